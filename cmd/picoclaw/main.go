@@ -8,17 +8,26 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"embed"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/fs"
+	"log"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/chzyer/readline"
 	"github.com/joho/godotenv"
@@ -29,13 +38,23 @@ import (
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/cron"
 	"github.com/sipeed/picoclaw/pkg/devices"
+	"github.com/sipeed/picoclaw/pkg/federation"
+	"github.com/sipeed/picoclaw/pkg/filelink"
 	"github.com/sipeed/picoclaw/pkg/heartbeat"
 	"github.com/sipeed/picoclaw/pkg/logger"
 	"github.com/sipeed/picoclaw/pkg/migrate"
+	"github.com/sipeed/picoclaw/pkg/openaiapi"
 	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/quota"
+	"github.com/sipeed/picoclaw/pkg/scheduler"
+	"github.com/sipeed/picoclaw/pkg/secrets"
+	"github.com/sipeed/picoclaw/pkg/session"
 	"github.com/sipeed/picoclaw/pkg/skills"
 	"github.com/sipeed/picoclaw/pkg/state"
+	"github.com/sipeed/picoclaw/pkg/tasks"
 	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/tui"
+	"github.com/sipeed/picoclaw/pkg/utils"
 	"github.com/sipeed/picoclaw/pkg/voice"
 )
 
@@ -117,8 +136,57 @@ func copyDirectory(src, dst string) error {
 	})
 }
 
+// Global flags, taken out of os.Args before the command runs.
+var (
+	configFlag      string   // --config: the config file to use
+	configOverrides []string // --set key=value, applied over everything else
+	profileFlag     string   // --profile: the profile to apply over the config
+	debugFlag       bool     // --debug on agent, run or gateway: log at debug level whatever the config says
+)
+
+// parseGlobalFlags removes --config, --set and --profile from args.
+func parseGlobalFlags(args []string) ([]string, error) {
+	rest := args[:0:0]
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name, value, inline := strings.Cut(arg, "=")
+		if name != "--config" && name != "--set" && name != "--profile" {
+			rest = append(rest, arg)
+			continue
+		}
+		if !inline {
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("%s needs a value", arg)
+			}
+			i++
+			value = args[i]
+		}
+		switch name {
+		case "--config":
+			configFlag = value
+		case "--profile":
+			profileFlag = value
+		default:
+			configOverrides = append(configOverrides, value)
+		}
+	}
+	return rest, nil
+}
+
 func main() {
+	args, err := parseGlobalFlags(os.Args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	os.Args = args
+
 	if len(os.Args) < 2 {
+		// echo "question" | picoclaw
+		if stdinPiped() {
+			runTask("", "text", "")
+			return
+		}
 		printHelp()
 		os.Exit(1)
 	}
@@ -126,10 +194,18 @@ func main() {
 	command := os.Args[1]
 
 	switch command {
+	case tools.LandlockHelperCommand:
+		// Internal: run an exec command under the landlock backend's rules
+		if err := tools.RunLandlockHelper(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "picoclaw landlock: %v\n", err)
+			os.Exit(126)
+		}
 	case "onboard":
 		onboard()
 	case "agent":
 		agentCmd()
+	case "run":
+		runCmd()
 	case "gateway":
 		gatewayCmd()
 	case "status":
@@ -191,9 +267,24 @@ func main() {
 		}
 	case "config":
 		configCmd()
+	case "guard":
+		guardCmd()
+	case "secret":
+		secretCmd()
+	case "export":
+		exportCmd()
+	case "fork":
+		forkCmd()
+	case "ingest":
+		ingestCmd()
 	case "version", "--version", "-v":
 		printVersion()
 	default:
+		// cat error.log | picoclaw "explain this"
+		if stdinPiped() || strings.ContainsAny(command, " \t\n") {
+			runTask(strings.Join(os.Args[1:], " "), "text", "")
+			return
+		}
 		fmt.Printf("Unknown command: %s\n", command)
 		printHelp()
 		os.Exit(1)
@@ -207,6 +298,7 @@ func printHelp() {
 	fmt.Println("Commands:")
 	fmt.Println("  onboard     Initialize picoclaw configuration and workspace")
 	fmt.Println("  agent       Interact with the agent directly")
+	fmt.Println("  run         Run one task and print the result (-p, --output json)")
 	fmt.Println("  auth        Manage authentication (login, logout, status)")
 	fmt.Println("  gateway     Start picoclaw gateway")
 	fmt.Println("  status      Show picoclaw status")
@@ -214,7 +306,17 @@ func printHelp() {
 	fmt.Println("  migrate     Migrate from OpenClaw to PicoClaw")
 	fmt.Println("  skills      Manage skills (install, list, remove)")
 	fmt.Println("  config      Manage configuration (get, set, list)")
+	fmt.Println("  guard       Inspect exec safety rules (list, test)")
+	fmt.Println("  secret      Keep API keys in the OS keyring (set, get, list, delete)")
+	fmt.Println("  export      Write a session transcript as Markdown or HTML")
+	fmt.Println("  fork        Copy a session up to a turn, optionally with another model, and replay the next turn")
+	fmt.Println("  ingest      Add documents or web pages to the knowledge base the agent searches")
 	fmt.Println("  version     Show version information")
+	fmt.Println()
+	fmt.Println("Global flags:")
+	fmt.Println("  --config <file>      Config file, JSON or YAML (default: see README)")
+	fmt.Println("  --set <key>=<value>  Override a config key, e.g. --set agents.defaults.model=gpt-4o")
+	fmt.Println("  --profile <name>     Use a profile from agents.profiles")
 }
 
 func onboard() {
@@ -374,12 +476,15 @@ func migrateHelp() {
 func agentCmd() {
 	message := ""
 	sessionKey := "cli:default"
+	dryRun := false
+	showStats := true
+	plain := false
 
 	args := os.Args[2:]
 	for i := 0; i < len(args); i++ {
 		switch args[i] {
 		case "--debug", "-d":
-			logger.SetLevel(logger.DEBUG)
+			enableDebug()
 			fmt.Println("🔍 Debug mode enabled")
 		case "-m", "--message":
 			if i+1 < len(args) {
@@ -391,6 +496,12 @@ func agentCmd() {
 				sessionKey = args[i+1]
 				i++
 			}
+		case "--dry-run":
+			dryRun = true
+		case "--no-stats":
+			showStats = false
+		case "--plain":
+			plain = true
 		}
 	}
 
@@ -408,6 +519,24 @@ func agentCmd() {
 
 	msgBus := bus.NewMessageBus()
 	agentLoop := agent.NewAgentLoop(cfg, msgBus, provider)
+	agents := &switchableAgent{
+		loop:    agentLoop,
+		profile: cfg.Agents.Defaults.Profile,
+		msgBus:  msgBus,
+		setup: func(al *agent.AgentLoop) {
+			al.SetApprovalPersist(persistApprovalRule)
+			al.SetDryRun(dryRun)
+		},
+	}
+	agents.setup(agentLoop)
+	if dryRun {
+		fmt.Println("🧪 Dry run: mutating tools only describe what they would do")
+	}
+	stdinReader := bufio.NewReader(os.Stdin)
+	agents.SetApprover(cliApprover(func(prompt string) (string, error) {
+		fmt.Print(prompt)
+		return stdinReader.ReadString('\n')
+	}))
 
 	// Print agent startup info (only for interactive mode)
 	startupInfo := agentLoop.GetStartupInfo()
@@ -427,18 +556,288 @@ func agentCmd() {
 		}
 		fmt.Printf("\n%s %s\n", logo, response)
 	} else {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go config.Watch(ctx, getConfigPath(), cfg, agents.loadConfig, func(updated *config.Config) {
+			agents.Agent().ApplyConfig(updated)
+		})
+
+		if !plain && isTerminal() && runTUI(agents, msgBus, sessionKey) {
+			return
+		}
 		fmt.Printf("%s Interactive mode (Ctrl+C to exit)\n\n", logo)
-		interactiveMode(agentLoop, sessionKey)
+		interactiveMode(agents, sessionKey, newStatusLine(showStats))
+	}
+}
+
+// runCmd runs one task without interaction and prints the answer, or with
+// --output json a result scripts can parse. It exits 1 if the task failed.
+func runCmd() {
+	prompt := ""
+	output := "text"
+	sessionKey := ""
+
+	args := os.Args[2:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--debug", "-d":
+			enableDebug()
+		case "-p", "--prompt":
+			if i+1 < len(args) {
+				prompt = args[i+1]
+				i++
+			}
+		case "-o", "--output":
+			if i+1 < len(args) {
+				output = args[i+1]
+				i++
+			}
+		case "-s", "--session":
+			if i+1 < len(args) {
+				sessionKey = args[i+1]
+				i++
+			}
+		}
+	}
+	if output != "text" && output != "json" {
+		fmt.Fprintln(os.Stderr, "Usage: picoclaw run -p <prompt> [--output text|json] [-s <session>]")
+		os.Exit(2)
+	}
+	runTask(prompt, output, sessionKey)
+}
+
+// maxPipedInput bounds the stdin attached to a prompt; the rest is cut.
+const maxPipedInput = 256 << 10
+
+// runTask runs prompt as a one-shot task, with anything piped to stdin
+// attached, and prints the result as text or JSON.
+func runTask(prompt, output, sessionKey string) {
+	if stdinPiped() {
+		data, err := io.ReadAll(io.LimitReader(os.Stdin, maxPipedInput+1))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading stdin: %v\n", err)
+			os.Exit(1)
+		}
+		prompt = withPipedInput(prompt, data)
+	}
+	if strings.TrimSpace(prompt) == "" {
+		fmt.Fprintln(os.Stderr, "Usage: picoclaw run -p <prompt> [--output text|json] [-s <session>]")
+		fmt.Fprintln(os.Stderr, "       <command> | picoclaw \"<prompt>\"")
+		os.Exit(2)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	provider, err := providers.CreateProvider(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating provider: %v\n", err)
+		os.Exit(1)
+	}
+
+	agentLoop := agent.NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+	// Nobody is there to answer, so tools that need approval are refused
+	agentLoop.SetApprover(func(ctx context.Context, req tools.ApprovalRequest) (tools.ApprovalDecision, error) {
+		return tools.ApprovalDeny, fmt.Errorf("approval can't be asked for in picoclaw run")
+	})
+
+	result := agentLoop.RunOneShot(context.Background(), prompt, sessionKey)
+	if output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(result)
+	} else if result.Error == "" {
+		fmt.Println(result.Response)
+	}
+	if result.Error != "" {
+		if output == "text" {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", result.Error)
+		}
+		os.Exit(1)
+	}
+}
+
+// withPipedInput attaches data read from stdin to prompt, or makes it the
+// prompt if there is none.
+func withPipedInput(prompt string, data []byte) string {
+	cut := len(data) > maxPipedInput
+	if cut {
+		data = data[:maxPipedInput]
+		// Drop a character split by the cut
+		for i := 0; i < utf8.UTFMax && len(data) > 0 && !utf8.Valid(data); i++ {
+			data = data[:len(data)-1]
+		}
+	}
+	if bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data) {
+		fmt.Fprintln(os.Stderr, "Error: stdin is not text")
+		os.Exit(2)
+	}
+	input := strings.TrimRight(string(data), "\n")
+	if cut {
+		input += fmt.Sprintf("\n[input cut at %d KB]", maxPipedInput>>10)
+	}
+	if strings.TrimSpace(input) == "" {
+		return prompt
+	}
+	if strings.TrimSpace(prompt) == "" {
+		return input
+	}
+	return fmt.Sprintf("%s\n\nInput (piped to stdin):\n```\n%s\n```", prompt, input)
+}
+
+// stdinPiped reports whether stdin is a pipe or file rather than a
+// terminal or /dev/null.
+func stdinPiped() bool {
+	fi, err := os.Stdin.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice == 0
+}
+
+// runTUI runs the full-screen interface. It returns false, leaving the
+// screen alone, if the terminal can't host it.
+func runTUI(agents *switchableAgent, msgBus *bus.MessageBus, sessionKey string) bool {
+	app := tui.New(profileBackend{agents}, sessionKey)
+	msgBus.WatchActivity("cli", app.Activity)
+	defer msgBus.WatchActivity("cli", nil)
+	agents.SetApprover(app.Approve)
+
+	// Log lines would tear the screen; keep them in a file instead
+	logFile, err := os.OpenFile(filepath.Join(os.TempDir(), "picoclaw-tui.log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err == nil {
+		log.SetOutput(logFile)
+		defer logFile.Close()
+	} else {
+		log.SetOutput(io.Discard)
+	}
+	defer log.SetOutput(os.Stderr)
+
+	if err := app.Run(); err != nil {
+		logger.DebugCF("tui", "Falling back to line mode", map[string]interface{}{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// switchableAgent is the agent of an interactive session. /profile replaces
+// it with one built for another profile, on the same bus and with the same
+// approver.
+type switchableAgent struct {
+	mu       sync.RWMutex
+	loop     *agent.AgentLoop
+	profile  string
+	msgBus   *bus.MessageBus
+	approver tools.Approver
+	setup    func(al *agent.AgentLoop) // applied to each new agent
+}
+
+// Agent returns the current agent.
+func (s *switchableAgent) Agent() *agent.AgentLoop {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.loop
+}
+
+// SetApprover sets the approver of the current agent and those to come.
+func (s *switchableAgent) SetApprover(approver tools.Approver) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.approver = approver
+	s.loop.SetApprover(approver)
+}
+
+// loadConfig loads the config for the current profile.
+func (s *switchableAgent) loadConfig() (*config.Config, error) {
+	s.mu.RLock()
+	profile := s.profile
+	s.mu.RUnlock()
+	if profile == "" {
+		profile = config.DefaultProfile
+	}
+	return loadProfileConfig(profile)
+}
+
+// Switch builds an agent for profile and makes it current. The old agent's
+// background commands are stopped.
+func (s *switchableAgent) Switch(profile string) (*config.Config, error) {
+	cfg, err := loadProfileConfig(profile)
+	if err != nil {
+		return nil, err
+	}
+	provider, err := providers.CreateProvider(cfg)
+	if err != nil {
+		return nil, err
+	}
+	al := agent.NewAgentLoop(cfg, s.msgBus, provider)
+	s.setup(al)
+
+	s.mu.Lock()
+	old := s.loop
+	s.loop, s.profile = al, cfg.Agents.Defaults.Profile
+	if s.approver != nil {
+		al.SetApprover(s.approver)
+	}
+	s.mu.Unlock()
+	old.Stop()
+	return cfg, nil
+}
+
+// switchProfile handles "/profile <name>" in the CLI.
+func (s *switchableAgent) switchProfile(name string) string {
+	cfg, err := s.Switch(name)
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err)
+	}
+	return fmt.Sprintf("👤 Switched to profile %s: %s in %s", name, cfg.Agents.Defaults.Model, cfg.WorkspacePath())
+}
+
+// profileBackend is the TUI backend of a switchableAgent, answering
+// "/profile <name>" itself.
+type profileBackend struct {
+	agents *switchableAgent
+}
+
+func (b profileBackend) Send(ctx context.Context, session, text string) (string, error) {
+	if name, ok := strings.CutPrefix(text, "/profile "); ok && strings.TrimSpace(name) != "" {
+		return b.agents.switchProfile(strings.TrimSpace(name)), nil
+	}
+	return tui.AgentBackend(b.agents.Agent()).Send(ctx, session, text)
+}
+
+func (b profileBackend) Sessions() []agent.SessionInfo {
+	return tui.AgentBackend(b.agents.Agent()).Sessions()
+}
+
+func (b profileBackend) History(session string) []providers.Message {
+	return tui.AgentBackend(b.agents.Agent()).History(session)
+}
+
+func (b profileBackend) Models() []string {
+	return tui.AgentBackend(b.agents.Agent()).Models()
+}
+
+func (b profileBackend) Model(session string) string {
+	return tui.AgentBackend(b.agents.Agent()).Model(session)
+}
+
+// isTerminal reports whether stdin and stdout are both terminals.
+func isTerminal() bool {
+	for _, f := range []*os.File{os.Stdin, os.Stdout} {
+		if fi, err := f.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+			return false
+		}
 	}
+	return true
 }
 
-func interactiveMode(agentLoop *agent.AgentLoop, sessionKey string) {
+func interactiveMode(agents *switchableAgent, sessionKey string, status *statusLine) {
 	prompt := fmt.Sprintf("%s You: ", logo)
 
 	rl, err := readline.NewEx(&readline.Config{
 		Prompt:          prompt,
 		HistoryFile:     filepath.Join(os.TempDir(), ".picoclaw_history"),
 		HistoryLimit:    100,
+		AutoComplete:    replCompleter(agents),
 		InterruptPrompt: "^C",
 		EOFPrompt:       "exit",
 	})
@@ -446,11 +845,17 @@ func interactiveMode(agentLoop *agent.AgentLoop, sessionKey string) {
 	if err != nil {
 		fmt.Printf("Error initializing readline: %v\n", err)
 		fmt.Println("Falling back to simple input mode...")
-		simpleInteractiveMode(agentLoop, sessionKey)
+		simpleInteractiveMode(agents, sessionKey, status)
 		return
 	}
 	defer rl.Close()
 
+	agents.SetApprover(status.Approver(cliApprover(func(approvalPrompt string) (string, error) {
+		rl.SetPrompt(approvalPrompt)
+		defer rl.SetPrompt(prompt)
+		return rl.Readline()
+	})))
+
 	for {
 		line, err := rl.Readline()
 		if err != nil {
@@ -472,8 +877,14 @@ func interactiveMode(agentLoop *agent.AgentLoop, sessionKey string) {
 			return
 		}
 
-		ctx := context.Background()
-		response, err := agentLoop.ProcessDirect(ctx, input, sessionKey)
+		if next, ok := replCommand(agents, input, sessionKey); ok {
+			sessionKey = next
+			continue
+		}
+
+		response, err := status.Run(func(ctx context.Context) (string, error) {
+			return agents.Agent().ProcessDirect(ctx, input, sessionKey)
+		})
 		if err != nil {
 			fmt.Printf("Error: %v\n", err)
 			continue
@@ -483,8 +894,150 @@ func interactiveMode(agentLoop *agent.AgentLoop, sessionKey string) {
 	}
 }
 
-func simpleInteractiveMode(agentLoop *agent.AgentLoop, sessionKey string) {
+// replCommand runs the slash commands the CLI answers itself: /help,
+// /session, which picks the session to talk in, and /profile <name>. It returns the session to
+// use next, and false for input the agent should get, including its own
+// slash commands.
+func replCommand(agents *switchableAgent, input, sessionKey string) (string, bool) {
+	fields := strings.Fields(input)
+	switch fields[0] {
+	case "/help":
+		fmt.Println("\nCommands:")
+		fmt.Println("  /session new           Start a new session")
+		fmt.Println("  /session resume [n]    List sessions, or switch to one by number or key")
+		fmt.Println("  /session fork [turn] [model]  Continue in a copy of this session, cut after a turn")
+		fmt.Println("  /profile <name>        Switch to a profile, with its own sessions")
+		for _, cmd := range agent.Commands() {
+			fmt.Printf("  %s\n", cmd.Usage)
+		}
+		fmt.Println("  exit                   Leave; Tab completes commands")
+		fmt.Println()
+		return sessionKey, true
+	case "/profile":
+		if len(fields) != 2 {
+			// The agent lists the profiles
+			return sessionKey, false
+		}
+		fmt.Printf("%s\n\n", agents.switchProfile(fields[1]))
+		return sessionKey, true
+	case "/session":
+	default:
+		return sessionKey, false
+	}
+
+	sessions := agents.Agent().ListSessions("cli:")
+	switch {
+	case len(fields) == 2 && fields[1] == "new":
+		sessionKey = "cli:" + time.Now().Format("20060102-150405")
+		fmt.Printf("Started session %s\n\n", sessionKey)
+	case len(fields) == 3 && fields[1] == "resume":
+		target := fields[2]
+		if n, err := strconv.Atoi(target); err == nil && n >= 1 && n <= len(sessions) {
+			target = sessions[n-1].Key
+		}
+		if !strings.HasPrefix(target, "cli:") {
+			target = "cli:" + target
+		}
+		history := agents.Agent().SessionHistory(target)
+		if len(history) == 0 {
+			fmt.Printf("No session %s; /session resume lists them\n\n", target)
+			break
+		}
+		sessionKey = target
+		fmt.Printf("Resumed session %s (%d messages)\n", sessionKey, len(history))
+		for i := len(history) - 1; i >= 0; i-- {
+			if history[i].Role == "assistant" && history[i].Content != "" {
+				fmt.Printf("\n%s %s\n", logo, utils.Truncate(history[i].Content, 500))
+				break
+			}
+		}
+		fmt.Println()
+	case len(fields) >= 2 && len(fields) <= 4 && fields[1] == "fork":
+		turns, model := -1, ""
+		for _, arg := range fields[2:] {
+			if n, err := strconv.Atoi(arg); err == nil && turns < 0 {
+				turns = n
+			} else {
+				model = arg
+			}
+		}
+		fork := forkKey(sessionKey)
+		if err := agents.Agent().ForkSession(sessionKey, fork, turns, model); err != nil {
+			fmt.Printf("Can't fork: %v\n\n", err)
+			break
+		}
+		sessionKey = fork
+		fmt.Printf("Forked into session %s (%d messages, model %s)\n\n",
+			sessionKey, len(agents.Agent().SessionHistory(sessionKey)), agents.Agent().SessionModel(sessionKey))
+	case len(fields) <= 2 && (len(fields) == 1 || fields[1] == "resume"):
+		fmt.Printf("Current session: %s\n", sessionKey)
+		for i, info := range sessions {
+			fmt.Printf("  %2d. %-24s %3d messages  %s\n", i+1, strings.TrimPrefix(info.Key, "cli:"), info.Messages, info.Title)
+		}
+		fmt.Println("Switch with /session resume <number>, or start one with /session new")
+		fmt.Println()
+	default:
+		fmt.Printf("Usage: /session new | /session resume [number|key] | /session fork [turn] [model]\n\n")
+	}
+	return sessionKey, true
+}
+
+// replCompleter completes commands with Tab: their names, and the models,
+// tools and sessions they take.
+func replCompleter(agents *switchableAgent) *readline.PrefixCompleter {
+	sessions := func(string) []string {
+		var keys []string
+		for _, info := range agents.Agent().ListSessions("cli:") {
+			keys = append(keys, strings.TrimPrefix(info.Key, "cli:"))
+		}
+		return keys
+	}
+	models := func(string) []string {
+		return append(agents.Agent().KnownModels(), "reset")
+	}
+	items := []readline.PrefixCompleterInterface{
+		readline.PcItem("/help"),
+		readline.PcItem("/session",
+			readline.PcItem("new"),
+			readline.PcItem("resume", readline.PcItemDynamic(sessions)),
+			readline.PcItem("fork")),
+	}
+	for _, cmd := range agent.Commands() {
+		switch cmd.Name {
+		case "model":
+			items = append(items, readline.PcItem("/model", readline.PcItemDynamic(models)))
+		case "tools":
+			items = append(items, readline.PcItem("/tools",
+				readline.PcItem("on"),
+				readline.PcItem("off"),
+				readline.PcItemDynamic(func(string) []string { return agents.Agent().ToolNames() },
+					readline.PcItem("on"),
+					readline.PcItem("off"))))
+		case "profile":
+			profiles := func(string) []string {
+				return append([]string{config.DefaultProfile}, agents.Agent().Profiles()...)
+			}
+			items = append(items, readline.PcItem("/profile", readline.PcItemDynamic(profiles)))
+		case "persona":
+			personas := func(string) []string {
+				return append(agents.Agent().Personas(), "none", "reset")
+			}
+			items = append(items, readline.PcItem("/persona", readline.PcItemDynamic(personas)))
+		case "dryrun", "voice":
+			items = append(items, readline.PcItem("/"+cmd.Name, readline.PcItem("on"), readline.PcItem("off")))
+		default:
+			items = append(items, readline.PcItem("/"+cmd.Name))
+		}
+	}
+	return readline.NewPrefixCompleter(items...)
+}
+
+func simpleInteractiveMode(agents *switchableAgent, sessionKey string, status *statusLine) {
 	reader := bufio.NewReader(os.Stdin)
+	agents.SetApprover(status.Approver(cliApprover(func(prompt string) (string, error) {
+		fmt.Print(prompt)
+		return reader.ReadString('\n')
+	})))
 	for {
 		fmt.Print(fmt.Sprintf("%s You: ", logo))
 		line, err := reader.ReadString('\n')
@@ -507,8 +1060,14 @@ func simpleInteractiveMode(agentLoop *agent.AgentLoop, sessionKey string) {
 			return
 		}
 
-		ctx := context.Background()
-		response, err := agentLoop.ProcessDirect(ctx, input, sessionKey)
+		if next, ok := replCommand(agents, input, sessionKey); ok {
+			sessionKey = next
+			continue
+		}
+
+		response, err := status.Run(func(ctx context.Context) (string, error) {
+			return agents.Agent().ProcessDirect(ctx, input, sessionKey)
+		})
 		if err != nil {
 			fmt.Printf("Error: %v\n", err)
 			continue
@@ -518,12 +1077,125 @@ func simpleInteractiveMode(agentLoop *agent.AgentLoop, sessionKey string) {
 	}
 }
 
+// statusLine shows how a turn is going below the prompt: time elapsed,
+// tokens generated and their rate, and the tool running, so a slow local
+// model doesn't look hung. It is only drawn on a terminal.
+type statusLine struct {
+	enabled bool
+	mu      sync.Mutex
+	paused  bool
+	drawn   bool
+}
+
+func newStatusLine(enabled bool) *statusLine {
+	if fi, err := os.Stdout.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		enabled = false
+	}
+	return &statusLine{enabled: enabled}
+}
+
+// Run runs a turn, refreshing the line until it returns. Ctrl-C stops the
+// turn instead of picoclaw.
+func (s *statusLine) Run(turn func(ctx context.Context) (string, error)) (string, error) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+	go func() {
+		select {
+		case <-interrupts:
+			cancel(agent.ErrStopped)
+		case <-ctx.Done():
+		}
+	}()
+
+	if !s.enabled {
+		return turn(ctx)
+	}
+	tracker := agent.NewTurnTracker()
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(500 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				s.draw("")
+				return
+			case <-ticker.C:
+				s.draw(formatTurnStats(tracker.Stats()))
+			}
+		}
+	}()
+	response, err := turn(agent.WithTurnTracker(ctx, tracker))
+	close(done)
+	<-stopped
+	return response, err
+}
+
+// Approver clears the line while approver asks the user.
+func (s *statusLine) Approver(approver tools.Approver) tools.Approver {
+	return func(ctx context.Context, req tools.ApprovalRequest) (tools.ApprovalDecision, error) {
+		s.draw("")
+		s.mu.Lock()
+		s.paused = true
+		s.mu.Unlock()
+		defer func() {
+			s.mu.Lock()
+			s.paused = false
+			s.mu.Unlock()
+		}()
+		return approver(ctx, req)
+	}
+}
+
+func (s *statusLine) draw(text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.paused || (text == "" && !s.drawn) {
+		return
+	}
+	fmt.Print("\r\033[K" + text)
+	s.drawn = text != ""
+}
+
+func formatTurnStats(stats agent.TurnStats) string {
+	line := fmt.Sprintf("⏳ %s", stats.Elapsed.Round(time.Second))
+	if stats.Tokens > 0 {
+		line += fmt.Sprintf(" · %d tokens · %.1f tok/s", stats.Tokens, stats.TokensPerSec)
+	}
+	if stats.Tools != "" {
+		return line + " · running " + stats.Tools
+	}
+	return line + " · thinking"
+}
+
+// cliApprover answers tool approval prompts from the terminal.
+func cliApprover(readLine func(prompt string) (string, error)) tools.Approver {
+	return func(ctx context.Context, req tools.ApprovalRequest) (tools.ApprovalDecision, error) {
+		fmt.Printf("\n⚠️  Tool %s wants to run:\n\n%s\n\n", req.Tool, req.Summary)
+		answer, err := readLine("Approve? [y]es / [a]lways / [N]o: ")
+		if err != nil {
+			return tools.ApprovalDeny, err
+		}
+		return tools.ParseApprovalReply(answer), nil
+	}
+}
+
+// persistApprovalRule saves an always-allow decision to the config file.
+func persistApprovalRule(rule string) error {
+	return config.AddApprovalRule(getConfigPath(), rule)
+}
+
 func gatewayCmd() {
 	// Check for --debug flag
 	args := os.Args[2:]
 	for _, arg := range args {
 		if arg == "--debug" || arg == "-d" {
-			logger.SetLevel(logger.DEBUG)
+			enableDebug()
 			fmt.Println("🔍 Debug mode enabled")
 			break
 		}
@@ -543,6 +1215,7 @@ func gatewayCmd() {
 
 	msgBus := bus.NewMessageBus()
 	agentLoop := agent.NewAgentLoop(cfg, msgBus, provider)
+	agentLoop.SetApprovalPersist(persistApprovalRule)
 
 	// Print agent startup info
 	fmt.Println("\n📦 Agent Status:")
@@ -553,6 +1226,9 @@ func gatewayCmd() {
 	fmt.Printf("  • Skills: %d/%d available\n",
 		skillsInfo["available"],
 		skillsInfo["total"])
+	if lowMem, _ := startupInfo["low_memory"].(bool); lowMem {
+		fmt.Println("  • Low-memory mode: on")
+	}
 
 	// Log to file as well
 	logger.InfoCF("agent", "Agent initialized",
@@ -563,7 +1239,7 @@ func gatewayCmd() {
 		})
 
 	// Setup cron tool and service
-	cronService := setupCronTool(agentLoop, msgBus, cfg.WorkspacePath())
+	cronService := setupCronTool(agentLoop, msgBus, cfg)
 
 	heartbeatService := heartbeat.NewHeartbeatService(
 		cfg.WorkspacePath(),
@@ -588,24 +1264,28 @@ func gatewayCmd() {
 		// sent to user via processSystemMessage when the async task completes
 		return tools.SilentResult(response)
 	})
+	reminderLoc := reminderLocation(cfg.Tools.Reminders)
+	heartbeatService.AddContext("Due in the next 24 hours", func() string {
+		return upcomingJobs(cronService, reminderLoc)
+	})
+	heartbeatService.AddContext("Still running", agentLoop.PendingWork)
 
 	channelManager, err := channels.NewManager(cfg, msgBus)
 	if err != nil {
 		fmt.Printf("Error creating channel manager: %v\n", err)
 		os.Exit(1)
 	}
-
-	var transcriber *voice.GroqTranscriber
-	if cfg.Providers.Groq.APIKey != "" {
-		transcriber = voice.NewGroqTranscriber(cfg.Providers.Groq.APIKey)
-		logger.InfoC("voice", "Groq voice transcription enabled")
-	}
-
-	if transcriber != nil {
-		if telegramChannel, ok := channelManager.GetChannel("telegram"); ok {
-			if tc, ok := telegramChannel.(*channels.TelegramChannel); ok {
-				tc.SetTranscriber(transcriber)
-				logger.InfoC("voice", "Groq transcription attached to Telegram channel")
+	agentLoop.SetQuietHours(channelManager.QuietHours())
+
+	if transcriber := newTranscriber(cfg); transcriber != nil {
+		for _, name := range channelManager.GetEnabledChannels() {
+			ch, _ := channelManager.GetChannel(name)
+			if ta, ok := ch.(channels.TranscriberAware); ok {
+				ta.SetTranscriber(transcriber)
+				logger.InfoCF("voice", "Voice transcription attached to channel", map[string]interface{}{
+					"channel":  name,
+					"provider": cfg.Voice.STT.Provider,
+				})
 			}
 		}
 	}
@@ -633,6 +1313,13 @@ func gatewayCmd() {
 	}
 	fmt.Println("✓ Heartbeat service started")
 
+	var taskScheduler *scheduler.Scheduler
+	if cfg.Scheduler.Enabled {
+		taskScheduler = scheduler.New(cfg.Scheduler, filepath.Join(cfg.WorkspacePath(), "state"), agentLoop, msgBus)
+		taskScheduler.Start(ctx)
+		fmt.Printf("✓ Scheduler started (%d tasks)\n", len(taskScheduler.Tasks()))
+	}
+
 	stateManager := state.NewManager(cfg.WorkspacePath())
 	deviceService := devices.NewService(devices.Config{
 		Enabled:    cfg.Devices.Enabled,
@@ -651,20 +1338,120 @@ func gatewayCmd() {
 
 	go agentLoop.Run(ctx)
 
+	// Pick up edits to the config file without a restart
+	go config.Watch(ctx, getConfigPath(), cfg, loadConfig, func(updated *config.Config) {
+		agentLoop.ApplyConfig(updated)
+		channelManager.ApplyConfig(updated)
+	})
+
+	server := startGatewayServer(cfg, agentLoop, channelManager)
+
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt)
 	<-sigChan
 
 	fmt.Println("\nShutting down...")
 	cancel()
+	if server != nil {
+		server.Close()
+	}
 	deviceService.Stop()
 	heartbeatService.Stop()
+	if taskScheduler != nil {
+		taskScheduler.Stop()
+	}
 	cronService.Stop()
 	agentLoop.Stop()
 	channelManager.StopAll(ctx)
 	fmt.Println("✓ Gateway stopped")
 }
 
+// newTranscriber returns the engine voice.stt selects for voice messages,
+// or nil if it isn't set up.
+func newTranscriber(cfg *config.Config) voice.Transcriber {
+	stt := cfg.Voice.STT
+	switch strings.ToLower(stt.Provider) {
+	case "whisper-server":
+		if stt.URL == "" {
+			logger.WarnC("voice", "voice.stt.url is not set, voice messages won't be transcribed")
+			return nil
+		}
+		logger.InfoCF("voice", "whisper.cpp server transcription enabled", map[string]interface{}{"url": stt.URL})
+		return voice.NewWhisperServerTranscriber(stt.URL, stt.Language)
+	case "whisper":
+		t, err := voice.NewWhisperCLITranscriber(stt.Path, stt.ModelPath(), stt.Language)
+		if err != nil {
+			logger.WarnCF("voice", "whisper.cpp is not available, voice messages won't be transcribed",
+				map[string]interface{}{"error": err.Error()})
+			return nil
+		}
+		logger.InfoC("voice", "Local whisper.cpp transcription enabled")
+		return t
+	default:
+		if cfg.Providers.Groq.APIKey == "" {
+			return nil
+		}
+		logger.InfoC("voice", "Groq voice transcription enabled")
+		return voice.NewGroqTranscriber(cfg.Providers.Groq.APIKey)
+	}
+}
+
+// startGatewayServer serves the gateway's HTTP endpoints on
+// gateway.host:gateway.port. It returns nil if none are enabled.
+func startGatewayServer(cfg *config.Config, agentLoop *agent.AgentLoop, channelManager *channels.Manager) *http.Server {
+	mux := http.NewServeMux()
+	enabled := false
+
+	if cfg.Federation.Enabled {
+		mux.Handle(federation.TaskPath, federation.NewServer(agent.FederationPeers(cfg), agentLoop.HandleFederatedTask))
+		fmt.Printf("✓ Federation enabled as %q (%d peers)\n", cfg.Federation.Name, len(cfg.Federation.Peers))
+		enabled = true
+	}
+
+	if api := cfg.Gateway.OpenAI; api.Enabled {
+		server, err := openaiapi.NewServer(api.ModelName, api.APIKeys, agentLoop.HandleChatCompletion)
+		if err != nil {
+			fmt.Printf("Error starting OpenAI-compatible API: %v\n", err)
+		} else {
+			mux.Handle("/v1/", server)
+			fmt.Printf("✓ OpenAI-compatible API at http://%s/v1 (model %q)\n",
+				net.JoinHostPort(cfg.Gateway.Host, strconv.Itoa(cfg.Gateway.Port)), api.ModelName)
+			enabled = true
+		}
+	}
+
+	if links := channelManager.Links(); links != nil {
+		mux.Handle(filelink.Path, links)
+		fmt.Printf("✓ Attachment links enabled at %s%s\n", strings.TrimRight(cfg.Gateway.Links.BaseURL, "/"), filelink.Path)
+		enabled = true
+	}
+
+	for _, name := range channelManager.GetEnabledChannels() {
+		channel, _ := channelManager.GetChannel(name)
+		if h, ok := channel.(channels.HTTPChannel); ok {
+			mux.Handle(h.HTTPPath(), h)
+			fmt.Printf("✓ %s channel at http://%s%s\n", name,
+				net.JoinHostPort(cfg.Gateway.Host, strconv.Itoa(cfg.Gateway.Port)), h.HTTPPath())
+			enabled = true
+		}
+	}
+
+	if !enabled {
+		return nil
+	}
+
+	server := &http.Server{
+		Addr:    net.JoinHostPort(cfg.Gateway.Host, strconv.Itoa(cfg.Gateway.Port)),
+		Handler: mux,
+	}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.ErrorCF("gateway", "HTTP server failed", map[string]interface{}{"error": err.Error()})
+		}
+	}()
+	return server
+}
+
 func statusCmd() {
 	cfg, err := loadConfig()
 	if err != nil {
@@ -694,6 +1481,10 @@ func statusCmd() {
 	} else {
 		fmt.Println("Workspace:", workspace, "✗")
 	}
+	if disk := cfg.Resources.Disk; disk.MaxMB > 0 {
+		report := quota.New(int64(disk.MaxMB)<<20, disk.WarnPercent, agent.DiskAreas(workspace)...).Scan()
+		fmt.Println("Disk:", report)
+	}
 
 	if _, err := os.Stat(configPath); err == nil {
 		fmt.Printf("Model: %s\n", cfg.Agents.Defaults.Model)
@@ -833,7 +1624,7 @@ func authLoginOpenAI(useDeviceCode bool) {
 		os.Exit(1)
 	}
 
-	appCfg, err := loadConfig()
+	appCfg, err := loadConfigFile()
 	if err == nil {
 		appCfg.Providers.OpenAI.AuthMethod = "oauth"
 		if err := config.SaveConfig(getConfigPath(), appCfg); err != nil {
@@ -859,7 +1650,7 @@ func authLoginPasteToken(provider string) {
 		os.Exit(1)
 	}
 
-	appCfg, err := loadConfig()
+	appCfg, err := loadConfigFile()
 	if err == nil {
 		switch provider {
 		case "anthropic":
@@ -895,7 +1686,7 @@ func authLogoutCmd() {
 			os.Exit(1)
 		}
 
-		appCfg, err := loadConfig()
+		appCfg, err := loadConfigFile()
 		if err == nil {
 			switch provider {
 			case "openai":
@@ -913,7 +1704,7 @@ func authLogoutCmd() {
 			os.Exit(1)
 		}
 
-		appCfg, err := loadConfig()
+		appCfg, err := loadConfigFile()
 		if err == nil {
 			appCfg.Providers.OpenAI.AuthMethod = ""
 			appCfg.Providers.Anthropic.AuthMethod = ""
@@ -960,11 +1751,18 @@ func authStatusCmd() {
 }
 
 func getConfigPath() string {
-	home, _ := os.UserHomeDir()
-	return filepath.Join(home, ".picoclaw", "config.json")
+	if configFlag != "" {
+		if strings.HasPrefix(configFlag, "~/") {
+			home, _ := os.UserHomeDir()
+			return filepath.Join(home, configFlag[2:])
+		}
+		return configFlag
+	}
+	return config.ConfigPath()
 }
 
-func setupCronTool(agentLoop *agent.AgentLoop, msgBus *bus.MessageBus, workspace string) *cron.CronService {
+func setupCronTool(agentLoop *agent.AgentLoop, msgBus *bus.MessageBus, cfg *config.Config) *cron.CronService {
+	workspace := cfg.WorkspacePath()
 	cronStorePath := filepath.Join(workspace, "cron", "jobs.json")
 
 	// Create cron service
@@ -974,8 +1772,20 @@ func setupCronTool(agentLoop *agent.AgentLoop, msgBus *bus.MessageBus, workspace
 	cronTool := tools.NewCronTool(cronService, agentLoop, msgBus, workspace)
 	agentLoop.RegisterTool(cronTool)
 
+	// Reminders share the cron store but are delivered by their own tool
+	reminderTool := tools.NewReminderTool(cronService, msgBus, reminderLocation(cfg.Tools.Reminders), agentLoop.LastActiveChat)
+	agentLoop.RegisterTool(reminderTool)
+
+	if cfg.Tools.Tasks.Enabled {
+		setupTasksTool(agentLoop, cronService, cfg)
+	}
+
 	// Set the onJob handler
 	cronService.SetOnJob(func(job *cron.CronJob) (string, error) {
+		if job.Payload.Kind == cron.PayloadReminder {
+			reminderTool.Deliver(job)
+			return "ok", nil
+		}
 		result := cronTool.ExecuteJob(context.Background(), job)
 		return result, nil
 	})
@@ -983,15 +1793,131 @@ func setupCronTool(agentLoop *agent.AgentLoop, msgBus *bus.MessageBus, workspace
 	return cronService
 }
 
-func loadConfig() (*config.Config, error) {
-	// Load env files (ignore errors if files don't exist)
-	_ = godotenv.Load(".config.env") // Ollama/local config
-	_ = godotenv.Load(".env")        // General secrets
-	_ = godotenv.Load()              // Default .env in current dir
-
-	return config.LoadConfig(getConfigPath())
-}
-
+// setupTasksTool registers the tasks tool, whose reminders are delivered
+// by the reminder tool.
+func setupTasksTool(agentLoop *agent.AgentLoop, cronService *cron.CronService, cfg *config.Config) {
+	store, err := tasks.Open(filepath.Join(cfg.WorkspacePath(), "tasks.db"))
+	if err != nil {
+		logger.WarnCF("tasks", "Tasks tool disabled", map[string]interface{}{"error": err.Error()})
+		return
+	}
+	loc := reminderLocation(cfg.Tools.Reminders)
+	var remote tasks.Remote
+	switch taskCfg := cfg.Tools.Tasks; {
+	case taskCfg.Todoist.Token != "":
+		remote = tasks.NewTodoist(taskCfg.Todoist.Token, loc)
+	case taskCfg.CalDAV.URL != "":
+		remote = tasks.NewCalDAV(taskCfg.CalDAV.URL, taskCfg.CalDAV.Username, taskCfg.CalDAV.Password, loc)
+	}
+	agentLoop.RegisterTool(tools.NewTasksTool(store, remote, cronService, loc))
+}
+
+// reminderLocation returns the zone reminder times are read in.
+func reminderLocation(cfg config.RemindersConfig) *time.Location {
+	if cfg.Timezone == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		logger.WarnCF("reminder", "Unknown reminders timezone, using the host's",
+			map[string]interface{}{"timezone": cfg.Timezone, "error": err.Error()})
+		return time.Local
+	}
+	return loc
+}
+
+// upcomingJobs lists the reminders and cron jobs due within the next day,
+// soonest first, for the heartbeat prompt.
+func upcomingJobs(cronService *cron.CronService, loc *time.Location) string {
+	now := time.Now()
+	jobs := cronService.ListJobs(false)
+	sort.Slice(jobs, func(i, j int) bool {
+		return nextRunMS(jobs[i]) < nextRunMS(jobs[j])
+	})
+	var sb strings.Builder
+	for _, job := range jobs {
+		next := nextRunMS(job)
+		if next == 0 || time.UnixMilli(next).Sub(now) > 24*time.Hour {
+			continue
+		}
+		kind := "Job"
+		if job.Payload.Kind == cron.PayloadReminder {
+			kind = "Reminder"
+		}
+		fmt.Fprintf(&sb, "- %s at %s: %s\n", kind, time.UnixMilli(next).In(loc).Format("Mon 15:04"), job.Payload.Message)
+	}
+	return sb.String()
+}
+
+func nextRunMS(job cron.CronJob) int64 {
+	if job.State.NextRunAtMS == nil {
+		return 0
+	}
+	return *job.State.NextRunAtMS
+}
+
+// loadConfig loads the config with the profile from --profile, or else
+// agents.defaults.profile, applied.
+func loadConfig() (*config.Config, error) {
+	return loadProfileConfig(profileFlag)
+}
+
+// loadProfileConfig loads the config with profile applied; "" picks
+// agents.defaults.profile.
+func loadProfileConfig(profile string) (*config.Config, error) {
+	// Load env files (ignore errors if files don't exist)
+	_ = godotenv.Load(".config.env") // Ollama/local config
+	_ = godotenv.Load(".env")        // General secrets
+	_ = godotenv.Load()              // Default .env in current dir
+
+	cfg, err := config.LoadConfig(getConfigPath())
+	if err != nil {
+		return nil, err
+	}
+	if err := config.ApplyOverrides(cfg, configOverrides); err != nil {
+		return nil, err
+	}
+	if profile == "" {
+		profile = cfg.Agents.Defaults.Profile
+	}
+	if profile != "" {
+		if err := cfg.ApplyProfile(profile); err != nil {
+			return nil, err
+		}
+	}
+	if err := applyLogging(cfg.Logging); err != nil {
+		return nil, fmt.Errorf("logging: %w", err)
+	}
+	return cfg, nil
+}
+
+// enableDebug handles --debug.
+func enableDebug() {
+	debugFlag = true
+	logger.SetLevel(logger.DEBUG)
+}
+
+// applyLogging sets up the logger from the config; --debug wins over the
+// configured level.
+func applyLogging(cfg config.LoggingConfig) error {
+	opts := logger.Options{
+		Level:      cfg.Level,
+		Format:     cfg.Format,
+		File:       cfg.File,
+		Components: cfg.Components,
+	}
+	if debugFlag {
+		opts.Level = "debug"
+	}
+	return logger.Configure(opts)
+}
+
+// loadConfigFile loads the config file alone, without environment or
+// --set overrides, for commands that write it back.
+func loadConfigFile() (*config.Config, error) {
+	return config.LoadConfigFile(getConfigPath())
+}
+
 func cronCmd() {
 	if len(os.Args) < 3 {
 		cronHelp()
@@ -1439,6 +2365,120 @@ func configCmd() {
 	}
 }
 
+func secretCmd() {
+	if len(os.Args) < 3 {
+		secretHelp()
+		return
+	}
+	store := secrets.Default()
+	args := os.Args[3:]
+
+	switch os.Args[2] {
+	case "set":
+		name, useFor := "", ""
+		for i := 0; i < len(args); i++ {
+			if args[i] == "--for" && i+1 < len(args) {
+				useFor = args[i+1]
+				i++
+			} else if name == "" {
+				name = args[i]
+			}
+		}
+		if err := secrets.ValidateName(name); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			fmt.Println("Usage: picoclaw secret set <name> [--for <config key>]")
+			os.Exit(2)
+		}
+		if useFor != "" {
+			if err := config.CheckSecretKey(useFor); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(2)
+			}
+		}
+		value, err := readSecretValue(name)
+		if err != nil || value == "" {
+			fmt.Printf("Error: no value read: %v\n", err)
+			os.Exit(1)
+		}
+		if err := store.Set(name, value); err != nil {
+			fmt.Printf("Error saving to the %s: %v\n", store.Name(), err)
+			os.Exit(1)
+		}
+		fmt.Printf("✓ Saved %s in the %s\n", name, store.Name())
+		if useFor == "" {
+			fmt.Printf("Use it with a config value of \"%s\"\n", secrets.Ref(name))
+			return
+		}
+		if err := config.UseSecret(getConfigPath(), useFor, name); err != nil {
+			fmt.Printf("Error updating the config: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✓ %s now reads it from the keyring\n", useFor)
+	case "get":
+		if len(args) != 1 {
+			fmt.Println("Usage: picoclaw secret get <name>")
+			os.Exit(2)
+		}
+		value, err := store.Get(args[0])
+		if err != nil {
+			fmt.Printf("Error: %s: %v\n", args[0], err)
+			os.Exit(1)
+		}
+		fmt.Println(value)
+	case "list":
+		names, err := store.List()
+		if err != nil {
+			fmt.Printf("Error reading the %s: %v\n", store.Name(), err)
+			os.Exit(1)
+		}
+		if len(names) == 0 {
+			fmt.Printf("No secrets in the %s\n", store.Name())
+			return
+		}
+		fmt.Printf("Secrets in the %s:\n", store.Name())
+		for _, name := range names {
+			fmt.Printf("  %s\n", name)
+		}
+	case "delete", "rm":
+		if len(args) != 1 {
+			fmt.Println("Usage: picoclaw secret delete <name>")
+			os.Exit(2)
+		}
+		if err := store.Delete(args[0]); err != nil {
+			fmt.Printf("Error: %s: %v\n", args[0], err)
+			os.Exit(1)
+		}
+		fmt.Printf("✓ Deleted %s\n", args[0])
+	default:
+		fmt.Printf("Unknown secret command: %s\n", os.Args[2])
+		secretHelp()
+	}
+}
+
+// readSecretValue reads a secret from stdin: without echo on a terminal,
+// or all of it, less the final newline, when piped.
+func readSecretValue(name string) (string, error) {
+	if stdinPiped() {
+		data, err := io.ReadAll(io.LimitReader(os.Stdin, 64<<10))
+		return strings.TrimRight(string(data), "\r\n"), err
+	}
+	value, err := readline.Password(fmt.Sprintf("Value for %s: ", name))
+	return string(value), err
+}
+
+func secretHelp() {
+	fmt.Println("Usage: picoclaw secret <command>")
+	fmt.Println()
+	fmt.Println("Commands:")
+	fmt.Println("  set <name> [--for <key>]  Save a secret, typed or piped; --for points a config key at it")
+	fmt.Println("  get <name>                Print a secret")
+	fmt.Println("  list                      List the saved secrets")
+	fmt.Println("  delete <name>             Delete a secret")
+	fmt.Println()
+	fmt.Println("Config values of \"keyring:<name>\" are read from the OS keyring, e.g.:")
+	fmt.Println("  picoclaw secret set openai --for providers.openai.api_key")
+}
+
 func configHelp() {
 	fmt.Println("Usage: picoclaw config <command>")
 	fmt.Println()
@@ -1460,6 +2500,163 @@ func configHelp() {
 	fmt.Println("  picoclaw config set ollama.api_base http://192.168.1.100:11434")
 }
 
+func guardCmd() {
+	if len(os.Args) < 3 {
+		guardHelp()
+		return
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	workspace := cfg.WorkspacePath()
+	execTool := tools.NewExecTool(workspace, cfg.Agents.Defaults.RestrictToWorkspace)
+	execTool.SetSharedFolders(cfg.SharedFolderPaths())
+	if backend := cfg.Tools.Exec.Backend; backend == "docker" || backend == "podman" {
+		execTool.SetBackend(tools.NewContainerBackend(backend, cfg.Tools.Exec.Image, workspace))
+	}
+	if err := agent.ConfigureExecGuard(execTool, cfg.Tools.Exec); err != nil {
+		fmt.Printf("Invalid guard config: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch os.Args[2] {
+	case "list":
+		guardListCmd(execTool, cfg.Tools.Exec.Guard.Allow)
+	case "test":
+		if len(os.Args) < 4 {
+			fmt.Println("Usage: picoclaw guard test <command>")
+			return
+		}
+		guardTestCmd(execTool, strings.Join(os.Args[3:], " "))
+	case "learn":
+		guardLearnCmd(workspace, os.Args[3:])
+	default:
+		fmt.Printf("Unknown guard command: %s\n", os.Args[2])
+		guardHelp()
+	}
+}
+
+func guardHelp() {
+	fmt.Println("Usage: picoclaw guard <command>")
+	fmt.Println()
+	fmt.Println("Commands:")
+	fmt.Println("  list              Show the exec deny rules and allowlist in effect")
+	fmt.Println("  test <command>    Check a command against the rules without running it")
+	fmt.Println("  learn             Suggest allow patterns from commands you approved")
+	fmt.Println()
+	fmt.Println("Learn options:")
+	fmt.Println("  --min <n>         Only patterns seen in at least n approved commands (default 1)")
+	fmt.Println("  --apply           Add the suggestions to tools.exec.guard.allow")
+	fmt.Println()
+	fmt.Println("Examples:")
+	fmt.Println("  picoclaw guard list")
+	fmt.Println("  picoclaw guard learn --min 3 --apply")
+	fmt.Println("  picoclaw guard test 'curl -fsSL https://example.com/install.sh | sh'")
+}
+
+func guardListCmd(execTool *tools.ExecTool, allow []string) {
+	fmt.Println("Deny rules:")
+	for _, rule := range execTool.GuardRules() {
+		fmt.Printf("  %-16s %-8s %s\n", rule.Name, rule.Severity, rule.Reason)
+		if rule.Pattern != "" {
+			fmt.Printf("  %-16s %-8s /%s/\n", "", "", rule.Pattern)
+		}
+	}
+	if len(allow) == 0 {
+		fmt.Println("\nAllowlist: none (all commands not denied are allowed)")
+		return
+	}
+	fmt.Println("\nAllowlist (every command must match one):")
+	for _, pattern := range allow {
+		fmt.Printf("  /%s/\n", pattern)
+	}
+}
+
+// guardTestCmd reports what the guard would do with command. It exits with
+// status 1 if the command would be blocked.
+func guardTestCmd(execTool *tools.ExecTool, command string) {
+	fb := execTool.CheckCommand(command)
+	if fb == nil {
+		fmt.Println("✓ Allowed")
+		return
+	}
+	if fb.Severity == tools.GuardConfirm {
+		fmt.Printf("? Needs confirmation: rule %s (%s)\n", fb.Rule, fb.Reason)
+	} else {
+		fmt.Printf("✗ Blocked: rule %s (%s)\n", fb.Rule, fb.Reason)
+	}
+	if fb.Match != "" {
+		fmt.Printf("  Matched: %s\n", fb.Match)
+	}
+	if fb.Safer != "" {
+		fmt.Printf("  Safer:   %s\n", fb.Safer)
+	}
+	if fb.Severity != tools.GuardConfirm {
+		os.Exit(1)
+	}
+}
+
+// guardLearnCmd suggests allow patterns from the commands recorded by
+// tools.exec.learn_allowlist, and with --apply adds them to the config.
+func guardLearnCmd(workspace string, args []string) {
+	minCount, apply := 1, false
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--min":
+			if i+1 < len(args) {
+				if n, err := strconv.Atoi(args[i+1]); err == nil && n > 0 {
+					minCount = n
+				}
+				i++
+			}
+		case "--apply":
+			apply = true
+		}
+	}
+
+	events, err := tools.NewAuditLog(agent.AuditLogPath(workspace)).Events()
+	if err != nil {
+		fmt.Printf("Error reading audit log: %v\n", err)
+		os.Exit(1)
+	}
+	var commands []string
+	for _, event := range events {
+		if event.Event == tools.AuditCommandApproved {
+			commands = append(commands, event.Command)
+		}
+	}
+	if len(commands) == 0 {
+		fmt.Println("No approved commands recorded yet.")
+		fmt.Println("Set tools.exec.learn_allowlist to true and keep exec in tools.approval.require_confirmation.")
+		return
+	}
+
+	suggestions := tools.SuggestAllowPatterns(commands, minCount)
+	fmt.Printf("Suggested allow patterns from %d approved commands:\n\n", len(commands))
+	patterns := make([]string, len(suggestions))
+	for i, s := range suggestions {
+		patterns[i] = s.Pattern
+		fmt.Printf("  %-32s %4dx  e.g. %s\n", s.Pattern, s.Count, s.Example)
+	}
+	if len(patterns) == 0 {
+		fmt.Printf("  none seen at least %d times\n", minCount)
+		return
+	}
+
+	if !apply {
+		fmt.Println("\nReview them, then run with --apply to add them to tools.exec.guard.allow.")
+		return
+	}
+	if err := config.AddAllowPatterns(getConfigPath(), patterns); err != nil {
+		fmt.Printf("Error saving config: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("\n✓ Added %d patterns to tools.exec.guard.allow; only matching commands will run from now on.\n", len(patterns))
+}
+
 func configListCmd() {
 	cfg, err := loadConfig()
 	if err != nil {
@@ -1500,7 +2697,7 @@ func configGetCmd(key string) {
 }
 
 func configSetCmd(key, value string) {
-	cfg, err := loadConfig()
+	cfg, err := loadConfigFile()
 	if err != nil {
 		fmt.Printf("Error loading config: %v\n", err)
 		return
@@ -1604,3 +2801,361 @@ func maskKey(key string) string {
 	}
 	return key[:4] + "****" + key[len(key)-4:]
 }
+
+func exportCmd() {
+	format, output := "", ""
+	var keys []string
+	args := os.Args[2:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-f", "--format":
+			if i+1 < len(args) {
+				format = args[i+1]
+				i++
+			}
+		case "-o", "--output":
+			if i+1 < len(args) {
+				output = args[i+1]
+				i++
+			}
+		default:
+			keys = append(keys, args[i])
+		}
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	sessions := session.NewSessionManager(cfg.SessionsPath())
+	if len(keys) != 1 {
+		exportHelp(sessions)
+		return
+	}
+
+	key, err := findSession(sessions, keys[0])
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	s, _ := sessions.Get(key)
+	if format == "" {
+		format = session.FormatMarkdown
+		if ext := strings.ToLower(filepath.Ext(output)); ext == ".html" || ext == ".htm" {
+			format = session.FormatHTML
+		}
+	}
+
+	if output == "" {
+		if err := session.Export(os.Stdout, s, format); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	var buf bytes.Buffer
+	if err := session.Export(&buf, s, format); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(output, buf.Bytes(), 0644); err != nil {
+		fmt.Printf("Error writing %s: %v\n", output, err)
+		os.Exit(1)
+	}
+	fmt.Printf("✓ Exported %s to %s\n", key, output)
+}
+
+// findSession resolves name to a session key: the key itself, or the one
+// key containing it, such as "123" for "telegram:123".
+func findSession(sessions *session.SessionManager, name string) (string, error) {
+	if _, ok := sessions.Get(name); ok {
+		return name, nil
+	}
+	var matches []string
+	for _, info := range sessions.List("") {
+		if strings.Contains(info.Key, name) {
+			matches = append(matches, info.Key)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no session matches %q", name)
+	case 1:
+		return matches[0], nil
+	}
+	return "", fmt.Errorf("%q matches several sessions: %s", name, strings.Join(matches, ", "))
+}
+
+func exportHelp(sessions *session.SessionManager) {
+	fmt.Println("Usage: picoclaw export <session> [options]")
+	fmt.Println()
+	fmt.Println("Options:")
+	fmt.Println("  -f, --format <format>  markdown (default) or html")
+	fmt.Println("  -o, --output <file>    Write to a file instead of stdout; .html picks html")
+	infos := sessions.List("")
+	if len(infos) == 0 {
+		return
+	}
+	fmt.Println()
+	fmt.Println("Recent sessions:")
+	for i, info := range infos {
+		if i == 10 {
+			fmt.Printf("  … and %d more\n", len(infos)-i)
+			break
+		}
+		fmt.Printf("  %-30s %4d messages, updated %s\n", info.Key, info.Messages, info.Updated.Format("2006-01-02 15:04"))
+	}
+}
+
+func forkCmd() {
+	turns, model, name, replay := -1, "", "", false
+	var keys []string
+	args := os.Args[2:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-t", "--turn":
+			if i+1 < len(args) {
+				n, err := strconv.Atoi(args[i+1])
+				if err != nil || n < 0 {
+					fmt.Printf("Error: --turn needs a number of turns, got %q\n", args[i+1])
+					os.Exit(1)
+				}
+				turns = n
+				i++
+			}
+		case "-m", "--model":
+			if i+1 < len(args) {
+				model = args[i+1]
+				i++
+			}
+		case "--as":
+			if i+1 < len(args) {
+				name = args[i+1]
+				i++
+			}
+		case "--replay":
+			replay = true
+		default:
+			keys = append(keys, args[i])
+		}
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	sessions := session.NewSessionManager(cfg.SessionsPath())
+	if len(keys) != 1 {
+		forkHelp()
+		return
+	}
+	src, err := findSession(sessions, keys[0])
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if name == "" {
+		name = forkKey(src)
+	}
+	original, _ := sessions.Get(src)
+	total := len(session.TurnStarts(original.Messages))
+	if replay && turns < 0 {
+		// Replaying needs a turn after the fork: redo the last one
+		turns = total - 1
+	}
+	next, originalReply, hasNext := session.Turn(original.Messages, turns+1)
+	if replay && !hasNext {
+		fmt.Printf("Error: %s has %d turns, so there is no turn %d to replay\n", src, total, turns+1)
+		os.Exit(1)
+	}
+
+	if err := sessions.Fork(src, name, turns); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if model != "" {
+		overrides := sessions.GetOverrides(name)
+		overrides.Model = model
+		sessions.SetOverrides(name, overrides)
+	}
+	if err := sessions.Save(name); err != nil {
+		fmt.Printf("Error saving %s: %v\n", name, err)
+		os.Exit(1)
+	}
+	kept := total
+	if turns >= 0 {
+		kept = turns
+	}
+	fmt.Printf("✓ Forked %s into %s with %d of %d turns\n", src, name, kept, total)
+	if !replay {
+		fmt.Printf("Continue it with: picoclaw agent -s %s\n", name)
+		return
+	}
+
+	provider, err := providers.CreateProvider(cfg)
+	if err != nil {
+		fmt.Printf("Error creating provider: %v\n", err)
+		os.Exit(1)
+	}
+	agentLoop := agent.NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+	// Nobody is there to answer, so tools that need approval are refused
+	agentLoop.SetApprover(func(ctx context.Context, req tools.ApprovalRequest) (tools.ApprovalDecision, error) {
+		return tools.ApprovalDeny, fmt.Errorf("approval can't be asked for in picoclaw fork --replay")
+	})
+
+	fmt.Printf("\nTurn %d: %s\n", turns+1, next)
+	fmt.Printf("\n━━ Original reply ━━\n%s\n", originalReply)
+	result := agentLoop.RunOneShot(context.Background(), next, name)
+	fmt.Printf("\n━━ Replay with %s ━━\n", result.Model)
+	if result.Error != "" {
+		fmt.Printf("Failed: %s\n", result.Error)
+		os.Exit(1)
+	}
+	fmt.Println(result.Response)
+	fmt.Printf("\nContinue it with: picoclaw agent -s %s\n", name)
+}
+
+// forkKey names a fork of the session key.
+func forkKey(key string) string {
+	return key + "-fork-" + time.Now().Format("20060102-150405")
+}
+
+func forkHelp() {
+	fmt.Println("Usage: picoclaw fork <session> [options]")
+	fmt.Println()
+	fmt.Println("Copies a session into a new one, leaving the original as it is.")
+	fmt.Println()
+	fmt.Println("Options:")
+	fmt.Println("  -t, --turn <n>      Keep only the first n turns (default: all)")
+	fmt.Println("  -m, --model <name>  Use this model in the fork")
+	fmt.Println("  --as <key>          Name the fork (default: <session>-fork-<time>)")
+	fmt.Println("  --replay            Send turn n+1 again in the fork and show both replies")
+}
+
+func ingestCmd() {
+	list := false
+	var remove, sources []string
+	args := os.Args[2:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-l", "--list":
+			list = true
+		case "--remove":
+			if i+1 < len(args) {
+				remove = append(remove, args[i+1])
+				i++
+			}
+		case "-h", "--help":
+			ingestHelp()
+			return
+		default:
+			sources = append(sources, args[i])
+		}
+	}
+	if !list && len(remove) == 0 && len(sources) == 0 {
+		ingestHelp()
+		return
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	store := agent.NewKnowledgeStore(cfg.WorkspacePath(), cfg)
+
+	for _, source := range remove {
+		if !strings.Contains(source, "://") {
+			if abs, err := filepath.Abs(source); err == nil {
+				source = abs
+			}
+		}
+		removed, err := store.Remove(source)
+		switch {
+		case err != nil:
+			fmt.Printf("Error removing %s: %v\n", source, err)
+			os.Exit(1)
+		case removed:
+			fmt.Printf("Removed %s\n", source)
+		default:
+			fmt.Printf("%s is not in the knowledge base\n", source)
+		}
+	}
+
+	// Directories are read file by file
+	var files []string
+	for _, source := range sources {
+		info, err := os.Stat(source)
+		if err != nil || !info.IsDir() {
+			files = append(files, source)
+			continue
+		}
+		filepath.WalkDir(source, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() && path != source && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if !d.IsDir() && agent.IsKnowledgeFile(path) {
+				files = append(files, path)
+			}
+			return nil
+		})
+	}
+
+	failed := 0
+	if len(files) > 0 {
+		how := "keywords only; set tools.knowledge.embedding to search by meaning"
+		if e := store.Embedder(); e != nil {
+			how = "embedded with " + e.Model()
+		}
+		fmt.Printf("Ingesting %d source(s), %s\n", len(files), how)
+	}
+	for _, source := range files {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		doc, pages, err := agent.ReadKnowledgeSource(ctx, source)
+		if err == nil {
+			doc, err = store.Ingest(ctx, doc, pages)
+		}
+		cancel()
+		if err != nil {
+			fmt.Printf("  ✗ %s: %v\n", source, err)
+			failed++
+			continue
+		}
+		fmt.Printf("  ✓ %s: %d page(s), %d chunks\n", source, doc.Pages, doc.Chunks)
+	}
+
+	if list {
+		docs := store.Documents()
+		if len(docs) == 0 {
+			fmt.Println("The knowledge base is empty.")
+		}
+		for _, d := range docs {
+			model := d.Model
+			if model == "" {
+				model = "keywords only"
+			}
+			fmt.Printf("  %s\n    %d page(s), %d chunks, %s, added %s\n", d.Source, d.Pages, d.Chunks,
+				model, d.IngestedAt.Format("2006-01-02 15:04"))
+		}
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func ingestHelp() {
+	fmt.Println("Usage: picoclaw ingest <path|url>... [options]")
+	fmt.Println()
+	fmt.Println("Adds PDF, DOCX and EPUB documents, HTML pages and text files to the")
+	fmt.Println("knowledge base the agent searches with knowledge_search. Folders are")
+	fmt.Println("read file by file. Ingesting a source again replaces it.")
+	fmt.Println()
+	fmt.Println("Options:")
+	fmt.Println("  -l, --list         List the ingested documents")
+	fmt.Println("  --remove <source>  Remove an ingested path or URL")
+}
@@ -13,6 +13,8 @@ require (
 	github.com/mymmrac/telego v1.6.0
 	github.com/openai/openai-go/v3 v3.21.0
 	golang.org/x/oauth2 v0.35.0
+	golang.org/x/sys v0.41.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -38,5 +40,4 @@ require (
 	golang.org/x/crypto v0.48.0 // indirect
 	golang.org/x/net v0.50.0 // indirect
 	golang.org/x/sync v0.19.0 // indirect
-	golang.org/x/sys v0.41.0 // indirect
 )
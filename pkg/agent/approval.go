@@ -0,0 +1,120 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// defaultApprovalWait bounds how long a turn waits for an approval reply.
+const defaultApprovalWait = 5 * time.Minute
+
+// SetApprover replaces how approval prompts are answered, e.g. by reading
+// from the terminal in interactive CLI mode. It has no effect unless
+// approvals are enabled in the config.
+func (al *AgentLoop) SetApprover(approver tools.Approver) {
+	if al.approvals != nil {
+		al.approvals.SetApprover(approver)
+	}
+	for _, execTool := range al.execTools {
+		execTool.SetGuardApprover(approver)
+	}
+}
+
+// SetApprovalPersist sets the function that saves always-allow decisions.
+func (al *AgentLoop) SetApprovalPersist(persist func(rule string) error) {
+	if al.approvals != nil {
+		al.approvals.SetPersist(persist)
+	}
+}
+
+// requestApprovalViaBus sends the prompt to the chat the request came from
+// and waits for the next message from that chat.
+func (al *AgentLoop) requestApprovalViaBus(ctx context.Context, req tools.ApprovalRequest) (tools.ApprovalDecision, error) {
+	if req.Channel == "" || req.ChatID == "" || constants.IsInternalChannel(req.Channel) {
+		return tools.ApprovalDeny, fmt.Errorf("no user chat to ask for approval")
+	}
+
+	key := req.Channel + ":" + req.ChatID
+	reply := make(chan string, 1)
+	if _, busy := al.pendingReplies.LoadOrStore(key, reply); busy {
+		return tools.ApprovalDeny, fmt.Errorf("another approval is already pending in this chat")
+	}
+	defer al.pendingReplies.Delete(key)
+
+	al.bus.PublishOutbound(bus.OutboundMessage{
+		Channel: req.Channel,
+		ChatID:  req.ChatID,
+		Content: req.Prompt(),
+	})
+	al.bus.PublishActivity(bus.Activity{
+		Channel: req.Channel,
+		ChatID:  req.ChatID,
+		Kind:    bus.ActivityApproval,
+		Tool:    req.Tool,
+		Detail:  req.Summary,
+	})
+
+	wait := al.approvalWait
+	if wait <= 0 {
+		wait = defaultApprovalWait
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case answer := <-reply:
+		return tools.ParseApprovalReply(answer), nil
+	case <-timer.C:
+		al.bus.PublishOutbound(bus.OutboundMessage{
+			Channel: req.Channel,
+			ChatID:  req.ChatID,
+			Content: fmt.Sprintf("No answer, `%s` was not run.", req.Tool),
+		})
+		return tools.ApprovalDeny, fmt.Errorf("timed out waiting for approval")
+	case <-ctx.Done():
+		return tools.ApprovalDeny, ctx.Err()
+	}
+}
+
+// deliverApprovalReply routes msg to a turn waiting for approval in the same
+// chat. It returns false if no approval is pending there. Reactions only
+// answer when the channel turned them into a reply, such as Slack's ✅.
+func (al *AgentLoop) deliverApprovalReply(msg bus.InboundMessage) bool {
+	if msg.Metadata["reaction"] != "" && msg.Content == "" {
+		return false
+	}
+	value, ok := al.pendingReplies.Load(msg.Channel + ":" + msg.ChatID)
+	if !ok {
+		return false
+	}
+	select {
+	case value.(chan string) <- msg.Content:
+		return true
+	default:
+		return false
+	}
+}
+
+// learnApprovedCommands returns an approval observer that records the
+// commands the user approves, for "picoclaw guard learn".
+func learnApprovedCommands(log *tools.AuditLog) func(tools.ApprovalRequest, tools.ApprovalDecision) {
+	return func(req tools.ApprovalRequest, decision tools.ApprovalDecision) {
+		if decision == tools.ApprovalDeny {
+			return
+		}
+		if command := tools.ApprovedCommand(req); command != "" {
+			log.Record(tools.AuditEvent{
+				Event:   tools.AuditCommandApproved,
+				Tool:    req.Tool,
+				Command: command,
+				Channel: req.Channel,
+				ChatID:  req.ChatID,
+			})
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package agent
+
+import (
+	"path/filepath"
+
+	"github.com/sipeed/picoclaw/pkg/budget"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// newBudget returns a tracker for the configured budgets, kept in
+// state/budget.json, or nil if none is set.
+func newBudget(cfg config.BudgetConfig, workspace string) *budget.Tracker {
+	if cfg.SessionTokens <= 0 && cfg.SessionUSD <= 0 && cfg.DailyTokens <= 0 && cfg.DailyUSD <= 0 {
+		return nil
+	}
+	prices := make(map[string]budget.Price, len(cfg.Prices))
+	for model, p := range cfg.Prices {
+		prices[model] = budget.Price{Prompt: p.Prompt, Completion: p.Completion}
+	}
+	return budget.New(filepath.Join(workspace, "state", "budget.json"), budget.Limits{
+		SessionTokens: cfg.SessionTokens,
+		SessionUSD:    cfg.SessionUSD,
+		DailyTokens:   cfg.DailyTokens,
+		DailyUSD:      cfg.DailyUSD,
+		WarnPercent:   cfg.WarnPercent,
+	}, prices)
+}
+
+// checkBudget returns an error once the chat's or the day's budget is used
+// up, so the turn stops before the next model call.
+func (al *AgentLoop) checkBudget(sessionKey string) error {
+	err := al.budget.Check(sessionKey)
+	if err != nil {
+		logger.WarnCF("agent", "Budget used up, not calling the model",
+			map[string]interface{}{"session_key": sessionKey, "error": err.Error()})
+	}
+	return err
+}
+
+// budgetWarning returns a note for the end of the reply the first time the
+// chat's or the day's usage nears a budget, and "" otherwise.
+func (al *AgentLoop) budgetWarning(sessionKey string) string {
+	if warning := al.budget.Warning(sessionKey); warning != "" {
+		return "\n\n" + warning
+	}
+	return ""
+}
@@ -0,0 +1,48 @@
+package agent
+
+import (
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/calendar"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// registerCalendarTool adds the calendar tool when it is enabled and at
+// least one calendar is configured. Misconfigured calendars are logged and
+// left out rather than failing startup.
+func registerCalendarTool(registry *tools.ToolRegistry, cfg config.CalendarConfig) {
+	if !cfg.Enabled {
+		return
+	}
+	loc := time.Local
+	if cfg.Timezone != "" {
+		tz, err := time.LoadLocation(cfg.Timezone)
+		if err != nil {
+			logger.WarnCF("agent", "Unknown calendar timezone, using the host's",
+				map[string]interface{}{"timezone": cfg.Timezone, "error": err.Error()})
+		} else {
+			loc = tz
+		}
+	}
+
+	var sources []calendar.Source
+	for _, c := range cfg.Calendars {
+		switch {
+		case c.Name == "":
+			logger.WarnCF("agent", "Skipping calendar without a name", nil)
+		case c.Type == "caldav" && c.URL != "":
+			sources = append(sources, calendar.NewCalDAV(c.Name, c.URL, c.Username, c.Password, loc, c.ReadOnly))
+		case (c.Type == "ics" || c.Type == "") && c.Path != "":
+			sources = append(sources, calendar.NewFile(c.Name, c.FilePath(), loc, c.ReadOnly))
+		default:
+			logger.WarnCF("agent", "Skipping calendar: type must be caldav (with url) or ics (with path)",
+				map[string]interface{}{"calendar": c.Name, "type": c.Type})
+		}
+	}
+	if len(sources) == 0 {
+		return
+	}
+	registry.Register(tools.NewCalendarTool(sources, loc))
+}
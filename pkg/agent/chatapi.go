@@ -0,0 +1,39 @@
+package agent
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/sipeed/picoclaw/pkg/openaiapi"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// HandleChatCompletion answers a request to the OpenAI-compatible API with
+// a full agent turn. The client sends the whole conversation every time,
+// so the turn runs in a throwaway session seeded with the earlier
+// messages, and nothing is kept once it is answered.
+func (al *AgentLoop) HandleChatCompletion(ctx context.Context, user string, messages []openaiapi.Message) (string, error) {
+	sessionKey := "openai:" + uuid.NewString()
+	history := make([]providers.Message, 0, len(messages)-1)
+	for _, m := range messages[:len(messages)-1] {
+		history = append(history, providers.Message{Role: m.Role, Content: m.Content})
+	}
+	al.sessions.SetHistory(sessionKey, history)
+	defer func() {
+		al.sessions.Delete(sessionKey)
+		al.usage.Delete(sessionKey)
+	}()
+
+	chatID := user
+	if chatID == "" {
+		chatID = "api"
+	}
+	return al.runAgentLoop(ctx, processOptions{
+		SessionKey:      sessionKey,
+		Channel:         "openai",
+		ChatID:          chatID,
+		SenderID:        user,
+		UserMessage:     messages[len(messages)-1].Content,
+		DefaultResponse: "I've completed processing but have no response to give.",
+	})
+}
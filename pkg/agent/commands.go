@@ -0,0 +1,157 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+// command is a slash command the agent answers itself, without the LLM.
+type command struct {
+	usage   string
+	handler func(ctx context.Context, al *AgentLoop, msg bus.InboundMessage, args string) (string, error)
+}
+
+// commands maps command names (without the slash) to their handlers.
+// Messages starting with an unknown command go to the LLM as usual.
+var commands = map[string]command{
+	"run": {
+		usage:   "/run workflow|report <name> [args]",
+		handler: runCommand,
+	},
+	"compare": {
+		usage:   "/compare <modelA> <modelB> <prompt>",
+		handler: compareCommand,
+	},
+	"shorter": {
+		usage:   "/shorter",
+		handler: shorterCommand,
+	},
+	"more": {
+		usage:   "/more detail",
+		handler: moreCommand,
+	},
+	"prefer": {
+		usage:   "/prefer <instruction>, e.g. /prefer no bullet lists",
+		handler: preferCommand,
+	},
+	"prefs": {
+		usage:   "/prefs [reset]",
+		handler: prefsCommand,
+	},
+	"voice": {
+		usage:   "/voice [on|off|always]",
+		handler: voiceCommand,
+	},
+	"dnd": {
+		usage:   "/dnd [2h|07:30|off]",
+		handler: dndCommand,
+	},
+	"pin": {
+		usage:   "/pin [text] (without text, pins my last reply)",
+		handler: pinCommand,
+	},
+	"pins": {
+		usage:   "/pins",
+		handler: pinsCommand,
+	},
+	"unpin": {
+		usage:   "/unpin <number|all>",
+		handler: unpinCommand,
+	},
+	"model": {
+		usage:   "/model [name|reset]",
+		handler: modelCommand,
+	},
+	"provider": {
+		usage:   "/provider [name|reset]",
+		handler: providerCommand,
+	},
+	"temp": {
+		usage:   "/temp [0-2|reset]",
+		handler: tempCommand,
+	},
+	"dryrun": {
+		usage:   "/dryrun [on|off]",
+		handler: dryRunCommand,
+	},
+	"context": {
+		usage:   "/context",
+		handler: contextCommand,
+	},
+	"tools": {
+		usage:   "/tools [on|off] or /tools <name> on|off",
+		handler: toolsCommand,
+	},
+	"usage": {
+		usage:   "/usage",
+		handler: usageCommand,
+	},
+	"compact": {
+		usage:   "/compact",
+		handler: compactCommand,
+	},
+	"plan": {
+		usage:   "/plan <goal>, /plan go, /plan cancel or /plan",
+		handler: planCommand,
+	},
+	"persona": {
+		usage:   "/persona [name|none|reset]",
+		handler: personaCommand,
+	},
+	"profile": {
+		usage:   "/profile [name] (switching works in picoclaw agent)",
+		handler: profileCommand,
+	},
+	"stop": {
+		usage:   "/stop",
+		handler: stopCommand,
+	},
+}
+
+// handleCommand runs msg as a slash command. It returns false if msg is not
+// a known command.
+func (al *AgentLoop) handleCommand(ctx context.Context, msg bus.InboundMessage) (string, bool) {
+	name, args, ok := parseCommand(msg.Content)
+	if !ok {
+		return "", false
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		return "", false
+	}
+
+	response, err := cmd.handler(ctx, al, msg, args)
+	if err != nil {
+		return fmt.Sprintf("Error: %v\nUsage: %s", err, cmd.usage), true
+	}
+	return response, true
+}
+
+// parseCommand splits a slash command into its lowercase name and
+// arguments. ok is false if content is not a slash command.
+func parseCommand(content string) (name, args string, ok bool) {
+	content = strings.TrimSpace(content)
+	if !strings.HasPrefix(content, "/") {
+		return "", "", false
+	}
+	name, args, _ = strings.Cut(content[1:], " ")
+	// Telegram appends the bot name in groups: /run@my_bot
+	name, _, _ = strings.Cut(name, "@")
+	return strings.ToLower(name), strings.TrimSpace(args), true
+}
+
+// runCommand dispatches "/run <kind> ...": workflows and reports.
+func runCommand(ctx context.Context, al *AgentLoop, msg bus.InboundMessage, args string) (string, error) {
+	kind, rest, _ := strings.Cut(args, " ")
+	switch kind {
+	case "workflow", "wf":
+		return al.runWorkflowCommand(ctx, msg, strings.TrimSpace(rest))
+	case "report":
+		return al.runReportCommand(ctx, msg, strings.TrimSpace(rest))
+	default:
+		return "", fmt.Errorf("unknown run target %q", kind)
+	}
+}
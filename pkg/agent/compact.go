@@ -0,0 +1,129 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// maxCompactMessageChars bounds each message fed to the summarizer, so
+// large tool outputs do not overflow a small model's context.
+const maxCompactMessageChars = 2000
+
+// compactSession is the summarize_session tool's backend. It folds the
+// history before the current tool call into the session summary, pins the
+// given facts, and restarts the history with the request being worked on.
+func (al *AgentLoop) compactSession(ctx context.Context, sessionKey string, pinned []string) (int, error) {
+	if _, busy := al.summarizing.LoadOrStore(sessionKey, true); busy {
+		return 0, fmt.Errorf("session is already being summarized")
+	}
+	defer al.summarizing.Delete(sessionKey)
+
+	// Keep the assistant message that called the tool, so its tool calls
+	// still get their results.
+	history := al.sessions.GetHistory(sessionKey)
+	cut := -1
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Role == "assistant" && len(history[i].ToolCalls) > 0 {
+			cut = i
+			break
+		}
+	}
+	if cut < 2 {
+		return 0, fmt.Errorf("not enough history to summarize")
+	}
+
+	summary, err := al.summarizeBatch(ctx, messagesForSummary(history[:cut]), al.sessions.GetSummary(sessionKey))
+	if err != nil {
+		return 0, err
+	}
+	if summary == "" {
+		return 0, fmt.Errorf("summarizer returned an empty summary")
+	}
+
+	request := "Continue the task in progress."
+	if turn, ok := al.sessions.CurrentTurn(sessionKey); ok && turn.UserMessage != "" {
+		request = turn.UserMessage
+	}
+	kept := append([]providers.Message{{Role: "user", Content: request}}, history[cut:]...)
+
+	al.sessions.AddPinned(sessionKey, pinned...)
+	al.sessions.SetSummary(sessionKey, summary)
+	al.sessions.SetHistory(sessionKey, kept)
+	if err := al.sessions.Save(sessionKey); err != nil {
+		logger.WarnCF("agent", "Failed to save compacted session",
+			map[string]interface{}{
+				"session_key": sessionKey,
+				"error":       err.Error(),
+			})
+	}
+
+	logger.InfoCF("agent", "Session compacted by model",
+		map[string]interface{}{
+			"session_key": sessionKey,
+			"folded":      cut,
+			"pinned":      len(pinned),
+		})
+	return cut, nil
+}
+
+// messagesForSummary flattens tool calls and results into text and trims
+// long contents for the summarizer.
+func messagesForSummary(history []providers.Message) []providers.Message {
+	out := make([]providers.Message, 0, len(history))
+	for _, m := range history {
+		content := m.Content
+		for _, tc := range m.ToolCalls {
+			name, args := tc.Name, ""
+			if tc.Function != nil {
+				name, args = tc.Function.Name, tc.Function.Arguments
+			}
+			content += fmt.Sprintf("\n[called %s %s]", name, utils.Truncate(args, 200))
+		}
+		out = append(out, providers.Message{
+			Role:    m.Role,
+			Content: utils.Truncate(strings.TrimSpace(content), maxCompactMessageChars),
+		})
+	}
+	return out
+}
+
+// sessionSummary returns the summary shown in the system prompt, followed
+// by the session's pinned facts.
+func (al *AgentLoop) sessionSummary(sessionKey string) string {
+	summary := al.sessions.GetSummary(sessionKey)
+	pinned := al.sessions.GetPinned(sessionKey)
+	if len(pinned) == 0 {
+		return summary
+	}
+
+	var sb strings.Builder
+	if summary != "" {
+		sb.WriteString(summary)
+		sb.WriteString("\n\n")
+	}
+	sb.WriteString("### Pinned Facts\n")
+	for _, fact := range pinned {
+		sb.WriteString("\n- ")
+		sb.WriteString(fact)
+	}
+	return sb.String()
+}
+
+// rebuildMessages rebuilds the LLM messages from the session after it was
+// compacted mid-turn. compactSession leaves the current request as the
+// first history message.
+func (al *AgentLoop) rebuildMessages(opts processOptions) []providers.Message {
+	history := al.sessions.GetHistory(opts.SessionKey)
+	request := opts.UserMessage
+	if len(history) > 0 && history[0].Role == "user" {
+		request = history[0].Content
+		history = history[1:]
+	}
+	messages := al.contextBuilder.BuildMessages(nil, al.sessionSummary(opts.SessionKey), request, nil, opts.Channel, opts.ChatID)
+	return append(messages, history...)
+}
@@ -0,0 +1,136 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// compareTools are the tools offered during /compare. The prompt runs once
+// per model, so only tools that change nothing may be used.
+var compareTools = map[string]bool{
+	"read_file":        true,
+	"read_document":    true,
+	"knowledge_search": true,
+	"table":            true,
+	"list_dir":         true,
+	"search":           true,
+	"web_search":       true,
+	"web_fetch":        true,
+	"weather":          true,
+	"list_processes":   true,
+	"read_output":      true,
+}
+
+// comparison is one model's answer in a /compare run.
+type comparison struct {
+	model            string
+	response         string
+	err              error
+	elapsed          time.Duration
+	promptTokens     int
+	completionTokens int
+}
+
+// compareCommand handles "/compare <modelA> <modelB> <prompt>".
+func compareCommand(ctx context.Context, al *AgentLoop, msg bus.InboundMessage, args string) (string, error) {
+	modelA, rest, _ := strings.Cut(args, " ")
+	modelB, prompt, _ := strings.Cut(strings.TrimSpace(rest), " ")
+	prompt = strings.TrimSpace(prompt)
+	if modelA == "" || modelB == "" || prompt == "" {
+		return "", fmt.Errorf("need two models and a prompt")
+	}
+	models := []string{modelA, modelB}
+
+	logger.InfoCF("agent", "Comparing models",
+		map[string]interface{}{
+			"models":  models,
+			"channel": msg.Channel,
+		})
+
+	results := make([]comparison, len(models))
+	var wg sync.WaitGroup
+	for i, model := range models {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = al.compareRun(ctx, msg, i, model, prompt)
+		}()
+	}
+	wg.Wait()
+
+	return formatComparison(results), nil
+}
+
+// compareRun answers prompt with model in a throwaway copy of the chat's
+// session, so both models see the same context and the chat's history is
+// left untouched.
+func (al *AgentLoop) compareRun(ctx context.Context, msg bus.InboundMessage, slot int, model, prompt string) comparison {
+	sessionKey := fmt.Sprintf("compare:%d:%s:%s", slot, msg.Channel, msg.ChatID)
+	al.sessions.SetHistory(sessionKey, al.sessions.GetHistory(msg.SessionKey))
+	al.sessions.SetSummary(sessionKey, al.sessions.GetSummary(msg.SessionKey))
+	al.usage.Delete(sessionKey)
+	defer func() {
+		al.sessions.SetHistory(sessionKey, nil)
+		al.sessions.SetSummary(sessionKey, "")
+		al.sessions.Save(sessionKey)
+		al.usage.Delete(sessionKey)
+	}()
+
+	start := time.Now()
+	response, err := al.runAgentLoop(ctx, processOptions{
+		SessionKey:  sessionKey,
+		Channel:     msg.Channel,
+		ChatID:      msg.ChatID,
+		SenderID:    msg.SenderID,
+		UserMessage: prompt,
+		ToolFilter:  func(name string) bool { return compareTools[name] },
+		Model:       model,
+	})
+	c := comparison{model: model, response: response, err: err, elapsed: time.Since(start)}
+	c.promptTokens, c.completionTokens = al.sessionTokens(sessionKey)
+	return c
+}
+
+// formatComparison renders the answers one after the other, each headed by
+// its model and stats, followed by a one-line summary.
+func formatComparison(results []comparison) string {
+	var sb strings.Builder
+	names := make([]string, len(results))
+	for i, c := range results {
+		names[i] = c.model
+	}
+	fmt.Fprintf(&sb, "⚖️ %s", strings.Join(names, " vs "))
+
+	for _, c := range results {
+		fmt.Fprintf(&sb, "\n\n━━ %s ━━\n%s\n", c.model, c.stats())
+		if c.err != nil {
+			fmt.Fprintf(&sb, "Failed: %v", c.err)
+		} else {
+			sb.WriteString(c.response)
+		}
+	}
+
+	sb.WriteString("\n\n━━ Summary ━━")
+	for _, c := range results {
+		fmt.Fprintf(&sb, "\n• %s: %s", c.model, c.stats())
+	}
+	return sb.String()
+}
+
+// stats describes the run's latency, tokens and answer length.
+func (c comparison) stats() string {
+	s := fmt.Sprintf("%.1fs", c.elapsed.Seconds())
+	if c.promptTokens+c.completionTokens > 0 {
+		s += fmt.Sprintf(", %s in / %s out tokens", formatTokens(c.promptTokens), formatTokens(c.completionTokens))
+	}
+	if c.err == nil {
+		s += fmt.Sprintf(", %d chars", len(c.response))
+	}
+	return s
+}
@@ -4,9 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"runtime"
 	"strings"
-	"time"
 
 	"github.com/sipeed/picoclaw/pkg/logger"
 	"github.com/sipeed/picoclaw/pkg/providers"
@@ -19,6 +17,10 @@ type ContextBuilder struct {
 	skillsLoader *skills.SkillsLoader
 	memory       *MemoryStore
 	tools        *tools.ToolRegistry // Direct reference to tool registry
+	instructions string              // agents.defaults.system_prompt
+	// promptTemplate is agents.defaults.prompt_template, "" for the built-in one
+	promptTemplate string
+	profile        string
 }
 
 func getGlobalConfigDir() string {
@@ -48,40 +50,38 @@ func (cb *ContextBuilder) SetToolsRegistry(registry *tools.ToolRegistry) {
 	cb.tools = registry
 }
 
-func (cb *ContextBuilder) getIdentity() string {
-	now := time.Now().Format("2006-01-02 15:04 (Monday)")
-	workspacePath, _ := filepath.Abs(filepath.Join(cb.workspace))
-	runtime := fmt.Sprintf("%s %s, Go %s", runtime.GOOS, runtime.GOARCH, runtime.Version())
-
-	// Build tools section dynamically
-	toolsSection := cb.buildToolsSection()
-
-	return fmt.Sprintf(`# picoclaw 🦞
-
-You are picoclaw, a helpful AI assistant.
-
-## Current Time
-%s
-
-## Runtime
-%s
-
-## Workspace
-Your workspace is at: %s
-- Memory: %s/memory/MEMORY.md
-- Daily Notes: %s/memory/YYYYMM/YYYYMMDD.md
-- Skills: %s/skills/{skill-name}/SKILL.md
-
-%s
-
-## Important Rules
-
-1. **ALWAYS use tools** - When you need to perform an action (schedule reminders, send messages, execute commands, etc.), you MUST call the appropriate tool. Do NOT just say you'll do it or pretend to do it.
+// SetInstructions sets text added to the system prompt after the workspace
+// files, such as a profile's system prompt.
+func (cb *ContextBuilder) SetInstructions(text string) {
+	cb.instructions = strings.TrimSpace(text)
+}
 
-2. **Be helpful and accurate** - When using tools, briefly explain what you're doing.
+// getIdentity renders the identity and rules section from the prompt
+// template, falling back to the built-in template if it fails.
+func (cb *ContextBuilder) getIdentity(data promptData) string {
+	name, text := cb.identityTemplate()
+	identity, err := cb.renderPrompt(name, text, data)
+	if err != nil {
+		logger.WarnCF("agent", "Prompt template failed, using the built-in one",
+			map[string]interface{}{"template": name, "error": err.Error()})
+		identity, _ = cb.renderPrompt("identity", defaultPromptTemplate, data)
+	}
+	return identity
+}
 
-3. **Memory** - When remembering something, write to %s/memory/MEMORY.md`,
-		now, runtime, workspacePath, workspacePath, workspacePath, workspacePath, toolsSection, workspacePath)
+// getInstructions renders agents.defaults.system_prompt, which may use the
+// same variables and partials as the prompt template.
+func (cb *ContextBuilder) getInstructions(data promptData) string {
+	if !strings.Contains(cb.instructions, "{{") {
+		return cb.instructions
+	}
+	text, err := cb.renderPrompt("system_prompt", cb.instructions, data)
+	if err != nil {
+		logger.WarnCF("agent", "Can't fill in the system prompt, using it as written",
+			map[string]interface{}{"error": err.Error()})
+		return cb.instructions
+	}
+	return strings.TrimSpace(text)
 }
 
 func (cb *ContextBuilder) buildToolsSection() string {
@@ -106,39 +106,72 @@ func (cb *ContextBuilder) buildToolsSection() string {
 	return sb.String()
 }
 
+// promptSection is one named part of the system prompt.
+type promptSection struct {
+	name    string
+	content string
+}
+
 func (cb *ContextBuilder) BuildSystemPrompt() string {
-	parts := []string{}
+	sections := cb.systemPromptSections()
+	parts := make([]string, len(sections))
+	for i, s := range sections {
+		parts[i] = s.content
+	}
+
+	// Join with "---" separator
+	return strings.Join(parts, "\n\n---\n\n")
+}
+
+// systemPromptSections returns the parts BuildSystemPrompt joins, named so
+// /context can show what each one costs.
+func (cb *ContextBuilder) systemPromptSections() []promptSection {
+	sections := []promptSection{}
+	data := cb.promptData()
 
 	// Core identity section
-	parts = append(parts, cb.getIdentity())
+	sections = append(sections, promptSection{"Identity and rules", cb.getIdentity(data)})
 
 	// Bootstrap files
 	bootstrapContent := cb.LoadBootstrapFiles()
 	if bootstrapContent != "" {
-		parts = append(parts, bootstrapContent)
+		sections = append(sections, promptSection{"Bootstrap files", bootstrapContent})
+	}
+
+	if instructions := cb.getInstructions(data); instructions != "" {
+		sections = append(sections, promptSection{"Instructions", "# Instructions\n\n" + instructions})
 	}
 
-	// Skills - show summary, AI can read full content with read_file tool
+	// Skills - show summary, AI loads full content with the skill tool
 	skillsSummary := cb.skillsLoader.BuildSkillsSummary()
 	if skillsSummary != "" {
-		parts = append(parts, fmt.Sprintf(`# Skills
+		sections = append(sections, promptSection{"Skills", fmt.Sprintf(`# Skills
 
-The following skills extend your capabilities. To use a skill, read its SKILL.md file using the read_file tool.
+The following skills extend your capabilities. When a task matches a skill, load its instructions with the skill tool first and follow them.
 
-%s`, skillsSummary))
+%s`, skillsSummary)})
 	}
 
 	// Memory context
 	memoryContext := cb.memory.GetMemoryContext()
 	if memoryContext != "" {
-		parts = append(parts, "# Memory\n\n"+memoryContext)
+		sections = append(sections, promptSection{"Memory", "# Memory\n\n" + memoryContext})
 	}
 
-	// Join with "---" separator
-	return strings.Join(parts, "\n\n---\n\n")
+	return sections
 }
 
 func (cb *ContextBuilder) LoadBootstrapFiles() string {
+	var result string
+	for _, f := range cb.bootstrapFiles() {
+		result += f.content
+	}
+	return result
+}
+
+// bootstrapFiles returns the workspace files included in the system
+// prompt, named by file.
+func (cb *ContextBuilder) bootstrapFiles() []promptSection {
 	bootstrapFiles := []string{
 		"AGENTS.md",
 		"SOUL.md",
@@ -146,15 +179,14 @@ func (cb *ContextBuilder) LoadBootstrapFiles() string {
 		"IDENTITY.md",
 	}
 
-	var result string
+	var files []promptSection
 	for _, filename := range bootstrapFiles {
 		filePath := filepath.Join(cb.workspace, filename)
 		if data, err := os.ReadFile(filePath); err == nil {
-			result += fmt.Sprintf("## %s\n\n%s\n\n", filename, string(data))
+			files = append(files, promptSection{filename, fmt.Sprintf("## %s\n\n%s\n\n", filename, string(data))})
 		}
 	}
-
-	return result
+	return files
 }
 
 func (cb *ContextBuilder) BuildMessages(history []providers.Message, summary string, currentMessage string, media []string, channel, chatID string) []providers.Message {
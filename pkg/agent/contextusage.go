@@ -0,0 +1,215 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// contextPart is one line of the /context breakdown.
+type contextPart struct {
+	name   string
+	tokens int
+	detail string
+	tip    string
+}
+
+// contextCommand handles "/context": it breaks down the prompt the next
+// turn in this chat would send, with estimated tokens per part, so users
+// can see what fills a small model's window and what to trim.
+func contextCommand(ctx context.Context, al *AgentLoop, msg bus.InboundMessage, args string) (string, error) {
+	parts := al.contextParts(msg)
+	total := 0
+	for _, p := range parts {
+		total += p.tokens
+	}
+
+	var sb strings.Builder
+	if window := al.contextSize(); window > 0 {
+		used := total * 100 / window
+		fmt.Fprintf(&sb, "📊 Context: about %s of %s tokens (%d%%)\n%s\n",
+			formatTokens(total), formatTokens(window), used, usageBar(used))
+	} else {
+		fmt.Fprintf(&sb, "📊 Context: about %s tokens\n", formatTokens(total))
+	}
+
+	var biggest contextPart
+	for _, p := range parts {
+		if p.tokens == 0 {
+			continue
+		}
+		fmt.Fprintf(&sb, "\n- %s: %s", p.name, formatTokens(p.tokens))
+		if total > 0 {
+			fmt.Fprintf(&sb, " (%d%%)", p.tokens*100/total)
+		}
+		if p.detail != "" {
+			fmt.Fprintf(&sb, ", %s", p.detail)
+		}
+		if p.tokens > biggest.tokens {
+			biggest = p
+		}
+	}
+	if biggest.tip != "" {
+		fmt.Fprintf(&sb, "\n\nLargest: %s. %s", biggest.name, biggest.tip)
+	}
+	return sb.String(), nil
+}
+
+// contextParts measures each part of the prompt for msg's chat, built the
+// same way runAgentLoop builds it. Tokens are estimated like estimateTokens.
+func (al *AgentLoop) contextParts(msg bus.InboundMessage) []contextPart {
+	var parts []contextPart
+	cb := al.contextBuilder
+
+	for _, s := range cb.systemPromptSections() {
+		switch s.name {
+		case "Identity and rules":
+			toolList := cb.buildToolsSection()
+			if !strings.Contains(s.content, toolList) {
+				toolList = "" // a prompt template that leaves out the tool list
+			}
+			parts = append(parts, contextPart{
+				name:   s.name,
+				tokens: (len(s.content) - len(toolList)) / 4,
+			})
+			parts = append(parts, contextPart{
+				name:   "Tool list",
+				tokens: len(toolList) / 4,
+				tip:    "Hide tools you don't need with tools.disabled in the config.",
+			})
+		case "Bootstrap files":
+			for _, f := range cb.bootstrapFiles() {
+				parts = append(parts, contextPart{
+					name:   f.name,
+					tokens: len(f.content) / 4,
+					tip:    fmt.Sprintf("Shorten %s in the workspace.", f.name),
+				})
+			}
+		case "Skills":
+			parts = append(parts, contextPart{
+				name:   s.name,
+				tokens: len(s.content) / 4,
+				tip:    "Remove skills you don't use from the workspace skills folder.",
+			})
+		case "Memory":
+			parts = append(parts, contextPart{
+				name:   s.name,
+				tokens: len(s.content) / 4,
+				tip:    "Trim memory/MEMORY.md, or ask me to forget what's no longer needed.",
+			})
+		}
+	}
+
+	history := al.sessions.GetHistory(msg.SessionKey)
+	summary := al.sessionSummary(msg.SessionKey)
+	if summary != "" {
+		parts = append(parts, contextPart{
+			name:   "Summary and pins",
+			tokens: len(summary) / 4,
+			detail: fmt.Sprintf("%d pinned", len(al.sessions.GetPinned(msg.SessionKey))),
+			tip:    "Remove pins you no longer need with /unpin.",
+		})
+	}
+	if name, persona, ok := al.chatPersona(msg.SessionKey); ok {
+		parts = append(parts, contextPart{
+			name:   "Persona",
+			tokens: len(personaPrompt(persona)) / 4,
+			detail: name,
+		})
+	}
+	if msg.SenderID != "" {
+		if prompt := al.preferences.Get(preferenceUser(msg.Channel, msg.SenderID)).Prompt(); prompt != "" {
+			parts = append(parts, contextPart{
+				name:   "Preferences",
+				tokens: len(prompt) / 4,
+				tip:    "Drop preferences with /prefs reset.",
+			})
+		}
+	}
+	if al.planningHints {
+		messages := cb.BuildMessages(history, summary, "", nil, msg.Channel, msg.ChatID)
+		parts = append(parts, contextPart{
+			name:   "Planning hints",
+			tokens: len(al.buildPlanningHints(messages, msg.SessionKey)) / 4,
+		})
+	}
+
+	toolResults := 0
+	for _, m := range history {
+		if m.Role == "tool" {
+			toolResults += len(m.Content) / 4
+		}
+	}
+	turns := contextPart{
+		name:   "Recent turns",
+		tokens: al.estimateTokens(history),
+		detail: fmt.Sprintf("%d messages", len(history)),
+		tip:    "Ask me to summarize the conversation so far to shrink it.",
+	}
+	if toolResults > 0 {
+		turns.detail += fmt.Sprintf(", %s in tool results", formatTokens(toolResults))
+	}
+	parts = append(parts, turns)
+
+	model := al.sessions.GetOverrides(msg.SessionKey).Model
+	if model == "" {
+		model = al.defaultModel()
+	}
+	defs := al.tools.ToProviderDefsFiltered(al.sessionToolFilter(msg.SessionKey))
+	parts = append(parts, toolSchemaPart(defs, providers.SchemaLevelFor(al.toolSchemas, model)))
+	return parts
+}
+
+// toolSchemaPart measures the tool definitions sent with every request at
+// the model's schema level, and names the largest ones.
+func toolSchemaPart(defs []providers.ToolDefinition, level providers.SchemaLevel) contextPart {
+	type schema struct {
+		name   string
+		tokens int
+	}
+	sent := providers.CompactTools(defs, level)
+	schemas := make([]schema, 0, len(sent))
+	total := 0
+	for _, def := range sent {
+		data, err := json.Marshal(def)
+		if err != nil {
+			continue
+		}
+		schemas = append(schemas, schema{def.Function.Name, len(data) / 4})
+		total += len(data) / 4
+	}
+	sort.SliceStable(schemas, func(i, j int) bool { return schemas[i].tokens > schemas[j].tokens })
+
+	detail := fmt.Sprintf("%d tools", len(schemas))
+	if level != providers.SchemaFull {
+		detail += fmt.Sprintf(" (%s, %s in full)", level, formatTokens(providers.EstimateToolTokens(defs)))
+	}
+	if len(schemas) > 0 {
+		top := make([]string, 0, 3)
+		for _, s := range schemas[:min(3, len(schemas))] {
+			top = append(top, fmt.Sprintf("%s %s", s.name, formatTokens(s.tokens)))
+		}
+		detail += "; largest " + strings.Join(top, ", ")
+	}
+	tip := "Hide tools you don't need with tools.disabled in the config."
+	if level == providers.SchemaFull {
+		tip = "Set agents.defaults.tool_schemas to compact, or hide tools you don't need with tools.disabled."
+	}
+	return contextPart{
+		name:   "Tool schemas",
+		tokens: total,
+		detail: detail,
+		tip:    tip,
+	}
+}
+
+// usageBar draws percent as a 20-cell bar.
+func usageBar(percent int) string {
+	filled := min(20, max(0, percent/5))
+	return "[" + strings.Repeat("█", filled) + strings.Repeat("░", 20-filled) + "]"
+}
@@ -0,0 +1,40 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+// SetDryRun switches dry-run mode for the agent and its subagents. While it
+// is on, exec, file writes and other mutating tools only report what they
+// would do, so the user can review a plan before letting it run.
+func (al *AgentLoop) SetDryRun(dryRun bool) {
+	al.tools.SetDryRun(dryRun)
+	if al.subagentTools != nil {
+		al.subagentTools.SetDryRun(dryRun)
+	}
+}
+
+// DryRun reports whether dry-run mode is on.
+func (al *AgentLoop) DryRun() bool {
+	return al.tools.DryRun()
+}
+
+// dryRunCommand handles "/dryrun", "/dryrun on" and "/dryrun off".
+func dryRunCommand(ctx context.Context, al *AgentLoop, msg bus.InboundMessage, args string) (string, error) {
+	switch args {
+	case "":
+	case "on":
+		al.SetDryRun(true)
+	case "off":
+		al.SetDryRun(false)
+	default:
+		return "", fmt.Errorf("expected on or off, got %q", args)
+	}
+	if al.DryRun() {
+		return "Dry run is on: commands, file changes and messages are only described, not carried out.", nil
+	}
+	return "Dry run is off: tools run for real.", nil
+}
@@ -0,0 +1,231 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// Fact types recognized by the extractor.
+const (
+	FactDate       = "date"       // birthdays, anniversaries, deadlines
+	FactContact    = "contact"    // people and how to reach them
+	FactPreference = "preference" // likes, dislikes, habits
+	FactPersonal   = "personal"   // anything else the user states about themselves
+)
+
+// Fact is one explicit statement by the user, e.g. that their anniversary
+// is June 3rd, together with where it came from.
+type Fact struct {
+	Type    string     `json:"type"`
+	Subject string     `json:"subject"` // what the fact is about, e.g. "anniversary"
+	Value   string     `json:"value"`   // e.g. "June 3rd"
+	Date    string     `json:"date,omitempty"`
+	Source  FactSource `json:"source"`
+}
+
+// FactSource records which message a fact was extracted from.
+type FactSource struct {
+	Channel string    `json:"channel"`
+	ChatID  string    `json:"chat_id"`
+	Quote   string    `json:"quote"` // the user's words
+	At      time.Time `json:"at"`
+}
+
+// key identifies a fact; a newer fact with the same key replaces the old one.
+func (f Fact) key() string {
+	return f.Type + ":" + strings.ToLower(strings.TrimSpace(f.Subject))
+}
+
+// FactStore keeps extracted facts in memory/facts.json.
+type FactStore struct {
+	path  string
+	mu    sync.Mutex
+	facts []Fact
+}
+
+func NewFactStore(memoryDir string) *FactStore {
+	s := &FactStore{path: filepath.Join(memoryDir, "facts.json")}
+	if data, err := os.ReadFile(s.path); err == nil {
+		if err := json.Unmarshal(data, &s.facts); err != nil {
+			logger.WarnCF("agent", "Ignoring unreadable facts file",
+				map[string]interface{}{"error": err.Error()})
+		}
+	}
+	return s
+}
+
+// Add stores facts, replacing older facts about the same subject, and
+// saves the store.
+func (s *FactStore) Add(facts []Fact) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, f := range facts {
+		replaced := false
+		for i := range s.facts {
+			if s.facts[i].key() == f.key() {
+				s.facts[i] = f
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			s.facts = append(s.facts, f)
+		}
+	}
+
+	data, err := json.MarshalIndent(s.facts, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// All returns the stored facts sorted by type and subject.
+func (s *FactStore) All() []Fact {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	facts := append([]Fact(nil), s.facts...)
+	sort.Slice(facts, func(i, j int) bool { return facts[i].key() < facts[j].key() })
+	return facts
+}
+
+// Context formats the facts for the system prompt.
+func (s *FactStore) Context() string {
+	facts := s.All()
+	if len(facts) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("## Known Facts\n")
+	for _, f := range facts {
+		fmt.Fprintf(&sb, "\n- [%s] %s: %s", f.Type, f.Subject, f.Value)
+		if f.Date != "" {
+			fmt.Fprintf(&sb, " (%s)", f.Date)
+		}
+		fmt.Fprintf(&sb, " — said on %s, %s", f.Source.Channel, f.Source.At.Format("2006-01-02"))
+	}
+	return sb.String()
+}
+
+// factCue matches messages that may state something about the user. Only
+// those are sent to the extractor, which saves an LLM call on most turns.
+var factCue = regexp.MustCompile(`(?i)\b(my|i am|i'm|im|i like|i love|i hate|i prefer|i don't|i dont|i never|i always|call me|remember)\b`)
+
+const factExtractionPrompt = `Extract facts the user explicitly states about themselves or people close to them from the message below. Ignore questions, requests, hypotheticals and anything you would have to guess.
+
+Return a JSON array and nothing else. Each item has:
+- "type": one of "date", "contact", "preference", "personal"
+- "subject": short name of what the fact is about, e.g. "anniversary", "sister", "coffee"
+- "value": the fact in the user's terms, e.g. "June 3rd"
+- "date": for dates, "MM-DD" or "YYYY-MM-DD" if known, else omit
+
+Return [] if there are no such facts.
+
+MESSAGE:
+`
+
+// maybeExtractFacts mines the user's message for facts in the background.
+func (al *AgentLoop) maybeExtractFacts(opts processOptions) {
+	if !al.factExtraction || constants.IsInternalChannel(opts.Channel) || !factCue.MatchString(opts.UserMessage) {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(providers.WithPriority(context.Background(), providers.PriorityBackground), 60*time.Second)
+		defer cancel()
+		if err := al.extractFacts(ctx, opts); err != nil {
+			logger.WarnCF("agent", "Fact extraction failed",
+				map[string]interface{}{
+					"session_key": opts.SessionKey,
+					"error":       err.Error(),
+				})
+		}
+	}()
+}
+
+// extractFacts asks the model for the facts stated in the user's message
+// and stores them with their provenance.
+func (al *AgentLoop) extractFacts(ctx context.Context, opts processOptions) error {
+	response, err := al.provider.Chat(ctx, []providers.Message{
+		{Role: "user", Content: factExtractionPrompt + opts.UserMessage},
+	}, nil, al.defaultModel(), map[string]interface{}{
+		"max_tokens":  512,
+		"temperature": 0.0,
+	})
+	if err != nil {
+		return err
+	}
+
+	facts, err := parseExtractedFacts(response.Content)
+	if err != nil {
+		return err
+	}
+	if len(facts) == 0 {
+		return nil
+	}
+
+	source := FactSource{
+		Channel: opts.Channel,
+		ChatID:  opts.ChatID,
+		Quote:   utils.Truncate(opts.UserMessage, 300),
+		At:      time.Now(),
+	}
+	for i := range facts {
+		facts[i].Source = source
+	}
+
+	logger.InfoCF("agent", "Extracted facts",
+		map[string]interface{}{
+			"count":   len(facts),
+			"channel": opts.Channel,
+		})
+	return al.contextBuilder.memory.facts.Add(facts)
+}
+
+// parseExtractedFacts reads the extractor's JSON array, tolerating a code
+// fence or text around it, and drops malformed items.
+func parseExtractedFacts(content string) ([]Fact, error) {
+	start := strings.Index(content, "[")
+	end := strings.LastIndex(content, "]")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no JSON array in extractor response")
+	}
+
+	var raw []Fact
+	if err := json.Unmarshal([]byte(content[start:end+1]), &raw); err != nil {
+		return nil, fmt.Errorf("invalid extractor response: %w", err)
+	}
+
+	facts := make([]Fact, 0, len(raw))
+	for _, f := range raw {
+		f.Subject = strings.TrimSpace(f.Subject)
+		f.Value = strings.TrimSpace(f.Value)
+		if f.Subject == "" || f.Value == "" {
+			continue
+		}
+		switch f.Type {
+		case FactDate, FactContact, FactPreference, FactPersonal:
+		default:
+			f.Type = FactPersonal
+		}
+		facts = append(facts, f)
+	}
+	return facts, nil
+}
@@ -0,0 +1,38 @@
+package agent
+
+import (
+	"context"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/federation"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// FederationPeers returns the peers configured for federation.
+func FederationPeers(cfg *config.Config) []federation.Peer {
+	peers := make([]federation.Peer, 0, len(cfg.Federation.Peers))
+	for _, p := range cfg.Federation.Peers {
+		peers = append(peers, federation.Peer{Name: p.Name, URL: p.URL, Secret: p.Secret})
+	}
+	return peers
+}
+
+// registerFederationTools adds the delegate tool when there are peers to
+// send tasks to.
+func registerFederationTools(registry *tools.ToolRegistry, cfg *config.Config) {
+	if !cfg.Federation.Enabled {
+		return
+	}
+	timeout := time.Duration(cfg.Federation.Timeout) * time.Second
+	client := federation.NewClient(cfg.Federation.Name, FederationPeers(cfg), timeout)
+	if len(client.Peers()) > 0 {
+		registry.Register(tools.NewDelegateTool(client))
+	}
+}
+
+// HandleFederatedTask runs a task received from a peer. Each peer gets a
+// session of its own; replies go back over HTTP, not to a chat channel.
+func (al *AgentLoop) HandleFederatedTask(ctx context.Context, peer, task string) (string, error) {
+	return al.ProcessDirectWithChannel(ctx, task, "federation:"+peer, "federation", peer)
+}
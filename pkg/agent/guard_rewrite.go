@@ -0,0 +1,35 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// maxGuardRewrites is how many blocked commands per turn the model is asked
+// to rewrite before it is told to stop and explain instead.
+const maxGuardRewrites = 2
+
+// guardRewritePrompt asks the model for a safer equivalent of a command the
+// safety guard blocked, using the guard's structured feedback. attempt
+// counts the blocks so far in this turn.
+func guardRewritePrompt(fb *tools.GuardFeedback, attempt int) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "[Safety guard] `%s` was blocked by rule %s (%s)", fb.Command, fb.Rule, fb.Reason)
+	if fb.Match != "" {
+		fmt.Fprintf(&sb, ", matching `%s`", fb.Match)
+	}
+	sb.WriteString(". ")
+
+	switch {
+	case attempt > maxGuardRewrites:
+		fmt.Fprintf(&sb, "Commands have been blocked %d times this turn. Do not retry; tell the user what you were trying to do and which rule stopped it.", attempt)
+	case fb.Safer == "":
+		sb.WriteString("There is no safe equivalent. Do not retry; tell the user what you were trying to do and which rule stopped it.")
+	default:
+		fmt.Fprintf(&sb, "Rewrite it as a safer equivalent that reaches the same goal: %s. ", fb.Safer)
+		sb.WriteString("Do not work around the rule with quoting, variables, another shell or an encoded form; the rewritten command is checked by the same rules.")
+	}
+	return sb.String()
+}
@@ -0,0 +1,28 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// PendingWork lists the background work still in progress (spawned
+// subagents and commands started with exec's background option), so a
+// heartbeat can follow up on it. It is empty when nothing is running.
+func (al *AgentLoop) PendingWork() string {
+	var sb strings.Builder
+	for _, task := range al.subagents.RunningTasks() {
+		name := task.Label
+		if name == "" {
+			name = utils.Truncate(task.Task, 80)
+		}
+		fmt.Fprintf(&sb, "- Subagent %s: %s\n", task.ID, name)
+	}
+	for _, p := range al.processes.List() {
+		if p.Running() {
+			fmt.Fprintf(&sb, "- Process %s: %s (%s)\n", p.ID, utils.Truncate(p.Command, 80), p.Status())
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,88 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// sessionUsage accumulates the tokens reported by the provider for a session.
+type sessionUsage struct {
+	mu               sync.Mutex
+	promptTokens     int
+	completionTokens int
+}
+
+// recordUsage adds one LLM response's usage to the session's totals.
+func (al *AgentLoop) recordUsage(sessionKey string, usage *providers.UsageInfo) {
+	if usage == nil {
+		return
+	}
+	al.sessions.AddUsage(sessionKey, *usage)
+	value, _ := al.usage.LoadOrStore(sessionKey, &sessionUsage{})
+	u := value.(*sessionUsage)
+	u.mu.Lock()
+	u.promptTokens += usage.PromptTokens
+	u.completionTokens += usage.CompletionTokens
+	u.mu.Unlock()
+}
+
+// sessionTokens returns the prompt and completion tokens used by a session.
+func (al *AgentLoop) sessionTokens(sessionKey string) (int, int) {
+	value, ok := al.usage.Load(sessionKey)
+	if !ok {
+		return 0, 0
+	}
+	u := value.(*sessionUsage)
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.promptTokens, u.completionTokens
+}
+
+// buildPlanningHints describes the resources left for this turn, so the model
+// can plan around them: context headroom, the tool round limit and tokens
+// spent so far, and how slow each tool has been.
+func (al *AgentLoop) buildPlanningHints(messages []providers.Message, sessionKey string) string {
+	var sb strings.Builder
+	sb.WriteString("\n\n## Planning Hints\n")
+
+	if window := al.contextSize(); window > 0 {
+		used := al.estimateTokens(messages)
+		free := max(0, 100-used*100/window)
+		fmt.Fprintf(&sb, "\n- Context: about %s of %s tokens in use (%d%% free).",
+			formatTokens(used), formatTokens(window), free)
+		if free < 25 {
+			sb.WriteString(" Keep tool output short, or call summarize_session before continuing.")
+		}
+	}
+
+	fmt.Fprintf(&sb, "\n- Budget: at most %d tool rounds this turn.", al.iterationLimit())
+	if prompt, completion := al.sessionTokens(sessionKey); prompt+completion > 0 {
+		fmt.Fprintf(&sb, " This conversation has used %s tokens (%s prompt, %s completion).",
+			formatTokens(prompt+completion), formatTokens(prompt), formatTokens(completion))
+	}
+
+	if stats := al.tools.Stats(); len(stats) > 0 {
+		parts := make([]string, 0, len(stats))
+		for _, s := range stats {
+			part := fmt.Sprintf("%s %.1fs", s.Name, s.AvgLatency().Seconds())
+			if s.Errors > 0 {
+				part += fmt.Sprintf(" (%d/%d failed)", s.Errors, s.Calls)
+			}
+			parts = append(parts, part)
+		}
+		fmt.Fprintf(&sb, "\n- Average tool latency: %s. Batch work for slow tools into fewer calls.", strings.Join(parts, ", "))
+	}
+
+	return sb.String()
+}
+
+// formatTokens renders a token count compactly, e.g. 12.4k.
+func formatTokens(n int) string {
+	if n < 1000 {
+		return fmt.Sprintf("%d", n)
+	}
+	return fmt.Sprintf("%.1fk", float64(n)/1000)
+}
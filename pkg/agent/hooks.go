@@ -0,0 +1,120 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sipeed/picoclaw/pkg/hooks"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// Hooks returns the agent's hooks, to register Go middleware:
+//
+//	al.Hooks().OnToolResult("redact", func(ctx context.Context, p *hooks.Payload) error {
+//		p.Content = strings.ReplaceAll(p.Content, secret, "[redacted]")
+//		return nil
+//	})
+func (al *AgentLoop) Hooks() *hooks.Registry {
+	return al.hooks
+}
+
+func hookPayload(event hooks.Event, opts processOptions) hooks.Payload {
+	return hooks.Payload{
+		Event:      event,
+		SessionKey: opts.SessionKey,
+		Channel:    opts.Channel,
+		ChatID:     opts.ChatID,
+		SenderID:   opts.SenderID,
+	}
+}
+
+// logBlocked logs an event a hook blocked.
+func logBlocked(p hooks.Payload, err error) {
+	logger.WarnCF("agent", "Hook blocked event",
+		map[string]interface{}{
+			"event":       string(p.Event),
+			"tool":        p.Tool,
+			"session_key": p.SessionKey,
+			"error":       err.Error(),
+		})
+}
+
+// hookUserMessage runs the user_message hooks, which may rewrite the
+// message or refuse the turn.
+func (al *AgentLoop) hookUserMessage(ctx context.Context, opts *processOptions) error {
+	if !al.hooks.Has(hooks.UserMessage) {
+		return nil
+	}
+	p := hookPayload(hooks.UserMessage, *opts)
+	p.Content = opts.UserMessage
+	if err := al.hooks.Run(ctx, &p); err != nil {
+		logBlocked(p, err)
+		return err
+	}
+	opts.UserMessage = p.Content
+	return nil
+}
+
+// hookToolCall runs the tool_call hooks, which may change the arguments.
+// It returns a result for the model if a hook blocked the call, and nil to
+// run it.
+func (al *AgentLoop) hookToolCall(ctx context.Context, opts processOptions, tc *providers.ToolCall) *tools.ToolResult {
+	if !al.hooks.Has(hooks.ToolCall) {
+		return nil
+	}
+	p := hookPayload(hooks.ToolCall, opts)
+	p.Tool = tc.Name
+	p.Arguments = tc.Arguments
+	if err := al.hooks.Run(ctx, &p); err != nil {
+		logBlocked(p, err)
+		return tools.ErrorResult(fmt.Sprintf("Not run: %v", err))
+	}
+	tc.Arguments = p.Arguments
+	return nil
+}
+
+// hookToolResult runs the tool_result hooks on what the model will see.
+func (al *AgentLoop) hookToolResult(ctx context.Context, opts processOptions, tc providers.ToolCall, result *tools.ToolResult) {
+	if !al.hooks.Has(hooks.ToolResult) {
+		return
+	}
+	p := hookPayload(hooks.ToolResult, opts)
+	p.Tool = tc.Name
+	p.Arguments = tc.Arguments
+	p.Content = result.ForLLM
+	p.IsError = result.IsError
+	if err := al.hooks.Run(ctx, &p); err != nil {
+		logBlocked(p, err)
+		result.ForLLM = fmt.Sprintf("(Result withheld: %v)", err)
+		return
+	}
+	result.ForLLM = p.Content
+}
+
+// hookAssistantMessage runs the assistant_message hooks on the reply and
+// returns it, possibly changed.
+func (al *AgentLoop) hookAssistantMessage(ctx context.Context, opts processOptions, content string) string {
+	if !al.hooks.Has(hooks.AssistantMessage) {
+		return content
+	}
+	p := hookPayload(hooks.AssistantMessage, opts)
+	p.Content = content
+	if err := al.hooks.Run(ctx, &p); err != nil {
+		logBlocked(p, err)
+		return fmt.Sprintf("(Reply withheld: %v)", err)
+	}
+	return p.Content
+}
+
+// hookError tells the error hooks a turn failed.
+func (al *AgentLoop) hookError(opts processOptions, err error) {
+	if !al.hooks.Has(hooks.Error) {
+		return
+	}
+	p := hookPayload(hooks.Error, opts)
+	p.Content = err.Error()
+	// The turn's context may be cancelled already
+	al.hooks.Run(context.Background(), &p)
+}
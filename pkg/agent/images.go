@@ -0,0 +1,111 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/imaging"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// describeImagePrompt asks the vision model for a description the main
+// model can work from.
+const describeImagePrompt = "Describe this image in detail for someone who cannot see it. Transcribe any text in it exactly."
+
+// newCapabilityResolver builds the model capability lookup from the
+// configured overrides.
+func newCapabilityResolver(cfg *config.Config) *providers.CapabilityResolver {
+	overrides := make(map[string][]string, len(cfg.Agents.Defaults.ModelCapabilities))
+	for model, features := range cfg.Agents.Defaults.ModelCapabilities {
+		overrides[model] = features
+	}
+	return providers.NewCapabilityResolver(overrides)
+}
+
+// attachImages adds the images among media to msg, scaled and converted to
+// what the provider accepts. Other attachments are left to the message
+// text. When the model can't view images, the vision model (if set)
+// describes them in the text instead. When an image can't be sent, a note
+// in the message tells the model so it doesn't answer as if it had seen it.
+func (al *AgentLoop) attachImages(ctx context.Context, msg *providers.Message, media []string, provider providers.LLMProvider, model string) {
+	var images []string
+	for _, path := range media {
+		if imaging.IsImage(path) {
+			images = append(images, path)
+		}
+	}
+	if len(images) == 0 {
+		return
+	}
+
+	if provider == nil {
+		provider = al.provider
+	}
+	if model == "" {
+		model = al.defaultModel()
+	}
+	describe := false
+	if !al.capabilities.Resolve(ctx, provider, model).Vision {
+		if al.visionModel == "" || !al.capabilities.Resolve(ctx, al.provider, al.visionModel).Vision {
+			msg.Content += fmt.Sprintf("\n[%d image(s) attached, but the current model cannot view images.]", len(images))
+			return
+		}
+		describe, provider = true, al.provider
+	}
+	limits := provider.(providers.VisionProvider).ImageLimits()
+
+	for _, path := range images {
+		img, err := imaging.Prepare(path, imaging.Limits{
+			Formats:      limits.Formats,
+			MaxBytes:     limits.MaxBytes,
+			MaxDimension: limits.MaxDimension,
+		})
+		if err != nil {
+			logger.WarnCF("agent", "Could not attach image",
+				map[string]interface{}{
+					"file":  filepath.Base(path),
+					"error": err.Error(),
+				})
+			msg.Content += fmt.Sprintf("\n[An attached image could not be sent to the model: %v]", err)
+			continue
+		}
+		if img.Converted {
+			logger.DebugCF("agent", "Image converted for the model",
+				map[string]interface{}{
+					"file":   filepath.Base(path),
+					"type":   img.MediaType,
+					"width":  img.Width,
+					"height": img.Height,
+					"bytes":  len(img.Data),
+				})
+		}
+		image := providers.Image{MediaType: img.MediaType, Data: img.Data}
+		if describe {
+			msg.Content += al.describeImage(ctx, image)
+			continue
+		}
+		msg.Images = append(msg.Images, image)
+	}
+}
+
+// describeImage has the vision model describe image and returns the
+// description as a note for the message text.
+func (al *AgentLoop) describeImage(ctx context.Context, image providers.Image) string {
+	resp, err := al.provider.Chat(ctx, []providers.Message{
+		{Role: "user", Content: describeImagePrompt, Images: []providers.Image{image}},
+	}, nil, al.visionModel, map[string]interface{}{"max_tokens": 1024})
+	if err == nil && strings.TrimSpace(resp.Content) == "" {
+		err = fmt.Errorf("empty description")
+	}
+	if err != nil {
+		logger.WarnCF("agent", "Vision model could not describe image",
+			map[string]interface{}{"model": al.visionModel, "error": err.Error()})
+		return fmt.Sprintf("\n[An attached image could not be described: %v]", err)
+	}
+	return fmt.Sprintf("\n[Attached image, described by %s since the current model cannot view images: %s]",
+		al.visionModel, strings.TrimSpace(resp.Content))
+}
@@ -0,0 +1,193 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/knowledge"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// maxKnowledgeSource bounds a file or download read for ingestion.
+const maxKnowledgeSource = 100 << 20
+
+// textExtensions are the plain text files ingest reads, besides documents
+// and HTML.
+var textExtensions = map[string]bool{
+	".txt": true, ".md": true, ".markdown": true, ".rst": true, ".org": true, ".adoc": true,
+}
+
+// KnowledgePath is where the knowledge base's index is kept.
+func KnowledgePath(workspace string) string {
+	return filepath.Join(workspace, "knowledge")
+}
+
+// NewKnowledgeStore opens workspace's knowledge base, embedding with
+// the configured endpoint, or the OpenAI provider's key if none is set.
+// Without either, documents are searched by keywords.
+func NewKnowledgeStore(workspace string, cfg *config.Config) *knowledge.Store {
+	kc := cfg.Tools.Knowledge
+	var embedder knowledge.Embedder
+	apiKey, apiBase := kc.Embedding.APIKey, kc.Embedding.APIBase
+	if apiKey == "" && apiBase == "" {
+		apiKey, apiBase = cfg.Providers.OpenAI.APIKey, cfg.Providers.OpenAI.APIBase
+	}
+	if apiKey != "" || apiBase != "" {
+		embedder = knowledge.NewOpenAIEmbedder(apiBase, apiKey, kc.Embedding.Model)
+	}
+	return knowledge.NewStore(KnowledgePath(workspace), embedder, knowledge.Options{
+		ChunkChars:   kc.ChunkChars,
+		ChunkOverlap: kc.ChunkOverlap,
+	})
+}
+
+// registerKnowledgeTool adds knowledge_search when it is enabled.
+func registerKnowledgeTool(registry *tools.ToolRegistry, workspace string, cfg *config.Config) {
+	if !cfg.Tools.Knowledge.Enabled {
+		return
+	}
+	registry.Register(tools.NewKnowledgeSearchTool(NewKnowledgeStore(workspace, cfg)))
+}
+
+// IsKnowledgeFile reports whether ingest can read the file at path: a PDF,
+// DOCX or EPUB document, an HTML page or plain text.
+func IsKnowledgeFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return tools.DocumentFormat(path) != "" || ext == ".html" || ext == ".htm" || textExtensions[ext]
+}
+
+// ReadKnowledgeSource reads a file, or downloads a URL, into pages for
+// ingest. Documents keep their pages; web pages and text are one page
+// without a label.
+func ReadKnowledgeSource(ctx context.Context, source string) (knowledge.Document, []knowledge.Page, error) {
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		return readKnowledgeURL(ctx, source)
+	}
+	abs, err := filepath.Abs(source)
+	if err != nil {
+		return knowledge.Document{}, nil, err
+	}
+	doc := knowledge.Document{Source: abs, Title: filepath.Base(abs)}
+	pages, format, err := readKnowledgeFile(ctx, abs)
+	doc.Format = format
+	return doc, pages, err
+}
+
+func readKnowledgeFile(ctx context.Context, file string) ([]knowledge.Page, string, error) {
+	if format := tools.DocumentFormat(file); format != "" {
+		docPages, err := tools.ReadDocumentPages(ctx, file)
+		if err != nil {
+			return nil, format, err
+		}
+		pages := make([]knowledge.Page, len(docPages))
+		for i, p := range docPages {
+			pages[i] = knowledge.Page{Label: p.Label, Text: p.Text}
+		}
+		return pages, format, nil
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, "", err
+	}
+	if info.Size() > maxKnowledgeSource {
+		return nil, "", fmt.Errorf("%s is too large (%d MB)", filepath.Base(file), info.Size()>>20)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, "", err
+	}
+	if ext := strings.ToLower(filepath.Ext(file)); ext == ".html" || ext == ".htm" {
+		_, text := tools.HTMLText(data)
+		return []knowledge.Page{{Text: text}}, "html", nil
+	}
+	if !utf8.Valid(data) || strings.ContainsRune(string(data[:min(len(data), 8192)]), 0) {
+		return nil, "", fmt.Errorf("%s is not a text file, PDF, DOCX, EPUB or HTML page", filepath.Base(file))
+	}
+	return []knowledge.Page{{Text: string(data)}}, "text", nil
+}
+
+// readKnowledgeURL downloads a web page or document. Documents are saved
+// to a temporary file to be read like local ones.
+func readKnowledgeURL(ctx context.Context, url string) (knowledge.Document, []knowledge.Page, error) {
+	doc := knowledge.Document{Source: url}
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return doc, nil, err
+	}
+	req.Header.Set("User-Agent", "picoclaw")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return doc, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return doc, nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxKnowledgeSource+1))
+	if err != nil {
+		return doc, nil, err
+	}
+	if len(data) > maxKnowledgeSource {
+		return doc, nil, fmt.Errorf("%s is larger than %d MB", url, maxKnowledgeSource>>20)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	ext := ""
+	switch mediaType {
+	case "application/pdf":
+		ext = ".pdf"
+	case "application/vnd.openxmlformats-officedocument.wordprocessingml.document":
+		ext = ".docx"
+	case "application/epub+zip":
+		ext = ".epub"
+	case "text/html", "application/xhtml+xml":
+		ext = ".html"
+	default:
+		// Servers often send documents as application/octet-stream
+		if IsKnowledgeFile(resp.Request.URL.Path) {
+			ext = strings.ToLower(path.Ext(resp.Request.URL.Path))
+		} else if strings.HasPrefix(mediaType, "text/") {
+			ext = ".txt"
+		} else {
+			return doc, nil, fmt.Errorf("%s is %s, not a web page, text or a PDF, DOCX or EPUB document", url, mediaType)
+		}
+	}
+
+	doc.Title = path.Base(resp.Request.URL.Path)
+	if doc.Title == "/" || doc.Title == "." {
+		doc.Title = resp.Request.URL.Host
+	}
+	if ext == ".html" {
+		title, text := tools.HTMLText(data)
+		if title != "" {
+			doc.Title = title
+		}
+		doc.Format = "html"
+		return doc, []knowledge.Page{{Text: text}}, nil
+	}
+	tmp, err := os.MkdirTemp("", "picoclaw-ingest-")
+	if err != nil {
+		return doc, nil, err
+	}
+	defer os.RemoveAll(tmp)
+	file := filepath.Join(tmp, "download"+ext)
+	if err := os.WriteFile(file, data, 0600); err != nil {
+		return doc, nil, err
+	}
+	pages, format, err := readKnowledgeFile(ctx, file)
+	doc.Format = format
+	return doc, pages, err
+}
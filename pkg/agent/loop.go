@@ -9,115 +9,304 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
+
+	"github.com/sipeed/picoclaw/pkg/budget"
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/hooks"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/notify"
 	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/quiet"
+	"github.com/sipeed/picoclaw/pkg/quota"
+	"github.com/sipeed/picoclaw/pkg/resources"
 	"github.com/sipeed/picoclaw/pkg/session"
 	"github.com/sipeed/picoclaw/pkg/state"
 	"github.com/sipeed/picoclaw/pkg/tools"
 	"github.com/sipeed/picoclaw/pkg/utils"
+	"github.com/sipeed/picoclaw/pkg/voice"
 )
 
 type AgentLoop struct {
 	bus            *bus.MessageBus
 	provider       providers.LLMProvider
 	workspace      string
+	settingsMu     sync.RWMutex // guards model, contextWindow, maxIterations, maxRepeats, temperature and the personas, which ApplyConfig changes
 	model          string
 	contextWindow  int // Maximum context window size in tokens
 	maxIterations  int
+	maxRepeats     int // identical tool calls allowed per turn; 0 for no limit
 	sessions       *session.SessionManager
 	state          *state.Manager
 	contextBuilder *ContextBuilder
 	tools          *tools.ToolRegistry
+	subagentTools  *tools.ToolRegistry
+	subagents      *tools.SubagentManager
+	processes      *tools.ProcessManager // background commands started by exec
 	running        atomic.Bool
 	summarizing    sync.Map // Tracks which sessions are currently being summarized
+	sessionTools   sync.Map // sessionKey -> *sync.Map of tool names disabled for that session
+	turns          sync.Map // sessionKey -> *runningTurn, for /stop
+	limits         resources.Limits
+	interrupted    []session.InterruptedTurn // turns closed at startup, reported once Run starts
+	approvals      *tools.ApprovalGate
+	approvalWait   time.Duration
+	pendingReplies sync.Map // "channel:chatID" -> chan string awaiting an approval reply
+	usage          sync.Map // sessionKey -> *sessionUsage
+	planningHints  bool     // add context, budget and tool latency hints to the system prompt
+	factExtraction bool     // mine user messages for facts to remember
+	planApproval   bool     // /plan shows the plan and waits for /plan go
+	preferences    *PreferenceStore
+	execTools      []*tools.ExecTool // main and subagent exec tools, for the guard approver
+	diskQuota      *quota.Manager    // nil unless resources.disk.max_mb is set
+	budget         *budget.Tracker   // nil unless a budget is set
+	hooks          *hooks.Registry   // Go middleware and the configured hooks
+	speech         voice.Synthesizer // nil unless a TTS engine is set up
+	channelSpeech  map[string]voice.Synthesizer
+	voiceReply     string // default voice reply mode
+	voiceChannels  map[string]config.VoiceChannelConfig
+	echoTranscript bool // quote what was heard above answers to voice messages
+	speechMaxChars int
+	quiet          *quiet.Hours // set by SetQuietHours when chat channels run
+	capabilities   *providers.CapabilityResolver
+	visionModel    string // describes images for models that can't view them
+	providerName   string // configured provider, shown by /provider
+	temperature    float64
+	newProvider    func(name string) (providers.LLMProvider, error) // creates providers for /provider
+	namedProviders sync.Map                                         // provider name -> providers.LLMProvider
+	toolSchemas    providers.SchemaLevel                            // "" picks the level per model
+	schemaCosts    sync.Map                                         // model -> tool schema cost logged
+	profile        string                                           // agents.defaults.profile, "" for none
+	profiles       []string                                         // configured profile names
+	persona        string                                           // agents.defaults.persona, "" for none
+	personas       map[string]config.PersonaConfig
 }
 
 // processOptions configures how a message is processed
 type processOptions struct {
-	SessionKey      string // Session identifier for history/context
-	Channel         string // Target channel for tool execution
-	ChatID          string // Target chat ID for tool execution
-	UserMessage     string // User message content (may include prefix)
-	DefaultResponse string // Response when LLM returns empty
-	EnableSummary   bool   // Whether to trigger summarization
-	SendResponse    bool   // Whether to send response via bus
-	NoHistory       bool   // If true, don't load session history (for heartbeat)
+	SessionKey      string           // Session identifier for history/context
+	TurnID          string           // Identifies this turn for idempotency of side-effecting tools
+	Channel         string           // Target channel for tool execution
+	ChatID          string           // Target chat ID for tool execution
+	SenderID        string           // User the message came from, for their preferences
+	UserMessage     string           // User message content (may include prefix)
+	Media           []string         // Local paths of attachments; images are shown to the model
+	DefaultResponse string           // Response when LLM returns empty
+	EnableSummary   bool             // Whether to trigger summarization
+	SendResponse    bool             // Whether to send response via bus
+	NoHistory       bool             // If true, don't load session history (for heartbeat)
+	ToolFilter      tools.ToolFilter // Optional further restriction of the offered tools (workflow steps)
+	Model           string           // Overrides the configured model (/compare, /model)
+	Urgency         bus.Urgency      // Set for proactive turns, whose messages may wait out quiet hours
+
+	// Set by applyOverrides from the session's /provider and /temp
+	Provider    providers.LLMProvider
+	Temperature float64
+}
+
+// execBackend returns the container backend selected in the config, or nil
+// to run commands on the host.
+func execBackend(cfg config.ExecConfig, workspace string, shared []string) tools.ExecBackend {
+	switch cfg.Backend {
+	case "docker", "podman":
+		backend := tools.NewContainerBackend(cfg.Backend, cfg.Image, workspace)
+		backend.Network = cfg.Network
+		backend.Memory = cfg.Memory
+		backend.CPUs = cfg.CPUs
+		return backend
+	case "landlock":
+		if !tools.LandlockSupported() {
+			// The backend refuses to run commands rather than run them unrestricted
+			logger.ErrorCF("agent", "Landlock is not available on this system; exec commands will fail",
+				map[string]interface{}{"backend": cfg.Backend})
+		}
+		readOnly, readWrite := cfg.Landlock.Paths()
+		// Shared folders are usable from exec like the workspace
+		readWrite = append(readWrite, shared...)
+		return tools.NewLandlockBackend(workspace, readOnly, readWrite)
+	case "", "host":
+		return nil
+	default:
+		logger.WarnCF("agent", "Unknown exec backend, running commands on the host",
+			map[string]interface{}{"backend": cfg.Backend})
+		return nil
+	}
+}
+
+// AuditLogPath is where guard blocks, overrides and learned approvals are
+// recorded.
+func AuditLogPath(workspace string) string {
+	return filepath.Join(workspace, "state", "audit.jsonl")
+}
+
+// ArtifactsPath is where tool output too long for the model is saved.
+func ArtifactsPath(workspace string) string {
+	return filepath.Join(workspace, "artifacts")
+}
+
+// ConfigureExecGuard applies the guard rules, allowlist and override policy
+// from the config to execTool. Parts of the config that are invalid are
+// left at their defaults and reported in the error.
+func ConfigureExecGuard(execTool *tools.ExecTool, cfg config.ExecConfig) error {
+	configured := make([]tools.GuardRule, len(cfg.Guard.Rules))
+	for i, rule := range cfg.Guard.Rules {
+		configured[i] = tools.GuardRule{
+			Name:     rule.Name,
+			Pattern:  rule.Pattern,
+			Reason:   rule.Reason,
+			Severity: rule.Severity,
+			Safer:    rule.Safer,
+		}
+	}
+	execTool.SetGuardOverride(cfg.GuardOverride == "approve")
+	return errors.Join(
+		execTool.SetGuardRules(tools.MergeGuardRules(tools.DefaultGuardRules, configured)),
+		execTool.SetAllowPatterns(cfg.Guard.Allow),
+	)
 }
 
 // createToolRegistry creates a tool registry with common tools.
 // This is shared between main agent and subagents.
-func createToolRegistry(workspace string, restrict bool, cfg *config.Config, msgBus *bus.MessageBus) *tools.ToolRegistry {
+func createToolRegistry(workspace string, restrict bool, cfg *config.Config, msgBus *bus.MessageBus, limits resources.Limits, processes *tools.ProcessManager) *tools.ToolRegistry {
 	registry := tools.NewToolRegistry()
 
 	// File system tools
-	registry.Register(tools.NewReadFileTool(workspace, restrict))
+	readFileTool := tools.NewReadFileTool(workspace, restrict)
+	readFileTool.SetMaxBytes(limits.ReadFileMaxBytes)
+	registry.Register(readFileTool)
 	registry.Register(tools.NewWriteFileTool(workspace, restrict))
 	registry.Register(tools.NewListDirTool(workspace, restrict))
 	registry.Register(tools.NewEditFileTool(workspace, restrict))
 	registry.Register(tools.NewAppendFileTool(workspace, restrict))
+	registry.Register(tools.NewSearchTool(workspace, restrict))
+	registry.Register(tools.NewReadDocumentTool(workspace, restrict))
+	registry.Register(tools.NewTableTool(workspace, restrict))
+	registerKnowledgeTool(registry, workspace, cfg)
+	registerSQLTool(registry, workspace, restrict, cfg.Tools.SQL)
 
 	// Shell execution
-	registry.Register(tools.NewExecTool(workspace, restrict))
-
-	if searchTool := tools.NewWebSearchTool(tools.WebSearchToolOptions{
-		BraveAPIKey:          cfg.Tools.Web.Brave.APIKey,
-		BraveMaxResults:      cfg.Tools.Web.Brave.MaxResults,
-		BraveEnabled:         cfg.Tools.Web.Brave.Enabled,
-		DuckDuckGoMaxResults: cfg.Tools.Web.DuckDuckGo.MaxResults,
-		DuckDuckGoEnabled:    cfg.Tools.Web.DuckDuckGo.Enabled,
-	}); searchTool != nil {
-		registry.Register(searchTool)
+	execTool := tools.NewExecTool(workspace, restrict)
+	execTool.SetMaxOutput(limits.ExecMaxOutput)
+	if backend := execBackend(cfg.Tools.Exec, workspace, cfg.SharedFolderPaths()); backend != nil {
+		execTool.SetBackend(backend)
 	}
-	registry.Register(tools.NewWebFetchTool(50000))
-
-	// Weather tool
-	if cfg.Tools.Weather.APIKey != "" {
-		registry.Register(tools.NewWeatherTool(cfg.Tools.Weather.APIKey, cfg.Tools.Weather.DefaultZip))
+	execTool.SetProcessManager(processes)
+	execTool.SetStreamInterval(time.Duration(cfg.Tools.Exec.StreamInterval) * time.Second)
+	maxExecOutput := cfg.Tools.Exec.MaxOutputBytes
+	if limits.LowMemory {
+		// Don't let the model undo low-memory mode one call at a time
+		maxExecOutput = limits.ExecMaxOutput
+	}
+	execTool.SetLimits(time.Duration(cfg.Tools.Exec.MaxTimeout)*time.Second, maxExecOutput)
+	if cfg.Tools.Output.MaxChars > 0 && maxExecOutput > limits.ExecMaxOutput {
+		// Keep what the output policy can save to a file rather than cutting it here
+		execTool.SetMaxOutput(maxExecOutput)
+	}
+	execTool.SetEnvPolicy(&tools.EnvPolicy{Inherit: cfg.Tools.Exec.Env.Inherit, Deny: cfg.Tools.Exec.Env.Deny})
+	if path := cfg.Tools.Exec.Env.SecretsPath(); path != "" {
+		execTool.SetSecretVault(tools.NewSecretVault(path))
+	}
+	execTool.SetAuditLog(tools.NewAuditLog(AuditLogPath(workspace)))
+	if err := ConfigureExecGuard(execTool, cfg.Tools.Exec); err != nil {
+		logger.ErrorCF("agent", "Invalid exec guard config, keeping the default rules",
+			map[string]interface{}{"error": err.Error()})
+	}
+	registry.Register(execTool)
+	registry.Register(tools.NewListProcessesTool(processes))
+	registry.Register(tools.NewReadOutputTool(processes))
+	registry.Register(tools.NewKillProcessTool(processes))
+	registry.Register(tools.NewShellSessionTool(execTool, processes))
+	registerPythonTool(registry, workspace, cfg, limits.ExecMaxOutput)
+
+	// Optional tool groups; each can be compiled out with a build tag
+	// (noweb, nohardware) for minimal builds.
+	registerWebTools(registry, cfg, limits)
+	registerHardwareTools(registry)
+	registerCalendarTool(registry, cfg.Tools.Calendar)
+	registerMQTTTool(registry, cfg)
+	if cfg.Tools.Screenshot.Enabled {
+		registry.Register(tools.NewScreenshotTool(workspace))
+	}
+	if cfg.Tools.Notify.Enabled {
+		if notifier := notify.New(cfg.Tools.Notify); len(notifier.Targets()) > 0 {
+			registry.Register(tools.NewNotifyTool(notifier))
+		}
 	}
-
-	// Hardware tools (I2C, SPI) - Linux only, returns error on other platforms
-	registry.Register(tools.NewI2CTool())
-	registry.Register(tools.NewSPITool())
 
 	// Message tool - available to both agent and subagent
 	// Subagent uses it to communicate directly with user
 	messageTool := tools.NewMessageTool()
-	messageTool.SetSendCallback(func(channel, chatID, content string) error {
+	messageTool.SetSendCallback(func(channel, chatID, content string, urgency bus.Urgency) error {
 		msgBus.PublishOutbound(bus.OutboundMessage{
 			Channel: channel,
 			ChatID:  chatID,
 			Content: content,
+			Urgency: urgency,
 		})
 		return nil
 	})
 	registry.Register(messageTool)
 
+	// Folders the user shared on top of the workspace
+	if shared := cfg.SharedFolderPaths(); len(shared) > 0 {
+		for _, name := range registry.List() {
+			if tool, ok := registry.Get(name); ok {
+				if scoped, ok := tool.(tools.SharedFolderTool); ok {
+					scoped.SetSharedFolders(shared)
+				}
+			}
+		}
+	}
+
 	return registry
 }
 
+// applyToolConfig offers only the tools in tools.enabled, if any are
+// listed, and disables those in tools.disabled.
+func applyToolConfig(registry *tools.ToolRegistry, cfg *config.Config) {
+	if len(cfg.Tools.Enabled) > 0 {
+		registry.SelectTools(cfg.Tools.Enabled, nil)
+	}
+	if len(cfg.Tools.Disabled) > 0 {
+		registry.ApplyDisabled(cfg.Tools.Disabled)
+	}
+}
+
 func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers.LLMProvider) *AgentLoop {
 	workspace := cfg.WorkspacePath()
 	os.MkdirAll(workspace, 0755)
 
 	restrict := cfg.Agents.Defaults.RestrictToWorkspace
 
+	// Pick buffer and concurrency limits for this host (low-memory mode)
+	limits := resources.Detect(cfg.Resources.LowMemory, cfg.Resources.ThresholdMB)
+	limits.Apply()
+
+	// Background processes are shared, so the main agent can check on a
+	// server a subagent started
+	processes := tools.NewProcessManager()
+
 	// Create tool registry for main agent
-	toolsRegistry := createToolRegistry(workspace, restrict, cfg, msgBus)
+	toolsRegistry := createToolRegistry(workspace, restrict, cfg, msgBus, limits, processes)
 
 	// Create subagent manager with its own tool registry
 	subagentManager := tools.NewSubagentManager(provider, cfg.Agents.Defaults.Model, workspace, msgBus)
-	subagentTools := createToolRegistry(workspace, restrict, cfg, msgBus)
+	subagentManager.SetMaxConcurrent(limits.MaxSubagents)
+	capabilities := newCapabilityResolver(cfg)
+	subagentManager.SetCapabilities(capabilities)
+	subagentTools := createToolRegistry(workspace, restrict, cfg, msgBus, limits, processes)
 	// Subagent doesn't need spawn/subagent tools to avoid recursion
 	subagentManager.SetTools(subagentTools)
 
@@ -129,7 +318,32 @@ func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers
 	subagentTool := tools.NewSubagentTool(subagentManager)
 	toolsRegistry.Register(subagentTool)
 
-	sessionsManager := session.NewSessionManager(filepath.Join(workspace, "sessions"))
+	// Register spawn_agent tool (parallel child agents with restricted tools)
+	toolsRegistry.Register(tools.NewSpawnAgentTool(subagentManager))
+
+	sessionsManager := session.NewSessionManager(cfg.SessionsPath())
+	interrupted := closeInterruptedTurns(sessionsManager)
+
+	// Remember completed side-effecting calls so retries don't repeat them
+	idempotency := tools.NewIdempotencyStore(filepath.Join(workspace, "state", "idempotency.json"), 24*time.Hour)
+	toolsRegistry.SetIdempotencyStore(idempotency)
+	subagentTools.SetIdempotencyStore(idempotency)
+
+	// One pool for both registries, so subagents share the host's limits
+	workers := cfg.Tools.Concurrency.Workers
+	if workers <= 0 {
+		workers = limits.ToolWorkers
+	}
+	pool := tools.NewWorkerPool(workers, cfg.Tools.Concurrency.PerTool)
+	toolsRegistry.SetWorkerPool(pool)
+	subagentTools.SetWorkerPool(pool)
+
+	// Spill oversized results to files instead of into the context
+	if out := cfg.Tools.Output; out.MaxChars > 0 || out.MaxTurnChars > 0 {
+		policy := tools.NewOutputPolicy(ArtifactsPath(workspace), out.MaxChars, out.MaxTurnChars, out.PerTool)
+		toolsRegistry.SetOutputPolicy(policy)
+		subagentTools.SetOutputPolicy(policy)
+	}
 
 	// Create state manager for atomic state persistence
 	stateManager := state.NewManager(workspace)
@@ -137,33 +351,146 @@ func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers
 	// Create context builder and set tools registry
 	contextBuilder := NewContextBuilder(workspace)
 	contextBuilder.SetToolsRegistry(toolsRegistry)
+	contextBuilder.SetInstructions(cfg.Agents.Defaults.SystemPrompt)
+	contextBuilder.SetPromptTemplate(cfg.Agents.Defaults.PromptTemplate)
+	contextBuilder.SetProfile(cfg.Agents.Defaults.Profile)
 
-	return &AgentLoop{
+	al := &AgentLoop{
 		bus:            msgBus,
 		provider:       provider,
 		workspace:      workspace,
 		model:          cfg.Agents.Defaults.Model,
 		contextWindow:  cfg.Agents.Defaults.MaxTokens, // Restore context window for summarization
 		maxIterations:  cfg.Agents.Defaults.MaxToolIterations,
+		maxRepeats:     cfg.Agents.Defaults.MaxRepeatedToolCalls,
 		sessions:       sessionsManager,
 		state:          stateManager,
 		contextBuilder: contextBuilder,
 		tools:          toolsRegistry,
+		subagentTools:  subagentTools,
+		subagents:      subagentManager,
+		processes:      processes,
 		summarizing:    sync.Map{},
+		limits:         limits,
+		interrupted:    interrupted,
+		planningHints:  cfg.Agents.Defaults.PlanningHints,
+		factExtraction: cfg.Agents.Defaults.FactExtraction,
+		planApproval:   cfg.Agents.Defaults.PlanApproval,
+		preferences:    NewPreferenceStore(filepath.Join(workspace, "state")),
+		speech:         newSpeechSynthesizer(cfg, ""),
+		channelSpeech:  newChannelSynthesizers(cfg),
+		voiceReply:     cfg.Voice.Reply,
+		voiceChannels:  cfg.Voice.Channels,
+		echoTranscript: cfg.Voice.STT.EchoTranscript,
+		speechMaxChars: cfg.Voice.TTS.MaxChars,
+		capabilities:   capabilities,
+		visionModel:    cfg.Agents.Defaults.VisionModel,
+		providerName:   cfg.Agents.Defaults.Provider,
+		temperature:    cfg.Agents.Defaults.Temperature,
+		toolSchemas:    newSchemaLevel(cfg),
+		profile:        cfg.Agents.Defaults.Profile,
+		profiles:       cfg.ProfileNames(),
+		persona:        cfg.Agents.Defaults.Persona,
+		personas:       cfg.Agents.Personas,
+		newProvider: func(name string) (providers.LLMProvider, error) {
+			return providers.CreateNamedProvider(cfg, name)
+		},
+	}
+
+	al.SetDryRun(cfg.Agents.Defaults.DryRun)
+
+	if _, ok := cfg.Agents.Personas[cfg.Agents.Defaults.Persona]; !ok && cfg.Agents.Defaults.Persona != "" {
+		logger.WarnCF("agent", "Default persona is not configured, chats start without one",
+			map[string]interface{}{"persona": cfg.Agents.Defaults.Persona})
+	}
+
+	al.budget = newBudget(cfg.Budget, workspace)
+	al.hooks = hooks.NewRegistry()
+	if err := al.hooks.RegisterConfig(cfg.Hooks); err != nil {
+		logger.ErrorCF("agent", "Invalid hook config, skipping the rest of the hooks",
+			map[string]interface{}{"error": err.Error()})
+	}
+
+	if disk := cfg.Resources.Disk; disk.MaxMB > 0 {
+		al.diskQuota = quota.New(int64(disk.MaxMB)<<20, disk.WarnPercent, DiskAreas(workspace)...)
+		setDiskQuota(al.diskQuota, toolsRegistry, subagentTools)
 	}
+
+	// Delegation to other picoclaw instances (main agent only)
+	registerFederationTools(toolsRegistry, cfg)
+
+	// Tools provided by executables in the plugins folder (main agent only)
+	registerPlugins(toolsRegistry, cfg.Tools.Plugins, cfg.Tools.Exec.Env, workspace)
+
+	// Let the model load skill instructions when a task needs them
+	toolsRegistry.Register(tools.NewSkillTool(contextBuilder.skillsLoader))
+
+	// Let the model compress its own context during long tasks
+	toolsRegistry.Register(tools.NewSummarizeSessionTool(al.compactSession))
+
+	if cfg.Tools.Approval.Enabled {
+		required := []string(cfg.Tools.Approval.RequireConfirmation)
+		if slices.Contains(required, "exec") {
+			// Shell sessions and Python run commands too; don't let them bypass approval
+			for _, name := range []string{"shell_session", "python"} {
+				if !slices.Contains(required, name) {
+					required = append(required, name)
+				}
+			}
+		}
+		al.approvals = tools.NewApprovalGate(required, cfg.Tools.Approval.AlwaysAllow)
+		al.approvals.SetApprover(al.requestApprovalViaBus)
+		al.approvalWait = time.Duration(cfg.Tools.Approval.Timeout) * time.Second
+		toolsRegistry.SetApprovalGate(al.approvals)
+		subagentTools.SetApprovalGate(al.approvals)
+		if cfg.Tools.Exec.LearnAllowlist {
+			al.approvals.SetObserver(learnApprovedCommands(tools.NewAuditLog(AuditLogPath(workspace))))
+		}
+	}
+	if cfg.Tools.Exec.LearnAllowlist && (al.approvals == nil || !al.approvals.RequiresConfirmation("exec")) {
+		logger.WarnC("agent", "Allowlist learning needs exec in tools.approval.require_confirmation; nothing will be learned")
+	}
+
+	// The guard asks about confirm rules and overrides even without approvals
+	for _, registry := range []*tools.ToolRegistry{toolsRegistry, subagentTools} {
+		if tool, ok := registry.Get("exec"); ok {
+			if execTool, ok := tool.(*tools.ExecTool); ok {
+				execTool.SetGuardApprover(al.requestApprovalViaBus)
+				al.execTools = append(al.execTools, execTool)
+			}
+		}
+	}
+	for _, registry := range []*tools.ToolRegistry{toolsRegistry, subagentTools} {
+		if tool, ok := registry.Get("screenshot"); ok {
+			if screenshotTool, ok := tool.(*tools.ScreenshotTool); ok {
+				screenshotTool.SetDescriber(al.describeScreenshot)
+			}
+		}
+	}
+
+	// Last, so every registered tool is covered
+	applyToolConfig(toolsRegistry, cfg)
+	applyToolConfig(subagentTools, cfg)
+
+	return al
 }
 
 func (al *AgentLoop) Run(ctx context.Context) error {
 	al.running.Store(true)
+	al.notifyInterruptedTurns()
+
+	// Inbound messages are read by a separate goroutine so that replies to
+	// approval prompts can reach a turn that is blocked waiting for them.
+	work := make(chan bus.InboundMessage, 16)
+	go al.dispatchInbound(ctx, work)
 
 	for al.running.Load() {
 		select {
 		case <-ctx.Done():
 			return nil
-		default:
-			msg, ok := al.bus.ConsumeInbound(ctx)
+		case msg, ok := <-work:
 			if !ok {
-				continue
+				return nil
 			}
 
 			response, err := al.processMessage(ctx, msg)
@@ -185,7 +512,8 @@ func (al *AgentLoop) Run(ctx context.Context) error {
 					al.bus.PublishOutbound(bus.OutboundMessage{
 						Channel: msg.Channel,
 						ChatID:  msg.ChatID,
-						Content: response,
+						Content: al.withTranscript(msg, response),
+						Media:   al.speakReply(ctx, msg, response),
 					})
 				}
 			}
@@ -195,12 +523,81 @@ func (al *AgentLoop) Run(ctx context.Context) error {
 	return nil
 }
 
+// dispatchInbound consumes the bus, hands approval replies to the waiting
+// turn and forwards everything else to work.
+func (al *AgentLoop) dispatchInbound(ctx context.Context, work chan<- bus.InboundMessage) {
+	defer close(work)
+	for al.running.Load() {
+		msg, ok := al.bus.ConsumeInbound(ctx)
+		if !ok {
+			return
+		}
+		if al.deliverApprovalReply(msg) || al.deliverStop(msg) {
+			continue
+		}
+		select {
+		case work <- msg:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
 func (al *AgentLoop) Stop() {
 	al.running.Store(false)
+	al.processes.StopAll()
+	closeTools(al.tools)
 }
 
-func (al *AgentLoop) RegisterTool(tool tools.Tool) {
-	al.tools.Register(tool)
+// closeTools stops what tools keep running between calls, such as Python
+// interpreters and the browser.
+func closeTools(registry *tools.ToolRegistry) {
+	for _, name := range registry.List() {
+		if tool, ok := registry.Get(name); ok {
+			if closer, ok := tool.(interface{ Close() }); ok {
+				closer.Close()
+			}
+		}
+	}
+}
+
+// RegisterTool adds a tool, replacing one with the same name. It fails if
+// the name is invalid.
+func (al *AgentLoop) RegisterTool(tool tools.Tool) error {
+	return al.tools.Register(tool)
+}
+
+// SetSessionToolEnabled enables or disables a tool for a single session
+// without affecting other sessions or the registry-wide state.
+func (al *AgentLoop) SetSessionToolEnabled(sessionKey, name string, enabled bool) error {
+	if _, ok := al.tools.Get(name); !ok {
+		return fmt.Errorf("tool %q not found", name)
+	}
+
+	value, _ := al.sessionTools.LoadOrStore(sessionKey, &sync.Map{})
+	disabled := value.(*sync.Map)
+	if enabled {
+		disabled.Delete(name)
+	} else {
+		disabled.Store(name, true)
+	}
+	return nil
+}
+
+// sessionToolFilter returns a filter that hides tools disabled for the session.
+func (al *AgentLoop) sessionToolFilter(sessionKey string) tools.ToolFilter {
+	value, ok := al.sessionTools.Load(sessionKey)
+	if !ok {
+		return nil
+	}
+	disabled := value.(*sync.Map)
+	return func(name string) bool {
+		if _, off := disabled.Load(allTools); off {
+			return false
+		}
+		_, off := disabled.Load(name)
+		return !off
+	}
 }
 
 // RecordLastChannel records the last active channel for this workspace.
@@ -215,6 +612,16 @@ func (al *AgentLoop) RecordLastChatID(chatID string) error {
 	return al.state.SetLastChatID(chatID)
 }
 
+// LastActiveChat returns the channel and chat ID the user last wrote from,
+// or empty strings if none is recorded.
+func (al *AgentLoop) LastActiveChat() (channel, chatID string) {
+	channel, chatID, ok := strings.Cut(al.state.GetLastChannel(), ":")
+	if !ok || channel == "" || chatID == "" {
+		return "", ""
+	}
+	return channel, chatID
+}
+
 func (al *AgentLoop) ProcessDirect(ctx context.Context, content, sessionKey string) (string, error) {
 	return al.ProcessDirectWithChannel(ctx, content, sessionKey, "cli", "direct")
 }
@@ -226,6 +633,7 @@ func (al *AgentLoop) ProcessDirectWithChannel(ctx context.Context, content, sess
 		ChatID:     chatID,
 		Content:    content,
 		SessionKey: sessionKey,
+		Metadata:   map[string]string{"urgency": string(bus.UrgencyNormal)},
 	}
 
 	return al.processMessage(ctx, msg)
@@ -243,6 +651,7 @@ func (al *AgentLoop) ProcessHeartbeat(ctx context.Context, content, channel, cha
 		EnableSummary:   false,
 		SendResponse:    false,
 		NoHistory:       true, // Don't load session history for heartbeat
+		Urgency:         bus.UrgencyNormal,
 	})
 }
 
@@ -254,8 +663,9 @@ func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage)
 	} else {
 		logContent = utils.Truncate(msg.Content, 80)
 	}
-	logger.InfoCF("agent", fmt.Sprintf("Processing message from %s:%s: %s", msg.Channel, msg.SenderID, logContent),
+	logger.InfoCF("agent", "Processing message",
 		map[string]interface{}{
+			"content":     logContent,
 			"channel":     msg.Channel,
 			"chat_id":     msg.ChatID,
 			"sender_id":   msg.SenderID,
@@ -267,16 +677,48 @@ func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage)
 		return al.processSystemMessage(ctx, msg)
 	}
 
+	// Reactions to earlier replies are feedback, not a new turn
+	if emoji := msg.Metadata["reaction"]; emoji != "" {
+		al.handleReaction(msg, emoji)
+		return "", nil
+	}
+
+	// Let /stop cancel the turn; /stop itself must not replace it
+	if name, _, _ := parseCommand(msg.Content); name != "stop" {
+		var done func()
+		ctx, done = al.trackTurn(ctx, msg.SessionKey)
+		defer done()
+	}
+
+	// Slash commands are answered without the LLM
+	if response, ok := al.handleCommand(ctx, msg); ok {
+		if stopped(ctx) {
+			return stoppedReply, nil
+		}
+		return response, nil
+	}
+
+	// Scheduled jobs run as messages marked with their urgency
+	urgency, _ := bus.ParseUrgency(msg.Metadata["urgency"])
+
 	// Process as user message
-	return al.runAgentLoop(ctx, processOptions{
+	response, err := al.runAgentLoop(ctx, processOptions{
 		SessionKey:      msg.SessionKey,
+		TurnID:          turnIDFor(msg),
 		Channel:         msg.Channel,
 		ChatID:          msg.ChatID,
+		SenderID:        msg.SenderID,
 		UserMessage:     msg.Content,
+		Media:           msg.Media,
 		DefaultResponse: "I've completed processing but have no response to give.",
 		EnableSummary:   true,
 		SendResponse:    false,
+		Urgency:         urgency,
 	})
+	if err != nil && stopped(ctx) {
+		return stoppedReply, nil
+	}
+	return response, err
 }
 
 func (al *AgentLoop) processSystemMessage(ctx context.Context, msg bus.InboundMessage) (string, error) {
@@ -331,16 +773,51 @@ func (al *AgentLoop) processSystemMessage(ctx context.Context, msg bus.InboundMe
 	return "", nil
 }
 
+// turnIDFor derives the turn ID for an inbound message. Messages carrying a
+// channel message ID get a stable ID, so a message redelivered after a crash
+// maps to the same turn and its side effects are not repeated.
+func turnIDFor(msg bus.InboundMessage) string {
+	if id := msg.Metadata["message_id"]; id != "" {
+		return fmt.Sprintf("%s:%s:%s", msg.Channel, msg.ChatID, id)
+	}
+	return uuid.NewString()
+}
+
 // runAgentLoop is the core message processing logic.
 // It handles context building, LLM calls, tool execution, and response handling.
-func (al *AgentLoop) runAgentLoop(ctx context.Context, opts processOptions) (string, error) {
+func (al *AgentLoop) runAgentLoop(ctx context.Context, opts processOptions) (reply string, err error) {
+	defer func() {
+		if err != nil {
+			al.hookError(opts, err)
+		}
+	}()
+
+	// Tag the turn so side-effecting tools are not repeated within it
+	if opts.TurnID == "" {
+		opts.TurnID = uuid.NewString()
+	}
+	ctx = tools.WithTurnID(ctx, opts.TurnID)
+	ctx = tools.WithSessionKey(ctx, opts.SessionKey)
+	if opts.Urgency != "" {
+		ctx = tools.WithUrgency(ctx, opts.Urgency)
+	}
+
+	al.applyOverrides(&opts)
+	ctx = al.withQueuePriority(ctx, opts)
+	if err := al.checkBudget(opts.SessionKey); err != nil {
+		return "", err
+	}
+	if err := al.hookUserMessage(ctx, &opts); err != nil {
+		return "", err
+	}
+
 	// 0. Record last channel for heartbeat notifications (skip internal channels)
 	if opts.Channel != "" && opts.ChatID != "" {
 		// Don't record internal channels (cli, system, subagent)
 		if !constants.IsInternalChannel(opts.Channel) {
 			channelKey := fmt.Sprintf("%s:%s", opts.Channel, opts.ChatID)
 			if err := al.RecordLastChannel(channelKey); err != nil {
-				logger.WarnCF("agent", "Failed to record last channel: %v", map[string]interface{}{"error": err.Error()})
+				logger.WarnCF("agent", "Failed to record last channel", map[string]interface{}{"error": err.Error()})
 			}
 		}
 	}
@@ -353,7 +830,7 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, opts processOptions) (str
 	var summary string
 	if !opts.NoHistory {
 		history = al.sessions.GetHistory(opts.SessionKey)
-		summary = al.sessions.GetSummary(opts.SessionKey)
+		summary = al.sessionSummary(opts.SessionKey)
 	}
 	messages := al.contextBuilder.BuildMessages(
 		history,
@@ -363,13 +840,37 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, opts processOptions) (str
 		opts.Channel,
 		opts.ChatID,
 	)
+	al.attachImages(ctx, &messages[len(messages)-1], opts.Media, opts.Provider, opts.Model)
+	if al.planningHints {
+		messages[0].Content += al.buildPlanningHints(messages, opts.SessionKey)
+	}
+	if _, persona, ok := al.chatPersona(opts.SessionKey); ok {
+		messages[0].Content += personaPrompt(persona)
+	}
+	if opts.SenderID != "" {
+		messages[0].Content += al.preferences.Get(preferenceUser(opts.Channel, opts.SenderID)).Prompt()
+	}
 
-	// 3. Save user message to session
+	// 3. Save user message to session and checkpoint the turn, so a crash
+	// mid-turn can be detected and closed on the next start
 	al.sessions.AddMessage(opts.SessionKey, "user", opts.UserMessage)
+	al.sessions.BeginTurn(opts.SessionKey, session.TurnCheckpoint{
+		Channel:     opts.Channel,
+		ChatID:      opts.ChatID,
+		UserMessage: opts.UserMessage,
+	})
+	al.sessions.Save(opts.SessionKey)
 
 	// 4. Run LLM iteration loop
 	finalContent, iteration, err := al.runLLMIteration(ctx, messages, opts)
 	if err != nil {
+		// Leave the history valid for the next turn, with what ran so far
+		note := ""
+		if stopped(ctx) {
+			note = stoppedNote
+		}
+		al.sessions.CloseTurn(opts.SessionKey, note)
+		al.sessions.Save(opts.SessionKey)
 		return "", err
 	}
 
@@ -380,14 +881,20 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, opts processOptions) (str
 	if finalContent == "" {
 		finalContent = opts.DefaultResponse
 	}
+	finalContent = al.hookAssistantMessage(ctx, opts, finalContent)
 
 	// 6. Save final assistant message to session
 	al.sessions.AddMessage(opts.SessionKey, "assistant", finalContent)
+	al.sessions.EndTurn(opts.SessionKey)
 	al.sessions.Save(opts.SessionKey)
 
+	// Warn under the reply, not in the history, when a budget is nearly used up
+	finalContent += al.budgetWarning(opts.SessionKey)
+
 	// 7. Optional: summarization
 	if opts.EnableSummary {
 		al.maybeSummarize(opts.SessionKey)
+		al.maybeExtractFacts(opts)
 	}
 
 	// 8. Optional: send response via bus
@@ -396,13 +903,18 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, opts processOptions) (str
 			Channel: opts.Channel,
 			ChatID:  opts.ChatID,
 			Content: finalContent,
+			Urgency: opts.Urgency,
 		})
 	}
 
-	// 9. Log response
+	// 9. Keep disk usage under the quota and warn before writes fail
+	al.checkDiskQuota(opts)
+
+	// 10. Log response
 	responsePreview := utils.Truncate(finalContent, 120)
-	logger.InfoCF("agent", fmt.Sprintf("Response: %s", responsePreview),
+	logger.InfoCF("agent", "Response",
 		map[string]interface{}{
+			"content":      responsePreview,
 			"session_key":  opts.SessionKey,
 			"iterations":   iteration,
 			"final_length": len(finalContent),
@@ -415,29 +927,41 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, opts processOptions) (str
 // Returns the final content, iteration count, and any error.
 func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.Message, opts processOptions) (string, int, error) {
 	iteration := 0
+	guardBlocks := 0
 	var finalContent string
+	provider, model := opts.Provider, opts.Model
+	maxIterations := al.iterationLimit()
+	guard := newLoopGuard(al.repeatLimit())
+	answered := false
 
-	for iteration < al.maxIterations {
+	for iteration < maxIterations {
 		iteration++
 
 		logger.DebugCF("agent", "LLM iteration",
 			map[string]interface{}{
 				"iteration": iteration,
-				"max":       al.maxIterations,
+				"max":       maxIterations,
 			})
 
 		// Build tool definitions
-		providerToolDefs := al.tools.ToProviderDefs()
+		toolFilter := al.sessionToolFilter(opts.SessionKey)
+		if opts.ToolFilter != nil {
+			sessionFilter, stepFilter := toolFilter, opts.ToolFilter
+			toolFilter = func(name string) bool {
+				return stepFilter(name) && (sessionFilter == nil || sessionFilter(name))
+			}
+		}
+		providerToolDefs := al.toolDefsFor(al.tools.ToProviderDefsFiltered(toolFilter), model)
 
 		// Log LLM request details
 		logger.DebugCF("agent", "LLM request",
 			map[string]interface{}{
 				"iteration":         iteration,
-				"model":             al.model,
+				"model":             model,
 				"messages_count":    len(messages),
 				"tools_count":       len(providerToolDefs),
 				"max_tokens":        8192,
-				"temperature":       0.7,
+				"temperature":       opts.Temperature,
 				"system_prompt_len": len(messages[0].Content),
 			})
 
@@ -449,11 +973,24 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 				"tools_json":    formatToolsForLog(providerToolDefs),
 			})
 
-		// Call LLM
-		response, err := al.provider.Chat(ctx, messages, providerToolDefs, al.model, map[string]interface{}{
+		// Stop before the call once the budget is used up or the user
+		// stopped the turn, also mid-turn
+		if err := context.Cause(ctx); err != nil {
+			return "", iteration, err
+		}
+		if err := al.checkBudget(opts.SessionKey); err != nil {
+			return "", iteration, err
+		}
+
+		// Call LLM with only what the model supports
+		caps := al.capabilities.Resolve(ctx, provider, model)
+		tracker := turnTrackerFrom(ctx)
+		tracker.llmStarted()
+		response, err := providers.ChatWithCapabilities(ctx, provider, caps, messages, providerToolDefs, model, map[string]interface{}{
 			"max_tokens":  8192,
-			"temperature": 0.7,
+			"temperature": opts.Temperature,
 		})
+		tracker.llmDone(response)
 
 		if err != nil {
 			logger.ErrorCF("agent", "LLM call failed",
@@ -463,10 +1000,15 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 				})
 			return "", iteration, fmt.Errorf("LLM call failed: %w", err)
 		}
+		al.recordUsage(opts.SessionKey, response.Usage)
+		if response.Usage != nil {
+			al.budget.Record(opts.SessionKey, model, response.Usage.PromptTokens, response.Usage.CompletionTokens)
+		}
 
 		// Check if no tool calls - we're done
 		if len(response.ToolCalls) == 0 {
 			finalContent = response.Content
+			answered = true
 			logger.InfoCF("agent", "LLM response without tool calls (direct answer)",
 				map[string]interface{}{
 					"iteration":     iteration,
@@ -487,6 +1029,18 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 				"iteration": iteration,
 			})
 
+		// Stop a model that keeps repeating itself before the calls are saved
+		refused, stuck := guard.screen(response.ToolCalls)
+		if stuck != "" {
+			logger.WarnCF("agent", "Stopped a turn repeating the same tool call",
+				map[string]interface{}{
+					"tools":       toolNames,
+					"iteration":   iteration,
+					"session_key": opts.SessionKey,
+				})
+			return stuckReply(stuck), iteration, nil
+		}
+
 		// Build assistant message with tool calls
 		assistantMsg := providers.Message{
 			Role:    "assistant",
@@ -508,46 +1062,32 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 		// Save assistant message with tool calls to session
 		al.sessions.AddFullMessage(opts.SessionKey, assistantMsg)
 
-		// Execute tool calls
-		for _, tc := range response.ToolCalls {
-			// Log tool call with arguments preview
-			argsJSON, _ := json.Marshal(tc.Arguments)
-			argsPreview := utils.Truncate(string(argsJSON), 200)
-			logger.InfoCF("agent", fmt.Sprintf("Tool call: %s(%s)", tc.Name, argsPreview),
-				map[string]interface{}{
-					"tool":      tc.Name,
-					"iteration": iteration,
-				})
-
-			// Create async callback for tools that implement AsyncTool
-			// NOTE: Following openclaw's design, async tools do NOT send results directly to users.
-			// Instead, they notify the agent via PublishInbound, and the agent decides
-			// whether to forward the result to the user (in processSystemMessage).
-			asyncCallback := func(callbackCtx context.Context, result *tools.ToolResult) {
-				// Log the async completion but don't send directly to user
-				// The agent will handle user notification via processSystemMessage
-				if !result.Silent && result.ForUser != "" {
-					logger.InfoCF("agent", "Async tool completed, agent will handle notification",
-						map[string]interface{}{
-							"tool":        tc.Name,
-							"content_len": len(result.ForUser),
-						})
-				}
-			}
+		// Execute tool calls; the worker pool bounds how many run at once
+		results := al.executeToolCalls(ctx, response.ToolCalls, opts, toolFilter, iteration, refused)
 
-			toolResult := al.tools.ExecuteWithContext(ctx, tc.Name, tc.Arguments, opts.Channel, opts.ChatID, asyncCallback)
+		compacted := false
+		for i, tc := range response.ToolCalls {
+			toolResult := results[i]
 
-			// Send ForUser content to user immediately if not Silent
-			if !toolResult.Silent && toolResult.ForUser != "" && opts.SendResponse {
+			// Send ForUser content and attachments to user immediately if not Silent
+			sentFiles := false
+			if !toolResult.Silent && (toolResult.ForUser != "" || len(toolResult.Attachments) > 0) && opts.SendResponse {
+				content := toolResult.ForUser
+				if content == "" {
+					content = attachmentCaption(toolResult.Attachments)
+				}
 				al.bus.PublishOutbound(bus.OutboundMessage{
 					Channel: opts.Channel,
 					ChatID:  opts.ChatID,
-					Content: toolResult.ForUser,
+					Content: content,
+					Media:   toolResult.AttachmentPaths(),
 				})
+				sentFiles = len(toolResult.Attachments) > 0
 				logger.DebugCF("agent", "Sent tool result to user",
 					map[string]interface{}{
 						"tool":        tc.Name,
-						"content_len": len(toolResult.ForUser),
+						"content_len": len(content),
+						"attachments": len(toolResult.Attachments),
 					})
 			}
 
@@ -556,6 +1096,26 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 			if contentForLLM == "" && toolResult.Err != nil {
 				contentForLLM = toolResult.Err.Error()
 			}
+			if contentForLLM == "" && toolResult.Data != nil {
+				if data, err := json.Marshal(toolResult.Data); err == nil {
+					contentForLLM = string(data)
+				}
+			}
+			if sentFiles {
+				// The model shouldn't send the files again or claim it can't
+				contentForLLM += "\n\n[Sent to the user: " + attachmentCaption(toolResult.Attachments) + "]"
+			}
+			if toolResult.Guard != nil {
+				// Steer the model to a safer command rather than a workaround
+				guardBlocks++
+				contentForLLM += "\n\n" + guardRewritePrompt(toolResult.Guard, guardBlocks)
+				logger.InfoCF("agent", "Asked model to rewrite blocked command",
+					map[string]interface{}{
+						"tool":    tc.Name,
+						"rule":    toolResult.Guard.Rule,
+						"attempt": guardBlocks,
+					})
+			}
 
 			toolResultMsg := providers.Message{
 				Role:       "tool",
@@ -566,12 +1126,138 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 
 			// Save tool result message to session
 			al.sessions.AddFullMessage(opts.SessionKey, toolResultMsg)
+
+			if tc.Name == "summarize_session" && !toolResult.IsError {
+				compacted = true
+			}
 		}
+
+		// The model compressed its context; continue from the compacted session
+		if compacted {
+			messages = al.rebuildMessages(opts)
+		}
+
+		// Checkpoint after each round of tool calls
+		al.sessions.UpdateTurn(opts.SessionKey, iteration)
+		al.sessions.Save(opts.SessionKey)
 	}
 
+	if !answered {
+		logger.WarnCF("agent", "Turn ran out of tool rounds",
+			map[string]interface{}{
+				"max":         maxIterations,
+				"session_key": opts.SessionKey,
+			})
+		return stuckReply(fmt.Sprintf("I used all %d tool rounds without finishing", maxIterations)), iteration, nil
+	}
 	return finalContent, iteration, nil
 }
 
+// executeToolCalls runs one round of tool calls and returns their results
+// in call order. Calls run one at a time, in order, since a later call may
+// depend on an earlier one (write_file then exec); only consecutive calls
+// to tools that declare themselves concurrency-safe run together, bounded
+// by the registry's worker pool. Calls in refused are not run and get the
+// result given there.
+func (al *AgentLoop) executeToolCalls(ctx context.Context, calls []providers.ToolCall, opts processOptions, toolFilter tools.ToolFilter, iteration int, refused map[int]*tools.ToolResult) []*tools.ToolResult {
+	results := make([]*tools.ToolResult, len(calls))
+	for i, result := range refused {
+		results[i] = result
+	}
+
+	var wg sync.WaitGroup
+	for i, tc := range calls {
+		if results[i] != nil {
+			continue
+		}
+		if !al.tools.ConcurrencySafe(tc.Name) {
+			wg.Wait()
+			results[i] = al.executeToolCall(ctx, tc, opts, toolFilter, iteration)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = al.executeToolCall(ctx, tc, opts, toolFilter, iteration)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// executeToolCall runs a single tool call.
+func (al *AgentLoop) executeToolCall(ctx context.Context, tc providers.ToolCall, opts processOptions, toolFilter tools.ToolFilter, iteration int) *tools.ToolResult {
+	// Log tool call with arguments preview
+	argsJSON, _ := json.Marshal(tc.Arguments)
+	argsPreview := utils.Truncate(string(argsJSON), 200)
+	logger.InfoCF("agent", "Tool call",
+		map[string]interface{}{
+			"tool":      tc.Name,
+			"arguments": argsPreview,
+			"iteration": iteration,
+		})
+
+	// Create async callback for tools that implement AsyncTool
+	// NOTE: Following openclaw's design, async tools do NOT send results directly to users.
+	// Instead, they notify the agent via PublishInbound, and the agent decides
+	// whether to forward the result to the user (in processSystemMessage).
+	asyncCallback := func(callbackCtx context.Context, result *tools.ToolResult) {
+		// Log the async completion but don't send directly to user
+		// The agent will handle user notification via processSystemMessage
+		if !result.Silent && result.ForUser != "" {
+			logger.InfoCF("agent", "Async tool completed, agent will handle notification",
+				map[string]interface{}{
+					"tool":        tc.Name,
+					"content_len": len(result.ForUser),
+				})
+		}
+	}
+
+	if toolFilter != nil && !toolFilter(tc.Name) {
+		return tools.ErrorResult(fmt.Sprintf("tool %q is disabled for this session", tc.Name))
+	}
+	if blocked := al.hookToolCall(ctx, opts, &tc); blocked != nil {
+		return blocked
+	}
+
+	// Long-running tools show partial output in the chat as they go
+	if opts.SendResponse && !constants.IsInternalChannel(opts.Channel) {
+		ctx = tools.WithProgress(ctx, func(update string) {
+			al.bus.PublishOutbound(bus.OutboundMessage{
+				Channel: opts.Channel,
+				ChatID:  opts.ChatID,
+				Content: update,
+			})
+		})
+	}
+	tracker := turnTrackerFrom(ctx)
+	tracker.toolStarted(tc.Name)
+	defer tracker.toolDone(tc.Name)
+	al.bus.PublishActivity(bus.Activity{
+		Channel: opts.Channel,
+		ChatID:  opts.ChatID,
+		Kind:    bus.ActivityToolStart,
+		Tool:    tc.Name,
+		Detail:  utils.Truncate(string(argsJSON), activityDetailLimit),
+	})
+	started := time.Now()
+	result := al.tools.ExecuteWithContext(ctx, tc.Name, tc.Arguments, opts.Channel, opts.ChatID, asyncCallback)
+	al.hookToolResult(ctx, opts, tc, result)
+	tracker.toolFinished(tc.Name, tc.Arguments, result, time.Since(started))
+	al.bus.PublishActivity(bus.Activity{
+		Channel: opts.Channel,
+		ChatID:  opts.ChatID,
+		Kind:    bus.ActivityToolDone,
+		Tool:    tc.Name,
+		Detail:  utils.Truncate(result.ForLLM, activityDetailLimit),
+		IsError: result.IsError,
+	})
+	return result
+}
+
+// activityDetailLimit bounds the arguments and results shown live.
+const activityDetailLimit = 2000
+
 // updateToolContexts updates the context for tools that need channel/chatID info.
 func (al *AgentLoop) updateToolContexts(channel, chatID string) {
 	// Use ContextualTool interface instead of type assertions
@@ -590,13 +1276,18 @@ func (al *AgentLoop) updateToolContexts(channel, chatID string) {
 			st.SetContext(channel, chatID)
 		}
 	}
+	if tool, ok := al.tools.Get("spawn_agent"); ok {
+		if st, ok := tool.(tools.ContextualTool); ok {
+			st.SetContext(channel, chatID)
+		}
+	}
 }
 
 // maybeSummarize triggers summarization if the session history exceeds thresholds.
 func (al *AgentLoop) maybeSummarize(sessionKey string) {
 	newHistory := al.sessions.GetHistory(sessionKey)
 	tokenEstimate := al.estimateTokens(newHistory)
-	threshold := al.contextWindow * 75 / 100
+	threshold := al.contextSize() * 75 / 100
 
 	if len(newHistory) > 20 || tokenEstimate > threshold {
 		if _, loading := al.summarizing.LoadOrStore(sessionKey, true); !loading {
@@ -622,6 +1313,8 @@ func (al *AgentLoop) GetStartupInfo() map[string]interface{} {
 	// Skills info
 	info["skills"] = al.contextBuilder.GetSkillsInfo()
 
+	info["low_memory"] = al.limits.LowMemory
+
 	return info
 }
 
@@ -678,7 +1371,7 @@ func formatToolsForLog(tools []providers.ToolDefinition) string {
 
 // summarizeSession summarizes the conversation history for a session.
 func (al *AgentLoop) summarizeSession(sessionKey string) {
-	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	ctx, cancel := context.WithTimeout(providers.WithPriority(context.Background(), providers.PriorityBackground), 120*time.Second)
 	defer cancel()
 
 	history := al.sessions.GetHistory(sessionKey)
@@ -693,7 +1386,7 @@ func (al *AgentLoop) summarizeSession(sessionKey string) {
 
 	// Oversized Message Guard
 	// Skip messages larger than 50% of context window to prevent summarizer overflow
-	maxMessageTokens := al.contextWindow / 2
+	maxMessageTokens := al.contextSize() / 2
 	validMessages := make([]providers.Message, 0)
 	omitted := false
 
@@ -727,7 +1420,7 @@ func (al *AgentLoop) summarizeSession(sessionKey string) {
 
 		// Merge them
 		mergePrompt := fmt.Sprintf("Merge these two conversation summaries into one cohesive summary:\n\n1: %s\n\n2: %s", s1, s2)
-		resp, err := al.provider.Chat(ctx, []providers.Message{{Role: "user", Content: mergePrompt}}, nil, al.model, map[string]interface{}{
+		resp, err := al.provider.Chat(ctx, []providers.Message{{Role: "user", Content: mergePrompt}}, nil, al.defaultModel(), map[string]interface{}{
 			"max_tokens":  1024,
 			"temperature": 0.3,
 		})
@@ -762,7 +1455,7 @@ func (al *AgentLoop) summarizeBatch(ctx context.Context, batch []providers.Messa
 		prompt += fmt.Sprintf("%s: %s\n", m.Role, m.Content)
 	}
 
-	response, err := al.provider.Chat(ctx, []providers.Message{{Role: "user", Content: prompt}}, nil, al.model, map[string]interface{}{
+	response, err := al.provider.Chat(ctx, []providers.Message{{Role: "user", Content: prompt}}, nil, al.defaultModel(), map[string]interface{}{
 		"max_tokens":  1024,
 		"temperature": 0.3,
 	})
@@ -780,3 +1473,13 @@ func (al *AgentLoop) estimateTokens(messages []providers.Message) int {
 	}
 	return total
 }
+
+// attachmentCaption lists attachments by name, for a tool result that has
+// files but no text for the user.
+func attachmentCaption(attachments []tools.Attachment) string {
+	names := make([]string, len(attachments))
+	for i, a := range attachments {
+		names[i] = a.DisplayName()
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,57 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// stuckPrefix starts the reply of a turn its safeguards stopped, so callers
+// such as /plan can tell it from an answer.
+const stuckPrefix = "I'm stuck: "
+
+// stuckReply is the reply when a turn is stopped for looping or running out
+// of tool rounds.
+func stuckReply(reason string) string {
+	return stuckPrefix + reason + ", so I stopped. Could you give me more detail, or break the task into smaller steps?"
+}
+
+// loopGuard spots a turn that keeps making the same tool call, as a
+// confused model can. A call may run limit times with the same arguments;
+// the next one is refused with a nudge to try something else, and one more
+// after that stops the turn.
+type loopGuard struct {
+	limit int // 0 for no limit
+	calls map[string]int
+}
+
+func newLoopGuard(limit int) *loopGuard {
+	return &loopGuard{limit: limit, calls: make(map[string]int)}
+}
+
+// screen records a round of tool calls. It returns results for the calls
+// it refuses, by index, and a reason to stop when the model repeats a call
+// it was already told to leave.
+func (g *loopGuard) screen(calls []providers.ToolCall) (map[int]*tools.ToolResult, string) {
+	if g.limit <= 0 {
+		return nil, ""
+	}
+	refused := make(map[int]*tools.ToolResult)
+	for i, tc := range calls {
+		// Arguments marshal with sorted keys, so equal calls get equal keys
+		args, _ := json.Marshal(tc.Arguments)
+		key := tc.Name + " " + string(args)
+		g.calls[key]++
+		switch n := g.calls[key]; {
+		case n > g.limit+1:
+			return nil, fmt.Sprintf("I kept calling %s with the same arguments without getting anywhere", tc.Name)
+		case n > g.limit:
+			refused[i] = tools.ErrorResult(fmt.Sprintf(
+				"Not run: you already called %s with these arguments %d times this turn, and it would give the same result. Use what you have, try a different approach, or tell the user what is blocking you.",
+				tc.Name, g.limit))
+		}
+	}
+	return refused, ""
+}
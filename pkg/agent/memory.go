@@ -16,10 +16,12 @@ import (
 // MemoryStore manages persistent memory for the agent.
 // - Long-term memory: memory/MEMORY.md
 // - Daily notes: memory/YYYYMM/YYYYMMDD.md
+// - Extracted facts: memory/facts.json
 type MemoryStore struct {
 	workspace  string
 	memoryDir  string
 	memoryFile string
+	facts      *FactStore
 }
 
 // NewMemoryStore creates a new MemoryStore with the given workspace path.
@@ -35,6 +37,7 @@ func NewMemoryStore(workspace string) *MemoryStore {
 		workspace:  workspace,
 		memoryDir:  memoryDir,
 		memoryFile: memoryFile,
+		facts:      NewFactStore(memoryDir),
 	}
 }
 
@@ -139,6 +142,11 @@ func (ms *MemoryStore) GetMemoryContext() string {
 		parts = append(parts, "## Long-term Memory\n\n"+longTerm)
 	}
 
+	// Facts extracted from conversations
+	if facts := ms.facts.Context(); facts != "" {
+		parts = append(parts, facts)
+	}
+
 	// Recent daily notes (last 3 days)
 	recentNotes := ms.GetRecentDailyNotes(3)
 	if recentNotes != "" {
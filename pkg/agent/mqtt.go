@@ -0,0 +1,35 @@
+package agent
+
+import (
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/mqtt"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// mqttTools holds one mqtt tool per broker, shared by the agent's and the
+// subagents' registries: two connections with the same client ID would
+// keep knocking each other off the broker.
+var mqttTools sync.Map
+
+// registerMQTTTool adds the mqtt tool when a broker is configured for the
+// mqtt channel, whether or not the channel itself is on.
+func registerMQTTTool(registry *tools.ToolRegistry, cfg *config.Config) {
+	mc := cfg.Channels.MQTT
+	if !cfg.Tools.MQTT.Enabled || mc.Broker == "" {
+		return
+	}
+	opts := mqtt.Options{
+		Broker:   mc.Broker,
+		Username: mc.Username,
+		Password: mc.Password,
+	}
+	if mc.ClientID != "" {
+		// The channel connects as ClientID
+		opts.ClientID = mc.ClientID + "-tool"
+	}
+	tool := tools.NewMQTTTool(opts, cfg.Tools.MQTT.AllowPublish)
+	shared, _ := mqttTools.LoadOrStore(mc.Broker+"\x00"+opts.ClientID, tool)
+	registry.Register(shared.(*tools.MQTTTool))
+}
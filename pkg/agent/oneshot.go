@@ -0,0 +1,48 @@
+package agent
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OneShotResult is the outcome of RunOneShot, shaped for scripts.
+type OneShotResult struct {
+	Response   string           `json:"response"`
+	Error      string           `json:"error,omitempty"`
+	Session    string           `json:"session,omitempty"`
+	Model      string           `json:"model"`
+	ToolCalls  []ToolCallRecord `json:"tool_calls"`
+	Usage      TurnUsage        `json:"usage"`
+	DurationMS int64            `json:"duration_ms"`
+}
+
+// RunOneShot runs prompt as a single task and reports what it took. With
+// an empty sessionKey the task starts from a blank history and leaves no
+// session behind; otherwise it continues that session like any turn.
+func (al *AgentLoop) RunOneShot(ctx context.Context, prompt, sessionKey string) OneShotResult {
+	result := OneShotResult{Session: sessionKey}
+	if sessionKey == "" {
+		sessionKey = "run:" + uuid.NewString()
+		defer func() {
+			al.sessions.Delete(sessionKey)
+			al.usage.Delete(sessionKey)
+		}()
+	}
+	result.Model = al.SessionModel(sessionKey)
+
+	tracker := NewTurnTracker()
+	response, err := al.ProcessDirectWithChannel(WithTurnTracker(ctx, tracker), prompt, sessionKey, "cli", "run")
+	result.Response = response
+	if err != nil {
+		result.Error = err.Error()
+	}
+	result.ToolCalls = tracker.ToolCalls()
+	if result.ToolCalls == nil {
+		result.ToolCalls = []ToolCallRecord{}
+	}
+	result.Usage = tracker.Usage()
+	result.DurationMS = time.Since(tracker.start).Milliseconds()
+	return result
+}
@@ -0,0 +1,154 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/session"
+)
+
+// maxTemperature is the highest temperature /temp accepts, the upper bound
+// most providers allow.
+const maxTemperature = 2.0
+
+// modelCommand handles "/model [name|reset]": the chat's turns use the named
+// model instead of the configured one.
+func modelCommand(ctx context.Context, al *AgentLoop, msg bus.InboundMessage, args string) (string, error) {
+	o := al.sessions.GetOverrides(msg.SessionKey)
+	switch args {
+	case "":
+		return al.describeOverrides(o), nil
+	case "reset":
+		o.Model = ""
+	default:
+		if strings.ContainsAny(args, " \t\n") {
+			return "", fmt.Errorf("model names have no spaces")
+		}
+		o.Model = args
+	}
+	if err := al.saveOverrides(msg.SessionKey, o); err != nil {
+		return "", err
+	}
+	return al.describeOverrides(o), nil
+}
+
+// providerCommand handles "/provider [name|reset]". The provider must be
+// configured; it is created now so a typo is reported here rather than on
+// the next turn.
+func providerCommand(ctx context.Context, al *AgentLoop, msg bus.InboundMessage, args string) (string, error) {
+	o := al.sessions.GetOverrides(msg.SessionKey)
+	switch args {
+	case "":
+		return al.describeOverrides(o), nil
+	case "reset":
+		o.Provider = ""
+	default:
+		name := strings.ToLower(args)
+		if _, err := al.namedProvider(name); err != nil {
+			return "", err
+		}
+		o.Provider = name
+	}
+	if err := al.saveOverrides(msg.SessionKey, o); err != nil {
+		return "", err
+	}
+	return al.describeOverrides(o), nil
+}
+
+// tempCommand handles "/temp [0-2|reset]".
+func tempCommand(ctx context.Context, al *AgentLoop, msg bus.InboundMessage, args string) (string, error) {
+	o := al.sessions.GetOverrides(msg.SessionKey)
+	switch args {
+	case "":
+		return al.describeOverrides(o), nil
+	case "reset":
+		o.Temperature = nil
+	default:
+		t, err := strconv.ParseFloat(args, 64)
+		if err != nil || t < 0 || t > maxTemperature {
+			return "", fmt.Errorf("temperature must be a number from 0 to %g", maxTemperature)
+		}
+		o.Temperature = &t
+	}
+	if err := al.saveOverrides(msg.SessionKey, o); err != nil {
+		return "", err
+	}
+	return al.describeOverrides(o), nil
+}
+
+func (al *AgentLoop) saveOverrides(sessionKey string, o session.Overrides) error {
+	al.sessions.SetOverrides(sessionKey, o)
+	return al.sessions.Save(sessionKey)
+}
+
+// describeOverrides shows the settings this chat's turns use, marking the
+// ones changed for it.
+func (al *AgentLoop) describeOverrides(o session.Overrides) string {
+	setting := func(value, override string) string {
+		if override == "" {
+			return value + " (default)"
+		}
+		return override + " (this chat)"
+	}
+	provider := al.providerName
+	if provider == "" {
+		provider = "auto"
+	}
+	temperature := ""
+	if o.Temperature != nil {
+		temperature = strconv.FormatFloat(*o.Temperature, 'g', -1, 64)
+	}
+	return fmt.Sprintf("Model: %s\nProvider: %s\nTemperature: %s\nChange with /model, /provider or /temp; \"reset\" restores the default.",
+		setting(al.defaultModel(), o.Model),
+		setting(provider, o.Provider),
+		setting(strconv.FormatFloat(al.defaultTemperature(), 'g', -1, 64), temperature))
+}
+
+// namedProvider returns the configured provider called name, creating it
+// on first use.
+func (al *AgentLoop) namedProvider(name string) (providers.LLMProvider, error) {
+	if p, ok := al.namedProviders.Load(name); ok {
+		return p.(providers.LLMProvider), nil
+	}
+	if al.newProvider == nil {
+		return nil, fmt.Errorf("switching providers is not available")
+	}
+	p, err := al.newProvider(name)
+	if err != nil {
+		return nil, err
+	}
+	actual, _ := al.namedProviders.LoadOrStore(name, p)
+	return actual.(providers.LLMProvider), nil
+}
+
+// applyOverrides fills in the provider, model and temperature for a turn
+// from the session's overrides and the configured defaults. A model given
+// by the caller (/compare) is kept.
+func (al *AgentLoop) applyOverrides(opts *processOptions) {
+	o := al.sessions.GetOverrides(opts.SessionKey)
+	opts.Provider = al.provider
+	if o.Provider != "" {
+		p, err := al.namedProvider(o.Provider)
+		if err != nil {
+			logger.WarnCF("agent", "Session provider unavailable, using the default",
+				map[string]interface{}{"session_key": opts.SessionKey, "provider": o.Provider, "error": err.Error()})
+		} else {
+			opts.Provider = p
+		}
+	}
+	if opts.Model == "" {
+		opts.Model = o.Model
+	}
+	if opts.Model == "" {
+		opts.Model = al.defaultModel()
+	}
+	opts.Temperature = al.defaultTemperature()
+	if o.Temperature != nil {
+		opts.Temperature = *o.Temperature
+	}
+}
@@ -0,0 +1,127 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// noPersona is the /persona argument that turns the persona off for a
+// chat, even if a default is configured.
+const noPersona = "none"
+
+// personaVerbosity maps the verbosity levels to instructions, worded like
+// the /shorter and /more preferences.
+var personaVerbosity = map[string]string{
+	"terse":    "Keep replies as short as possible: a sentence or two, no preamble.",
+	"brief":    "Keep replies brief and to the point.",
+	"normal":   "",
+	"detailed": "Give thorough, detailed replies with explanations and examples.",
+}
+
+// personaPrompt renders a persona as a section of the system prompt.
+func personaPrompt(p config.PersonaConfig) string {
+	var lines []string
+	if p.Name != "" {
+		lines = append(lines, fmt.Sprintf("Your name is %s; use it when you introduce yourself.", p.Name))
+	}
+	if p.Tone != "" {
+		lines = append(lines, fmt.Sprintf("Your tone is %s.", strings.TrimSuffix(p.Tone, ".")))
+	}
+	if text, ok := personaVerbosity[strings.ToLower(p.Verbosity)]; !ok && p.Verbosity != "" {
+		lines = append(lines, fmt.Sprintf("Verbosity: %s.", p.Verbosity))
+	} else if text != "" {
+		lines = append(lines, text)
+	}
+	if p.Language != "" {
+		lines = append(lines, fmt.Sprintf("Always reply in %s, whatever language the user writes in.", p.Language))
+	}
+	if p.MaxWords > 0 {
+		lines = append(lines, fmt.Sprintf("Keep replies under about %d words unless asked for more.", p.MaxWords))
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return "\n\n## Persona\n\n- " + strings.Join(lines, "\n- ")
+}
+
+// chatPersona returns the persona a chat uses: the one picked with
+// /persona, else the configured default. ok is false for none.
+func (al *AgentLoop) chatPersona(sessionKey string) (name string, persona config.PersonaConfig, ok bool) {
+	name = al.sessions.GetOverrides(sessionKey).Persona
+	al.settingsMu.RLock()
+	defer al.settingsMu.RUnlock()
+	if name == "" {
+		name = al.persona
+	}
+	persona, ok = al.personas[name]
+	return name, persona, ok
+}
+
+// Personas lists the configured personas, sorted.
+func (al *AgentLoop) Personas() []string {
+	al.settingsMu.RLock()
+	defer al.settingsMu.RUnlock()
+	names := make([]string, 0, len(al.personas))
+	for name := range al.personas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// personaCommand handles "/persona [name|none|reset]": the chat's replies
+// use the named persona instead of the default.
+func personaCommand(ctx context.Context, al *AgentLoop, msg bus.InboundMessage, args string) (string, error) {
+	o := al.sessions.GetOverrides(msg.SessionKey)
+	switch args {
+	case "":
+		return al.describePersona(msg.SessionKey), nil
+	case "reset":
+		o.Persona = ""
+	case noPersona:
+		o.Persona = noPersona
+	default:
+		names := al.Personas()
+		if !slices.Contains(names, args) {
+			if len(names) == 0 {
+				return "", fmt.Errorf("no personas are configured; add them under agents.personas")
+			}
+			return "", fmt.Errorf("no persona %q; personas are %s", args, strings.Join(names, ", "))
+		}
+		o.Persona = args
+	}
+	if err := al.saveOverrides(msg.SessionKey, o); err != nil {
+		return "", err
+	}
+	return al.describePersona(msg.SessionKey), nil
+}
+
+// describePersona shows the chat's persona and the others.
+func (al *AgentLoop) describePersona(sessionKey string) string {
+	name, persona, ok := al.chatPersona(sessionKey)
+	var sb strings.Builder
+	switch {
+	case ok:
+		fmt.Fprintf(&sb, "Persona: %s", name)
+		if al.sessions.GetOverrides(sessionKey).Persona == "" {
+			sb.WriteString(" (default)")
+		}
+		if prompt := personaPrompt(persona); prompt != "" {
+			sb.WriteString(strings.Replace(prompt, "\n\n## Persona\n\n", "\n", 1))
+		}
+	case name == "" || name == noPersona:
+		sb.WriteString("Persona: none")
+	default:
+		fmt.Fprintf(&sb, "Persona: none (%s is not configured)", name)
+	}
+	if names := al.Personas(); len(names) > 0 {
+		fmt.Fprintf(&sb, "\nPersonas: %s\nSwitch with /persona <name>; /persona none turns it off and /persona reset restores the default.", strings.Join(names, ", "))
+	}
+	return sb.String()
+}
@@ -0,0 +1,74 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// pinCommand handles "/pin [text]": the text, or the agent's last reply,
+// is kept word for word in the system prompt of every later turn, however
+// often the history is summarized.
+func pinCommand(ctx context.Context, al *AgentLoop, msg bus.InboundMessage, args string) (string, error) {
+	fact := args
+	if fact == "" {
+		history := al.sessions.GetHistory(msg.SessionKey)
+		for i := len(history) - 1; i >= 0; i-- {
+			if m := history[i]; m.Role == "assistant" && len(m.ToolCalls) == 0 && strings.TrimSpace(m.Content) != "" {
+				fact = strings.TrimSpace(m.Content)
+				break
+			}
+		}
+		if fact == "" {
+			return "", fmt.Errorf("nothing to pin yet")
+		}
+	}
+
+	al.sessions.AddPinned(msg.SessionKey, fact)
+	if err := al.sessions.Save(msg.SessionKey); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("📌 Pinned: %s", utils.Truncate(fact, 120)), nil
+}
+
+// pinsCommand lists the chat's pinned facts, numbered for /unpin.
+func pinsCommand(ctx context.Context, al *AgentLoop, msg bus.InboundMessage, args string) (string, error) {
+	pinned := al.sessions.GetPinned(msg.SessionKey)
+	if len(pinned) == 0 {
+		return "Nothing pinned. Use /pin <text>, or /pin alone to pin my last reply.", nil
+	}
+	var sb strings.Builder
+	sb.WriteString("📌 Pinned:")
+	for i, fact := range pinned {
+		fmt.Fprintf(&sb, "\n%d. %s", i+1, utils.Truncate(fact, 200))
+	}
+	return sb.String(), nil
+}
+
+// unpinCommand handles "/unpin <number|all>".
+func unpinCommand(ctx context.Context, al *AgentLoop, msg bus.InboundMessage, args string) (string, error) {
+	pinned := al.sessions.GetPinned(msg.SessionKey)
+	var reply string
+	switch args {
+	case "":
+		return "", fmt.Errorf("say which pin to remove; /pins lists them")
+	case "all":
+		pinned, reply = nil, "All pins removed."
+	default:
+		n, err := strconv.Atoi(args)
+		if err != nil || n < 1 || n > len(pinned) {
+			return "", fmt.Errorf("no pin %q; /pins lists them", args)
+		}
+		reply = fmt.Sprintf("Unpinned: %s", utils.Truncate(pinned[n-1], 120))
+		pinned = append(pinned[:n-1], pinned[n:]...)
+	}
+	al.sessions.SetPinned(msg.SessionKey, pinned)
+	if err := al.sessions.Save(msg.SessionKey); err != nil {
+		return "", err
+	}
+	return reply, nil
+}
@@ -0,0 +1,297 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/session"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const (
+	// maxPlanSteps bounds a plan, so a small model can't plan forever.
+	maxPlanSteps = 10
+	// maxReplans is how often a plan's remaining steps are redone after a
+	// step fails before the run stops and waits for the user.
+	maxReplans = 2
+)
+
+const planningPrompt = `Break the goal below into a short plan of concrete steps you can carry out with your tools, in order. Each step should be one action with a clear result, such as "Find the config files under /etc/nginx" or "Summarize the errors in the log". Use as few steps as the goal needs, at most %d.
+
+Return a JSON array of step descriptions and nothing else, e.g. ["First step", "Second step"].
+
+GOAL:
+%s`
+
+const replanningPrompt = `You are carrying out a plan for the goal below, and a step failed.
+
+GOAL:
+%s
+
+STEPS SO FAR:
+%s
+
+Write new steps to reach the goal from here, working around the failure. Don't repeat steps that are done. At most %d steps.
+
+Return a JSON array of step descriptions and nothing else. Return [] if the goal can't be reached.`
+
+// stepStatus matches the status line a step's reply ends with.
+var stepStatus = regexp.MustCompile(`(?im)^\s*STATUS:\s*(done|failed)\b:?\s*(.*)$`)
+
+// planCommand handles "/plan <goal>", "/plan go", "/plan cancel" and
+// "/plan" to show the chat's plan.
+func planCommand(ctx context.Context, al *AgentLoop, msg bus.InboundMessage, args string) (string, error) {
+	plan := al.sessions.GetPlan(msg.SessionKey)
+	switch strings.ToLower(args) {
+	case "":
+		if plan == nil {
+			return "No plan. Start one with /plan <goal>.", nil
+		}
+		return formatPlan(plan) + planHint(plan), nil
+	case "go", "run", "yes":
+		if plan == nil {
+			return "", fmt.Errorf("no plan to run; start one with /plan <goal>")
+		}
+		plan.Approved = true
+		return al.runPlan(ctx, msg, plan)
+	case "cancel", "clear":
+		al.sessions.SetPlan(msg.SessionKey, nil)
+		if err := al.sessions.Save(msg.SessionKey); err != nil {
+			return "", err
+		}
+		return "Plan dropped.", nil
+	}
+
+	steps, err := al.makePlan(ctx, msg, fmt.Sprintf(planningPrompt, maxPlanSteps, args))
+	if err != nil {
+		return "", fmt.Errorf("couldn't make a plan: %w", err)
+	}
+	if len(steps) == 0 {
+		return "", fmt.Errorf("the model returned no steps; try describing the goal differently")
+	}
+	plan = &session.Plan{Goal: args, Created: time.Now()}
+	for _, step := range steps {
+		plan.Steps = append(plan.Steps, session.PlanStep{Description: step, Status: session.StepPending})
+	}
+	if !al.planApproval {
+		plan.Approved = true
+		return al.runPlan(ctx, msg, plan)
+	}
+	if err := al.savePlan(msg.SessionKey, plan); err != nil {
+		return "", err
+	}
+	return formatPlan(plan) + planHint(plan), nil
+}
+
+// makePlan asks the chat's model for a list of steps.
+func (al *AgentLoop) makePlan(ctx context.Context, msg bus.InboundMessage, prompt string) ([]string, error) {
+	opts := processOptions{SessionKey: msg.SessionKey}
+	al.applyOverrides(&opts)
+	response, err := opts.Provider.Chat(ctx, []providers.Message{
+		{Role: "user", Content: prompt},
+	}, nil, opts.Model, map[string]interface{}{
+		"max_tokens":  1024,
+		"temperature": 0.2,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return parsePlanSteps(response.Content)
+}
+
+// parsePlanSteps reads the planner's JSON array, tolerating a code fence
+// or text around it.
+func parsePlanSteps(content string) ([]string, error) {
+	start := strings.Index(content, "[")
+	end := strings.LastIndex(content, "]")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no JSON array in planner response")
+	}
+	var raw []string
+	if err := json.Unmarshal([]byte(content[start:end+1]), &raw); err != nil {
+		return nil, fmt.Errorf("invalid planner response: %w", err)
+	}
+	var steps []string
+	for _, step := range raw {
+		if step = strings.TrimSpace(step); step != "" {
+			steps = append(steps, step)
+		}
+	}
+	if len(steps) > maxPlanSteps {
+		steps = steps[:maxPlanSteps]
+	}
+	return steps, nil
+}
+
+// runPlan carries out the plan's remaining steps one at a time in the
+// chat's session, reporting each step as it finishes. When a step fails
+// the rest are replanned, up to maxReplans times; after that the run stops
+// and /plan go retries from the failed step.
+func (al *AgentLoop) runPlan(ctx context.Context, msg bus.InboundMessage, plan *session.Plan) (string, error) {
+	logger.InfoCF("agent", "Running plan",
+		map[string]interface{}{"goal": utils.Truncate(plan.Goal, 80), "steps": len(plan.Steps), "session_key": msg.SessionKey})
+
+	var lastReply string
+	for i := plan.Next(); i >= 0; i = plan.Next() {
+		if ctx.Err() != nil {
+			plan.Steps[i].Status = session.StepPending
+			al.savePlan(msg.SessionKey, plan)
+			return "", ctx.Err()
+		}
+		plan.Steps[i].Status = session.StepRunning
+		al.savePlan(msg.SessionKey, plan)
+
+		reply, err := al.runAgentLoop(ctx, processOptions{
+			SessionKey:      msg.SessionKey,
+			Channel:         msg.Channel,
+			ChatID:          msg.ChatID,
+			SenderID:        msg.SenderID,
+			UserMessage:     stepPrompt(plan, i),
+			DefaultResponse: "STATUS: failed: no answer",
+			EnableSummary:   true,
+		})
+		result, failed := parseStepReply(reply, err)
+		plan.Steps[i].Result = utils.Truncate(result, 500)
+		if !failed {
+			plan.Steps[i].Status = session.StepDone
+			lastReply = result
+			al.reportStep(msg, plan, i)
+			continue
+		}
+
+		plan.Steps[i].Status = session.StepFailed
+		al.reportStep(msg, plan, i)
+		if err != nil && ctx.Err() != nil {
+			al.savePlan(msg.SessionKey, plan)
+			return "", err
+		}
+		if plan.Replans >= maxReplans || !al.replan(ctx, msg, plan, i) {
+			al.savePlan(msg.SessionKey, plan)
+			return fmt.Sprintf("Step %d failed: %s\n\n%s\n\nSend /plan go to retry from the failed step, or /plan cancel.",
+				i+1, result, formatPlan(plan)), nil
+		}
+	}
+
+	al.sessions.SetPlan(msg.SessionKey, nil)
+	if err := al.sessions.Save(msg.SessionKey); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s\n\n%s", formatPlan(plan), lastReply), nil
+}
+
+// replan replaces the steps after the failed one with new steps from the
+// model. The failed step stays in the plan, marked skipped. It returns
+// false if no new steps came back.
+func (al *AgentLoop) replan(ctx context.Context, msg bus.InboundMessage, plan *session.Plan, failed int) bool {
+	steps, err := al.makePlan(ctx, msg, fmt.Sprintf(replanningPrompt, plan.Goal, formatPlan(plan), maxPlanSteps))
+	if err != nil || len(steps) == 0 {
+		logger.WarnCF("agent", "Replanning failed",
+			map[string]interface{}{"session_key": msg.SessionKey, "error": fmt.Sprint(err)})
+		return false
+	}
+	plan.Replans++
+	plan.Steps[failed].Status = session.StepSkipped
+	plan.Steps = plan.Steps[:failed+1]
+	for _, step := range steps {
+		plan.Steps = append(plan.Steps, session.PlanStep{Description: step, Status: session.StepPending})
+	}
+	al.savePlan(msg.SessionKey, plan)
+	return true
+}
+
+// stepPrompt is the message that runs step i.
+func stepPrompt(plan *session.Plan, i int) string {
+	return fmt.Sprintf(`I'm working through a plan for: %s
+
+%s
+
+Do step %d now, and only that step: %s
+
+When you're done, end your reply with a line "STATUS: done", or "STATUS: failed: <reason>" if you couldn't complete the step.`,
+		plan.Goal, formatPlan(plan), i+1, plan.Steps[i].Description)
+}
+
+// parseStepReply reads a step's outcome from its reply and removes the
+// status line. A reply without one counts as done, unless the turn got
+// stuck.
+func parseStepReply(reply string, err error) (string, bool) {
+	if err != nil {
+		return err.Error(), true
+	}
+	if strings.HasPrefix(reply, stuckPrefix) {
+		return reply, true
+	}
+	matches := stepStatus.FindAllStringSubmatchIndex(reply, -1)
+	if len(matches) == 0 {
+		return strings.TrimSpace(reply), false
+	}
+	m := matches[len(matches)-1]
+	failed := strings.EqualFold(reply[m[2]:m[3]], "failed")
+	reason := strings.TrimSpace(reply[m[4]:m[5]])
+	text := strings.TrimSpace(reply[:m[0]] + reply[m[1]:])
+	if failed && reason != "" {
+		if text == "" {
+			return reason, true
+		}
+		return text + "\n" + reason, true
+	}
+	return text, failed
+}
+
+// reportStep tells the chat a step finished, like workflow steps.
+func (al *AgentLoop) reportStep(msg bus.InboundMessage, plan *session.Plan, i int) {
+	if constants.IsInternalChannel(msg.Channel) {
+		return
+	}
+	mark := "✓"
+	if plan.Steps[i].Status == session.StepFailed {
+		mark = "✗"
+	}
+	al.bus.PublishOutbound(bus.OutboundMessage{
+		Channel: msg.Channel,
+		ChatID:  msg.ChatID,
+		Content: fmt.Sprintf("%s Step %d/%d: %s", mark, i+1, len(plan.Steps), plan.Steps[i].Description),
+	})
+}
+
+func (al *AgentLoop) savePlan(sessionKey string, plan *session.Plan) error {
+	al.sessions.SetPlan(sessionKey, plan)
+	return al.sessions.Save(sessionKey)
+}
+
+// formatPlan lists the steps with their status.
+func formatPlan(plan *session.Plan) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Plan: %s", plan.Goal)
+	for i, step := range plan.Steps {
+		mark := map[string]string{
+			session.StepDone:    "[x]",
+			session.StepFailed:  "[!]",
+			session.StepRunning: "[>]",
+			session.StepSkipped: "[-]",
+		}[step.Status]
+		if mark == "" {
+			mark = "[ ]"
+		}
+		fmt.Fprintf(&sb, "\n%s %d. %s", mark, i+1, step.Description)
+		if (step.Status == session.StepFailed || step.Status == session.StepSkipped) && step.Result != "" {
+			fmt.Fprintf(&sb, " (%s)", utils.Truncate(step.Result, 120))
+		}
+	}
+	return sb.String()
+}
+
+func planHint(plan *session.Plan) string {
+	if !plan.Approved {
+		return "\n\nSend /plan go to run it, or /plan cancel to drop it."
+	}
+	return "\n\nSend /plan go to continue, or /plan cancel to drop it."
+}
@@ -0,0 +1,34 @@
+package agent
+
+import (
+	"context"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// registerPlugins adds the tools provided by executables in the plugins
+// folder. Plugins that don't describe themselves, or whose tool name is
+// taken, are logged and left out. They inherit the environment exec
+// commands do.
+func registerPlugins(registry *tools.ToolRegistry, cfg config.PluginsConfig, env config.ExecEnvConfig, workspace string) {
+	if !cfg.Enabled {
+		return
+	}
+	dir := cfg.Path(workspace)
+	timeout := time.Duration(cfg.Timeout) * time.Second
+	policy := &tools.EnvPolicy{Inherit: env.Inherit, Deny: env.Deny}
+	plugins, errs := tools.LoadPlugins(context.Background(), dir, timeout, policy, []string{"PICOCLAW_WORKSPACE=" + workspace})
+	for _, err := range errs {
+		logger.WarnCF("plugins", "Skipping plugin", map[string]interface{}{"dir": dir, "error": err.Error()})
+	}
+	for _, p := range plugins {
+		if err := registry.RegisterUnique(p); err != nil {
+			logger.WarnCF("plugins", "Skipping plugin", map[string]interface{}{"path": p.Path(), "error": err.Error()})
+			continue
+		}
+		logger.InfoCF("plugins", "Plugin tool registered", map[string]interface{}{"tool": p.Name(), "path": p.Path()})
+	}
+}
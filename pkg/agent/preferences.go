@@ -0,0 +1,212 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// maxVerbosity bounds how far /shorter and /more can move the reply length.
+const maxVerbosity = 2
+
+// Preferences are formatting and verbosity choices learned from a user's
+// feedback and applied to every later reply to them.
+type Preferences struct {
+	Verbosity int       `json:"verbosity"` // -2 (terse) to 2 (detailed)
+	Notes     []string  `json:"notes,omitempty"`
+	Voice     string    `json:"voice,omitempty"` // voice reply mode set with /voice; "" for the configured default
+	Updated   time.Time `json:"updated"`
+}
+
+// Prompt renders the preferences as instructions for the system prompt.
+func (p Preferences) Prompt() string {
+	var lines []string
+	switch {
+	case p.Verbosity <= -2:
+		lines = append(lines, "Keep replies as short as possible: a sentence or two, no preamble.")
+	case p.Verbosity == -1:
+		lines = append(lines, "Keep replies brief and to the point.")
+	case p.Verbosity == 1:
+		lines = append(lines, "Give somewhat more detail and explanation than usual.")
+	case p.Verbosity >= 2:
+		lines = append(lines, "Give thorough, detailed replies with explanations and examples.")
+	}
+	lines = append(lines, p.Notes...)
+	if len(lines) == 0 {
+		return ""
+	}
+	return "\n\n## User Preferences\n\nThis user has asked for the following; follow it unless they say otherwise:\n- " + strings.Join(lines, "\n- ")
+}
+
+// PreferenceStore keeps each user's preferences in state/preferences.json.
+type PreferenceStore struct {
+	path  string
+	mu    sync.Mutex
+	users map[string]Preferences
+}
+
+func NewPreferenceStore(stateDir string) *PreferenceStore {
+	s := &PreferenceStore{
+		path:  filepath.Join(stateDir, "preferences.json"),
+		users: make(map[string]Preferences),
+	}
+	if data, err := os.ReadFile(s.path); err == nil {
+		if err := json.Unmarshal(data, &s.users); err != nil {
+			logger.WarnCF("agent", "Ignoring unreadable preferences file",
+				map[string]interface{}{"error": err.Error()})
+		}
+	}
+	return s
+}
+
+// Get returns a user's preferences.
+func (s *PreferenceStore) Get(user string) Preferences {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.users[user]
+}
+
+// Update changes a user's preferences with fn and saves the store.
+func (s *PreferenceStore) Update(user string, fn func(p *Preferences)) (Preferences, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.users[user]
+	fn(&p)
+	p.Updated = time.Now()
+	s.users[user] = p
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return p, err
+	}
+	data, err := json.MarshalIndent(s.users, "", "  ")
+	if err != nil {
+		return p, err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return p, err
+	}
+	return p, os.Rename(tmp, s.path)
+}
+
+// Reset forgets a user's preferences.
+func (s *PreferenceStore) Reset(user string) error {
+	_, err := s.Update(user, func(p *Preferences) { *p = Preferences{} })
+	return err
+}
+
+// preferenceUser identifies the user a message came from. Telegram sender
+// IDs carry the username after "|", which can change, so only the ID is used.
+func preferenceUser(channel, senderID string) string {
+	id, _, _ := strings.Cut(senderID, "|")
+	return channel + ":" + id
+}
+
+// adjustVerbosity moves a user's verbosity by delta and describes the result.
+func (al *AgentLoop) adjustVerbosity(msg bus.InboundMessage, delta int) (string, error) {
+	p, err := al.preferences.Update(preferenceUser(msg.Channel, msg.SenderID), func(p *Preferences) {
+		p.Verbosity = max(-maxVerbosity, min(maxVerbosity, p.Verbosity+delta))
+	})
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case p.Verbosity < 0:
+		return fmt.Sprintf("Got it, I'll keep replies shorter (level %d).", p.Verbosity), nil
+	case p.Verbosity > 0:
+		return fmt.Sprintf("Got it, I'll give more detail (level +%d).", p.Verbosity), nil
+	default:
+		return "Got it, back to my usual level of detail.", nil
+	}
+}
+
+// shorterCommand handles "/shorter".
+func shorterCommand(ctx context.Context, al *AgentLoop, msg bus.InboundMessage, args string) (string, error) {
+	return al.adjustVerbosity(msg, -1)
+}
+
+// moreCommand handles "/more detail" (or just "/more").
+func moreCommand(ctx context.Context, al *AgentLoop, msg bus.InboundMessage, args string) (string, error) {
+	return al.adjustVerbosity(msg, 1)
+}
+
+// preferCommand handles "/prefer <instruction>", e.g. "/prefer no bullet lists".
+func preferCommand(ctx context.Context, al *AgentLoop, msg bus.InboundMessage, args string) (string, error) {
+	if args == "" {
+		return "", fmt.Errorf("say what you prefer")
+	}
+	_, err := al.preferences.Update(preferenceUser(msg.Channel, msg.SenderID), func(p *Preferences) {
+		if !slices.Contains(p.Notes, args) {
+			p.Notes = append(p.Notes, args)
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Noted: %s", args), nil
+}
+
+// prefsCommand handles "/prefs" and "/prefs reset".
+func prefsCommand(ctx context.Context, al *AgentLoop, msg bus.InboundMessage, args string) (string, error) {
+	user := preferenceUser(msg.Channel, msg.SenderID)
+	switch args {
+	case "":
+		p := al.preferences.Get(user)
+		if p.Verbosity == 0 && len(p.Notes) == 0 && p.Voice == "" {
+			return "No preferences saved. Use /shorter, /more detail, /prefer <instruction> or /voice.", nil
+		}
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "Verbosity: %+d", p.Verbosity)
+		if p.Voice != "" {
+			fmt.Fprintf(&sb, "\nVoice replies: %s", p.Voice)
+		}
+		for _, note := range p.Notes {
+			sb.WriteString("\n• " + note)
+		}
+		return sb.String(), nil
+	case "reset", "clear":
+		if err := al.preferences.Reset(user); err != nil {
+			return "", err
+		}
+		return "Preferences cleared.", nil
+	default:
+		return "", fmt.Errorf("unknown option %q", args)
+	}
+}
+
+// reactionVerbosity maps emoji reactions on the agent's replies to
+// verbosity feedback. Other reactions are ignored.
+var reactionVerbosity = map[string]int{
+	"👎": -1, // too long or off the mark
+	"🥱": -1,
+	"🤔": 1, // not enough explanation
+}
+
+// handleReaction applies an emoji reaction on one of the agent's messages
+// as feedback. It sends nothing back, so reacting stays lightweight.
+func (al *AgentLoop) handleReaction(msg bus.InboundMessage, emoji string) {
+	delta, ok := reactionVerbosity[emoji]
+	if !ok {
+		return
+	}
+	if _, err := al.adjustVerbosity(msg, delta); err != nil {
+		logger.WarnCF("agent", "Failed to save preference from reaction",
+			map[string]interface{}{"error": err.Error()})
+		return
+	}
+	logger.InfoCF("agent", "Learned preference from reaction",
+		map[string]interface{}{
+			"channel": msg.Channel,
+			"emoji":   emoji,
+		})
+}
@@ -0,0 +1,45 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// Profile returns the profile the agent was built with, "" for none.
+func (al *AgentLoop) Profile() string {
+	return al.profile
+}
+
+// Profiles lists the configured profiles, sorted.
+func (al *AgentLoop) Profiles() []string {
+	return al.profiles
+}
+
+// profileCommand handles "/profile": the profile in use and the others. A
+// profile picks the workspace and session store, so a running agent can't
+// change it; picoclaw agent answers "/profile <name>" itself by starting
+// another agent.
+func profileCommand(ctx context.Context, al *AgentLoop, msg bus.InboundMessage, args string) (string, error) {
+	if args != "" {
+		return "", fmt.Errorf("a chat can't switch profiles; start picoclaw with --profile %s", args)
+	}
+	current := al.profile
+	if current == "" {
+		current = config.DefaultProfile
+	}
+	text := fmt.Sprintf("👤 Profile: %s", current)
+	if len(al.profiles) == 0 {
+		return text + "\nNo profiles are configured; add them under agents.profiles.", nil
+	}
+	names := []string{config.DefaultProfile}
+	for _, name := range al.profiles {
+		if name != config.DefaultProfile {
+			names = append(names, name)
+		}
+	}
+	return text + "\nProfiles: " + strings.Join(names, ", "), nil
+}
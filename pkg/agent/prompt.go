@@ -0,0 +1,193 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// defaultPromptTemplate is the identity and rules section used when
+// agents.defaults.prompt_template is unset.
+const defaultPromptTemplate = `# picoclaw 🦞
+
+You are picoclaw, a helpful AI assistant.
+
+## Current Time
+{{.Time}}
+
+## Runtime
+{{.Runtime}}
+
+## Workspace
+Your workspace is at: {{.Workspace}}
+- Memory: {{.Workspace}}/memory/MEMORY.md
+- Daily Notes: {{.Workspace}}/memory/YYYYMM/YYYYMMDD.md
+- Skills: {{.Workspace}}/skills/{skill-name}/SKILL.md
+
+{{.ToolsSection}}
+
+## Important Rules
+
+1. **ALWAYS use tools** - When you need to perform an action (schedule reminders, send messages, execute commands, etc.), you MUST call the appropriate tool. Do NOT just say you'll do it or pretend to do it.
+
+2. **Be helpful and accurate** - When using tools, briefly explain what you're doing.
+
+3. **Memory** - When remembering something, write to {{.Workspace}}/memory/MEMORY.md`
+
+// promptsDir is the workspace folder partials are loaded from.
+const promptsDir = "prompts"
+
+// maxPartialDepth stops partials that include each other forever.
+const maxPartialDepth = 8
+
+// promptData is what prompt templates can refer to, e.g. {{.Workspace}}
+// or {{.User.coffee}}.
+type promptData struct {
+	Now          time.Time
+	Time         string // e.g. "2026-03-14 09:30 (Saturday)"
+	Date         string // e.g. "2026-03-14"
+	OS           string
+	Arch         string
+	Runtime      string // OS, architecture and Go version
+	Workspace    string
+	Profile      string            // "" for none
+	Tools        []string          // names of the enabled tools
+	ToolsSection string            // the "Available Tools" list
+	Facts        []Fact            // facts about the user, from memory/facts.json
+	User         map[string]string // fact values by lowercase subject
+}
+
+// SetPromptTemplate sets the file whose template replaces the built-in
+// identity and rules section; relative paths are in the workspace. ""
+// restores the built-in one.
+func (cb *ContextBuilder) SetPromptTemplate(path string) {
+	cb.promptTemplate = path
+}
+
+// SetProfile sets the profile in use, whose partials in prompts/<profile>
+// take precedence over those in prompts.
+func (cb *ContextBuilder) SetProfile(name string) {
+	cb.profile = name
+}
+
+func (cb *ContextBuilder) promptData() promptData {
+	now := time.Now()
+	workspacePath, _ := filepath.Abs(cb.workspace)
+	data := promptData{
+		Now:          now,
+		Time:         now.Format("2006-01-02 15:04 (Monday)"),
+		Date:         now.Format("2006-01-02"),
+		OS:           runtime.GOOS,
+		Arch:         runtime.GOARCH,
+		Runtime:      fmt.Sprintf("%s %s, Go %s", runtime.GOOS, runtime.GOARCH, runtime.Version()),
+		Workspace:    workspacePath,
+		Profile:      cb.profile,
+		ToolsSection: cb.buildToolsSection(),
+		User:         map[string]string{},
+	}
+	if cb.tools != nil {
+		for _, name := range cb.tools.List() {
+			if cb.tools.IsEnabled(name) {
+				data.Tools = append(data.Tools, name)
+			}
+		}
+	}
+	if cb.memory != nil {
+		data.Facts = cb.memory.facts.All()
+		for _, f := range data.Facts {
+			data.User[strings.ToLower(strings.TrimSpace(f.Subject))] = f.Value
+		}
+	}
+	return data
+}
+
+// identityTemplate returns the configured prompt template, or the built-in
+// one if none is set or it can't be read.
+func (cb *ContextBuilder) identityTemplate() (name, text string) {
+	if cb.promptTemplate == "" {
+		return "identity", defaultPromptTemplate
+	}
+	path := cb.promptTemplate
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, path[2:])
+		}
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(cb.workspace, path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		logger.WarnCF("agent", "Can't read the prompt template, using the built-in one",
+			map[string]interface{}{"path": path, "error": err.Error()})
+		return "identity", defaultPromptTemplate
+	}
+	return filepath.Base(path), string(data)
+}
+
+// renderPrompt fills in a prompt template. Besides the promptData fields,
+// templates can use {{partial "name"}} to include prompts/name.md from the
+// workspace, itself a template, and {{join .Tools ", "}}.
+func (cb *ContextBuilder) renderPrompt(name, text string, data promptData) (string, error) {
+	depth := 0
+	var render func(name, text string) (string, error)
+	funcs := template.FuncMap{
+		"join": strings.Join,
+		"partial": func(partial string) (string, error) {
+			if depth >= maxPartialDepth {
+				return "", fmt.Errorf("partials nested more than %d deep", maxPartialDepth)
+			}
+			text, err := cb.readPartial(partial)
+			if err != nil {
+				return "", err
+			}
+			depth++
+			defer func() { depth-- }()
+			return render(partial, text)
+		},
+	}
+	render = func(name, text string) (string, error) {
+		tmpl, err := template.New(name).Funcs(funcs).Option("missingkey=zero").Parse(text)
+		if err != nil {
+			return "", err
+		}
+		var sb strings.Builder
+		if err := tmpl.Execute(&sb, data); err != nil {
+			return "", err
+		}
+		return sb.String(), nil
+	}
+	return render(name, text)
+}
+
+// readPartial reads a partial from prompts/<profile> or prompts in the
+// workspace. Names without an extension get ".md".
+func (cb *ContextBuilder) readPartial(name string) (string, error) {
+	if !filepath.IsLocal(name) {
+		return "", fmt.Errorf("partial %q must be a path inside %s", name, promptsDir)
+	}
+	if filepath.Ext(name) == "" {
+		name += ".md"
+	}
+	var dirs []string
+	if cb.profile != "" {
+		dirs = append(dirs, filepath.Join(cb.workspace, promptsDir, cb.profile))
+	}
+	dirs = append(dirs, filepath.Join(cb.workspace, promptsDir))
+	for _, dir := range dirs {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err == nil {
+			return strings.TrimRight(string(data), "\n"), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("no partial %s in %s", name, filepath.Join(cb.workspace, promptsDir))
+}
@@ -0,0 +1,51 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// registerPythonTool adds the python tool, running where the config says:
+// on the host, in a container, or wherever exec commands run.
+func registerPythonTool(registry *tools.ToolRegistry, workspace string, cfg *config.Config, maxOutput int) {
+	pc := cfg.Tools.Python
+	if !pc.Enabled {
+		return
+	}
+	tool := tools.NewPythonTool(workspace)
+	tool.SetPython(pc.Python)
+	tool.SetLimits(pc.MemoryMB, pc.CPUSeconds, time.Duration(pc.Timeout)*time.Second, time.Duration(pc.IdleMinutes)*time.Minute)
+	tool.SetMaxOutput(maxOutput)
+
+	var backend tools.ExecBackend
+	switch pc.Backend {
+	case "":
+		backend = execBackend(cfg.Tools.Exec, workspace, cfg.SharedFolderPaths())
+	case "host":
+	case "docker", "podman":
+		backend = tools.NewContainerBackend(pc.Backend, pc.Image, workspace)
+	default:
+		logger.WarnCF("agent", "Unknown python backend, running Python on the host",
+			map[string]interface{}{"backend": pc.Backend})
+	}
+	if container, ok := backend.(*tools.ContainerBackend); ok {
+		// The exec image need not have Python; the python image does
+		python := *container
+		python.Image = pc.Image
+		if pc.MemoryMB > 0 {
+			python.Memory = fmt.Sprintf("%dm", pc.MemoryMB)
+		}
+		backend = &python
+	} else {
+		// The exec tool's rules for what reaches a command's environment
+		policy := &tools.EnvPolicy{Inherit: cfg.Tools.Exec.Env.Inherit, Deny: cfg.Tools.Exec.Env.Deny}
+		tool.SetEnv(policy.Filter(os.Environ()))
+	}
+	tool.SetBackend(backend)
+	registry.Register(tool)
+}
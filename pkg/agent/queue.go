@@ -0,0 +1,41 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// withQueuePriority marks a turn's model requests for the provider's
+// queue: proactive turns (heartbeat, scheduled jobs) give way to users.
+// A user whose turn has to wait is told their place in line, once.
+func (al *AgentLoop) withQueuePriority(ctx context.Context, opts processOptions) context.Context {
+	if opts.Urgency != "" {
+		return providers.WithPriority(ctx, providers.PriorityScheduled)
+	}
+	ctx = providers.WithPriority(ctx, providers.PriorityInteractive)
+	if constants.IsInternalChannel(opts.Channel) || opts.ChatID == "" {
+		return ctx
+	}
+	var once sync.Once
+	return providers.WithQueueNotify(ctx, func(position int) {
+		once.Do(func() {
+			al.bus.PublishOutbound(bus.OutboundMessage{
+				Channel: opts.Channel,
+				ChatID:  opts.ChatID,
+				Content: queueMessage(position),
+			})
+		})
+	})
+}
+
+func queueMessage(position int) string {
+	if position <= 1 {
+		return "⏳ The model is busy; you're next in line."
+	}
+	return fmt.Sprintf("⏳ The model is busy; you're number %d in line.", position)
+}
@@ -0,0 +1,67 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/quiet"
+)
+
+// SetQuietHours connects the quiet hours policy the channel manager applies
+// to outbound messages, so /dnd can change it.
+func (al *AgentLoop) SetQuietHours(hours *quiet.Hours) {
+	al.quiet = hours
+}
+
+// dndCommand handles "/dnd [2h|HH:MM|off]": hold proactive messages for a
+// while, until a time of day, or stop holding them. Without arguments it
+// shows the chat's quiet hours.
+func dndCommand(ctx context.Context, al *AgentLoop, msg bus.InboundMessage, args string) (string, error) {
+	if al.quiet == nil {
+		return "", fmt.Errorf("do not disturb is only available on chat channels")
+	}
+	user := quiet.User(msg.Channel, msg.ChatID)
+	now := time.Now()
+	args = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(args), "until")))
+
+	var until time.Time
+	switch {
+	case args == "":
+		return al.quiet.Status(user, now), nil
+	case args == "off":
+		if err := al.quiet.SetDND(user, time.Time{}); err != nil {
+			return "", err
+		}
+		return "Do not disturb is off. Held messages will arrive within a minute, unless it is quiet hours.", nil
+	default:
+		var err error
+		if until, err = parseDNDUntil(args, now, al.quiet.Location(user)); err != nil {
+			return "", err
+		}
+	}
+	if err := al.quiet.SetDND(user, until); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Do not disturb until %s. Only urgent alerts will come through before then.",
+		until.In(al.quiet.Location(user)).Format("Mon 15:04")), nil
+}
+
+// parseDNDUntil reads a duration ("2h", "90m") or a time of day ("07:30",
+// the next time it comes round in loc).
+func parseDNDUntil(s string, now time.Time, loc *time.Location) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return now.Add(d), nil
+	}
+	if t, err := time.Parse("15:04", s); err == nil {
+		local := now.In(loc)
+		until := time.Date(local.Year(), local.Month(), local.Day(), t.Hour(), t.Minute(), 0, 0, loc)
+		if !until.After(local) {
+			until = until.AddDate(0, 0, 1)
+		}
+		return until, nil
+	}
+	return time.Time{}, fmt.Errorf("%q is neither a duration like 2h nor a time like 07:30", s)
+}
@@ -0,0 +1,54 @@
+package agent
+
+import (
+	"path/filepath"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/quota"
+	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// DiskAreas returns what the disk quota counts: the workspace, whose files
+// are never deleted, and its cache directory and downloaded attachments,
+// which are evicted oldest first when the quota is exceeded.
+func DiskAreas(workspace string) []quota.Area {
+	return []quota.Area{
+		{Name: "workspace", Path: workspace},
+		{Name: "cache", Path: filepath.Join(workspace, "cache"), Evictable: true},
+		{Name: "attachments", Path: utils.MediaDir(), Evictable: true},
+	}
+}
+
+// setDiskQuota makes the file tools in registries check q before writing.
+func setDiskQuota(q *quota.Manager, registries ...*tools.ToolRegistry) {
+	for _, registry := range registries {
+		for _, name := range registry.List() {
+			if tool, ok := registry.Get(name); ok {
+				if limited, ok := tool.(tools.DiskQuotaTool); ok {
+					limited.SetQuota(q)
+				}
+			}
+		}
+	}
+}
+
+// checkDiskQuota evicts old cache files and attachments if the turn pushed
+// usage over the quota, and warns the user once it is nearly full.
+func (al *AgentLoop) checkDiskQuota(opts processOptions) {
+	if al.diskQuota == nil {
+		return
+	}
+	if evicted := al.diskQuota.Enforce(); len(evicted) > 0 {
+		logger.DebugCF("agent", "Disk quota eviction",
+			map[string]interface{}{"files": evicted})
+	}
+	if warning := al.diskQuota.Warning(); warning != "" && opts.SendResponse {
+		al.bus.PublishOutbound(bus.OutboundMessage{
+			Channel: opts.Channel,
+			ChatID:  opts.ChatID,
+			Content: warning,
+		})
+	}
+}
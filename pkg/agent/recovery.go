@@ -0,0 +1,58 @@
+package agent
+
+import (
+	"fmt"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/session"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// interruptedNote is stored as the assistant's reply to a turn that was cut
+// short by a crash, so the model knows the request was not completed.
+const interruptedNote = "(This request was interrupted by a restart before it finished. Tools that had already run may have taken effect.)"
+
+// closeInterruptedTurns finds turns that were still in progress when the
+// process stopped and closes them, so every session starts with a valid
+// history. Tool calls are not replayed since they may have side effects.
+func closeInterruptedTurns(sessions *session.SessionManager) []session.InterruptedTurn {
+	turns := sessions.InterruptedTurns()
+	for _, turn := range turns {
+		logger.WarnCF("agent", "Closing turn interrupted by restart",
+			map[string]interface{}{
+				"session_key": turn.SessionKey,
+				"started":     turn.Started,
+				"iteration":   turn.Iteration,
+			})
+		sessions.CloseTurn(turn.SessionKey, interruptedNote)
+		if err := sessions.Save(turn.SessionKey); err != nil {
+			logger.ErrorCF("agent", "Failed to save recovered session",
+				map[string]interface{}{
+					"session_key": turn.SessionKey,
+					"error":       err.Error(),
+				})
+		}
+	}
+	return turns
+}
+
+// notifyInterruptedTurns tells users whose request was cut short by a
+// restart that it did not finish.
+func (al *AgentLoop) notifyInterruptedTurns() {
+	turns := al.interrupted
+	al.interrupted = nil
+
+	for _, turn := range turns {
+		if turn.Channel == "" || turn.ChatID == "" || constants.IsInternalChannel(turn.Channel) {
+			continue
+		}
+		al.bus.PublishOutbound(bus.OutboundMessage{
+			Channel: turn.Channel,
+			ChatID:  turn.ChatID,
+			Content: fmt.Sprintf("⚠️ I restarted before finishing your request \"%s\". Send it again if you still need it.",
+				utils.Truncate(turn.UserMessage, 80)),
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package agent
+
+import (
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// ApplyConfig applies the parts of cfg that can change while the agent
+// runs: enabled and disabled tools, the exec guard's rules and allowlist,
+// the model defaults and the personas. Everything else needs a restart.
+func (al *AgentLoop) ApplyConfig(cfg *config.Config) {
+	for _, registry := range []*tools.ToolRegistry{al.tools, al.subagentTools} {
+		registry.SelectTools(cfg.Tools.Enabled, cfg.Tools.Disabled)
+	}
+	for _, execTool := range al.execTools {
+		if err := ConfigureExecGuard(execTool, cfg.Tools.Exec); err != nil {
+			logger.ErrorCF("agent", "Invalid exec guard config, keeping the rules that were valid",
+				map[string]interface{}{"error": err.Error()})
+		}
+	}
+
+	defaults := cfg.Agents.Defaults
+	al.settingsMu.Lock()
+	al.model = defaults.Model
+	al.temperature = defaults.Temperature
+	al.maxIterations = defaults.MaxToolIterations
+	al.maxRepeats = defaults.MaxRepeatedToolCalls
+	al.contextWindow = defaults.MaxTokens
+	al.persona = defaults.Persona
+	al.personas = cfg.Agents.Personas
+	al.settingsMu.Unlock()
+	al.subagents.SetDefaultModel(defaults.Model)
+}
+
+// defaultModel is the model for sessions that haven't picked one.
+func (al *AgentLoop) defaultModel() string {
+	al.settingsMu.RLock()
+	defer al.settingsMu.RUnlock()
+	return al.model
+}
+
+func (al *AgentLoop) defaultTemperature() float64 {
+	al.settingsMu.RLock()
+	defer al.settingsMu.RUnlock()
+	return al.temperature
+}
+
+// iterationLimit is the most tool rounds a turn may take.
+func (al *AgentLoop) iterationLimit() int {
+	al.settingsMu.RLock()
+	defer al.settingsMu.RUnlock()
+	return al.maxIterations
+}
+
+// repeatLimit is how often a turn may make the same tool call.
+func (al *AgentLoop) repeatLimit() int {
+	al.settingsMu.RLock()
+	defer al.settingsMu.RUnlock()
+	return al.maxRepeats
+}
+
+// contextSize is the context window in tokens; 0 means unknown.
+func (al *AgentLoop) contextSize() int {
+	al.settingsMu.RLock()
+	defer al.settingsMu.RUnlock()
+	return al.contextWindow
+}
@@ -0,0 +1,111 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/report"
+)
+
+// reportNarration is the system prompt for turning a filled-in report into
+// a message. The data is already there, so no tools are offered.
+const reportNarration = `You write briefings from data that has already been gathered. Turn the report below into a short, natural message for the user. Use only the data given and say plainly when something is unavailable. Do not mention templates, tools or data sources.`
+
+// runReportCommand handles "/run report <name> [args]". Without a name it
+// lists the available reports.
+func (al *AgentLoop) runReportCommand(ctx context.Context, msg bus.InboundMessage, args string) (string, error) {
+	reports := al.loadReports()
+	name, reportArgs, _ := strings.Cut(args, " ")
+	if name == "" {
+		return listReports(reports), nil
+	}
+	r, ok := reports[name]
+	if !ok {
+		return "", fmt.Errorf("report %q not found\n\n%s", name, listReports(reports))
+	}
+	return al.runReport(ctx, r, strings.TrimSpace(reportArgs), msg.Channel, msg.ChatID)
+}
+
+// loadReports reads the workspace's reports, re-read on every run so edits
+// take effect without a restart.
+func (al *AgentLoop) loadReports() map[string]*report.Report {
+	reports, errs := report.LoadDir(filepath.Join(al.workspace, "reports"))
+	for _, err := range errs {
+		logger.WarnCF("agent", "Skipping invalid report", map[string]interface{}{"error": err.Error()})
+	}
+	return reports
+}
+
+// runReport fetches the report's data in parallel and has the model narrate
+// the filled-in template in a single call.
+func (al *AgentLoop) runReport(ctx context.Context, r *report.Report, args, channel, chatID string) (string, error) {
+	for name, b := range r.Data {
+		if _, ok := al.tools.Get(b.Tool); !ok {
+			return "", fmt.Errorf("report %q data %q uses unknown tool %q", r.Name, name, b.Tool)
+		}
+	}
+
+	start := time.Now()
+	fetch := func(ctx context.Context, tool string, toolArgs map[string]interface{}) (string, error) {
+		result := al.tools.ExecuteWithContext(ctx, tool, toolArgs, channel, chatID, nil)
+		if result.IsError {
+			return "", errors.New(result.ForLLM)
+		}
+		return result.ForLLM, nil
+	}
+	filled, errs := r.Fill(ctx, args, time.Now(), fetch)
+	for _, err := range errs {
+		logger.WarnCF("agent", "Report data unavailable",
+			map[string]interface{}{"report": r.Name, "error": err.Error()})
+	}
+	logger.InfoCF("agent", "Report data fetched",
+		map[string]interface{}{
+			"report":      r.Name,
+			"bindings":    len(r.Data),
+			"failed":      len(errs),
+			"duration_ms": time.Since(start).Milliseconds(),
+		})
+
+	system := reportNarration
+	if r.Style != "" {
+		system += "\n\nStyle: " + r.Style
+	}
+	resp, err := al.provider.Chat(ctx, []providers.Message{
+		{Role: "system", Content: system},
+		{Role: "user", Content: filled},
+	}, nil, al.defaultModel(), map[string]interface{}{
+		"max_tokens":  1024,
+		"temperature": 0.3,
+	})
+	if err != nil {
+		return "", fmt.Errorf("narrating report: %w", err)
+	}
+	return strings.TrimSpace(resp.Content), nil
+}
+
+func listReports(reports map[string]*report.Report) string {
+	if len(reports) == 0 {
+		return "No reports defined. Add YAML files to the reports/ folder of the workspace."
+	}
+	var sb strings.Builder
+	sb.WriteString("Available reports:\n")
+	for _, name := range report.Names(reports) {
+		r := reports[name]
+		sources := "sources"
+		if len(r.Data) == 1 {
+			sources = "source"
+		}
+		fmt.Fprintf(&sb, "\n• %s (%d %s)", name, len(r.Data), sources)
+		if r.Description != "" {
+			sb.WriteString(" - " + r.Description)
+		}
+	}
+	return sb.String()
+}
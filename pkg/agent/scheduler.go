@@ -0,0 +1,56 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/scheduler"
+	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/workflow"
+)
+
+// RunScheduledTask runs a scheduled task for the chat its result goes to.
+// Prompts run without history, like heartbeats, so each briefing stands on
+// its own; workflows and reports are re-read from the workspace on every
+// run.
+func (al *AgentLoop) RunScheduledTask(ctx context.Context, task scheduler.Task, channel, chatID string) (string, error) {
+	if channel == "" || chatID == "" {
+		channel, chatID = "cli", "direct"
+	}
+	if task.Report != "" {
+		r, ok := al.loadReports()[task.Report]
+		if !ok {
+			return "", fmt.Errorf("report %q not found", task.Report)
+		}
+		return al.runReport(ctx, r, task.Args, channel, chatID)
+	}
+	if task.Workflow == "" {
+		return al.runAgentLoop(ctx, processOptions{
+			SessionKey:      "schedule:" + task.Name,
+			Channel:         channel,
+			ChatID:          chatID,
+			UserMessage:     task.Prompt,
+			DefaultResponse: "I've completed processing but have no response to give.",
+			NoHistory:       true,
+			Urgency:         bus.UrgencyNormal,
+		})
+	}
+
+	workflows, errs := workflow.LoadDir(filepath.Join(al.workspace, "workflows"))
+	wf, ok := workflows[task.Workflow]
+	if !ok {
+		if len(errs) > 0 {
+			return "", fmt.Errorf("workflow %q not found: %v", task.Workflow, errors.Join(errs...))
+		}
+		return "", fmt.Errorf("workflow %q not found", task.Workflow)
+	}
+	ctx = tools.WithUrgency(ctx, bus.UrgencyNormal)
+	result, err := al.runWorkflow(ctx, wf, task.Args, channel, chatID, nil)
+	if err != nil {
+		return "", err
+	}
+	return result.Report(), nil
+}
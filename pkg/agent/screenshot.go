@@ -0,0 +1,57 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/imaging"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// describeScreenshotPrompt asks for what matters on a screen rather than
+// a picture's composition.
+const describeScreenshotPrompt = "This is a screenshot of a computer screen. Describe what is on it: the open applications and windows, " +
+	"what each shows, and any dialogs, errors or notifications. Transcribe important text exactly."
+
+// describeScreenshot has the vision model, or the main model when it can
+// view images itself, describe a screenshot for the screenshot tool.
+func (al *AgentLoop) describeScreenshot(ctx context.Context, path, question string) (string, string, error) {
+	model := al.visionModel
+	if model == "" || !al.capabilities.Resolve(ctx, al.provider, model).Vision {
+		model = al.defaultModel()
+		if !al.capabilities.Resolve(ctx, al.provider, model).Vision {
+			return "", "", tools.ErrNoVisionModel
+		}
+	}
+	vision, ok := al.provider.(providers.VisionProvider)
+	if !ok {
+		return "", "", tools.ErrNoVisionModel
+	}
+	limits := vision.ImageLimits()
+	img, err := imaging.Prepare(path, imaging.Limits{
+		Formats:      limits.Formats,
+		MaxBytes:     limits.MaxBytes,
+		MaxDimension: limits.MaxDimension,
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	prompt := describeScreenshotPrompt
+	if question != "" {
+		prompt += "\n\nAbove all, answer this: " + question
+	}
+	resp, err := al.provider.Chat(ctx, []providers.Message{
+		{Role: "user", Content: prompt, Images: []providers.Image{{MediaType: img.MediaType, Data: img.Data}}},
+	}, nil, model, map[string]interface{}{"max_tokens": 1024})
+	if err != nil {
+		return "", "", err
+	}
+	description := strings.TrimSpace(resp.Content)
+	if description == "" {
+		return "", "", fmt.Errorf("%s gave an empty description", model)
+	}
+	return description, model, nil
+}
@@ -0,0 +1,132 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+// allTools marks a session whose tools are all switched off.
+const allTools = "*"
+
+// CommandInfo describes a slash command the agent answers itself.
+type CommandInfo struct {
+	Name  string // without the slash
+	Usage string
+}
+
+// Commands lists the agent's slash commands by name, for help and
+// completion in clients.
+func Commands() []CommandInfo {
+	list := make([]CommandInfo, 0, len(commands))
+	for name, cmd := range commands {
+		list = append(list, CommandInfo{Name: name, Usage: cmd.usage})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// ToolNames returns the names of the registered tools, sorted.
+func (al *AgentLoop) ToolNames() []string {
+	names := al.tools.List()
+	sort.Strings(names)
+	return names
+}
+
+// setSessionToolsEnabled switches all tools on or off for a session. On
+// also clears tools switched off one by one.
+func (al *AgentLoop) setSessionToolsEnabled(sessionKey string, enabled bool) {
+	if enabled {
+		al.sessionTools.Delete(sessionKey)
+		return
+	}
+	value, _ := al.sessionTools.LoadOrStore(sessionKey, &sync.Map{})
+	value.(*sync.Map).Store(allTools, true)
+}
+
+// toolsCommand handles "/tools", "/tools on|off" and "/tools <name> on|off".
+func toolsCommand(ctx context.Context, al *AgentLoop, msg bus.InboundMessage, args string) (string, error) {
+	fields := strings.Fields(args)
+	switch {
+	case len(fields) == 0:
+	case len(fields) == 1 && (fields[0] == "on" || fields[0] == "off"):
+		al.setSessionToolsEnabled(msg.SessionKey, fields[0] == "on")
+	case len(fields) == 2 && (fields[1] == "on" || fields[1] == "off"):
+		if err := al.SetSessionToolEnabled(msg.SessionKey, fields[0], fields[1] == "on"); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("expected on, off or a tool name followed by on or off")
+	}
+
+	filter := al.sessionToolFilter(msg.SessionKey)
+	var on, off []string
+	for _, name := range al.ToolNames() {
+		if !al.tools.IsEnabled(name) {
+			continue
+		}
+		if filter == nil || filter(name) {
+			on = append(on, name)
+		} else {
+			off = append(off, name)
+		}
+	}
+	if len(on) == 0 {
+		return "🔧 Tools are off for this chat: the model can only answer from what it knows. /tools on switches them back on.", nil
+	}
+	text := fmt.Sprintf("🔧 %d tools on: %s", len(on), strings.Join(on, ", "))
+	if len(off) > 0 {
+		text += fmt.Sprintf("\nOff for this chat: %s", strings.Join(off, ", "))
+	}
+	return text, nil
+}
+
+// usageCommand handles "/usage": tokens spent in the session since the
+// agent started, and how full the context is.
+func usageCommand(ctx context.Context, al *AgentLoop, msg bus.InboundMessage, args string) (string, error) {
+	prompt, completion := al.sessionTokens(msg.SessionKey)
+	history := al.sessions.GetHistory(msg.SessionKey)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "📈 Model: %s", al.SessionModel(msg.SessionKey))
+	fmt.Fprintf(&sb, "\n- Tokens since start: %s (%s prompt, %s completion)",
+		formatTokens(prompt+completion), formatTokens(prompt), formatTokens(completion))
+	used := al.estimateTokens(history)
+	if window := al.contextSize(); window > 0 {
+		fmt.Fprintf(&sb, "\n- History: %d messages, about %s of %s tokens (%d%%)",
+			len(history), formatTokens(used), formatTokens(window), used*100/window)
+	} else {
+		fmt.Fprintf(&sb, "\n- History: %d messages, about %s tokens", len(history), formatTokens(used))
+	}
+	if al.sessions.GetSummary(msg.SessionKey) != "" {
+		sb.WriteString("\n- Older messages are kept as a summary")
+	}
+	if budgets := al.budget.Describe(msg.SessionKey); budgets != "" {
+		fmt.Fprintf(&sb, "\n- Budget: %s", budgets)
+	}
+	return sb.String(), nil
+}
+
+// compactCommand handles "/compact": it folds the history into the session
+// summary now instead of waiting for the context to fill up.
+func compactCommand(ctx context.Context, al *AgentLoop, msg bus.InboundMessage, args string) (string, error) {
+	before := len(al.sessions.GetHistory(msg.SessionKey))
+	if before <= 4 {
+		return fmt.Sprintf("Nothing to compact: the chat has %d messages.", before), nil
+	}
+	if _, busy := al.summarizing.LoadOrStore(msg.SessionKey, true); busy {
+		return "", fmt.Errorf("the chat is already being summarized")
+	}
+	defer al.summarizing.Delete(msg.SessionKey)
+
+	al.summarizeSession(msg.SessionKey)
+	after := len(al.sessions.GetHistory(msg.SessionKey))
+	if after >= before {
+		return "", fmt.Errorf("the summary could not be written; the history is unchanged")
+	}
+	return fmt.Sprintf("🗜️ Folded %d messages into the chat summary and kept the last %d.", before-after, after), nil
+}
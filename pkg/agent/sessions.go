@@ -0,0 +1,85 @@
+package agent
+
+import (
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// SessionInfo describes a stored conversation, for session pickers.
+type SessionInfo struct {
+	Key      string
+	Title    string // the first user message, shortened
+	Messages int
+	Updated  time.Time
+}
+
+// ListSessions describes the sessions whose keys start with prefix, most
+// recently updated first.
+func (al *AgentLoop) ListSessions(prefix string) []SessionInfo {
+	infos := al.sessions.List(prefix)
+	list := make([]SessionInfo, 0, len(infos))
+	for _, info := range infos {
+		s := SessionInfo{Key: info.Key, Messages: info.Messages, Updated: info.Updated}
+		for _, m := range al.sessions.GetHistory(info.Key) {
+			if m.Role == "user" {
+				s.Title = utils.Truncate(strings.Join(strings.Fields(m.Content), " "), 60)
+				break
+			}
+		}
+		list = append(list, s)
+	}
+	return list
+}
+
+// SessionHistory returns the messages of a session.
+func (al *AgentLoop) SessionHistory(key string) []providers.Message {
+	return al.sessions.GetHistory(key)
+}
+
+// SessionModel returns the model a session uses: its /model override or
+// the configured model.
+func (al *AgentLoop) SessionModel(key string) string {
+	if model := al.sessions.GetOverrides(key).Model; model != "" {
+		return model
+	}
+	return al.defaultModel()
+}
+
+// KnownModels returns the models named in the config or chosen for a
+// session, the configured model first. Providers may offer others.
+func (al *AgentLoop) KnownModels() []string {
+	models := []string{al.defaultModel()}
+	seen := map[string]bool{al.model: true}
+	add := func(model string) {
+		if model != "" && !seen[model] {
+			seen[model] = true
+			models = append(models, model)
+		}
+	}
+	add(al.visionModel)
+	for _, model := range al.capabilities.Configured() {
+		add(model)
+	}
+	for _, info := range al.sessions.List("") {
+		add(al.sessions.GetOverrides(info.Key).Model)
+	}
+	return models
+}
+
+// ForkSession copies the first turns turns of session src into a new
+// session dst, using model there if it is set, and saves it. A negative
+// turns copies every turn.
+func (al *AgentLoop) ForkSession(src, dst string, turns int, model string) error {
+	if err := al.sessions.Fork(src, dst, turns); err != nil {
+		return err
+	}
+	if model != "" {
+		overrides := al.sessions.GetOverrides(dst)
+		overrides.Model = model
+		al.sessions.SetOverrides(dst, overrides)
+	}
+	return al.sessions.Save(dst)
+}
@@ -0,0 +1,20 @@
+package agent
+
+import (
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// registerSQLTool adds the sql tool with the configured databases.
+func registerSQLTool(registry *tools.ToolRegistry, workspace string, restrict bool, cfg config.SQLConfig) {
+	if !cfg.Enabled {
+		return
+	}
+	databases := make([]tools.SQLDatabase, 0, len(cfg.Databases))
+	for name, db := range cfg.Databases {
+		databases = append(databases, tools.SQLDatabase{Name: name, DSN: db.Source(), Writable: db.Writable})
+	}
+	registry.Register(tools.NewSQLTool(workspace, restrict, databases, cfg.MaxRows, time.Duration(cfg.Timeout)*time.Second))
+}
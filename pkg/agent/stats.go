@@ -0,0 +1,184 @@
+package agent
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// TurnStats is a snapshot of a turn in progress, for a status line that
+// shows users of slow models that the agent is still working.
+type TurnStats struct {
+	Elapsed      time.Duration
+	Tokens       int     // completion tokens generated so far
+	TokensPerSec float64 // over the time spent waiting for the model
+	Tools        string  // tools running now, empty while the model is thinking
+}
+
+// ToolCallRecord is one tool call made during a turn.
+type ToolCallRecord struct {
+	Name       string                 `json:"name"`
+	Arguments  map[string]interface{} `json:"arguments"`
+	Result     string                 `json:"result"`
+	IsError    bool                   `json:"is_error"`
+	DurationMS int64                  `json:"duration_ms"`
+	// Data and Attachments are the tool's structured output, if any
+	Data        interface{}        `json:"data,omitempty"`
+	Attachments []tools.Attachment `json:"attachments,omitempty"`
+}
+
+// TurnUsage adds up the model calls of a turn, as reported by the
+// provider.
+type TurnUsage struct {
+	LLMCalls         int `json:"llm_calls"`
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// TurnTracker follows one turn. Pass it to the agent with WithTurnTracker
+// and read it with Stats from another goroutine.
+type TurnTracker struct {
+	mu       sync.Mutex
+	start    time.Time
+	llmStart time.Time // zero unless a model call is in progress
+	llmTime  time.Duration
+	tokens   int
+	running  map[string]int
+	calls    []ToolCallRecord
+	usage    TurnUsage
+}
+
+// NewTurnTracker starts tracking a turn now.
+func NewTurnTracker() *TurnTracker {
+	return &TurnTracker{start: time.Now(), running: make(map[string]int)}
+}
+
+type turnTrackerKey struct{}
+
+// WithTurnTracker returns a context that reports the turn's progress to t.
+func WithTurnTracker(ctx context.Context, t *TurnTracker) context.Context {
+	return context.WithValue(ctx, turnTrackerKey{}, t)
+}
+
+func turnTrackerFrom(ctx context.Context) *TurnTracker {
+	t, _ := ctx.Value(turnTrackerKey{}).(*TurnTracker)
+	return t
+}
+
+// Stats returns the turn's progress so far.
+func (t *TurnTracker) Stats() TurnStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	llmTime := t.llmTime
+	if !t.llmStart.IsZero() {
+		llmTime += now.Sub(t.llmStart)
+	}
+	stats := TurnStats{Elapsed: now.Sub(t.start), Tokens: t.tokens}
+	if llmTime > 0 {
+		stats.TokensPerSec = float64(t.tokens) / llmTime.Seconds()
+	}
+	names := make([]string, 0, len(t.running))
+	for name := range t.running {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	stats.Tools = strings.Join(names, ", ")
+	return stats
+}
+
+// ToolCalls returns the tool calls finished so far, in order.
+func (t *TurnTracker) ToolCalls() []ToolCallRecord {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]ToolCallRecord(nil), t.calls...)
+}
+
+// Usage returns the tokens used by the turn's model calls so far.
+func (t *TurnTracker) Usage() TurnUsage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.usage
+}
+
+// The methods below are no-ops on a nil tracker, so the loop can call them
+// whether or not anyone is watching.
+
+func (t *TurnTracker) llmStarted() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.llmStart = time.Now()
+	t.mu.Unlock()
+}
+
+func (t *TurnTracker) llmDone(resp *providers.LLMResponse) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.llmStart.IsZero() {
+		t.llmTime += time.Since(t.llmStart)
+		t.llmStart = time.Time{}
+	}
+	if resp == nil {
+		return
+	}
+	t.usage.LLMCalls++
+	if resp.Usage != nil {
+		t.usage.PromptTokens += resp.Usage.PromptTokens
+		t.usage.CompletionTokens += resp.Usage.CompletionTokens
+		t.usage.TotalTokens += resp.Usage.PromptTokens + resp.Usage.CompletionTokens
+	}
+	if resp.Usage != nil && resp.Usage.CompletionTokens > 0 {
+		t.tokens += resp.Usage.CompletionTokens
+		return
+	}
+	// Same 4 chars per token heuristic as the context estimate
+	t.tokens += len(resp.Content) / 4
+}
+
+func (t *TurnTracker) toolStarted(name string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.running[name]++
+	t.mu.Unlock()
+}
+
+func (t *TurnTracker) toolDone(name string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	if t.running[name]--; t.running[name] <= 0 {
+		delete(t.running, name)
+	}
+	t.mu.Unlock()
+}
+
+func (t *TurnTracker) toolFinished(name string, args map[string]interface{}, result *tools.ToolResult, took time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.calls = append(t.calls, ToolCallRecord{
+		Name:        name,
+		Arguments:   args,
+		Result:      result.ForLLM,
+		IsError:     result.IsError,
+		DurationMS:  took.Milliseconds(),
+		Data:        result.Data,
+		Attachments: result.Attachments,
+	})
+	t.mu.Unlock()
+}
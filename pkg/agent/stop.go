@@ -0,0 +1,79 @@
+package agent
+
+import (
+	"context"
+	"errors"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// ErrStopped is the cause of a turn cancelled with /stop, or with Ctrl-C
+// in picoclaw agent.
+var ErrStopped = errors.New("stopped by the user")
+
+// stoppedNote is stored as the assistant's reply to a stopped turn, so the
+// model knows the request was not completed when the user goes on.
+const stoppedNote = "(Stopped by the user before finishing. Tools that had already run may have taken effect.)"
+
+// stoppedReply tells the user the turn stopped.
+const stoppedReply = "⏹️ Stopped. What was done so far is kept; tell me how to go on, or ask something else."
+
+// runningTurn is a turn that /stop can cancel.
+type runningTurn struct {
+	cancel context.CancelCauseFunc
+}
+
+// trackTurn makes the chat's turn stoppable. The returned context is
+// cancelled with ErrStopped by StopTurn; call done when the turn ends.
+func (al *AgentLoop) trackTurn(ctx context.Context, sessionKey string) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	turn := &runningTurn{cancel: cancel}
+	al.turns.Store(sessionKey, turn)
+	return ctx, func() {
+		al.turns.CompareAndDelete(sessionKey, turn)
+		cancel(nil)
+	}
+}
+
+// StopTurn cancels the chat's running turn: the model request and running
+// tools are cancelled, and results so far are kept in the session. It
+// returns false if the chat has no turn running.
+func (al *AgentLoop) StopTurn(sessionKey string) bool {
+	value, ok := al.turns.Load(sessionKey)
+	if !ok {
+		return false
+	}
+	logger.InfoCF("agent", "Stopping turn", map[string]interface{}{"session_key": sessionKey})
+	value.(*runningTurn).cancel(ErrStopped)
+	return true
+}
+
+// stopped reports whether ctx was cancelled by the user.
+func stopped(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrStopped)
+}
+
+// stopCommand handles "/stop". The stopped turn replies itself.
+func stopCommand(ctx context.Context, al *AgentLoop, msg bus.InboundMessage, args string) (string, error) {
+	if !al.StopTurn(msg.SessionKey) {
+		return "Nothing to stop.", nil
+	}
+	return "", nil
+}
+
+// deliverStop answers /stop as soon as it arrives, since the turn it stops
+// holds up the messages behind it.
+func (al *AgentLoop) deliverStop(msg bus.InboundMessage) bool {
+	if name, _, _ := parseCommand(msg.Content); name != "stop" {
+		return false
+	}
+	if response, _ := al.handleCommand(context.Background(), msg); response != "" {
+		al.bus.PublishOutbound(bus.OutboundMessage{
+			Channel: msg.Channel,
+			ChatID:  msg.ChatID,
+			Content: response,
+		})
+	}
+	return true
+}
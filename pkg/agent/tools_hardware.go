@@ -0,0 +1,12 @@
+//go:build !nohardware
+
+package agent
+
+import "github.com/sipeed/picoclaw/pkg/tools"
+
+// registerHardwareTools adds the I2C and SPI tools. They are Linux only and
+// return an error on other platforms.
+func registerHardwareTools(registry *tools.ToolRegistry) {
+	registry.Register(tools.NewI2CTool())
+	registry.Register(tools.NewSPITool())
+}
@@ -0,0 +1,8 @@
+//go:build nohardware
+
+package agent
+
+import "github.com/sipeed/picoclaw/pkg/tools"
+
+// registerHardwareTools is a no-op when built with the nohardware tag.
+func registerHardwareTools(registry *tools.ToolRegistry) {}
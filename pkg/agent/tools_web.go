@@ -0,0 +1,77 @@
+//go:build !noweb
+
+package agent
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/browser"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/geo"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/resources"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// registerWebTools adds web search, web fetch, browser, location and
+// weather tools.
+func registerWebTools(registry *tools.ToolRegistry, cfg *config.Config, limits resources.Limits) {
+	if searchTool := tools.NewWebSearchTool(tools.WebSearchToolOptions{
+		BraveAPIKey:          cfg.Tools.Web.Brave.APIKey,
+		BraveMaxResults:      cfg.Tools.Web.Brave.MaxResults,
+		BraveEnabled:         cfg.Tools.Web.Brave.Enabled,
+		DuckDuckGoMaxResults: cfg.Tools.Web.DuckDuckGo.MaxResults,
+		DuckDuckGoEnabled:    cfg.Tools.Web.DuckDuckGo.Enabled,
+	}); searchTool != nil {
+		registry.Register(searchTool)
+	}
+	fetchTool := tools.NewWebFetchTool(limits.WebFetchMaxChars)
+	fetchTool.SetMaxBodyBytes(limits.WebFetchMaxBody)
+	registry.Register(fetchTool)
+	registerBrowserTool(registry, cfg)
+
+	// One geocoder serves the location and weather tools, so a place
+	// looked up once is cached for both
+	geocoder := geo.NewClient()
+	if cfg.Tools.Location.Enabled {
+		registry.Register(tools.NewLocationTool(geocoder))
+	}
+
+	// Weather tool; Open-Meteo needs no key, so it is on by default
+	if cfg.Tools.Weather.Enabled {
+		provider, err := tools.NewWeatherProvider(cfg.Tools.Weather.Provider, cfg.Tools.Weather.APIKey, cfg.Tools.Weather.OneCall, geocoder)
+		if err != nil {
+			logger.WarnCF("agent", "Weather tool disabled", map[string]interface{}{"error": err.Error()})
+			return
+		}
+		weatherTool := tools.NewWeatherTool(provider, cfg.Tools.Weather.DefaultZip)
+		weatherTool.SetUnits(cfg.Tools.Weather.Units)
+		registry.Register(weatherTool)
+	}
+}
+
+// browserTools holds one browser tool per workspace, shared by the agent's
+// and the subagents' registries: Chromium locks its profile folder, so a
+// second browser on it would not start.
+var browserTools sync.Map
+
+// registerBrowserTool adds the browser tool if a browser is installed.
+func registerBrowserTool(registry *tools.ToolRegistry, cfg *config.Config) {
+	bc := cfg.Tools.Browser
+	if !bc.Enabled {
+		return
+	}
+	if bc.Binary == "" && browser.FindBinary() == "" {
+		logger.DebugCF("agent", "No Chromium or Chrome found, browser tool disabled", nil)
+		return
+	}
+	workspace := cfg.WorkspacePath()
+	tool := tools.NewBrowserTool(workspace, browser.Options{
+		Binary:         bc.Binary,
+		AllowedDomains: bc.AllowedDomains,
+	})
+	tool.SetLimits(time.Duration(bc.Timeout)*time.Second, time.Duration(bc.IdleMinutes)*time.Minute)
+	shared, _ := browserTools.LoadOrStore(workspace, tool)
+	registry.Register(shared.(*tools.BrowserTool))
+}
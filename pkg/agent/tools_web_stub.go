@@ -0,0 +1,12 @@
+//go:build noweb
+
+package agent
+
+import (
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/resources"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// registerWebTools is a no-op when built with the noweb tag.
+func registerWebTools(registry *tools.ToolRegistry, cfg *config.Config, limits resources.Limits) {}
@@ -0,0 +1,36 @@
+package agent
+
+import (
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// newSchemaLevel reads agents.defaults.tool_schemas. An unknown value is
+// logged and treated as auto.
+func newSchemaLevel(cfg *config.Config) providers.SchemaLevel {
+	level, err := providers.ParseSchemaLevel(cfg.Agents.Defaults.ToolSchemas)
+	if err != nil {
+		logger.WarnCF("agent", "Invalid tool_schemas, using auto",
+			map[string]interface{}{"error": err.Error()})
+	}
+	return level
+}
+
+// toolDefsFor returns defs reduced to model's schema level. The first time
+// a model is used, what its tool list costs is logged.
+func (al *AgentLoop) toolDefsFor(defs []providers.ToolDefinition, model string) []providers.ToolDefinition {
+	level := providers.SchemaLevelFor(al.toolSchemas, model)
+	compacted := providers.CompactTools(defs, level)
+	if _, seen := al.schemaCosts.LoadOrStore(model, true); !seen {
+		logger.InfoCF("agent", "Tool schema cost",
+			map[string]interface{}{
+				"model":       model,
+				"level":       string(level),
+				"tools":       len(defs),
+				"full_tokens": providers.EstimateToolTokens(defs),
+				"sent_tokens": providers.EstimateToolTokens(compacted),
+			})
+	}
+	return compacted
+}
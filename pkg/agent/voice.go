@@ -0,0 +1,189 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+	"github.com/sipeed/picoclaw/pkg/voice"
+)
+
+// Voice reply modes, set per user with /voice and defaulting to voice.reply.
+const (
+	voiceReplyOff    = "off"
+	voiceReplyVoice  = "voice" // answer voice notes with a voice note
+	voiceReplyAlways = "always"
+)
+
+// newSpeechSynthesizer returns the TTS engine for voice replies, speaking
+// with voiceName instead of the configured voice if set, or nil when the
+// engine isn't set up: no API key, or Piper or its model missing.
+func newSpeechSynthesizer(cfg *config.Config, voiceName string) voice.Synthesizer {
+	tts := cfg.Voice.TTS
+	if strings.EqualFold(tts.Provider, "piper") {
+		piper, err := voice.NewPiperSynthesizer(tts.Piper.Path, tts.Piper.ModelPath(voiceName))
+		if err != nil {
+			logger.WarnCF("voice", "Piper is not available, voice replies are off",
+				map[string]interface{}{"error": err.Error()})
+			return nil
+		}
+		return piper
+	}
+
+	apiKey, apiBase := tts.APIKey, tts.APIBase
+	if apiKey == "" {
+		apiKey = cfg.Providers.OpenAI.APIKey
+		if apiBase == "" {
+			apiBase = cfg.Providers.OpenAI.APIBase
+		}
+	}
+	if apiKey == "" {
+		return nil
+	}
+	if voiceName == "" {
+		voiceName = tts.Voice
+	}
+	return voice.NewSpeechSynthesizer(apiBase, apiKey, tts.Model, voiceName)
+}
+
+// newChannelSynthesizers returns an engine for each channel that speaks
+// with its own voice.
+func newChannelSynthesizers(cfg *config.Config) map[string]voice.Synthesizer {
+	speakers := make(map[string]voice.Synthesizer)
+	for channel, vc := range cfg.Voice.Channels {
+		if vc.Voice == "" {
+			continue
+		}
+		if s := newSpeechSynthesizer(cfg, vc.Voice); s != nil {
+			speakers[channel] = s
+		}
+	}
+	return speakers
+}
+
+// synthesizerFor returns the engine that speaks on channel, or nil.
+func (al *AgentLoop) synthesizerFor(channel string) voice.Synthesizer {
+	if s, ok := al.channelSpeech[channel]; ok {
+		return s
+	}
+	return al.speech
+}
+
+// voiceReplyMode returns how the sender of msg wants to be answered: their
+// /voice choice, else the channel's setting, else voice.reply.
+func (al *AgentLoop) voiceReplyMode(msg bus.InboundMessage) string {
+	if mode := al.preferences.Get(preferenceUser(msg.Channel, msg.SenderID)).Voice; mode != "" {
+		return mode
+	}
+	if mode := al.voiceChannels[msg.Channel].Reply; mode != "" {
+		return mode
+	}
+	if al.voiceReply == "" {
+		return voiceReplyOff
+	}
+	return al.voiceReply
+}
+
+// speakReply synthesizes response as a voice note when the sender asked for
+// spoken replies, and returns its path to attach to the outbound message.
+// The text reply is always sent too; a failed synthesis only loses the audio.
+func (al *AgentLoop) speakReply(ctx context.Context, msg bus.InboundMessage, response string) []string {
+	speech := al.synthesizerFor(msg.Channel)
+	if speech == nil || strings.HasPrefix(strings.TrimSpace(msg.Content), "/") {
+		return nil
+	}
+	switch al.voiceReplyMode(msg) {
+	case voiceReplyAlways:
+	case voiceReplyVoice:
+		if msg.Metadata["voice"] != "true" {
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	text := voice.SpeakableText(response, al.speechMaxChars)
+	if text == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+	audio, ext, err := speech.Synthesize(ctx, text)
+	if err != nil {
+		logger.WarnCF("voice", "Speech synthesis failed, replying in text only",
+			map[string]interface{}{"error": err.Error()})
+		return nil
+	}
+
+	// Kept with downloaded attachments, which the disk quota evicts
+	dir := utils.MediaDir()
+	path := filepath.Join(dir, "reply_"+uuid.NewString()[:8]+ext)
+	if err := os.MkdirAll(dir, 0700); err == nil {
+		err = os.WriteFile(path, audio, 0600)
+	}
+	if err != nil {
+		logger.WarnCF("voice", "Failed to save voice reply",
+			map[string]interface{}{"error": err.Error()})
+		return nil
+	}
+	return []string{path}
+}
+
+// withTranscript quotes what was heard above the answer to a transcribed
+// voice message, so the user can tell a wrong answer from a misheard
+// question.
+func (al *AgentLoop) withTranscript(msg bus.InboundMessage, response string) string {
+	transcript := strings.TrimSpace(msg.Metadata["transcript"])
+	if !al.echoTranscript || transcript == "" {
+		return response
+	}
+	return fmt.Sprintf("🎤 \"%s\"\n\n%s", transcript, response)
+}
+
+// voiceCommand handles "/voice [on|off|always]".
+func voiceCommand(ctx context.Context, al *AgentLoop, msg bus.InboundMessage, args string) (string, error) {
+	user := preferenceUser(msg.Channel, msg.SenderID)
+	var mode string
+	switch strings.ToLower(args) {
+	case "":
+		current := al.voiceReplyMode(msg)
+		if al.synthesizerFor(msg.Channel) == nil {
+			return "Voice replies are not available: no text-to-speech engine is set up in voice.tts.", nil
+		}
+		return fmt.Sprintf("Voice replies: %s. Use /voice on, /voice always or /voice off.", current), nil
+	case "on", "voice":
+		mode = voiceReplyVoice
+	case "off":
+		mode = voiceReplyOff
+	case "always":
+		mode = voiceReplyAlways
+	default:
+		return "", fmt.Errorf("unknown option %q", args)
+	}
+	if _, err := al.preferences.Update(user, func(p *Preferences) { p.Voice = mode }); err != nil {
+		return "", err
+	}
+
+	var reply string
+	switch mode {
+	case voiceReplyVoice:
+		reply = "Got it, I'll reply with a voice note when you send one."
+	case voiceReplyAlways:
+		reply = "Got it, I'll add a voice note to every reply."
+	default:
+		reply = "Got it, text replies only."
+	}
+	if al.synthesizerFor(msg.Channel) == nil {
+		reply += " (Voice replies need a text-to-speech engine in voice.tts, which is not set up yet.)"
+	}
+	return reply, nil
+}
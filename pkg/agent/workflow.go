@@ -0,0 +1,113 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/workflow"
+)
+
+// runWorkflowCommand handles "/run workflow <name> [args]". Without a name
+// it lists the available workflows. Workflows are re-read on every run, so
+// edits take effect without a restart.
+func (al *AgentLoop) runWorkflowCommand(ctx context.Context, msg bus.InboundMessage, args string) (string, error) {
+	workflows, errs := workflow.LoadDir(filepath.Join(al.workspace, "workflows"))
+	for _, err := range errs {
+		logger.WarnCF("agent", "Skipping invalid workflow", map[string]interface{}{"error": err.Error()})
+	}
+
+	name, wfArgs, _ := strings.Cut(args, " ")
+	if name == "" {
+		return listWorkflows(workflows), nil
+	}
+	wf, ok := workflows[name]
+	if !ok {
+		return "", fmt.Errorf("workflow %q not found\n\n%s", name, listWorkflows(workflows))
+	}
+
+	progress := func(sr workflow.StepResult) {
+		if constants.IsInternalChannel(msg.Channel) {
+			return
+		}
+		mark := "✓"
+		if sr.Err != nil {
+			mark = "✗"
+		}
+		al.bus.PublishOutbound(bus.OutboundMessage{
+			Channel: msg.Channel,
+			ChatID:  msg.ChatID,
+			Content: fmt.Sprintf("%s %s: %s", mark, wf.Name, sr.Name),
+		})
+	}
+
+	result, err := al.runWorkflow(ctx, wf, wfArgs, msg.Channel, msg.ChatID, progress)
+	if err != nil {
+		return "", err
+	}
+	return result.Report(), nil
+}
+
+// runWorkflow runs wf for the chat, reporting each finished step to
+// progress if it is non-nil.
+func (al *AgentLoop) runWorkflow(ctx context.Context, wf *workflow.Workflow, args, channel, chatID string, progress func(workflow.StepResult)) (*workflow.Result, error) {
+	for _, step := range wf.Steps {
+		for _, toolName := range step.Tools {
+			if _, ok := al.tools.Get(toolName); !ok {
+				return nil, fmt.Errorf("workflow %q step %q uses unknown tool %q", wf.Name, step.Name, toolName)
+			}
+		}
+	}
+
+	logger.InfoCF("agent", "Running workflow",
+		map[string]interface{}{
+			"workflow": wf.Name,
+			"steps":    len(wf.Steps),
+			"channel":  channel,
+		})
+
+	// Steps share a session of their own, so later steps see earlier work
+	// without it ending up in the chat's history.
+	sessionKey := fmt.Sprintf("workflow:%s:%s:%s", wf.Name, channel, chatID)
+	al.sessions.SetHistory(sessionKey, nil)
+	al.sessions.SetSummary(sessionKey, "")
+
+	runStep := func(ctx context.Context, prompt string, allowed []string) (string, error) {
+		opts := processOptions{
+			SessionKey:  sessionKey,
+			Channel:     channel,
+			ChatID:      chatID,
+			UserMessage: prompt,
+		}
+		if len(allowed) > 0 {
+			opts.ToolFilter = func(name string) bool { return slices.Contains(allowed, name) }
+		}
+		return al.runAgentLoop(ctx, opts)
+	}
+
+	if progress == nil {
+		progress = func(workflow.StepResult) {}
+	}
+	return wf.Run(ctx, args, al.workspace, runStep, progress), nil
+}
+
+func listWorkflows(workflows map[string]*workflow.Workflow) string {
+	if len(workflows) == 0 {
+		return "No workflows defined. Add YAML files to the workflows/ folder of the workspace."
+	}
+	var sb strings.Builder
+	sb.WriteString("Available workflows:\n")
+	for _, name := range workflow.Names(workflows) {
+		wf := workflows[name]
+		fmt.Fprintf(&sb, "\n• %s (%d steps)", name, len(wf.Steps))
+		if wf.Description != "" {
+			sb.WriteString(" - " + wf.Description)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,150 @@
+// Package agenttest runs the agent end to end in tests, without network
+// or external services: a message goes in through an in-memory channel, a
+// provider replaying a script decides which tools to call, stub tools
+// answer, and the reply comes back out through the channel manager.
+//
+//	provider := agenttest.NewProvider(
+//		agenttest.UseTool("lookup", map[string]interface{}{"q": "weather"}),
+//		agenttest.Reply("Sunny."),
+//	)
+//	lookup := agenttest.StubTool("lookup", "sunny, 21°C")
+//	h := agenttest.New(t, provider, lookup)
+//	if reply := h.Ask("How's the weather?"); reply != "Sunny." { ... }
+package agenttest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/agent"
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+const (
+	// ChannelName is the name of the harness's channel.
+	ChannelName = "test"
+	// ChatID and UserID are who Ask and Say talk as.
+	ChatID = "chat"
+	UserID = "user"
+
+	// ReplyTimeout is how long Ask waits for the agent's answer.
+	ReplyTimeout = 10 * time.Second
+)
+
+// Harness is a running agent wired to a fake channel and a scripted
+// provider.
+type Harness struct {
+	t        testing.TB
+	Config   *config.Config
+	Bus      *bus.MessageBus
+	Agent    *agent.AgentLoop
+	Provider *Provider
+	Channel  *Channel
+	Manager  *channels.Manager
+}
+
+// Config returns the configuration New uses: a temporary workspace and
+// no channels or optional services, so the provider is only asked to
+// answer turns.
+func Config(t testing.TB) *config.Config {
+	return &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         8192,
+				MaxToolIterations: 10,
+			},
+		},
+	}
+}
+
+// New starts an agent with Config, answering with provider and with
+// extra tools registered. It stops when the test ends.
+func New(t testing.TB, provider *Provider, extra ...tools.Tool) *Harness {
+	return NewWithConfig(t, Config(t), provider, extra...)
+}
+
+// NewWithConfig is New with cfg, usually Config changed by the test.
+func NewWithConfig(t testing.TB, cfg *config.Config, provider *Provider, extra ...tools.Tool) *Harness {
+	t.Helper()
+	mb := bus.NewMessageBus()
+	loop := agent.NewAgentLoop(cfg, mb, provider)
+	for _, tool := range extra {
+		if err := loop.RegisterTool(tool); err != nil {
+			t.Fatalf("agenttest: registering tool: %v", err)
+		}
+	}
+
+	manager, err := channels.NewManager(cfg, mb)
+	if err != nil {
+		t.Fatalf("agenttest: creating channel manager: %v", err)
+	}
+	channel := NewChannel(ChannelName, mb)
+	manager.RegisterChannel(ChannelName, channel)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := manager.StartAll(ctx); err != nil {
+		cancel()
+		t.Fatalf("agenttest: starting channels: %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		loop.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		loop.Stop()
+		cancel()
+		manager.StopAll(context.Background())
+		<-done
+	})
+
+	return &Harness{
+		t:        t,
+		Config:   cfg,
+		Bus:      mb,
+		Agent:    loop,
+		Provider: provider,
+		Channel:  channel,
+		Manager:  manager,
+	}
+}
+
+// Say sends text to the agent as UserID in ChatID, without waiting.
+func (h *Harness) Say(text string, media ...string) {
+	h.Channel.Say(ChatID, UserID, text, media...)
+}
+
+// Ask sends text to the agent and returns its reply, failing the test if
+// none arrives within ReplyTimeout.
+func (h *Harness) Ask(text string, media ...string) string {
+	h.t.Helper()
+	h.Say(text, media...)
+	return h.Reply()
+}
+
+// Reply returns the agent's next message, failing the test if none
+// arrives within ReplyTimeout.
+func (h *Harness) Reply() string {
+	h.t.Helper()
+	msg, ok := h.Channel.WaitForReply(ReplyTimeout)
+	if !ok {
+		h.t.Fatalf("agenttest: no reply within %s (%d provider calls, %d steps left)",
+			ReplyTimeout, len(h.Provider.Calls()), h.Provider.Remaining())
+	}
+	return msg.Content
+}
+
+// Finished fails the test if steps of the provider's script were not
+// used.
+func (h *Harness) Finished() {
+	h.t.Helper()
+	if n := h.Provider.Remaining(); n > 0 {
+		h.t.Errorf("agenttest: %d scripted provider steps were not used", n)
+	}
+}
@@ -0,0 +1,87 @@
+package agenttest
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// TestHarness_ToolRoundTrip verifies a message goes in, the scripted tool
+// call runs the stub with its arguments, the model sees the result, and
+// the reply comes out on the channel.
+func TestHarness_ToolRoundTrip(t *testing.T) {
+	lookup := StubTool("lookup", "sunny, 21°C")
+	provider := NewProvider(
+		UseTool("lookup", map[string]interface{}{"q": "weather"}),
+		func(call Call) (*providers.LLMResponse, error) {
+			last := call.LastMessage()
+			if last.Role != "tool" || last.Content != "sunny, 21°C" {
+				t.Errorf("Expected the tool result as the last message, got %s: %q", last.Role, last.Content)
+			}
+			return &providers.LLMResponse{Content: "Sunny."}, nil
+		},
+	)
+	h := New(t, provider, lookup)
+
+	if reply := h.Ask("How's the weather?"); reply != "Sunny." {
+		t.Errorf("Expected %q, got %q", "Sunny.", reply)
+	}
+	h.Finished()
+
+	calls := lookup.Calls()
+	if len(calls) != 1 || calls[0]["q"] != "weather" {
+		t.Errorf("Expected one lookup of weather, got %v", calls)
+	}
+	first := provider.Calls()[0]
+	if !first.HasTool("lookup") || !strings.Contains(first.LastMessage().Content, "How's the weather?") {
+		t.Errorf("Expected the first call to offer lookup and carry the question, got %q", first.LastMessage().Content)
+	}
+}
+
+// TestHarness_KeepsHistory verifies a second message in the chat is sent
+// with the first exchange.
+func TestHarness_KeepsHistory(t *testing.T) {
+	provider := NewProvider(Reply("Hi Ann."), Reply("You're Ann."))
+	h := New(t, provider)
+
+	h.Ask("I'm Ann.")
+	if reply := h.Ask("Who am I?"); reply != "You're Ann." {
+		t.Errorf("Expected the second reply, got %q", reply)
+	}
+	var seen []string
+	for _, m := range provider.Calls()[1].Messages {
+		seen = append(seen, m.Content)
+	}
+	if joined := strings.Join(seen, "\n"); !strings.Contains(joined, "I'm Ann.") || !strings.Contains(joined, "Hi Ann.") {
+		t.Errorf("Expected the first exchange in the second call, got %q", joined)
+	}
+}
+
+// TestHarness_Failures verifies failing tools reach the model as errors,
+// and provider failures and unscripted calls reach the user.
+func TestHarness_Failures(t *testing.T) {
+	broken := FailingTool("deploy", "permission denied")
+	provider := NewProvider(
+		UseTool("deploy", nil),
+		func(call Call) (*providers.LLMResponse, error) {
+			if !strings.Contains(call.LastMessage().Content, "permission denied") {
+				t.Errorf("Expected the tool error, got %q", call.LastMessage().Content)
+			}
+			return &providers.LLMResponse{Content: "Deploy failed."}, nil
+		},
+		Fail(errors.New("provider down")),
+	)
+	h := New(t, provider, broken)
+
+	if reply := h.Ask("deploy"); reply != "Deploy failed." {
+		t.Errorf("Expected the failure to be reported, got %q", reply)
+	}
+	if reply := h.Ask("again"); !strings.Contains(reply, "provider down") {
+		t.Errorf("Expected the provider error, got %q", reply)
+	}
+	if reply := h.Ask("and again"); !strings.Contains(reply, "beyond the end of the script") {
+		t.Errorf("Expected an unscripted call to fail, got %q", reply)
+	}
+}
@@ -0,0 +1,81 @@
+package agenttest
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
+)
+
+// Channel is an in-memory chat channel: tests say things on it and read
+// what the agent sends back.
+type Channel struct {
+	*channels.BaseChannel
+	running atomic.Bool
+	replies chan bus.OutboundMessage
+
+	mu   sync.Mutex
+	sent []bus.OutboundMessage
+}
+
+// NewChannel creates a channel named name on mb. Everyone is allowed.
+func NewChannel(name string, mb *bus.MessageBus) *Channel {
+	return &Channel{
+		BaseChannel: channels.NewBaseChannel(name, nil, mb, nil),
+		replies:     make(chan bus.OutboundMessage, 100),
+	}
+}
+
+func (c *Channel) Start(ctx context.Context) error {
+	c.running.Store(true)
+	return nil
+}
+
+func (c *Channel) Stop(ctx context.Context) error {
+	c.running.Store(false)
+	return nil
+}
+
+func (c *Channel) IsRunning() bool {
+	return c.running.Load()
+}
+
+// Send records msg.
+func (c *Channel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	c.mu.Lock()
+	c.sent = append(c.sent, msg)
+	c.mu.Unlock()
+	select {
+	case c.replies <- msg:
+	default:
+		// Nobody is waiting; Sent still has it
+	}
+	return nil
+}
+
+// Say sends text from senderID in chatID to the agent, as if a user wrote
+// it. media are local paths of attachments.
+func (c *Channel) Say(chatID, senderID, text string, media ...string) {
+	c.HandleMessage(senderID, chatID, text, media, nil)
+}
+
+// WaitForReply returns the next message the agent sends on the channel,
+// or false if none arrives within timeout.
+func (c *Channel) WaitForReply(timeout time.Duration) (bus.OutboundMessage, bool) {
+	select {
+	case msg := <-c.replies:
+		return msg, true
+	case <-time.After(timeout):
+		return bus.OutboundMessage{}, false
+	}
+}
+
+// Sent returns every message the agent has sent on the channel.
+func (c *Channel) Sent() []bus.OutboundMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]bus.OutboundMessage(nil), c.sent...)
+}
@@ -0,0 +1,146 @@
+package agenttest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// Call is one request the agent made to the provider.
+type Call struct {
+	Messages []providers.Message
+	Tools    []providers.ToolDefinition
+	Model    string
+}
+
+// LastMessage returns the last message of the request.
+func (c Call) LastMessage() providers.Message {
+	if len(c.Messages) == 0 {
+		return providers.Message{}
+	}
+	return c.Messages[len(c.Messages)-1]
+}
+
+// HasTool reports whether the tool named name was offered in the request.
+func (c Call) HasTool(name string) bool {
+	for _, t := range c.Tools {
+		if t.Function.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Step answers one provider call. Most scripts use Reply and UseTool; a
+// Step of its own can look at the request, e.g. to answer with a tool
+// result.
+type Step func(call Call) (*providers.LLMResponse, error)
+
+// Reply answers with text and no tool calls, which ends the turn.
+func Reply(text string) Step {
+	return func(Call) (*providers.LLMResponse, error) {
+		return &providers.LLMResponse{Content: text, FinishReason: "stop"}, nil
+	}
+}
+
+// UseTool asks the agent to run one tool with args.
+func UseTool(name string, args map[string]interface{}) Step {
+	return UseTools(ToolUse{Name: name, Args: args})
+}
+
+// ToolUse is one tool call in a UseTools step.
+type ToolUse struct {
+	Name string
+	Args map[string]interface{}
+}
+
+// UseTools asks the agent to run several tools in one response.
+func UseTools(uses ...ToolUse) Step {
+	return func(call Call) (*providers.LLMResponse, error) {
+		resp := &providers.LLMResponse{FinishReason: "tool_calls"}
+		for i, u := range uses {
+			args := u.Args
+			if args == nil {
+				args = map[string]interface{}{}
+			}
+			resp.ToolCalls = append(resp.ToolCalls, providers.ToolCall{
+				ID:        fmt.Sprintf("call_%d_%d", len(call.Messages), i),
+				Type:      "function",
+				Name:      u.Name,
+				Arguments: args,
+			})
+		}
+		return resp, nil
+	}
+}
+
+// Fail answers with err, as a provider outage would.
+func Fail(err error) Step {
+	return func(Call) (*providers.LLMResponse, error) {
+		return nil, err
+	}
+}
+
+// Provider replays a script: each call to Chat is answered by the next
+// Step. A call beyond the end of the script fails, so tests notice turns
+// that ask the model more often than expected.
+type Provider struct {
+	model string
+
+	mu     sync.Mutex
+	script []Step
+	calls  []Call
+}
+
+// NewProvider returns a provider that answers with steps, in order.
+func NewProvider(steps ...Step) *Provider {
+	return &Provider{model: "test-model", script: steps}
+}
+
+// Add appends steps to the script.
+func (p *Provider) Add(steps ...Step) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.script = append(p.script, steps...)
+}
+
+func (p *Provider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, options map[string]interface{}) (*providers.LLMResponse, error) {
+	call := Call{
+		Messages: append([]providers.Message(nil), messages...),
+		Tools:    append([]providers.ToolDefinition(nil), tools...),
+		Model:    model,
+	}
+
+	p.mu.Lock()
+	p.calls = append(p.calls, call)
+	if len(p.script) == 0 {
+		n := len(p.calls)
+		p.mu.Unlock()
+		return nil, fmt.Errorf("agenttest: provider call %d is beyond the end of the script", n)
+	}
+	step := p.script[0]
+	p.script = p.script[1:]
+	p.mu.Unlock()
+
+	return step(call)
+}
+
+func (p *Provider) GetDefaultModel() string {
+	return p.model
+}
+
+// Calls returns the requests made so far.
+func (p *Provider) Calls() []Call {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Call(nil), p.calls...)
+}
+
+// Remaining returns how many steps of the script are left.
+func (p *Provider) Remaining() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.script)
+}
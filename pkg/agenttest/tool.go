@@ -0,0 +1,77 @@
+package agenttest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// Tool is a scripted stand-in for a real tool. It records the arguments of
+// every call and answers with Handler.
+type Tool struct {
+	ToolName string
+	Desc     string
+	Params   map[string]interface{}
+	Handler  func(args map[string]interface{}) *tools.ToolResult
+
+	mu    sync.Mutex
+	calls []map[string]interface{}
+}
+
+// StubTool returns a tool named name that takes any arguments and answers
+// every call with result.
+func StubTool(name, result string) *Tool {
+	return &Tool{
+		ToolName: name,
+		Handler: func(map[string]interface{}) *tools.ToolResult {
+			return tools.NewToolResult(result)
+		},
+	}
+}
+
+// FailingTool returns a tool named name whose every call fails with
+// message.
+func FailingTool(name, message string) *Tool {
+	return &Tool{
+		ToolName: name,
+		Handler: func(map[string]interface{}) *tools.ToolResult {
+			return tools.ErrorResult(message)
+		},
+	}
+}
+
+func (t *Tool) Name() string {
+	return t.ToolName
+}
+
+func (t *Tool) Description() string {
+	if t.Desc == "" {
+		return "Test tool " + t.ToolName + "."
+	}
+	return t.Desc
+}
+
+func (t *Tool) Parameters() map[string]interface{} {
+	if t.Params == nil {
+		return map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+	}
+	return t.Params
+}
+
+func (t *Tool) Execute(ctx context.Context, args map[string]interface{}) *tools.ToolResult {
+	t.mu.Lock()
+	t.calls = append(t.calls, args)
+	t.mu.Unlock()
+	if t.Handler == nil {
+		return tools.NewToolResult("ok")
+	}
+	return t.Handler(args)
+}
+
+// Calls returns the arguments of each call so far.
+func (t *Tool) Calls() []map[string]interface{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]map[string]interface{}(nil), t.calls...)
+}
@@ -0,0 +1,349 @@
+// Package browser drives a headless Chromium over the DevTools protocol,
+// for pages that need JavaScript or a login. It launches the browser
+// itself and speaks the protocol over a WebSocket, so it needs nothing
+// but a Chromium or Chrome binary.
+package browser
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// binaries are the names Chromium and Chrome are installed under.
+var binaries = []string{"chromium", "chromium-browser", "google-chrome", "google-chrome-stable", "chrome", "microsoft-edge"}
+
+// FindBinary returns the first Chromium-like browser installed, or "".
+func FindBinary() string {
+	for _, name := range binaries {
+		if path, err := exec.LookPath(name); err == nil {
+			return path
+		}
+	}
+	if runtime.GOOS == "darwin" {
+		for _, path := range []string{
+			"/Applications/Chromium.app/Contents/MacOS/Chromium",
+			"/Applications/Google Chrome.app/Contents/MacOS/Google Chrome",
+		} {
+			if _, err := os.Stat(path); err == nil {
+				return path
+			}
+		}
+	}
+	return ""
+}
+
+// Options configures a browser.
+type Options struct {
+	// Binary is the browser to run; empty finds one with FindBinary.
+	Binary string
+	// ProfileDir keeps cookies and logins between runs; empty uses a
+	// temporary profile removed on Close.
+	ProfileDir string
+	// AllowedDomains limits the pages that may be opened to these domains
+	// and their subdomains. Empty allows any public site.
+	AllowedDomains []string
+}
+
+// Browser is a running headless browser. It is safe for concurrent use;
+// each Page should be used by one caller at a time.
+type Browser struct {
+	cmd     *exec.Cmd
+	conn    *conn
+	policy  *policy
+	tempDir string
+
+	mu    sync.Mutex
+	pages map[string]*Page // by session ID
+}
+
+// Launch starts the browser and connects to it.
+func Launch(ctx context.Context, opts Options) (*Browser, error) {
+	binary := opts.Binary
+	if binary == "" {
+		if binary = FindBinary(); binary == "" {
+			return nil, errors.New("no Chromium or Chrome found; install chromium or set tools.browser.binary")
+		}
+	}
+	b := &Browser{policy: newPolicy(opts.AllowedDomains), pages: make(map[string]*Page)}
+	profile := opts.ProfileDir
+	if profile == "" {
+		dir, err := os.MkdirTemp("", "picoclaw-browser-")
+		if err != nil {
+			return nil, err
+		}
+		profile, b.tempDir = dir, dir
+	} else if err := os.MkdirAll(profile, 0700); err != nil {
+		return nil, err
+	}
+
+	args := []string{
+		"--headless=new",
+		"--remote-debugging-port=0",
+		"--user-data-dir=" + profile,
+		"--no-first-run",
+		"--no-default-browser-check",
+		"--disable-gpu",
+		"--disable-dev-shm-usage",
+		"--disable-extensions",
+		"--disable-background-networking",
+		"--mute-audio",
+		"--window-size=1280,900",
+	}
+	if runtime.GOOS == "linux" && os.Geteuid() == 0 {
+		// Chromium refuses to start its sandbox as root
+		args = append(args, "--no-sandbox")
+	}
+	args = append(args, "about:blank")
+	b.cmd = exec.Command(binary, args...)
+	stderr, err := b.cmd.StderrPipe()
+	if err != nil {
+		b.cleanup()
+		return nil, err
+	}
+	if err := b.cmd.Start(); err != nil {
+		b.cleanup()
+		return nil, fmt.Errorf("failed to start %s: %w", binary, err)
+	}
+
+	wsURL, err := devToolsURL(ctx, stderr)
+	if err != nil {
+		b.Close()
+		return nil, err
+	}
+	if b.conn, err = dial(ctx, wsURL, b.dispatch); err != nil {
+		b.Close()
+		return nil, fmt.Errorf("failed to connect to the browser: %w", err)
+	}
+	return b, nil
+}
+
+// devToolsURL reads the browser's WebSocket address from its log, then
+// keeps draining the log so the browser never blocks on it.
+func devToolsURL(ctx context.Context, stderr io.Reader) (string, error) {
+	found := make(chan string, 1)
+	go func() {
+		scanner := bufio.NewScanner(stderr)
+		sent := false
+		var last string
+		for scanner.Scan() {
+			line := scanner.Text()
+			if !sent {
+				if rest, ok := strings.CutPrefix(line, "DevTools listening on "); ok {
+					found <- strings.TrimSpace(rest)
+					sent = true
+				} else if strings.TrimSpace(line) != "" {
+					last = line
+				}
+			}
+		}
+		if !sent {
+			found <- "error: " + last
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	select {
+	case addr := <-found:
+		if msg, ok := strings.CutPrefix(addr, "error: "); ok {
+			return "", fmt.Errorf("the browser exited: %s", msg)
+		}
+		return addr, nil
+	case <-ctx.Done():
+		return "", errors.New("the browser did not start in time")
+	}
+}
+
+// dispatch routes a page's events to it.
+func (b *Browser) dispatch(msg message) {
+	b.mu.Lock()
+	page := b.pages[msg.SessionID]
+	b.mu.Unlock()
+	if page != nil {
+		page.event(msg)
+	}
+}
+
+// Alive reports whether the browser is still connected.
+func (b *Browser) Alive() bool {
+	return b.conn != nil && !b.conn.closed()
+}
+
+// NewPage opens a blank tab.
+func (b *Browser) NewPage(ctx context.Context) (*Page, error) {
+	var target struct {
+		TargetID string `json:"targetId"`
+	}
+	if err := b.conn.call(ctx, "", "Target.createTarget", map[string]interface{}{"url": "about:blank"}, &target); err != nil {
+		return nil, err
+	}
+	var attached struct {
+		SessionID string `json:"sessionId"`
+	}
+	err := b.conn.call(ctx, "", "Target.attachToTarget", map[string]interface{}{"targetId": target.TargetID, "flatten": true}, &attached)
+	if err != nil {
+		return nil, err
+	}
+	page := newPage(b, target.TargetID, attached.SessionID)
+	b.mu.Lock()
+	b.pages[attached.SessionID] = page
+	b.mu.Unlock()
+
+	if err := page.enable(ctx); err != nil {
+		page.Close()
+		return nil, err
+	}
+	return page, nil
+}
+
+func (b *Browser) closePage(p *Page) {
+	b.mu.Lock()
+	delete(b.pages, p.session)
+	b.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	b.conn.call(ctx, "", "Target.closeTarget", map[string]interface{}{"targetId": p.target}, nil)
+}
+
+// Close stops the browser.
+func (b *Browser) Close() error {
+	if b.conn != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		b.conn.call(ctx, "", "Browser.close", nil, nil)
+		cancel()
+		b.conn.close()
+	}
+	if b.cmd != nil && b.cmd.Process != nil {
+		done := make(chan struct{})
+		go func() {
+			b.cmd.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(3 * time.Second):
+			b.cmd.Process.Kill()
+			<-done
+		}
+	}
+	b.cleanup()
+	return nil
+}
+
+func (b *Browser) cleanup() {
+	if b.tempDir != "" {
+		os.RemoveAll(b.tempDir)
+	}
+}
+
+// policy decides which URLs the browser may load.
+type policy struct {
+	domains []string
+
+	mu      sync.Mutex
+	private map[string]bool // host -> resolves to a private address
+}
+
+func newPolicy(domains []string) *policy {
+	p := &policy{private: make(map[string]bool)}
+	for _, d := range domains {
+		d = strings.ToLower(strings.Trim(strings.TrimSpace(d), "."))
+		d = strings.TrimPrefix(d, "*.")
+		if d != "" {
+			p.domains = append(p.domains, d)
+		}
+	}
+	return p
+}
+
+// listed reports whether host is one of the allowed domains or under one.
+func (p *policy) listed(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, d := range p.domains {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPage returns why a page at rawURL may not be opened, or nil.
+func (p *policy) checkPage(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+	switch u.Scheme {
+	case "about", "data", "blob":
+		return nil
+	case "http", "https":
+	default:
+		return fmt.Errorf("%s: URLs are not allowed", u.Scheme)
+	}
+	if len(p.domains) > 0 && !p.listed(u.Hostname()) {
+		return fmt.Errorf("%s is not in the allowed domains (%s)", u.Hostname(), strings.Join(p.domains, ", "))
+	}
+	return p.checkRequest(u)
+}
+
+// checkRequest refuses requests to private networks, unless the host is
+// listed explicitly, so a page can't reach the local network through the
+// browser.
+func (p *policy) checkRequest(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "ws" && u.Scheme != "wss" {
+		return nil
+	}
+	host := u.Hostname()
+	if p.listed(host) {
+		return nil
+	}
+	p.mu.Lock()
+	private, known := p.private[host]
+	p.mu.Unlock()
+	if !known {
+		private = isPrivateHost(host)
+		p.mu.Lock()
+		if len(p.private) > 1024 {
+			clear(p.private)
+		}
+		p.private[host] = private
+		p.mu.Unlock()
+	}
+	if private {
+		return fmt.Errorf("%s is on a private network", host)
+	}
+	return nil
+}
+
+// isPrivateHost reports whether host is, or resolves to, a loopback,
+// private, link-local or unspecified address.
+func isPrivateHost(host string) bool {
+	host = strings.ToLower(host)
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		var err error
+		if ips, err = net.LookupIP(host); err != nil {
+			return false
+		}
+	}
+	for _, ip := range ips {
+		if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,237 @@
+package browser
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// fakeChrome is a DevTools endpoint that answers the calls a Page makes
+// with canned results.
+type fakeChrome struct {
+	srv *httptest.Server
+
+	mu     sync.Mutex
+	calls  []string
+	failed []string // URLs the client refused through Fetch.failRequest
+}
+
+func newFakeChrome(t *testing.T) *fakeChrome {
+	f := &fakeChrome{}
+	upgrader := websocket.Upgrader{}
+	f.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		f.serve(ws)
+	}))
+	t.Cleanup(f.srv.Close)
+	return f
+}
+
+func (f *fakeChrome) serve(ws *websocket.Conn) {
+	reply := func(msg message, result interface{}) {
+		raw, _ := json.Marshal(result)
+		ws.WriteJSON(message{ID: msg.ID, SessionID: msg.SessionID, Result: raw})
+	}
+	event := func(method string, params interface{}) {
+		raw, _ := json.Marshal(params)
+		ws.WriteJSON(message{SessionID: "S1", Method: method, Params: raw})
+	}
+	for {
+		var msg message
+		if err := ws.ReadJSON(&msg); err != nil {
+			return
+		}
+		f.mu.Lock()
+		f.calls = append(f.calls, msg.Method)
+		f.mu.Unlock()
+
+		var params map[string]interface{}
+		json.Unmarshal(msg.Params, &params)
+		switch msg.Method {
+		case "Target.createTarget":
+			reply(msg, map[string]string{"targetId": "T1"})
+		case "Target.attachToTarget":
+			reply(msg, map[string]string{"sessionId": "S1"})
+		case "Page.navigate":
+			// The page and a script from the local network ask to load
+			requests := map[string]string{"r1": params["url"].(string), "r2": "http://127.0.0.1:9/tracker.js"}
+			event("Fetch.requestPaused", map[string]interface{}{"requestId": "r1", "request": map[string]string{"url": requests["r1"]}, "resourceType": "Document"})
+			event("Fetch.requestPaused", map[string]interface{}{"requestId": "r2", "request": map[string]string{"url": requests["r2"]}, "resourceType": "Script"})
+			for answered := 0; answered < 2; {
+				var fetch message
+				if ws.ReadJSON(&fetch) != nil {
+					return
+				}
+				var p struct {
+					RequestID string `json:"requestId"`
+				}
+				json.Unmarshal(fetch.Params, &p)
+				if fetch.Method == "Fetch.failRequest" {
+					f.mu.Lock()
+					f.failed = append(f.failed, requests[p.RequestID])
+					f.mu.Unlock()
+				}
+				reply(fetch, struct{}{})
+				answered++
+			}
+			reply(msg, map[string]string{"frameId": "F1", "loaderId": "L1"})
+			event("Page.frameStartedLoading", map[string]string{"frameId": "F1"})
+			event("Page.loadEventFired", map[string]float64{"timestamp": 1})
+		case "Runtime.evaluate":
+			expr := params["expression"].(string)
+			var value interface{}
+			switch {
+			case expr == "[location.href, document.title]":
+				value = []string{"https://example.com/", "Example"}
+			case strings.HasPrefix(expr, "document.body"):
+				value = "Hello\nworld"
+			case strings.HasPrefix(expr, findElement) && strings.Contains(expr, `"#missing"`):
+				value = nil
+			case strings.HasPrefix(expr, findElement):
+				value = map[string]interface{}{"x": 10, "y": 20, "width": 30, "height": 10, "description": `button "Go"`}
+			case strings.Contains(expr, "throw"):
+				raw, _ := json.Marshal(map[string]interface{}{"exceptionDetails": map[string]interface{}{
+					"text": "Uncaught", "exception": map[string]string{"description": "Error: boom\n    at <anonymous>:1:1"},
+				}})
+				ws.WriteJSON(message{ID: msg.ID, SessionID: msg.SessionID, Result: raw})
+				continue
+			}
+			reply(msg, map[string]interface{}{"result": map[string]interface{}{"value": value}})
+		default:
+			reply(msg, struct{}{})
+		}
+	}
+}
+
+func (f *fakeChrome) count(method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, c := range f.calls {
+		if c == method {
+			n++
+		}
+	}
+	return n
+}
+
+// fakeBinary writes a script that announces the fake endpoint like
+// Chromium does, then exits
+func fakeBinary(t *testing.T, wsURL string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	path := filepath.Join(t.TempDir(), "chromium")
+	script := "#!/bin/sh\necho 'starting' >&2\necho 'DevTools listening on " + wsURL + "' >&2\n"
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestPage verifies a page loads through the request filter and that
+// clicks, text and script errors go through the protocol
+func TestPage(t *testing.T) {
+	f := newFakeChrome(t)
+	binary := fakeBinary(t, "ws"+strings.TrimPrefix(f.srv.URL, "http"))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	b, err := Launch(ctx, Options{Binary: binary, AllowedDomains: []string{"example.com"}})
+	if err != nil {
+		t.Fatalf("Launch failed: %v", err)
+	}
+	defer b.Close()
+	page, err := b.NewPage(ctx)
+	if err != nil {
+		t.Fatalf("NewPage failed: %v", err)
+	}
+
+	if err := page.Navigate(ctx, "https://example.com/"); err != nil {
+		t.Fatalf("Navigate failed: %v", err)
+	}
+	f.mu.Lock()
+	failed := f.failed
+	f.mu.Unlock()
+	if len(failed) != 1 || failed[0] != "http://127.0.0.1:9/tracker.js" {
+		t.Errorf("Expected only the local network request refused, got %v", failed)
+	}
+	if blocked := page.TakeBlocked(); len(blocked) != 1 || !strings.Contains(blocked[0], "private network") {
+		t.Errorf("Expected the refusal reported, got %v", blocked)
+	}
+
+	if err := page.Navigate(ctx, "https://evil.test/"); err == nil || !strings.Contains(err.Error(), "allowed domains") {
+		t.Errorf("Expected a domain outside the list refused, got %v", err)
+	}
+
+	pageURL, title, err := page.Info(ctx)
+	if err != nil || pageURL != "https://example.com/" || title != "Example" {
+		t.Errorf("Expected the page's URL and title, got %q %q %v", pageURL, title, err)
+	}
+	if text, err := page.Text(ctx, ""); err != nil || text != "Hello\nworld" {
+		t.Errorf("Expected the page text, got %q %v", text, err)
+	}
+
+	clicked, err := page.Click(ctx, "text=Go")
+	if err != nil || clicked != `button "Go"` {
+		t.Errorf("Expected the button clicked, got %q %v", clicked, err)
+	}
+	if n := f.count("Input.dispatchMouseEvent"); n != 3 {
+		t.Errorf("Expected move, press and release, got %d mouse events", n)
+	}
+	if _, err := page.Click(ctx, "#missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if err := page.evaluate(ctx, "throw new Error('boom')", nil); err == nil || err.Error() != "script error: Error: boom" {
+		t.Errorf("Expected the script error, got %v", err)
+	}
+
+	page.Close()
+	if n := f.count("Target.closeTarget"); n != 1 {
+		t.Errorf("Expected the tab closed, got %d", n)
+	}
+}
+
+// TestPolicy verifies the allowlist and the private network check
+func TestPolicy(t *testing.T) {
+	open := newPolicy(nil)
+	listed := newPolicy([]string{"*.Example.com", "127.0.0.1"})
+	cases := []struct {
+		p   *policy
+		url string
+		ok  bool
+	}{
+		{open, "about:blank", true},
+		{open, "file:///etc/passwd", false},
+		{open, "chrome://settings", false},
+		{open, "http://localhost:8080/", false},
+		{open, "http://10.1.2.3/", false},
+		{open, "http://[::1]/", false},
+		{listed, "https://example.com/login", true},
+		{listed, "https://mail.example.com/", true},
+		{listed, "https://notexample.com/", false},
+		{listed, "http://127.0.0.1:3000/", true},
+		{listed, "http://192.168.1.1/", false},
+	}
+	for _, c := range cases {
+		if err := c.p.checkPage(c.url); (err == nil) != c.ok {
+			t.Errorf("%s: expected ok=%v, got %v", c.url, c.ok, err)
+		}
+	}
+}
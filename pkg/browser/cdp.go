@@ -0,0 +1,152 @@
+package browser
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// errClosed is returned by calls on a connection that has gone away,
+// usually because the browser exited.
+var errClosed = errors.New("the browser connection is closed")
+
+// message is a DevTools protocol message: a call, its response or an event.
+// With flattened sessions every message for a page carries its session ID.
+type message struct {
+	ID        int64           `json:"id,omitempty"`
+	SessionID string          `json:"sessionId,omitempty"`
+	Method    string          `json:"method,omitempty"`
+	Params    json.RawMessage `json:"params,omitempty"`
+	Result    json.RawMessage `json:"result,omitempty"`
+	Error     *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// conn is a DevTools protocol connection over a WebSocket. Events are
+// passed to onEvent from the read loop, which must not block on a call.
+type conn struct {
+	ws      *websocket.Conn
+	onEvent func(message)
+
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	nextID  int64
+	pending map[int64]chan message
+	done    chan struct{}
+}
+
+func dial(ctx context.Context, url string, onEvent func(message)) (*conn, error) {
+	ws, _, err := websocket.DefaultDialer.DialContext(ctx, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	c := &conn{
+		ws:      ws,
+		onEvent: onEvent,
+		pending: make(map[int64]chan message),
+		done:    make(chan struct{}),
+	}
+	go c.readLoop()
+	return c, nil
+}
+
+func (c *conn) readLoop() {
+	defer func() {
+		c.mu.Lock()
+		close(c.done)
+		c.pending = nil
+		c.mu.Unlock()
+	}()
+	for {
+		var msg message
+		if err := c.ws.ReadJSON(&msg); err != nil {
+			return
+		}
+		if msg.ID == 0 {
+			if c.onEvent != nil {
+				c.onEvent(msg)
+			}
+			continue
+		}
+		c.mu.Lock()
+		reply, ok := c.pending[msg.ID]
+		delete(c.pending, msg.ID)
+		c.mu.Unlock()
+		if ok {
+			reply <- msg
+		}
+	}
+}
+
+// call sends method to the browser, or to a page when sessionID is set,
+// and decodes the response into result if it is not nil.
+func (c *conn) call(ctx context.Context, sessionID, method string, params, result interface{}) error {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	if params == nil {
+		raw = []byte("{}")
+	}
+	reply := make(chan message, 1)
+	c.mu.Lock()
+	if c.pending == nil {
+		c.mu.Unlock()
+		return errClosed
+	}
+	c.nextID++
+	id := c.nextID
+	c.pending[id] = reply
+	c.mu.Unlock()
+
+	c.writeMu.Lock()
+	err = c.ws.WriteJSON(message{ID: id, SessionID: sessionID, Method: method, Params: raw})
+	c.writeMu.Unlock()
+	if err != nil {
+		c.forget(id)
+		return errClosed
+	}
+
+	select {
+	case msg := <-reply:
+		if msg.Error != nil {
+			return fmt.Errorf("%s: %s", method, msg.Error.Message)
+		}
+		if result != nil && len(msg.Result) > 0 {
+			return json.Unmarshal(msg.Result, result)
+		}
+		return nil
+	case <-c.done:
+		return errClosed
+	case <-ctx.Done():
+		c.forget(id)
+		return ctx.Err()
+	}
+}
+
+func (c *conn) forget(id int64) {
+	c.mu.Lock()
+	if c.pending != nil {
+		delete(c.pending, id)
+	}
+	c.mu.Unlock()
+}
+
+func (c *conn) close() error {
+	return c.ws.Close()
+}
+
+func (c *conn) closed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,469 @@
+package browser
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned when no element matches a selector.
+var ErrNotFound = errors.New("no element matches the selector")
+
+// Page is a browser tab. Its methods must not be called concurrently.
+type Page struct {
+	browser *Browser
+	target  string
+	session string
+
+	// lifecycle receives the names of load events; they are dropped when
+	// nobody is waiting
+	lifecycle chan string
+
+	mu      sync.Mutex
+	blocked []string // requests the policy refused since the last TakeBlocked
+}
+
+func newPage(b *Browser, target, session string) *Page {
+	return &Page{browser: b, target: target, session: session, lifecycle: make(chan string, 64)}
+}
+
+func (p *Page) call(ctx context.Context, method string, params, result interface{}) error {
+	return p.browser.conn.call(ctx, p.session, method, params, result)
+}
+
+// enable turns on the events the page needs, and routes every request
+// through the policy.
+func (p *Page) enable(ctx context.Context) error {
+	if err := p.call(ctx, "Page.enable", nil, nil); err != nil {
+		return err
+	}
+	return p.call(ctx, "Fetch.enable", map[string]interface{}{
+		"patterns": []map[string]string{{"urlPattern": "*"}},
+	}, nil)
+}
+
+// event handles an event for this page. It runs on the connection's read
+// loop, so anything that calls the browser runs in its own goroutine.
+func (p *Page) event(msg message) {
+	switch msg.Method {
+	case "Fetch.requestPaused":
+		go p.filterRequest(msg.Params)
+	case "Page.javascriptDialogOpening":
+		// Nobody can answer an alert or confirm; accept it so the page goes on
+		go p.call(context.Background(), "Page.handleJavaScriptDialog", map[string]interface{}{"accept": true}, nil)
+	case "Page.frameStartedLoading", "Page.frameRequestedNavigation", "Page.loadEventFired", "Page.navigatedWithinDocument":
+		select {
+		case p.lifecycle <- msg.Method:
+		default:
+		}
+	}
+}
+
+func (p *Page) filterRequest(raw json.RawMessage) {
+	var req struct {
+		RequestID string `json:"requestId"`
+		Request   struct {
+			URL string `json:"url"`
+		} `json:"request"`
+		ResourceType string `json:"resourceType"`
+	}
+	if json.Unmarshal(raw, &req) != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var err error
+	if req.ResourceType == "Document" {
+		err = p.browser.policy.checkPage(req.Request.URL)
+	} else if u, perr := url.Parse(req.Request.URL); perr == nil {
+		err = p.browser.policy.checkRequest(u)
+	}
+	if err != nil {
+		p.mu.Lock()
+		if len(p.blocked) < 20 {
+			p.blocked = append(p.blocked, err.Error())
+		}
+		p.mu.Unlock()
+		p.call(ctx, "Fetch.failRequest", map[string]interface{}{"requestId": req.RequestID, "errorReason": "BlockedByClient"}, nil)
+		return
+	}
+	p.call(ctx, "Fetch.continueRequest", map[string]interface{}{"requestId": req.RequestID}, nil)
+}
+
+// TakeBlocked returns why requests were refused since the last call.
+func (p *Page) TakeBlocked() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	blocked := p.blocked
+	p.blocked = nil
+	return blocked
+}
+
+// Navigate opens rawURL and waits for it to load, or for ctx to end.
+func (p *Page) Navigate(ctx context.Context, rawURL string) error {
+	if err := p.browser.policy.checkPage(rawURL); err != nil {
+		return err
+	}
+	p.drain()
+	var nav struct {
+		LoaderID  string `json:"loaderId"`
+		ErrorText string `json:"errorText"`
+	}
+	if err := p.call(ctx, "Page.navigate", map[string]interface{}{"url": rawURL}, &nav); err != nil {
+		return err
+	}
+	if nav.ErrorText != "" {
+		if blocked := p.TakeBlocked(); len(blocked) > 0 {
+			return errors.New(blocked[0])
+		}
+		return fmt.Errorf("failed to open %s: %s", rawURL, nav.ErrorText)
+	}
+	if nav.LoaderID != "" {
+		p.waitLoad(ctx, true)
+	}
+	return nil
+}
+
+// Back goes to the previous page in the tab's history.
+func (p *Page) Back(ctx context.Context) error {
+	var history struct {
+		CurrentIndex int `json:"currentIndex"`
+		Entries      []struct {
+			ID int `json:"id"`
+		} `json:"entries"`
+	}
+	if err := p.call(ctx, "Page.getNavigationHistory", nil, &history); err != nil {
+		return err
+	}
+	if history.CurrentIndex <= 0 || history.CurrentIndex >= len(history.Entries) {
+		return errors.New("there is no previous page")
+	}
+	p.drain()
+	entry := history.Entries[history.CurrentIndex-1].ID
+	if err := p.call(ctx, "Page.navigateToHistoryEntry", map[string]interface{}{"entryId": entry}, nil); err != nil {
+		return err
+	}
+	p.waitLoad(ctx, false)
+	return nil
+}
+
+// drain forgets earlier load events before an action.
+func (p *Page) drain() {
+	for {
+		select {
+		case <-p.lifecycle:
+		default:
+			return
+		}
+	}
+}
+
+// waitLoad waits for a navigation caused by the last action to finish.
+// Unless started, it first waits briefly for one to begin; actions that
+// only change the page in place then get a moment for scripts to run.
+// It reports whether the page finished loading before ctx ended.
+func (p *Page) waitLoad(ctx context.Context, started bool) bool {
+	if !started {
+		timer := time.NewTimer(700 * time.Millisecond)
+		defer timer.Stop()
+	wait:
+		for {
+			select {
+			case ev := <-p.lifecycle:
+				switch ev {
+				case "Page.navigatedWithinDocument":
+					return true
+				case "Page.frameStartedLoading", "Page.frameRequestedNavigation":
+					break wait
+				case "Page.loadEventFired":
+					return true
+				}
+			case <-timer.C:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+	}
+	for {
+		select {
+		case ev := <-p.lifecycle:
+			if ev == "Page.loadEventFired" || ev == "Page.navigatedWithinDocument" {
+				// Give scripts that run on load a moment to render
+				select {
+				case <-time.After(300 * time.Millisecond):
+				case <-ctx.Done():
+				}
+				return true
+			}
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// evaluate runs a JavaScript expression and decodes its value into result.
+func (p *Page) evaluate(ctx context.Context, expr string, result interface{}) error {
+	var reply struct {
+		Result struct {
+			Value json.RawMessage `json:"value"`
+		} `json:"result"`
+		ExceptionDetails *struct {
+			Text      string `json:"text"`
+			Exception *struct {
+				Description string `json:"description"`
+			} `json:"exception"`
+		} `json:"exceptionDetails"`
+	}
+	err := p.call(ctx, "Runtime.evaluate", map[string]interface{}{
+		"expression":    expr,
+		"returnByValue": true,
+		"awaitPromise":  true,
+		"userGesture":   true,
+	}, &reply)
+	if err != nil {
+		return err
+	}
+	if d := reply.ExceptionDetails; d != nil {
+		if d.Exception != nil && d.Exception.Description != "" {
+			return fmt.Errorf("script error: %s", firstLine(d.Exception.Description))
+		}
+		return fmt.Errorf("script error: %s", d.Text)
+	}
+	if result == nil || len(reply.Result.Value) == 0 {
+		return nil
+	}
+	return json.Unmarshal(reply.Result.Value, result)
+}
+
+// findElement is a JavaScript function that finds the element for a
+// selector, scrolls it into view and describes where it is. A selector is
+// CSS, or "text=..." for the clickable element whose text contains it.
+const findElement = `(function(sel, focus, clear) {
+	let el = null;
+	if (sel.startsWith("text=")) {
+		const want = sel.slice(5).trim().toLowerCase();
+		const text = e => (e.innerText || e.value || e.getAttribute("aria-label") || "").trim().toLowerCase();
+		const clickable = 'a, button, input[type=submit], input[type=button], [role=button], [role=link], [role=tab], [role=menuitem], label, summary, [onclick]';
+		el = Array.from(document.querySelectorAll(clickable)).find(e => text(e).includes(want)) ||
+			Array.from(document.querySelectorAll("body *")).find(e => e.children.length === 0 && text(e).includes(want));
+	} else {
+		el = document.querySelector(sel);
+	}
+	if (!el) return null;
+	el.scrollIntoView({block: "center", inline: "center"});
+	if (focus) {
+		el.focus();
+		if (clear) {
+			if ("value" in el) {
+				el.value = "";
+				el.dispatchEvent(new Event("input", {bubbles: true}));
+			} else if (el.isContentEditable) {
+				document.execCommand("selectAll");
+				document.execCommand("delete");
+			}
+		}
+	}
+	const r = el.getBoundingClientRect();
+	const label = (el.innerText || el.value || el.getAttribute("aria-label") || el.getAttribute("name") || "").trim().replace(/\s+/g, " ").slice(0, 60);
+	return {x: r.left + r.width / 2, y: r.top + r.height / 2, width: r.width, height: r.height,
+		description: el.tagName.toLowerCase() + (label ? ' "' + label + '"' : "")};
+})`
+
+type element struct {
+	X           float64 `json:"x"`
+	Y           float64 `json:"y"`
+	Width       float64 `json:"width"`
+	Height      float64 `json:"height"`
+	Description string  `json:"description"`
+}
+
+func (p *Page) find(ctx context.Context, selector string, focus, clear bool) (*element, error) {
+	sel, _ := json.Marshal(selector)
+	var el *element
+	expr := fmt.Sprintf("%s(%s, %t, %t)", findElement, sel, focus, clear)
+	if err := p.evaluate(ctx, expr, &el); err != nil {
+		return nil, err
+	}
+	if el == nil {
+		return nil, fmt.Errorf("%w %q", ErrNotFound, selector)
+	}
+	return el, nil
+}
+
+// Click clicks the element for selector with the mouse, waits for any
+// navigation it starts, and describes what it clicked.
+func (p *Page) Click(ctx context.Context, selector string) (string, error) {
+	el, err := p.find(ctx, selector, false, false)
+	if err != nil {
+		return "", err
+	}
+	if el.Width == 0 || el.Height == 0 {
+		return "", fmt.Errorf("%s is not visible", el.Description)
+	}
+	p.drain()
+	for _, typ := range []string{"mouseMoved", "mousePressed", "mouseReleased"} {
+		params := map[string]interface{}{"type": typ, "x": el.X, "y": el.Y}
+		if typ != "mouseMoved" {
+			params["button"] = "left"
+			params["clickCount"] = 1
+		}
+		if err := p.call(ctx, "Input.dispatchMouseEvent", params, nil); err != nil {
+			return "", err
+		}
+	}
+	p.waitLoad(ctx, false)
+	return el.Description, nil
+}
+
+// Type focuses the element for selector and types text into it, replacing
+// its value if clear, then presses Enter if submit.
+func (p *Page) Type(ctx context.Context, selector, text string, clear, submit bool) (string, error) {
+	el, err := p.find(ctx, selector, true, clear)
+	if err != nil {
+		return "", err
+	}
+	if text != "" {
+		if err := p.call(ctx, "Input.insertText", map[string]interface{}{"text": text}, nil); err != nil {
+			return "", err
+		}
+	}
+	if submit {
+		p.drain()
+		for _, typ := range []string{"keyDown", "keyUp"} {
+			params := map[string]interface{}{
+				"type": typ, "key": "Enter", "code": "Enter",
+				"windowsVirtualKeyCode": 13, "nativeVirtualKeyCode": 13,
+			}
+			if typ == "keyDown" {
+				params["text"] = "\r"
+			}
+			if err := p.call(ctx, "Input.dispatchKeyEvent", params, nil); err != nil {
+				return "", err
+			}
+		}
+		p.waitLoad(ctx, false)
+	}
+	return el.Description, nil
+}
+
+// Info returns the page's URL and title.
+func (p *Page) Info(ctx context.Context) (pageURL, title string, err error) {
+	var info [2]string
+	err = p.evaluate(ctx, "[location.href, document.title]", &info)
+	return info[0], info[1], err
+}
+
+// Text returns the visible text of the page, or of the elements matching
+// selector separated by blank lines.
+func (p *Page) Text(ctx context.Context, selector string) (string, error) {
+	if selector == "" {
+		var text string
+		err := p.evaluate(ctx, "document.body ? document.body.innerText : ''", &text)
+		return text, err
+	}
+	sel, _ := json.Marshal(selector)
+	var texts []string
+	expr := fmt.Sprintf("Array.from(document.querySelectorAll(%s)).map(e => e.innerText || e.value || '')", sel)
+	if err := p.evaluate(ctx, expr, &texts); err != nil {
+		return "", err
+	}
+	if len(texts) == 0 {
+		return "", fmt.Errorf("%w %q", ErrNotFound, selector)
+	}
+	return strings.Join(texts, "\n\n"), nil
+}
+
+// Link is a link on the page.
+type Link struct {
+	Text string `json:"text"`
+	URL  string `json:"url"`
+}
+
+// Links returns the page's links, at most limit.
+func (p *Page) Links(ctx context.Context, limit int) ([]Link, error) {
+	var links []Link
+	expr := fmt.Sprintf(`Array.from(document.querySelectorAll("a[href]"))
+		.map(a => ({text: (a.innerText || a.getAttribute("aria-label") || "").trim().replace(/\s+/g, " ").slice(0, 100), url: a.href}))
+		.filter(l => l.url.startsWith("http"))
+		.slice(0, %d)`, limit)
+	err := p.evaluate(ctx, expr, &links)
+	return links, err
+}
+
+// Field is a form control, with a selector that finds it.
+type Field struct {
+	Selector string `json:"selector"`
+	Type     string `json:"type"`
+	Label    string `json:"label,omitempty"`
+	Value    string `json:"value,omitempty"`
+}
+
+// Fields returns the page's visible form controls and buttons, so the
+// caller knows what to type into and click.
+func (p *Page) Fields(ctx context.Context, limit int) ([]Field, error) {
+	var fields []Field
+	expr := fmt.Sprintf(`Array.from(document.querySelectorAll("input, textarea, select, button, [contenteditable=true]"))
+		.filter(e => e.type !== "hidden" && e.getClientRects().length > 0)
+		.slice(0, %d)
+		.map(e => {
+			const tag = e.tagName.toLowerCase();
+			let sel = tag;
+			if (e.id) sel = "#" + CSS.escape(e.id);
+			else if (e.name) sel = tag + "[name=" + JSON.stringify(e.name) + "]";
+			else if (tag === "button" && e.innerText.trim()) sel = "text=" + e.innerText.trim().slice(0, 40);
+			const labelled = e.labels && e.labels.length ? e.labels[0].innerText : "";
+			const label = (labelled || e.getAttribute("aria-label") || e.placeholder || (tag === "button" ? e.innerText : "") || "").trim().replace(/\s+/g, " ").slice(0, 60);
+			const type = tag === "input" ? (e.type || "text") : tag;
+			const value = type === "password" ? "" : String(e.value || "").slice(0, 60);
+			return {selector: sel, type: type, label: label, value: value};
+		})`, limit)
+	err := p.evaluate(ctx, expr, &fields)
+	return fields, err
+}
+
+// Screenshot captures the viewport, or the whole page if fullPage, as PNG.
+func (p *Page) Screenshot(ctx context.Context, fullPage bool) ([]byte, error) {
+	params := map[string]interface{}{"format": "png"}
+	if fullPage {
+		var metrics struct {
+			ContentSize struct {
+				Width  float64 `json:"width"`
+				Height float64 `json:"height"`
+			} `json:"cssContentSize"`
+		}
+		if err := p.call(ctx, "Page.getLayoutMetrics", nil, &metrics); err != nil {
+			return nil, err
+		}
+		params["captureBeyondViewport"] = true
+		params["clip"] = map[string]interface{}{
+			"x": 0, "y": 0, "scale": 1,
+			"width":  metrics.ContentSize.Width,
+			"height": min(metrics.ContentSize.Height, 16000),
+		}
+	}
+	var shot struct {
+		Data string `json:"data"`
+	}
+	if err := p.call(ctx, "Page.captureScreenshot", params, &shot); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(shot.Data)
+}
+
+// Close closes the tab.
+func (p *Page) Close() {
+	p.browser.closePage(p)
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
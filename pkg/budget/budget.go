@@ -0,0 +1,289 @@
+// Package budget tracks the tokens and dollars the model uses per chat and
+// per day, and stops further model calls once a configured budget is used
+// up.
+package budget
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// ErrExceeded is returned by Check once a budget is used up.
+var ErrExceeded = errors.New("budget used up")
+
+// Limits are the budgets; 0 is no limit.
+type Limits struct {
+	SessionTokens int
+	SessionUSD    float64
+	DailyTokens   int
+	DailyUSD      float64
+	WarnPercent   int // warn once usage reaches this share of a limit; 80 if not in 1..99
+}
+
+// Price is what a model costs in US dollars per million tokens.
+type Price struct {
+	Prompt     float64
+	Completion float64
+}
+
+// Spend is what was used in one scope.
+type Spend struct {
+	Tokens int     `json:"tokens"`
+	USD    float64 `json:"usd"`
+}
+
+// state is what the tracker keeps on disk.
+type state struct {
+	Day      string           `json:"day"` // the day Daily counts, e.g. "2026-03-14"
+	Daily    Spend            `json:"daily"`
+	Sessions map[string]Spend `json:"sessions"`
+	Warned   []string         `json:"warned,omitempty"` // scopes already warned about, e.g. "day-usd" or "session-tokens:telegram:123"
+}
+
+// Tracker adds up usage and enforces the limits. A nil *Tracker allows
+// everything, so callers don't need to check whether a budget is set.
+type Tracker struct {
+	path     string
+	mu       sync.Mutex
+	limits   Limits
+	prices   map[string]Price
+	unpriced map[string]bool // models already logged as having no price
+	state    state
+	now      func() time.Time
+}
+
+// New returns a tracker that keeps its totals in path, which is read if it
+// exists.
+func New(path string, limits Limits, prices map[string]Price) *Tracker {
+	t := &Tracker{
+		path:     path,
+		unpriced: make(map[string]bool),
+		state:    state{Sessions: make(map[string]Spend)},
+		now:      time.Now,
+	}
+	if limits.WarnPercent <= 0 || limits.WarnPercent >= 100 {
+		limits.WarnPercent = 80
+	}
+	t.limits, t.prices = limits, prices
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &t.state); err != nil {
+			logger.WarnCF("budget", "Ignoring unreadable budget file",
+				map[string]interface{}{"path": path, "error": err.Error()})
+		}
+		if t.state.Sessions == nil {
+			t.state.Sessions = make(map[string]Spend)
+		}
+	}
+	return t
+}
+
+// Record adds a model call's tokens to the session's and the day's totals
+// and saves them.
+func (t *Tracker) Record(session, model string, promptTokens, completionTokens int) {
+	if t == nil || promptTokens+completionTokens == 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rollover()
+	usd := t.cost(model, promptTokens, completionTokens)
+	add := func(s Spend) Spend {
+		s.Tokens += promptTokens + completionTokens
+		s.USD += usd
+		return s
+	}
+	t.state.Daily = add(t.state.Daily)
+	t.state.Sessions[session] = add(t.state.Sessions[session])
+	if err := t.save(); err != nil {
+		logger.WarnCF("budget", "Failed to save budget totals",
+			map[string]interface{}{"path": t.path, "error": err.Error()})
+	}
+}
+
+// Check returns an error wrapping ErrExceeded if the session's or the day's
+// budget is used up.
+func (t *Tracker) Check(session string) error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rollover()
+	for _, s := range t.scopes(session) {
+		if s.percent() >= 100 {
+			return fmt.Errorf("%w: %s", ErrExceeded, s.describe())
+		}
+	}
+	return nil
+}
+
+// Warning returns a warning the first time the session's or the day's
+// usage reaches the warning share of a limit, and "" otherwise.
+func (t *Tracker) Warning(session string) string {
+	if t == nil {
+		return ""
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rollover()
+	var warnings []string
+	for _, s := range t.scopes(session) {
+		if p := s.percent(); p < t.limits.WarnPercent || p >= 100 || t.warned(s.key) {
+			continue
+		}
+		t.state.Warned = append(t.state.Warned, s.key)
+		warnings = append(warnings, s.describe())
+	}
+	if len(warnings) == 0 {
+		return ""
+	}
+	t.save()
+	return "⚠️ Budget nearly used up: " + strings.Join(warnings, "; ") + ". Replies stop when it runs out."
+}
+
+// Usage returns the session's and the day's totals.
+func (t *Tracker) Usage(session string) (sessionSpend, daily Spend) {
+	if t == nil {
+		return Spend{}, Spend{}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rollover()
+	return t.state.Sessions[session], t.state.Daily
+}
+
+// Describe renders the budgets that are set with the share used, e.g. for
+// /usage, or "" if none are.
+func (t *Tracker) Describe(session string) string {
+	if t == nil {
+		return ""
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rollover()
+	var parts []string
+	for _, s := range t.scopes(session) {
+		parts = append(parts, s.describe())
+	}
+	return strings.Join(parts, "; ")
+}
+
+// scope is one limited total, such as the day's dollars.
+type scope struct {
+	key   string
+	label string
+	used  float64
+	limit float64
+	usd   bool
+}
+
+func (s scope) percent() int {
+	return int(s.used * 100 / s.limit)
+}
+
+func (s scope) describe() string {
+	if s.usd {
+		return fmt.Sprintf("%s $%.2f of $%.2f (%d%%)", s.label, s.used, s.limit, s.percent())
+	}
+	return fmt.Sprintf("%s %s of %s tokens (%d%%)", s.label, formatTokens(int(s.used)), formatTokens(int(s.limit)), s.percent())
+}
+
+// scopes lists the limits that are set, with their usage.
+func (t *Tracker) scopes(session string) []scope {
+	sessionSpend, daily := t.state.Sessions[session], t.state.Daily
+	var scopes []scope
+	if t.limits.SessionTokens > 0 {
+		scopes = append(scopes, scope{"session-tokens:" + session, "this chat", float64(sessionSpend.Tokens), float64(t.limits.SessionTokens), false})
+	}
+	if t.limits.SessionUSD > 0 {
+		scopes = append(scopes, scope{"session-usd:" + session, "this chat", sessionSpend.USD, t.limits.SessionUSD, true})
+	}
+	if t.limits.DailyTokens > 0 {
+		scopes = append(scopes, scope{"day-tokens", "today", float64(daily.Tokens), float64(t.limits.DailyTokens), false})
+	}
+	if t.limits.DailyUSD > 0 {
+		scopes = append(scopes, scope{"day-usd", "today", daily.USD, t.limits.DailyUSD, true})
+	}
+	return scopes
+}
+
+func (t *Tracker) warned(key string) bool {
+	for _, k := range t.state.Warned {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// rollover starts a new day's totals once the date changed.
+func (t *Tracker) rollover() {
+	day := t.now().Format("2006-01-02")
+	if t.state.Day == day {
+		return
+	}
+	t.state.Day = day
+	t.state.Daily = Spend{}
+	warned := t.state.Warned[:0]
+	for _, key := range t.state.Warned {
+		if !strings.HasPrefix(key, "day-") {
+			warned = append(warned, key)
+		}
+	}
+	t.state.Warned = warned
+}
+
+// cost prices a call. Models are looked up by name, then by the part after
+// the last "/", so "openrouter/gpt-4o" finds a price for "gpt-4o".
+func (t *Tracker) cost(model string, promptTokens, completionTokens int) float64 {
+	price, ok := t.prices[model]
+	if !ok {
+		price, ok = t.prices[model[strings.LastIndex(model, "/")+1:]]
+	}
+	if !ok {
+		if !t.unpriced[model] && (t.limits.SessionUSD > 0 || t.limits.DailyUSD > 0) {
+			t.unpriced[model] = true
+			logger.WarnCF("budget", "No price for model; its calls count as free against dollar budgets",
+				map[string]interface{}{"model": model})
+		}
+		return 0
+	}
+	return (float64(promptTokens)*price.Prompt + float64(completionTokens)*price.Completion) / 1e6
+}
+
+func (t *Tracker) save() error {
+	if t.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(t.path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(t.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := t.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, t.path)
+}
+
+// formatTokens renders a token count compactly, e.g. 12.5k or 2.1M.
+func formatTokens(n int) string {
+	switch {
+	case n >= 1_000_000:
+		return fmt.Sprintf("%.1fM", float64(n)/1e6)
+	case n >= 1000:
+		return fmt.Sprintf("%.1fk", float64(n)/1000)
+	}
+	return fmt.Sprint(n)
+}
@@ -0,0 +1,78 @@
+package budget
+
+import (
+	"errors"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestTracker_Limits verifies the warning comes once at the warning share
+// and Check stops once a budget is used up, per chat.
+func TestTracker_Limits(t *testing.T) {
+	tr := New(filepath.Join(t.TempDir(), "budget.json"), Limits{SessionTokens: 1000}, nil)
+
+	tr.Record("a", "m", 700, 100)
+	if w := tr.Warning("a"); !strings.Contains(w, "this chat 800 of 1.0k tokens (80%)") {
+		t.Errorf("Expected a warning at 80%%, got %q", w)
+	}
+	if w := tr.Warning("a"); w != "" {
+		t.Errorf("Expected the warning only once, got %q", w)
+	}
+	if err := tr.Check("a"); err != nil {
+		t.Errorf("Expected the chat to be under budget, got %v", err)
+	}
+
+	tr.Record("a", "m", 150, 50)
+	if err := tr.Check("a"); !errors.Is(err, ErrExceeded) {
+		t.Errorf("Expected the budget to be used up, got %v", err)
+	}
+	if err := tr.Check("b"); err != nil {
+		t.Errorf("Expected another chat to be unaffected, got %v", err)
+	}
+}
+
+// TestTracker_DailyDollars verifies calls are priced by model, the day's
+// total starts over the next day, and totals survive a restart.
+func TestTracker_DailyDollars(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "budget.json")
+	prices := map[string]Price{"gpt-4o": {Prompt: 2.5, Completion: 10}}
+	tr := New(path, Limits{DailyUSD: 1}, prices)
+	day := time.Date(2026, 3, 14, 9, 0, 0, 0, time.Local)
+	tr.now = func() time.Time { return day }
+
+	tr.Record("a", "openrouter/gpt-4o", 200_000, 20_000)
+	tr.Record("b", "unpriced-model", 500_000, 0)
+	if _, daily := tr.Usage("b"); math.Abs(daily.USD-0.7) > 1e-9 || daily.Tokens != 720_000 {
+		t.Errorf("Expected $0.70 and 720k tokens today, got %+v", daily)
+	}
+
+	tr.Record("b", "gpt-4o", 120_000, 0)
+	if err := tr.Check("b"); !errors.Is(err, ErrExceeded) || !strings.Contains(err.Error(), "today $1.00 of $1.00") {
+		t.Errorf("Expected the daily budget to be used up, got %v", err)
+	}
+
+	reloaded := New(path, Limits{DailyUSD: 1}, prices)
+	reloaded.now = tr.now
+	if err := reloaded.Check("c"); !errors.Is(err, ErrExceeded) {
+		t.Errorf("Expected the totals to be read back, got %v", err)
+	}
+	reloaded.now = func() time.Time { return day.Add(24 * time.Hour) }
+	if err := reloaded.Check("c"); err != nil {
+		t.Errorf("Expected a new day to start over, got %v", err)
+	}
+	if session, _ := reloaded.Usage("a"); session.Tokens != 220_000 {
+		t.Errorf("Expected the chat's total to carry over, got %+v", session)
+	}
+}
+
+// TestTracker_Nil verifies a nil tracker allows everything.
+func TestTracker_Nil(t *testing.T) {
+	var tr *Tracker
+	tr.Record("a", "m", 1, 1)
+	if tr.Check("a") != nil || tr.Warning("a") != "" || tr.Describe("a") != "" {
+		t.Error("Expected a nil tracker to have no limits")
+	}
+}
@@ -9,6 +9,7 @@ type MessageBus struct {
 	inbound  chan InboundMessage
 	outbound chan OutboundMessage
 	handlers map[string]MessageHandler
+	watchers map[string]func(Activity) // channel -> activity watcher
 	mu       sync.RWMutex
 }
 
@@ -17,6 +18,7 @@ func NewMessageBus() *MessageBus {
 		inbound:  make(chan InboundMessage, 100),
 		outbound: make(chan OutboundMessage, 100),
 		handlers: make(map[string]MessageHandler),
+		watchers: make(map[string]func(Activity)),
 	}
 }
 
@@ -59,6 +61,28 @@ func (mb *MessageBus) GetHandler(channel string) (MessageHandler, bool) {
 	return handler, ok
 }
 
+// WatchActivity calls watch with the activity in the channel's chats; nil
+// stops watching. watch runs on the agent's goroutine and must not block.
+func (mb *MessageBus) WatchActivity(channel string, watch func(Activity)) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	if watch == nil {
+		delete(mb.watchers, channel)
+		return
+	}
+	mb.watchers[channel] = watch
+}
+
+// PublishActivity passes a to the watcher of its channel, if any.
+func (mb *MessageBus) PublishActivity(a Activity) {
+	mb.mu.RLock()
+	watch := mb.watchers[a.Channel]
+	mb.mu.RUnlock()
+	if watch != nil {
+		watch(a)
+	}
+}
+
 func (mb *MessageBus) Close() {
 	close(mb.inbound)
 	close(mb.outbound)
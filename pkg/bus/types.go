@@ -11,9 +11,67 @@ type InboundMessage struct {
 }
 
 type OutboundMessage struct {
-	Channel string `json:"channel"`
-	ChatID  string `json:"chat_id"`
-	Content string `json:"content"`
+	Channel string   `json:"channel"`
+	ChatID  string   `json:"chat_id"`
+	Content string   `json:"content"`
+	Media   []string `json:"media,omitempty"` // local files to attach, e.g. a voice reply; channels send what they can
+	// Urgency is set on messages the user did not ask for (heartbeat
+	// findings, scheduled jobs, device events). Replies leave it empty and
+	// are always delivered at once; proactive messages may wait out quiet hours.
+	Urgency Urgency `json:"urgency,omitempty"`
+}
+
+// Urgency ranks proactive messages for quiet hours.
+type Urgency string
+
+const (
+	UrgencyLow      Urgency = "low"      // briefings and digests
+	UrgencyNormal   Urgency = "normal"   // routine findings, device events, scheduled jobs
+	UrgencyHigh     Urgency = "high"     // needs attention today
+	UrgencyCritical Urgency = "critical" // cannot wait: severe weather, UPS on battery
+)
+
+// Rank orders urgencies from 1 (low) to 4 (critical); 0 is a reply.
+func (u Urgency) Rank() int {
+	switch u {
+	case UrgencyLow:
+		return 1
+	case UrgencyNormal:
+		return 2
+	case UrgencyHigh:
+		return 3
+	case UrgencyCritical:
+		return 4
+	default:
+		return 0
+	}
+}
+
+// ParseUrgency reads an urgency name; ok is false for anything unknown.
+func ParseUrgency(s string) (Urgency, bool) {
+	u := Urgency(s)
+	return u, u.Rank() > 0
+}
+
+// ActivityKind says what an Activity reports.
+type ActivityKind string
+
+const (
+	ActivityToolStart ActivityKind = "tool_start" // Detail holds the arguments
+	ActivityToolDone  ActivityKind = "tool_done"  // Detail holds the result
+	ActivityApproval  ActivityKind = "approval"   // Detail holds what the tool wants to do
+)
+
+// Activity reports what the agent is doing in a chat, for channels that
+// show it live, such as the web UI. Chat channels get the outcome as
+// messages and need not listen.
+type Activity struct {
+	Channel string       `json:"channel"`
+	ChatID  string       `json:"chat_id"`
+	Kind    ActivityKind `json:"kind"`
+	Tool    string       `json:"tool,omitempty"`
+	Detail  string       `json:"detail,omitempty"`
+	IsError bool         `json:"is_error,omitempty"`
 }
 
 type MessageHandler func(InboundMessage) error
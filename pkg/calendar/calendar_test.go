@@ -0,0 +1,199 @@
+package calendar
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const sample = "BEGIN:VCALENDAR\r\n" +
+	"BEGIN:VEVENT\r\nUID:standup\r\nSUMMARY:Standup\r\n" +
+	"DTSTART;TZID=Etc/GMT+4:20261019T090000\r\nDURATION:PT15M\r\n" +
+	"RRULE:FREQ=WEEKLY;BYDAY=MO,WE,FR;COUNT=6\r\n" +
+	"EXDATE;TZID=Etc/GMT+4:20261021T090000\r\n" +
+	"BEGIN:VALARM\r\nSUMMARY:ignored\r\nEND:VALARM\r\nEND:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\nUID:standup\r\nRECURRENCE-ID;TZID=Etc/GMT+4:20261023T090000\r\n" +
+	"SUMMARY:Standup (moved)\r\nDTSTART;TZID=Etc/GMT+4:20261023T110000\r\nDTEND;TZID=Etc/GMT+4:20261023T111500\r\nEND:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\nUID:trip\r\nSUMMARY:Trip to Lyon\\, France\r\nLOCATION:Lyon\r\n" +
+	"DESCRIPTION:Long description that is folded\r\n  across two lines\r\n" +
+	"DTSTART;VALUE=DATE:20261022\r\nDTEND;VALUE=DATE:20261024\r\nEND:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+// TestExpand verifies recurring events are expanded with exceptions and
+// edited instances, and that all-day events span their dates.
+func TestExpand(t *testing.T) {
+	events, err := Parse(strings.NewReader(sample), time.UTC)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 VEVENTs, got %d", len(events))
+	}
+	if events[2].Summary != "Trip to Lyon, France" || events[2].Description != "Long description that is folded across two lines" {
+		t.Errorf("Expected unescaped, unfolded text, got %q / %q", events[2].Summary, events[2].Description)
+	}
+
+	from := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	got := Expand(events, from, from.AddDate(0, 0, 7))
+	var lines []string
+	for _, e := range got {
+		lines = append(lines, e.Start.UTC().Format("Mon 15:04")+" "+e.Summary)
+	}
+	// Oct 21 is excluded and Oct 23 was moved to 11:00
+	want := []string{
+		"Mon 13:00 Standup",
+		"Thu 00:00 Trip to Lyon, France",
+		"Fri 15:00 Standup (moved)",
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(lines, "\n"))
+	}
+	if trip := got[1]; !trip.AllDay || trip.End.Sub(trip.Start) != 48*time.Hour {
+		t.Errorf("Expected a two-day all-day trip, got %+v", trip)
+	}
+
+	// The excluded instance still counts, so COUNT=6 ends on Fri Oct 30
+	later := Expand(events, from.AddDate(0, 0, 7), from.AddDate(0, 0, 21))
+	if len(later) != 3 || later[2].Start.Day() != 30 {
+		t.Errorf("Expected the series to end on Oct 30, got %d instances", len(later))
+	}
+}
+
+// TestFile_CreateRoundTrip verifies events added to an .ics file are read
+// back, including into a file that does not exist yet.
+func TestFile_CreateRoundTrip(t *testing.T) {
+	cal := NewFile("home", filepath.Join(t.TempDir(), "home.ics"), time.UTC, false)
+	start := time.Date(2026, 10, 22, 14, 0, 0, 0, time.UTC)
+	for i, summary := range []string{"Dentist; bring forms", "Call mom"} {
+		e := Event{UID: fmt.Sprintf("e%d", i), Summary: summary, Start: start.Add(time.Duration(i) * time.Hour), End: start.Add(time.Duration(i)*time.Hour + 30*time.Minute)}
+		if err := cal.Create(context.Background(), e); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+	}
+	events, err := cal.Events(context.Background(), start.Add(-time.Hour), start.Add(24*time.Hour))
+	if err != nil || len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d (%v)", len(events), err)
+	}
+	if events[0].Summary != "Dentist; bring forms" || events[0].Calendar != "home" {
+		t.Errorf("Expected the first event back from the home calendar, got %+v", events[0])
+	}
+
+	readOnly := NewFile("holidays", filepath.Join(t.TempDir(), "h.ics"), time.UTC, true)
+	if err := readOnly.Create(context.Background(), Event{UID: "x"}); err != ErrReadOnly {
+		t.Errorf("Expected ErrReadOnly, got %v", err)
+	}
+}
+
+// TestCalDAV verifies the REPORT query and PUT of a CalDAV calendar.
+func TestCalDAV(t *testing.T) {
+	var put string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "me" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		switch r.Method {
+		case "REPORT":
+			if !strings.Contains(string(body), `<c:time-range start="20261019T000000Z"`) {
+				t.Errorf("Expected a time-range filter, got %s", body)
+			}
+			w.WriteHeader(http.StatusMultiStatus)
+			fmt.Fprintf(w, `<?xml version="1.0"?><d:multistatus xmlns:d="DAV:" xmlns:cal="urn:ietf:params:xml:ns:caldav">
+<d:response><d:href>/cal/standup.ics</d:href><d:propstat><d:prop><cal:calendar-data>%s</cal:calendar-data></d:prop></d:propstat></d:response>
+</d:multistatus>`, strings.ReplaceAll(sample, "&", "&amp;"))
+		case "PUT":
+			if r.URL.Path != "/cal/new-1.ics" || r.Header.Get("If-None-Match") != "*" {
+				t.Errorf("Expected a new resource at /cal/new-1.ics, got %s", r.URL.Path)
+			}
+			put = string(body)
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer server.Close()
+
+	cal := NewCalDAV("work", server.URL+"/cal", "me", "secret", time.UTC, false)
+	from := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	events, err := cal.Events(context.Background(), from, from.AddDate(0, 0, 7))
+	if err != nil || len(events) != 3 || events[0].Calendar != "work" {
+		t.Fatalf("Expected 3 events from the work calendar, got %d (%v)", len(events), err)
+	}
+
+	e := Event{UID: "new-1", Summary: "Review", Start: from.Add(10 * time.Hour), End: from.Add(11 * time.Hour)}
+	if err := cal.Create(context.Background(), e); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if !strings.Contains(put, "DTSTART:20261019T100000Z\r\n") || !strings.Contains(put, "SUMMARY:Review\r\n") {
+		t.Errorf("Expected the event in iCalendar form, got %q", put)
+	}
+
+	bad := NewCalDAV("work", server.URL+"/cal", "me", "wrong", time.UTC, false)
+	if _, err := bad.Events(context.Background(), from, from.AddDate(0, 0, 1)); err == nil || !strings.Contains(err.Error(), "credentials") {
+		t.Errorf("Expected a credentials error, got %v", err)
+	}
+}
+
+// TestCalDAVTodos verifies VTODOs are read from a task list, and written
+// back to their resource.
+func TestCalDAVTodos(t *testing.T) {
+	const todos = "BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nUID:milk\r\nSUMMARY:Buy milk\\; oat\r\nDUE;VALUE=DATE:20261020\r\nPRIORITY:1\r\n" +
+		"BEGIN:VALARM\r\nDESCRIPTION:ignored\r\nEND:VALARM\r\nEND:VTODO\r\nEND:VCALENDAR\r\n"
+	const done = "BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nUID:taxes\r\nSUMMARY:Taxes\r\nDUE:20261019T150000Z\r\nSTATUS:COMPLETED\r\nEND:VTODO\r\nEND:VCALENDAR\r\n"
+	var put, deleted string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		switch r.Method {
+		case "REPORT":
+			if !strings.Contains(string(body), `<c:comp-filter name="VTODO"/>`) {
+				t.Errorf("Expected a VTODO query, got %s", body)
+			}
+			w.WriteHeader(http.StatusMultiStatus)
+			fmt.Fprintf(w, `<?xml version="1.0"?><d:multistatus xmlns:d="DAV:" xmlns:cal="urn:ietf:params:xml:ns:caldav">
+<d:response><d:href>/tasks/milk.ics</d:href><d:propstat><d:prop><cal:calendar-data>%s</cal:calendar-data></d:prop></d:propstat></d:response>
+<d:response><d:href>/tasks/taxes.ics</d:href><d:propstat><d:prop><cal:calendar-data>%s</cal:calendar-data></d:prop></d:propstat></d:response>
+</d:multistatus>`, todos, done)
+		case "PUT":
+			if r.URL.Path != "/tasks/milk.ics" {
+				t.Errorf("Expected the todo's own resource, got %s", r.URL.Path)
+			}
+			put = string(body)
+			w.WriteHeader(http.StatusNoContent)
+		case "DELETE":
+			deleted = r.URL.Path
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	list := NewCalDAV("tasks", server.URL+"/tasks", "", "", time.UTC, false)
+	got, err := list.Todos(context.Background())
+	if err != nil || len(got) != 2 {
+		t.Fatalf("Expected 2 todos, got %d (%v)", len(got), err)
+	}
+	milk := got[0]
+	if milk.Summary != "Buy milk; oat" || !milk.DueDate || !milk.Due.Equal(time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC)) ||
+		milk.Priority != 1 || milk.Completed || milk.Href != server.URL+"/tasks/milk.ics" {
+		t.Errorf("Unexpected todo %+v", milk)
+	}
+	if !got[1].Completed || got[1].DueDate {
+		t.Errorf("Expected a completed todo due at a time, got %+v", got[1])
+	}
+
+	milk.Completed = true
+	if href, err := list.PutTodo(context.Background(), milk); err != nil || href != milk.Href {
+		t.Fatalf("PutTodo failed: %q %v", href, err)
+	}
+	if !strings.Contains(put, "UID:milk\r\n") || !strings.Contains(put, "DUE;VALUE=DATE:20261020\r\n") ||
+		!strings.Contains(put, "STATUS:COMPLETED\r\n") || !strings.Contains(put, "SUMMARY:Buy milk\\; oat\r\n") {
+		t.Errorf("Expected the completed todo in iCalendar form, got %q", put)
+	}
+	if err := list.DeleteTodo(context.Background(), milk.Href); err != nil || deleted != "/tasks/milk.ics" {
+		t.Errorf("Expected a deleted todo that is already gone to be fine, got %v", err)
+	}
+}
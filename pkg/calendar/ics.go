@@ -0,0 +1,312 @@
+// Package calendar reads and writes events in iCalendar (RFC 5545) form,
+// from local .ics files and CalDAV servers, and expands recurring events
+// into the instances that fall in a time window.
+package calendar
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event is one event, or one instance of a recurring event after Expand.
+type Event struct {
+	UID         string
+	Summary     string
+	Description string
+	Location    string
+	Start, End  time.Time
+	AllDay      bool
+	Calendar    string // name of the calendar it came from
+
+	rule         *recurrence
+	exdates      []time.Time
+	recurrenceID time.Time // set on an edited instance of a recurring event
+}
+
+// Parse reads the VEVENTs of an iCalendar stream. Times without a zone,
+// and dates of all-day events, are taken to be in loc.
+func Parse(r io.Reader, loc *time.Location) ([]Event, error) {
+	var events []Event
+	var current *Event
+	depth := 0 // nesting inside the VEVENT, e.g. VALARM
+	for _, line := range unfold(r) {
+		name, params, value := splitProperty(line)
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			current = &Event{}
+			depth = 0
+			continue
+		case current == nil:
+			continue
+		case name == "BEGIN":
+			depth++
+			continue
+		case name == "END" && value == "VEVENT":
+			if current.End.IsZero() {
+				current.End = current.Start
+				if current.AllDay {
+					current.End = current.Start.AddDate(0, 0, 1)
+				}
+			}
+			if !current.Start.IsZero() {
+				events = append(events, *current)
+			}
+			current = nil
+			continue
+		case name == "END":
+			depth--
+			continue
+		case depth > 0:
+			continue
+		}
+
+		switch name {
+		case "UID":
+			current.UID = value
+		case "SUMMARY":
+			current.Summary = unescape(value)
+		case "DESCRIPTION":
+			current.Description = unescape(value)
+		case "LOCATION":
+			current.Location = unescape(value)
+		case "DTSTART":
+			t, allDay, err := parseTime(value, params, loc)
+			if err != nil {
+				return nil, fmt.Errorf("bad DTSTART %q: %w", value, err)
+			}
+			current.Start, current.AllDay = t, allDay
+		case "DTEND":
+			if t, _, err := parseTime(value, params, loc); err == nil {
+				current.End = t
+			}
+		case "DURATION":
+			if d, err := parseDuration(value); err == nil && !current.Start.IsZero() {
+				current.End = current.Start.Add(d)
+			}
+		case "RRULE":
+			rule, err := parseRule(value, loc)
+			if err != nil {
+				return nil, fmt.Errorf("bad RRULE %q: %w", value, err)
+			}
+			current.rule = rule
+		case "EXDATE":
+			for _, v := range strings.Split(value, ",") {
+				if t, _, err := parseTime(v, params, loc); err == nil {
+					current.exdates = append(current.exdates, t)
+				}
+			}
+		case "RECURRENCE-ID":
+			if t, _, err := parseTime(value, params, loc); err == nil {
+				current.recurrenceID = t
+			}
+		}
+	}
+	return events, nil
+}
+
+// Expand returns the events and instances of recurring events that overlap
+// [from, to), sorted by start. Edited instances replace the ones they edit.
+func Expand(events []Event, from, to time.Time) []Event {
+	edited := map[string]bool{}
+	for _, e := range events {
+		if !e.recurrenceID.IsZero() {
+			edited[e.UID+"@"+e.recurrenceID.UTC().Format(time.RFC3339)] = true
+		}
+	}
+
+	var out []Event
+	for _, e := range events {
+		if e.rule == nil || !e.recurrenceID.IsZero() {
+			if e.Start.Before(to) && e.End.After(from) || e.Start.Equal(from) {
+				out = append(out, e)
+			}
+			continue
+		}
+		length := e.End.Sub(e.Start)
+		e.rule.each(e.Start, to, func(start time.Time) {
+			if edited[e.UID+"@"+start.UTC().Format(time.RFC3339)] || e.excluded(start) {
+				return
+			}
+			if end := start.Add(length); start.Before(to) && (end.After(from) || start.Equal(from)) {
+				instance := e
+				instance.Start, instance.End = start, end
+				instance.rule = nil
+				out = append(out, instance)
+			}
+		})
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Start.Before(out[j].Start) })
+	return out
+}
+
+func (e Event) excluded(start time.Time) bool {
+	for _, ex := range e.exdates {
+		if ex.Equal(start) || (e.AllDay && sameDate(ex, start)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Marshal renders the event as a complete iCalendar object, as stored in a
+// CalDAV resource.
+func Marshal(e Event) string {
+	var sb strings.Builder
+	sb.WriteString("BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//picoclaw//calendar//EN\r\n")
+	sb.WriteString(marshalEvent(e))
+	sb.WriteString("END:VCALENDAR\r\n")
+	return sb.String()
+}
+
+// marshalEvent renders the VEVENT block of e.
+func marshalEvent(e Event) string {
+	var sb strings.Builder
+	sb.WriteString("BEGIN:VEVENT\r\n")
+	fmt.Fprintf(&sb, "UID:%s\r\n", e.UID)
+	fmt.Fprintf(&sb, "DTSTAMP:%s\r\n", time.Now().UTC().Format("20060102T150405Z"))
+	if e.AllDay {
+		fmt.Fprintf(&sb, "DTSTART;VALUE=DATE:%s\r\n", e.Start.Format("20060102"))
+		fmt.Fprintf(&sb, "DTEND;VALUE=DATE:%s\r\n", e.End.Format("20060102"))
+	} else {
+		fmt.Fprintf(&sb, "DTSTART:%s\r\n", e.Start.UTC().Format("20060102T150405Z"))
+		fmt.Fprintf(&sb, "DTEND:%s\r\n", e.End.UTC().Format("20060102T150405Z"))
+	}
+	fmt.Fprintf(&sb, "SUMMARY:%s\r\n", escape(e.Summary))
+	if e.Location != "" {
+		fmt.Fprintf(&sb, "LOCATION:%s\r\n", escape(e.Location))
+	}
+	if e.Description != "" {
+		fmt.Fprintf(&sb, "DESCRIPTION:%s\r\n", escape(e.Description))
+	}
+	sb.WriteString("END:VEVENT\r\n")
+	return sb.String()
+}
+
+// unfold reads content lines, joining continuation lines that start with
+// a space or tab.
+func unfold(r io.Reader) []string {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// splitProperty splits "NAME;PARAM=V:VALUE" into its parts. Colons inside
+// quoted parameter values don't end the name.
+func splitProperty(line string) (string, map[string]string, string) {
+	inQuotes := false
+	colon := -1
+	for i, c := range line {
+		if c == '"' {
+			inQuotes = !inQuotes
+		} else if c == ':' && !inQuotes {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return strings.ToUpper(line), nil, ""
+	}
+	parts := strings.Split(line[:colon], ";")
+	params := map[string]string{}
+	for _, p := range parts[1:] {
+		if k, v, ok := strings.Cut(p, "="); ok {
+			params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+		}
+	}
+	return strings.ToUpper(parts[0]), params, line[colon+1:]
+}
+
+// parseTime parses a DATE or DATE-TIME value, honouring TZID. Unknown zone
+// names (e.g. Windows names from Exchange) fall back to loc.
+func parseTime(value string, params map[string]string, loc *time.Location) (time.Time, bool, error) {
+	value = strings.TrimSpace(value)
+	if params["VALUE"] == "DATE" || len(value) == 8 {
+		t, err := time.ParseInLocation("20060102", value, loc)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		return t, false, err
+	}
+	zone := loc
+	if tzid := params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			zone = l
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, zone)
+	return t, false, err
+}
+
+// parseDuration parses an iCalendar duration such as "PT1H30M" or "P1D".
+func parseDuration(value string) (time.Duration, error) {
+	neg := strings.HasPrefix(value, "-")
+	value = strings.TrimLeft(value, "+-")
+	if !strings.HasPrefix(value, "P") {
+		return 0, fmt.Errorf("duration must start with P")
+	}
+	var d time.Duration
+	num := ""
+	for _, c := range value[1:] {
+		if c >= '0' && c <= '9' {
+			num += string(c)
+			continue
+		}
+		if c == 'T' {
+			continue
+		}
+		n, err := strconv.Atoi(num)
+		if err != nil {
+			return 0, fmt.Errorf("bad duration %q", value)
+		}
+		num = ""
+		switch c {
+		case 'W':
+			d += time.Duration(n) * 7 * 24 * time.Hour
+		case 'D':
+			d += time.Duration(n) * 24 * time.Hour
+		case 'H':
+			d += time.Duration(n) * time.Hour
+		case 'M':
+			d += time.Duration(n) * time.Minute
+		case 'S':
+			d += time.Duration(n) * time.Second
+		default:
+			return 0, fmt.Errorf("bad duration %q", value)
+		}
+	}
+	if neg {
+		d = -d
+	}
+	return d, nil
+}
+
+func unescape(s string) string {
+	return strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(s)
+}
+
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, ",", `\,`, ";", `\;`).Replace(s)
+}
+
+func sameDate(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
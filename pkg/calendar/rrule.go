@@ -0,0 +1,142 @@
+package calendar
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxInstances bounds the expansion of one recurring event.
+const maxInstances = 5000
+
+// recurrence is the subset of RRULE that calendars commonly use: FREQ,
+// INTERVAL, COUNT, UNTIL and, for weekly rules, BYDAY.
+type recurrence struct {
+	freq     string
+	interval int
+	count    int
+	until    time.Time
+	byDay    []time.Weekday
+}
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+func parseRule(value string, loc *time.Location) (*recurrence, error) {
+	rule := &recurrence{interval: 1}
+	for _, part := range strings.Split(value, ";") {
+		key, val, _ := strings.Cut(part, "=")
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			rule.freq = strings.ToUpper(val)
+		case "INTERVAL":
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("bad INTERVAL %q", val)
+			}
+			rule.interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("bad COUNT %q", val)
+			}
+			rule.count = n
+		case "UNTIL":
+			t, _, err := parseTime(val, nil, loc)
+			if err != nil {
+				return nil, fmt.Errorf("bad UNTIL %q", val)
+			}
+			rule.until = t
+		case "BYDAY":
+			for _, d := range strings.Split(val, ",") {
+				// Ordinals such as 2MO only apply to monthly rules, which
+				// repeat on the start's day of the month here
+				d = strings.TrimLeft(d, "+-0123456789")
+				if wd, ok := weekdays[strings.ToUpper(d)]; ok {
+					rule.byDay = append(rule.byDay, wd)
+				}
+			}
+		}
+	}
+	switch rule.freq {
+	case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+		return rule, nil
+	}
+	return nil, fmt.Errorf("unsupported FREQ %q", rule.freq)
+}
+
+// each calls fn with the start of every instance from start until before
+// the given time, the rule's COUNT or its UNTIL, whichever comes first.
+func (r *recurrence) each(start, before time.Time, fn func(time.Time)) {
+	n := 0
+	emit := func(t time.Time) bool {
+		if !r.until.IsZero() && t.After(r.until) || !t.Before(before) {
+			return false
+		}
+		if r.count > 0 && n >= r.count {
+			return false
+		}
+		n++
+		fn(t)
+		return true
+	}
+
+	if r.freq == "WEEKLY" && len(r.byDay) > 0 {
+		// Walk week by week from the Sunday of the start's week
+		weekStart := start.AddDate(0, 0, -int(start.Weekday()))
+		for week := 0; n < maxInstances; week += r.interval {
+			base := weekStart.AddDate(0, 0, 7*week)
+			if !base.Before(before) {
+				return
+			}
+			for day := time.Sunday; day <= time.Saturday; day++ {
+				if !hasDay(r.byDay, day) {
+					continue
+				}
+				t := base.AddDate(0, 0, int(day))
+				if t.Before(start) {
+					continue
+				}
+				if !emit(t) {
+					return
+				}
+			}
+		}
+		return
+	}
+
+	for i := 0; n < maxInstances; i += r.interval {
+		var t time.Time
+		switch r.freq {
+		case "DAILY":
+			t = start.AddDate(0, 0, i)
+		case "WEEKLY":
+			t = start.AddDate(0, 0, 7*i)
+		case "MONTHLY":
+			t = start.AddDate(0, i, 0)
+			if t.Day() != start.Day() {
+				continue // no 31st this month
+			}
+		case "YEARLY":
+			t = start.AddDate(i, 0, 0)
+			if t.Day() != start.Day() {
+				continue // no Feb 29 this year
+			}
+		}
+		if !emit(t) {
+			return
+		}
+	}
+}
+
+func hasDay(days []time.Weekday, day time.Weekday) bool {
+	for _, d := range days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
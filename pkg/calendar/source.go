@@ -0,0 +1,221 @@
+package calendar
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrReadOnly is returned when creating an event in a read-only calendar.
+var ErrReadOnly = errors.New("calendar is read-only")
+
+// Source is a calendar events are read from and added to.
+type Source interface {
+	Name() string
+	ReadOnly() bool
+	// Events returns the events overlapping [from, to), recurring events
+	// expanded, sorted by start.
+	Events(ctx context.Context, from, to time.Time) ([]Event, error)
+	Create(ctx context.Context, e Event) error
+}
+
+// File is a calendar kept in a local .ics file.
+type File struct {
+	name     string
+	path     string
+	loc      *time.Location
+	readOnly bool
+	mu       sync.Mutex
+}
+
+// NewFile returns a calendar backed by the .ics file at path. Floating
+// times in the file are taken to be in loc.
+func NewFile(name, path string, loc *time.Location, readOnly bool) *File {
+	return &File{name: name, path: path, loc: loc, readOnly: readOnly}
+}
+
+func (f *File) Name() string   { return f.name }
+func (f *File) ReadOnly() bool { return f.readOnly }
+
+func (f *File) Events(ctx context.Context, from, to time.Time) ([]Event, error) {
+	f.mu.Lock()
+	data, err := os.ReadFile(f.path)
+	f.mu.Unlock()
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	events, err := Parse(bytes.NewReader(data), f.loc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", f.path, err)
+	}
+	return tag(Expand(events, from, to), f.name), nil
+}
+
+// Create adds the event to the file, creating the file if needed.
+func (f *File) Create(ctx context.Context, e Event) error {
+	if f.readOnly {
+		return ErrReadOnly
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, err := os.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return os.WriteFile(f.path, []byte(Marshal(e)), 0644)
+	}
+	if err != nil {
+		return err
+	}
+	content := string(data)
+	end := strings.LastIndex(content, "END:VCALENDAR")
+	if end < 0 {
+		return fmt.Errorf("%s is not an iCalendar file", f.path)
+	}
+	content = content[:end] + marshalEvent(e) + content[end:]
+	return os.WriteFile(f.path, []byte(content), 0644)
+}
+
+// CalDAV is a calendar collection on a CalDAV server (Nextcloud, Radicale,
+// iCloud, Fastmail, ...).
+type CalDAV struct {
+	name     string
+	url      string // of the calendar collection
+	username string
+	password string
+	loc      *time.Location
+	readOnly bool
+	client   *http.Client
+}
+
+// NewCalDAV returns a calendar backed by the collection at url.
+func NewCalDAV(name, url, username, password string, loc *time.Location, readOnly bool) *CalDAV {
+	return &CalDAV{
+		name:     name,
+		url:      strings.TrimRight(url, "/") + "/",
+		username: username,
+		password: password,
+		loc:      loc,
+		readOnly: readOnly,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (c *CalDAV) Name() string   { return c.name }
+func (c *CalDAV) ReadOnly() bool { return c.readOnly }
+
+// multistatus is the part of a WebDAV REPORT response we use.
+type multistatus struct {
+	Responses []struct {
+		Propstat []struct {
+			CalendarData string `xml:"prop>calendar-data"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+// Events runs a calendar-query REPORT for the window. The server filters
+// recurring events by their instances but returns the whole series, which
+// is expanded here.
+func (c *CalDAV) Events(ctx context.Context, from, to time.Time) ([]Event, error) {
+	body := fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop><c:calendar-data/></d:prop>
+  <c:filter>
+    <c:comp-filter name="VCALENDAR">
+      <c:comp-filter name="VEVENT">
+        <c:time-range start="%s" end="%s"/>
+      </c:comp-filter>
+    </c:comp-filter>
+  </c:filter>
+</c:calendar-query>`, from.UTC().Format("20060102T150405Z"), to.UTC().Format("20060102T150405Z"))
+
+	resp, err := c.do(ctx, "REPORT", c.url, "application/xml; charset=utf-8", body, map[string]string{"Depth": "1"})
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusMultiStatus && resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("CalDAV REPORT returned status %d", resp.StatusCode)
+	}
+	var ms multistatus
+	if err := xml.Unmarshal(resp.Body, &ms); err != nil {
+		return nil, fmt.Errorf("failed to parse CalDAV response: %w", err)
+	}
+	var events []Event
+	for _, r := range ms.Responses {
+		for _, ps := range r.Propstat {
+			if ps.CalendarData == "" {
+				continue
+			}
+			parsed, err := Parse(strings.NewReader(ps.CalendarData), c.loc)
+			if err != nil {
+				continue // one broken event shouldn't hide the rest
+			}
+			events = append(events, parsed...)
+		}
+	}
+	return tag(Expand(events, from, to), c.name), nil
+}
+
+// Create stores the event as a new resource named after its UID.
+func (c *CalDAV) Create(ctx context.Context, e Event) error {
+	if c.readOnly {
+		return ErrReadOnly
+	}
+	resp, err := c.do(ctx, "PUT", c.url+e.UID+".ics", "text/calendar; charset=utf-8", Marshal(e), map[string]string{"If-None-Match": "*"})
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("CalDAV PUT returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(resp.Body)))
+	}
+	return nil
+}
+
+// davResponse is a response with its body read.
+type davResponse struct {
+	StatusCode int
+	Body       []byte
+}
+
+func (c *CalDAV) do(ctx context.Context, method, url, contentType, body string, headers map[string]string) (*davResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("CalDAV request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CalDAV response: %w", err)
+	}
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return nil, fmt.Errorf("CalDAV server refused the credentials (status %d)", resp.StatusCode)
+	}
+	return &davResponse{StatusCode: resp.StatusCode, Body: data}, nil
+}
+
+func tag(events []Event, calendar string) []Event {
+	for i := range events {
+		events[i].Calendar = calendar
+	}
+	return events
+}
@@ -0,0 +1,231 @@
+package calendar
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Todo is a task from an iCalendar VTODO, as kept in CalDAV task lists.
+type Todo struct {
+	UID         string
+	Summary     string
+	Description string
+	Due         time.Time // zero if none
+	DueDate     bool      // Due is a date, without a time of day
+	Priority    int       // 1 (highest) to 9 (lowest); 0 if undefined
+	Completed   bool
+	Href        string // of the CalDAV resource, when read from a server
+}
+
+// ParseTodos reads the VTODOs of an iCalendar stream. Times without a
+// zone, and due dates, are taken to be in loc.
+func ParseTodos(r io.Reader, loc *time.Location) ([]Todo, error) {
+	var todos []Todo
+	var current *Todo
+	depth := 0 // nesting inside the VTODO, e.g. VALARM
+	for _, line := range unfold(r) {
+		name, params, value := splitProperty(line)
+		switch {
+		case name == "BEGIN" && value == "VTODO":
+			current = &Todo{}
+			depth = 0
+			continue
+		case current == nil:
+			continue
+		case name == "BEGIN":
+			depth++
+			continue
+		case name == "END" && value == "VTODO":
+			todos = append(todos, *current)
+			current = nil
+			continue
+		case name == "END":
+			depth--
+			continue
+		case depth > 0:
+			continue
+		}
+
+		switch name {
+		case "UID":
+			current.UID = value
+		case "SUMMARY":
+			current.Summary = unescape(value)
+		case "DESCRIPTION":
+			current.Description = unescape(value)
+		case "DUE":
+			t, date, err := parseTime(value, params, loc)
+			if err != nil {
+				return nil, fmt.Errorf("bad DUE %q: %w", value, err)
+			}
+			current.Due, current.DueDate = t, date
+		case "PRIORITY":
+			current.Priority, _ = strconv.Atoi(strings.TrimSpace(value))
+		case "STATUS":
+			current.Completed = current.Completed || strings.EqualFold(value, "COMPLETED")
+		case "COMPLETED":
+			current.Completed = true
+		}
+	}
+	return todos, nil
+}
+
+// MarshalTodo renders the todo as a complete iCalendar object, as stored
+// in a CalDAV resource.
+func MarshalTodo(t Todo) string {
+	var sb strings.Builder
+	now := time.Now().UTC().Format("20060102T150405Z")
+	sb.WriteString("BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//picoclaw//tasks//EN\r\n")
+	sb.WriteString("BEGIN:VTODO\r\n")
+	fmt.Fprintf(&sb, "UID:%s\r\n", t.UID)
+	fmt.Fprintf(&sb, "DTSTAMP:%s\r\n", now)
+	fmt.Fprintf(&sb, "SUMMARY:%s\r\n", escape(t.Summary))
+	if t.Description != "" {
+		fmt.Fprintf(&sb, "DESCRIPTION:%s\r\n", escape(t.Description))
+	}
+	if !t.Due.IsZero() {
+		if t.DueDate {
+			fmt.Fprintf(&sb, "DUE;VALUE=DATE:%s\r\n", t.Due.Format("20060102"))
+		} else {
+			fmt.Fprintf(&sb, "DUE:%s\r\n", t.Due.UTC().Format("20060102T150405Z"))
+		}
+	}
+	if t.Priority > 0 {
+		fmt.Fprintf(&sb, "PRIORITY:%d\r\n", t.Priority)
+	}
+	if t.Completed {
+		fmt.Fprintf(&sb, "STATUS:COMPLETED\r\nCOMPLETED:%s\r\nPERCENT-COMPLETE:100\r\n", now)
+	} else {
+		sb.WriteString("STATUS:NEEDS-ACTION\r\n")
+	}
+	sb.WriteString("END:VTODO\r\nEND:VCALENDAR\r\n")
+	return sb.String()
+}
+
+// todoMultistatus is the part of a VTODO REPORT response we use.
+type todoMultistatus struct {
+	Responses []struct {
+		Href     string `xml:"href"`
+		Propstat []struct {
+			CalendarData string `xml:"prop>calendar-data"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+// Todos returns the todos of the collection, completed ones included;
+// servers differ in how well they filter on status.
+func (c *CalDAV) Todos(ctx context.Context) ([]Todo, error) {
+	body := `<?xml version="1.0" encoding="utf-8"?>
+<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop><c:calendar-data/></d:prop>
+  <c:filter>
+    <c:comp-filter name="VCALENDAR">
+      <c:comp-filter name="VTODO"/>
+    </c:comp-filter>
+  </c:filter>
+</c:calendar-query>`
+	resp, err := c.do(ctx, "REPORT", c.url, "application/xml; charset=utf-8", body, map[string]string{"Depth": "1"})
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusMultiStatus && resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("CalDAV REPORT returned status %d", resp.StatusCode)
+	}
+	var ms todoMultistatus
+	if err := xml.Unmarshal(resp.Body, &ms); err != nil {
+		return nil, fmt.Errorf("failed to parse CalDAV response: %w", err)
+	}
+	var todos []Todo
+	for _, r := range ms.Responses {
+		for _, ps := range r.Propstat {
+			if ps.CalendarData == "" {
+				continue
+			}
+			parsed, err := ParseTodos(strings.NewReader(ps.CalendarData), c.loc)
+			if err != nil {
+				continue // one broken todo shouldn't hide the rest
+			}
+			for i := range parsed {
+				parsed[i].Href = c.resolve(r.Href)
+			}
+			todos = append(todos, parsed...)
+		}
+	}
+	return todos, nil
+}
+
+// Todo reads the todo at href.
+func (c *CalDAV) Todo(ctx context.Context, href string) (Todo, error) {
+	resp, err := c.do(ctx, "GET", href, "text/plain", "", nil)
+	if err != nil {
+		return Todo{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Todo{}, fmt.Errorf("CalDAV GET returned status %d", resp.StatusCode)
+	}
+	todos, err := ParseTodos(strings.NewReader(string(resp.Body)), c.loc)
+	if err != nil {
+		return Todo{}, err
+	}
+	if len(todos) == 0 {
+		return Todo{}, fmt.Errorf("%s holds no task", href)
+	}
+	todos[0].Href = href
+	return todos[0], nil
+}
+
+// PutTodo stores the todo at its Href, or as a new resource named after
+// its UID, and returns where it was stored.
+func (c *CalDAV) PutTodo(ctx context.Context, t Todo) (string, error) {
+	if c.readOnly {
+		return "", ErrReadOnly
+	}
+	href := t.Href
+	if href == "" {
+		href = c.url + url.PathEscape(t.UID) + ".ics"
+	}
+	resp, err := c.do(ctx, "PUT", href, "text/calendar; charset=utf-8", MarshalTodo(t), nil)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("CalDAV PUT returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(resp.Body)))
+	}
+	return href, nil
+}
+
+// DeleteTodo removes the resource at href. One that is already gone is
+// not an error.
+func (c *CalDAV) DeleteTodo(ctx context.Context, href string) error {
+	if c.readOnly {
+		return ErrReadOnly
+	}
+	resp, err := c.do(ctx, "DELETE", href, "text/plain", "", nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("CalDAV DELETE returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// resolve makes href, often a path, absolute against the collection URL.
+func (c *CalDAV) resolve(href string) string {
+	base, err := url.Parse(c.url)
+	if err != nil || href == "" {
+		return href
+	}
+	ref, err := url.Parse(href)
+	if err != nil {
+		return href
+	}
+	return base.ResolveReference(ref).String()
+}
@@ -2,8 +2,10 @@ package channels
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 )
@@ -22,7 +24,9 @@ type BaseChannel struct {
 	bus       *bus.MessageBus
 	running   bool
 	name      string
+	allowMu   sync.RWMutex
 	allowList []string
+	guard     *inboundGuard
 }
 
 func NewBaseChannel(name string, config interface{}, bus *bus.MessageBus, allowList []string) *BaseChannel {
@@ -32,6 +36,7 @@ func NewBaseChannel(name string, config interface{}, bus *bus.MessageBus, allowL
 		name:      name,
 		allowList: allowList,
 		running:   false,
+		guard:     newInboundGuard(defaultInboundLimits),
 	}
 }
 
@@ -43,8 +48,27 @@ func (c *BaseChannel) IsRunning() bool {
 	return c.running
 }
 
+// SetAllowList replaces the senders the channel accepts; an empty list
+// accepts everyone. It is applied when the config is reloaded.
+func (c *BaseChannel) SetAllowList(allowList []string) error {
+	c.allowMu.Lock()
+	defer c.allowMu.Unlock()
+	c.allowList = allowList
+	return nil
+}
+
+// HasAllowList reports whether the channel only accepts listed senders.
+func (c *BaseChannel) HasAllowList() bool {
+	c.allowMu.RLock()
+	defer c.allowMu.RUnlock()
+	return len(c.allowList) > 0
+}
+
 func (c *BaseChannel) IsAllowed(senderID string) bool {
-	if len(c.allowList) == 0 {
+	c.allowMu.RLock()
+	allowList := c.allowList
+	c.allowMu.RUnlock()
+	if len(allowList) == 0 {
 		return true
 	}
 
@@ -56,7 +80,7 @@ func (c *BaseChannel) IsAllowed(senderID string) bool {
 		userPart = senderID[idx+1:]
 	}
 
-	for _, allowed := range c.allowList {
+	for _, allowed := range allowList {
 		// Strip leading "@" from allowed value for username matching
 		trimmed := strings.TrimPrefix(allowed, "@")
 		allowedID := trimmed
@@ -106,3 +130,32 @@ func (c *BaseChannel) HandleMessage(senderID, chatID, content string, media []st
 func (c *BaseChannel) setRunning(running bool) {
 	c.running = running
 }
+
+// PermanentError marks a send failure that retrying cannot fix, such as an
+// invalid chat ID or a user who blocked the bot. Other errors are treated as
+// transient and the message is queued for retry.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent wraps err as a PermanentError.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+// IsPermanent reports whether err is marked as permanent.
+func IsPermanent(err error) bool {
+	var pe *PermanentError
+	return errors.As(err, &pe)
+}
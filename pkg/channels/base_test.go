@@ -1,6 +1,14 @@
 package channels
 
-import "testing"
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
 
 func TestBaseChannelIsAllowed(t *testing.T) {
 	tests := []struct {
@@ -50,3 +58,40 @@ func TestBaseChannelIsAllowed(t *testing.T) {
 		})
 	}
 }
+
+// TestBaseChannel_Admit verifies redelivered messages are dropped and a
+// flooding sender is throttled with a single notice.
+func TestBaseChannel_Admit(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	ch := NewBaseChannel("test", nil, msgBus, nil)
+	ch.SetInboundLimits(config.InboundConfig{DedupeWindow: 600, Burst: 3, PerMinute: 1})
+
+	if !ch.Admit("alice", "1", "100") {
+		t.Fatal("Expected the first delivery to be admitted")
+	}
+	if ch.Admit("alice", "1", "100") {
+		t.Error("Expected a redelivery of message 100 to be dropped")
+	}
+	if !ch.Admit("bob", "2", "100") {
+		t.Error("Expected the same message ID in another chat to be admitted")
+	}
+
+	admitted := 0
+	for i := 0; i < 5; i++ {
+		if ch.Admit("alice", "1", fmt.Sprintf("%d", 200+i)) {
+			admitted++
+		}
+	}
+	// The duplicate above took no token, so alice has two of three left
+	if admitted != 2 {
+		t.Errorf("Expected 2 more messages admitted within the burst, got %d", admitted)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if notice, ok := msgBus.SubscribeOutbound(ctx); !ok || notice.ChatID != "1" || notice.Content != floodNotice {
+		t.Errorf("Expected a flood notice to chat 1, got %+v", notice)
+	}
+	if extra, ok := msgBus.SubscribeOutbound(ctx); ok {
+		t.Errorf("Expected only one notice, got another: %+v", extra)
+	}
+}
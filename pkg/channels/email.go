@@ -0,0 +1,956 @@
+//go:build !noemail
+
+package channels
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const (
+	// emailTimeout bounds one IMAP poll or SMTP delivery.
+	emailTimeout = 2 * time.Minute
+	// emailMaxMessage is the largest email that is fetched.
+	emailMaxMessage = 50 << 20
+	// emailMaxAttachment is the largest file attached to a reply.
+	emailMaxAttachment = 20 << 20
+	// emailMaxThreads bounds how many threads are remembered for replies.
+	emailMaxThreads = 1000
+	// emailMaxReferences bounds the References header of replies.
+	emailMaxReferences = 20
+)
+
+// EmailChannel reads a dedicated mailbox over IMAP and answers by email
+// over SMTP. Each email thread is a session; its chat ID is derived from
+// the Message-ID that started the thread.
+type EmailChannel struct {
+	*BaseChannel
+	config config.EmailConfig
+
+	// dial and deliver are replaced in tests
+	dial    func(ctx context.Context) (net.Conn, error)
+	deliver func(from string, to []string, msg []byte) error
+
+	pollMu    sync.Mutex // one poll at a time
+	mu        sync.Mutex // guards threads
+	storePath string
+	threads   map[string]*emailThread
+}
+
+// emailThread is what a reply needs to land in the sender's thread. The
+// threads are kept in state/email.json so replies still thread after a
+// restart.
+type emailThread struct {
+	To         string    `json:"to"`
+	Subject    string    `json:"subject"`
+	InReplyTo  string    `json:"in_reply_to"`
+	References []string  `json:"references"`
+	Updated    time.Time `json:"updated"`
+}
+
+func init() {
+	RegisterFactory("email", ChannelFactory{
+		Enabled: func(cfg *config.Config) bool {
+			e := cfg.Channels.Email
+			return e.Enabled && e.IMAPServer != "" && e.SMTPServer != "" && e.Username != ""
+		},
+		Create: func(cfg *config.Config, bus *bus.MessageBus) (Channel, error) {
+			return NewEmailChannel(cfg.Channels.Email, filepath.Join(cfg.WorkspacePath(), "state", "email.json"), bus)
+		},
+		AllowList: func(cfg *config.Config) []string { return []string(cfg.Channels.Email.AllowFrom) },
+	})
+}
+
+// NewEmailChannel creates the channel; storePath is where threads are
+// remembered.
+func NewEmailChannel(cfg config.EmailConfig, storePath string, bus *bus.MessageBus) (*EmailChannel, error) {
+	if len(cfg.AllowFrom) == 0 {
+		// Anyone can send mail, and From is easy to fake; don't run open
+		return nil, fmt.Errorf("email channel needs allow_from")
+	}
+	if cfg.Address == "" {
+		cfg.Address = cfg.Username
+	}
+	if _, err := mail.ParseAddress(cfg.Address); err != nil {
+		return nil, fmt.Errorf("invalid email address %q: %w", cfg.Address, err)
+	}
+	if cfg.Folder == "" {
+		cfg.Folder = "INBOX"
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 60
+	}
+	allow := normalizeAddresses(cfg.AllowFrom)
+
+	threads := make(map[string]*emailThread)
+	data, err := os.ReadFile(storePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &threads); err != nil {
+			return nil, fmt.Errorf("reading %s: %w", storePath, err)
+		}
+	}
+
+	c := &EmailChannel{
+		BaseChannel: NewBaseChannel("email", cfg, bus, allow),
+		config:      cfg,
+		storePath:   storePath,
+		threads:     threads,
+	}
+	c.dial = c.dialIMAP
+	c.deliver = c.sendSMTP
+	return c, nil
+}
+
+func (c *EmailChannel) Start(ctx context.Context) error {
+	if err := c.poll(ctx); err != nil {
+		return fmt.Errorf("email login failed: %w", err)
+	}
+	c.setRunning(true)
+	logger.InfoCF("email", "Email channel started", map[string]interface{}{
+		"address": c.config.Address,
+		"folder":  c.config.Folder,
+	})
+	go c.run(ctx)
+	return nil
+}
+
+func (c *EmailChannel) Stop(ctx context.Context) error {
+	logger.InfoC("email", "Stopping email channel...")
+	c.setRunning(false)
+	return nil
+}
+
+// run checks the mailbox every poll interval until ctx is done.
+func (c *EmailChannel) run(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(c.config.PollInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !c.IsRunning() {
+			return
+		}
+		if err := c.poll(ctx); err != nil {
+			logger.WarnCF("email", "Checking the mailbox failed", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}
+}
+
+// poll logs in, passes on every unread message and marks it read. Mail
+// that is ignored is marked read too, so it isn't fetched again.
+func (c *EmailChannel) poll(ctx context.Context) error {
+	c.pollMu.Lock()
+	defer c.pollMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, emailTimeout)
+	defer cancel()
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	client := &imapClient{conn: conn, r: bufio.NewReader(conn)}
+	if err := client.greeting(); err != nil {
+		return err
+	}
+	defer client.command("LOGOUT")
+	if _, err := client.command("LOGIN %s %s", imapQuote(c.config.Username), imapQuote(c.config.Password)); err != nil {
+		return err
+	}
+	if _, err := client.command("SELECT %s", imapQuote(c.config.Folder)); err != nil {
+		return err
+	}
+	responses, err := client.command("UID SEARCH UNSEEN")
+	if err != nil {
+		return err
+	}
+	var uids []string
+	for _, r := range responses {
+		if fields := strings.Fields(r.text); len(fields) > 1 && strings.EqualFold(fields[1], "SEARCH") {
+			uids = append(uids, fields[2:]...)
+		}
+	}
+
+	for _, uid := range uids {
+		if _, err := strconv.ParseUint(uid, 10, 32); err != nil {
+			continue
+		}
+		responses, err := client.command("UID FETCH %s (BODY.PEEK[])", uid)
+		if err != nil {
+			return err
+		}
+		for _, r := range responses {
+			if len(r.literals) > 0 {
+				c.handleEmail(r.literals[0])
+				break
+			}
+		}
+		if _, err := client.command(`UID STORE %s +FLAGS.SILENT (\Seen)`, uid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *EmailChannel) dialIMAP(ctx context.Context) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(c.config.IMAPServer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid imap_server %q: %w", c.config.IMAPServer, err)
+	}
+	dialer := &tls.Dialer{Config: &tls.Config{ServerName: host}}
+	return dialer.DialContext(ctx, "tcp", c.config.IMAPServer)
+}
+
+// handleEmail passes on one raw message if it is from an allowed sender
+// and not an automatic reply.
+func (c *EmailChannel) handleEmail(raw []byte) {
+	msg, err := parseEmail(raw)
+	if err != nil {
+		logger.WarnCF("email", "Could not read email", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+	if msg.From == "" || strings.EqualFold(msg.From, c.config.Address) {
+		return
+	}
+	if msg.Automatic {
+		logger.DebugCF("email", "Ignoring automatic email", map[string]interface{}{
+			"from": msg.From,
+		})
+		return
+	}
+	if msg.DMARCFail {
+		logger.WarnCF("email", "Ignoring email that failed DMARC", map[string]interface{}{
+			"from": msg.From,
+		})
+		return
+	}
+	if !c.IsAllowed(msg.From) {
+		logger.DebugCF("email", "Email rejected by allowlist", map[string]interface{}{
+			"from": msg.From,
+		})
+		return
+	}
+
+	chatID := emailChatID(msg)
+	if !c.Admit(msg.From, chatID, msg.MessageID) {
+		return
+	}
+	c.rememberThread(chatID, msg)
+
+	content := msg.Text
+	if msg.Subject != "" && len(msg.References) == 0 {
+		content = "Subject: " + msg.Subject + "\n\n" + content
+	}
+	var media []string
+	for _, a := range msg.Attachments {
+		path := saveEmailAttachment(a)
+		if path == "" {
+			continue
+		}
+		media = append(media, path)
+		content += fmt.Sprintf("\n[file: %s]", a.Name)
+	}
+	content = strings.TrimSpace(content)
+	if content == "" {
+		content = "[empty message]"
+	}
+
+	logger.DebugCF("email", "Received email", map[string]interface{}{
+		"from":    msg.From,
+		"chat_id": chatID,
+		"preview": utils.Truncate(content, 50),
+	})
+
+	c.HandleMessage(msg.From, chatID, content, media, map[string]string{
+		"message_id": msg.MessageID,
+		"subject":    msg.Subject,
+	})
+}
+
+// emailChatID names the thread a message belongs to after its first
+// message: the oldest reference, the message it answers, or itself.
+func emailChatID(msg *emailMessage) string {
+	root := msg.MessageID
+	switch {
+	case len(msg.References) > 0:
+		root = msg.References[0]
+	case msg.InReplyTo != "":
+		root = msg.InReplyTo
+	case root == "":
+		root = msg.From + "\x00" + msg.Subject
+	}
+	sum := sha256.Sum256([]byte(root))
+	return hex.EncodeToString(sum[:8])
+}
+
+// rememberThread records where replies to chatID go, forgetting the
+// threads untouched longest once emailMaxThreads are kept.
+func (c *EmailChannel) rememberThread(chatID string, msg *emailMessage) {
+	refs := msg.References
+	if msg.MessageID != "" {
+		refs = append(refs, msg.MessageID)
+	}
+	subject := msg.Subject
+	for {
+		trimmed := strings.TrimSpace(subject)
+		if len(trimmed) < 3 || !strings.EqualFold(trimmed[:3], "re:") {
+			subject = trimmed
+			break
+		}
+		subject = trimmed[3:]
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.threads[chatID] = &emailThread{
+		To:         msg.From,
+		Subject:    subject,
+		InReplyTo:  msg.MessageID,
+		References: trimReferences(refs),
+		Updated:    time.Now(),
+	}
+	if len(c.threads) > emailMaxThreads {
+		ids := make([]string, 0, len(c.threads))
+		for id := range c.threads {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool { return c.threads[ids[i]].Updated.Before(c.threads[ids[j]].Updated) })
+		for _, id := range ids[:len(ids)-emailMaxThreads] {
+			delete(c.threads, id)
+		}
+	}
+	if err := c.saveThreads(); err != nil {
+		logger.WarnCF("email", "Could not save email threads", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+// trimReferences keeps the first reference, which names the thread, and
+// the latest ones.
+func trimReferences(refs []string) []string {
+	if len(refs) <= emailMaxReferences {
+		return refs
+	}
+	return append([]string{refs[0]}, refs[len(refs)-emailMaxReferences+1:]...)
+}
+
+// saveThreads writes the threads atomically. Callers hold c.mu.
+func (c *EmailChannel) saveThreads() error {
+	if err := os.MkdirAll(filepath.Dir(c.storePath), 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(c.threads)
+	if err != nil {
+		return err
+	}
+	tmp := c.storePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.storePath)
+}
+
+func saveEmailAttachment(a emailAttachment) string {
+	dir := utils.MediaDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return ""
+	}
+	path := filepath.Join(dir, uuid.New().String()[:8]+"_"+utils.SanitizeFilename(a.Name))
+	if err := os.WriteFile(path, a.Data, 0600); err != nil {
+		logger.ErrorCF("email", "Failed to save attachment", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return ""
+	}
+	return path
+}
+
+// CanSendMedia reports whether the file is small enough to attach; larger
+// ones are sent as links.
+func (c *EmailChannel) CanSendMedia(path string) bool {
+	return fileFits(path, emailMaxAttachment)
+}
+
+// Send replies in the thread of chat ID, attaching msg.Media.
+func (c *EmailChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("email channel not running")
+	}
+	c.mu.Lock()
+	thread, ok := c.threads[msg.ChatID]
+	var reply emailThread
+	if ok {
+		reply = *thread
+		reply.References = append([]string(nil), thread.References...)
+	}
+	c.mu.Unlock()
+	if !ok {
+		return Permanent(fmt.Errorf("unknown email thread %q", msg.ChatID))
+	}
+
+	messageID := fmt.Sprintf("%s@%s", uuid.NewString(), emailDomain(c.config.Address))
+	data, err := composeEmail(c.config.Address, reply, messageID, msg.Content, msg.Media)
+	if err != nil {
+		return Permanent(err)
+	}
+	if err := c.deliver(c.config.Address, []string{reply.To}, data); err != nil {
+		var tpErr *textproto.Error
+		if errors.As(err, &tpErr) && tpErr.Code >= 500 {
+			return Permanent(err)
+		}
+		return err
+	}
+
+	// Later replies continue from this one
+	c.mu.Lock()
+	if thread, ok := c.threads[msg.ChatID]; ok {
+		thread.References = trimReferences(append(thread.References, messageID))
+		thread.Updated = time.Now()
+		if err := c.saveThreads(); err != nil {
+			logger.WarnCF("email", "Could not save email threads", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}
+	c.mu.Unlock()
+	return nil
+}
+
+func emailDomain(address string) string {
+	if addr, err := mail.ParseAddress(address); err == nil {
+		address = addr.Address
+	}
+	if _, domain, ok := strings.Cut(address, "@"); ok && domain != "" {
+		return domain
+	}
+	return "picoclaw.local"
+}
+
+// sendSMTP delivers msg, over TLS on port 465 and with STARTTLS
+// otherwise. The password is never sent unencrypted.
+func (c *EmailChannel) sendSMTP(from string, to []string, msg []byte) error {
+	host, port, err := net.SplitHostPort(c.config.SMTPServer)
+	if err != nil {
+		return Permanent(fmt.Errorf("invalid smtp_server %q: %w", c.config.SMTPServer, err))
+	}
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	tlsConfig := &tls.Config{ServerName: host}
+	var conn net.Conn
+	if port == "465" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", c.config.SMTPServer, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", c.config.SMTPServer)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(emailTimeout))
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if port != "465" {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return Permanent(fmt.Errorf("%s does not support STARTTLS", c.config.SMTPServer))
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if err := client.Auth(smtp.PlainAuth("", c.config.Username, c.config.Password, host)); err != nil {
+		return err
+	}
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// composeEmail builds the reply: plain text, with the files as
+// attachments. Auto-Submitted tells other mail robots not to answer it.
+func composeEmail(from string, thread emailThread, messageID, text string, files []string) ([]byte, error) {
+	var buf bytes.Buffer
+	subject := "Re: " + thread.Subject
+	if thread.Subject == "" {
+		subject = "Re: your message"
+	}
+	header := func(name, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+	}
+	header("From", from)
+	header("To", thread.To)
+	header("Subject", mime.QEncoding.Encode("utf-8", subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", "<"+messageID+">")
+	if thread.InReplyTo != "" {
+		header("In-Reply-To", "<"+thread.InReplyTo+">")
+	}
+	if len(thread.References) > 0 {
+		header("References", "<"+strings.Join(thread.References, "> <")+">")
+	}
+	header("Auto-Submitted", "auto-replied")
+	header("MIME-Version", "1.0")
+
+	if len(files) == 0 {
+		header("Content-Type", "text/plain; charset=utf-8")
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		return buf.Bytes(), writeQuotedPrintable(&buf, text)
+	}
+
+	mw := multipart.NewWriter(&buf)
+	header("Content-Type", mime.FormatMediaType("multipart/mixed", map[string]string{"boundary": mw.Boundary()}))
+	buf.WriteString("\r\n")
+	part, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := writeQuotedPrintable(part, text); err != nil {
+		return nil, err
+	}
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		name := filepath.Base(path)
+		if len(data) > emailMaxAttachment {
+			logger.WarnCF("email", "Attachment too large, not sent", map[string]interface{}{
+				"file": name,
+				"size": len(data),
+			})
+			continue
+		}
+		contentType := mime.TypeByExtension(filepath.Ext(name))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {contentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": name})},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoded := base64.StdEncoding.EncodeToString(data)
+		for len(encoded) > 76 {
+			io.WriteString(part, encoded[:76]+"\r\n")
+			encoded = encoded[76:]
+		}
+		io.WriteString(part, encoded+"\r\n")
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(w io.Writer, text string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := io.WriteString(qp, strings.ReplaceAll(text, "\n", "\r\n")); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// emailMessage is the part of a received email the channel uses.
+type emailMessage struct {
+	From        string // lower-case address
+	Subject     string
+	MessageID   string // without angle brackets, as are the others
+	InReplyTo   string
+	References  []string
+	Text        string // the new text, without the quoted earlier messages
+	Attachments []emailAttachment
+	Automatic   bool // an auto-reply, bounce or list mail
+	DMARCFail   bool // the receiving server found the From domain forged
+}
+
+type emailAttachment struct {
+	Name string
+	Data []byte
+}
+
+var messageIDPattern = regexp.MustCompile(`<([^<>\s]+)>`)
+
+// parseEmail reads a raw RFC 5322 message.
+func parseEmail(raw []byte) (*emailMessage, error) {
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	dec := new(mime.WordDecoder)
+	msg := &emailMessage{}
+	if from, err := mail.ParseAddress(m.Header.Get("From")); err == nil {
+		msg.From = strings.ToLower(from.Address)
+	}
+	if subject, err := dec.DecodeHeader(m.Header.Get("Subject")); err == nil {
+		msg.Subject = strings.TrimSpace(subject)
+	}
+	ids := func(name string) []string {
+		var out []string
+		for _, match := range messageIDPattern.FindAllStringSubmatch(m.Header.Get(name), -1) {
+			out = append(out, match[1])
+		}
+		return out
+	}
+	if id := ids("Message-ID"); len(id) > 0 {
+		msg.MessageID = id[0]
+	}
+	if id := ids("In-Reply-To"); len(id) > 0 {
+		msg.InReplyTo = id[0]
+	}
+	msg.References = ids("References")
+
+	auto := strings.ToLower(m.Header.Get("Auto-Submitted"))
+	precedence := strings.ToLower(m.Header.Get("Precedence"))
+	msg.Automatic = (auto != "" && auto != "no") ||
+		precedence == "bulk" || precedence == "list" || precedence == "junk" ||
+		m.Header.Get("List-Id") != "" ||
+		strings.HasPrefix(msg.From, "mailer-daemon@") || strings.HasPrefix(msg.From, "postmaster@")
+	msg.DMARCFail = strings.Contains(strings.ToLower(m.Header.Get("Authentication-Results")), "dmarc=fail")
+
+	var plain, htmlText string
+	err = walkEmailPart(textproto.MIMEHeader(m.Header), m.Body, func(contentType, name string, data []byte) {
+		switch {
+		case name != "":
+			msg.Attachments = append(msg.Attachments, emailAttachment{Name: name, Data: data})
+		case contentType == "text/plain" && plain == "":
+			plain = string(data)
+		case contentType == "text/html" && htmlText == "":
+			htmlText = htmlToText(string(data))
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if plain == "" {
+		plain = htmlText
+	}
+	msg.Text = stripQuotedReply(plain)
+	return msg, nil
+}
+
+// walkEmailPart calls visit with the decoded body of every leaf part.
+// Parts with a file name are attachments; name is empty for the others.
+func walkEmailPart(header textproto.MIMEHeader, body io.Reader, visit func(contentType, name string, data []byte)) error {
+	contentType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		contentType, params = "text/plain", map[string]string{}
+	}
+	if strings.HasPrefix(contentType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := walkEmailPart(part.Header, part, visit); err != nil {
+				return err
+			}
+		}
+	}
+
+	switch strings.ToLower(header.Get("Content-Transfer-Encoding")) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, &newlineStripper{r: body})
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+	data, err := io.ReadAll(io.LimitReader(body, emailMaxMessage))
+	if err != nil {
+		return err
+	}
+
+	dec := new(mime.WordDecoder)
+	name := ""
+	if disposition, dparams, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil {
+		name = dparams["filename"]
+		if name == "" && disposition == "attachment" {
+			name = "attachment"
+		}
+	}
+	if name == "" {
+		name = params["name"]
+	}
+	if decoded, err := dec.DecodeHeader(name); err == nil {
+		name = decoded
+	}
+	if name == "" && contentType == "message/rfc822" {
+		name = "message.eml"
+	}
+	if name == "" && strings.HasPrefix(contentType, "text/") {
+		data = toUTF8(params["charset"], data)
+	}
+	visit(contentType, name, data)
+	return nil
+}
+
+// newlineStripper drops the line breaks base64 bodies are wrapped with.
+type newlineStripper struct {
+	r io.Reader
+}
+
+func (s *newlineStripper) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	kept := 0
+	for _, b := range p[:n] {
+		if b != '\r' && b != '\n' && b != ' ' && b != '\t' {
+			p[kept] = b
+			kept++
+		}
+	}
+	if kept == 0 && n > 0 && err == nil {
+		return s.Read(p)
+	}
+	return kept, err
+}
+
+// toUTF8 converts Latin-1 text, the common legacy charset; UTF-8 and
+// ASCII are returned unchanged, as are charsets it doesn't know.
+func toUTF8(charset string, data []byte) []byte {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "latin1", "windows-1252", "cp1252":
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return []byte(string(runes))
+	}
+	return data
+}
+
+var (
+	htmlBreaks  = regexp.MustCompile(`(?i)<br\s*/?>|</p>|</div>|</li>|</tr>|</h[1-6]>`)
+	htmlDrop    = regexp.MustCompile(`(?is)<(style|script|head)[^>]*>.*?</(style|script|head)>`)
+	htmlQuote   = regexp.MustCompile(`(?is)<blockquote[^>]*>.*?</blockquote>`)
+	htmlTags    = regexp.MustCompile(`<[^>]*>`)
+	blankLines  = regexp.MustCompile(`\n{3,}`)
+	wroteHeader = regexp.MustCompile(`(?i)^(on\s.*|.*\s)?wrote:$`)
+)
+
+// htmlToText reduces an HTML body to its text, dropping quoted messages.
+func htmlToText(s string) string {
+	s = htmlDrop.ReplaceAllString(s, "")
+	s = htmlQuote.ReplaceAllString(s, "")
+	s = htmlBreaks.ReplaceAllString(s, "\n")
+	s = htmlTags.ReplaceAllString(s, "")
+	s = html.UnescapeString(s)
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return strings.TrimSpace(blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
+
+// stripQuotedReply keeps the new text of a reply: quoted lines, the
+// "On ... wrote:" line before them, forwarded originals and the signature
+// are dropped, since the thread's history is already in the session.
+func stripQuotedReply(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	var kept []string
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, ">") {
+			continue
+		}
+		if line == "-- " || strings.HasPrefix(trimmed, "-----Original Message-----") {
+			break
+		}
+		if wroteHeader.MatchString(trimmed) {
+			// Clients wrap "On <date>, <name> <address>" onto two lines
+			if n := len(kept); n > 0 && strings.HasPrefix(strings.ToLower(strings.TrimSpace(kept[n-1])), "on ") && !strings.HasPrefix(strings.ToLower(trimmed), "on ") {
+				kept = kept[:n-1]
+			}
+			break
+		}
+		kept = append(kept, line)
+	}
+	return strings.TrimSpace(strings.Join(kept, "\n"))
+}
+
+// imapClient speaks the few IMAP4rev1 commands polling needs.
+type imapClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+	tag  int
+}
+
+// imapResponse is one untagged response. Literals are taken out of the
+// text in the order they appear.
+type imapResponse struct {
+	text     string
+	literals [][]byte
+}
+
+var imapLiteral = regexp.MustCompile(`\{(\d+)\}$`)
+
+func (c *imapClient) greeting() error {
+	line, err := c.readLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "* OK") && !strings.HasPrefix(line, "* PREAUTH") {
+		return fmt.Errorf("imap: unexpected greeting %q", line)
+	}
+	return nil
+}
+
+// command sends one command and returns its untagged responses, or the
+// server's reason when it doesn't answer OK.
+func (c *imapClient) command(format string, args ...interface{}) ([]imapResponse, error) {
+	c.tag++
+	tag := fmt.Sprintf("A%d", c.tag)
+	cmd := fmt.Sprintf(format, args...)
+	if _, err := fmt.Fprintf(c.conn, "%s %s\r\n", tag, cmd); err != nil {
+		return nil, err
+	}
+	name, _, _ := strings.Cut(cmd, " ")
+
+	var responses []imapResponse
+	for {
+		resp, err := c.readResponse()
+		if err != nil {
+			return nil, err
+		}
+		if rest, ok := strings.CutPrefix(resp.text, tag+" "); ok {
+			if status, _, _ := strings.Cut(rest, " "); !strings.EqualFold(status, "OK") {
+				return nil, fmt.Errorf("imap %s: %s", name, rest)
+			}
+			return responses, nil
+		}
+		if strings.HasPrefix(resp.text, "*") {
+			responses = append(responses, resp)
+		}
+	}
+}
+
+// readResponse reads a line and the literals it announces.
+func (c *imapClient) readResponse() (imapResponse, error) {
+	var resp imapResponse
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return resp, err
+		}
+		m := imapLiteral.FindStringSubmatch(line)
+		if m == nil {
+			resp.text += line
+			return resp, nil
+		}
+		n, err := strconv.Atoi(m[1])
+		if err != nil || n > emailMaxMessage {
+			return resp, fmt.Errorf("imap: literal of %s bytes is too large", m[1])
+		}
+		literal := make([]byte, n)
+		if _, err := io.ReadFull(c.r, literal); err != nil {
+			return resp, err
+		}
+		resp.text += line[:len(line)-len(m[0])]
+		resp.literals = append(resp.literals, literal)
+	}
+}
+
+func (c *imapClient) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// imapQuote makes s an IMAP quoted string.
+func imapQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// SetAllowList replaces the accepted senders. An empty list is refused, as
+// the channel never runs open.
+func (c *EmailChannel) SetAllowList(allowList []string) error {
+	if len(allowList) == 0 {
+		return fmt.Errorf("email channel needs allow_from")
+	}
+	return c.BaseChannel.SetAllowList(normalizeAddresses(allowList))
+}
+
+// normalizeAddresses lowercases and trims addresses for matching.
+func normalizeAddresses(addrs []string) []string {
+	normalized := make([]string, len(addrs))
+	for i, addr := range addrs {
+		normalized[i] = strings.ToLower(strings.TrimSpace(addr))
+	}
+	return normalized
+}
@@ -0,0 +1,253 @@
+//go:build !noemail
+
+package channels
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// fakeIMAP serves messages by UID over a pipe and records which were
+// marked read.
+type fakeIMAP struct {
+	t        *testing.T
+	messages map[string]string
+	seen     map[string]bool
+}
+
+func (s *fakeIMAP) dial(ctx context.Context) (net.Conn, error) {
+	client, server := net.Pipe()
+	go s.serve(server)
+	return client, nil
+}
+
+func (s *fakeIMAP) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	fmt.Fprint(conn, "* OK ready\r\n")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		tag, cmd, _ := strings.Cut(strings.TrimSpace(line), " ")
+		switch {
+		case strings.HasPrefix(cmd, "LOGIN "):
+			if cmd != `LOGIN "bot@example.com" "p\"w"` {
+				fmt.Fprintf(conn, "%s NO bad credentials\r\n", tag)
+				continue
+			}
+		case cmd == "UID SEARCH UNSEEN":
+			var uids []string
+			for uid := range s.messages {
+				if !s.seen[uid] {
+					uids = append(uids, uid)
+				}
+			}
+			fmt.Fprintf(conn, "* SEARCH %s\r\n", strings.Join(uids, " "))
+		case strings.HasPrefix(cmd, "UID FETCH "):
+			uid := strings.Fields(cmd)[2]
+			msg := s.messages[uid]
+			fmt.Fprintf(conn, "* 1 FETCH (UID %s BODY[] {%d}\r\n%s)\r\n", uid, len(msg), msg)
+		case strings.HasPrefix(cmd, "UID STORE "):
+			s.seen[strings.Fields(cmd)[2]] = true
+		case cmd == "LOGOUT":
+			fmt.Fprintf(conn, "* BYE\r\n%s OK bye\r\n", tag)
+			return
+		}
+		fmt.Fprintf(conn, "%s OK done\r\n", tag)
+	}
+}
+
+const firstEmail = "From: Ann <Ann@Example.com>\r\n" +
+	"To: bot@example.com\r\n" +
+	"Subject: =?utf-8?q?Trip_to_M=C3=BCnchen?=\r\n" +
+	"Message-ID: <first@example.com>\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=XX\r\n" +
+	"\r\n" +
+	"--XX\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"Please plan the trip, budget 500 =E2=82=AC.\r\n" +
+	"--XX\r\n" +
+	"Content-Type: application/pdf; name=\"tickets.pdf\"\r\n" +
+	"Content-Disposition: attachment; filename=\"tickets.pdf\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"JVBERi0x\r\nLjQK\r\n" +
+	"--XX--\r\n"
+
+// TestEmailChannel_Thread verifies an allowed email reaches the agent with
+// its attachment, other senders and auto-replies are ignored but marked
+// read, and the reply threads under the original message.
+func TestEmailChannel_Thread(t *testing.T) {
+	mb := bus.NewMessageBus()
+	storePath := filepath.Join(t.TempDir(), "email.json")
+	c, err := NewEmailChannel(config.EmailConfig{
+		Username:  "bot@example.com",
+		Password:  `p"w`,
+		AllowFrom: config.FlexibleStringSlice{"ann@example.com"},
+	}, storePath, mb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &fakeIMAP{t: t, seen: map[string]bool{}, messages: map[string]string{
+		"1": firstEmail,
+		"2": "From: mallory@example.net\r\nMessage-ID: <x@example.net>\r\n\r\nhi",
+		"3": "From: ann@example.com\r\nAuto-Submitted: auto-replied\r\nMessage-ID: <away@example.com>\r\n\r\nI am away",
+	}}
+	c.dial = server.dial
+	var sent []byte
+	var sentTo []string
+	c.deliver = func(from string, to []string, msg []byte) error {
+		sentTo, sent = to, msg
+		return nil
+	}
+
+	if err := c.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop(context.Background())
+	if len(server.seen) != 3 {
+		t.Errorf("Expected all 3 emails marked read, got %v", server.seen)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, ok := mb.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("Expected the allowed email to be forwarded")
+	}
+	if msg.SenderID != "ann@example.com" || !strings.Contains(msg.Content, "Subject: Trip to München") ||
+		!strings.Contains(msg.Content, "budget 500 €") || !strings.Contains(msg.Content, "[file: tickets.pdf]") {
+		t.Errorf("Unexpected message from %q: %q", msg.SenderID, msg.Content)
+	}
+	if len(msg.Media) != 1 {
+		t.Fatalf("Expected 1 attachment, got %v", msg.Media)
+	}
+	if data, _ := os.ReadFile(msg.Media[0]); string(data) != "%PDF-1.4\n" {
+		t.Errorf("Expected the decoded PDF, got %q", data)
+	}
+	os.Remove(msg.Media[0])
+	ctx2, cancel2 := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel2()
+	if extra, ok := mb.ConsumeInbound(ctx2); ok {
+		t.Errorf("Expected other emails to be ignored, got %q from %q", extra.Content, extra.SenderID)
+	}
+
+	// Replies survive a restart of the channel
+	c2, err := NewEmailChannel(config.EmailConfig{
+		Username:  "bot@example.com",
+		AllowFrom: config.FlexibleStringSlice{"ann@example.com"},
+	}, storePath, mb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2.deliver = c.deliver
+	c2.setRunning(true)
+	if err := c2.Send(context.Background(), bus.OutboundMessage{ChatID: msg.ChatID, Content: "Booked, see the plan."}); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := mail.ReadMessage(strings.NewReader(string(sent)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sentTo) != 1 || sentTo[0] != "ann@example.com" {
+		t.Errorf("Expected the reply to go to ann@example.com, got %v", sentTo)
+	}
+	if reply.Header.Get("In-Reply-To") != "<first@example.com>" || reply.Header.Get("References") != "<first@example.com>" {
+		t.Errorf("Expected the reply in the thread, got In-Reply-To %q References %q",
+			reply.Header.Get("In-Reply-To"), reply.Header.Get("References"))
+	}
+	if subject, _ := new(mime.WordDecoder).DecodeHeader(reply.Header.Get("Subject")); subject != "Re: Trip to München" {
+		t.Errorf("Expected subject %q, got %q", "Re: Trip to München", subject)
+	}
+
+	// Ann's answer to the reply is in the same session
+	answer, err := parseEmail([]byte("From: ann@example.com\r\nMessage-ID: <second@example.com>\r\n" +
+		"In-Reply-To: " + reply.Header.Get("Message-ID") + "\r\n" +
+		"References: <first@example.com> " + reply.Header.Get("Message-ID") + "\r\n\r\nThanks!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if emailChatID(answer) != msg.ChatID {
+		t.Errorf("Expected the answer in chat %q, got %q", msg.ChatID, emailChatID(answer))
+	}
+
+	if err := c2.Send(context.Background(), bus.OutboundMessage{ChatID: "unknown", Content: "x"}); !IsPermanent(err) {
+		t.Errorf("Expected a permanent error for an unknown thread, got %v", err)
+	}
+}
+
+// TestEmailChannel_RequiresAllowFrom verifies the channel refuses to read
+// mail from anyone.
+func TestEmailChannel_RequiresAllowFrom(t *testing.T) {
+	_, err := NewEmailChannel(config.EmailConfig{Username: "bot@example.com"}, filepath.Join(t.TempDir(), "email.json"), bus.NewMessageBus())
+	if err == nil {
+		t.Error("Expected an error without allow_from")
+	}
+}
+
+// TestManager_ApplyConfigAllowList verifies a reloaded allow_from reaches a
+// running channel, and that the email channel keeps its list rather than
+// run open.
+func TestManager_ApplyConfigAllowList(t *testing.T) {
+	c, err := NewEmailChannel(config.EmailConfig{Username: "bot@example.com", AllowFrom: []string{"ann@example.com"}},
+		filepath.Join(t.TempDir(), "email.json"), bus.NewMessageBus())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Manager{channels: map[string]Channel{"email": c}}
+
+	cfg := config.DefaultConfig()
+	cfg.Channels.Email.AllowFrom = []string{" Bob@Example.com"}
+	m.ApplyConfig(cfg)
+	if !c.IsAllowed("bob@example.com") || c.IsAllowed("ann@example.com") {
+		t.Error("Expected only bob@example.com to be allowed after the reload")
+	}
+
+	cfg.Channels.Email.AllowFrom = nil
+	m.ApplyConfig(cfg)
+	if !c.IsAllowed("bob@example.com") || c.IsAllowed("eve@example.com") {
+		t.Error("Expected an empty allow_from to keep the previous list")
+	}
+}
+
+// TestStripQuotedReply verifies only the new text of a reply is kept.
+func TestStripQuotedReply(t *testing.T) {
+	tests := map[string]string{
+		"Sounds good.\n\nOn Mon, 3 Mar 2025 at 10:00, Bot <bot@example.com> wrote:\n> Booked.": "Sounds good.",
+		"Yes\nOn Mon, 3 Mar 2025, Bot <bot@example.com>\nwrote:\n> Booked.":                    "Yes",
+		"Yes please\n-- \nAnn, sent from my phone":                                             "Yes please",
+		"Fine\n\n-----Original Message-----\nFrom: Bot":                                        "Fine",
+		"Line one\n> quoted\nLine two":                                                         "Line one\nLine two",
+	}
+	for in, want := range tests {
+		if got := stripQuotedReply(in); got != want {
+			t.Errorf("Expected %q for %q, got %q", want, in, got)
+		}
+	}
+}
+
+// TestHTMLToText verifies HTML-only mail is read as text without its
+// quoted part.
+func TestHTMLToText(t *testing.T) {
+	got := htmlToText(`<html><head><style>p{}</style></head><body><p>Hi &amp; thanks</p><div>Next<br>line</div><blockquote>old</blockquote></body></html>`)
+	if got != "Hi & thanks\nNext\nline" {
+		t.Errorf("Expected the text without quote, got %q", got)
+	}
+}
@@ -0,0 +1,138 @@
+package channels
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// defaultInboundLimits apply until the manager sets the configured ones.
+var defaultInboundLimits = config.InboundConfig{DedupeWindow: 600, Burst: 5, PerMinute: 20}
+
+// maxSeen bounds the dedupe memory; expired IDs are pruned past it.
+const maxSeen = 4096
+
+// floodNotice is sent once when a sender's messages start being dropped.
+const floodNotice = "⏳ You're sending messages faster than I can keep up with, so I skipped some. Wait a moment, then send the last one again."
+
+// inboundGuard drops redelivered messages (webhook retries, duplicate
+// updates) and bursts from one sender before they reach the agent, so a
+// message never triggers side-effecting tools twice.
+type inboundGuard struct {
+	window    time.Duration
+	burst     float64
+	perSecond float64 // 0 disables flood control
+
+	mu      sync.Mutex
+	seen    map[string]time.Time // message key -> when first seen
+	buckets map[string]*bucket   // sender -> tokens
+}
+
+// bucket is a token bucket: each message takes a token and tokens refill
+// at perSecond up to burst.
+type bucket struct {
+	tokens   float64
+	updated  time.Time
+	notified bool // flood notice sent since the bucket last ran dry
+}
+
+func newInboundGuard(cfg config.InboundConfig) *inboundGuard {
+	g := &inboundGuard{
+		window:    time.Duration(cfg.DedupeWindow) * time.Second,
+		burst:     float64(cfg.Burst),
+		perSecond: float64(cfg.PerMinute) / 60,
+		seen:      make(map[string]time.Time),
+		buckets:   make(map[string]*bucket),
+	}
+	if g.window <= 0 {
+		g.window = time.Duration(defaultInboundLimits.DedupeWindow) * time.Second
+	}
+	if g.burst <= 0 {
+		g.burst = float64(defaultInboundLimits.Burst)
+	}
+	return g
+}
+
+// duplicate reports whether key was seen within the dedupe window, and
+// records it if not.
+func (g *inboundGuard) duplicate(key string, now time.Time) bool {
+	if first, ok := g.seen[key]; ok && now.Sub(first) < g.window {
+		return true
+	}
+	if len(g.seen) >= maxSeen {
+		for k, t := range g.seen {
+			if now.Sub(t) >= g.window {
+				delete(g.seen, k)
+			}
+		}
+	}
+	g.seen[key] = now
+	return false
+}
+
+// flooding takes a token for sender and reports whether there was none,
+// and whether this is the first drop since the sender last had tokens.
+func (g *inboundGuard) flooding(sender string, now time.Time) (dropped, notify bool) {
+	if g.perSecond <= 0 {
+		return false, false
+	}
+	b, ok := g.buckets[sender]
+	if !ok {
+		b = &bucket{tokens: g.burst, updated: now}
+		g.buckets[sender] = b
+	}
+	b.tokens = min(g.burst, b.tokens+now.Sub(b.updated).Seconds()*g.perSecond)
+	b.updated = now
+	if b.tokens >= 1 {
+		b.tokens--
+		b.notified = false
+		return false, false
+	}
+	notify = !b.notified
+	b.notified = true
+	return true, notify
+}
+
+// SetInboundLimits replaces the dedupe window and flood limits.
+func (c *BaseChannel) SetInboundLimits(cfg config.InboundConfig) {
+	c.guard = newInboundGuard(cfg)
+}
+
+// Admit decides whether an inbound event should be handled. Channels call it
+// first, before downloading attachments or showing a typing indicator.
+// messageID identifies the event within the chat (e.g. the Telegram message
+// ID); events without one are only subject to flood control. When a sender
+// starts being throttled they are told once.
+func (c *BaseChannel) Admit(senderID, chatID, messageID string) bool {
+	now := time.Now()
+	c.guard.mu.Lock()
+	if messageID != "" && c.guard.duplicate(chatID+"/"+messageID, now) {
+		c.guard.mu.Unlock()
+		logger.DebugCF(c.name, "Dropped duplicate message", map[string]interface{}{
+			"chat_id":    chatID,
+			"message_id": messageID,
+		})
+		return false
+	}
+	dropped, notify := c.guard.flooding(senderID, now)
+	c.guard.mu.Unlock()
+	if !dropped {
+		return true
+	}
+
+	logger.WarnCF(c.name, "Dropped message from flooding sender", map[string]interface{}{
+		"sender_id": senderID,
+		"chat_id":   chatID,
+	})
+	if notify && c.bus != nil {
+		c.bus.PublishOutbound(bus.OutboundMessage{
+			Channel: c.name,
+			ChatID:  chatID,
+			Content: floodNotice,
+		})
+	}
+	return false
+}
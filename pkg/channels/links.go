@@ -0,0 +1,83 @@
+package channels
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/filelink"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// MediaSupport is implemented by channels that can't send every
+// attachment, e.g. text-only channels or ones with a size limit. Channels
+// without it are trusted to send all media. The manager replaces media a
+// channel can't send with a link, so it is not silently dropped.
+type MediaSupport interface {
+	CanSendMedia(path string) bool
+}
+
+// Links returns the store serving attachments as links, or nil if
+// gateway.links is off.
+func (m *Manager) Links() *filelink.Store {
+	return m.links
+}
+
+// linkUnsendable moves the media channel can't send out of msg, adding a
+// link to each file to the text instead, or a note that it could not be
+// sent when links are off.
+func (m *Manager) linkUnsendable(channel Channel, msg bus.OutboundMessage) bus.OutboundMessage {
+	support, ok := channel.(MediaSupport)
+	if !ok || len(msg.Media) == 0 {
+		return msg
+	}
+
+	var keep, lines []string
+	for _, path := range msg.Media {
+		if support.CanSendMedia(path) {
+			keep = append(keep, path)
+			continue
+		}
+		name := filepath.Base(path)
+		if m.links == nil {
+			lines = append(lines, fmt.Sprintf("📎 %s could not be sent here.", name))
+			continue
+		}
+		url, err := m.links.Publish(path)
+		if err != nil {
+			logger.WarnCF("channels", "Failed to link attachment", map[string]interface{}{
+				"channel": msg.Channel,
+				"path":    path,
+				"error":   err.Error(),
+			})
+			lines = append(lines, fmt.Sprintf("📎 %s could not be sent here.", name))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("📎 %s: %s (for %s)", name, url, formatTTL(m.links.TTL())))
+	}
+	if len(lines) == 0 {
+		return msg
+	}
+
+	msg.Media = keep
+	msg.Content = strings.TrimSpace(msg.Content + "\n\n" + strings.Join(lines, "\n"))
+	return msg
+}
+
+// fileFits reports whether the file at path is at most limit bytes. Files
+// that can't be read are left to the channel to report.
+func fileFits(path string, limit int64) bool {
+	info, err := os.Stat(path)
+	return err != nil || info.Size() <= limit
+}
+
+// formatTTL renders a link lifetime like "1h" or "30m".
+func formatTTL(d time.Duration) string {
+	if d >= time.Hour && d%time.Hour == 0 {
+		return fmt.Sprintf("%dh", d/time.Hour)
+	}
+	return fmt.Sprintf("%dm", d/time.Minute)
+}
@@ -0,0 +1,82 @@
+package channels
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// textOnlyChannel records what it was asked to send and takes no media
+// over 4 bytes.
+type textOnlyChannel struct {
+	sent []bus.OutboundMessage
+}
+
+func (c *textOnlyChannel) Name() string                    { return "sms" }
+func (c *textOnlyChannel) Start(ctx context.Context) error { return nil }
+func (c *textOnlyChannel) Stop(ctx context.Context) error  { return nil }
+func (c *textOnlyChannel) IsRunning() bool                 { return true }
+func (c *textOnlyChannel) IsAllowed(senderID string) bool  { return true }
+func (c *textOnlyChannel) CanSendMedia(path string) bool   { return fileFits(path, 4) }
+func (c *textOnlyChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	c.sent = append(c.sent, msg)
+	return nil
+}
+
+func newLinkTestManager(t *testing.T, links bool) *Manager {
+	t.Helper()
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Workspace = t.TempDir()
+	cfg.Gateway.Links = config.FileLinksConfig{Enabled: links, BaseURL: "https://claw.example.com", TTL: 30}
+	m, err := NewManager(cfg, bus.NewMessageBus())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// TestManager_LinksUnsendableMedia verifies media a channel can't send is
+// replaced by a link in the text, and what it can send is left attached.
+func TestManager_LinksUnsendableMedia(t *testing.T) {
+	dir := t.TempDir()
+	small := filepath.Join(dir, "ok.txt")
+	chart := filepath.Join(dir, "chart.png")
+	os.WriteFile(small, []byte("ok"), 0644)
+	os.WriteFile(chart, []byte("a large chart"), 0644)
+
+	m := newLinkTestManager(t, true)
+	ch := &textOnlyChannel{}
+	m.deliver(context.Background(), ch, bus.OutboundMessage{Channel: "sms", ChatID: "1", Content: "Here you go.", Media: []string{small, chart}})
+
+	if len(ch.sent) != 1 {
+		t.Fatalf("Expected 1 message, got %d", len(ch.sent))
+	}
+	got := ch.sent[0]
+	if len(got.Media) != 1 || got.Media[0] != small {
+		t.Errorf("Expected only the small file attached, got %v", got.Media)
+	}
+	if !strings.HasPrefix(got.Content, "Here you go.\n\n📎 chart.png: https://claw.example.com/files/") ||
+		!strings.HasSuffix(got.Content, "/chart.png (for 30m)") {
+		t.Errorf("Expected a link to the chart, got %q", got.Content)
+	}
+}
+
+// TestManager_NotesUnsendableMediaWithoutLinks verifies the user is told
+// about media that could not be sent when links are off.
+func TestManager_NotesUnsendableMediaWithoutLinks(t *testing.T) {
+	chart := filepath.Join(t.TempDir(), "chart.png")
+	os.WriteFile(chart, []byte("a large chart"), 0644)
+
+	m := newLinkTestManager(t, false)
+	ch := &textOnlyChannel{}
+	m.deliver(context.Background(), ch, bus.OutboundMessage{Channel: "sms", ChatID: "1", Media: []string{chart}})
+
+	if got := ch.sent[0]; len(got.Media) != 0 || got.Content != "📎 chart.png could not be sent here." {
+		t.Errorf("Expected a note instead of the chart, got %q with %v", got.Content, got.Media)
+	}
+}
@@ -9,19 +9,31 @@ package channels
 import (
 	"context"
 	"fmt"
+	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/filelink"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/outbox"
+	"github.com/sipeed/picoclaw/pkg/quiet"
 )
 
+// quietCheckInterval is how often held messages are checked for release.
+const quietCheckInterval = time.Minute
+
 type Manager struct {
 	channels     map[string]Channel
 	bus          *bus.MessageBus
 	config       *config.Config
 	dispatchTask *asyncTask
+	outbox       *outbox.Queue
+	retryWake    chan struct{}
+	quiet        *quiet.Hours
+	links        *filelink.Store // nil unless gateway.links is on
 	mu           sync.RWMutex
 }
 
@@ -36,6 +48,27 @@ func NewManager(cfg *config.Config, messageBus *bus.MessageBus) (*Manager, error
 		config:   cfg,
 	}
 
+	if cfg.Channels.Outbox.Enabled {
+		path := filepath.Join(cfg.WorkspacePath(), "state", "outbox.json")
+		m.outbox = outbox.New(path, time.Duration(cfg.Channels.Outbox.MaxAge)*time.Hour)
+		m.retryWake = make(chan struct{}, 1)
+	}
+
+	m.quiet = quiet.New(cfg.Channels.QuietHours, filepath.Join(cfg.WorkspacePath(), "state"))
+
+	if links := cfg.Gateway.Links; links.Enabled {
+		ttl := time.Duration(links.TTL) * time.Minute
+		if ttl <= 0 {
+			ttl = time.Hour
+		}
+		store, err := filelink.NewStore(links.BaseURL, ttl)
+		if err != nil {
+			logger.ErrorCF("channels", "Attachment links disabled", map[string]interface{}{"error": err.Error()})
+		} else {
+			m.links = store
+		}
+	}
+
 	if err := m.initChannels(); err != nil {
 		return nil, err
 	}
@@ -46,17 +79,32 @@ func NewManager(cfg *config.Config, messageBus *bus.MessageBus) (*Manager, error
 func (m *Manager) initChannels() error {
 	logger.InfoC("channels", "Initializing channel manager")
 
-	if m.config.Channels.Telegram.Enabled && m.config.Channels.Telegram.Token != "" {
-		logger.DebugC("channels", "Attempting to initialize Telegram channel")
-		telegram, err := NewTelegramChannel(m.config.Channels.Telegram, m.bus)
+	for _, name := range AvailableChannels() {
+		factory, _ := getFactory(name)
+		if !factory.Enabled(m.config) {
+			continue
+		}
+
+		logger.DebugCF("channels", "Attempting to initialize channel", map[string]interface{}{
+			"channel": name,
+		})
+		channel, err := factory.Create(m.config, m.bus)
 		if err != nil {
-			logger.ErrorCF("channels", "Failed to initialize Telegram channel", map[string]interface{}{
-				"error": err.Error(),
+			logger.ErrorCF("channels", "Failed to initialize channel", map[string]interface{}{
+				"channel": name,
+				"error":   err.Error(),
 			})
-		} else {
-			m.channels["telegram"] = telegram
-			logger.InfoC("channels", "Telegram channel enabled successfully")
+			continue
 		}
+		if limited, ok := channel.(interface {
+			SetInboundLimits(config.InboundConfig)
+		}); ok {
+			limited.SetInboundLimits(m.config.Channels.Inbound)
+		}
+		m.channels[name] = channel
+		logger.InfoCF("channels", "Channel enabled successfully", map[string]interface{}{
+			"channel": name,
+		})
 	}
 
 	logger.InfoCF("channels", "Channel initialization completed", map[string]interface{}{
@@ -81,6 +129,15 @@ func (m *Manager) StartAll(ctx context.Context) error {
 	m.dispatchTask = &asyncTask{cancel: cancel}
 
 	go m.dispatchOutbound(dispatchCtx)
+	if m.outbox != nil {
+		if pending := m.outbox.Len(); pending > 0 {
+			logger.InfoCF("channels", "Retrying undelivered messages from outbox", map[string]interface{}{
+				"pending": pending,
+			})
+		}
+		go m.retryOutbound(dispatchCtx)
+	}
+	go m.releaseQuiet(dispatchCtx)
 
 	for name, channel := range m.channels {
 		logger.InfoCF("channels", "Starting channel", map[string]interface{}{
@@ -139,6 +196,13 @@ func (m *Manager) dispatchOutbound(ctx context.Context) {
 				continue
 			}
 
+			msg, alsoNotify := m.routeProactive(msg)
+			if alsoNotify {
+				m.dispatchTo(ctx, "notify", bus.OutboundMessage{
+					Channel: "notify", ChatID: msg.ChatID, Content: msg.Content, Media: msg.Media, Urgency: msg.Urgency,
+				})
+			}
+
 			// Silently skip internal channels
 			if constants.IsInternalChannel(msg.Channel) {
 				continue
@@ -149,18 +213,222 @@ func (m *Manager) dispatchOutbound(ctx context.Context) {
 			m.mu.RUnlock()
 
 			if !exists {
+				if msg.Channel == "" {
+					logger.InfoCF("channels", "No chat to send proactive message to", map[string]interface{}{
+						"urgency": string(msg.Urgency),
+					})
+					continue
+				}
 				logger.WarnCF("channels", "Unknown channel for outbound message", map[string]interface{}{
 					"channel": msg.Channel,
 				})
 				continue
 			}
 
-			if err := channel.Send(ctx, msg); err != nil {
-				logger.ErrorCF("channels", "Error sending message to channel", map[string]interface{}{
+			if m.quiet.Hold(msg, time.Now()) {
+				logger.InfoCF("channels", "Message held for quiet hours", map[string]interface{}{
 					"channel": msg.Channel,
-					"error":   err.Error(),
+					"chat_id": msg.ChatID,
+					"urgency": string(msg.Urgency),
 				})
+				continue
 			}
+
+			m.deliver(ctx, channel, msg)
+		}
+	}
+}
+
+// routeProactive applies tools.notify.proactive to a message the user
+// didn't ask for, such as a reminder or a scheduled task's result. With
+// "fallback", one that has no open chat to go to (no chat, a chat in the
+// terminal, or a channel that isn't running) is sent as a notification
+// instead; with "always", alsoNotify reports it should be sent as one too.
+func (m *Manager) routeProactive(msg bus.OutboundMessage) (routed bus.OutboundMessage, alsoNotify bool) {
+	if msg.Urgency == "" || msg.Channel == "notify" {
+		return msg, false
+	}
+	m.mu.RLock()
+	_, hasNotify := m.channels["notify"]
+	_, exists := m.channels[msg.Channel]
+	m.mu.RUnlock()
+	if !hasNotify {
+		return msg, false
+	}
+	switch m.config.Tools.Notify.Proactive {
+	case "always":
+		return msg, true
+	case "fallback":
+		if !exists {
+			msg.Channel = "notify"
+		}
+	}
+	return msg, false
+}
+
+// dispatchTo delivers msg on the named channel, unless quiet hours hold it.
+func (m *Manager) dispatchTo(ctx context.Context, name string, msg bus.OutboundMessage) {
+	m.mu.RLock()
+	channel, exists := m.channels[name]
+	m.mu.RUnlock()
+	if !exists || m.quiet.Hold(msg, time.Now()) {
+		return
+	}
+	m.deliver(ctx, channel, msg)
+}
+
+// QuietHours returns the quiet hours policy, which the agent's /dnd command
+// updates.
+func (m *Manager) QuietHours() *quiet.Hours {
+	return m.quiet
+}
+
+// releaseQuiet delivers held messages once their chat's quiet time is over.
+func (m *Manager) releaseQuiet(ctx context.Context) {
+	ticker := time.NewTicker(quietCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, msg := range m.quiet.Release(time.Now()) {
+			m.mu.RLock()
+			channel, exists := m.channels[msg.Channel]
+			m.mu.RUnlock()
+			if !exists {
+				continue
+			}
+			logger.InfoCF("channels", "Delivering messages held for quiet hours", map[string]interface{}{
+				"channel": msg.Channel,
+				"chat_id": msg.ChatID,
+			})
+			m.deliver(ctx, channel, msg)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliver sends msg, queueing it in the outbox if the send fails with a
+// transient error. Messages for a chat that already has queued messages are
+// queued behind them so the chat sees them in order.
+func (m *Manager) deliver(ctx context.Context, channel Channel, msg bus.OutboundMessage) {
+	msg = m.linkUnsendable(channel, msg)
+	if m.outbox != nil && m.outbox.HasPending(msg.Channel, msg.ChatID) {
+		m.enqueue(msg, nil)
+		return
+	}
+
+	err := channel.Send(ctx, msg)
+	if err == nil {
+		return
+	}
+	logger.ErrorCF("channels", "Error sending message to channel", map[string]interface{}{
+		"channel": msg.Channel,
+		"error":   err.Error(),
+	})
+	if m.outbox != nil && !IsPermanent(err) && ctx.Err() == nil {
+		m.enqueue(msg, err)
+	}
+}
+
+func (m *Manager) enqueue(msg bus.OutboundMessage, sendErr error) {
+	if err := m.outbox.Enqueue(msg, sendErr, time.Now()); err != nil {
+		logger.ErrorCF("channels", "Failed to queue message for retry", map[string]interface{}{
+			"channel": msg.Channel,
+			"error":   err.Error(),
+		})
+		return
+	}
+	logger.InfoCF("channels", "Message queued for retry", map[string]interface{}{
+		"channel": msg.Channel,
+		"chat_id": msg.ChatID,
+	})
+	m.wakeRetry()
+}
+
+func (m *Manager) wakeRetry() {
+	select {
+	case m.retryWake <- struct{}{}:
+	default:
+	}
+}
+
+// retryOutbound resends queued messages as they become due.
+func (m *Manager) retryOutbound(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			m.retryDue(ctx)
+		case <-m.retryWake:
+		}
+
+		// Sleep until the next entry is due, or until something is queued
+		timer.Stop()
+		select {
+		case <-timer.C:
+		default:
+		}
+		if next, ok := m.outbox.NextDue(); ok {
+			timer.Reset(max(time.Until(next), 0))
+		}
+	}
+}
+
+func (m *Manager) retryDue(ctx context.Context) {
+	due, expired := m.outbox.Due(time.Now())
+	for _, e := range expired {
+		logger.ErrorCF("channels", "Dropping undelivered message after max age", map[string]interface{}{
+			"channel":  e.Message.Channel,
+			"chat_id":  e.Message.ChatID,
+			"attempts": e.Attempts,
+			"error":    e.LastError,
+		})
+	}
+
+	for _, e := range due {
+		m.mu.RLock()
+		channel, exists := m.channels[e.Message.Channel]
+		m.mu.RUnlock()
+		if !exists {
+			logger.WarnCF("channels", "Dropping queued message for unknown channel", map[string]interface{}{
+				"channel": e.Message.Channel,
+			})
+			m.outbox.Drop(e.ID)
+			continue
+		}
+
+		err := channel.Send(ctx, e.Message)
+		switch {
+		case err == nil:
+			m.outbox.Delivered(e.ID)
+			logger.InfoCF("channels", "Delivered queued message", map[string]interface{}{
+				"channel":  e.Message.Channel,
+				"chat_id":  e.Message.ChatID,
+				"attempts": e.Attempts + 1,
+			})
+		case IsPermanent(err):
+			m.outbox.Drop(e.ID)
+			logger.ErrorCF("channels", "Dropping queued message after permanent error", map[string]interface{}{
+				"channel": e.Message.Channel,
+				"error":   err.Error(),
+			})
+		case ctx.Err() != nil:
+			return
+		default:
+			m.outbox.Failed(e.ID, err, time.Now())
+			logger.WarnCF("channels", "Retry failed", map[string]interface{}{
+				"channel":  e.Message.Channel,
+				"attempts": e.Attempts + 1,
+				"error":    err.Error(),
+			})
 		}
 	}
 }
@@ -197,6 +465,28 @@ func (m *Manager) GetEnabledChannels() []string {
 	return names
 }
 
+// ApplyConfig updates the allowlists of the running channels from a
+// reloaded config. A list the channel refuses is logged and the old one
+// kept. Other channel settings need a restart.
+func (m *Manager) ApplyConfig(cfg *config.Config) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for name, channel := range m.channels {
+		factory, ok := getFactory(name)
+		setter, settable := channel.(AllowListSetter)
+		if !ok || factory.AllowList == nil || !settable {
+			continue
+		}
+		if err := setter.SetAllowList(factory.AllowList(cfg)); err != nil {
+			logger.ErrorCF("channels", "Allowlist not updated", map[string]interface{}{
+				"channel": name,
+				"error":   err.Error(),
+			})
+		}
+	}
+}
+
 func (m *Manager) RegisterChannel(name string, channel Channel) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
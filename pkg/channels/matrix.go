@@ -0,0 +1,881 @@
+//go:build !nomatrix
+
+package channels
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/olm"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// matrixSyncTimeout is how long each /sync long poll waits for events.
+const matrixSyncTimeout = 30 * time.Second
+
+// matrixPendingLimit bounds the encrypted events held until their room key
+// arrives; matrixPendingAge is how long they are held.
+const (
+	matrixPendingLimit = 100
+	matrixPendingAge   = 10 * time.Minute
+)
+
+// matrixSyncFilter keeps /sync responses small: no presence, and only the
+// latest timeline events of each room.
+const matrixSyncFilter = `{"presence":{"not_types":["*"]},"account_data":{"not_types":["*"]},"room":{"timeline":{"limit":20},"state":{"lazy_load_members":true},"ephemeral":{"not_types":["*"]},"account_data":{"not_types":["*"]}}}`
+
+// MatrixChannel is a Matrix client. It syncs with the homeserver, joins
+// rooms it is invited to by allowed users, and reads and answers in both
+// plain and end-to-end encrypted rooms. Each room is a session; its chat
+// ID is the room ID.
+type MatrixChannel struct {
+	*BaseChannel
+	config config.MatrixConfig
+	client *http.Client
+
+	mu      sync.Mutex // guards store, crypto and pending
+	store   *matrixStore
+	crypto  *matrixCrypto // nil when encryption is off
+	pending []matrixPending
+}
+
+// matrixStore is what the channel keeps in state/matrix.json: the login,
+// the sync position and the encryption keys.
+type matrixStore struct {
+	path string
+
+	AccessToken string            `json:"access_token,omitempty"` // from a password login
+	UserID      string            `json:"user_id"`
+	DeviceID    string            `json:"device_id"`
+	NextBatch   string            `json:"next_batch"`
+	Crypto      matrixCryptoState `json:"crypto"`
+}
+
+// matrixPending is an encrypted event whose room key hadn't arrived.
+type matrixPending struct {
+	roomID   string
+	event    matrixEvent
+	received time.Time
+}
+
+// matrixEvent is a room or to-device event.
+type matrixEvent struct {
+	Type     string          `json:"type"`
+	EventID  string          `json:"event_id"`
+	Sender   string          `json:"sender"`
+	StateKey *string         `json:"state_key"`
+	Content  json.RawMessage `json:"content"`
+}
+
+func init() {
+	RegisterFactory("matrix", ChannelFactory{
+		Enabled: func(cfg *config.Config) bool {
+			m := cfg.Channels.Matrix
+			return m.Enabled && m.Homeserver != "" && (m.AccessToken != "" || (m.UserID != "" && m.Password != ""))
+		},
+		Create: func(cfg *config.Config, bus *bus.MessageBus) (Channel, error) {
+			return NewMatrixChannel(cfg.Channels.Matrix, filepath.Join(cfg.WorkspacePath(), "state", "matrix.json"), bus)
+		},
+		AllowList: func(cfg *config.Config) []string { return []string(cfg.Channels.Matrix.AllowFrom) },
+	})
+}
+
+// NewMatrixChannel creates the channel; storePath is where the login and
+// encryption keys are kept.
+func NewMatrixChannel(cfg config.MatrixConfig, storePath string, bus *bus.MessageBus) (*MatrixChannel, error) {
+	if _, err := url.Parse(cfg.Homeserver); err != nil {
+		return nil, fmt.Errorf("invalid homeserver URL %q: %w", cfg.Homeserver, err)
+	}
+	cfg.Homeserver = strings.TrimRight(cfg.Homeserver, "/")
+	store := &matrixStore{path: storePath}
+	data, err := os.ReadFile(storePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, store); err != nil {
+			return nil, fmt.Errorf("reading %s: %w", storePath, err)
+		}
+	}
+	return &MatrixChannel{
+		BaseChannel: NewBaseChannel("matrix", cfg, bus, cfg.AllowFrom),
+		config:      cfg,
+		client:      &http.Client{Timeout: matrixSyncTimeout + 30*time.Second},
+		store:       store,
+	}, nil
+}
+
+// save writes the store atomically, readable only by the owner since it
+// holds the access token and private keys. Callers hold c.mu.
+func (s *matrixStore) save() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func (c *MatrixChannel) Start(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.login(ctx); err != nil {
+		return fmt.Errorf("matrix login failed: %w", err)
+	}
+	if c.config.Encryption {
+		logger.WarnCF("matrix", "Matrix end-to-end encryption is experimental; its Olm/Megolm implementation has not been audited", nil)
+		c.crypto = newMatrixCrypto(c.api, c.store.UserID, c.store.DeviceID, &c.store.Crypto, c.store.save)
+		if err := c.crypto.setup(ctx); err != nil {
+			return fmt.Errorf("matrix encryption setup failed: %w", err)
+		}
+	}
+
+	c.setRunning(true)
+	logger.InfoCF("matrix", "Matrix client connected", map[string]interface{}{
+		"user_id":    c.store.UserID,
+		"device_id":  c.store.DeviceID,
+		"encryption": c.config.Encryption,
+	})
+	go c.syncLoop(ctx)
+	return nil
+}
+
+// login finds out the user and device of the access token, or logs in
+// with the password the first time. A new device starts with new keys.
+func (c *MatrixChannel) login(ctx context.Context) error {
+	if c.config.AccessToken == "" && c.store.AccessToken == "" {
+		var resp struct {
+			AccessToken string `json:"access_token"`
+			UserID      string `json:"user_id"`
+			DeviceID    string `json:"device_id"`
+		}
+		err := c.api(ctx, http.MethodPost, "/_matrix/client/v3/login", map[string]interface{}{
+			"type":                        "m.login.password",
+			"identifier":                  map[string]string{"type": "m.id.user", "user": c.config.UserID},
+			"password":                    c.config.Password,
+			"initial_device_display_name": "picoclaw",
+		}, &resp)
+		if err != nil {
+			return err
+		}
+		c.store.AccessToken = resp.AccessToken
+		c.store.Crypto = matrixCryptoState{}
+		c.store.NextBatch = ""
+	}
+
+	var who struct {
+		UserID   string `json:"user_id"`
+		DeviceID string `json:"device_id"`
+	}
+	if err := c.api(ctx, http.MethodGet, "/_matrix/client/v3/account/whoami", nil, &who); err != nil {
+		return err
+	}
+	if c.config.Encryption && who.DeviceID == "" {
+		return errors.New("the access token has no device; encryption needs one")
+	}
+	if who.DeviceID != c.store.DeviceID || who.UserID != c.store.UserID {
+		if c.store.DeviceID != "" {
+			logger.WarnCF("matrix", "Logged in as a new device, starting with new encryption keys", map[string]interface{}{
+				"device_id": who.DeviceID,
+			})
+		}
+		c.store.Crypto = matrixCryptoState{}
+		c.store.NextBatch = ""
+	}
+	c.store.UserID, c.store.DeviceID = who.UserID, who.DeviceID
+	return c.store.save()
+}
+
+func (c *MatrixChannel) Stop(ctx context.Context) error {
+	logger.InfoC("matrix", "Stopping Matrix client...")
+	c.setRunning(false)
+	return nil
+}
+
+// matrixSync is the part of a /sync response the channel reads.
+type matrixSync struct {
+	NextBatch string `json:"next_batch"`
+	ToDevice  struct {
+		Events []matrixEvent `json:"events"`
+	} `json:"to_device"`
+	DeviceLists struct {
+		Changed []string `json:"changed"`
+	} `json:"device_lists"`
+	OneTimeKeyCounts map[string]int `json:"device_one_time_keys_count"`
+	Rooms            struct {
+		Join map[string]struct {
+			State struct {
+				Events []matrixEvent `json:"events"`
+			} `json:"state"`
+			Timeline struct {
+				Events []matrixEvent `json:"events"`
+			} `json:"timeline"`
+		} `json:"join"`
+		Invite map[string]struct {
+			InviteState struct {
+				Events []matrixEvent `json:"events"`
+			} `json:"invite_state"`
+		} `json:"invite"`
+	} `json:"rooms"`
+}
+
+// syncLoop long-polls /sync until ctx is done. The first sync of a new
+// device only catches up, so old messages are not answered.
+func (c *MatrixChannel) syncLoop(ctx context.Context) {
+	backoff := time.Second
+	for ctx.Err() == nil && c.IsRunning() {
+		c.mu.Lock()
+		since := c.store.NextBatch
+		c.mu.Unlock()
+
+		query := url.Values{"filter": {matrixSyncFilter}}
+		if since != "" {
+			query.Set("since", since)
+			query.Set("timeout", fmt.Sprintf("%d", matrixSyncTimeout.Milliseconds()))
+		}
+		var resp matrixSync
+		err := c.api(ctx, http.MethodGet, "/_matrix/client/v3/sync?"+query.Encode(), nil, &resp)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			wait := backoff
+			var mErr *matrixError
+			if errors.As(err, &mErr) && mErr.RetryAfter > 0 {
+				wait = mErr.RetryAfter
+			}
+			logger.WarnCF("matrix", "Sync failed, retrying", map[string]interface{}{
+				"error": err.Error(),
+				"in":    wait.String(),
+			})
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return
+			}
+			backoff = min(backoff*2, 5*time.Minute)
+			continue
+		}
+		backoff = time.Second
+		c.handleSync(ctx, &resp, since == "")
+	}
+}
+
+// handleSync processes one sync response: room keys first, so messages
+// in the same response can be decrypted, then invites and messages.
+func (c *MatrixChannel) handleSync(ctx context.Context, resp *matrixSync, initial bool) {
+	c.mu.Lock()
+	var messages []matrixMessage
+	if c.crypto != nil {
+		c.crypto.deviceListsChanged(resp.DeviceLists.Changed)
+		gotKeys := false
+		for _, ev := range resp.ToDevice.Events {
+			if ev.Type != "m.room.encrypted" {
+				continue
+			}
+			sessionID, err := c.crypto.handleToDevice(ev.Sender, ev.Content)
+			if err != nil {
+				logger.WarnCF("matrix", "Failed to decrypt to-device event", map[string]interface{}{
+					"sender": ev.Sender,
+					"error":  err.Error(),
+				})
+			}
+			gotKeys = gotKeys || sessionID != ""
+		}
+		if count, ok := resp.OneTimeKeyCounts["signed_curve25519"]; ok {
+			if err := c.crypto.uploadKeys(ctx, count); err != nil {
+				logger.WarnCF("matrix", "Failed to upload one-time keys", map[string]interface{}{
+					"error": err.Error(),
+				})
+			}
+		}
+		if gotKeys {
+			messages = append(messages, c.retryPending()...)
+		}
+	}
+
+	for roomID, room := range resp.Rooms.Join {
+		for _, ev := range append(room.State.Events, room.Timeline.Events...) {
+			if ev.Type == "m.room.encryption" && ev.StateKey != nil && c.crypto != nil {
+				c.crypto.state.Rooms[roomID] = true
+			}
+		}
+		if initial {
+			continue
+		}
+		for _, ev := range room.Timeline.Events {
+			if msg, ok := c.readEvent(roomID, ev); ok {
+				messages = append(messages, msg)
+			}
+		}
+	}
+	c.store.NextBatch = resp.NextBatch
+	if err := c.store.save(); err != nil {
+		logger.ErrorCF("matrix", "Failed to save sync state", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	c.mu.Unlock()
+
+	for roomID, invite := range resp.Rooms.Invite {
+		c.handleInvite(ctx, roomID, invite.InviteState.Events)
+	}
+	for _, msg := range messages {
+		c.handleMessage(ctx, msg)
+	}
+}
+
+// matrixMessage is a decrypted m.room.message event.
+type matrixMessage struct {
+	roomID  string
+	eventID string
+	sender  string
+	content json.RawMessage
+}
+
+// readEvent returns the message in a timeline event, decrypting it if
+// needed. Encrypted events whose key is missing are held for later.
+// Callers hold c.mu.
+func (c *MatrixChannel) readEvent(roomID string, ev matrixEvent) (matrixMessage, bool) {
+	if ev.Sender == c.store.UserID {
+		return matrixMessage{}, false
+	}
+	evType, content := ev.Type, ev.Content
+	if evType == "m.room.encrypted" {
+		if c.crypto == nil {
+			return matrixMessage{}, false
+		}
+		var err error
+		evType, content, err = c.crypto.decryptRoomEvent(roomID, ev.Content)
+		if errors.Is(err, errMissingRoomKey) {
+			c.pending = append(c.pending, matrixPending{roomID: roomID, event: ev, received: time.Now()})
+			if len(c.pending) > matrixPendingLimit {
+				c.pending = c.pending[1:]
+			}
+			return matrixMessage{}, false
+		}
+		if err != nil {
+			logger.WarnCF("matrix", "Failed to decrypt room event", map[string]interface{}{
+				"room_id":  roomID,
+				"event_id": ev.EventID,
+				"error":    err.Error(),
+			})
+			return matrixMessage{}, false
+		}
+	}
+	if evType != "m.room.message" {
+		return matrixMessage{}, false
+	}
+	return matrixMessage{roomID: roomID, eventID: ev.EventID, sender: ev.Sender, content: content}, true
+}
+
+// retryPending decrypts held events whose room keys may have arrived.
+// Callers hold c.mu.
+func (c *MatrixChannel) retryPending() []matrixMessage {
+	pending := c.pending
+	c.pending = nil
+	var messages []matrixMessage
+	for _, p := range pending {
+		if time.Since(p.received) > matrixPendingAge {
+			continue
+		}
+		if msg, ok := c.readEvent(p.roomID, p.event); ok {
+			messages = append(messages, msg)
+		}
+	}
+	return messages
+}
+
+// handleInvite joins rooms an allowed user invited the bot to.
+func (c *MatrixChannel) handleInvite(ctx context.Context, roomID string, state []matrixEvent) {
+	inviter := ""
+	for _, ev := range state {
+		if ev.Type == "m.room.member" && ev.StateKey != nil && *ev.StateKey == c.store.UserID {
+			inviter = ev.Sender
+		}
+	}
+	if !c.roomAllowed(roomID) || !c.HasAllowList() || !c.IsAllowed(inviter) {
+		logger.DebugCF("matrix", "Invite not accepted", map[string]interface{}{
+			"room_id": roomID,
+			"inviter": inviter,
+		})
+		return
+	}
+	if err := c.api(ctx, http.MethodPost, "/_matrix/client/v3/join/"+pathEscape(roomID), map[string]interface{}{}, nil); err != nil {
+		logger.ErrorCF("matrix", "Failed to join room", map[string]interface{}{
+			"room_id": roomID,
+			"error":   err.Error(),
+		})
+		return
+	}
+	logger.InfoCF("matrix", "Joined room", map[string]interface{}{
+		"room_id": roomID,
+		"inviter": inviter,
+	})
+}
+
+func (c *MatrixChannel) roomAllowed(roomID string) bool {
+	return len(c.config.AllowRooms) == 0 || slices.Contains(c.config.AllowRooms, roomID)
+}
+
+// matrixMessageContent is the content of an m.room.message event.
+type matrixMessageContent struct {
+	MsgType string                 `json:"msgtype"`
+	Body    string                 `json:"body"`
+	URL     string                 `json:"url"`
+	File    *matrixFile            `json:"file"`
+	Info    map[string]interface{} `json:"info"`
+}
+
+// matrixFile describes an attachment encrypted on the client, as sent in
+// encrypted rooms.
+type matrixFile struct {
+	URL    string            `json:"url"`
+	Key    matrixJWK         `json:"key"`
+	IV     string            `json:"iv"`
+	Hashes map[string]string `json:"hashes"`
+	V      string            `json:"v"`
+}
+
+type matrixJWK struct {
+	Kty    string   `json:"kty"`
+	KeyOps []string `json:"key_ops"`
+	Alg    string   `json:"alg"`
+	K      string   `json:"k"`
+	Ext    bool     `json:"ext"`
+}
+
+// replyFallback matches the quoted original that clients put in front of
+// a reply's body.
+var replyFallback = regexp.MustCompile(`^(?:>.*\n)+\n`)
+
+func (c *MatrixChannel) handleMessage(ctx context.Context, msg matrixMessage) {
+	if !c.roomAllowed(msg.roomID) {
+		return
+	}
+	if !c.IsAllowed(msg.sender) {
+		logger.DebugCF("matrix", "Message rejected by allowlist", map[string]interface{}{
+			"sender": msg.sender,
+		})
+		return
+	}
+	if !c.Admit(msg.sender, msg.roomID, msg.eventID) {
+		return
+	}
+	var content matrixMessageContent
+	if err := json.Unmarshal(msg.content, &content); err != nil {
+		return
+	}
+
+	text := ""
+	var media []string
+	switch content.MsgType {
+	case "m.text", "m.notice", "m.emote":
+		text = replyFallback.ReplaceAllString(content.Body, "")
+	case "m.image", "m.file", "m.audio", "m.video":
+		if path := c.downloadMedia(ctx, content); path != "" {
+			media = append(media, path)
+		}
+		kind := strings.TrimPrefix(content.MsgType, "m.")
+		text = fmt.Sprintf("[%s: %s]", kind, content.Body)
+	default:
+		return
+	}
+
+	logger.DebugCF("matrix", "Received message", map[string]interface{}{
+		"sender_id": msg.sender,
+		"chat_id":   msg.roomID,
+		"preview":   utils.Truncate(text, 50),
+	})
+	c.setTyping(ctx, msg.roomID, true)
+
+	c.HandleMessage(msg.sender, msg.roomID, text, media, map[string]string{
+		"message_id": msg.eventID,
+		"user_id":    msg.sender,
+	})
+}
+
+func (c *MatrixChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("matrix client not running")
+	}
+	if !strings.HasPrefix(msg.ChatID, "!") {
+		return Permanent(fmt.Errorf("invalid room ID %q", msg.ChatID))
+	}
+	c.setTyping(ctx, msg.ChatID, false)
+
+	if strings.TrimSpace(msg.Content) != "" {
+		content := map[string]interface{}{
+			"msgtype":        "m.text",
+			"body":           msg.Content,
+			"format":         "org.matrix.custom.html",
+			"formatted_body": markdownToMatrixHTML(msg.Content),
+		}
+		if err := c.sendEvent(ctx, msg.ChatID, content); err != nil {
+			return err
+		}
+	}
+	for _, path := range msg.Media {
+		content, err := c.uploadMedia(ctx, msg.ChatID, path)
+		if err == nil {
+			err = c.sendEvent(ctx, msg.ChatID, content)
+		}
+		if err != nil {
+			logger.ErrorCF("matrix", "Failed to send attachment", map[string]interface{}{
+				"path":  path,
+				"error": err.Error(),
+			})
+		}
+	}
+	return nil
+}
+
+// sendEvent sends an m.room.message, encrypted if the room is.
+func (c *MatrixChannel) sendEvent(ctx context.Context, roomID string, content map[string]interface{}) error {
+	evType := "m.room.message"
+	var body interface{} = content
+	c.mu.Lock()
+	if c.encrypted(roomID) {
+		enc, err := c.crypto.encryptRoomEvent(ctx, roomID, evType, content)
+		if err != nil {
+			c.mu.Unlock()
+			return fmt.Errorf("encrypting message: %w", err)
+		}
+		evType, body = "m.room.encrypted", enc
+	}
+	c.mu.Unlock()
+	path := fmt.Sprintf("/_matrix/client/v3/rooms/%s/send/%s/%s", pathEscape(roomID), evType, newTxnID())
+	return c.api(ctx, http.MethodPut, path, body, nil)
+}
+
+// encrypted reports whether roomID has encryption on. Callers hold c.mu.
+func (c *MatrixChannel) encrypted(roomID string) bool {
+	return c.crypto != nil && c.crypto.state.Rooms[roomID]
+}
+
+func (c *MatrixChannel) setTyping(ctx context.Context, roomID string, typing bool) {
+	path := fmt.Sprintf("/_matrix/client/v3/rooms/%s/typing/%s", pathEscape(roomID), pathEscape(c.store.UserID))
+	body := map[string]interface{}{"typing": typing}
+	if typing {
+		body["timeout"] = 120000
+	}
+	if err := c.api(ctx, http.MethodPut, path, body, nil); err != nil {
+		logger.DebugCF("matrix", "Failed to set typing", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+// downloadMedia saves an attachment to the media directory, decrypting it
+// if it was encrypted, and returns its path or "" on failure.
+func (c *MatrixChannel) downloadMedia(ctx context.Context, content matrixMessageContent) string {
+	mxc := content.URL
+	if content.File != nil {
+		mxc = content.File.URL
+	}
+	server, mediaID, ok := strings.Cut(strings.TrimPrefix(mxc, "mxc://"), "/")
+	if !ok || !strings.HasPrefix(mxc, "mxc://") {
+		return ""
+	}
+	data, err := c.fetch(ctx, "/_matrix/client/v1/media/download/"+pathEscape(server)+"/"+pathEscape(mediaID))
+	if err == nil && content.File != nil {
+		data, err = decryptAttachment(data, content.File)
+	}
+	if err != nil {
+		logger.ErrorCF("matrix", "Failed to download attachment", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return ""
+	}
+
+	dir := utils.MediaDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return ""
+	}
+	name := uuid.New().String()[:8] + "_" + utils.SanitizeFilename(content.Body)
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return ""
+	}
+	return path
+}
+
+// uploadMedia uploads a local file, encrypting it first in encrypted
+// rooms, and returns the message content that shares it.
+func (c *MatrixChannel) uploadMedia(ctx context.Context, roomID, path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	name := filepath.Base(path)
+	mimeType := mime.TypeByExtension(filepath.Ext(path))
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	msgType := "m.file"
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		msgType = "m.image"
+	case strings.HasPrefix(mimeType, "audio/"):
+		msgType = "m.audio"
+	case strings.HasPrefix(mimeType, "video/"):
+		msgType = "m.video"
+	}
+
+	c.mu.Lock()
+	encrypted := c.encrypted(roomID)
+	c.mu.Unlock()
+	var file *matrixFile
+	uploadType := mimeType
+	if encrypted {
+		data, file, err = encryptAttachment(data)
+		if err != nil {
+			return nil, err
+		}
+		uploadType = "application/octet-stream"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		c.config.Homeserver+"/_matrix/media/v3/upload?filename="+url.QueryEscape(name), bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", uploadType)
+	var uploaded struct {
+		ContentURI string `json:"content_uri"`
+	}
+	if err := c.do(req, &uploaded); err != nil {
+		return nil, err
+	}
+
+	content := map[string]interface{}{
+		"msgtype": msgType,
+		"body":    name,
+		"info":    map[string]interface{}{"mimetype": mimeType, "size": len(data)},
+	}
+	if file != nil {
+		file.URL = uploaded.ContentURI
+		content["file"] = file
+	} else {
+		content["url"] = uploaded.ContentURI
+	}
+	return content, nil
+}
+
+// decryptAttachment checks an encrypted attachment's hash and decrypts it
+// with AES-256-CTR.
+func decryptAttachment(data []byte, f *matrixFile) ([]byte, error) {
+	key, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(f.Key.K, "="))
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("invalid attachment key")
+	}
+	iv, err := olm.Decode(f.IV)
+	if err != nil || len(iv) != aes.BlockSize {
+		return nil, errors.New("invalid attachment IV")
+	}
+	sum := sha256.Sum256(data)
+	if want := f.Hashes["sha256"]; want == "" || strings.TrimRight(want, "=") != olm.Encode(sum[:]) {
+		return nil, errors.New("attachment hash does not match")
+	}
+	block, _ := aes.NewCipher(key)
+	out := make([]byte, len(data))
+	cipher.NewCTR(block, iv).XORKeyStream(out, data)
+	return out, nil
+}
+
+// encryptAttachment encrypts data with a new key for upload to an
+// encrypted room. The returned file lacks only its URL.
+func encryptAttachment(data []byte) ([]byte, *matrixFile, error) {
+	key := make([]byte, 32)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, nil, err
+	}
+	// The counter half of the IV starts at zero, as the spec recommends
+	if _, err := rand.Read(iv[:8]); err != nil {
+		return nil, nil, err
+	}
+	block, _ := aes.NewCipher(key)
+	out := make([]byte, len(data))
+	cipher.NewCTR(block, iv).XORKeyStream(out, data)
+	sum := sha256.Sum256(out)
+	return out, &matrixFile{
+		Key: matrixJWK{
+			Kty:    "oct",
+			KeyOps: []string{"encrypt", "decrypt"},
+			Alg:    "A256CTR",
+			K:      base64.RawURLEncoding.EncodeToString(key),
+			Ext:    true,
+		},
+		IV:     olm.Encode(iv),
+		Hashes: map[string]string{"sha256": olm.Encode(sum[:])},
+		V:      "v2",
+	}, nil
+}
+
+// matrixError is an error response from the homeserver.
+type matrixError struct {
+	Status     int
+	Code       string `json:"errcode"`
+	Message    string `json:"error"`
+	RetryAfter time.Duration
+}
+
+func (e *matrixError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.Status, e.Code, e.Message)
+}
+
+// api calls a client-server API endpoint with a JSON body and decodes the
+// JSON reply into out, which may be nil.
+func (c *MatrixChannel) api(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.config.Homeserver+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return c.do(req, out)
+}
+
+// fetch downloads a binary resource.
+func (c *MatrixChannel) fetch(ctx context.Context, path string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.config.Homeserver+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	return data, c.do(req, &data)
+}
+
+// do sends an authenticated request. out may be a *[]byte for the raw
+// body. Rejections that retrying won't fix are marked permanent.
+func (c *MatrixChannel) do(req *http.Request, out interface{}) error {
+	token := c.config.AccessToken
+	if token == "" {
+		token = c.store.AccessToken
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		mErr := &matrixError{Status: resp.StatusCode}
+		var body struct {
+			Code         string `json:"errcode"`
+			Message      string `json:"error"`
+			RetryAfterMS int64  `json:"retry_after_ms"`
+		}
+		if json.Unmarshal(data, &body) == nil {
+			mErr.Code, mErr.Message = body.Code, body.Message
+			mErr.RetryAfter = time.Duration(body.RetryAfterMS) * time.Millisecond
+		}
+		if resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusNotFound ||
+			resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized {
+			return Permanent(mErr)
+		}
+		return mErr
+	}
+	if raw, ok := out.(*[]byte); ok {
+		*raw = data
+		return nil
+	}
+	if out != nil {
+		return json.Unmarshal(data, out)
+	}
+	return nil
+}
+
+func pathEscape(s string) string {
+	return url.PathEscape(s)
+}
+
+func newTxnID() string {
+	return "picoclaw-" + uuid.New().String()
+}
+
+var (
+	matrixCodeBlock  = regexp.MustCompile("(?s)```[a-zA-Z0-9_+-]*\n?(.*?)```")
+	matrixInlineCode = regexp.MustCompile("`([^`\n]+)`")
+	matrixBold       = regexp.MustCompile(`\*\*(.+?)\*\*`)
+	matrixItalic     = regexp.MustCompile(`(^|[^*\w])[*_]([^*_\n]+)[*_]`)
+	matrixLink       = regexp.MustCompile(`\[([^\]]+)\]\((https?://[^)\s"]+)\)`)
+	matrixHeading    = regexp.MustCompile(`(?m)^#{1,6}\s+(.+)$`)
+)
+
+// markdownToMatrixHTML renders the model's markdown as the HTML subset
+// Matrix clients display. Code is escaped and otherwise left alone.
+func markdownToMatrixHTML(text string) string {
+	var codes []string
+	hold := func(s string) string {
+		codes = append(codes, s)
+		return fmt.Sprintf("\x00%d\x00", len(codes)-1)
+	}
+	text = matrixCodeBlock.ReplaceAllStringFunc(text, func(m string) string {
+		code := matrixCodeBlock.FindStringSubmatch(m)[1]
+		return hold("<pre><code>" + html.EscapeString(code) + "</code></pre>")
+	})
+	text = matrixInlineCode.ReplaceAllStringFunc(text, func(m string) string {
+		return hold("<code>" + html.EscapeString(matrixInlineCode.FindStringSubmatch(m)[1]) + "</code>")
+	})
+
+	text = html.EscapeString(text)
+	text = matrixHeading.ReplaceAllString(text, "<strong>$1</strong>")
+	text = matrixBold.ReplaceAllString(text, "<strong>$1</strong>")
+	text = matrixItalic.ReplaceAllString(text, "$1<em>$2</em>")
+	text = matrixLink.ReplaceAllString(text, `<a href="$2">$1</a>`)
+	text = strings.ReplaceAll(text, "\n", "<br>")
+
+	for i, code := range codes {
+		text = strings.Replace(text, fmt.Sprintf("\x00%d\x00", i), code, 1)
+	}
+	return text
+}
@@ -0,0 +1,749 @@
+//go:build !nomatrix
+
+package channels
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/olm"
+)
+
+// Matrix encryption algorithm names.
+const (
+	algorithmOlm    = "m.olm.v1.curve25519-aes-sha2"
+	algorithmMegolm = "m.megolm.v1.aes-sha2"
+)
+
+// Outbound room sessions are replaced after this many messages or this
+// long, the defaults of m.room.encryption.
+const (
+	megolmRotationMessages = 100
+	megolmRotationPeriod   = 7 * 24 * time.Hour
+)
+
+// olmSessionsPerDevice bounds the Olm sessions kept with one device.
+const olmSessionsPerDevice = 10
+
+// errMissingRoomKey means the sender's room key has not arrived yet; it
+// usually comes in a later sync.
+var errMissingRoomKey = errors.New("room key not received yet")
+
+// matrixCryptoState is the persisted part of the encryption state.
+type matrixCryptoState struct {
+	Account      *olm.Account                       `json:"account,omitempty"`
+	KeysUploaded bool                               `json:"keys_uploaded"`
+	OlmSessions  map[string][]*olm.Session          `json:"olm_sessions"` // by device Curve25519 key, last used first
+	Inbound      map[string]*matrixInboundSession   `json:"inbound_sessions"`
+	Outbound     map[string]*matrixOutbound         `json:"outbound_sessions"` // by room ID
+	Rooms        map[string]bool                    `json:"encrypted_rooms"`
+	Devices      map[string]map[string]matrixDevice `json:"devices"` // by user, then device ID
+}
+
+// matrixInboundSession is a room key another device shared with us.
+type matrixInboundSession struct {
+	Session    *olm.InboundGroupSession `json:"session"`
+	RoomID     string                   `json:"room_id"`
+	SenderKey  string                   `json:"sender_key"`
+	SigningKey string                   `json:"signing_key"` // the sender's claimed Ed25519 key
+}
+
+// matrixOutbound is the room session this device encrypts with, and the
+// devices (by Curve25519 key) its key has been sent to.
+type matrixOutbound struct {
+	Session    *olm.OutboundGroupSession `json:"session"`
+	Messages   int                       `json:"messages"`
+	SharedWith map[string]bool           `json:"shared_with"`
+}
+
+// matrixDevice is a device's verified identity keys.
+type matrixDevice struct {
+	UserID   string `json:"user_id"`
+	DeviceID string `json:"device_id"`
+	Curve    string `json:"curve25519"`
+	Ed25519  string `json:"ed25519"`
+}
+
+// matrixAPI calls a client-server API endpoint; see MatrixChannel.api.
+type matrixAPI func(ctx context.Context, method, path string, body, out interface{}) error
+
+// matrixCrypto encrypts and decrypts for one device: it publishes the
+// device's keys, keeps Olm sessions with other devices to exchange room
+// keys, and Megolm sessions per room for the messages themselves. Callers
+// hold the channel's lock, which also guards state.
+type matrixCrypto struct {
+	api      matrixAPI
+	userID   string
+	deviceID string
+	state    *matrixCryptoState
+	save     func() error
+
+	outdated  map[string]bool      // users whose device list changed
+	noSession map[string]time.Time // devices without one-time keys, by Curve25519 key
+}
+
+func newMatrixCrypto(api matrixAPI, userID, deviceID string, state *matrixCryptoState, save func() error) *matrixCrypto {
+	if state.OlmSessions == nil {
+		state.OlmSessions = make(map[string][]*olm.Session)
+	}
+	if state.Inbound == nil {
+		state.Inbound = make(map[string]*matrixInboundSession)
+	}
+	if state.Outbound == nil {
+		state.Outbound = make(map[string]*matrixOutbound)
+	}
+	if state.Rooms == nil {
+		state.Rooms = make(map[string]bool)
+	}
+	if state.Devices == nil {
+		state.Devices = make(map[string]map[string]matrixDevice)
+	}
+	return &matrixCrypto{
+		api:       api,
+		userID:    userID,
+		deviceID:  deviceID,
+		state:     state,
+		save:      save,
+		outdated:  make(map[string]bool),
+		noSession: make(map[string]time.Time),
+	}
+}
+
+// setup creates the device's account on first use and publishes its keys.
+func (m *matrixCrypto) setup(ctx context.Context) error {
+	if m.state.Account == nil {
+		account, err := olm.NewAccount()
+		if err != nil {
+			return err
+		}
+		m.state.Account = account
+		m.state.KeysUploaded = false
+		if err := m.save(); err != nil {
+			return err
+		}
+	}
+	if !m.state.KeysUploaded {
+		return m.uploadKeys(ctx, 0)
+	}
+	return nil
+}
+
+func (m *matrixCrypto) identityKeys() (curve, ed string) {
+	return m.state.Account.IdentityKeys()
+}
+
+// sign adds this device's signature to obj.
+func (m *matrixCrypto) sign(obj map[string]interface{}) error {
+	data, err := canonicalJSON(obj)
+	if err != nil {
+		return err
+	}
+	obj["signatures"] = map[string]interface{}{
+		m.userID: map[string]string{"ed25519:" + m.deviceID: m.state.Account.Sign(data)},
+	}
+	return nil
+}
+
+// uploadKeys publishes the device keys if they haven't been, and tops the
+// one-time keys on the server up to half of what the account can hold.
+func (m *matrixCrypto) uploadKeys(ctx context.Context, serverCount int) error {
+	account := m.state.Account
+	target := account.MaxOneTimeKeys() / 2
+	if m.state.KeysUploaded && serverCount >= target {
+		return nil
+	}
+	if n := target - serverCount - len(account.UnpublishedOneTimeKeys()); n > 0 {
+		if err := account.GenerateOneTimeKeys(n); err != nil {
+			return err
+		}
+	}
+
+	body := map[string]interface{}{}
+	if !m.state.KeysUploaded {
+		curve, ed := m.identityKeys()
+		keys := map[string]interface{}{
+			"user_id":    m.userID,
+			"device_id":  m.deviceID,
+			"algorithms": []string{algorithmOlm, algorithmMegolm},
+			"keys": map[string]string{
+				"curve25519:" + m.deviceID: curve,
+				"ed25519:" + m.deviceID:    ed,
+			},
+		}
+		if err := m.sign(keys); err != nil {
+			return err
+		}
+		body["device_keys"] = keys
+	}
+	otks := map[string]interface{}{}
+	for id, key := range account.UnpublishedOneTimeKeys() {
+		obj := map[string]interface{}{"key": key}
+		if err := m.sign(obj); err != nil {
+			return err
+		}
+		otks["signed_curve25519:"+id] = obj
+	}
+	body["one_time_keys"] = otks
+
+	if err := m.api(ctx, http.MethodPost, "/_matrix/client/v3/keys/upload", body, nil); err != nil {
+		return fmt.Errorf("uploading keys: %w", err)
+	}
+	account.MarkKeysAsPublished()
+	m.state.KeysUploaded = true
+	logger.DebugCF("matrix", "Uploaded encryption keys", map[string]interface{}{
+		"one_time_keys": len(otks),
+	})
+	return m.save()
+}
+
+// deviceListsChanged marks users whose devices must be fetched again.
+func (m *matrixCrypto) deviceListsChanged(users []string) {
+	for _, u := range users {
+		m.outdated[u] = true
+	}
+}
+
+// handleToDevice decrypts an Olm-encrypted to-device event and stores the
+// room key it carries. It returns the room key's session ID, if any.
+func (m *matrixCrypto) handleToDevice(sender string, content json.RawMessage) (string, error) {
+	var enc struct {
+		Algorithm  string `json:"algorithm"`
+		SenderKey  string `json:"sender_key"`
+		Ciphertext map[string]struct {
+			Type int    `json:"type"`
+			Body string `json:"body"`
+		} `json:"ciphertext"`
+	}
+	if err := json.Unmarshal(content, &enc); err != nil {
+		return "", err
+	}
+	if enc.Algorithm != algorithmOlm {
+		return "", fmt.Errorf("unsupported algorithm %q", enc.Algorithm)
+	}
+	curve, ed := m.identityKeys()
+	ct, ok := enc.Ciphertext[curve]
+	if !ok {
+		return "", fmt.Errorf("not encrypted for this device")
+	}
+	body, err := olm.Decode(ct.Body)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := m.decryptOlm(enc.SenderKey, ct.Type, body)
+	if err != nil {
+		return "", err
+	}
+
+	var payload struct {
+		Type          string            `json:"type"`
+		Sender        string            `json:"sender"`
+		Recipient     string            `json:"recipient"`
+		RecipientKeys map[string]string `json:"recipient_keys"`
+		Keys          map[string]string `json:"keys"`
+		Content       json.RawMessage   `json:"content"`
+	}
+	if err := json.Unmarshal(plaintext, &payload); err != nil {
+		return "", err
+	}
+	if payload.Sender != sender || payload.Recipient != m.userID || payload.RecipientKeys["ed25519"] != ed {
+		return "", fmt.Errorf("to-device payload is addressed wrongly")
+	}
+	if payload.Type != "m.room_key" {
+		return "", nil
+	}
+
+	var key struct {
+		Algorithm  string `json:"algorithm"`
+		RoomID     string `json:"room_id"`
+		SessionID  string `json:"session_id"`
+		SessionKey string `json:"session_key"`
+	}
+	if err := json.Unmarshal(payload.Content, &key); err != nil {
+		return "", err
+	}
+	if key.Algorithm != algorithmMegolm {
+		return "", nil
+	}
+	session, err := olm.NewInboundGroupSession(key.SessionKey)
+	if err != nil {
+		return "", err
+	}
+	if session.ID() != key.SessionID {
+		return "", fmt.Errorf("room key does not match its session ID")
+	}
+	id := key.RoomID + "|" + key.SessionID
+	if old, ok := m.state.Inbound[id]; ok && old.Session.FirstKnownIndex() <= session.FirstKnownIndex() {
+		return key.SessionID, nil // already have it from as early or earlier
+	}
+	m.state.Inbound[id] = &matrixInboundSession{
+		Session:    session,
+		RoomID:     key.RoomID,
+		SenderKey:  enc.SenderKey,
+		SigningKey: payload.Keys["ed25519"],
+	}
+	logger.DebugCF("matrix", "Received room key", map[string]interface{}{
+		"room_id": key.RoomID,
+		"sender":  sender,
+	})
+	return key.SessionID, m.save()
+}
+
+// decryptOlm tries the sessions with the sending device, and starts a new
+// one for a pre-key message none of them match.
+func (m *matrixCrypto) decryptOlm(senderKey string, msgType int, body []byte) ([]byte, error) {
+	sessions := m.state.OlmSessions[senderKey]
+	for i, s := range sessions {
+		if msgType == olm.MessageTypePreKey && !s.MatchesInbound(body) {
+			continue
+		}
+		plaintext, err := s.Decrypt(msgType, body)
+		if err != nil {
+			if msgType == olm.MessageTypePreKey {
+				return nil, err
+			}
+			continue
+		}
+		m.useSession(senderKey, i)
+		return plaintext, m.save()
+	}
+	if msgType != olm.MessageTypePreKey {
+		return nil, fmt.Errorf("no Olm session with %s can decrypt this", senderKey)
+	}
+
+	if claimed, err := olm.PreKeyIdentity(body); err != nil || claimed != senderKey {
+		return nil, fmt.Errorf("pre-key message is not from the sender key")
+	}
+	s, err := m.state.Account.NewInboundSession(body)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := s.Decrypt(msgType, body)
+	if err != nil {
+		return nil, err
+	}
+	m.addSession(senderKey, s)
+	return plaintext, m.save()
+}
+
+// useSession moves the i-th session with a device to the front, where
+// sending looks first.
+func (m *matrixCrypto) useSession(curve string, i int) {
+	sessions := m.state.OlmSessions[curve]
+	s := sessions[i]
+	copy(sessions[1:i+1], sessions[:i])
+	sessions[0] = s
+}
+
+func (m *matrixCrypto) addSession(curve string, s *olm.Session) {
+	sessions := append([]*olm.Session{s}, m.state.OlmSessions[curve]...)
+	if len(sessions) > olmSessionsPerDevice {
+		sessions = sessions[:olmSessionsPerDevice]
+	}
+	m.state.OlmSessions[curve] = sessions
+}
+
+// decryptRoomEvent decrypts an m.room.encrypted room event, returning the
+// original event type and content.
+func (m *matrixCrypto) decryptRoomEvent(roomID string, content json.RawMessage) (string, json.RawMessage, error) {
+	var enc struct {
+		Algorithm  string `json:"algorithm"`
+		SenderKey  string `json:"sender_key"`
+		SessionID  string `json:"session_id"`
+		Ciphertext string `json:"ciphertext"`
+	}
+	if err := json.Unmarshal(content, &enc); err != nil {
+		return "", nil, err
+	}
+	if enc.Algorithm != algorithmMegolm {
+		return "", nil, fmt.Errorf("unsupported algorithm %q", enc.Algorithm)
+	}
+	in, ok := m.state.Inbound[roomID+"|"+enc.SessionID]
+	if !ok {
+		return "", nil, errMissingRoomKey
+	}
+	if enc.SenderKey != "" && enc.SenderKey != in.SenderKey {
+		return "", nil, fmt.Errorf("event sender key does not match its room key")
+	}
+	ciphertext, err := olm.Decode(enc.Ciphertext)
+	if err != nil {
+		return "", nil, err
+	}
+	plaintext, _, err := in.Session.Decrypt(ciphertext)
+	if err != nil {
+		return "", nil, err
+	}
+	var payload struct {
+		Type    string          `json:"type"`
+		RoomID  string          `json:"room_id"`
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(plaintext, &payload); err != nil {
+		return "", nil, err
+	}
+	if payload.RoomID != roomID {
+		return "", nil, fmt.Errorf("event was encrypted for another room")
+	}
+	return payload.Type, payload.Content, m.save()
+}
+
+// encryptRoomEvent encrypts an event for roomID, first sending the room
+// key to any member device that doesn't have it yet.
+func (m *matrixCrypto) encryptRoomEvent(ctx context.Context, roomID, evType string, content interface{}) (map[string]interface{}, error) {
+	devices, err := m.roomDevices(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	current := make(map[string]bool, len(devices))
+	for _, d := range devices {
+		current[d.Curve] = true
+	}
+
+	out := m.state.Outbound[roomID]
+	rotate := out == nil || out.Messages >= megolmRotationMessages ||
+		time.Since(out.Session.Created) > megolmRotationPeriod
+	if out != nil && !rotate {
+		// Someone left: they must not read what comes next
+		for curve := range out.SharedWith {
+			if !current[curve] {
+				rotate = true
+				break
+			}
+		}
+	}
+	if rotate {
+		session, err := olm.NewOutboundGroupSession()
+		if err != nil {
+			return nil, err
+		}
+		out = &matrixOutbound{Session: session, SharedWith: make(map[string]bool)}
+		m.state.Outbound[roomID] = out
+	}
+
+	var missing []matrixDevice
+	for _, d := range devices {
+		if !out.SharedWith[d.Curve] {
+			missing = append(missing, d)
+		}
+	}
+	if len(missing) > 0 {
+		if err := m.shareRoomKey(ctx, roomID, out, missing); err != nil {
+			return nil, err
+		}
+	}
+
+	plaintext, err := json.Marshal(map[string]interface{}{
+		"type":    evType,
+		"content": content,
+		"room_id": roomID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	ciphertext := out.Session.Encrypt(plaintext)
+	out.Messages++
+	if err := m.save(); err != nil {
+		return nil, err
+	}
+	curve, _ := m.identityKeys()
+	return map[string]interface{}{
+		"algorithm":  algorithmMegolm,
+		"sender_key": curve,
+		"ciphertext": olm.Encode(ciphertext),
+		"session_id": out.Session.ID(),
+		"device_id":  m.deviceID,
+	}, nil
+}
+
+// roomDevices returns the devices of the room's joined members, except
+// this one.
+func (m *matrixCrypto) roomDevices(ctx context.Context, roomID string) ([]matrixDevice, error) {
+	var members struct {
+		Joined map[string]json.RawMessage `json:"joined"`
+	}
+	if err := m.api(ctx, http.MethodGet, "/_matrix/client/v3/rooms/"+pathEscape(roomID)+"/joined_members", nil, &members); err != nil {
+		return nil, fmt.Errorf("listing room members: %w", err)
+	}
+	users := make([]string, 0, len(members.Joined))
+	for u := range members.Joined {
+		users = append(users, u)
+	}
+	sort.Strings(users)
+	if err := m.updateDevices(ctx, users); err != nil {
+		return nil, err
+	}
+
+	var devices []matrixDevice
+	for _, u := range users {
+		for _, d := range m.state.Devices[u] {
+			if u == m.userID && d.DeviceID == m.deviceID {
+				continue
+			}
+			devices = append(devices, d)
+		}
+	}
+	return devices, nil
+}
+
+// updateDevices fetches the device keys of users not known yet or whose
+// devices changed, keeping only devices whose keys are self-signed.
+func (m *matrixCrypto) updateDevices(ctx context.Context, users []string) error {
+	query := map[string][]string{}
+	for _, u := range users {
+		if _, known := m.state.Devices[u]; !known || m.outdated[u] {
+			query[u] = []string{}
+		}
+	}
+	if len(query) == 0 {
+		return nil
+	}
+	var resp struct {
+		DeviceKeys map[string]map[string]json.RawMessage `json:"device_keys"`
+	}
+	if err := m.api(ctx, http.MethodPost, "/_matrix/client/v3/keys/query", map[string]interface{}{"device_keys": query}, &resp); err != nil {
+		return fmt.Errorf("querying device keys: %w", err)
+	}
+	for u := range query {
+		known := m.state.Devices[u]
+		devices := make(map[string]matrixDevice)
+		for deviceID, raw := range resp.DeviceKeys[u] {
+			d, err := verifyDeviceKeys(u, deviceID, raw)
+			if err != nil {
+				logger.WarnCF("matrix", "Ignoring device with invalid keys", map[string]interface{}{
+					"user_id":   u,
+					"device_id": deviceID,
+					"error":     err.Error(),
+				})
+				continue
+			}
+			if old, ok := known[deviceID]; ok && old.Ed25519 != d.Ed25519 {
+				logger.WarnCF("matrix", "Ignoring device whose signing key changed", map[string]interface{}{
+					"user_id":   u,
+					"device_id": deviceID,
+				})
+				d = old
+			}
+			devices[deviceID] = d
+		}
+		m.state.Devices[u] = devices
+		delete(m.outdated, u)
+	}
+	return m.save()
+}
+
+// verifyDeviceKeys checks a device's keys are signed by its own Ed25519
+// key and belong to the user and device they are listed under.
+func verifyDeviceKeys(userID, deviceID string, raw json.RawMessage) (matrixDevice, error) {
+	var keys struct {
+		UserID   string            `json:"user_id"`
+		DeviceID string            `json:"device_id"`
+		Keys     map[string]string `json:"keys"`
+	}
+	if err := json.Unmarshal(raw, &keys); err != nil {
+		return matrixDevice{}, err
+	}
+	if keys.UserID != userID || keys.DeviceID != deviceID {
+		return matrixDevice{}, fmt.Errorf("keys are for %s/%s", keys.UserID, keys.DeviceID)
+	}
+	d := matrixDevice{
+		UserID:   userID,
+		DeviceID: deviceID,
+		Curve:    keys.Keys["curve25519:"+deviceID],
+		Ed25519:  keys.Keys["ed25519:"+deviceID],
+	}
+	if d.Curve == "" || d.Ed25519 == "" {
+		return matrixDevice{}, fmt.Errorf("missing identity keys")
+	}
+	if err := verifySignature(raw, userID, deviceID, d.Ed25519); err != nil {
+		return matrixDevice{}, err
+	}
+	return d, nil
+}
+
+// verifySignature checks the signature by userID's deviceID on a signed
+// JSON object.
+func verifySignature(raw json.RawMessage, userID, deviceID, ed25519Key string) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var obj map[string]interface{}
+	if err := dec.Decode(&obj); err != nil {
+		return err
+	}
+	sigs, _ := obj["signatures"].(map[string]interface{})
+	userSigs, _ := sigs[userID].(map[string]interface{})
+	sig, _ := userSigs["ed25519:"+deviceID].(string)
+	if sig == "" {
+		return fmt.Errorf("not signed by the device")
+	}
+	delete(obj, "signatures")
+	delete(obj, "unsigned")
+	data, err := canonicalJSON(obj)
+	if err != nil {
+		return err
+	}
+	pub, err := olm.Decode(ed25519Key)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid signing key")
+	}
+	sigBytes, err := olm.Decode(sig)
+	if err != nil || !ed25519.Verify(pub, data, sigBytes) {
+		return fmt.Errorf("signature does not verify")
+	}
+	return nil
+}
+
+// shareRoomKey sends the room session's key to devices over Olm, starting
+// Olm sessions with one-time keys where there are none yet. Devices that
+// have no one-time keys left are skipped for an hour.
+func (m *matrixCrypto) shareRoomKey(ctx context.Context, roomID string, out *matrixOutbound, devices []matrixDevice) error {
+	claim := map[string]map[string]string{}
+	for _, d := range devices {
+		if len(m.state.OlmSessions[d.Curve]) == 0 && time.Since(m.noSession[d.Curve]) > time.Hour {
+			if claim[d.UserID] == nil {
+				claim[d.UserID] = map[string]string{}
+			}
+			claim[d.UserID][d.DeviceID] = "signed_curve25519"
+		}
+	}
+	if len(claim) > 0 {
+		var resp struct {
+			OneTimeKeys map[string]map[string]map[string]json.RawMessage `json:"one_time_keys"`
+		}
+		if err := m.api(ctx, http.MethodPost, "/_matrix/client/v3/keys/claim", map[string]interface{}{"one_time_keys": claim}, &resp); err != nil {
+			return fmt.Errorf("claiming one-time keys: %w", err)
+		}
+		for _, d := range devices {
+			if claim[d.UserID][d.DeviceID] == "" {
+				continue
+			}
+			if err := m.startSession(d, resp.OneTimeKeys[d.UserID][d.DeviceID]); err != nil {
+				m.noSession[d.Curve] = time.Now()
+				logger.WarnCF("matrix", "Cannot start an encrypted session with device", map[string]interface{}{
+					"user_id":   d.UserID,
+					"device_id": d.DeviceID,
+					"error":     err.Error(),
+				})
+			}
+		}
+	}
+
+	_, ed := m.identityKeys()
+	roomKey := map[string]interface{}{
+		"algorithm":   algorithmMegolm,
+		"room_id":     roomID,
+		"session_id":  out.Session.ID(),
+		"session_key": out.Session.SessionKey(),
+	}
+	messages := map[string]map[string]interface{}{}
+	var sent []string
+	for _, d := range devices {
+		content, err := m.encryptOlm(d, "m.room_key", roomKey, ed)
+		if err != nil {
+			continue // no session
+		}
+		if messages[d.UserID] == nil {
+			messages[d.UserID] = map[string]interface{}{}
+		}
+		messages[d.UserID][d.DeviceID] = content
+		sent = append(sent, d.Curve)
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+	path := "/_matrix/client/v3/sendToDevice/m.room.encrypted/" + newTxnID()
+	if err := m.api(ctx, http.MethodPut, path, map[string]interface{}{"messages": messages}, nil); err != nil {
+		return fmt.Errorf("sending room key: %w", err)
+	}
+	for _, curve := range sent {
+		out.SharedWith[curve] = true
+	}
+	return m.save()
+}
+
+// startSession starts an Olm session from a claimed one-time key after
+// checking the device signed it.
+func (m *matrixCrypto) startSession(d matrixDevice, keys map[string]json.RawMessage) error {
+	for keyID, raw := range keys {
+		if !strings.HasPrefix(keyID, "signed_curve25519:") {
+			continue
+		}
+		if err := verifySignature(raw, d.UserID, d.DeviceID, d.Ed25519); err != nil {
+			return err
+		}
+		var otk struct {
+			Key string `json:"key"`
+		}
+		if err := json.Unmarshal(raw, &otk); err != nil {
+			return err
+		}
+		s, err := olm.NewOutboundSession(m.state.Account, d.Curve, otk.Key)
+		if err != nil {
+			return err
+		}
+		m.addSession(d.Curve, s)
+		return nil
+	}
+	return fmt.Errorf("no one-time key available")
+}
+
+// encryptOlm encrypts a to-device event for one device.
+func (m *matrixCrypto) encryptOlm(d matrixDevice, evType string, content interface{}, ourEd string) (map[string]interface{}, error) {
+	sessions := m.state.OlmSessions[d.Curve]
+	if len(sessions) == 0 {
+		return nil, fmt.Errorf("no Olm session")
+	}
+	plaintext, err := json.Marshal(map[string]interface{}{
+		"type":           evType,
+		"content":        content,
+		"sender":         m.userID,
+		"sender_device":  m.deviceID,
+		"keys":           map[string]string{"ed25519": ourEd},
+		"recipient":      d.UserID,
+		"recipient_keys": map[string]string{"ed25519": d.Ed25519},
+	})
+	if err != nil {
+		return nil, err
+	}
+	msgType, body, err := sessions[0].Encrypt(plaintext)
+	if err != nil {
+		return nil, err
+	}
+	curve, _ := m.identityKeys()
+	return map[string]interface{}{
+		"algorithm":  algorithmOlm,
+		"sender_key": curve,
+		"ciphertext": map[string]interface{}{
+			d.Curve: map[string]interface{}{"type": msgType, "body": olm.Encode(body)},
+		},
+	}, nil
+}
+
+// canonicalJSON encodes v as Matrix canonical JSON: sorted keys, no
+// whitespace and no HTML escaping.
+func canonicalJSON(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var generic interface{}
+	if err := dec.Decode(&generic); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(generic); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
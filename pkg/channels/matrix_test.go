@@ -0,0 +1,274 @@
+//go:build !nomatrix
+
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// fakeHomeserver implements the key and to-device endpoints the crypto
+// code uses, for two or more devices in one room.
+type fakeHomeserver struct {
+	t           *testing.T
+	members     []string
+	deviceKeys  map[string]map[string]json.RawMessage // user -> device -> signed keys
+	oneTimeKeys map[string]map[string]map[string]json.RawMessage
+	inbox       map[string][]json.RawMessage // "user/device" -> to-device contents
+}
+
+func newFakeHomeserver(t *testing.T, members ...string) *fakeHomeserver {
+	return &fakeHomeserver{
+		t:           t,
+		members:     members,
+		deviceKeys:  make(map[string]map[string]json.RawMessage),
+		oneTimeKeys: make(map[string]map[string]map[string]json.RawMessage),
+		inbox:       make(map[string][]json.RawMessage),
+	}
+}
+
+// api returns the API function of one logged-in device.
+func (s *fakeHomeserver) api(userID, deviceID string) matrixAPI {
+	return func(ctx context.Context, method, path string, body, out interface{}) error {
+		data, _ := json.Marshal(body)
+		var reply interface{}
+		switch {
+		case strings.HasSuffix(path, "/keys/upload"):
+			var req struct {
+				DeviceKeys  json.RawMessage            `json:"device_keys"`
+				OneTimeKeys map[string]json.RawMessage `json:"one_time_keys"`
+			}
+			json.Unmarshal(data, &req)
+			if req.DeviceKeys != nil {
+				if s.deviceKeys[userID] == nil {
+					s.deviceKeys[userID] = map[string]json.RawMessage{}
+				}
+				s.deviceKeys[userID][deviceID] = req.DeviceKeys
+			}
+			if s.oneTimeKeys[userID] == nil {
+				s.oneTimeKeys[userID] = map[string]map[string]json.RawMessage{}
+			}
+			if s.oneTimeKeys[userID][deviceID] == nil {
+				s.oneTimeKeys[userID][deviceID] = map[string]json.RawMessage{}
+			}
+			for id, key := range req.OneTimeKeys {
+				s.oneTimeKeys[userID][deviceID][id] = key
+			}
+			reply = map[string]interface{}{}
+		case strings.HasSuffix(path, "/joined_members"):
+			joined := map[string]interface{}{}
+			for _, m := range s.members {
+				joined[m] = map[string]interface{}{}
+			}
+			reply = map[string]interface{}{"joined": joined}
+		case strings.HasSuffix(path, "/keys/query"):
+			reply = map[string]interface{}{"device_keys": s.deviceKeys}
+		case strings.HasSuffix(path, "/keys/claim"):
+			var req struct {
+				OneTimeKeys map[string]map[string]string `json:"one_time_keys"`
+			}
+			json.Unmarshal(data, &req)
+			claimed := map[string]map[string]map[string]json.RawMessage{}
+			for user, devices := range req.OneTimeKeys {
+				claimed[user] = map[string]map[string]json.RawMessage{}
+				for device := range devices {
+					for id, key := range s.oneTimeKeys[user][device] {
+						claimed[user][device] = map[string]json.RawMessage{id: key}
+						delete(s.oneTimeKeys[user][device], id)
+						break
+					}
+				}
+			}
+			reply = map[string]interface{}{"one_time_keys": claimed}
+		case strings.Contains(path, "/sendToDevice/"):
+			var req struct {
+				Messages map[string]map[string]json.RawMessage `json:"messages"`
+			}
+			json.Unmarshal(data, &req)
+			for user, devices := range req.Messages {
+				for device, content := range devices {
+					s.inbox[user+"/"+device] = append(s.inbox[user+"/"+device], content)
+				}
+			}
+			reply = map[string]interface{}{}
+		default:
+			s.t.Fatalf("Unexpected request %s %s", method, path)
+		}
+		if out != nil {
+			encoded, _ := json.Marshal(reply)
+			return json.Unmarshal(encoded, out)
+		}
+		return nil
+	}
+}
+
+func newTestCrypto(t *testing.T, server *fakeHomeserver, userID, deviceID string) *matrixCrypto {
+	t.Helper()
+	m := newMatrixCrypto(server.api(userID, deviceID), userID, deviceID, &matrixCryptoState{}, func() error { return nil })
+	if err := m.setup(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// TestMatrixCrypto_RoomMessage verifies a message encrypted for a room can
+// be read by another member's device once the room key it was sent over
+// Olm arrives, in both directions, and not before.
+func TestMatrixCrypto_RoomMessage(t *testing.T) {
+	ctx := context.Background()
+	server := newFakeHomeserver(t, "@bot:example.org", "@alice:example.org")
+	bot := newTestCrypto(t, server, "@bot:example.org", "BOT")
+	alice := newTestCrypto(t, server, "@alice:example.org", "PHONE")
+	const room = "!room:example.org"
+
+	if n := len(server.oneTimeKeys["@bot:example.org"]["BOT"]); n != bot.state.Account.MaxOneTimeKeys()/2 {
+		t.Errorf("Expected %d one-time keys uploaded, got %d", bot.state.Account.MaxOneTimeKeys()/2, n)
+	}
+
+	enc, err := bot.encryptRoomEvent(ctx, room, "m.room.message", map[string]string{"msgtype": "m.text", "body": "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := json.Marshal(enc)
+	if _, _, err := alice.decryptRoomEvent(room, content); err != errMissingRoomKey {
+		t.Errorf("Expected errMissingRoomKey before the room key arrives, got %v", err)
+	}
+
+	deliver := func(to *matrixCrypto, sender string) {
+		t.Helper()
+		key := to.userID + "/" + to.deviceID
+		for _, msg := range server.inbox[key] {
+			if _, err := to.handleToDevice(sender, msg); err != nil {
+				t.Fatalf("Expected the to-device event to decrypt, got %v", err)
+			}
+		}
+		delete(server.inbox, key)
+	}
+	deliver(alice, "@bot:example.org")
+
+	evType, plaintext, err := alice.decryptRoomEvent(room, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if evType != "m.room.message" || !strings.Contains(string(plaintext), `"hello"`) {
+		t.Errorf("Expected the original message, got %s %s", evType, plaintext)
+	}
+	if _, _, err := alice.decryptRoomEvent("!other:example.org", content); err == nil {
+		t.Error("Expected a message replayed into another room to fail")
+	}
+
+	// The reply goes over the Olm session the bot started
+	reply, err := alice.encryptRoomEvent(ctx, room, "m.room.message", map[string]string{"msgtype": "m.text", "body": "hi bot"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alice.state.OlmSessions[mustCurve(bot)]) != 1 {
+		t.Errorf("Expected alice to reuse the bot's Olm session, got %d sessions", len(alice.state.OlmSessions[mustCurve(bot)]))
+	}
+	deliver(bot, "@alice:example.org")
+	content, _ = json.Marshal(reply)
+	if _, plaintext, err := bot.decryptRoomEvent(room, content); err != nil || !strings.Contains(string(plaintext), `"hi bot"`) {
+		t.Errorf("Expected the bot to read alice's reply, got %s (%v)", plaintext, err)
+	}
+}
+
+// TestMatrixCrypto_Rotation verifies the room key is replaced when a member
+// leaves, so they cannot read later messages.
+func TestMatrixCrypto_Rotation(t *testing.T) {
+	ctx := context.Background()
+	server := newFakeHomeserver(t, "@bot:example.org", "@alice:example.org", "@eve:example.org")
+	bot := newTestCrypto(t, server, "@bot:example.org", "BOT")
+	newTestCrypto(t, server, "@alice:example.org", "PHONE")
+	newTestCrypto(t, server, "@eve:example.org", "LAPTOP")
+	const room = "!room:example.org"
+
+	first, err := bot.encryptRoomEvent(ctx, room, "m.room.message", map[string]string{"body": "one"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := bot.encryptRoomEvent(ctx, room, "m.room.message", map[string]string{"body": "two"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first["session_id"] != second["session_id"] {
+		t.Error("Expected the same room key while members don't change")
+	}
+
+	server.members = server.members[:2]
+	third, err := bot.encryptRoomEvent(ctx, room, "m.room.message", map[string]string{"body": "three"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third["session_id"] == second["session_id"] {
+		t.Error("Expected a new room key after a member left")
+	}
+}
+
+func mustCurve(m *matrixCrypto) string {
+	curve, _ := m.identityKeys()
+	return curve
+}
+
+// TestVerifySignature verifies signed JSON from the canonical form, and
+// that a changed field breaks the signature.
+func TestVerifySignature(t *testing.T) {
+	server := newFakeHomeserver(t)
+	m := newTestCrypto(t, server, "@bot:example.org", "BOT")
+	_, ed := m.identityKeys()
+
+	obj := map[string]interface{}{"key": "abc", "note": "<b>&</b>", "n": 3}
+	if err := m.sign(obj); err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := json.Marshal(obj)
+	if err := verifySignature(raw, "@bot:example.org", "BOT", ed); err != nil {
+		t.Errorf("Expected the signature to verify, got %v", err)
+	}
+	obj["key"] = "abd"
+	raw, _ = json.Marshal(obj)
+	if err := verifySignature(raw, "@bot:example.org", "BOT", ed); err == nil {
+		t.Error("Expected a changed object to fail verification")
+	}
+
+	canonical, _ := canonicalJSON(map[string]interface{}{"b": 1, "a": "<&>"})
+	if string(canonical) != `{"a":"<&>","b":1}` {
+		t.Errorf("Expected sorted keys without escaping, got %s", canonical)
+	}
+}
+
+// TestMatrixAttachment verifies encrypted attachments round-trip and that
+// a modified file is rejected.
+func TestMatrixAttachment(t *testing.T) {
+	data := []byte("a photo, honestly")
+	encrypted, file, err := encryptAttachment(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := decryptAttachment(encrypted, file)
+	if err != nil || string(got) != string(data) {
+		t.Errorf("Expected %q, got %q (%v)", data, got, err)
+	}
+	encrypted[0] ^= 1
+	if _, err := decryptAttachment(encrypted, file); err == nil {
+		t.Error("Expected a modified attachment to fail its hash check")
+	}
+}
+
+// TestMarkdownToMatrixHTML verifies formatting is converted and code is
+// escaped but not formatted.
+func TestMarkdownToMatrixHTML(t *testing.T) {
+	tests := map[string]string{
+		"**bold** and *it*":           "<strong>bold</strong> and <em>it</em>",
+		"[docs](https://example.com)": `<a href="https://example.com">docs</a>`,
+		"a < b\nnext":                 "a &lt; b<br>next",
+		"`**x** <y>`":                 "<code>**x** &lt;y&gt;</code>",
+		"```go\nx := 1\n```":          "<pre><code>x := 1\n</code></pre>",
+	}
+	for in, want := range tests {
+		if got := markdownToMatrixHTML(in); got != want {
+			t.Errorf("Expected %q for %q, got %q", want, in, got)
+		}
+	}
+}
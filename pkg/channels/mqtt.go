@@ -0,0 +1,283 @@
+//go:build !nomqtt
+
+package channels
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/mqtt"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const (
+	// mqttMaxPayload is how many characters of a payload reach the agent.
+	mqttMaxPayload = 8000
+	// mqttQueue is how many messages may wait for the agent before more
+	// are dropped.
+	mqttQueue = 64
+	// mqttMaxBackoff is the longest wait between reconnection attempts.
+	mqttMaxBackoff = time.Minute
+)
+
+// MQTTChannel prompts the agent with messages on subscribed broker topics
+// and publishes its replies. Each topic is its own chat.
+type MQTTChannel struct {
+	*BaseChannel
+	config config.MQTTConfig
+
+	incoming chan mqtt.Message
+	cancel   context.CancelFunc
+
+	mu         sync.Mutex // guards client and lastPrompt
+	client     *mqtt.Client
+	lastPrompt map[string]time.Time
+}
+
+func init() {
+	RegisterFactory("mqtt", ChannelFactory{
+		Enabled: func(cfg *config.Config) bool {
+			m := cfg.Channels.MQTT
+			return m.Enabled && m.Broker != ""
+		},
+		Create: func(cfg *config.Config, bus *bus.MessageBus) (Channel, error) {
+			return NewMQTTChannel(cfg.Channels.MQTT, bus)
+		},
+	})
+}
+
+// NewMQTTChannel creates the channel, checking its topics.
+func NewMQTTChannel(cfg config.MQTTConfig, bus *bus.MessageBus) (*MQTTChannel, error) {
+	if len(cfg.Subscriptions) == 0 {
+		return nil, fmt.Errorf("mqtt channel needs subscriptions")
+	}
+	for _, sub := range cfg.Subscriptions {
+		if err := mqtt.ValidFilter(sub.Topic); err != nil {
+			return nil, err
+		}
+		if sub.QoS < 0 || sub.QoS > 1 {
+			return nil, fmt.Errorf("mqtt subscription %q: qos must be 0 or 1", sub.Topic)
+		}
+	}
+	if cfg.ReplyTopic == "" {
+		cfg.ReplyTopic = "picoclaw/reply"
+	}
+	if err := mqtt.ValidTopic(strings.ReplaceAll(cfg.ReplyTopic, "{topic}", "x")); err != nil {
+		return nil, fmt.Errorf("invalid reply_topic: %w", err)
+	}
+	return &MQTTChannel{
+		BaseChannel: NewBaseChannel("mqtt", cfg, bus, nil),
+		config:      cfg,
+		incoming:    make(chan mqtt.Message, mqttQueue),
+		lastPrompt:  make(map[string]time.Time),
+	}, nil
+}
+
+func (c *MQTTChannel) Start(ctx context.Context) error {
+	logger.InfoC("mqtt", "Starting MQTT channel...")
+	client, err := c.connect(ctx)
+	if err != nil {
+		return fmt.Errorf("mqtt connection failed: %w", err)
+	}
+	ctx, c.cancel = context.WithCancel(ctx)
+	c.setRunning(true)
+	logger.InfoCF("mqtt", "MQTT channel started", map[string]interface{}{
+		"broker":        c.config.Broker,
+		"subscriptions": len(c.config.Subscriptions),
+	})
+	go c.run(ctx, client)
+	go c.dispatch(ctx)
+	return nil
+}
+
+func (c *MQTTChannel) Stop(ctx context.Context) error {
+	logger.InfoC("mqtt", "Stopping MQTT channel...")
+	c.setRunning(false)
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.mu.Lock()
+	client := c.client
+	c.client = nil
+	c.mu.Unlock()
+	if client != nil {
+		client.Close()
+	}
+	return nil
+}
+
+// connect dials the broker and subscribes to the configured topics.
+func (c *MQTTChannel) connect(ctx context.Context) (*mqtt.Client, error) {
+	client, err := mqtt.Dial(ctx, mqtt.Options{
+		Broker:    c.config.Broker,
+		ClientID:  c.config.ClientID,
+		Username:  c.config.Username,
+		Password:  c.config.Password,
+		OnMessage: c.enqueue,
+	})
+	if err != nil {
+		return nil, err
+	}
+	subs := make([]mqtt.Subscription, len(c.config.Subscriptions))
+	for i, sub := range c.config.Subscriptions {
+		subs[i] = mqtt.Subscription{Filter: sub.Topic, QoS: byte(sub.QoS)}
+	}
+	if err := client.Subscribe(ctx, subs...); err != nil {
+		client.Close()
+		return nil, err
+	}
+	c.mu.Lock()
+	c.client = client
+	c.mu.Unlock()
+	return client, nil
+}
+
+// run reconnects whenever the broker goes away, backing off while it
+// stays away.
+func (c *MQTTChannel) run(ctx context.Context, client *mqtt.Client) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-client.Done():
+		}
+		logger.WarnCF("mqtt", "Lost the MQTT broker, reconnecting", map[string]interface{}{
+			"error": fmt.Sprint(client.Err()),
+		})
+		for backoff := time.Second; ; backoff = min(backoff*2, mqttMaxBackoff) {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			next, err := c.connect(ctx)
+			if err == nil {
+				client = next
+				logger.InfoC("mqtt", "Reconnected to the MQTT broker")
+				break
+			}
+			logger.WarnCF("mqtt", "Reconnecting to the MQTT broker failed", map[string]interface{}{
+				"error": err.Error(),
+				"retry": (backoff * 2).String(),
+			})
+		}
+	}
+}
+
+// enqueue takes a message off the connection. The agent may be busy, so
+// messages wait in a queue, and are dropped when it is full rather than
+// holding up the connection.
+func (c *MQTTChannel) enqueue(msg mqtt.Message) {
+	select {
+	case c.incoming <- msg:
+	default:
+		logger.WarnCF("mqtt", "Too many MQTT messages waiting, dropping one", map[string]interface{}{
+			"topic": msg.Topic,
+		})
+	}
+}
+
+func (c *MQTTChannel) dispatch(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-c.incoming:
+			c.handleMQTT(msg)
+		}
+	}
+}
+
+// handleMQTT passes on one message as a prompt. Retained messages are
+// state from before the subscription, not events, so they are skipped.
+func (c *MQTTChannel) handleMQTT(msg mqtt.Message) {
+	if msg.Retained {
+		return
+	}
+	sub, ok := c.subscriptionFor(msg.Topic)
+	if !ok {
+		return
+	}
+	if sub.Cooldown > 0 {
+		now := time.Now()
+		c.mu.Lock()
+		last, seen := c.lastPrompt[msg.Topic]
+		cooling := seen && now.Sub(last) < time.Duration(sub.Cooldown)*time.Second
+		if !cooling {
+			c.lastPrompt[msg.Topic] = now
+		}
+		c.mu.Unlock()
+		if cooling {
+			logger.DebugCF("mqtt", "MQTT message dropped during cooldown", map[string]interface{}{
+				"topic": msg.Topic,
+			})
+			return
+		}
+	}
+	if !c.Admit(msg.Topic, msg.Topic, "") {
+		return
+	}
+
+	content := mqttPrompt(sub.Prompt, msg)
+	logger.DebugCF("mqtt", "Received MQTT message", map[string]interface{}{
+		"topic":   msg.Topic,
+		"preview": utils.Truncate(string(msg.Payload), 50),
+	})
+	c.HandleMessage(msg.Topic, msg.Topic, content, nil, map[string]string{
+		"topic": msg.Topic,
+	})
+}
+
+// subscriptionFor finds the first subscription matching topic.
+func (c *MQTTChannel) subscriptionFor(topic string) (config.MQTTSubscription, bool) {
+	for _, sub := range c.config.Subscriptions {
+		if mqtt.Match(sub.Topic, topic) {
+			return sub, true
+		}
+	}
+	return config.MQTTSubscription{}, false
+}
+
+// mqttPrompt is what the agent is told about a message.
+func mqttPrompt(prompt string, msg mqtt.Message) string {
+	payload := string(msg.Payload)
+	switch {
+	case len(msg.Payload) == 0:
+		payload = "(empty)"
+	case !utf8.Valid(msg.Payload):
+		payload = fmt.Sprintf("[%d bytes of binary data]", len(msg.Payload))
+	default:
+		payload = utils.Truncate(payload, mqttMaxPayload)
+	}
+	text := fmt.Sprintf("MQTT message on %s:\n%s", msg.Topic, payload)
+	if prompt != "" {
+		text = prompt + "\n\n" + text
+	}
+	return text
+}
+
+// Send publishes a reply to the reply topic of the chat's topic.
+func (c *MQTTChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("mqtt channel not running")
+	}
+	topic := strings.ReplaceAll(c.config.ReplyTopic, "{topic}", msg.ChatID)
+	if err := mqtt.ValidTopic(topic); err != nil {
+		return Permanent(err)
+	}
+	c.mu.Lock()
+	client := c.client
+	c.mu.Unlock()
+	if client == nil {
+		return errors.New("mqtt broker not connected")
+	}
+	return client.Publish(ctx, topic, []byte(msg.Content), 1, false)
+}
@@ -0,0 +1,98 @@
+//go:build !nomqtt
+
+package channels
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/mqtt"
+	"github.com/sipeed/picoclaw/pkg/mqtt/mqtttest"
+)
+
+// TestMQTTChannel verifies messages on subscribed topics prompt the agent
+// (but retained state and messages during a cooldown don't), that replies
+// are published, and that the channel reconnects after the broker drops it
+func TestMQTTChannel(t *testing.T) {
+	broker := mqtttest.NewBroker(t)
+	broker.Publish("home/door/front", "closed", true)
+	mb := bus.NewMessageBus()
+	ch, err := NewMQTTChannel(config.MQTTConfig{
+		Broker: broker.URL(),
+		Subscriptions: []config.MQTTSubscription{
+			{Topic: "home/door/+", Prompt: "Tell me if a door opens.", Cooldown: 60},
+			{Topic: "home/#"},
+		},
+		ReplyTopic: "picoclaw/reply/{topic}",
+	}, mb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := ch.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer ch.Stop(ctx)
+
+	broker.Publish("home/door/front", "open", false)
+	broker.Publish("home/door/front", "closed", false)
+	broker.Publish("home/hall/temp", "19.5", false)
+
+	msg, ok := mb.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("Expected a prompt for the door")
+	}
+	want := "Tell me if a door opens.\n\nMQTT message on home/door/front:\nopen"
+	if msg.Content != want || msg.ChatID != "home/door/front" || msg.SessionKey != "mqtt:home/door/front" {
+		t.Errorf("Unexpected prompt %+v", msg)
+	}
+	if msg, _ := mb.ConsumeInbound(ctx); msg.Content != "MQTT message on home/hall/temp:\n19.5" {
+		t.Errorf("Expected the second door message dropped and the temperature passed on, got %q", msg.Content)
+	}
+
+	if err := ch.Send(ctx, bus.OutboundMessage{ChatID: "home/door/front", Content: "The front door opened."}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	msgs := broker.Messages()
+	if len(msgs) != 1 || msgs[0].Topic != "picoclaw/reply/home/door/front" || msgs[0].Payload != "The front door opened." {
+		t.Errorf("Unexpected reply %+v", msgs)
+	}
+
+	broker.Disconnect()
+	for broker.Subscribers("home/#") != 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	for broker.Subscribers("home/#") == 0 {
+		select {
+		case <-broker.Changed():
+		case <-ctx.Done():
+			t.Fatal("Expected the channel to reconnect and subscribe again")
+		}
+	}
+	broker.Publish("home/hall/light", "on", false)
+	if msg, ok := mb.ConsumeInbound(ctx); !ok || !strings.HasSuffix(msg.Content, "home/hall/light:\non") {
+		t.Errorf("Expected messages after reconnecting, got %q", msg.Content)
+	}
+}
+
+// TestMQTTConfig verifies bad subscriptions are refused and binary and
+// empty payloads described
+func TestMQTTConfig(t *testing.T) {
+	if _, err := NewMQTTChannel(config.MQTTConfig{Broker: "tcp://localhost"}, bus.NewMessageBus()); err == nil {
+		t.Error("Expected a channel without subscriptions refused")
+	}
+	if _, err := NewMQTTChannel(config.MQTTConfig{Subscriptions: []config.MQTTSubscription{{Topic: "a/#/b"}}}, bus.NewMessageBus()); err == nil {
+		t.Error("Expected an invalid filter refused")
+	}
+	if got := mqttPrompt("", mqtt.Message{Topic: "cam/snap", Payload: []byte{0xff, 0xd8, 0xff}}); got != "MQTT message on cam/snap:\n[3 bytes of binary data]" {
+		t.Errorf("Unexpected prompt %q", got)
+	}
+	if got := mqttPrompt("Ring", mqtt.Message{Topic: "door/bell"}); got != "Ring\n\nMQTT message on door/bell:\n(empty)" {
+		t.Errorf("Unexpected prompt %q", got)
+	}
+}
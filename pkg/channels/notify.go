@@ -0,0 +1,89 @@
+//go:build !nonotify
+
+package channels
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/notify"
+)
+
+// NotifyChannel sends messages as notifications, to the desktop and push
+// services in tools.notify. It only sends: a scheduled task can be pointed
+// at it ("notify:me"), and proactive messages without an open chat fall
+// back to it.
+type NotifyChannel struct {
+	*BaseChannel
+	notifier *notify.Notifier
+}
+
+func init() {
+	RegisterFactory("notify", ChannelFactory{
+		Enabled: func(cfg *config.Config) bool {
+			return cfg.Tools.Notify.Enabled && len(notify.New(cfg.Tools.Notify).Targets()) > 0
+		},
+		Create: func(cfg *config.Config, bus *bus.MessageBus) (Channel, error) {
+			return NewNotifyChannel(notify.New(cfg.Tools.Notify), bus), nil
+		},
+	})
+}
+
+// NewNotifyChannel creates the channel for notifier's targets.
+func NewNotifyChannel(notifier *notify.Notifier, bus *bus.MessageBus) *NotifyChannel {
+	return &NotifyChannel{
+		BaseChannel: NewBaseChannel("notify", nil, bus, nil),
+		notifier:    notifier,
+	}
+}
+
+func (c *NotifyChannel) Start(ctx context.Context) error {
+	c.setRunning(true)
+	logger.InfoCF("notify", "Notify channel started", map[string]interface{}{
+		"targets": c.notifier.Targets(),
+	})
+	return nil
+}
+
+func (c *NotifyChannel) Stop(ctx context.Context) error {
+	c.setRunning(false)
+	return nil
+}
+
+// IsAllowed is false: nobody writes to picoclaw through notifications.
+func (c *NotifyChannel) IsAllowed(senderID string) bool {
+	return false
+}
+
+// Send delivers msg to every target. It fails only if no target took it,
+// so a retry doesn't repeat the notification where it arrived.
+func (c *NotifyChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("notify channel not running")
+	}
+	content := msg.Content
+	if content == "" {
+		if len(msg.Media) == 0 {
+			return nil
+		}
+		// Notifications can't carry files
+		content = fmt.Sprintf("%d file(s) for you; ask for them in a chat.", len(msg.Media))
+	}
+	sent, err := c.notifier.Send(ctx, notify.Notification{
+		Message:  content,
+		Priority: notify.PriorityFor(msg.Urgency),
+	})
+	if len(sent) == 0 {
+		return err
+	}
+	if err != nil {
+		logger.WarnCF("notify", "Some notifications failed", map[string]interface{}{
+			"sent":  sent,
+			"error": err.Error(),
+		})
+	}
+	return nil
+}
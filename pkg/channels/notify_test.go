@@ -0,0 +1,120 @@
+//go:build !nonotify
+
+package channels
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/notify"
+)
+
+// phoneTarget passes the notifications it gets to a channel.
+type phoneTarget chan notify.Notification
+
+func (p phoneTarget) Name() string { return "phone" }
+
+func (p phoneTarget) Send(ctx context.Context, n notify.Notification) error {
+	p <- n
+	return nil
+}
+
+// startNotifyManager runs a manager with the sms test channel and a
+// notify channel, and returns the bus and the notifications sent.
+func startNotifyManager(t *testing.T, proactive string) (*bus.MessageBus, *textOnlyChannel, phoneTarget) {
+	t.Helper()
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Workspace = t.TempDir()
+	cfg.Tools.Notify.Proactive = proactive
+	mb := bus.NewMessageBus()
+	m, err := NewManager(cfg, mb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	phone := make(phoneTarget, 4)
+	notifier := NewNotifyChannel(notify.NewWithTargets(phone), mb)
+	notifier.Start(context.Background())
+	sms := &textOnlyChannel{}
+	m.RegisterChannel("notify", notifier)
+	m.RegisterChannel("sms", sms)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go m.dispatchOutbound(ctx)
+	return mb, sms, phone
+}
+
+func expectNotification(t *testing.T, phone phoneTarget) notify.Notification {
+	t.Helper()
+	select {
+	case n := <-phone:
+		return n
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected a notification")
+		return notify.Notification{}
+	}
+}
+
+// TestManager_NotifyFallback verifies proactive messages without an open
+// chat become notifications, and replies and messages to chats don't.
+func TestManager_NotifyFallback(t *testing.T) {
+	mb, sms, phone := startNotifyManager(t, "fallback")
+
+	mb.PublishOutbound(bus.OutboundMessage{Channel: "cli", ChatID: "direct", Content: "Take out the bins", Urgency: bus.UrgencyHigh})
+	if n := expectNotification(t, phone); n.Message != "Take out the bins" || n.Priority != notify.PriorityHigh {
+		t.Errorf("Unexpected notification %+v", n)
+	}
+	mb.PublishOutbound(bus.OutboundMessage{Content: "Nightly backup finished", Urgency: bus.UrgencyNormal})
+	if n := expectNotification(t, phone); n.Message != "Nightly backup finished" {
+		t.Errorf("Unexpected notification %+v", n)
+	}
+
+	mb.PublishOutbound(bus.OutboundMessage{Channel: "cli", ChatID: "direct", Content: "a reply"})
+	mb.PublishOutbound(bus.OutboundMessage{Channel: "sms", ChatID: "1", Content: "Weather alert", Urgency: bus.UrgencyHigh})
+	mb.PublishOutbound(bus.OutboundMessage{Channel: "notify", ChatID: "me", Content: "Report ready"})
+	if n := expectNotification(t, phone); n.Message != "Report ready" {
+		t.Errorf("Expected only the message sent to notify, got %+v", n)
+	}
+	if len(sms.sent) != 1 || sms.sent[0].Content != "Weather alert" {
+		t.Errorf("Expected the alert in the chat, got %+v", sms.sent)
+	}
+}
+
+// TestManager_NotifyAlways verifies proactive messages are sent to their
+// chat and as a notification.
+func TestManager_NotifyAlways(t *testing.T) {
+	mb, sms, phone := startNotifyManager(t, "always")
+
+	mb.PublishOutbound(bus.OutboundMessage{Channel: "sms", ChatID: "1", Content: "UPS on battery", Urgency: bus.UrgencyCritical})
+	if n := expectNotification(t, phone); n.Message != "UPS on battery" || n.Priority != notify.PriorityUrgent {
+		t.Errorf("Unexpected notification %+v", n)
+	}
+	mb.PublishOutbound(bus.OutboundMessage{Channel: "notify", ChatID: "me", Content: "marker"})
+	expectNotification(t, phone)
+	if len(sms.sent) != 1 || sms.sent[0].Content != "UPS on battery" {
+		t.Errorf("Expected the message in the chat too, got %+v", sms.sent)
+	}
+}
+
+// TestNotifyChannel_Media verifies files are mentioned, since
+// notifications can't carry them.
+func TestNotifyChannel_Media(t *testing.T) {
+	phone := make(phoneTarget, 1)
+	ch := NewNotifyChannel(notify.NewWithTargets(phone), bus.NewMessageBus())
+	if err := ch.Send(context.Background(), bus.OutboundMessage{Content: "x"}); err == nil {
+		t.Error("Expected an error before the channel is started")
+	}
+	ch.Start(context.Background())
+	if err := ch.Send(context.Background(), bus.OutboundMessage{Media: []string{"a.png", "b.png"}}); err != nil {
+		t.Fatal(err)
+	}
+	if n := <-phone; n.Message != "2 file(s) for you; ask for them in a chat." {
+		t.Errorf("Unexpected notification %+v", n)
+	}
+	if ch.IsAllowed("anyone") {
+		t.Error("Expected nobody allowed to write through notifications")
+	}
+}
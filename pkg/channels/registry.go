@@ -0,0 +1,77 @@
+package channels
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/voice"
+)
+
+// ChannelFactory creates a channel from config. Factories are registered from
+// init() in build-tagged files so that channels can be left out of minimal
+// builds (e.g. `go build -tags notelegram`).
+type ChannelFactory struct {
+	// Enabled reports whether the channel is turned on in the config.
+	Enabled func(cfg *config.Config) bool
+	// Create builds the channel.
+	Create func(cfg *config.Config, bus *bus.MessageBus) (Channel, error)
+	// AllowList returns the channel's allow_from, so a config reload can
+	// update a running channel. Nil for channels without one.
+	AllowList func(cfg *config.Config) []string
+}
+
+// AllowListSetter is implemented by channels whose allowlist can change
+// while they run.
+type AllowListSetter interface {
+	SetAllowList(allowList []string) error
+}
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]ChannelFactory)
+)
+
+// RegisterFactory makes a channel available to the manager under name.
+func RegisterFactory(name string, factory ChannelFactory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	factories[name] = factory
+}
+
+// AvailableChannels returns the names of channels compiled into this binary.
+func AvailableChannels() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func getFactory(name string) (ChannelFactory, bool) {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	f, ok := factories[name]
+	return f, ok
+}
+
+// TranscriberAware is implemented by channels that can transcribe voice
+// messages, so callers can attach a transcriber without depending on a
+// concrete channel type that may be compiled out.
+type TranscriberAware interface {
+	SetTranscriber(transcriber voice.Transcriber)
+}
+
+// HTTPChannel is implemented by channels served from the gateway's HTTP
+// server, which mounts each at its path.
+type HTTPChannel interface {
+	Channel
+	http.Handler
+	HTTPPath() string
+}
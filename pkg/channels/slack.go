@@ -0,0 +1,583 @@
+//go:build !noslack
+
+package channels
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// slackAPI is the base URL of the Slack Web API.
+const slackAPI = "https://slack.com/api/"
+
+// slackRecentMessages bounds how many of the bot's own messages are
+// remembered, so reactions to them can be traced back to their thread.
+const slackRecentMessages = 500
+
+// SlackChannel talks to Slack over Socket Mode: events arrive on a
+// websocket opened with the app-level token, so no public URL is needed.
+// Each thread is its own session; its chat ID is "channel/thread_ts".
+type SlackChannel struct {
+	*BaseChannel
+	config    config.SlackConfig
+	client    *http.Client
+	apiURL    string
+	botUserID string
+
+	writeMu sync.Mutex // websocket writes (acks) must not interleave
+	conn    *websocket.Conn
+
+	mu      sync.Mutex
+	threads map[string]bool   // chat IDs of threads the bot takes part in
+	posted  map[string]string // ts of the bot's messages -> chat ID
+	order   []string          // posted keys, oldest first
+}
+
+func init() {
+	RegisterFactory("slack", ChannelFactory{
+		Enabled: func(cfg *config.Config) bool {
+			s := cfg.Channels.Slack
+			return s.Enabled && s.BotToken != "" && s.AppToken != ""
+		},
+		Create: func(cfg *config.Config, bus *bus.MessageBus) (Channel, error) {
+			return NewSlackChannel(cfg.Channels.Slack, bus)
+		},
+		AllowList: func(cfg *config.Config) []string { return []string(cfg.Channels.Slack.AllowFrom) },
+	})
+}
+
+func NewSlackChannel(cfg config.SlackConfig, bus *bus.MessageBus) (*SlackChannel, error) {
+	if !strings.HasPrefix(cfg.AppToken, "xapp-") {
+		return nil, fmt.Errorf("slack app_token must be an app-level token (xapp-...)")
+	}
+	return &SlackChannel{
+		BaseChannel: NewBaseChannel("slack", cfg, bus, cfg.AllowFrom),
+		config:      cfg,
+		client:      &http.Client{Timeout: 30 * time.Second},
+		apiURL:      slackAPI,
+		threads:     make(map[string]bool),
+		posted:      make(map[string]string),
+	}, nil
+}
+
+func (c *SlackChannel) Start(ctx context.Context) error {
+	var auth struct {
+		UserID string `json:"user_id"`
+		User   string `json:"user"`
+	}
+	if err := c.call(ctx, c.config.BotToken, "auth.test", nil, &auth); err != nil {
+		return fmt.Errorf("slack auth failed: %w", err)
+	}
+	c.botUserID = auth.UserID
+
+	c.setRunning(true)
+	logger.InfoCF("slack", "Slack bot connected", map[string]interface{}{
+		"user": auth.User,
+	})
+	go c.run(ctx)
+	return nil
+}
+
+func (c *SlackChannel) Stop(ctx context.Context) error {
+	logger.InfoC("slack", "Stopping Slack bot...")
+	c.setRunning(false)
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.conn != nil {
+		return c.conn.Close()
+	}
+	return nil
+}
+
+// run keeps a Socket Mode connection open until ctx is done, reconnecting
+// when Slack asks to or the connection drops.
+func (c *SlackChannel) run(ctx context.Context) {
+	backoff := time.Second
+	for ctx.Err() == nil && c.IsRunning() {
+		err := c.connect(ctx)
+		if ctx.Err() != nil || !c.IsRunning() {
+			return
+		}
+		if err != nil {
+			logger.WarnCF("slack", "Socket Mode connection lost, reconnecting", map[string]interface{}{
+				"error": err.Error(),
+				"in":    backoff.String(),
+			})
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return
+			}
+			backoff = min(backoff*2, time.Minute)
+			continue
+		}
+		backoff = time.Second
+	}
+}
+
+// slackEnvelope is one Socket Mode frame.
+type slackEnvelope struct {
+	EnvelopeID string `json:"envelope_id"`
+	Type       string `json:"type"`
+	Payload    struct {
+		Event slackEvent `json:"event"`
+	} `json:"payload"`
+}
+
+type slackEvent struct {
+	Type        string      `json:"type"`
+	Subtype     string      `json:"subtype"`
+	User        string      `json:"user"`
+	BotID       string      `json:"bot_id"`
+	Text        string      `json:"text"`
+	Channel     string      `json:"channel"`
+	ChannelType string      `json:"channel_type"`
+	TS          string      `json:"ts"`
+	ThreadTS    string      `json:"thread_ts"`
+	Files       []slackFile `json:"files"`
+	Reaction    string      `json:"reaction"`
+	Item        struct {
+		Type    string `json:"type"`
+		Channel string `json:"channel"`
+		TS      string `json:"ts"`
+	} `json:"item"`
+}
+
+type slackFile struct {
+	Name     string `json:"name"`
+	Mimetype string `json:"mimetype"`
+	URL      string `json:"url_private_download"`
+}
+
+// connect opens one Socket Mode connection and reads from it. It returns
+// nil when Slack asked for a reconnect.
+func (c *SlackChannel) connect(ctx context.Context) error {
+	var open struct {
+		URL string `json:"url"`
+	}
+	if err := c.call(ctx, c.config.AppToken, "apps.connections.open", nil, &open); err != nil {
+		return err
+	}
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, open.URL, nil)
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	c.conn = conn
+	c.writeMu.Unlock()
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	for {
+		var env slackEnvelope
+		if err := conn.ReadJSON(&env); err != nil {
+			return err
+		}
+		if env.EnvelopeID != "" {
+			c.writeMu.Lock()
+			err := conn.WriteJSON(map[string]string{"envelope_id": env.EnvelopeID})
+			c.writeMu.Unlock()
+			if err != nil {
+				return err
+			}
+		}
+		switch env.Type {
+		case "disconnect":
+			logger.DebugC("slack", "Slack asked for a reconnect")
+			return nil
+		case "events_api":
+			switch ev := env.Payload.Event; ev.Type {
+			case "message":
+				go c.handleMessage(ev)
+			case "reaction_added":
+				c.handleReaction(ev)
+			}
+		}
+	}
+}
+
+// handleMessage passes on direct messages, messages that mention the bot
+// and replies in threads the bot takes part in. Top-level messages start a
+// thread, which becomes the session.
+func (c *SlackChannel) handleMessage(ev slackEvent) {
+	if ev.BotID != "" || ev.User == "" || ev.User == c.botUserID {
+		return
+	}
+	if ev.Subtype != "" && ev.Subtype != "file_share" && ev.Subtype != "thread_broadcast" {
+		return // edits, deletions, joins
+	}
+	if len(c.config.AllowChannels) > 0 && !slices.Contains(c.config.AllowChannels, ev.Channel) {
+		logger.DebugCF("slack", "Message rejected by channel allowlist", map[string]interface{}{
+			"channel": ev.Channel,
+		})
+		return
+	}
+	if !c.IsAllowed(ev.User) {
+		logger.DebugCF("slack", "Message rejected by allowlist", map[string]interface{}{
+			"user_id": ev.User,
+		})
+		return
+	}
+
+	mention := "<@" + c.botUserID + ">"
+	mentioned := c.botUserID != "" && strings.Contains(ev.Text, mention)
+	chatID := slackChatID(ev.Channel, ev.ThreadTS, ev.TS, ev.ChannelType == "im")
+	c.mu.Lock()
+	joined := c.threads[chatID]
+	if mentioned || ev.ChannelType == "im" {
+		c.threads[chatID] = true
+	}
+	c.mu.Unlock()
+	if !mentioned && !joined && ev.ChannelType != "im" {
+		return
+	}
+	if !c.Admit(ev.User, chatID, ev.Channel+"/"+ev.TS) {
+		return
+	}
+
+	content := strings.TrimSpace(strings.ReplaceAll(ev.Text, mention, ""))
+	var media []string
+	for _, f := range ev.Files {
+		path := c.downloadFile(f)
+		if path == "" {
+			continue
+		}
+		media = append(media, path)
+		kind := "file"
+		if strings.HasPrefix(f.Mimetype, "image/") {
+			kind = "image"
+		} else if strings.HasPrefix(f.Mimetype, "audio/") {
+			kind = "audio"
+		}
+		if content != "" {
+			content += "\n"
+		}
+		content += fmt.Sprintf("[%s: %s]", kind, f.Name)
+	}
+	if content == "" {
+		content = "[empty message]"
+	}
+
+	logger.DebugCF("slack", "Received message", map[string]interface{}{
+		"sender_id": ev.User,
+		"chat_id":   chatID,
+		"preview":   utils.Truncate(content, 50),
+	})
+
+	c.HandleMessage(ev.User, chatID, content, media, map[string]string{
+		"message_id": ev.TS,
+		"user_id":    ev.User,
+		"channel":    ev.Channel,
+		"is_group":   fmt.Sprintf("%t", ev.ChannelType != "im"),
+	})
+}
+
+// slackChatID maps a message to its session: the thread it is in, or the
+// thread it starts. Direct messages outside a thread share one session.
+func slackChatID(channel, threadTS, ts string, direct bool) string {
+	switch {
+	case threadTS != "":
+		return channel + "/" + threadTS
+	case direct:
+		return channel
+	default:
+		return channel + "/" + ts
+	}
+}
+
+// slackApprovals maps reaction names to approval replies, so a tool call
+// can be confirmed by reacting to its prompt.
+var slackApprovals = map[string]string{
+	"white_check_mark":       "yes",
+	"heavy_check_mark":       "yes",
+	"+1":                     "yes",
+	"thumbsup":               "yes",
+	"repeat":                 "always",
+	"infinity":               "always",
+	"x":                      "no",
+	"no_entry":               "no",
+	"no_entry_sign":          "no",
+	"-1":                     "no",
+	"thumbsdown":             "no",
+	"heavy_multiplication_x": "no",
+}
+
+// slackEmoji turns reaction names into the emoji the agent knows as
+// feedback.
+var slackEmoji = map[string]string{
+	"+1":            "👍",
+	"thumbsup":      "👍",
+	"-1":            "👎",
+	"thumbsdown":    "👎",
+	"yawning_face":  "🥱",
+	"thinking_face": "🤔",
+}
+
+// handleReaction forwards a reaction to one of the bot's messages. An
+// approval reaction carries the matching reply as content, which answers a
+// pending confirmation in that thread; otherwise the agent reads the
+// reaction as feedback from the "reaction" metadata.
+func (c *SlackChannel) handleReaction(ev slackEvent) {
+	if ev.Item.Type != "message" || ev.User == "" || ev.User == c.botUserID {
+		return
+	}
+	c.mu.Lock()
+	chatID, ok := c.posted[ev.Item.Channel+"/"+ev.Item.TS]
+	c.mu.Unlock()
+	if !ok {
+		return // not a message of ours, or too old
+	}
+	if !c.Admit(ev.User, chatID, fmt.Sprintf("%s/%s/%s", ev.Item.TS, ev.User, ev.Reaction)) {
+		return
+	}
+	emoji := slackEmoji[ev.Reaction]
+	if emoji == "" {
+		emoji = ":" + ev.Reaction + ":"
+	}
+	c.HandleMessage(ev.User, chatID, slackApprovals[ev.Reaction], nil, map[string]string{
+		"reaction":   emoji,
+		"message_id": ev.Item.TS,
+		"user_id":    ev.User,
+	})
+}
+
+func (c *SlackChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("slack bot not running")
+	}
+	channel, threadTS, _ := strings.Cut(msg.ChatID, "/")
+	if channel == "" {
+		return Permanent(fmt.Errorf("invalid chat ID %q", msg.ChatID))
+	}
+
+	if strings.TrimSpace(msg.Content) != "" {
+		var posted struct {
+			TS string `json:"ts"`
+		}
+		err := c.call(ctx, c.config.BotToken, "chat.postMessage", map[string]interface{}{
+			"channel":   channel,
+			"thread_ts": threadTS,
+			"text":      markdownToSlack(msg.Content),
+		}, &posted)
+		if err != nil {
+			return err
+		}
+		c.remember(channel+"/"+posted.TS, msg.ChatID)
+	}
+	for _, path := range msg.Media {
+		if err := c.uploadFile(ctx, channel, threadTS, path); err != nil {
+			logger.ErrorCF("slack", "Failed to send attachment", map[string]interface{}{
+				"path":  path,
+				"error": err.Error(),
+			})
+		}
+	}
+	return nil
+}
+
+// remember records one of the bot's messages, dropping the oldest once
+// slackRecentMessages are kept.
+func (c *SlackChannel) remember(key, chatID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.posted[key] = chatID
+	c.order = append(c.order, key)
+	if len(c.order) > slackRecentMessages {
+		delete(c.posted, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+// uploadFile sends a local file into the thread with Slack's external
+// upload flow: get an upload URL, post the bytes, then share the file.
+func (c *SlackChannel) uploadFile(ctx context.Context, channel, threadTS, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	name := filepath.Base(path)
+	var upload struct {
+		UploadURL string `json:"upload_url"`
+		FileID    string `json:"file_id"`
+	}
+	form := url.Values{"filename": {name}, "length": {fmt.Sprintf("%d", len(data))}}
+	if err := c.callForm(ctx, "files.getUploadURLExternal", form, &upload); err != nil {
+		return err
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("file", name)
+	if err != nil {
+		return err
+	}
+	part.Write(data)
+	mw.Close()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, upload.UploadURL, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("upload failed: %s", resp.Status)
+	}
+
+	return c.call(ctx, c.config.BotToken, "files.completeUploadExternal", map[string]interface{}{
+		"files":      []map[string]string{{"id": upload.FileID, "title": name}},
+		"channel_id": channel,
+		"thread_ts":  threadTS,
+	}, nil)
+}
+
+func (c *SlackChannel) downloadFile(f slackFile) string {
+	if f.URL == "" {
+		return ""
+	}
+	return utils.DownloadFile(f.URL, f.Name, utils.DownloadOptions{
+		LoggerPrefix: "slack",
+		ExtraHeaders: map[string]string{"Authorization": "Bearer " + c.config.BotToken},
+	})
+}
+
+// slackResponse is the envelope of every Web API reply.
+type slackResponse struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error"`
+}
+
+// call posts a JSON request to a Web API method and decodes the reply into
+// out, which may be nil.
+func (c *SlackChannel) call(ctx context.Context, token, method string, body map[string]interface{}, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.apiURL+method, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	return c.do(req, method, out)
+}
+
+// callForm is call for the methods that only take form-encoded arguments.
+func (c *SlackChannel) callForm(ctx context.Context, method string, form url.Values, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.apiURL+method, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.config.BotToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return c.do(req, method, out)
+}
+
+func (c *SlackChannel) do(req *http.Request, method string, out interface{}) error {
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return fmt.Errorf("%s: rate limited, retry after %ss", method, resp.Header.Get("Retry-After"))
+	}
+	var status slackResponse
+	if err := json.Unmarshal(data, &status); err != nil {
+		return fmt.Errorf("%s: %s: %w", method, resp.Status, err)
+	}
+	if !status.OK {
+		return classifySlackError(fmt.Errorf("%s: %s", method, status.Error), status.Error)
+	}
+	if out != nil {
+		return json.Unmarshal(data, out)
+	}
+	return nil
+}
+
+// slackPermanentErrors are Web API errors that retrying will not fix.
+var slackPermanentErrors = []string{
+	"channel_not_found", "not_in_channel", "is_archived", "msg_too_long",
+	"invalid_auth", "account_inactive", "token_revoked", "missing_scope",
+	"thread_not_found", "invalid_arguments",
+}
+
+// classifySlackError marks errors Slack will keep returning as permanent
+// so the outbox does not retry them.
+func classifySlackError(err error, code string) error {
+	if slices.Contains(slackPermanentErrors, code) {
+		return Permanent(err)
+	}
+	return err
+}
+
+var (
+	slackBold    = regexp.MustCompile(`\*\*(.+?)\*\*`)
+	slackStrike  = regexp.MustCompile(`~~(.+?)~~`)
+	slackLink    = regexp.MustCompile(`\[([^\]]+)\]\((https?://[^)\s]+)\)`)
+	slackHeading = regexp.MustCompile(`(?m)^#{1,6}\s+(.+)$`)
+)
+
+// markdownToSlack converts the model's markdown to Slack mrkdwn. Code
+// blocks and inline code are only escaped.
+func markdownToSlack(text string) string {
+	var out strings.Builder
+	for i, chunk := range strings.Split(escapeSlack(text), "```") {
+		if i > 0 {
+			out.WriteString("```")
+		}
+		if i%2 == 1 {
+			out.WriteString(chunk) // inside a code block
+			continue
+		}
+		for j, span := range strings.Split(chunk, "`") {
+			if j > 0 {
+				out.WriteString("`")
+			}
+			if j%2 == 0 {
+				span = slackHeading.ReplaceAllString(span, "*$1*")
+				span = slackBold.ReplaceAllString(span, "*$1*")
+				span = slackStrike.ReplaceAllString(span, "~$1~")
+				span = slackLink.ReplaceAllString(span, "<$2|$1>")
+			}
+			out.WriteString(span)
+		}
+	}
+	return out.String()
+}
+
+// escapeSlack escapes the characters mrkdwn reserves for links and
+// mentions.
+func escapeSlack(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
@@ -0,0 +1,95 @@
+//go:build !noslack
+
+package channels
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// TestSlackChatID verifies each thread maps to its own session, top-level
+// messages start one, and direct messages outside threads share one.
+func TestSlackChatID(t *testing.T) {
+	tests := []struct {
+		threadTS, ts string
+		direct       bool
+		want         string
+	}{
+		{"", "1700.1", false, "C1/1700.1"},
+		{"1600.5", "1700.1", false, "C1/1600.5"},
+		{"", "1700.1", true, "C1"},
+		{"1600.5", "1700.1", true, "C1/1600.5"},
+	}
+	for _, tt := range tests {
+		if got := slackChatID("C1", tt.threadTS, tt.ts, tt.direct); got != tt.want {
+			t.Errorf("Expected %q for thread %q direct %v, got %q", tt.want, tt.threadTS, tt.direct, got)
+		}
+	}
+}
+
+// TestMarkdownToSlack verifies markdown is converted to mrkdwn and code is
+// only escaped.
+func TestMarkdownToSlack(t *testing.T) {
+	tests := map[string]string{
+		"**bold** and ~~gone~~":           "*bold* and ~gone~",
+		"see [docs](https://example.com)": "see <https://example.com|docs>",
+		"## Title":                        "*Title*",
+		"a < b & c":                       "a &lt; b &amp; c",
+		"`**x**` stays":                   "`**x**` stays",
+		"```\n**x** <y>\n```":             "```\n**x** &lt;y&gt;\n```",
+	}
+	for in, want := range tests {
+		if got := markdownToSlack(in); got != want {
+			t.Errorf("Expected %q for %q, got %q", want, in, got)
+		}
+	}
+}
+
+// TestSlackChannel_ReactionApproval verifies a ✅ on one of the bot's
+// messages is forwarded as "yes" to that thread, other reactions carry no
+// content, and reactions to unknown messages are ignored.
+func TestSlackChannel_ReactionApproval(t *testing.T) {
+	mb := bus.NewMessageBus()
+	c, err := NewSlackChannel(config.SlackConfig{BotToken: "xoxb-1", AppToken: "xapp-1"}, mb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.botUserID = "UBOT"
+	c.remember("C1/1700.2", "C1/1700.1")
+
+	react := func(name, ts string) slackEvent {
+		ev := slackEvent{Type: "reaction_added", User: "U1", Reaction: name}
+		ev.Item.Type, ev.Item.Channel, ev.Item.TS = "message", "C1", ts
+		return ev
+	}
+	c.handleReaction(react("white_check_mark", "1700.2"))
+	c.handleReaction(react("tada", "1700.2"))
+	c.handleReaction(react("white_check_mark", "1800.0"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, ok := mb.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("Expected the approval reaction to be forwarded")
+	}
+	if msg.ChatID != "C1/1700.1" || msg.Content != "yes" {
+		t.Errorf("Expected \"yes\" in thread C1/1700.1, got %q in %q", msg.Content, msg.ChatID)
+	}
+	msg, ok = mb.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("Expected the feedback reaction to be forwarded")
+	}
+	if msg.Content != "" || msg.Metadata["reaction"] != ":tada:" {
+		t.Errorf("Expected a reaction with no content, got %q %q", msg.Content, msg.Metadata["reaction"])
+	}
+
+	short, cancelShort := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancelShort()
+	if msg, ok := mb.ConsumeInbound(short); ok {
+		t.Errorf("Expected reactions to unknown messages to be ignored, got %+v", msg)
+	}
+}
@@ -1,17 +1,26 @@
+//go:build !notelegram
+
 package channels
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
+	"github.com/google/uuid"
 	"github.com/mymmrac/telego"
+	"github.com/mymmrac/telego/telegoapi"
 	tu "github.com/mymmrac/telego/telegoutil"
 
 	"github.com/sipeed/picoclaw/pkg/bus"
@@ -26,9 +35,33 @@ type TelegramChannel struct {
 	bot          *telego.Bot
 	config       config.TelegramConfig
 	chatIDs      map[string]int64
-	transcriber  *voice.GroqTranscriber
+	transcriber  voice.Transcriber
 	placeholders sync.Map // chatID -> messageID
 	stopThinking sync.Map // chatID -> thinkingCancel
+	webhook      *http.Server
+}
+
+// telegramMessageLimit is the most text Telegram accepts in one message,
+// less some room for the markup the HTML conversion adds.
+const telegramMessageLimit = 3800
+
+// telegramMaxUpload is the largest file a bot can send.
+const telegramMaxUpload = 50 << 20
+
+// telegramUpdates are the update types the bot asks for; reactions are only
+// sent when asked for.
+var telegramUpdates = []string{"message", "message_reaction"}
+
+func init() {
+	RegisterFactory("telegram", ChannelFactory{
+		Enabled: func(cfg *config.Config) bool {
+			return cfg.Channels.Telegram.Enabled && cfg.Channels.Telegram.Token != ""
+		},
+		Create: func(cfg *config.Config, bus *bus.MessageBus) (Channel, error) {
+			return NewTelegramChannel(cfg.Channels.Telegram, bus)
+		},
+		AllowList: func(cfg *config.Config) []string { return []string(cfg.Channels.Telegram.AllowFrom) },
+	})
 }
 
 type thinkingCancel struct {
@@ -74,18 +107,20 @@ func NewTelegramChannel(cfg config.TelegramConfig, bus *bus.MessageBus) (*Telegr
 	}, nil
 }
 
-func (c *TelegramChannel) SetTranscriber(transcriber *voice.GroqTranscriber) {
+func (c *TelegramChannel) SetTranscriber(transcriber voice.Transcriber) {
 	c.transcriber = transcriber
 }
 
 func (c *TelegramChannel) Start(ctx context.Context) error {
-	logger.InfoC("telegram", "Starting Telegram bot (polling mode)...")
-
-	updates, err := c.bot.UpdatesViaLongPolling(ctx, &telego.GetUpdatesParams{
-		Timeout: 30,
-	})
+	var updates <-chan telego.Update
+	var err error
+	if c.config.WebhookURL != "" {
+		updates, err = c.startWebhook(ctx)
+	} else {
+		updates, err = c.startPolling(ctx)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to start long polling: %w", err)
+		return err
 	}
 
 	c.setRunning(true)
@@ -106,6 +141,9 @@ func (c *TelegramChannel) Start(ctx context.Context) error {
 				if update.Message != nil {
 					c.handleMessage(ctx, update)
 				}
+				if update.MessageReaction != nil {
+					c.handleReaction(update.MessageReaction)
+				}
 			}
 		}
 	}()
@@ -113,12 +151,82 @@ func (c *TelegramChannel) Start(ctx context.Context) error {
 	return nil
 }
 
+func (c *TelegramChannel) startPolling(ctx context.Context) (<-chan telego.Update, error) {
+	logger.InfoC("telegram", "Starting Telegram bot (polling mode)...")
+
+	// Telegram refuses getUpdates while a webhook from an earlier run is set
+	if err := c.bot.DeleteWebhook(ctx, &telego.DeleteWebhookParams{}); err != nil {
+		logger.WarnCF("telegram", "Failed to remove webhook", map[string]interface{}{"error": err.Error()})
+	}
+	updates, err := c.bot.UpdatesViaLongPolling(ctx, &telego.GetUpdatesParams{
+		Timeout:        30,
+		AllowedUpdates: telegramUpdates,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start long polling: %w", err)
+	}
+	return updates, nil
+}
+
+// startWebhook registers the webhook with Telegram and serves it on
+// webhook_listen. Requests without the secret token are rejected.
+func (c *TelegramChannel) startWebhook(ctx context.Context) (<-chan telego.Update, error) {
+	logger.InfoCF("telegram", "Starting Telegram bot (webhook mode)...", map[string]interface{}{
+		"url":    c.config.WebhookURL,
+		"listen": c.config.WebhookListen,
+	})
+
+	webhookURL, err := url.Parse(c.config.WebhookURL)
+	if err != nil || webhookURL.Scheme != "https" {
+		return nil, fmt.Errorf("invalid webhook URL %q: must be https", c.config.WebhookURL)
+	}
+	secret := c.config.WebhookSecret
+	if secret == "" {
+		// Only this run's webhook needs it, so a random one will do
+		secret = strings.ReplaceAll(uuid.NewString(), "-", "")
+	}
+
+	server := &http.Server{Addr: c.config.WebhookListen, ReadHeaderTimeout: 10 * time.Second}
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for webhook: %w", err)
+	}
+	updates, err := c.bot.UpdatesViaWebhook(ctx,
+		telego.WebhookHTTPServer(server, webhookURL.Path, secret),
+		telego.WithWebhookSet(ctx, &telego.SetWebhookParams{
+			URL:            c.config.WebhookURL,
+			AllowedUpdates: telegramUpdates,
+			SecretToken:    secret,
+		}))
+	if err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to set webhook: %w", err)
+	}
+
+	c.webhook = server
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			logger.ErrorCF("telegram", "Webhook server stopped", map[string]interface{}{"error": err.Error()})
+		}
+	}()
+	return updates, nil
+}
+
 func (c *TelegramChannel) Stop(ctx context.Context) error {
 	logger.InfoC("telegram", "Stopping Telegram bot...")
 	c.setRunning(false)
+	if c.webhook != nil {
+		return c.webhook.Shutdown(ctx)
+	}
 	return nil
 }
 
+// CanSendMedia reports whether the file is within the bot upload limit;
+// larger ones are sent as links.
+func (c *TelegramChannel) CanSendMedia(path string) bool {
+	return fileFits(path, telegramMaxUpload)
+}
+
 func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
 	if !c.IsRunning() {
 		return fmt.Errorf("telegram bot not running")
@@ -126,7 +234,7 @@ func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 
 	chatID, err := parseChatID(msg.ChatID)
 	if err != nil {
-		return fmt.Errorf("invalid chat ID: %w", err)
+		return Permanent(fmt.Errorf("invalid chat ID: %w", err))
 	}
 
 	// Stop thinking animation
@@ -137,33 +245,172 @@ func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 		c.stopThinking.Delete(msg.ChatID)
 	}
 
-	htmlContent := markdownToTelegramHTML(msg.Content)
+	if err := c.sendText(ctx, chatID, msg); err != nil {
+		return err
+	}
+	c.sendMedia(ctx, chatID, msg.Media)
+	return nil
+}
 
-	// Try to edit placeholder
-	if pID, ok := c.placeholders.Load(msg.ChatID); ok {
-		c.placeholders.Delete(msg.ChatID)
-		editMsg := tu.EditMessageText(tu.ID(chatID), pID.(int), htmlContent)
-		editMsg.ParseMode = telego.ModeHTML
+// sendText sends the reply in as many messages as Telegram's length limit
+// needs. The first part replaces the "Thinking..." placeholder.
+func (c *TelegramChannel) sendText(ctx context.Context, chatID int64, msg bus.OutboundMessage) error {
+	parts := splitTelegramMessage(msg.Content, telegramMessageLimit)
+	for i, part := range parts {
+		htmlContent := markdownToTelegramHTML(part)
+
+		// Try to edit placeholder
+		if pID, ok := c.placeholders.Load(msg.ChatID); ok && i == 0 {
+			c.placeholders.Delete(msg.ChatID)
+			editMsg := tu.EditMessageText(tu.ID(chatID), pID.(int), htmlContent)
+			editMsg.ParseMode = telego.ModeHTML
+
+			if _, err := c.bot.EditMessageText(ctx, editMsg); err == nil {
+				continue
+			}
+			// Fallback to new message if edit fails
+		}
 
-		if _, err = c.bot.EditMessageText(ctx, editMsg); err == nil {
-			return nil
+		tgMsg := tu.Message(tu.ID(chatID), htmlContent)
+		tgMsg.ParseMode = telego.ModeHTML
+
+		if _, err := c.bot.SendMessage(ctx, tgMsg); err != nil {
+			logger.ErrorCF("telegram", "HTML parse failed, falling back to plain text", map[string]interface{}{
+				"error": err.Error(),
+			})
+			tgMsg = tu.Message(tu.ID(chatID), part)
+			if _, err = c.bot.SendMessage(ctx, tgMsg); err != nil {
+				if i > 0 {
+					// Earlier parts arrived; retrying would send them again
+					return Permanent(err)
+				}
+				return classifyTelegramError(err)
+			}
 		}
-		// Fallback to new message if edit fails
 	}
 
-	tgMsg := tu.Message(tu.ID(chatID), htmlContent)
-	tgMsg.ParseMode = telego.ModeHTML
+	return nil
+}
 
-	if _, err = c.bot.SendMessage(ctx, tgMsg); err != nil {
-		logger.ErrorCF("telegram", "HTML parse failed, falling back to plain text", map[string]interface{}{
-			"error": err.Error(),
-		})
-		tgMsg.ParseMode = ""
-		_, err = c.bot.SendMessage(ctx, tgMsg)
-		return err
+// splitTelegramMessage splits markdown text into parts of at most limit
+// characters, at paragraph or line breaks where it can. A code block that
+// is split is closed at the end of one part and reopened in the next.
+func splitTelegramMessage(text string, limit int) []string {
+	var parts []string
+	fence := "" // opening line of the code block a part ends inside
+	for utf8.RuneCountInString(text) > limit {
+		cut := string([]rune(text)[:limit])
+		rest := text[len(cut):]
+		for _, sep := range []string{"\n\n", "\n", " "} {
+			if i := strings.LastIndex(cut, sep); i > len(cut)/2 {
+				cut, rest = cut[:i], text[i+len(sep):]
+				break
+			}
+		}
+		text = rest
+
+		part := fence + cut
+		fence = openFence(part)
+		if fence != "" {
+			part += "\n```"
+			fence += "\n"
+		}
+		parts = append(parts, part)
 	}
+	return append(parts, fence+text)
+}
 
-	return nil
+// openFence returns the opening line of a code block left open at the end
+// of text, or "" if every block is closed.
+func openFence(text string) string {
+	open := ""
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			if open == "" {
+				open = strings.TrimSpace(line)
+			} else {
+				open = ""
+			}
+		}
+	}
+	return open
+}
+
+// sendMedia sends attachments after the text: OGG/Opus audio as a voice
+// note, other audio as an audio file, anything else as a document. The text has already been delivered,
+// so failures are logged rather than returned, which would resend it.
+func (c *TelegramChannel) sendMedia(ctx context.Context, chatID int64, media []string) {
+	for _, path := range media {
+		file, err := os.Open(path)
+		if err != nil {
+			logger.WarnCF("telegram", "Attachment missing, not sent", map[string]interface{}{
+				"path":  path,
+				"error": err.Error(),
+			})
+			continue
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".ogg", ".oga", ".opus":
+			c.bot.SendChatAction(ctx, tu.ChatAction(tu.ID(chatID), telego.ChatActionUploadVoice))
+			_, err = c.bot.SendVoice(ctx, tu.Voice(tu.ID(chatID), tu.File(file)))
+		case ".wav", ".mp3", ".m4a":
+			_, err = c.bot.SendAudio(ctx, tu.Audio(tu.ID(chatID), tu.File(file)))
+		default:
+			_, err = c.bot.SendDocument(ctx, tu.Document(tu.ID(chatID), tu.File(file)))
+		}
+		file.Close()
+		if err != nil {
+			logger.ErrorCF("telegram", "Failed to send attachment", map[string]interface{}{
+				"path":  path,
+				"error": err.Error(),
+			})
+		}
+	}
+}
+
+// classifyTelegramError marks errors the Bot API will keep returning (bad
+// request, bot blocked or kicked) as permanent so they are not retried.
+func classifyTelegramError(err error) error {
+	var apiErr *telegoapi.Error
+	if errors.As(err, &apiErr) && (apiErr.ErrorCode == http.StatusBadRequest || apiErr.ErrorCode == http.StatusForbidden) {
+		return Permanent(err)
+	}
+	return err
+}
+
+// handleReaction forwards an emoji newly added to a message as feedback.
+// The agent reads it from the "reaction" metadata instead of the content.
+func (c *TelegramChannel) handleReaction(reaction *telego.MessageReactionUpdated) {
+	user := reaction.User
+	if user == nil {
+		return
+	}
+	senderID := fmt.Sprintf("%d", user.ID)
+	if user.Username != "" {
+		senderID = fmt.Sprintf("%s|%s", senderID, user.Username)
+	}
+
+	old := make(map[string]bool)
+	for _, r := range reaction.OldReaction {
+		if e, ok := r.(*telego.ReactionTypeEmoji); ok {
+			old[e.Emoji] = true
+		}
+	}
+	for _, r := range reaction.NewReaction {
+		e, ok := r.(*telego.ReactionTypeEmoji)
+		if !ok || old[e.Emoji] {
+			continue
+		}
+		chatID := fmt.Sprintf("%d", reaction.Chat.ID)
+		if !c.Admit(senderID, chatID, fmt.Sprintf("%d/%d/%s", reaction.MessageID, user.ID, e.Emoji)) {
+			continue
+		}
+		c.HandleMessage(senderID, fmt.Sprintf("%d", reaction.Chat.ID), "", nil, map[string]string{
+			"reaction":   e.Emoji,
+			"message_id": fmt.Sprintf("%d", reaction.MessageID),
+			"user_id":    fmt.Sprintf("%d", user.ID),
+		})
+	}
 }
 
 func (c *TelegramChannel) handleMessage(ctx context.Context, update telego.Update) {
@@ -193,6 +440,16 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, update telego.Updat
 	}
 
 	chatID := message.Chat.ID
+	if len(c.config.AllowChats) > 0 && !slices.Contains(c.config.AllowChats, fmt.Sprintf("%d", chatID)) {
+		logger.DebugCF("telegram", "Message rejected by chat allowlist", map[string]interface{}{
+			"chat_id": chatID,
+		})
+		return
+	}
+	// Before any downloads or placeholders, so a redelivered update costs nothing
+	if !c.Admit(senderID, fmt.Sprintf("%d", chatID), fmt.Sprintf("%d", message.MessageID)) {
+		return
+	}
 	c.chatIDs[senderID] = chatID
 
 	content := ""
@@ -226,7 +483,8 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, update telego.Updat
 		photo := message.Photo[len(message.Photo)-1]
 		photoPath := c.downloadPhoto(ctx, photo.FileID)
 		if photoPath != "" {
-			localFiles = append(localFiles, photoPath)
+			// Kept for the agent, which reads it after this handler returns;
+			// the disk quota evicts old attachments
 			mediaPaths = append(mediaPaths, photoPath)
 			if content != "" {
 				content += "\n"
@@ -235,7 +493,9 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, update telego.Updat
 		}
 	}
 
-	if message.Voice != nil {
+	voiceNote := message.Voice != nil
+	transcript := ""
+	if voiceNote {
 		voicePath := c.downloadFile(ctx, message.Voice.FileID, ".ogg")
 		if voicePath != "" {
 			localFiles = append(localFiles, voicePath)
@@ -243,7 +503,8 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, update telego.Updat
 
 			transcribedText := ""
 			if c.transcriber != nil && c.transcriber.IsAvailable() {
-				ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+				// Local whisper.cpp on a small board can take a while
+				ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
 				defer cancel()
 
 				result, err := c.transcriber.Transcribe(ctx, voicePath)
@@ -255,6 +516,7 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, update telego.Updat
 					transcribedText = fmt.Sprintf("[voice (transcription failed)]")
 				} else {
 					transcribedText = fmt.Sprintf("[voice transcription: %s]", result.Text)
+					transcript = result.Text
 					logger.InfoCF("telegram", "Voice transcribed successfully", map[string]interface{}{
 						"text": result.Text,
 					})
@@ -337,6 +599,13 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, update telego.Updat
 		"first_name": user.FirstName,
 		"is_group":   fmt.Sprintf("%t", message.Chat.Type != "private"),
 	}
+	if voiceNote {
+		// Lets the agent answer in kind when the user asked for voice replies
+		metadata["voice"] = "true"
+		if transcript != "" {
+			metadata["transcript"] = transcript
+		}
+	}
 
 	c.HandleMessage(senderID, fmt.Sprintf("%d", chatID), content, mediaPaths, metadata)
 }
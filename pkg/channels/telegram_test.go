@@ -0,0 +1,43 @@
+//go:build !notelegram
+
+package channels
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// TestSplitTelegramMessage verifies long replies are split at line breaks
+// within the limit, and split code blocks are closed and reopened.
+func TestSplitTelegramMessage(t *testing.T) {
+	if parts := splitTelegramMessage("short reply", 100); len(parts) != 1 || parts[0] != "short reply" {
+		t.Errorf("Expected the reply unchanged, got %q", parts)
+	}
+
+	para := strings.Repeat("word ", 15) // 75 chars
+	text := para + "\n\n" + para + "\n\n" + para
+	parts := splitTelegramMessage(text, 100)
+	if len(parts) != 3 {
+		t.Fatalf("Expected 3 parts, got %d: %q", len(parts), parts)
+	}
+	for _, part := range parts {
+		if utf8.RuneCountInString(part) > 100 {
+			t.Errorf("Expected at most 100 chars, got %d", utf8.RuneCountInString(part))
+		}
+		if part != para {
+			t.Errorf("Expected a split at the paragraph break, got %q", part)
+		}
+	}
+
+	code := "```go\n" + strings.Repeat("x := 1\n", 20) + "```"
+	parts = splitTelegramMessage(code, 80)
+	if len(parts) < 2 {
+		t.Fatalf("Expected the code block to be split, got %q", parts)
+	}
+	for _, part := range parts {
+		if !strings.HasPrefix(part, "```go\n") || !strings.HasSuffix(part, "```") {
+			t.Errorf("Expected each part to be a whole code block, got %q", part)
+		}
+	}
+}
@@ -0,0 +1,523 @@
+//go:build !nowebui
+
+package channels
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+//go:embed webui/index.html
+var webPage []byte
+
+const (
+	// webPath is where the gateway serves the UI.
+	webPath = "/chat/"
+	// webCookie holds the login.
+	webCookie = "picoclaw_web"
+	// webMaxSessions bounds how many chats are kept; the oldest go first.
+	webMaxSessions = 100
+	// webMaxEntries bounds the transcript kept per chat.
+	webMaxEntries = 200
+	// webMaxMessage is the largest message the UI can send.
+	webMaxMessage = 64 << 10
+	// webSender is the sender ID of messages from the UI; its one user is
+	// whoever has the token.
+	webSender = "web"
+)
+
+// Kinds of transcript entries.
+const (
+	webEntryUser      = "user"
+	webEntryAssistant = "assistant"
+	webEntryTool      = "tool"
+	webEntryApproval  = "approval"
+)
+
+// WebChannel serves a chat UI for the browser from the gateway: a list of
+// chats, the conversation, the tools the agent runs, and buttons to answer
+// approval prompts. Each chat is a session; transcripts are kept in
+// state/web.json so the UI can show them after a reload or restart.
+type WebChannel struct {
+	*BaseChannel
+	token     string
+	storePath string
+
+	mu       sync.Mutex // guards sessions and clients
+	sessions map[string]*webSession
+	clients  map[string]map[chan webEntry]struct{} // chat ID -> event streams
+}
+
+// webSession is one chat as the UI shows it.
+type webSession struct {
+	ID      string     `json:"id"`
+	Title   string     `json:"title"`
+	Updated time.Time  `json:"updated"`
+	Entries []webEntry `json:"entries,omitempty"`
+	NextID  int        `json:"next_id,omitempty"`
+}
+
+// webEntry is one line of a transcript: a message, a tool call with its
+// arguments and result, or an approval prompt.
+type webEntry struct {
+	ID     int       `json:"id"`
+	Kind   string    `json:"kind"`
+	Text   string    `json:"text,omitempty"`
+	Tool   string    `json:"tool,omitempty"`
+	Args   string    `json:"args,omitempty"`
+	Result string    `json:"result,omitempty"`
+	Done   bool      `json:"done,omitempty"`
+	Error  bool      `json:"error,omitempty"`
+	Answer string    `json:"answer,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+func init() {
+	RegisterFactory("web", ChannelFactory{
+		Enabled: func(cfg *config.Config) bool {
+			return cfg.Channels.Web.Enabled && cfg.Channels.Web.Token != ""
+		},
+		Create: func(cfg *config.Config, bus *bus.MessageBus) (Channel, error) {
+			return NewWebChannel(cfg.Channels.Web, filepath.Join(cfg.WorkspacePath(), "state", "web.json"), bus)
+		},
+	})
+}
+
+// NewWebChannel creates the channel; storePath is where transcripts are
+// kept.
+func NewWebChannel(cfg config.WebConfig, storePath string, bus *bus.MessageBus) (*WebChannel, error) {
+	if cfg.Token == "" {
+		// The UI runs the agent with all its tools; don't serve it open
+		return nil, fmt.Errorf("web channel needs a token")
+	}
+
+	sessions := make(map[string]*webSession)
+	data, err := os.ReadFile(storePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &sessions); err != nil {
+			return nil, fmt.Errorf("reading %s: %w", storePath, err)
+		}
+	}
+
+	return &WebChannel{
+		BaseChannel: NewBaseChannel("web", cfg, bus, nil),
+		token:       cfg.Token,
+		storePath:   storePath,
+		sessions:    sessions,
+		clients:     make(map[string]map[chan webEntry]struct{}),
+	}, nil
+}
+
+func (c *WebChannel) Start(ctx context.Context) error {
+	c.bus.WatchActivity("web", c.onActivity)
+	c.setRunning(true)
+	logger.InfoCF("web", "Web UI started", map[string]interface{}{
+		"path": webPath,
+	})
+	return nil
+}
+
+func (c *WebChannel) Stop(ctx context.Context) error {
+	logger.InfoC("web", "Stopping web UI...")
+	c.bus.WatchActivity("web", nil)
+	c.setRunning(false)
+	return nil
+}
+
+// HTTPPath is where the gateway mounts the UI.
+func (c *WebChannel) HTTPPath() string {
+	return webPath
+}
+
+// CanSendMedia reports false: the UI shows text, and files reach it as
+// links.
+func (c *WebChannel) CanSendMedia(path string) bool {
+	return false
+}
+
+// Send adds the agent's reply to the transcript of chat ID.
+func (c *WebChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("web channel not running")
+	}
+	if !c.addEntry(msg.ChatID, webEntry{Kind: webEntryAssistant, Text: msg.Content}) {
+		return Permanent(fmt.Errorf("unknown web chat %q", msg.ChatID))
+	}
+	return nil
+}
+
+// onActivity records the tools the agent runs and the approvals it asks
+// for in the transcript.
+func (c *WebChannel) onActivity(a bus.Activity) {
+	switch a.Kind {
+	case bus.ActivityToolStart:
+		c.addEntry(a.ChatID, webEntry{Kind: webEntryTool, Tool: a.Tool, Args: a.Detail})
+	case bus.ActivityToolDone:
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		s := c.sessions[a.ChatID]
+		if s == nil {
+			return
+		}
+		for i := len(s.Entries) - 1; i >= 0; i-- {
+			e := &s.Entries[i]
+			if e.Kind == webEntryTool && e.Tool == a.Tool && !e.Done {
+				e.Done, e.Result, e.Error = true, a.Detail, a.IsError
+				c.changed(s, i)
+				return
+			}
+		}
+	case bus.ActivityApproval:
+		c.addEntry(a.ChatID, webEntry{Kind: webEntryApproval, Tool: a.Tool, Text: a.Detail})
+	}
+}
+
+// addEntry appends e to chat ID's transcript and reports whether the chat
+// exists.
+func (c *WebChannel) addEntry(chatID string, e webEntry) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.sessions[chatID]
+	if s == nil {
+		return false
+	}
+	e.ID = s.NextID
+	s.NextID++
+	e.Time = time.Now()
+	s.Entries = append(s.Entries, e)
+	if len(s.Entries) > webMaxEntries {
+		s.Entries = s.Entries[len(s.Entries)-webMaxEntries:]
+	}
+	s.Updated = e.Time
+	c.changed(s, len(s.Entries)-1)
+	return true
+}
+
+// changed saves the sessions and tells the chat's streams about entry i.
+// Callers hold c.mu.
+func (c *WebChannel) changed(s *webSession, i int) {
+	if err := c.save(); err != nil {
+		logger.WarnCF("web", "Could not save web chats", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	for ch := range c.clients[s.ID] {
+		select {
+		case ch <- s.Entries[i]:
+		default:
+			// A stalled browser reloads the transcript when it reconnects
+		}
+	}
+}
+
+// save writes the sessions atomically. Callers hold c.mu.
+func (c *WebChannel) save() error {
+	if err := os.MkdirAll(filepath.Dir(c.storePath), 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(c.sessions)
+	if err != nil {
+		return err
+	}
+	tmp := c.storePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.storePath)
+}
+
+// ServeHTTP serves the page and its API below webPath. Everything but the
+// page and login needs the login cookie.
+func (c *WebChannel) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, strings.TrimSuffix(webPath, "/"))
+	switch {
+	case path == "/" || path == "/index.html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("X-Frame-Options", "DENY")
+		w.Write(webPage)
+		return
+	case path == "/api/login":
+		c.serveLogin(w, r)
+		return
+	case !strings.HasPrefix(path, "/api/"):
+		http.NotFound(w, r)
+		return
+	}
+	if !c.loggedIn(r) {
+		webError(w, http.StatusUnauthorized, "not logged in")
+		return
+	}
+	if r.Method == http.MethodPost && !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		// Forms can post across sites; JSON needs a preflight
+		webError(w, http.StatusUnsupportedMediaType, "expected JSON")
+		return
+	}
+
+	route := strings.Split(strings.Trim(strings.TrimPrefix(path, "/api/"), "/"), "/")
+	switch {
+	case len(route) == 1 && route[0] == "sessions":
+		c.serveSessions(w, r)
+	case len(route) == 2 && route[0] == "sessions":
+		c.serveSession(w, r, route[1])
+	case len(route) == 3 && route[0] == "sessions" && route[2] == "messages":
+		c.serveMessage(w, r, route[1])
+	case len(route) == 1 && route[0] == "events":
+		c.serveEvents(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// cookieValue is what the login cookie holds: a hash of the token, so the
+// token itself isn't kept by the browser.
+func (c *WebChannel) cookieValue() string {
+	sum := sha256.Sum256([]byte("picoclaw-web:" + c.token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *WebChannel) loggedIn(r *http.Request) bool {
+	cookie, err := r.Cookie(webCookie)
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(c.cookieValue())) == 1
+}
+
+func (c *WebChannel) serveLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		webError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, webMaxMessage)).Decode(&req); err != nil {
+		webError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(req.Token), []byte(c.token)) != 1 {
+		logger.WarnCF("web", "Failed web UI login", map[string]interface{}{
+			"remote": r.RemoteAddr,
+		})
+		webError(w, http.StatusUnauthorized, "wrong token")
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     webCookie,
+		Value:    c.cookieValue(),
+		Path:     webPath,
+		MaxAge:   30 * 24 * 3600,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteStrictMode,
+	})
+	webJSON(w, map[string]bool{"ok": true})
+}
+
+// serveSessions lists the chats, latest first, or starts one.
+func (c *WebChannel) serveSessions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		c.mu.Lock()
+		list := make([]webSession, 0, len(c.sessions))
+		for _, s := range c.sessions {
+			list = append(list, webSession{ID: s.ID, Title: s.Title, Updated: s.Updated})
+		}
+		c.mu.Unlock()
+		sort.Slice(list, func(i, j int) bool { return list[i].Updated.After(list[j].Updated) })
+		webJSON(w, list)
+	case http.MethodPost:
+		buf := make([]byte, 8)
+		if _, err := rand.Read(buf); err != nil {
+			webError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s := &webSession{ID: hex.EncodeToString(buf), Title: "New chat", Updated: time.Now()}
+		c.mu.Lock()
+		c.sessions[s.ID] = s
+		c.trimSessions()
+		err := c.save()
+		c.mu.Unlock()
+		if err != nil {
+			webError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		webJSON(w, s)
+	default:
+		webError(w, http.StatusMethodNotAllowed, "use GET or POST")
+	}
+}
+
+// trimSessions forgets the chats least recently used beyond
+// webMaxSessions. Callers hold c.mu.
+func (c *WebChannel) trimSessions() {
+	for len(c.sessions) > webMaxSessions {
+		var oldest *webSession
+		for _, s := range c.sessions {
+			if oldest == nil || s.Updated.Before(oldest.Updated) {
+				oldest = s
+			}
+		}
+		delete(c.sessions, oldest.ID)
+	}
+}
+
+// serveSession returns a chat with its transcript, or deletes it.
+func (c *WebChannel) serveSession(w http.ResponseWriter, r *http.Request, id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.sessions[id]
+	if s == nil {
+		webError(w, http.StatusNotFound, "no such chat")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		webJSON(w, s)
+	case http.MethodDelete:
+		delete(c.sessions, id)
+		if err := c.save(); err != nil {
+			webError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		webJSON(w, map[string]bool{"ok": true})
+	default:
+		webError(w, http.StatusMethodNotAllowed, "use GET or DELETE")
+	}
+}
+
+// serveMessage passes a message from the UI to the agent. A message sent
+// while an approval is open answers it.
+func (c *WebChannel) serveMessage(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPost {
+		webError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+	var req struct {
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, webMaxMessage)).Decode(&req); err != nil {
+		webError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	text := strings.TrimSpace(req.Text)
+	if text == "" {
+		webError(w, http.StatusBadRequest, "empty message")
+		return
+	}
+
+	c.mu.Lock()
+	s := c.sessions[id]
+	if s == nil {
+		c.mu.Unlock()
+		webError(w, http.StatusNotFound, "no such chat")
+		return
+	}
+	if n := len(s.Entries); n > 0 && s.Entries[n-1].Kind == webEntryApproval && s.Entries[n-1].Answer == "" {
+		s.Entries[n-1].Answer = text
+		c.changed(s, n-1)
+	}
+	if s.Title == "New chat" {
+		s.Title = utils.Truncate(strings.Join(strings.Fields(text), " "), 60)
+	}
+	c.mu.Unlock()
+
+	messageID := uuid.NewString()
+	if !c.Admit(webSender, id, messageID) {
+		webError(w, http.StatusTooManyRequests, "too many messages, slow down")
+		return
+	}
+	c.addEntry(id, webEntry{Kind: webEntryUser, Text: text})
+	c.HandleMessage(webSender, id, text, nil, map[string]string{"message_id": messageID})
+	webJSON(w, map[string]bool{"ok": true})
+}
+
+// serveEvents streams a chat's new and changed entries as server-sent
+// events until the browser goes away.
+func (c *WebChannel) serveEvents(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("session")
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		webError(w, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+
+	events := make(chan webEntry, 64)
+	c.mu.Lock()
+	if c.sessions[id] == nil {
+		c.mu.Unlock()
+		webError(w, http.StatusNotFound, "no such chat")
+		return
+	}
+	if c.clients[id] == nil {
+		c.clients[id] = make(map[chan webEntry]struct{})
+	}
+	c.clients[id][events] = struct{}{}
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.clients[id], events)
+		if len(c.clients[id]) == 0 {
+			delete(c.clients, id)
+		}
+		c.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case entry := <-events:
+			data, _ := json.Marshal(entry)
+			fmt.Fprintf(w, "data: %s\n\n", data)
+		}
+		flusher.Flush()
+	}
+}
+
+func webJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(v)
+}
+
+func webError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,187 @@
+//go:build !nowebui
+
+package channels
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// webClient logs in to a test server and calls the web UI's API.
+type webClient struct {
+	t      *testing.T
+	server *httptest.Server
+	client *http.Client
+}
+
+func (wc *webClient) do(method, path, body string) (*http.Response, []byte) {
+	wc.t.Helper()
+	req, err := http.NewRequest(method, wc.server.URL+path, strings.NewReader(body))
+	if err != nil {
+		wc.t.Fatal(err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := wc.client.Do(req)
+	if err != nil {
+		wc.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp, data
+}
+
+func newWebTest(t *testing.T) (*WebChannel, *bus.MessageBus, *webClient) {
+	t.Helper()
+	mb := bus.NewMessageBus()
+	c, err := NewWebChannel(config.WebConfig{Enabled: true, Token: "secret"}, filepath.Join(t.TempDir(), "web.json"), mb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Stop(context.Background()) })
+
+	mux := http.NewServeMux()
+	mux.Handle(c.HTTPPath(), c)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	jar, _ := cookiejar.New(nil)
+	return c, mb, &webClient{t: t, server: server, client: &http.Client{Jar: jar}}
+}
+
+// TestWebChannel_RequiresToken verifies the UI is not served without a
+// token.
+func TestWebChannel_RequiresToken(t *testing.T) {
+	if _, err := NewWebChannel(config.WebConfig{Enabled: true}, filepath.Join(t.TempDir(), "web.json"), bus.NewMessageBus()); err == nil {
+		t.Error("Expected an error without a token")
+	}
+}
+
+// TestWebChannel_Login verifies the page is public, the API needs the
+// login cookie, and only the right token sets it.
+func TestWebChannel_Login(t *testing.T) {
+	_, _, wc := newWebTest(t)
+
+	if resp, body := wc.do("GET", "/chat/", ""); resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "<title>PicoClaw</title>") {
+		t.Errorf("Expected the page, got %d", resp.StatusCode)
+	}
+	if resp, _ := wc.do("GET", "/chat/api/sessions", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 before login, got %d", resp.StatusCode)
+	}
+	if resp, _ := wc.do("POST", "/chat/api/login", `{"token":"wrong"}`); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a wrong token, got %d", resp.StatusCode)
+	}
+	resp, _ := wc.do("POST", "/chat/api/login", `{"token":"secret"}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected login to succeed, got %d", resp.StatusCode)
+	}
+	for _, cookie := range resp.Cookies() {
+		if cookie.Value == "secret" || !cookie.HttpOnly || cookie.SameSite != http.SameSiteStrictMode {
+			t.Errorf("Expected an HttpOnly, SameSite=Strict cookie without the token, got %+v", cookie)
+		}
+	}
+	if resp, _ := wc.do("GET", "/chat/api/sessions", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200 after login, got %d", resp.StatusCode)
+	}
+}
+
+// TestWebChannel_Chat verifies a message from the UI reaches the agent,
+// and that tool activity, approvals and the reply are added to the
+// transcript and streamed to the page.
+func TestWebChannel_Chat(t *testing.T) {
+	c, mb, wc := newWebTest(t)
+	wc.do("POST", "/chat/api/login", `{"token":"secret"}`)
+
+	_, body := wc.do("POST", "/chat/api/sessions", "{}")
+	var session webSession
+	if err := json.Unmarshal(body, &session); err != nil || session.ID == "" {
+		t.Fatalf("Expected a new chat, got %s", body)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", wc.server.URL+"/chat/api/events?session="+session.ID, nil)
+	stream, err := wc.client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Body.Close()
+	events := bufio.NewReader(stream.Body)
+	next := func() webEntry {
+		t.Helper()
+		for {
+			line, err := events.ReadString('\n')
+			if err != nil {
+				t.Fatalf("Event stream ended: %v", err)
+			}
+			if data, ok := strings.CutPrefix(strings.TrimSpace(line), "data: "); ok {
+				var e webEntry
+				json.Unmarshal([]byte(data), &e)
+				return e
+			}
+		}
+	}
+
+	if resp, _ := wc.do("POST", "/chat/api/sessions/"+session.ID+"/messages", `{"text":"list my files"}`); resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the message to be accepted, got %d", resp.StatusCode)
+	}
+	msg, ok := mb.ConsumeInbound(ctx)
+	if !ok || msg.Channel != "web" || msg.ChatID != session.ID || msg.Content != "list my files" {
+		t.Fatalf("Unexpected inbound message: %+v", msg)
+	}
+	if e := next(); e.Kind != webEntryUser || e.Text != "list my files" {
+		t.Errorf("Expected the user's message, got %+v", e)
+	}
+
+	mb.PublishActivity(bus.Activity{Channel: "web", ChatID: session.ID, Kind: bus.ActivityToolStart, Tool: "list_dir", Detail: `{"path":"."}`})
+	started := next()
+	mb.PublishActivity(bus.Activity{Channel: "web", ChatID: session.ID, Kind: bus.ActivityToolDone, Tool: "list_dir", Detail: "notes.txt"})
+	if e := next(); e.ID != started.ID || !e.Done || e.Args != `{"path":"."}` || e.Result != "notes.txt" {
+		t.Errorf("Expected the tool call to be updated with its result, got %+v", e)
+	}
+	mb.PublishActivity(bus.Activity{Channel: "web", ChatID: session.ID, Kind: bus.ActivityApproval, Tool: "exec", Detail: "rm notes.txt"})
+	if e := next(); e.Kind != webEntryApproval || e.Tool != "exec" {
+		t.Errorf("Expected an approval entry, got %+v", e)
+	}
+
+	if err := c.Send(ctx, bus.OutboundMessage{Channel: "web", ChatID: session.ID, Content: "Done."}); err != nil {
+		t.Fatal(err)
+	}
+	if e := next(); e.Kind != webEntryAssistant || e.Text != "Done." {
+		t.Errorf("Expected the reply, got %+v", e)
+	}
+	if err := c.Send(ctx, bus.OutboundMessage{Channel: "web", ChatID: "missing", Content: "x"}); !IsPermanent(err) {
+		t.Errorf("Expected a permanent error for an unknown chat, got %v", err)
+	}
+
+	_, body = wc.do("GET", "/chat/api/sessions/"+session.ID, "")
+	var transcript webSession
+	json.Unmarshal(body, &transcript)
+	if len(transcript.Entries) != 4 || transcript.Title != "list my files" {
+		t.Errorf("Expected 4 entries titled after the first message, got %q with %+v", transcript.Title, transcript.Entries)
+	}
+
+	// A restart keeps the chat
+	restarted, err := NewWebChannel(config.WebConfig{Token: "secret"}, c.storePath, mb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := restarted.sessions[session.ID]; s == nil || len(s.Entries) != 4 {
+		t.Errorf("Expected the transcript to survive a restart, got %+v", s)
+	}
+}
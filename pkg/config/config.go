@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
 
 	"github.com/caarlos0/env/v11"
@@ -44,39 +46,219 @@ func (f *FlexibleStringSlice) UnmarshalJSON(data []byte) error {
 }
 
 type Config struct {
-	Agents    AgentsConfig    `json:"agents"`
-	Channels  ChannelsConfig  `json:"channels"`
-	Providers ProvidersConfig `json:"providers"`
-	Gateway   GatewayConfig   `json:"gateway"`
-	Tools     ToolsConfig     `json:"tools"`
-	Heartbeat HeartbeatConfig `json:"heartbeat"`
-	Devices   DevicesConfig   `json:"devices"`
-	mu        sync.RWMutex
+	Agents     AgentsConfig     `json:"agents"`
+	Channels   ChannelsConfig   `json:"channels"`
+	Providers  ProvidersConfig  `json:"providers"`
+	Gateway    GatewayConfig    `json:"gateway"`
+	Tools      ToolsConfig      `json:"tools"`
+	Heartbeat  HeartbeatConfig  `json:"heartbeat"`
+	Scheduler  SchedulerConfig  `json:"scheduler"`
+	Devices    DevicesConfig    `json:"devices"`
+	Resources  ResourcesConfig  `json:"resources"`
+	Budget     BudgetConfig     `json:"budget"`
+	Hooks      []HookConfig     `json:"hooks,omitempty"`
+	Logging    LoggingConfig    `json:"logging"`
+	Federation FederationConfig `json:"federation"`
+	Voice      VoiceConfig      `json:"voice"`
+	Chaos      ChaosConfig      `json:"chaos"`
+	mu         sync.RWMutex
 }
 
 type AgentsConfig struct {
 	Defaults AgentDefaults `json:"defaults"`
+	// Profiles are named sets of settings, such as "work" or "coding",
+	// applied over the defaults with --profile or defaults.profile.
+	Profiles map[string]ProfileConfig `json:"profiles,omitempty"`
+	// Personas are named ways to speak, picked with defaults.persona, a
+	// profile's persona or /persona in a chat.
+	Personas map[string]PersonaConfig `json:"personas,omitempty"`
+}
+
+// PersonaConfig describes how the agent speaks. Empty fields leave it to
+// the model.
+type PersonaConfig struct {
+	Name      string `json:"name,omitempty"`      // what the agent calls itself
+	Tone      string `json:"tone,omitempty"`      // e.g. "warm and playful"
+	Verbosity string `json:"verbosity,omitempty"` // "terse", "brief", "normal" or "detailed"
+	Language  string `json:"language,omitempty"`  // e.g. "French"; "" answers in the user's language
+	MaxWords  int    `json:"max_words,omitempty"` // a soft limit on reply length
 }
 
 type AgentDefaults struct {
-	Workspace           string  `json:"workspace" env:"PICOCLAW_AGENTS_DEFAULTS_WORKSPACE"`
-	RestrictToWorkspace bool    `json:"restrict_to_workspace" env:"PICOCLAW_AGENTS_DEFAULTS_RESTRICT_TO_WORKSPACE"`
-	Provider            string  `json:"provider" env:"PICOCLAW_AGENTS_DEFAULTS_PROVIDER"`
-	Model               string  `json:"model" env:"PICOCLAW_AGENTS_DEFAULTS_MODEL"`
-	MaxTokens           int     `json:"max_tokens" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOKENS"`
-	Temperature         float64 `json:"temperature" env:"PICOCLAW_AGENTS_DEFAULTS_TEMPERATURE"`
-	MaxToolIterations   int     `json:"max_tool_iterations" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOOL_ITERATIONS"`
+	Workspace            string  `json:"workspace" env:"PICOCLAW_AGENTS_DEFAULTS_WORKSPACE"`
+	RestrictToWorkspace  bool    `json:"restrict_to_workspace" env:"PICOCLAW_AGENTS_DEFAULTS_RESTRICT_TO_WORKSPACE"`
+	Provider             string  `json:"provider" env:"PICOCLAW_AGENTS_DEFAULTS_PROVIDER"`
+	Model                string  `json:"model" env:"PICOCLAW_AGENTS_DEFAULTS_MODEL"`
+	MaxTokens            int     `json:"max_tokens" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOKENS"`
+	Temperature          float64 `json:"temperature" env:"PICOCLAW_AGENTS_DEFAULTS_TEMPERATURE"`
+	MaxToolIterations    int     `json:"max_tool_iterations" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOOL_ITERATIONS"`
+	MaxRepeatedToolCalls int     `json:"max_repeated_tool_calls" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_REPEATED_TOOL_CALLS"` // identical calls allowed per turn; 0 for no limit
+	PlanningHints        bool    `json:"planning_hints" env:"PICOCLAW_AGENTS_DEFAULTS_PLANNING_HINTS"`
+	FactExtraction       bool    `json:"fact_extraction" env:"PICOCLAW_AGENTS_DEFAULTS_FACT_EXTRACTION"`
+	PlanApproval         bool    `json:"plan_approval" env:"PICOCLAW_AGENTS_DEFAULTS_PLAN_APPROVAL"` // /plan waits for /plan go
+	DryRun               bool    `json:"dry_run" env:"PICOCLAW_AGENTS_DEFAULTS_DRY_RUN"`
+	// SharedFolders are folders outside the workspace the file tools and
+	// exec may use even when restricted to the workspace.
+	SharedFolders FlexibleStringSlice `json:"shared_folders,omitempty" env:"PICOCLAW_AGENTS_DEFAULTS_SHARED_FOLDERS"`
+	// VisionModel describes images for models that can't view them; it
+	// must be served by the same provider.
+	VisionModel string `json:"vision_model,omitempty" env:"PICOCLAW_AGENTS_DEFAULTS_VISION_MODEL"`
+	// ModelCapabilities overrides what a model supports, e.g.
+	// {"my-model": ["tools"]}; features not listed are treated as missing.
+	ModelCapabilities map[string]FlexibleStringSlice `json:"model_capabilities,omitempty"`
+	// ToolSchemas is how much of the tool schemas models get: "auto"
+	// (compact for models known to cope, full for others), "full",
+	// "compact" or "minimal".
+	ToolSchemas string `json:"tool_schemas" env:"PICOCLAW_AGENTS_DEFAULTS_TOOL_SCHEMAS"`
+	// SystemPrompt is added to the system prompt after the workspace files.
+	SystemPrompt string `json:"system_prompt,omitempty" env:"PICOCLAW_AGENTS_DEFAULTS_SYSTEM_PROMPT"`
+	// PromptTemplate is a template file, relative to the workspace, that
+	// replaces the built-in identity and rules of the system prompt.
+	PromptTemplate string `json:"prompt_template,omitempty" env:"PICOCLAW_AGENTS_DEFAULTS_PROMPT_TEMPLATE"`
+	// Profile is the profile in use unless --profile picks another.
+	Profile string `json:"profile,omitempty" env:"PICOCLAW_AGENTS_DEFAULTS_PROFILE"`
+	// Persona is the persona chats use unless they pick another.
+	Persona string `json:"persona,omitempty" env:"PICOCLAW_AGENTS_DEFAULTS_PERSONA"`
 }
 
 type ChannelsConfig struct {
-	Telegram TelegramConfig `json:"telegram"`
+	Telegram   TelegramConfig   `json:"telegram"`
+	Slack      SlackConfig      `json:"slack"`
+	Matrix     MatrixConfig     `json:"matrix"`
+	Email      EmailConfig      `json:"email"`
+	Web        WebConfig        `json:"web"`
+	MQTT       MQTTConfig       `json:"mqtt"`
+	Outbox     OutboxConfig     `json:"outbox"`
+	QuietHours QuietHoursConfig `json:"quiet_hours"`
+	Inbound    InboundConfig    `json:"inbound"`
+}
+
+// InboundConfig protects the agent from redelivered and flooding messages.
+// A message ID seen again within DedupeWindow seconds is dropped. Each
+// sender may send Burst messages at once, refilled at PerMinute; 0 turns
+// flood control off.
+type InboundConfig struct {
+	DedupeWindow int `json:"dedupe_window" env:"PICOCLAW_CHANNELS_INBOUND_DEDUPE_WINDOW"`
+	Burst        int `json:"burst" env:"PICOCLAW_CHANNELS_INBOUND_BURST"`
+	PerMinute    int `json:"per_minute" env:"PICOCLAW_CHANNELS_INBOUND_PER_MINUTE"`
 }
 
+// QuietHoursConfig holds proactive messages (heartbeat alerts, scheduled
+// jobs, device events) during a nightly window until it ends. Messages at
+// or above BreakThrough urgency (low, normal, high, critical) are sent
+// anyway. Users overrides the window per chat, keyed "channel:chat_id".
+type QuietHoursConfig struct {
+	Enabled      bool                      `json:"enabled" env:"PICOCLAW_CHANNELS_QUIET_HOURS_ENABLED"`
+	Start        string                    `json:"start" env:"PICOCLAW_CHANNELS_QUIET_HOURS_START"` // "22:00"
+	End          string                    `json:"end" env:"PICOCLAW_CHANNELS_QUIET_HOURS_END"`     // "07:00"
+	Timezone     string                    `json:"timezone" env:"PICOCLAW_CHANNELS_QUIET_HOURS_TIMEZONE"`
+	BreakThrough string                    `json:"break_through" env:"PICOCLAW_CHANNELS_QUIET_HOURS_BREAK_THROUGH"`
+	Users        map[string]QuietHoursRule `json:"users,omitempty"`
+}
+
+// QuietHoursRule is one chat's quiet window. Empty fields use the defaults.
+type QuietHoursRule struct {
+	Start        string `json:"start,omitempty"`
+	End          string `json:"end,omitempty"`
+	Timezone     string `json:"timezone,omitempty"`
+	BreakThrough string `json:"break_through,omitempty"`
+}
+
+// OutboxConfig controls retrying of outbound messages that failed to send.
+type OutboxConfig struct {
+	Enabled bool `json:"enabled" env:"PICOCLAW_CHANNELS_OUTBOX_ENABLED"`
+	MaxAge  int  `json:"max_age" env:"PICOCLAW_CHANNELS_OUTBOX_MAX_AGE"` // hours
+}
+
+// TelegramConfig configures the Telegram bot. Updates come by long polling
+// unless WebhookURL is set, in which case Telegram posts them to it and the
+// bot listens on WebhookListen (behind a TLS-terminating proxy).
 type TelegramConfig struct {
-	Enabled   bool                `json:"enabled" env:"PICOCLAW_CHANNELS_TELEGRAM_ENABLED"`
-	Token     string              `json:"token" env:"PICOCLAW_CHANNELS_TELEGRAM_TOKEN"`
-	Proxy     string              `json:"proxy" env:"PICOCLAW_CHANNELS_TELEGRAM_PROXY"`
-	AllowFrom FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_TELEGRAM_ALLOW_FROM"`
+	Enabled       bool                `json:"enabled" env:"PICOCLAW_CHANNELS_TELEGRAM_ENABLED"`
+	Token         string              `json:"token" env:"PICOCLAW_CHANNELS_TELEGRAM_TOKEN"`
+	Proxy         string              `json:"proxy" env:"PICOCLAW_CHANNELS_TELEGRAM_PROXY"`
+	AllowFrom     FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_TELEGRAM_ALLOW_FROM"`
+	AllowChats    FlexibleStringSlice `json:"allow_chats" env:"PICOCLAW_CHANNELS_TELEGRAM_ALLOW_CHATS"`
+	WebhookURL    string              `json:"webhook_url" env:"PICOCLAW_CHANNELS_TELEGRAM_WEBHOOK_URL"`
+	WebhookListen string              `json:"webhook_listen" env:"PICOCLAW_CHANNELS_TELEGRAM_WEBHOOK_LISTEN"`
+	WebhookSecret string              `json:"webhook_secret" env:"PICOCLAW_CHANNELS_TELEGRAM_WEBHOOK_SECRET"`
+}
+
+// SlackConfig configures the Slack app. It connects over Socket Mode, so
+// AppToken (xapp-) opens the event connection and BotToken (xoxb-) sends
+// replies. AllowChannels limits which channel IDs it answers in.
+type SlackConfig struct {
+	Enabled       bool                `json:"enabled" env:"PICOCLAW_CHANNELS_SLACK_ENABLED"`
+	BotToken      string              `json:"bot_token" env:"PICOCLAW_CHANNELS_SLACK_BOT_TOKEN"`
+	AppToken      string              `json:"app_token" env:"PICOCLAW_CHANNELS_SLACK_APP_TOKEN"`
+	AllowFrom     FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_SLACK_ALLOW_FROM"`
+	AllowChannels FlexibleStringSlice `json:"allow_channels" env:"PICOCLAW_CHANNELS_SLACK_ALLOW_CHANNELS"`
+}
+
+// EmailConfig configures the email channel. It checks Folder of the IMAP
+// mailbox every PollInterval seconds for unread mail and answers over
+// SMTP from Address (Username when empty). Each email thread is its own
+// session. Mail is only read from senders in AllowFrom, which is required.
+type EmailConfig struct {
+	Enabled      bool                `json:"enabled" env:"PICOCLAW_CHANNELS_EMAIL_ENABLED"`
+	IMAPServer   string              `json:"imap_server" env:"PICOCLAW_CHANNELS_EMAIL_IMAP_SERVER"` // host:port, TLS
+	SMTPServer   string              `json:"smtp_server" env:"PICOCLAW_CHANNELS_EMAIL_SMTP_SERVER"` // host:port; 465 is TLS, others STARTTLS
+	Username     string              `json:"username" env:"PICOCLAW_CHANNELS_EMAIL_USERNAME"`
+	Password     string              `json:"password" env:"PICOCLAW_CHANNELS_EMAIL_PASSWORD"`
+	Address      string              `json:"address" env:"PICOCLAW_CHANNELS_EMAIL_ADDRESS"`
+	Folder       string              `json:"folder" env:"PICOCLAW_CHANNELS_EMAIL_FOLDER"`
+	PollInterval int                 `json:"poll_interval" env:"PICOCLAW_CHANNELS_EMAIL_POLL_INTERVAL"` // seconds
+	AllowFrom    FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_EMAIL_ALLOW_FROM"`
+}
+
+// WebConfig serves a chat UI for the browser at /chat/ on the gateway.
+// Token is the password the UI asks for, and is required.
+type WebConfig struct {
+	Enabled bool   `json:"enabled" env:"PICOCLAW_CHANNELS_WEB_ENABLED"`
+	Token   string `json:"token" env:"PICOCLAW_CHANNELS_WEB_TOKEN"`
+}
+
+// MQTTConfig connects to a home-automation broker. Broker is
+// tcp://host:port, or mqtts://host:port for TLS. Each message on one of
+// Subscriptions is a prompt, with the topic as its chat; the agent's
+// replies are published to ReplyTopic, where "{topic}" stands for the
+// topic that started the chat. The mqtt tool uses the same broker.
+type MQTTConfig struct {
+	Enabled       bool               `json:"enabled" env:"PICOCLAW_CHANNELS_MQTT_ENABLED"`
+	Broker        string             `json:"broker" env:"PICOCLAW_CHANNELS_MQTT_BROKER"`
+	Username      string             `json:"username" env:"PICOCLAW_CHANNELS_MQTT_USERNAME"`
+	Password      string             `json:"password" env:"PICOCLAW_CHANNELS_MQTT_PASSWORD"`
+	ClientID      string             `json:"client_id" env:"PICOCLAW_CHANNELS_MQTT_CLIENT_ID"`
+	Subscriptions []MQTTSubscription `json:"subscriptions"`
+	ReplyTopic    string             `json:"reply_topic" env:"PICOCLAW_CHANNELS_MQTT_REPLY_TOPIC"`
+}
+
+// MQTTSubscription is a topic filter (+ and # allowed) whose messages
+// prompt the agent. Prompt says what to do with them. Messages on a topic
+// within Cooldown seconds of the last one that prompted are dropped, so a
+// chatty sensor doesn't flood the agent.
+type MQTTSubscription struct {
+	Topic    string `json:"topic"`
+	Prompt   string `json:"prompt,omitempty"`
+	QoS      int    `json:"qos,omitempty"`
+	Cooldown int    `json:"cooldown,omitempty"`
+}
+
+// MatrixConfig configures the Matrix client. It logs in with AccessToken,
+// or with Password once, keeping the token and device in the workspace's
+// state/matrix.json with its encryption keys. Encryption lets it read and
+// answer in end-to-end encrypted rooms; it is experimental and off by
+// default. Invites from users in AllowFrom are accepted; AllowRooms limits
+// which room IDs it answers in.
+type MatrixConfig struct {
+	Enabled     bool                `json:"enabled" env:"PICOCLAW_CHANNELS_MATRIX_ENABLED"`
+	Homeserver  string              `json:"homeserver" env:"PICOCLAW_CHANNELS_MATRIX_HOMESERVER"`
+	UserID      string              `json:"user_id" env:"PICOCLAW_CHANNELS_MATRIX_USER_ID"`
+	AccessToken string              `json:"access_token" env:"PICOCLAW_CHANNELS_MATRIX_ACCESS_TOKEN"`
+	Password    string              `json:"password" env:"PICOCLAW_CHANNELS_MATRIX_PASSWORD"`
+	Encryption  bool                `json:"encryption" env:"PICOCLAW_CHANNELS_MATRIX_ENCRYPTION"`
+	AllowFrom   FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_MATRIX_ALLOW_FROM"`
+	AllowRooms  FlexibleStringSlice `json:"allow_rooms" env:"PICOCLAW_CHANNELS_MATRIX_ALLOW_ROOMS"`
 }
 
 type HeartbeatConfig struct {
@@ -84,11 +266,185 @@ type HeartbeatConfig struct {
 	Interval int  `json:"interval" env:"PICOCLAW_HEARTBEAT_INTERVAL"` // minutes, min 5
 }
 
+// SchedulerConfig configures tasks run on cron schedules. Timezone (an IANA
+// name) is the zone cron expressions are read in; empty means the host's.
+// Runs missed while picoclaw was down are made up once on startup if they
+// are at most CatchUpHours old.
+type SchedulerConfig struct {
+	Enabled      bool                  `json:"enabled" env:"PICOCLAW_SCHEDULER_ENABLED"`
+	Timezone     string                `json:"timezone" env:"PICOCLAW_SCHEDULER_TIMEZONE"`
+	CatchUpHours int                   `json:"catch_up_hours" env:"PICOCLAW_SCHEDULER_CATCH_UP_HOURS"`
+	Tasks        []ScheduledTaskConfig `json:"tasks"`
+}
+
+// ScheduledTaskConfig is one scheduled task: a prompt for the agent, or a
+// workflow or report from the workspace, and where to send the result
+// ("channel:chat_id", or empty for the chat the user was last active in).
+type ScheduledTaskConfig struct {
+	Name     string `json:"name"`
+	Cron     string `json:"cron"`
+	Prompt   string `json:"prompt,omitempty"`
+	Workflow string `json:"workflow,omitempty"`
+	Report   string `json:"report,omitempty"`
+	Args     string `json:"args,omitempty"`
+	Notify   string `json:"notify,omitempty"`
+}
+
+// ChaosConfig injects provider faults for resilience testing. Each rate is
+// the fraction (0-1) of LLM requests that get that fault; at most one fault
+// is injected per request. Seed makes a run reproducible; 0 picks one.
+type ChaosConfig struct {
+	Enabled           bool    `json:"enabled" env:"PICOCLAW_CHAOS_ENABLED"`
+	Seed              int64   `json:"seed" env:"PICOCLAW_CHAOS_SEED"`
+	TimeoutRate       float64 `json:"timeout_rate" env:"PICOCLAW_CHAOS_TIMEOUT_RATE"`
+	RateLimitRate     float64 `json:"rate_limit_rate" env:"PICOCLAW_CHAOS_RATE_LIMIT_RATE"`
+	MalformedToolRate float64 `json:"malformed_tool_rate" env:"PICOCLAW_CHAOS_MALFORMED_TOOL_RATE"`
+	PartialRate       float64 `json:"partial_rate" env:"PICOCLAW_CHAOS_PARTIAL_RATE"`
+}
+
 type DevicesConfig struct {
 	Enabled    bool `json:"enabled" env:"PICOCLAW_DEVICES_ENABLED"`
 	MonitorUSB bool `json:"monitor_usb" env:"PICOCLAW_DEVICES_MONITOR_USB"`
 }
 
+// ResourcesConfig controls low-memory mode for small boards and the disk
+// quota.
+type ResourcesConfig struct {
+	LowMemory   string          `json:"low_memory" env:"PICOCLAW_RESOURCES_LOW_MEMORY"` // "auto", "on" or "off"
+	ThresholdMB int             `json:"threshold_mb" env:"PICOCLAW_RESOURCES_THRESHOLD_MB"`
+	Disk        DiskQuotaConfig `json:"disk"`
+}
+
+// DiskQuotaConfig caps the disk space used by the workspace, its cache
+// directory and downloaded attachments. MaxMB 0 disables the quota.
+type DiskQuotaConfig struct {
+	MaxMB       int `json:"max_mb" env:"PICOCLAW_RESOURCES_DISK_MAX_MB"`
+	WarnPercent int `json:"warn_percent" env:"PICOCLAW_RESOURCES_DISK_WARN_PERCENT"`
+}
+
+// BudgetConfig caps what the model may use per chat and per day, in
+// tokens or dollars. A limit of 0 is no limit. Dollars are worked out from
+// Prices, per model.
+type BudgetConfig struct {
+	SessionTokens int                   `json:"session_tokens" env:"PICOCLAW_BUDGET_SESSION_TOKENS"`
+	SessionUSD    float64               `json:"session_usd" env:"PICOCLAW_BUDGET_SESSION_USD"`
+	DailyTokens   int                   `json:"daily_tokens" env:"PICOCLAW_BUDGET_DAILY_TOKENS"`
+	DailyUSD      float64               `json:"daily_usd" env:"PICOCLAW_BUDGET_DAILY_USD"`
+	WarnPercent   int                   `json:"warn_percent" env:"PICOCLAW_BUDGET_WARN_PERCENT"`
+	Prices        map[string]ModelPrice `json:"prices,omitempty"`
+}
+
+// ModelPrice is what a model costs in US dollars per million tokens.
+type ModelPrice struct {
+	Prompt     float64 `json:"prompt"`
+	Completion float64 `json:"completion"`
+}
+
+// HookConfig runs a command or calls a webhook on an agent event, such as
+// each tool call, to log, redact or block it. See pkg/hooks for the
+// payload and the reply a hook may give.
+type HookConfig struct {
+	Name       string   `json:"name,omitempty"`
+	Event      string   `json:"event"`                 // "user_message", "tool_call", "tool_result", "assistant_message" or "error"
+	Exec       string   `json:"exec,omitempty"`        // command run with the payload on stdin
+	Webhook    string   `json:"webhook,omitempty"`     // URL the payload is POSTed to
+	Tools      []string `json:"tools,omitempty"`       // for tool events, only these tools; all if empty
+	Timeout    int      `json:"timeout,omitempty"`     // seconds; 5 if 0
+	Async      bool     `json:"async,omitempty"`       // don't wait for the hook, e.g. for logging
+	FailClosed bool     `json:"fail_closed,omitempty"` // block the event if the hook fails or times out
+}
+
+// LoggingConfig sets how much picoclaw logs and in what form. Components
+// sets the level per subsystem, such as "agent", "telegram" or "cron",
+// overriding Level.
+type LoggingConfig struct {
+	Level      string            `json:"level" env:"PICOCLAW_LOGGING_LEVEL"`   // "debug", "info", "warn" or "error"
+	Format     string            `json:"format" env:"PICOCLAW_LOGGING_FORMAT"` // "text" or "json"
+	File       string            `json:"file,omitempty" env:"PICOCLAW_LOGGING_FILE"`
+	Components map[string]string `json:"components,omitempty"`
+}
+
+// FederationConfig lets picoclaw instances delegate tasks to each other.
+// Tasks are served by the gateway on gateway.host:gateway.port.
+type FederationConfig struct {
+	Enabled bool         `json:"enabled" env:"PICOCLAW_FEDERATION_ENABLED"`
+	Name    string       `json:"name" env:"PICOCLAW_FEDERATION_NAME"`       // how this instance identifies itself to peers
+	Timeout int          `json:"timeout" env:"PICOCLAW_FEDERATION_TIMEOUT"` // seconds per delegated task
+	Peers   []PeerConfig `json:"peers"`
+}
+
+// PeerConfig is another instance. Both sides configure the same secret.
+type PeerConfig struct {
+	Name   string `json:"name"`
+	URL    string `json:"url"` // peer's gateway, e.g. http://vps.example.com:18790; empty to only accept its tasks
+	Secret string `json:"secret"`
+}
+
+// VoiceConfig controls spoken replies on channels that support voice notes.
+// Reply is the default for users who have not chosen with /voice: "off",
+// "voice" (answer voice notes with a voice note) or "always". Channels
+// overrides Reply and the voice per channel.
+type VoiceConfig struct {
+	Reply    string                        `json:"reply" env:"PICOCLAW_VOICE_REPLY"`
+	TTS      TTSConfig                     `json:"tts"`
+	STT      STTConfig                     `json:"stt"`
+	Channels map[string]VoiceChannelConfig `json:"channels,omitempty"`
+}
+
+// VoiceChannelConfig overrides the voice settings for one channel. Voice is
+// a voice name for an API, or an .onnx model for Piper.
+type VoiceChannelConfig struct {
+	Reply string `json:"reply,omitempty"`
+	Voice string `json:"voice,omitempty"`
+}
+
+// TTSConfig selects the text-to-speech engine. Provider is "openai", an
+// OpenAI-compatible endpoint, or "piper", which runs locally. An empty
+// APIKey falls back to the OpenAI provider's key and base URL.
+type TTSConfig struct {
+	Provider string      `json:"provider" env:"PICOCLAW_VOICE_TTS_PROVIDER"`
+	APIKey   string      `json:"api_key" env:"PICOCLAW_VOICE_TTS_API_KEY"`
+	APIBase  string      `json:"api_base" env:"PICOCLAW_VOICE_TTS_API_BASE"`
+	Model    string      `json:"model" env:"PICOCLAW_VOICE_TTS_MODEL"`
+	Voice    string      `json:"voice" env:"PICOCLAW_VOICE_TTS_VOICE"`
+	Piper    PiperConfig `json:"piper"`
+	MaxChars int         `json:"max_chars" env:"PICOCLAW_VOICE_TTS_MAX_CHARS"` // longer replies are cut at a sentence
+}
+
+// STTConfig selects how voice messages are transcribed. Provider is "groq"
+// (Whisper through the Groq provider's key), "whisper-server" (a
+// whisper.cpp server at URL) or "whisper" (the whisper.cpp program at Path
+// with Model). Language is a code such as "en", or empty to detect it.
+// EchoTranscript quotes the transcript above the answer.
+type STTConfig struct {
+	Provider       string `json:"provider" env:"PICOCLAW_VOICE_STT_PROVIDER"`
+	URL            string `json:"url,omitempty" env:"PICOCLAW_VOICE_STT_URL"`
+	Path           string `json:"path,omitempty" env:"PICOCLAW_VOICE_STT_PATH"`
+	Model          string `json:"model,omitempty" env:"PICOCLAW_VOICE_STT_MODEL"`
+	Language       string `json:"language,omitempty" env:"PICOCLAW_VOICE_STT_LANGUAGE"`
+	EchoTranscript bool   `json:"echo_transcript" env:"PICOCLAW_VOICE_STT_ECHO_TRANSCRIPT"`
+}
+
+// ModelPath returns Model with ~ expanded.
+func (c STTConfig) ModelPath() string {
+	return expandHome(c.Model)
+}
+
+// PiperConfig is the local Piper engine: the binary (piper on PATH if
+// empty) and the .onnx voice model to speak with.
+type PiperConfig struct {
+	Path  string `json:"path,omitempty" env:"PICOCLAW_VOICE_TTS_PIPER_PATH"`
+	Model string `json:"model" env:"PICOCLAW_VOICE_TTS_PIPER_MODEL"`
+}
+
+// ModelPath returns the voice model to use: voice if set, else Model.
+func (c PiperConfig) ModelPath(voice string) string {
+	if voice != "" {
+		return expandHome(voice)
+	}
+	return expandHome(c.Model)
+}
+
 type ProvidersConfig struct {
 	Anthropic    ProviderConfig `json:"anthropic"`
 	OpenAI       ProviderConfig `json:"openai"`
@@ -113,14 +469,33 @@ type ProviderConfig struct {
 
 // OllamaConfig has explicit env var support since it's commonly used locally
 type OllamaConfig struct {
-	APIBase string `json:"api_base" env:"OLLAMA_API_BASE"`
-	APIKey  string `json:"api_key" env:"OLLAMA_API_KEY"`
-	Proxy   string `json:"proxy,omitempty" env:"OLLAMA_PROXY"`
+	APIBase       string `json:"api_base" env:"OLLAMA_API_BASE"`
+	APIKey        string `json:"api_key" env:"OLLAMA_API_KEY"`
+	Proxy         string `json:"proxy,omitempty" env:"OLLAMA_PROXY"`
+	MaxConcurrent int    `json:"max_concurrent" env:"OLLAMA_MAX_CONCURRENT"` // requests at once, others queue; 0 is unlimited
 }
 
 type GatewayConfig struct {
-	Host string `json:"host" env:"PICOCLAW_GATEWAY_HOST"`
-	Port int    `json:"port" env:"PICOCLAW_GATEWAY_PORT"`
+	Host   string          `json:"host" env:"PICOCLAW_GATEWAY_HOST"`
+	Port   int             `json:"port" env:"PICOCLAW_GATEWAY_PORT"`
+	OpenAI OpenAIAPIConfig `json:"openai"`
+	Links  FileLinksConfig `json:"links"`
+}
+
+// FileLinksConfig sends attachments a channel can't deliver itself as
+// short-lived links to the gateway.
+type FileLinksConfig struct {
+	Enabled bool   `json:"enabled" env:"PICOCLAW_GATEWAY_LINKS_ENABLED"`
+	BaseURL string `json:"base_url" env:"PICOCLAW_GATEWAY_LINKS_BASE_URL"` // how users reach the gateway, e.g. https://claw.example.com
+	TTL     int    `json:"ttl" env:"PICOCLAW_GATEWAY_LINKS_TTL"`           // minutes a link works
+}
+
+// OpenAIAPIConfig serves the agent as an OpenAI-compatible chat completions
+// API at /v1 on the gateway. Clients authenticate with one of APIKeys.
+type OpenAIAPIConfig struct {
+	Enabled   bool                `json:"enabled" env:"PICOCLAW_GATEWAY_OPENAI_ENABLED"`
+	APIKeys   FlexibleStringSlice `json:"api_keys" env:"PICOCLAW_GATEWAY_OPENAI_API_KEYS"`
+	ModelName string              `json:"model_name" env:"PICOCLAW_GATEWAY_OPENAI_MODEL_NAME"` // model ID shown to clients
 }
 
 type BraveConfig struct {
@@ -140,33 +515,417 @@ type WebToolsConfig struct {
 }
 
 type WeatherConfig struct {
+	Enabled bool `json:"enabled" env:"PICOCLAW_TOOLS_WEATHER_ENABLED"`
+	// Provider is "openweathermap", "open-meteo" or "wttr". Empty picks
+	// OpenWeatherMap when an API key is set and Open-Meteo otherwise.
+	Provider   string `json:"provider" env:"PICOCLAW_TOOLS_WEATHER_PROVIDER"`
 	APIKey     string `json:"api_key" env:"PICOCLAW_TOOLS_WEATHER_API_KEY"`
-	DefaultZip string `json:"default_zip" env:"PICOCLAW_TOOLS_WEATHER_DEFAULT_ZIP"`
+	DefaultZip string `json:"default_zip" env:"PICOCLAW_TOOLS_WEATHER_DEFAULT_ZIP"` // ZIP code or city name
+	Units      string `json:"units" env:"PICOCLAW_TOOLS_WEATHER_UNITS"`             // "imperial" or "metric"
+	// OneCall uses the One Call 3.0 API for 7-day forecasts; it needs a
+	// separate OpenWeatherMap subscription.
+	OneCall bool `json:"one_call" env:"PICOCLAW_TOOLS_WEATHER_ONE_CALL"`
+}
+
+// LocationConfig controls the location tool, which geocodes places for the
+// model and other tools.
+type LocationConfig struct {
+	Enabled bool `json:"enabled" env:"PICOCLAW_TOOLS_LOCATION_ENABLED"`
+}
+
+// CalendarConfig configures the calendar tool. Timezone (an IANA name)
+// is the zone times are shown and entered in; empty means the host's.
+type CalendarConfig struct {
+	Enabled   bool                   `json:"enabled" env:"PICOCLAW_TOOLS_CALENDAR_ENABLED"`
+	Timezone  string                 `json:"timezone" env:"PICOCLAW_TOOLS_CALENDAR_TIMEZONE"`
+	Calendars []CalendarSourceConfig `json:"calendars"`
+}
+
+// CalendarSourceConfig is one calendar: a CalDAV collection URL
+// (type "caldav") or a local .ics file (type "ics").
+type CalendarSourceConfig struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	URL      string `json:"url,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	ReadOnly bool   `json:"read_only,omitempty"`
+}
+
+// FilePath returns the .ics path with ~ expanded.
+func (c CalendarSourceConfig) FilePath() string {
+	return expandHome(c.Path)
+}
+
+// RemindersConfig configures the reminder tool. Timezone (an IANA name) is
+// the zone reminder times are read in; empty means the host's.
+type RemindersConfig struct {
+	Timezone string `json:"timezone" env:"PICOCLAW_TOOLS_REMINDERS_TIMEZONE"`
+}
+
+// ApprovalConfig controls human-in-the-loop confirmation of tool calls.
+type ApprovalConfig struct {
+	Enabled             bool                `json:"enabled" env:"PICOCLAW_TOOLS_APPROVAL_ENABLED"`
+	RequireConfirmation FlexibleStringSlice `json:"require_confirmation" env:"PICOCLAW_TOOLS_APPROVAL_REQUIRE_CONFIRMATION"`
+	// AlwaysAllow holds "tool" or "tool:action" rules added by "always" replies.
+	AlwaysAllow FlexibleStringSlice `json:"always_allow"`
+	Timeout     int                 `json:"timeout" env:"PICOCLAW_TOOLS_APPROVAL_TIMEOUT"` // seconds
+}
+
+// ExecConfig selects where the exec tool runs commands. Backend is "host"
+// (the default), "docker"/"podman" to run each command in a disposable
+// container that only sees the workspace, or "landlock" to run on the host
+// with the kernel restricting file access to the workspace (Linux only).
+type ExecConfig struct {
+	Backend string `json:"backend" env:"PICOCLAW_TOOLS_EXEC_BACKEND"`
+	Image   string `json:"image" env:"PICOCLAW_TOOLS_EXEC_IMAGE"`
+	Network bool   `json:"network" env:"PICOCLAW_TOOLS_EXEC_NETWORK"`
+	Memory  string `json:"memory" env:"PICOCLAW_TOOLS_EXEC_MEMORY"`
+	CPUs    string `json:"cpus" env:"PICOCLAW_TOOLS_EXEC_CPUS"`
+	// StreamInterval is how often, in seconds, a running command sends its
+	// new output to the chat. 0 disables streaming.
+	StreamInterval int `json:"stream_interval" env:"PICOCLAW_TOOLS_EXEC_STREAM_INTERVAL"`
+	// MaxTimeout (seconds) and MaxOutputBytes cap the timeout_seconds and
+	// max_output_bytes the model may pass for a single command.
+	MaxTimeout     int           `json:"max_timeout" env:"PICOCLAW_TOOLS_EXEC_MAX_TIMEOUT"`
+	MaxOutputBytes int           `json:"max_output_bytes" env:"PICOCLAW_TOOLS_EXEC_MAX_OUTPUT_BYTES"`
+	Env            ExecEnvConfig `json:"env"`
+	// GuardOverride is "off" (blocked commands never run) or "approve" (the
+	// model may ask the user to run a blocked command once).
+	GuardOverride string          `json:"guard_override" env:"PICOCLAW_TOOLS_EXEC_GUARD_OVERRIDE"`
+	Guard         ExecGuardConfig `json:"guard"`
+	// LearnAllowlist records the commands the user approves in the audit
+	// log, for "picoclaw guard learn" to turn into allow patterns.
+	LearnAllowlist bool               `json:"learn_allowlist" env:"PICOCLAW_TOOLS_EXEC_LEARN_ALLOWLIST"`
+	Landlock       ExecLandlockConfig `json:"landlock"`
+}
+
+// ExecLandlockConfig lists what commands may access besides the workspace
+// under the landlock backend: ReadOnly paths can be read and executed,
+// ReadWrite paths also written. Missing paths are ignored.
+type ExecLandlockConfig struct {
+	ReadOnly  []string `json:"read_only"`
+	ReadWrite []string `json:"read_write"`
+}
+
+// Paths returns the read-only and read-write paths with ~ expanded.
+func (c ExecLandlockConfig) Paths() (readOnly, readWrite []string) {
+	for _, p := range c.ReadOnly {
+		readOnly = append(readOnly, expandHome(p))
+	}
+	for _, p := range c.ReadWrite {
+		readWrite = append(readWrite, expandHome(p))
+	}
+	return readOnly, readWrite
+}
+
+// ExecGuardConfig customizes the exec safety guard. Rules named like a
+// built-in rule change it (e.g. its severity, or "off" to disable it);
+// others are added. Allow, if set, lists regular expressions every command
+// in a command line must match.
+type ExecGuardConfig struct {
+	Rules []GuardRuleConfig `json:"rules"`
+	Allow []string          `json:"allow"`
+}
+
+// GuardRuleConfig is a named deny rule. Pattern is a case-insensitive
+// regular expression matched against each command from its name, wrappers
+// such as sudo stripped; Severity is "block" (the default), "confirm" to ask
+// the user first, or "off".
+type GuardRuleConfig struct {
+	Name     string `json:"name"`
+	Pattern  string `json:"pattern"`
+	Reason   string `json:"reason"`
+	Severity string `json:"severity"`
+	Safer    string `json:"safer"`
+}
+
+// ExecEnvConfig controls the environment of exec commands. Inherit lists the
+// variables passed through from picoclaw's environment (globs such as "LC_*";
+// empty passes all), Deny removes secret-looking ones even if inherited, and
+// SecretsFile is a JSON object of secrets calls may inject by name.
+type ExecEnvConfig struct {
+	Inherit     []string `json:"inherit"`
+	Deny        []string `json:"deny"`
+	SecretsFile string   `json:"secrets_file" env:"PICOCLAW_TOOLS_EXEC_SECRETS_FILE"`
+}
+
+// SecretsPath returns the secrets file path with ~ expanded.
+func (c ExecEnvConfig) SecretsPath() string {
+	return expandHome(c.SecretsFile)
+}
+
+// ConcurrencyConfig bounds parallel tool calls. Workers is the number of
+// calls running at once (0 picks one for the host); PerTool caps single
+// tools on top, e.g. {"exec": 1}.
+type ConcurrencyConfig struct {
+	Workers int            `json:"workers" env:"PICOCLAW_TOOLS_CONCURRENCY_WORKERS"`
+	PerTool map[string]int `json:"per_tool"`
+}
+
+// PluginsConfig configures tools provided by external executables. Dir
+// defaults to the workspace's plugins folder; Timeout bounds each call, in
+// seconds.
+type PluginsConfig struct {
+	Enabled bool   `json:"enabled" env:"PICOCLAW_TOOLS_PLUGINS_ENABLED"`
+	Dir     string `json:"dir,omitempty" env:"PICOCLAW_TOOLS_PLUGINS_DIR"`
+	Timeout int    `json:"timeout" env:"PICOCLAW_TOOLS_PLUGINS_TIMEOUT"`
+}
+
+// Path returns the plugins folder: Dir, or plugins in workspace.
+func (c PluginsConfig) Path(workspace string) string {
+	if c.Dir != "" {
+		return expandHome(c.Dir)
+	}
+	return filepath.Join(workspace, "plugins")
+}
+
+// OutputConfig caps the tool output the model sees. A result longer than
+// MaxChars, or its PerTool cap, is saved to the workspace's artifacts
+// folder and the model gets its start and end and the file's path.
+// MaxTurnChars caps the results of one turn together. 0 turns a cap off.
+type OutputConfig struct {
+	MaxChars     int            `json:"max_chars" env:"PICOCLAW_TOOLS_OUTPUT_MAX_CHARS"`
+	MaxTurnChars int            `json:"max_turn_chars" env:"PICOCLAW_TOOLS_OUTPUT_MAX_TURN_CHARS"`
+	PerTool      map[string]int `json:"per_tool"`
+}
+
+// KnowledgeConfig configures the documents added with picoclaw ingest and
+// the knowledge_search tool. Documents are cut into chunks of about
+// ChunkChars, each repeating ChunkOverlap of the one before.
+type KnowledgeConfig struct {
+	Enabled      bool            `json:"enabled" env:"PICOCLAW_TOOLS_KNOWLEDGE_ENABLED"`
+	ChunkChars   int             `json:"chunk_chars" env:"PICOCLAW_TOOLS_KNOWLEDGE_CHUNK_CHARS"`
+	ChunkOverlap int             `json:"chunk_overlap" env:"PICOCLAW_TOOLS_KNOWLEDGE_CHUNK_OVERLAP"`
+	Embedding    EmbeddingConfig `json:"embedding"`
+}
+
+// EmbeddingConfig is the OpenAI-compatible /embeddings endpoint documents
+// are embedded with, such as OpenAI or a local Ollama. Empty APIKey and
+// APIBase fall back to the OpenAI provider's; with neither, documents are
+// found by keywords only.
+type EmbeddingConfig struct {
+	APIKey  string `json:"api_key" env:"PICOCLAW_TOOLS_KNOWLEDGE_EMBEDDING_API_KEY"`
+	APIBase string `json:"api_base" env:"PICOCLAW_TOOLS_KNOWLEDGE_EMBEDDING_API_BASE"`
+	Model   string `json:"model" env:"PICOCLAW_TOOLS_KNOWLEDGE_EMBEDDING_MODEL"`
+}
+
+// SQLConfig configures the sql tool. SQLite files in the workspace can be
+// opened by path; Databases names others by a postgres:// or mysql:// URL
+// or an SQLite path. Databases are read-only unless Writable. MaxRows is
+// how many rows a query shows by default, Timeout is in seconds.
+type SQLConfig struct {
+	Enabled   bool                         `json:"enabled" env:"PICOCLAW_TOOLS_SQL_ENABLED"`
+	MaxRows   int                          `json:"max_rows" env:"PICOCLAW_TOOLS_SQL_MAX_ROWS"`
+	Timeout   int                          `json:"timeout" env:"PICOCLAW_TOOLS_SQL_TIMEOUT"`
+	Databases map[string]SQLDatabaseConfig `json:"databases,omitempty"`
+}
+
+type SQLDatabaseConfig struct {
+	DSN      string `json:"dsn"`
+	Writable bool   `json:"writable,omitempty"`
+}
+
+// Source returns DSN, with ~ expanded if it is an SQLite path.
+func (c SQLDatabaseConfig) Source() string {
+	if strings.Contains(c.DSN, "://") {
+		return c.DSN
+	}
+	return expandHome(c.DSN)
+}
+
+// PythonConfig configures the python tool. Backend is "host", "docker" or
+// "podman"; empty uses the exec tool's backend. Image is the container
+// image and Python the host interpreter. MemoryMB caps an interpreter's
+// memory and CPUSeconds the CPU time of one call (0 for no limit);
+// Timeout is the wall-clock limit of a call in seconds, and an
+// interpreter unused for IdleMinutes is stopped.
+type PythonConfig struct {
+	Enabled     bool   `json:"enabled" env:"PICOCLAW_TOOLS_PYTHON_ENABLED"`
+	Backend     string `json:"backend" env:"PICOCLAW_TOOLS_PYTHON_BACKEND"`
+	Image       string `json:"image" env:"PICOCLAW_TOOLS_PYTHON_IMAGE"`
+	Python      string `json:"python" env:"PICOCLAW_TOOLS_PYTHON_PYTHON"`
+	MemoryMB    int    `json:"memory_mb" env:"PICOCLAW_TOOLS_PYTHON_MEMORY_MB"`
+	CPUSeconds  int    `json:"cpu_seconds" env:"PICOCLAW_TOOLS_PYTHON_CPU_SECONDS"`
+	Timeout     int    `json:"timeout" env:"PICOCLAW_TOOLS_PYTHON_TIMEOUT"`
+	IdleMinutes int    `json:"idle_minutes" env:"PICOCLAW_TOOLS_PYTHON_IDLE_MINUTES"`
+}
+
+// BrowserConfig configures the browser tool. Binary is Chromium or Chrome;
+// empty finds one on the PATH. AllowedDomains, if set, are the only sites
+// (with their subdomains) pages may be opened from. Timeout is the
+// seconds an action may take; the browser stops after IdleMinutes unused.
+type BrowserConfig struct {
+	Enabled        bool                `json:"enabled" env:"PICOCLAW_TOOLS_BROWSER_ENABLED"`
+	Binary         string              `json:"binary" env:"PICOCLAW_TOOLS_BROWSER_BINARY"`
+	AllowedDomains FlexibleStringSlice `json:"allowed_domains" env:"PICOCLAW_TOOLS_BROWSER_ALLOWED_DOMAINS"`
+	Timeout        int                 `json:"timeout" env:"PICOCLAW_TOOLS_BROWSER_TIMEOUT"`
+	IdleMinutes    int                 `json:"idle_minutes" env:"PICOCLAW_TOOLS_BROWSER_IDLE_MINUTES"`
+}
+
+// MQTTToolConfig configures the mqtt tool, which publishes to and reads
+// from the broker in channels.mqtt. AllowPublish, if set, are the only
+// topic filters it may publish to.
+type MQTTToolConfig struct {
+	Enabled      bool                `json:"enabled" env:"PICOCLAW_TOOLS_MQTT_ENABLED"`
+	AllowPublish FlexibleStringSlice `json:"allow_publish" env:"PICOCLAW_TOOLS_MQTT_ALLOW_PUBLISH"`
+}
+
+// ScreenshotConfig controls the screenshot tool, which captures the
+// desktop the gateway runs on. It is off by default, since whatever is
+// on screen reaches the model.
+type ScreenshotConfig struct {
+	Enabled bool `json:"enabled" env:"PICOCLAW_TOOLS_SCREENSHOT_ENABLED"`
+}
+
+// NotifyConfig configures notifications: the notify tool, and alerts for
+// proactive messages. Desktop shows them on the machine picoclaw runs on;
+// Ntfy, Pushover and Gotify push them to the user's phone. Proactive is
+// "fallback" to send reminders and scheduled results as notifications
+// when they have no open chat to go to, "always" to send them as
+// notifications too, or "off".
+type NotifyConfig struct {
+	Enabled   bool           `json:"enabled" env:"PICOCLAW_TOOLS_NOTIFY_ENABLED"`
+	Desktop   bool           `json:"desktop" env:"PICOCLAW_TOOLS_NOTIFY_DESKTOP"`
+	Ntfy      NtfyConfig     `json:"ntfy"`
+	Pushover  PushoverConfig `json:"pushover"`
+	Gotify    GotifyConfig   `json:"gotify"`
+	Proactive string         `json:"proactive" env:"PICOCLAW_TOOLS_NOTIFY_PROACTIVE"`
+}
+
+// NtfyConfig publishes to Topic on Server (ntfy.sh when empty). Token is
+// an access token for protected topics.
+type NtfyConfig struct {
+	Server string `json:"server" env:"PICOCLAW_TOOLS_NOTIFY_NTFY_SERVER"`
+	Topic  string `json:"topic" env:"PICOCLAW_TOOLS_NOTIFY_NTFY_TOPIC"`
+	Token  string `json:"token" env:"PICOCLAW_TOOLS_NOTIFY_NTFY_TOKEN"`
+}
+
+// PushoverConfig sends with an application's AppToken to UserKey.
+type PushoverConfig struct {
+	AppToken string `json:"app_token" env:"PICOCLAW_TOOLS_NOTIFY_PUSHOVER_APP_TOKEN"`
+	UserKey  string `json:"user_key" env:"PICOCLAW_TOOLS_NOTIFY_PUSHOVER_USER_KEY"`
+}
+
+// GotifyConfig sends to the Gotify server at URL with an application Token.
+type GotifyConfig struct {
+	URL   string `json:"url" env:"PICOCLAW_TOOLS_NOTIFY_GOTIFY_URL"`
+	Token string `json:"token" env:"PICOCLAW_TOOLS_NOTIFY_GOTIFY_TOKEN"`
+}
+
+// TasksConfig configures the tasks tool, whose list is kept in tasks.db in
+// the workspace. Setting Todoist or CalDAV syncs the list with it;
+// Todoist is used if both are set.
+type TasksConfig struct {
+	Enabled bool              `json:"enabled" env:"PICOCLAW_TOOLS_TASKS_ENABLED"`
+	Todoist TodoistConfig     `json:"todoist"`
+	CalDAV  TasksCalDAVConfig `json:"caldav"`
+}
+
+// TodoistConfig syncs with Todoist using the API Token from its
+// integration settings.
+type TodoistConfig struct {
+	Token string `json:"token" env:"PICOCLAW_TOOLS_TASKS_TODOIST_TOKEN"`
+}
+
+// TasksCalDAVConfig syncs with the CalDAV task list collection at URL.
+type TasksCalDAVConfig struct {
+	URL      string `json:"url" env:"PICOCLAW_TOOLS_TASKS_CALDAV_URL"`
+	Username string `json:"username" env:"PICOCLAW_TOOLS_TASKS_CALDAV_USERNAME"`
+	Password string `json:"password" env:"PICOCLAW_TOOLS_TASKS_CALDAV_PASSWORD"`
 }
 
 type ToolsConfig struct {
-	Web     WebToolsConfig `json:"web"`
-	Weather WeatherConfig  `json:"weather"`
+	Web         WebToolsConfig    `json:"web"`
+	Weather     WeatherConfig     `json:"weather"`
+	Location    LocationConfig    `json:"location"`
+	Calendar    CalendarConfig    `json:"calendar"`
+	Reminders   RemindersConfig   `json:"reminders"`
+	Approval    ApprovalConfig    `json:"approval"`
+	Exec        ExecConfig        `json:"exec"`
+	Concurrency ConcurrencyConfig `json:"concurrency"`
+	Plugins     PluginsConfig     `json:"plugins"`
+	Output      OutputConfig      `json:"output"`
+	Knowledge   KnowledgeConfig   `json:"knowledge"`
+	SQL         SQLConfig         `json:"sql"`
+	Python      PythonConfig      `json:"python"`
+	Browser     BrowserConfig     `json:"browser"`
+	MQTT        MQTTToolConfig    `json:"mqtt"`
+	Screenshot  ScreenshotConfig  `json:"screenshot"`
+	Notify      NotifyConfig      `json:"notify"`
+	Tasks       TasksConfig       `json:"tasks"`
+	// Disabled lists tools (or "namespace__*" groups) that stay registered
+	// but are never offered to the model.
+	Disabled FlexibleStringSlice `json:"disabled,omitempty" env:"PICOCLAW_TOOLS_DISABLED"`
+	// Enabled, if set, lists the only tools (or groups) offered; Disabled
+	// still applies on top.
+	Enabled FlexibleStringSlice `json:"enabled,omitempty" env:"PICOCLAW_TOOLS_ENABLED"`
 }
 
 func DefaultConfig() *Config {
 	return &Config{
 		Agents: AgentsConfig{
 			Defaults: AgentDefaults{
-				Workspace:           "~/.picoclaw/workspace",
-				RestrictToWorkspace: true,
-				Provider:            "",
-				Model:               "glm-4.7",
-				MaxTokens:           8192,
-				Temperature:         0.7,
-				MaxToolIterations:   20,
+				Workspace:            "~/.picoclaw/workspace",
+				RestrictToWorkspace:  true,
+				Provider:             "",
+				Model:                "glm-4.7",
+				MaxTokens:            8192,
+				Temperature:          0.7,
+				MaxToolIterations:    20,
+				MaxRepeatedToolCalls: 3,
+				PlanningHints:        true,
+				FactExtraction:       true,
+				PlanApproval:         true,
+				ToolSchemas:          "auto",
 			},
 		},
 		Channels: ChannelsConfig{
 			Telegram: TelegramConfig{
-				Enabled:   false,
-				Token:     "",
-				AllowFrom: FlexibleStringSlice{},
+				Enabled:       false,
+				Token:         "",
+				AllowFrom:     FlexibleStringSlice{},
+				AllowChats:    FlexibleStringSlice{},
+				WebhookListen: "127.0.0.1:8443",
+			},
+			Slack: SlackConfig{
+				Enabled:       false,
+				AllowFrom:     FlexibleStringSlice{},
+				AllowChannels: FlexibleStringSlice{},
+			},
+			Matrix: MatrixConfig{
+				Enabled:    false,
+				AllowFrom:  FlexibleStringSlice{},
+				AllowRooms: FlexibleStringSlice{},
+			},
+			Email: EmailConfig{
+				Enabled:      false,
+				Folder:       "INBOX",
+				PollInterval: 60,
+				AllowFrom:    FlexibleStringSlice{},
+			},
+			Web: WebConfig{
+				Enabled: false,
+			},
+			MQTT: MQTTConfig{
+				Enabled:    false,
+				ReplyTopic: "picoclaw/reply",
+			},
+			Outbox: OutboxConfig{
+				Enabled: true,
+				MaxAge:  24,
+			},
+			QuietHours: QuietHoursConfig{
+				Enabled:      false,
+				Start:        "22:00",
+				End:          "07:00",
+				BreakThrough: "high",
+			},
+			Inbound: InboundConfig{
+				DedupeWindow: 600,
+				Burst:        5,
+				PerMinute:    20,
 			},
 		},
 		Providers: ProvidersConfig{
@@ -180,11 +939,39 @@ func DefaultConfig() *Config {
 			Nvidia:       ProviderConfig{},
 			Moonshot:     ProviderConfig{},
 			ShengSuanYun: ProviderConfig{},
-			Ollama:       OllamaConfig{APIBase: "http://localhost:11434"},
+			Ollama:       OllamaConfig{APIBase: "http://localhost:11434", MaxConcurrent: 1},
 		},
 		Gateway: GatewayConfig{
 			Host: "0.0.0.0",
 			Port: 18790,
+			OpenAI: OpenAIAPIConfig{
+				Enabled:   false,
+				APIKeys:   FlexibleStringSlice{},
+				ModelName: "picoclaw",
+			},
+			Links: FileLinksConfig{
+				Enabled: false,
+				TTL:     60,
+			},
+		},
+		Federation: FederationConfig{
+			Enabled: false,
+			Name:    "picoclaw",
+			Timeout: 300,
+			Peers:   []PeerConfig{},
+		},
+		Voice: VoiceConfig{
+			Reply: "off",
+			TTS: TTSConfig{
+				Provider: "openai",
+				Model:    "gpt-4o-mini-tts",
+				Voice:    "alloy",
+				MaxChars: 1500,
+			},
+			STT: STTConfig{
+				Provider:       "groq",
+				EchoTranscript: true,
+			},
 		},
 		Tools: ToolsConfig{
 			Web: WebToolsConfig{
@@ -198,45 +985,158 @@ func DefaultConfig() *Config {
 					MaxResults: 5,
 				},
 			},
+			Weather: WeatherConfig{
+				Enabled: true,
+			},
+			Location: LocationConfig{
+				Enabled: true,
+			},
+			Exec: ExecConfig{
+				Backend:        "host",
+				Image:          "alpine:3.20",
+				Memory:         "512m",
+				CPUs:           "1",
+				StreamInterval: 15,
+				MaxTimeout:     1800,
+				MaxOutputBytes: 200000,
+				Env: ExecEnvConfig{
+					Inherit: []string{"PATH", "HOME", "USER", "LOGNAME", "SHELL", "LANG", "LC_*", "TERM", "TZ", "TMPDIR",
+						"SYSTEMROOT", "COMSPEC", "PATHEXT", "WINDIR", "TEMP", "TMP", "USERPROFILE", "APPDATA", "LOCALAPPDATA"},
+					Deny: []string{"AWS_*", "*_TOKEN", "*_SECRET", "*_SECRET_*", "*_KEY", "*_PASSWORD", "*_PASSWD",
+						"*_CREDENTIALS", "PICOCLAW_*"},
+					SecretsFile: "~/.picoclaw/secrets.json",
+				},
+				GuardOverride: "off",
+				Landlock: ExecLandlockConfig{
+					ReadOnly:  []string{"/usr", "/bin", "/sbin", "/lib", "/lib64", "/etc", "/opt", "/proc", "/dev"},
+					ReadWrite: []string{"/tmp", "/dev/null"},
+				},
+			},
+			Concurrency: ConcurrencyConfig{
+				PerTool: map[string]int{
+					"exec":      1,
+					"web_fetch": 4,
+				},
+			},
+			Plugins: PluginsConfig{
+				Enabled: true,
+				Timeout: 60,
+			},
+			Output: OutputConfig{
+				MaxChars:     16000,
+				MaxTurnChars: 80000,
+				PerTool: map[string]int{
+					"read_file": 50000,
+				},
+			},
+			Knowledge: KnowledgeConfig{
+				Enabled:      true,
+				ChunkChars:   1200,
+				ChunkOverlap: 200,
+				Embedding: EmbeddingConfig{
+					Model: "text-embedding-3-small",
+				},
+			},
+			SQL: SQLConfig{
+				Enabled: true,
+				MaxRows: 100,
+				Timeout: 30,
+			},
+			Python: PythonConfig{
+				Enabled:     true,
+				Image:       "python:3.12-slim",
+				Python:      "python3",
+				MemoryMB:    512,
+				CPUSeconds:  60,
+				Timeout:     60,
+				IdleMinutes: 30,
+			},
+			Browser: BrowserConfig{
+				Enabled:     true,
+				Timeout:     30,
+				IdleMinutes: 10,
+			},
+			MQTT: MQTTToolConfig{
+				Enabled: true,
+			},
+			Notify: NotifyConfig{
+				Enabled:   true,
+				Proactive: "fallback",
+			},
+			Tasks: TasksConfig{
+				Enabled: true,
+			},
 		},
 		Heartbeat: HeartbeatConfig{
 			Enabled:  true,
 			Interval: 30, // default 30 minutes
 		},
+		Scheduler: SchedulerConfig{
+			Enabled:      false,
+			CatchUpHours: 6,
+		},
 		Devices: DevicesConfig{
 			Enabled:    false,
 			MonitorUSB: true,
 		},
+		Resources: ResourcesConfig{
+			LowMemory:   "auto",
+			ThresholdMB: 512,
+			Disk: DiskQuotaConfig{
+				WarnPercent: 90,
+			},
+		},
+		Budget: BudgetConfig{
+			WarnPercent: 80,
+		},
+		Logging: LoggingConfig{
+			Level:  "info",
+			Format: "text",
+		},
 	}
 }
 
+// LoadConfig reads the JSON or YAML config file at path over the defaults
+// and applies PICOCLAW_* environment variables. A missing file is not an
+// error.
 func LoadConfig(path string) (*Config, error) {
-	cfg := DefaultConfig()
-
-	data, err := os.ReadFile(path)
+	cfg, err := LoadConfigFile(path)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return cfg, nil
-		}
 		return nil, err
 	}
 
-	if err := json.Unmarshal(data, cfg); err != nil {
+	if err := env.Parse(cfg); err != nil {
 		return nil, err
 	}
-
-	if err := env.Parse(cfg); err != nil {
+	if err := resolveSecrets(cfg); err != nil {
 		return nil, err
 	}
 
 	return cfg, nil
 }
 
+// LoadConfigFile reads the config file at path over the defaults, without
+// environment overrides, for changing and saving it.
+func LoadConfigFile(path string) (*Config, error) {
+	cfg := DefaultConfig()
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := decodeConfig(path, data, cfg); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// SaveConfig writes cfg to path, as YAML if path ends in .yaml or .yml.
 func SaveConfig(path string, cfg *Config) error {
 	cfg.mu.RLock()
 	defer cfg.mu.RUnlock()
 
-	data, err := json.MarshalIndent(cfg, "", "  ")
+	data, err := encodeConfig(path, cfg)
 	if err != nil {
 		return err
 	}
@@ -249,12 +1149,58 @@ func SaveConfig(path string, cfg *Config) error {
 	return os.WriteFile(path, data, 0600)
 }
 
+// AddApprovalRule appends an always-allow rule to the config file at path.
+func AddApprovalRule(path, rule string) error {
+	return updateConfigFile(path, func(cfg *Config) {
+		if !slices.Contains(cfg.Tools.Approval.AlwaysAllow, rule) {
+			cfg.Tools.Approval.AlwaysAllow = append(cfg.Tools.Approval.AlwaysAllow, rule)
+		}
+	})
+}
+
+// AddAllowPatterns appends exec allow patterns not already present to the
+// config file at path.
+func AddAllowPatterns(path string, patterns []string) error {
+	return updateConfigFile(path, func(cfg *Config) {
+		for _, pattern := range patterns {
+			if !slices.Contains(cfg.Tools.Exec.Guard.Allow, pattern) {
+				cfg.Tools.Exec.Guard.Allow = append(cfg.Tools.Exec.Guard.Allow, pattern)
+			}
+		}
+	})
+}
+
+// updateConfigFile applies update to the config file at path. The file is
+// re-read without environment overrides so that secrets passed via env are
+// not written to disk.
+func updateConfigFile(path string, update func(cfg *Config)) error {
+	cfg, err := LoadConfigFile(path)
+	if err != nil {
+		return err
+	}
+	update(cfg)
+	return SaveConfig(path, cfg)
+}
+
 func (c *Config) WorkspacePath() string {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 	return expandHome(c.Agents.Defaults.Workspace)
 }
 
+// SharedFolderPaths returns the shared folders with ~ expanded.
+func (c *Config) SharedFolderPaths() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var paths []string
+	for _, p := range c.Agents.Defaults.SharedFolders {
+		if p = expandHome(strings.TrimSpace(p)); p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
 func (c *Config) GetAPIKey() string {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -0,0 +1,235 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is built in layers, each overriding the one before:
+//
+//  1. DefaultConfig
+//  2. the config file, JSON or YAML (see ConfigPath)
+//  3. PICOCLAW_* environment variables
+//  4. overrides from the command line (see ApplyOverrides)
+//
+// YAML files use the same key names as JSON. Any value may be
+// "keyring:<name>", which is replaced by that secret from the OS keyring
+// (see package secrets); LoadConfigFile leaves such values as they are, so
+// the secrets are never saved to the file.
+
+// ConfigPath finds the config file: $PICOCLAW_CONFIG if set, else the
+// first of config.yaml, config.yml and config.json in
+// $XDG_CONFIG_HOME/picoclaw (~/.config/picoclaw), else ~/.picoclaw/config.json,
+// which is also where a new config goes.
+func ConfigPath() string {
+	if path := os.Getenv("PICOCLAW_CONFIG"); path != "" {
+		return expandHome(path)
+	}
+	home, _ := os.UserHomeDir()
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		dir = filepath.Join(home, ".config")
+	}
+	for _, name := range []string{"config.yaml", "config.yml", "config.json"} {
+		path := filepath.Join(dir, "picoclaw", name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return filepath.Join(home, ".picoclaw", "config.json")
+}
+
+// isYAML reports whether path names a YAML file.
+func isYAML(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// decodeConfig reads data, in the format path's extension names, into cfg.
+func decodeConfig(path string, data []byte, cfg *Config) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var tree interface{}
+		if err := yaml.Unmarshal(data, &tree); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if tree == nil {
+			return nil
+		}
+		// Go through JSON so YAML uses the JSON key names and types
+		converted, err := json.Marshal(tree)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		data = converted
+	case ".toml":
+		return fmt.Errorf("%s: TOML is not supported, use YAML or JSON", path)
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// encodeConfig renders cfg as JSON, or as YAML with the fields in the same
+// order if path is a YAML file.
+func encodeConfig(path string, cfg *Config) ([]byte, error) {
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil || !isYAML(path) {
+		return data, err
+	}
+	// JSON is YAML: parse it into nodes to keep the order, then drop the
+	// JSON quoting and brackets.
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+	plainStyle(&node)
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func plainStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		plainStyle(child)
+	}
+}
+
+// ApplyOverrides sets config keys from key=value pairs, such as
+// "agents.defaults.model=gpt-4o" from --set. Keys are dotted JSON names.
+// Values are taken as JSON where the key holds a number, boolean or
+// object; a list also takes comma-separated items. "keyring:" values are
+// resolved.
+func ApplyOverrides(cfg *Config, overrides []string) error {
+	if len(overrides) == 0 {
+		return nil
+	}
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	if err := applyOverrides(cfg, overrides); err != nil {
+		return err
+	}
+	return resolveSecrets(cfg)
+}
+
+// applyOverrides is ApplyOverrides without resolving secrets or locking.
+func applyOverrides(cfg *Config, overrides []string) error {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	var tree map[string]interface{}
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return err
+	}
+	for _, override := range overrides {
+		key, value, ok := strings.Cut(override, "=")
+		if !ok || key == "" {
+			return fmt.Errorf("override %q is not key=value", override)
+		}
+		path := strings.Split(key, ".")
+		if err := setKey(tree, path, value, keyType(reflect.TypeOf((*Config)(nil)), path)); err != nil {
+			return fmt.Errorf("override %s: %w", key, err)
+		}
+	}
+
+	data, err = json.Marshal(tree)
+	if err != nil {
+		return err
+	}
+	// Unknown keys are caught here; keys in maps such as model_capabilities are free
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	updated := DefaultConfig()
+	if err := dec.Decode(updated); err != nil {
+		return fmt.Errorf("invalid override: %w", err)
+	}
+	return json.Unmarshal(data, cfg)
+}
+
+// setKey sets the value at path in tree, parsed for a key of type typ.
+func setKey(tree map[string]interface{}, path []string, value string, typ reflect.Type) error {
+	for _, name := range path[:len(path)-1] {
+		next, ok := tree[name].(map[string]interface{})
+		if !ok {
+			if tree[name] != nil {
+				return fmt.Errorf("%s is not a section", name)
+			}
+			next = map[string]interface{}{}
+			tree[name] = next
+		}
+		tree = next
+	}
+
+	name := path[len(path)-1]
+	if typ != nil {
+		switch {
+		case typ.Kind() == reflect.String:
+			tree[name] = value
+			return nil
+		case typ.Kind() == reflect.Slice && typ.Elem().Kind() == reflect.String && !strings.HasPrefix(strings.TrimSpace(value), "["):
+			items := []interface{}{}
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			tree[name] = items
+			return nil
+		}
+	}
+	var parsed interface{}
+	if err := json.Unmarshal([]byte(value), &parsed); err != nil {
+		// Not JSON: a string, left for the decoder to accept or refuse
+		parsed = value
+	}
+	tree[name] = parsed
+	return nil
+}
+
+// keyType finds the Go type of the field at a dotted JSON path, or nil if
+// there is none.
+func keyType(typ reflect.Type, path []string) reflect.Type {
+	for _, name := range path {
+		for typ.Kind() == reflect.Pointer {
+			typ = typ.Elem()
+		}
+		switch typ.Kind() {
+		case reflect.Map:
+			typ = typ.Elem()
+		case reflect.Struct:
+			field, ok := jsonField(typ, name)
+			if !ok {
+				return nil
+			}
+			typ = field.Type
+		default:
+			return nil
+		}
+	}
+	return typ
+}
+
+func jsonField(typ reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if tag == name || (tag == "" && field.IsExported() && strings.EqualFold(field.Name, name)) {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
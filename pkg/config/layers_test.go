@@ -0,0 +1,137 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestLoadConfig_YAML verifies a YAML file uses the JSON key names and
+// that environment variables override it.
+func TestLoadConfig_YAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	yaml := `
+agents:
+  defaults:
+    model: llama3.2
+    max_tokens: 4096
+tools:
+  exec:
+    guard:
+      allow: ["git status", "ls"]
+`
+	if err := os.WriteFile(path, []byte(yaml), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PICOCLAW_AGENTS_DEFAULTS_MAX_TOKENS", "2048")
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.Agents.Defaults.Model != "llama3.2" {
+		t.Errorf("Expected model llama3.2, got %q", cfg.Agents.Defaults.Model)
+	}
+	if cfg.Agents.Defaults.MaxTokens != 2048 {
+		t.Errorf("Expected the environment to win with 2048, got %d", cfg.Agents.Defaults.MaxTokens)
+	}
+	if len(cfg.Tools.Exec.Guard.Allow) != 2 {
+		t.Errorf("Expected 2 allow patterns, got %v", cfg.Tools.Exec.Guard.Allow)
+	}
+	if cfg.Agents.Defaults.MaxToolIterations != DefaultConfig().Agents.Defaults.MaxToolIterations {
+		t.Errorf("Expected unset keys to keep their defaults, got %d", cfg.Agents.Defaults.MaxToolIterations)
+	}
+}
+
+// TestLoadConfig_EnvWithoutFile verifies environment variables apply when
+// there is no config file.
+func TestLoadConfig_EnvWithoutFile(t *testing.T) {
+	t.Setenv("PICOCLAW_AGENTS_DEFAULTS_MODEL", "from-env")
+	cfg, err := LoadConfig(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Agents.Defaults.Model != "from-env" {
+		t.Errorf("Expected from-env, got %q", cfg.Agents.Defaults.Model)
+	}
+}
+
+// TestSaveConfig_YAML verifies a YAML config is written back as YAML that
+// loads the same.
+func TestSaveConfig_YAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	cfg := DefaultConfig()
+	cfg.Agents.Defaults.Model = "123"
+	cfg.Tools.Exec.Guard.Allow = []string{"git status"}
+	if err := SaveConfig(path, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if !strings.HasPrefix(string(data), "agents:\n  defaults:\n") || strings.Contains(string(data), "{") {
+		t.Errorf("Expected block-style YAML in field order, got:\n%s", data)
+	}
+	loaded, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Agents.Defaults.Model != "123" || len(loaded.Tools.Exec.Guard.Allow) != 1 {
+		t.Errorf("Expected the saved values back, got %q and %v", loaded.Agents.Defaults.Model, loaded.Tools.Exec.Guard.Allow)
+	}
+}
+
+// TestApplyOverrides verifies --set values are typed like the keys they
+// set and that unknown keys and bad values are refused.
+func TestApplyOverrides(t *testing.T) {
+	cfg := DefaultConfig()
+	err := ApplyOverrides(cfg, []string{
+		"agents.defaults.model=42",
+		"agents.defaults.max_tokens=1024",
+		"agents.defaults.restrict_to_workspace=false",
+		"tools.exec.guard.allow=git status, ls",
+		"channels.telegram.allow_from=[\"123\"]",
+	})
+	if err != nil {
+		t.Fatalf("ApplyOverrides failed: %v", err)
+	}
+	d := cfg.Agents.Defaults
+	if d.Model != "42" || d.MaxTokens != 1024 || d.RestrictToWorkspace {
+		t.Errorf("Expected model 42, 1024 tokens and no restriction, got %q, %d, %v", d.Model, d.MaxTokens, d.RestrictToWorkspace)
+	}
+	if allow := cfg.Tools.Exec.Guard.Allow; len(allow) != 2 || allow[1] != "ls" {
+		t.Errorf("Expected [git status ls], got %v", allow)
+	}
+	if from := cfg.Channels.Telegram.AllowFrom; len(from) != 1 || from[0] != "123" {
+		t.Errorf("Expected [123], got %v", from)
+	}
+
+	for _, bad := range []string{"agents.defaults.modle=x", "agents.defaults.max_tokens=lots", "model"} {
+		if err := ApplyOverrides(DefaultConfig(), []string{bad}); err == nil {
+			t.Errorf("Expected %q to be refused", bad)
+		}
+	}
+}
+
+// TestConfigPath verifies the lookup order of config files.
+func TestConfigPath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("PICOCLAW_CONFIG", "")
+
+	if got := ConfigPath(); got != filepath.Join(home, ".picoclaw", "config.json") {
+		t.Errorf("Expected the legacy path by default, got %s", got)
+	}
+	dir := filepath.Join(home, ".config", "picoclaw")
+	os.MkdirAll(dir, 0700)
+	os.WriteFile(filepath.Join(dir, "config.json"), []byte("{}"), 0600)
+	os.WriteFile(filepath.Join(dir, "config.yaml"), []byte("{}"), 0600)
+	if got := ConfigPath(); got != filepath.Join(dir, "config.yaml") {
+		t.Errorf("Expected config.yaml first, got %s", got)
+	}
+	t.Setenv("PICOCLAW_CONFIG", "/etc/picoclaw.yaml")
+	if got := ConfigPath(); got != "/etc/picoclaw.yaml" {
+		t.Errorf("Expected PICOCLAW_CONFIG, got %s", got)
+	}
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultProfile names the plain config, with no profile applied.
+const DefaultProfile = "default"
+
+// ProfileConfig bundles the settings a profile changes. Empty fields keep
+// the defaults, except Workspace: each profile gets its own, by default
+// the default workspace with "-<profile>" added, so its sessions, memory
+// and files stay apart.
+type ProfileConfig struct {
+	Model          string              `json:"model,omitempty"`
+	Provider       string              `json:"provider,omitempty"`
+	SystemPrompt   string              `json:"system_prompt,omitempty"`
+	PromptTemplate string              `json:"prompt_template,omitempty"`
+	Persona        string              `json:"persona,omitempty"`
+	Tools          FlexibleStringSlice `json:"tools,omitempty"` // the only tools offered, as in tools.enabled
+	Workspace      string              `json:"workspace,omitempty"`
+}
+
+// ProfileNames returns the configured profiles, sorted.
+func (c *Config) ProfileNames() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	names := make([]string, 0, len(c.Agents.Profiles))
+	for name := range c.Agents.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ApplyProfile applies the named profile over the defaults. DefaultProfile,
+// unless configured as a profile, leaves the defaults as they are.
+func (c *Config) ApplyProfile(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	profile, ok := c.Agents.Profiles[name]
+	if !ok {
+		if name == DefaultProfile {
+			c.Agents.Defaults.Profile = ""
+			return nil
+		}
+		names := make([]string, 0, len(c.Agents.Profiles))
+		for known := range c.Agents.Profiles {
+			names = append(names, known)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return fmt.Errorf("no profile %q: agents.profiles is empty", name)
+		}
+		return fmt.Errorf("no profile %q; profiles are %s", name, strings.Join(names, ", "))
+	}
+
+	d := &c.Agents.Defaults
+	d.Profile = name
+	if profile.Model != "" {
+		d.Model = profile.Model
+	}
+	if profile.Provider != "" {
+		d.Provider = profile.Provider
+	}
+	if profile.SystemPrompt != "" {
+		d.SystemPrompt = profile.SystemPrompt
+	}
+	if profile.PromptTemplate != "" {
+		d.PromptTemplate = profile.PromptTemplate
+	}
+	if profile.Persona != "" {
+		d.Persona = profile.Persona
+	}
+	if len(profile.Tools) > 0 {
+		c.Tools.Enabled = profile.Tools
+	}
+	if profile.Workspace != "" {
+		d.Workspace = profile.Workspace
+	} else {
+		d.Workspace = strings.TrimRight(d.Workspace, `/\`) + "-" + name
+	}
+	return nil
+}
+
+// SessionsPath is where sessions are stored: the workspace's sessions
+// folder, or a folder in it for the profile in use, so profiles sharing a
+// workspace don't share chats.
+func (c *Config) SessionsPath() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	path := filepath.Join(expandHome(c.Agents.Defaults.Workspace), "sessions")
+	if profile := c.Agents.Defaults.Profile; profile != "" {
+		path = filepath.Join(path, "profiles", profile)
+	}
+	return path
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestApplyProfile verifies a profile replaces the settings it sets, gets
+// a workspace of its own, and keeps its sessions apart.
+func TestApplyProfile(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Agents.Defaults.Workspace = "/data/workspace"
+	cfg.Agents.Profiles = map[string]ProfileConfig{
+		"coding": {Model: "qwen-coder", SystemPrompt: "Answer with code.", PromptTemplate: "prompts/coder.md", Tools: []string{"read_file", "exec"}},
+		"home":   {Workspace: "/data/home"},
+	}
+
+	if err := cfg.ApplyProfile("coding"); err != nil {
+		t.Fatalf("ApplyProfile failed: %v", err)
+	}
+	d := cfg.Agents.Defaults
+	if d.Model != "qwen-coder" || d.SystemPrompt != "Answer with code." || len(cfg.Tools.Enabled) != 2 {
+		t.Errorf("Expected the coding settings, got %q, %q and %v", d.Model, d.SystemPrompt, cfg.Tools.Enabled)
+	}
+	if d.PromptTemplate != "prompts/coder.md" {
+		t.Errorf("Expected the profile's prompt template, got %q", d.PromptTemplate)
+	}
+	if d.Workspace != "/data/workspace-coding" || d.Temperature != DefaultConfig().Agents.Defaults.Temperature {
+		t.Errorf("Expected its own workspace and default temperature, got %s and %v", d.Workspace, d.Temperature)
+	}
+	if got := cfg.SessionsPath(); got != filepath.Join("/data/workspace-coding", "sessions", "profiles", "coding") {
+		t.Errorf("Expected a sessions folder for the profile, got %s", got)
+	}
+
+	home := DefaultConfig()
+	home.Agents.Profiles = cfg.Agents.Profiles
+	home.ApplyProfile("home")
+	if home.Agents.Defaults.Workspace != "/data/home" || home.Agents.Defaults.Model != DefaultConfig().Agents.Defaults.Model {
+		t.Errorf("Expected the home workspace and the default model, got %s and %s", home.Agents.Defaults.Workspace, home.Agents.Defaults.Model)
+	}
+
+	plain := DefaultConfig()
+	plain.Agents.Profiles = cfg.Agents.Profiles
+	if err := plain.ApplyProfile(DefaultProfile); err != nil || plain.SessionsPath() != filepath.Join(expandHome(plain.Agents.Defaults.Workspace), "sessions") {
+		t.Errorf("Expected the default profile to change nothing, got %v and %s", err, plain.SessionsPath())
+	}
+	if err := plain.ApplyProfile("wrok"); err == nil || !strings.Contains(err.Error(), "coding, home") {
+		t.Errorf("Expected an error listing the profiles, got %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/secrets"
+)
+
+// secretStore is where "keyring:<name>" values are looked up.
+var secretStore = secrets.Default
+
+// resolveSecrets replaces each value of the form "keyring:<name>" with the
+// secret of that name from the OS keyring.
+func resolveSecrets(cfg *Config) error {
+	var store secrets.Store
+	return resolveSecretValues(reflect.ValueOf(cfg).Elem(), "", func(name string) (string, error) {
+		if store == nil {
+			store = secretStore()
+		}
+		return store.Get(name)
+	})
+}
+
+func resolveSecretValues(v reflect.Value, path string, get func(name string) (string, error)) error {
+	switch v.Kind() {
+	case reflect.String:
+		name, ok := secrets.ParseRef(v.String())
+		if !ok {
+			return nil
+		}
+		value, err := get(name)
+		if err != nil {
+			return fmt.Errorf("%s: secret %q from the keyring: %w", path, name, err)
+		}
+		v.SetString(value)
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if !t.Field(i).IsExported() {
+				continue
+			}
+			name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+			if name == "" {
+				name = strings.ToLower(t.Field(i).Name)
+			}
+			if err := resolveSecretValues(v.Field(i), joinKey(path, name), get); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := resolveSecretValues(v.Index(i), fmt.Sprintf("%s[%d]", path, i), get); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		// Map values can't be set in place: resolve a copy and put it back
+		iter := v.MapRange()
+		for iter.Next() {
+			value := reflect.New(iter.Value().Type()).Elem()
+			value.Set(iter.Value())
+			if err := resolveSecretValues(value, joinKey(path, fmt.Sprint(iter.Key())), get); err != nil {
+				return err
+			}
+			v.SetMapIndex(iter.Key(), value)
+		}
+	case reflect.Pointer:
+		if !v.IsNil() {
+			return resolveSecretValues(v.Elem(), path, get)
+		}
+	}
+	return nil
+}
+
+func joinKey(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// CheckSecretKey reports whether key is a config key a secret can fill.
+func CheckSecretKey(key string) error {
+	if typ := keyType(reflect.TypeOf((*Config)(nil)), strings.Split(key, ".")); typ == nil || typ.Kind() != reflect.String {
+		return fmt.Errorf("%s is not a config key that takes text", key)
+	}
+	return nil
+}
+
+// UseSecret points key in the config file at path to the keyring secret
+// name, replacing any value written there.
+func UseSecret(path, key, name string) error {
+	if err := CheckSecretKey(key); err != nil {
+		return err
+	}
+	cfg, err := LoadConfigFile(path)
+	if err != nil {
+		return err
+	}
+	if err := applyOverrides(cfg, []string{key + "=" + secrets.Ref(name)}); err != nil {
+		return err
+	}
+	return SaveConfig(path, cfg)
+}
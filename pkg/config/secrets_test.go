@@ -0,0 +1,92 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/secrets"
+)
+
+// mapStore is a secrets.Store backed by a map.
+type mapStore map[string]string
+
+func (mapStore) Name() string { return "test store" }
+
+func (s mapStore) Get(name string) (string, error) {
+	if value, ok := s[name]; ok {
+		return value, nil
+	}
+	return "", secrets.ErrNotFound
+}
+
+func (s mapStore) Set(name, value string) error { s[name] = value; return nil }
+func (s mapStore) Delete(name string) error     { delete(s, name); return nil }
+func (s mapStore) List() ([]string, error)      { return nil, nil }
+
+func useStore(t *testing.T, store secrets.Store) {
+	original := secretStore
+	secretStore = func() secrets.Store { return store }
+	t.Cleanup(func() { secretStore = original })
+}
+
+// TestLoadConfig_Secrets verifies "keyring:" values are replaced with the
+// stored secret, including inside maps, and that a missing one is an error
+// naming the key.
+func TestLoadConfig_Secrets(t *testing.T) {
+	useStore(t, mapStore{"openai": "sk-from-keyring", "coder": "coder-model"})
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := `{
+  "providers": {"openai": {"api_key": "keyring:openai"}, "groq": {"api_key": "gsk-plain"}},
+  "agents": {"profiles": {"coding": {"model": "keyring:coder"}}}
+}`
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.Providers.OpenAI.APIKey != "sk-from-keyring" || cfg.Providers.Groq.APIKey != "gsk-plain" {
+		t.Errorf("Expected the keyring and plain keys, got %q and %q", cfg.Providers.OpenAI.APIKey, cfg.Providers.Groq.APIKey)
+	}
+	if got := cfg.Agents.Profiles["coding"].Model; got != "coder-model" {
+		t.Errorf("Expected secrets in maps to resolve, got %q", got)
+	}
+
+	useStore(t, mapStore{"coder": "coder-model"})
+	_, err = LoadConfig(path)
+	if err == nil || !strings.Contains(err.Error(), "providers.openai.api_key") {
+		t.Errorf("Expected an error naming providers.openai.api_key, got %v", err)
+	}
+}
+
+// TestUseSecret verifies the config file gets the reference, not the
+// secret, and that only text keys are accepted.
+func TestUseSecret(t *testing.T) {
+	useStore(t, mapStore{"vllm": "sk-secret"})
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"providers": {"vllm": {"api_base": "http://localhost:8000/v1"}}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := UseSecret(path, "providers.vllm.api_key", "vllm"); err != nil {
+		t.Fatalf("UseSecret failed: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), `"keyring:vllm"`) || strings.Contains(string(data), "sk-secret") {
+		t.Errorf("Expected the file to hold the reference only, got %s", data)
+	}
+	if !strings.Contains(string(data), "http://localhost:8000/v1") {
+		t.Errorf("Expected the other values kept, got %s", data)
+	}
+
+	if err := UseSecret(path, "agents.defaults.max_tokens", "vllm"); err == nil {
+		t.Error("Expected a number key to be rejected")
+	}
+	if err := UseSecret(path, "providers.vllm.no_such_key", "vllm"); err == nil {
+		t.Error("Expected an unknown key to be rejected")
+	}
+}
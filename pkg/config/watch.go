@@ -0,0 +1,192 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// watchInterval is how often Watch checks the config file.
+var watchInterval = 2 * time.Second
+
+// liveKeys are the config keys a running agent picks up on reload; a key
+// matches itself and everything under it. "*" matches one section.
+var liveKeys = []string{
+	"tools.disabled",
+	"tools.enabled",
+	"tools.exec.guard",
+	"tools.exec.guard_override",
+	"agents.defaults.model",
+	"agents.defaults.temperature",
+	"agents.defaults.max_tokens",
+	"agents.defaults.max_tool_iterations",
+	"agents.defaults.max_repeated_tool_calls",
+	"agents.defaults.persona",
+	"agents.personas",
+	"channels.*.allow_from",
+}
+
+// Watch checks path for changes until ctx is done. When the file changes
+// it reloads the config with load, logs what changed, and passes the new
+// config to apply if any key a running agent can pick up changed. A config
+// that fails to load is logged and the current one kept.
+func Watch(ctx context.Context, path string, current *Config, load func() (*Config, error), apply func(*Config)) {
+	last := fileStamp(path)
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		stamp := fileStamp(path)
+		if stamp == last {
+			continue
+		}
+		last = stamp
+
+		updated, err := load()
+		if err != nil {
+			logger.ErrorCF("config", "Config reload failed, keeping the current config",
+				map[string]interface{}{"path": path, "error": err.Error()})
+			continue
+		}
+		live, restart := splitLive(Diff(current, updated))
+		if len(live) == 0 && len(restart) == 0 {
+			continue
+		}
+		fields := map[string]interface{}{"path": path}
+		if len(live) > 0 {
+			fields["applied"] = strings.Join(live, "; ")
+		}
+		if len(restart) > 0 {
+			fields["needs_restart"] = strings.Join(restart, "; ")
+		}
+		logger.InfoCF("config", "Config file changed", fields)
+		current = updated
+		if len(live) > 0 {
+			apply(updated)
+		}
+	}
+}
+
+// fileStamp identifies a version of the file by size and modification
+// time; "" if it is missing.
+func fileStamp(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%d:%d", info.Size(), info.ModTime().UnixNano())
+}
+
+// Diff describes the keys that differ between two configs, one
+// "key: old -> new" per key, sorted. Values of secret keys are left out.
+func Diff(old, updated *Config) []string {
+	before, after := flatten(old), flatten(updated)
+	var changes []string
+	for key, value := range after {
+		if prev, ok := before[key]; !ok || prev != value {
+			changes = append(changes, describeChange(key, before[key], value))
+		}
+	}
+	for key, prev := range before {
+		if _, ok := after[key]; !ok {
+			changes = append(changes, describeChange(key, prev, ""))
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+func describeChange(key, old, updated string) string {
+	last := strings.ToLower(key[strings.LastIndex(key, ".")+1:])
+	for _, secret := range []string{"key", "token", "secret", "password"} {
+		if strings.Contains(last, secret) {
+			return key + ": changed"
+		}
+	}
+	return fmt.Sprintf("%s: %s -> %s", key, shorten(old), shorten(updated))
+}
+
+func shorten(value string) string {
+	if value == "" {
+		return "(unset)"
+	}
+	if len(value) > 60 {
+		return value[:57] + "..."
+	}
+	return value
+}
+
+// flatten maps the dotted JSON key of each value in cfg to its JSON text.
+// Lists are kept whole.
+func flatten(cfg *Config) map[string]string {
+	cfg.mu.RLock()
+	data, err := json.Marshal(cfg)
+	cfg.mu.RUnlock()
+	flat := map[string]string{}
+	if err != nil {
+		return flat
+	}
+	var tree map[string]interface{}
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return flat
+	}
+	var walk func(prefix string, value interface{})
+	walk = func(prefix string, value interface{}) {
+		if section, ok := value.(map[string]interface{}); ok {
+			for name, child := range section {
+				walk(prefix+"."+name, child)
+			}
+			return
+		}
+		text, _ := json.Marshal(value)
+		flat[strings.TrimPrefix(prefix, ".")] = string(text)
+	}
+	walk("", tree)
+	return flat
+}
+
+// splitLive sorts changes from Diff into those a running agent picks up
+// and those that need a restart.
+func splitLive(changes []string) (live, restart []string) {
+	for _, change := range changes {
+		key, _, _ := strings.Cut(change, ": ")
+		if isLiveKey(key) {
+			live = append(live, change)
+		} else {
+			restart = append(restart, change)
+		}
+	}
+	return live, restart
+}
+
+func isLiveKey(key string) bool {
+	parts := strings.Split(key, ".")
+	for _, live := range liveKeys {
+		pattern := strings.Split(live, ".")
+		if len(parts) < len(pattern) {
+			continue
+		}
+		match := true
+		for i, name := range pattern {
+			if name != "*" && name != parts[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
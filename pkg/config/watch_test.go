@@ -0,0 +1,65 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestDiff verifies changed keys are listed with their values, secrets
+// are masked, and live keys are told apart from those needing a restart.
+func TestDiff(t *testing.T) {
+	old := DefaultConfig()
+	updated := DefaultConfig()
+	updated.Agents.Defaults.Model = "gpt-4o"
+	updated.Providers.OpenAI.APIKey = "sk-secret"
+	updated.Channels.Telegram.AllowFrom = []string{"123"}
+	updated.Gateway.Port = 9999
+
+	changes := Diff(old, updated)
+	joined := strings.Join(changes, "\n")
+	if len(changes) != 4 || !strings.Contains(joined, "agents.defaults.model: "+`"`+old.Agents.Defaults.Model+`" -> "gpt-4o"`) {
+		t.Errorf("Expected 4 changes including the model, got:\n%s", joined)
+	}
+	if strings.Contains(joined, "sk-secret") || !strings.Contains(joined, "providers.openai.api_key: changed") {
+		t.Errorf("Expected the API key to be masked, got:\n%s", joined)
+	}
+
+	live, restart := splitLive(changes)
+	if len(live) != 2 || len(restart) != 2 {
+		t.Errorf("Expected model and allow_from live, got live %v and restart %v", live, restart)
+	}
+}
+
+// TestWatch verifies an edited config file is loaded and applied, and a
+// broken one is skipped.
+func TestWatch(t *testing.T) {
+	defer func(interval time.Duration) { watchInterval = interval }(watchInterval)
+	watchInterval = 10 * time.Millisecond
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{}`), 0600)
+	current, _ := LoadConfigFile(path)
+
+	applied := make(chan *Config, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go Watch(ctx, path, current, func() (*Config, error) { return LoadConfigFile(path) },
+		func(cfg *Config) { applied <- cfg })
+
+	os.WriteFile(path, []byte(`{"agents": {"defaults": {"model": `), 0600)
+	time.Sleep(50 * time.Millisecond)
+	os.WriteFile(path, []byte(`{"tools": {"disabled": ["exec"]}}`), 0600)
+
+	select {
+	case cfg := <-applied:
+		if len(cfg.Tools.Disabled) != 1 || cfg.Tools.Disabled[0] != "exec" {
+			t.Errorf("Expected exec disabled, got %v", cfg.Tools.Disabled)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the edited config to be applied")
+	}
+}
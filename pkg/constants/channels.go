@@ -4,9 +4,11 @@ package constants
 // InternalChannels defines channels that are used for internal communication
 // and should not be exposed to external users or recorded as last active channel.
 var InternalChannels = map[string]bool{
-	"cli":      true,
-	"system":   true,
-	"subagent": true,
+	"cli":        true,
+	"system":     true,
+	"subagent":   true,
+	"federation": true,
+	"openai":     true,
 }
 
 // IsInternalChannel returns true if the channel is an internal channel.
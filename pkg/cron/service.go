@@ -5,13 +5,14 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"log"
 	"os"
 	"path/filepath"
 	"sync"
 	"time"
 
 	"github.com/adhocore/gronx"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
 )
 
 type CronSchedule struct {
@@ -22,6 +23,10 @@ type CronSchedule struct {
 	TZ      string `json:"tz,omitempty"`
 }
 
+// PayloadReminder marks jobs created by the reminder tool: their message
+// is sent to the user as-is, wherever they were last active.
+const PayloadReminder = "reminder"
+
 type CronPayload struct {
 	Kind    string `json:"kind"`
 	Message string `json:"message"`
@@ -162,7 +167,7 @@ func (cs *CronService) checkJobs() {
 	}
 
 	if err := cs.saveStoreUnsafe(); err != nil {
-		log.Printf("[cron] failed to save store: %v", err)
+		logger.ErrorCF("cron", "Failed to save store", map[string]interface{}{"error": err.Error()})
 	}
 
 	cs.mu.Unlock()
@@ -209,7 +214,7 @@ func (cs *CronService) executeJobByID(jobID string) {
 		}
 	}
 	if job == nil {
-		log.Printf("[cron] job %s disappeared before state update", jobID)
+		logger.WarnCF("cron", "Job disappeared before state update", map[string]interface{}{"job_id": jobID})
 		return
 	}
 
@@ -238,11 +243,18 @@ func (cs *CronService) executeJobByID(jobID string) {
 	}
 
 	if err := cs.saveStoreUnsafe(); err != nil {
-		log.Printf("[cron] failed to save store: %v", err)
+		logger.ErrorCF("cron", "Failed to save store", map[string]interface{}{"error": err.Error()})
 	}
 }
 
 func (cs *CronService) computeNextRun(schedule *CronSchedule, nowMS int64) *int64 {
+	return NextRun(*schedule, time.UnixMilli(nowMS))
+}
+
+// NextRun returns when schedule next fires after now, in Unix milliseconds,
+// or nil if it never does or is invalid.
+func NextRun(schedule CronSchedule, now time.Time) *int64 {
+	nowMS := now.UnixMilli()
 	if schedule.Kind == "at" {
 		if schedule.AtMS != nil && *schedule.AtMS > nowMS {
 			return schedule.AtMS
@@ -263,11 +275,19 @@ func (cs *CronService) computeNextRun(schedule *CronSchedule, nowMS int64) *int6
 			return nil
 		}
 
-		// Use gronx to calculate next run time
-		now := time.UnixMilli(nowMS)
+		// Use gronx to calculate next run time, in the schedule's zone
+		if schedule.TZ != "" {
+			if loc, err := time.LoadLocation(schedule.TZ); err == nil {
+				now = now.In(loc)
+			} else {
+				logger.WarnCF("cron", "Unknown timezone, using local time",
+					map[string]interface{}{"tz": schedule.TZ, "error": err.Error()})
+			}
+		}
 		nextTime, err := gronx.NextTickAfter(schedule.Expr, now, false)
 		if err != nil {
-			log.Printf("[cron] failed to compute next run for expr '%s': %v", schedule.Expr, err)
+			logger.ErrorCF("cron", "Failed to compute next run",
+				map[string]interface{}{"expr": schedule.Expr, "error": err.Error()})
 			return nil
 		}
 
@@ -344,6 +364,18 @@ func (cs *CronService) saveStoreUnsafe() error {
 }
 
 func (cs *CronService) AddJob(name string, schedule CronSchedule, message string, deliver bool, channel, to string) (*CronJob, error) {
+	return cs.AddJobWithPayload(name, schedule, CronPayload{
+		Kind:    "agent_turn",
+		Message: message,
+		Deliver: deliver,
+		Channel: channel,
+		To:      to,
+	})
+}
+
+// AddJobWithPayload adds a job whose payload kind is chosen by the caller,
+// e.g. PayloadReminder, so the job handler can dispatch on it.
+func (cs *CronService) AddJobWithPayload(name string, schedule CronSchedule, payload CronPayload) (*CronJob, error) {
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
 
@@ -357,13 +389,7 @@ func (cs *CronService) AddJob(name string, schedule CronSchedule, message string
 		Name:     name,
 		Enabled:  true,
 		Schedule: schedule,
-		Payload: CronPayload{
-			Kind:    "agent_turn",
-			Message: message,
-			Deliver: deliver,
-			Channel: channel,
-			To:      to,
-		},
+		Payload:  payload,
 		State: CronJobState{
 			NextRunAtMS: cs.computeNextRun(&schedule, now),
 		},
@@ -414,7 +440,7 @@ func (cs *CronService) removeJobUnsafe(jobID string) bool {
 
 	if removed {
 		if err := cs.saveStoreUnsafe(); err != nil {
-			log.Printf("[cron] failed to save store after remove: %v", err)
+			logger.ErrorCF("cron", "Failed to save store after remove", map[string]interface{}{"error": err.Error()})
 		}
 	}
 
@@ -438,7 +464,7 @@ func (cs *CronService) EnableJob(jobID string, enabled bool) *CronJob {
 			}
 
 			if err := cs.saveStoreUnsafe(); err != nil {
-				log.Printf("[cron] failed to save store after enable: %v", err)
+				logger.ErrorCF("cron", "Failed to save store after enable", map[string]interface{}{"error": err.Error()})
 			}
 			return job
 		}
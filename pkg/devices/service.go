@@ -131,6 +131,7 @@ func (s *Service) sendNotification(ev *events.DeviceEvent) {
 		Channel: platform,
 		ChatID:  userID,
 		Content: msg,
+		Urgency: bus.UrgencyNormal,
 	})
 
 	logger.InfoCF("devices", "Device notification sent", map[string]interface{}{
@@ -0,0 +1,280 @@
+// Package federation lets picoclaw instances delegate tasks to each other
+// over HTTP. Requests and responses are signed with an HMAC-SHA256 secret
+// shared by each pair of peers, and carry a timestamp and a request ID so a
+// captured request cannot be replayed.
+package federation
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+const (
+	// TaskPath is where the gateway accepts delegated tasks.
+	TaskPath = "/federation/task"
+
+	HeaderPeer      = "X-Picoclaw-Peer"
+	HeaderTimestamp = "X-Picoclaw-Timestamp"
+	HeaderSignature = "X-Picoclaw-Signature"
+
+	// MaxClockSkew is how far a request's timestamp may be from local time.
+	MaxClockSkew = 5 * time.Minute
+
+	maxBodySize = 1 << 20
+)
+
+// Peer is another picoclaw instance. URL is the base URL of its gateway;
+// a peer without a URL can send tasks but not receive them.
+type Peer struct {
+	Name   string
+	URL    string
+	Secret string
+}
+
+// TaskRequest asks a peer to run a task with its own agent and tools.
+type TaskRequest struct {
+	ID   string `json:"id"`
+	Task string `json:"task"`
+}
+
+// TaskResponse is a peer's answer to a TaskRequest.
+type TaskResponse struct {
+	ID     string `json:"id"`
+	Result string `json:"result,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Sign returns the hex HMAC-SHA256 of the timestamp and body.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verify checks the signature and freshness of a signed message.
+func verify(secret, timestamp, signature string, body []byte, now time.Time) error {
+	if secret == "" {
+		return fmt.Errorf("no shared secret configured")
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp")
+	}
+	if skew := now.Sub(time.Unix(unix, 0)); skew > MaxClockSkew || skew < -MaxClockSkew {
+		return fmt.Errorf("timestamp outside allowed clock skew")
+	}
+	if !hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature)) {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
+
+// Client sends tasks to peers.
+type Client struct {
+	self  string
+	peers map[string]Peer
+	http  *http.Client
+}
+
+// NewClient creates a client that identifies itself to peers as self.
+// timeout bounds each delegated task, including the remote agent's work.
+func NewClient(self string, peers []Peer, timeout time.Duration) *Client {
+	c := &Client{
+		self:  self,
+		peers: make(map[string]Peer),
+		http:  &http.Client{Timeout: timeout},
+	}
+	for _, p := range peers {
+		if p.URL != "" {
+			c.peers[p.Name] = p
+		}
+	}
+	return c
+}
+
+// Peers returns the names of the peers tasks can be sent to.
+func (c *Client) Peers() []string {
+	names := make([]string, 0, len(c.peers))
+	for name := range c.peers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Delegate runs task on the named peer and returns its result.
+func (c *Client) Delegate(ctx context.Context, peerName, task string) (string, error) {
+	peer, ok := c.peers[peerName]
+	if !ok {
+		return "", fmt.Errorf("unknown peer %q", peerName)
+	}
+
+	req := TaskRequest{ID: uuid.NewString(), Task: task}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(peer.URL, "/")+TaskPath, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set(HeaderPeer, c.self)
+	httpReq.Header.Set(HeaderTimestamp, timestamp)
+	httpReq.Header.Set(HeaderSignature, Sign(peer.Secret, timestamp, body))
+
+	resp, err := c.http.Do(httpReq)
+	if err != nil {
+		return "", fmt.Errorf("peer %s unreachable: %w", peerName, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil {
+		return "", fmt.Errorf("failed to read response from %s: %w", peerName, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("peer %s returned %s: %s", peerName, resp.Status, strings.TrimSpace(string(respBody)))
+	}
+
+	// The result must come from the peer itself, not whoever is in between
+	if err := verify(peer.Secret, resp.Header.Get(HeaderTimestamp), resp.Header.Get(HeaderSignature), respBody, time.Now()); err != nil {
+		return "", fmt.Errorf("rejected response from %s: %w", peerName, err)
+	}
+
+	var taskResp TaskResponse
+	if err := json.Unmarshal(respBody, &taskResp); err != nil {
+		return "", fmt.Errorf("invalid response from %s: %w", peerName, err)
+	}
+	if taskResp.ID != req.ID {
+		return "", fmt.Errorf("response from %s does not match the request", peerName)
+	}
+	if taskResp.Error != "" {
+		return "", fmt.Errorf("peer %s failed: %s", peerName, taskResp.Error)
+	}
+	return taskResp.Result, nil
+}
+
+// TaskHandler runs a task received from a peer.
+type TaskHandler func(ctx context.Context, peer, task string) (string, error)
+
+// Server accepts signed tasks from peers.
+type Server struct {
+	peers map[string]Peer
+	run   TaskHandler
+	seen  map[string]time.Time // request IDs within the skew window
+	mu    sync.Mutex
+}
+
+// NewServer creates a handler for TaskPath that runs tasks from the given
+// peers with run.
+func NewServer(peers []Peer, run TaskHandler) *Server {
+	s := &Server{
+		peers: make(map[string]Peer),
+		run:   run,
+		seen:  make(map[string]time.Time),
+	}
+	for _, p := range peers {
+		s.peers[p.Name] = p
+	}
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	peerName := r.Header.Get(HeaderPeer)
+	peer, ok := s.peers[peerName]
+	if !ok {
+		http.Error(w, "unknown peer", http.StatusForbidden)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, "failed to read request", http.StatusBadRequest)
+		return
+	}
+	if err := verify(peer.Secret, r.Header.Get(HeaderTimestamp), r.Header.Get(HeaderSignature), body, time.Now()); err != nil {
+		logger.WarnCF("federation", "Rejected task request",
+			map[string]interface{}{
+				"peer":  peerName,
+				"error": err.Error(),
+			})
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var req TaskRequest
+	if err := json.Unmarshal(body, &req); err != nil || req.ID == "" || strings.TrimSpace(req.Task) == "" {
+		http.Error(w, "invalid task request", http.StatusBadRequest)
+		return
+	}
+	if !s.markSeen(req.ID) {
+		http.Error(w, "duplicate request", http.StatusConflict)
+		return
+	}
+
+	logger.InfoCF("federation", "Running task from peer",
+		map[string]interface{}{
+			"peer": peerName,
+			"id":   req.ID,
+		})
+
+	resp := TaskResponse{ID: req.ID}
+	result, err := s.run(r.Context(), peerName, req.Task)
+	if err != nil {
+		resp.Error = err.Error()
+	} else {
+		resp.Result = result
+	}
+
+	respBody, _ := json.Marshal(resp)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(HeaderTimestamp, timestamp)
+	w.Header().Set(HeaderSignature, Sign(peer.Secret, timestamp, respBody))
+	w.Write(respBody)
+}
+
+// markSeen records a request ID and reports whether it is new. IDs older
+// than twice the clock skew are forgotten, since their timestamps would be
+// rejected anyway.
+func (s *Server) markSeen(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for seenID, at := range s.seen {
+		if now.Sub(at) > 2*MaxClockSkew {
+			delete(s.seen, seenID)
+		}
+	}
+	if _, dup := s.seen[id]; dup {
+		return false
+	}
+	s.seen[id] = now
+	return true
+}
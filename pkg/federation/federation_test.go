@@ -0,0 +1,91 @@
+package federation
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newPair(t *testing.T, run TaskHandler) (*Client, *httptest.Server) {
+	t.Helper()
+	server := httptest.NewServer(NewServer([]Peer{{Name: "home", Secret: "s3cret"}}, run))
+	t.Cleanup(server.Close)
+	client := NewClient("home", []Peer{{Name: "vps", URL: server.URL, Secret: "s3cret"}}, 5*time.Second)
+	return client, server
+}
+
+// TestDelegate_RoundTrip verifies a signed task runs on the peer and returns its result
+func TestDelegate_RoundTrip(t *testing.T) {
+	var gotPeer, gotTask string
+	client, _ := newPair(t, func(ctx context.Context, peer, task string) (string, error) {
+		gotPeer, gotTask = peer, task
+		return "disk 42% used", nil
+	})
+
+	result, err := client.Delegate(context.Background(), "vps", "check disk space")
+	if err != nil {
+		t.Fatalf("Delegate failed: %v", err)
+	}
+	if result != "disk 42% used" || gotPeer != "home" || gotTask != "check disk space" {
+		t.Errorf("Unexpected round trip: result=%q peer=%q task=%q", result, gotPeer, gotTask)
+	}
+}
+
+// TestDelegate_RemoteError verifies task errors are reported to the caller
+func TestDelegate_RemoteError(t *testing.T) {
+	client, _ := newPair(t, func(ctx context.Context, peer, task string) (string, error) {
+		return "", fmt.Errorf("provider down")
+	})
+
+	if _, err := client.Delegate(context.Background(), "vps", "x"); err == nil || !strings.Contains(err.Error(), "provider down") {
+		t.Errorf("Expected remote error, got %v", err)
+	}
+	if _, err := client.Delegate(context.Background(), "nobody", "x"); err == nil {
+		t.Error("Expected error for unknown peer")
+	}
+}
+
+// TestServer_RejectsBadRequests verifies signature, peer, clock and replay checks
+func TestServer_RejectsBadRequests(t *testing.T) {
+	_, server := newPair(t, func(ctx context.Context, peer, task string) (string, error) {
+		return "ok", nil
+	})
+
+	body := []byte(`{"id":"req-1","task":"uptime"}`)
+	send := func(peer, secret string, at time.Time) int {
+		ts := strconv.FormatInt(at.Unix(), 10)
+		req, _ := http.NewRequest(http.MethodPost, server.URL+TaskPath, bytes.NewReader(body))
+		req.Header.Set(HeaderPeer, peer)
+		req.Header.Set(HeaderTimestamp, ts)
+		req.Header.Set(HeaderSignature, Sign(secret, ts, body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	now := time.Now()
+	if code := send("home", "wrong", now); code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for bad signature, got %d", code)
+	}
+	if code := send("stranger", "s3cret", now); code != http.StatusForbidden {
+		t.Errorf("Expected 403 for unknown peer, got %d", code)
+	}
+	if code := send("home", "s3cret", now.Add(-time.Hour)); code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for stale timestamp, got %d", code)
+	}
+	if code := send("home", "s3cret", now); code != http.StatusOK {
+		t.Errorf("Expected 200 for valid request, got %d", code)
+	}
+	if code := send("home", "s3cret", now); code != http.StatusConflict {
+		t.Errorf("Expected 409 for replayed request, got %d", code)
+	}
+}
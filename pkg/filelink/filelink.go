@@ -0,0 +1,121 @@
+// Package filelink serves local files under short-lived, unguessable links,
+// for attachments a channel can't send itself (text-only channels, files
+// over a size limit). Links live in memory and end with the process.
+package filelink
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Path is where the gateway serves links.
+const Path = "/files/"
+
+type link struct {
+	path    string
+	expires time.Time
+}
+
+// Store hands out links and serves the files behind them.
+type Store struct {
+	baseURL string
+	ttl     time.Duration
+	now     func() time.Time
+
+	mu    sync.Mutex
+	links map[string]link // token -> file
+}
+
+// NewStore creates a store whose links start with baseURL, the address
+// users reach the gateway at, and work for ttl.
+func NewStore(baseURL string, ttl time.Duration) (*Store, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("base URL must be an http(s) URL, got %q", baseURL)
+	}
+	return &Store{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		ttl:     ttl,
+		now:     time.Now,
+		links:   make(map[string]link),
+	}, nil
+}
+
+// TTL returns how long links work.
+func (s *Store) TTL() time.Duration {
+	return s.ttl
+}
+
+// Publish returns a link to the file at path.
+func (s *Store) Publish(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("%s is a directory", path)
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	for t, l := range s.links {
+		if now.After(l.expires) {
+			delete(s.links, t)
+		}
+	}
+	s.links[token] = link{path: path, expires: now.Add(s.ttl)}
+	return s.baseURL + Path + token + "/" + url.PathEscape(filepath.Base(path)), nil
+}
+
+// ServeHTTP serves Path<token>/<name>. Unknown and expired links are not
+// found.
+func (s *Store) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, Path), "/")
+
+	s.mu.Lock()
+	l, ok := s.links[token]
+	if ok && s.now().After(l.expires) {
+		delete(s.links, token)
+		ok = false
+	}
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	file, err := os.Open(l.path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox") // HTML files can't run scripts
+	http.ServeContent(w, r, filepath.Base(l.path), info.ModTime(), file)
+}
@@ -0,0 +1,67 @@
+package filelink
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestStore_PublishAndServe verifies a link serves its file until it
+// expires, and unknown links are not found.
+func TestStore_PublishAndServe(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chart 1.png")
+	os.WriteFile(path, []byte("PNGDATA"), 0644)
+
+	store, err := NewStore("https://claw.example.com/", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	link, err := store.Publish(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(link, "https://claw.example.com/files/") || !strings.HasSuffix(link, "/chart%201.png") {
+		t.Errorf("Unexpected link %q", link)
+	}
+
+	get := func(p string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		store.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, p, nil))
+		return rec
+	}
+	urlPath := strings.TrimPrefix(link, "https://claw.example.com")
+	rec := get(urlPath)
+	if body, _ := io.ReadAll(rec.Body); rec.Code != http.StatusOK || string(body) != "PNGDATA" {
+		t.Errorf("Expected the file, got %d %q", rec.Code, body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "image/png" {
+		t.Errorf("Expected image/png, got %q", ct)
+	}
+
+	if rec := get("/files/0123456789abcdef0123456789abcdef/chart%201.png"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected an unknown link to be not found, got %d", rec.Code)
+	}
+
+	now = now.Add(time.Hour + time.Second)
+	if rec := get(urlPath); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected an expired link to be not found, got %d", rec.Code)
+	}
+}
+
+// TestNewStore_RequiresBaseURL verifies links need an address users can
+// reach.
+func TestNewStore_RequiresBaseURL(t *testing.T) {
+	for _, base := range []string{"", "claw.example.com", "ftp://claw.example.com"} {
+		if _, err := NewStore(base, time.Hour); err == nil {
+			t.Errorf("Expected an error for base URL %q", base)
+		}
+	}
+}
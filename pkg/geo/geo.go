@@ -0,0 +1,354 @@
+// Package geo turns place names and addresses into coordinates and back,
+// so tools that need a location (weather, time zones, sunrise and sunset)
+// share one lookup and one cache. Place names are looked up with the
+// Open-Meteo geocoding API and addresses with OpenStreetMap Nominatim;
+// neither needs an API key.
+package geo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned when a query matches no place.
+var ErrNotFound = errors.New("location not found")
+
+// maxCacheEntries bounds the lookup cache. Places don't move, so entries
+// don't expire; when the cache is full an arbitrary entry is dropped.
+const maxCacheEntries = 512
+
+// Place is a resolved location.
+type Place struct {
+	Name        string // city, town or the first part of an address
+	Region      string // state or province
+	Country     string
+	CountryCode string // ISO 3166-1 alpha-2, upper case
+	Lat, Lon    float64
+	Timezone    string // IANA name, e.g. "America/New_York"; may be empty
+	Address     string // full address, for address and reverse lookups
+}
+
+// Label names the place with its region, e.g. "Tampa, Florida".
+func (p Place) Label() string {
+	if p.Name == "" {
+		return FormatCoordinates(p.Lat, p.Lon)
+	}
+	if p.Region != "" && p.Region != p.Name {
+		return p.Name + ", " + p.Region
+	}
+	return p.Name
+}
+
+// Client resolves locations and caches the results. It is safe for
+// concurrent use.
+type Client struct {
+	// Service endpoints; they can point at self-hosted instances.
+	GeocodeURL   string // Open-Meteo geocoding
+	NominatimURL string // OpenStreetMap Nominatim
+	ForecastURL  string // Open-Meteo forecast, used for time zones
+
+	http  *http.Client
+	mu    sync.Mutex
+	cache map[string]Place
+}
+
+func NewClient() *Client {
+	return &Client{
+		GeocodeURL:   "https://geocoding-api.open-meteo.com",
+		NominatimURL: "https://nominatim.openstreetmap.org",
+		ForecastURL:  "https://api.open-meteo.com",
+		http:         &http.Client{Timeout: 10 * time.Second},
+		cache:        make(map[string]Place),
+	}
+}
+
+// Search resolves query, which may be a place name optionally followed by
+// a comma and a region or country ("Tampa,FL", "Paris, France"), a US ZIP
+// code, a street address, or coordinates ("27.95,-82.46").
+func (c *Client) Search(ctx context.Context, query string) (Place, error) {
+	query = strings.TrimSpace(query)
+	if lat, lon, ok := ParseCoordinates(query); ok {
+		place, err := c.Reverse(ctx, lat, lon)
+		if err != nil {
+			// The coordinates are all callers need; the name is a nicety
+			return Place{Lat: lat, Lon: lon}, nil
+		}
+		return place, nil
+	}
+
+	key := "search:" + strings.ToLower(query)
+	if place, ok := c.cached(key); ok {
+		return place, nil
+	}
+	place, err := c.searchName(ctx, query)
+	if errors.Is(err, ErrNotFound) {
+		// Not a place name; try it as an address
+		place, err = c.searchAddress(ctx, query)
+	}
+	if err != nil {
+		return Place{}, err
+	}
+	c.store(key, place)
+	return place, nil
+}
+
+// Reverse names the place at the given coordinates.
+func (c *Client) Reverse(ctx context.Context, lat, lon float64) (Place, error) {
+	key := fmt.Sprintf("reverse:%.4f,%.4f", lat, lon)
+	if place, ok := c.cached(key); ok {
+		return place, nil
+	}
+	query := url.Values{}
+	query.Set("lat", strconv.FormatFloat(lat, 'f', 6, 64))
+	query.Set("lon", strconv.FormatFloat(lon, 'f', 6, 64))
+	query.Set("format", "jsonv2")
+	query.Set("addressdetails", "1")
+	var result nominatimPlace
+	if err := c.get(ctx, c.NominatimURL+"/reverse?"+query.Encode(), &result); err != nil {
+		return Place{}, err
+	}
+	if result.DisplayName == "" {
+		return Place{}, fmt.Errorf("%w: %s", ErrNotFound, FormatCoordinates(lat, lon))
+	}
+	place := result.place()
+	place.Lat, place.Lon = lat, lon
+	c.store(key, place)
+	return place, nil
+}
+
+// Timezone returns the IANA time zone at the given coordinates.
+func (c *Client) Timezone(ctx context.Context, lat, lon float64) (string, error) {
+	key := fmt.Sprintf("tz:%.2f,%.2f", lat, lon)
+	if place, ok := c.cached(key); ok {
+		return place.Timezone, nil
+	}
+	query := url.Values{}
+	query.Set("latitude", strconv.FormatFloat(lat, 'f', 4, 64))
+	query.Set("longitude", strconv.FormatFloat(lon, 'f', 4, 64))
+	query.Set("timezone", "auto")
+	query.Set("forecast_days", "1")
+	var resp struct {
+		Timezone string `json:"timezone"`
+	}
+	if err := c.get(ctx, c.ForecastURL+"/v1/forecast?"+query.Encode(), &resp); err != nil {
+		return "", err
+	}
+	c.store(key, Place{Lat: lat, Lon: lon, Timezone: resp.Timezone})
+	return resp.Timezone, nil
+}
+
+// searchName looks query up as a place name with Open-Meteo.
+func (c *Client) searchName(ctx context.Context, query string) (Place, error) {
+	name, qualifier, _ := strings.Cut(query, ",")
+	name, qualifier = strings.TrimSpace(name), strings.TrimSpace(qualifier)
+	params := url.Values{}
+	params.Set("name", name)
+	params.Set("count", "10")
+	params.Set("language", "en")
+	params.Set("format", "json")
+	if isUSZip(name) {
+		params.Set("countryCode", "US")
+	}
+	var resp struct {
+		Results []struct {
+			Name        string  `json:"name"`
+			Latitude    float64 `json:"latitude"`
+			Longitude   float64 `json:"longitude"`
+			CountryCode string  `json:"country_code"`
+			Country     string  `json:"country"`
+			Admin1      string  `json:"admin1"`
+			Timezone    string  `json:"timezone"`
+		} `json:"results"`
+	}
+	if err := c.get(ctx, c.GeocodeURL+"/v1/search?"+params.Encode(), &resp); err != nil {
+		return Place{}, err
+	}
+	for _, r := range resp.Results {
+		place := Place{
+			Name:        r.Name,
+			Region:      r.Admin1,
+			Country:     r.Country,
+			CountryCode: strings.ToUpper(r.CountryCode),
+			Lat:         r.Latitude,
+			Lon:         r.Longitude,
+			Timezone:    r.Timezone,
+		}
+		if qualifier == "" || place.matches(qualifier) {
+			return place, nil
+		}
+	}
+	return Place{}, fmt.Errorf("%w: %s", ErrNotFound, query)
+}
+
+// searchAddress looks query up as an address with Nominatim.
+func (c *Client) searchAddress(ctx context.Context, query string) (Place, error) {
+	params := url.Values{}
+	params.Set("q", query)
+	params.Set("format", "jsonv2")
+	params.Set("addressdetails", "1")
+	params.Set("limit", "1")
+	var results []nominatimPlace
+	if err := c.get(ctx, c.NominatimURL+"/search?"+params.Encode(), &results); err != nil {
+		return Place{}, err
+	}
+	if len(results) == 0 {
+		return Place{}, fmt.Errorf("%w: %s", ErrNotFound, query)
+	}
+	place := results[0].place()
+	if tz, err := c.Timezone(ctx, place.Lat, place.Lon); err == nil {
+		place.Timezone = tz
+	}
+	return place, nil
+}
+
+// matches reports whether the place is in the region or country named by
+// qualifier, which may be a code ("FL", "US") or a full name.
+func (p Place) matches(qualifier string) bool {
+	if state, ok := usStates[strings.ToUpper(qualifier)]; ok && p.CountryCode == "US" {
+		return strings.EqualFold(p.Region, state)
+	}
+	return strings.EqualFold(qualifier, p.CountryCode) ||
+		strings.EqualFold(qualifier, p.Country) ||
+		strings.EqualFold(qualifier, p.Region)
+}
+
+// nominatimPlace is the part of a Nominatim result we use.
+type nominatimPlace struct {
+	Lat         string `json:"lat"`
+	Lon         string `json:"lon"`
+	DisplayName string `json:"display_name"`
+	Address     struct {
+		City        string `json:"city"`
+		Town        string `json:"town"`
+		Village     string `json:"village"`
+		Hamlet      string `json:"hamlet"`
+		State       string `json:"state"`
+		Country     string `json:"country"`
+		CountryCode string `json:"country_code"`
+	} `json:"address"`
+}
+
+func (n nominatimPlace) place() Place {
+	a := n.Address
+	place := Place{
+		Name:        firstNonEmpty(a.City, a.Town, a.Village, a.Hamlet),
+		Region:      a.State,
+		Country:     a.Country,
+		CountryCode: strings.ToUpper(a.CountryCode),
+		Address:     n.DisplayName,
+	}
+	place.Lat, _ = strconv.ParseFloat(n.Lat, 64)
+	place.Lon, _ = strconv.ParseFloat(n.Lon, 64)
+	return place
+}
+
+// get fetches apiURL and decodes the JSON body into v.
+func (c *Client) get(ctx context.Context, apiURL string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	// Nominatim's usage policy requires an identifying user agent
+	req.Header.Set("User-Agent", "picoclaw")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("geocoding request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("geocoding service returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("failed to parse geocoding response: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) cached(key string) (Place, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	place, ok := c.cache[key]
+	return place, ok
+}
+
+func (c *Client) store(key string, place Place) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.cache) >= maxCacheEntries {
+		for k := range c.cache {
+			delete(c.cache, k)
+			break
+		}
+	}
+	c.cache[key] = place
+}
+
+// ParseCoordinates parses "lat,lon" in decimal degrees.
+func ParseCoordinates(s string) (lat, lon float64, ok bool) {
+	latStr, lonStr, found := strings.Cut(s, ",")
+	if !found {
+		return 0, 0, false
+	}
+	lat, err1 := strconv.ParseFloat(strings.TrimSpace(latStr), 64)
+	lon, err2 := strconv.ParseFloat(strings.TrimSpace(lonStr), 64)
+	if err1 != nil || err2 != nil || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return 0, 0, false
+	}
+	return lat, lon, true
+}
+
+// FormatCoordinates renders coordinates as ParseCoordinates reads them.
+func FormatCoordinates(lat, lon float64) string {
+	return fmt.Sprintf("%.4f,%.4f", lat, lon)
+}
+
+func isUSZip(s string) bool {
+	if len(s) != 5 {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// usStates maps US state abbreviations to the names geocoding returns.
+var usStates = map[string]string{
+	"AL": "Alabama", "AK": "Alaska", "AZ": "Arizona", "AR": "Arkansas", "CA": "California",
+	"CO": "Colorado", "CT": "Connecticut", "DE": "Delaware", "DC": "District of Columbia",
+	"FL": "Florida", "GA": "Georgia", "HI": "Hawaii", "ID": "Idaho", "IL": "Illinois",
+	"IN": "Indiana", "IA": "Iowa", "KS": "Kansas", "KY": "Kentucky", "LA": "Louisiana",
+	"ME": "Maine", "MD": "Maryland", "MA": "Massachusetts", "MI": "Michigan", "MN": "Minnesota",
+	"MS": "Mississippi", "MO": "Missouri", "MT": "Montana", "NE": "Nebraska", "NV": "Nevada",
+	"NH": "New Hampshire", "NJ": "New Jersey", "NM": "New Mexico", "NY": "New York",
+	"NC": "North Carolina", "ND": "North Dakota", "OH": "Ohio", "OK": "Oklahoma", "OR": "Oregon",
+	"PA": "Pennsylvania", "RI": "Rhode Island", "SC": "South Carolina", "SD": "South Dakota",
+	"TN": "Tennessee", "TX": "Texas", "UT": "Utah", "VT": "Vermont", "VA": "Virginia",
+	"WA": "Washington", "WV": "West Virginia", "WI": "Wisconsin", "WY": "Wyoming",
+}
@@ -0,0 +1,103 @@
+package geo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestClient points a client at a fake geocoding server and counts the
+// requests made to each path.
+func newTestClient(t *testing.T) (*Client, map[string]int) {
+	t.Helper()
+	calls := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls[r.URL.Path]++
+		q := r.URL.Query()
+		switch r.URL.Path {
+		case "/v1/search":
+			if q.Get("name") != "Springfield" {
+				fmt.Fprint(w, `{}`)
+				return
+			}
+			fmt.Fprint(w, `{"results":[
+				{"name":"Springfield","latitude":39.8,"longitude":-89.6,"country_code":"US","country":"United States","admin1":"Illinois","timezone":"America/Chicago"},
+				{"name":"Springfield","latitude":37.2,"longitude":-93.3,"country_code":"US","country":"United States","admin1":"Missouri","timezone":"America/Chicago"}]}`)
+		case "/search":
+			if q.Get("q") == "Nowhere" {
+				fmt.Fprint(w, `[]`)
+				return
+			}
+			fmt.Fprint(w, `[{"lat":"51.5034","lon":"-0.1276","display_name":"10 Downing Street, London, England, United Kingdom","address":{"city":"London","state":"England","country":"United Kingdom","country_code":"gb"}}]`)
+		case "/reverse":
+			fmt.Fprint(w, `{"lat":"48.8584","lon":"2.2945","display_name":"Eiffel Tower, Paris, France","address":{"city":"Paris","state":"Ile-de-France","country":"France","country_code":"fr"}}`)
+		case "/v1/forecast":
+			fmt.Fprint(w, `{"timezone":"Europe/London"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	c := NewClient()
+	c.GeocodeURL, c.NominatimURL, c.ForecastURL = server.URL, server.URL, server.URL
+	return c, calls
+}
+
+// TestClient_Search verifies names with a state, addresses and coordinates
+// are resolved, and that lookups are cached.
+func TestClient_Search(t *testing.T) {
+	c, calls := newTestClient(t)
+	ctx := context.Background()
+
+	place, err := c.Search(ctx, "Springfield, MO")
+	if err != nil || place.Label() != "Springfield, Missouri" || place.Lat != 37.2 {
+		t.Errorf("Expected Springfield, Missouri, got %+v (%v)", place, err)
+	}
+	c.Search(ctx, "springfield, mo")
+	if calls["/v1/search"] != 1 {
+		t.Errorf("Expected one geocoding request, got %d", calls["/v1/search"])
+	}
+
+	place, err = c.Search(ctx, "10 Downing Street, London")
+	if err != nil || place.Label() != "London, England" || place.Timezone != "Europe/London" {
+		t.Errorf("Expected the address to resolve to London with a time zone, got %+v (%v)", place, err)
+	}
+
+	place, err = c.Search(ctx, "48.8584, 2.2945")
+	if err != nil || place.Name != "Paris" || place.Lat != 48.8584 {
+		t.Errorf("Expected coordinates to be reverse geocoded to Paris, got %+v (%v)", place, err)
+	}
+}
+
+// TestClient_NotFound verifies an unknown place reports ErrNotFound.
+func TestClient_NotFound(t *testing.T) {
+	c, _ := newTestClient(t)
+	if _, err := c.Search(context.Background(), "Nowhere"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+// TestSunTimes verifies sunrise and sunset against published times, and
+// that polar night is reported.
+func TestSunTimes(t *testing.T) {
+	rise, set, ok := SunTimes(time.Date(2026, 6, 21, 0, 0, 0, 0, time.UTC), 51.5074, -0.1278)
+	if !ok {
+		t.Fatal("Expected the sun to rise in London")
+	}
+	for name, got := range map[string]time.Time{"03:43": rise, "20:21": set} {
+		want, _ := time.Parse("15:04", name)
+		diff := time.Duration(got.Hour()-want.Hour())*time.Hour + time.Duration(got.Minute()-want.Minute())*time.Minute
+		if diff < -3*time.Minute || diff > 3*time.Minute {
+			t.Errorf("Expected %s UTC, got %s", name, got.Format("15:04"))
+		}
+	}
+
+	if _, _, ok := SunTimes(time.Date(2026, 12, 21, 0, 0, 0, 0, time.UTC), 69.65, 18.96); ok {
+		t.Error("Expected polar night in Tromsø")
+	}
+}
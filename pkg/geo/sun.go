@@ -0,0 +1,42 @@
+package geo
+
+import (
+	"math"
+	"time"
+)
+
+// SunTimes returns sunrise and sunset in UTC on the given calendar date at
+// the given coordinates, using the sunrise equation, which is accurate to
+// a minute or two. ok is false during polar day or night, when the sun
+// does not rise or set.
+func SunTimes(date time.Time, lat, lon float64) (rise, set time.Time, ok bool) {
+	const (
+		j2000     = 2451545.0 // Julian date of 2000-01-01 12:00 UTC
+		unixJD    = 2440587.5 // Julian date of the Unix epoch
+		obliquity = 23.4397   // of the ecliptic, in degrees
+	)
+	rad := math.Pi / 180
+
+	noon := time.Date(date.Year(), date.Month(), date.Day(), 12, 0, 0, 0, time.UTC)
+	n := math.Round(float64(noon.Unix())/86400 + unixJD - j2000)
+
+	meanNoon := n - lon/360
+	m := math.Mod(357.5291+0.98560028*meanNoon, 360) // mean anomaly
+	center := 1.9148*math.Sin(m*rad) + 0.02*math.Sin(2*m*rad) + 0.0003*math.Sin(3*m*rad)
+	lambda := math.Mod(m+center+180+102.9372, 360) // ecliptic longitude
+	transit := j2000 + meanNoon + 0.0053*math.Sin(m*rad) - 0.0069*math.Sin(2*lambda*rad)
+
+	sinDecl := math.Sin(lambda*rad) * math.Sin(obliquity*rad)
+	cosDecl := math.Cos(math.Asin(sinDecl))
+	// -0.833° accounts for refraction and the size of the sun's disc
+	cosHour := (math.Sin(-0.833*rad) - math.Sin(lat*rad)*sinDecl) / (math.Cos(lat*rad) * cosDecl)
+	if cosHour < -1 || cosHour > 1 {
+		return time.Time{}, time.Time{}, false
+	}
+	hourAngle := math.Acos(cosHour) / rad
+
+	toTime := func(jd float64) time.Time {
+		return time.Unix(0, int64((jd-unixJD)*86400*1e9)).UTC().Round(time.Minute)
+	}
+	return toTime(transit - hourAngle/360), toTime(transit + hourAngle/360), true
+}
@@ -31,12 +31,23 @@ const (
 // channel and chatID are derived from the last active user channel.
 type HeartbeatHandler func(prompt, channel, chatID string) *tools.ToolResult
 
+// ContextSource reports something the agent should know about on each
+// heartbeat, such as upcoming reminders or tasks still running. It returns
+// an empty string when there is nothing to report.
+type ContextSource func() string
+
+type contextSection struct {
+	title  string
+	source ContextSource
+}
+
 // HeartbeatService manages periodic heartbeat checks
 type HeartbeatService struct {
 	workspace string
 	bus       *bus.MessageBus
 	state     *state.Manager
 	handler   HeartbeatHandler
+	sources   []contextSection
 	interval  time.Duration
 	enabled   bool
 	mu        sync.RWMutex
@@ -76,6 +87,14 @@ func (hs *HeartbeatService) SetHandler(handler HeartbeatHandler) {
 	hs.handler = handler
 }
 
+// AddContext adds a section under title to every heartbeat prompt, so the
+// agent can act on pending work without being asked.
+func (hs *HeartbeatService) AddContext(title string, source ContextSource) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	hs.sources = append(hs.sources, contextSection{title: title, source: source})
+}
+
 // Start begins the heartbeat service
 func (hs *HeartbeatService) Start() error {
 	hs.mu.Lock()
@@ -242,9 +261,28 @@ Current time: %s
 You are a proactive AI assistant. This is a scheduled heartbeat check.
 Review the following tasks and execute any necessary actions using available skills.
 If there is nothing that requires attention, respond ONLY with: HEARTBEAT_OK
+If something cannot wait until the user's quiet hours end (e.g. a severe
+weather warning, a UPS running on battery), start your reply with: URGENT:
 
 %s
-`, now, content)
+%s`, now, content, hs.pendingContext())
+}
+
+// pendingContext renders the non-empty context sections.
+func (hs *HeartbeatService) pendingContext() string {
+	hs.mu.RLock()
+	sources := hs.sources
+	hs.mu.RUnlock()
+
+	var sb strings.Builder
+	for _, section := range sources {
+		text := strings.TrimSpace(section.source())
+		if text == "" {
+			continue
+		}
+		fmt.Fprintf(&sb, "\n## %s\n\n%s\n", section.title, text)
+	}
+	return sb.String()
 }
 
 // createDefaultHeartbeatTemplate creates the default HEARTBEAT.md file
@@ -307,13 +345,26 @@ func (hs *HeartbeatService) sendResponse(response string) {
 		return
 	}
 
+	content, urgency := heartbeatUrgency(response)
 	msgBus.PublishOutbound(bus.OutboundMessage{
 		Channel: platform,
 		ChatID:  userID,
-		Content: response,
+		Content: content,
+		Urgency: urgency,
 	})
 
-	hs.logInfo("Heartbeat result sent to %s", platform)
+	hs.logInfo("Heartbeat result sent to %s (urgency %s)", platform, urgency)
+}
+
+// heartbeatUrgency reads the URGENT: marker the prompt asks for. Marked
+// results are critical and break through quiet hours; others are normal
+// and wait for them to end.
+func heartbeatUrgency(response string) (string, bus.Urgency) {
+	trimmed := strings.TrimSpace(response)
+	if len(trimmed) >= 7 && strings.EqualFold(trimmed[:7], "URGENT:") {
+		return "🚨 " + strings.TrimSpace(trimmed[7:]), bus.UrgencyCritical
+	}
+	return response, bus.UrgencyNormal
 }
 
 // parseLastChannel parses the last channel string into platform and userID.
@@ -3,9 +3,11 @@ package heartbeat
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/tools"
 )
 
@@ -219,3 +221,33 @@ func TestHeartbeatFilePath(t *testing.T) {
 		t.Errorf("Expected HEARTBEAT.md at %s, but it doesn't exist", expectedPath)
 	}
 }
+
+func TestHeartbeatUrgency(t *testing.T) {
+	content, urgency := heartbeatUrgency("URGENT: UPS is on battery (38% left)")
+	if urgency != bus.UrgencyCritical || content != "🚨 UPS is on battery (38% left)" {
+		t.Errorf("Expected a critical alert, got %q (%s)", content, urgency)
+	}
+	content, urgency = heartbeatUrgency("3 new emails")
+	if urgency != bus.UrgencyNormal || content != "3 new emails" {
+		t.Errorf("Expected a normal message, got %q (%s)", content, urgency)
+	}
+}
+
+// TestBuildPrompt_Context verifies context sections are added to the prompt
+// and empty ones are left out.
+func TestBuildPrompt_Context(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "HEARTBEAT.md"), []byte("Test task"), 0644)
+
+	hs := NewHeartbeatService(tmpDir, 30, true)
+	hs.AddContext("Due in the next 24 hours", func() string { return "- Reminder at Mon 09:00: call the dentist\n" })
+	hs.AddContext("Still running", func() string { return "" })
+
+	prompt := hs.buildPrompt()
+	if !strings.Contains(prompt, "## Due in the next 24 hours\n\n- Reminder at Mon 09:00: call the dentist") {
+		t.Errorf("Expected the reminders section in the prompt, got %q", prompt)
+	}
+	if strings.Contains(prompt, "Still running") {
+		t.Errorf("Expected empty sections to be left out, got %q", prompt)
+	}
+}
@@ -0,0 +1,186 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// defaultTimeout bounds an external hook without a timeout.
+const defaultTimeout = 5 * time.Second
+
+// maxReplyBytes bounds what is read from an external hook.
+const maxReplyBytes = 1 << 20
+
+// reply is what an external hook may print, or return from a webhook: the
+// changed content or arguments, or a reason to block. Empty output changes
+// nothing.
+type reply struct {
+	Content   *string                `json:"content"`
+	Arguments map[string]interface{} `json:"arguments"`
+	Block     string                 `json:"block"`
+}
+
+// RegisterConfig adds the hooks from the config. Commands get the payload
+// as JSON on stdin and may print a reply; webhooks get it as a POST body
+// and may answer with one.
+func (r *Registry) RegisterConfig(cfgs []config.HookConfig) error {
+	for i, cfg := range cfgs {
+		if !slices.Contains(Events, Event(cfg.Event)) {
+			return fmt.Errorf("hook %d: unknown event %q", i+1, cfg.Event)
+		}
+		if (cfg.Exec == "") == (cfg.Webhook == "") {
+			return fmt.Errorf("hook %d: set exactly one of exec and webhook", i+1)
+		}
+		name := cfg.Name
+		if name == "" {
+			name = cfg.Exec + cfg.Webhook
+		}
+		r.Register(Event(cfg.Event), name, external(name, cfg))
+	}
+	return nil
+}
+
+// external turns a configured hook into a Hook.
+func external(name string, cfg config.HookConfig) Hook {
+	timeout := defaultTimeout
+	if cfg.Timeout > 0 {
+		timeout = time.Duration(cfg.Timeout) * time.Second
+	}
+	call := runWebhook
+	if cfg.Exec != "" {
+		call = runCommand
+	}
+	target := cfg.Exec + cfg.Webhook
+
+	return func(ctx context.Context, p *Payload) error {
+		if len(cfg.Tools) > 0 && p.Tool != "" && !slices.Contains(cfg.Tools, p.Tool) {
+			return nil
+		}
+		body, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		if cfg.Async {
+			go func() {
+				ctx, cancel := context.WithTimeout(context.Background(), timeout)
+				defer cancel()
+				if _, err := call(ctx, target, body); err != nil {
+					logger.WarnCF("hooks", "Hook failed",
+						map[string]interface{}{"hook": name, "event": string(p.Event), "error": err.Error()})
+				}
+			}()
+			return nil
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		out, err := call(ctx, target, body)
+		if err == nil {
+			err = apply(p, out)
+		}
+		var blocked *blockReply
+		switch {
+		case errors.As(err, &blocked):
+			return err
+		case err != nil && cfg.FailClosed:
+			return fmt.Errorf("hook failed: %w", err)
+		case err != nil:
+			logger.WarnCF("hooks", "Hook failed, carrying on",
+				map[string]interface{}{"hook": name, "event": string(p.Event), "error": err.Error()})
+		}
+		return nil
+	}
+}
+
+// blockReply is a hook's reason to block.
+type blockReply struct {
+	reason string
+}
+
+func (b *blockReply) Error() string {
+	return b.reason
+}
+
+// apply makes the changes an external hook asked for.
+func apply(p *Payload, out []byte) error {
+	if len(bytes.TrimSpace(out)) == 0 {
+		return nil
+	}
+	var r reply
+	if err := json.Unmarshal(out, &r); err != nil {
+		return fmt.Errorf("invalid hook reply: %w", err)
+	}
+	if r.Block != "" {
+		return &blockReply{reason: r.Block}
+	}
+	if r.Content != nil {
+		p.Content = *r.Content
+	}
+	if r.Arguments != nil {
+		p.Arguments = r.Arguments
+	}
+	return nil
+}
+
+// runCommand runs command with sh (or PowerShell on Windows), the payload on
+// stdin, and returns what it printed. A non-zero exit is an error.
+func runCommand(ctx context.Context, command string, payload []byte) ([]byte, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "powershell", "-NoProfile", "-NonInteractive", "-Command", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Env = os.Environ()
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+	if stdout.Len() > maxReplyBytes {
+		return nil, fmt.Errorf("reply longer than %d bytes", maxReplyBytes)
+	}
+	return stdout.Bytes(), nil
+}
+
+// runWebhook POSTs the payload to url and returns the response body. A
+// status other than 2xx is an error.
+func runWebhook(ctx context.Context, url string, payload []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxReplyBytes))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return body, nil
+}
@@ -0,0 +1,129 @@
+// Package hooks lets code and external programs watch and change what the
+// agent does: the user's message, each tool call and its result, the reply
+// and errors. A hook can rewrite the payload, e.g. to redact secrets, or
+// block it, e.g. to enforce a policy on tool calls.
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Event is a point in a turn where hooks run.
+type Event string
+
+const (
+	// UserMessage runs before the user's message reaches the model. Content
+	// can be changed; blocking refuses the turn.
+	UserMessage Event = "user_message"
+	// ToolCall runs before a tool runs. Arguments can be changed; blocking
+	// skips the call and tells the model why.
+	ToolCall Event = "tool_call"
+	// ToolResult runs after a tool ran. Content, what the model sees, can
+	// be changed; blocking replaces it with a note.
+	ToolResult Event = "tool_result"
+	// AssistantMessage runs before the reply is saved and sent. Content can
+	// be changed; blocking withholds the reply.
+	AssistantMessage Event = "assistant_message"
+	// Error runs when a turn fails. It only observes.
+	Error Event = "error"
+)
+
+// Events lists the events, for validating configs.
+var Events = []Event{UserMessage, ToolCall, ToolResult, AssistantMessage, Error}
+
+// Payload is what a hook sees and may change.
+type Payload struct {
+	Event      Event                  `json:"event"`
+	SessionKey string                 `json:"session_key,omitempty"`
+	Channel    string                 `json:"channel,omitempty"`
+	ChatID     string                 `json:"chat_id,omitempty"`
+	SenderID   string                 `json:"sender_id,omitempty"`
+	Content    string                 `json:"content,omitempty"` // the message, the tool result or the error
+	Tool       string                 `json:"tool,omitempty"`
+	Arguments  map[string]interface{} `json:"arguments,omitempty"`
+	IsError    bool                   `json:"is_error,omitempty"` // for tool results
+}
+
+// Hook is middleware for one event. It may change p; returning an error
+// blocks the event, with the error as the reason.
+type Hook func(ctx context.Context, p *Payload) error
+
+// BlockedError is returned by Run when a hook blocked the event.
+type BlockedError struct {
+	Hook   string
+	Reason error
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("blocked by hook %s: %v", e.Hook, e.Reason)
+}
+
+func (e *BlockedError) Unwrap() error {
+	return e.Reason
+}
+
+type entry struct {
+	name string
+	hook Hook
+}
+
+// Registry holds the hooks for each event. A nil *Registry has none, so
+// callers don't need to check whether hooks are set up.
+type Registry struct {
+	mu    sync.RWMutex
+	hooks map[Event][]entry
+}
+
+func NewRegistry() *Registry {
+	return &Registry{hooks: make(map[Event][]entry)}
+}
+
+// Register adds a hook for event. Hooks run in the order they were
+// registered, each seeing the changes of the ones before.
+func (r *Registry) Register(event Event, name string, hook Hook) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hooks[event] = append(r.hooks[event], entry{name: name, hook: hook})
+}
+
+// OnUserMessage and the On functions below register a hook for one event.
+func (r *Registry) OnUserMessage(name string, hook Hook) { r.Register(UserMessage, name, hook) }
+
+func (r *Registry) OnToolCall(name string, hook Hook) { r.Register(ToolCall, name, hook) }
+
+func (r *Registry) OnToolResult(name string, hook Hook) { r.Register(ToolResult, name, hook) }
+
+func (r *Registry) OnAssistantMessage(name string, hook Hook) {
+	r.Register(AssistantMessage, name, hook)
+}
+
+func (r *Registry) OnError(name string, hook Hook) { r.Register(Error, name, hook) }
+
+// Has reports whether any hook is registered for event.
+func (r *Registry) Has(event Event) bool {
+	if r == nil {
+		return false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.hooks[event]) > 0
+}
+
+// Run runs the hooks for p.Event in order. It stops at the first hook that
+// blocks and returns a *BlockedError.
+func (r *Registry) Run(ctx context.Context, p *Payload) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	entries := r.hooks[p.Event]
+	r.mu.RUnlock()
+	for _, e := range entries {
+		if err := e.hook(ctx, p); err != nil {
+			return &BlockedError{Hook: e.name, Reason: err}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// TestRegistry_Run verifies hooks run in order, each seeing the changes of
+// the ones before, and the first error blocks.
+func TestRegistry_Run(t *testing.T) {
+	r := NewRegistry()
+	r.OnToolResult("upper", func(ctx context.Context, p *Payload) error {
+		p.Content = strings.ToUpper(p.Content)
+		return nil
+	})
+	r.OnToolResult("suffix", func(ctx context.Context, p *Payload) error {
+		p.Content += "!"
+		return nil
+	})
+	p := &Payload{Event: ToolResult, Content: "done"}
+	if err := r.Run(context.Background(), p); err != nil || p.Content != "DONE!" {
+		t.Errorf("Expected DONE!, got %q, %v", p.Content, err)
+	}
+
+	r.OnToolCall("policy", func(ctx context.Context, p *Payload) error {
+		return errors.New("no exec after hours")
+	})
+	err := r.Run(context.Background(), &Payload{Event: ToolCall, Tool: "exec"})
+	var blocked *BlockedError
+	if !errors.As(err, &blocked) || blocked.Hook != "policy" || err.Error() != "blocked by hook policy: no exec after hours" {
+		t.Errorf("Expected the call to be blocked, got %v", err)
+	}
+
+	var none *Registry
+	if none.Has(ToolCall) || none.Run(context.Background(), p) != nil {
+		t.Error("Expected a nil registry to have no hooks")
+	}
+}
+
+// TestRegistry_Exec verifies command hooks get the payload on stdin, can
+// change or block it, and fail open unless fail_closed is set.
+func TestRegistry_Exec(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	r := NewRegistry()
+	err := r.RegisterConfig([]config.HookConfig{
+		{Event: "tool_call", Exec: `grep -q '"rm -rf /"' && echo '{"block": "not that"}' || true`, Tools: []string{"exec"}},
+		{Event: "tool_result", Exec: `grep -q password && echo '{"content": "[redacted]"}' || true`},
+		{Event: "user_message", Exec: "exit 3"},
+		{Event: "assistant_message", Exec: "exit 3", FailClosed: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.Run(context.Background(), &Payload{Event: ToolCall, Tool: "exec", Arguments: map[string]interface{}{"command": "rm -rf /"}})
+	if err == nil || !strings.Contains(err.Error(), "not that") {
+		t.Errorf("Expected the command to be blocked, got %v", err)
+	}
+	if err := r.Run(context.Background(), &Payload{Event: ToolCall, Tool: "read_file", Arguments: map[string]interface{}{"path": "rm -rf /"}}); err != nil {
+		t.Errorf("Expected other tools to skip the hook, got %v", err)
+	}
+
+	p := &Payload{Event: ToolResult, Tool: "read_file", Content: "password=hunter2"}
+	if err := r.Run(context.Background(), p); err != nil || p.Content != "[redacted]" {
+		t.Errorf("Expected the result to be redacted, got %q, %v", p.Content, err)
+	}
+	if err := r.Run(context.Background(), &Payload{Event: UserMessage, Content: "hi"}); err != nil {
+		t.Errorf("Expected a failing hook to be skipped, got %v", err)
+	}
+	if err := r.Run(context.Background(), &Payload{Event: AssistantMessage, Content: "hi"}); err == nil {
+		t.Error("Expected a failing fail_closed hook to block")
+	}
+}
+
+// TestRegistry_Webhook verifies webhooks get the payload as a POST body.
+func TestRegistry_Webhook(t *testing.T) {
+	var got Payload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"arguments": {"query": "safe"}}`))
+	}))
+	defer server.Close()
+
+	r := NewRegistry()
+	if err := r.RegisterConfig([]config.HookConfig{{Event: "tool_call", Webhook: server.URL}}); err != nil {
+		t.Fatal(err)
+	}
+	p := &Payload{Event: ToolCall, SessionKey: "telegram:1", Tool: "web_search", Arguments: map[string]interface{}{"query": "x"}}
+	if err := r.Run(context.Background(), p); err != nil || p.Arguments["query"] != "safe" {
+		t.Errorf("Expected the arguments to be replaced, got %v, %v", p.Arguments, err)
+	}
+	if got.SessionKey != "telegram:1" || got.Tool != "web_search" {
+		t.Errorf("Expected the payload to be posted, got %+v", got)
+	}
+
+	if err := r.RegisterConfig([]config.HookConfig{{Event: "tool_start", Exec: "true"}}); err == nil {
+		t.Error("Expected an unknown event to be refused")
+	}
+}
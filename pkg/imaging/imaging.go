@@ -0,0 +1,248 @@
+// Package imaging prepares attached images for vision models: it applies
+// the EXIF orientation, scales images down to the provider's size limit and
+// converts them to a format the provider accepts, so a 12-megapixel phone
+// photo is sent as a few hundred kilobytes instead of being rejected.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif" // registers the GIF decoder
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+)
+
+// maxInputBytes bounds the files Prepare reads.
+const maxInputBytes = 50 << 20
+
+// jpegQualities are tried in turn until an image fits MaxBytes.
+var jpegQualities = []int{85, 70, 55}
+
+// ErrNotImage is returned for files that are not images.
+var ErrNotImage = errors.New("not an image")
+
+// Limits describes the images a provider accepts.
+type Limits struct {
+	Formats      []string // accepted media types, e.g. "image/jpeg"
+	MaxBytes     int64    // per encoded image; 0 means no limit
+	MaxDimension int      // longest edge in pixels; 0 means no limit
+}
+
+func (l Limits) accepts(mediaType string) bool {
+	return len(l.Formats) == 0 || slices.Contains(l.Formats, mediaType)
+}
+
+// Image is a prepared image.
+type Image struct {
+	MediaType     string
+	Data          []byte
+	Width, Height int
+	Converted     bool // re-encoded, rotated or scaled
+}
+
+// IsImage reports whether the file at path looks like an image.
+func IsImage(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+	_, ok := imageType(head[:n])
+	return ok
+}
+
+// Prepare reads the image at path and returns it within limits. Images
+// that already fit are returned unchanged.
+func Prepare(path string, limits Limits) (*Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxInputBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxInputBytes {
+		return nil, fmt.Errorf("image is larger than %d MB", maxInputBytes>>20)
+	}
+	return PrepareBytes(data, limits)
+}
+
+// PrepareBytes is Prepare for an image in memory.
+func PrepareBytes(data []byte, limits Limits) (*Image, error) {
+	mediaType, ok := imageType(data)
+	if !ok {
+		return nil, ErrNotImage
+	}
+	orientation := 1
+	if mediaType == "image/jpeg" {
+		orientation = jpegOrientation(data)
+	}
+
+	cfg, _, cfgErr := image.DecodeConfig(bytes.NewReader(data))
+	if cfgErr == nil && limits.accepts(mediaType) && orientation == 1 &&
+		fits(cfg.Width, cfg.Height, limits.MaxDimension) &&
+		(limits.MaxBytes <= 0 || int64(len(data)) <= limits.MaxBytes) {
+		return &Image{MediaType: mediaType, Data: data, Width: cfg.Width, Height: cfg.Height}, nil
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		// Go decodes JPEG, PNG and GIF; WebP and HEIC can only be passed on
+		return nil, fmt.Errorf("cannot convert %s: %w", mediaType, err)
+	}
+	img := orient(src, orientation)
+
+	maxDim := limits.MaxDimension
+	for attempt := 0; attempt < 4; attempt++ {
+		scaled := img
+		if w, h := img.Bounds().Dx(), img.Bounds().Dy(); !fits(w, h, maxDim) {
+			scaled = resize(img, maxDim)
+		}
+		out, err := encode(scaled, mediaType, limits)
+		if err != nil {
+			return nil, err
+		}
+		if out.MediaType != "" {
+			out.Converted = true
+			return out, nil
+		}
+		// Still too large at the lowest quality: shrink and retry
+		longest := max(img.Bounds().Dx(), img.Bounds().Dy())
+		if maxDim <= 0 || maxDim > longest {
+			maxDim = longest
+		}
+		maxDim = maxDim * 3 / 4
+	}
+	return nil, fmt.Errorf("cannot fit image into %d bytes", limits.MaxBytes)
+}
+
+// encode writes img in an accepted format: PNG for images with
+// transparency when PNG is accepted, JPEG otherwise. It returns an empty
+// Image if the result does not fit MaxBytes.
+func encode(img *image.NRGBA, srcType string, limits Limits) (*Image, error) {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	fitsBytes := func(n int) bool { return limits.MaxBytes <= 0 || int64(n) <= limits.MaxBytes }
+
+	if (srcType == "image/png" || srcType == "image/gif") && limits.accepts("image/png") && !img.Opaque() {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, err
+		}
+		if fitsBytes(buf.Len()) {
+			return &Image{MediaType: "image/png", Data: buf.Bytes(), Width: w, Height: h}, nil
+		}
+	}
+	if !limits.accepts("image/jpeg") {
+		return nil, fmt.Errorf("the model accepts none of the formats images can be converted to")
+	}
+	for _, quality := range jpegQualities {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			return nil, err
+		}
+		if fitsBytes(buf.Len()) {
+			return &Image{MediaType: "image/jpeg", Data: buf.Bytes(), Width: w, Height: h}, nil
+		}
+	}
+	return &Image{}, nil
+}
+
+// imageType sniffs the media type of an image.
+func imageType(head []byte) (string, bool) {
+	mediaType := http.DetectContentType(head)
+	switch mediaType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+		return mediaType, true
+	}
+	return "", false
+}
+
+func fits(w, h, maxDim int) bool {
+	return maxDim <= 0 || (w <= maxDim && h <= maxDim)
+}
+
+// resize scales img so its longest edge is maxDim, averaging the source
+// pixels that fall into each target pixel.
+func resize(img *image.NRGBA, maxDim int) *image.NRGBA {
+	sw, sh := img.Bounds().Dx(), img.Bounds().Dy()
+	dw, dh := maxDim, sh*maxDim/sw
+	if sh > sw {
+		dw, dh = sw*maxDim/sh, maxDim
+	}
+	dw, dh = max(dw, 1), max(dh, 1)
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+
+	for dy := 0; dy < dh; dy++ {
+		y0, y1 := dy*sh/dh, max((dy+1)*sh/dh, dy*sh/dh+1)
+		for dx := 0; dx < dw; dx++ {
+			x0, x1 := dx*sw/dw, max((dx+1)*sw/dw, dx*sw/dw+1)
+			var r, g, b, a, n uint32
+			for y := y0; y < y1; y++ {
+				row := img.Pix[y*img.Stride:]
+				for x := x0; x < x1; x++ {
+					p := row[x*4 : x*4+4]
+					r += uint32(p[0])
+					g += uint32(p[1])
+					b += uint32(p[2])
+					a += uint32(p[3])
+					n++
+				}
+			}
+			i := dy*dst.Stride + dx*4
+			dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2], dst.Pix[i+3] = uint8(r/n), uint8(g/n), uint8(b/n), uint8(a/n)
+		}
+	}
+	return dst
+}
+
+// orient returns img as NRGBA with the EXIF orientation applied, so the
+// top row of the result is the top of the scene.
+func orient(src image.Image, orientation int) *image.NRGBA {
+	b := src.Bounds()
+	img := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(img, img.Bounds(), src, b.Min, draw.Src)
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for sy := 0; sy < h; sy++ {
+		for sx := 0; sx < w; sx++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored
+				dx, dy = w-1-sx, sy
+			case 3: // upside down
+				dx, dy = w-1-sx, h-1-sy
+			case 4: // mirrored upside down
+				dx, dy = sx, h-1-sy
+			case 5: // transposed
+				dx, dy = sy, sx
+			case 6: // turned 90° clockwise
+				dx, dy = h-1-sy, sx
+			case 7: // transversed
+				dx, dy = h-1-sy, w-1-sx
+			case 8: // turned 90° counterclockwise
+				dx, dy = sy, w-1-sx
+			}
+			copy(dst.Pix[dy*dst.Stride+dx*4:dy*dst.Stride+dx*4+4], img.Pix[sy*img.Stride+sx*4:sy*img.Stride+sx*4+4])
+		}
+	}
+	return dst
+}
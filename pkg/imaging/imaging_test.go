@@ -0,0 +1,95 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// halves returns a w×h image, red on the left half and blue on the right.
+func halves(w, h int, alpha uint8) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBA{R: 255, A: alpha}
+			if x >= w/2 {
+				c = color.NRGBA{B: 255, A: alpha}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// withOrientation inserts an EXIF segment with the given orientation
+// after the SOI marker of a JPEG.
+func withOrientation(jpg []byte, orientation uint16) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x01\x01\x12\x00\x03\x00\x00\x00\x01\x00\x00\x00\x00\x00\x00\x00\x00")
+	binary.BigEndian.PutUint16(tiff[18:], orientation)
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(app1[2:], uint16(len(segment)+2))
+	out := append([]byte{}, jpg[:2]...)
+	out = append(out, app1...)
+	out = append(out, segment...)
+	return append(out, jpg[2:]...)
+}
+
+// TestPrepare_RotatesAndScales verifies an EXIF-rotated photo is turned
+// upright and scaled to the longest edge allowed.
+func TestPrepare_RotatesAndScales(t *testing.T) {
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, halves(400, 200, 255), nil)
+	data := withOrientation(buf.Bytes(), 6)
+	if o := jpegOrientation(data); o != 6 {
+		t.Fatalf("Expected orientation 6, got %d", o)
+	}
+
+	img, err := PrepareBytes(data, Limits{Formats: []string{"image/jpeg"}, MaxDimension: 100})
+	if err != nil {
+		t.Fatalf("Prepare failed: %v", err)
+	}
+	if img.Width != 50 || img.Height != 100 || !img.Converted {
+		t.Fatalf("Expected a converted 50x100 image, got %dx%d", img.Width, img.Height)
+	}
+	decoded, err := jpeg.Decode(bytes.NewReader(img.Data))
+	if err != nil {
+		t.Fatalf("Expected a valid JPEG: %v", err)
+	}
+	// Turned clockwise, the left (red) half of the sensor is now on top
+	if r, _, b, _ := decoded.At(25, 10).RGBA(); r < b {
+		t.Errorf("Expected red at the top after rotation, got r=%d b=%d", r>>8, b>>8)
+	}
+}
+
+// TestPrepare_Formats verifies fitting images pass unchanged, transparent
+// PNGs stay PNG and unsupported formats are converted to JPEG.
+func TestPrepare_Formats(t *testing.T) {
+	var buf bytes.Buffer
+	png.Encode(&buf, halves(40, 20, 128))
+	data := buf.Bytes()
+
+	img, err := PrepareBytes(data, Limits{Formats: []string{"image/png", "image/jpeg"}, MaxDimension: 100})
+	if err != nil || img.Converted || !bytes.Equal(img.Data, data) {
+		t.Errorf("Expected a fitting image to be passed unchanged, got %+v (%v)", img, err)
+	}
+
+	img, err = PrepareBytes(data, Limits{Formats: []string{"image/png", "image/jpeg"}, MaxDimension: 10})
+	if err != nil || img.MediaType != "image/png" || img.Width != 10 {
+		t.Errorf("Expected a transparent image to be scaled as PNG, got %+v (%v)", img, err)
+	}
+
+	img, err = PrepareBytes(data, Limits{Formats: []string{"image/jpeg"}})
+	if err != nil || img.MediaType != "image/jpeg" {
+		t.Errorf("Expected conversion to JPEG, got %+v (%v)", img, err)
+	}
+
+	if _, err := PrepareBytes([]byte("just text"), Limits{}); !errors.Is(err, ErrNotImage) {
+		t.Errorf("Expected ErrNotImage, got %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package knowledge
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Page is a page or chapter of a document, or the whole of a text without
+// pages, in which case Label is empty.
+type Page struct {
+	Label string
+	Text  string
+}
+
+// chunkText splits text into pieces of about size bytes, each repeating
+// the last overlap bytes of the one before so a passage cut in two is
+// still found whole. Cuts fall at paragraph, sentence or word ends when
+// one is in the second half of a piece.
+func chunkText(text string, size, overlap int) []string {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil
+	}
+	if size <= 0 || len(text) <= size {
+		return []string{text}
+	}
+	if overlap < 0 || overlap >= size/2 {
+		overlap = size / 4
+	}
+
+	var chunks []string
+	for start := 0; start < len(text); {
+		end := start + size
+		if end >= len(text) {
+			chunks = append(chunks, strings.TrimSpace(text[start:]))
+			break
+		}
+		end = cutPoint(text, start, end)
+		if chunk := strings.TrimSpace(text[start:end]); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+
+		next := end - overlap
+		// Start the overlap at a word
+		if i := strings.IndexAny(text[next:end], " \n"); i >= 0 {
+			next += i + 1
+		}
+		for next < len(text) && !utf8.RuneStart(text[next]) {
+			next++
+		}
+		if next <= start {
+			next = end
+		}
+		start = next
+	}
+	return chunks
+}
+
+// cutPoint returns where to end a piece running from start to at most
+// end: after the last paragraph break, sentence end or space in its second
+// half, or at end without splitting a character.
+func cutPoint(text string, start, end int) int {
+	window := text[start:end]
+	half := len(window) / 2
+	for _, sep := range []string{"\n\n", ". ", "! ", "? ", "\n", " "} {
+		if i := strings.LastIndex(window, sep); i >= half {
+			return start + i + len(sep)
+		}
+	}
+	for end > start && !utf8.RuneStart(text[end]) {
+		end--
+	}
+	return end
+}
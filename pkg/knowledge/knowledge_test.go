@@ -0,0 +1,161 @@
+package knowledge
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// fakeEmbedder gives each text a vector counting a few words, so texts
+// sharing them are close
+type fakeEmbedder struct {
+	calls int
+}
+
+var fakeDimensions = []string{"router", "reset", "wifi", "password", "garden"}
+
+func (e *fakeEmbedder) Model() string { return "fake" }
+
+func (e *fakeEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	e.calls++
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		v := make([]float32, len(fakeDimensions))
+		for j, word := range fakeDimensions {
+			v[j] = float32(strings.Count(strings.ToLower(text), word))
+		}
+		vectors[i] = v
+	}
+	return vectors, nil
+}
+
+// TestChunkText verifies chunks stay near the size, overlap, end at word
+// boundaries and cover the whole text
+func TestChunkText(t *testing.T) {
+	var sb strings.Builder
+	for i := 0; i < 200; i++ {
+		sb.WriteString("The quick brown fox jumps over the lazy dog. ")
+	}
+	text := strings.TrimSpace(sb.String())
+
+	chunks := chunkText(text, 500, 100)
+	if len(chunks) < 18 {
+		t.Fatalf("Expected about 23 chunks, got %d", len(chunks))
+	}
+	for i, c := range chunks {
+		if len(c) > 500 {
+			t.Errorf("Chunk %d is %d bytes, over the size", i, len(c))
+		}
+		if at := strings.Index(text, c); at < 0 || (at > 0 && text[at-1] != ' ') {
+			t.Errorf("Chunk %d doesn't start at a word of the text: %q", i, c[:20])
+		}
+	}
+	if !strings.HasSuffix(chunks[len(chunks)-1], "lazy dog.") {
+		t.Errorf("Expected the last chunk to end the text, got %q", chunks[len(chunks)-1])
+	}
+	// The end of one chunk is repeated at the start of the next
+	tail := chunks[0][len(chunks[0])-40:]
+	if !strings.Contains(chunks[1], strings.TrimSpace(tail[strings.Index(tail, " ")+1:])) {
+		t.Errorf("Expected chunks to overlap, got %q then %q", chunks[0], chunks[1][:60])
+	}
+
+	if got := chunkText("short", 500, 100); len(got) != 1 || got[0] != "short" {
+		t.Errorf("Expected a short text as one chunk, got %q", got)
+	}
+	for _, c := range chunkText(strings.Repeat("é", 1000), 301, 50) {
+		if !utf8.ValidString(c) {
+			t.Fatalf("Expected whole characters, got %q", c)
+		}
+	}
+}
+
+// TestStoreKeywordSearch verifies documents are found by their words with
+// their source and page, and ingesting a source again replaces it
+func TestStoreKeywordSearch(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(dir, nil, Options{ChunkChars: 200})
+	ctx := context.Background()
+
+	_, err := store.Ingest(ctx, Document{Source: "/docs/router.pdf", Title: "Router manual"}, []Page{
+		{Label: "Page 1", Text: "Welcome to your new router."},
+		{Label: "Page 2", Text: "To reset the router, hold the reset button for ten seconds."},
+	})
+	if err != nil {
+		t.Fatalf("Ingest failed: %v", err)
+	}
+	store.Ingest(ctx, Document{Source: "/docs/garden.txt"}, []Page{{Text: "Water the garden every morning."}})
+
+	results, err := store.Search(ctx, "how do I reset it", "", 5)
+	if err != nil || len(results) == 0 {
+		t.Fatalf("Expected results, got %v, %v", results, err)
+	}
+	if r := results[0]; r.Source != "/docs/router.pdf" || r.Page != "Page 2" || r.Title != "Router manual" || r.Score != 1 {
+		t.Errorf("Expected page 2 of the manual first, got %+v", r)
+	}
+	if results, _ := store.Search(ctx, "reset", "garden", 5); len(results) != 0 {
+		t.Errorf("Expected the source filter to leave the manual out, got %+v", results)
+	}
+
+	doc, _ := store.Ingest(ctx, Document{Source: "/docs/router.pdf"}, []Page{{Label: "Page 1", Text: "Factory reset is in the app."}})
+	if docs := store.Documents(); len(docs) != 2 || doc.Chunks != 1 {
+		t.Errorf("Expected the manual replaced, got %+v", docs)
+	}
+	if results, _ := store.Search(ctx, "button", "", 5); len(results) != 0 {
+		t.Errorf("Expected the old pages gone, got %+v", results)
+	}
+
+	// Another store on the same folder, like a gateway next to ingest, sees it
+	if results, _ := NewStore(dir, nil, Options{}).Search(ctx, "factory", "", 5); len(results) != 1 {
+		t.Errorf("Expected the index shared through the file, got %+v", results)
+	}
+	if removed, err := store.Remove("/docs/garden.txt"); !removed || err != nil || len(store.Documents()) != 1 {
+		t.Errorf("Expected the garden notes removed, got %v, %v", removed, err)
+	}
+}
+
+// TestStoreVectorSearch verifies embedded chunks are ranked by meaning
+// and kept through a save and load
+func TestStoreVectorSearch(t *testing.T) {
+	dir := t.TempDir()
+	embedder := &fakeEmbedder{}
+	store := NewStore(dir, embedder, Options{})
+	ctx := context.Background()
+
+	doc, err := store.Ingest(ctx, Document{Source: "net.md"}, []Page{
+		{Label: "Page 1", Text: "Change the wifi password in settings. The wifi password is on the sticker."},
+		{Label: "Page 2", Text: "The garden hose connects at the back."},
+	})
+	if err != nil || doc.Model != "fake" {
+		t.Fatalf("Expected an embedded document, got %+v, %v", doc, err)
+	}
+
+	reloaded := NewStore(dir, embedder, Options{})
+	results, err := reloaded.Search(ctx, "wifi", "", 1)
+	if err != nil || len(results) != 1 || results[0].Page != "Page 1" {
+		t.Fatalf("Expected the wifi page, got %+v, %v", results, err)
+	}
+	if results[0].Vector != nil {
+		t.Error("Expected results without their vectors")
+	}
+	if embedder.calls != 2 {
+		t.Errorf("Expected one embedding call to ingest and one to search, got %d", embedder.calls)
+	}
+}
+
+// TestVectorJSON verifies vectors survive their compact encoding
+func TestVectorJSON(t *testing.T) {
+	v := Vector{0.5, -1.25, 3e-7}
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Vector
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[0] != 0.5 || got[1] != -1.25 || got[2] != 3e-7 {
+		t.Errorf("Expected %v back, got %v", v, got)
+	}
+}
@@ -0,0 +1,173 @@
+package knowledge
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// How the two scores of a chunk are mixed when the query has an embedding:
+// meaning counts most, but the words keep exact terms such as names and
+// part numbers on top, and still find chunks that were never embedded.
+const (
+	vectorWeight  = 0.7
+	keywordWeight = 0.3
+)
+
+// BM25 parameters
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Result is a chunk found by Search, with a score from 0 to 1.
+type Result struct {
+	Chunk
+	Title string  `json:"title,omitempty"`
+	Score float64 `json:"score"`
+}
+
+// Search returns the limit chunks that best match query, best first. If
+// source is set, only documents whose source contains it are searched.
+// Without an embedder, or if embedding the query fails, chunks are ranked
+// by their words alone.
+func (s *Store) Search(ctx context.Context, query, source string, limit int) ([]Result, error) {
+	s.mu.Lock()
+	s.reload()
+	docs := make(map[string]Document, len(s.index.Documents))
+	for _, d := range s.index.Documents {
+		docs[d.ID] = d
+	}
+	var chunks []Chunk
+	for _, c := range s.index.Chunks {
+		if source == "" || strings.Contains(strings.ToLower(c.Source), strings.ToLower(source)) {
+			chunks = append(chunks, c)
+		}
+	}
+	s.mu.Unlock()
+	if len(chunks) == 0 || strings.TrimSpace(query) == "" {
+		return nil, nil
+	}
+
+	var queryVector []float32
+	model := ""
+	if s.embedder != nil {
+		model = s.embedder.Model()
+		vectors, err := s.embedder.Embed(ctx, []string{query})
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			logger.WarnCF("knowledge", "Failed to embed the query, searching by keywords",
+				map[string]interface{}{"error": err.Error()})
+		} else if len(vectors) == 1 {
+			queryVector = vectors[0]
+		}
+	}
+
+	keywords := keywordScores(query, chunks)
+	results := make([]Result, 0, len(chunks))
+	for i, c := range chunks {
+		score := keywords[i]
+		if queryVector != nil {
+			score *= keywordWeight
+			if docs[c.DocID].Model == model && len(c.Vector) == len(queryVector) {
+				score += vectorWeight * max(cosine(queryVector, c.Vector), 0)
+			}
+		}
+		if score <= 0 {
+			continue
+		}
+		c.Vector = nil
+		results = append(results, Result{Chunk: c, Title: docs[c.DocID].Title, Score: score})
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// keywordScores ranks chunks against query with BM25, scaled so the best
+// chunk scores 1.
+func keywordScores(query string, chunks []Chunk) []float64 {
+	var terms []string
+	seen := make(map[string]bool)
+	for _, t := range tokenize(query) {
+		if !seen[t] {
+			seen[t] = true
+			terms = append(terms, t)
+		}
+	}
+	scores := make([]float64, len(chunks))
+	if len(terms) == 0 {
+		return scores
+	}
+
+	docs := make([]map[string]int, len(chunks))
+	lengths := make([]int, len(chunks))
+	df := make(map[string]int)
+	total := 0
+	for i, c := range chunks {
+		counts := make(map[string]int)
+		words := tokenize(c.Text)
+		for _, w := range words {
+			counts[w]++
+		}
+		for _, t := range terms {
+			if counts[t] > 0 {
+				df[t]++
+			}
+		}
+		docs[i], lengths[i] = counts, len(words)
+		total += len(words)
+	}
+	avg := float64(total) / float64(len(chunks))
+	if avg == 0 {
+		return scores
+	}
+
+	best := 0.0
+	n := float64(len(chunks))
+	for i := range chunks {
+		for _, t := range terms {
+			tf := float64(docs[i][t])
+			if tf == 0 {
+				continue
+			}
+			idf := math.Log(1 + (n-float64(df[t])+0.5)/(float64(df[t])+0.5))
+			scores[i] += idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*float64(lengths[i])/avg))
+		}
+		best = max(best, scores[i])
+	}
+	if best > 0 {
+		for i := range scores {
+			scores[i] /= best
+		}
+	}
+	return scores
+}
+
+// tokenize lowercases text into its words and numbers.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+func cosine(a, b []float32) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
@@ -0,0 +1,255 @@
+// Package knowledge keeps documents the user added with picoclaw ingest,
+// cut into chunks and embedded, so the agent can search them and cite
+// what it found by source and page.
+package knowledge
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// Document is an ingested file or web page.
+type Document struct {
+	ID         string    `json:"id"`
+	Source     string    `json:"source"` // the path or URL it was read from
+	Title      string    `json:"title,omitempty"`
+	Format     string    `json:"format,omitempty"` // e.g. "pdf" or "html"
+	Pages      int       `json:"pages"`
+	Chunks     int       `json:"chunks"`
+	Model      string    `json:"model,omitempty"` // the embedding model; empty if not embedded
+	IngestedAt time.Time `json:"ingested_at"`
+}
+
+// Chunk is a piece of a document's text with where it came from.
+type Chunk struct {
+	DocID  string `json:"doc_id"`
+	Source string `json:"source"`
+	Page   string `json:"page,omitempty"` // the page label, e.g. "Page 3"
+	Text   string `json:"text"`
+	Vector Vector `json:"vector,omitempty"`
+}
+
+// Vector is an embedding, stored as base64 of little-endian float32s,
+// which is about half the size of a JSON array.
+type Vector []float32
+
+func (v Vector) MarshalJSON() ([]byte, error) {
+	buf := make([]byte, 4*len(v))
+	for i, f := range v {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(f))
+	}
+	return json.Marshal(base64.StdEncoding.EncodeToString(buf))
+}
+
+func (v *Vector) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	buf, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(buf)%4 != 0 {
+		return errors.New("invalid vector")
+	}
+	*v = make(Vector, len(buf)/4)
+	for i := range *v {
+		(*v)[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
+	return nil
+}
+
+// Options sets how documents are cut into chunks.
+type Options struct {
+	ChunkChars   int // about how long a chunk is
+	ChunkOverlap int // how much of a chunk the next one repeats
+}
+
+type index struct {
+	Documents []Document `json:"documents"`
+	Chunks    []Chunk    `json:"chunks"`
+}
+
+// Store keeps the index in index.json in its folder. The file is read
+// again when another process, such as picoclaw ingest next to a running
+// gateway, has changed it.
+type Store struct {
+	path     string
+	embedder Embedder // nil searches by keywords only
+	opts     Options
+
+	mu      sync.Mutex
+	index   index
+	modTime time.Time
+	size    int64
+}
+
+// NewStore opens the store in dir. embedder may be nil, in which case
+// documents are only found by their words.
+func NewStore(dir string, embedder Embedder, opts Options) *Store {
+	if opts.ChunkChars <= 0 {
+		opts.ChunkChars = 1200
+	}
+	s := &Store{path: filepath.Join(dir, "index.json"), embedder: embedder, opts: opts}
+	s.mu.Lock()
+	s.reload()
+	s.mu.Unlock()
+	return s
+}
+
+// Embedder returns the store's embedder, or nil.
+func (s *Store) Embedder() Embedder {
+	return s.embedder
+}
+
+// reload reads the index if the file changed since it was last read.
+// s.mu must be held.
+func (s *Store) reload() {
+	info, err := os.Stat(s.path)
+	if err != nil || (info.ModTime().Equal(s.modTime) && info.Size() == s.size) {
+		return
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return
+	}
+	var idx index
+	if err := json.Unmarshal(data, &idx); err != nil {
+		logger.WarnCF("knowledge", "Ignoring unreadable knowledge index",
+			map[string]interface{}{"path": s.path, "error": err.Error()})
+		return
+	}
+	s.index = idx
+	s.modTime, s.size = info.ModTime(), info.Size()
+}
+
+// save writes the index through a temporary file, so a reader never sees
+// half of it. s.mu must be held.
+func (s *Store) save() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(s.index)
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	if info, err := os.Stat(s.path); err == nil {
+		s.modTime, s.size = info.ModTime(), info.Size()
+	}
+	return nil
+}
+
+// Ingest cuts pages into chunks, embeds them if the store has an embedder,
+// and adds them as doc, replacing what was ingested from the same source
+// before. The stored document is returned.
+func (s *Store) Ingest(ctx context.Context, doc Document, pages []Page) (Document, error) {
+	var chunks []Chunk
+	for _, page := range pages {
+		for _, text := range chunkText(page.Text, s.opts.ChunkChars, s.opts.ChunkOverlap) {
+			chunks = append(chunks, Chunk{Source: doc.Source, Page: page.Label, Text: text})
+		}
+	}
+	if len(chunks) == 0 {
+		return doc, fmt.Errorf("%s has no text", doc.Source)
+	}
+
+	doc.Model = ""
+	if s.embedder != nil {
+		texts := make([]string, len(chunks))
+		for i, c := range chunks {
+			texts[i] = c.Text
+		}
+		vectors, err := s.embedder.Embed(ctx, texts)
+		if err != nil {
+			return doc, fmt.Errorf("failed to embed %s: %w", doc.Source, err)
+		}
+		for i := range chunks {
+			chunks[i].Vector = vectors[i]
+		}
+		doc.Model = s.embedder.Model()
+	}
+
+	doc.ID = uuid.NewString()
+	doc.Pages = len(pages)
+	doc.Chunks = len(chunks)
+	if doc.IngestedAt.IsZero() {
+		doc.IngestedAt = time.Now()
+	}
+	for i := range chunks {
+		chunks[i].DocID = doc.ID
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reload()
+	s.remove(doc.Source)
+	s.index.Documents = append(s.index.Documents, doc)
+	s.index.Chunks = append(s.index.Chunks, chunks...)
+	if err := s.save(); err != nil {
+		return doc, fmt.Errorf("failed to save the knowledge index: %w", err)
+	}
+	return doc, nil
+}
+
+// Remove drops the document ingested from source, reporting whether there
+// was one.
+func (s *Store) Remove(source string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reload()
+	if !s.remove(source) {
+		return false, nil
+	}
+	return true, s.save()
+}
+
+// remove drops source's document and chunks. s.mu must be held.
+func (s *Store) remove(source string) bool {
+	ids := make(map[string]bool)
+	docs := s.index.Documents[:0]
+	for _, d := range s.index.Documents {
+		if d.Source == source {
+			ids[d.ID] = true
+		} else {
+			docs = append(docs, d)
+		}
+	}
+	if len(ids) == 0 {
+		return false
+	}
+	s.index.Documents = docs
+	chunks := s.index.Chunks[:0]
+	for _, c := range s.index.Chunks {
+		if !ids[c.DocID] {
+			chunks = append(chunks, c)
+		}
+	}
+	s.index.Chunks = chunks
+	return true
+}
+
+// Documents returns the ingested documents, oldest first.
+func (s *Store) Documents() []Document {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reload()
+	return append([]Document(nil), s.index.Documents...)
+}
@@ -1,11 +1,16 @@
+// Package logger is picoclaw's logging layer. It writes through log/slog,
+// as text or JSON, with a level that can be set globally and per component
+// (the subsystem a message comes from, such as "agent" or "telegram").
 package logger
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"os"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -30,29 +35,88 @@ var (
 		FATAL: "FATAL",
 	}
 
-	currentLevel = INFO
-	logger       *Logger
-	once         sync.Once
-	mu           sync.RWMutex
+	slogLevels = map[LogLevel]slog.Level{
+		DEBUG: slog.LevelDebug,
+		INFO:  slog.LevelInfo,
+		WARN:  slog.LevelWarn,
+		ERROR: slog.LevelError,
+		FATAL: slog.LevelError + 4,
+	}
+
+	currentLevel    = INFO
+	componentLevels map[string]LogLevel
+	output          io.Writer    = os.Stderr
+	console         slog.Handler = newHandler(output, "text", false)
+	file            *os.File
+	filePath        string
+	fileHandler     slog.Handler
+	mu              sync.RWMutex
 )
 
-type Logger struct {
-	file *os.File
+// Options configure the logger; see Configure.
+type Options struct {
+	Level      string            // "debug", "info", "warn" or "error"; "" keeps the current level
+	Format     string            // "text" (default) or "json"
+	File       string            // also write JSON lines to this file, if set
+	Components map[string]string // level per component, overriding Level
 }
 
-type LogEntry struct {
-	Level     string                 `json:"level"`
-	Timestamp string                 `json:"timestamp"`
-	Component string                 `json:"component,omitempty"`
-	Message   string                 `json:"message"`
-	Fields    map[string]interface{} `json:"fields,omitempty"`
-	Caller    string                 `json:"caller,omitempty"`
+// Configure sets the level, output format, log file and per-component
+// levels. It returns an error, and changes nothing, if a level or the
+// format is unknown or the file can't be opened.
+func Configure(opts Options) error {
+	level := GetLevel()
+	if opts.Level != "" {
+		var err error
+		if level, err = ParseLevel(opts.Level); err != nil {
+			return err
+		}
+	}
+	components := make(map[string]LogLevel, len(opts.Components))
+	for component, name := range opts.Components {
+		l, err := ParseLevel(name)
+		if err != nil {
+			return fmt.Errorf("component %s: %w", component, err)
+		}
+		components[component] = l
+	}
+	format := strings.ToLower(opts.Format)
+	if format != "" && format != "text" && format != "json" {
+		return fmt.Errorf("unknown log format %q (want text or json)", opts.Format)
+	}
+	mu.RLock()
+	reopen := opts.File != "" && opts.File != filePath
+	mu.RUnlock()
+	if reopen {
+		if err := EnableFileLogging(opts.File); err != nil {
+			return err
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	currentLevel = level
+	componentLevels = components
+	console = newHandler(output, format, false)
+	return nil
 }
 
-func init() {
-	once.Do(func() {
-		logger = &Logger{}
-	})
+// ParseLevel parses a level name such as "info" or "WARN". "warning" is
+// accepted for WARN.
+func ParseLevel(name string) (LogLevel, error) {
+	switch strings.ToUpper(strings.TrimSpace(name)) {
+	case "DEBUG":
+		return DEBUG, nil
+	case "INFO":
+		return INFO, nil
+	case "WARN", "WARNING":
+		return WARN, nil
+	case "ERROR":
+		return ERROR, nil
+	case "FATAL":
+		return FATAL, nil
+	}
+	return INFO, fmt.Errorf("unknown log level %q", name)
 }
 
 func SetLevel(level LogLevel) {
@@ -67,21 +131,23 @@ func GetLevel() LogLevel {
 	return currentLevel
 }
 
-func EnableFileLogging(filePath string) error {
-	mu.Lock()
-	defer mu.Unlock()
-
-	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+// EnableFileLogging also writes every message, as JSON lines with the
+// caller, to path.
+func EnableFileLogging(path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 	if err != nil {
 		return fmt.Errorf("failed to open log file: %w", err)
 	}
 
-	if logger.file != nil {
-		logger.file.Close()
+	mu.Lock()
+	if file != nil {
+		file.Close()
 	}
+	file, filePath = f, path
+	fileHandler = newHandler(f, "json", true)
+	mu.Unlock()
 
-	logger.file = file
-	log.Println("File logging enabled:", filePath)
+	InfoCF("logger", "File logging enabled", map[string]interface{}{"path": path})
 	return nil
 }
 
@@ -89,73 +155,77 @@ func DisableFileLogging() {
 	mu.Lock()
 	defer mu.Unlock()
 
-	if logger.file != nil {
-		logger.file.Close()
-		logger.file = nil
-		log.Println("File logging disabled")
+	if file != nil {
+		file.Close()
+		file, filePath = nil, ""
+		fileHandler = nil
 	}
 }
 
-func logMessage(level LogLevel, component string, message string, fields map[string]interface{}) {
-	if level < currentLevel {
-		return
+// newHandler returns a slog handler for format that lets every level
+// through; levels are filtered in logMessage, per component.
+func newHandler(w io.Writer, format string, source bool) slog.Handler {
+	opts := &slog.HandlerOptions{
+		AddSource: source,
+		Level:     slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.LevelKey && len(groups) == 0 {
+				if level, ok := a.Value.Any().(slog.Level); ok && level == slogLevels[FATAL] {
+					a.Value = slog.StringValue(logLevelNames[FATAL])
+				}
+			}
+			return a
+		},
 	}
-
-	entry := LogEntry{
-		Level:     logLevelNames[level],
-		Timestamp: time.Now().UTC().Format(time.RFC3339),
-		Component: component,
-		Message:   message,
-		Fields:    fields,
+	if format == "json" {
+		return slog.NewJSONHandler(w, opts)
 	}
+	return slog.NewTextHandler(w, opts)
+}
 
-	if pc, file, line, ok := runtime.Caller(2); ok {
-		fn := runtime.FuncForPC(pc)
-		if fn != nil {
-			entry.Caller = fmt.Sprintf("%s:%d (%s)", file, line, fn.Name())
-		}
+// enabled reports whether a message at level from component is logged.
+func enabled(level LogLevel, component string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	threshold, ok := componentLevels[component]
+	if !ok {
+		threshold = currentLevel
 	}
+	return level >= threshold
+}
 
-	if logger.file != nil {
-		jsonData, err := json.Marshal(entry)
-		if err == nil {
-			logger.file.WriteString(string(jsonData) + "\n")
-		}
+func logMessage(level LogLevel, component string, message string, fields map[string]interface{}) {
+	if !enabled(level, component) {
+		return
 	}
 
-	var fieldStr string
-	if len(fields) > 0 {
-		fieldStr = " " + formatFields(fields)
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:]) // skip Callers, logMessage and the exported function
+	record := slog.NewRecord(time.Now(), slogLevels[level], message, pcs[0])
+	if component != "" {
+		record.AddAttrs(slog.String("component", component))
 	}
-
-	logLine := fmt.Sprintf("[%s] [%s]%s %s%s",
-		entry.Timestamp,
-		logLevelNames[level],
-		formatComponent(component),
-		message,
-		fieldStr,
-	)
-
-	log.Println(logLine)
-
-	if level == FATAL {
-		os.Exit(1)
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		record.AddAttrs(slog.Any(k, fields[k]))
 	}
-}
 
-func formatComponent(component string) string {
-	if component == "" {
-		return ""
+	mu.RLock()
+	handlers := []slog.Handler{console, fileHandler}
+	mu.RUnlock()
+	for _, h := range handlers {
+		if h != nil {
+			h.Handle(context.Background(), record.Clone())
+		}
 	}
-	return fmt.Sprintf(" %s:", component)
-}
 
-func formatFields(fields map[string]interface{}) string {
-	var parts []string
-	for k, v := range fields {
-		parts = append(parts, fmt.Sprintf("%s=%v", k, v))
+	if level == FATAL {
+		os.Exit(1)
 	}
-	return fmt.Sprintf("{%s}", strings.Join(parts, ", "))
 }
 
 func Debug(message string) {
@@ -1,6 +1,9 @@
 package logger
 
 import (
+	"bytes"
+	"encoding/json"
+	"strings"
 	"testing"
 )
 
@@ -137,3 +140,107 @@ func TestLoggerHelperFunctions(t *testing.T) {
 	DebugC("test", "Debug with component")
 	WarnF("Warning with fields", map[string]interface{}{"key": "value"})
 }
+
+// captureOutput sends console output to a buffer, configured with opts,
+// until the test ends.
+func captureOutput(t *testing.T, opts Options) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	mu.Lock()
+	savedOutput, savedConsole, savedLevel, savedComponents := output, console, currentLevel, componentLevels
+	output = &buf
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		output, console, currentLevel, componentLevels = savedOutput, savedConsole, savedLevel, savedComponents
+		mu.Unlock()
+	})
+	if err := Configure(opts); err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+	return &buf
+}
+
+// TestConfigureJSON verifies messages are written as JSON with the
+// component and fields as attributes.
+func TestConfigureJSON(t *testing.T) {
+	buf := captureOutput(t, Options{Level: "info", Format: "json"})
+
+	InfoCF("agent", "Tool call", map[string]interface{}{"tool": "exec", "iteration": 2})
+	DebugCF("agent", "Hidden", nil)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("Expected 1 line, got %d: %q", len(lines), buf.String())
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("Expected a JSON line, got %q: %v", lines[0], err)
+	}
+	for key, want := range map[string]interface{}{"level": "INFO", "msg": "Tool call", "component": "agent", "tool": "exec", "iteration": 2.0} {
+		if entry[key] != want {
+			t.Errorf("Expected %s=%v, got %v", key, want, entry[key])
+		}
+	}
+}
+
+// TestConfigureComponents verifies per-component levels override the
+// global level both ways.
+func TestConfigureComponents(t *testing.T) {
+	buf := captureOutput(t, Options{
+		Level:      "warn",
+		Format:     "text",
+		Components: map[string]string{"cron": "debug", "telegram": "error"},
+	})
+
+	DebugC("cron", "cron debug")
+	InfoC("agent", "agent info")
+	WarnC("agent", "agent warn")
+	WarnC("telegram", "telegram warn")
+
+	out := buf.String()
+	for _, want := range []string{"cron debug", "agent warn"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q to be logged, got %q", want, out)
+		}
+	}
+	for _, unwanted := range []string{"agent info", "telegram warn"} {
+		if strings.Contains(out, unwanted) {
+			t.Errorf("Expected %q to be filtered, got %q", unwanted, out)
+		}
+	}
+	if !strings.Contains(out, "component=cron") {
+		t.Errorf("Expected text output with component=cron, got %q", out)
+	}
+}
+
+// TestConfigureInvalid verifies bad levels and formats are rejected
+// without changing the level.
+func TestConfigureInvalid(t *testing.T) {
+	initialLevel := GetLevel()
+	defer SetLevel(initialLevel)
+	SetLevel(WARN)
+
+	for _, opts := range []Options{
+		{Level: "loud"},
+		{Format: "xml"},
+		{Components: map[string]string{"agent": "verbose"}},
+	} {
+		if err := Configure(opts); err == nil {
+			t.Errorf("Expected an error for %+v", opts)
+		}
+	}
+	if GetLevel() != WARN {
+		t.Errorf("Expected level WARN to be kept, got %s", logLevelNames[GetLevel()])
+	}
+}
+
+// TestParseLevel verifies level names are parsed case-insensitively.
+func TestParseLevel(t *testing.T) {
+	for name, want := range map[string]LogLevel{"debug": DEBUG, "INFO": INFO, "Warning": WARN, "error": ERROR} {
+		got, err := ParseLevel(name)
+		if err != nil || got != want {
+			t.Errorf("ParseLevel(%q) = %v, %v; expected %v", name, got, err, want)
+		}
+	}
+}
@@ -0,0 +1,457 @@
+// Package mqtt is a small MQTT 3.1.1 client: enough to publish and
+// subscribe at QoS 0 and 1 over TCP or TLS, which is what home-automation
+// brokers such as Mosquitto expect of a participant.
+//
+// A Client is one connection. It does not reconnect by itself; callers
+// watch Done and dial again, resubscribing as they go.
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultKeepAlive is how often the client pings an idle broker.
+	DefaultKeepAlive = 60 * time.Second
+	// maxPacket is the largest packet accepted from the broker.
+	maxPacket = 4 << 20
+	// connectTimeout bounds the handshake when ctx has no deadline.
+	connectTimeout = 30 * time.Second
+)
+
+// ErrClosed is returned by calls on a connection that has ended.
+var ErrClosed = errors.New("mqtt connection closed")
+
+// Options describe how to reach and log in to a broker.
+type Options struct {
+	// Broker is tcp://host:port or mqtt://host:port, or mqtts://, ssl://
+	// or tls:// for TLS. The port defaults to 1883, or 8883 with TLS.
+	Broker   string
+	ClientID string // empty picks a random one
+	Username string
+	Password string
+	// KeepAlive is how often the broker is pinged; 0 is DefaultKeepAlive.
+	KeepAlive time.Duration
+	// OnMessage receives messages on subscribed topics. It runs on the
+	// connection's reader, so it must not block.
+	OnMessage func(Message)
+}
+
+// Message is one message received on a subscribed topic.
+type Message struct {
+	Topic    string
+	Payload  []byte
+	QoS      byte
+	Retained bool // a stored value sent on subscribing, not a new event
+}
+
+// Subscription is a topic filter and the QoS to receive it at.
+type Subscription struct {
+	Filter string
+	QoS    byte
+}
+
+// Client is one connection to a broker.
+type Client struct {
+	opts Options
+	conn net.Conn
+
+	writeMu sync.Mutex
+
+	mu      sync.Mutex // guards nextID and pending
+	nextID  uint16
+	pending map[uint16]chan []byte
+
+	done      chan struct{}
+	err       error
+	closeOnce sync.Once
+}
+
+// Dial connects and logs in to the broker. The connection stays open
+// until Close or until it fails; ctx only bounds the handshake.
+func Dial(ctx context.Context, opts Options) (*Client, error) {
+	network, addr, useTLS, err := parseBroker(opts.Broker)
+	if err != nil {
+		return nil, err
+	}
+	if opts.KeepAlive <= 0 {
+		opts.KeepAlive = DefaultKeepAlive
+	}
+	if opts.ClientID == "" {
+		b := make([]byte, 6)
+		rand.Read(b)
+		opts.ClientID = "picoclaw-" + hex.EncodeToString(b)
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, connectTimeout)
+		defer cancel()
+	}
+
+	var conn net.Conn
+	if useTLS {
+		host, _, _ := net.SplitHostPort(addr)
+		dialer := &tls.Dialer{Config: &tls.Config{ServerName: host}}
+		conn, err = dialer.DialContext(ctx, network, addr)
+	} else {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, network, addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		opts:    opts,
+		conn:    conn,
+		pending: make(map[uint16]chan []byte),
+		done:    make(chan struct{}),
+	}
+	r := bufio.NewReader(conn)
+	if err := c.handshake(ctx, r); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	go c.read(r)
+	go c.ping()
+	return c, nil
+}
+
+// parseBroker splits a broker URL into what to dial.
+func parseBroker(broker string) (network, addr string, useTLS bool, err error) {
+	if broker == "" {
+		return "", "", false, errors.New("no mqtt broker configured")
+	}
+	if !strings.Contains(broker, "://") {
+		broker = "tcp://" + broker
+	}
+	u, err := url.Parse(broker)
+	if err != nil {
+		return "", "", false, fmt.Errorf("invalid mqtt broker %q: %w", broker, err)
+	}
+	port := "1883"
+	switch u.Scheme {
+	case "tcp", "mqtt":
+	case "mqtts", "ssl", "tls":
+		useTLS = true
+		port = "8883"
+	default:
+		return "", "", false, fmt.Errorf("unsupported mqtt broker scheme %q", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return "", "", false, fmt.Errorf("invalid mqtt broker %q: no host", broker)
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	return "tcp", net.JoinHostPort(u.Hostname(), port), useTLS, nil
+}
+
+// connackErrors are the broker's reasons for refusing a connection.
+var connackErrors = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "client identifier rejected",
+	3: "server unavailable",
+	4: "bad username or password",
+	5: "not authorized",
+}
+
+func (c *Client) handshake(ctx context.Context, r *bufio.Reader) error {
+	deadline, _ := ctx.Deadline()
+	c.conn.SetDeadline(deadline)
+	defer c.conn.SetDeadline(time.Time{})
+
+	var flags byte = 0x02 // clean session; subscriptions are renewed on each dial
+	var payload []byte
+	payload = appendString(payload, c.opts.ClientID)
+	if c.opts.Username != "" {
+		flags |= 0x80
+		payload = appendString(payload, c.opts.Username)
+		if c.opts.Password != "" {
+			flags |= 0x40
+			payload = appendString(payload, c.opts.Password)
+		}
+	}
+	keepAlive := int(c.opts.KeepAlive / time.Second)
+	if keepAlive > 0xFFFF {
+		keepAlive = 0xFFFF
+	}
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, flags, byte(keepAlive>>8), byte(keepAlive))
+	body = append(body, payload...)
+	if err := c.write(packetConnect<<4, body); err != nil {
+		return err
+	}
+
+	typ, _, resp, err := readPacket(r)
+	if err != nil {
+		return fmt.Errorf("mqtt handshake: %w", err)
+	}
+	if typ != packetConnack || len(resp) < 2 {
+		return errors.New("mqtt handshake: broker did not acknowledge the connection")
+	}
+	if code := resp[1]; code != 0 {
+		reason, ok := connackErrors[code]
+		if !ok {
+			reason = fmt.Sprintf("code %d", code)
+		}
+		return fmt.Errorf("mqtt broker refused the connection: %s", reason)
+	}
+	return nil
+}
+
+// Publish sends payload to topic. At QoS 1 it waits for the broker to
+// acknowledge it.
+func (c *Client) Publish(ctx context.Context, topic string, payload []byte, qos byte, retain bool) error {
+	if err := ValidTopic(topic); err != nil {
+		return err
+	}
+	if qos > 1 {
+		qos = 1
+	}
+	header := packetPublish<<4 | qos<<1
+	if retain {
+		header |= 0x01
+	}
+	body := appendString(nil, topic)
+	if qos == 0 {
+		return c.write(header, append(body, payload...))
+	}
+	id, ack := c.register()
+	defer c.unregister(id)
+	body = append(body, byte(id>>8), byte(id))
+	if err := c.write(header, append(body, payload...)); err != nil {
+		return err
+	}
+	_, err := c.wait(ctx, ack)
+	return err
+}
+
+// Subscribe asks for messages matching the filters, which are delivered
+// to OnMessage. QoS above 1 is lowered to 1.
+func (c *Client) Subscribe(ctx context.Context, subs ...Subscription) error {
+	if len(subs) == 0 {
+		return nil
+	}
+	id, ack := c.register()
+	defer c.unregister(id)
+	body := []byte{byte(id >> 8), byte(id)}
+	for _, s := range subs {
+		if err := ValidFilter(s.Filter); err != nil {
+			return err
+		}
+		qos := s.QoS
+		if qos > 1 {
+			qos = 1
+		}
+		body = append(appendString(body, s.Filter), qos)
+	}
+	if err := c.write(packetSubscribe<<4|0x02, body); err != nil {
+		return err
+	}
+	granted, err := c.wait(ctx, ack)
+	if err != nil {
+		return err
+	}
+	for i, code := range granted {
+		if code == 0x80 && i < len(subs) {
+			return fmt.Errorf("mqtt broker refused the subscription to %q", subs[i].Filter)
+		}
+	}
+	return nil
+}
+
+// Unsubscribe stops messages matching the filters.
+func (c *Client) Unsubscribe(ctx context.Context, filters ...string) error {
+	if len(filters) == 0 {
+		return nil
+	}
+	id, ack := c.register()
+	defer c.unregister(id)
+	body := []byte{byte(id >> 8), byte(id)}
+	for _, f := range filters {
+		body = appendString(body, f)
+	}
+	if err := c.write(packetUnsubscribe<<4|0x02, body); err != nil {
+		return err
+	}
+	_, err := c.wait(ctx, ack)
+	return err
+}
+
+// Done is closed when the connection ends.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err is why the connection ended, once Done is closed.
+func (c *Client) Err() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return nil
+	}
+}
+
+// Close says goodbye to the broker and ends the connection.
+func (c *Client) Close() error {
+	select {
+	case <-c.done:
+		return nil
+	default:
+	}
+	c.write(packetDisconnect<<4, nil)
+	c.fail(ErrClosed)
+	return nil
+}
+
+// fail ends the connection with err, waking anyone waiting on a reply.
+func (c *Client) fail(err error) {
+	c.closeOnce.Do(func() {
+		c.err = err
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+// register reserves a packet ID and the channel its acknowledgement
+// arrives on.
+func (c *Client) register() (uint16, chan []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for {
+		c.nextID++
+		if c.nextID == 0 {
+			continue
+		}
+		if _, used := c.pending[c.nextID]; !used {
+			break
+		}
+	}
+	ack := make(chan []byte, 1)
+	c.pending[c.nextID] = ack
+	return c.nextID, ack
+}
+
+func (c *Client) unregister(id uint16) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}
+
+func (c *Client) wait(ctx context.Context, ack chan []byte) ([]byte, error) {
+	select {
+	case body := <-ack:
+		return body, nil
+	case <-c.done:
+		return nil, c.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *Client) write(header byte, body []byte) error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+	}
+	packet := append([]byte{header}, encodeLength(len(body))...)
+	packet = append(packet, body...)
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(c.opts.KeepAlive))
+	if _, err := c.conn.Write(packet); err != nil {
+		c.fail(err)
+		return err
+	}
+	return nil
+}
+
+// read handles packets from the broker until the connection fails. The
+// broker must send something, if only a ping response, within one and a
+// half keepalive periods.
+func (c *Client) read(r *bufio.Reader) {
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(c.opts.KeepAlive * 3 / 2))
+		typ, flags, body, err := readPacket(r)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				err = errors.New("mqtt broker stopped answering")
+			}
+			c.fail(err)
+			return
+		}
+		switch typ {
+		case packetPublish:
+			c.received(flags, body)
+		case packetPuback, packetSuback, packetUnsuback:
+			if len(body) < 2 {
+				continue
+			}
+			id := uint16(body[0])<<8 | uint16(body[1])
+			c.mu.Lock()
+			ack := c.pending[id]
+			c.mu.Unlock()
+			if ack != nil {
+				ack <- body[2:]
+			}
+		case packetPubrel:
+			// The end of a QoS 2 delivery the broker insisted on
+			if len(body) >= 2 {
+				c.write(packetPubcomp<<4, body[:2])
+			}
+		}
+	}
+}
+
+// received passes on a PUBLISH and acknowledges it.
+func (c *Client) received(flags byte, body []byte) {
+	qos := (flags >> 1) & 0x03
+	topic, rest, ok := readString(body)
+	if !ok {
+		return
+	}
+	if qos > 0 {
+		if len(rest) < 2 {
+			return
+		}
+		id := rest[:2]
+		rest = rest[2:]
+		if qos == 1 {
+			c.write(packetPuback<<4, id)
+		} else {
+			c.write(packetPubrec<<4, id)
+		}
+	}
+	if c.opts.OnMessage != nil {
+		c.opts.OnMessage(Message{Topic: topic, Payload: rest, QoS: qos, Retained: flags&0x01 != 0})
+	}
+}
+
+// ping keeps an idle connection alive.
+func (c *Client) ping() {
+	ticker := time.NewTicker(c.opts.KeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.write(packetPingreq<<4, nil)
+		}
+	}
+}
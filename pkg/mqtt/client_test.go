@@ -0,0 +1,117 @@
+package mqtt_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/mqtt"
+	"github.com/sipeed/picoclaw/pkg/mqtt/mqtttest"
+)
+
+// TestClient verifies login, publishing at both QoS levels, and that
+// subscriptions receive live and retained messages until unsubscribed
+func TestClient(t *testing.T) {
+	b := mqtttest.NewBroker(t)
+	b.Username, b.Password = "pico", "secret"
+	b.Publish("home/kitchen/temp", "21.5", true)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := mqtt.Dial(ctx, mqtt.Options{Broker: b.URL(), Username: "pico", Password: "wrong"}); err == nil || !strings.Contains(err.Error(), "bad username or password") {
+		t.Fatalf("Expected the login refused, got %v", err)
+	}
+
+	received := make(chan mqtt.Message, 10)
+	client, err := mqtt.Dial(ctx, mqtt.Options{
+		Broker: b.URL(), Username: "pico", Password: "secret",
+		OnMessage: func(m mqtt.Message) { received <- m },
+	})
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer client.Close()
+
+	if err := client.Subscribe(ctx, mqtt.Subscription{Filter: "home/+/temp", QoS: 1}); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	if m := <-received; m.Topic != "home/kitchen/temp" || string(m.Payload) != "21.5" || !m.Retained {
+		t.Errorf("Expected the retained reading, got %+v", m)
+	}
+	b.Publish("home/hall/temp", "19", false)
+	b.Publish("home/hall/humidity", "40", false)
+	if m := <-received; m.Topic != "home/hall/temp" || m.Retained {
+		t.Errorf("Expected the live reading, got %+v", m)
+	}
+
+	if err := client.Publish(ctx, "home/lamp/set", []byte("on"), 1, true); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	if err := client.Publish(ctx, "home/log", []byte("hello"), 0, false); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	if err := client.Publish(ctx, "home/+", nil, 0, false); err == nil {
+		t.Error("Expected a wildcard topic refused")
+	}
+	for deadline := time.After(5 * time.Second); len(b.Messages()) < 2; {
+		select {
+		case <-b.Changed():
+		case <-deadline:
+			t.Fatal("Timed out waiting for the messages")
+		}
+	}
+	msgs := b.Messages()
+	if msgs[0] != (mqtttest.Message{Topic: "home/lamp/set", Payload: "on", QoS: 1, Retained: true}) || msgs[1].Payload != "hello" {
+		t.Errorf("Unexpected messages %+v", msgs)
+	}
+
+	if err := client.Unsubscribe(ctx, "home/+/temp"); err != nil {
+		t.Fatalf("Unsubscribe failed: %v", err)
+	}
+	b.Publish("home/hall/temp", "20", false)
+
+	b.Disconnect()
+	select {
+	case <-client.Done():
+	case <-ctx.Done():
+		t.Fatal("Expected the dropped connection noticed")
+	}
+	if err := client.Publish(ctx, "home/log", nil, 1, false); err == nil {
+		t.Error("Expected publishing on a closed connection to fail")
+	}
+	select {
+	case m := <-received:
+		t.Errorf("Expected nothing after unsubscribing, got %+v", m)
+	default:
+	}
+}
+
+// TestMatch verifies topic filters with wildcards
+func TestMatch(t *testing.T) {
+	cases := []struct {
+		filter, topic string
+		want          bool
+	}{
+		{"home/door", "home/door", true},
+		{"home/door", "home/door/front", false},
+		{"home/+/temp", "home/hall/temp", true},
+		{"home/+/temp", "home/hall/humidity", false},
+		{"home/+", "home", false},
+		{"home/#", "home", true},
+		{"home/#", "home/a/b/c", true},
+		{"#", "anything/at/all", true},
+		{"#", "$SYS/uptime", false},
+		{"$SYS/#", "$SYS/uptime", true},
+	}
+	for _, c := range cases {
+		if got := mqtt.Match(c.filter, c.topic); got != c.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", c.filter, c.topic, got, c.want)
+		}
+	}
+	for _, bad := range []string{"", "home/#/x", "home/a+", "home#"} {
+		if mqtt.ValidFilter(bad) == nil {
+			t.Errorf("Expected filter %q refused", bad)
+		}
+	}
+}
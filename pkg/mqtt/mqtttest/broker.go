@@ -0,0 +1,340 @@
+// Package mqtttest runs an MQTT broker in memory for tests. It speaks
+// enough of MQTT 3.1.1 for the mqtt package: login, QoS 0 and 1,
+// retained messages, subscriptions with wildcards and pings.
+//
+//	b := mqtttest.NewBroker(t)
+//	client, err := mqtt.Dial(ctx, mqtt.Options{Broker: b.URL()})
+//	b.Publish("home/door", "open", false)
+//	msgs := b.Messages() // everything clients published
+package mqtttest
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/mqtt"
+)
+
+// Message is one message a client published.
+type Message struct {
+	Topic    string
+	Payload  string
+	QoS      byte
+	Retained bool
+}
+
+// Broker is an in-memory broker listening on localhost.
+type Broker struct {
+	// Username and Password, if set, are the only login accepted.
+	Username string
+	Password string
+
+	ln net.Listener
+
+	mu        sync.Mutex
+	sessions  map[*session]bool
+	retained  map[string]string
+	published []Message
+	changed   chan struct{}
+}
+
+type session struct {
+	conn    net.Conn
+	writeMu sync.Mutex
+	filters map[string]bool
+}
+
+// NewBroker starts a broker, stopped when the test ends.
+func NewBroker(t testing.TB) *Broker {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &Broker{
+		ln:       ln,
+		sessions: make(map[*session]bool),
+		retained: make(map[string]string),
+		changed:  make(chan struct{}),
+	}
+	go b.accept()
+	t.Cleanup(b.Close)
+	return b
+}
+
+// URL is the broker's address for mqtt.Options.Broker.
+func (b *Broker) URL() string {
+	return "tcp://" + b.ln.Addr().String()
+}
+
+// Close stops the broker and drops every client.
+func (b *Broker) Close() {
+	b.ln.Close()
+	b.Disconnect()
+}
+
+// Disconnect drops every client, as a broker restart would.
+func (b *Broker) Disconnect() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.sessions {
+		s.conn.Close()
+	}
+}
+
+// Publish delivers a message to subscribed clients, as if another
+// client had sent it, and keeps it if retained.
+func (b *Broker) Publish(topic, payload string, retain bool) {
+	b.route(Message{Topic: topic, Payload: payload, Retained: retain})
+}
+
+// Messages returns everything clients have published, in order.
+func (b *Broker) Messages() []Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]Message(nil), b.published...)
+}
+
+// Subscribers counts the clients subscribed to exactly filter.
+func (b *Broker) Subscribers(filter string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := 0
+	for s := range b.sessions {
+		if s.filters[filter] {
+			n++
+		}
+	}
+	return n
+}
+
+// Changed returns a channel closed the next time a client publishes,
+// subscribes or unsubscribes, for tests waiting on one.
+func (b *Broker) Changed() <-chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.changed
+}
+
+func (b *Broker) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+func (b *Broker) accept() {
+	for {
+		conn, err := b.ln.Accept()
+		if err != nil {
+			return
+		}
+		go b.serve(conn)
+	}
+}
+
+func (b *Broker) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	s := &session{conn: conn, filters: make(map[string]bool)}
+
+	typ, _, body, err := readPacket(r)
+	if err != nil || typ != 1 {
+		return
+	}
+	if code := b.login(body); code != 0 {
+		s.write(0x20, []byte{0, code})
+		return
+	}
+	b.mu.Lock()
+	b.sessions[s] = true
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		delete(b.sessions, s)
+		b.mu.Unlock()
+	}()
+	s.write(0x20, []byte{0, 0})
+
+	for {
+		typ, flags, body, err := readPacket(r)
+		if err != nil {
+			return
+		}
+		switch typ {
+		case 3: // PUBLISH
+			qos := (flags >> 1) & 0x03
+			topic, rest := readString(body)
+			if qos > 0 {
+				s.write(0x40, rest[:2])
+				rest = rest[2:]
+			}
+			msg := Message{Topic: topic, Payload: string(rest), QoS: qos, Retained: flags&0x01 != 0}
+			b.mu.Lock()
+			b.published = append(b.published, msg)
+			b.notify()
+			b.mu.Unlock()
+			b.route(msg)
+		case 8: // SUBSCRIBE
+			id, rest := body[:2], body[2:]
+			var granted []byte
+			var filters []string
+			for len(rest) > 0 {
+				var filter string
+				filter, rest = readString(rest)
+				granted = append(granted, rest[0])
+				rest = rest[1:]
+				filters = append(filters, filter)
+			}
+			b.mu.Lock()
+			for _, f := range filters {
+				s.filters[f] = true
+			}
+			b.notify()
+			b.mu.Unlock()
+			s.write(0x90, append(id, granted...))
+			b.sendRetained(s, filters)
+		case 10: // UNSUBSCRIBE
+			id, rest := body[:2], body[2:]
+			b.mu.Lock()
+			for len(rest) > 0 {
+				var filter string
+				filter, rest = readString(rest)
+				delete(s.filters, filter)
+			}
+			b.notify()
+			b.mu.Unlock()
+			s.write(0xB0, id)
+		case 12: // PINGREQ
+			s.write(0xD0, nil)
+		case 14: // DISCONNECT
+			return
+		}
+	}
+}
+
+// login checks a CONNECT packet, returning the CONNACK code.
+func (b *Broker) login(body []byte) byte {
+	_, rest := readString(body)
+	if len(rest) < 4 {
+		return 1
+	}
+	flags := rest[1]
+	_, rest = readString(rest[4:]) // client ID
+	var user, pass string
+	if flags&0x80 != 0 {
+		user, rest = readString(rest)
+	}
+	if flags&0x40 != 0 {
+		pass, _ = readString(rest)
+	}
+	if b.Username != "" && (user != b.Username || pass != b.Password) {
+		return 4
+	}
+	return 0
+}
+
+// route delivers msg to every session subscribed to its topic.
+func (b *Broker) route(msg Message) {
+	b.mu.Lock()
+	if msg.Retained {
+		if msg.Payload == "" {
+			delete(b.retained, msg.Topic)
+		} else {
+			b.retained[msg.Topic] = msg.Payload
+		}
+	}
+	var targets []*session
+	for s := range b.sessions {
+		for f := range s.filters {
+			if mqtt.Match(f, msg.Topic) {
+				targets = append(targets, s)
+				break
+			}
+		}
+	}
+	b.mu.Unlock()
+	for _, s := range targets {
+		s.publish(msg.Topic, msg.Payload, false)
+	}
+}
+
+func (b *Broker) sendRetained(s *session, filters []string) {
+	b.mu.Lock()
+	var topics, payloads []string
+	for topic, payload := range b.retained {
+		for _, f := range filters {
+			if mqtt.Match(f, topic) {
+				topics = append(topics, topic)
+				payloads = append(payloads, payload)
+				break
+			}
+		}
+	}
+	b.mu.Unlock()
+	for i := range topics {
+		s.publish(topics[i], payloads[i], true)
+	}
+}
+
+// publish sends a message to the session at QoS 0.
+func (s *session) publish(topic, payload string, retained bool) {
+	var header byte = 0x30
+	if retained {
+		header |= 0x01
+	}
+	s.write(header, append(appendString(nil, topic), payload...))
+}
+
+func (s *session) write(header byte, body []byte) {
+	packet := []byte{header}
+	n := len(body)
+	for {
+		c := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			c |= 0x80
+		}
+		packet = append(packet, c)
+		if n == 0 {
+			break
+		}
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.conn.Write(append(packet, body...))
+}
+
+func readPacket(r *bufio.Reader) (typ, flags byte, body []byte, err error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	length, multiplier := 0, 1
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		length += int(c&0x7F) * multiplier
+		multiplier *= 128
+		if c&0x80 == 0 {
+			break
+		}
+	}
+	body = make([]byte, length)
+	_, err = io.ReadFull(r, body)
+	return first >> 4, first & 0x0F, body, err
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+func readString(b []byte) (string, []byte) {
+	n := int(binary.BigEndian.Uint16(b))
+	return string(b[2 : 2+n]), b[2+n:]
+}
@@ -0,0 +1,155 @@
+package mqtt
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Control packet types, the high nibble of a packet's first byte.
+const (
+	packetConnect     byte = 1
+	packetConnack     byte = 2
+	packetPublish     byte = 3
+	packetPuback      byte = 4
+	packetPubrec      byte = 5
+	packetPubrel      byte = 6
+	packetPubcomp     byte = 7
+	packetSubscribe   byte = 8
+	packetSuback      byte = 9
+	packetUnsubscribe byte = 10
+	packetUnsuback    byte = 11
+	packetPingreq     byte = 12
+	packetPingresp    byte = 13
+	packetDisconnect  byte = 14
+)
+
+// readPacket reads one control packet: its type, flags and body.
+func readPacket(r *bufio.Reader) (typ, flags byte, body []byte, err error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return 0, 0, nil, errors.New("malformed mqtt packet length")
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		length += int(b&0x7F) * multiplier
+		multiplier *= 128
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	if length > maxPacket {
+		return 0, 0, nil, fmt.Errorf("mqtt packet of %d bytes is too large", length)
+	}
+	body = make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, 0, nil, err
+	}
+	return first >> 4, first & 0x0F, body, nil
+}
+
+// encodeLength encodes a packet's remaining length.
+func encodeLength(n int) []byte {
+	var out []byte
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		out = append(out, b)
+		if n == 0 {
+			return out
+		}
+	}
+}
+
+// appendString appends s with its two-byte length.
+func appendString(b []byte, s string) []byte {
+	b = append(b, byte(len(s)>>8), byte(len(s)))
+	return append(b, s...)
+}
+
+// readString reads a length-prefixed string from the front of b.
+func readString(b []byte) (string, []byte, bool) {
+	if len(b) < 2 {
+		return "", nil, false
+	}
+	n := int(b[0])<<8 | int(b[1])
+	if len(b) < 2+n {
+		return "", nil, false
+	}
+	return string(b[2 : 2+n]), b[2+n:], true
+}
+
+// ValidTopic reports whether topic can be published to.
+func ValidTopic(topic string) error {
+	if err := validName(topic); err != nil {
+		return err
+	}
+	if strings.ContainsAny(topic, "+#") {
+		return fmt.Errorf("mqtt topic %q cannot contain wildcards", topic)
+	}
+	return nil
+}
+
+// ValidFilter reports whether filter can be subscribed to: "+" stands
+// for one whole level, and "#" for any levels at the end.
+func ValidFilter(filter string) error {
+	if err := validName(filter); err != nil {
+		return err
+	}
+	levels := strings.Split(filter, "/")
+	for i, level := range levels {
+		if strings.Contains(level, "#") && (level != "#" || i != len(levels)-1) {
+			return fmt.Errorf("mqtt filter %q: # must be the whole last level", filter)
+		}
+		if strings.Contains(level, "+") && level != "+" {
+			return fmt.Errorf("mqtt filter %q: + must be a whole level", filter)
+		}
+	}
+	return nil
+}
+
+func validName(name string) error {
+	switch {
+	case name == "":
+		return errors.New("mqtt topic is empty")
+	case len(name) > 0xFFFF:
+		return errors.New("mqtt topic is too long")
+	case strings.ContainsRune(name, 0):
+		return errors.New("mqtt topic contains a NUL character")
+	}
+	return nil
+}
+
+// Match reports whether topic matches filter. As brokers do, wildcards
+// at the start of a filter don't match topics beginning with "$".
+func Match(filter, topic string) bool {
+	if strings.HasPrefix(topic, "$") && (strings.HasPrefix(filter, "+") || strings.HasPrefix(filter, "#")) {
+		return false
+	}
+	fl := strings.Split(filter, "/")
+	tl := strings.Split(topic, "/")
+	for i, f := range fl {
+		if f == "#" {
+			return true
+		}
+		if i >= len(tl) {
+			return false
+		}
+		if f != "+" && f != tl[i] {
+			return false
+		}
+	}
+	return len(fl) == len(tl)
+}
@@ -0,0 +1,151 @@
+// Package notify alerts the user outside of chats: on the desktop
+// picoclaw runs on (notify-send, osascript or a Windows toast), and
+// through push services that reach their phone (ntfy, Pushover, Gotify).
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// sendTimeout bounds one delivery.
+const sendTimeout = 15 * time.Second
+
+// DefaultTitle is used for notifications without one.
+const DefaultTitle = "picoclaw"
+
+// Priority is how insistent a notification is.
+type Priority string
+
+const (
+	PriorityLow    Priority = "low"
+	PriorityNormal Priority = "normal"
+	PriorityHigh   Priority = "high"
+	PriorityUrgent Priority = "urgent" // bypasses do-not-disturb where the service allows
+)
+
+// ParsePriority reads a priority name; empty is normal.
+func ParsePriority(s string) (Priority, error) {
+	switch p := Priority(strings.ToLower(strings.TrimSpace(s))); p {
+	case "":
+		return PriorityNormal, nil
+	case PriorityLow, PriorityNormal, PriorityHigh, PriorityUrgent:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown priority %q: use low, normal, high or urgent", s)
+}
+
+// PriorityFor is the priority of a proactive message of urgency u.
+func PriorityFor(u bus.Urgency) Priority {
+	switch u {
+	case bus.UrgencyLow:
+		return PriorityLow
+	case bus.UrgencyHigh:
+		return PriorityHigh
+	case bus.UrgencyCritical:
+		return PriorityUrgent
+	}
+	return PriorityNormal
+}
+
+// Notification is one alert.
+type Notification struct {
+	Title    string
+	Message  string
+	Priority Priority
+	URL      string // opened when the notification is tapped, where supported
+}
+
+// Target is somewhere notifications can be sent.
+type Target interface {
+	Name() string
+	Send(ctx context.Context, n Notification) error
+}
+
+// Notifier sends notifications to the configured targets.
+type Notifier struct {
+	targets []Target
+}
+
+// New creates a notifier for the targets configured in cfg.
+func New(cfg config.NotifyConfig) *Notifier {
+	client := &http.Client{Timeout: sendTimeout}
+	n := &Notifier{}
+	if cfg.Desktop {
+		n.targets = append(n.targets, newDesktop())
+	}
+	if cfg.Ntfy.Topic != "" {
+		n.targets = append(n.targets, &ntfy{server: cfg.Ntfy.Server, topic: cfg.Ntfy.Topic, token: cfg.Ntfy.Token, client: client})
+	}
+	if cfg.Pushover.AppToken != "" && cfg.Pushover.UserKey != "" {
+		n.targets = append(n.targets, &pushover{api: pushoverAPI, token: cfg.Pushover.AppToken, user: cfg.Pushover.UserKey, client: client})
+	}
+	if cfg.Gotify.URL != "" && cfg.Gotify.Token != "" {
+		n.targets = append(n.targets, &gotify{url: cfg.Gotify.URL, token: cfg.Gotify.Token, client: client})
+	}
+	return n
+}
+
+// NewWithTargets creates a notifier for the given targets.
+func NewWithTargets(targets ...Target) *Notifier {
+	return &Notifier{targets: targets}
+}
+
+// Targets names the configured targets.
+func (n *Notifier) Targets() []string {
+	names := make([]string, len(n.targets))
+	for i, t := range n.targets {
+		names[i] = t.Name()
+	}
+	return names
+}
+
+// Send delivers note to every target, or only to those named in only. It
+// returns the targets that took it; err describes those that failed.
+func (n *Notifier) Send(ctx context.Context, note Notification, only ...string) (sent []string, err error) {
+	if note.Title == "" {
+		note.Title = DefaultTitle
+	}
+	if note.Priority == "" {
+		note.Priority = PriorityNormal
+	}
+	var errs []error
+	matched := false
+	for _, t := range n.targets {
+		if len(only) > 0 && !contains(only, t.Name()) {
+			continue
+		}
+		matched = true
+		ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+		err := t.Send(ctx, note)
+		cancel()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", t.Name(), err))
+			continue
+		}
+		sent = append(sent, t.Name())
+	}
+	if !matched {
+		if len(only) > 0 {
+			return nil, fmt.Errorf("no such notification target %s; configured: %s", strings.Join(only, ", "), strings.Join(n.Targets(), ", "))
+		}
+		return nil, errors.New("no notification targets are configured")
+	}
+	return sent, errors.Join(errs...)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,175 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// recordingServer answers every request with reply and keeps the last one.
+func recordingServer(t *testing.T, status int, reply string) (*httptest.Server, *http.Request, *string) {
+	t.Helper()
+	last := &http.Request{}
+	body := new(string)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		*last = *r.Clone(context.Background())
+		*body = string(data)
+		w.WriteHeader(status)
+		w.Write([]byte(reply))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, last, body
+}
+
+// TestNtfy verifies the JSON published to an ntfy server
+func TestNtfy(t *testing.T) {
+	srv, req, body := recordingServer(t, http.StatusOK, "{}")
+	n := New(config.NotifyConfig{Ntfy: config.NtfyConfig{Server: srv.URL + "/", Topic: "alerts", Token: "tk"}})
+	sent, err := n.Send(context.Background(), Notification{Message: "Backup done", Priority: PriorityUrgent, URL: "https://example.com"})
+	if err != nil || len(sent) != 1 || sent[0] != "ntfy" {
+		t.Fatalf("Expected the notification sent via ntfy, got %v %v", sent, err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal([]byte(*body), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["topic"] != "alerts" || got["title"] != DefaultTitle || got["message"] != "Backup done" ||
+		got["priority"] != float64(5) || got["click"] != "https://example.com" {
+		t.Errorf("Unexpected ntfy message %v", got)
+	}
+	if auth := req.Header.Get("Authorization"); auth != "Bearer tk" {
+		t.Errorf("Expected the token sent, got %q", auth)
+	}
+}
+
+// TestPushover verifies the form sent to Pushover and its error reporting
+func TestPushover(t *testing.T) {
+	srv, _, body := recordingServer(t, http.StatusOK, `{"status":1}`)
+	p := &pushover{api: srv.URL, token: "app", user: "me", client: http.DefaultClient}
+	if err := p.Send(context.Background(), Notification{Title: "T", Message: "M", Priority: PriorityLow}); err != nil {
+		t.Fatal(err)
+	}
+	form, _ := url.ParseQuery(*body)
+	if form.Get("token") != "app" || form.Get("user") != "me" || form.Get("title") != "T" || form.Get("message") != "M" || form.Get("priority") != "-1" {
+		t.Errorf("Unexpected Pushover form %v", form)
+	}
+
+	srv, _, _ = recordingServer(t, http.StatusBadRequest, `{"status":0,"errors":["user identifier is invalid"]}`)
+	p.api = srv.URL
+	if err := p.Send(context.Background(), Notification{Message: "M"}); err == nil || err.Error() != "user identifier is invalid" {
+		t.Errorf("Expected Pushover's error, got %v", err)
+	}
+}
+
+// TestGotify verifies the message posted to Gotify
+func TestGotify(t *testing.T) {
+	srv, req, body := recordingServer(t, http.StatusOK, "{}")
+	n := New(config.NotifyConfig{Gotify: config.GotifyConfig{URL: srv.URL, Token: "key"}})
+	if _, err := n.Send(context.Background(), Notification{Message: "Disk full", Priority: PriorityHigh}); err != nil {
+		t.Fatal(err)
+	}
+	if req.URL.Path != "/message" || req.Header.Get("X-Gotify-Key") != "key" {
+		t.Errorf("Unexpected Gotify request %s %v", req.URL.Path, req.Header)
+	}
+	if !strings.Contains(*body, `"priority":7`) {
+		t.Errorf("Expected high priority, got %s", *body)
+	}
+
+	srv, _, _ = recordingServer(t, http.StatusUnauthorized, "bad token")
+	n = New(config.NotifyConfig{Gotify: config.GotifyConfig{URL: srv.URL, Token: "key"}})
+	if sent, err := n.Send(context.Background(), Notification{Message: "M"}); len(sent) != 0 || err == nil ||
+		err.Error() != "gotify: HTTP 401: bad token" {
+		t.Errorf("Expected the HTTP error, got %v %v", sent, err)
+	}
+}
+
+// TestDesktopCommands verifies the command run on each desktop, and that
+// the text never becomes part of the PowerShell script
+func TestDesktopCommands(t *testing.T) {
+	message := "it’s done’); Remove-Item -Recurse ~; (’"
+	cases := []struct {
+		goos string
+		want string
+		env  []string
+	}{
+		{"linux", `notify-send --app-name=picoclaw --urgency=critical -- Build "done" ` + message, nil},
+		{"darwin", `osascript -e display notification "` + message + `" with title "Build \"done\"" sound name "default"`, nil},
+		{"windows", "powershell -NoProfile -NonInteractive -Command " + toastScript,
+			[]string{`PICOCLAW_TOAST_TITLE=Build "done"`, "PICOCLAW_TOAST_MESSAGE=" + message}},
+	}
+	for _, c := range cases {
+		var got string
+		var gotEnv []string
+		d := &desktop{goos: c.goos, run: func(ctx context.Context, env []string, name string, args ...string) error {
+			got, gotEnv = strings.Join(append([]string{name}, args...), " "), env
+			return nil
+		}}
+		if err := d.Send(context.Background(), Notification{Title: `Build "done"`, Message: message, Priority: PriorityUrgent}); err != nil {
+			t.Fatal(err)
+		}
+		if got != c.want || strings.Join(gotEnv, "\n") != strings.Join(c.env, "\n") {
+			t.Errorf("%s: expected %q %q, got %q %q", c.goos, c.want, c.env, got, gotEnv)
+		}
+	}
+}
+
+type fakeTarget struct {
+	name  string
+	err   error
+	notes []Notification
+}
+
+func (f *fakeTarget) Name() string { return f.name }
+
+func (f *fakeTarget) Send(ctx context.Context, n Notification) error {
+	f.notes = append(f.notes, n)
+	return f.err
+}
+
+// TestNotifierSend verifies target selection, defaults and partial failure
+func TestNotifierSend(t *testing.T) {
+	phone := &fakeTarget{name: "ntfy"}
+	broken := &fakeTarget{name: "gotify", err: errors.New("offline")}
+	n := NewWithTargets(phone, broken)
+	ctx := context.Background()
+
+	sent, err := n.Send(ctx, Notification{Message: "hi"})
+	if len(sent) != 1 || sent[0] != "ntfy" || err == nil || err.Error() != "gotify: offline" {
+		t.Errorf("Expected ntfy to succeed and gotify to fail, got %v %v", sent, err)
+	}
+	if note := phone.notes[0]; note.Title != DefaultTitle || note.Priority != PriorityNormal {
+		t.Errorf("Expected the default title and priority, got %+v", note)
+	}
+
+	if sent, err := n.Send(ctx, Notification{Message: "hi"}, "NTFY"); len(sent) != 1 || err != nil || len(broken.notes) != 1 {
+		t.Errorf("Expected only ntfy used, got %v %v", sent, err)
+	}
+	if _, err := n.Send(ctx, Notification{Message: "hi"}, "desktop"); err == nil || !strings.Contains(err.Error(), "configured: ntfy, gotify") {
+		t.Errorf("Expected an unknown target refused, got %v", err)
+	}
+	if _, err := NewWithTargets().Send(ctx, Notification{Message: "hi"}); err == nil {
+		t.Error("Expected an error without targets")
+	}
+}
+
+// TestParsePriority verifies priority names
+func TestParsePriority(t *testing.T) {
+	if p, err := ParsePriority(" High "); p != PriorityHigh || err != nil {
+		t.Errorf("Expected high, got %q %v", p, err)
+	}
+	if p, err := ParsePriority(""); p != PriorityNormal || err != nil {
+		t.Errorf("Expected normal, got %q %v", p, err)
+	}
+	if _, err := ParsePriority("max"); err == nil {
+		t.Error("Expected an unknown priority refused")
+	}
+}
@@ -0,0 +1,210 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const (
+	defaultNtfyServer = "https://ntfy.sh"
+	pushoverAPI       = "https://api.pushover.net/1/messages.json"
+	// maxPushMessage fits every service's limit (Pushover's 1024 is the
+	// smallest); longer messages are cut.
+	maxPushMessage = 1024
+	maxPushTitle   = 250
+)
+
+// desktop shows notifications on the machine picoclaw runs on.
+type desktop struct {
+	goos string
+	// run runs a command with env added to picoclaw's environment.
+	run func(ctx context.Context, env []string, name string, args ...string) error
+}
+
+func newDesktop() *desktop {
+	return &desktop{
+		goos: runtime.GOOS,
+		run: func(ctx context.Context, env []string, name string, args ...string) error {
+			cmd := exec.CommandContext(ctx, name, args...)
+			cmd.Env = append(os.Environ(), env...)
+			out, err := cmd.CombinedOutput()
+			if err != nil && len(bytes.TrimSpace(out)) > 0 {
+				return fmt.Errorf("%s: %v: %s", name, err, bytes.TrimSpace(out))
+			}
+			return err
+		},
+	}
+}
+
+func (d *desktop) Name() string { return "desktop" }
+
+func (d *desktop) Send(ctx context.Context, n Notification) error {
+	switch d.goos {
+	case "darwin":
+		script := fmt.Sprintf("display notification %s with title %s", appleScriptString(n.Message), appleScriptString(n.Title))
+		if n.Priority == PriorityHigh || n.Priority == PriorityUrgent {
+			script += ` sound name "default"`
+		}
+		return d.run(ctx, nil, "osascript", "-e", script)
+	case "windows":
+		// The text goes in the environment: PowerShell strings end at
+		// typographic quotes too, so quoting it in the script is fragile
+		env := []string{"PICOCLAW_TOAST_TITLE=" + n.Title, "PICOCLAW_TOAST_MESSAGE=" + n.Message}
+		return d.run(ctx, env, "powershell", "-NoProfile", "-NonInteractive", "-Command", toastScript)
+	}
+	urgency := map[Priority]string{PriorityLow: "low", PriorityNormal: "normal", PriorityHigh: "normal", PriorityUrgent: "critical"}[n.Priority]
+	return d.run(ctx, nil, "notify-send", "--app-name=picoclaw", "--urgency="+urgency, "--", n.Title, n.Message)
+}
+
+// appleScriptString quotes s for AppleScript.
+func appleScriptString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// toastScript is PowerShell that shows a Windows toast notification with
+// the title and message from the environment.
+const toastScript = "[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null; " +
+	"$t = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02); " +
+	"$x = $t.GetElementsByTagName('text'); " +
+	"$x.Item(0).AppendChild($t.CreateTextNode($env:PICOCLAW_TOAST_TITLE)) > $null; " +
+	"$x.Item(1).AppendChild($t.CreateTextNode($env:PICOCLAW_TOAST_MESSAGE)) > $null; " +
+	"[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('picoclaw').Show([Windows.UI.Notifications.ToastNotification]::new($t))"
+
+// ntfy publishes to a topic on ntfy.sh or a self-hosted ntfy server.
+type ntfy struct {
+	server string
+	topic  string
+	token  string
+	client *http.Client
+}
+
+func (t *ntfy) Name() string { return "ntfy" }
+
+func (t *ntfy) Send(ctx context.Context, n Notification) error {
+	server := strings.TrimRight(t.server, "/")
+	if server == "" {
+		server = defaultNtfyServer
+	}
+	body := map[string]interface{}{
+		"topic":    t.topic,
+		"title":    utils.Truncate(n.Title, maxPushTitle),
+		"message":  utils.Truncate(n.Message, maxPushMessage),
+		"priority": map[Priority]int{PriorityLow: 2, PriorityNormal: 3, PriorityHigh: 4, PriorityUrgent: 5}[n.Priority],
+	}
+	if n.URL != "" {
+		body["click"] = n.URL
+	}
+	headers := map[string]string{"Content-Type": "application/json"}
+	if t.token != "" {
+		headers["Authorization"] = "Bearer " + t.token
+	}
+	return postJSON(ctx, t.client, server, headers, body)
+}
+
+// pushover sends through the Pushover API.
+type pushover struct {
+	api    string
+	token  string
+	user   string
+	client *http.Client
+}
+
+func (t *pushover) Name() string { return "pushover" }
+
+func (t *pushover) Send(ctx context.Context, n Notification) error {
+	form := url.Values{
+		"token":   {t.token},
+		"user":    {t.user},
+		"title":   {utils.Truncate(n.Title, maxPushTitle)},
+		"message": {utils.Truncate(n.Message, maxPushMessage)},
+		// Pushover's emergency priority repeats until acknowledged, which
+		// is more than an agent should ask for; urgent is high priority
+		"priority": {map[Priority]string{PriorityLow: "-1", PriorityNormal: "0", PriorityHigh: "1", PriorityUrgent: "1"}[n.Priority]},
+	}
+	if n.URL != "" {
+		form.Set("url", n.URL)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.api, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Status int      `json:"status"`
+		Errors []string `json:"errors"`
+	}
+	json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&result)
+	if result.Status != 1 {
+		if len(result.Errors) > 0 {
+			return errors.New(strings.Join(result.Errors, "; "))
+		}
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// gotify sends to a self-hosted Gotify server with an application token.
+type gotify struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func (t *gotify) Name() string { return "gotify" }
+
+func (t *gotify) Send(ctx context.Context, n Notification) error {
+	body := map[string]interface{}{
+		"title":    n.Title,
+		"message":  n.Message,
+		"priority": map[Priority]int{PriorityLow: 2, PriorityNormal: 5, PriorityHigh: 7, PriorityUrgent: 10}[n.Priority],
+	}
+	if n.URL != "" {
+		body["extras"] = map[string]interface{}{
+			"client::notification": map[string]interface{}{"click": map[string]string{"url": n.URL}},
+		}
+	}
+	headers := map[string]string{"Content-Type": "application/json", "X-Gotify-Key": t.token}
+	return postJSON(ctx, t.client, strings.TrimRight(t.url, "/")+"/message", headers, body)
+}
+
+// postJSON posts body and reports a non-2xx answer as an error.
+func postJSON(ctx context.Context, client *http.Client, endpoint string, headers map[string]string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
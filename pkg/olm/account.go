@@ -0,0 +1,149 @@
+package olm
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+)
+
+// maxOneTimeKeys is how many one-time keys an account keeps; generating
+// more drops the oldest, as libolm does.
+const maxOneTimeKeys = 100
+
+// Account holds a device's identity keys and its one-time keys.
+type Account struct {
+	IdentityKey KeyPair            `json:"identity_key"` // Curve25519
+	SigningKey  ed25519.PrivateKey `json:"signing_key"`
+	OneTimeKeys []OneTimeKey       `json:"one_time_keys"`
+	NextKeyID   uint32             `json:"next_key_id"`
+}
+
+// OneTimeKey is a Curve25519 key another device may claim once to start an
+// Olm session with this one.
+type OneTimeKey struct {
+	ID        uint32  `json:"id"`
+	Key       KeyPair `json:"key"`
+	Published bool    `json:"published"`
+}
+
+// NewAccount creates an account with new identity keys.
+func NewAccount() (*Account, error) {
+	identity, err := newKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	_, signing, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &Account{IdentityKey: identity, SigningKey: signing, NextKeyID: 1}, nil
+}
+
+// IdentityKeys returns the device's Curve25519 and Ed25519 public keys.
+func (a *Account) IdentityKeys() (curve25519, ed25519Key string) {
+	return Encode(a.IdentityKey.Public), Encode(a.SigningKey.Public().(ed25519.PublicKey))
+}
+
+// Sign signs message with the account's Ed25519 key.
+func (a *Account) Sign(message []byte) string {
+	return Encode(ed25519.Sign(a.SigningKey, message))
+}
+
+// GenerateOneTimeKeys adds n unpublished one-time keys.
+func (a *Account) GenerateOneTimeKeys(n int) error {
+	for i := 0; i < n; i++ {
+		key, err := newKeyPair()
+		if err != nil {
+			return err
+		}
+		a.OneTimeKeys = append(a.OneTimeKeys, OneTimeKey{ID: a.NextKeyID, Key: key})
+		a.NextKeyID++
+	}
+	if extra := len(a.OneTimeKeys) - maxOneTimeKeys; extra > 0 {
+		a.OneTimeKeys = a.OneTimeKeys[extra:]
+	}
+	return nil
+}
+
+// UnpublishedOneTimeKeys returns the keys not yet uploaded, as key ID ->
+// public key.
+func (a *Account) UnpublishedOneTimeKeys() map[string]string {
+	keys := make(map[string]string)
+	for _, k := range a.OneTimeKeys {
+		if !k.Published {
+			keys[keyID(k.ID)] = Encode(k.Key.Public)
+		}
+	}
+	return keys
+}
+
+// MarkKeysAsPublished records that every one-time key has been uploaded.
+func (a *Account) MarkKeysAsPublished() {
+	for i := range a.OneTimeKeys {
+		a.OneTimeKeys[i].Published = true
+	}
+}
+
+// MaxOneTimeKeys is how many one-time keys the account can hold.
+func (a *Account) MaxOneTimeKeys() int {
+	return maxOneTimeKeys
+}
+
+// keyID is a one-time key's ID as uploaded: its number, big-endian, in
+// base64.
+func keyID(id uint32) string {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], id)
+	return Encode(b[:])
+}
+
+// NewInboundSession starts a session from a pre-key message another device
+// sent to this one, and removes the one-time key it used.
+func (a *Account) NewInboundSession(message []byte) (*Session, error) {
+	pre, err := parsePreKeyMessage(message)
+	if err != nil {
+		return nil, err
+	}
+	idx := -1
+	for i, k := range a.OneTimeKeys {
+		if string(k.Key.Public) == string(pre.oneTimeKey) {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return nil, fmt.Errorf("olm: pre-key message uses an unknown one-time key")
+	}
+	otk := a.OneTimeKeys[idx].Key
+
+	var secret []byte
+	for _, pair := range [][2][]byte{
+		{otk.Private, pre.identityKey},
+		{a.IdentityKey.Private, pre.baseKey},
+		{otk.Private, pre.baseKey},
+	} {
+		s, err := sharedSecret(pair[0], pair[1])
+		if err != nil {
+			return nil, err
+		}
+		secret = append(secret, s...)
+	}
+	inner, err := parseMessage(pre.message)
+	if err != nil {
+		return nil, err
+	}
+	derived := hkdfSHA256(secret, nil, rootInfo, 64)
+	s := &Session{
+		RootKey: derived[:32],
+		ReceiverChains: []ReceiverChain{{
+			RatchetKey: inner.ratchetKey,
+			ChainKey:   derived[32:],
+		}},
+		TheirIdentityKey: pre.identityKey,
+		BaseKey:          pre.baseKey,
+		OneTimeKey:       pre.oneTimeKey,
+	}
+	a.OneTimeKeys = append(a.OneTimeKeys[:idx], a.OneTimeKeys[idx+1:]...)
+	return s, nil
+}
@@ -0,0 +1,202 @@
+package olm
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"os/exec"
+	"testing"
+)
+
+func unhex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// TestPublishedVectors checks the primitives the ratchets are built on
+// against the test vectors published with them: X25519 from RFC 7748 6.1,
+// HKDF-SHA256 from RFC 5869 A.1 and Ed25519 from RFC 8032 7.1.
+func TestPublishedVectors(t *testing.T) {
+	secret, err := sharedSecret(
+		unhex(t, "77076d0a7318a57d3c16c17251b26645df4c2f87ebc0992ab177fba51db92c2a"),
+		unhex(t, "de9edb7d7b7dc1b4d35b61c2ece435373f8343c85b78674dadfc7e146f882b4f"))
+	if err != nil || hex.EncodeToString(secret) != "4a5d9d5ba4ce2de1728e3bf480350f25e07e21c947d19e3376f09b3c1e161742" {
+		t.Errorf("X25519: got %x %v", secret, err)
+	}
+
+	okm := hkdfSHA256(bytes.Repeat([]byte{0x0b}, 22), unhex(t, "000102030405060708090a0b0c"), string(unhex(t, "f0f1f2f3f4f5f6f7f8f9")), 42)
+	if hex.EncodeToString(okm) != "3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf34007208d5b887185865" {
+		t.Errorf("HKDF: got %x", okm)
+	}
+
+	account := &Account{SigningKey: ed25519.NewKeyFromSeed(unhex(t, "9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60"))}
+	sig, _ := Decode(account.Sign(nil))
+	if hex.EncodeToString(sig) != "e5564300c360ac729086e2cc806e828a84877f1eb8e5d974d873e065224901555fb8821590a33bacc61e39701cf9b46bd25bf5f0595bbe24655141438e7a100b" {
+		t.Errorf("Ed25519: got %x", sig)
+	}
+}
+
+// libolmPeer drives libolm through its Python bindings, one JSON request
+// per line, keeping Olm sessions by name.
+const libolmPeer = `
+import json, sys
+import olm
+
+account = olm.Account()
+sessions = {}
+group = None
+for line in sys.stdin:
+    req = json.loads(line)
+    op = req["op"]
+    try:
+        if op == "keys":
+            account.generate_one_time_keys(1)
+            otk = list(account.one_time_keys["curve25519"].values())[0]
+            account.mark_keys_as_published()
+            resp = {"identity_key": account.identity_keys["curve25519"], "one_time_key": otk}
+        elif op == "outbound":
+            sessions[req["session"]] = olm.OutboundSession(account, req["identity_key"], req["one_time_key"])
+            resp = {}
+        elif op == "inbound":
+            session = olm.InboundSession(account, olm.OlmPreKeyMessage(req["body"]))
+            sessions[req["session"]] = session
+            resp = {"text": session.decrypt(olm.OlmPreKeyMessage(req["body"]))}
+        elif op == "encrypt":
+            msg = sessions[req["session"]].encrypt(req["text"])
+            resp = {"type": msg.message_type, "body": msg.ciphertext}
+        elif op == "decrypt":
+            cls = olm.OlmPreKeyMessage if req["type"] == 0 else olm.OlmMessage
+            resp = {"text": sessions[req["session"]].decrypt(cls(req["body"]))}
+        elif op == "group_decrypt":
+            text, index = olm.InboundGroupSession(req["session_key"]).decrypt(req["message"])
+            resp = {"text": text, "index": index}
+        elif op == "group_encrypt":
+            group = group or olm.OutboundGroupSession()
+            key = group.session_key
+            resp = {"session_key": key, "message": group.encrypt(req["text"])}
+    except Exception as e:
+        resp = {"error": repr(e)}
+    print(json.dumps(resp), flush=True)
+`
+
+// peerReply is any answer from libolmPeer.
+type peerReply struct {
+	Error       string `json:"error"`
+	IdentityKey string `json:"identity_key"`
+	OneTimeKey  string `json:"one_time_key"`
+	Type        int    `json:"type"`
+	Body        string `json:"body"`
+	Text        string `json:"text"`
+	Index       uint32 `json:"index"`
+	SessionKey  string `json:"session_key"`
+	Message     string `json:"message"`
+}
+
+// TestLibolmInterop exchanges pre-key, normal and Megolm messages with
+// libolm in both directions. It needs python3 with the olm bindings
+// (pip install python-olm) and is skipped without them.
+func TestLibolmInterop(t *testing.T) {
+	if err := exec.Command("python3", "-c", "import olm").Run(); err != nil {
+		t.Skip("python3 with the olm bindings is not installed")
+	}
+	cmd := exec.Command("python3", "-c", libolmPeer)
+	stdin, _ := cmd.StdinPipe()
+	stdout, _ := cmd.StdoutPipe()
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		stdin.Close()
+		cmd.Wait()
+	}()
+	replies := bufio.NewScanner(stdout)
+	peer := func(req map[string]interface{}) peerReply {
+		t.Helper()
+		line, _ := json.Marshal(req)
+		stdin.Write(append(line, '\n'))
+		if !replies.Scan() {
+			t.Fatalf("libolm peer exited: %v", replies.Err())
+		}
+		var reply peerReply
+		if err := json.Unmarshal(replies.Bytes(), &reply); err != nil || reply.Error != "" {
+			t.Fatalf("libolm peer failed on %s: %s %v", req["op"], reply.Error, err)
+		}
+		return reply
+	}
+	decode := func(s string) []byte {
+		t.Helper()
+		b, err := Decode(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	// libolm starts a session with us
+	account, err := NewAccount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	account.GenerateOneTimeKeys(1)
+	curve, _ := account.IdentityKeys()
+	var otk string
+	for _, key := range account.UnpublishedOneTimeKeys() {
+		otk = key
+	}
+	peer(map[string]interface{}{"op": "outbound", "session": "theirs", "identity_key": curve, "one_time_key": otk})
+	pre := peer(map[string]interface{}{"op": "encrypt", "session": "theirs", "text": "pre-key from libolm"})
+	if pre.Type != MessageTypePreKey {
+		t.Fatalf("Expected a pre-key message, got type %d", pre.Type)
+	}
+	inbound, err := account.NewInboundSession(decode(pre.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text, err := inbound.Decrypt(pre.Type, decode(pre.Body)); err != nil || string(text) != "pre-key from libolm" {
+		t.Fatalf("Pre-key message from libolm: got %q %v", text, err)
+	}
+	msgType, body, _ := inbound.Encrypt([]byte("normal from picoclaw"))
+	if reply := peer(map[string]interface{}{"op": "decrypt", "session": "theirs", "type": msgType, "body": Encode(body)}); reply.Text != "normal from picoclaw" {
+		t.Errorf("libolm read our normal message as %q", reply.Text)
+	}
+	normal := peer(map[string]interface{}{"op": "encrypt", "session": "theirs", "text": "normal from libolm"})
+	if text, err := inbound.Decrypt(normal.Type, decode(normal.Body)); normal.Type != MessageTypeNormal || err != nil || string(text) != "normal from libolm" {
+		t.Errorf("Normal message from libolm (type %d): got %q %v", normal.Type, text, err)
+	}
+
+	// We start a session with libolm
+	keys := peer(map[string]interface{}{"op": "keys"})
+	outbound, err := NewOutboundSession(account, keys.IdentityKey, keys.OneTimeKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgType, body, _ = outbound.Encrypt([]byte("pre-key from picoclaw"))
+	if reply := peer(map[string]interface{}{"op": "inbound", "session": "ours", "body": Encode(body)}); msgType != MessageTypePreKey || reply.Text != "pre-key from picoclaw" {
+		t.Errorf("libolm read our pre-key message (type %d) as %q", msgType, reply.Text)
+	}
+
+	// Megolm both ways
+	group, err := NewOutboundGroupSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionKey := group.SessionKey()
+	message := group.Encrypt([]byte("megolm from picoclaw"))
+	if reply := peer(map[string]interface{}{"op": "group_decrypt", "session_key": sessionKey, "message": Encode(message)}); reply.Text != "megolm from picoclaw" || reply.Index != 0 {
+		t.Errorf("libolm read our Megolm message as %q at index %d", reply.Text, reply.Index)
+	}
+	theirs := peer(map[string]interface{}{"op": "group_encrypt", "text": "megolm from libolm"})
+	groupIn, err := NewInboundGroupSession(theirs.SessionKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text, index, err := groupIn.Decrypt(decode(theirs.Message)); err != nil || string(text) != "megolm from libolm" || index != 0 {
+		t.Errorf("Megolm message from libolm: got %q at %d, %v", text, index, err)
+	}
+}
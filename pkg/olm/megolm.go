@@ -0,0 +1,224 @@
+package olm
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// megolmParts is the number of 32-byte parts of the Megolm ratchet.
+const megolmParts = 4
+
+// megolmSessionKeyVersion is the version byte of a shared session key.
+const megolmSessionKeyVersion = 2
+
+// megolmRatchet is the ratchet state R(0)..R(3) at index Counter.
+type megolmRatchet struct {
+	Data    []byte `json:"data"` // 4 x 32 bytes
+	Counter uint32 `json:"counter"`
+}
+
+// rehash sets R(to) = HMAC(R(from), to).
+func (r *megolmRatchet) rehash(from, to int) {
+	sum := hmacSHA256(r.Data[from*32:from*32+32], []byte{byte(to)})
+	copy(r.Data[to*32:to*32+32], sum)
+}
+
+// advance moves the ratchet on by one.
+func (r *megolmRatchet) advance() {
+	mask := uint32(0x00FFFFFF)
+	r.Counter++
+	h := 0
+	for h < megolmParts {
+		if r.Counter&mask == 0 {
+			break
+		}
+		h++
+		mask >>= 8
+	}
+	for i := megolmParts - 1; i >= h; i-- {
+		r.rehash(h, i)
+	}
+}
+
+// advanceTo moves the ratchet forward to index, taking at most 4 x 256
+// steps however far it is.
+func (r *megolmRatchet) advanceTo(index uint32) {
+	for j := 0; j < megolmParts; j++ {
+		shift := uint((megolmParts - j - 1) * 8)
+		mask := ^uint32(0) << shift
+		steps := ((index >> shift) - (r.Counter >> shift)) & 0xff
+		if steps == 0 {
+			if index < r.Counter {
+				steps = 0x100
+			} else {
+				continue
+			}
+		}
+		for ; steps > 1; steps-- {
+			r.rehash(j, j)
+		}
+		for k := megolmParts - 1; k >= j; k-- {
+			r.rehash(j, k)
+		}
+		r.Counter = index & mask
+	}
+}
+
+func (r megolmRatchet) clone() megolmRatchet {
+	return megolmRatchet{Data: append([]byte{}, r.Data...), Counter: r.Counter}
+}
+
+// OutboundGroupSession encrypts the messages this device sends to a room.
+type OutboundGroupSession struct {
+	Ratchet    megolmRatchet      `json:"ratchet"`
+	SigningKey ed25519.PrivateKey `json:"signing_key"`
+	Created    time.Time          `json:"created"`
+}
+
+// NewOutboundGroupSession creates a session with a random ratchet.
+func NewOutboundGroupSession() (*OutboundGroupSession, error) {
+	data := make([]byte, megolmParts*32)
+	if _, err := rand.Read(data); err != nil {
+		return nil, err
+	}
+	_, signing, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &OutboundGroupSession{
+		Ratchet:    megolmRatchet{Data: data},
+		SigningKey: signing,
+		Created:    time.Now(),
+	}, nil
+}
+
+// ID is the session's public signing key, as rooms and room keys name it.
+func (s *OutboundGroupSession) ID() string {
+	return Encode(s.SigningKey.Public().(ed25519.PublicKey))
+}
+
+// MessageIndex is the index the next message will be sent at.
+func (s *OutboundGroupSession) MessageIndex() uint32 {
+	return s.Ratchet.Counter
+}
+
+// SessionKey is the key to share with the room's devices so they can
+// decrypt messages from the current index on.
+func (s *OutboundGroupSession) SessionKey() string {
+	b := []byte{megolmSessionKeyVersion}
+	b = binary.BigEndian.AppendUint32(b, s.Ratchet.Counter)
+	b = append(b, s.Ratchet.Data...)
+	b = append(b, s.SigningKey.Public().(ed25519.PublicKey)...)
+	b = append(b, ed25519.Sign(s.SigningKey, b)...)
+	return Encode(b)
+}
+
+// Encrypt encrypts plaintext at the current index and advances the
+// ratchet.
+func (s *OutboundGroupSession) Encrypt(plaintext []byte) []byte {
+	keys := deriveMessageKeys(s.Ratchet.Data, megolmKeysInfo)
+	msg := []byte{messageVersion}
+	msg = appendIntField(msg, 1, uint64(s.Ratchet.Counter))
+	msg = appendBytesField(msg, 2, keys.encrypt(plaintext))
+	msg = append(msg, keys.mac(msg)...)
+	msg = append(msg, ed25519.Sign(s.SigningKey, msg)...)
+	s.Ratchet.advance()
+	return msg
+}
+
+// InboundGroupSession decrypts messages another device sent to a room.
+type InboundGroupSession struct {
+	Initial    megolmRatchet     `json:"initial"`
+	Latest     megolmRatchet     `json:"latest"`
+	SigningKey ed25519.PublicKey `json:"signing_key"`
+}
+
+// NewInboundGroupSession creates a session from a shared session key and
+// checks its signature.
+func NewInboundGroupSession(sessionKey string) (*InboundGroupSession, error) {
+	b, err := Decode(sessionKey)
+	if err != nil {
+		return nil, err
+	}
+	const size = 1 + 4 + megolmParts*32 + ed25519.PublicKeySize + ed25519.SignatureSize
+	if len(b) != size || b[0] != megolmSessionKeyVersion {
+		return nil, errors.New("olm: invalid session key")
+	}
+	pub := ed25519.PublicKey(b[5+megolmParts*32 : 5+megolmParts*32+ed25519.PublicKeySize])
+	signed := b[:size-ed25519.SignatureSize]
+	if !ed25519.Verify(pub, signed, b[size-ed25519.SignatureSize:]) {
+		return nil, errors.New("olm: session key signature does not verify")
+	}
+	r := megolmRatchet{
+		Data:    append([]byte{}, b[5:5+megolmParts*32]...),
+		Counter: binary.BigEndian.Uint32(b[1:5]),
+	}
+	return &InboundGroupSession{Initial: r, Latest: r.clone(), SigningKey: append(ed25519.PublicKey{}, pub...)}, nil
+}
+
+// ID is the session's public signing key.
+func (s *InboundGroupSession) ID() string {
+	return Encode(s.SigningKey)
+}
+
+// FirstKnownIndex is the earliest index this session can decrypt.
+func (s *InboundGroupSession) FirstKnownIndex() uint32 {
+	return s.Initial.Counter
+}
+
+// Decrypt checks a message's signature and MAC and decrypts it, returning
+// the index it was sent at.
+func (s *InboundGroupSession) Decrypt(message []byte) ([]byte, uint32, error) {
+	if len(message) < 1+macLength+ed25519.SignatureSize || message[0] != messageVersion {
+		return nil, 0, ErrBadMessage
+	}
+	signed := message[:len(message)-ed25519.SignatureSize]
+	if !ed25519.Verify(s.SigningKey, signed, message[len(signed):]) {
+		return nil, 0, errors.New("olm: message signature does not verify")
+	}
+	raw := signed[:len(signed)-macLength]
+	f, err := parseFields(raw[1:])
+	if err != nil {
+		return nil, 0, err
+	}
+	idx, ok := f.ints[1]
+	ciphertext := f.bytes[2]
+	if !ok || ciphertext == nil {
+		return nil, 0, ErrBadMessage
+	}
+	index := uint32(idx)
+
+	// Indexes are compared with wraparound, as libolm does
+	var r megolmRatchet
+	latest := index-s.Latest.Counter < 1<<31
+	switch {
+	case latest:
+		r = s.Latest.clone()
+	case index-s.Initial.Counter >= 1<<31:
+		return nil, 0, ErrUnknownIndex
+	default:
+		r = s.Initial.clone()
+	}
+	r.advanceTo(index)
+
+	keys := deriveMessageKeys(r.Data, megolmKeysInfo)
+	if !hmacEqual(keys.mac(raw), signed[len(raw):]) {
+		return nil, 0, ErrBadMAC
+	}
+	plaintext, err := keys.decrypt(ciphertext)
+	if err != nil {
+		return nil, 0, err
+	}
+	if latest {
+		s.Latest = r
+	}
+	return plaintext, index, nil
+}
+
+func hmacEqual(a, b []byte) bool {
+	return hmac.Equal(a, b)
+}
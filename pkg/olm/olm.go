@@ -0,0 +1,221 @@
+// Package olm implements the Olm and Megolm ratchets used for end-to-end
+// encryption in Matrix, with the standard library's Curve25519, Ed25519,
+// AES and HMAC. The wire formats follow the Olm and Megolm specifications
+// (version 3 messages) so sessions interoperate with libolm and vodozemac;
+// TestLibolmInterop checks this against libolm when its Python bindings
+// are installed. The implementation has not been audited, which is why
+// the Matrix channel only uses it when encryption is turned on.
+//
+// Olm is the pairwise double ratchet between two devices and carries room
+// keys; Megolm is the one-to-many ratchet that encrypts room messages.
+// Account, Session, OutboundGroupSession and InboundGroupSession marshal to
+// JSON for storage; the JSON holds private keys and must be kept private.
+package olm
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// messageVersion is the version byte of Olm and Megolm messages.
+const messageVersion = 3
+
+// macLength is how many bytes of the HMAC-SHA256 are sent with a message.
+const macLength = 8
+
+// KDF info strings from the specification.
+const (
+	rootInfo       = "OLM_ROOT"
+	ratchetInfo    = "OLM_RATCHET"
+	olmKeysInfo    = "OLM_KEYS"
+	megolmKeysInfo = "MEGOLM_KEYS"
+)
+
+var (
+	// ErrBadMAC is returned when a message fails authentication, e.g. it
+	// was tampered with or encrypted for another session.
+	ErrBadMAC = errors.New("olm: bad message MAC")
+	// ErrBadMessage is returned for messages that cannot be parsed.
+	ErrBadMessage = errors.New("olm: malformed message")
+	// ErrUnknownIndex is returned for Megolm messages older than the key
+	// this session was created from.
+	ErrUnknownIndex = errors.New("olm: message index before the first known index")
+)
+
+// Encode returns b as unpadded base64, the encoding Matrix uses for keys
+// and ciphertexts.
+func Encode(b []byte) string {
+	return base64.RawStdEncoding.EncodeToString(b)
+}
+
+// Decode reads base64 with or without padding.
+func Decode(s string) ([]byte, error) {
+	return base64.RawStdEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// KeyPair is a Curve25519 key pair.
+type KeyPair struct {
+	Private []byte `json:"private"`
+	Public  []byte `json:"public"`
+}
+
+func newKeyPair() (KeyPair, error) {
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return KeyPair{}, err
+	}
+	return KeyPair{Private: priv.Bytes(), Public: priv.PublicKey().Bytes()}, nil
+}
+
+// sharedSecret is X25519(priv, pub).
+func sharedSecret(priv, pub []byte) ([]byte, error) {
+	p, err := ecdh.X25519().NewPrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	q, err := ecdh.X25519().NewPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	return p.ECDH(q)
+}
+
+func hmacSHA256(key []byte, data ...[]byte) []byte {
+	h := hmac.New(sha256.New, key)
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+// hkdfSHA256 derives length bytes; a nil salt means a zero salt.
+func hkdfSHA256(secret, salt []byte, info string, length int) []byte {
+	out, err := hkdf.Key(sha256.New, secret, salt, info, length)
+	if err != nil {
+		panic(err) // only for lengths over 255*32
+	}
+	return out
+}
+
+// messageKeys are the AES-256 key, HMAC key and IV derived from one
+// message key (Olm) or ratchet state (Megolm).
+type messageKeys struct {
+	aesKey, macKey, iv []byte
+}
+
+func deriveMessageKeys(secret []byte, info string) messageKeys {
+	b := hkdfSHA256(secret, nil, info, 80)
+	return messageKeys{aesKey: b[:32], macKey: b[32:64], iv: b[64:80]}
+}
+
+func (k messageKeys) encrypt(plaintext []byte) []byte {
+	block, _ := aes.NewCipher(k.aesKey)
+	pad := aes.BlockSize - len(plaintext)%aes.BlockSize
+	buf := make([]byte, len(plaintext)+pad)
+	copy(buf, plaintext)
+	for i := len(plaintext); i < len(buf); i++ {
+		buf[i] = byte(pad)
+	}
+	cipher.NewCBCEncrypter(block, k.iv).CryptBlocks(buf, buf)
+	return buf
+}
+
+func (k messageKeys) decrypt(ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, ErrBadMessage
+	}
+	block, _ := aes.NewCipher(k.aesKey)
+	buf := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, k.iv).CryptBlocks(buf, ciphertext)
+	pad := int(buf[len(buf)-1])
+	if pad == 0 || pad > aes.BlockSize {
+		return nil, ErrBadMessage
+	}
+	return buf[:len(buf)-pad], nil
+}
+
+// mac is the truncated MAC of a message.
+func (k messageKeys) mac(message []byte) []byte {
+	return hmacSHA256(k.macKey, message)[:macLength]
+}
+
+// The message formats are protobuf-like: a version byte, then fields
+// tagged with (number << 3 | wire type), varints or length-prefixed bytes.
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func appendBytesField(b []byte, field int, v []byte) []byte {
+	b = append(b, byte(field<<3|2))
+	b = appendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendIntField(b []byte, field int, v uint64) []byte {
+	b = append(b, byte(field<<3))
+	return appendVarint(b, v)
+}
+
+// fields are the parsed fields of a message body.
+type fields struct {
+	bytes map[int][]byte
+	ints  map[int]uint64
+}
+
+func readVarint(b []byte) (uint64, int, error) {
+	var v uint64
+	for i := 0; i < len(b) && i < 10; i++ {
+		v |= uint64(b[i]&0x7f) << (7 * i)
+		if b[i] < 0x80 {
+			return v, i + 1, nil
+		}
+	}
+	return 0, 0, ErrBadMessage
+}
+
+// parseFields reads the fields after the version byte. Unknown fields are
+// skipped.
+func parseFields(b []byte) (fields, error) {
+	f := fields{bytes: make(map[int][]byte), ints: make(map[int]uint64)}
+	for len(b) > 0 {
+		tag, n, err := readVarint(b)
+		if err != nil {
+			return f, err
+		}
+		b = b[n:]
+		field := int(tag >> 3)
+		switch tag & 7 {
+		case 0:
+			v, n, err := readVarint(b)
+			if err != nil {
+				return f, err
+			}
+			f.ints[field] = v
+			b = b[n:]
+		case 2:
+			l, n, err := readVarint(b)
+			if err != nil || uint64(len(b)-n) < l {
+				return f, ErrBadMessage
+			}
+			f.bytes[field] = b[n : n+int(l)]
+			b = b[n+int(l):]
+		default:
+			return f, fmt.Errorf("%w: wire type %d", ErrBadMessage, tag&7)
+		}
+	}
+	return f, nil
+}
@@ -0,0 +1,223 @@
+package olm
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// newPair starts a session from alice to bob through a claimed one-time key
+// and has bob accept alice's first message.
+func newPair(t *testing.T) (alice, bob *Session, bobAccount *Account) {
+	t.Helper()
+	aliceAccount, err := NewAccount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobAccount, err = NewAccount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bobAccount.GenerateOneTimeKeys(1); err != nil {
+		t.Fatal(err)
+	}
+	var otk string
+	for _, key := range bobAccount.UnpublishedOneTimeKeys() {
+		otk = key
+	}
+	bobCurve, _ := bobAccount.IdentityKeys()
+	alice, err = NewOutboundSession(aliceAccount, bobCurve, otk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msgType, body, err := alice.Encrypt([]byte("hello bob"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msgType != MessageTypePreKey {
+		t.Fatalf("Expected a pre-key message first, got type %d", msgType)
+	}
+	bob, err = bobAccount.NewInboundSession(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bob.MatchesInbound(body) {
+		t.Error("Expected the pre-key message to match the session it created")
+	}
+	plaintext, err := bob.Decrypt(msgType, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plaintext) != "hello bob" {
+		t.Errorf("Expected %q, got %q", "hello bob", plaintext)
+	}
+	return alice, bob, bobAccount
+}
+
+// TestSession_RoundTrip verifies both sides agree on the session, the
+// one-time key is used up, and messages decrypt across ratchet steps.
+func TestSession_RoundTrip(t *testing.T) {
+	alice, bob, bobAccount := newPair(t)
+
+	if alice.ID() != bob.ID() {
+		t.Errorf("Expected both sides to have the same session ID, got %s and %s", alice.ID(), bob.ID())
+	}
+	if len(bobAccount.OneTimeKeys) != 0 {
+		t.Errorf("Expected the one-time key to be removed, got %d left", len(bobAccount.OneTimeKeys))
+	}
+
+	send := func(from, to *Session, text string) {
+		t.Helper()
+		msgType, body, err := from.Encrypt([]byte(text))
+		if err != nil {
+			t.Fatal(err)
+		}
+		plaintext, err := to.Decrypt(msgType, body)
+		if err != nil {
+			t.Fatalf("Decrypting %q: %v", text, err)
+		}
+		if string(plaintext) != text {
+			t.Errorf("Expected %q, got %q", text, plaintext)
+		}
+	}
+	send(bob, alice, "hi alice")
+	msgType, _, _ := alice.Encrypt([]byte("probe"))
+	if msgType != MessageTypeNormal {
+		t.Errorf("Expected normal messages after a reply, got type %d", msgType)
+	}
+	send(bob, alice, "second on the same chain")
+	send(alice, bob, "new ratchet step")
+	send(bob, alice, "and back")
+}
+
+// TestSession_OutOfOrder verifies messages that arrive late are decrypted
+// with skipped keys, and only once.
+func TestSession_OutOfOrder(t *testing.T) {
+	alice, bob, _ := newPair(t)
+
+	var bodies [][]byte
+	for _, text := range []string{"one", "two", "three"} {
+		_, body, err := bob.Encrypt([]byte(text))
+		if err != nil {
+			t.Fatal(err)
+		}
+		bodies = append(bodies, body)
+	}
+	for _, i := range []int{2, 0, 1} {
+		plaintext, err := alice.Decrypt(MessageTypeNormal, bodies[i])
+		if err != nil {
+			t.Fatalf("Decrypting message %d: %v", i, err)
+		}
+		if want := []string{"one", "two", "three"}[i]; string(plaintext) != want {
+			t.Errorf("Expected %q, got %q", want, plaintext)
+		}
+	}
+	if _, err := alice.Decrypt(MessageTypeNormal, bodies[0]); err == nil {
+		t.Error("Expected a replayed message to fail")
+	}
+}
+
+// TestSession_TamperedMessage verifies a modified message is rejected and
+// leaves the session usable.
+func TestSession_TamperedMessage(t *testing.T) {
+	alice, bob, _ := newPair(t)
+
+	_, body, err := bob.Encrypt([]byte("intact"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := append([]byte{}, body...)
+	tampered[len(tampered)-macLength-1] ^= 1
+	if _, err := alice.Decrypt(MessageTypeNormal, tampered); !errors.Is(err, ErrBadMAC) {
+		t.Errorf("Expected ErrBadMAC, got %v", err)
+	}
+	if _, err := alice.Decrypt(MessageTypeNormal, body); err != nil {
+		t.Errorf("Expected the real message to decrypt after a bad one, got %v", err)
+	}
+}
+
+// TestSession_JSON verifies a stored session keeps working.
+func TestSession_JSON(t *testing.T) {
+	alice, bob, _ := newPair(t)
+
+	data, err := json.Marshal(bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var restored Session
+	if err := json.Unmarshal(data, &restored); err != nil {
+		t.Fatal(err)
+	}
+	msgType, body, err := restored.Encrypt([]byte("from storage"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintext, err := alice.Decrypt(msgType, body); err != nil || string(plaintext) != "from storage" {
+		t.Errorf("Expected %q, got %q (%v)", "from storage", plaintext, err)
+	}
+}
+
+// TestMegolm_RoundTrip verifies a shared session key decrypts messages from
+// its index on, in any order, and not before it.
+func TestMegolm_RoundTrip(t *testing.T) {
+	out, err := NewOutboundGroupSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	early := out.Encrypt([]byte("before the key was shared"))
+
+	in, err := NewInboundGroupSession(out.SessionKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if in.ID() != out.ID() {
+		t.Errorf("Expected session ID %s, got %s", out.ID(), in.ID())
+	}
+	if in.FirstKnownIndex() != 1 {
+		t.Errorf("Expected first known index 1, got %d", in.FirstKnownIndex())
+	}
+
+	var msgs [][]byte
+	for _, text := range []string{"a", "b", "c"} {
+		msgs = append(msgs, out.Encrypt([]byte(text)))
+	}
+	for _, i := range []int{2, 0, 1} {
+		plaintext, index, err := in.Decrypt(msgs[i])
+		if err != nil {
+			t.Fatalf("Decrypting message %d: %v", i, err)
+		}
+		if want := []string{"a", "b", "c"}[i]; string(plaintext) != want || index != uint32(i+1) {
+			t.Errorf("Expected %q at %d, got %q at %d", want, i+1, plaintext, index)
+		}
+	}
+	if _, _, err := in.Decrypt(early); !errors.Is(err, ErrUnknownIndex) {
+		t.Errorf("Expected ErrUnknownIndex for a message before the key, got %v", err)
+	}
+
+	forged := append([]byte{}, msgs[0]...)
+	forged[3] ^= 1
+	if _, _, err := in.Decrypt(forged); err == nil {
+		t.Error("Expected a modified message to fail")
+	}
+}
+
+// TestMegolm_AdvanceTo verifies jumping ahead gives the same ratchet as
+// stepping, across the boundaries where higher parts are rehashed.
+func TestMegolm_AdvanceTo(t *testing.T) {
+	out, err := NewOutboundGroupSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, target := range []uint32{1, 255, 256, 257, 70000} {
+		stepped := out.Ratchet.clone()
+		for stepped.Counter < target {
+			stepped.advance()
+		}
+		jumped := out.Ratchet.clone()
+		jumped.advanceTo(target)
+		if string(stepped.Data) != string(jumped.Data) || jumped.Counter != target {
+			t.Errorf("Expected advanceTo(%d) to match stepping", target)
+		}
+	}
+}
@@ -0,0 +1,348 @@
+package olm
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// Olm message types.
+const (
+	MessageTypePreKey = 0
+	MessageTypeNormal = 1
+)
+
+// Limits from libolm: how many receiver chains and skipped message keys
+// are kept, and how far ahead of a chain a message may be.
+const (
+	maxReceiverChains = 5
+	maxSkippedKeys    = 40
+	maxMessageGap     = 2000
+)
+
+// Session is an Olm double ratchet between this device and one other.
+type Session struct {
+	RootKey        []byte          `json:"root_key"`
+	SenderChain    *SenderChain    `json:"sender_chain,omitempty"`
+	ReceiverChains []ReceiverChain `json:"receiver_chains"` // newest first
+	SkippedKeys    []SkippedKey    `json:"skipped_keys,omitempty"`
+
+	// ReceivedMessage is set once the other side has replied; until then
+	// messages are sent as pre-key messages so it can start the session.
+	ReceivedMessage bool `json:"received_message"`
+
+	// The keys the session was started from: the initiator's identity and
+	// base keys and the responder's one-time key.
+	TheirIdentityKey []byte `json:"their_identity_key"`
+	OurIdentityKey   []byte `json:"our_identity_key,omitempty"` // outbound only
+	BaseKey          []byte `json:"base_key"`
+	OneTimeKey       []byte `json:"one_time_key"`
+}
+
+// SenderChain is the chain this side sends on.
+type SenderChain struct {
+	RatchetKey KeyPair `json:"ratchet_key"`
+	ChainKey   []byte  `json:"chain_key"`
+	Index      uint32  `json:"index"`
+}
+
+// ReceiverChain is a chain the other side sent on.
+type ReceiverChain struct {
+	RatchetKey []byte `json:"ratchet_key"`
+	ChainKey   []byte `json:"chain_key"`
+	Index      uint32 `json:"index"`
+}
+
+// SkippedKey is the key of a message that has not arrived yet.
+type SkippedKey struct {
+	RatchetKey []byte `json:"ratchet_key"`
+	Index      uint32 `json:"index"`
+	MessageKey []byte `json:"message_key"`
+}
+
+// NewOutboundSession starts a session with the device whose identity key
+// and claimed one-time key are given (base64).
+func NewOutboundSession(a *Account, theirIdentityKey, theirOneTimeKey string) (*Session, error) {
+	identity, err := Decode(theirIdentityKey)
+	if err != nil || len(identity) != 32 {
+		return nil, fmt.Errorf("olm: invalid identity key")
+	}
+	otk, err := Decode(theirOneTimeKey)
+	if err != nil || len(otk) != 32 {
+		return nil, fmt.Errorf("olm: invalid one-time key")
+	}
+	base, err := newKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	ratchet, err := newKeyPair()
+	if err != nil {
+		return nil, err
+	}
+
+	var secret []byte
+	for _, pair := range [][2][]byte{
+		{a.IdentityKey.Private, otk},
+		{base.Private, identity},
+		{base.Private, otk},
+	} {
+		s, err := sharedSecret(pair[0], pair[1])
+		if err != nil {
+			return nil, err
+		}
+		secret = append(secret, s...)
+	}
+	derived := hkdfSHA256(secret, nil, rootInfo, 64)
+	return &Session{
+		RootKey:          derived[:32],
+		SenderChain:      &SenderChain{RatchetKey: ratchet, ChainKey: derived[32:]},
+		TheirIdentityKey: identity,
+		OurIdentityKey:   a.IdentityKey.Public,
+		BaseKey:          base.Public,
+		OneTimeKey:       otk,
+	}, nil
+}
+
+// ID identifies the session the same way on both sides.
+func (s *Session) ID() string {
+	initiator := s.TheirIdentityKey
+	if s.OurIdentityKey != nil {
+		initiator = s.OurIdentityKey
+	}
+	sum := sha256.Sum256(append(append(append([]byte{}, initiator...), s.BaseKey...), s.OneTimeKey...))
+	return Encode(sum[:])
+}
+
+// MatchesInbound reports whether a pre-key message was sent on this
+// session, so a repeated pre-key message is not taken for a new session.
+func (s *Session) MatchesInbound(message []byte) bool {
+	pre, err := parsePreKeyMessage(message)
+	if err != nil || s.OurIdentityKey != nil {
+		return false
+	}
+	return string(pre.baseKey) == string(s.BaseKey) &&
+		string(pre.identityKey) == string(s.TheirIdentityKey) &&
+		string(pre.oneTimeKey) == string(s.OneTimeKey)
+}
+
+// Encrypt encrypts plaintext and returns the message type and body.
+func (s *Session) Encrypt(plaintext []byte) (msgType int, body []byte, err error) {
+	if s.SenderChain == nil {
+		if len(s.ReceiverChains) == 0 {
+			return 0, nil, errors.New("olm: session has no chain to reply on")
+		}
+		ratchet, err := newKeyPair()
+		if err != nil {
+			return 0, nil, err
+		}
+		root, chain, err := advanceRoot(s.RootKey, ratchet.Private, s.ReceiverChains[0].RatchetKey)
+		if err != nil {
+			return 0, nil, err
+		}
+		s.RootKey = root
+		s.SenderChain = &SenderChain{RatchetKey: ratchet, ChainKey: chain}
+	}
+
+	chain := s.SenderChain
+	keys := deriveMessageKeys(messageKey(chain.ChainKey), olmKeysInfo)
+	msg := []byte{messageVersion}
+	msg = appendBytesField(msg, 1, chain.RatchetKey.Public)
+	msg = appendIntField(msg, 2, uint64(chain.Index))
+	msg = appendBytesField(msg, 4, keys.encrypt(plaintext))
+	msg = append(msg, keys.mac(msg)...)
+	chain.ChainKey = nextChainKey(chain.ChainKey)
+	chain.Index++
+
+	if s.ReceivedMessage {
+		return MessageTypeNormal, msg, nil
+	}
+	pre := []byte{messageVersion}
+	pre = appendBytesField(pre, 1, s.OneTimeKey)
+	pre = appendBytesField(pre, 2, s.BaseKey)
+	pre = appendBytesField(pre, 3, s.OurIdentityKey)
+	pre = appendBytesField(pre, 4, msg)
+	return MessageTypePreKey, pre, nil
+}
+
+// Decrypt decrypts a message of the given type. The session is only
+// changed when the message is authentic.
+func (s *Session) Decrypt(msgType int, body []byte) ([]byte, error) {
+	if msgType == MessageTypePreKey {
+		pre, err := parsePreKeyMessage(body)
+		if err != nil {
+			return nil, err
+		}
+		body = pre.message
+	}
+	msg, err := parseMessage(body)
+	if err != nil {
+		return nil, err
+	}
+
+	chainIdx := -1
+	for i, c := range s.ReceiverChains {
+		if string(c.RatchetKey) == string(msg.ratchetKey) {
+			chainIdx = i
+			break
+		}
+	}
+
+	if chainIdx >= 0 && s.ReceiverChains[chainIdx].Index > msg.counter {
+		// An older message: its key was kept when a later one arrived
+		for i, k := range s.SkippedKeys {
+			if k.Index != msg.counter || string(k.RatchetKey) != string(msg.ratchetKey) {
+				continue
+			}
+			plaintext, err := msg.open(k.MessageKey)
+			if err != nil {
+				return nil, err
+			}
+			s.SkippedKeys = append(s.SkippedKeys[:i], s.SkippedKeys[i+1:]...)
+			return plaintext, nil
+		}
+		return nil, fmt.Errorf("olm: message key %d already used", msg.counter)
+	}
+
+	var chain ReceiverChain
+	var newRoot []byte
+	if chainIdx >= 0 {
+		chain = s.ReceiverChains[chainIdx]
+	} else {
+		if s.SenderChain == nil {
+			return nil, errors.New("olm: message on an unknown chain")
+		}
+		root, chainKey, err := advanceRoot(s.RootKey, s.SenderChain.RatchetKey.Private, msg.ratchetKey)
+		if err != nil {
+			return nil, err
+		}
+		newRoot = root
+		chain = ReceiverChain{RatchetKey: msg.ratchetKey, ChainKey: chainKey}
+	}
+	if msg.counter-chain.Index > maxMessageGap {
+		return nil, fmt.Errorf("olm: message is too far ahead of the chain")
+	}
+
+	var skipped []SkippedKey
+	for chain.Index < msg.counter {
+		skipped = append(skipped, SkippedKey{
+			RatchetKey: chain.RatchetKey,
+			Index:      chain.Index,
+			MessageKey: messageKey(chain.ChainKey),
+		})
+		chain.ChainKey = nextChainKey(chain.ChainKey)
+		chain.Index++
+	}
+	plaintext, err := msg.open(messageKey(chain.ChainKey))
+	if err != nil {
+		return nil, err
+	}
+	chain.ChainKey = nextChainKey(chain.ChainKey)
+	chain.Index++
+
+	if chainIdx >= 0 {
+		s.ReceiverChains[chainIdx] = chain
+	} else {
+		s.RootKey = newRoot
+		s.ReceiverChains = append([]ReceiverChain{chain}, s.ReceiverChains...)
+		if len(s.ReceiverChains) > maxReceiverChains {
+			s.ReceiverChains = s.ReceiverChains[:maxReceiverChains]
+		}
+		s.SenderChain = nil // the next reply starts a new ratchet step
+	}
+	s.SkippedKeys = append(s.SkippedKeys, skipped...)
+	if extra := len(s.SkippedKeys) - maxSkippedKeys; extra > 0 {
+		s.SkippedKeys = s.SkippedKeys[extra:]
+	}
+	s.ReceivedMessage = true
+	return plaintext, nil
+}
+
+// advanceRoot performs a ratchet step: a new root key and chain key from
+// the old root and a fresh Diffie-Hellman exchange.
+func advanceRoot(root, ourPrivate, theirPublic []byte) (newRoot, chainKey []byte, err error) {
+	secret, err := sharedSecret(ourPrivate, theirPublic)
+	if err != nil {
+		return nil, nil, err
+	}
+	derived := hkdfSHA256(secret, root, ratchetInfo, 64)
+	return derived[:32], derived[32:], nil
+}
+
+func messageKey(chainKey []byte) []byte   { return hmacSHA256(chainKey, []byte{0x01}) }
+func nextChainKey(chainKey []byte) []byte { return hmacSHA256(chainKey, []byte{0x02}) }
+
+// olmMessage is a parsed normal message.
+type olmMessage struct {
+	raw        []byte // everything the MAC covers
+	mac        []byte
+	ratchetKey []byte
+	counter    uint32
+	ciphertext []byte
+}
+
+func parseMessage(b []byte) (*olmMessage, error) {
+	if len(b) < 1+macLength || b[0] != messageVersion {
+		return nil, ErrBadMessage
+	}
+	raw := b[:len(b)-macLength]
+	f, err := parseFields(raw[1:])
+	if err != nil {
+		return nil, err
+	}
+	counter, hasCounter := f.ints[2]
+	msg := &olmMessage{
+		raw:        raw,
+		mac:        b[len(b)-macLength:],
+		ratchetKey: f.bytes[1],
+		counter:    uint32(counter),
+		ciphertext: f.bytes[4],
+	}
+	if len(msg.ratchetKey) != 32 || !hasCounter || msg.ciphertext == nil {
+		return nil, ErrBadMessage
+	}
+	return msg, nil
+}
+
+// open checks the MAC with the keys from messageKey and decrypts.
+func (m *olmMessage) open(messageKey []byte) ([]byte, error) {
+	keys := deriveMessageKeys(messageKey, olmKeysInfo)
+	if !hmacEqual(keys.mac(m.raw), m.mac) {
+		return nil, ErrBadMAC
+	}
+	return keys.decrypt(m.ciphertext)
+}
+
+// preKeyMessage is a parsed pre-key message.
+type preKeyMessage struct {
+	oneTimeKey, baseKey, identityKey, message []byte
+}
+
+func parsePreKeyMessage(b []byte) (*preKeyMessage, error) {
+	if len(b) < 1 || b[0] != messageVersion {
+		return nil, ErrBadMessage
+	}
+	f, err := parseFields(b[1:])
+	if err != nil {
+		return nil, err
+	}
+	pre := &preKeyMessage{
+		oneTimeKey:  f.bytes[1],
+		baseKey:     f.bytes[2],
+		identityKey: f.bytes[3],
+		message:     f.bytes[4],
+	}
+	if len(pre.oneTimeKey) != 32 || len(pre.baseKey) != 32 || len(pre.identityKey) != 32 || pre.message == nil {
+		return nil, ErrBadMessage
+	}
+	return pre, nil
+}
+
+// PreKeyIdentity returns the sender identity key (base64) a pre-key
+// message claims, for checking it against the event's sender key.
+func PreKeyIdentity(message []byte) (string, error) {
+	pre, err := parsePreKeyMessage(message)
+	if err != nil {
+		return "", err
+	}
+	return Encode(pre.identityKey), nil
+}
@@ -0,0 +1,289 @@
+// Package openaiapi serves picoclaw as an OpenAI-compatible chat
+// completions API, so chat UIs and editors that speak that API can use the
+// agent, tools included, as if it were a model. Each request is answered by
+// a full agent turn; replies are not streamed token by token, but streaming
+// clients get the whole reply as one chunk.
+package openaiapi
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+const (
+	// CompletionsPath is where chat completions are served.
+	CompletionsPath = "/v1/chat/completions"
+	// ModelsPath lists the one model the server offers.
+	ModelsPath = "/v1/models"
+
+	maxBodySize = 4 << 20
+
+	// keepAliveInterval is how often a streaming response sends a comment
+	// while the agent works, so clients and proxies don't time out.
+	keepAliveInterval = 15 * time.Second
+)
+
+// Message is a chat message from the client, with the text parts of its
+// content joined.
+type Message struct {
+	Role    string
+	Content string
+}
+
+// ChatHandler answers a conversation. user is the request's "user" field,
+// and messages end with the user message to answer.
+type ChatHandler func(ctx context.Context, user string, messages []Message) (string, error)
+
+// Server serves CompletionsPath and ModelsPath.
+type Server struct {
+	model string
+	keys  []string
+	run   ChatHandler
+}
+
+// NewServer creates a handler that answers requests carrying one of keys
+// as a bearer token with run, under the model name model.
+func NewServer(model string, keys []string, run ChatHandler) (*Server, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("at least one API key is required")
+	}
+	return &Server{model: model, keys: keys, run: run}, nil
+}
+
+// chatRequest is the part of an OpenAI chat completion request the server
+// uses. Sampling parameters and client-side tools are ignored: the agent
+// uses its own.
+type chatRequest struct {
+	Model    string `json:"model"`
+	Messages []struct {
+		Role    string          `json:"role"`
+		Content json.RawMessage `json:"content"`
+	} `json:"messages"`
+	Stream bool   `json:"stream"`
+	User   string `json:"user"`
+}
+
+// textContent returns the text of a message's content, which is either a
+// string or a list of parts.
+func textContent(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, nil
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return "", fmt.Errorf("content must be a string or a list of parts")
+	}
+	var texts []string
+	for _, p := range parts {
+		if p.Type == "text" {
+			texts = append(texts, p.Text)
+		}
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		writeError(w, http.StatusUnauthorized, "invalid_api_key", "Invalid API key")
+		return
+	}
+
+	switch r.URL.Path {
+	case ModelsPath:
+		s.serveModels(w, r)
+	case CompletionsPath:
+		s.serveCompletions(w, r)
+	default:
+		writeError(w, http.StatusNotFound, "not_found", "Unknown endpoint "+r.URL.Path)
+	}
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+	for _, key := range s.keys {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(key)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) serveModels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Use GET")
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"object": "list",
+		"data": []map[string]interface{}{
+			{"id": s.model, "object": "model", "created": 0, "owned_by": "picoclaw"},
+		},
+	})
+}
+
+func (s *Server) serveCompletions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Use POST")
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "Failed to read request")
+		return
+	}
+	var req chatRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "Invalid JSON: "+err.Error())
+		return
+	}
+
+	messages := make([]Message, 0, len(req.Messages))
+	for _, m := range req.Messages {
+		switch m.Role {
+		case "system", "developer":
+			m.Role = "system"
+		case "user", "assistant":
+		default:
+			// Results of the client's own tools; the agent runs its own
+			continue
+		}
+		text, err := textContent(m.Content)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+			return
+		}
+		messages = append(messages, Message{Role: m.Role, Content: text})
+	}
+	if len(messages) == 0 || messages[len(messages)-1].Role != "user" {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "The last message must be from the user")
+		return
+	}
+
+	logger.InfoCF("openai", "Chat completion request",
+		map[string]interface{}{
+			"user":     req.User,
+			"messages": len(messages),
+			"stream":   req.Stream,
+		})
+
+	id := "chatcmpl-" + uuid.NewString()
+	created := time.Now().Unix()
+	if req.Stream {
+		s.stream(w, r, id, created, req.User, messages)
+		return
+	}
+
+	reply, err := s.run(r.Context(), req.User, messages)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"id":      id,
+		"object":  "chat.completion",
+		"created": created,
+		"model":   s.model,
+		"choices": []map[string]interface{}{{
+			"index":         0,
+			"message":       map[string]string{"role": "assistant", "content": reply},
+			"finish_reason": "stop",
+		}},
+	})
+}
+
+// stream answers as server-sent events: the role, then the whole reply,
+// then the finish reason. Errors after the headers are sent are reported
+// as an error event.
+func (s *Server) stream(w http.ResponseWriter, r *http.Request, id string, created int64, user string, messages []Message) {
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(v interface{}) {
+		data, _ := json.Marshal(v)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	chunk := func(delta map[string]string, finish interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"id":      id,
+			"object":  "chat.completion.chunk",
+			"created": created,
+			"model":   s.model,
+			"choices": []map[string]interface{}{{"index": 0, "delta": delta, "finish_reason": finish}},
+		}
+	}
+
+	send(chunk(map[string]string{"role": "assistant"}, nil))
+
+	type result struct {
+		reply string
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		reply, err := s.run(r.Context(), user, messages)
+		done <- result{reply, err}
+	}()
+
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			fmt.Fprint(w, ": working\n\n")
+			if flusher != nil {
+				flusher.Flush()
+			}
+		case res := <-done:
+			if res.err != nil {
+				send(map[string]interface{}{"error": map[string]string{"message": res.err.Error(), "type": "server_error"}})
+			} else {
+				send(chunk(map[string]string{"content": res.reply}, nil))
+				send(chunk(map[string]string{}, "stop"))
+			}
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			if flusher != nil {
+				flusher.Flush()
+			}
+			return
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError replies with an error in the shape OpenAI clients expect.
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]string{"message": message, "type": code, "code": code},
+	})
+}
@@ -0,0 +1,168 @@
+package openaiapi
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestServer(t *testing.T, run ChatHandler) *httptest.Server {
+	t.Helper()
+	s, err := NewServer("picoclaw", []string{"k1"}, run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func post(t *testing.T, url, key, body string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, url+CompletionsPath, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+key)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// TestServer_Completion verifies the conversation reaches the handler with
+// text parts joined and client tool results dropped, and the reply comes
+// back as a chat completion.
+func TestServer_Completion(t *testing.T) {
+	var gotUser string
+	var got []Message
+	server := newTestServer(t, func(ctx context.Context, user string, messages []Message) (string, error) {
+		gotUser, got = user, messages
+		return "Paris.", nil
+	})
+
+	resp := post(t, server.URL, "k1", `{"model":"gpt-4o","user":"ann","messages":[
+		{"role":"system","content":"Be brief."},
+		{"role":"user","content":"hi"},
+		{"role":"assistant","content":null},
+		{"role":"tool","content":"ignored"},
+		{"role":"user","content":[{"type":"text","text":"Capital"},{"type":"image_url"},{"type":"text","text":"of France?"}]}]}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %s", resp.Status)
+	}
+	var body struct {
+		Object  string `json:"object"`
+		Model   string `json:"model"`
+		Choices []struct {
+			Message      Message `json:"message"`
+			FinishReason string  `json:"finish_reason"`
+		} `json:"choices"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Object != "chat.completion" || body.Model != "picoclaw" || len(body.Choices) != 1 ||
+		body.Choices[0].Message.Content != "Paris." || body.Choices[0].FinishReason != "stop" {
+		t.Errorf("Unexpected response: %+v", body)
+	}
+	want := []Message{{"system", "Be brief."}, {"user", "hi"}, {"assistant", ""}, {"user", "Capital\nof France?"}}
+	if gotUser != "ann" || fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Expected user ann and %v, got %q and %v", want, gotUser, got)
+	}
+}
+
+// TestServer_Stream verifies streaming clients get the reply as chunks
+// ending with [DONE].
+func TestServer_Stream(t *testing.T) {
+	server := newTestServer(t, func(ctx context.Context, user string, messages []Message) (string, error) {
+		return "Hello!", nil
+	})
+
+	resp := post(t, server.URL, "k1", `{"stream":true,"messages":[{"role":"user","content":"hi"}]}`)
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %q", ct)
+	}
+	var content, finish string
+	var done bool
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		if data == "[DONE]" {
+			done = true
+			break
+		}
+		var chunk struct {
+			Choices []struct {
+				Delta        map[string]string `json:"delta"`
+				FinishReason *string           `json:"finish_reason"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatal(err)
+		}
+		content += chunk.Choices[0].Delta["content"]
+		if chunk.Choices[0].FinishReason != nil {
+			finish = *chunk.Choices[0].FinishReason
+		}
+	}
+	if content != "Hello!" || finish != "stop" || !done {
+		t.Errorf("Expected Hello! then stop and [DONE], got %q, %q, %v", content, finish, done)
+	}
+}
+
+// TestServer_RejectsBadRequests verifies the API key, the message list and
+// the endpoint are checked before the agent runs.
+func TestServer_RejectsBadRequests(t *testing.T) {
+	server := newTestServer(t, func(ctx context.Context, user string, messages []Message) (string, error) {
+		t.Error("Expected the handler not to run")
+		return "", nil
+	})
+
+	tests := []struct {
+		key, body string
+		status    int
+	}{
+		{"wrong", `{"messages":[{"role":"user","content":"hi"}]}`, http.StatusUnauthorized},
+		{"k1", `{"messages":[]}`, http.StatusBadRequest},
+		{"k1", `{"messages":[{"role":"user","content":"hi"},{"role":"assistant","content":"yo"}]}`, http.StatusBadRequest},
+		{"k1", `{"messages":[{"role":"user","content":42}]}`, http.StatusBadRequest},
+		{"k1", `not json`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if resp := post(t, server.URL, tt.key, tt.body); resp.StatusCode != tt.status {
+			t.Errorf("Expected %d for key %q and %s, got %s", tt.status, tt.key, tt.body, resp.Status)
+		}
+	}
+
+	if _, err := NewServer("picoclaw", nil, nil); err == nil {
+		t.Error("Expected an error without API keys")
+	}
+}
+
+// TestServer_Models verifies the configured model name is listed.
+func TestServer_Models(t *testing.T) {
+	server := newTestServer(t, nil)
+	req, _ := http.NewRequest(http.MethodGet, server.URL+ModelsPath, nil)
+	req.Header.Set("Authorization", "Bearer k1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	if len(body.Data) != 1 || body.Data[0].ID != "picoclaw" {
+		t.Errorf("Expected the picoclaw model, got %+v", body)
+	}
+}
@@ -0,0 +1,220 @@
+// Package outbox persists outbound messages that could not be delivered and
+// schedules them for retry with exponential backoff, so replies, reminders
+// and scheduled reports survive network outages and restarts.
+package outbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+const (
+	// InitialBackoff is the delay before the first retry.
+	InitialBackoff = 5 * time.Second
+	// MaxBackoff caps the delay between retries.
+	MaxBackoff = 10 * time.Minute
+	// DefaultMaxAge is how long an undelivered message is kept.
+	DefaultMaxAge = 24 * time.Hour
+)
+
+// Entry is a queued outbound message.
+type Entry struct {
+	ID          string              `json:"id"`
+	Message     bus.OutboundMessage `json:"message"`
+	Created     time.Time           `json:"created"`
+	Attempts    int                 `json:"attempts"`
+	NextAttempt time.Time           `json:"next_attempt"`
+	LastError   string              `json:"last_error,omitempty"`
+}
+
+// Queue is a persisted FIFO of undelivered messages. Entries for the same
+// chat are delivered in the order they were queued.
+type Queue struct {
+	path    string
+	maxAge  time.Duration
+	entries []*Entry
+	mu      sync.Mutex
+}
+
+// New loads the queue stored at path. A missing or unreadable file starts an
+// empty queue. maxAge <= 0 uses DefaultMaxAge.
+func New(path string, maxAge time.Duration) *Queue {
+	if maxAge <= 0 {
+		maxAge = DefaultMaxAge
+	}
+	q := &Queue{path: path, maxAge: maxAge}
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &q.entries)
+	}
+	return q
+}
+
+// Enqueue adds a message that failed to send with sendErr. A nil sendErr
+// queues a message that was not tried because its chat already has queued
+// messages.
+func (q *Queue) Enqueue(msg bus.OutboundMessage, sendErr error, now time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entry := &Entry{
+		ID:          uuid.NewString(),
+		Message:     msg,
+		Created:     now,
+		NextAttempt: now.Add(InitialBackoff),
+	}
+	if sendErr != nil {
+		entry.Attempts = 1
+		entry.LastError = sendErr.Error()
+	} else {
+		// Queued behind earlier entries for the same chat; try with them
+		entry.NextAttempt = now
+	}
+	q.entries = append(q.entries, entry)
+	return q.saveLocked()
+}
+
+// HasPending reports whether messages for the chat are waiting, in which case
+// new messages must be queued behind them to keep their order.
+func (q *Queue) HasPending(channel, chatID string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, e := range q.entries {
+		if e.Message.Channel == channel && e.Message.ChatID == chatID {
+			return true
+		}
+	}
+	return false
+}
+
+// Len returns the number of queued messages.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.entries)
+}
+
+// Due returns the entries to retry now, oldest first, at most one per chat:
+// a later message is only tried after the earlier one has been delivered.
+// Entries older than the queue's max age are dropped and returned separately.
+func (q *Queue) Due(now time.Time) (due []Entry, expired []Entry) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	kept := q.entries[:0]
+	seen := make(map[string]bool)
+	for _, e := range q.entries {
+		if now.Sub(e.Created) > q.maxAge {
+			expired = append(expired, *e)
+			continue
+		}
+		kept = append(kept, e)
+
+		chat := e.Message.Channel + ":" + e.Message.ChatID
+		if seen[chat] {
+			continue
+		}
+		seen[chat] = true
+		if !e.NextAttempt.After(now) {
+			due = append(due, *e)
+		}
+	}
+	q.entries = kept
+	if len(expired) > 0 {
+		q.saveLocked()
+	}
+	return due, expired
+}
+
+// NextDue returns when the earliest entry becomes due, or false if the queue
+// is empty. Only the oldest entry of each chat counts, as in Due.
+func (q *Queue) NextDue() (time.Time, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var next time.Time
+	seen := make(map[string]bool)
+	for _, e := range q.entries {
+		chat := e.Message.Channel + ":" + e.Message.ChatID
+		if seen[chat] {
+			continue
+		}
+		seen[chat] = true
+		if next.IsZero() || e.NextAttempt.Before(next) {
+			next = e.NextAttempt
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// Delivered removes an entry after a successful send.
+func (q *Queue) Delivered(id string) error {
+	return q.remove(id)
+}
+
+// Drop removes an entry that can never be delivered.
+func (q *Queue) Drop(id string) error {
+	return q.remove(id)
+}
+
+// Failed records a failed retry and schedules the next one.
+func (q *Queue) Failed(id string, sendErr error, now time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, e := range q.entries {
+		if e.ID != id {
+			continue
+		}
+		e.Attempts++
+		e.LastError = sendErr.Error()
+		e.NextAttempt = now.Add(Backoff(e.Attempts))
+		return q.saveLocked()
+	}
+	return nil
+}
+
+// Backoff returns the delay after the given number of failed attempts.
+func Backoff(attempts int) time.Duration {
+	d := InitialBackoff
+	for i := 1; i < attempts && d < MaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, MaxBackoff)
+}
+
+func (q *Queue) remove(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, e := range q.entries {
+		if e.ID == id {
+			q.entries = append(q.entries[:i], q.entries[i+1:]...)
+			return q.saveLocked()
+		}
+	}
+	return nil
+}
+
+// saveLocked writes the queue atomically. Must be called with the lock held.
+func (q *Queue) saveLocked() error {
+	if err := os.MkdirAll(filepath.Dir(q.path), 0755); err != nil {
+		return fmt.Errorf("failed to create outbox directory: %w", err)
+	}
+	data, err := json.MarshalIndent(q.entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal outbox: %w", err)
+	}
+	tmp := q.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write outbox: %w", err)
+	}
+	if err := os.Rename(tmp, q.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to save outbox: %w", err)
+	}
+	return nil
+}
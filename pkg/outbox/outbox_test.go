@@ -0,0 +1,81 @@
+package outbox
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+// TestQueue_RetryOrderPerChat verifies that only the oldest message of a chat is due
+func TestQueue_RetryOrderPerChat(t *testing.T) {
+	q := New(filepath.Join(t.TempDir(), "outbox.json"), time.Hour)
+	now := time.Now()
+
+	first := bus.OutboundMessage{Channel: "telegram", ChatID: "1", Content: "first"}
+	second := bus.OutboundMessage{Channel: "telegram", ChatID: "1", Content: "second"}
+	q.Enqueue(first, errors.New("network down"), now)
+	q.Enqueue(second, nil, now)
+
+	if !q.HasPending("telegram", "1") || q.HasPending("telegram", "2") {
+		t.Fatalf("Expected pending messages only for chat 1")
+	}
+
+	if due, _ := q.Due(now); len(due) != 0 {
+		t.Fatalf("Expected nothing due before backoff, got %d", len(due))
+	}
+
+	due, _ := q.Due(now.Add(InitialBackoff))
+	if len(due) != 1 || due[0].Message.Content != "first" {
+		t.Fatalf("Expected first message due, got %+v", due)
+	}
+
+	q.Delivered(due[0].ID)
+	due, _ = q.Due(now.Add(InitialBackoff))
+	if len(due) != 1 || due[0].Message.Content != "second" {
+		t.Fatalf("Expected second message due after first delivered, got %+v", due)
+	}
+}
+
+// TestQueue_PersistAndExpire verifies entries survive reload and expire after max age
+func TestQueue_PersistAndExpire(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "outbox.json")
+	now := time.Now()
+
+	q := New(path, time.Hour)
+	q.Enqueue(bus.OutboundMessage{Channel: "telegram", ChatID: "1", Content: "hi"}, errors.New("timeout"), now)
+
+	reloaded := New(path, time.Hour)
+	if reloaded.Len() != 1 {
+		t.Fatalf("Expected 1 entry after reload, got %d", reloaded.Len())
+	}
+
+	due, expired := reloaded.Due(now.Add(2 * time.Hour))
+	if len(due) != 0 || len(expired) != 1 {
+		t.Fatalf("Expected entry to expire, got due=%d expired=%d", len(due), len(expired))
+	}
+	if New(path, time.Hour).Len() != 0 {
+		t.Errorf("Expected expired entry to be removed from disk")
+	}
+}
+
+// TestQueue_Failed verifies exponential backoff on repeated failures
+func TestQueue_Failed(t *testing.T) {
+	q := New(filepath.Join(t.TempDir(), "outbox.json"), 0)
+	now := time.Now()
+	q.Enqueue(bus.OutboundMessage{Channel: "telegram", ChatID: "1"}, errors.New("down"), now)
+
+	due, _ := q.Due(now.Add(InitialBackoff))
+	q.Failed(due[0].ID, errors.New("still down"), now)
+
+	next, ok := q.NextDue()
+	if !ok || !next.Equal(now.Add(2*InitialBackoff)) {
+		t.Errorf("Expected next attempt after %v, got %v", 2*InitialBackoff, next.Sub(now))
+	}
+
+	if got := Backoff(100); got != MaxBackoff {
+		t.Errorf("Expected backoff capped at %v, got %v", MaxBackoff, got)
+	}
+}
@@ -0,0 +1,179 @@
+package providers
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// Capabilities says which request features a model accepts. Requests for a
+// model without them are degraded instead of failing with a 400: tools are
+// described in the prompt and images are described by a vision model.
+type Capabilities struct {
+	Tools  bool
+	Vision bool
+}
+
+// CapabilityProvider is implemented by providers that can ask the backend
+// what a model supports. ok is false when the backend doesn't say.
+type CapabilityProvider interface {
+	ModelCapabilities(ctx context.Context, model string) (caps Capabilities, ok bool)
+}
+
+// modelRules describe well-known model families, matched in order against
+// the lower-cased model name. Vision variants of text-only families come
+// first. Vision is only used when the provider can send images at all.
+var modelRules = []struct {
+	match string
+	caps  Capabilities
+}{
+	{"vision", Capabilities{Tools: true, Vision: true}},
+	{"-vl", Capabilities{Tools: true, Vision: true}},
+	{"glm-4v", Capabilities{Tools: true, Vision: true}},
+	{"glm-4.5v", Capabilities{Tools: true, Vision: true}},
+	{"llava", Capabilities{Vision: true}},
+	{"moondream", Capabilities{Vision: true}},
+	{"minicpm-v", Capabilities{Vision: true}},
+	{"deepseek-r1", Capabilities{}},
+	{"deepseek-reasoner", Capabilities{}},
+	{"o1-mini", Capabilities{}},
+	{"o1-preview", Capabilities{}},
+	{"gemma3", Capabilities{Vision: true}},
+	{"gemma", Capabilities{}},
+	{"tinyllama", Capabilities{}},
+	{"glm-", Capabilities{Tools: true}},
+	{"deepseek", Capabilities{Tools: true}},
+	{"gpt-3.5", Capabilities{Tools: true}},
+	{"o3-mini", Capabilities{Tools: true}},
+	{"mistral", Capabilities{Tools: true}},
+	{"mixtral", Capabilities{Tools: true}},
+	{"codestral", Capabilities{Tools: true}},
+	{"qwen", Capabilities{Tools: true}},
+	{"llama3", Capabilities{Tools: true}},
+	{"kimi", Capabilities{Tools: true}},
+	{"moonshot", Capabilities{Tools: true}},
+}
+
+// GuessCapabilities returns what a model is known to support from its name.
+// Unknown models are assumed to support both.
+func GuessCapabilities(model string) Capabilities {
+	name := strings.ToLower(model)
+	for _, rule := range modelRules {
+		if strings.Contains(name, rule.match) {
+			return rule.caps
+		}
+	}
+	return Capabilities{Tools: true, Vision: true}
+}
+
+// ParseCapabilities reads a list such as ["tools", "vision"]; features not
+// listed are unsupported.
+func ParseCapabilities(features []string) Capabilities {
+	var caps Capabilities
+	for _, f := range features {
+		switch strings.ToLower(strings.TrimSpace(f)) {
+		case "tools":
+			caps.Tools = true
+		case "vision":
+			caps.Vision = true
+		}
+	}
+	return caps
+}
+
+// CapabilityResolver looks up and caches model capabilities: configured
+// overrides first, then the backend, then the name rules. A nil resolver
+// uses the name rules only.
+type CapabilityResolver struct {
+	overrides map[string]Capabilities
+	mu        sync.Mutex
+	cache     map[string]Capabilities
+}
+
+// NewCapabilityResolver creates a resolver with per-model overrides, keyed
+// by model name and listing the supported features.
+func NewCapabilityResolver(overrides map[string][]string) *CapabilityResolver {
+	r := &CapabilityResolver{
+		overrides: make(map[string]Capabilities, len(overrides)),
+		cache:     make(map[string]Capabilities),
+	}
+	for model, features := range overrides {
+		r.overrides[model] = ParseCapabilities(features)
+	}
+	return r
+}
+
+// Configured returns the models with configured capabilities.
+func (r *CapabilityResolver) Configured() []string {
+	if r == nil {
+		return nil
+	}
+	models := make([]string, 0, len(r.overrides))
+	for model := range r.overrides {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	return models
+}
+
+// Resolve returns what model supports through provider.
+func (r *CapabilityResolver) Resolve(ctx context.Context, provider LLMProvider, model string) Capabilities {
+	caps, ok := Capabilities{}, false
+	if r != nil {
+		r.mu.Lock()
+		caps, ok = r.overrides[model]
+		if !ok {
+			caps, ok = r.cache[model]
+		}
+		r.mu.Unlock()
+	}
+	if !ok {
+		if cp, isCP := provider.(CapabilityProvider); isCP {
+			caps, ok = cp.ModelCapabilities(ctx, model)
+		}
+		if !ok {
+			caps = GuessCapabilities(model)
+		}
+		logger.DebugCF("provider", "Model capabilities",
+			map[string]interface{}{"model": model, "tools": caps.Tools, "vision": caps.Vision})
+		if r != nil {
+			r.mu.Lock()
+			r.cache[model] = caps
+			r.mu.Unlock()
+		}
+	}
+	if _, canSend := provider.(VisionProvider); !canSend {
+		caps.Vision = false
+	}
+	return caps
+}
+
+// ChatWithCapabilities sends a request with only what the model accepts:
+// without native tool calling the tools are described in the prompt, and
+// without vision images are dropped (callers describe them beforehand).
+func ChatWithCapabilities(ctx context.Context, provider LLMProvider, caps Capabilities, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	if !caps.Vision {
+		messages = withoutImages(messages)
+	}
+	if !caps.Tools && len(tools) > 0 {
+		return chatWithPromptTools(ctx, provider, messages, tools, model, options)
+	}
+	return provider.Chat(ctx, messages, tools, model, options)
+}
+
+func withoutImages(messages []Message) []Message {
+	for i, m := range messages {
+		if len(m.Images) > 0 {
+			out := make([]Message, len(messages))
+			copy(out, messages)
+			for j := i; j < len(out); j++ {
+				out[j].Images = nil
+			}
+			return out
+		}
+	}
+	return messages
+}
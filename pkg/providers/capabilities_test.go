@@ -0,0 +1,116 @@
+package providers
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// TestGuessCapabilities verifies well-known models are matched by family,
+// with vision variants taking precedence.
+func TestGuessCapabilities(t *testing.T) {
+	tests := []struct {
+		model string
+		want  Capabilities
+	}{
+		{"glm-4.7", Capabilities{Tools: true}},
+		{"glm-4.5v", Capabilities{Tools: true, Vision: true}},
+		{"ollama/llama3.2-vision:11b", Capabilities{Tools: true, Vision: true}},
+		{"qwen2.5-vl:7b", Capabilities{Tools: true, Vision: true}},
+		{"deepseek-r1:8b", Capabilities{}},
+		{"gemma3:4b", Capabilities{Vision: true}},
+		{"gpt-4o", Capabilities{Tools: true, Vision: true}},
+		{"claude-sonnet-4-5", Capabilities{Tools: true, Vision: true}},
+	}
+	for _, tt := range tests {
+		if got := GuessCapabilities(tt.model); got != tt.want {
+			t.Errorf("%s: Expected %+v, got %+v", tt.model, tt.want, got)
+		}
+	}
+}
+
+type promptToolsProvider struct {
+	got   []Message
+	tools []ToolDefinition
+	reply string
+}
+
+func (p *promptToolsProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	p.got, p.tools = messages, tools
+	return &LLMResponse{Content: p.reply, FinishReason: "stop"}, nil
+}
+
+func (p *promptToolsProvider) GetDefaultModel() string {
+	return "text-only"
+}
+
+// visionStub is a promptToolsProvider that can send images.
+type visionStub struct{ promptToolsProvider }
+
+func (p *visionStub) ImageLimits() ImageLimits {
+	return ImageLimits{}
+}
+
+// TestCapabilityResolver_Overrides verifies configured capabilities win and
+// that vision needs a provider that can send images.
+func TestCapabilityResolver_Overrides(t *testing.T) {
+	r := NewCapabilityResolver(map[string][]string{"gpt-4o": {"vision"}})
+	ctx := context.Background()
+	if got := r.Resolve(ctx, &visionStub{}, "gpt-4o"); got != (Capabilities{Vision: true}) {
+		t.Errorf("Expected the override, got %+v", got)
+	}
+	if got := r.Resolve(ctx, &promptToolsProvider{}, "gpt-4o"); got.Vision {
+		t.Errorf("Expected no vision for a provider that can't send images, got %+v", got)
+	}
+	var none *CapabilityResolver
+	if got := none.Resolve(ctx, &promptToolsProvider{}, "deepseek-r1"); got.Tools {
+		t.Errorf("Expected a nil resolver to fall back to the name rules, got %+v", got)
+	}
+}
+
+// TestChatWithCapabilities_PromptTools verifies that for models without
+// tool calling the tools and earlier calls go into the prompt, and that
+// tool_call blocks in the reply come back as tool calls.
+func TestChatWithCapabilities_PromptTools(t *testing.T) {
+	p := &promptToolsProvider{reply: "Let me check.\n<tool_call>{\"name\": \"read_file\", \"arguments\": {\"path\": \"b.txt\"}}</tool_call>"}
+	tools := []ToolDefinition{{Type: "function", Function: ToolFunctionDefinition{
+		Name: "read_file", Description: "Read a file",
+		Parameters: map[string]interface{}{"type": "object"},
+	}}}
+	messages := []Message{
+		{Role: "system", Content: "You are picoclaw."},
+		{Role: "user", Content: "Compare a.txt and b.txt", Images: []Image{{MediaType: "image/jpeg"}}},
+		{Role: "assistant", ToolCalls: []ToolCall{{ID: "c1", Name: "read_file", Arguments: map[string]interface{}{"path": "a.txt"}}}},
+		{Role: "tool", ToolCallID: "c1", Content: "alpha"},
+	}
+
+	resp, err := ChatWithCapabilities(context.Background(), p, Capabilities{}, messages, tools, "text-only", nil)
+	if err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+	if p.tools != nil {
+		t.Errorf("Expected no native tools in the request, got %d", len(p.tools))
+	}
+	if !strings.Contains(p.got[0].Content, "You are picoclaw.") || !strings.Contains(p.got[0].Content, "- read_file: Read a file") {
+		t.Errorf("Expected the tools in the system prompt, got %q", p.got[0].Content)
+	}
+	if len(p.got[1].Images) != 0 {
+		t.Error("Expected images to be dropped for a model without vision")
+	}
+	if want := `<tool_call>{"name": "read_file", "arguments": {"path":"a.txt"}}</tool_call>`; p.got[2].Content != want {
+		t.Errorf("Expected the earlier call as text %q, got %q", want, p.got[2].Content)
+	}
+	if p.got[3].Role != "user" || p.got[3].Content != "Result of read_file:\nalpha" {
+		t.Errorf("Expected the tool result as a user message, got %+v", p.got[3])
+	}
+	if len(messages[1].Images) != 1 || messages[0].Content != "You are picoclaw." {
+		t.Error("Expected the caller's messages to be left unchanged")
+	}
+
+	if resp.Content != "Let me check." || len(resp.ToolCalls) != 1 || resp.FinishReason != "tool_calls" {
+		t.Fatalf("Expected one parsed tool call, got %+v", resp)
+	}
+	if tc := resp.ToolCalls[0]; tc.Name != "read_file" || tc.Arguments["path"] != "b.txt" || tc.ID == "" {
+		t.Errorf("Expected read_file(b.txt), got %+v", tc)
+	}
+}
@@ -0,0 +1,188 @@
+package providers
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	anthropicoption "github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/openai/openai-go/v3"
+	openaioption "github.com/openai/openai-go/v3/option"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// Faults the chaos transport can inject.
+const (
+	FaultTimeout       = "timeout"
+	FaultRateLimit     = "rate_limit"
+	FaultMalformedTool = "malformed_tool_call"
+	FaultPartial       = "partial_response"
+)
+
+// toolArguments matches the JSON-encoded arguments string of a tool call in
+// OpenAI-style responses.
+var toolArguments = regexp.MustCompile(`("arguments"\s*:\s*")((?:[^"\\]|\\.)*)(")`)
+
+// ChaosTransport injects provider faults into HTTP requests at configured
+// rates, so that error handling can be tested against realistic failures:
+// timeouts, 429s, tool calls with broken argument JSON and responses cut
+// off mid-body.
+type ChaosTransport struct {
+	next  http.RoundTripper
+	rates []faultRate
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+type faultRate struct {
+	fault string
+	rate  float64
+}
+
+// NewChaosTransport wraps next (http.DefaultTransport if nil).
+func NewChaosTransport(next http.RoundTripper, cfg config.ChaosConfig) *ChaosTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &ChaosTransport{
+		next: next,
+		rates: []faultRate{
+			{FaultTimeout, cfg.TimeoutRate},
+			{FaultRateLimit, cfg.RateLimitRate},
+			{FaultMalformedTool, cfg.MalformedToolRate},
+			{FaultPartial, cfg.PartialRate},
+		},
+		rng: rand.New(rand.NewSource(seed)),
+	}
+}
+
+// pick draws the fault for one request, or "" for none.
+func (t *ChaosTransport) pick() string {
+	t.mu.Lock()
+	roll := t.rng.Float64()
+	t.mu.Unlock()
+	for _, fr := range t.rates {
+		if roll < fr.rate {
+			return fr.fault
+		}
+		roll -= fr.rate
+	}
+	return ""
+}
+
+func (t *ChaosTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	fault := t.pick()
+	if fault == "" {
+		return t.next.RoundTrip(req)
+	}
+	logger.WarnCF("chaos", "Injecting provider fault",
+		map[string]interface{}{"fault": fault, "url": req.URL.Path})
+
+	switch fault {
+	case FaultTimeout:
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, chaosTimeout{}
+	case FaultRateLimit:
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		body := `{"error":{"type":"rate_limit_error","message":"chaos: injected rate limit"}}`
+		return &http.Response{
+			Status:        "429 Too Many Requests",
+			StatusCode:    http.StatusTooManyRequests,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"Content-Type": {"application/json"}, "Retry-After": {"1"}},
+			Body:          io.NopCloser(strings.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	if fault == FaultMalformedTool {
+		// Cut each arguments string in half; responses without tool calls
+		// pass unchanged
+		data = toolArguments.ReplaceAllFunc(data, func(m []byte) []byte {
+			parts := toolArguments.FindSubmatch(m)
+			value := parts[2][:len(parts[2])/2]
+			value = bytes.TrimRight(value, `\`)
+			return append(append(append([]byte{}, parts[1]...), value...), parts[3]...)
+		})
+		resp.Body = io.NopCloser(bytes.NewReader(data))
+		return resp, nil
+	}
+	// Partial response: the connection drops halfway through the body
+	resp.Body = io.NopCloser(io.MultiReader(bytes.NewReader(data[:len(data)/2]), errReader{io.ErrUnexpectedEOF}))
+	return resp, nil
+}
+
+// chaosTimeout looks like a network timeout to callers that check for one.
+type chaosTimeout struct{}
+
+func (chaosTimeout) Error() string   { return "chaos: injected provider timeout" }
+func (chaosTimeout) Timeout() bool   { return true }
+func (chaosTimeout) Temporary() bool { return true }
+func (chaosTimeout) Unwrap() error   { return os.ErrDeadlineExceeded }
+
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
+
+// InjectFaults routes provider's requests through a chaos transport and
+// returns it. Providers that don't talk HTTP are returned unchanged.
+func InjectFaults(provider LLMProvider, cfg config.ChaosConfig) LLMProvider {
+	wrap := func(client *http.Client) *http.Client {
+		return &http.Client{Timeout: client.Timeout, Transport: NewChaosTransport(client.Transport, cfg)}
+	}
+	switch p := provider.(type) {
+	case *HTTPProvider:
+		p.httpClient = wrap(p.httpClient)
+	case *OllamaProvider:
+		p.httpClient = wrap(p.httpClient)
+	case *ClaudeProvider:
+		client := anthropic.NewClient(append(p.client.Options, anthropicoption.WithHTTPClient(wrap(http.DefaultClient)))...)
+		p.client = &client
+	case *CodexProvider:
+		client := openai.NewClient(append(p.client.Options, openaioption.WithHTTPClient(wrap(http.DefaultClient)))...)
+		p.client = &client
+	default:
+		logger.WarnCF("chaos", "Chaos mode is not supported for this provider", nil)
+		return provider
+	}
+	logger.WarnCF("chaos", "Chaos mode on: provider faults will be injected", map[string]interface{}{
+		"timeout_rate":        strconv.FormatFloat(cfg.TimeoutRate, 'f', -1, 64),
+		"rate_limit_rate":     strconv.FormatFloat(cfg.RateLimitRate, 'f', -1, 64),
+		"malformed_tool_rate": strconv.FormatFloat(cfg.MalformedToolRate, 'f', -1, 64),
+		"partial_rate":        strconv.FormatFloat(cfg.PartialRate, 'f', -1, 64),
+	})
+	return provider
+}
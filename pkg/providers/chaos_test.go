@@ -0,0 +1,114 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func chaosServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{
+				{
+					"message": map[string]interface{}{
+						"content": "",
+						"tool_calls": []map[string]interface{}{
+							{
+								"id":   "call_1",
+								"type": "function",
+								"function": map[string]interface{}{
+									"name":      "read_file",
+									"arguments": `{"path": "/tmp/notes.txt"}`,
+								},
+							},
+						},
+					},
+					"finish_reason": "tool_calls",
+				},
+			},
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func chaosChat(t *testing.T, cfg config.ChaosConfig) (*LLMResponse, error) {
+	t.Helper()
+	provider := InjectFaults(NewHTTPProvider("key", chaosServer(t).URL, ""), cfg)
+	return provider.Chat(context.Background(), []Message{{Role: "user", Content: "read my notes"}}, nil, "gpt-4o", nil)
+}
+
+// TestChaosTransport_Faults verifies each fault surfaces the way the real
+// failure would.
+func TestChaosTransport_Faults(t *testing.T) {
+	_, err := chaosChat(t, config.ChaosConfig{Enabled: true, TimeoutRate: 1})
+	if err == nil || !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Expected a timeout error, got %v", err)
+	}
+
+	_, err = chaosChat(t, config.ChaosConfig{Enabled: true, RateLimitRate: 1})
+	if err == nil || !strings.Contains(err.Error(), "429") {
+		t.Errorf("Expected a 429 error, got %v", err)
+	}
+
+	resp, err := chaosChat(t, config.ChaosConfig{Enabled: true, MalformedToolRate: 1})
+	if err != nil {
+		t.Fatalf("Expected a response with a malformed tool call, got error %v", err)
+	}
+	if len(resp.ToolCalls) != 1 {
+		t.Fatalf("Expected 1 tool call, got %d", len(resp.ToolCalls))
+	}
+	if _, ok := resp.ToolCalls[0].Arguments["raw"]; !ok {
+		t.Errorf("Expected unparseable arguments under raw, got %v", resp.ToolCalls[0].Arguments)
+	}
+
+	_, err = chaosChat(t, config.ChaosConfig{Enabled: true, PartialRate: 1})
+	if err == nil {
+		t.Error("Expected an error for a partial response, got nil")
+	}
+}
+
+// TestChaosTransport_ZeroRates verifies requests pass through unchanged when
+// no fault is configured.
+func TestChaosTransport_ZeroRates(t *testing.T) {
+	resp, err := chaosChat(t, config.ChaosConfig{Enabled: true, Seed: 1})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(resp.ToolCalls) != 1 || resp.ToolCalls[0].Arguments["path"] != "/tmp/notes.txt" {
+		t.Errorf("Expected the tool call unchanged, got %+v", resp.ToolCalls)
+	}
+}
+
+// TestChaosTransport_Rates verifies faults are injected at roughly the
+// configured rate.
+func TestChaosTransport_Rates(t *testing.T) {
+	server := chaosServer(t)
+	client := &http.Client{Transport: NewChaosTransport(nil, config.ChaosConfig{Seed: 42, RateLimitRate: 0.25})}
+	limited := 0
+	for i := 0; i < 400; i++ {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusTooManyRequests {
+			limited++
+		}
+	}
+	if limited < 60 || limited > 140 {
+		t.Errorf("Expected about 100 of 400 requests rate limited, got %d", limited)
+	}
+}
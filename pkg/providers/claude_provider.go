@@ -2,6 +2,7 @@ package providers
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 
@@ -52,6 +53,16 @@ func (p *ClaudeProvider) Chat(ctx context.Context, messages []Message, tools []T
 	return parseClaudeResponse(resp), nil
 }
 
+// ImageLimits returns what the Messages API accepts. Larger images are
+// scaled down by the API anyway, so 1568 pixels saves upload time.
+func (p *ClaudeProvider) ImageLimits() ImageLimits {
+	return ImageLimits{
+		Formats:      []string{"image/jpeg", "image/png", "image/gif", "image/webp"},
+		MaxBytes:     5 << 20,
+		MaxDimension: 1568,
+	}
+}
+
 func (p *ClaudeProvider) GetDefaultModel() string {
 	return "claude-sonnet-4-5-20250929"
 }
@@ -70,9 +81,11 @@ func buildClaudeParams(messages []Message, tools []ToolDefinition, model string,
 					anthropic.NewUserMessage(anthropic.NewToolResultBlock(msg.ToolCallID, msg.Content, false)),
 				)
 			} else {
-				anthropicMessages = append(anthropicMessages,
-					anthropic.NewUserMessage(anthropic.NewTextBlock(msg.Content)),
-				)
+				blocks := []anthropic.ContentBlockParamUnion{anthropic.NewTextBlock(msg.Content)}
+				for _, img := range msg.Images {
+					blocks = append(blocks, anthropic.NewImageBlockBase64(img.MediaType, base64.StdEncoding.EncodeToString(img.Data)))
+				}
+				anthropicMessages = append(anthropicMessages, anthropic.NewUserMessage(blocks...))
 			}
 		case "assistant":
 			if len(msg.ToolCalls) > 0 {
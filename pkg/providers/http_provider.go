@@ -48,6 +48,16 @@ func NewHTTPProvider(apiKey, apiBase, proxy string) *HTTPProvider {
 	}
 }
 
+// ImageLimits returns what OpenAI's vision models accept; other
+// OpenAI-compatible services are held to the same limits.
+func (p *HTTPProvider) ImageLimits() ImageLimits {
+	return ImageLimits{
+		Formats:      []string{"image/jpeg", "image/png", "image/gif", "image/webp"},
+		MaxBytes:     4 << 20,
+		MaxDimension: 2048,
+	}
+}
+
 func (p *HTTPProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
 	if p.apiBase == "" {
 		return nil, fmt.Errorf("API base not configured")
@@ -63,7 +73,7 @@ func (p *HTTPProvider) Chat(ctx context.Context, messages []Message, tools []Too
 
 	requestBody := map[string]interface{}{
 		"model":    model,
-		"messages": messages,
+		"messages": openAIMessages(messages),
 	}
 
 	if len(tools) > 0 {
@@ -219,9 +229,41 @@ func createCodexAuthProvider() (LLMProvider, error) {
 	return NewCodexProviderWithTokenSource(cred.AccessToken, cred.AccountID, createCodexTokenSource()), nil
 }
 
+func newOllamaProvider(cfg *config.Config) *OllamaProvider {
+	o := cfg.Providers.Ollama
+	p := NewOllamaProvider(o.APIBase, o.APIKey, o.Proxy)
+	p.SetMaxConcurrent(o.MaxConcurrent)
+	return p
+}
+
+// CreateProvider creates the provider for the configured model, with faults
+// injected into its requests when chaos mode is on.
 func CreateProvider(cfg *config.Config) (LLMProvider, error) {
+	provider, err := createProvider(cfg, cfg.Agents.Defaults.Provider, false)
+	return withChaos(cfg, provider, err)
+}
+
+// CreateNamedProvider creates the provider called name with its settings
+// from cfg. Unlike CreateProvider it does not fall back to another provider
+// when that one has no credentials configured.
+func CreateNamedProvider(cfg *config.Config, name string) (LLMProvider, error) {
+	provider, err := createProvider(cfg, name, true)
+	return withChaos(cfg, provider, err)
+}
+
+func withChaos(cfg *config.Config, provider LLMProvider, err error) (LLMProvider, error) {
+	if err != nil || !cfg.Chaos.Enabled {
+		return provider, err
+	}
+	return InjectFaults(provider, cfg.Chaos), nil
+}
+
+// createProvider creates providerName, or picks a provider by the model
+// name when it is empty or not configured. With strict set, providerName
+// must be configured.
+func createProvider(cfg *config.Config, providerName string, strict bool) (LLMProvider, error) {
 	model := cfg.Agents.Defaults.Model
-	providerName := strings.ToLower(cfg.Agents.Defaults.Provider)
+	providerName = strings.ToLower(providerName)
 
 	var apiKey, apiBase, proxy string
 
@@ -316,18 +358,20 @@ func CreateProvider(cfg *config.Config) (LLMProvider, error) {
 				}
 			}
 		case "ollama":
-			return NewOllamaProvider(cfg.Providers.Ollama.APIBase,
-				cfg.Providers.Ollama.APIKey, cfg.Providers.Ollama.Proxy), nil
+			return newOllamaProvider(cfg), nil
 		}
 	}
 
+	if strict && apiKey == "" && apiBase == "" {
+		return nil, fmt.Errorf("provider %q is unknown or not configured", providerName)
+	}
+
 	// Fallback: detect provider from model name
 	if apiKey == "" && apiBase == "" {
 		switch {
 		case strings.HasPrefix(model, "ollama/"):
 			// Use Ollama provider for ollama/ prefixed models
-			return NewOllamaProvider(cfg.Providers.Ollama.APIBase,
-				cfg.Providers.Ollama.APIKey, cfg.Providers.Ollama.Proxy), nil
+			return newOllamaProvider(cfg), nil
 
 		case (strings.Contains(lowerModel, "kimi") || strings.Contains(lowerModel, "moonshot") || strings.HasPrefix(model, "moonshot/")) && cfg.Providers.Moonshot.APIKey != "":
 			apiKey = cfg.Providers.Moonshot.APIKey
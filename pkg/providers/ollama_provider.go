@@ -20,6 +20,7 @@ type OllamaProvider struct {
 	apiBase    string
 	apiKey     string // Optional, for remote Ollama instances
 	httpClient *http.Client
+	queue      *RequestQueue // nil when requests are not limited
 }
 
 // NewOllamaProvider creates a new Ollama provider
@@ -49,6 +50,56 @@ func NewOllamaProvider(apiBase, apiKey, proxy string) *OllamaProvider {
 	}
 }
 
+// SetMaxConcurrent limits how many chat requests run at once; the rest
+// wait in priority order. 0 lets all through.
+func (p *OllamaProvider) SetMaxConcurrent(n int) {
+	p.queue = nil
+	if n > 0 {
+		p.queue = NewRequestQueue(n)
+	}
+}
+
+// ImageLimits returns what Ollama's vision models accept.
+func (p *OllamaProvider) ImageLimits() ImageLimits {
+	return ImageLimits{
+		Formats:      []string{"image/jpeg", "image/png"},
+		MaxBytes:     8 << 20,
+		MaxDimension: 1568,
+	}
+}
+
+// ModelCapabilities asks Ollama what model supports. Ollama lists a
+// model's capabilities in /api/show since 0.6.4; older versions don't say.
+func (p *OllamaProvider) ModelCapabilities(ctx context.Context, model string) (Capabilities, bool) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	body, _ := json.Marshal(map[string]string{"model": strings.TrimPrefix(model, "ollama/")})
+	req, err := http.NewRequestWithContext(ctx, "POST", p.apiBase+"/api/show", bytes.NewReader(body))
+	if err != nil {
+		return Capabilities{}, false
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return Capabilities{}, false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Capabilities{}, false
+	}
+
+	var show struct {
+		Capabilities []string `json:"capabilities"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&show); err != nil || len(show.Capabilities) == 0 {
+		return Capabilities{}, false
+	}
+	return ParseCapabilities(show.Capabilities), true
+}
+
 // Chat sends a chat request to Ollama using the OpenAI-compatible endpoint
 func (p *OllamaProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
 	// Strip ollama/ prefix from model name if present
@@ -58,7 +109,7 @@ func (p *OllamaProvider) Chat(ctx context.Context, messages []Message, tools []T
 
 	requestBody := map[string]interface{}{
 		"model":    model,
-		"messages": messages,
+		"messages": openAIMessages(messages),
 		"stream":   false,
 	}
 
@@ -80,6 +131,16 @@ func (p *OllamaProvider) Chat(ctx context.Context, messages []Message, tools []T
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
+	// A busy local model answers one request at a time; wait here, in
+	// priority order, rather than piling requests up against its timeout
+	if p.queue != nil {
+		release, err := p.queue.Acquire(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("waiting for the model: %w", err)
+		}
+		defer release()
+	}
+
 	// Use OpenAI-compatible endpoint
 	req, err := http.NewRequestWithContext(ctx, "POST", p.apiBase+"/v1/chat/completions", bytes.NewReader(jsonData))
 	if err != nil {
@@ -6,7 +6,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestOllamaProvider_InterfaceCompliance(t *testing.T) {
@@ -177,6 +179,42 @@ func TestOllamaProvider_Chat(t *testing.T) {
 	}
 }
 
+func TestOllamaProvider_ChatWithImage(t *testing.T) {
+	var parts []interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []struct {
+				Content interface{} `json:"content"`
+			} `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		parts, _ = req.Messages[len(req.Messages)-1].Content.([]interface{})
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": map[string]interface{}{"content": "A cat"}, "finish_reason": "stop"}},
+		})
+	}))
+	defer server.Close()
+
+	provider := NewOllamaProvider(server.URL, "", "")
+	var _ VisionProvider = provider
+	messages := []Message{
+		{Role: "system", Content: "You are helpful"},
+		{Role: "user", Content: "What is this?", Images: []Image{{MediaType: "image/png", Data: []byte("png")}}},
+	}
+	if _, err := provider.Chat(context.Background(), messages, nil, "llava", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(parts) != 2 {
+		t.Fatalf("got %d content parts, want text and image", len(parts))
+	}
+	image, _ := parts[1].(map[string]interface{})
+	url, _ := image["image_url"].(map[string]interface{})["url"].(string)
+	if url != "data:image/png;base64,cG5n" {
+		t.Errorf("got image url %q, want a base64 data URL", url)
+	}
+}
+
 func TestOllamaProvider_ListModels(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != "/api/tags" {
@@ -258,3 +296,70 @@ func TestOllamaProvider_GetDefaultModel(t *testing.T) {
 		t.Errorf("got default model %q, want %q", provider.GetDefaultModel(), "llama3.2")
 	}
 }
+
+// TestOllamaProvider_ModelCapabilities verifies capabilities are read from
+// /api/show, and that servers which don't list them leave it unknown.
+func TestOllamaProvider_ModelCapabilities(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model string `json:"model"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if r.URL.Path != "/api/show" {
+			t.Errorf("Expected /api/show, got %s", r.URL.Path)
+		}
+		if req.Model == "gemma3:4b" {
+			w.Write([]byte(`{"capabilities": ["completion", "vision"]}`))
+			return
+		}
+		w.Write([]byte(`{"modelfile": "..."}`))
+	}))
+	defer server.Close()
+
+	p := NewOllamaProvider(server.URL, "", "")
+	caps, ok := p.ModelCapabilities(context.Background(), "ollama/gemma3:4b")
+	if !ok || caps != (Capabilities{Vision: true}) {
+		t.Errorf("Expected vision without tools, got %+v (%v)", caps, ok)
+	}
+	if _, ok := p.ModelCapabilities(context.Background(), "old-model"); ok {
+		t.Error("Expected unknown capabilities for a server that doesn't list them")
+	}
+}
+
+// TestOllamaProvider_MaxConcurrent verifies requests beyond the limit wait
+// instead of reaching the server at the same time.
+func TestOllamaProvider_MaxConcurrent(t *testing.T) {
+	var mu sync.Mutex
+	active, peak := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		active++
+		peak = max(peak, active)
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		active--
+		mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": map[string]interface{}{"content": "ok"}, "finish_reason": "stop"}},
+		})
+	}))
+	defer server.Close()
+
+	provider := NewOllamaProvider(server.URL, "", "")
+	provider.SetMaxConcurrent(1)
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := provider.Chat(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil, "llama3.2", nil); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if peak != 1 {
+		t.Errorf("Expected at most 1 request at a time, got %d", peak)
+	}
+}
@@ -0,0 +1,30 @@
+package providers
+
+import "encoding/base64"
+
+// openAIMessages converts messages for OpenAI-compatible chat completion
+// APIs. Messages with images get a list of content parts with the images
+// as data URLs; the rest are sent as they are.
+func openAIMessages(messages []Message) []interface{} {
+	out := make([]interface{}, 0, len(messages))
+	for _, msg := range messages {
+		if len(msg.Images) == 0 {
+			out = append(out, msg)
+			continue
+		}
+		parts := []map[string]interface{}{{"type": "text", "text": msg.Content}}
+		for _, img := range msg.Images {
+			parts = append(parts, map[string]interface{}{
+				"type": "image_url",
+				"image_url": map[string]interface{}{
+					"url": "data:" + img.MediaType + ";base64," + base64.StdEncoding.EncodeToString(img.Data),
+				},
+			})
+		}
+		out = append(out, map[string]interface{}{
+			"role":    msg.Role,
+			"content": parts,
+		})
+	}
+	return out
+}
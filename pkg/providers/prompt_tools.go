@@ -0,0 +1,109 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// promptToolCall matches a tool call written out by a model without native
+// tool calling.
+var promptToolCall = regexp.MustCompile(`(?s)<tool_call>\s*(.*?)\s*</tool_call>`)
+
+var promptCallSeq atomic.Int64
+
+const promptToolsIntro = `
+
+## Tool Calling
+
+You can call tools. To call one, reply with one or more blocks of exactly this form and nothing after them:
+<tool_call>{"name": "tool_name", "arguments": {"param": "value"}}</tool_call>
+Each result comes back in the next message. When you have what you need, reply normally without tool_call blocks.
+
+Available tools:
+`
+
+// chatWithPromptTools emulates tool calling for models that don't support
+// it: the tools are described in the system prompt, earlier calls and
+// results are written into the conversation as text, and <tool_call>
+// blocks in the reply are returned as tool calls.
+func chatWithPromptTools(ctx context.Context, provider LLMProvider, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	resp, err := provider.Chat(ctx, promptToolMessages(messages, tools), nil, model, options)
+	if err != nil {
+		return nil, err
+	}
+	resp.Content, resp.ToolCalls = parsePromptToolCalls(resp.Content)
+	if len(resp.ToolCalls) > 0 {
+		resp.FinishReason = "tool_calls"
+	}
+	return resp, nil
+}
+
+// promptToolMessages rewrites messages for a model without tool calling.
+func promptToolMessages(messages []Message, tools []ToolDefinition) []Message {
+	var sb strings.Builder
+	sb.WriteString(promptToolsIntro)
+	for _, t := range tools {
+		params, _ := json.Marshal(t.Function.Parameters)
+		fmt.Fprintf(&sb, "- %s: %s\n  parameters: %s\n", t.Function.Name, t.Function.Description, params)
+	}
+
+	out := make([]Message, 0, len(messages)+1)
+	if len(messages) == 0 || messages[0].Role != "system" {
+		out = append(out, Message{Role: "system"})
+	}
+	names := make(map[string]string) // tool call ID -> tool name
+	for _, m := range messages {
+		switch {
+		case m.Role == "assistant" && len(m.ToolCalls) > 0:
+			var calls strings.Builder
+			calls.WriteString(m.Content)
+			for _, tc := range m.ToolCalls {
+				name, args := tc.Name, tc.Arguments
+				if name == "" && tc.Function != nil {
+					name = tc.Function.Name
+					json.Unmarshal([]byte(tc.Function.Arguments), &args)
+				}
+				names[tc.ID] = name
+				argsJSON, _ := json.Marshal(args)
+				fmt.Fprintf(&calls, "\n<tool_call>{\"name\": %q, \"arguments\": %s}</tool_call>", name, argsJSON)
+			}
+			m = Message{Role: "assistant", Content: strings.TrimSpace(calls.String())}
+		case m.Role == "tool":
+			m = Message{Role: "user", Content: fmt.Sprintf("Result of %s:\n%s", names[m.ToolCallID], m.Content)}
+		}
+		out = append(out, m)
+	}
+	out[0].Content += sb.String()
+	return out
+}
+
+// parsePromptToolCalls extracts <tool_call> blocks from content and returns
+// the remaining text and the calls. Blocks that aren't valid calls are left
+// in the text.
+func parsePromptToolCalls(content string) (string, []ToolCall) {
+	var calls []ToolCall
+	text := promptToolCall.ReplaceAllStringFunc(content, func(block string) string {
+		var call struct {
+			Name      string                 `json:"name"`
+			Arguments map[string]interface{} `json:"arguments"`
+		}
+		body := promptToolCall.FindStringSubmatch(block)[1]
+		if err := json.Unmarshal([]byte(body), &call); err != nil || call.Name == "" {
+			return block
+		}
+		if call.Arguments == nil {
+			call.Arguments = map[string]interface{}{}
+		}
+		calls = append(calls, ToolCall{
+			ID:        fmt.Sprintf("call_prompt_%d", promptCallSeq.Add(1)),
+			Name:      call.Name,
+			Arguments: call.Arguments,
+		})
+		return ""
+	})
+	return strings.TrimSpace(text), calls
+}
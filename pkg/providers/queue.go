@@ -0,0 +1,144 @@
+package providers
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// Priority orders requests waiting for a busy model. Higher goes first.
+type Priority int
+
+const (
+	PriorityBackground  Priority = iota // summaries, fact extraction, indexing
+	PriorityScheduled                   // heartbeat and scheduled jobs
+	PriorityInteractive                 // a user waiting for a reply
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityBackground:
+		return "background"
+	case PriorityScheduled:
+		return "scheduled"
+	default:
+		return "interactive"
+	}
+}
+
+type priorityKey struct{}
+type queueNotifyKey struct{}
+
+// WithPriority marks the requests made with ctx. Requests without a
+// priority are interactive.
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// PriorityFrom returns the priority of ctx.
+func PriorityFrom(ctx context.Context) Priority {
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok {
+		return p
+	}
+	return PriorityInteractive
+}
+
+// WithQueueNotify sets a function called with the request's place in line
+// (1 is next) when it has to wait for the model.
+func WithQueueNotify(ctx context.Context, notify func(position int)) context.Context {
+	return context.WithValue(ctx, queueNotifyKey{}, notify)
+}
+
+// RequestQueue lets a limited number of requests use a model at once. The
+// others wait in priority order, first come first served within a
+// priority, so an interactive turn is not stuck behind background work.
+type RequestQueue struct {
+	mu      sync.Mutex
+	slots   int
+	active  int
+	waiting []*queueWaiter
+	seq     uint64
+}
+
+type queueWaiter struct {
+	priority Priority
+	seq      uint64
+	ready    chan struct{}
+}
+
+// NewRequestQueue allows slots requests at once.
+func NewRequestQueue(slots int) *RequestQueue {
+	if slots < 1 {
+		slots = 1
+	}
+	return &RequestQueue{slots: slots}
+}
+
+// Acquire waits for a slot and returns the function that gives it back.
+// It fails only when ctx is done first.
+func (q *RequestQueue) Acquire(ctx context.Context) (func(), error) {
+	q.mu.Lock()
+	if q.active < q.slots && len(q.waiting) == 0 {
+		q.active++
+		q.mu.Unlock()
+		return q.release, nil
+	}
+	q.seq++
+	w := &queueWaiter{priority: PriorityFrom(ctx), seq: q.seq, ready: make(chan struct{})}
+	i := sort.Search(len(q.waiting), func(i int) bool {
+		return q.waiting[i].priority < w.priority
+	})
+	q.waiting = append(q.waiting, nil)
+	copy(q.waiting[i+1:], q.waiting[i:])
+	q.waiting[i] = w
+	q.mu.Unlock()
+
+	if notify, ok := ctx.Value(queueNotifyKey{}).(func(int)); ok {
+		notify(i + 1)
+	}
+
+	select {
+	case <-w.ready:
+		return q.release, nil
+	case <-ctx.Done():
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		select {
+		case <-w.ready:
+			// Granted as ctx ended; pass the slot on
+			q.releaseLocked()
+		default:
+			for j, other := range q.waiting {
+				if other == w {
+					q.waiting = append(q.waiting[:j], q.waiting[j+1:]...)
+					break
+				}
+			}
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// Waiting returns how many requests are waiting.
+func (q *RequestQueue) Waiting() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.waiting)
+}
+
+func (q *RequestQueue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.releaseLocked()
+}
+
+// releaseLocked hands the slot to the first waiter, or frees it.
+func (q *RequestQueue) releaseLocked() {
+	if len(q.waiting) == 0 {
+		q.active--
+		return
+	}
+	next := q.waiting[0]
+	q.waiting = q.waiting[1:]
+	close(next.ready)
+}
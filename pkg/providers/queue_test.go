@@ -0,0 +1,105 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitFor polls until q has n waiting requests.
+func waitFor(t *testing.T, q *RequestQueue, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for q.Waiting() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d waiting requests, got %d", n, q.Waiting())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestRequestQueue_Priority verifies waiting requests get the slot by
+// priority, in arrival order within one, and are told their place.
+func TestRequestQueue_Priority(t *testing.T) {
+	q := NewRequestQueue(1)
+	release, err := q.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var order []string
+	positions := map[string]int{}
+	var wg sync.WaitGroup
+	enqueue := func(name string, p Priority) {
+		wg.Add(1)
+		ctx := WithQueueNotify(WithPriority(context.Background(), p), func(position int) {
+			mu.Lock()
+			positions[name] = position
+			mu.Unlock()
+		})
+		go func() {
+			defer wg.Done()
+			release, err := q.Acquire(ctx)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+			release()
+		}()
+	}
+	enqueue("index", PriorityBackground)
+	waitFor(t, q, 1)
+	enqueue("cron", PriorityScheduled)
+	waitFor(t, q, 2)
+	enqueue("user1", PriorityInteractive)
+	waitFor(t, q, 3)
+	enqueue("user2", PriorityInteractive)
+	waitFor(t, q, 4)
+
+	release()
+	wg.Wait()
+	want := []string{"user1", "user2", "cron", "index"}
+	for i := range want {
+		if i >= len(order) || order[i] != want[i] {
+			t.Fatalf("Expected order %v, got %v", want, order)
+		}
+	}
+	if positions["user1"] != 1 || positions["user2"] != 2 || positions["cron"] != 1 {
+		t.Errorf("Expected positions user1=1 user2=2 cron=1, got %v", positions)
+	}
+}
+
+// TestRequestQueue_Cancel verifies a request that gives up leaves the
+// line, and the slot still passes on.
+func TestRequestQueue_Cancel(t *testing.T) {
+	q := NewRequestQueue(1)
+	release, _ := q.Acquire(context.Background())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := q.Acquire(ctx)
+		done <- err
+	}()
+	waitFor(t, q, 1)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if q.Waiting() != 0 {
+		t.Errorf("Expected the canceled request to leave the line, got %d waiting", q.Waiting())
+	}
+
+	release()
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := q.Acquire(ctx); err != nil {
+		t.Errorf("Expected the free slot to be taken, got %v", err)
+	}
+}
@@ -0,0 +1,304 @@
+package providers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// SchemaLevel says how much of the tool schemas is sent to a model. Tool
+// schemas go with every request and can take a large part of a small
+// model's context.
+type SchemaLevel string
+
+const (
+	// SchemaFull sends the schemas as the tools define them.
+	SchemaFull SchemaLevel = "full"
+	// SchemaCompact cuts descriptions to their first sentence, drops
+	// annotations models don't use, and shares sub-schemas repeated within
+	// a tool through $defs.
+	SchemaCompact SchemaLevel = "compact"
+	// SchemaMinimal is SchemaCompact without parameter descriptions.
+	SchemaMinimal SchemaLevel = "minimal"
+)
+
+// ParseSchemaLevel reads a configured level. "auto" and "" return "", which
+// SchemaLevelFor resolves per model.
+func ParseSchemaLevel(s string) (SchemaLevel, error) {
+	switch level := SchemaLevel(strings.ToLower(strings.TrimSpace(s))); level {
+	case "", "auto":
+		return "", nil
+	case SchemaFull, SchemaCompact, SchemaMinimal:
+		return level, nil
+	default:
+		return "", fmt.Errorf("unknown tool schema level %q (want auto, full, compact or minimal)", s)
+	}
+}
+
+// compactSchemaModels are model families, matched against the lower-cased
+// model name, that call tools reliably from short schemas.
+var compactSchemaModels = []string{
+	"claude", "gpt-4", "gpt-5", "o3", "o4",
+	"qwen2.5", "qwen3", "llama3.1", "llama3.3",
+	"mistral-large", "deepseek-v3", "deepseek-chat",
+	"glm-4.5", "glm-4.6", "glm-4.7", "kimi",
+}
+
+// SchemaLevelFor returns the level for model: configured if set, otherwise
+// compact for the families known to cope and full for the rest.
+func SchemaLevelFor(configured SchemaLevel, model string) SchemaLevel {
+	if configured != "" {
+		return configured
+	}
+	name := strings.ToLower(model)
+	for _, family := range compactSchemaModels {
+		if strings.Contains(name, family) {
+			return SchemaCompact
+		}
+	}
+	return SchemaFull
+}
+
+// EstimateToolTokens estimates the tokens the tool definitions take in a
+// request, at four characters per token.
+func EstimateToolTokens(tools []ToolDefinition) int {
+	total := 0
+	for _, t := range tools {
+		data, _ := json.Marshal(t)
+		total += len(data) / 4
+	}
+	return total
+}
+
+// CompactTools returns the tools with their schemas reduced to level. The
+// tools passed in are not changed.
+func CompactTools(tools []ToolDefinition, level SchemaLevel) []ToolDefinition {
+	if level != SchemaCompact && level != SchemaMinimal {
+		return tools
+	}
+	out := make([]ToolDefinition, len(tools))
+	for i, t := range tools {
+		out[i] = t
+		out[i].Function.Description = firstSentence(t.Function.Description)
+		if t.Function.Parameters != nil {
+			params, _ := compactSchema(t.Function.Parameters, level).(map[string]interface{})
+			shareRepeated(params)
+			out[i].Function.Parameters = params
+		}
+	}
+	return out
+}
+
+// schemaNoise are annotations models don't need to call a tool.
+var schemaNoise = []string{"title", "examples", "example", "$comment", "$schema"}
+
+// schemaKeys hold sub-schemas; other keys (enum, default, ...) hold values
+// that are copied as they are.
+var schemaKeys = map[string]bool{
+	"items": true, "additionalProperties": true, "not": true,
+	"anyOf": true, "oneOf": true, "allOf": true,
+}
+
+// compactSchema copies a schema, shortening or dropping descriptions on the
+// way down.
+func compactSchema(node interface{}, level SchemaLevel) interface{} {
+	v, ok := node.(map[string]interface{})
+	if !ok {
+		if list, isList := node.([]interface{}); isList {
+			// anyOf and friends
+			out := make([]interface{}, len(list))
+			for i, item := range list {
+				out[i] = compactSchema(item, level)
+			}
+			return out
+		}
+		return copyValue(node)
+	}
+
+	out := make(map[string]interface{}, len(v))
+	for key, value := range v {
+		switch {
+		case key == "properties" || key == "$defs" || key == "definitions":
+			props, ok := value.(map[string]interface{})
+			if !ok {
+				out[key] = copyValue(value)
+				continue
+			}
+			compacted := make(map[string]interface{}, len(props))
+			for name, prop := range props {
+				compacted[name] = compactSchema(prop, level)
+			}
+			out[key] = compacted
+		case key == "description":
+			if s, ok := value.(string); ok && level != SchemaMinimal {
+				out[key] = firstSentence(s)
+			}
+		case schemaKeys[key]:
+			out[key] = compactSchema(value, level)
+		default:
+			out[key] = copyValue(value)
+		}
+	}
+	for _, key := range schemaNoise {
+		delete(out, key)
+	}
+	return out
+}
+
+// copyValue deep-copies a JSON value.
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			out[key] = copyValue(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = copyValue(item)
+		}
+		return out
+	default:
+		return value
+	}
+}
+
+// firstSentence cuts a description at the end of its first sentence or
+// paragraph.
+func firstSentence(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.Index(s, "\n\n"); i > 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	for i := 0; i < len(s)-1; i++ {
+		if (s[i] != '.' && s[i] != '!' && s[i] != '?') || (s[i+1] != ' ' && s[i+1] != '\n') {
+			continue
+		}
+		rest := strings.TrimLeft(s[i+1:], " \n")
+		if rest != "" && unicode.IsUpper([]rune(rest)[0]) {
+			return s[:i+1]
+		}
+	}
+	return s
+}
+
+// minSharedSchema is the size in bytes of JSON below which a repeated
+// sub-schema is cheaper inline than as a $ref.
+const minSharedSchema = 80
+
+// shareRepeated moves object sub-schemas that appear more than once in a
+// tool's parameters to $defs, largest first, and refers to them by $ref.
+func shareRepeated(params map[string]interface{}) {
+	if params == nil {
+		return
+	}
+	for {
+		counts := map[string]int{}
+		examples := map[string]string{} // canonical JSON -> a property name it appears under
+		countSubschemas(params, "", counts, examples)
+
+		var best string
+		for schema, count := range counts {
+			if count > 1 && len(schema) >= minSharedSchema && len(schema) > len(best) {
+				best = schema
+			}
+		}
+		if best == "" {
+			return
+		}
+
+		defs, _ := params["$defs"].(map[string]interface{})
+		if defs == nil {
+			defs = map[string]interface{}{}
+			params["$defs"] = defs
+		}
+		name := examples[best]
+		for i := 2; defs[name] != nil; i++ {
+			name = fmt.Sprintf("%s%d", examples[best], i)
+		}
+		var def interface{}
+		json.Unmarshal([]byte(best), &def)
+		defs[name] = def
+		replaceSubschema(params, best, map[string]interface{}{"$ref": "#/$defs/" + name})
+	}
+}
+
+// countSubschemas counts the object schemas below node by their canonical
+// JSON, skipping node itself and $defs.
+func countSubschemas(node interface{}, name string, counts map[string]int, names map[string]string) {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		if name != "" && v["type"] == "object" {
+			data, _ := json.Marshal(v)
+			counts[string(data)]++
+			if _, ok := names[string(data)]; !ok {
+				names[string(data)] = name
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys) // deterministic names for shared schemas
+		for _, key := range keys {
+			switch key {
+			case "$defs":
+			case "properties":
+				if props, ok := v[key].(map[string]interface{}); ok {
+					propNames := make([]string, 0, len(props))
+					for prop := range props {
+						propNames = append(propNames, prop)
+					}
+					sort.Strings(propNames)
+					for _, prop := range propNames {
+						countSubschemas(props[prop], prop, counts, names)
+					}
+				}
+			default:
+				childName := name
+				if childName == "" {
+					childName = key
+				}
+				countSubschemas(v[key], childName, counts, names)
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			countSubschemas(item, name, counts, names)
+		}
+	}
+}
+
+// replaceSubschema replaces every schema below node whose canonical JSON is
+// target with ref.
+func replaceSubschema(node interface{}, target string, ref map[string]interface{}) {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if key == "$defs" {
+				continue
+			}
+			if m, ok := child.(map[string]interface{}); ok {
+				if data, _ := json.Marshal(m); string(data) == target {
+					v[key] = ref
+					continue
+				}
+			}
+			replaceSubschema(child, target, ref)
+		}
+	case []interface{}:
+		for i, child := range v {
+			if m, ok := child.(map[string]interface{}); ok {
+				if data, _ := json.Marshal(m); string(data) == target {
+					v[i] = ref
+					continue
+				}
+			}
+			replaceSubschema(child, target, ref)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package providers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func pointSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type":        "object",
+		"description": "A point on the map. Coordinates are WGS84.",
+		"properties": map[string]interface{}{
+			"lat": map[string]interface{}{"type": "number", "description": "Latitude in degrees."},
+			"lon": map[string]interface{}{"type": "number", "description": "Longitude in degrees."},
+		},
+		"required": []interface{}{"lat", "lon"},
+	}
+}
+
+func routeTool() ToolDefinition {
+	return ToolDefinition{Type: "function", Function: ToolFunctionDefinition{
+		Name:        "route",
+		Description: "Plan a route between two points. Uses the configured map service, e.g. OSRM.\n\nReturns distance and duration.",
+		Parameters: map[string]interface{}{
+			"type":  "object",
+			"title": "RouteArgs",
+			"properties": map[string]interface{}{
+				"from": pointSchema(),
+				"to":   pointSchema(),
+				"mode": map[string]interface{}{
+					"type":        "string",
+					"description": "How to travel.",
+					"enum":        []interface{}{"car", "bike"},
+					"examples":    []interface{}{"car"},
+				},
+			},
+			"required": []interface{}{"from", "to"},
+		},
+	}}
+}
+
+// TestCompactTools_Compact verifies descriptions are cut to their first
+// sentence, annotations are dropped and repeated sub-schemas are shared,
+// without changing the tools passed in.
+func TestCompactTools_Compact(t *testing.T) {
+	tools := []ToolDefinition{routeTool()}
+	before, _ := json.Marshal(tools)
+
+	got := CompactTools(tools, SchemaCompact)
+	if after, _ := json.Marshal(tools); string(after) != string(before) {
+		t.Error("Expected the original tools to be unchanged")
+	}
+
+	fn := got[0].Function
+	if fn.Description != "Plan a route between two points." {
+		t.Errorf("Expected the first sentence, got %q", fn.Description)
+	}
+	props := fn.Parameters["properties"].(map[string]interface{})
+	if _, ok := fn.Parameters["title"]; ok {
+		t.Error("Expected the title to be dropped")
+	}
+	mode := props["mode"].(map[string]interface{})
+	if _, ok := mode["examples"]; ok || mode["description"] != "How to travel." || len(mode["enum"].([]interface{})) != 2 {
+		t.Errorf("Expected mode without examples but with its description and enum, got %v", mode)
+	}
+	if props["from"].(map[string]interface{})["$ref"] != "#/$defs/from" || props["to"].(map[string]interface{})["$ref"] != "#/$defs/from" {
+		t.Errorf("Expected from and to to share one definition, got %v and %v", props["from"], props["to"])
+	}
+	def := fn.Parameters["$defs"].(map[string]interface{})["from"].(map[string]interface{})
+	if def["description"] != "A point on the map." {
+		t.Errorf("Expected the shared definition to be compacted, got %v", def)
+	}
+
+	if EstimateToolTokens(got) >= EstimateToolTokens(tools) {
+		t.Errorf("Expected fewer tokens, got %d from %d", EstimateToolTokens(got), EstimateToolTokens(tools))
+	}
+}
+
+// TestCompactTools_Minimal verifies parameter descriptions are dropped but
+// the tool keeps a short description.
+func TestCompactTools_Minimal(t *testing.T) {
+	got := CompactTools([]ToolDefinition{routeTool()}, SchemaMinimal)
+	data, _ := json.Marshal(got[0].Function.Parameters)
+	if strings.Contains(string(data), "description") {
+		t.Errorf("Expected no parameter descriptions, got %s", data)
+	}
+	if got[0].Function.Description != "Plan a route between two points." {
+		t.Errorf("Expected the tool's first sentence, got %q", got[0].Function.Description)
+	}
+
+	full := []ToolDefinition{routeTool()}
+	if same := CompactTools(full, SchemaFull); EstimateToolTokens(same) != EstimateToolTokens(full) {
+		t.Error("Expected full schemas to be sent unchanged")
+	}
+}
+
+// TestSchemaLevelFor verifies models known to cope get compact schemas by
+// default, and a configured level wins.
+func TestSchemaLevelFor(t *testing.T) {
+	tests := []struct {
+		configured SchemaLevel
+		model      string
+		want       SchemaLevel
+	}{
+		{"", "claude-sonnet-4", SchemaCompact},
+		{"", "qwen2.5:7b", SchemaCompact},
+		{"", "phi3:mini", SchemaFull},
+		{SchemaMinimal, "phi3:mini", SchemaMinimal},
+		{SchemaFull, "gpt-4o", SchemaFull},
+	}
+	for _, tt := range tests {
+		if got := SchemaLevelFor(tt.configured, tt.model); got != tt.want {
+			t.Errorf("Expected %q for %q with %q, got %q", tt.want, tt.model, tt.configured, got)
+		}
+	}
+
+	if level, err := ParseSchemaLevel("auto"); err != nil || level != "" {
+		t.Errorf("Expected auto to choose per model, got %q, %v", level, err)
+	}
+	if _, err := ParseSchemaLevel("tiny"); err == nil {
+		t.Error("Expected an error for an unknown level")
+	}
+}
+
+// TestFirstSentence verifies abbreviations and lower-case continuations
+// don't end the sentence.
+func TestFirstSentence(t *testing.T) {
+	tests := map[string]string{
+		"Read a file. Paths are relative.":       "Read a file.",
+		"Use e.g. a glob. Then filter.":          "Use e.g. a glob.",
+		"Run a command\n\nDetails follow.":       "Run a command",
+		"Version 1.2 only":                       "Version 1.2 only",
+		"Stop! Really.":                          "Stop!",
+		"Fetch a URL.\nReturns the page as text": "Fetch a URL.",
+	}
+	for in, want := range tests {
+		if got := firstSentence(in); got != want {
+			t.Errorf("Expected %q for %q, got %q", want, in, got)
+		}
+	}
+}
@@ -33,6 +33,28 @@ type Message struct {
 	Content    string     `json:"content"`
 	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
 	ToolCallID string     `json:"tool_call_id,omitempty"`
+	// Images attached to a user message. They are sent only with the
+	// current turn and never stored in the session.
+	Images []Image `json:"-"`
+}
+
+// Image is an image prepared for a vision model.
+type Image struct {
+	MediaType string // e.g. "image/jpeg"
+	Data      []byte
+}
+
+// ImageLimits describes the images a provider accepts.
+type ImageLimits struct {
+	Formats      []string // accepted media types
+	MaxBytes     int64    // per image
+	MaxDimension int      // longest edge in pixels
+}
+
+// VisionProvider is implemented by providers that can send images to the
+// model. Images are only attached for providers that implement it.
+type VisionProvider interface {
+	ImageLimits() ImageLimits
 }
 
 type LLMProvider interface {
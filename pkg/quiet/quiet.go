@@ -0,0 +1,327 @@
+// Package quiet holds proactive messages (heartbeat alerts, scheduled jobs,
+// device events) while a user has quiet hours or do-not-disturb on, and
+// releases them as one digest when the quiet time ends. Messages urgent
+// enough for the user's break-through level are never held.
+package quiet
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// Rule is a daily quiet window and the lowest urgency that is delivered
+// during it anyway.
+type Rule struct {
+	start, end   int // minutes after midnight; equal means no window
+	loc          *time.Location
+	BreakThrough bus.Urgency
+}
+
+// ParseRule reads a window given as "HH:MM" times in timezone (the host's
+// if empty). Empty start and end give a rule with no window, which still
+// sets the break-through level for do-not-disturb.
+func ParseRule(start, end, timezone, breakThrough string) (Rule, error) {
+	r := Rule{loc: time.Local, BreakThrough: bus.UrgencyHigh}
+	if timezone != "" {
+		loc, err := time.LoadLocation(timezone)
+		if err != nil {
+			return r, fmt.Errorf("timezone: %w", err)
+		}
+		r.loc = loc
+	}
+	if breakThrough != "" {
+		u, ok := bus.ParseUrgency(breakThrough)
+		if !ok {
+			return r, fmt.Errorf("break_through %q: use low, normal, high or critical", breakThrough)
+		}
+		r.BreakThrough = u
+	}
+	if start == "" && end == "" {
+		return r, nil
+	}
+	var err error
+	if r.start, err = parseClock(start); err != nil {
+		return r, fmt.Errorf("start: %w", err)
+	}
+	if r.end, err = parseClock(end); err != nil {
+		return r, fmt.Errorf("end: %w", err)
+	}
+	return r, nil
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("%q is not HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// quietUntil reports whether now falls in the window and, if so, when the
+// window ends.
+func (r Rule) quietUntil(now time.Time) (time.Time, bool) {
+	if r.start == r.end {
+		return time.Time{}, false
+	}
+	local := now.In(r.loc)
+	m := local.Hour()*60 + local.Minute()
+	var quiet bool
+	if r.start < r.end {
+		quiet = m >= r.start && m < r.end
+	} else {
+		// Wraps past midnight, e.g. 22:00-07:00
+		quiet = m >= r.start || m < r.end
+	}
+	if !quiet {
+		return time.Time{}, false
+	}
+	end := time.Date(local.Year(), local.Month(), local.Day(), r.end/60, r.end%60, 0, 0, r.loc)
+	if !end.After(local) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return end, true
+}
+
+// Window describes the rule, e.g. "22:00-07:00 Europe/Paris".
+func (r Rule) Window() string {
+	if r.start == r.end {
+		return "none"
+	}
+	return fmt.Sprintf("%02d:%02d-%02d:%02d %s", r.start/60, r.start%60, r.end/60, r.end%60, r.loc)
+}
+
+// Held is a message waiting for its user's quiet time to end.
+type Held struct {
+	Message bus.OutboundMessage `json:"message"`
+	Queued  time.Time           `json:"queued"`
+}
+
+type state struct {
+	DND  map[string]time.Time `json:"dnd,omitempty"` // user -> do not disturb until
+	Held []Held               `json:"held,omitempty"`
+}
+
+// Hours applies quiet hours and do-not-disturb to outbound messages. Users
+// are identified as "channel:chat_id", the chat proactive messages go to.
+type Hours struct {
+	path  string
+	def   Rule
+	users map[string]Rule
+	mu    sync.Mutex
+	state state
+}
+
+// New builds the policy from cfg and loads held messages and do-not-disturb
+// settings from stateDir. Invalid rules are logged and ignored. With quiet
+// hours disabled, only /dnd holds messages.
+func New(cfg config.QuietHoursConfig, stateDir string) *Hours {
+	h := &Hours{
+		path:  filepath.Join(stateDir, "quiet.json"),
+		users: make(map[string]Rule),
+	}
+	h.def, _ = ParseRule("", "", cfg.Timezone, cfg.BreakThrough)
+	if cfg.Enabled {
+		rule, err := ParseRule(cfg.Start, cfg.End, cfg.Timezone, cfg.BreakThrough)
+		if err != nil {
+			logger.WarnCF("quiet", "Invalid quiet hours, ignoring them", map[string]interface{}{"error": err.Error()})
+		} else {
+			h.def = rule
+		}
+		for user, u := range cfg.Users {
+			rule, err := ParseRule(or(u.Start, cfg.Start), or(u.End, cfg.End), or(u.Timezone, cfg.Timezone), or(u.BreakThrough, cfg.BreakThrough))
+			if err != nil {
+				logger.WarnCF("quiet", "Invalid quiet hours for user, using the defaults",
+					map[string]interface{}{"user": user, "error": err.Error()})
+				continue
+			}
+			h.users[user] = rule
+		}
+	}
+	if data, err := os.ReadFile(h.path); err == nil {
+		json.Unmarshal(data, &h.state)
+	}
+	return h
+}
+
+func or(value, fallback string) string {
+	if value != "" {
+		return value
+	}
+	return fallback
+}
+
+// User returns the key quiet hours are kept under for a chat.
+func User(channel, chatID string) string {
+	return channel + ":" + chatID
+}
+
+func (h *Hours) rule(user string) Rule {
+	if r, ok := h.users[user]; ok {
+		return r
+	}
+	return h.def
+}
+
+// quietUntilLocked reports whether user is in quiet time at now and until
+// when: the later of the do-not-disturb end and the quiet window end.
+func (h *Hours) quietUntilLocked(user string, now time.Time) (time.Time, bool) {
+	until, quiet := h.rule(user).quietUntil(now)
+	if dnd, ok := h.state.DND[user]; ok && now.Before(dnd) {
+		if !quiet || dnd.After(until) {
+			until = dnd
+		}
+		quiet = true
+	}
+	return until, quiet
+}
+
+// Hold keeps msg for later if it is proactive, its user is in quiet time
+// and it is not urgent enough to break through. It reports whether it did.
+func (h *Hours) Hold(msg bus.OutboundMessage, now time.Time) bool {
+	if msg.Urgency.Rank() == 0 {
+		return false
+	}
+	user := User(msg.Channel, msg.ChatID)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, quiet := h.quietUntilLocked(user, now); !quiet {
+		return false
+	}
+	if msg.Urgency.Rank() >= h.rule(user).BreakThrough.Rank() {
+		return false
+	}
+	h.state.Held = append(h.state.Held, Held{Message: msg, Queued: now})
+	if err := h.saveLocked(); err != nil {
+		logger.WarnCF("quiet", "Failed to save held message", map[string]interface{}{"error": err.Error()})
+	}
+	return true
+}
+
+// Release removes the messages of users whose quiet time is over and
+// returns them, one digest per chat in the order they were held.
+func (h *Hours) Release(now time.Time) []bus.OutboundMessage {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	byUser := make(map[string][]Held)
+	var order []string
+	kept := h.state.Held[:0]
+	for _, held := range h.state.Held {
+		user := User(held.Message.Channel, held.Message.ChatID)
+		if _, quiet := h.quietUntilLocked(user, now); quiet {
+			kept = append(kept, held)
+			continue
+		}
+		if _, ok := byUser[user]; !ok {
+			order = append(order, user)
+		}
+		byUser[user] = append(byUser[user], held)
+	}
+	if len(order) == 0 {
+		return nil
+	}
+	h.state.Held = kept
+	for user, until := range h.state.DND {
+		if !now.Before(until) {
+			delete(h.state.DND, user)
+		}
+	}
+	if err := h.saveLocked(); err != nil {
+		logger.WarnCF("quiet", "Failed to save quiet hours state", map[string]interface{}{"error": err.Error()})
+	}
+
+	released := make([]bus.OutboundMessage, 0, len(order))
+	for _, user := range order {
+		released = append(released, digest(byUser[user]))
+	}
+	return released
+}
+
+// digest combines a chat's held messages into one.
+func digest(held []Held) bus.OutboundMessage {
+	msg := held[0].Message
+	msg.Urgency = ""
+	if len(held) == 1 {
+		return msg
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d messages held during quiet hours:", len(held))
+	msg.Media = nil
+	for _, h := range held {
+		fmt.Fprintf(&sb, "\n\n[%s] %s", h.Queued.Format("15:04"), h.Message.Content)
+		msg.Media = append(msg.Media, h.Message.Media...)
+	}
+	msg.Content = sb.String()
+	return msg
+}
+
+// SetDND turns do-not-disturb on for user until the given time, or off if
+// until is zero. Held messages are released on the next Release.
+func (h *Hours) SetDND(user string, until time.Time) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.state.DND == nil {
+		h.state.DND = make(map[string]time.Time)
+	}
+	if until.IsZero() {
+		delete(h.state.DND, user)
+	} else {
+		h.state.DND[user] = until
+	}
+	return h.saveLocked()
+}
+
+// Location returns the time zone of user's quiet hours.
+func (h *Hours) Location(user string) *time.Location {
+	return h.rule(user).loc
+}
+
+// Status describes user's quiet hours for a chat reply.
+func (h *Hours) Status(user string, now time.Time) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	rule := h.rule(user)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Quiet hours: %s. Alerts of %s urgency or above always come through.", rule.Window(), rule.BreakThrough)
+	if dnd, ok := h.state.DND[user]; ok && now.Before(dnd) {
+		fmt.Fprintf(&sb, "\nDo not disturb until %s.", dnd.In(rule.loc).Format("Mon 15:04"))
+	} else if until, quiet := h.quietUntilLocked(user, now); quiet {
+		fmt.Fprintf(&sb, "\nQuiet now, until %s.", until.In(rule.loc).Format("15:04"))
+	}
+	held := 0
+	for _, m := range h.state.Held {
+		if User(m.Message.Channel, m.Message.ChatID) == user {
+			held++
+		}
+	}
+	if held > 0 {
+		fmt.Fprintf(&sb, "\n%d message(s) held.", held)
+	}
+	return sb.String()
+}
+
+func (h *Hours) saveLocked() error {
+	if err := os.MkdirAll(filepath.Dir(h.path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(h.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := h.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, h.path)
+}
@@ -0,0 +1,75 @@
+package quiet
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// TestHours_HoldAndRelease verifies proactive messages wait out a window
+// that wraps past midnight, urgent ones and replies break through, and held
+// messages come back as one digest per chat.
+func TestHours_HoldAndRelease(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.QuietHoursConfig{
+		Enabled: true, Start: "22:00", End: "07:00", Timezone: "UTC", BreakThrough: "high",
+		Users: map[string]config.QuietHoursRule{"telegram:2": {Start: "01:00", End: "02:00"}},
+	}
+	h := New(cfg, dir)
+	night := time.Date(2026, 10, 17, 23, 30, 0, 0, time.UTC)
+
+	briefing := bus.OutboundMessage{Channel: "telegram", ChatID: "1", Content: "Briefing", Urgency: bus.UrgencyLow}
+	alert := bus.OutboundMessage{Channel: "telegram", ChatID: "1", Content: "Disk full", Urgency: bus.UrgencyNormal}
+	storm := bus.OutboundMessage{Channel: "telegram", ChatID: "1", Content: "Storm warning", Urgency: bus.UrgencyCritical}
+	reply := bus.OutboundMessage{Channel: "telegram", ChatID: "1", Content: "Sure"}
+	other := bus.OutboundMessage{Channel: "telegram", ChatID: "2", Content: "Disk full", Urgency: bus.UrgencyNormal}
+
+	if !h.Hold(briefing, night) || !h.Hold(alert, night.Add(time.Minute)) {
+		t.Fatal("Expected low and normal messages to be held at night")
+	}
+	if h.Hold(storm, night) || h.Hold(reply, night) {
+		t.Error("Expected critical messages and replies to be delivered")
+	}
+	if h.Hold(other, night) {
+		t.Error("Expected the per-user window (01:00-02:00) to apply to chat 2")
+	}
+
+	if released := New(cfg, dir).Release(night.Add(4 * time.Hour)); len(released) != 0 {
+		t.Fatalf("Expected nothing released before 07:00, got %d", len(released))
+	}
+	released := New(cfg, dir).Release(time.Date(2026, 10, 18, 7, 0, 0, 0, time.UTC))
+	if len(released) != 1 {
+		t.Fatalf("Expected one digest after 07:00, got %d", len(released))
+	}
+	digest := released[0]
+	if digest.Urgency != "" || !strings.Contains(digest.Content, "2 messages held") ||
+		strings.Index(digest.Content, "Briefing") > strings.Index(digest.Content, "Disk full") {
+		t.Errorf("Expected both messages in order, got %q", digest.Content)
+	}
+}
+
+// TestHours_DND verifies do-not-disturb holds messages outside quiet hours
+// until it ends, and that turning it off releases them.
+func TestHours_DND(t *testing.T) {
+	h := New(config.QuietHoursConfig{BreakThrough: "critical"}, t.TempDir())
+	noon := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	msg := bus.OutboundMessage{Channel: "telegram", ChatID: "1", Content: "Rain later", Urgency: bus.UrgencyHigh}
+
+	if h.Hold(msg, noon) {
+		t.Fatal("Expected no holding without quiet hours or do-not-disturb")
+	}
+	h.SetDND("telegram:1", noon.Add(2*time.Hour))
+	if !h.Hold(msg, noon) {
+		t.Fatal("Expected a high message held under do-not-disturb with break_through critical")
+	}
+	if len(h.Release(noon.Add(time.Hour))) != 0 {
+		t.Error("Expected nothing released while do-not-disturb is on")
+	}
+	h.SetDND("telegram:1", time.Time{})
+	if released := h.Release(noon.Add(time.Hour)); len(released) != 1 || released[0].Content != "Rain later" {
+		t.Errorf("Expected the message released as is, got %+v", released)
+	}
+}
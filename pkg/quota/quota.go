@@ -0,0 +1,265 @@
+// Package quota tracks how much disk space picoclaw uses in the workspace,
+// its caches and downloaded attachments, and keeps it under a configured
+// limit by evicting the oldest cache and attachment files first.
+package quota
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// ErrExceeded is returned by Reserve when a write would not fit even after
+// evicting every evictable file.
+var ErrExceeded = errors.New("disk quota exceeded")
+
+// rescanInterval is how long a scan is trusted before the disk is walked
+// again. Reservations are added to it in between.
+const rescanInterval = time.Minute
+
+// Area is a directory counted against the quota. Files in an evictable
+// area may be deleted to make room; the rest of the workspace never is.
+type Area struct {
+	Name      string
+	Path      string
+	Evictable bool
+}
+
+// AreaUsage is the space used by one area.
+type AreaUsage struct {
+	Area
+	Bytes int64
+	Files int
+}
+
+// Report is the result of a scan.
+type Report struct {
+	Areas []AreaUsage
+	Total int64
+	Limit int64
+}
+
+// Percent returns the share of the limit in use, or 0 without a limit.
+func (r Report) Percent() int {
+	if r.Limit <= 0 {
+		return 0
+	}
+	return int(r.Total * 100 / r.Limit)
+}
+
+// String renders the report one area per line, e.g. for picoclaw status.
+func (r Report) String() string {
+	s := fmt.Sprintf("%s of %s (%d%%)", FormatBytes(r.Total), FormatBytes(r.Limit), r.Percent())
+	for _, a := range r.Areas {
+		s += fmt.Sprintf("\n  %-12s %s in %d files", a.Name, FormatBytes(a.Bytes), a.Files)
+	}
+	return s
+}
+
+// Manager enforces a disk quota over a set of areas. A nil *Manager allows
+// everything, so callers don't need to check whether a quota is configured.
+type Manager struct {
+	limit   int64
+	warnAt  int64
+	areas   []Area
+	mu      sync.Mutex
+	used    int64
+	scanned time.Time
+	warned  bool
+}
+
+// New returns a manager keeping areas under limit bytes and warning once
+// usage reaches warnPercent of it (90 if warnPercent is not in 1..99).
+// Areas nested in another area are only counted once, in the inner one.
+func New(limit int64, warnPercent int, areas ...Area) *Manager {
+	if warnPercent <= 0 || warnPercent >= 100 {
+		warnPercent = 90
+	}
+	return &Manager{
+		limit:  limit,
+		warnAt: limit * int64(warnPercent) / 100,
+		areas:  areas,
+	}
+}
+
+// Scan walks every area and returns what it uses.
+func (m *Manager) Scan() Report {
+	if m == nil {
+		return Report{}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.scanLocked()
+}
+
+func (m *Manager) scanLocked() Report {
+	report := Report{Limit: m.limit}
+	for _, area := range m.areas {
+		usage := AreaUsage{Area: area}
+		m.walk(area, func(path string, info fs.FileInfo) {
+			usage.Bytes += info.Size()
+			usage.Files++
+		})
+		report.Areas = append(report.Areas, usage)
+		report.Total += usage.Bytes
+	}
+	m.used = report.Total
+	m.scanned = time.Now()
+	return report
+}
+
+// walk calls fn for each regular file in area, skipping other areas nested
+// inside it.
+func (m *Manager) walk(area Area, fn func(path string, info fs.FileInfo)) {
+	filepath.WalkDir(area.Path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != area.Path && m.isArea(path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			fn(path, info)
+		}
+		return nil
+	})
+}
+
+func (m *Manager) isArea(path string) bool {
+	for _, area := range m.areas {
+		if filepath.Clean(area.Path) == filepath.Clean(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reserve checks that n more bytes fit under the quota, evicting the
+// oldest cache and attachment files if needed. On success the bytes are
+// counted as used until the next scan.
+func (m *Manager) Reserve(n int64) error {
+	if m == nil || m.limit <= 0 {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if time.Since(m.scanned) > rescanInterval {
+		m.scanLocked()
+	}
+	if m.used+n > m.limit {
+		m.evictLocked(m.used + n - m.limit)
+	}
+	if m.used+n > m.limit {
+		return fmt.Errorf("%w: %s used of %s, %s more requested",
+			ErrExceeded, FormatBytes(m.used), FormatBytes(m.limit), FormatBytes(n))
+	}
+	m.used += n
+	return nil
+}
+
+// Enforce rescans and, if usage is over the limit, evicts the oldest cache
+// and attachment files until it is not. It returns the evicted paths.
+func (m *Manager) Enforce() []string {
+	if m == nil || m.limit <= 0 {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.scanLocked()
+	if m.used <= m.limit {
+		return nil
+	}
+	return m.evictLocked(m.used - m.limit)
+}
+
+// evictLocked deletes evictable files, oldest first, until at least need
+// bytes are freed or none are left.
+func (m *Manager) evictLocked(need int64) []string {
+	type candidate struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var candidates []candidate
+	for _, area := range m.areas {
+		if !area.Evictable {
+			continue
+		}
+		m.walk(area, func(path string, info fs.FileInfo) {
+			candidates = append(candidates, candidate{path, info.Size(), info.ModTime()})
+		})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].modTime.Before(candidates[j].modTime)
+	})
+
+	var evicted []string
+	freed := int64(0)
+	for _, c := range candidates {
+		if freed >= need {
+			break
+		}
+		if err := os.Remove(c.path); err != nil {
+			continue
+		}
+		freed += c.size
+		evicted = append(evicted, c.path)
+	}
+	m.used -= freed
+	if len(evicted) > 0 {
+		logger.InfoCF("quota", "Evicted files to stay under the disk quota",
+			map[string]interface{}{
+				"files": len(evicted),
+				"freed": freed,
+			})
+	}
+	return evicted
+}
+
+// Warning returns a message for the user the first time usage reaches the
+// warning threshold, and "" otherwise. Dropping back below it re-arms the
+// warning.
+func (m *Manager) Warning() string {
+	if m == nil || m.limit <= 0 {
+		return ""
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.used < m.warnAt {
+		m.warned = false
+		return ""
+	}
+	if m.warned {
+		return ""
+	}
+	m.warned = true
+	return fmt.Sprintf("⚠️ Disk quota nearly full: %s of %s used (%d%%). Old cache files and attachments are removed automatically, but once the workspace itself fills up, file writes will fail. Delete files you no longer need or raise resources.disk.max_mb.",
+		FormatBytes(m.used), FormatBytes(m.limit), m.used*100/m.limit)
+}
+
+// FormatBytes renders n in the largest unit that keeps it above 1.
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,92 @@
+package quota
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFile creates a file of size bytes modified age ago.
+func writeFile(t *testing.T, path string, size int, age time.Duration) {
+	t.Helper()
+	os.MkdirAll(filepath.Dir(path), 0755)
+	if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+	mod := time.Now().Add(-age)
+	os.Chtimes(path, mod, mod)
+}
+
+// TestManager_EvictsOldestFirst verifies only cache files are evicted,
+// oldest first, and that nested areas are counted once.
+func TestManager_EvictsOldestFirst(t *testing.T) {
+	workspace := t.TempDir()
+	cache := filepath.Join(workspace, "cache")
+	writeFile(t, filepath.Join(workspace, "notes.md"), 400, time.Hour*48)
+	writeFile(t, filepath.Join(cache, "old.bin"), 300, time.Hour*24)
+	writeFile(t, filepath.Join(cache, "new.bin"), 300, time.Minute)
+
+	m := New(800, 90,
+		Area{Name: "workspace", Path: workspace},
+		Area{Name: "cache", Path: cache, Evictable: true},
+	)
+	report := m.Scan()
+	if report.Total != 1000 {
+		t.Fatalf("Expected 1000 bytes in use, got %d", report.Total)
+	}
+
+	evicted := m.Enforce()
+	if len(evicted) != 1 || filepath.Base(evicted[0]) != "old.bin" {
+		t.Errorf("Expected only old.bin to be evicted, got %v", evicted)
+	}
+	if _, err := os.Stat(filepath.Join(workspace, "notes.md")); err != nil {
+		t.Errorf("Expected workspace files to be kept: %v", err)
+	}
+
+	// 700 used; 50 fits, 500 would need more than the cache holds
+	if err := m.Reserve(50); err != nil {
+		t.Errorf("Expected 50 bytes to fit, got %v", err)
+	}
+	if err := m.Reserve(500); !errors.Is(err, ErrExceeded) {
+		t.Errorf("Expected ErrExceeded, got %v", err)
+	}
+}
+
+// TestManager_WarnsOnce verifies the warning is given once per crossing of
+// the threshold.
+func TestManager_WarnsOnce(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "data"), 95, 0)
+	m := New(100, 90, Area{Name: "workspace", Path: workspace})
+	m.Scan()
+
+	if w := m.Warning(); !strings.Contains(w, "95%") {
+		t.Errorf("Expected a warning at 95%%, got %q", w)
+	}
+	if w := m.Warning(); w != "" {
+		t.Errorf("Expected no repeated warning, got %q", w)
+	}
+
+	os.Remove(filepath.Join(workspace, "data"))
+	m.Scan()
+	m.Warning()
+	writeFile(t, filepath.Join(workspace, "data"), 95, 0)
+	m.Scan()
+	if w := m.Warning(); w == "" {
+		t.Error("Expected the warning again after usage dropped and rose")
+	}
+}
+
+// TestManager_Nil verifies a nil manager allows everything.
+func TestManager_Nil(t *testing.T) {
+	var m *Manager
+	if err := m.Reserve(1 << 40); err != nil {
+		t.Errorf("Expected a nil manager to allow writes, got %v", err)
+	}
+	if m.Warning() != "" || m.Enforce() != nil {
+		t.Error("Expected a nil manager to do nothing")
+	}
+}
@@ -0,0 +1,184 @@
+// Package report loads report templates: briefings whose data comes from
+// tool calls made directly, in parallel, rather than by the agent. The
+// model only turns the filled-in template into prose, which takes one
+// call without tools instead of a tool-calling loop.
+//
+// A report is a YAML file in the workspace's reports/ directory:
+//
+//	description: Weekday morning briefing
+//	data:
+//	  weather: {tool: weather, args: {location: Paris}}
+//	  agenda: {tool: calendar, args: {action: list, when: today}}
+//	template: |
+//	  Weather: {{weather}}
+//	  Today's calendar: {{agenda}}
+package report
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// placeholder matches {{name}} in a template.
+var placeholder = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.-]+)\s*\}\}`)
+
+// Report is a named briefing template and the data it is filled with.
+type Report struct {
+	Name        string             `yaml:"name"`
+	Description string             `yaml:"description"`
+	Data        map[string]Binding `yaml:"data"`
+	Template    string             `yaml:"template"`
+	// Style is an optional instruction for the narration, e.g. "at most
+	// five lines, no headings".
+	Style string `yaml:"style"`
+	Path  string `yaml:"-"`
+}
+
+// Binding is a tool call whose output fills a placeholder.
+type Binding struct {
+	Tool string                 `yaml:"tool"`
+	Args map[string]interface{} `yaml:"args"`
+}
+
+// Fetcher calls a tool and returns its output.
+type Fetcher func(ctx context.Context, tool string, args map[string]interface{}) (string, error)
+
+// Load parses a report file. The name defaults to the file name.
+func Load(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var r Report
+	if err := yaml.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	if r.Name == "" {
+		r.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	r.Path = path
+	if err := r.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	return &r, nil
+}
+
+// LoadDir loads every .yaml/.yml report in dir, keyed by name. Files that
+// fail to parse are reported in errs and skipped.
+func LoadDir(dir string) (reports map[string]*Report, errs []error) {
+	reports = make(map[string]*Report)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+		return reports, errs
+	}
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		r, err := Load(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		reports[r.Name] = r
+	}
+	return reports, errs
+}
+
+// Names returns the sorted names of the reports.
+func Names(reports map[string]*Report) []string {
+	names := make([]string, 0, len(reports))
+	for name := range reports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Validate checks that every binding names a tool and every placeholder in
+// the template is bound.
+func (r *Report) Validate() error {
+	if strings.TrimSpace(r.Template) == "" {
+		return fmt.Errorf("report %q has no template", r.Name)
+	}
+	for name, b := range r.Data {
+		if b.Tool == "" {
+			return fmt.Errorf("data %q: tool is required", name)
+		}
+	}
+	for _, m := range placeholder.FindAllStringSubmatch(r.Template, -1) {
+		if _, ok := r.Data[m[1]]; !ok && !builtin[m[1]] {
+			return fmt.Errorf("template uses {{%s}}, which is not in data", m[1])
+		}
+	}
+	return nil
+}
+
+// builtin are the placeholders filled without a tool call.
+var builtin = map[string]bool{"args": true, "date": true, "time": true}
+
+// Fill fetches every binding in parallel and returns the template with the
+// placeholders replaced. A binding that fails is filled with a note saying
+// so, and its error is returned in errs; the rest of the report still
+// renders. {{args}} in string arguments and in the template is replaced by
+// args, and {{date}} and {{time}} by now.
+func (r *Report) Fill(ctx context.Context, args string, now time.Time, fetch Fetcher) (filled string, errs []error) {
+	values := map[string]string{
+		"args": args,
+		"date": now.Format("Monday, 2 January 2006"),
+		"time": now.Format("15:04"),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, b := range r.Data {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			output, err := fetch(ctx, b.Tool, expandArgs(b.Args, args))
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s (%s): %w", name, b.Tool, err))
+				output = fmt.Sprintf("(%s unavailable: %v)", name, err)
+			}
+			values[name] = strings.TrimSpace(output)
+		}()
+	}
+	wg.Wait()
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+
+	filled = placeholder.ReplaceAllStringFunc(r.Template, func(m string) string {
+		return values[placeholder.FindStringSubmatch(m)[1]]
+	})
+	return filled, errs
+}
+
+// expandArgs copies a binding's arguments with {{args}} filled in. YAML
+// integers become float64, as tools expect from JSON-decoded calls.
+func expandArgs(in map[string]interface{}, args string) map[string]interface{} {
+	out := make(map[string]interface{}, len(in))
+	for k, v := range in {
+		switch val := v.(type) {
+		case string:
+			v = strings.ReplaceAll(val, "{{args}}", args)
+		case int:
+			v = float64(val)
+		}
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,84 @@
+package report
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const morning = `
+description: Morning briefing
+data:
+  weather: {tool: weather, args: {location: "{{args}}"}}
+  agenda: {tool: calendar, args: {action: list, when: today}}
+template: |
+  {{date}}
+  Weather: {{weather}}
+  Agenda: {{agenda}}
+`
+
+// TestLoadDir verifies reports are parsed and unbound placeholders rejected
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "morning.yaml"), []byte(morning), 0644)
+	os.WriteFile(filepath.Join(dir, "broken.yaml"), []byte("template: \"{{news}}\"\n"), 0644)
+
+	reports, errs := LoadDir(dir)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "{{news}}") {
+		t.Errorf("Expected 1 error for the unbound placeholder, got %v", errs)
+	}
+	r, ok := reports["morning"]
+	if !ok {
+		t.Fatalf("Expected morning report, got %v", Names(reports))
+	}
+	if len(r.Data) != 2 || r.Data["agenda"].Tool != "calendar" {
+		t.Errorf("Unexpected data: %+v", r.Data)
+	}
+}
+
+// TestFill verifies bindings are fetched in parallel with {{args}} filled in,
+// and a failed binding leaves a note instead of failing the report
+func TestFill(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "morning.yaml"), []byte(morning), 0644)
+	r, err := Load(filepath.Join(dir, "morning.yaml"))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	var inFlight, maxInFlight atomic.Int32
+	fetch := func(ctx context.Context, tool string, args map[string]interface{}) (string, error) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		if tool == "calendar" {
+			return "", fmt.Errorf("not configured")
+		}
+		return fmt.Sprintf("sunny in %s", args["location"]), nil
+	}
+
+	now := time.Date(2026, 3, 2, 7, 0, 0, 0, time.UTC)
+	filled, errs := r.Fill(context.Background(), "Paris", now, fetch)
+	for _, want := range []string{"Monday, 2 March 2026", "Weather: sunny in Paris", "Agenda: (agenda unavailable: not configured)"} {
+		if !strings.Contains(filled, want) {
+			t.Errorf("Expected %q in report, got %q", want, filled)
+		}
+	}
+	if len(errs) != 1 {
+		t.Errorf("Expected 1 error, got %v", errs)
+	}
+	if maxInFlight.Load() != 2 {
+		t.Errorf("Expected both bindings fetched at once, got %d", maxInFlight.Load())
+	}
+}
@@ -0,0 +1,117 @@
+// Package resources detects constrained hosts (Pi Zero class boards) and
+// provides the limits picoclaw uses to keep its memory use bounded there.
+package resources
+
+import (
+	"runtime/debug"
+	"strings"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// Low-memory mode settings.
+const (
+	ModeAuto = "auto"
+	ModeOn   = "on"
+	ModeOff  = "off"
+
+	// DefaultThresholdMB is the available RAM below which auto mode switches
+	// to low-memory limits.
+	DefaultThresholdMB = 512
+)
+
+// Limits are the buffer, cache and concurrency bounds used by tools and the
+// agent loop.
+type Limits struct {
+	LowMemory         bool
+	ExecMaxOutput     int   // bytes of command output kept
+	WebFetchMaxChars  int   // characters of extracted page text
+	WebFetchMaxBody   int64 // bytes read from a response body
+	ReadFileMaxBytes  int64 // bytes read by read_file in one call
+	MaxSubagents      int   // concurrently running subagents
+	ToolWorkers       int   // tool calls running at once
+	GCPercent         int   // 0 leaves the Go default
+	MemoryLimitBytes  int64 // soft Go heap limit, 0 leaves it unset
+	AvailableMemoryMB uint64
+}
+
+// DefaultLimits returns the limits used on normal hosts.
+func DefaultLimits() Limits {
+	return Limits{
+		ExecMaxOutput:    10000,
+		WebFetchMaxChars: 50000,
+		WebFetchMaxBody:  10 << 20,
+		ReadFileMaxBytes: 10 << 20,
+		MaxSubagents:     8,
+		ToolWorkers:      4,
+	}
+}
+
+// LowMemoryLimits returns tighter limits for hosts with little free RAM.
+func LowMemoryLimits() Limits {
+	return Limits{
+		LowMemory:        true,
+		ExecMaxOutput:    4000,
+		WebFetchMaxChars: 20000,
+		WebFetchMaxBody:  1 << 20,
+		ReadFileMaxBytes: 256 << 10,
+		MaxSubagents:     1,
+		ToolWorkers:      2,
+		GCPercent:        50,
+		MemoryLimitBytes: 96 << 20,
+	}
+}
+
+// Detect picks limits for mode ("auto", "on" or "off"). In auto mode the
+// low-memory limits are used when available RAM is below thresholdMB.
+func Detect(mode string, thresholdMB int) Limits {
+	if thresholdMB <= 0 {
+		thresholdMB = DefaultThresholdMB
+	}
+
+	availableMB := uint64(0)
+	if avail, err := AvailableMemory(); err == nil {
+		availableMB = avail >> 20
+	}
+
+	var limits Limits
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case ModeOn:
+		limits = LowMemoryLimits()
+	case ModeOff:
+		limits = DefaultLimits()
+	default:
+		if availableMB > 0 && availableMB < uint64(thresholdMB) {
+			limits = LowMemoryLimits()
+		} else {
+			limits = DefaultLimits()
+		}
+	}
+	limits.AvailableMemoryMB = availableMB
+	return limits
+}
+
+var applyOnce sync.Once
+
+// Apply tunes the Go runtime for the limits. It only takes effect once per
+// process since GC settings are global.
+func (l Limits) Apply() {
+	applyOnce.Do(func() {
+		if l.GCPercent > 0 {
+			debug.SetGCPercent(l.GCPercent)
+		}
+		if l.MemoryLimitBytes > 0 {
+			debug.SetMemoryLimit(l.MemoryLimitBytes)
+		}
+		if l.LowMemory {
+			logger.InfoCF("resources", "Low-memory mode enabled",
+				map[string]interface{}{
+					"available_mb":    l.AvailableMemoryMB,
+					"exec_max_output": l.ExecMaxOutput,
+					"max_subagents":   l.MaxSubagents,
+					"tool_workers":    l.ToolWorkers,
+				})
+		}
+	})
+}
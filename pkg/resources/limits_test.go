@@ -0,0 +1,28 @@
+package resources
+
+import "testing"
+
+func TestDetect_ForcedModes(t *testing.T) {
+	if !Detect(ModeOn, 0).LowMemory {
+		t.Error("Expected low-memory limits when mode is on")
+	}
+	if Detect(ModeOff, 1<<30).LowMemory {
+		t.Error("Expected default limits when mode is off")
+	}
+}
+
+func TestLowMemoryLimits_AreTighter(t *testing.T) {
+	def, low := DefaultLimits(), LowMemoryLimits()
+	if low.ExecMaxOutput >= def.ExecMaxOutput {
+		t.Errorf("Expected smaller exec output cap, got %d >= %d", low.ExecMaxOutput, def.ExecMaxOutput)
+	}
+	if low.ReadFileMaxBytes >= def.ReadFileMaxBytes {
+		t.Errorf("Expected smaller read cap, got %d >= %d", low.ReadFileMaxBytes, def.ReadFileMaxBytes)
+	}
+	if low.MaxSubagents >= def.MaxSubagents {
+		t.Errorf("Expected fewer subagents, got %d >= %d", low.MaxSubagents, def.MaxSubagents)
+	}
+	if low.ToolWorkers >= def.ToolWorkers {
+		t.Errorf("Expected fewer tool workers, got %d >= %d", low.ToolWorkers, def.ToolWorkers)
+	}
+}
@@ -0,0 +1,23 @@
+//go:build linux
+
+package resources
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseMemAvailable(t *testing.T) {
+	input := "MemTotal:         438024 kB\nMemFree:           21520 kB\nMemAvailable:     183744 kB\n"
+	got, err := parseMemAvailable(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseMemAvailable failed: %v", err)
+	}
+	if want := uint64(183744 * 1024); got != want {
+		t.Errorf("Expected %d, got %d", want, got)
+	}
+
+	if _, err := parseMemAvailable(strings.NewReader("MemTotal: 1 kB\n")); err == nil {
+		t.Error("Expected error when MemAvailable is missing")
+	}
+}
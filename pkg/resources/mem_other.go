@@ -0,0 +1,11 @@
+//go:build !linux
+
+package resources
+
+import "errors"
+
+// AvailableMemory is not supported on this platform; auto mode then keeps
+// the default limits.
+func AvailableMemory() (uint64, error) {
+	return 0, errors.New("available memory detection is only supported on Linux")
+}
@@ -0,0 +1,205 @@
+// Package pathguard confines file paths to a set of allowed folders: the
+// workspace and any folders the user has explicitly shared with the agent.
+// Paths are checked both as written and after following symlinks (and
+// junctions on Windows), so a link inside an allowed folder cannot be used
+// to reach a file outside it.
+package pathguard
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+var (
+	// ErrOutside is returned for a path that is not inside any allowed folder.
+	ErrOutside = errors.New("path is outside the allowed folders")
+	// ErrLink is returned for a path inside an allowed folder that leads out
+	// of it through a symlink or junction.
+	ErrLink = errors.New("path leads outside the allowed folders through a link")
+	// ErrDriveRelative is returned on Windows for paths like C:notes.txt,
+	// which resolve against that drive's current directory.
+	ErrDriveRelative = errors.New("drive-relative path depends on the drive's current directory")
+)
+
+// root is an allowed folder as configured and with its links resolved.
+type root struct {
+	abs  string
+	real string
+}
+
+// Guard checks paths against a fixed set of allowed folders.
+type Guard struct {
+	roots []root
+}
+
+// New returns a guard allowing paths inside any of roots. Empty entries are
+// ignored; a root that does not exist yet is still allowed by its path.
+func New(roots ...string) *Guard {
+	g := &Guard{}
+	for _, r := range roots {
+		if r == "" {
+			continue
+		}
+		abs, err := filepath.Abs(r)
+		if err != nil {
+			continue
+		}
+		g.roots = append(g.roots, root{abs: abs, real: Real(abs)})
+	}
+	return g
+}
+
+// Roots returns the allowed folders as absolute paths.
+func (g *Guard) Roots() []string {
+	roots := make([]string, len(g.roots))
+	for i, r := range g.roots {
+		roots[i] = r.abs
+	}
+	return roots
+}
+
+// Resolve makes path absolute, relative to base, and checks it. It returns
+// the cleaned path, with links left in place so error messages and previews
+// show the path the way the caller wrote it.
+func (g *Guard) Resolve(path, base string) (string, error) {
+	if runtime.GOOS == "windows" && IsDriveRelative(path) {
+		return "", ErrDriveRelative
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(base, path)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if err := g.Check(abs); err != nil {
+		return "", err
+	}
+	return abs, nil
+}
+
+// Check reports whether the absolute path is inside an allowed folder both
+// as written and once every link on the way to it has been followed.
+func (g *Guard) Check(path string) error {
+	path = filepath.Clean(path)
+	if !g.contains(path) {
+		return ErrOutside
+	}
+	if real, err := realPath(path); err != nil || !g.contains(real) {
+		return ErrLink
+	}
+	return nil
+}
+
+// Contains reports whether Check accepts path.
+func (g *Guard) Contains(path string) bool {
+	return g.Check(path) == nil
+}
+
+// contains compares path with each root as configured and as resolved, since
+// either spelling may appear (e.g. /tmp and /private/tmp on macOS).
+func (g *Guard) contains(path string) bool {
+	for _, r := range g.roots {
+		if Within(path, r.abs) || Within(path, r.real) {
+			return true
+		}
+	}
+	return false
+}
+
+// Real returns path made absolute with symlinks (and junctions on Windows)
+// resolved. A path that does not exist yet is resolved through its longest
+// existing ancestor, so a link in any parent directory is followed, as is a
+// dangling link on the way. A link that can't be read is left as it is.
+func Real(path string) string {
+	real, err := realPath(path)
+	if err != nil {
+		abs, _ := filepath.Abs(path)
+		return abs
+	}
+	return real
+}
+
+// maxLinks bounds how many links are followed, as the kernel's ELOOP does.
+const maxLinks = 40
+
+// errLinkLoop is returned for links that point at each other.
+var errLinkLoop = errors.New("too many levels of symbolic links")
+
+// realPath resolves path like Real. filepath.EvalSymlinks fails on a path
+// that doesn't exist, so each missing component is looked at with Lstat:
+// one that is a dangling link is followed to its target, which is where a
+// write through it would land.
+func realPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	for links := 0; ; {
+		p, rest := abs, ""
+		for {
+			if real, err := filepath.EvalSymlinks(p); err == nil {
+				return filepath.Join(real, rest), nil
+			}
+			info, err := os.Lstat(p)
+			if err == nil && (info.Mode()&os.ModeSymlink != 0 || runtime.GOOS == "windows" && info.Mode()&os.ModeIrregular != 0) {
+				break
+			}
+			if err == nil {
+				// It exists, so something else kept EvalSymlinks from
+				// resolving it
+				return "", fmt.Errorf("cannot resolve %s", p)
+			}
+			parent := filepath.Dir(p)
+			if parent == p {
+				return abs, nil
+			}
+			rest = filepath.Join(filepath.Base(p), rest)
+			p = parent
+		}
+
+		if links++; links > maxLinks {
+			return "", errLinkLoop
+		}
+		target, err := os.Readlink(p)
+		if err != nil {
+			return "", err
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(p), target)
+		}
+		abs = filepath.Join(target, rest)
+	}
+}
+
+// Within reports whether path is root or inside it. Comparing whole path
+// elements keeps /work/ws-other out of /work/ws; on Windows case is ignored
+// and a path on another drive or share is never within.
+func Within(path, root string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || filepath.IsAbs(rel) {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// IsDriveRelative reports whether path names a drive but no root, like
+// C:notes.txt, which Windows resolves against that drive's current directory.
+func IsDriveRelative(path string) bool {
+	return len(path) >= 2 && path[1] == ':' && isDriveLetter(path[0]) &&
+		(len(path) == 2 || (path[2] != '\\' && path[2] != '/'))
+}
+
+// IsUNC reports whether path is a UNC or device path: \\server\share,
+// \\?\C:\... or \\.\pipe\....
+func IsUNC(path string) bool {
+	return strings.HasPrefix(path, `\\`) || strings.HasPrefix(path, "//")
+}
+
+func isDriveLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,112 @@
+package pathguard
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestGuard_SharedFolders verifies paths in any allowed folder pass, links
+// out of them are caught, and sibling folders sharing a prefix stay outside.
+func TestGuard_SharedFolders(t *testing.T) {
+	root := t.TempDir()
+	workspace := filepath.Join(root, "ws")
+	shared := filepath.Join(root, "shared")
+	os.MkdirAll(workspace, 0755)
+	os.MkdirAll(shared, 0755)
+	os.MkdirAll(filepath.Join(root, "private"), 0755)
+	if err := os.Symlink(filepath.Join(root, "private"), filepath.Join(shared, "escape")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	if err := os.Symlink(shared, filepath.Join(workspace, "docs")); err != nil {
+		t.Fatalf("Failed to create link: %v", err)
+	}
+	g := New(workspace, shared)
+
+	for _, path := range []string{
+		filepath.Join(workspace, "notes.md"),
+		filepath.Join(workspace, "new", "dir", "file.txt"),
+		filepath.Join(shared, "report.pdf"),
+		filepath.Join(workspace, "docs", "report.pdf"),
+	} {
+		if err := g.Check(path); err != nil {
+			t.Errorf("Expected %s to be allowed, got %v", path, err)
+		}
+	}
+	for path, want := range map[string]error{
+		filepath.Join(root, "private", "key"):       ErrOutside,
+		filepath.Join(root, "shared-other", "x"):    ErrOutside,
+		filepath.Join(shared, "escape", "key"):      ErrLink,
+		filepath.Join(shared, "escape", "new", "x"): ErrLink,
+	} {
+		if err := g.Check(path); err != want {
+			t.Errorf("Check(%s) = %v, expected %v", path, err, want)
+		}
+	}
+
+	got, err := g.Resolve("docs/report.pdf", workspace)
+	if err != nil || got != filepath.Join(workspace, "docs", "report.pdf") {
+		t.Errorf("Expected the relative path to resolve in the workspace, got %q, %v", got, err)
+	}
+	if _, err := g.Resolve("../private/key", workspace); err != ErrOutside {
+		t.Errorf("Expected a relative escape to be refused, got %v", err)
+	}
+}
+
+// TestWindowsPathForms verifies drive-relative and UNC paths are recognized.
+func TestWindowsPathForms(t *testing.T) {
+	for path, want := range map[string]bool{
+		`C:notes.txt`: true,
+		`c:`:          true,
+		`C:\Users`:    false,
+		`C:/Users`:    false,
+		`notes.txt`:   false,
+	} {
+		if got := IsDriveRelative(path); got != want {
+			t.Errorf("IsDriveRelative(%q) = %v, expected %v", path, got, want)
+		}
+	}
+	for path, want := range map[string]bool{
+		`\\server\share\x`: true,
+		`\\?\C:\x`:         true,
+		`//server/share`:   true,
+		`C:\x`:             false,
+	} {
+		if got := IsUNC(path); got != want {
+			t.Errorf("IsUNC(%q) = %v, expected %v", path, got, want)
+		}
+	}
+}
+
+// TestGuard_DanglingLinks verifies a link to a file that doesn't exist yet
+// is followed to its target, so writing through it can't create a file
+// outside the allowed folders.
+func TestGuard_DanglingLinks(t *testing.T) {
+	root := t.TempDir()
+	workspace := filepath.Join(root, "ws")
+	outside := filepath.Join(root, "outside")
+	os.MkdirAll(workspace, 0755)
+	if err := os.Symlink(filepath.Join(outside, "x"), filepath.Join(workspace, "link")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	os.Symlink(filepath.Join(outside, "dir"), filepath.Join(workspace, "dirlink"))
+	os.Symlink("ok.txt", filepath.Join(workspace, "later"))
+	os.Symlink("loop2", filepath.Join(workspace, "loop1"))
+	os.Symlink("loop1", filepath.Join(workspace, "loop2"))
+	g := New(workspace)
+
+	for path, want := range map[string]error{
+		filepath.Join(workspace, "link"):              ErrLink,
+		filepath.Join(workspace, "dirlink", "new.md"): ErrLink,
+		filepath.Join(workspace, "loop1"):             ErrLink,
+		filepath.Join(workspace, "later"):             nil,
+		filepath.Join(workspace, "new", "file.txt"):   nil,
+	} {
+		if err := g.Check(path); err != want {
+			t.Errorf("Check(%s) = %v, expected %v", path, err, want)
+		}
+	}
+	if got, want := Real(filepath.Join(workspace, "link")), filepath.Join(Real(root), "outside", "x"); got != want {
+		t.Errorf("Expected the dangling link followed to %s, got %s", want, got)
+	}
+}
@@ -0,0 +1,310 @@
+// Package scheduler runs configured tasks on cron schedules, such as a
+// morning briefing or a nightly backup check, and sends their results to a
+// chat. Runs missed while picoclaw was down are made up once on startup if
+// they are recent enough; older ones are skipped.
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// lateAfter is how far past its time a run may start and still count as on
+// time rather than missed.
+const lateAfter = 2 * time.Minute
+
+// Task is a validated scheduled task.
+type Task struct {
+	Name     string
+	Prompt   string
+	Workflow string
+	Report   string
+	Args     string
+
+	schedule cron.CronSchedule
+	loc      *time.Location
+	channel  string // notify target; empty for the last active chat
+	chatID   string
+}
+
+// Runner runs tasks through the agent.
+type Runner interface {
+	// RunScheduledTask runs task and returns the reply to send, which may
+	// be empty. channel and chatID are where the reply goes.
+	RunScheduledTask(ctx context.Context, task Task, channel, chatID string) (string, error)
+	// LastActiveChat returns the chat the user last wrote from.
+	LastActiveChat() (channel, chatID string)
+}
+
+// Scheduler runs tasks when their cron expressions fall due.
+type Scheduler struct {
+	tasks   []Task
+	catchUp time.Duration
+	runner  Runner
+	bus     *bus.MessageBus
+	path    string
+	now     func() time.Time
+
+	mu      sync.Mutex
+	lastRun map[string]time.Time // task -> when it last ran or was skipped
+	running map[string]bool
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// New validates the configured tasks, logging and dropping invalid ones,
+// and loads when each last ran from stateDir.
+func New(cfg config.SchedulerConfig, stateDir string, runner Runner, msgBus *bus.MessageBus) *Scheduler {
+	s := &Scheduler{
+		catchUp: time.Duration(cfg.CatchUpHours) * time.Hour,
+		runner:  runner,
+		bus:     msgBus,
+		path:    filepath.Join(stateDir, "scheduler.json"),
+		now:     time.Now,
+		lastRun: make(map[string]time.Time),
+		running: make(map[string]bool),
+	}
+	seen := make(map[string]bool)
+	for _, tc := range cfg.Tasks {
+		task, err := parseTask(tc, cfg.Timezone)
+		if err == nil && seen[task.Name] {
+			err = fmt.Errorf("duplicate task name")
+		}
+		if err != nil {
+			logger.WarnCF("scheduler", "Skipping invalid scheduled task",
+				map[string]interface{}{"task": tc.Name, "error": err.Error()})
+			continue
+		}
+		seen[task.Name] = true
+		s.tasks = append(s.tasks, task)
+	}
+	if data, err := os.ReadFile(s.path); err == nil {
+		json.Unmarshal(data, &s.lastRun)
+	}
+	return s
+}
+
+func parseTask(tc config.ScheduledTaskConfig, timezone string) (Task, error) {
+	task := Task{
+		Name:     strings.TrimSpace(tc.Name),
+		Prompt:   strings.TrimSpace(tc.Prompt),
+		Workflow: strings.TrimSpace(tc.Workflow),
+		Report:   strings.TrimSpace(tc.Report),
+		Args:     tc.Args,
+		schedule: cron.CronSchedule{Kind: "cron", Expr: strings.TrimSpace(tc.Cron), TZ: timezone},
+		loc:      time.Local,
+	}
+	if task.Name == "" {
+		return task, fmt.Errorf("name is required")
+	}
+	set := 0
+	for _, s := range []string{task.Prompt, task.Workflow, task.Report} {
+		if s != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return task, fmt.Errorf("set one of prompt, workflow or report")
+	}
+	if timezone != "" {
+		loc, err := time.LoadLocation(timezone)
+		if err != nil {
+			return task, fmt.Errorf("timezone: %w", err)
+		}
+		task.loc = loc
+	}
+	if cron.NextRun(task.schedule, time.Now()) == nil {
+		return task, fmt.Errorf("invalid cron expression %q", task.schedule.Expr)
+	}
+	if tc.Notify != "" {
+		channel, chatID, ok := strings.Cut(tc.Notify, ":")
+		if !ok || channel == "" || chatID == "" {
+			return task, fmt.Errorf("notify %q is not channel:chat_id", tc.Notify)
+		}
+		task.channel, task.chatID = channel, chatID
+	}
+	return task, nil
+}
+
+// Tasks returns the valid tasks.
+func (s *Scheduler) Tasks() []Task {
+	return s.tasks
+}
+
+// Start makes up missed runs and then checks the tasks every 30 seconds.
+// Tasks seen for the first time start counting from now.
+func (s *Scheduler) Start(ctx context.Context) {
+	if len(s.tasks) == 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	s.mu.Lock()
+	s.cancel = cancel
+	now := s.now()
+	for _, task := range s.tasks {
+		if _, ok := s.lastRun[task.Name]; !ok {
+			s.lastRun[task.Name] = now
+		}
+	}
+	s.mu.Unlock()
+
+	s.check(ctx, now)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(30 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.check(ctx, s.now())
+			}
+		}
+	}()
+	logger.InfoCF("scheduler", "Scheduler started", map[string]interface{}{"tasks": len(s.tasks)})
+}
+
+// Stop cancels running tasks and waits for them to return.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	s.wg.Wait()
+}
+
+// check starts every task that fell due since it last ran. A run more than
+// lateAfter past its time was missed: the latest missed time is made up if
+// it is within the catch-up window, and skipped otherwise.
+func (s *Scheduler) check(ctx context.Context, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed := false
+	for _, task := range s.tasks {
+		if s.running[task.Name] {
+			continue
+		}
+		due, ok := latestDue(task.schedule, s.lastRun[task.Name], now)
+		if !ok {
+			continue
+		}
+		s.lastRun[task.Name] = now
+		changed = true
+
+		var delayed time.Time
+		if now.Sub(due) > lateAfter {
+			if now.Sub(due) > s.catchUp {
+				logger.WarnCF("scheduler", "Skipping missed scheduled run",
+					map[string]interface{}{"task": task.Name, "due": due.Format(time.RFC3339)})
+				continue
+			}
+			delayed = due
+		}
+		s.running[task.Name] = true
+		s.wg.Add(1)
+		go func(task Task) {
+			defer s.wg.Done()
+			s.run(ctx, task, delayed)
+			s.mu.Lock()
+			delete(s.running, task.Name)
+			s.mu.Unlock()
+		}(task)
+	}
+	if changed {
+		if err := s.saveLocked(); err != nil {
+			logger.WarnCF("scheduler", "Failed to save scheduler state", map[string]interface{}{"error": err.Error()})
+		}
+	}
+}
+
+// latestDue returns the last time schedule fell due after last and up to
+// now, if any.
+func latestDue(schedule cron.CronSchedule, last, now time.Time) (time.Time, bool) {
+	var due time.Time
+	for i := 0; i < 10000; i++ {
+		next := cron.NextRun(schedule, last)
+		if next == nil {
+			break
+		}
+		t := time.UnixMilli(*next)
+		if t.After(now) {
+			break
+		}
+		due, last = t, t
+	}
+	return due, !due.IsZero()
+}
+
+// run runs task and sends the reply, noting when a made-up run was due.
+func (s *Scheduler) run(ctx context.Context, task Task, delayed time.Time) {
+	channel, chatID := task.channel, task.chatID
+	if channel == "" {
+		channel, chatID = s.runner.LastActiveChat()
+	}
+	logger.InfoCF("scheduler", "Running scheduled task",
+		map[string]interface{}{"task": task.Name, "channel": channel, "catch_up": !delayed.IsZero()})
+
+	reply, err := s.runner.RunScheduledTask(ctx, task, channel, chatID)
+	urgency := bus.UrgencyNormal
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		logger.ErrorCF("scheduler", "Scheduled task failed",
+			map[string]interface{}{"task": task.Name, "error": err.Error()})
+		reply = fmt.Sprintf("⚠️ Scheduled task %q failed: %v", task.Name, err)
+		urgency = bus.UrgencyHigh
+	}
+	reply = strings.TrimSpace(reply)
+	if reply == "" {
+		return
+	}
+	if !delayed.IsZero() {
+		reply = fmt.Sprintf("(%s was due at %s, while I was offline.)\n\n%s", task.Name, delayed.In(task.loc).Format("Mon 15:04"), reply)
+	}
+	if s.bus == nil {
+		return
+	}
+	if channel == "" || chatID == "" {
+		// Sent anyway: the channel manager can deliver it as a notification
+		logger.InfoCF("scheduler", "No chat to send scheduled task result to",
+			map[string]interface{}{"task": task.Name})
+	}
+	s.bus.PublishOutbound(bus.OutboundMessage{
+		Channel: channel,
+		ChatID:  chatID,
+		Content: reply,
+		Urgency: urgency,
+	})
+}
+
+func (s *Scheduler) saveLocked() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s.lastRun, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -0,0 +1,108 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+type fakeRunner struct {
+	mu  sync.Mutex
+	ran []string
+}
+
+func (r *fakeRunner) RunScheduledTask(ctx context.Context, task Task, channel, chatID string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ran = append(r.ran, task.Name)
+	return "result of " + task.Name, nil
+}
+
+func (r *fakeRunner) LastActiveChat() (string, string) {
+	return "telegram", "42"
+}
+
+// TestScheduler_CatchUp verifies due tasks run on time, a recently missed
+// run is made up once with a note, an old one is skipped, and tasks seen
+// for the first time do not run for past times.
+func TestScheduler_CatchUp(t *testing.T) {
+	dir := t.TempDir()
+	// 09:00 on Saturday 17 October 2026
+	now := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+	last := map[string]time.Time{
+		"briefing": now.Add(-26 * time.Hour), // missed yesterday's and today's 07:00
+		"backup":   now.Add(-30 * time.Hour), // missed 02:30 well over 6 hours ago
+		"hourly":   now.Add(-30 * time.Minute),
+	}
+	data, _ := json.Marshal(last)
+	os.WriteFile(filepath.Join(dir, "scheduler.json"), data, 0644)
+
+	runner := &fakeRunner{}
+	msgBus := bus.NewMessageBus()
+	defer msgBus.Close()
+	s := New(config.SchedulerConfig{
+		Timezone:     "UTC",
+		CatchUpHours: 6,
+		Tasks: []config.ScheduledTaskConfig{
+			{Name: "briefing", Cron: "0 7 * * *", Prompt: "Morning briefing"},
+			{Name: "backup", Cron: "30 2 * * *", Workflow: "backup-report", Notify: "slack:C1"},
+			{Name: "hourly", Cron: "0 * * * *", Prompt: "Check the queue"},
+			{Name: "new", Cron: "0 8 * * *", Prompt: "Never ran before"},
+			{Name: "broken", Cron: "not a cron", Prompt: "x"},
+			{Name: "both", Cron: "0 8 * * *", Prompt: "x", Workflow: "y"},
+		},
+	}, dir, runner, msgBus)
+	if len(s.Tasks()) != 4 {
+		t.Fatalf("Expected the 2 invalid tasks to be dropped, got %d tasks", len(s.Tasks()))
+	}
+	s.now = func() time.Time { return now }
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s.Start(ctx)
+	msgs := make(map[string]bus.OutboundMessage)
+	for i := 0; i < 2; i++ {
+		msg, ok := msgBus.SubscribeOutbound(ctx)
+		if !ok {
+			t.Fatal("Expected a scheduled task result")
+		}
+		msgs[strings.TrimPrefix(msg.Content[strings.LastIndex(msg.Content, "result of "):], "result of ")] = msg
+	}
+	cancel()
+	s.Stop()
+
+	if len(runner.ran) != 2 {
+		t.Fatalf("Expected briefing and hourly to run, got %v", runner.ran)
+	}
+	briefing, ok := msgs["briefing"]
+	if !ok || !strings.HasPrefix(briefing.Content, "(briefing was due at Sat 07:00, while I was offline.)") {
+		t.Errorf("Expected briefing to be made up with a note, got %q", briefing.Content)
+	}
+	if briefing.Channel != "telegram" || briefing.ChatID != "42" || briefing.Urgency != bus.UrgencyNormal {
+		t.Errorf("Expected a normal message to the last active chat, got %+v", briefing)
+	}
+	if hourly := msgs["hourly"]; hourly.Content != "result of hourly" {
+		t.Errorf("Expected hourly to run on time without a note, got %q", hourly.Content)
+	}
+
+	// Every task now counts from 09:00, so a later check runs only what fell due since
+	runner.ran = nil
+	s.check(context.Background(), now.Add(61*time.Minute))
+	s.wg.Wait()
+	if len(runner.ran) != 1 || runner.ran[0] != "hourly" {
+		t.Errorf("Expected only hourly at 10:01, got %v", runner.ran)
+	}
+
+	saved, _ := os.ReadFile(filepath.Join(dir, "scheduler.json"))
+	if !strings.Contains(string(saved), `"new"`) {
+		t.Errorf("Expected the new task's start to be saved, got %s", saved)
+	}
+}
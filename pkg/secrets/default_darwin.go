@@ -0,0 +1,6 @@
+package secrets
+
+// Default returns the macOS keychain.
+func Default() Store {
+	return keychainStore{}
+}
@@ -0,0 +1,20 @@
+//go:build !darwin && !windows && !linux && !freebsd && !openbsd && !netbsd && !dragonfly
+
+package secrets
+
+import "errors"
+
+var errUnsupported = errors.New("no OS keyring is supported on this system")
+
+// Default returns a store that refuses everything: there is no keyring.
+func Default() Store {
+	return unsupportedStore{}
+}
+
+type unsupportedStore struct{}
+
+func (unsupportedStore) Name() string               { return "none" }
+func (unsupportedStore) Get(string) (string, error) { return "", errUnsupported }
+func (unsupportedStore) Set(string, string) error   { return errUnsupported }
+func (unsupportedStore) Delete(string) error        { return errUnsupported }
+func (unsupportedStore) List() ([]string, error)    { return nil, errUnsupported }
@@ -0,0 +1,9 @@
+//go:build linux || freebsd || openbsd || netbsd || dragonfly
+
+package secrets
+
+// Default returns the Secret Service, which needs secret-tool and a
+// running keyring such as GNOME Keyring or KWallet.
+func Default() Store {
+	return secretServiceStore{}
+}
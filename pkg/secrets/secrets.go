@@ -0,0 +1,89 @@
+// Package secrets keeps API keys and other secrets in the OS keyring: the
+// macOS keychain, the Secret Service (GNOME Keyring, KWallet) on Linux, or
+// the Windows Credential Manager. The config refers to a stored secret as
+// "keyring:<name>".
+package secrets
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Service is the service name secrets are stored under.
+const Service = "picoclaw"
+
+// RefPrefix marks a config value that names a secret in the keyring.
+const RefPrefix = "keyring:"
+
+// ErrNotFound is returned for a secret that isn't stored.
+var ErrNotFound = errors.New("secret not found")
+
+// Store is a place to keep secrets by name.
+type Store interface {
+	// Name describes the store, e.g. "macOS keychain".
+	Name() string
+	Get(name string) (string, error)
+	Set(name, value string) error
+	Delete(name string) error
+	// List returns the names of the stored secrets.
+	List() ([]string, error)
+}
+
+// Ref returns the config value that refers to the secret name.
+func Ref(name string) string {
+	return RefPrefix + name
+}
+
+// ParseRef returns the secret name a config value refers to, if it does.
+func ParseRef(value string) (string, bool) {
+	name, ok := strings.CutPrefix(value, RefPrefix)
+	return name, ok && name != ""
+}
+
+// ValidateName checks a secret name: letters, digits and ".-_" only, so it
+// is safe as a keyring attribute and in a config value.
+func ValidateName(name string) error {
+	if name == "" {
+		return fmt.Errorf("secret name is empty")
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune(".-_", r)) {
+			return fmt.Errorf("secret name %q may only use letters, digits, '.', '-' and '_'", name)
+		}
+	}
+	return nil
+}
+
+// runCommand runs a keyring tool with stdin and returns its output. Tests
+// replace it.
+var runCommand = func(stdin, name string, args ...string) (string, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return "", fmt.Errorf("%s is not installed: %w", name, err)
+		}
+		return stdout.String(), &commandError{err: err, stderr: strings.TrimSpace(stderr.String())}
+	}
+	return stdout.String(), nil
+}
+
+// commandError is a keyring tool that exited with an error.
+type commandError struct {
+	err    error
+	stderr string
+}
+
+func (e *commandError) Error() string {
+	if e.stderr == "" {
+		return e.err.Error()
+	}
+	return fmt.Sprintf("%v: %s", e.err, e.stderr)
+}
+
+func (e *commandError) Unwrap() error { return e.err }
@@ -0,0 +1,114 @@
+package secrets
+
+import (
+	"errors"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestParseRef verifies only "keyring:" values with a name are references.
+func TestParseRef(t *testing.T) {
+	if name, ok := ParseRef(Ref("openai")); !ok || name != "openai" {
+		t.Errorf("Expected openai, got %q (%v)", name, ok)
+	}
+	for _, value := range []string{"sk-abc", "keyring:", ""} {
+		if _, ok := ParseRef(value); ok {
+			t.Errorf("Expected %q not to be a reference", value)
+		}
+	}
+}
+
+// TestValidateName verifies names are limited to safe characters.
+func TestValidateName(t *testing.T) {
+	for _, name := range []string{"openai", "tg.bot-token_2"} {
+		if err := ValidateName(name); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "my key", "a/b", "x;rm"} {
+		if err := ValidateName(name); err == nil {
+			t.Errorf("Expected %q to be rejected", name)
+		}
+	}
+}
+
+// TestParseKeychainDump verifies only this service's accounts are listed.
+func TestParseKeychainDump(t *testing.T) {
+	dump := `keychain: "/Users/me/Library/Keychains/login.keychain-db"
+class: "genp"
+attributes:
+    "acct"<blob>="openai"
+    "svce"<blob>="picoclaw"
+keychain: "/Users/me/Library/Keychains/login.keychain-db"
+class: "genp"
+attributes:
+    "acct"<blob>="me@example.com"
+    "svce"<blob>="other-app"
+keychain: "/Users/me/Library/Keychains/login.keychain-db"
+class: "genp"
+attributes:
+    "acct"<blob>="anthropic"
+    "svce"<blob>="picoclaw"
+`
+	if got := parseKeychainDump(dump); !reflect.DeepEqual(got, []string{"anthropic", "openai"}) {
+		t.Errorf("Expected [anthropic openai], got %v", got)
+	}
+}
+
+// TestSecretServiceStore verifies secret-tool is driven with the value on
+// stdin and that a missing secret is ErrNotFound.
+func TestSecretServiceStore(t *testing.T) {
+	stored := map[string]string{}
+	original := runCommand
+	defer func() { runCommand = original }()
+	runCommand = func(stdin, name string, args ...string) (string, error) {
+		if name != "secret-tool" {
+			t.Fatalf("Expected secret-tool, got %s", name)
+		}
+		key := args[len(args)-1]
+		switch args[0] {
+		case "store":
+			if strings.Contains(strings.Join(args, " "), stdin) {
+				t.Errorf("Expected the value only on stdin, got args %v", args)
+			}
+			stored[key] = stdin
+		case "lookup":
+			if value, ok := stored[key]; ok {
+				return value, nil
+			}
+			return "", &commandError{err: &exec.ExitError{}}
+		case "clear":
+			delete(stored, key)
+		case "search":
+			var out strings.Builder
+			for name := range stored {
+				out.WriteString("[/1]\nattribute.service = picoclaw\nattribute.name = " + name + "\n")
+			}
+			return out.String(), nil
+		}
+		return "", nil
+	}
+
+	store := secretServiceStore{}
+	if err := store.Set("openai", "sk-secret"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	store.Set("groq", "gsk-secret")
+	if value, err := store.Get("openai"); err != nil || value != "sk-secret" {
+		t.Errorf("Expected sk-secret, got %q (%v)", value, err)
+	}
+	if names, _ := store.List(); !reflect.DeepEqual(names, []string{"groq", "openai"}) {
+		t.Errorf("Expected [groq openai], got %v", names)
+	}
+	if err := store.Delete("openai"); err != nil {
+		t.Errorf("Delete failed: %v", err)
+	}
+	if _, err := store.Get("openai"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after delete, got %v", err)
+	}
+	if err := store.Delete("openai"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound deleting a missing secret, got %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+package secrets
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// keychainStore keeps secrets in the macOS keychain with the security tool.
+type keychainStore struct{}
+
+func (keychainStore) Name() string { return "macOS keychain" }
+
+func (keychainStore) Get(name string) (string, error) {
+	out, err := runCommand("", "security", "find-generic-password", "-s", Service, "-a", name, "-w")
+	if err != nil {
+		return "", keychainError(err)
+	}
+	return strings.TrimSuffix(out, "\n"), nil
+}
+
+func (keychainStore) Set(name, value string) error {
+	// Commands on stdin keep the value out of the process list; -X takes it
+	// hex-encoded, so no quoting is needed
+	command := fmt.Sprintf("add-generic-password -U -s %s -a %s -X %s\n", Service, name, hex.EncodeToString([]byte(value)))
+	_, err := runCommand(command, "security", "-i")
+	return err
+}
+
+func (keychainStore) Delete(name string) error {
+	_, err := runCommand("", "security", "delete-generic-password", "-s", Service, "-a", name)
+	return keychainError(err)
+}
+
+func (keychainStore) List() ([]string, error) {
+	out, err := runCommand("", "security", "dump-keychain")
+	if err != nil {
+		return nil, err
+	}
+	return parseKeychainDump(out), nil
+}
+
+func keychainError(err error) error {
+	if err != nil && strings.Contains(err.Error(), "could not be found") {
+		return ErrNotFound
+	}
+	return err
+}
+
+// parseKeychainDump finds the accounts of this service's items in the
+// output of security dump-keychain.
+func parseKeychainDump(out string) []string {
+	var names []string
+	account, service := "", ""
+	flush := func() {
+		if service == Service && account != "" {
+			names = append(names, account)
+		}
+		account, service = "", ""
+	}
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "keychain:") {
+			flush()
+			continue
+		}
+		if value, ok := strings.CutPrefix(line, `"acct"<blob>=`); ok {
+			account = strings.Trim(value, `"`)
+		} else if value, ok := strings.CutPrefix(line, `"svce"<blob>=`); ok {
+			service = strings.Trim(value, `"`)
+		}
+	}
+	flush()
+	sort.Strings(names)
+	return names
+}
+
+// secretServiceStore keeps secrets in the Secret Service (GNOME Keyring,
+// KWallet) with secret-tool, found in libsecret-tools.
+type secretServiceStore struct{}
+
+func (secretServiceStore) Name() string { return "Secret Service" }
+
+func (secretServiceStore) Get(name string) (string, error) {
+	out, err := runCommand("", "secret-tool", "lookup", "service", Service, "name", name)
+	if err != nil {
+		if _, exited := err.(*commandError); exited && out == "" {
+			return "", ErrNotFound
+		}
+		return "", err
+	}
+	return out, nil
+}
+
+func (secretServiceStore) Set(name, value string) error {
+	// The value is read from stdin, so it never shows in the process list
+	_, err := runCommand(value, "secret-tool", "store", "--label", Service+": "+name, "service", Service, "name", name)
+	return err
+}
+
+func (secretServiceStore) Delete(name string) error {
+	if _, err := (secretServiceStore{}).Get(name); err != nil {
+		return err
+	}
+	_, err := runCommand("", "secret-tool", "clear", "service", Service, "name", name)
+	return err
+}
+
+func (secretServiceStore) List() ([]string, error) {
+	out, err := runCommand("", "secret-tool", "search", "--all", "service", Service)
+	if err != nil {
+		if _, exited := err.(*commandError); exited && out == "" {
+			return nil, nil // nothing stored
+		}
+		return nil, err
+	}
+	var names []string
+	for _, line := range strings.Split(out, "\n") {
+		if name, ok := strings.CutPrefix(strings.TrimSpace(line), "attribute.name = "); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
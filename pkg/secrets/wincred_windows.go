@@ -0,0 +1,137 @@
+//go:build windows
+
+package secrets
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	advapi32           = windows.NewLazySystemDLL("advapi32.dll")
+	procCredReadW      = advapi32.NewProc("CredReadW")
+	procCredWriteW     = advapi32.NewProc("CredWriteW")
+	procCredDeleteW    = advapi32.NewProc("CredDeleteW")
+	procCredEnumerateW = advapi32.NewProc("CredEnumerateW")
+	procCredFree       = advapi32.NewProc("CredFree")
+)
+
+const (
+	credTypeGeneric         = 1
+	credPersistLocalMachine = 2
+)
+
+// credential is CREDENTIALW.
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        windows.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// Default returns the Windows Credential Manager.
+func Default() Store {
+	return credStore{}
+}
+
+// credStore keeps secrets as generic credentials named "picoclaw:<name>".
+type credStore struct{}
+
+func (credStore) Name() string { return "Windows Credential Manager" }
+
+func credTarget(name string) (*uint16, error) {
+	return windows.UTF16PtrFromString(Service + ":" + name)
+}
+
+func credError(err error) error {
+	if errors.Is(err, windows.ERROR_NOT_FOUND) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (credStore) Get(name string) (string, error) {
+	target, err := credTarget(name)
+	if err != nil {
+		return "", err
+	}
+	var cred *credential
+	if ret, _, err := procCredReadW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred))); ret == 0 {
+		return "", credError(err)
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(cred)))
+	if cred.CredentialBlobSize == 0 {
+		return "", nil
+	}
+	return string(unsafe.Slice(cred.CredentialBlob, cred.CredentialBlobSize)), nil
+}
+
+func (credStore) Set(name, value string) error {
+	target, err := credTarget(name)
+	if err != nil {
+		return err
+	}
+	user, _ := windows.UTF16PtrFromString(Service)
+	blob := []byte(value)
+	cred := credential{
+		Type:               credTypeGeneric,
+		TargetName:         target,
+		CredentialBlobSize: uint32(len(blob)),
+		Persist:            credPersistLocalMachine,
+		UserName:           user,
+	}
+	if len(blob) > 0 {
+		cred.CredentialBlob = &blob[0]
+	}
+	if ret, _, err := procCredWriteW.Call(uintptr(unsafe.Pointer(&cred)), 0); ret == 0 {
+		return err
+	}
+	return nil
+}
+
+func (credStore) Delete(name string) error {
+	target, err := credTarget(name)
+	if err != nil {
+		return err
+	}
+	if ret, _, err := procCredDeleteW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0); ret == 0 {
+		return credError(err)
+	}
+	return nil
+}
+
+func (credStore) List() ([]string, error) {
+	filter, _ := windows.UTF16PtrFromString(Service + ":*")
+	var count uint32
+	var creds **credential
+	if ret, _, err := procCredEnumerateW.Call(uintptr(unsafe.Pointer(filter)), 0,
+		uintptr(unsafe.Pointer(&count)), uintptr(unsafe.Pointer(&creds))); ret == 0 {
+		if errors.Is(err, windows.ERROR_NOT_FOUND) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(creds)))
+
+	var names []string
+	for _, cred := range unsafe.Slice(creds, count) {
+		target := windows.UTF16PtrToString(cred.TargetName)
+		if name, ok := strings.CutPrefix(target, Service+":"); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,154 @@
+package session
+
+import (
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// TurnCheckpoint marks a turn that has started but not finished. It is saved
+// with the session while the agent works, so that after a crash or power
+// loss the turn can be found and closed instead of leaving half a
+// conversation behind.
+type TurnCheckpoint struct {
+	Channel     string    `json:"channel,omitempty"`
+	ChatID      string    `json:"chat_id,omitempty"`
+	UserMessage string    `json:"user_message"`
+	Started     time.Time `json:"started"`
+	Iteration   int       `json:"iteration"`
+}
+
+// InterruptedTurn is a checkpoint found for a session at startup.
+type InterruptedTurn struct {
+	SessionKey string
+	TurnCheckpoint
+}
+
+// BeginTurn records that a turn is in progress for the session.
+func (sm *SessionManager) BeginTurn(key string, cp TurnCheckpoint) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session := sm.getOrCreateLocked(key)
+	if cp.Started.IsZero() {
+		cp.Started = time.Now()
+	}
+	session.Turn = &cp
+}
+
+// UpdateTurn records the current LLM iteration of the in-progress turn.
+func (sm *SessionManager) UpdateTurn(key string, iteration int) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if session, ok := sm.sessions[key]; ok && session.Turn != nil {
+		session.Turn.Iteration = iteration
+	}
+}
+
+// EndTurn clears the in-progress marker after a turn completed normally.
+func (sm *SessionManager) EndTurn(key string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if session, ok := sm.sessions[key]; ok {
+		session.Turn = nil
+	}
+}
+
+// InterruptedTurns returns the sessions that were loaded with a turn still
+// marked as in progress.
+func (sm *SessionManager) InterruptedTurns() []InterruptedTurn {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	var turns []InterruptedTurn
+	for key, session := range sm.sessions {
+		if session.Turn != nil {
+			turns = append(turns, InterruptedTurn{SessionKey: key, TurnCheckpoint: *session.Turn})
+		}
+	}
+	return turns
+}
+
+// CloseTurn ends an unfinished turn so the history is valid again: every
+// tool call without a result gets a placeholder result, and note (if not
+// empty) is added as the assistant's final message.
+func (sm *SessionManager) CloseTurn(key, note string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session, ok := sm.sessions[key]
+	if !ok {
+		return
+	}
+
+	session.Messages = append(session.Messages, missingToolResults(session.Messages)...)
+	if note != "" {
+		session.Messages = append(session.Messages, providers.Message{Role: "assistant", Content: note})
+	}
+	session.Turn = nil
+	session.Updated = time.Now()
+}
+
+// missingToolResults returns placeholder results for the tool calls of the
+// last assistant message that never got a result.
+func missingToolResults(messages []providers.Message) []providers.Message {
+	last := -1
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "assistant" && len(messages[i].ToolCalls) > 0 {
+			last = i
+			break
+		}
+	}
+	if last < 0 {
+		return nil
+	}
+
+	answered := make(map[string]bool)
+	for _, msg := range messages[last+1:] {
+		if msg.Role == "tool" {
+			answered[msg.ToolCallID] = true
+		}
+	}
+
+	var results []providers.Message
+	for _, tc := range messages[last].ToolCalls {
+		if answered[tc.ID] {
+			continue
+		}
+		results = append(results, providers.Message{
+			Role:       "tool",
+			Content:    "Error: this tool call was interrupted before it returned a result.",
+			ToolCallID: tc.ID,
+		})
+	}
+	return results
+}
+
+// getOrCreateLocked returns the session for key, creating it if needed.
+// Must be called with the lock held.
+func (sm *SessionManager) getOrCreateLocked(key string) *Session {
+	session, ok := sm.sessions[key]
+	if !ok {
+		session = &Session{
+			Key:      key,
+			Messages: []providers.Message{},
+			Created:  time.Now(),
+			Updated:  time.Now(),
+		}
+		sm.sessions[key] = session
+	}
+	return session
+}
+
+// CurrentTurn returns the checkpoint of the turn in progress, if any.
+func (sm *SessionManager) CurrentTurn(key string) (TurnCheckpoint, bool) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	if session, ok := sm.sessions[key]; ok && session.Turn != nil {
+		return *session.Turn, true
+	}
+	return TurnCheckpoint{}, false
+}
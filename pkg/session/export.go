@@ -0,0 +1,271 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// Export formats.
+const (
+	FormatMarkdown = "markdown"
+	FormatHTML     = "html"
+)
+
+// exportEntry is one message of a transcript, with the results of the tool
+// calls it made attached to the calls.
+type exportEntry struct {
+	Role    string
+	Content string
+	Calls   []exportCall
+}
+
+// exportCall is a tool call and its result.
+type exportCall struct {
+	ID        string
+	Name      string
+	Arguments string
+	Result    string
+	Answered  bool
+}
+
+// exportFooter sums up the session under the transcript.
+type exportFooter struct {
+	Messages  int
+	ToolCalls int
+	Usage     *providers.UsageInfo
+}
+
+// Export writes a transcript of the session in format, FormatMarkdown or
+// FormatHTML. Tool calls are shown folded, with their arguments and
+// results, and the session's token usage is given at the end.
+func Export(w io.Writer, s Session, format string) error {
+	entries := exportEntries(s.Messages)
+	footer := exportFooter{Messages: len(s.Messages), Usage: s.Usage}
+	for _, e := range entries {
+		footer.ToolCalls += len(e.Calls)
+	}
+	switch format {
+	case FormatMarkdown, "md", "":
+		return exportMarkdown(w, s, entries, footer)
+	case FormatHTML:
+		return exportHTML(w, s, entries, footer)
+	}
+	return fmt.Errorf("unknown export format %q (want markdown or html)", format)
+}
+
+// exportEntries pairs tool results with the calls that asked for them.
+// Results whose call isn't found are kept as entries of their own.
+func exportEntries(messages []providers.Message) []exportEntry {
+	var entries []exportEntry
+	calls := make(map[string]*exportCall)
+	for _, msg := range messages {
+		if msg.Role == "tool" {
+			if call, ok := calls[msg.ToolCallID]; ok && msg.ToolCallID != "" {
+				call.Result, call.Answered = msg.Content, true
+				continue
+			}
+			entries = append(entries, exportEntry{Role: "tool", Content: msg.Content})
+			continue
+		}
+		entry := exportEntry{Role: msg.Role, Content: msg.Content}
+		for _, tc := range msg.ToolCalls {
+			entry.Calls = append(entry.Calls, exportCall{ID: tc.ID, Name: toolCallName(tc), Arguments: toolCallArguments(tc)})
+		}
+		entries = append(entries, entry)
+		last := &entries[len(entries)-1]
+		for i := range last.Calls {
+			calls[last.Calls[i].ID] = &last.Calls[i]
+		}
+	}
+	return entries
+}
+
+func toolCallName(tc providers.ToolCall) string {
+	if tc.Name == "" && tc.Function != nil {
+		return tc.Function.Name
+	}
+	return tc.Name
+}
+
+// toolCallArguments renders the call's arguments as indented JSON.
+func toolCallArguments(tc providers.ToolCall) string {
+	if tc.Arguments == nil && tc.Function != nil {
+		var args interface{}
+		if err := json.Unmarshal([]byte(tc.Function.Arguments), &args); err != nil {
+			return tc.Function.Arguments
+		}
+		data, _ := json.MarshalIndent(args, "", "  ")
+		return string(data)
+	}
+	data, _ := json.MarshalIndent(tc.Arguments, "", "  ")
+	return string(data)
+}
+
+// roleTitle is the heading shown for a message from role.
+func roleTitle(role string) string {
+	switch role {
+	case "user":
+		return "👤 User"
+	case "assistant":
+		return "🤖 Assistant"
+	case "system":
+		return "⚙️ System"
+	case "tool":
+		return "🔧 Tool result"
+	}
+	return role
+}
+
+// usageLine describes the session's totals, e.g. "24 messages · 5 tool
+// calls · 13,023 tokens (12,345 prompt, 678 completion)".
+func usageLine(f exportFooter) string {
+	parts := []string{plural(f.Messages, "message"), plural(f.ToolCalls, "tool call")}
+	if u := f.Usage; u != nil {
+		total := u.TotalTokens
+		if total == 0 {
+			total = u.PromptTokens + u.CompletionTokens
+		}
+		parts = append(parts, fmt.Sprintf("%s tokens (%s prompt, %s completion)",
+			groupDigits(total), groupDigits(u.PromptTokens), groupDigits(u.CompletionTokens)))
+	}
+	return strings.Join(parts, " · ")
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// groupDigits writes n with thousands separators.
+func groupDigits(n int) string {
+	if n < 0 {
+		return "-" + groupDigits(-n)
+	}
+	s := fmt.Sprint(n)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+// fence returns a code fence longer than any run of backticks in text.
+func fence(text string) string {
+	longest, run := 0, 0
+	for _, r := range text {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
+
+func exportMarkdown(w io.Writer, s Session, entries []exportEntry, footer exportFooter) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Session %s\n\n", s.Key)
+	fmt.Fprintf(&b, "Started %s, last updated %s.\n\n", s.Created.Format(time.DateTime), s.Updated.Format(time.DateTime))
+	if s.Summary != "" {
+		fmt.Fprintf(&b, "> **Earlier conversation (summarized):** %s\n\n",
+			strings.ReplaceAll(strings.TrimSpace(s.Summary), "\n", "\n> "))
+	}
+	for _, e := range entries {
+		fmt.Fprintf(&b, "### %s\n\n", roleTitle(e.Role))
+		if content := strings.TrimSpace(e.Content); content != "" {
+			if e.Role == "tool" {
+				f := fence(content)
+				fmt.Fprintf(&b, "%s\n%s\n%s\n\n", f, content, f)
+			} else {
+				b.WriteString(content + "\n\n")
+			}
+		}
+		for _, call := range e.Calls {
+			fmt.Fprintf(&b, "<details>\n<summary>🔧 %s</summary>\n\n", template.HTMLEscapeString(call.Name))
+			f := fence(call.Arguments)
+			fmt.Fprintf(&b, "Arguments:\n\n%sjson\n%s\n%s\n\n", f, call.Arguments, f)
+			if call.Answered {
+				f = fence(call.Result)
+				fmt.Fprintf(&b, "Result:\n\n%s\n%s\n%s\n\n", f, call.Result, f)
+			} else {
+				b.WriteString("No result was recorded.\n\n")
+			}
+			b.WriteString("</details>\n\n")
+		}
+	}
+	fmt.Fprintf(&b, "---\n\n%s\n", usageLine(footer))
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+var htmlTranscript = template.Must(template.New("transcript").Funcs(template.FuncMap{
+	"title": roleTitle,
+	"usage": usageLine,
+	"date":  func(t time.Time) string { return t.Format(time.DateTime) },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Session {{.Session.Key}}</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 50rem; margin: 2rem auto; padding: 0 1rem; line-height: 1.5; color: #222; }
+.message { border-left: 3px solid #ccc; padding: 0.25rem 1rem; margin: 1rem 0; }
+.user { border-color: #3b82f6; }
+.assistant { border-color: #10b981; }
+.tool { border-color: #f59e0b; }
+h3 { margin: 0.5rem 0; font-size: 1rem; }
+.content { white-space: pre-wrap; }
+details { background: #f6f6f6; border-radius: 4px; padding: 0.25rem 0.75rem; margin: 0.5rem 0; }
+summary { cursor: pointer; font-family: monospace; }
+pre { white-space: pre-wrap; word-break: break-word; background: #fff; padding: 0.5rem; border-radius: 4px; }
+blockquote, footer, .meta { color: #666; }
+</style>
+</head>
+<body>
+<h1>Session {{.Session.Key}}</h1>
+<p class="meta">Started {{date .Session.Created}}, last updated {{date .Session.Updated}}.</p>
+{{- if .Session.Summary}}
+<blockquote><strong>Earlier conversation (summarized):</strong> {{.Session.Summary}}</blockquote>
+{{- end}}
+{{- range .Entries}}
+<div class="message {{.Role}}">
+<h3>{{title .Role}}</h3>
+{{- if .Content}}{{if eq .Role "tool"}}
+<pre>{{.Content}}</pre>{{else}}
+<div class="content">{{.Content}}</div>{{end}}{{end}}
+{{- range .Calls}}
+<details>
+<summary>🔧 {{.Name}}</summary>
+<p>Arguments:</p>
+<pre>{{.Arguments}}</pre>
+{{- if .Answered}}
+<p>Result:</p>
+<pre>{{.Result}}</pre>
+{{- else}}
+<p>No result was recorded.</p>
+{{- end}}
+</details>
+{{- end}}
+</div>
+{{- end}}
+<hr>
+<footer>{{usage .Footer}}</footer>
+</body>
+</html>
+`))
+
+func exportHTML(w io.Writer, s Session, entries []exportEntry, footer exportFooter) error {
+	return htmlTranscript.Execute(w, struct {
+		Session Session
+		Entries []exportEntry
+		Footer  exportFooter
+	}{s, entries, footer})
+}
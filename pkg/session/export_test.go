@@ -0,0 +1,87 @@
+package session
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+func exportSession() Session {
+	return Session{
+		Key: "telegram:123",
+		Messages: []providers.Message{
+			{Role: "user", Content: "What's in /tmp?"},
+			{Role: "assistant", ToolCalls: []providers.ToolCall{
+				{ID: "call_1", Name: "exec", Arguments: map[string]interface{}{"command": "ls /tmp"}},
+			}},
+			{Role: "tool", ToolCallID: "call_1", Content: "notes.txt\n<script>"},
+			{Role: "assistant", Content: "Just notes.txt."},
+		},
+		Usage:   &providers.UsageInfo{PromptTokens: 12345, CompletionTokens: 678},
+		Created: time.Date(2026, 3, 14, 9, 0, 0, 0, time.UTC),
+		Updated: time.Date(2026, 3, 14, 9, 5, 0, 0, time.UTC),
+	}
+}
+
+// TestExportMarkdown verifies tool calls are folded with their results and
+// the usage footer is written
+func TestExportMarkdown(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Export(&buf, exportSession(), FormatMarkdown); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"# Session telegram:123",
+		"<summary>🔧 exec</summary>",
+		`"command": "ls /tmp"`,
+		"Result:\n\n```\nnotes.txt\n<script>\n```",
+		"Just notes.txt.",
+		"4 messages · 1 tool call · 13,023 tokens (12,345 prompt, 678 completion)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in markdown, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "Tool result") {
+		t.Errorf("Expected the tool result to be attached to its call, got:\n%s", out)
+	}
+}
+
+// TestExportHTML verifies content is escaped and tool calls are collapsible
+func TestExportHTML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Export(&buf, exportSession(), FormatHTML); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "<details>") || !strings.Contains(out, "&lt;script&gt;") {
+		t.Errorf("Expected collapsible, escaped tool output, got:\n%s", out)
+	}
+	if strings.Contains(out, "<script>") {
+		t.Errorf("Expected tool output to be escaped, got:\n%s", out)
+	}
+	if !strings.Contains(out, "13,023 tokens") {
+		t.Errorf("Expected the usage footer, got:\n%s", out)
+	}
+}
+
+// TestExportUnknownFormat verifies an unknown format is an error
+func TestExportUnknownFormat(t *testing.T) {
+	if err := Export(&bytes.Buffer{}, exportSession(), "pdf"); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
+
+// TestFence verifies fences are longer than backtick runs in the text
+func TestFence(t *testing.T) {
+	if got := fence("plain"); got != "```" {
+		t.Errorf("Expected ```, got %s", got)
+	}
+	if got := fence("a ```` b"); got != "`````" {
+		t.Errorf("Expected 5 backticks, got %s", got)
+	}
+}
@@ -0,0 +1,80 @@
+package session
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// TurnStarts returns the index in messages of each turn's user message.
+// A turn is a user message and everything up to the next one.
+func TurnStarts(messages []providers.Message) []int {
+	var starts []int
+	for i, msg := range messages {
+		if msg.Role == "user" {
+			starts = append(starts, i)
+		}
+	}
+	return starts
+}
+
+// Turn returns the user message of turn n, counted from 1, and the reply
+// that ended it.
+func Turn(messages []providers.Message, n int) (prompt, reply string, ok bool) {
+	starts := TurnStarts(messages)
+	if n < 1 || n > len(starts) {
+		return "", "", false
+	}
+	end := len(messages)
+	if n < len(starts) {
+		end = starts[n]
+	}
+	for i := end - 1; i > starts[n-1]; i-- {
+		if messages[i].Role == "assistant" && messages[i].Content != "" {
+			reply = messages[i].Content
+			break
+		}
+	}
+	return messages[starts[n-1]].Content, reply, true
+}
+
+// Fork copies the first turns turns of session src into a new session dst,
+// with its summary, pinned facts and model overrides, so the conversation
+// can go on from there without touching src. A negative turns copies every
+// turn. The fork is only in memory until saved.
+func (sm *SessionManager) Fork(src, dst string, turns int) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	stored, ok := sm.sessions[src]
+	if !ok {
+		return fmt.Errorf("no session %s", src)
+	}
+	if _, exists := sm.sessions[dst]; exists {
+		return fmt.Errorf("session %s already exists", dst)
+	}
+	starts := TurnStarts(stored.Messages)
+	if turns > len(starts) {
+		return fmt.Errorf("session %s has only %d turns", src, len(starts))
+	}
+	end := len(stored.Messages)
+	if turns >= 0 && turns < len(starts) {
+		end = starts[turns]
+	}
+
+	fork := &Session{
+		Key:      dst,
+		Messages: append([]providers.Message{}, stored.Messages[:end]...),
+		Summary:  stored.Summary,
+		Pinned:   append([]string(nil), stored.Pinned...),
+		Created:  time.Now(),
+		Updated:  time.Now(),
+	}
+	if stored.Overrides != nil {
+		overrides := *stored.Overrides
+		fork.Overrides = &overrides
+	}
+	sm.sessions[dst] = fork
+	return nil
+}
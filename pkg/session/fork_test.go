@@ -0,0 +1,66 @@
+package session
+
+import (
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+func forkHistory() []providers.Message {
+	return []providers.Message{
+		{Role: "user", Content: "one"},
+		{Role: "assistant", Content: "first"},
+		{Role: "user", Content: "two"},
+		{Role: "assistant", ToolCalls: []providers.ToolCall{{ID: "c1", Name: "exec"}}},
+		{Role: "tool", ToolCallID: "c1", Content: "ok"},
+		{Role: "assistant", Content: "second"},
+		{Role: "user", Content: "three"},
+		{Role: "assistant", Content: "third"},
+	}
+}
+
+// TestFork verifies the fork keeps whole turns and the original is untouched
+func TestFork(t *testing.T) {
+	sm := NewSessionManager(t.TempDir())
+	sm.SetHistory("src", forkHistory())
+	sm.SetSummary("src", "earlier")
+	sm.SetOverrides("src", Overrides{Persona: "pirate"})
+
+	if err := sm.Fork("src", "dst", 2); err != nil {
+		t.Fatalf("Fork failed: %v", err)
+	}
+	history := sm.GetHistory("dst")
+	if len(history) != 6 || history[5].Content != "second" {
+		t.Errorf("Expected the first 2 turns, got %+v", history)
+	}
+	if sm.GetSummary("dst") != "earlier" || sm.GetOverrides("dst").Persona != "pirate" {
+		t.Errorf("Expected summary and overrides to be copied")
+	}
+	if len(sm.GetHistory("src")) != 8 {
+		t.Errorf("Expected the original to keep 8 messages, got %d", len(sm.GetHistory("src")))
+	}
+
+	if err := sm.Fork("src", "dst", 1); err == nil {
+		t.Error("Expected an error forking onto an existing session")
+	}
+	if err := sm.Fork("src", "other", 4); err == nil {
+		t.Error("Expected an error for more turns than the session has")
+	}
+	if err := sm.Fork("missing", "other", 1); err == nil {
+		t.Error("Expected an error for a missing session")
+	}
+	if err := sm.Fork("src", "all", -1); err != nil || len(sm.GetHistory("all")) != 8 {
+		t.Errorf("Expected -1 to copy every turn, got %v", err)
+	}
+}
+
+// TestTurn verifies a turn's prompt and final reply are found
+func TestTurn(t *testing.T) {
+	prompt, reply, ok := Turn(forkHistory(), 2)
+	if !ok || prompt != "two" || reply != "second" {
+		t.Errorf("Expected two/second, got %q/%q/%v", prompt, reply, ok)
+	}
+	if _, _, ok := Turn(forkHistory(), 4); ok {
+		t.Error("Expected no turn 4")
+	}
+}
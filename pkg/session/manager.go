@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -12,11 +13,25 @@ import (
 )
 
 type Session struct {
-	Key      string              `json:"key"`
-	Messages []providers.Message `json:"messages"`
-	Summary  string              `json:"summary,omitempty"`
-	Created  time.Time           `json:"created"`
-	Updated  time.Time           `json:"updated"`
+	Key       string               `json:"key"`
+	Messages  []providers.Message  `json:"messages"`
+	Summary   string               `json:"summary,omitempty"`
+	Pinned    []string             `json:"pinned,omitempty"`    // facts kept verbatim through summarization
+	Overrides *Overrides           `json:"overrides,omitempty"` // model settings chosen for this session
+	Turn      *TurnCheckpoint      `json:"turn,omitempty"`      // set while a turn is in progress
+	Plan      *Plan                `json:"plan,omitempty"`      // the step plan made with /plan
+	Usage     *providers.UsageInfo `json:"usage,omitempty"`     // tokens used by the session's model calls
+	Created   time.Time            `json:"created"`
+	Updated   time.Time            `json:"updated"`
+}
+
+// Overrides replace the configured model settings for one session. Empty
+// fields keep the configured value.
+type Overrides struct {
+	Model       string   `json:"model,omitempty"`
+	Provider    string   `json:"provider,omitempty"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	Persona     string   `json:"persona,omitempty"`
 }
 
 type SessionManager struct {
@@ -100,6 +115,62 @@ func (sm *SessionManager) GetHistory(key string) []providers.Message {
 	return history
 }
 
+// Get returns a copy of the session, for reading it whole.
+func (sm *SessionManager) Get(key string) (Session, bool) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	stored, ok := sm.sessions[key]
+	if !ok {
+		return Session{}, false
+	}
+	s := *stored
+	s.Messages = append([]providers.Message(nil), stored.Messages...)
+	s.Pinned = append([]string(nil), stored.Pinned...)
+	if stored.Usage != nil {
+		usage := *stored.Usage
+		s.Usage = &usage
+	}
+	return s, true
+}
+
+// AddUsage adds a model call's tokens to the session's totals.
+func (sm *SessionManager) AddUsage(key string, usage providers.UsageInfo) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session := sm.getOrCreateLocked(key)
+	if session.Usage == nil {
+		session.Usage = &providers.UsageInfo{}
+	}
+	session.Usage.PromptTokens += usage.PromptTokens
+	session.Usage.CompletionTokens += usage.CompletionTokens
+	session.Usage.TotalTokens += usage.TotalTokens
+}
+
+// Info describes a stored session without its messages.
+type Info struct {
+	Key      string
+	Messages int
+	Updated  time.Time
+}
+
+// List describes the sessions whose keys start with prefix, most recently
+// updated first.
+func (sm *SessionManager) List(prefix string) []Info {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	var infos []Info
+	for key, session := range sm.sessions {
+		if strings.HasPrefix(key, prefix) {
+			infos = append(infos, Info{Key: key, Messages: len(session.Messages), Updated: session.Updated})
+		}
+	}
+	slices.SortFunc(infos, func(a, b Info) int { return b.Updated.Compare(a.Updated) })
+	return infos
+}
+
 func (sm *SessionManager) GetSummary(key string) string {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
@@ -122,6 +193,94 @@ func (sm *SessionManager) SetSummary(key string, summary string) {
 	}
 }
 
+// GetPinned returns the facts pinned for the session.
+func (sm *SessionManager) GetPinned(key string) []string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	session, ok := sm.sessions[key]
+	if !ok {
+		return nil
+	}
+	return append([]string(nil), session.Pinned...)
+}
+
+// AddPinned pins facts to the session, skipping ones already pinned.
+func (sm *SessionManager) AddPinned(key string, facts ...string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session := sm.getOrCreateLocked(key)
+	for _, fact := range facts {
+		if !slices.Contains(session.Pinned, fact) {
+			session.Pinned = append(session.Pinned, fact)
+		}
+	}
+	session.Updated = time.Now()
+}
+
+// SetPinned replaces the facts pinned for the session.
+func (sm *SessionManager) SetPinned(key string, facts []string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session := sm.getOrCreateLocked(key)
+	session.Pinned = append([]string(nil), facts...)
+	session.Updated = time.Now()
+}
+
+// GetOverrides returns the session's model overrides.
+func (sm *SessionManager) GetOverrides(key string) Overrides {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	session, ok := sm.sessions[key]
+	if !ok || session.Overrides == nil {
+		return Overrides{}
+	}
+	return *session.Overrides
+}
+
+// SetOverrides replaces the session's model overrides.
+func (sm *SessionManager) SetOverrides(key string, overrides Overrides) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session := sm.getOrCreateLocked(key)
+	if overrides == (Overrides{}) {
+		session.Overrides = nil
+	} else {
+		session.Overrides = &overrides
+	}
+	session.Updated = time.Now()
+}
+
+// SetHistory replaces the messages of the session.
+func (sm *SessionManager) SetHistory(key string, messages []providers.Message) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session := sm.getOrCreateLocked(key)
+	session.Messages = append([]providers.Message(nil), messages...)
+	session.Updated = time.Now()
+}
+
+// Delete forgets the session and removes its file.
+func (sm *SessionManager) Delete(key string) error {
+	sm.mu.Lock()
+	delete(sm.sessions, key)
+	sm.mu.Unlock()
+
+	if sm.storage == "" || key == "" || key != filepath.Base(key) {
+		return nil
+	}
+	err := os.Remove(filepath.Join(sm.storage, key+".json"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
 func (sm *SessionManager) TruncateHistory(key string, keepLast int) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
@@ -169,6 +328,21 @@ func (sm *SessionManager) Save(key string) error {
 		Created: stored.Created,
 		Updated: stored.Updated,
 	}
+	if len(stored.Pinned) > 0 {
+		snapshot.Pinned = append([]string(nil), stored.Pinned...)
+	}
+	if stored.Overrides != nil {
+		overrides := *stored.Overrides
+		snapshot.Overrides = &overrides
+	}
+	if stored.Turn != nil {
+		turn := *stored.Turn
+		snapshot.Turn = &turn
+	}
+	if stored.Usage != nil {
+		usage := *stored.Usage
+		snapshot.Usage = &usage
+	}
 	if len(stored.Messages) > 0 {
 		snapshot.Messages = make([]providers.Message, len(stored.Messages))
 		copy(snapshot.Messages, stored.Messages)
@@ -0,0 +1,71 @@
+package session
+
+import "time"
+
+// Plan step statuses.
+const (
+	StepPending = "pending"
+	StepRunning = "running"
+	StepDone    = "done"
+	StepFailed  = "failed"
+	StepSkipped = "skipped" // failed, and replaced by new steps
+)
+
+// Plan is a step plan for a goal, made with /plan and run one step at a
+// time. It is kept with the session, so it survives a restart and can be
+// resumed.
+type Plan struct {
+	Goal     string     `json:"goal"`
+	Steps    []PlanStep `json:"steps"`
+	Replans  int        `json:"replans,omitempty"`  // times the remaining steps were replanned after a failure
+	Approved bool       `json:"approved,omitempty"` // the user let it run
+	Created  time.Time  `json:"created"`
+}
+
+// PlanStep is one step of a plan and how it went.
+type PlanStep struct {
+	Description string `json:"description"`
+	Status      string `json:"status"`
+	Result      string `json:"result,omitempty"` // the agent's reply, or why the step failed
+}
+
+// Next returns the index of the first step still to run, or -1 if there
+// are none.
+func (p *Plan) Next() int {
+	for i, step := range p.Steps {
+		if step.Status != StepDone && step.Status != StepSkipped {
+			return i
+		}
+	}
+	return -1
+}
+
+// GetPlan returns a copy of the session's plan, or nil if it has none.
+func (sm *SessionManager) GetPlan(key string) *Plan {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	session, ok := sm.sessions[key]
+	if !ok || session.Plan == nil {
+		return nil
+	}
+	plan := *session.Plan
+	plan.Steps = append([]PlanStep(nil), session.Plan.Steps...)
+	return &plan
+}
+
+// SetPlan replaces the session's plan; nil removes it.
+func (sm *SessionManager) SetPlan(key string, plan *Plan) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session := sm.getOrCreateLocked(key)
+	if plan == nil {
+		session.Plan = nil
+	} else {
+		stored := *plan
+		stored.Steps = append([]PlanStep(nil), plan.Steps...)
+		session.Plan = &stored
+	}
+	session.Updated = time.Now()
+}
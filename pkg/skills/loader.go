@@ -260,11 +260,12 @@ func (sl *SkillsLoader) parseSimpleYAML(content string) map[string]string {
 	return result
 }
 
+// frontmatter matches a leading block between --- lines. (?s) lets . match
+// newlines, so the block can span several lines.
+var frontmatter = regexp.MustCompile(`(?s)^---\r?\n(.*?)\r?\n---[ \t]*(?:\r?\n|$)`)
+
 func (sl *SkillsLoader) extractFrontmatter(content string) string {
-	// (?s) enables DOTALL mode so . matches newlines
-	// Match first ---, capture everything until next --- on its own line
-	re := regexp.MustCompile(`(?s)^---\n(.*)\n---`)
-	match := re.FindStringSubmatch(content)
+	match := frontmatter.FindStringSubmatch(content)
 	if len(match) > 1 {
 		return match[1]
 	}
@@ -272,8 +273,7 @@ func (sl *SkillsLoader) extractFrontmatter(content string) string {
 }
 
 func (sl *SkillsLoader) stripFrontmatter(content string) string {
-	re := regexp.MustCompile(`^---\n.*?\n---\n`)
-	return re.ReplaceAllString(content, "")
+	return frontmatter.ReplaceAllString(content, "")
 }
 
 func escapeXML(s string) string {
@@ -0,0 +1,94 @@
+package tasks
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/sipeed/picoclaw/pkg/calendar"
+)
+
+// CalDAV syncs with a CalDAV task list (Nextcloud Tasks, Radicale, iCloud
+// Reminders, ...), keeping tasks as VTODOs. A task's remote ID is the URL
+// of its resource.
+type CalDAV struct {
+	list *calendar.CalDAV
+	loc  *time.Location
+}
+
+// NewCalDAV returns a remote for the task list collection at url.
+func NewCalDAV(url, username, password string, loc *time.Location) *CalDAV {
+	return &CalDAV{list: calendar.NewCalDAV("tasks", url, username, password, loc, false), loc: loc}
+}
+
+func (c *CalDAV) Name() string { return "CalDAV" }
+
+func (c *CalDAV) Open(ctx context.Context) ([]Task, error) {
+	todos, err := c.list.Todos(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var tasks []Task
+	for _, todo := range todos {
+		if todo.Completed || todo.Href == "" {
+			continue
+		}
+		task := Task{
+			Title:    todo.Summary,
+			Notes:    todo.Description,
+			Due:      todo.Due,
+			DueTime:  !todo.Due.IsZero() && !todo.DueDate,
+			Priority: todoPriority(todo.Priority),
+			Remote:   todo.Href,
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+func (c *CalDAV) Save(ctx context.Context, t Task) (string, error) {
+	todo := calendar.Todo{UID: uuid.NewString() + "@picoclaw"}
+	if t.Remote != "" {
+		var err error
+		if todo, err = c.list.Todo(ctx, t.Remote); err != nil {
+			return "", err
+		}
+	}
+	todo.Summary, todo.Description = t.Title, t.Notes
+	todo.Due, todo.DueDate = t.Due, !t.DueTime
+	todo.Priority = icalPriority(t.Priority)
+	return c.list.PutTodo(ctx, todo)
+}
+
+func (c *CalDAV) Complete(ctx context.Context, t Task) error {
+	todo, err := c.list.Todo(ctx, t.Remote)
+	if err != nil {
+		return err
+	}
+	todo.Completed = true
+	_, err = c.list.PutTodo(ctx, todo)
+	return err
+}
+
+func (c *CalDAV) Delete(ctx context.Context, t Task) error {
+	return c.list.DeleteTodo(ctx, t.Remote)
+}
+
+// todoPriority reads an iCalendar priority: 1 to 4 is high, 5 medium and
+// 6 to 9 low (RFC 5545).
+func todoPriority(p int) Priority {
+	switch {
+	case p == 1:
+		return PriorityUrgent
+	case p >= 2 && p <= 4:
+		return PriorityHigh
+	case p >= 6:
+		return PriorityLow
+	}
+	return PriorityNormal
+}
+
+func icalPriority(p Priority) int {
+	return map[Priority]int{PriorityLow: 9, PriorityNormal: 5, PriorityHigh: 3, PriorityUrgent: 1}[p]
+}
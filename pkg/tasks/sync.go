@@ -0,0 +1,102 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Remote is a task service the list is synced with.
+type Remote interface {
+	Name() string
+	// Open returns the service's unfinished tasks, with Remote set.
+	Open(ctx context.Context) ([]Task, error)
+	// Save creates the task, or updates it when Remote is set, and returns
+	// its remote ID.
+	Save(ctx context.Context, t Task) (string, error)
+	Complete(ctx context.Context, t Task) error
+	Delete(ctx context.Context, t Task) error
+}
+
+// SyncResult lists what a sync changed locally, and how many local tasks
+// it pushed.
+type SyncResult struct {
+	Imported  []Task // new on the remote
+	Updated   []Task // changed on the remote
+	Completed []Task // finished or deleted on the remote
+	Pushed    int
+}
+
+// Sync brings the store and the remote in line. The remote wins for
+// tasks both have, except that a task finished locally is finished there
+// too. Priorities are only copied on import, since services grade them
+// differently. Tasks the remote doesn't know are pushed to it.
+func Sync(ctx context.Context, store *Store, remote Remote) (SyncResult, error) {
+	var result SyncResult
+	open, err := remote.Open(ctx)
+	if err != nil {
+		return result, fmt.Errorf("%s: %w", remote.Name(), err)
+	}
+	remoteTasks := make(map[string]Task, len(open))
+	for _, t := range open {
+		remoteTasks[t.Remote] = t
+	}
+	local, err := store.List(Filter{All: true})
+	if err != nil {
+		return result, err
+	}
+
+	known := make(map[string]bool, len(local))
+	for _, t := range local {
+		if t.Remote == "" {
+			if t.Done {
+				continue
+			}
+			id, err := remote.Save(ctx, t)
+			if err != nil {
+				return result, fmt.Errorf("%s: %w", remote.Name(), err)
+			}
+			t.Remote = id
+			if err := store.Update(t); err != nil {
+				return result, err
+			}
+			known[id] = true
+			result.Pushed++
+			continue
+		}
+		known[t.Remote] = true
+		r, stillOpen := remoteTasks[t.Remote]
+		switch {
+		case t.Done && stillOpen:
+			if err := remote.Complete(ctx, t); err != nil {
+				return result, fmt.Errorf("%s: %w", remote.Name(), err)
+			}
+			result.Pushed++
+		case t.Done:
+		case !stillOpen:
+			t.Done, t.Completed = true, time.Now()
+			if err := store.Update(t); err != nil {
+				return result, err
+			}
+			result.Completed = append(result.Completed, t)
+		case r.Title != t.Title || r.Notes != t.Notes || !r.Due.Equal(t.Due) || r.DueTime != t.DueTime:
+			t.Title, t.Notes, t.Due, t.DueTime = r.Title, r.Notes, r.Due, r.DueTime
+			if err := store.Update(t); err != nil {
+				return result, err
+			}
+			result.Updated = append(result.Updated, t)
+		}
+	}
+
+	for _, r := range open {
+		if known[r.Remote] {
+			continue
+		}
+		added, err := store.Add(r)
+		if err != nil {
+			return result, err
+		}
+		result.Imported = append(result.Imported, added)
+	}
+	return result, nil
+}
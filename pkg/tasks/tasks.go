@@ -0,0 +1,304 @@
+// Package tasks keeps the user's to-do list in a local SQLite database and
+// syncs it with Todoist or a CalDAV task list. The database is driven
+// through the sqlite3 command-line client, as the sql tool does, so that
+// picoclaw stays a pure Go build.
+package tasks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned for a task ID that isn't in the store.
+var ErrNotFound = errors.New("task not found")
+
+// Priority orders tasks; higher is more important.
+type Priority int
+
+const (
+	PriorityLow Priority = iota + 1
+	PriorityNormal
+	PriorityHigh
+	PriorityUrgent
+)
+
+var priorityNames = map[Priority]string{
+	PriorityLow:    "low",
+	PriorityNormal: "normal",
+	PriorityHigh:   "high",
+	PriorityUrgent: "urgent",
+}
+
+func (p Priority) String() string {
+	if name, ok := priorityNames[p]; ok {
+		return name
+	}
+	return "normal"
+}
+
+// ParsePriority reads a priority name; empty is normal.
+func ParsePriority(s string) (Priority, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return PriorityNormal, nil
+	}
+	for p, name := range priorityNames {
+		if name == s {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown priority %q: use low, normal, high or urgent", s)
+}
+
+// Task is one to-do item.
+type Task struct {
+	ID        int64
+	Title     string
+	Notes     string
+	Due       time.Time // zero if none
+	DueTime   bool      // Due has a time of day; otherwise only its date counts
+	Priority  Priority
+	Done      bool
+	Completed time.Time
+	Created   time.Time
+	Reminder  string // ID of the cron job reminding of it
+	Remote    string // ID in the synced service
+}
+
+// Filter selects tasks to list.
+type Filter struct {
+	Done      bool      // list done tasks instead of open ones
+	All       bool      // list both
+	DueBefore time.Time // only tasks due before this time
+	Search    string    // only tasks whose title or notes contain this
+}
+
+const schema = `CREATE TABLE IF NOT EXISTS tasks (
+	id INTEGER PRIMARY KEY,
+	title TEXT NOT NULL,
+	notes TEXT NOT NULL DEFAULT '',
+	due INTEGER,
+	due_time INTEGER NOT NULL DEFAULT 0,
+	priority INTEGER NOT NULL DEFAULT 2,
+	done INTEGER NOT NULL DEFAULT 0,
+	completed INTEGER,
+	created INTEGER NOT NULL,
+	reminder TEXT NOT NULL DEFAULT '',
+	remote TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS tasks_open ON tasks (done, due);`
+
+// columns is the order tasks are selected in.
+const columns = "id, title, notes, due, due_time, priority, done, completed, created, reminder, remote"
+
+// Store is a to-do list kept in an SQLite file.
+type Store struct {
+	path    string
+	sqlite3 string
+	mu      sync.Mutex
+}
+
+// Open opens the task database at path, creating it if needed.
+func Open(path string) (*Store, error) {
+	bin, err := exec.LookPath("sqlite3")
+	if err != nil {
+		return nil, errors.New("the task list needs sqlite3 (e.g. apt install sqlite3)")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	s := &Store{path: path, sqlite3: bin}
+	if _, err := s.query(schema); err != nil {
+		return nil, fmt.Errorf("failed to create the task database: %w", err)
+	}
+	return s, nil
+}
+
+// Add saves a new task and returns it with its ID.
+func (s *Store) Add(t Task) (Task, error) {
+	if t.Created.IsZero() {
+		t.Created = time.Now()
+	}
+	if t.Priority == 0 {
+		t.Priority = PriorityNormal
+	}
+	rows, err := s.query(fmt.Sprintf(
+		"INSERT INTO tasks (title, notes, due, due_time, priority, done, completed, created, reminder, remote) VALUES (%s, %s, %s, %d, %d, %d, %s, %d, %s, %s); "+
+			"SELECT "+columns+" FROM tasks WHERE id = last_insert_rowid();",
+		quote(t.Title), quote(t.Notes), unixOrNull(t.Due), boolInt(t.DueTime), t.Priority, boolInt(t.Done),
+		unixOrNull(t.Completed), t.Created.Unix(), quote(t.Reminder), quote(t.Remote)))
+	if err != nil {
+		return Task{}, err
+	}
+	if len(rows) != 1 {
+		return Task{}, errors.New("the new task was not saved")
+	}
+	return rows[0], nil
+}
+
+// Get returns the task with the given ID.
+func (s *Store) Get(id int64) (Task, error) {
+	rows, err := s.query(fmt.Sprintf("SELECT "+columns+" FROM tasks WHERE id = %d;", id))
+	if err != nil {
+		return Task{}, err
+	}
+	if len(rows) == 0 {
+		return Task{}, ErrNotFound
+	}
+	return rows[0], nil
+}
+
+// Update saves changes to an existing task.
+func (s *Store) Update(t Task) error {
+	rows, err := s.query(fmt.Sprintf(
+		"UPDATE tasks SET title = %s, notes = %s, due = %s, due_time = %d, priority = %d, done = %d, completed = %s, reminder = %s, remote = %s WHERE id = %d; "+
+			"SELECT "+columns+" FROM tasks WHERE id = %d;",
+		quote(t.Title), quote(t.Notes), unixOrNull(t.Due), boolInt(t.DueTime), t.Priority, boolInt(t.Done),
+		unixOrNull(t.Completed), quote(t.Reminder), quote(t.Remote), t.ID, t.ID))
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Delete removes a task.
+func (s *Store) Delete(id int64) error {
+	rows, err := s.query(fmt.Sprintf("SELECT id FROM tasks WHERE id = %d; DELETE FROM tasks WHERE id = %d;", id, id))
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// List returns the tasks matching f: undated tasks last, then by due date,
+// priority and age. Done tasks come most recently completed first.
+func (s *Store) List(f Filter) ([]Task, error) {
+	var where []string
+	switch {
+	case f.All:
+	case f.Done:
+		where = append(where, "done = 1")
+	default:
+		where = append(where, "done = 0")
+	}
+	if !f.DueBefore.IsZero() {
+		where = append(where, fmt.Sprintf("due IS NOT NULL AND due < %d", f.DueBefore.Unix()))
+	}
+	if f.Search != "" {
+		pattern := quote("%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(f.Search) + "%")
+		where = append(where, fmt.Sprintf(`(title LIKE %s ESCAPE '\' OR notes LIKE %s ESCAPE '\')`, pattern, pattern))
+	}
+	query := "SELECT " + columns + " FROM tasks"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	if f.Done && !f.All {
+		query += " ORDER BY completed DESC, id DESC;"
+	} else {
+		query += " ORDER BY done, due IS NULL, due, priority DESC, id;"
+	}
+	return s.query(query)
+}
+
+// row is a task as sqlite3 prints it in JSON mode.
+type row struct {
+	ID        int64  `json:"id"`
+	Title     string `json:"title"`
+	Notes     string `json:"notes"`
+	Due       *int64 `json:"due"`
+	DueTime   int    `json:"due_time"`
+	Priority  int    `json:"priority"`
+	Done      int    `json:"done"`
+	Completed *int64 `json:"completed"`
+	Created   int64  `json:"created"`
+	Reminder  string `json:"reminder"`
+	Remote    string `json:"remote"`
+}
+
+// query runs sql and returns the tasks it selects.
+func (s *Store) query(sql string) ([]Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	// -safe refuses ATTACH, extensions and shell escapes
+	cmd := exec.CommandContext(ctx, s.sqlite3, "-safe", "-bail", "-json", "-cmd", ".timeout 5000", s.path, sql)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, errors.New(msg)
+		}
+		return nil, err
+	}
+
+	// Each SELECT prints its own array; the last one is the answer
+	out := bytes.TrimSpace(stdout.Bytes())
+	if len(out) == 0 {
+		return nil, nil
+	}
+	if i := bytes.LastIndex(out, []byte("\n[")); i >= 0 {
+		out = out[i+1:]
+	}
+	var rows []row
+	if err := json.Unmarshal(out, &rows); err != nil {
+		return nil, fmt.Errorf("unexpected sqlite3 output: %w", err)
+	}
+	tasks := make([]Task, len(rows))
+	for i, r := range rows {
+		tasks[i] = Task{
+			ID:       r.ID,
+			Title:    r.Title,
+			Notes:    r.Notes,
+			DueTime:  r.DueTime != 0,
+			Priority: Priority(r.Priority),
+			Done:     r.Done != 0,
+			Created:  time.Unix(r.Created, 0),
+			Reminder: r.Reminder,
+			Remote:   r.Remote,
+		}
+		if r.Due != nil {
+			tasks[i].Due = time.Unix(*r.Due, 0)
+		}
+		if r.Completed != nil {
+			tasks[i].Completed = time.Unix(*r.Completed, 0)
+		}
+	}
+	return tasks, nil
+}
+
+// quote renders s as an SQL string literal. NUL bytes, which would end the
+// statement early, are dropped.
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(strings.ReplaceAll(s, "\x00", ""), "'", "''") + "'"
+}
+
+func unixOrNull(t time.Time) string {
+	if t.IsZero() {
+		return "NULL"
+	}
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
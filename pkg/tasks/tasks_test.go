@@ -0,0 +1,236 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openTestStore(t *testing.T) *Store {
+	t.Helper()
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 is not installed")
+	}
+	store, err := Open(filepath.Join(t.TempDir(), "tasks.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func titles(list []Task) string {
+	var names []string
+	for _, t := range list {
+		names = append(names, t.Title)
+	}
+	return strings.Join(names, ", ")
+}
+
+// TestStore verifies tasks are saved, ordered, filtered and removed
+func TestStore(t *testing.T) {
+	store := openTestStore(t)
+	day := time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC)
+
+	passport, err := store.Add(Task{Title: "Renew passport", Notes: "Photo's at home", Due: day.AddDate(0, 0, 3)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if passport.ID == 0 || passport.Priority != PriorityNormal || passport.Created.IsZero() || passport.Notes != "Photo's at home" {
+		t.Errorf("Unexpected new task %+v", passport)
+	}
+	store.Add(Task{Title: "Call plumber", Due: day.Add(17 * time.Hour), DueTime: true, Priority: PriorityUrgent})
+	store.Add(Task{Title: "Read 50% of the book", Priority: PriorityLow})
+	store.Add(Task{Title: "Water plants", Due: day.Add(17 * time.Hour), DueTime: true, Priority: PriorityLow})
+
+	list, err := store.List(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := titles(list); got != "Call plumber, Water plants, Renew passport, Read 50% of the book" {
+		t.Errorf("Unexpected order: %s", got)
+	}
+	if got, _ := store.List(Filter{DueBefore: day.AddDate(0, 0, 1)}); titles(got) != "Call plumber, Water plants" {
+		t.Errorf("Expected the tasks due on the day, got %s", titles(got))
+	}
+	if got, _ := store.List(Filter{Search: "50%"}); titles(got) != "Read 50% of the book" {
+		t.Errorf("Expected a literal search, got %s", titles(got))
+	}
+	if got, _ := store.List(Filter{Search: "photo"}); titles(got) != "Renew passport" {
+		t.Errorf("Expected notes searched, got %s", titles(got))
+	}
+
+	passport.Done, passport.Completed, passport.Reminder = true, day, "job-1"
+	if err := store.Update(passport); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.Get(passport.ID)
+	if err != nil || !got.Done || !got.Completed.Equal(day) || got.Reminder != "job-1" || !got.Due.Equal(day.AddDate(0, 0, 3)) {
+		t.Errorf("Expected the update saved, got %+v %v", got, err)
+	}
+	if done, _ := store.List(Filter{Done: true}); titles(done) != "Renew passport" {
+		t.Errorf("Expected the done task, got %s", titles(done))
+	}
+
+	if err := store.Delete(passport.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(passport.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected the task gone, got %v", err)
+	}
+	if err := store.Delete(passport.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected deleting it again to fail, got %v", err)
+	}
+	if err := store.Update(Task{ID: 999, Title: "x"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected updating a missing task to fail, got %v", err)
+	}
+}
+
+// fakeRemote is a task service held in memory.
+type fakeRemote struct {
+	open      map[string]Task
+	completed []string
+	next      int
+}
+
+func (f *fakeRemote) Name() string { return "fake" }
+
+func (f *fakeRemote) Open(ctx context.Context) ([]Task, error) {
+	var list []Task
+	for _, t := range f.open {
+		list = append(list, t)
+	}
+	return list, nil
+}
+
+func (f *fakeRemote) Save(ctx context.Context, t Task) (string, error) {
+	if t.Remote == "" {
+		f.next++
+		t.Remote = "r" + string(rune('0'+f.next))
+	}
+	t.ID = 0
+	f.open[t.Remote] = t
+	return t.Remote, nil
+}
+
+func (f *fakeRemote) Complete(ctx context.Context, t Task) error {
+	delete(f.open, t.Remote)
+	f.completed = append(f.completed, t.Remote)
+	return nil
+}
+
+func (f *fakeRemote) Delete(ctx context.Context, t Task) error {
+	delete(f.open, t.Remote)
+	return nil
+}
+
+// TestSync verifies tasks are imported, updated, finished and pushed
+func TestSync(t *testing.T) {
+	store := openTestStore(t)
+	due := time.Date(2026, 10, 20, 9, 0, 0, 0, time.UTC)
+	remote := &fakeRemote{open: map[string]Task{
+		"a": {Title: "Imported", Priority: PriorityHigh, Remote: "a"},
+		"b": {Title: "Renamed there", Due: due, DueTime: true, Remote: "b"},
+		"c": {Title: "Finished here", Remote: "c"},
+	}}
+	store.Add(Task{Title: "Renamed here", Remote: "b"})
+	store.Add(Task{Title: "Finished here", Remote: "c", Done: true})
+	store.Add(Task{Title: "Finished there", Remote: "gone"})
+	store.Add(Task{Title: "Local only"})
+
+	result, err := Sync(context.Background(), store, remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if titles(result.Imported) != "Imported" || result.Imported[0].Priority != PriorityHigh {
+		t.Errorf("Expected one import, got %+v", result.Imported)
+	}
+	if titles(result.Updated) != "Renamed there" || !result.Updated[0].Due.Equal(due) {
+		t.Errorf("Expected the rename pulled, got %+v", result.Updated)
+	}
+	if titles(result.Completed) != "Finished there" {
+		t.Errorf("Expected the task finished remotely closed, got %+v", result.Completed)
+	}
+	if result.Pushed != 2 || len(remote.completed) != 1 || remote.completed[0] != "c" {
+		t.Errorf("Expected the local task sent and the finished one closed, got %d %v", result.Pushed, remote.completed)
+	}
+	if _, ok := remote.open["r1"]; !ok {
+		t.Errorf("Expected the local task on the remote, got %v", remote.open)
+	}
+
+	open, _ := store.List(Filter{})
+	if got := titles(open); got != "Renamed there, Imported, Local only" {
+		t.Errorf("Unexpected open tasks after sync: %s", got)
+	}
+	if result, err := Sync(context.Background(), store, remote); err != nil ||
+		len(result.Imported)+len(result.Updated)+len(result.Completed)+result.Pushed != 0 {
+		t.Errorf("Expected a second sync to change nothing, got %+v %v", result, err)
+	}
+}
+
+// TestTodoist verifies tasks are read page by page and written in
+// Todoist's form
+func TestTodoist(t *testing.T) {
+	var requests []string
+	var saved map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		requests = append(requests, r.Method+" "+r.URL.RequestURI())
+		switch {
+		case r.Method == http.MethodGet && r.URL.Query().Get("cursor") == "":
+			io.WriteString(w, `{"results":[{"id":"1","content":"Pay rent","priority":4,"due":{"date":"2026-10-20"}}],"next_cursor":"p2"}`)
+		case r.Method == http.MethodGet:
+			io.WriteString(w, `{"results":[{"id":"2","content":"Dentist","description":"Bring card","priority":1,"due":{"date":"2026-10-21T14:30:00Z"}}],"next_cursor":null}`)
+		case r.URL.Path == "/tasks":
+			json.NewDecoder(r.Body).Decode(&saved)
+			io.WriteString(w, `{"id":"3"}`)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	todoist := NewTodoist("tok", time.UTC)
+	todoist.api = server.URL
+	ctx := context.Background()
+	open, err := todoist.Open(ctx)
+	if err != nil || len(open) != 2 {
+		t.Fatalf("Expected 2 tasks, got %+v %v", open, err)
+	}
+	if rent := open[0]; rent.Remote != "1" || rent.Priority != PriorityUrgent || rent.DueTime ||
+		!rent.Due.Equal(time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected task %+v", rent)
+	}
+	if dentist := open[1]; dentist.Notes != "Bring card" || dentist.Priority != PriorityNormal || !dentist.DueTime {
+		t.Errorf("Unexpected task %+v", dentist)
+	}
+
+	id, err := todoist.Save(ctx, Task{Title: "Call mum", Priority: PriorityHigh, Due: time.Date(2026, 10, 22, 0, 0, 0, 0, time.UTC)})
+	if err != nil || id != "3" {
+		t.Fatalf("Expected the new task's ID, got %q %v", id, err)
+	}
+	if saved["content"] != "Call mum" || saved["priority"] != float64(3) || saved["due_date"] != "2026-10-22" {
+		t.Errorf("Unexpected task sent: %v", saved)
+	}
+	if err := todoist.Complete(ctx, Task{Remote: "3"}); err != nil {
+		t.Fatal(err)
+	}
+	if last := requests[len(requests)-1]; last != "POST /tasks/3/close" {
+		t.Errorf("Expected the task closed, got %s", last)
+	}
+
+	todoist.token = "wrong"
+	if _, err := todoist.Open(ctx); err == nil || !strings.Contains(err.Error(), "API token") {
+		t.Errorf("Expected a token error, got %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package tasks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const todoistAPI = "https://api.todoist.com/api/v1"
+
+// Todoist syncs with the user's Todoist inbox through its REST API.
+type Todoist struct {
+	api    string
+	token  string
+	loc    *time.Location
+	client *http.Client
+}
+
+// NewTodoist returns a Todoist remote for the API token from Todoist's
+// integration settings. Floating due times are taken to be in loc.
+func NewTodoist(token string, loc *time.Location) *Todoist {
+	return &Todoist{api: todoistAPI, token: token, loc: loc, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+func (t *Todoist) Name() string { return "Todoist" }
+
+// todoistTask is the part of a Todoist task we use.
+type todoistTask struct {
+	ID          string `json:"id"`
+	Content     string `json:"content"`
+	Description string `json:"description"`
+	Priority    int    `json:"priority"`
+	Due         *struct {
+		Date     string `json:"date"`
+		Datetime string `json:"datetime"`
+	} `json:"due"`
+}
+
+func (t *Todoist) Open(ctx context.Context) ([]Task, error) {
+	var tasks []Task
+	cursor := ""
+	for {
+		endpoint := t.api + "/tasks?limit=200"
+		if cursor != "" {
+			endpoint += "&cursor=" + url.QueryEscape(cursor)
+		}
+		var page struct {
+			Results    []todoistTask `json:"results"`
+			NextCursor *string       `json:"next_cursor"`
+		}
+		if err := t.do(ctx, http.MethodGet, endpoint, nil, &page); err != nil {
+			return nil, err
+		}
+		for _, tt := range page.Results {
+			tasks = append(tasks, t.task(tt))
+		}
+		if page.NextCursor == nil || *page.NextCursor == "" {
+			return tasks, nil
+		}
+		cursor = *page.NextCursor
+	}
+}
+
+// task converts a Todoist task. Todoist's priority 1 is unflagged, 4 the
+// most urgent.
+func (t *Todoist) task(tt todoistTask) Task {
+	task := Task{
+		Title:    tt.Content,
+		Notes:    tt.Description,
+		Priority: map[int]Priority{1: PriorityNormal, 2: PriorityHigh, 3: PriorityHigh, 4: PriorityUrgent}[tt.Priority],
+		Remote:   tt.ID,
+	}
+	if task.Priority == 0 {
+		task.Priority = PriorityNormal
+	}
+	if tt.Due != nil {
+		value := tt.Due.Datetime
+		if value == "" {
+			value = tt.Due.Date
+		}
+		if due, err := time.Parse(time.RFC3339, value); err == nil {
+			task.Due, task.DueTime = due, true
+		} else if due, err := time.ParseInLocation("2006-01-02T15:04:05", value, t.loc); err == nil {
+			task.Due, task.DueTime = due, true
+		} else if due, err := time.ParseInLocation("2006-01-02", value, t.loc); err == nil {
+			task.Due = due
+		}
+	}
+	return task
+}
+
+func (t *Todoist) Save(ctx context.Context, task Task) (string, error) {
+	body := map[string]interface{}{
+		"content":     task.Title,
+		"description": task.Notes,
+		"priority":    map[Priority]int{PriorityLow: 1, PriorityNormal: 1, PriorityHigh: 3, PriorityUrgent: 4}[task.Priority],
+	}
+	switch {
+	case task.Due.IsZero() && task.Remote != "":
+		body["due_string"] = "no date"
+	case task.Due.IsZero():
+	case task.DueTime:
+		body["due_datetime"] = task.Due.UTC().Format(time.RFC3339)
+	default:
+		body["due_date"] = task.Due.In(t.loc).Format("2006-01-02")
+	}
+	endpoint := t.api + "/tasks"
+	if task.Remote != "" {
+		endpoint += "/" + url.PathEscape(task.Remote)
+	}
+	var saved todoistTask
+	if err := t.do(ctx, http.MethodPost, endpoint, body, &saved); err != nil {
+		return "", err
+	}
+	if saved.ID == "" {
+		return task.Remote, nil
+	}
+	return saved.ID, nil
+}
+
+func (t *Todoist) Complete(ctx context.Context, task Task) error {
+	return t.do(ctx, http.MethodPost, t.api+"/tasks/"+url.PathEscape(task.Remote)+"/close", nil, nil)
+}
+
+func (t *Todoist) Delete(ctx context.Context, task Task) error {
+	return t.do(ctx, http.MethodDelete, t.api+"/tasks/"+url.PathEscape(task.Remote), nil, nil)
+}
+
+// do sends body as JSON and decodes the answer into out, if given.
+func (t *Todoist) do(ctx context.Context, method, endpoint string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Todoist request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("Todoist refused the API token (status %d)", resp.StatusCode)
+	case resp.StatusCode/100 != 2:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("Todoist returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	case out == nil || resp.StatusCode == http.StatusNoContent:
+		return nil
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 10<<20)).Decode(out); err != nil {
+		return fmt.Errorf("failed to parse Todoist response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// ApprovalDecision is the user's answer to a confirmation prompt.
+type ApprovalDecision int
+
+const (
+	ApprovalDeny ApprovalDecision = iota
+	ApprovalApprove
+	ApprovalAlwaysAllow
+)
+
+// ApprovalRequest describes a tool call waiting for user confirmation.
+type ApprovalRequest struct {
+	Tool    string
+	Args    map[string]interface{}
+	Summary string // exact action shown to the user, e.g. the shell command
+	Channel string
+	ChatID  string
+}
+
+// Prompt renders the request as a message for the user.
+func (r ApprovalRequest) Prompt() string {
+	return fmt.Sprintf("⚠️ Tool `%s` wants to run:\n\n%s\n\nReply *yes* to approve, *always* to always allow, or *no* to deny.",
+		r.Tool, r.Summary)
+}
+
+// Approver asks the user to confirm a tool call and blocks until they answer
+// or ctx is done.
+type Approver func(ctx context.Context, req ApprovalRequest) (ApprovalDecision, error)
+
+// ConfirmableTool is an optional interface for tools that can describe a
+// call in a form the user can check before approving it (exec returns the
+// command line). Always-allow rules for such tools are recorded per action
+// rather than for the whole tool.
+type ConfirmableTool interface {
+	Tool
+	ConfirmationSummary(args map[string]interface{}) string
+}
+
+// ParseApprovalReply maps a free-form user reply to a decision.
+// Anything that is not a clear approval is treated as a denial.
+func ParseApprovalReply(reply string) ApprovalDecision {
+	switch strings.ToLower(strings.TrimSpace(reply)) {
+	case "y", "yes", "approve", "ok", "allow":
+		return ApprovalApprove
+	case "a", "always", "always allow", "always-allow":
+		return ApprovalAlwaysAllow
+	default:
+		return ApprovalDeny
+	}
+}
+
+// ApprovalGate holds the approval policy: which tools require confirmation,
+// which actions the user has already allowed permanently, and how to ask.
+type ApprovalGate struct {
+	mu       sync.RWMutex
+	asking   map[string]*chatPrompt // by channel:chat_id; replies don't say which call they answer
+	required map[string]bool
+	allowed  map[string]bool
+	approver Approver
+	persist  func(rule string) error
+	observer func(req ApprovalRequest, decision ApprovalDecision)
+}
+
+// NewApprovalGate creates a gate for the given tools. alwaysAllow holds rules
+// previously persisted by the user, either "tool" or "tool:action".
+func NewApprovalGate(requireConfirmation, alwaysAllow []string) *ApprovalGate {
+	g := &ApprovalGate{
+		required: make(map[string]bool),
+		allowed:  make(map[string]bool),
+		asking:   make(map[string]*chatPrompt),
+	}
+	for _, name := range requireConfirmation {
+		g.required[strings.TrimSpace(name)] = true
+	}
+	for _, rule := range alwaysAllow {
+		g.allowed[rule] = true
+	}
+	return g
+}
+
+// SetApprover sets the function used to ask the user.
+func (g *ApprovalGate) SetApprover(approver Approver) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.approver = approver
+}
+
+// SetPersist sets the function used to save always-allow rules.
+func (g *ApprovalGate) SetPersist(persist func(rule string) error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.persist = persist
+}
+
+// SetObserver sets a function told about every decision the user makes,
+// e.g. to learn which commands they approve.
+func (g *ApprovalGate) SetObserver(observer func(req ApprovalRequest, decision ApprovalDecision)) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.observer = observer
+}
+
+// RequiresConfirmation reports whether calls to the tool need approval.
+func (g *ApprovalGate) RequiresConfirmation(name string) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.required[name]
+}
+
+// Check asks for approval if the tool requires it. It returns nil when the
+// call may proceed, or an error result to hand back to the model.
+func (g *ApprovalGate) Check(ctx context.Context, name string, tool Tool, args map[string]interface{}, channel, chatID string) *ToolResult {
+	if !g.RequiresConfirmation(name) {
+		return nil
+	}
+
+	summary, rule := approvalSummary(name, tool, args)
+
+	// Concurrent calls from one chat queue here, one prompt at a time, and
+	// see an "always" given to an earlier one. Other chats are not held up.
+	unlock := g.lockChat(channel + ":" + chatID)
+	defer unlock()
+
+	g.mu.RLock()
+	allowed := g.allowed[name] || g.allowed[rule]
+	approver := g.approver
+	observer := g.observer
+	g.mu.RUnlock()
+	if allowed {
+		return nil
+	}
+
+	if approver == nil {
+		return ErrorResult(fmt.Sprintf("tool %q requires user confirmation, but no one is available to approve it", name))
+	}
+
+	req := ApprovalRequest{
+		Tool:    name,
+		Args:    args,
+		Summary: summary,
+		Channel: channel,
+		ChatID:  chatID,
+	}
+	decision, err := approver(ctx, req)
+	if err != nil {
+		logger.WarnCF("tool", "Approval request failed",
+			map[string]interface{}{
+				"tool":  name,
+				"error": err.Error(),
+			})
+		return ErrorResult(fmt.Sprintf("tool %q was not approved: %v", name, err)).WithError(err)
+	}
+
+	logger.InfoCF("tool", "Approval decision",
+		map[string]interface{}{
+			"tool":     name,
+			"decision": decision.String(),
+		})
+	if observer != nil {
+		observer(req, decision)
+	}
+
+	switch decision {
+	case ApprovalApprove:
+		return nil
+	case ApprovalAlwaysAllow:
+		g.allow(rule)
+		return nil
+	default:
+		return ErrorResult(fmt.Sprintf("user denied execution of tool %q", name))
+	}
+}
+
+// chatPrompt serializes the prompts of one chat.
+type chatPrompt struct {
+	mu    sync.Mutex
+	users int // calls holding or waiting for mu
+}
+
+// lockChat waits until no other prompt is open in the chat and returns the
+// function that releases it.
+func (g *ApprovalGate) lockChat(key string) func() {
+	g.mu.Lock()
+	p := g.asking[key]
+	if p == nil {
+		p = &chatPrompt{}
+		g.asking[key] = p
+	}
+	p.users++
+	g.mu.Unlock()
+
+	p.mu.Lock()
+	return func() {
+		p.mu.Unlock()
+		g.mu.Lock()
+		if p.users--; p.users == 0 {
+			delete(g.asking, key)
+		}
+		g.mu.Unlock()
+	}
+}
+
+// allow records an always-allow rule and persists it.
+func (g *ApprovalGate) allow(rule string) {
+	g.mu.Lock()
+	g.allowed[rule] = true
+	persist := g.persist
+	g.mu.Unlock()
+
+	if persist == nil {
+		return
+	}
+	if err := persist(rule); err != nil {
+		logger.WarnCF("tool", "Failed to persist approval rule",
+			map[string]interface{}{
+				"rule":  rule,
+				"error": err.Error(),
+			})
+	}
+}
+
+// approvalSummary returns the text shown to the user and the always-allow
+// rule that an "always" answer would record.
+func approvalSummary(name string, tool Tool, args map[string]interface{}) (string, string) {
+	if ct, ok := tool.(ConfirmableTool); ok {
+		if summary := ct.ConfirmationSummary(args); summary != "" {
+			return summary, name + ":" + summary
+		}
+	}
+	argsJSON, _ := json.MarshalIndent(args, "", "  ")
+	return string(argsJSON), name
+}
+
+func (d ApprovalDecision) String() string {
+	switch d {
+	case ApprovalApprove:
+		return "approve"
+	case ApprovalAlwaysAllow:
+		return "always_allow"
+	default:
+		return "deny"
+	}
+}
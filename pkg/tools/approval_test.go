@@ -0,0 +1,167 @@
+package tools
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestApprovalGate_DenyAndApprove verifies the gate blocks a denied call
+// and lets an approved one through.
+func TestApprovalGate_DenyAndApprove(t *testing.T) {
+	r := NewToolRegistry()
+	r.Register(&stubTool{name: "exec"})
+	r.Register(&stubTool{name: "read_file"})
+
+	decision := ApprovalDeny
+	asked := 0
+	gate := NewApprovalGate([]string{"exec"}, nil)
+	gate.SetApprover(func(ctx context.Context, req ApprovalRequest) (ApprovalDecision, error) {
+		asked++
+		return decision, nil
+	})
+	r.SetApprovalGate(gate)
+
+	if result := r.Execute(context.Background(), "exec", map[string]interface{}{}); !result.IsError {
+		t.Errorf("Expected denied call to return an error, got %q", result.ForLLM)
+	}
+
+	decision = ApprovalApprove
+	if result := r.Execute(context.Background(), "exec", map[string]interface{}{}); result.IsError {
+		t.Errorf("Expected approved call to run, got error %q", result.ForLLM)
+	}
+
+	if result := r.Execute(context.Background(), "read_file", map[string]interface{}{}); result.IsError {
+		t.Errorf("Expected tool without confirmation to run, got %q", result.ForLLM)
+	}
+	if asked != 2 {
+		t.Errorf("Expected approver to be asked 2 times, got %d", asked)
+	}
+}
+
+// TestApprovalGate_AlwaysAllow verifies "always" answers are remembered per
+// command and persisted.
+func TestApprovalGate_AlwaysAllow(t *testing.T) {
+	r := NewToolRegistry()
+	r.Register(NewExecTool(t.TempDir(), false))
+
+	asked := 0
+	var persisted []string
+	gate := NewApprovalGate([]string{"exec"}, nil)
+	gate.SetApprover(func(ctx context.Context, req ApprovalRequest) (ApprovalDecision, error) {
+		asked++
+		if asked == 1 && req.Summary != "echo hi" {
+			t.Errorf("Expected summary to be the command, got %q", req.Summary)
+		}
+		return ApprovalAlwaysAllow, nil
+	})
+	gate.SetPersist(func(rule string) error {
+		persisted = append(persisted, rule)
+		return nil
+	})
+	r.SetApprovalGate(gate)
+
+	args := map[string]interface{}{"command": "echo hi"}
+	r.Execute(context.Background(), "exec", args)
+	r.Execute(context.Background(), "exec", args)
+
+	if asked != 1 {
+		t.Errorf("Expected approver to be asked once, got %d", asked)
+	}
+	if len(persisted) != 1 || persisted[0] != "exec:echo hi" {
+		t.Errorf("Expected persisted rule exec:echo hi, got %v", persisted)
+	}
+
+	// A different command still needs approval
+	r.Execute(context.Background(), "exec", map[string]interface{}{"command": "echo bye"})
+	if asked != 2 {
+		t.Errorf("Expected new command to require approval, got %d prompts", asked)
+	}
+}
+
+// TestApprovalGate_NoApprover verifies calls are denied when nobody can answer.
+func TestApprovalGate_NoApprover(t *testing.T) {
+	r := NewToolRegistry()
+	r.Register(&stubTool{name: "exec"})
+	r.SetApprovalGate(NewApprovalGate([]string{"exec"}, nil))
+
+	if result := r.Execute(context.Background(), "exec", map[string]interface{}{}); !result.IsError {
+		t.Error("Expected call to be denied without an approver")
+	}
+}
+
+// TestApprovalGate_ConcurrentChats verifies a prompt waiting in one chat
+// does not hold up prompts in another, while prompts in one chat still go
+// one at a time.
+func TestApprovalGate_ConcurrentChats(t *testing.T) {
+	gate := NewApprovalGate([]string{"exec"}, nil)
+	asked := make(chan string, 3)
+	release := make(chan struct{})
+	gate.SetApprover(func(ctx context.Context, req ApprovalRequest) (ApprovalDecision, error) {
+		asked <- req.ChatID
+		if req.ChatID == "a" {
+			<-release
+		}
+		return ApprovalApprove, nil
+	})
+
+	var wg sync.WaitGroup
+	check := func(chatID string) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if result := gate.Check(context.Background(), "exec", &stubTool{name: "exec"}, nil, "telegram", chatID); result != nil {
+				t.Errorf("Expected chat %s to be approved, got %q", chatID, result.ForLLM)
+			}
+		}()
+	}
+	next := func() string {
+		select {
+		case chatID := <-asked:
+			return chatID
+		case <-time.After(2 * time.Second):
+			return ""
+		}
+	}
+
+	check("a")
+	if got := next(); got != "a" {
+		t.Fatalf("Expected chat a to be asked, got %q", got)
+	}
+	check("a")
+	check("b")
+	// Chat b is asked while chat a's first prompt is still open, and a's
+	// second waits for it
+	if got := next(); got != "b" {
+		t.Errorf("Expected chat b to be asked while chat a waits, got %q", got)
+	}
+	select {
+	case chatID := <-asked:
+		t.Errorf("Expected chat a's second prompt to wait, got one for %q", chatID)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	if got := next(); got != "a" {
+		t.Errorf("Expected chat a's second prompt after the first, got %q", got)
+	}
+	wg.Wait()
+	if len(gate.asking) != 0 {
+		t.Errorf("Expected no chat locks left, got %d", len(gate.asking))
+	}
+}
+
+func TestParseApprovalReply(t *testing.T) {
+	tests := map[string]ApprovalDecision{
+		"yes":      ApprovalApprove,
+		" Y\n":     ApprovalApprove,
+		"always":   ApprovalAlwaysAllow,
+		"no":       ApprovalDeny,
+		"rm -rf /": ApprovalDeny,
+	}
+	for reply, want := range tests {
+		if got := ParseApprovalReply(reply); got != want {
+			t.Errorf("ParseApprovalReply(%q) = %v, want %v", reply, got, want)
+		}
+	}
+}
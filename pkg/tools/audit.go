@@ -0,0 +1,108 @@
+package tools
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// Audit event kinds.
+const (
+	AuditGuardBlock          = "guard_block"           // the safety guard refused a command
+	AuditGuardOverride       = "guard_override"        // the user approved running a blocked command
+	AuditGuardOverrideDenied = "guard_override_denied" // the user (or a timeout) refused the override
+	AuditGuardConfirmed      = "guard_confirmed"       // the user confirmed a command matching a confirm rule
+	AuditGuardConfirmDenied  = "guard_confirm_denied"  // the user (or a timeout) refused it
+	AuditCommandApproved     = "command_approved"      // the user approved a command (allowlist learning)
+)
+
+// AuditEvent is one line of the audit log.
+type AuditEvent struct {
+	Time    time.Time `json:"time"`
+	Event   string    `json:"event"`
+	Tool    string    `json:"tool"`
+	Command string    `json:"command,omitempty"`
+	Rule    string    `json:"rule,omitempty"`
+	Reason  string    `json:"reason,omitempty"`
+	Channel string    `json:"channel,omitempty"`
+	ChatID  string    `json:"chat_id,omitempty"`
+	Detail  string    `json:"detail,omitempty"` // e.g. the model's reason for an override
+}
+
+// AuditLog appends security-relevant events to a JSON Lines file.
+type AuditLog struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewAuditLog(path string) *AuditLog {
+	return &AuditLog{path: path}
+}
+
+// Record appends event, stamping its time. Failures are logged, not
+// returned: a full disk should not stop the guard from doing its job.
+func (a *AuditLog) Record(event AuditEvent) {
+	if a == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	data, err := json.Marshal(event)
+	if err == nil {
+		err = a.append(append(data, '\n'))
+	}
+	if err != nil {
+		logger.WarnCF("tool", "Failed to write audit log",
+			map[string]interface{}{
+				"event": event.Event,
+				"error": err.Error(),
+			})
+	}
+}
+
+func (a *AuditLog) append(line []byte) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(a.path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(a.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(line)
+	return err
+}
+
+// Events reads the log back, oldest first. A missing log has no events;
+// lines that do not parse are skipped.
+func (a *AuditLog) Events() ([]AuditEvent, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	f, err := os.Open(a.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []AuditEvent
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var event AuditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err == nil {
+			events = append(events, event)
+		}
+	}
+	return events, scanner.Err()
+}
@@ -70,10 +70,16 @@ type AsyncTool interface {
 }
 
 func ToolToSchema(tool Tool) map[string]interface{} {
+	return toolSchema(tool.Name(), tool)
+}
+
+// toolSchema builds the function schema for a tool exposed under name,
+// which differs from tool.Name() for namespaced registrations.
+func toolSchema(name string, tool Tool) map[string]interface{} {
 	return map[string]interface{}{
 		"type": "function",
 		"function": map[string]interface{}{
-			"name":        tool.Name(),
+			"name":        name,
 			"description": tool.Description(),
 			"parameters":  tool.Parameters(),
 		},
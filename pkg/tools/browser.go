@@ -0,0 +1,479 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/browser"
+)
+
+const (
+	// maxBrowserTabs caps the tabs open at once, one per conversation; the
+	// one used least recently is closed to make room.
+	maxBrowserTabs     = 8
+	defaultBrowserText = 8000
+	browserPreviewText = 1500
+	maxBrowserLinks    = 100
+)
+
+// BrowserTool drives a headless Chromium for pages web_fetch can't read:
+// ones built by JavaScript, or behind a login. Each conversation gets its
+// own tab; the browser starts on first use and stops when idle. Cookies
+// are kept in a profile folder, so logins survive restarts.
+type BrowserTool struct {
+	workspace string
+	opts      browser.Options
+	timeout   time.Duration
+	idle      time.Duration
+	maxChars  int
+
+	mu      sync.Mutex
+	browser *browser.Browser
+	tabs    map[string]*browserTab
+	idler   *time.Timer
+}
+
+type browserTab struct {
+	page     *browser.Page
+	mu       sync.Mutex // one action at a time
+	lastUsed time.Time
+}
+
+// NewBrowserTool creates the tool. opts.ProfileDir defaults to
+// state/browser in the workspace.
+func NewBrowserTool(workspace string, opts browser.Options) *BrowserTool {
+	if opts.ProfileDir == "" {
+		opts.ProfileDir = filepath.Join(workspace, "state", "browser")
+	}
+	return &BrowserTool{
+		workspace: workspace,
+		opts:      opts,
+		timeout:   30 * time.Second,
+		idle:      10 * time.Minute,
+		maxChars:  defaultBrowserText,
+		tabs:      make(map[string]*browserTab),
+	}
+}
+
+// SetLimits sets the time an action may take and how long an unused
+// browser is kept; zero keeps the default.
+func (t *BrowserTool) SetLimits(timeout, idle time.Duration) {
+	if timeout > 0 {
+		t.timeout = timeout
+	}
+	if idle > 0 {
+		t.idle = idle
+	}
+}
+
+func (t *BrowserTool) Name() string {
+	return "browser"
+}
+
+func (t *BrowserTool) Description() string {
+	desc := "Use a real (headless) web browser for pages that need JavaScript or a login, which web_fetch can't handle. " +
+		"Actions: navigate to a url; click an element; type text into a field (submit presses Enter); " +
+		"extract the page's text, links or form fields; screenshot; back; close. " +
+		`Selectors are CSS (e.g. "#email", "button[type=submit]") or "text=Sign in" for the button or link with that text; ` +
+		"extract with what=fields lists the inputs and buttons with selectors to use. The tab stays open between calls."
+	if len(t.opts.AllowedDomains) > 0 {
+		desc += " Only these sites can be opened: " + strings.Join(t.opts.AllowedDomains, ", ") + "."
+	}
+	return desc
+}
+
+func (t *BrowserTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type": "string",
+				"enum": []string{"navigate", "click", "type", "extract", "screenshot", "back", "close"},
+			},
+			"url": map[string]interface{}{
+				"type":        "string",
+				"description": "Page to open (for navigate)",
+			},
+			"selector": map[string]interface{}{
+				"type":        "string",
+				"description": `Element to click or type into, as CSS or "text=..."; for extract, only the text of matching elements`,
+			},
+			"text": map[string]interface{}{
+				"type":        "string",
+				"description": "Text to type (for type)",
+			},
+			"submit": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Press Enter after typing (for type)",
+			},
+			"clear": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Replace what the field holds instead of adding to it (for type; default true)",
+			},
+			"what": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"text", "links", "fields"},
+				"description": "For extract: the visible text (default), the links, or the form fields and buttons",
+			},
+			"full_page": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Capture the whole page, not just the visible part (for screenshot)",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+// ConfirmationSummary describes the action, for users who approve each one.
+func (t *BrowserTool) ConfirmationSummary(args map[string]interface{}) string {
+	action, _ := args["action"].(string)
+	selector, _ := args["selector"].(string)
+	switch action {
+	case "navigate":
+		u, _ := args["url"].(string)
+		return "open " + u
+	case "click":
+		return "click " + selector
+	case "type":
+		text, _ := args["text"].(string)
+		summary := fmt.Sprintf("type %q into %s", text, selector)
+		if submit, _ := args["submit"].(bool); submit {
+			summary += " and press Enter"
+		}
+		return summary
+	}
+	return action
+}
+
+func (t *BrowserTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	action, _ := args["action"].(string)
+	key := SessionKeyFromContext(ctx)
+	if key == "" {
+		key = "default"
+	}
+	if action == "close" {
+		if t.closeTab(key) {
+			return NewToolResult("Closed the browser tab")
+		}
+		return NewToolResult("No browser tab was open")
+	}
+	switch action {
+	case "navigate", "click", "type", "extract", "screenshot", "back":
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action %q: use navigate, click, type, extract, screenshot, back or close", action))
+	}
+
+	tab, err := t.tab(ctx, key)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to start the browser: %v", err)).WithError(err)
+	}
+	tab.mu.Lock()
+	defer tab.mu.Unlock()
+	defer func() { tab.lastUsed = time.Now() }()
+
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	result := t.run(ctx, tab.page, action, args)
+	if blocked := tab.page.TakeBlocked(); len(blocked) > 0 && !result.IsError {
+		result.ForLLM += "\n(Blocked: " + strings.Join(uniqueStrings(blocked), "; ") + ")"
+	}
+	return result
+}
+
+func (t *BrowserTool) run(ctx context.Context, page *browser.Page, action string, args map[string]interface{}) *ToolResult {
+	selector, _ := args["selector"].(string)
+	switch action {
+	case "navigate":
+		u, _ := args["url"].(string)
+		if u == "" {
+			return ErrorResult("url is required")
+		}
+		if !strings.Contains(u, "://") && !strings.HasPrefix(u, "about:") {
+			u = "https://" + u
+		}
+		if err := page.Navigate(ctx, u); err != nil {
+			return ErrorResult(err.Error()).WithError(err)
+		}
+		return t.pageSummary(ctx, page, "", true)
+
+	case "click":
+		if selector == "" {
+			return ErrorResult("selector is required")
+		}
+		clicked, err := page.Click(ctx, selector)
+		if err != nil {
+			return t.actionError(ctx, page, err)
+		}
+		return t.pageSummary(ctx, page, "Clicked "+clicked, false)
+
+	case "type":
+		if selector == "" {
+			return ErrorResult("selector is required")
+		}
+		text, _ := args["text"].(string)
+		clear := true
+		if v, ok := args["clear"].(bool); ok {
+			clear = v
+		}
+		submit, _ := args["submit"].(bool)
+		field, err := page.Type(ctx, selector, text, clear, submit)
+		if err != nil {
+			return t.actionError(ctx, page, err)
+		}
+		done := fmt.Sprintf("Typed %d characters into %s", len([]rune(text)), field)
+		if submit {
+			done += " and pressed Enter"
+		}
+		return t.pageSummary(ctx, page, done, submit)
+
+	case "back":
+		if err := page.Back(ctx); err != nil {
+			return ErrorResult(err.Error())
+		}
+		return t.pageSummary(ctx, page, "", true)
+
+	case "extract":
+		return t.extract(ctx, page, args)
+
+	case "screenshot":
+		fullPage, _ := args["full_page"].(bool)
+		png, err := page.Screenshot(ctx, fullPage)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("screenshot failed: %v", err)).WithError(err)
+		}
+		rel := filepath.Join("browser", fmt.Sprintf("screenshot-%s.png", time.Now().Format("20060102-150405.000")))
+		path := filepath.Join(t.workspace, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return ErrorResult(err.Error())
+		}
+		if err := os.WriteFile(path, png, 0644); err != nil {
+			return ErrorResult(err.Error())
+		}
+		pageURL, title, _ := page.Info(ctx)
+		return NewToolResult(fmt.Sprintf("Saved a screenshot of %s to %s", pageLabel(pageURL, title), rel)).
+			WithAttachments(Attachment{Path: path})
+	}
+	return ErrorResult(fmt.Sprintf("unknown action %q", action))
+}
+
+func (t *BrowserTool) extract(ctx context.Context, page *browser.Page, args map[string]interface{}) *ToolResult {
+	selector, _ := args["selector"].(string)
+	what, _ := args["what"].(string)
+	pageURL, title, _ := page.Info(ctx)
+	header := "Page: " + pageLabel(pageURL, title) + "\n\n"
+
+	switch what {
+	case "links":
+		links, err := page.Links(ctx, maxBrowserLinks)
+		if err != nil {
+			return ErrorResult(err.Error())
+		}
+		if len(links) == 0 {
+			return NewToolResult(header + "No links")
+		}
+		var sb strings.Builder
+		for _, l := range links {
+			text := l.Text
+			if text == "" {
+				text = "(no text)"
+			}
+			fmt.Fprintf(&sb, "- %s: %s\n", text, l.URL)
+		}
+		return NewToolResult(header + strings.TrimRight(sb.String(), "\n")).WithData(links)
+
+	case "fields":
+		fields, err := page.Fields(ctx, maxBrowserLinks)
+		if err != nil {
+			return ErrorResult(err.Error())
+		}
+		if len(fields) == 0 {
+			return NewToolResult(header + "No form fields or buttons")
+		}
+		var sb strings.Builder
+		for _, f := range fields {
+			fmt.Fprintf(&sb, "- %s (%s)", f.Selector, f.Type)
+			if f.Label != "" {
+				fmt.Fprintf(&sb, " %q", f.Label)
+			}
+			if f.Value != "" {
+				fmt.Fprintf(&sb, " = %q", f.Value)
+			}
+			sb.WriteString("\n")
+		}
+		return NewToolResult(header + strings.TrimRight(sb.String(), "\n")).WithData(fields)
+
+	case "", "text":
+		text, err := page.Text(ctx, selector)
+		if err != nil {
+			return t.actionError(ctx, page, err)
+		}
+		return NewToolResult(header + truncateText(cleanPageText(text), t.maxChars))
+	}
+	return ErrorResult(fmt.Sprintf("unknown what %q: use text, links or fields", what))
+}
+
+// pageSummary reports where the tab is after an action, with the start
+// of the page's text when a new page loaded.
+func (t *BrowserTool) pageSummary(ctx context.Context, page *browser.Page, done string, preview bool) *ToolResult {
+	pageURL, title, err := page.Info(ctx)
+	var sb strings.Builder
+	if done != "" {
+		sb.WriteString(done + ". ")
+	}
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			sb.WriteString("The page is still loading; try extract in a moment.")
+			return NewToolResult(sb.String())
+		}
+		return ErrorResult(sb.String() + err.Error())
+	}
+	sb.WriteString("Page: " + pageLabel(pageURL, title))
+	if preview {
+		if text, err := page.Text(ctx, ""); err == nil {
+			if text = cleanPageText(text); text != "" {
+				sb.WriteString("\n\n" + truncateText(text, browserPreviewText))
+			}
+		}
+	}
+	return NewToolResult(sb.String())
+}
+
+// actionError explains a failed action; when the element was not found it
+// lists the fields and buttons the page has.
+func (t *BrowserTool) actionError(ctx context.Context, page *browser.Page, err error) *ToolResult {
+	msg := err.Error()
+	if errors.Is(err, browser.ErrNotFound) {
+		if fields, ferr := page.Fields(ctx, 30); ferr == nil && len(fields) > 0 {
+			selectors := make([]string, len(fields))
+			for i, f := range fields {
+				selectors[i] = f.Selector
+			}
+			msg += ". Fields and buttons on the page: " + strings.Join(selectors, ", ")
+		}
+	}
+	return ErrorResult(msg).WithError(err)
+}
+
+// tab returns the conversation's tab, starting the browser if needed.
+func (t *BrowserTool) tab(ctx context.Context, key string) (*browserTab, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.idler != nil {
+		t.idler.Stop()
+	}
+	t.idler = time.AfterFunc(t.idle, t.Close)
+
+	if t.browser != nil && !t.browser.Alive() {
+		// It crashed or was killed; start over
+		t.browser.Close()
+		t.browser = nil
+		clear(t.tabs)
+	}
+	if tab, ok := t.tabs[key]; ok {
+		return tab, nil
+	}
+	if t.browser == nil {
+		b, err := browser.Launch(ctx, t.opts)
+		if err != nil {
+			return nil, err
+		}
+		t.browser = b
+	}
+	if len(t.tabs) >= maxBrowserTabs {
+		var oldest string
+		for k, tab := range t.tabs {
+			if oldest == "" || tab.lastUsed.Before(t.tabs[oldest].lastUsed) {
+				oldest = k
+			}
+		}
+		t.tabs[oldest].page.Close()
+		delete(t.tabs, oldest)
+	}
+	page, err := t.browser.NewPage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tab := &browserTab{page: page, lastUsed: time.Now()}
+	t.tabs[key] = tab
+	return tab, nil
+}
+
+func (t *BrowserTool) closeTab(key string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tab, ok := t.tabs[key]
+	if !ok {
+		return false
+	}
+	delete(t.tabs, key)
+	tab.page.Close()
+	return true
+}
+
+// Close stops the browser.
+func (t *BrowserTool) Close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.idler != nil {
+		t.idler.Stop()
+	}
+	if t.browser != nil {
+		t.browser.Close()
+		t.browser = nil
+	}
+	clear(t.tabs)
+}
+
+func pageLabel(pageURL, title string) string {
+	if title == "" {
+		return pageURL
+	}
+	return fmt.Sprintf("%s (%s)", title, pageURL)
+}
+
+// cleanPageText trims lines and collapses runs of blank lines.
+func cleanPageText(text string) string {
+	lines := strings.Split(text, "\n")
+	out := lines[:0]
+	blank := false
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			if !blank && len(out) > 0 {
+				out = append(out, "")
+			}
+			blank = true
+			continue
+		}
+		out = append(out, line)
+		blank = false
+	}
+	return strings.TrimSpace(strings.Join(out, "\n"))
+}
+
+// truncateText cuts text to max characters, saying how much was left out.
+func truncateText(text string, max int) string {
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+	return string(runes[:max]) + fmt.Sprintf("\n... (%d more characters; extract with a selector for a part of the page)", len(runes)-max)
+}
+
+func uniqueStrings(list []string) []string {
+	seen := make(map[string]bool, len(list))
+	out := list[:0]
+	for _, s := range list {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
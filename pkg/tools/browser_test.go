@@ -0,0 +1,48 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/browser"
+)
+
+// TestBrowserToolWithoutBrowser verifies calls that need no browser, and
+// that a missing binary is reported
+func TestBrowserToolWithoutBrowser(t *testing.T) {
+	tool := NewBrowserTool(t.TempDir(), browser.Options{Binary: "/nonexistent/chromium", AllowedDomains: []string{"example.com"}})
+	defer tool.Close()
+	ctx := context.Background()
+
+	if result := tool.Execute(ctx, map[string]interface{}{"action": "close"}); result.IsError || result.ForLLM != "No browser tab was open" {
+		t.Errorf("Expected nothing to close, got %q", result.ForLLM)
+	}
+	if result := tool.Execute(ctx, map[string]interface{}{"action": "scroll"}); !result.IsError {
+		t.Errorf("Expected an unknown action to fail, got %q", result.ForLLM)
+	}
+	result := tool.Execute(ctx, map[string]interface{}{"action": "navigate", "url": "example.com"})
+	if !result.IsError || !strings.Contains(result.ForLLM, "failed to start the browser") {
+		t.Errorf("Expected the missing browser reported, got %q", result.ForLLM)
+	}
+	if !strings.Contains(tool.Description(), "Only these sites can be opened: example.com") {
+		t.Errorf("Expected the allowed domains in the description, got %q", tool.Description())
+	}
+
+	summary := tool.ConfirmationSummary(map[string]interface{}{"action": "type", "selector": "#q", "text": "hello", "submit": true})
+	if summary != `type "hello" into #q and press Enter` {
+		t.Errorf("Unexpected confirmation summary %q", summary)
+	}
+}
+
+// TestCleanPageText verifies lines are trimmed, blank runs collapsed and
+// long text cut with a note
+func TestCleanPageText(t *testing.T) {
+	got := cleanPageText("\n\n  Title  \n\n\n\n  body line\t\n  \nend\n")
+	if want := "Title\n\nbody line\n\nend"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	if got := truncateText("héllo world", 5); !strings.HasPrefix(got, "héllo\n... (6 more characters") {
+		t.Errorf("Expected the text cut at 5 characters, got %q", got)
+	}
+}
@@ -0,0 +1,373 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/sipeed/picoclaw/pkg/calendar"
+)
+
+// CalendarTool lists and creates events in the configured calendars (CalDAV
+// servers and local .ics files). Times are shown in one time zone, named in
+// the output, so the model never has to convert.
+type CalendarTool struct {
+	calendars []calendar.Source
+	loc       *time.Location
+}
+
+// NewCalendarTool returns a calendar tool over calendars, showing and
+// reading times in loc (time.Local if nil).
+func NewCalendarTool(calendars []calendar.Source, loc *time.Location) *CalendarTool {
+	if loc == nil {
+		loc = time.Local
+	}
+	return &CalendarTool{calendars: calendars, loc: loc}
+}
+
+func (t *CalendarTool) Name() string {
+	return "calendar"
+}
+
+func (t *CalendarTool) Description() string {
+	names := make([]string, 0, len(t.calendars))
+	for _, c := range t.calendars {
+		name := c.Name()
+		if c.ReadOnly() {
+			name += " (read-only)"
+		}
+		names = append(names, name)
+	}
+	return fmt.Sprintf("List events on the user's calendars or add an event. Calendars: %s. Times are in %s.",
+		strings.Join(names, ", "), t.loc)
+}
+
+func (t *CalendarTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"list", "create"},
+				"description": "list events (default) or create one",
+			},
+			"when": map[string]interface{}{
+				"type":        "string",
+				"description": "For list: today, tomorrow, 3-day, 7-day (default), a weekday such as 'thursday', or YYYY-MM-DD",
+			},
+			"summary": map[string]interface{}{
+				"type":        "string",
+				"description": "For create: event title",
+			},
+			"start": map[string]interface{}{
+				"type":        "string",
+				"description": "For create: 'YYYY-MM-DD HH:MM' in the calendar time zone, or YYYY-MM-DD for an all-day event",
+			},
+			"end": map[string]interface{}{
+				"type":        "string",
+				"description": "For create: end in the same form as start (default: one hour after start, or the same day)",
+			},
+			"duration_minutes": map[string]interface{}{
+				"type":        "integer",
+				"description": "For create: length instead of end",
+			},
+			"location": map[string]interface{}{
+				"type":        "string",
+				"description": "For create: where the event takes place",
+			},
+			"description": map[string]interface{}{
+				"type":        "string",
+				"description": "For create: notes",
+			},
+			"calendar": map[string]interface{}{
+				"type":        "string",
+				"description": "Calendar name; list defaults to all, create to the first writable one",
+			},
+		},
+		"required": []string{},
+	}
+}
+
+// HasSideEffects marks the tool as externally visible: a retried create
+// within a turn must not add the event twice.
+func (t *CalendarTool) HasSideEffects() bool {
+	return true
+}
+
+// ConfirmationSummary describes a create, e.g. "add "Dentist" on Thu Oct 22
+// 14:00-14:30 to home"; listing needs no confirmation.
+func (t *CalendarTool) ConfirmationSummary(args map[string]interface{}) string {
+	if action, _ := args["action"].(string); action != "create" {
+		return ""
+	}
+	e, cal, err := t.newEvent(args)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("add %q on %s to %s", e.Summary, t.formatSpan(e), cal.Name())
+}
+
+// DryRun lists events as usual and only describes a create.
+func (t *CalendarTool) DryRun(ctx context.Context, args map[string]interface{}) *ToolResult {
+	if action, _ := args["action"].(string); action != "create" {
+		return t.Execute(ctx, args)
+	}
+	e, cal, err := t.newEvent(args)
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+	return UserResult(fmt.Sprintf("Dry run, event not created. It would add %q on %s to %s.",
+		e.Summary, t.formatSpan(e), cal.Name()))
+}
+
+func (t *CalendarTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	action, _ := args["action"].(string)
+	switch action {
+	case "", "list":
+		return t.list(ctx, args)
+	case "create":
+		return t.create(ctx, args)
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action %q: use list or create", action))
+	}
+}
+
+func (t *CalendarTool) list(ctx context.Context, args map[string]interface{}) *ToolResult {
+	when, _ := args["when"].(string)
+	when = strings.ToLower(strings.TrimSpace(when))
+	if when == "" {
+		when = "7-day"
+	}
+	now := time.Now().In(t.loc)
+	day, days, err := parseWhen(when, time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, t.loc))
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+	from := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, t.loc)
+	to := from.AddDate(0, 0, days)
+
+	name, _ := args["calendar"].(string)
+	var events []calendar.Event
+	var failed []string
+	var lastErr error
+	queried := 0
+	for _, cal := range t.calendars {
+		if name != "" && !strings.EqualFold(cal.Name(), name) {
+			continue
+		}
+		queried++
+		found, err := cal.Events(ctx, from, to)
+		if err != nil {
+			failed = append(failed, cal.Name())
+			lastErr = err
+			continue
+		}
+		events = append(events, found...)
+	}
+	if queried == 0 {
+		return ErrorResult(fmt.Sprintf("no calendar named %q", name))
+	}
+	if len(failed) == queried {
+		return ErrorResult(fmt.Sprintf("calendar unavailable: %v", lastErr)).
+			WithError(Unavailable("calendar", lastErr))
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Start.Before(events[j].Start) })
+
+	text := formatEvents(events, from, to, t.loc, len(t.calendars) > 1)
+	if len(failed) > 0 {
+		text += fmt.Sprintf("\n(Could not read %s: %v)", strings.Join(failed, ", "), lastErr)
+	}
+	return NewToolResult(text)
+}
+
+func (t *CalendarTool) create(ctx context.Context, args map[string]interface{}) *ToolResult {
+	e, cal, err := t.newEvent(args)
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+	if err := cal.Create(ctx, e); err != nil {
+		if errors.Is(err, calendar.ErrReadOnly) {
+			return ErrorResult(fmt.Sprintf("calendar %s is read-only", cal.Name()))
+		}
+		return ErrorResult(fmt.Sprintf("failed to create event: %v", err)).
+			WithError(Unavailable("calendar", err))
+	}
+	return NewToolResult(fmt.Sprintf("Added %q on %s to %s.", e.Summary, t.formatSpan(e), cal.Name()))
+}
+
+// newEvent builds the event a create call describes and picks its calendar.
+func (t *CalendarTool) newEvent(args map[string]interface{}) (calendar.Event, calendar.Source, error) {
+	summary, _ := args["summary"].(string)
+	if strings.TrimSpace(summary) == "" {
+		return calendar.Event{}, nil, errors.New("summary is required")
+	}
+	startArg, _ := args["start"].(string)
+	start, allDay, err := parseEventTime(startArg, t.loc)
+	if err != nil {
+		return calendar.Event{}, nil, fmt.Errorf("start: %w", err)
+	}
+
+	var end time.Time
+	endArg, _ := args["end"].(string)
+	minutes, hasMinutes := args["duration_minutes"].(float64)
+	switch {
+	case endArg != "":
+		var endAllDay bool
+		if end, endAllDay, err = parseEventTime(endArg, t.loc); err != nil {
+			return calendar.Event{}, nil, fmt.Errorf("end: %w", err)
+		}
+		if allDay && endAllDay {
+			end = end.AddDate(0, 0, 1) // the end date given is the last day
+		}
+	case hasMinutes && minutes > 0:
+		end = start.Add(time.Duration(minutes) * time.Minute)
+	case allDay:
+		end = start.AddDate(0, 0, 1)
+	default:
+		end = start.Add(time.Hour)
+	}
+	if !end.After(start) {
+		return calendar.Event{}, nil, errors.New("end must be after start")
+	}
+
+	cal, err := t.writable(args)
+	if err != nil {
+		return calendar.Event{}, nil, err
+	}
+	location, _ := args["location"].(string)
+	description, _ := args["description"].(string)
+	return calendar.Event{
+		UID:         uuid.NewString() + "@picoclaw",
+		Summary:     strings.TrimSpace(summary),
+		Description: description,
+		Location:    location,
+		Start:       start,
+		End:         end,
+		AllDay:      allDay,
+		Calendar:    cal.Name(),
+	}, cal, nil
+}
+
+// writable returns the calendar named in args, or the first writable one.
+func (t *CalendarTool) writable(args map[string]interface{}) (calendar.Source, error) {
+	name, _ := args["calendar"].(string)
+	for _, cal := range t.calendars {
+		if name != "" {
+			if strings.EqualFold(cal.Name(), name) {
+				if cal.ReadOnly() {
+					return nil, fmt.Errorf("calendar %s is read-only", cal.Name())
+				}
+				return cal, nil
+			}
+			continue
+		}
+		if !cal.ReadOnly() {
+			return cal, nil
+		}
+	}
+	if name != "" {
+		return nil, fmt.Errorf("no calendar named %q", name)
+	}
+	return nil, errors.New("no writable calendar is configured")
+}
+
+// parseEventTime reads a time in loc; a bare date means an all-day event.
+func parseEventTime(s string, loc *time.Location) (time.Time, bool, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, false, errors.New("is required")
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.In(loc), false, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02T15:04:05"} {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, false, nil
+		}
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, loc); err == nil {
+		return t, true, nil
+	}
+	return time.Time{}, false, fmt.Errorf("cannot parse %q: use 'YYYY-MM-DD HH:MM' or YYYY-MM-DD", s)
+}
+
+// formatSpan renders when an event takes place, e.g. "Thu Oct 22 14:00-14:30"
+// or "Thu Oct 22 (all day)".
+func (t *CalendarTool) formatSpan(e calendar.Event) string {
+	start, end := e.Start.In(t.loc), e.End.In(t.loc)
+	if e.AllDay {
+		last := end.AddDate(0, 0, -1)
+		if !last.After(start) {
+			return start.Format("Mon Jan 2") + " (all day)"
+		}
+		return start.Format("Mon Jan 2") + " to " + last.Format("Mon Jan 2") + " (all day)"
+	}
+	if start.YearDay() == end.YearDay() && start.Year() == end.Year() {
+		return start.Format("Mon Jan 2 15:04") + "-" + end.Format("15:04")
+	}
+	return start.Format("Mon Jan 2 15:04") + " to " + end.Format("Mon Jan 2 15:04")
+}
+
+// formatEvents renders events grouped by day, e.g.
+//
+//	Events Thu Oct 22 to Sat Oct 24 (times in Europe/Paris):
+//	Thu Oct 22
+//	  09:00-09:30  Standup (Room 4) [work]
+//	  all day      Trip to Lyon
+func formatEvents(events []calendar.Event, from, to time.Time, loc *time.Location, showCalendar bool) string {
+	var sb strings.Builder
+	last := to.AddDate(0, 0, -1)
+	span := from.Format("Mon Jan 2")
+	if !last.Equal(from) {
+		span += " to " + last.Format("Mon Jan 2")
+	}
+	if len(events) == 0 {
+		return fmt.Sprintf("No events %s.", span)
+	}
+	fmt.Fprintf(&sb, "Events %s (times in %s):", span, loc)
+
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		next := day.AddDate(0, 0, 1)
+		header := false
+		for _, e := range events {
+			if !e.Start.Before(next) || !e.End.After(day) {
+				continue
+			}
+			if !header {
+				sb.WriteString("\n" + day.Format("Mon Jan 2"))
+				header = true
+			}
+			sb.WriteString("\n  " + eventLine(e, day, next, loc, showCalendar))
+		}
+	}
+	return sb.String()
+}
+
+// eventLine renders one event as it falls on day.
+func eventLine(e calendar.Event, day, next time.Time, loc *time.Location, showCalendar bool) string {
+	start, end := e.Start.In(loc), e.End.In(loc)
+	var when string
+	switch {
+	case e.AllDay || (!start.After(day) && !end.Before(next)):
+		when = "all day"
+	case start.Before(day):
+		when = "until " + end.Format("15:04")
+	case end.After(next):
+		when = start.Format("15:04") + "-"
+	default:
+		when = start.Format("15:04") + "-" + end.Format("15:04")
+	}
+	line := fmt.Sprintf("%-12s %s", when, e.Summary)
+	if e.Location != "" {
+		line += " (" + e.Location + ")"
+	}
+	if showCalendar && e.Calendar != "" {
+		line += " [" + e.Calendar + "]"
+	}
+	return line
+}
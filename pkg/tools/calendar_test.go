@@ -0,0 +1,78 @@
+package tools
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/calendar"
+)
+
+// TestCalendarTool_CreateAndList verifies events created through the tool
+// are listed back in the configured time zone, and that read-only
+// calendars are skipped when picking where to create.
+func TestCalendarTool_CreateAndList(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip("no time zone database")
+	}
+	dir := t.TempDir()
+	tool := NewCalendarTool([]calendar.Source{
+		calendar.NewFile("holidays", filepath.Join(dir, "holidays.ics"), paris, true),
+		calendar.NewFile("home", filepath.Join(dir, "home.ics"), paris, false),
+	}, paris)
+	ctx := context.Background()
+
+	day := time.Now().In(paris).AddDate(0, 0, 2).Format("2006-01-02")
+	result := tool.Execute(ctx, map[string]interface{}{
+		"action": "create", "summary": "Dentist", "start": day + " 14:00",
+		"duration_minutes": float64(30), "location": "Rue de Rivoli",
+	})
+	if result.IsError {
+		t.Fatalf("Expected create to succeed, got %s", result.ForLLM)
+	}
+	if !strings.Contains(result.ForLLM, "14:00-14:30 to home") {
+		t.Errorf("Expected the event to go to home, got %s", result.ForLLM)
+	}
+	tool.Execute(ctx, map[string]interface{}{"action": "create", "summary": "Trip", "start": day})
+
+	result = tool.Execute(ctx, map[string]interface{}{"when": day})
+	for _, want := range []string{"(times in Europe/Paris)", "14:00-14:30  Dentist (Rue de Rivoli) [home]", "all day      Trip"} {
+		if !strings.Contains(result.ForLLM, want) {
+			t.Errorf("Expected %q in listing, got:\n%s", want, result.ForLLM)
+		}
+	}
+
+	result = tool.Execute(ctx, map[string]interface{}{"when": "today"})
+	if !strings.HasPrefix(result.ForLLM, "No events") {
+		t.Errorf("Expected no events today, got %s", result.ForLLM)
+	}
+
+	result = tool.Execute(ctx, map[string]interface{}{"action": "create", "summary": "x", "start": day, "calendar": "holidays"})
+	if !result.IsError || !strings.Contains(result.ForLLM, "read-only") {
+		t.Errorf("Expected a read-only error, got %s", result.ForLLM)
+	}
+}
+
+// TestCalendarTool_DryRun verifies a dry-run create describes the event
+// without writing it.
+func TestCalendarTool_DryRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "home.ics")
+	tool := NewCalendarTool([]calendar.Source{calendar.NewFile("home", path, time.UTC, false)}, time.UTC)
+	args := map[string]interface{}{"action": "create", "summary": "Review", "start": "2026-10-22 09:00", "end": "2026-10-22 10:30"}
+
+	result := tool.DryRun(context.Background(), args)
+	if !strings.Contains(result.ForLLM, `"Review" on Thu Oct 22 09:00-10:30 to home`) {
+		t.Errorf("Expected the event described, got %s", result.ForLLM)
+	}
+	if summary := tool.ConfirmationSummary(args); summary != `add "Review" on Thu Oct 22 09:00-10:30 to home` {
+		t.Errorf("Expected a confirmation summary, got %q", summary)
+	}
+	events, _ := calendar.NewFile("home", path, time.UTC, false).Events(context.Background(),
+		time.Date(2026, 10, 22, 0, 0, 0, 0, time.UTC), time.Date(2026, 10, 23, 0, 0, 0, 0, time.UTC))
+	if len(events) != 0 {
+		t.Errorf("Expected nothing written in a dry run, got %d events", len(events))
+	}
+}
@@ -291,6 +291,7 @@ func (t *CronTool) ExecuteJob(ctx context.Context, job *cron.CronJob) string {
 			Channel: channel,
 			ChatID:  chatID,
 			Content: output,
+			Urgency: bus.UrgencyNormal,
 		})
 		return "ok"
 	}
@@ -301,6 +302,7 @@ func (t *CronTool) ExecuteJob(ctx context.Context, job *cron.CronJob) string {
 			Channel: channel,
 			ChatID:  chatID,
 			Content: job.Payload.Message,
+			Urgency: bus.UrgencyNormal,
 		})
 		return "ok"
 	}
@@ -0,0 +1,70 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Delegator sends a task to another picoclaw instance and returns its result.
+type Delegator interface {
+	Delegate(ctx context.Context, peer, task string) (string, error)
+	Peers() []string
+}
+
+// DelegateTool hands a task to a federated peer, which runs it with its own
+// agent and local tools (e.g. checking disk space on a remote server).
+type DelegateTool struct {
+	delegator Delegator
+}
+
+func NewDelegateTool(delegator Delegator) *DelegateTool {
+	return &DelegateTool{delegator: delegator}
+}
+
+func (t *DelegateTool) Name() string {
+	return "delegate"
+}
+
+func (t *DelegateTool) Description() string {
+	return fmt.Sprintf("Ask another picoclaw agent to do a task on its own machine and return the result. Describe the task completely; the remote agent does not see this conversation. Available peers: %s.",
+		strings.Join(t.delegator.Peers(), ", "))
+}
+
+func (t *DelegateTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"peer": map[string]interface{}{
+				"type":        "string",
+				"description": "Name of the peer to run the task",
+				"enum":        t.delegator.Peers(),
+			},
+			"task": map[string]interface{}{
+				"type":        "string",
+				"description": "The task for the remote agent",
+			},
+		},
+		"required": []string{"peer", "task"},
+	}
+}
+
+// HasSideEffects reports true: the remote agent may act on its machine, so
+// a repeated call within a turn must not run the task twice.
+func (t *DelegateTool) HasSideEffects() bool {
+	return true
+}
+
+func (t *DelegateTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	peer, _ := args["peer"].(string)
+	task, _ := args["task"].(string)
+	if peer == "" || strings.TrimSpace(task) == "" {
+		return ErrorResult("peer and task are required")
+	}
+
+	result, err := t.delegator.Delegate(ctx, peer, task)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("delegation to %s failed: %v", peer, err)).WithError(err)
+	}
+	return NewToolResult(fmt.Sprintf("Result from %s:\n%s", peer, result))
+}
@@ -0,0 +1,337 @@
+package tools
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// diffContext is the number of unchanged lines shown around a change.
+	diffContext = 3
+	// maxDiffCells bounds the LCS table (about 1 MB); larger changes are
+	// shown as one replaced block instead of a minimal diff.
+	maxDiffCells = 250_000
+)
+
+// diffOp is one line of an edit script.
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	text string
+}
+
+// splitLines splits s into lines without their newline characters.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.Split(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns an edit script turning a into b.
+func diffLines(a, b []string) []diffOp {
+	// Trim common prefix and suffix so the LCS only covers the changed part.
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if len(midA)*len(midB) > maxDiffCells {
+		for _, line := range midA {
+			ops = append(ops, diffOp{'-', line})
+		}
+		for _, line := range midB {
+			ops = append(ops, diffOp{'+', line})
+		}
+	} else {
+		ops = append(ops, lcsDiff(midA, midB)...)
+	}
+
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
+
+// lcsDiff computes a minimal line diff with a longest-common-subsequence table.
+func lcsDiff(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	table := make([][]int32, n+1)
+	for i := range table {
+		table[i] = make([]int32, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				table[i][j] = table[i+1][j+1] + 1
+			} else if table[i+1][j] >= table[i][j+1] {
+				table[i][j] = table[i+1][j]
+			} else {
+				table[i][j] = table[i][j+1]
+			}
+		}
+	}
+
+	ops := make([]diffOp, 0, n+m)
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case table[i+1][j] >= table[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < m; j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
+
+// unifiedDiff renders the change from oldContent to newContent as a unified
+// diff. It returns "" when the contents are equal.
+func unifiedDiff(path, oldContent, newContent string) string {
+	if oldContent == newContent {
+		return ""
+	}
+	ops := diffLines(splitLines(oldContent), splitLines(newContent))
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- a/%s\n+++ b/%s\n", path, path)
+
+	// Walk the script and emit hunks of changes with surrounding context.
+	oldLine, newLine := 1, 1
+	for start := 0; start < len(ops); {
+		// Find the next change
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+			oldLine++
+			newLine++
+		}
+		if start >= len(ops) {
+			break
+		}
+
+		from := start - diffContext
+		if from < 0 {
+			from = 0
+		}
+		hunkOld, hunkNew := oldLine-(start-from), newLine-(start-from)
+
+		// Extend the hunk while changes are close together
+		end, lastChange := start, start
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				lastChange = end
+			} else if end-lastChange > 2*diffContext {
+				break
+			}
+			end++
+		}
+		to := lastChange + diffContext + 1
+		if to > len(ops) {
+			to = len(ops)
+		}
+
+		var body strings.Builder
+		oldCount, newCount := 0, 0
+		for _, op := range ops[from:to] {
+			body.WriteByte(op.kind)
+			body.WriteString(op.text)
+			body.WriteByte('\n')
+			if op.kind != '+' {
+				oldCount++
+			}
+			if op.kind != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n%s", hunkRange(hunkOld, oldCount), hunkRange(hunkNew, newCount), body.String())
+
+		// Advance line counters past the hunk
+		for _, op := range ops[start:to] {
+			if op.kind != '+' {
+				oldLine++
+			}
+			if op.kind != '-' {
+				newLine++
+			}
+		}
+		start = to
+	}
+	return sb.String()
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	if count == 1 {
+		return strconv.Itoa(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// diffHunk is a parsed hunk of a unified diff.
+type diffHunk struct {
+	oldStart int
+	lines    []diffOp
+}
+
+// parseUnifiedDiff parses the hunks of a single-file unified diff. File
+// headers ("---", "+++", "diff", "index") are skipped.
+func parseUnifiedDiff(patch string) ([]diffHunk, error) {
+	var hunks []diffHunk
+	var current *diffHunk
+
+	for _, line := range strings.Split(strings.ReplaceAll(patch, "\r\n", "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(line, "@@"):
+			oldStart, err := parseHunkHeader(line)
+			if err != nil {
+				return nil, err
+			}
+			hunks = append(hunks, diffHunk{oldStart: oldStart})
+			current = &hunks[len(hunks)-1]
+		case current == nil:
+			// Headers before the first hunk
+			continue
+		case strings.HasPrefix(line, `\`):
+			// "\ No newline at end of file"
+			continue
+		case line == "":
+			// Blank context line with its leading space stripped by an editor
+			current.lines = append(current.lines, diffOp{' ', ""})
+		case line[0] == ' ' || line[0] == '-' || line[0] == '+':
+			current.lines = append(current.lines, diffOp{line[0], line[1:]})
+		default:
+			return nil, fmt.Errorf("unexpected line in hunk: %q", line)
+		}
+	}
+
+	if len(hunks) == 0 {
+		return nil, fmt.Errorf("patch contains no hunks")
+	}
+	for i := range hunks {
+		// Drop trailing blank context added by a final newline in the patch
+		for len(hunks[i].lines) > 0 {
+			last := hunks[i].lines[len(hunks[i].lines)-1]
+			if last.kind != ' ' || last.text != "" {
+				break
+			}
+			hunks[i].lines = hunks[i].lines[:len(hunks[i].lines)-1]
+		}
+	}
+	return hunks, nil
+}
+
+// parseHunkHeader returns the old start line from "@@ -l,s +l,s @@".
+func parseHunkHeader(line string) (int, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 || !strings.HasPrefix(fields[1], "-") {
+		return 0, fmt.Errorf("invalid hunk header: %q", line)
+	}
+	start, _, _ := strings.Cut(fields[1][1:], ",")
+	n, err := strconv.Atoi(start)
+	if err != nil {
+		return 0, fmt.Errorf("invalid hunk header: %q", line)
+	}
+	return n, nil
+}
+
+// applyUnifiedDiff applies patch to content. Each hunk must match the file
+// exactly; its position may drift from the header's line number, as happens
+// when a model counts lines imprecisely.
+func applyUnifiedDiff(content, patch string) (string, error) {
+	hunks, err := parseUnifiedDiff(patch)
+	if err != nil {
+		return "", err
+	}
+
+	trailingNewline := strings.HasSuffix(content, "\n") || content == ""
+	lines := splitLines(content)
+	offset := 0 // shift caused by earlier hunks
+
+	for i, h := range hunks {
+		var oldLines, newLines []string
+		for _, op := range h.lines {
+			if op.kind != '+' {
+				oldLines = append(oldLines, op.text)
+			}
+			if op.kind != '-' {
+				newLines = append(newLines, op.text)
+			}
+		}
+
+		want := h.oldStart - 1 + offset
+		if len(oldLines) == 0 && h.oldStart == 0 {
+			want = 0
+		}
+		pos := findLines(lines, oldLines, want)
+		if pos < 0 {
+			return "", fmt.Errorf("hunk %d does not match the file (expected near line %d)", i+1, h.oldStart)
+		}
+
+		updated := make([]string, 0, len(lines)-len(oldLines)+len(newLines))
+		updated = append(updated, lines[:pos]...)
+		updated = append(updated, newLines...)
+		updated = append(updated, lines[pos+len(oldLines):]...)
+		lines = updated
+		offset += len(newLines) - len(oldLines)
+	}
+
+	result := strings.Join(lines, "\n")
+	if trailingNewline && len(lines) > 0 {
+		result += "\n"
+	}
+	return result, nil
+}
+
+// findLines returns the index where needle occurs in lines, searching
+// outward from near. It returns -1 if there is no match.
+func findLines(lines, needle []string, near int) int {
+	matchAt := func(pos int) bool {
+		if pos < 0 || pos+len(needle) > len(lines) {
+			return false
+		}
+		for k, line := range needle {
+			if lines[pos+k] != line {
+				return false
+			}
+		}
+		return true
+	}
+
+	for delta := 0; delta <= len(lines); delta++ {
+		if matchAt(near - delta) {
+			return near - delta
+		}
+		if delta > 0 && matchAt(near+delta) {
+			return near + delta
+		}
+	}
+	return -1
+}
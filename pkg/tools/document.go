@@ -0,0 +1,571 @@
+package tools
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// defaultDocumentChars is how much text read_document returns per call,
+	// below the output policy's default cap so pages aren't spilled.
+	defaultDocumentChars = 12000
+	maxDocumentChars     = 100000
+	// docxPartChars sizes the parts a DOCX without page breaks is split in.
+	docxPartChars = 3000
+	// maxDocumentEntry bounds one decompressed DOCX or EPUB entry.
+	maxDocumentEntry = 50 << 20
+)
+
+// DocumentPage is a page of a PDF, a chapter of an EPUB, or a page or part
+// of a DOCX.
+type DocumentPage struct {
+	Label string // e.g. "Page 3" or "Chapter 2: The Voyage"
+	Text  string
+}
+
+// ReadDocumentTool extracts the text of PDF, DOCX and EPUB files page by
+// page, returning as many pages as fit in one result and where to go on.
+type ReadDocumentTool struct {
+	pathScope
+	pdftotext string // the pdftotext binary, found on PATH if empty
+}
+
+func NewReadDocumentTool(workspace string, restrict bool) *ReadDocumentTool {
+	return &ReadDocumentTool{pathScope: pathScope{workspace: workspace, restrict: restrict}}
+}
+
+func (t *ReadDocumentTool) Name() string {
+	return "read_document"
+}
+
+// ConcurrencySafe reports true: documents are only read.
+func (t *ReadDocumentTool) ConcurrencySafe() bool {
+	return true
+}
+
+func (t *ReadDocumentTool) Description() string {
+	return "Read the text of a PDF, Word (.docx) or EPUB document, page by page (chapters for EPUB). Returns the requested pages up to max_chars and says which pages to ask for next. Use read_file for plain text files."
+}
+
+func (t *ReadDocumentTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "Path to the document",
+			},
+			"pages": map[string]interface{}{
+				"type":        "string",
+				"description": `Pages to read, e.g. "3", "2-5", "10-" or "1-2,7" (default: from the first page)`,
+			},
+			"max_chars": map[string]interface{}{
+				"type":        "integer",
+				"description": fmt.Sprintf("Most characters to return (default %d, max %d); later pages are left for the next call", defaultDocumentChars, maxDocumentChars),
+			},
+		},
+		"required": []string{"path"},
+	}
+}
+
+func (t *ReadDocumentTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	path, _ := args["path"].(string)
+	if path == "" {
+		return ErrorResult("path is required")
+	}
+	maxChars := defaultDocumentChars
+	if v, ok := args["max_chars"].(float64); ok && v >= 1 {
+		maxChars = min(int(v), maxDocumentChars)
+	}
+	resolved, err := t.resolvePath(path)
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+
+	format := DocumentFormat(resolved)
+	if format == "" {
+		return ErrorResult(fmt.Sprintf("%s is not a PDF, DOCX or EPUB file; use read_file for text files", path))
+	}
+	pages, err := readDocument(ctx, t.pdftotext, resolved)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to read %s: %v", path, err)).WithError(err)
+	}
+	if len(pages) == 0 {
+		return ErrorResult(fmt.Sprintf("%s has no text", path))
+	}
+
+	spec, _ := args["pages"].(string)
+	wanted, err := parsePageRanges(spec, len(pages))
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+	return documentResult(path, format, pages, wanted, maxChars)
+}
+
+// DocumentFormat returns "pdf", "docx" or "epub" for a document
+// read_document can read, judged by its extension, or "" for other files.
+func DocumentFormat(path string) string {
+	switch format := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), ".")); format {
+	case "pdf", "docx", "epub":
+		return format
+	}
+	return ""
+}
+
+// ReadDocumentPages extracts the text of the PDF, DOCX or EPUB file at
+// path page by page, as read_document does.
+func ReadDocumentPages(ctx context.Context, path string) ([]DocumentPage, error) {
+	return readDocument(ctx, "", path)
+}
+
+func readDocument(ctx context.Context, pdftotext, path string) ([]DocumentPage, error) {
+	switch DocumentFormat(path) {
+	case "pdf":
+		return readPDF(ctx, pdftotext, path)
+	case "docx":
+		return readDOCX(path)
+	case "epub":
+		return readEPUB(path)
+	}
+	return nil, fmt.Errorf("%s is not a PDF, DOCX or EPUB file", filepath.Base(path))
+}
+
+// documentResult renders the wanted pages until maxChars is reached and
+// says where to continue.
+func documentResult(path, format string, pages []DocumentPage, wanted []int, maxChars int) *ToolResult {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s (%s, %d %s)\n", filepath.Base(path), strings.ToUpper(format), len(pages), pageNoun(format, len(pages)))
+
+	var shown []int
+	cut := false
+	for _, n := range wanted {
+		page := pages[n-1]
+		block := fmt.Sprintf("\n--- %s ---\n%s\n", page.Label, strings.TrimSpace(page.Text))
+		if sb.Len()+len(block) > maxChars {
+			if len(shown) > 0 {
+				break
+			}
+			// A single page over the limit is cut rather than skipped
+			block = truncateRunes(block, maxChars) + "\n[Page cut at max_chars.]\n"
+			cut = true
+		}
+		sb.WriteString(block)
+		shown = append(shown, n)
+	}
+
+	if strings.TrimSpace(joinPages(pages, shown)) == "" && format == "pdf" {
+		sb.WriteString("\n[No text found on these pages: the PDF may be scanned images without a text layer.]\n")
+	}
+
+	next := ""
+	if rest := wanted[len(shown):]; len(rest) > 0 {
+		next = formatPageRanges(rest)
+		fmt.Fprintf(&sb, "\n[Showed %s of the requested pages. Continue with pages=%q.]", formatPageRanges(shown), next)
+	} else if last := shown[len(shown)-1]; last < len(pages) && !cut {
+		fmt.Fprintf(&sb, "\n[End of the requested pages; the document continues to %s %d.]", strings.ToLower(pageNoun(format, 1)), len(pages))
+	}
+
+	return NewToolResult(strings.TrimRight(sb.String(), "\n")).WithData(map[string]interface{}{
+		"format": format,
+		"pages":  len(pages),
+		"shown":  shown,
+		"next":   next,
+	})
+}
+
+func pageNoun(format string, n int) string {
+	noun := "page"
+	if format == "epub" {
+		noun = "chapter"
+	}
+	if n != 1 {
+		noun += "s"
+	}
+	return noun
+}
+
+func joinPages(pages []DocumentPage, numbers []int) string {
+	var sb strings.Builder
+	for _, n := range numbers {
+		sb.WriteString(pages[n-1].Text)
+	}
+	return sb.String()
+}
+
+// truncateRunes cuts s to at most n bytes without splitting a character.
+func truncateRunes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// parsePageRanges reads "3", "2-5", "10-" or "1-2,7" into page numbers for
+// a document of total pages; empty is every page.
+func parsePageRanges(spec string, total int) ([]int, error) {
+	spec = strings.ReplaceAll(spec, " ", "")
+	if spec == "" {
+		spec = "1-"
+	}
+	var pages []int
+	seen := make(map[int]bool)
+	for _, part := range strings.Split(spec, ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		first, err := strconv.Atoi(from)
+		if err != nil || first < 1 {
+			return nil, fmt.Errorf("invalid pages %q: use e.g. \"3\", \"2-5\" or \"10-\"", spec)
+		}
+		last := first
+		if isRange {
+			last = total
+			if to != "" {
+				if last, err = strconv.Atoi(to); err != nil || last < first {
+					return nil, fmt.Errorf("invalid pages %q: use e.g. \"3\", \"2-5\" or \"10-\"", spec)
+				}
+			}
+		}
+		if first > total {
+			return nil, fmt.Errorf("page %d is past the end: the document has %d", first, total)
+		}
+		for n := first; n <= min(last, total); n++ {
+			if !seen[n] {
+				seen[n] = true
+				pages = append(pages, n)
+			}
+		}
+	}
+	return pages, nil
+}
+
+// formatPageRanges writes page numbers back as ranges, e.g. "1-3,7".
+func formatPageRanges(pages []int) string {
+	var parts []string
+	for i := 0; i < len(pages); {
+		j := i
+		for j+1 < len(pages) && pages[j+1] == pages[j]+1 {
+			j++
+		}
+		if i == j {
+			parts = append(parts, strconv.Itoa(pages[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", pages[i], pages[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
+
+// readPDF runs pdftotext (poppler-utils), which separates pages with form
+// feeds.
+func readPDF(ctx context.Context, binary, path string) ([]DocumentPage, error) {
+	if binary == "" {
+		binary = "pdftotext"
+	}
+	if _, err := exec.LookPath(binary); err != nil {
+		return nil, errors.New("reading PDFs needs pdftotext from poppler-utils (e.g. apt install poppler-utils)")
+	}
+	cmd := exec.CommandContext(ctx, binary, "-enc", "UTF-8", path, "-")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("pdftotext: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	texts := strings.Split(stdout.String(), "\f")
+	if len(texts) > 1 && strings.TrimSpace(texts[len(texts)-1]) == "" {
+		texts = texts[:len(texts)-1]
+	}
+	pages := make([]DocumentPage, len(texts))
+	for i, text := range texts {
+		pages[i] = DocumentPage{Label: fmt.Sprintf("Page %d", i+1), Text: text}
+	}
+	return pages, nil
+}
+
+// readDOCX reads word/document.xml. Pages follow the page breaks Word
+// saved; a document without them is split into parts of about
+// docxPartChars at paragraph ends.
+func readDOCX(path string) ([]DocumentPage, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	data, err := readZipEntry(&zr.Reader, "word/document.xml")
+	if err != nil {
+		return nil, err
+	}
+
+	var pages []string
+	var page, para strings.Builder
+	breakPage := func() {
+		if strings.TrimSpace(page.String()) != "" {
+			pages = append(pages, page.String())
+		}
+		page.Reset()
+	}
+	heading := false
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid document.xml: %w", err)
+		}
+		switch el := tok.(type) {
+		case xml.StartElement:
+			switch el.Name.Local {
+			case "t":
+				var text string
+				if err := dec.DecodeElement(&text, &el); err == nil {
+					para.WriteString(text)
+				}
+			case "tab":
+				para.WriteString("\t")
+			case "br":
+				if attr(el, "type") == "page" {
+					page.WriteString(para.String())
+					para.Reset()
+					breakPage()
+				} else {
+					para.WriteString("\n")
+				}
+			case "lastRenderedPageBreak":
+				page.WriteString(para.String())
+				para.Reset()
+				breakPage()
+			case "pStyle":
+				heading = strings.HasPrefix(strings.ToLower(attr(el, "val")), "heading") ||
+					strings.EqualFold(attr(el, "val"), "title")
+			}
+		case xml.EndElement:
+			if el.Name.Local == "p" {
+				if text := strings.TrimSpace(para.String()); text != "" {
+					if heading {
+						page.WriteString("# ")
+					}
+					page.WriteString(text)
+				}
+				page.WriteString("\n")
+				para.Reset()
+				heading = false
+			}
+		}
+	}
+	page.WriteString(para.String())
+	breakPage()
+
+	label := "Page"
+	if len(pages) == 1 && len(pages[0]) > docxPartChars {
+		pages = splitParagraphs(pages[0], docxPartChars)
+		label = "Part"
+	}
+	out := make([]DocumentPage, len(pages))
+	for i, text := range pages {
+		out[i] = DocumentPage{Label: fmt.Sprintf("%s %d", label, i+1), Text: text}
+	}
+	return out, nil
+}
+
+// splitParagraphs cuts text into parts of about size at line ends.
+func splitParagraphs(text string, size int) []string {
+	var parts []string
+	var part strings.Builder
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if part.Len() > 0 && part.Len()+len(line) > size {
+			parts = append(parts, part.String())
+			part.Reset()
+		}
+		part.WriteString(line)
+	}
+	if strings.TrimSpace(part.String()) != "" {
+		parts = append(parts, part.String())
+	}
+	return parts
+}
+
+// readEPUB reads the chapters in the order of the book's spine.
+func readEPUB(file string) ([]DocumentPage, error) {
+	zr, err := zip.OpenReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	data, err := readZipEntry(&zr.Reader, "META-INF/container.xml")
+	if err != nil {
+		return nil, err
+	}
+	var container struct {
+		Rootfiles []struct {
+			FullPath string `xml:"full-path,attr"`
+		} `xml:"rootfiles>rootfile"`
+	}
+	if err := xml.Unmarshal(data, &container); err != nil || len(container.Rootfiles) == 0 {
+		return nil, errors.New("invalid EPUB: no package document")
+	}
+	opfPath := container.Rootfiles[0].FullPath
+	data, err = readZipEntry(&zr.Reader, opfPath)
+	if err != nil {
+		return nil, err
+	}
+	var pkg struct {
+		Items []struct {
+			ID   string `xml:"id,attr"`
+			Href string `xml:"href,attr"`
+		} `xml:"manifest>item"`
+		Spine []struct {
+			IDRef string `xml:"idref,attr"`
+		} `xml:"spine>itemref"`
+	}
+	if err := xml.Unmarshal(data, &pkg); err != nil {
+		return nil, fmt.Errorf("invalid EPUB package: %w", err)
+	}
+	hrefs := make(map[string]string, len(pkg.Items))
+	for _, item := range pkg.Items {
+		hrefs[item.ID] = item.Href
+	}
+
+	var pages []DocumentPage
+	for _, ref := range pkg.Spine {
+		href, ok := hrefs[ref.IDRef]
+		if !ok {
+			continue
+		}
+		name := path.Join(path.Dir(opfPath), href)
+		if i := strings.IndexByte(name, '#'); i >= 0 {
+			name = name[:i]
+		}
+		chapter, err := readZipEntry(&zr.Reader, name)
+		if err != nil {
+			continue
+		}
+		title, text := HTMLText(chapter)
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		label := fmt.Sprintf("Chapter %d", len(pages)+1)
+		if title != "" {
+			label += ": " + title
+		}
+		pages = append(pages, DocumentPage{Label: label, Text: text})
+	}
+	return pages, nil
+}
+
+// HTMLText returns the first heading and the text of an HTML page or
+// XHTML chapter, with a line per block element.
+func HTMLText(data []byte) (title, text string) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = false
+	dec.AutoClose = xml.HTMLAutoClose
+	dec.Entity = xml.HTMLEntity
+
+	var sb, headingText strings.Builder
+	skip, inHeading := 0, false
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		switch el := tok.(type) {
+		case xml.StartElement:
+			switch strings.ToLower(el.Name.Local) {
+			case "script", "style", "head", "nav", "noscript", "svg":
+				skip++
+			case "h1", "h2", "h3", "h4", "h5", "h6":
+				sb.WriteString("\n# ")
+				inHeading = title == ""
+			case "p", "div", "li", "tr", "blockquote", "section":
+				sb.WriteString("\n")
+			case "br":
+				sb.WriteString("\n")
+			}
+		case xml.EndElement:
+			switch strings.ToLower(el.Name.Local) {
+			case "script", "style", "head", "nav", "noscript", "svg":
+				skip--
+			case "h1", "h2", "h3", "h4", "h5", "h6":
+				if inHeading {
+					title = strings.Join(strings.Fields(headingText.String()), " ")
+					inHeading = false
+				}
+				sb.WriteString("\n")
+			case "p", "div", "li", "blockquote":
+				sb.WriteString("\n")
+			}
+		case xml.CharData:
+			if skip > 0 {
+				continue
+			}
+			// Collapse whitespace, keeping a space where the source had one
+			raw := string(el)
+			s := strings.Join(strings.Fields(raw), " ")
+			if raw != strings.TrimLeftFunc(raw, unicode.IsSpace) {
+				s = " " + s
+			}
+			if s != " " && raw != strings.TrimRightFunc(raw, unicode.IsSpace) {
+				s += " "
+			}
+			sb.WriteString(s)
+			if inHeading {
+				headingText.WriteString(s)
+			}
+		}
+	}
+
+	var lines []string
+	for _, line := range strings.Split(sb.String(), "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" && line != "#" {
+			lines = append(lines, line)
+		}
+	}
+	return title, strings.Join(lines, "\n")
+}
+
+func readZipEntry(zr *zip.Reader, name string) ([]byte, error) {
+	for _, f := range zr.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		data, err := io.ReadAll(io.LimitReader(rc, maxDocumentEntry+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > maxDocumentEntry {
+			return nil, fmt.Errorf("%s is too large", name)
+		}
+		return data, nil
+	}
+	return nil, fmt.Errorf("missing %s", name)
+}
+
+func attr(el xml.StartElement, name string) string {
+	for _, a := range el.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,154 @@
+package tools
+
+import (
+	"archive/zip"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func writeZip(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for name, content := range files {
+		w, _ := zw.Create(name)
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+const testDocx = `<?xml version="1.0" encoding="UTF-8"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>
+<w:p><w:pPr><w:pStyle w:val="Heading1"/></w:pPr><w:r><w:t>Quarterly report</w:t></w:r></w:p>
+<w:p><w:r><w:t xml:space="preserve">Sales rose </w:t></w:r><w:r><w:t>12%.</w:t></w:r></w:p>
+<w:p><w:r><w:br w:type="page"/><w:t>Outlook is stable.</w:t></w:r></w:p>
+</w:body></w:document>`
+
+// TestReadDocumentDOCX verifies paragraphs, headings and page breaks
+func TestReadDocumentDOCX(t *testing.T) {
+	dir := t.TempDir()
+	writeZip(t, filepath.Join(dir, "report.docx"), map[string]string{"word/document.xml": testDocx})
+	tool := NewReadDocumentTool(dir, true)
+
+	result := tool.Execute(context.Background(), map[string]interface{}{"path": "report.docx"})
+	if result.IsError {
+		t.Fatalf("Expected the document, got %s", result.ForLLM)
+	}
+	for _, want := range []string{"report.docx (DOCX, 2 pages)", "--- Page 1 ---\n# Quarterly report\nSales rose 12%.", "--- Page 2 ---\nOutlook is stable."} {
+		if !strings.Contains(result.ForLLM, want) {
+			t.Errorf("Expected %q in %q", want, result.ForLLM)
+		}
+	}
+
+	result = tool.Execute(context.Background(), map[string]interface{}{"path": "report.docx", "pages": "2"})
+	if strings.Contains(result.ForLLM, "Sales") || !strings.Contains(result.ForLLM, "Outlook") {
+		t.Errorf("Expected only page 2, got %q", result.ForLLM)
+	}
+	if result := tool.Execute(context.Background(), map[string]interface{}{"path": "report.docx", "pages": "5"}); !result.IsError {
+		t.Errorf("Expected an error past the end, got %q", result.ForLLM)
+	}
+}
+
+// TestReadDocumentEPUB verifies chapters follow the spine, with titles
+func TestReadDocumentEPUB(t *testing.T) {
+	dir := t.TempDir()
+	writeZip(t, filepath.Join(dir, "book.epub"), map[string]string{
+		"META-INF/container.xml": `<container><rootfiles><rootfile full-path="OEBPS/content.opf"/></rootfiles></container>`,
+		"OEBPS/content.opf": `<package><manifest>
+<item id="c1" href="one.xhtml"/><item id="c2" href="text/two.xhtml"/><item id="css" href="style.css"/>
+</manifest><spine><itemref idref="c2"/><itemref idref="c1"/></spine></package>`,
+		"OEBPS/one.xhtml":      `<html><head><title>x</title><style>p{}</style></head><body><h1>Arrival</h1><p>They landed&nbsp;at dawn.</p></body></html>`,
+		"OEBPS/text/two.xhtml": `<html><body><h2>Departure</h2><p>The ship <em>left</em>.<br/>Nobody waved.</p></body></html>`,
+	})
+
+	result := NewReadDocumentTool(dir, true).Execute(context.Background(), map[string]interface{}{"path": "book.epub"})
+	if result.IsError {
+		t.Fatalf("Expected the book, got %s", result.ForLLM)
+	}
+	want := "--- Chapter 1: Departure ---\n# Departure\nThe ship left.\nNobody waved.\n\n--- Chapter 2: Arrival ---\n# Arrival\nThey landed at dawn."
+	if !strings.Contains(result.ForLLM, want) {
+		t.Errorf("Expected chapters in spine order, got %q", result.ForLLM)
+	}
+}
+
+// TestReadDocumentChunking verifies pages beyond max_chars are left for
+// the next call, which is named
+func TestReadDocumentChunking(t *testing.T) {
+	var pages []DocumentPage
+	for i := 1; i <= 5; i++ {
+		pages = append(pages, DocumentPage{Label: "Page " + string(rune('0'+i)), Text: strings.Repeat("word ", 100)})
+	}
+	wanted, _ := parsePageRanges("", 5)
+	result := documentResult("big.pdf", "pdf", pages, wanted, 1200)
+	if !strings.Contains(result.ForLLM, "Page 2") || strings.Contains(result.ForLLM, "Page 3 ---") {
+		t.Errorf("Expected two pages to fit, got %q", result.ForLLM)
+	}
+	if !strings.Contains(result.ForLLM, `Continue with pages="3-5"`) {
+		t.Errorf("Expected where to continue, got %q", result.ForLLM)
+	}
+	if data := result.Data.(map[string]interface{}); data["next"] != "3-5" || data["pages"] != 5 {
+		t.Errorf("Expected the continuation in the data, got %v", data)
+	}
+
+	// A page longer than max_chars is cut, not skipped
+	result = documentResult("big.pdf", "pdf", pages, []int{4}, 200)
+	if !strings.Contains(result.ForLLM, "Page 4") || !strings.Contains(result.ForLLM, "cut at max_chars") {
+		t.Errorf("Expected the page cut, got %q", result.ForLLM)
+	}
+}
+
+// TestReadDocumentPDF verifies pdftotext output is split at form feeds
+func TestReadDocumentPDF(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("pdftotext is faked with a shell script")
+	}
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "scan.pdf"), []byte("%PDF-1.4"), 0644)
+	fake := filepath.Join(dir, "pdftotext")
+	os.WriteFile(fake, []byte("#!/bin/sh\nprintf 'Invoice 42\\fTotal: 10 EUR\\f'\n"), 0755)
+	tool := NewReadDocumentTool(dir, true)
+	tool.pdftotext = fake
+
+	result := tool.Execute(context.Background(), map[string]interface{}{"path": "scan.pdf", "pages": "2-"})
+	if result.IsError {
+		t.Fatalf("Expected the PDF, got %s", result.ForLLM)
+	}
+	if !strings.Contains(result.ForLLM, "(PDF, 2 pages)") || !strings.Contains(result.ForLLM, "--- Page 2 ---\nTotal: 10 EUR") || strings.Contains(result.ForLLM, "Invoice") {
+		t.Errorf("Expected page 2 of 2, got %q", result.ForLLM)
+	}
+}
+
+func TestParsePageRanges(t *testing.T) {
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"", "1-10"},
+		{"3", "3"},
+		{"2-4", "2-4"},
+		{"8-", "8-10"},
+		{"1-2, 7", "1-2,7"},
+		{"9-20", "9-10"},
+	}
+	for _, tt := range tests {
+		pages, err := parsePageRanges(tt.spec, 10)
+		if err != nil || formatPageRanges(pages) != tt.want {
+			t.Errorf("parsePageRanges(%q) = %v, %v; want %s", tt.spec, pages, err, tt.want)
+		}
+	}
+	for _, bad := range []string{"x", "0", "5-3", "11"} {
+		if _, err := parsePageRanges(bad, 10); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+)
+
+// DryRunTool is an optional interface for tools that can describe what a
+// call would do in more detail than its arguments, e.g. exec checks the
+// command against the guard and file tools compute the diff.
+type DryRunTool interface {
+	Tool
+	DryRun(ctx context.Context, args map[string]interface{}) *ToolResult
+}
+
+// mutatingTools are the built-in tools that change something outside the
+// conversation. In dry-run mode they, and every SideEffectTool, only report
+// what they would do; read-only tools still run so the plan is realistic.
+var mutatingTools = map[string]bool{
+	"exec":          true,
+	"shell_session": true,
+	"python":        true,
+	"browser":       true,
+	"mqtt":          true,
+	"write_file":    true,
+	"edit_file":     true,
+	"append_file":   true,
+	"kill_process":  true,
+	"cron":          true,
+	"i2c":           true,
+	"spi":           true,
+}
+
+// isMutating reports whether tool must not run in dry-run mode.
+func isMutating(tool Tool) bool {
+	if _, ok := tool.(DryRunTool); ok {
+		return true
+	}
+	if se, ok := tool.(SideEffectTool); ok && se.HasSideEffects() {
+		return true
+	}
+	return mutatingTools[tool.Name()]
+}
+
+// dryRunResult describes the call without performing it.
+func dryRunResult(ctx context.Context, name string, tool Tool, args map[string]interface{}) *ToolResult {
+	if dr, ok := tool.(DryRunTool); ok {
+		return dr.DryRun(ctx, args)
+	}
+	action := ""
+	if ct, ok := tool.(ConfirmableTool); ok {
+		action = ct.ConfirmationSummary(args)
+	}
+	if action == "" {
+		argsJSON, _ := json.Marshal(args)
+		action = string(argsJSON)
+	}
+	return UserResult(fmt.Sprintf("Dry run, %s not called. It would run with:\n%s", name, action))
+}
+
+// DryRun reports the command, where it would run and what the guard would
+// say about it, without running it.
+func (t *ExecTool) DryRun(ctx context.Context, args map[string]interface{}) *ToolResult {
+	command, ok := args["command"].(string)
+	if !ok {
+		return ErrorResult("command is required")
+	}
+	cwd := t.workingDir
+	if wd, ok := args["working_dir"].(string); ok && wd != "" {
+		cwd = wd
+	}
+	if cwd == "" {
+		if wd, err := os.Getwd(); err == nil {
+			cwd = wd
+		}
+	}
+
+	msg := fmt.Sprintf("Dry run, command not executed. It would run:\n%s\n(in %s)", command, cwd)
+	if names := secretNames(args); len(names) > 0 {
+		msg += fmt.Sprintf("\n(with secrets: %v)", names)
+	}
+	if block := t.guardCommand(command, cwd); block != nil {
+		if block.Severity == GuardConfirm {
+			msg += fmt.Sprintf("\nThe user would be asked to confirm it: rule %s (%s).", block.Rule, block.Reason)
+		} else {
+			msg += "\nIt would be refused: " + block.Error()
+		}
+	}
+	return UserResult(msg)
+}
+
+// DryRun previews the write as a diff.
+func (t *WriteFileTool) DryRun(ctx context.Context, args map[string]interface{}) *ToolResult {
+	return showUser(t.Execute(ctx, withDryRun(args)))
+}
+
+// DryRun previews the edit as a diff.
+func (t *EditFileTool) DryRun(ctx context.Context, args map[string]interface{}) *ToolResult {
+	return showUser(t.Execute(ctx, withDryRun(args)))
+}
+
+// DryRun checks the path and reports how much would be appended.
+func (t *AppendFileTool) DryRun(ctx context.Context, args map[string]interface{}) *ToolResult {
+	path, ok := args["path"].(string)
+	if !ok {
+		return ErrorResult("path is required")
+	}
+	content, ok := args["content"].(string)
+	if !ok {
+		return ErrorResult("content is required")
+	}
+	if _, err := t.resolvePath(path); err != nil {
+		return ErrorResult(err.Error())
+	}
+	return UserResult(fmt.Sprintf("Dry run, file not modified. %d bytes would be appended to %s:\n%s",
+		len(content), path, truncatePreview(content)))
+}
+
+// withDryRun returns a copy of args with dry_run set, for tools that
+// already support previewing a single call.
+func withDryRun(args map[string]interface{}) map[string]interface{} {
+	copied := maps.Clone(args)
+	if copied == nil {
+		copied = make(map[string]interface{})
+	}
+	copied["dry_run"] = true
+	return copied
+}
+
+// showUser makes a successful preview visible to the user as well.
+func showUser(result *ToolResult) *ToolResult {
+	if !result.IsError {
+		result.ForUser = result.ForLLM
+	}
+	return result
+}
@@ -0,0 +1,58 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestToolRegistry_DryRun verifies that mutating tools only describe their
+// calls in dry-run mode while read-only tools still run.
+func TestToolRegistry_DryRun(t *testing.T) {
+	workspace := t.TempDir()
+	r := NewToolRegistry()
+	r.Register(NewWriteFileTool(workspace, true))
+	r.Register(NewExecTool(workspace, true))
+	r.Register(&stubTool{name: "lookup"})
+	r.SetDryRun(true)
+	ctx := context.Background()
+
+	result := r.Execute(ctx, "write_file", map[string]interface{}{"path": "notes.txt", "content": "hello\n"})
+	if result.IsError || !strings.Contains(result.ForLLM, "Dry run") || !strings.Contains(result.ForLLM, "+hello") {
+		t.Errorf("Expected a dry-run diff, got %q", result.ForLLM)
+	}
+	if result.ForUser == "" {
+		t.Error("Expected the dry-run preview to be shown to the user")
+	}
+	if _, err := os.Stat(filepath.Join(workspace, "notes.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected no file to be written, stat returned %v", err)
+	}
+
+	result = r.Execute(ctx, "exec", map[string]interface{}{"command": "touch made.txt"})
+	if result.IsError || !strings.Contains(result.ForLLM, "touch made.txt") {
+		t.Errorf("Expected the command to be described, got %q", result.ForLLM)
+	}
+	if _, err := os.Stat(filepath.Join(workspace, "made.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected the command not to run, stat returned %v", err)
+	}
+
+	result = r.Execute(ctx, "exec", map[string]interface{}{"command": "rm -rf /"})
+	if !strings.Contains(result.ForLLM, "would be refused") {
+		t.Errorf("Expected the guard verdict in the dry run, got %q", result.ForLLM)
+	}
+
+	if result := r.Execute(ctx, "lookup", nil); result.ForLLM != "ran lookup" {
+		t.Errorf("Expected read-only tools to run, got %q", result.ForLLM)
+	}
+
+	r.SetDryRun(false)
+	result = r.Execute(ctx, "write_file", map[string]interface{}{"path": "notes.txt", "content": "hello\n"})
+	if result.IsError {
+		t.Fatalf("Expected the write to succeed, got %q", result.ForLLM)
+	}
+	if _, err := os.Stat(filepath.Join(workspace, "notes.txt")); err != nil {
+		t.Errorf("Expected the file to be written once dry run is off: %v", err)
+	}
+}
@@ -7,19 +7,16 @@ import (
 	"strings"
 )
 
-// EditFileTool edits a file by replacing old_text with new_text.
-// The old_text must exist exactly in the file.
+// EditFileTool edits a file either by replacing old_text with new_text,
+// where old_text must exist exactly once in the file, or by applying a
+// unified diff. With dry_run it only returns the diff it would apply.
 type EditFileTool struct {
-	allowedDir string
-	restrict   bool
+	pathScope
 }
 
 // NewEditFileTool creates a new EditFileTool with optional directory restriction.
 func NewEditFileTool(allowedDir string, restrict bool) *EditFileTool {
-	return &EditFileTool{
-		allowedDir: allowedDir,
-		restrict:   restrict,
-	}
+	return &EditFileTool{pathScope: pathScope{workspace: allowedDir, restrict: restrict}}
 }
 
 func (t *EditFileTool) Name() string {
@@ -27,7 +24,7 @@ func (t *EditFileTool) Name() string {
 }
 
 func (t *EditFileTool) Description() string {
-	return "Edit a file by replacing old_text with new_text. The old_text must exist exactly in the file."
+	return "Edit a file by replacing old_text with new_text (old_text must appear exactly once), or by applying a unified diff in patch. Set dry_run to preview the change as a diff without writing it."
 }
 
 func (t *EditFileTool) Parameters() map[string]interface{} {
@@ -46,68 +43,132 @@ func (t *EditFileTool) Parameters() map[string]interface{} {
 				"type":        "string",
 				"description": "The text to replace with",
 			},
+			"patch": map[string]interface{}{
+				"type":        "string",
+				"description": "A unified diff to apply instead of old_text/new_text",
+			},
+			"dry_run": map[string]interface{}{
+				"type":        "boolean",
+				"description": "If true, return the diff without modifying the file",
+			},
 		},
-		"required": []string{"path", "old_text", "new_text"},
+		"required": []string{"path"},
+	}
+}
+
+// ConfirmationSummary shows the diff when approval is required.
+func (t *EditFileTool) ConfirmationSummary(args map[string]interface{}) string {
+	path, _ := args["path"].(string)
+	_, oldContent, newContent, errResult := t.plan(args)
+	if errResult != nil {
+		return ""
 	}
+	return truncatePreview(unifiedDiff(path, oldContent, newContent))
 }
 
 func (t *EditFileTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
-	path, ok := args["path"].(string)
-	if !ok {
-		return ErrorResult("path is required")
+	resolvedPath, oldContent, newContent, errResult := t.plan(args)
+	if errResult != nil {
+		return errResult
 	}
 
-	oldText, ok := args["old_text"].(string)
-	if !ok {
-		return ErrorResult("old_text is required")
+	path, _ := args["path"].(string)
+	diff := unifiedDiff(path, oldContent, newContent)
+
+	if dryRun, _ := args["dry_run"].(bool); dryRun {
+		if diff == "" {
+			return NewToolResult("Dry run: the edit would not change the file")
+		}
+		return NewToolResult("Dry run, file not modified. The edit would apply:\n" + diff).WithPreview(diff)
 	}
 
-	newText, ok := args["new_text"].(string)
+	if exceeded := t.reserve(int64(len(newContent) - len(oldContent))); exceeded != nil {
+		return exceeded
+	}
+
+	if err := os.WriteFile(resolvedPath, []byte(newContent), 0644); err != nil {
+		return ErrorResult(fmt.Sprintf("failed to write file: %v", err))
+	}
+
+	return SilentResult(fmt.Sprintf("File edited: %s", path)).WithPreview(diff)
+}
+
+// plan validates the arguments and computes the edited content without
+// touching the file.
+func (t *EditFileTool) plan(args map[string]interface{}) (resolvedPath, oldContent, newContent string, errResult *ToolResult) {
+	path, ok := args["path"].(string)
 	if !ok {
-		return ErrorResult("new_text is required")
+		return "", "", "", ErrorResult("path is required")
 	}
 
-	resolvedPath, err := validatePath(path, t.allowedDir, t.restrict)
+	patch, hasPatch := args["patch"].(string)
+	hasPatch = hasPatch && patch != ""
+	oldText, hasOld := args["old_text"].(string)
+	newText, hasNew := args["new_text"].(string)
+	if !hasPatch {
+		if !hasOld {
+			return "", "", "", ErrorResult("old_text is required")
+		}
+		if !hasNew {
+			return "", "", "", ErrorResult("new_text is required")
+		}
+	}
+
+	resolvedPath, err := t.resolvePath(path)
 	if err != nil {
-		return ErrorResult(err.Error())
+		return "", "", "", ErrorResult(err.Error())
 	}
 
 	if _, err := os.Stat(resolvedPath); os.IsNotExist(err) {
-		return ErrorResult(fmt.Sprintf("file not found: %s", path))
+		return "", "", "", ErrorResult(fmt.Sprintf("file not found: %s", path))
+	}
+	if refused := checkTextFile(resolvedPath, path, maxEditFileSize); refused != nil {
+		return "", "", "", refused
 	}
 
 	content, err := os.ReadFile(resolvedPath)
 	if err != nil {
-		return ErrorResult(fmt.Sprintf("failed to read file: %v", err))
+		return "", "", "", ErrorResult(fmt.Sprintf("failed to read file: %v", err))
 	}
-
 	contentStr := string(content)
 
+	if hasPatch {
+		patched, err := applyUnifiedDiff(contentStr, patch)
+		if err != nil {
+			return "", "", "", ErrorResult(fmt.Sprintf("failed to apply patch: %v", err))
+		}
+		return resolvedPath, contentStr, patched, nil
+	}
+
 	if !strings.Contains(contentStr, oldText) {
-		return ErrorResult("old_text not found in file. Make sure it matches exactly")
+		return "", "", "", ErrorResult("old_text not found in file. Make sure it matches exactly")
 	}
 
 	count := strings.Count(contentStr, oldText)
 	if count > 1 {
-		return ErrorResult(fmt.Sprintf("old_text appears %d times. Please provide more context to make it unique", count))
+		return "", "", "", ErrorResult(fmt.Sprintf("old_text appears %d times. Please provide more context to make it unique", count))
 	}
 
-	newContent := strings.Replace(contentStr, oldText, newText, 1)
+	return resolvedPath, contentStr, strings.Replace(contentStr, oldText, newText, 1), nil
+}
 
-	if err := os.WriteFile(resolvedPath, []byte(newContent), 0644); err != nil {
-		return ErrorResult(fmt.Sprintf("failed to write file: %v", err))
-	}
+// maxPreviewLen bounds diffs shown in approval prompts.
+const maxPreviewLen = 3000
 
-	return SilentResult(fmt.Sprintf("File edited: %s", path))
+// truncatePreview shortens a diff for display to the user.
+func truncatePreview(preview string) string {
+	if len(preview) <= maxPreviewLen {
+		return preview
+	}
+	return preview[:maxPreviewLen] + fmt.Sprintf("\n... (%d more bytes)", len(preview)-maxPreviewLen)
 }
 
 type AppendFileTool struct {
-	workspace string
-	restrict  bool
+	pathScope
 }
 
 func NewAppendFileTool(workspace string, restrict bool) *AppendFileTool {
-	return &AppendFileTool{workspace: workspace, restrict: restrict}
+	return &AppendFileTool{pathScope: pathScope{workspace: workspace, restrict: restrict}}
 }
 
 func (t *AppendFileTool) Name() string {
@@ -146,11 +207,19 @@ func (t *AppendFileTool) Execute(ctx context.Context, args map[string]interface{
 		return ErrorResult("content is required")
 	}
 
-	resolvedPath, err := validatePath(path, t.workspace, t.restrict)
+	resolvedPath, err := t.resolvePath(path)
 	if err != nil {
 		return ErrorResult(err.Error())
 	}
 
+	if refused := checkTextFile(resolvedPath, path, 0); refused != nil {
+		return refused
+	}
+
+	if exceeded := t.reserve(int64(len(content))); exceeded != nil {
+		return exceeded
+	}
+
 	f, err := os.OpenFile(resolvedPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		return ErrorResult(fmt.Sprintf("failed to open file: %v", err))
@@ -2,6 +2,7 @@ package tools
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -287,3 +288,93 @@ func TestEditTool_AppendFile_MissingContent(t *testing.T) {
 		t.Errorf("Expected error when content is missing")
 	}
 }
+
+// TestEditTool_EditFile_Patch verifies a unified diff is applied even when
+// the hunk header line number is off
+func TestEditTool_EditFile_Patch(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "config.ini")
+	os.WriteFile(testFile, []byte("[main]\nname=pico\nport=80\ndebug=false\n"), 0644)
+
+	patch := "--- a/config.ini\n+++ b/config.ini\n@@ -5,3 +5,3 @@\n name=pico\n-port=80\n+port=8080\n debug=false\n"
+	tool := NewEditFileTool(tmpDir, true)
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"path":  testFile,
+		"patch": patch,
+	})
+
+	if result.IsError {
+		t.Fatalf("Expected success, got error: %s", result.ForLLM)
+	}
+	content, _ := os.ReadFile(testFile)
+	if string(content) != "[main]\nname=pico\nport=8080\ndebug=false\n" {
+		t.Errorf("Unexpected content after patch: %q", string(content))
+	}
+	if !strings.Contains(result.Preview, "+port=8080") {
+		t.Errorf("Expected preview diff, got: %s", result.Preview)
+	}
+}
+
+// TestEditTool_EditFile_DryRun verifies dry_run returns a diff and leaves the file untouched
+func TestEditTool_EditFile_DryRun(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "test.txt")
+	os.WriteFile(testFile, []byte("Hello World\n"), 0644)
+
+	tool := NewEditFileTool(tmpDir, true)
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"path":     testFile,
+		"old_text": "World",
+		"new_text": "Universe",
+		"dry_run":  true,
+	})
+
+	if result.IsError {
+		t.Fatalf("Expected success, got error: %s", result.ForLLM)
+	}
+	if !strings.Contains(result.ForLLM, "-Hello World") || !strings.Contains(result.ForLLM, "+Hello Universe") {
+		t.Errorf("Expected diff in dry run result, got: %s", result.ForLLM)
+	}
+	content, _ := os.ReadFile(testFile)
+	if string(content) != "Hello World\n" {
+		t.Errorf("Dry run modified the file: %q", string(content))
+	}
+	if summary := tool.ConfirmationSummary(map[string]interface{}{
+		"path": testFile, "old_text": "World", "new_text": "Universe",
+	}); !strings.Contains(summary, "+Hello Universe") {
+		t.Errorf("Expected confirmation summary to be the diff, got: %s", summary)
+	}
+}
+
+// TestUnifiedDiff_RoundTrip verifies generated diffs apply back cleanly
+func TestUnifiedDiff_RoundTrip(t *testing.T) {
+	var oldLines, newLines []string
+	for i := 0; i < 40; i++ {
+		oldLines = append(oldLines, fmt.Sprintf("line %d", i))
+		switch {
+		case i == 5:
+			newLines = append(newLines, "changed 5")
+		case i == 20:
+			// deleted
+		case i == 30:
+			newLines = append(newLines, "line 30", "inserted")
+		default:
+			newLines = append(newLines, fmt.Sprintf("line %d", i))
+		}
+	}
+	oldContent := strings.Join(oldLines, "\n") + "\n"
+	newContent := strings.Join(newLines, "\n") + "\n"
+
+	diff := unifiedDiff("f.txt", oldContent, newContent)
+	if strings.Count(diff, "@@ -") != 3 {
+		t.Errorf("Expected 3 hunks, got diff:\n%s", diff)
+	}
+
+	got, err := applyUnifiedDiff(oldContent, diff)
+	if err != nil {
+		t.Fatalf("applyUnifiedDiff failed: %v\n%s", err, diff)
+	}
+	if got != newContent {
+		t.Errorf("Round trip mismatch.\nGot:\n%s\nWant:\n%s", got, newContent)
+	}
+}
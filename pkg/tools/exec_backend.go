@@ -0,0 +1,153 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// ExecBackend decides where the exec tool runs a shell command.
+type ExecBackend interface {
+	// Command returns the process that runs command in cwd with env
+	// ("NAME=value" entries; nil inherits picoclaw's environment), and a
+	// cleanup function to call if the process is cut short (timeout or cancel).
+	Command(ctx context.Context, command, cwd string, env []string) (*exec.Cmd, func(), error)
+	// Sandboxed reports whether commands are isolated from the host. Host
+	// path checks are skipped for sandboxed backends since the command can
+	// only see the workspace.
+	Sandboxed() bool
+	// Describe returns a note for the tool description, or "".
+	Describe() string
+}
+
+// HostBackend runs commands directly on the host with sh (or PowerShell on
+// Windows).
+type HostBackend struct{}
+
+func (HostBackend) Command(ctx context.Context, command, cwd string, env []string) (*exec.Cmd, func(), error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "powershell", "-NoProfile", "-NonInteractive", "-Command", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	if cwd != "" {
+		cmd.Dir = cwd
+	}
+	cmd.Env = env
+	return cmd, func() {}, nil
+}
+
+func (HostBackend) Sandboxed() bool  { return false }
+func (HostBackend) Describe() string { return "" }
+
+// containerWorkspace is where the workspace is mounted inside the container.
+const containerWorkspace = "/workspace"
+
+// ContainerBackend runs every command in a disposable Docker or Podman
+// container. Only the workspace is mounted (read-write), the network is off
+// unless enabled, and the container has no capabilities.
+type ContainerBackend struct {
+	Runtime   string // "docker" or "podman"
+	Image     string
+	Workspace string // host directory mounted at /workspace
+	Network   bool
+	Memory    string // e.g. "512m"; empty for no limit
+	CPUs      string // e.g. "1"; empty for no limit
+}
+
+func NewContainerBackend(runtime, image, workspace string) *ContainerBackend {
+	return &ContainerBackend{
+		Runtime:   runtime,
+		Image:     image,
+		Workspace: workspace,
+	}
+}
+
+// The container starts with the image's environment; only the variables in
+// env are passed in.
+func (b *ContainerBackend) Command(ctx context.Context, command, cwd string, env []string) (*exec.Cmd, func(), error) {
+	bin, err := exec.LookPath(b.Runtime)
+	if err != nil {
+		// Fail closed rather than falling back to the host
+		return nil, nil, fmt.Errorf("container runtime %q not found: %w", b.Runtime, err)
+	}
+	workdir, err := b.containerPath(cwd)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	name := "picoclaw-exec-" + uuid.NewString()[:8]
+	args := []string{
+		"run", "--rm", "-i", "--name", name,
+		"--cap-drop", "ALL",
+		"--security-opt", "no-new-privileges",
+		"--pids-limit", "256",
+		"-v", b.Workspace + ":" + containerWorkspace + ":rw",
+		"-w", workdir,
+	}
+	if !b.Network {
+		args = append(args, "--network", "none")
+	}
+	if b.Memory != "" {
+		args = append(args, "--memory", b.Memory)
+	}
+	if b.CPUs != "" {
+		args = append(args, "--cpus", b.CPUs)
+	}
+	if runtime.GOOS == "linux" {
+		// Files created in the workspace stay owned by the user
+		args = append(args, "--user", fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()))
+	}
+	for _, kv := range env {
+		// Values stay out of the command line, where ps would show them
+		name, _, _ := strings.Cut(kv, "=")
+		args = append(args, "-e", name)
+	}
+	args = append(args, b.Image, "sh", "-c", command)
+
+	cmd := exec.CommandContext(ctx, bin, args...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	cleanup := func() {
+		// Killing the client does not stop the container
+		exec.Command(bin, "rm", "-f", name).Run()
+	}
+	return cmd, cleanup, nil
+}
+
+// containerPath maps a host directory inside the workspace to its path in
+// the container.
+func (b *ContainerBackend) containerPath(cwd string) (string, error) {
+	if cwd == "" {
+		return containerWorkspace, nil
+	}
+	if cwd == containerWorkspace || strings.HasPrefix(cwd, containerWorkspace+"/") {
+		// Already a container path, as the model sees it
+		return path.Clean(cwd), nil
+	}
+	rel, err := filepath.Rel(b.Workspace, cwd)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("working directory %s is outside the workspace, which is all the container can see", cwd)
+	}
+	return path.Join(containerWorkspace, filepath.ToSlash(rel)), nil
+}
+
+func (b *ContainerBackend) Sandboxed() bool { return true }
+
+func (b *ContainerBackend) Describe() string {
+	network := "no network access"
+	if b.Network {
+		network = "network access"
+	}
+	return fmt.Sprintf("Commands run in a disposable %s container (%s) with %s; the workspace is mounted at %s and nothing else on the host is visible.",
+		b.Runtime, b.Image, network, containerWorkspace)
+}
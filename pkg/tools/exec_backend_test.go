@@ -0,0 +1,84 @@
+package tools
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestContainerBackend_Args verifies the container is isolated and runs the
+// command in the mapped working directory.
+func TestContainerBackend_Args(t *testing.T) {
+	workspace := t.TempDir()
+	// Any binary on PATH stands in for docker; the command is never run
+	b := NewContainerBackend("sh", "alpine:3.20", workspace)
+	b.Memory = "256m"
+
+	cmd, cleanup, err := b.Command(context.Background(), "ls", filepath.Join(workspace, "src"), nil)
+	if err != nil {
+		t.Fatalf("Command failed: %v", err)
+	}
+	if cleanup == nil {
+		t.Fatal("Expected a cleanup function")
+	}
+
+	args := strings.Join(cmd.Args[1:], " ")
+	for _, want := range []string{
+		"run --rm",
+		"--network none",
+		"--cap-drop ALL",
+		"--memory 256m",
+		"-v " + workspace + ":/workspace:rw",
+		"-w /workspace/src",
+		"alpine:3.20 sh -c ls",
+	} {
+		if !strings.Contains(args, want) {
+			t.Errorf("Expected args to contain %q, got %s", want, args)
+		}
+	}
+	if slices.Contains(cmd.Args, "--cpus") {
+		t.Errorf("Expected no CPU limit, got %s", args)
+	}
+}
+
+// TestContainerBackend_Network verifies network access can be enabled.
+func TestContainerBackend_Network(t *testing.T) {
+	b := NewContainerBackend("sh", "alpine:3.20", t.TempDir())
+	b.Network = true
+
+	cmd, _, err := b.Command(context.Background(), "true", "", nil)
+	if err != nil {
+		t.Fatalf("Command failed: %v", err)
+	}
+	if slices.Contains(cmd.Args, "none") {
+		t.Errorf("Expected network to be enabled, got %v", cmd.Args)
+	}
+}
+
+// TestContainerBackend_OutsideWorkspace verifies working directories the
+// container cannot see are rejected.
+func TestContainerBackend_OutsideWorkspace(t *testing.T) {
+	b := NewContainerBackend("sh", "alpine:3.20", t.TempDir())
+
+	if _, _, err := b.Command(context.Background(), "ls", "/etc", nil); err == nil {
+		t.Error("Expected error for working directory outside the workspace")
+	}
+}
+
+// TestContainerBackend_MissingRuntime verifies a missing runtime fails the
+// command instead of running it on the host.
+func TestContainerBackend_MissingRuntime(t *testing.T) {
+	b := NewContainerBackend("picoclaw-no-such-runtime", "alpine:3.20", t.TempDir())
+
+	tool := NewExecTool(b.Workspace, true)
+	tool.SetBackend(b)
+	result := tool.Execute(context.Background(), map[string]interface{}{"command": "echo hi"})
+	if !result.IsError {
+		t.Fatalf("Expected error, got %s", result.ForLLM)
+	}
+	if !strings.Contains(result.ForLLM, "not found") {
+		t.Errorf("Expected runtime not found error, got %s", result.ForLLM)
+	}
+}
@@ -0,0 +1,140 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// EnvPolicy decides which of picoclaw's environment variables commands run
+// by the exec tool inherit. Patterns are shell globs on the variable name,
+// e.g. "LC_*" or "*_TOKEN".
+type EnvPolicy struct {
+	Inherit []string // names passed through; empty passes everything
+	Deny    []string // names never passed through, even if inherited
+}
+
+// Filter returns the entries of environ ("NAME=value") the policy lets through.
+func (p *EnvPolicy) Filter(environ []string) []string {
+	kept := make([]string, 0, len(environ))
+	for _, kv := range environ {
+		name, _, _ := strings.Cut(kv, "=")
+		if p.Allows(name) {
+			kept = append(kept, kv)
+		}
+	}
+	return kept
+}
+
+// Allows reports whether the variable name is inherited.
+func (p *EnvPolicy) Allows(name string) bool {
+	if matchEnvPatterns(p.Deny, name) {
+		return false
+	}
+	return len(p.Inherit) == 0 || matchEnvPatterns(p.Inherit, name)
+}
+
+// inheritedEnv returns picoclaw's environment as policy lets it through to
+// a command, or all of it without a policy.
+func inheritedEnv(policy *EnvPolicy) []string {
+	env := os.Environ()
+	if policy != nil {
+		env = policy.Filter(env)
+	}
+	return env
+}
+
+func matchEnvPatterns(patterns []string, name string) bool {
+	if runtime.GOOS == "windows" {
+		// Variable names are case-insensitive on Windows
+		name = strings.ToUpper(name)
+	}
+	for _, pattern := range patterns {
+		if runtime.GOOS == "windows" {
+			pattern = strings.ToUpper(pattern)
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// SecretVault holds secrets the model may inject into a single command by
+// name, without ever seeing their values. It is a JSON object of name to
+// value, read on every use so edits take effect without a restart.
+type SecretVault struct {
+	path string
+}
+
+func NewSecretVault(path string) *SecretVault {
+	return &SecretVault{path: path}
+}
+
+func (v *SecretVault) load() (map[string]string, error) {
+	data, err := os.ReadFile(v.path)
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var secrets map[string]string
+	if err := json.Unmarshal(data, &secrets); err != nil {
+		return nil, fmt.Errorf("invalid secrets file %s: %w", v.path, err)
+	}
+	return secrets, nil
+}
+
+// Names returns the names of the stored secrets, sorted.
+func (v *SecretVault) Names() []string {
+	secrets, err := v.load()
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(secrets))
+	for name := range secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Lookup returns the named secrets, or an error naming any that are missing.
+func (v *SecretVault) Lookup(names []string) (map[string]string, error) {
+	secrets, err := v.load()
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]string, len(names))
+	var missing []string
+	for _, name := range names {
+		value, ok := secrets[name]
+		if !ok {
+			missing = append(missing, name)
+			continue
+		}
+		found[name] = value
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("unknown secrets: %s", strings.Join(missing, ", "))
+	}
+	return found, nil
+}
+
+// redactSecrets replaces secret values in command output with their names,
+// so a command that echoes a token does not hand it to the model.
+func redactSecrets(output string, secrets map[string]string) string {
+	for name, value := range secrets {
+		if len(value) < 4 {
+			// Too short to replace without mangling unrelated output
+			continue
+		}
+		output = strings.ReplaceAll(output, value, "[secret:"+name+"]")
+	}
+	return output
+}
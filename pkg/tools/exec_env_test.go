@@ -0,0 +1,65 @@
+//go:build !windows
+
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestEnvPolicy_Filter verifies only inherited variables pass and the
+// denylist wins over the inherit list.
+func TestEnvPolicy_Filter(t *testing.T) {
+	policy := &EnvPolicy{
+		Inherit: []string{"PATH", "LC_*", "GITHUB_TOKEN"},
+		Deny:    []string{"*_TOKEN"},
+	}
+	got := policy.Filter([]string{"PATH=/bin", "LC_ALL=C", "GITHUB_TOKEN=x", "HOME=/root"})
+	if strings.Join(got, " ") != "PATH=/bin LC_ALL=C" {
+		t.Errorf("Expected PATH and LC_ALL only, got %v", got)
+	}
+
+	open := &EnvPolicy{Deny: []string{"AWS_*"}}
+	if !open.Allows("HOME") || open.Allows("AWS_SECRET_ACCESS_KEY") {
+		t.Error("Expected an empty inherit list to pass everything but denied names")
+	}
+}
+
+// TestExecTool_EnvPolicyAndSecrets verifies commands do not inherit denied
+// variables, get requested secrets, and have secret values redacted.
+func TestExecTool_EnvPolicyAndSecrets(t *testing.T) {
+	t.Setenv("PICOCLAW_TEST_TOKEN", "inherited-value")
+	vaultPath := filepath.Join(t.TempDir(), "secrets.json")
+	os.WriteFile(vaultPath, []byte(`{"DEPLOY_KEY": "s3cr3t-value"}`), 0600)
+
+	tool := NewExecTool("", false)
+	tool.SetEnvPolicy(&EnvPolicy{Deny: []string{"*_TOKEN"}})
+	tool.SetSecretVault(NewSecretVault(vaultPath))
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"command": `echo "token=$PICOCLAW_TEST_TOKEN key=$DEPLOY_KEY"`,
+		"secrets": []interface{}{"DEPLOY_KEY"},
+	})
+	if result.IsError {
+		t.Fatalf("Expected success, got %s", result.ForLLM)
+	}
+	if !strings.Contains(result.ForLLM, "token= key=[secret:DEPLOY_KEY]") {
+		t.Errorf("Expected denied variable unset and secret redacted, got %s", result.ForLLM)
+	}
+
+	result = tool.Execute(context.Background(), map[string]interface{}{
+		"command": "true",
+		"secrets": []interface{}{"MISSING"},
+	})
+	if !result.IsError || !strings.Contains(result.ForLLM, "MISSING") {
+		t.Errorf("Expected unknown secret error, got %s", result.ForLLM)
+	}
+
+	summary := tool.ConfirmationSummary(map[string]interface{}{"command": "deploy", "secrets": []interface{}{"DEPLOY_KEY"}})
+	if !strings.Contains(summary, "with secrets: DEPLOY_KEY") {
+		t.Errorf("Expected secrets in confirmation summary, got %s", summary)
+	}
+}
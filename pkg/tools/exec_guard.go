@@ -0,0 +1,889 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/sandbox/pathguard"
+)
+
+// Guard rule severities.
+const (
+	GuardBlock   = "block"   // the command is refused
+	GuardConfirm = "confirm" // the user is asked before the command runs
+	GuardOff     = "off"     // the rule is disabled
+)
+
+// GuardRule is a named deny rule of the exec safety guard. The built-in
+// rules are checks on the parsed command; a configured rule has a Pattern, a
+// regular expression matched case-insensitively against each command the
+// line would run, from its name and with wrappers such as sudo removed, so
+// `\bgit\s+push\b` sees `sudo git push` but not `echo git push`. Safer, if
+// set, describes how to get the same result without tripping the rule.
+type GuardRule struct {
+	Name     string `json:"name"`
+	Pattern  string `json:"pattern,omitempty"`
+	Reason   string `json:"reason"`
+	Severity string `json:"severity"` // GuardBlock (the default), GuardConfirm or GuardOff
+	Safer    string `json:"safer,omitempty"`
+}
+
+// DefaultGuardRules block destructive commands unless the config changes them.
+var DefaultGuardRules = []GuardRule{
+	{Name: "rm-recursive", Reason: "recursive or forced delete",
+		Safer: "delete the specific files by name with plain rm, or move them into a trash directory inside the workspace"},
+	{Name: "windows-del", Reason: "forced or quiet delete",
+		Safer: "delete the specific files by name with plain del"},
+	{Name: "windows-rmdir", Reason: "recursive directory delete",
+		Safer: "delete the files by name first, then remove the empty directory with plain rmdir"},
+	{Name: "disk-format", Reason: "formats a disk"},
+	{Name: "dd", Reason: "raw disk copy",
+		Safer: "copy files with cp, or use head -c to read a few bytes"},
+	{Name: "disk-write", Reason: "writes to a disk device"},
+	{Name: "shutdown", Reason: "shuts down or reboots the machine"},
+	{Name: "fork-bomb", Reason: "fork bomb"},
+	{Name: "pipe-to-shell", Reason: "runs piped-in code without inspecting it",
+		Safer: "download the script to a file first (curl -fsSL -o script.sh URL), read it with cat or head and check what it does, then run it with sh script.sh as a separate command"},
+	{Name: "eval", Reason: "evaluates generated code",
+		Safer: "run the command directly, with its arguments written out, instead of through eval"},
+	{Name: "xargs-rm", Reason: "deletes a generated list of files",
+		Safer: "list the files first, then delete the ones that should go by name with plain rm"},
+	{Name: "find-delete", Reason: "deletes every file find matches",
+		Safer: "run find without -delete to list the files, then delete the ones that should go by name with plain rm"},
+}
+
+// guardChecks are the built-in rules by name. Each returns the part of the
+// command that matched, or "".
+var guardChecks = map[string]func(c *guardCall) string{
+	"rm-recursive": func(c *guardCall) string {
+		return c.matchIf(c.name == "rm" && c.hasFlag("r", "f", "recursive", "force"))
+	},
+	"windows-del": func(c *guardCall) string {
+		return c.matchIf((c.name == "del" || c.name == "erase") && c.hasSwitch("/f", "/q"))
+	},
+	"windows-rmdir": func(c *guardCall) string {
+		return c.matchIf((c.name == "rmdir" || c.name == "rd") && c.hasSwitch("/s"))
+	},
+	"disk-format": func(c *guardCall) string {
+		return c.matchIf(c.name == "format" || c.name == "diskpart" || c.name == "mkfs" || strings.HasPrefix(c.name, "mkfs."))
+	},
+	"dd": func(c *guardCall) string {
+		return c.matchIf(c.name == "dd" && c.hasArgPrefix("if="))
+	},
+	"disk-write": func(c *guardCall) string {
+		for _, r := range c.cmd.redirects {
+			if strings.Contains(r.op, ">") && diskDevicePattern.MatchString(r.target.text) {
+				return r.op + " " + r.target.text
+			}
+		}
+		return ""
+	},
+	"shutdown": func(c *guardCall) string {
+		if powerCommands[c.name] {
+			return c.line
+		}
+		return c.matchIf(c.name == "systemctl" && len(c.args) > 0 && powerCommands[c.args[0]])
+	},
+	"fork-bomb": func(c *guardCall) string {
+		// A function piping into itself
+		return c.matchIf(c.functions[c.name] && c.pipedFrom == c.name)
+	},
+	"pipe-to-shell": func(c *guardCall) string {
+		if c.readsCode() {
+			return c.pipeline.String()
+		}
+		return ""
+	},
+	"eval": func(c *guardCall) string {
+		return c.matchIf(c.name == "eval")
+	},
+	"xargs-rm": func(c *guardCall) string {
+		return c.matchIf(c.name == "rm" && c.wrappedBy("xargs"))
+	},
+	"find-delete": func(c *guardCall) string {
+		if c.name != "find" {
+			return ""
+		}
+		for i, arg := range c.args {
+			switch arg {
+			case "-delete":
+				return c.line
+			case "-exec", "-execdir", "-ok", "-okdir":
+				if i+1 < len(c.args) && path.Base(c.args[i+1]) == "rm" {
+					return c.line
+				}
+			}
+		}
+		return ""
+	},
+}
+
+var diskDevicePattern = regexp.MustCompile(`^/dev/(sd[a-z]|nvme\d+n\d+|vd[a-z]|hd[a-z]|mmcblk\d+)`)
+
+// powerCommands shut down or restart the machine, also as systemctl verbs.
+var powerCommands = map[string]bool{
+	"shutdown": true, "reboot": true, "poweroff": true, "halt": true,
+}
+
+// guardRule is a GuardRule with its pattern compiled, or its built-in check.
+type guardRule struct {
+	GuardRule
+	pattern *regexp.Regexp
+	check   func(c *guardCall) string
+}
+
+// match returns the part of c the rule matches, or "".
+func (r *guardRule) match(c *guardCall) string {
+	if r.check != nil {
+		return r.check(c)
+	}
+	return r.pattern.FindString(c.line)
+}
+
+var defaultGuardRules = mustCompileGuardRules(DefaultGuardRules)
+
+func mustCompileGuardRules(rules []GuardRule) []guardRule {
+	compiled, err := compileGuardRules(rules)
+	if err != nil {
+		panic(err)
+	}
+	return compiled
+}
+
+// compileGuardRules compiles the enabled rules in rules. A pattern set on a
+// built-in rule replaces its check.
+func compileGuardRules(rules []GuardRule) ([]guardRule, error) {
+	compiled := make([]guardRule, 0, len(rules))
+	for _, rule := range rules {
+		switch rule.Severity {
+		case "":
+			rule.Severity = GuardBlock
+		case GuardBlock, GuardConfirm:
+		case GuardOff:
+			continue
+		default:
+			return nil, fmt.Errorf("guard rule %q: unknown severity %q", rule.Name, rule.Severity)
+		}
+		if rule.Name == "" {
+			return nil, fmt.Errorf("guard rule with pattern %q has no name", rule.Pattern)
+		}
+		if rule.Pattern == "" {
+			check, ok := guardChecks[rule.Name]
+			if !ok {
+				return nil, fmt.Errorf("guard rule %q has no pattern", rule.Name)
+			}
+			compiled = append(compiled, guardRule{GuardRule: rule, check: check})
+			continue
+		}
+		// Anchored at the command name, so arguments that merely mention
+		// a command do not match
+		re, err := regexp.Compile("(?i)^(?:" + rule.Pattern + ")")
+		if err != nil {
+			return nil, fmt.Errorf("guard rule %q: %w", rule.Name, err)
+		}
+		compiled = append(compiled, guardRule{GuardRule: rule, pattern: re})
+	}
+	return compiled, nil
+}
+
+// MergeGuardRules applies configured rules to the defaults. A rule named
+// like a default one changes it (empty fields keep the default's), so
+// {"name": "eval", "severity": "confirm"} only softens eval; other rules
+// are added.
+func MergeGuardRules(defaults, configured []GuardRule) []GuardRule {
+	merged := append([]GuardRule(nil), defaults...)
+	for _, rule := range configured {
+		i := indexGuardRule(merged, rule.Name)
+		if i < 0 {
+			merged = append(merged, rule)
+			continue
+		}
+		if rule.Pattern != "" {
+			merged[i].Pattern = rule.Pattern
+		}
+		if rule.Reason != "" {
+			merged[i].Reason = rule.Reason
+		}
+		if rule.Severity != "" {
+			merged[i].Severity = rule.Severity
+		}
+		if rule.Safer != "" {
+			merged[i].Safer = rule.Safer
+		}
+	}
+	return merged
+}
+
+func indexGuardRule(rules []GuardRule, name string) int {
+	for i, rule := range rules {
+		if rule.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// SetGuardRules replaces the deny rules, e.g. with
+// MergeGuardRules(DefaultGuardRules, configured). On error the current rules
+// are kept.
+func (t *ExecTool) SetGuardRules(rules []GuardRule) error {
+	compiled, err := compileGuardRules(rules)
+	if err != nil {
+		return err
+	}
+	t.guardMu.Lock()
+	t.denyRules = compiled
+	t.guardMu.Unlock()
+	return nil
+}
+
+// GuardRules returns the enabled deny rules.
+func (t *ExecTool) GuardRules() []GuardRule {
+	t.guardMu.RLock()
+	defer t.guardMu.RUnlock()
+	rules := make([]GuardRule, len(t.denyRules))
+	for i, rule := range t.denyRules {
+		rules[i] = rule.GuardRule
+	}
+	return rules
+}
+
+// saferAlternatives covers the guard's built-in checks that are not deny rules.
+var saferAlternatives = map[string]string{
+	"unparsable":             "fix the quoting so the command parses, or split it into simpler commands",
+	"dynamic-command":        "write the command name out literally instead of taking it from a variable or substitution",
+	"allowlist":              "use only commands the allowlist permits",
+	"path-traversal":         "use paths inside the working directory, without ..",
+	"path-outside-workspace": "copy what you need into the workspace, or work with paths inside it",
+}
+
+// guardBlock says why the safety guard blocked a command.
+type guardBlock struct {
+	Rule     string // rule name, e.g. "rm-recursive" or "path-outside-workspace"
+	Reason   string // what the rule protects against
+	Match    string // the part of the command that triggered it, if any
+	Safer    string // how to do the same thing safely; empty if there is no safe way
+	Severity string // GuardBlock, or GuardConfirm if the user may let it run
+}
+
+func (b *guardBlock) Error() string {
+	msg := fmt.Sprintf("Command blocked by safety guard (rule %s: %s)", b.Rule, b.Reason)
+	if b.Match != "" {
+		msg += fmt.Sprintf("; matched: %s", b.Match)
+	}
+	return msg
+}
+
+// GuardFeedback is the structured form of a guard block, for the agent to
+// turn into a request for a safer command.
+type GuardFeedback struct {
+	Command  string `json:"command"`
+	Rule     string `json:"rule"`
+	Reason   string `json:"reason"`
+	Match    string `json:"match,omitempty"`
+	Safer    string `json:"safer,omitempty"`
+	Severity string `json:"severity"`
+}
+
+// Feedback describes the block of command.
+func (b *guardBlock) Feedback(command string) *GuardFeedback {
+	safer := b.Safer
+	if safer == "" {
+		safer = saferAlternatives[b.Rule]
+	}
+	severity := b.Severity
+	if severity == "" {
+		severity = GuardBlock
+	}
+	return &GuardFeedback{
+		Command:  command,
+		Rule:     b.Rule,
+		Reason:   b.Reason,
+		Match:    b.Match,
+		Safer:    safer,
+		Severity: severity,
+	}
+}
+
+// CheckCommand evaluates command against the guard as if it were run in
+// the working directory, and returns why it would be stopped, or nil.
+func (t *ExecTool) CheckCommand(command string) *GuardFeedback {
+	block := t.guardCommand(command, t.workingDir)
+	if block == nil {
+		return nil
+	}
+	return block.Feedback(command)
+}
+
+// SetAuditLog records guard blocks and overrides in log.
+func (t *ExecTool) SetAuditLog(log *AuditLog) {
+	t.audit = log
+}
+
+// SetGuardApprover sets who is asked about commands matching a confirm
+// rule and, if overrides are allowed, blocked commands. Without one, both
+// are refused.
+func (t *ExecTool) SetGuardApprover(approver Approver) {
+	t.guardApprover = approver
+}
+
+// SetGuardOverride lets the model ask, with override_guard, to run a
+// blocked command once; the guard approver puts the request to the user.
+func (t *ExecTool) SetGuardOverride(allow bool) {
+	t.guardMu.Lock()
+	t.allowOverride = allow
+	t.guardMu.Unlock()
+}
+
+func (t *ExecTool) overridesEnabled() bool {
+	t.guardMu.RLock()
+	defer t.guardMu.RUnlock()
+	return t.allowOverride && t.guardApprover != nil
+}
+
+// SetContext records the chat the current call comes from, for override
+// prompts and the audit log.
+func (t *ExecTool) SetContext(channel, chatID string) {
+	t.channel = channel
+	t.chatID = chatID
+}
+
+// checkGuard runs the safety guard and returns an error result if the
+// command may not run. A command matching a confirm rule runs if the user
+// confirms it; a blocked one runs anyway if the call sets override_guard and
+// the user approves it. Blocks, confirmations and overrides are audited.
+func (t *ExecTool) checkGuard(ctx context.Context, command, cwd string, args map[string]interface{}) *ToolResult {
+	block := t.guardCommand(command, cwd)
+	if block == nil {
+		return nil
+	}
+	event := AuditEvent{
+		Event:   AuditGuardBlock,
+		Tool:    "exec",
+		Command: command,
+		Rule:    block.Rule,
+		Reason:  block.Reason,
+		Channel: t.channel,
+		ChatID:  t.chatID,
+	}
+
+	if block.Severity == GuardConfirm {
+		return t.askGuard(ctx, command, block, event, args,
+			fmt.Sprintf("%s\n\n⚠️ Matches safety rule %s (%s).", command, block.Rule, block.Reason),
+			AuditGuardConfirmed, AuditGuardConfirmDenied, "the user did not confirm it")
+	}
+
+	override, _ := args["override_guard"].(bool)
+	if !override || !t.overridesEnabled() {
+		t.audit.Record(event)
+		msg := block.Error()
+		if t.overridesEnabled() {
+			msg += ". If the user needs exactly this command, call exec again with override_guard set to true and an override_reason; the user will be asked to approve it."
+		}
+		return ErrorResult(msg).WithGuard(block.Feedback(command))
+	}
+
+	reason, _ := args["override_reason"].(string)
+	event.Detail = reason
+	return t.askGuard(ctx, command, block, event, args,
+		fmt.Sprintf("%s\n\n⛔ Blocked by safety rule %s (%s).\nReason given: %s", command, block.Rule, block.Reason, reason),
+		AuditGuardOverride, AuditGuardOverrideDenied, "the user denied the override")
+}
+
+// askGuard asks the user whether command, stopped by block, may run, and
+// audits the answer as approved or denied.
+func (t *ExecTool) askGuard(ctx context.Context, command string, block *guardBlock, event AuditEvent, args map[string]interface{},
+	summary, approved, denied, deniedMsg string) *ToolResult {
+	if t.guardApprover == nil {
+		t.audit.Record(event)
+		return ErrorResult(block.Error() + "; nobody can be asked to confirm it").WithGuard(block.Feedback(command))
+	}
+	decision, err := t.guardApprover(ctx, ApprovalRequest{
+		Tool:    "exec",
+		Args:    args,
+		Summary: summary,
+		Channel: t.channel,
+		ChatID:  t.chatID,
+	})
+	// "Always" approves this one command; guard rules are changed in the config
+	if err != nil || decision == ApprovalDeny {
+		event.Event = denied
+		t.audit.Record(event)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("%s; not approved: %v", block.Error(), err)).
+				WithError(err).WithGuard(block.Feedback(command))
+		}
+		return ErrorResult(block.Error() + "; " + deniedMsg).WithGuard(block.Feedback(command))
+	}
+	event.Event = approved
+	t.audit.Record(event)
+	logger.WarnCF("tool", "User let a guarded command run",
+		map[string]interface{}{
+			"rule":    block.Rule,
+			"event":   approved,
+			"command": command,
+		})
+	return nil
+}
+
+// guardCommand checks command against the deny and allow rules and the
+// workspace restriction, and returns why it is blocked, or nil. Rules are
+// matched against every command the parsed line would run, with quoting
+// removed and wrappers such as sudo, env and xargs stripped, so
+// obfuscations such as `"r"m`, `$(rm -rf /)` or `bash <(curl ...)` are
+// caught while `echo 'rm -rf /'` is not.
+func (t *ExecTool) guardCommand(command, cwd string) *guardBlock {
+	t.guardMu.RLock()
+	denyRules, allowPatterns := t.denyRules, t.allowPatterns
+	t.guardMu.RUnlock()
+
+	cmd := strings.TrimSpace(command)
+
+	script, err := parseShell(cmd)
+	if err != nil {
+		return &guardBlock{Rule: "unparsable", Reason: fmt.Sprintf("could not parse command: %v", err)}
+	}
+
+	calls := guardCalls(script)
+	for _, c := range calls {
+		if c.words[0].dynamic() {
+			return &guardBlock{Rule: "dynamic-command", Reason: "command name comes from a variable or substitution", Match: c.cmd.String()}
+		}
+	}
+
+	// A confirm rule only applies if no block rule or other check matches
+	var confirm *guardBlock
+	for i := range denyRules {
+		rule := &denyRules[i]
+		for _, c := range calls {
+			m := rule.match(c)
+			if m == "" {
+				continue
+			}
+			block := &guardBlock{Rule: rule.Name, Reason: rule.Reason, Match: m, Safer: rule.Safer, Severity: rule.Severity}
+			if rule.Severity != GuardConfirm {
+				return block
+			}
+			if confirm == nil {
+				confirm = block
+			}
+			break
+		}
+	}
+
+	if len(allowPatterns) > 0 {
+		// Every command in the line must be allowed, not just the first
+		for _, c := range script.simpleCommands() {
+			if !matchesAny(allowPatterns, strings.ToLower(c.String())) {
+				return &guardBlock{Rule: "allowlist", Reason: "not in allowlist", Match: c.name()}
+			}
+		}
+	}
+
+	// A sandboxed backend only sees the workspace, so host paths are moot
+	if t.restrictToWorkspace && !t.backend.Sandboxed() {
+		if block := t.guardPaths(cmd, cwd, script); block != nil {
+			return block
+		}
+	}
+	return confirm
+}
+
+// guardCall is a command as the guard rules see it: the command a simple
+// command runs once wrappers such as sudo, env and xargs are stripped, with
+// its name and arguments lower-cased.
+type guardCall struct {
+	cmd       *shellCommand
+	pipeline  *shellPipeline
+	words     []shellWord // the wrapped command, name first
+	wrappers  []string    // e.g. sudo, xargs
+	name      string      // without its directory, e.g. rm for /bin/rm
+	args      []string
+	flags     map[string]bool // short flags split up (-rf is r and f), long ones without dashes
+	line      string          // name and arguments, e.g. "rm -rf /"
+	pipedFrom string          // name of the command piped into this one, if any
+	functions map[string]bool // functions the script defines
+}
+
+// guardWrappers run the command in their arguments. Each lists its flags
+// that take a separate value.
+var guardWrappers = map[string]struct {
+	short string
+	long  []string
+}{
+	"sudo":    {"CDghpRrTtUu", []string{"chdir", "close-from", "group", "host", "other-user", "prompt", "role", "type", "command-timeout", "user"}},
+	"doas":    {"Cu", nil},
+	"env":     {"CSu", []string{"chdir", "split-string", "unset"}},
+	"command": {"", nil},
+	"builtin": {"", nil},
+	"exec":    {"a", nil},
+	"nohup":   {"", nil},
+	"nice":    {"n", []string{"adjustment"}},
+	"timeout": {"ks", []string{"kill-after", "signal"}},
+	"stdbuf":  {"eio", []string{"error", "input", "output"}},
+	"xargs":   {"adEILnPs", []string{"arg-file", "delimiter", "eof", "max-args", "max-chars", "max-lines", "max-procs", "process-slot-var", "replace"}},
+}
+
+// guardCalls returns the commands the script would run, including nested
+// ones.
+func guardCalls(script *shellScript) []*guardCall {
+	functions := make(map[string]bool)
+	script.walk(func(p *shellPipeline) {
+		for _, c := range p.commands {
+			if c.defines {
+				functions[c.name()] = true
+			} else if c.name() == "function" && len(c.words) > 1 {
+				functions[strings.TrimSuffix(c.words[1].text, "()")] = true
+			}
+		}
+	})
+
+	var calls []*guardCall
+	script.walk(func(p *shellPipeline) {
+		// "?" stands for a stage that is not a plain command, e.g. a subshell
+		pipedFrom := ""
+		for _, c := range p.commands {
+			var call *guardCall
+			if len(c.words) > 0 && !c.defines {
+				call = newGuardCall(c)
+			}
+			if call == nil {
+				pipedFrom = "?"
+				continue
+			}
+			call.pipeline = p
+			call.functions = functions
+			call.pipedFrom = pipedFrom
+			pipedFrom = call.name
+			calls = append(calls, call)
+		}
+	})
+	return calls
+}
+
+// newGuardCall strips the wrappers from c. It returns nil if the wrappers
+// run nothing, as with `command -v rm`.
+func newGuardCall(c *shellCommand) *guardCall {
+	call := &guardCall{cmd: c, words: c.words}
+	for len(call.words) > 0 {
+		name := path.Base(call.words[0].text)
+		wrapper, ok := guardWrappers[name]
+		if !ok {
+			break
+		}
+		rest, split := skipWrapperFlags(call.words[1:], wrapper.short, wrapper.long)
+		switch name {
+		case "command":
+			for _, w := range call.words[1 : len(call.words)-len(rest)] {
+				if strings.ContainsAny(w.text, "vV") {
+					return nil // only describes the command
+				}
+			}
+		case "env":
+			for len(rest) > 0 && strings.Contains(rest[0].text, "=") && !rest[0].dynamic() {
+				rest = rest[1:]
+			}
+			// -S splits its value into the command and its arguments
+			rest = append(split, rest...)
+		case "timeout":
+			if len(rest) > 0 {
+				rest = rest[1:] // the duration
+			}
+		}
+		if len(rest) == 0 {
+			break
+		}
+		call.wrappers = append(call.wrappers, name)
+		call.words = rest
+	}
+	if len(call.words) == 0 {
+		return nil
+	}
+
+	call.name = strings.ToLower(path.Base(call.words[0].text))
+	call.flags = make(map[string]bool)
+	parts := []string{call.name}
+	flagsDone := false
+	for _, w := range call.words[1:] {
+		arg := strings.ToLower(w.text)
+		call.args = append(call.args, arg)
+		if arg != "" {
+			parts = append(parts, arg)
+		}
+		switch {
+		case flagsDone:
+		case arg == "--":
+			flagsDone = true
+		case strings.HasPrefix(arg, "--"):
+			name, _, _ := strings.Cut(arg[2:], "=")
+			call.flags[name] = true
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			for _, f := range arg[1:] {
+				call.flags[string(f)] = true
+			}
+		}
+	}
+	call.line = strings.Join(parts, " ")
+	return call
+}
+
+// skipWrapperFlags returns the words after a wrapper's flags, and the words
+// of an env -S value.
+func skipWrapperFlags(words []shellWord, short string, long []string) (rest, split []shellWord) {
+	for len(words) > 0 {
+		arg := words[0].text
+		switch {
+		case arg == "--":
+			return words[1:], split
+		case strings.HasPrefix(arg, "--"):
+			name, _, hasValue := strings.Cut(arg[2:], "=")
+			words = words[1:]
+			if !hasValue && slices.Contains(long, name) && len(words) > 0 {
+				if name == "split-string" {
+					split = splitWords(words[0])
+				}
+				words = words[1:]
+			}
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			words = words[1:]
+			for i := 1; i < len(arg); i++ {
+				if !strings.ContainsRune(short, rune(arg[i])) {
+					continue
+				}
+				value := arg[i+1:]
+				if value == "" && len(words) > 0 {
+					value = words[0].text
+					if arg[i] == 'S' {
+						split = splitWords(words[0])
+					}
+					words = words[1:]
+				} else if arg[i] == 'S' {
+					split = splitWords(shellWord{text: value, fixed: true})
+				}
+				break
+			}
+		default:
+			return words, split
+		}
+	}
+	return words, split
+}
+
+// splitWords splits a word on blanks, as env -S does.
+func splitWords(w shellWord) []shellWord {
+	var words []shellWord
+	for _, f := range strings.Fields(w.text) {
+		words = append(words, shellWord{text: f, fixed: true})
+	}
+	return words
+}
+
+// matchIf returns the command line if ok, or "".
+func (c *guardCall) matchIf(ok bool) string {
+	if ok {
+		return c.line
+	}
+	return ""
+}
+
+// hasFlag reports whether the command was given any of flags.
+func (c *guardCall) hasFlag(flags ...string) bool {
+	for _, f := range flags {
+		if c.flags[f] {
+			return true
+		}
+	}
+	return false
+}
+
+// hasSwitch reports whether any argument is one of the Windows switches.
+func (c *guardCall) hasSwitch(switches ...string) bool {
+	for _, arg := range c.args {
+		if slices.Contains(switches, arg) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *guardCall) hasArgPrefix(prefix string) bool {
+	for _, arg := range c.args {
+		if strings.HasPrefix(arg, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *guardCall) wrappedBy(name string) bool {
+	return slices.Contains(c.wrappers, name)
+}
+
+// codeInterpreters run a script given as a file, inline with their code
+// flag, or on standard input.
+var codeInterpreters = map[string]string{
+	"perl": "eE", "ruby": "e", "node": "ep", "nodejs": "ep", "php": "rR", "lua": "e", "deno": "", "bun": "e",
+}
+
+// interpreterCodeFlags returns the flags with which the interpreter named
+// name takes its code inline, and whether it is an interpreter.
+func interpreterCodeFlags(name string) (string, bool) {
+	switch {
+	case shellInterpreters[name], name == "source", name == ".":
+		return "c", true
+	case name == "python" || strings.HasPrefix(name, "python2") || strings.HasPrefix(name, "python3") || name == "pypy" || name == "pypy3":
+		return "cm", true
+	}
+	flags, ok := codeInterpreters[name]
+	return flags, ok
+}
+
+// readsCode reports whether the command is a shell or interpreter whose
+// code comes from another command: piped into it, or given as a command
+// or process substitution (`bash <(curl ...)`, `sh -c "$(curl ...)"`).
+func (c *guardCall) readsCode() bool {
+	codeFlags, ok := interpreterCodeFlags(c.name)
+	if !ok {
+		return false
+	}
+	stdin := c.pipedFrom != ""
+	for _, r := range c.cmd.redirects {
+		if (r.op == "<" || r.op == "<<<") && len(r.target.subs) > 0 {
+			stdin = true
+		}
+	}
+	args := c.words[1:]
+	for i := 0; i < len(args); i++ {
+		arg := args[i].text
+		if arg == "-" || arg == "--" {
+			return stdin
+		}
+		if !strings.HasPrefix(arg, "-") || len(arg) == 1 {
+			// The script file
+			return len(args[i].subs) > 0 || stdin && (arg == "/dev/stdin" || arg == "/dev/fd/0")
+		}
+		if strings.HasPrefix(arg, "--") {
+			continue
+		}
+		if c.name != "source" && c.name != "." && strings.Contains(arg, "s") && shellInterpreters[c.name] {
+			return stdin // sh -s reads the script from standard input
+		}
+		if strings.ContainsAny(arg[1:], codeFlags) {
+			return i+1 < len(args) && len(args[i+1].subs) > 0
+		}
+	}
+	return stdin
+}
+
+// guardPaths blocks paths outside the workspace and shared folders, after
+// following symlinks and junctions.
+func (t *ExecTool) guardPaths(cmd, cwd string, script *shellScript) *guardBlock {
+	// Check for path traversal patterns
+	if strings.Contains(cmd, "..\\") || strings.Contains(cmd, "../") {
+		return &guardBlock{Rule: "path-traversal", Reason: "path traversal detected"}
+	}
+	// Check for URL-encoded path traversal
+	if strings.Contains(cmd, "%2e%2e%2f") || strings.Contains(cmd, "%2e%2e/") ||
+		strings.Contains(cmd, "..%2f") || strings.Contains(cmd, "%2e%2e%5c") {
+		return &guardBlock{Rule: "path-traversal", Reason: "URL-encoded path traversal detected"}
+	}
+	// Check for null byte injection
+	if strings.Contains(cmd, "\x00") || strings.Contains(cmd, "%00") {
+		return &guardBlock{Rule: "null-byte", Reason: "null byte injection detected"}
+	}
+
+	cwdPath, err := filepath.Abs(cwd)
+	if err != nil {
+		return nil
+	}
+	workspace := t.workingDir
+	if workspace == "" {
+		workspace = cwdPath
+	}
+	guard := pathguard.New(append([]string{workspace}, t.sharedFolders...)...)
+	if err := guard.Check(cwdPath); err != nil {
+		return &guardBlock{Rule: "path-outside-workspace", Reason: "working dir outside the workspace", Match: cwd}
+	}
+
+	for _, raw := range guardPathCandidates(cmd, script) {
+		if runtime.GOOS == "windows" {
+			if pathguard.IsDriveRelative(raw) {
+				return &guardBlock{Rule: "path-outside-workspace", Reason: "drive-relative path depends on the drive's current directory", Match: raw}
+			}
+			if pathguard.IsUNC(raw) && !pathguard.IsUNC(cwdPath) {
+				return &guardBlock{Rule: "path-outside-workspace", Reason: "network or device path", Match: raw}
+			}
+		}
+		p := raw
+		if p == "~" || strings.HasPrefix(p, "~/") {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				continue
+			}
+			p = filepath.Join(home, p[1:])
+		}
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(cwdPath, p)
+		}
+		switch guard.Check(p) {
+		case pathguard.ErrOutside:
+			return &guardBlock{Rule: "path-outside-workspace", Reason: "path outside working dir", Match: raw}
+		case pathguard.ErrLink:
+			// A symlink or junction inside the workspace can still lead out of it
+			return &guardBlock{Rule: "path-outside-workspace", Reason: "path leads outside working dir through a link", Match: raw}
+		}
+	}
+	return nil
+}
+
+// guardPathPattern finds absolute paths in a command line: Unix paths,
+// Windows drive paths with either slash, and on Windows UNC paths and
+// drive-relative ones (C:file). A path must start a word, so URLs such as
+// https://... and refs such as origin/main are not mistaken for one.
+var guardPathPattern = regexp.MustCompile(`(?:^|[\s"'=(>])(?:((?:[A-Za-z]:|\\\\)[^\s"'|;&<>()]*)|(/[^\s"'|;&<>()]*))`)
+
+// guardPathCandidates returns the paths in cmd to check: absolute paths
+// anywhere in the line, and the words of the parsed commands that contain a
+// path separator, which may reach outside through a link.
+func guardPathCandidates(cmd string, script *shellScript) []string {
+	var paths []string
+	for _, m := range guardPathPattern.FindAllStringSubmatch(cmd, -1) {
+		switch {
+		case m[1] != "" && runtime.GOOS == "windows":
+			paths = append(paths, m[1])
+		case m[2] != "":
+			paths = append(paths, m[2])
+		}
+	}
+	for _, c := range script.simpleCommands() {
+		for i, w := range c.allWords() {
+			if i == len(c.assigns) || w.dynamic() || w.text == "" {
+				continue // the command name is looked up on PATH
+			}
+			if _, value, ok := strings.Cut(w.text, "="); ok && i < len(c.assigns) {
+				w.text = value
+			}
+			if strings.ContainsAny(w.text, `/\`) && !strings.Contains(w.text, "://") {
+				paths = append(paths, w.text)
+			}
+		}
+	}
+	return paths
+}
+
+func matchesAny(patterns []*regexp.Regexp, s string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,179 @@
+//go:build !windows
+
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readAudit(t *testing.T, path string) []AuditEvent {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read audit log: %v", err)
+	}
+	var events []AuditEvent
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var e AuditEvent
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("Invalid audit line %q: %v", line, err)
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+// fakeShutdown writes a harmless script named shutdown to a new directory
+// and returns the directory, for running a command the shutdown rule guards.
+func fakeShutdown(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "shutdown"), []byte("#!/bin/sh\necho shutdown skipped\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// TestExecTool_GuardNamesRule verifies a block says which rule matched and
+// is recorded in the audit log.
+func TestExecTool_GuardNamesRule(t *testing.T) {
+	auditPath := filepath.Join(t.TempDir(), "audit.jsonl")
+	tool := NewExecTool("", false)
+	tool.SetAuditLog(NewAuditLog(auditPath))
+	tool.SetContext("telegram", "42")
+
+	result := tool.Execute(context.Background(), map[string]interface{}{"command": "rm -rf /tmp/x"})
+	if !result.IsError || !strings.Contains(result.ForLLM, "rule rm-recursive") {
+		t.Fatalf("Expected block naming rm-recursive, got %q", result.ForLLM)
+	}
+	if strings.Contains(result.ForLLM, "override_guard") {
+		t.Errorf("Expected no override hint when overrides are off, got %q", result.ForLLM)
+	}
+
+	events := readAudit(t, auditPath)
+	if len(events) != 1 || events[0].Event != AuditGuardBlock || events[0].Rule != "rm-recursive" || events[0].ChatID != "42" {
+		t.Errorf("Expected one guard_block event for rm-recursive, got %+v", events)
+	}
+}
+
+// TestExecTool_GuardOverride verifies a blocked command runs only when the
+// user approves the override, and both outcomes are audited.
+func TestExecTool_GuardOverride(t *testing.T) {
+	auditPath := filepath.Join(t.TempDir(), "audit.jsonl")
+	tool := NewExecTool(fakeShutdown(t), false)
+	tool.SetAuditLog(NewAuditLog(auditPath))
+	tool.SetContext("telegram", "42")
+
+	decision := ApprovalDeny
+	var asked ApprovalRequest
+	tool.SetGuardApprover(func(ctx context.Context, req ApprovalRequest) (ApprovalDecision, error) {
+		asked = req
+		return decision, nil
+	})
+	tool.SetGuardOverride(true)
+
+	blocked := tool.Execute(context.Background(), map[string]interface{}{"command": "./shutdown now"})
+	if !blocked.IsError || !strings.Contains(blocked.ForLLM, "override_guard") {
+		t.Fatalf("Expected block with override hint, got %q", blocked.ForLLM)
+	}
+
+	args := map[string]interface{}{
+		"command":         "./shutdown now",
+		"override_guard":  true,
+		"override_reason": "printing the word",
+	}
+	denied := tool.Execute(context.Background(), args)
+	if !denied.IsError || !strings.Contains(denied.ForLLM, "denied the override") {
+		t.Errorf("Expected denied override, got %q", denied.ForLLM)
+	}
+	if !strings.Contains(asked.Summary, "shutdown") || !strings.Contains(asked.Summary, "printing the word") {
+		t.Errorf("Expected prompt with rule and reason, got %q", asked.Summary)
+	}
+
+	decision = ApprovalApprove
+	approved := tool.Execute(context.Background(), args)
+	if approved.IsError || !strings.Contains(approved.ForLLM, "shutdown") {
+		t.Errorf("Expected approved command to run, got %q", approved.ForLLM)
+	}
+
+	var kinds []string
+	for _, e := range readAudit(t, auditPath) {
+		kinds = append(kinds, e.Event)
+	}
+	want := "guard_block guard_override_denied guard_override"
+	if strings.Join(kinds, " ") != want {
+		t.Errorf("Expected audit events %q, got %q", want, strings.Join(kinds, " "))
+	}
+}
+
+// TestExecTool_GuardRuleSeverities verifies configured rules change the
+// defaults by name, add new ones, and that confirm rules ask the user.
+func TestExecTool_GuardRuleSeverities(t *testing.T) {
+	auditPath := filepath.Join(t.TempDir(), "audit.jsonl")
+	tool := NewExecTool(fakeShutdown(t), false)
+	tool.SetAuditLog(NewAuditLog(auditPath))
+	err := tool.SetGuardRules(MergeGuardRules(DefaultGuardRules, []GuardRule{
+		{Name: "shutdown", Severity: GuardConfirm},
+		{Name: "eval", Severity: GuardOff},
+		{Name: "git-push", Pattern: `\bgit\s+push\b`, Reason: "publishes commits"},
+	}))
+	if err != nil {
+		t.Fatalf("SetGuardRules failed: %v", err)
+	}
+
+	if fb := tool.CheckCommand("eval echo hi"); fb != nil {
+		t.Errorf("Expected eval rule to be off, got %+v", fb)
+	}
+	if fb := tool.CheckCommand("git push origin main"); fb == nil || fb.Rule != "git-push" || fb.Severity != GuardBlock {
+		t.Errorf("Expected added git-push rule to block, got %+v", fb)
+	}
+	if fb := tool.CheckCommand("sudo -u git git push"); fb == nil || fb.Rule != "git-push" {
+		t.Errorf("Expected git-push rule to see through sudo, got %+v", fb)
+	}
+	if fb := tool.CheckCommand("echo git push"); fb != nil {
+		t.Errorf("Expected pattern not to match an argument, got %+v", fb)
+	}
+	// A block rule wins over a confirm rule in the same command
+	if fb := tool.CheckCommand("shutdown -h now; rm -rf build"); fb == nil || fb.Rule != "rm-recursive" {
+		t.Errorf("Expected rm-recursive to win over confirm rule, got %+v", fb)
+	}
+
+	confirmed := false
+	tool.SetGuardApprover(func(ctx context.Context, req ApprovalRequest) (ApprovalDecision, error) {
+		if !strings.Contains(req.Summary, "safety rule shutdown") {
+			t.Errorf("Expected prompt naming the rule, got %q", req.Summary)
+		}
+		if confirmed {
+			return ApprovalApprove, nil
+		}
+		return ApprovalDeny, nil
+	})
+	args := map[string]interface{}{"command": "./shutdown now"}
+	if result := tool.Execute(context.Background(), args); !result.IsError || !strings.Contains(result.ForLLM, "did not confirm") {
+		t.Errorf("Expected unconfirmed command to be refused, got %q", result.ForLLM)
+	}
+	confirmed = true
+	if result := tool.Execute(context.Background(), args); result.IsError {
+		t.Errorf("Expected confirmed command to run, got %q", result.ForLLM)
+	}
+
+	var kinds []string
+	for _, e := range readAudit(t, auditPath) {
+		kinds = append(kinds, e.Event)
+	}
+	if want := "guard_confirm_denied guard_confirmed"; strings.Join(kinds, " ") != want {
+		t.Errorf("Expected audit events %q, got %q", want, strings.Join(kinds, " "))
+	}
+
+	if err := tool.SetGuardRules([]GuardRule{{Name: "bad", Pattern: "x", Severity: "warn"}}); err == nil {
+		t.Error("Expected an unknown severity to be rejected")
+	}
+	if fb := tool.CheckCommand("git push"); fb == nil {
+		t.Error("Expected rules to be kept after a rejected update")
+	}
+}
@@ -0,0 +1,98 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// LandlockHelperCommand is the hidden picoclaw subcommand that applies the
+// Landlock ruleset to itself and then runs the command. Go cannot run code
+// between fork and exec, so the restriction is applied in a helper process
+// that execs the shell.
+const LandlockHelperCommand = "__landlock-exec"
+
+// LandlockBackend runs commands on the host, but under a Landlock ruleset
+// (Linux 5.13+): the kernel only lets them read and write the workspace and
+// the ReadWrite paths, and read and execute the ReadOnly paths. Everything
+// else, such as the home directory, is out of reach whatever the command
+// line looks like.
+type LandlockBackend struct {
+	Workspace string
+	ReadOnly  []string // e.g. /usr, /etc
+	ReadWrite []string // e.g. /tmp
+}
+
+func NewLandlockBackend(workspace string, readOnly, readWrite []string) *LandlockBackend {
+	return &LandlockBackend{
+		Workspace: workspace,
+		ReadOnly:  readOnly,
+		ReadWrite: readWrite,
+	}
+}
+
+// LandlockSupported reports whether the kernel can enforce Landlock rules.
+func LandlockSupported() bool {
+	return landlockABI() > 0
+}
+
+func (b *LandlockBackend) Command(ctx context.Context, command, cwd string, env []string) (*exec.Cmd, func(), error) {
+	if !LandlockSupported() {
+		// Fail closed rather than running unrestricted
+		return nil, nil, fmt.Errorf("landlock is not available on this system")
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot find the picoclaw binary for the landlock helper: %w", err)
+	}
+
+	args := []string{LandlockHelperCommand, "--rw", b.Workspace}
+	for _, p := range b.ReadWrite {
+		args = append(args, "--rw", p)
+	}
+	for _, p := range b.ReadOnly {
+		args = append(args, "--ro", p)
+	}
+	args = append(args, "--", "sh", "-c", command)
+
+	cmd := exec.CommandContext(ctx, self, args...)
+	if cwd != "" {
+		cmd.Dir = cwd
+	}
+	cmd.Env = env
+	return cmd, func() {}, nil
+}
+
+func (b *LandlockBackend) Sandboxed() bool { return true }
+
+func (b *LandlockBackend) Describe() string {
+	return fmt.Sprintf("Commands run on the host, but the kernel only lets them read and write %s and %s, and read system directories (%s); other paths fail with \"permission denied\".",
+		b.Workspace, strings.Join(b.ReadWrite, ", "), strings.Join(b.ReadOnly, ", "))
+}
+
+// RunLandlockHelper implements LandlockHelperCommand. args are the
+// arguments after it: --rw and --ro paths, then -- and the command to run.
+// It only returns on error; on success the process becomes the command.
+func RunLandlockHelper(args []string) error {
+	var readWrite, readOnly []string
+	for len(args) > 0 && args[0] != "--" {
+		if len(args) < 2 {
+			return fmt.Errorf("missing path after %s", args[0])
+		}
+		switch args[0] {
+		case "--rw":
+			readWrite = append(readWrite, args[1])
+		case "--ro":
+			readOnly = append(readOnly, args[1])
+		default:
+			return fmt.Errorf("unknown option %s", args[0])
+		}
+		args = args[2:]
+	}
+	if len(args) < 2 {
+		return fmt.Errorf("no command given")
+	}
+	return landlockExec(readWrite, readOnly, args[1:])
+}
@@ -0,0 +1,65 @@
+//go:build linux
+
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestLandlockHelperProcess is not a real test: it stands in for the
+// picoclaw binary when TestLandlockBackend runs the helper.
+func TestLandlockHelperProcess(t *testing.T) {
+	if os.Getenv("PICOCLAW_TEST_LANDLOCK_HELPER") != "1" {
+		return
+	}
+	i := slices.Index(os.Args, LandlockHelperCommand)
+	fmt.Fprintln(os.Stderr, RunLandlockHelper(os.Args[i+1:]))
+	os.Exit(126)
+}
+
+// TestLandlockBackend verifies commands can use the workspace but not
+// paths outside the allowed ones.
+func TestLandlockBackend(t *testing.T) {
+	if !LandlockSupported() {
+		t.Skip("landlock not available")
+	}
+	workspace := t.TempDir()
+	outside := t.TempDir()
+	os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644)
+
+	backend := NewLandlockBackend(workspace, []string{"/usr", "/bin", "/lib", "/lib64", "/etc"}, []string{"/dev/null"})
+	script := fmt.Sprintf("echo ok > note.txt && cat note.txt; cat %s/secret.txt || echo denied", outside)
+	cmd, _, err := backend.Command(context.Background(), script, workspace, nil)
+	if err != nil {
+		t.Fatalf("Command failed: %v", err)
+	}
+	cmd.Args = append([]string{cmd.Args[0], "-test.run=^TestLandlockHelperProcess$", "--"}, cmd.Args[1:]...)
+	cmd.Env = append(os.Environ(), "PICOCLAW_TEST_LANDLOCK_HELPER=1")
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Expected command to run, got %v: %s", err, out)
+	}
+	if got := string(out); !strings.Contains(got, "ok") || strings.Contains(got, "secret\n") || !strings.Contains(got, "denied") {
+		t.Errorf("Expected workspace access only, got: %s", got)
+	}
+}
+
+// TestRunLandlockHelper_Args verifies malformed helper arguments are rejected.
+func TestRunLandlockHelper_Args(t *testing.T) {
+	for _, args := range [][]string{
+		{"--rw"},
+		{"--bogus", "/tmp", "--", "true"},
+		{"--rw", "/tmp", "--"},
+	} {
+		if err := RunLandlockHelper(args); err == nil {
+			t.Errorf("Expected error for %v", args)
+		}
+	}
+}
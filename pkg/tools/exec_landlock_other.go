@@ -0,0 +1,15 @@
+//go:build !linux
+
+package tools
+
+import "fmt"
+
+// landlockABI is 0: Landlock is Linux only.
+func landlockABI() int {
+	return 0
+}
+
+// landlockExec is a stub for non-Linux platforms.
+func landlockExec(readWrite, readOnly, argv []string) error {
+	return fmt.Errorf("landlock is only supported on Linux")
+}
@@ -0,0 +1,98 @@
+package tools
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// subcommandTools are commands whose first argument picks what they do, so
+// allowing "git status" should not allow "git push".
+var subcommandTools = map[string]bool{
+	"git": true, "gh": true, "go": true, "cargo": true, "npm": true, "pnpm": true, "yarn": true,
+	"pip": true, "pip3": true, "uv": true, "docker": true, "podman": true, "kubectl": true,
+	"helm": true, "terraform": true, "systemctl": true, "apt": true, "apt-get": true,
+	"brew": true, "make": true, "dotnet": true,
+}
+
+var subcommandWord = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+// AllowSuggestion is an allow pattern learned from approved commands.
+type AllowSuggestion struct {
+	Pattern string
+	Count   int    // approved commands it covers
+	Example string // one of them
+}
+
+// ApprovedCommand returns the shell command an approval request was for,
+// or "" if it was not for a command.
+func ApprovedCommand(req ApprovalRequest) string {
+	command, _ := req.Args["command"].(string)
+	switch req.Tool {
+	case "exec":
+		return command
+	case "shell_session":
+		if action, _ := req.Args["action"].(string); action == "run" {
+			return command
+		}
+	}
+	return ""
+}
+
+// SuggestAllowPatterns derives allow patterns from commands the user
+// approved: one per command name, or per subcommand for tools such as git,
+// keeping those seen fewer than minCount times out. The most used come first.
+func SuggestAllowPatterns(commands []string, minCount int) []AllowSuggestion {
+	byPattern := make(map[string]*AllowSuggestion)
+	for _, command := range commands {
+		script, err := parseShell(command)
+		if err != nil {
+			continue
+		}
+		seen := make(map[string]bool) // count each pattern once per command
+		for _, c := range script.simpleCommands() {
+			pattern := allowPatternFor(c)
+			if pattern == "" || seen[pattern] {
+				continue
+			}
+			seen[pattern] = true
+			if s, ok := byPattern[pattern]; ok {
+				s.Count++
+			} else {
+				byPattern[pattern] = &AllowSuggestion{Pattern: pattern, Count: 1, Example: c.String()}
+			}
+		}
+	}
+
+	suggestions := make([]AllowSuggestion, 0, len(byPattern))
+	for _, s := range byPattern {
+		if s.Count >= minCount {
+			suggestions = append(suggestions, *s)
+		}
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Count != suggestions[j].Count {
+			return suggestions[i].Count > suggestions[j].Count
+		}
+		return suggestions[i].Pattern < suggestions[j].Pattern
+	})
+	return suggestions
+}
+
+// allowPatternFor returns the pattern that allows c, matched like the
+// guard's allowlist against the lower-cased command.
+func allowPatternFor(c *shellCommand) string {
+	if c.words[0].dynamic() {
+		return ""
+	}
+	name := strings.ToLower(c.name())
+	if !subcommandTools[name] {
+		return fmt.Sprintf(`^%s(\s|$)`, regexp.QuoteMeta(name))
+	}
+	if len(c.words) > 1 && !c.words[1].dynamic() && subcommandWord.MatchString(strings.ToLower(c.words[1].text)) {
+		return fmt.Sprintf(`^%s\s+%s(\s|$)`, regexp.QuoteMeta(name), regexp.QuoteMeta(strings.ToLower(c.words[1].text)))
+	}
+	// No subcommand, e.g. "git --version": allow exactly this
+	return "^" + regexp.QuoteMeta(strings.ToLower(c.String())) + "$"
+}
@@ -0,0 +1,83 @@
+package tools
+
+import (
+	"context"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+// TestSuggestAllowPatterns verifies approved commands become per-command
+// patterns, per-subcommand for tools like git, ordered by use.
+func TestSuggestAllowPatterns(t *testing.T) {
+	suggestions := SuggestAllowPatterns([]string{
+		"git status",
+		"git status && ls -la",
+		"git log --oneline | head -5",
+		"FOO=1 ls src",
+		"$(echo rm) x",
+	}, 1)
+
+	got := make(map[string]int)
+	for _, s := range suggestions {
+		got[s.Pattern] = s.Count
+	}
+	want := map[string]int{
+		`^git\s+status(\s|$)`: 2,
+		`^ls(\s|$)`:           2,
+		`^git\s+log(\s|$)`:    1,
+		`^head(\s|$)`:         1,
+		`^echo(\s|$)`:         1, // the substitution, not the dynamic command
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d patterns, got %v", len(want), got)
+	}
+	for pattern, count := range want {
+		if got[pattern] != count {
+			t.Errorf("Expected %s seen %d times, got %d", pattern, count, got[pattern])
+		}
+	}
+	if suggestions[0].Count != 2 {
+		t.Errorf("Expected most used pattern first, got %+v", suggestions[0])
+	}
+
+	allow := regexp.MustCompile(`^git\s+status(\s|$)`)
+	if !allow.MatchString("git status -s") || allow.MatchString("git statusx") || allow.MatchString("git push") {
+		t.Error("Expected git status pattern to match only git status")
+	}
+
+	if frequent := SuggestAllowPatterns([]string{"ls", "ls -l", "pwd"}, 2); len(frequent) != 1 || frequent[0].Pattern != `^ls(\s|$)` {
+		t.Errorf("Expected only ls with min count 2, got %+v", frequent)
+	}
+}
+
+// TestApprovalGate_Observer verifies approved commands can be recorded for
+// allowlist learning.
+func TestApprovalGate_Observer(t *testing.T) {
+	log := NewAuditLog(filepath.Join(t.TempDir(), "audit.jsonl"))
+	gate := NewApprovalGate([]string{"exec"}, nil)
+	gate.SetApprover(func(ctx context.Context, req ApprovalRequest) (ApprovalDecision, error) {
+		if req.Args["command"] == "ls" {
+			return ApprovalApprove, nil
+		}
+		return ApprovalDeny, nil
+	})
+	gate.SetObserver(func(req ApprovalRequest, decision ApprovalDecision) {
+		if command := ApprovedCommand(req); command != "" && decision != ApprovalDeny {
+			log.Record(AuditEvent{Event: AuditCommandApproved, Tool: req.Tool, Command: command})
+		}
+	})
+
+	tool := NewExecTool("", false)
+	for _, command := range []string{"ls", "whoami"} {
+		gate.Check(context.Background(), "exec", tool, map[string]interface{}{"command": command}, "cli", "direct")
+	}
+
+	events, err := log.Events()
+	if err != nil {
+		t.Fatalf("Events failed: %v", err)
+	}
+	if len(events) != 1 || events[0].Command != "ls" {
+		t.Errorf("Expected only the approved ls to be recorded, got %+v", events)
+	}
+}
@@ -0,0 +1,296 @@
+package tools
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/quota"
+)
+
+const (
+	// largeFileThreshold is the size above which read_file returns fewer
+	// lines by default, so one call does not fill the context.
+	largeFileThreshold = 1 << 20
+	// largeFileReadLimit is the default line limit for large files.
+	largeFileReadLimit = 200
+	// defaultHexdumpLen and maxHexdumpLen bound mode=hexdump, in bytes.
+	defaultHexdumpLen = 256
+	maxHexdumpLen     = 4096
+	// maxStringsOutput bounds mode=strings, in bytes of output.
+	maxStringsOutput = 8000
+	// minStringLen is the shortest printable run mode=strings reports.
+	minStringLen = 4
+	// maxArchiveEntries bounds the listing of mode=extract.
+	maxArchiveEntries = 200
+	// maxEditFileSize bounds the files edit_file loads into memory.
+	maxEditFileSize = 10 << 20
+)
+
+// archiveKind names the archive formats mode=extract can open.
+type archiveKind string
+
+const (
+	archiveNone  archiveKind = ""
+	archiveZip   archiveKind = "zip"
+	archiveTar   archiveKind = "tar"
+	archiveTarGz archiveKind = "tar.gz"
+)
+
+// detectArchive recognizes zip, tar and gzipped tar files by their magic
+// bytes, falling back to the name for tar, which has its magic at 257.
+func detectArchive(name string, head []byte) archiveKind {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasPrefix(string(head), "PK\x03\x04") || strings.HasPrefix(string(head), "PK\x05\x06"):
+		return archiveZip
+	case len(head) >= 2 && head[0] == 0x1f && head[1] == 0x8b:
+		if strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz") {
+			return archiveTarGz
+		}
+	case len(head) >= 262 && string(head[257:262]) == "ustar":
+		return archiveTar
+	case strings.HasSuffix(lower, ".tar"):
+		return archiveTar
+	}
+	return archiveNone
+}
+
+// fileType returns the MIME type of a file from its content, or from its
+// extension when the content is not conclusive.
+func fileType(name string, head []byte) string {
+	sniffed := http.DetectContentType(head)
+	if sniffed != "application/octet-stream" {
+		return sniffed
+	}
+	if byExt := mime.TypeByExtension(filepath.Ext(name)); byExt != "" {
+		return byExt
+	}
+	return sniffed
+}
+
+// binaryNotice describes a binary file instead of dumping it, and says how
+// to look inside.
+func binaryNotice(path string, info os.FileInfo, head []byte) string {
+	options := "Use mode=hexdump (with offset and limit in bytes) or mode=strings to look inside"
+	if detectArchive(path, head) != archiveNone {
+		options += ", or mode=extract to list the archive and entry=<name> to read a file in it"
+	}
+	return fmt.Sprintf("%s is a binary file (%s, %s, modified %s); contents not shown. %s.",
+		path, fileType(path, head), quota.FormatBytes(info.Size()), info.ModTime().Format(time.RFC3339), options)
+}
+
+// checkTextFile refuses to change an existing file that is binary or,
+// if maxSize is set, larger than maxSize. A missing file passes.
+func checkTextFile(resolvedPath, path string, maxSize int64) *ToolResult {
+	f, err := os.Open(resolvedPath)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		return nil
+	}
+	if maxSize > 0 && info.Size() > maxSize {
+		return ErrorResult(fmt.Sprintf("%s is too large to edit (%s, limit %s); use exec with a stream editor such as sed instead",
+			path, quota.FormatBytes(info.Size()), quota.FormatBytes(maxSize)))
+	}
+	head := make([]byte, sniffLen)
+	n, _ := io.ReadFull(f, head)
+	if detectEncoding(head[:n]) == encodingBinary {
+		return ErrorResult(fmt.Sprintf("%s is a binary file (%s, %s); only text files can be changed this way",
+			path, fileType(path, head[:n]), quota.FormatBytes(info.Size())))
+	}
+	return nil
+}
+
+// hexdump renders length bytes from offset as offset, hex and ASCII columns.
+func hexdump(f io.ReaderAt, size, offset, length int64) string {
+	if length <= 0 {
+		length = defaultHexdumpLen
+	}
+	length = min(length, maxHexdumpLen, max(size-offset, 0))
+	buf := make([]byte, length)
+	n, _ := f.ReadAt(buf, offset)
+	buf = buf[:n]
+
+	var sb strings.Builder
+	for i := 0; i < len(buf); i += 16 {
+		line := buf[i:min(i+16, len(buf))]
+		fmt.Fprintf(&sb, "%08x  ", offset+int64(i))
+		for j := 0; j < 16; j++ {
+			if j < len(line) {
+				fmt.Fprintf(&sb, "%02x ", line[j])
+			} else {
+				sb.WriteString("   ")
+			}
+			if j == 7 {
+				sb.WriteByte(' ')
+			}
+		}
+		sb.WriteString(" |")
+		for _, b := range line {
+			if b >= 0x20 && b < 0x7f {
+				sb.WriteByte(b)
+			} else {
+				sb.WriteByte('.')
+			}
+		}
+		sb.WriteString("|\n")
+	}
+	if end := offset + int64(n); end < size {
+		fmt.Fprintf(&sb, "[%d of %d bytes shown. Use offset=%d to continue.]", n, size, end)
+	}
+	return sb.String()
+}
+
+// printableStrings returns runs of at least minStringLen printable ASCII
+// characters from r, one per line, stopping at maxStringsOutput bytes.
+func printableStrings(r io.Reader) (string, bool) {
+	br := bufio.NewReader(r)
+	var sb, run strings.Builder
+	flush := func() {
+		if run.Len() >= minStringLen {
+			sb.WriteString(run.String())
+			sb.WriteByte('\n')
+		}
+		run.Reset()
+	}
+	for sb.Len() < maxStringsOutput {
+		b, err := br.ReadByte()
+		if err != nil {
+			flush()
+			return sb.String(), false
+		}
+		if (b >= 0x20 && b < 0x7f) || b == '\t' {
+			run.WriteByte(b)
+		} else {
+			flush()
+		}
+	}
+	return sb.String(), true
+}
+
+// archiveEntry is one file in an archive.
+type archiveEntry struct {
+	Name string
+	Size int64
+	Dir  bool
+	open func() (io.ReadCloser, error)
+}
+
+// walkArchive calls fn for each entry of the archive at path until fn
+// returns false. Entries are only readable inside fn.
+func walkArchive(path string, kind archiveKind, fn func(archiveEntry) bool) error {
+	if kind == archiveZip {
+		zr, err := zip.OpenReader(path)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		for _, f := range zr.File {
+			if !fn(archiveEntry{Name: f.Name, Size: int64(f.UncompressedSize64), Dir: f.FileInfo().IsDir(), open: f.Open}) {
+				break
+			}
+		}
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var r io.Reader = file
+	if kind == archiveTarGz {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		entry := archiveEntry{
+			Name: hdr.Name,
+			Size: hdr.Size,
+			Dir:  hdr.Typeflag == tar.TypeDir,
+			open: func() (io.ReadCloser, error) { return io.NopCloser(tr), nil },
+		}
+		if !fn(entry) {
+			return nil
+		}
+	}
+}
+
+// listArchive lists the entries of an archive with their sizes.
+func listArchive(path string, kind archiveKind) (string, error) {
+	var sb strings.Builder
+	count := 0
+	err := walkArchive(path, kind, func(e archiveEntry) bool {
+		count++
+		if count > maxArchiveEntries {
+			return true
+		}
+		if e.Dir {
+			fmt.Fprintf(&sb, "DIR:  %s\n", e.Name)
+		} else {
+			fmt.Fprintf(&sb, "FILE: %s (%s)\n", e.Name, quota.FormatBytes(e.Size))
+		}
+		return true
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s archive: %w", kind, err)
+	}
+	if count > maxArchiveEntries {
+		fmt.Fprintf(&sb, "[%d more entries not shown]\n", count-maxArchiveEntries)
+	}
+	sb.WriteString("Use entry=<name> to read a file in the archive.")
+	return sb.String(), nil
+}
+
+// openArchiveEntry finds name in the archive and passes its content to fn.
+func openArchiveEntry(path string, kind archiveKind, name string, fn func(e archiveEntry, r io.Reader) error) error {
+	found := false
+	var fnErr error
+	err := walkArchive(path, kind, func(e archiveEntry) bool {
+		if e.Name != name || e.Dir {
+			return true
+		}
+		found = true
+		rc, err := e.open()
+		if err != nil {
+			fnErr = err
+			return false
+		}
+		defer rc.Close()
+		fnErr = fn(e, rc)
+		return false
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read %s archive: %w", kind, err)
+	}
+	if !found {
+		return fmt.Errorf("no file named %q in the archive; use mode=extract without entry to list it", name)
+	}
+	return fnErr
+}
@@ -0,0 +1,229 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+const (
+	// defaultReadLimit is the number of lines read_file returns when no
+	// limit is given.
+	defaultReadLimit = 2000
+	// maxReadLineLength is the number of characters kept from a single line.
+	maxReadLineLength = 2000
+	// sniffLen is how much of a file is inspected to detect its encoding.
+	sniffLen = 8000
+)
+
+// textEncoding is the encoding detected for a file.
+type textEncoding int
+
+const (
+	encodingUTF8 textEncoding = iota
+	encodingUTF8BOM
+	encodingUTF16LE
+	encodingUTF16BE
+	encodingBinary
+)
+
+func (e textEncoding) String() string {
+	switch e {
+	case encodingUTF8BOM:
+		return "UTF-8 with BOM"
+	case encodingUTF16LE:
+		return "UTF-16LE"
+	case encodingUTF16BE:
+		return "UTF-16BE"
+	case encodingBinary:
+		return "binary"
+	default:
+		return "UTF-8"
+	}
+}
+
+// detectEncoding looks at the start of a file. Files with a BOM are decoded
+// accordingly; files containing NUL bytes or mostly control characters are
+// treated as binary. Anything else is read as UTF-8, falling back to
+// Latin-1 per line when a line is not valid UTF-8.
+func detectEncoding(head []byte) textEncoding {
+	switch {
+	case bytes.HasPrefix(head, []byte{0xEF, 0xBB, 0xBF}):
+		return encodingUTF8BOM
+	case bytes.HasPrefix(head, []byte{0xFF, 0xFE}):
+		return encodingUTF16LE
+	case bytes.HasPrefix(head, []byte{0xFE, 0xFF}):
+		return encodingUTF16BE
+	}
+
+	if bytes.IndexByte(head, 0) >= 0 {
+		return encodingBinary
+	}
+
+	control := 0
+	for _, b := range head {
+		if b < 0x20 && b != '\n' && b != '\r' && b != '\t' && b != '\f' && b != '\b' && b != 0x1b {
+			control++
+		}
+	}
+	if len(head) > 0 && control*10 > len(head) {
+		return encodingBinary
+	}
+	return encodingUTF8
+}
+
+// decodeUTF16 converts UTF-16 text (without BOM) to a UTF-8 string.
+func decodeUTF16(data []byte, bigEndian bool) string {
+	units := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		if bigEndian {
+			units = append(units, uint16(data[i])<<8|uint16(data[i+1]))
+		} else {
+			units = append(units, uint16(data[i+1])<<8|uint16(data[i]))
+		}
+	}
+	return string(utf16.Decode(units))
+}
+
+// decodeLine returns line as a string, reading it as Latin-1 if it is not
+// valid UTF-8. The second result reports whether the fallback was used.
+func decodeLine(line []byte) (string, bool) {
+	if utf8.Valid(line) {
+		return string(line), false
+	}
+	runes := make([]rune, len(line))
+	for i, b := range line {
+		runes[i] = rune(b)
+	}
+	return string(runes), true
+}
+
+// lineWindow is the part of a file returned by read_file.
+type lineWindow struct {
+	Text       string
+	First      int  // first line included (1-based)
+	Last       int  // last line included
+	Total      int  // total lines in the file
+	LinesCut   bool // some lines were longer than maxReadLineLength
+	SizeCapped bool // output stopped early because maxBytes was reached
+	Latin1     bool // some lines were decoded as Latin-1
+}
+
+// readLineWindow streams r and collects up to limit lines starting at line
+// offset, keeping at most maxBytes of output. It keeps counting lines after
+// the window so the caller can tell the model how much is left.
+func readLineWindow(r io.Reader, offset, limit int, maxBytes int64) (lineWindow, error) {
+	br := bufio.NewReader(r)
+	w := lineWindow{First: offset}
+	var out strings.Builder
+
+	for lineNo := 1; ; lineNo++ {
+		inWindow := lineNo >= offset && lineNo < offset+limit && !w.SizeCapped
+		keep := 0
+		if inWindow {
+			keep = maxReadLineLength * utf8.UTFMax
+		}
+
+		raw, cut, err := readBoundedLine(br, keep)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return w, err
+		}
+		atEOF := errors.Is(err, io.EOF)
+		if atEOF && len(raw) == 0 && !cut {
+			// No trailing partial line
+			break
+		}
+		w.Total = lineNo
+
+		if inWindow {
+			text, latin1 := decodeLine(raw)
+			w.Latin1 = w.Latin1 || latin1
+			if runes := []rune(text); len(runes) > maxReadLineLength {
+				text = string(runes[:maxReadLineLength])
+				cut = true
+			}
+			if cut {
+				text += " …"
+				w.LinesCut = true
+			}
+			if int64(out.Len()+len(text)+1) > maxBytes && out.Len() > 0 {
+				w.SizeCapped = true
+			} else {
+				if out.Len() > 0 {
+					out.WriteByte('\n')
+				}
+				out.WriteString(text)
+				w.Last = lineNo
+			}
+		}
+
+		if atEOF {
+			break
+		}
+	}
+
+	w.Text = out.String()
+	return w, nil
+}
+
+// readBoundedLine reads one line, keeping at most keep bytes of it so that a
+// file with a huge single line cannot exhaust memory. The trailing newline
+// (and carriage return) is removed. cut reports whether bytes were dropped.
+func readBoundedLine(br *bufio.Reader, keep int) (line []byte, cut bool, err error) {
+	for {
+		chunk, readErr := br.ReadSlice('\n')
+		if readErr == nil {
+			chunk = chunk[:len(chunk)-1]
+		}
+		if room := keep - len(line); room > 0 {
+			take := len(chunk)
+			if take > room {
+				take = room
+				cut = true
+			}
+			line = append(line, chunk[:take]...)
+		} else if len(chunk) > 0 {
+			cut = true
+		}
+
+		if readErr == bufio.ErrBufferFull {
+			continue
+		}
+		if readErr == nil {
+			line = bytes.TrimSuffix(line, []byte{'\r'})
+		}
+		return line, cut, readErr
+	}
+}
+
+// formatWindowNote explains what part of the file was returned.
+func formatWindowNote(w lineWindow, enc textEncoding) string {
+	var notes []string
+	if w.First > 1 || w.Last < w.Total {
+		notes = append(notes, fmt.Sprintf("Showing lines %d-%d of %d.", w.First, w.Last, w.Total))
+		if w.Last < w.Total {
+			notes = append(notes, fmt.Sprintf("Use offset=%d to read more.", w.Last+1))
+		}
+	}
+	if w.SizeCapped {
+		notes = append(notes, "Output was cut to stay within the size limit.")
+	}
+	if w.LinesCut {
+		notes = append(notes, fmt.Sprintf("Lines longer than %d characters were truncated.", maxReadLineLength))
+	}
+	switch {
+	case enc == encodingUTF16LE || enc == encodingUTF16BE:
+		notes = append(notes, fmt.Sprintf("Decoded from %s.", enc))
+	case w.Latin1:
+		notes = append(notes, "Some lines were not valid UTF-8 and were decoded as Latin-1.")
+	}
+	if len(notes) == 0 {
+		return ""
+	}
+	return "\n\n[" + strings.Join(notes, " ") + "]"
+}
@@ -1,16 +1,23 @@
 package tools
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/quota"
+	"github.com/sipeed/picoclaw/pkg/sandbox/pathguard"
 )
 
-// validatePath ensures the given path is within the workspace if restrict is true.
-// It also resolves symlinks to prevent symlink traversal attacks.
-func validatePath(path, workspace string, restrict bool) (string, error) {
+// validatePath resolves path against the workspace. If restrict is true the
+// path must stay inside the workspace or one of the shared folders, after
+// following symlinks, so a link cannot be used to escape.
+func validatePath(path, workspace string, restrict bool, shared ...string) (string, error) {
 	// If restrict is enabled but workspace is empty, use current directory as fallback
 	if restrict && workspace == "" {
 		cwd, err := os.Getwd()
@@ -29,62 +36,114 @@ func validatePath(path, workspace string, restrict bool) (string, error) {
 		return "", fmt.Errorf("failed to resolve workspace path: %w", err)
 	}
 
-	// Resolve workspace symlinks for consistent comparison
-	realWorkspace, err := filepath.EvalSymlinks(absWorkspace)
-	if err != nil {
-		// If workspace doesn't exist yet, use the absolute path
-		realWorkspace = absWorkspace
-	}
-
-	var absPath string
-	if filepath.IsAbs(path) {
-		absPath = filepath.Clean(path)
-	} else {
-		absPath, err = filepath.Abs(filepath.Join(absWorkspace, path))
+	if !restrict {
+		if filepath.IsAbs(path) {
+			return filepath.Clean(path), nil
+		}
+		absPath, err := filepath.Abs(filepath.Join(absWorkspace, path))
 		if err != nil {
 			return "", fmt.Errorf("failed to resolve file path: %w", err)
 		}
+		return absPath, nil
 	}
 
-	if restrict {
-		// Resolve symlinks in the target path to prevent symlink traversal
-		realPath, err := filepath.EvalSymlinks(absPath)
-		if err != nil {
-			// If path doesn't exist, check the parent directory
-			parentDir := filepath.Dir(absPath)
-			realParent, parentErr := filepath.EvalSymlinks(parentDir)
-			if parentErr != nil {
-				// Parent doesn't exist either, use the cleaned absolute path
-				realPath = absPath
-			} else {
-				realPath = filepath.Join(realParent, filepath.Base(absPath))
-			}
-		}
-
-		// Check if the resolved real path is within the workspace
-		if !strings.HasPrefix(realPath, realWorkspace) && !strings.HasPrefix(realPath, absWorkspace) {
-			return "", fmt.Errorf("access denied: path is outside the workspace")
+	guard := pathguard.New(append([]string{absWorkspace}, shared...)...)
+	absPath, err := guard.Resolve(path, absWorkspace)
+	switch {
+	case errors.Is(err, pathguard.ErrDriveRelative):
+		return "", fmt.Errorf("access denied: drive-relative path %s depends on the drive's current directory; use a full path", path)
+	case errors.Is(err, pathguard.ErrOutside), errors.Is(err, pathguard.ErrLink):
+		if len(shared) > 0 {
+			return "", fmt.Errorf("access denied: path is outside the workspace and shared folders")
 		}
+		return "", fmt.Errorf("access denied: path is outside the workspace")
+	case err != nil:
+		return "", fmt.Errorf("failed to resolve file path: %w", err)
 	}
-
 	return absPath, nil
 }
 
-type ReadFileTool struct {
+// pathScope is the part of a file tool that decides which paths it may
+// touch: the workspace and, when restricted, any shared folders.
+type pathScope struct {
 	workspace string
 	restrict  bool
+	shared    []string
+	quota     *quota.Manager
+}
+
+// SetSharedFolders lets the tool reach folders outside the workspace when
+// it is restricted to the workspace.
+func (s *pathScope) SetSharedFolders(folders []string) {
+	s.shared = folders
+}
+
+// SetQuota makes writes that would exceed the disk quota fail.
+func (s *pathScope) SetQuota(q *quota.Manager) {
+	s.quota = q
+}
+
+// reserve checks the disk quota before a write that grows the workspace by
+// growth bytes, returning an error result if it does not fit.
+func (s *pathScope) reserve(growth int64) *ToolResult {
+	if growth <= 0 {
+		return nil
+	}
+	if err := s.quota.Reserve(growth); err != nil {
+		return ErrorResult(fmt.Sprintf("file not written: %v. Delete files that are no longer needed and try again.", err)).WithError(err)
+	}
+	return nil
+}
+
+// resolvePath validates path against the tool's scope.
+func (s *pathScope) resolvePath(path string) (string, error) {
+	return validatePath(path, s.workspace, s.restrict, s.shared...)
+}
+
+// DiskQuotaTool is implemented by tools whose writes count against the
+// disk quota.
+type DiskQuotaTool interface {
+	Tool
+	SetQuota(q *quota.Manager)
+}
+
+// SharedFolderTool is implemented by tools whose access can be extended
+// from the workspace to shared folders.
+type SharedFolderTool interface {
+	Tool
+	SetSharedFolders(folders []string)
+}
+
+// defaultReadFileMaxBytes caps a single read_file call.
+const defaultReadFileMaxBytes = 10 << 20
+
+type ReadFileTool struct {
+	pathScope
+	maxBytes int64
 }
 
 func NewReadFileTool(workspace string, restrict bool) *ReadFileTool {
-	return &ReadFileTool{workspace: workspace, restrict: restrict}
+	return &ReadFileTool{pathScope: pathScope{workspace: workspace, restrict: restrict}, maxBytes: defaultReadFileMaxBytes}
+}
+
+// SetMaxBytes caps how much of a file is read in one call.
+func (t *ReadFileTool) SetMaxBytes(n int64) {
+	if n > 0 {
+		t.maxBytes = n
+	}
 }
 
 func (t *ReadFileTool) Name() string {
 	return "read_file"
 }
 
+// ConcurrencySafe reports true: reading a file cannot disturb other calls.
+func (t *ReadFileTool) ConcurrencySafe() bool {
+	return true
+}
+
 func (t *ReadFileTool) Description() string {
-	return "Read the contents of a file"
+	return "Read a text file. Returns up to `limit` lines starting at line `offset` (1-based) and says how to continue if the file is longer. Binary files are described instead of dumped; use mode=hexdump or mode=strings to look inside them, and mode=extract to list or read zip and tar archives. Non-UTF-8 text is decoded."
 }
 
 func (t *ReadFileTool) Parameters() map[string]interface{} {
@@ -95,6 +154,23 @@ func (t *ReadFileTool) Parameters() map[string]interface{} {
 				"type":        "string",
 				"description": "Path to the file to read",
 			},
+			"offset": map[string]interface{}{
+				"type":        "integer",
+				"description": "Line number to start reading from (1-based, default 1)",
+			},
+			"limit": map[string]interface{}{
+				"type":        "integer",
+				"description": fmt.Sprintf("Maximum number of lines to return (default %d, or %d for files over %s)", defaultReadLimit, largeFileReadLimit, quota.FormatBytes(largeFileThreshold)),
+			},
+			"mode": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"text", "hexdump", "strings", "extract"},
+				"description": fmt.Sprintf("text (default); hexdump shows raw bytes, with offset and limit in bytes (default %d, max %d); strings lists printable runs; extract lists a zip or tar archive, or reads one file in it with entry", defaultHexdumpLen, maxHexdumpLen),
+			},
+			"entry": map[string]interface{}{
+				"type":        "string",
+				"description": "With mode=extract, the archive entry to read",
+			},
 		},
 		"required": []string{"path"},
 	}
@@ -106,26 +182,159 @@ func (t *ReadFileTool) Execute(ctx context.Context, args map[string]interface{})
 		return ErrorResult("path is required")
 	}
 
-	resolvedPath, err := validatePath(path, t.workspace, t.restrict)
+	offset := 1
+	if v, ok := args["offset"].(float64); ok && v >= 1 {
+		offset = int(v)
+	}
+	limit := 0
+	if v, ok := args["limit"].(float64); ok && v >= 1 {
+		limit = int(v)
+	}
+	mode, _ := args["mode"].(string)
+
+	resolvedPath, err := t.resolvePath(path)
 	if err != nil {
 		return ErrorResult(err.Error())
 	}
 
-	content, err := os.ReadFile(resolvedPath)
+	f, err := os.Open(resolvedPath)
 	if err != nil {
 		return ErrorResult(fmt.Sprintf("failed to read file: %v", err))
 	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to read file: %v", err))
+	}
+	if info.IsDir() {
+		return ErrorResult(fmt.Sprintf("%s is a directory, use list_dir instead", path))
+	}
 
-	return NewToolResult(string(content))
+	maxBytes := t.maxBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultReadFileMaxBytes
+	}
+
+	br := bufio.NewReaderSize(f, sniffLen)
+	head, _ := br.Peek(sniffLen)
+
+	switch mode {
+	case "", "text":
+	case "hexdump":
+		byteOffset := int64(0)
+		if v, ok := args["offset"].(float64); ok && v > 0 {
+			byteOffset = int64(v)
+		}
+		return NewToolResult(hexdump(f, info.Size(), byteOffset, int64(limit)))
+	case "strings":
+		out, capped := printableStrings(br)
+		if capped {
+			out += fmt.Sprintf("[Output stopped at %d bytes.]", maxStringsOutput)
+		}
+		if out == "" {
+			out = fmt.Sprintf("(no printable strings of %d or more characters)", minStringLen)
+		}
+		return NewToolResult(out)
+	case "extract":
+		return t.extract(resolvedPath, path, head, args, offset, limit, maxBytes)
+	default:
+		return ErrorResult(fmt.Sprintf("unknown mode %q: use text, hexdump, strings or extract", mode))
+	}
+
+	return t.readText(br, path, info, head, offset, limit, maxBytes)
+}
+
+// readText returns a window of lines from a text file, or a description of
+// a binary one.
+func (t *ReadFileTool) readText(br *bufio.Reader, path string, info os.FileInfo, head []byte, offset, limit int, maxBytes int64) *ToolResult {
+	enc := detectEncoding(head)
+	var sizeNote string
+	if limit == 0 {
+		limit = defaultReadLimit
+		if info.Size() > largeFileThreshold {
+			limit = largeFileReadLimit
+			sizeNote = fmt.Sprintf("\n[The file is %s, so at most %d lines are shown per call.]", quota.FormatBytes(info.Size()), limit)
+		}
+	}
+
+	var r io.Reader = br
+	switch enc {
+	case encodingBinary:
+		return NewToolResult(binaryNotice(path, info, head))
+	case encodingUTF8BOM:
+		br.Discard(3)
+	case encodingUTF16LE, encodingUTF16BE:
+		// UTF-16 is decoded up front, bounded by twice the output cap since
+		// each character takes at least two bytes.
+		br.Discard(2)
+		data, err := io.ReadAll(io.LimitReader(br, 2*maxBytes))
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to read file: %v", err))
+		}
+		r = strings.NewReader(decodeUTF16(data, enc == encodingUTF16BE))
+	}
+
+	window, err := readLineWindow(r, offset, limit, maxBytes)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to read file: %v", err))
+	}
+	if window.Total == 0 {
+		return NewToolResult("(empty file)")
+	}
+	if offset > window.Total {
+		return ErrorResult(fmt.Sprintf("offset %d is past the end of the file (%d lines)", offset, window.Total))
+	}
+
+	return NewToolResult(window.Text + formatWindowNote(window, enc) + sizeNote)
+}
+
+// extract lists an archive, or reads one text entry of it like read_file.
+func (t *ReadFileTool) extract(resolvedPath, path string, head []byte, args map[string]interface{}, offset, limit int, maxBytes int64) *ToolResult {
+	kind := detectArchive(resolvedPath, head)
+	if kind == archiveNone {
+		return ErrorResult(fmt.Sprintf("%s is not a zip or tar archive", path))
+	}
+	entry, _ := args["entry"].(string)
+	if entry == "" {
+		listing, err := listArchive(resolvedPath, kind)
+		if err != nil {
+			return ErrorResult(err.Error())
+		}
+		return NewToolResult(listing)
+	}
+
+	var result *ToolResult
+	err := openArchiveEntry(resolvedPath, kind, entry, func(e archiveEntry, r io.Reader) error {
+		br := bufio.NewReaderSize(r, sniffLen)
+		entryHead, _ := br.Peek(sniffLen)
+		if detectEncoding(entryHead) == encodingBinary {
+			result = NewToolResult(fmt.Sprintf("%s in %s is a binary file (%s, %s); contents not shown.",
+				e.Name, path, fileType(e.Name, entryHead), quota.FormatBytes(e.Size)))
+			return nil
+		}
+		if limit == 0 {
+			limit = defaultReadLimit
+		}
+		window, err := readLineWindow(br, offset, limit, maxBytes)
+		if err != nil {
+			return err
+		}
+		result = NewToolResult(window.Text + formatWindowNote(window, encodingUTF8))
+		return nil
+	})
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+	return result
 }
 
 type WriteFileTool struct {
-	workspace string
-	restrict  bool
+	pathScope
 }
 
 func NewWriteFileTool(workspace string, restrict bool) *WriteFileTool {
-	return &WriteFileTool{workspace: workspace, restrict: restrict}
+	return &WriteFileTool{pathScope: pathScope{workspace: workspace, restrict: restrict}}
 }
 
 func (t *WriteFileTool) Name() string {
@@ -133,7 +342,7 @@ func (t *WriteFileTool) Name() string {
 }
 
 func (t *WriteFileTool) Description() string {
-	return "Write content to a file"
+	return "Write content to a file, replacing it if it exists. Set dry_run to preview the change as a diff without writing it."
 }
 
 func (t *WriteFileTool) Parameters() map[string]interface{} {
@@ -148,11 +357,27 @@ func (t *WriteFileTool) Parameters() map[string]interface{} {
 				"type":        "string",
 				"description": "Content to write to the file",
 			},
+			"dry_run": map[string]interface{}{
+				"type":        "boolean",
+				"description": "If true, return the diff without writing the file",
+			},
 		},
 		"required": []string{"path", "content"},
 	}
 }
 
+// ConfirmationSummary shows the diff against the current file when approval
+// is required.
+func (t *WriteFileTool) ConfirmationSummary(args map[string]interface{}) string {
+	path, _ := args["path"].(string)
+	content, _ := args["content"].(string)
+	resolvedPath, err := t.resolvePath(path)
+	if err != nil {
+		return ""
+	}
+	return truncatePreview(writePreview(path, resolvedPath, content))
+}
+
 func (t *WriteFileTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
 	path, ok := args["path"].(string)
 	if !ok {
@@ -164,36 +389,67 @@ func (t *WriteFileTool) Execute(ctx context.Context, args map[string]interface{}
 		return ErrorResult("content is required")
 	}
 
-	resolvedPath, err := validatePath(path, t.workspace, t.restrict)
+	resolvedPath, err := t.resolvePath(path)
 	if err != nil {
 		return ErrorResult(err.Error())
 	}
 
+	preview := writePreview(path, resolvedPath, content)
+	if dryRun, _ := args["dry_run"].(bool); dryRun {
+		return NewToolResult("Dry run, file not written. The write would apply:\n" + preview).WithPreview(preview)
+	}
+
 	dir := filepath.Dir(resolvedPath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return ErrorResult(fmt.Sprintf("failed to create directory: %v", err))
 	}
 
+	growth := int64(len(content))
+	if info, err := os.Stat(resolvedPath); err == nil {
+		growth -= info.Size()
+	}
+	if exceeded := t.reserve(growth); exceeded != nil {
+		return exceeded
+	}
+
 	if err := os.WriteFile(resolvedPath, []byte(content), 0644); err != nil {
 		return ErrorResult(fmt.Sprintf("failed to write file: %v", err))
 	}
 
-	return SilentResult(fmt.Sprintf("File written: %s", path))
+	return SilentResult(fmt.Sprintf("File written: %s", path)).WithPreview(preview)
+}
+
+// writePreview diffs new content against the file currently at resolvedPath
+// (empty if it does not exist).
+func writePreview(path, resolvedPath, content string) string {
+	existing, err := os.ReadFile(resolvedPath)
+	if err != nil {
+		existing = nil
+	}
+	diff := unifiedDiff(path, string(existing), content)
+	if diff == "" {
+		return "(no changes)"
+	}
+	return diff
 }
 
 type ListDirTool struct {
-	workspace string
-	restrict  bool
+	pathScope
 }
 
 func NewListDirTool(workspace string, restrict bool) *ListDirTool {
-	return &ListDirTool{workspace: workspace, restrict: restrict}
+	return &ListDirTool{pathScope: pathScope{workspace: workspace, restrict: restrict}}
 }
 
 func (t *ListDirTool) Name() string {
 	return "list_dir"
 }
 
+// ConcurrencySafe reports true: listing only reads the directory.
+func (t *ListDirTool) ConcurrencySafe() bool {
+	return true
+}
+
 func (t *ListDirTool) Description() string {
 	return "List files and directories in a path"
 }
@@ -217,7 +473,7 @@ func (t *ListDirTool) Execute(ctx context.Context, args map[string]interface{})
 		path = "."
 	}
 
-	resolvedPath, err := validatePath(path, t.workspace, t.restrict)
+	resolvedPath, err := t.resolvePath(path)
 	if err != nil {
 		return ErrorResult(err.Error())
 	}
@@ -231,6 +487,9 @@ func (t *ListDirTool) Execute(ctx context.Context, args map[string]interface{})
 	for _, entry := range entries {
 		if entry.IsDir() {
 			result += "DIR:  " + entry.Name() + "\n"
+		} else if info, err := entry.Info(); err == nil {
+			// Sizes let the model spot files too large to read whole
+			result += fmt.Sprintf("FILE: %s (%s)\n", entry.Name(), quota.FormatBytes(info.Size()))
 		} else {
 			result += "FILE: " + entry.Name() + "\n"
 		}
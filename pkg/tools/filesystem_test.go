@@ -1,11 +1,15 @@
 package tools
 
 import (
+	"archive/zip"
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/quota"
 )
 
 // TestFilesystemTool_ReadFile_Success verifies successful file reading
@@ -60,6 +64,201 @@ func TestFilesystemTool_ReadFile_NotFound(t *testing.T) {
 	}
 }
 
+// TestFilesystemTool_ReadFile_Pagination verifies offset/limit windows and
+// the continuation hint
+func TestFilesystemTool_ReadFile_Pagination(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "lines.txt")
+	var lines []string
+	for i := 1; i <= 10; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	os.WriteFile(testFile, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+
+	tool := &ReadFileTool{}
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"path":   testFile,
+		"offset": float64(3),
+		"limit":  float64(2),
+	})
+
+	if result.IsError {
+		t.Fatalf("Expected success, got error: %s", result.ForLLM)
+	}
+	if !strings.HasPrefix(result.ForLLM, "line 3\nline 4\n") {
+		t.Errorf("Expected lines 3-4, got: %s", result.ForLLM)
+	}
+	if strings.Contains(result.ForLLM, "line 5") {
+		t.Errorf("Expected window to stop at line 4, got: %s", result.ForLLM)
+	}
+	if !strings.Contains(result.ForLLM, "Showing lines 3-4 of 10") || !strings.Contains(result.ForLLM, "offset=5") {
+		t.Errorf("Expected continuation hint, got: %s", result.ForLLM)
+	}
+
+	result = tool.Execute(context.Background(), map[string]interface{}{
+		"path":   testFile,
+		"offset": float64(50),
+	})
+	if !result.IsError {
+		t.Errorf("Expected error for offset past end of file")
+	}
+}
+
+// TestFilesystemTool_ReadFile_Binary verifies binary files are not dumped
+func TestFilesystemTool_ReadFile_Binary(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "blob.bin")
+	os.WriteFile(testFile, []byte{0x7f, 'E', 'L', 'F', 0, 0, 1, 2, 3}, 0644)
+
+	tool := &ReadFileTool{}
+	result := tool.Execute(context.Background(), map[string]interface{}{"path": testFile})
+
+	if result.IsError {
+		t.Fatalf("Expected success, got error: %s", result.ForLLM)
+	}
+	if !strings.Contains(result.ForLLM, "binary file") {
+		t.Errorf("Expected binary file notice, got: %q", result.ForLLM)
+	}
+}
+
+// TestFilesystemTool_ReadFile_BinaryModes verifies the binary notice gives
+// type and size, and that hexdump and strings look inside the file.
+func TestFilesystemTool_ReadFile_BinaryModes(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "image.png")
+	data := append([]byte("\x89PNG\r\n\x1a\n\x00\x00"), []byte("hidden-marker\x00\x01ab\x02")...)
+	os.WriteFile(testFile, data, 0644)
+	tool := &ReadFileTool{}
+
+	result := tool.Execute(context.Background(), map[string]interface{}{"path": testFile})
+	if !strings.Contains(result.ForLLM, "image/png") || !strings.Contains(result.ForLLM, fmt.Sprintf("%d B", len(data))) {
+		t.Errorf("Expected the MIME type and size in the notice, got: %q", result.ForLLM)
+	}
+	if strings.Contains(result.ForLLM, "hidden-marker") {
+		t.Errorf("Expected the contents not to be shown, got: %q", result.ForLLM)
+	}
+
+	result = tool.Execute(context.Background(), map[string]interface{}{"path": testFile, "mode": "hexdump", "limit": float64(16)})
+	if !strings.HasPrefix(result.ForLLM, "00000000  89 50 4e 47") || !strings.Contains(result.ForLLM, "offset=16") {
+		t.Errorf("Expected a 16-byte hexdump with a continuation hint, got: %q", result.ForLLM)
+	}
+
+	result = tool.Execute(context.Background(), map[string]interface{}{"path": testFile, "mode": "strings"})
+	if !strings.Contains(result.ForLLM, "hidden-marker\n") || strings.Contains(result.ForLLM, "ab\n") {
+		t.Errorf("Expected only runs of %d or more printable characters, got: %q", minStringLen, result.ForLLM)
+	}
+}
+
+// TestFilesystemTool_ReadFile_Extract verifies a zip archive can be listed
+// and an entry in it read.
+func TestFilesystemTool_ReadFile_Extract(t *testing.T) {
+	tmpDir := t.TempDir()
+	archive := filepath.Join(tmpDir, "bundle.zip")
+	f, _ := os.Create(archive)
+	zw := zip.NewWriter(f)
+	w, _ := zw.Create("docs/readme.txt")
+	w.Write([]byte("line one\nline two\n"))
+	zw.Close()
+	f.Close()
+	tool := &ReadFileTool{}
+
+	result := tool.Execute(context.Background(), map[string]interface{}{"path": archive})
+	if !strings.Contains(result.ForLLM, "mode=extract") {
+		t.Errorf("Expected the notice to offer mode=extract, got: %q", result.ForLLM)
+	}
+
+	result = tool.Execute(context.Background(), map[string]interface{}{"path": archive, "mode": "extract"})
+	if !strings.Contains(result.ForLLM, "FILE: docs/readme.txt (18 B)") {
+		t.Errorf("Expected the archive listing, got: %q", result.ForLLM)
+	}
+
+	result = tool.Execute(context.Background(), map[string]interface{}{"path": archive, "mode": "extract", "entry": "docs/readme.txt", "offset": float64(2)})
+	if result.IsError || !strings.HasPrefix(result.ForLLM, "line two") {
+		t.Errorf("Expected the second line of the entry, got: %q", result.ForLLM)
+	}
+
+	result = tool.Execute(context.Background(), map[string]interface{}{"path": archive, "mode": "extract", "entry": "missing.txt"})
+	if !result.IsError {
+		t.Errorf("Expected an error for a missing entry, got: %q", result.ForLLM)
+	}
+}
+
+// TestFilesystemTool_ReadFile_LargeFile verifies large files are read in
+// smaller windows by default.
+func TestFilesystemTool_ReadFile_LargeFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "big.log")
+	line := strings.Repeat("x", 99) + "\n"
+	os.WriteFile(testFile, []byte(strings.Repeat(line, largeFileThreshold/len(line)+1)), 0644)
+
+	tool := &ReadFileTool{}
+	result := tool.Execute(context.Background(), map[string]interface{}{"path": testFile})
+	if lines := strings.Count(result.ForLLM, line); lines != largeFileReadLimit {
+		t.Errorf("Expected %d lines from a large file, got %d", largeFileReadLimit, lines)
+	}
+	if !strings.Contains(result.ForLLM, "1.0 MiB") {
+		t.Errorf("Expected a note on the file size, got: %q", result.ForLLM[len(result.ForLLM)-200:])
+	}
+}
+
+// TestEditFileTool_RefusesBinary verifies binary files are not edited or
+// appended to.
+func TestEditFileTool_RefusesBinary(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "blob.bin")
+	os.WriteFile(testFile, []byte{0x7f, 'E', 'L', 'F', 0, 0, 1, 2, 3}, 0644)
+
+	result := NewEditFileTool(tmpDir, true).Execute(context.Background(), map[string]interface{}{
+		"path": testFile, "old_text": "ELF", "new_text": "FLE",
+	})
+	if !result.IsError || !strings.Contains(result.ForLLM, "binary file") {
+		t.Errorf("Expected edit_file to refuse a binary file, got: %q", result.ForLLM)
+	}
+	result = NewAppendFileTool(tmpDir, true).Execute(context.Background(), map[string]interface{}{
+		"path": testFile, "content": "more",
+	})
+	if !result.IsError || !strings.Contains(result.ForLLM, "binary file") {
+		t.Errorf("Expected append_file to refuse a binary file, got: %q", result.ForLLM)
+	}
+}
+
+// TestFilesystemTool_ReadFile_Encodings verifies UTF-16 and Latin-1 decoding
+func TestFilesystemTool_ReadFile_Encodings(t *testing.T) {
+	tmpDir := t.TempDir()
+	tool := &ReadFileTool{}
+
+	utf16File := filepath.Join(tmpDir, "utf16.txt")
+	os.WriteFile(utf16File, []byte{0xFF, 0xFE, 'h', 0, 'i', 0, '\n', 0}, 0644)
+	result := tool.Execute(context.Background(), map[string]interface{}{"path": utf16File})
+	if !strings.HasPrefix(result.ForLLM, "hi") || !strings.Contains(result.ForLLM, "UTF-16LE") {
+		t.Errorf("Expected decoded UTF-16 text, got: %q", result.ForLLM)
+	}
+
+	latin1File := filepath.Join(tmpDir, "latin1.txt")
+	os.WriteFile(latin1File, []byte("caf\xe9\n"), 0644)
+	result = tool.Execute(context.Background(), map[string]interface{}{"path": latin1File})
+	if !strings.HasPrefix(result.ForLLM, "café") {
+		t.Errorf("Expected Latin-1 text decoded to UTF-8, got: %q", result.ForLLM)
+	}
+}
+
+// TestFilesystemTool_ReadFile_LongLine verifies very long lines are cut
+func TestFilesystemTool_ReadFile_LongLine(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "long.txt")
+	os.WriteFile(testFile, []byte(strings.Repeat("a", 100000)+"\nend\n"), 0644)
+
+	tool := &ReadFileTool{}
+	result := tool.Execute(context.Background(), map[string]interface{}{"path": testFile})
+
+	if len(result.ForLLM) > 3000 {
+		t.Errorf("Expected long line to be truncated, got length %d", len(result.ForLLM))
+	}
+	if !strings.Contains(result.ForLLM, "\nend") {
+		t.Errorf("Expected following line to be kept, got: %q", result.ForLLM[len(result.ForLLM)-200:])
+	}
+}
+
 // TestFilesystemTool_ReadFile_MissingPath verifies error handling for missing path
 func TestFilesystemTool_ReadFile_MissingPath(t *testing.T) {
 	tool := &ReadFileTool{}
@@ -247,3 +446,93 @@ func TestFilesystemTool_ListDir_DefaultPath(t *testing.T) {
 		t.Errorf("Expected success with default path '.', got IsError=true: %s", result.ForLLM)
 	}
 }
+
+// TestValidatePath_Confinement verifies links in any parent directory are
+// followed and sibling directories sharing a prefix stay outside.
+func TestValidatePath_Confinement(t *testing.T) {
+	root := t.TempDir()
+	workspace := filepath.Join(root, "ws")
+	os.MkdirAll(workspace, 0755)
+	if err := os.Symlink(root, filepath.Join(workspace, "escape")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	for _, path := range []string{
+		filepath.Join(root, "ws-other", "file.txt"),
+		"escape/secret.txt",
+		"escape/new/dir/file.txt",
+	} {
+		if _, err := validatePath(path, workspace, true); err == nil {
+			t.Errorf("Expected %s to be outside the workspace", path)
+		}
+	}
+	if _, err := validatePath("new/dir/file.txt", workspace, true); err != nil {
+		t.Errorf("Expected a new file in the workspace to be allowed, got %v", err)
+	}
+}
+
+// TestWriteFileTool_SharedFolders verifies a restricted tool can use a
+// shared folder but nothing else outside the workspace.
+func TestWriteFileTool_SharedFolders(t *testing.T) {
+	root := t.TempDir()
+	workspace := filepath.Join(root, "ws")
+	shared := filepath.Join(root, "shared")
+	os.MkdirAll(workspace, 0755)
+	os.MkdirAll(shared, 0755)
+
+	tool := NewWriteFileTool(workspace, true)
+	tool.SetSharedFolders([]string{shared})
+	ctx := context.Background()
+
+	result := tool.Execute(ctx, map[string]interface{}{"path": filepath.Join(shared, "out.txt"), "content": "hi"})
+	if result.IsError {
+		t.Errorf("Expected a write to the shared folder to succeed, got %s", result.ForLLM)
+	}
+	result = tool.Execute(ctx, map[string]interface{}{"path": filepath.Join(root, "other.txt"), "content": "hi"})
+	if !result.IsError || !strings.Contains(result.ForLLM, "shared folders") {
+		t.Errorf("Expected a write outside both folders to be denied, got %s", result.ForLLM)
+	}
+}
+
+// TestWriteFileTool_DanglingLink verifies a write through a link to a file
+// that doesn't exist yet can't create it outside the workspace.
+func TestWriteFileTool_DanglingLink(t *testing.T) {
+	root := t.TempDir()
+	workspace := filepath.Join(root, "ws")
+	os.MkdirAll(workspace, 0755)
+	target := filepath.Join(root, "outside", "x")
+	os.MkdirAll(filepath.Dir(target), 0755)
+	if err := os.Symlink(target, filepath.Join(workspace, "link")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	tool := NewWriteFileTool(workspace, true)
+	result := tool.Execute(context.Background(), map[string]interface{}{"path": "link", "content": "pwned"})
+	if !result.IsError {
+		t.Errorf("Expected the write through the link to be denied, got %s", result.ForLLM)
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Errorf("Expected nothing written outside the workspace, got %v", err)
+	}
+}
+
+// TestWriteFileTool_DiskQuota verifies writes that do not fit the quota
+// fail without touching the file.
+func TestWriteFileTool_DiskQuota(t *testing.T) {
+	workspace := t.TempDir()
+	tool := NewWriteFileTool(workspace, true)
+	tool.SetQuota(quota.New(100, 90, quota.Area{Name: "workspace", Path: workspace}))
+	ctx := context.Background()
+
+	result := tool.Execute(ctx, map[string]interface{}{"path": "small.txt", "content": strings.Repeat("a", 60)})
+	if result.IsError {
+		t.Fatalf("Expected a small write to succeed, got %s", result.ForLLM)
+	}
+	result = tool.Execute(ctx, map[string]interface{}{"path": "big.txt", "content": strings.Repeat("b", 60)})
+	if !result.IsError || !strings.Contains(result.ForLLM, "quota") {
+		t.Errorf("Expected the write to be refused by the quota, got %s", result.ForLLM)
+	}
+	if _, err := os.Stat(filepath.Join(workspace, "big.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected big.txt not to be written, stat returned %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+const (
+	// degradeAfter is how many backend failures in a row mark a tool degraded.
+	degradeAfter = 3
+	// probeInterval is how often a degraded tool may be tried again.
+	probeInterval = 2 * time.Minute
+)
+
+// BackendError marks a tool failure caused by the service behind the tool
+// (a search API, a weather service) rather than by the call's arguments.
+// Repeated backend errors mark the tool degraded.
+type BackendError struct {
+	Backend string
+	Err     error
+}
+
+func (e *BackendError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Backend, e.Err)
+}
+
+func (e *BackendError) Unwrap() error {
+	return e.Err
+}
+
+// Unavailable wraps err as a BackendError for the named backend.
+func Unavailable(backend string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &BackendError{Backend: backend, Err: err}
+}
+
+// IsUnavailable reports whether err is marked as a backend failure.
+func IsUnavailable(err error) bool {
+	var be *BackendError
+	return errors.As(err, &be)
+}
+
+// toolHealth tracks backend failures of one tool.
+type toolHealth struct {
+	failures  int // consecutive backend failures
+	lastError string
+	since     time.Time // first failure of the current run
+	lastTry   time.Time
+}
+
+func (h *toolHealth) degraded() bool {
+	return h.failures >= degradeAfter
+}
+
+// note is added to a degraded tool's description so the model knows not to
+// rely on it.
+func (h *toolHealth) note() string {
+	return fmt.Sprintf("[DEGRADED: the backend has been failing since %s (%s). Calls are refused except for an occasional retry; prefer another approach or tell the user.] ",
+		h.since.Format("15:04"), h.lastError)
+}
+
+// checkHealth returns an error result if the tool is degraded and was tried
+// too recently, or nil if the call may go ahead. A call let through after
+// probeInterval checks whether the backend has recovered.
+func (r *ToolRegistry) checkHealth(name string, now time.Time) *ToolResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.tools[name]
+	if !ok || !entry.health.degraded() {
+		return nil
+	}
+	h := &entry.health
+	if now.Sub(h.lastTry) < probeInterval {
+		retry := h.lastTry.Add(probeInterval).Sub(now).Round(time.Second)
+		return ErrorResult(fmt.Sprintf("tool %q is unavailable: its backend has failed %d times in a row (%s). Not retrying for another %s.",
+			name, h.failures, h.lastError, retry))
+	}
+	h.lastTry = now
+	return nil
+}
+
+// recordHealth updates the tool's health from a call's result.
+func (r *ToolRegistry) recordHealth(name string, result *ToolResult, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.tools[name]
+	if !ok {
+		return
+	}
+	h := &entry.health
+	if result.IsError && IsUnavailable(result.Err) {
+		if h.failures == 0 {
+			h.since = now
+		}
+		h.failures++
+		h.lastError = result.Err.Error()
+		h.lastTry = now
+		if h.failures == degradeAfter {
+			logger.WarnCF("tool", "Tool marked degraded",
+				map[string]interface{}{
+					"tool":  name,
+					"error": h.lastError,
+				})
+		}
+		return
+	}
+	if result.IsError {
+		// Argument errors say nothing about the backend
+		return
+	}
+	if h.degraded() {
+		logger.InfoCF("tool", "Tool recovered",
+			map[string]interface{}{
+				"tool": name,
+			})
+	}
+	entry.health = toolHealth{}
+}
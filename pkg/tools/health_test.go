@@ -0,0 +1,73 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// flakyTool fails with a backend error while down is set.
+type flakyTool struct {
+	stubTool
+	down  bool
+	calls int
+}
+
+func (t *flakyTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	t.calls++
+	if t.down {
+		return ErrorResult("search failed").WithError(Unavailable("search API", errors.New("connection refused")))
+	}
+	return NewToolResult("ok")
+}
+
+// TestToolRegistry_DegradesFailingBackend verifies repeated backend errors
+// flag the tool in its description and stop further calls until a retry
+// is due.
+func TestToolRegistry_DegradesFailingBackend(t *testing.T) {
+	r := NewToolRegistry()
+	tool := &flakyTool{stubTool: stubTool{name: "web_search"}, down: true}
+	r.Register(tool)
+
+	for range degradeAfter {
+		r.Execute(context.Background(), "web_search", nil)
+	}
+	if desc := r.ToProviderDefs()[0].Function.Description; !strings.Contains(desc, "DEGRADED") {
+		t.Errorf("Expected degraded description, got %s", desc)
+	}
+
+	result := r.Execute(context.Background(), "web_search", nil)
+	if !result.IsError || !strings.Contains(result.ForLLM, "unavailable") {
+		t.Errorf("Expected call to be refused, got %s", result.ForLLM)
+	}
+	if tool.calls != degradeAfter {
+		t.Errorf("Expected %d calls to reach the tool, got %d", degradeAfter, tool.calls)
+	}
+
+	// Once the probe interval has passed, a call gets through and a
+	// success clears the degraded state
+	tool.down = false
+	r.tools["web_search"].health.lastTry = time.Now().Add(-probeInterval)
+	if result := r.Execute(context.Background(), "web_search", nil); result.IsError {
+		t.Fatalf("Expected probe call to succeed, got %s", result.ForLLM)
+	}
+	if desc := r.ToProviderDefs()[0].Function.Description; strings.Contains(desc, "DEGRADED") {
+		t.Errorf("Expected tool to recover, got %s", desc)
+	}
+}
+
+// TestToolRegistry_ArgumentErrorsDoNotDegrade verifies ordinary errors
+// leave the tool healthy.
+func TestToolRegistry_ArgumentErrorsDoNotDegrade(t *testing.T) {
+	r := NewToolRegistry()
+	r.Register(&stubTool{name: "read_file"})
+
+	for range degradeAfter + 1 {
+		r.recordHealth("read_file", ErrorResult("path is required"), time.Now())
+	}
+	if r.tools["read_file"].health.degraded() {
+		t.Error("Expected argument errors not to degrade the tool")
+	}
+}
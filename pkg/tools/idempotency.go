@@ -0,0 +1,132 @@
+package tools
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// SideEffectTool is an optional interface for tools whose calls are visible
+// outside picoclaw (chat messages, emails, notifications, calendar events).
+// A repeated identical call within the same agent turn is answered from the
+// idempotency store instead of running again, so a retry cannot send twice.
+type SideEffectTool interface {
+	Tool
+	HasSideEffects() bool
+}
+
+type turnIDKey struct{}
+
+// WithTurnID returns a context carrying the ID of the current agent turn.
+func WithTurnID(ctx context.Context, turnID string) context.Context {
+	return context.WithValue(ctx, turnIDKey{}, turnID)
+}
+
+// TurnIDFromContext returns the turn ID set by WithTurnID, or "".
+func TurnIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(turnIDKey{}).(string)
+	return id
+}
+
+// IdempotencyKey identifies one side-effecting call within a turn.
+// Arguments are hashed via JSON, which orders map keys deterministically.
+func IdempotencyKey(turnID, tool string, args map[string]interface{}) string {
+	argsJSON, _ := json.Marshal(args)
+	h := sha256.New()
+	h.Write([]byte(turnID))
+	h.Write([]byte{0})
+	h.Write([]byte(tool))
+	h.Write([]byte{0})
+	h.Write(argsJSON)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+type idempotencyRecord struct {
+	Tool   string    `json:"tool"`
+	Result string    `json:"result"`
+	Time   time.Time `json:"time"`
+}
+
+// IdempotencyStore remembers completed side-effecting calls on disk so that
+// they are not repeated, even when a turn is retried after a restart.
+type IdempotencyStore struct {
+	mu      sync.Mutex
+	path    string
+	ttl     time.Duration
+	records map[string]idempotencyRecord
+}
+
+// NewIdempotencyStore loads the store at path. Records older than ttl are
+// dropped. An empty path keeps records in memory only.
+func NewIdempotencyStore(path string, ttl time.Duration) *IdempotencyStore {
+	s := &IdempotencyStore{
+		path:    path,
+		ttl:     ttl,
+		records: make(map[string]idempotencyRecord),
+	}
+	if path != "" {
+		if data, err := os.ReadFile(path); err == nil {
+			_ = json.Unmarshal(data, &s.records)
+		}
+	}
+	s.pruneLocked(time.Now())
+	return s
+}
+
+// Lookup returns the result recorded for key, if any.
+func (s *IdempotencyStore) Lookup(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.records[key]
+	if !ok || (s.ttl > 0 && time.Since(rec.Time) > s.ttl) {
+		return "", false
+	}
+	return rec.Result, true
+}
+
+// Record stores the result of a completed call and persists the store.
+func (s *IdempotencyStore) Record(key, tool, result string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.pruneLocked(now)
+	s.records[key] = idempotencyRecord{Tool: tool, Result: result, Time: now}
+	return s.saveLocked()
+}
+
+// pruneLocked drops expired records. Must be called with the lock held.
+func (s *IdempotencyStore) pruneLocked(now time.Time) {
+	if s.ttl <= 0 {
+		return
+	}
+	for key, rec := range s.records {
+		if now.Sub(rec.Time) > s.ttl {
+			delete(s.records, key)
+		}
+	}
+}
+
+// saveLocked writes the store atomically. Must be called with the lock held.
+func (s *IdempotencyStore) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(s.records)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -0,0 +1,57 @@
+package tools
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// sendTool counts how often it runs and reports side effects.
+type sendTool struct {
+	stubTool
+	sent int
+}
+
+func (t *sendTool) HasSideEffects() bool { return true }
+func (t *sendTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	t.sent++
+	return NewToolResult("sent")
+}
+
+// TestIdempotency_SkipsRepeatWithinTurn verifies an identical side-effecting
+// call in the same turn runs once, while other turns and arguments still run
+func TestIdempotency_SkipsRepeatWithinTurn(t *testing.T) {
+	storePath := filepath.Join(t.TempDir(), "idempotency.json")
+	tool := &sendTool{stubTool: stubTool{name: "send_email"}}
+	r := NewToolRegistry()
+	r.Register(tool)
+	r.SetIdempotencyStore(NewIdempotencyStore(storePath, time.Hour))
+
+	args := map[string]interface{}{"to": "a@example.com", "body": "hi"}
+	turn := WithTurnID(context.Background(), "turn-1")
+
+	r.Execute(turn, "send_email", args)
+	result := r.Execute(turn, "send_email", args)
+	if tool.sent != 1 {
+		t.Errorf("Expected 1 send within the turn, got %d", tool.sent)
+	}
+	if result.IsError {
+		t.Errorf("Expected skipped call to succeed, got error: %s", result.ForLLM)
+	}
+
+	r.Execute(turn, "send_email", map[string]interface{}{"to": "b@example.com", "body": "hi"})
+	r.Execute(WithTurnID(context.Background(), "turn-2"), "send_email", args)
+	if tool.sent != 3 {
+		t.Errorf("Expected different args and turns to send, got %d sends", tool.sent)
+	}
+
+	// A restart reloads the store, so a redelivered turn still does not resend
+	r2 := NewToolRegistry()
+	r2.Register(tool)
+	r2.SetIdempotencyStore(NewIdempotencyStore(storePath, time.Hour))
+	r2.Execute(turn, "send_email", args)
+	if tool.sent != 3 {
+		t.Errorf("Expected persisted key to prevent resend, got %d sends", tool.sent)
+	}
+}
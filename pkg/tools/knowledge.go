@@ -0,0 +1,108 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/knowledge"
+)
+
+const (
+	defaultKnowledgeResults = 5
+	maxKnowledgeResults     = 20
+)
+
+// KnowledgeSearchTool searches the documents added with picoclaw ingest
+// and returns passages with their source and page, for the model to quote
+// and cite.
+type KnowledgeSearchTool struct {
+	store *knowledge.Store
+}
+
+func NewKnowledgeSearchTool(store *knowledge.Store) *KnowledgeSearchTool {
+	return &KnowledgeSearchTool{store: store}
+}
+
+func (t *KnowledgeSearchTool) Name() string {
+	return "knowledge_search"
+}
+
+func (t *KnowledgeSearchTool) Description() string {
+	return "Search the documents the user has added to the knowledge base (manuals, papers, notes, web pages) for passages about a question. " +
+		"Each passage comes with its source and page: base answers on them and cite them, e.g. [manual.pdf, Page 12]. " +
+		"Say so if nothing relevant is found rather than guessing."
+}
+
+func (t *KnowledgeSearchTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"query": map[string]interface{}{
+				"type":        "string",
+				"description": "What to look for, as a question or keywords",
+			},
+			"source": map[string]interface{}{
+				"type":        "string",
+				"description": "Only search documents whose path or URL contains this, e.g. a file name",
+			},
+			"limit": map[string]interface{}{
+				"type":        "integer",
+				"description": fmt.Sprintf("Number of passages (default %d, max %d)", defaultKnowledgeResults, maxKnowledgeResults),
+			},
+		},
+		"required": []string{"query"},
+	}
+}
+
+func (t *KnowledgeSearchTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	query, _ := args["query"].(string)
+	if strings.TrimSpace(query) == "" {
+		return ErrorResult("query is required")
+	}
+	source, _ := args["source"].(string)
+	limit := defaultKnowledgeResults
+	if v, ok := args["limit"].(float64); ok && v >= 1 {
+		limit = min(int(v), maxKnowledgeResults)
+	}
+
+	docs := t.store.Documents()
+	if len(docs) == 0 {
+		return NewToolResult("The knowledge base is empty. Documents are added with `picoclaw ingest <path|url>`.")
+	}
+	results, err := t.store.Search(ctx, query, source, limit)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("knowledge search failed: %v", err)).WithError(err)
+	}
+	if len(results) == 0 {
+		msg := fmt.Sprintf("No passages match %q in %d documents.", query, len(docs))
+		if source != "" {
+			msg = fmt.Sprintf("No passages match %q in documents from %q.", query, source)
+		}
+		return NewToolResult(msg).WithData(map[string]interface{}{"results": results})
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d passages for %q (cite as [source, page]):\n", len(results), query)
+	for i, r := range results {
+		fmt.Fprintf(&sb, "\n[%d] %s (score %.2f)\n%s\n", i+1, citation(r), r.Score, r.Text)
+	}
+	return NewToolResult(strings.TrimRight(sb.String(), "\n")).WithData(map[string]interface{}{"results": results})
+}
+
+// citation names where a passage is from, e.g. "manual.pdf, Page 12"; web
+// pages keep their URL.
+func citation(r knowledge.Result) string {
+	source := r.Source
+	if !strings.Contains(source, "://") {
+		source = filepath.Base(source)
+	}
+	if r.Title != "" && r.Title != source {
+		source = fmt.Sprintf("%s (%s)", source, r.Title)
+	}
+	if r.Page != "" {
+		source += ", " + r.Page
+	}
+	return source
+}
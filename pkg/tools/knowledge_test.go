@@ -0,0 +1,51 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/knowledge"
+)
+
+// TestKnowledgeSearchTool verifies passages come with a citation of their
+// source and page
+func TestKnowledgeSearchTool(t *testing.T) {
+	store := knowledge.NewStore(t.TempDir(), nil, knowledge.Options{})
+	tool := NewKnowledgeSearchTool(store)
+	ctx := context.Background()
+
+	result := tool.Execute(ctx, map[string]interface{}{"query": "reset"})
+	if result.IsError || !strings.Contains(result.ForLLM, "picoclaw ingest") {
+		t.Errorf("Expected a note that nothing is ingested, got %q", result.ForLLM)
+	}
+
+	store.Ingest(ctx, knowledge.Document{Source: "/home/pi/docs/router.pdf", Title: "Router manual"}, []knowledge.Page{
+		{Label: "Page 1", Text: "Welcome to your new router."},
+		{Label: "Page 12", Text: "To reset the router, hold the reset button for ten seconds."},
+	})
+	store.Ingest(ctx, knowledge.Document{Source: "https://example.com/faq", Title: "example.com"}, []knowledge.Page{
+		{Text: "A reset keeps your wifi name."},
+	})
+
+	result = tool.Execute(ctx, map[string]interface{}{"query": "reset the router", "limit": float64(1)})
+	if result.IsError {
+		t.Fatalf("Expected results, got %q", result.ForLLM)
+	}
+	if !strings.Contains(result.ForLLM, "[1] router.pdf (Router manual), Page 12") || !strings.Contains(result.ForLLM, "ten seconds") {
+		t.Errorf("Expected page 12 cited by file name, got %q", result.ForLLM)
+	}
+	if strings.Contains(result.ForLLM, "[2]") {
+		t.Errorf("Expected one passage, got %q", result.ForLLM)
+	}
+
+	result = tool.Execute(ctx, map[string]interface{}{"query": "reset", "source": "example.com"})
+	if !strings.Contains(result.ForLLM, "https://example.com/faq (example.com)") || strings.Contains(result.ForLLM, "router.pdf") {
+		t.Errorf("Expected only the web page, cited by URL, got %q", result.ForLLM)
+	}
+
+	result = tool.Execute(ctx, map[string]interface{}{"query": "bluetooth"})
+	if result.IsError || !strings.Contains(result.ForLLM, "No passages") {
+		t.Errorf("Expected no passages, got %q", result.ForLLM)
+	}
+}
@@ -0,0 +1,121 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/geo"
+)
+
+// LocationTool resolves place names and addresses to coordinates and back,
+// and reports the time zone, local time and sunrise and sunset there. The
+// coordinates it returns can be passed to other tools such as weather.
+type LocationTool struct {
+	geocoder *geo.Client
+}
+
+// NewLocationTool returns a location tool using geocoder, which is meant to
+// be shared with other tools so lookups are cached once.
+func NewLocationTool(geocoder *geo.Client) *LocationTool {
+	if geocoder == nil {
+		geocoder = geo.NewClient()
+	}
+	return &LocationTool{geocoder: geocoder}
+}
+
+func (t *LocationTool) Name() string {
+	return "location"
+}
+
+func (t *LocationTool) Description() string {
+	return "Look up a place name or address and get its coordinates, time zone, local time and today's sunrise and sunset; or give latitude and longitude to find what place is there."
+}
+
+func (t *LocationTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"query": map[string]interface{}{
+				"type":        "string",
+				"description": "Place name (e.g., 'Tampa,FL', 'Kyoto'), ZIP code or street address",
+			},
+			"latitude": map[string]interface{}{
+				"type":        "number",
+				"description": "For a reverse lookup, with longitude",
+			},
+			"longitude": map[string]interface{}{
+				"type":        "number",
+				"description": "For a reverse lookup, with latitude",
+			},
+		},
+		"required": []string{},
+	}
+}
+
+func (t *LocationTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	query, _ := args["query"].(string)
+	lat, hasLat := args["latitude"].(float64)
+	lon, hasLon := args["longitude"].(float64)
+
+	var place geo.Place
+	var err error
+	switch {
+	case hasLat && hasLon:
+		if lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+			return ErrorResult("latitude must be within -90..90 and longitude within -180..180")
+		}
+		place, err = t.geocoder.Reverse(ctx, lat, lon)
+	case strings.TrimSpace(query) != "":
+		place, err = t.geocoder.Search(ctx, query)
+	default:
+		return ErrorResult("query, or latitude and longitude, is required")
+	}
+	if errors.Is(err, geo.ErrNotFound) {
+		return ErrorResult(err.Error())
+	}
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(Unavailable("geocoding", err))
+	}
+
+	if place.Timezone == "" {
+		// Not fatal: the sun times are then given in UTC
+		place.Timezone, _ = t.geocoder.Timezone(ctx, place.Lat, place.Lon)
+	}
+	return NewToolResult(describePlace(place, time.Now()))
+}
+
+// describePlace renders a place with its local time and sun times at now.
+func describePlace(place geo.Place, now time.Time) string {
+	var sb strings.Builder
+	sb.WriteString(place.Label())
+	if place.Country != "" && place.Country != place.Name {
+		sb.WriteString(", " + place.Country)
+	}
+	fmt.Fprintf(&sb, "\nCoordinates: %s", geo.FormatCoordinates(place.Lat, place.Lon))
+	if place.Address != "" {
+		fmt.Fprintf(&sb, "\nAddress: %s", place.Address)
+	}
+
+	loc, zone := time.UTC, "UTC"
+	if place.Timezone != "" {
+		if tz, err := time.LoadLocation(place.Timezone); err == nil {
+			loc, zone = tz, "local time"
+		}
+		fmt.Fprintf(&sb, "\nTime zone: %s", place.Timezone)
+		if loc != time.UTC {
+			fmt.Fprintf(&sb, ", local time %s", now.In(loc).Format("Mon Jan 2 15:04"))
+		}
+	}
+
+	today := now.In(loc)
+	rise, set, ok := geo.SunTimes(today, place.Lat, place.Lon)
+	if ok {
+		fmt.Fprintf(&sb, "\nSunrise %s, sunset %s (%s)", rise.In(loc).Format("15:04"), set.In(loc).Format("15:04"), zone)
+	} else {
+		sb.WriteString("\nThe sun does not rise or set today (polar day or night).")
+	}
+	return sb.String()
+}
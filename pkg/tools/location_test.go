@@ -0,0 +1,51 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/geo"
+)
+
+// TestDescribePlace verifies the place is shown with coordinates that other
+// tools accept, and with local sun times when the time zone is known.
+func TestDescribePlace(t *testing.T) {
+	place := geo.Place{Name: "London", Region: "England", Country: "United Kingdom", Lat: 51.5074, Lon: -0.1278}
+	now := time.Date(2026, 6, 21, 12, 0, 0, 0, time.UTC)
+
+	got := describePlace(place, now)
+	if !strings.Contains(got, "London, England, United Kingdom\nCoordinates: 51.5074,-0.1278") {
+		t.Errorf("Expected the label and coordinates, got %q", got)
+	}
+	if !strings.Contains(got, "Sunrise 03:4") || !strings.Contains(got, "(UTC)") {
+		t.Errorf("Expected sun times in UTC without a time zone, got %q", got)
+	}
+	if lat, lon, ok := geo.ParseCoordinates("51.5074,-0.1278"); !ok || lat != place.Lat || lon != place.Lon {
+		t.Errorf("Expected the coordinates to parse back, got %v,%v", lat, lon)
+	}
+
+	if _, err := time.LoadLocation("Europe/London"); err != nil {
+		t.Skip("time zone database not available")
+	}
+	place.Timezone = "Europe/London"
+	got = describePlace(place, now)
+	if !strings.Contains(got, "local time Sun Jun 21 13:00") || !strings.Contains(got, "Sunrise 04:4") {
+		t.Errorf("Expected local times in BST, got %q", got)
+	}
+}
+
+// TestLocationTool_Arguments verifies a query or both coordinates are needed.
+func TestLocationTool_Arguments(t *testing.T) {
+	tool := NewLocationTool(nil)
+	for _, args := range []map[string]interface{}{
+		{},
+		{"latitude": 10.0},
+		{"latitude": 95.0, "longitude": 10.0},
+	} {
+		if result := tool.Execute(context.Background(), args); !result.IsError {
+			t.Errorf("Expected an error for %v, got %q", args, result.ForLLM)
+		}
+	}
+}
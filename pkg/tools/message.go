@@ -3,9 +3,27 @@ package tools
 import (
 	"context"
 	"fmt"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
 )
 
-type SendCallback func(channel, chatID, content string) error
+// SendCallback delivers a message. urgency is empty for replies and set for
+// messages sent from proactive turns (heartbeat, scheduled jobs).
+type SendCallback func(channel, chatID, content string, urgency bus.Urgency) error
+
+type urgencyKey struct{}
+
+// WithUrgency marks ctx as a proactive turn whose messages have urgency u,
+// so they can be held during the user's quiet hours.
+func WithUrgency(ctx context.Context, u bus.Urgency) context.Context {
+	return context.WithValue(ctx, urgencyKey{}, u)
+}
+
+// UrgencyFromContext returns the urgency set by WithUrgency, or "".
+func UrgencyFromContext(ctx context.Context) bus.Urgency {
+	u, _ := ctx.Value(urgencyKey{}).(bus.Urgency)
+	return u
+}
 
 type MessageTool struct {
 	sendCallback   SendCallback
@@ -42,11 +60,22 @@ func (t *MessageTool) Parameters() map[string]interface{} {
 				"type":        "string",
 				"description": "Optional: target chat/user ID",
 			},
+			"urgency": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"low", "normal", "high", "critical"},
+				"description": "Optional, for heartbeat and scheduled tasks only: messages below the user's break-through level (usually high) wait until their quiet hours end. Use critical only for what cannot wait, e.g. a severe weather warning or a UPS running on battery",
+			},
 		},
 		"required": []string{"content"},
 	}
 }
 
+// HasSideEffects marks sends as externally visible, so identical sends
+// within one turn are deduplicated by the registry.
+func (t *MessageTool) HasSideEffects() bool {
+	return true
+}
+
 func (t *MessageTool) SetContext(channel, chatID string) {
 	t.defaultChannel = channel
 	t.defaultChatID = chatID
@@ -86,7 +115,14 @@ func (t *MessageTool) Execute(ctx context.Context, args map[string]interface{})
 		return &ToolResult{ForLLM: "Message sending not configured", IsError: true}
 	}
 
-	if err := t.sendCallback(channel, chatID, content); err != nil {
+	// Replies to the user are never held, whatever the model asks for
+	urgency := UrgencyFromContext(ctx)
+	requested, _ := args["urgency"].(string)
+	if u, ok := bus.ParseUrgency(requested); ok && urgency != "" {
+		urgency = u
+	}
+
+	if err := t.sendCallback(channel, chatID, content, urgency); err != nil {
 		return &ToolResult{
 			ForLLM:  fmt.Sprintf("sending message: %v", err),
 			IsError: true,
@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
 )
 
 func TestMessageTool_Execute_Success(t *testing.T) {
@@ -11,7 +13,7 @@ func TestMessageTool_Execute_Success(t *testing.T) {
 	tool.SetContext("test-channel", "test-chat-id")
 
 	var sentChannel, sentChatID, sentContent string
-	tool.SetSendCallback(func(channel, chatID, content string) error {
+	tool.SetSendCallback(func(channel, chatID, content string, urgency bus.Urgency) error {
 		sentChannel = channel
 		sentChatID = chatID
 		sentContent = content
@@ -63,7 +65,7 @@ func TestMessageTool_Execute_WithCustomChannel(t *testing.T) {
 	tool.SetContext("default-channel", "default-chat-id")
 
 	var sentChannel, sentChatID string
-	tool.SetSendCallback(func(channel, chatID, content string) error {
+	tool.SetSendCallback(func(channel, chatID, content string, urgency bus.Urgency) error {
 		sentChannel = channel
 		sentChatID = chatID
 		return nil
@@ -99,7 +101,7 @@ func TestMessageTool_Execute_SendFailure(t *testing.T) {
 	tool.SetContext("test-channel", "test-chat-id")
 
 	sendErr := errors.New("network error")
-	tool.SetSendCallback(func(channel, chatID, content string) error {
+	tool.SetSendCallback(func(channel, chatID, content string, urgency bus.Urgency) error {
 		return sendErr
 	})
 
@@ -153,7 +155,7 @@ func TestMessageTool_Execute_NoTargetChannel(t *testing.T) {
 	tool := NewMessageTool()
 	// No SetContext called, so defaultChannel and defaultChatID are empty
 
-	tool.SetSendCallback(func(channel, chatID, content string) error {
+	tool.SetSendCallback(func(channel, chatID, content string, urgency bus.Urgency) error {
 		return nil
 	})
 
@@ -257,3 +259,30 @@ func TestMessageTool_Parameters(t *testing.T) {
 		t.Error("Expected chat_id type to be 'string'")
 	}
 }
+
+// TestMessageTool_Urgency verifies messages from proactive turns carry an
+// urgency the model may raise, while replies never do.
+func TestMessageTool_Urgency(t *testing.T) {
+	var got bus.Urgency
+	tool := NewMessageTool()
+	tool.SetContext("telegram", "1")
+	tool.SetSendCallback(func(channel, chatID, content string, urgency bus.Urgency) error {
+		got = urgency
+		return nil
+	})
+	args := map[string]interface{}{"content": "Storm warning", "urgency": "critical"}
+
+	tool.Execute(context.Background(), args)
+	if got != "" {
+		t.Errorf("Expected a reply to have no urgency, got %q", got)
+	}
+	heartbeat := WithUrgency(context.Background(), bus.UrgencyNormal)
+	tool.Execute(heartbeat, args)
+	if got != bus.UrgencyCritical {
+		t.Errorf("Expected critical, got %q", got)
+	}
+	tool.Execute(heartbeat, map[string]interface{}{"content": "All good"})
+	if got != bus.UrgencyNormal {
+		t.Errorf("Expected the turn's urgency, got %q", got)
+	}
+}
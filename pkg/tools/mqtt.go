@@ -0,0 +1,285 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/mqtt"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const (
+	mqttTimeout         = 15 * time.Second
+	defaultMQTTWait     = 3
+	maxMQTTWait         = 30
+	maxMQTTMessages     = 20
+	maxMQTTPayloadChars = 2000
+	// mqttQuiet ends a read early once messages stop arriving, so reading
+	// retained state doesn't wait out the whole period.
+	mqttQuiet = 500 * time.Millisecond
+)
+
+// MQTTTool publishes to and reads from an MQTT broker, such as the one a
+// home-automation system runs. It connects on first use and stays
+// connected.
+type MQTTTool struct {
+	opts         mqtt.Options
+	allowPublish []string
+
+	readMu sync.Mutex // one read at a time, so each sees its own retained messages
+
+	mu      sync.Mutex // guards client and the read in progress
+	client  *mqtt.Client
+	filter  string
+	reading chan mqtt.Message
+}
+
+// NewMQTTTool creates the tool. allowPublish, if not empty, are the only
+// topic filters it may publish to.
+func NewMQTTTool(opts mqtt.Options, allowPublish []string) *MQTTTool {
+	t := &MQTTTool{allowPublish: allowPublish}
+	opts.OnMessage = t.deliver
+	t.opts = opts
+	return t
+}
+
+func (t *MQTTTool) Name() string {
+	return "mqtt"
+}
+
+func (t *MQTTTool) Description() string {
+	desc := "Talk to the MQTT broker that home-automation devices use. " +
+		"publish sends a payload to a topic (e.g. to switch a device, publish \"ON\" to its command topic; retain keeps it as the topic's state). " +
+		"read subscribes to a topic filter (+ matches one level, # any at the end) for a few seconds and returns what arrives, " +
+		"including the stored state of retained topics, e.g. read \"home/+/temperature\"."
+	if len(t.allowPublish) > 0 {
+		desc += " Publishing is only allowed to: " + strings.Join(t.allowPublish, ", ") + "."
+	}
+	return desc
+}
+
+func (t *MQTTTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type": "string",
+				"enum": []string{"publish", "read"},
+			},
+			"topic": map[string]interface{}{
+				"type":        "string",
+				"description": "Topic to publish to, or topic filter to read",
+			},
+			"payload": map[string]interface{}{
+				"type":        "string",
+				"description": "Message to publish",
+			},
+			"retain": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Keep the message as the topic's current value (for publish)",
+			},
+			"wait": map[string]interface{}{
+				"type":        "integer",
+				"description": fmt.Sprintf("Seconds to listen for messages (for read; default %d, at most %d)", defaultMQTTWait, maxMQTTWait),
+			},
+		},
+		"required": []string{"action", "topic"},
+	}
+}
+
+// ConfirmationSummary describes the action, for users who approve each one.
+func (t *MQTTTool) ConfirmationSummary(args map[string]interface{}) string {
+	action, _ := args["action"].(string)
+	topic, _ := args["topic"].(string)
+	if action != "publish" {
+		return action + " " + topic
+	}
+	payload, _ := args["payload"].(string)
+	summary := fmt.Sprintf("publish %q to %s", utils.Truncate(payload, 100), topic)
+	if retain, _ := args["retain"].(bool); retain {
+		summary += " (retained)"
+	}
+	return summary
+}
+
+func (t *MQTTTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	action, _ := args["action"].(string)
+	topic, _ := args["topic"].(string)
+	if topic == "" {
+		return ErrorResult("topic is required")
+	}
+	switch action {
+	case "publish":
+		return t.publish(ctx, topic, args)
+	case "read":
+		return t.read(ctx, topic, args)
+	}
+	return ErrorResult(fmt.Sprintf("unknown action %q: use publish or read", action))
+}
+
+func (t *MQTTTool) publish(ctx context.Context, topic string, args map[string]interface{}) *ToolResult {
+	if err := mqtt.ValidTopic(topic); err != nil {
+		return ErrorResult(err.Error())
+	}
+	if !t.publishAllowed(topic) {
+		return ErrorResult(fmt.Sprintf("publishing to %s is not allowed; allowed topics: %s", topic, strings.Join(t.allowPublish, ", ")))
+	}
+	payload, _ := args["payload"].(string)
+	retain, _ := args["retain"].(bool)
+
+	ctx, cancel := context.WithTimeout(ctx, mqttTimeout)
+	defer cancel()
+	client, err := t.connect(ctx)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to connect to the MQTT broker: %v", err)).WithError(err)
+	}
+	if err := client.Publish(ctx, topic, []byte(payload), 1, retain); err != nil {
+		return ErrorResult(fmt.Sprintf("publishing to %s failed: %v", topic, err)).WithError(err)
+	}
+	done := fmt.Sprintf("Published %d bytes to %s", len(payload), topic)
+	if retain {
+		done += " (retained)"
+	}
+	return NewToolResult(done)
+}
+
+func (t *MQTTTool) publishAllowed(topic string) bool {
+	if len(t.allowPublish) == 0 {
+		return true
+	}
+	for _, filter := range t.allowPublish {
+		if mqtt.Match(filter, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *MQTTTool) read(ctx context.Context, filter string, args map[string]interface{}) *ToolResult {
+	if err := mqtt.ValidFilter(filter); err != nil {
+		return ErrorResult(err.Error())
+	}
+	wait := defaultMQTTWait
+	if w, ok := args["wait"].(float64); ok && w > 0 {
+		wait = min(int(w), maxMQTTWait)
+	}
+
+	t.readMu.Lock()
+	defer t.readMu.Unlock()
+	dialCtx, cancel := context.WithTimeout(ctx, mqttTimeout)
+	defer cancel()
+	client, err := t.connect(dialCtx)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to connect to the MQTT broker: %v", err)).WithError(err)
+	}
+
+	messages := make(chan mqtt.Message, maxMQTTMessages)
+	t.mu.Lock()
+	t.filter, t.reading = filter, messages
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		t.filter, t.reading = "", nil
+		t.mu.Unlock()
+	}()
+	if err := client.Subscribe(dialCtx, mqtt.Subscription{Filter: filter, QoS: 1}); err != nil {
+		return ErrorResult(fmt.Sprintf("subscribing to %s failed: %v", filter, err)).WithError(err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mqttTimeout)
+		defer cancel()
+		client.Unsubscribe(ctx, filter)
+	}()
+
+	var got []mqtt.Message
+	deadline := time.NewTimer(time.Duration(wait) * time.Second)
+	defer deadline.Stop()
+	var quiet <-chan time.Time
+collect:
+	for len(got) < maxMQTTMessages {
+		select {
+		case msg := <-messages:
+			got = append(got, msg)
+			quiet = time.After(mqttQuiet)
+		case <-quiet:
+			break collect
+		case <-deadline.C:
+			break collect
+		case <-client.Done():
+			break collect
+		case <-ctx.Done():
+			return ErrorResult("read cancelled")
+		}
+	}
+
+	if len(got) == 0 {
+		return NewToolResult(fmt.Sprintf("No messages on %s within %d seconds", filter, wait))
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d messages on %s:\n", len(got), filter)
+	for _, msg := range got {
+		fmt.Fprintf(&b, "%s: %s", msg.Topic, mqttPayload(msg.Payload))
+		if msg.Retained {
+			b.WriteString(" (retained)")
+		}
+		b.WriteString("\n")
+	}
+	if len(got) == maxMQTTMessages {
+		fmt.Fprintf(&b, "(stopped after %d messages; read a narrower topic for more)\n", maxMQTTMessages)
+	}
+	return NewToolResult(strings.TrimRight(b.String(), "\n"))
+}
+
+// mqttPayload shows a payload as text when it is text.
+func mqttPayload(payload []byte) string {
+	switch {
+	case len(payload) == 0:
+		return "(empty)"
+	case !utf8.Valid(payload):
+		return fmt.Sprintf("[%d bytes of binary data]", len(payload))
+	}
+	return utils.Truncate(string(payload), maxMQTTPayloadChars)
+}
+
+// deliver hands a received message to the read in progress.
+func (t *MQTTTool) deliver(msg mqtt.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.reading == nil || !mqtt.Match(t.filter, msg.Topic) {
+		return
+	}
+	select {
+	case t.reading <- msg:
+	default:
+	}
+}
+
+// connect returns the connection to the broker, dialing it again if it
+// was lost.
+func (t *MQTTTool) connect(ctx context.Context) (*mqtt.Client, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.client != nil && t.client.Err() == nil {
+		return t.client, nil
+	}
+	client, err := mqtt.Dial(ctx, t.opts)
+	if err != nil {
+		return nil, err
+	}
+	t.client = client
+	return client, nil
+}
+
+// Close disconnects from the broker.
+func (t *MQTTTool) Close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.client != nil {
+		t.client.Close()
+		t.client = nil
+	}
+}
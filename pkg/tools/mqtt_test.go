@@ -0,0 +1,53 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/mqtt"
+	"github.com/sipeed/picoclaw/pkg/mqtt/mqtttest"
+)
+
+// TestMQTTTool verifies publishing within the allowed topics, and reading
+// retained state from a topic filter
+func TestMQTTTool(t *testing.T) {
+	broker := mqtttest.NewBroker(t)
+	broker.Publish("home/kitchen/temperature", "21.5", true)
+	broker.Publish("home/hall/temperature", "19", true)
+	broker.Publish("home/hall/humidity", "40", true)
+	tool := NewMQTTTool(mqtt.Options{Broker: broker.URL()}, []string{"home/+/set"})
+	defer tool.Close()
+	ctx := context.Background()
+
+	result := tool.Execute(ctx, map[string]interface{}{"action": "publish", "topic": "home/lamp/set", "payload": "ON", "retain": true})
+	if result.IsError || result.ForLLM != "Published 2 bytes to home/lamp/set (retained)" {
+		t.Fatalf("Unexpected result %q", result.ForLLM)
+	}
+	if msgs := broker.Messages(); len(msgs) != 1 || msgs[0].Topic != "home/lamp/set" || msgs[0].Payload != "ON" || !msgs[0].Retained {
+		t.Errorf("Unexpected messages %+v", msgs)
+	}
+	result = tool.Execute(ctx, map[string]interface{}{"action": "publish", "topic": "home/lock/unlock", "payload": "1"})
+	if !result.IsError || !strings.Contains(result.ForLLM, "not allowed") {
+		t.Errorf("Expected a topic outside the allowlist refused, got %q", result.ForLLM)
+	}
+
+	result = tool.Execute(ctx, map[string]interface{}{"action": "read", "topic": "home/+/temperature", "wait": float64(5)})
+	if result.IsError || !strings.HasPrefix(result.ForLLM, "2 messages on home/+/temperature:") ||
+		!strings.Contains(result.ForLLM, "home/kitchen/temperature: 21.5 (retained)") ||
+		!strings.Contains(result.ForLLM, "home/hall/temperature: 19 (retained)") {
+		t.Errorf("Expected the retained temperatures, got %q", result.ForLLM)
+	}
+	if n := broker.Subscribers("home/+/temperature"); n != 0 {
+		t.Errorf("Expected the read to unsubscribe, %d still subscribed", n)
+	}
+	result = tool.Execute(ctx, map[string]interface{}{"action": "read", "topic": "garden/#", "wait": float64(1)})
+	if result.ForLLM != "No messages on garden/# within 1 seconds" {
+		t.Errorf("Unexpected result %q", result.ForLLM)
+	}
+
+	summary := tool.ConfirmationSummary(map[string]interface{}{"action": "publish", "topic": "home/lamp/set", "payload": "ON", "retain": true})
+	if summary != `publish "ON" to home/lamp/set (retained)` {
+		t.Errorf("Unexpected confirmation summary %q", summary)
+	}
+}
@@ -0,0 +1,104 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/notify"
+)
+
+// NotifyTool alerts the user outside of chats: on the desktop, or on their
+// phone through a push service.
+type NotifyTool struct {
+	notifier *notify.Notifier
+}
+
+// NewNotifyTool creates the tool for the notifier's targets.
+func NewNotifyTool(notifier *notify.Notifier) *NotifyTool {
+	return &NotifyTool{notifier: notifier}
+}
+
+func (t *NotifyTool) Name() string {
+	return "notify"
+}
+
+func (t *NotifyTool) Description() string {
+	return "Send the user a notification (" + strings.Join(t.notifier.Targets(), ", ") + "), which reaches them even when no chat is open. " +
+		"Use it for alerts that matter, such as a finished long task, a reminder or something that needs attention; " +
+		"answer questions in the chat as usual. Keep the message short."
+}
+
+func (t *NotifyTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"message": map[string]interface{}{
+				"type":        "string",
+				"description": "The notification text",
+			},
+			"title": map[string]interface{}{
+				"type":        "string",
+				"description": "A short title (default \"picoclaw\")",
+			},
+			"priority": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"low", "normal", "high", "urgent"},
+				"description": "How insistent the notification is (default normal); urgent may bypass do-not-disturb, so save it for emergencies",
+			},
+			"url": map[string]interface{}{
+				"type":        "string",
+				"description": "A link to open when the notification is tapped",
+			},
+			"via": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string", "enum": t.notifier.Targets()},
+				"description": "Only these targets (default all)",
+			},
+		},
+		"required": []string{"message"},
+	}
+}
+
+// HasSideEffects marks the tool as externally visible: a retried call
+// must not notify twice.
+func (t *NotifyTool) HasSideEffects() bool {
+	return true
+}
+
+// ConfirmationSummary describes the notification, for users who approve
+// each one.
+func (t *NotifyTool) ConfirmationSummary(args map[string]interface{}) string {
+	message, _ := args["message"].(string)
+	return fmt.Sprintf("send the notification %q", message)
+}
+
+func (t *NotifyTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	message, _ := args["message"].(string)
+	message = strings.TrimSpace(message)
+	if message == "" {
+		return ErrorResult("message is required")
+	}
+	priorityName, _ := args["priority"].(string)
+	priority, err := notify.ParsePriority(priorityName)
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+	title, _ := args["title"].(string)
+	link, _ := args["url"].(string)
+
+	sent, err := t.notifier.Send(ctx, notify.Notification{
+		Title:    strings.TrimSpace(title),
+		Message:  message,
+		Priority: priority,
+		URL:      link,
+	}, stringList(args["via"])...)
+	if len(sent) == 0 {
+		return ErrorResult(fmt.Sprintf("the notification was not sent: %v", err)).WithError(err)
+	}
+	result := "Sent the notification via " + strings.Join(sent, ", ")
+	if err != nil {
+		result += fmt.Sprintf(" (failed: %v)", err)
+	}
+	return NewToolResult(result)
+}
@@ -0,0 +1,56 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/notify"
+)
+
+type recordingTarget struct {
+	name  string
+	err   error
+	notes []notify.Notification
+}
+
+func (r *recordingTarget) Name() string { return r.name }
+
+func (r *recordingTarget) Send(ctx context.Context, n notify.Notification) error {
+	r.notes = append(r.notes, n)
+	return r.err
+}
+
+// TestNotifyTool verifies notifications are sent, partial failures are
+// reported and bad arguments refused
+func TestNotifyTool(t *testing.T) {
+	desktop := &recordingTarget{name: "desktop"}
+	ntfy := &recordingTarget{name: "ntfy", err: errors.New("HTTP 503")}
+	tool := NewNotifyTool(notify.NewWithTargets(desktop, ntfy))
+	ctx := context.Background()
+
+	result := tool.Execute(ctx, map[string]interface{}{"message": " Build finished ", "title": "CI", "priority": "high"})
+	if result.IsError || result.ForLLM != "Sent the notification via desktop (failed: ntfy: HTTP 503)" {
+		t.Errorf("Unexpected result %q", result.ForLLM)
+	}
+	if n := desktop.notes[0]; n.Message != "Build finished" || n.Title != "CI" || n.Priority != notify.PriorityHigh {
+		t.Errorf("Unexpected notification %+v", n)
+	}
+
+	result = tool.Execute(ctx, map[string]interface{}{"message": "hi", "via": []interface{}{"ntfy"}})
+	if !result.IsError || len(desktop.notes) != 1 {
+		t.Errorf("Expected an error when the only target fails, got %q", result.ForLLM)
+	}
+	for _, args := range []map[string]interface{}{
+		{"message": "  "},
+		{"message": "hi", "priority": "max"},
+	} {
+		if result := tool.Execute(ctx, args); !result.IsError {
+			t.Errorf("Expected %v refused, got %q", args, result.ForLLM)
+		}
+	}
+	if !strings.Contains(tool.Description(), "(desktop, ntfy)") {
+		t.Errorf("Expected the targets in the description, got %q", tool.Description())
+	}
+}
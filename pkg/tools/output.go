@@ -0,0 +1,237 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+const (
+	// minOutputChars is what a result keeps even when the turn's budget is
+	// spent, so the model still sees how it starts and where the rest is.
+	minOutputChars = 1000
+	// artifactRetention is how long spilled outputs are kept.
+	artifactRetention = 7 * 24 * time.Hour
+	// turnUsageTTL drops the budget of turns that ended long ago.
+	turnUsageTTL = time.Hour
+)
+
+// OutputPolicy caps how much tool output the model sees, so one verbose
+// command or page can't fill the context. A result over its cap is saved
+// whole to a file in the artifacts folder and the model gets its start and
+// end with the file's path, to read the rest in parts if it needs to.
+type OutputPolicy struct {
+	dir          string
+	maxChars     int
+	maxTurnChars int
+	perTool      map[string]int
+
+	mu      sync.Mutex
+	turns   map[string]*turnUsage
+	pruned  bool
+	counter int
+}
+
+type turnUsage struct {
+	chars int
+	seen  time.Time
+}
+
+// NewOutputPolicy returns a policy saving oversized results in dir.
+// maxChars caps one result and maxTurnChars all results of a turn; perTool
+// overrides maxChars for single tools. 0 turns a cap off, for perTool too.
+func NewOutputPolicy(dir string, maxChars, maxTurnChars int, perTool map[string]int) *OutputPolicy {
+	return &OutputPolicy{
+		dir:          dir,
+		maxChars:     maxChars,
+		maxTurnChars: maxTurnChars,
+		perTool:      perTool,
+		turns:        make(map[string]*turnUsage),
+	}
+}
+
+// Dir is the folder oversized results are saved in.
+func (p *OutputPolicy) Dir() string {
+	return p.dir
+}
+
+// Apply fits result's ForLLM into the tool's cap and what is left of the
+// turn's budget, spilling the whole output to a file if it doesn't. Reads
+// of a spilled file are cut short instead of being saved again.
+func (p *OutputPolicy) Apply(ctx context.Context, name string, args map[string]interface{}, result *ToolResult) *ToolResult {
+	if result == nil || result.Async {
+		return result
+	}
+	limit := p.limit(ctx, name)
+	size := len(result.ForLLM)
+	if limit <= 0 || size <= limit {
+		p.use(ctx, size)
+		return result
+	}
+
+	head, tail := cutOutput(result.ForLLM, limit)
+	omitted := size - len(head) - len(tail)
+	var note string
+	if p.readsArtifact(args) {
+		note = fmt.Sprintf("... [%d chars omitted; read a smaller range of the file]", omitted)
+	} else if path, err := p.save(name, result.ForLLM); err != nil {
+		logger.WarnCF("tool", "Failed to save oversized tool output",
+			map[string]interface{}{
+				"tool":  name,
+				"error": err.Error(),
+			})
+		note = fmt.Sprintf("... [%d chars omitted]", omitted)
+	} else {
+		note = fmt.Sprintf("... [%d chars omitted; the full output (%d chars) is saved in %s. Read parts of it with read_file offset and limit, or search it, rather than all at once]",
+			omitted, size, path)
+		logger.InfoCF("tool", "Saved oversized tool output",
+			map[string]interface{}{
+				"tool":  name,
+				"chars": size,
+				"limit": limit,
+				"path":  path,
+			})
+	}
+
+	result.ForLLM = head + "\n\n" + note + "\n\n" + tail
+	p.use(ctx, len(result.ForLLM))
+	return result
+}
+
+// limit is the most name's result may show now, or 0 for no cap.
+func (p *OutputPolicy) limit(ctx context.Context, name string) int {
+	limit := p.maxChars
+	if n, ok := p.perTool[name]; ok {
+		limit = n
+	}
+	if p.maxTurnChars <= 0 {
+		return limit
+	}
+	turnID := TurnIDFromContext(ctx)
+	if turnID == "" {
+		return limit
+	}
+	p.mu.Lock()
+	used := 0
+	if u, ok := p.turns[turnID]; ok {
+		used = u.chars
+	}
+	p.mu.Unlock()
+	left := max(p.maxTurnChars-used, minOutputChars)
+	if limit <= 0 || left < limit {
+		return left
+	}
+	return limit
+}
+
+// use counts chars against the turn's budget.
+func (p *OutputPolicy) use(ctx context.Context, chars int) {
+	turnID := TurnIDFromContext(ctx)
+	if p.maxTurnChars <= 0 || turnID == "" {
+		return
+	}
+	now := time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for id, u := range p.turns {
+		if now.Sub(u.seen) > turnUsageTTL {
+			delete(p.turns, id)
+		}
+	}
+	u, ok := p.turns[turnID]
+	if !ok {
+		u = &turnUsage{}
+		p.turns[turnID] = u
+	}
+	u.chars += chars
+	u.seen = now
+}
+
+// save writes output to a new file in the artifacts folder, removing old
+// ones the first time, and returns its path.
+func (p *OutputPolicy) save(name, output string) (string, error) {
+	if err := os.MkdirAll(p.dir, 0755); err != nil {
+		return "", err
+	}
+	p.mu.Lock()
+	if !p.pruned {
+		p.pruned = true
+		pruneArtifacts(p.dir, time.Now().Add(-artifactRetention))
+	}
+	p.counter++
+	n := p.counter
+	p.mu.Unlock()
+
+	safe := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == '.' || r == ' ' {
+			return '_'
+		}
+		return r
+	}, name)
+	path := filepath.Join(p.dir, fmt.Sprintf("%s-%s-%d.txt", time.Now().Format("20060102-150405"), safe, n))
+	if err := os.WriteFile(path, []byte(output), 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// readsArtifact reports whether args name a file in the artifacts folder.
+func (p *OutputPolicy) readsArtifact(args map[string]interface{}) bool {
+	dir := filepath.Clean(p.dir) + string(filepath.Separator)
+	for _, v := range args {
+		if s, ok := v.(string); ok && strings.HasPrefix(filepath.Clean(s), dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// pruneArtifacts removes files in dir last changed before cutoff.
+func pruneArtifacts(dir string, cutoff time.Time) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() || info.ModTime().After(cutoff) {
+			continue
+		}
+		os.Remove(filepath.Join(dir, entry.Name()))
+	}
+}
+
+// cutOutput keeps about two thirds of limit from the start of s and a third
+// from the end, cut at line breaks when one is near and never inside a
+// UTF-8 character.
+func cutOutput(s string, limit int) (head, tail string) {
+	headLen := limit * 2 / 3
+	tailLen := limit - headLen
+
+	head = s[:headLen]
+	if i := strings.LastIndexByte(head, '\n'); i > headLen/2 {
+		head = head[:i]
+	}
+	for len(head) > 0 {
+		if r, size := utf8.DecodeLastRuneInString(head); r != utf8.RuneError || size != 1 {
+			break
+		}
+		head = head[:len(head)-1]
+	}
+
+	tail = s[len(s)-tailLen:]
+	if i := strings.IndexByte(tail, '\n'); i >= 0 && i < tailLen/2 {
+		tail = tail[i+1:]
+	}
+	for len(tail) > 0 && !utf8.RuneStart(tail[0]) {
+		tail = tail[1:]
+	}
+	return head, tail
+}
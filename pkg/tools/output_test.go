@@ -0,0 +1,119 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func numberedLines(n int) string {
+	var sb strings.Builder
+	for i := 0; i < n; i++ {
+		sb.WriteString(strings.Repeat("x", 20))
+		sb.WriteString(" line\n")
+	}
+	return sb.String()
+}
+
+// TestOutputPolicySpill verifies an oversized result is saved whole and
+// the model gets its start, end and the file's path
+func TestOutputPolicySpill(t *testing.T) {
+	dir := t.TempDir()
+	policy := NewOutputPolicy(dir, 1000, 0, nil)
+	output := "first line\n" + numberedLines(200) + "last line"
+
+	result := policy.Apply(context.Background(), "exec", nil, NewToolResult(output))
+	if len(result.ForLLM) > 1400 {
+		t.Errorf("Expected the result cut to about 1000 chars, got %d", len(result.ForLLM))
+	}
+	if !strings.HasPrefix(result.ForLLM, "first line") || !strings.HasSuffix(result.ForLLM, "last line") {
+		t.Errorf("Expected the start and end kept, got %q", result.ForLLM)
+	}
+
+	path := regexp.MustCompile(`saved in (\S+)\.`).FindStringSubmatch(result.ForLLM)
+	if path == nil {
+		t.Fatalf("Expected the artifact path, got %q", result.ForLLM)
+	}
+	saved, err := os.ReadFile(path[1])
+	if err != nil || string(saved) != output {
+		t.Errorf("Expected the whole output saved, got %d bytes, %v", len(saved), err)
+	}
+	if filepath.Dir(path[1]) != dir {
+		t.Errorf("Expected the artifact in %s, got %s", dir, path[1])
+	}
+
+	// Short results pass unchanged
+	result = policy.Apply(context.Background(), "exec", nil, NewToolResult("ok"))
+	if result.ForLLM != "ok" {
+		t.Errorf("Expected a short result unchanged, got %q", result.ForLLM)
+	}
+}
+
+// TestOutputPolicyPerTool verifies per-tool caps override the default and 0
+// turns the cap off
+func TestOutputPolicyPerTool(t *testing.T) {
+	policy := NewOutputPolicy(t.TempDir(), 1000, 0, map[string]int{"read_file": 3000, "web_fetch": 0})
+	output := numberedLines(100) // 2600 chars
+
+	if result := policy.Apply(context.Background(), "read_file", nil, NewToolResult(output)); result.ForLLM != output {
+		t.Error("Expected read_file's higher cap to keep the output whole")
+	}
+	if result := policy.Apply(context.Background(), "web_fetch", nil, NewToolResult(output)); result.ForLLM != output {
+		t.Error("Expected web_fetch to be uncapped")
+	}
+	if result := policy.Apply(context.Background(), "exec", nil, NewToolResult(output)); result.ForLLM == output {
+		t.Error("Expected exec to be capped")
+	}
+}
+
+// TestOutputPolicyTurnBudget verifies results share a turn's budget and a
+// new turn starts afresh
+func TestOutputPolicyTurnBudget(t *testing.T) {
+	policy := NewOutputPolicy(t.TempDir(), 0, 5000, nil)
+	ctx := WithTurnID(context.Background(), "turn-1")
+	output := numberedLines(100) // 2600 chars
+
+	if result := policy.Apply(ctx, "exec", nil, NewToolResult(output)); result.ForLLM != output {
+		t.Error("Expected the first result to fit the turn")
+	}
+	if result := policy.Apply(ctx, "exec", nil, NewToolResult(output)); len(result.ForLLM) > 2800 || !strings.Contains(result.ForLLM, "saved in") {
+		t.Errorf("Expected the second result cut to what is left, got %d chars", len(result.ForLLM))
+	}
+	if result := policy.Apply(ctx, "exec", nil, NewToolResult(output)); len(result.ForLLM) > minOutputChars+400 {
+		t.Errorf("Expected a spent turn to keep only a preview, got %d chars", len(result.ForLLM))
+	}
+
+	next := WithTurnID(context.Background(), "turn-2")
+	if result := policy.Apply(next, "exec", nil, NewToolResult(output)); result.ForLLM != output {
+		t.Error("Expected a new turn to have its own budget")
+	}
+}
+
+// TestOutputPolicyArtifactRead verifies reading a saved output is cut
+// short rather than saved again
+func TestOutputPolicyArtifactRead(t *testing.T) {
+	dir := t.TempDir()
+	policy := NewOutputPolicy(dir, 1000, 0, nil)
+	args := map[string]interface{}{"path": filepath.Join(dir, "20260101-000000-exec-1.txt")}
+
+	result := policy.Apply(context.Background(), "read_file", args, NewToolResult(numberedLines(200)))
+	if !strings.Contains(result.ForLLM, "read a smaller range") {
+		t.Errorf("Expected a note to read less, got %q", result.ForLLM)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Expected nothing saved, got %d files", len(entries))
+	}
+}
+
+// TestCutOutput verifies cuts don't split UTF-8 characters
+func TestCutOutput(t *testing.T) {
+	s := strings.Repeat("é", 1000)
+	head, tail := cutOutput(s, 301)
+	if !strings.HasPrefix(s, head) || !strings.HasSuffix(s, tail) || !utf8.ValidString(head) || !utf8.ValidString(tail) {
+		t.Errorf("Expected whole characters, got %q ... %q", head, tail)
+	}
+}
@@ -0,0 +1,229 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A plugin is an executable that provides a tool, written in any language.
+// It is run in one of two ways:
+//
+//	<plugin> describe
+//	    prints {"name": ..., "description": ..., "parameters": {JSON schema}}
+//	<plugin> execute
+//	    reads {"arguments": {...}} on stdin and prints
+//	    {"result": "...", "for_user": "...", "error": "...",
+//	     "data": {any JSON}, "attachments": [{"path": ..., "name": ..., "media_type": ...}]}
+//
+// Attachment paths relative to the plugin's directory are resolved there.
+// Output that isn't JSON is taken as the result; a non-zero exit is an
+// error, with what the plugin wrote to stderr.
+
+const (
+	// pluginDescribeTimeout bounds "describe", run once at startup.
+	pluginDescribeTimeout = 10 * time.Second
+	// maxPluginOutput bounds what is read from a plugin.
+	maxPluginOutput = 1 << 20
+)
+
+// pluginDescription is what a plugin prints for "describe".
+type pluginDescription struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Parameters  map[string]interface{} `json:"parameters"`
+}
+
+// pluginReply is what a plugin prints for "execute".
+type pluginReply struct {
+	Result      string          `json:"result"`
+	ForUser     string          `json:"for_user,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	Data        json.RawMessage `json:"data,omitempty"`
+	Attachments []Attachment    `json:"attachments,omitempty"`
+}
+
+// PluginTool is a tool provided by a plugin executable.
+type PluginTool struct {
+	path    string
+	desc    pluginDescription
+	timeout time.Duration
+	policy  *EnvPolicy
+	env     []string
+}
+
+// LoadPlugins describes every executable in dir and returns the tools they
+// provide. Plugins that fail to describe themselves are reported in errs
+// and skipped. A missing dir has no plugins.
+func LoadPlugins(ctx context.Context, dir string, timeout time.Duration, policy *EnvPolicy, env []string) (plugins []*PluginTool, errs []error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+		return nil, errs
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || !isExecutable(path) {
+			continue
+		}
+		p, err := NewPluginTool(ctx, path, timeout, policy, env)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", entry.Name(), err))
+			continue
+		}
+		plugins = append(plugins, p)
+	}
+	return plugins, errs
+}
+
+// NewPluginTool runs the plugin at path with "describe" and returns its
+// tool. Executions are stopped after timeout. The plugin inherits the
+// variables policy lets through, as exec commands do, and env.
+func NewPluginTool(ctx context.Context, path string, timeout time.Duration, policy *EnvPolicy, env []string) (*PluginTool, error) {
+	p := &PluginTool{path: path, timeout: timeout, policy: policy, env: env}
+	ctx, cancel := context.WithTimeout(ctx, pluginDescribeTimeout)
+	defer cancel()
+	out, err := p.run(ctx, "describe", nil)
+	if err != nil {
+		return nil, fmt.Errorf("describe: %w", err)
+	}
+	if err := json.Unmarshal(out, &p.desc); err != nil {
+		return nil, fmt.Errorf("describe: invalid JSON: %w", err)
+	}
+	if !validToolName.MatchString(p.desc.Name) {
+		return nil, fmt.Errorf("describe: invalid tool name %q (letters, digits, _ and - only)", p.desc.Name)
+	}
+	if p.desc.Parameters == nil {
+		p.desc.Parameters = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+	}
+	return p, nil
+}
+
+func (p *PluginTool) Name() string {
+	return p.desc.Name
+}
+
+func (p *PluginTool) Description() string {
+	return p.desc.Description
+}
+
+func (p *PluginTool) Parameters() map[string]interface{} {
+	return p.desc.Parameters
+}
+
+// Path is the plugin's executable.
+func (p *PluginTool) Path() string {
+	return p.path
+}
+
+func (p *PluginTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	input, err := json.Marshal(map[string]interface{}{"arguments": args})
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("plugin %s: %v", p.desc.Name, err)).WithError(err)
+	}
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+	out, err := p.run(ctx, "execute", input)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("timed out after %s", p.timeout)
+		}
+		return ErrorResult(fmt.Sprintf("plugin %s failed: %v", p.desc.Name, err)).WithError(err)
+	}
+
+	var reply pluginReply
+	trimmed := bytes.TrimSpace(out)
+	if len(trimmed) == 0 || trimmed[0] != '{' || json.Unmarshal(trimmed, &reply) != nil {
+		return NewToolResult(string(out))
+	}
+	if reply.Error != "" {
+		return ErrorResult(reply.Error)
+	}
+	result := NewToolResult(reply.Result)
+	result.ForUser = reply.ForUser
+	if len(reply.Data) > 0 && string(reply.Data) != "null" {
+		result.Data = reply.Data
+	}
+	for _, a := range reply.Attachments {
+		if a.Path == "" {
+			continue
+		}
+		if !filepath.IsAbs(a.Path) {
+			a.Path = filepath.Join(filepath.Dir(p.path), a.Path)
+		}
+		result.Attachments = append(result.Attachments, a)
+	}
+	return result
+}
+
+// run starts the plugin with command and input on stdin, and returns what
+// it printed.
+func (p *PluginTool) run(ctx context.Context, command string, input []byte) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, p.path, command)
+	cmd.Dir = filepath.Dir(p.path)
+	cmd.Env = append(inheritedEnv(p.policy), p.env...)
+	cmd.Stdin = bytes.NewReader(input)
+	// Don't wait on children the plugin left holding its output
+	cmd.WaitDelay = time.Second
+	var stdout, stderr limitedBuffer
+	stdout.limit, stderr.limit = maxPluginOutput, 4096
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+	if stdout.cut {
+		return nil, fmt.Errorf("output longer than %d bytes", maxPluginOutput)
+	}
+	return stdout.Bytes(), nil
+}
+
+// limitedBuffer keeps the first limit bytes written to it.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+	cut   bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); len(p) > room {
+		b.cut = true
+		b.Buffer.Write(p[:max(room, 0)])
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// isExecutable reports whether path can be run as a plugin: an executable
+// file, or on Windows an .exe, .bat or .cmd.
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".exe", ".bat", ".cmd":
+			return true
+		}
+		return false
+	}
+	return info.Mode().Perm()&0111 != 0
+}
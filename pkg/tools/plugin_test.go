@@ -0,0 +1,170 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+const echoPlugin = `#!/bin/sh
+case "$1" in
+describe)
+  echo '{"name": "echo_upper", "description": "Upper-cases text", "parameters": {"type": "object", "properties": {"text": {"type": "string"}}}}'
+  ;;
+execute)
+  input=$(cat)
+  case "$input" in
+  *fail*) echo '{"error": "asked to fail"}' ;;
+  *plain*) echo "plain output" ;;
+  *) echo "{\"result\": \"got $(echo "$input" | tr a-z A-Z | tr -d '\"{}')\"}" ;;
+  esac
+  ;;
+esac
+`
+
+func writePlugin(t *testing.T, dir, name, script string, mode os.FileMode) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(script), mode); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestLoadPlugins verifies executables are described and broken or
+// non-executable files are skipped
+func TestLoadPlugins(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugins are shell scripts")
+	}
+	dir := t.TempDir()
+	writePlugin(t, dir, "echo", echoPlugin, 0755)
+	writePlugin(t, dir, "notes.txt", "not a plugin", 0644)
+	writePlugin(t, dir, "broken", "#!/bin/sh\necho 'not json'\n", 0755)
+	writePlugin(t, dir, "badname", "#!/bin/sh\necho '{\"name\": \"has space\"}'\n", 0755)
+
+	plugins, errs := LoadPlugins(context.Background(), dir, 5*time.Second, nil, nil)
+	if len(plugins) != 1 || plugins[0].Name() != "echo_upper" {
+		t.Fatalf("Expected the echo_upper plugin, got %v", plugins)
+	}
+	if len(errs) != 2 {
+		t.Errorf("Expected errors for broken and badname, got %v", errs)
+	}
+	if plugins[0].Parameters()["type"] != "object" {
+		t.Errorf("Expected the described parameters, got %v", plugins[0].Parameters())
+	}
+
+	if plugins, errs := LoadPlugins(context.Background(), filepath.Join(dir, "missing"), time.Second, nil, nil); plugins != nil || errs != nil {
+		t.Errorf("Expected nothing for a missing dir, got %v, %v", plugins, errs)
+	}
+}
+
+// TestPluginExecute verifies arguments go in as JSON and replies, errors
+// and plain output come back
+func TestPluginExecute(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugins are shell scripts")
+	}
+	dir := t.TempDir()
+	writePlugin(t, dir, "echo", echoPlugin, 0755)
+	p, err := NewPluginTool(context.Background(), filepath.Join(dir, "echo"), 5*time.Second, nil, nil)
+	if err != nil {
+		t.Fatalf("NewPluginTool failed: %v", err)
+	}
+
+	result := p.Execute(context.Background(), map[string]interface{}{"text": "hi"})
+	if result.IsError || !strings.Contains(result.ForLLM, "TEXT:HI") {
+		t.Errorf("Expected the upper-cased arguments, got %+v", result)
+	}
+	result = p.Execute(context.Background(), map[string]interface{}{"text": "fail"})
+	if !result.IsError || result.ForLLM != "asked to fail" {
+		t.Errorf("Expected the plugin's error, got %+v", result)
+	}
+	result = p.Execute(context.Background(), map[string]interface{}{"text": "plain"})
+	if result.IsError || strings.TrimSpace(result.ForLLM) != "plain output" {
+		t.Errorf("Expected plain output as the result, got %+v", result)
+	}
+}
+
+// TestPluginTimeout verifies a slow plugin is stopped
+func TestPluginTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugins are shell scripts")
+	}
+	dir := t.TempDir()
+	writePlugin(t, dir, "slow", "#!/bin/sh\nif [ \"$1\" = describe ]; then echo '{\"name\": \"slow\"}'; else exec sleep 5; fi\n", 0755)
+	p, err := NewPluginTool(context.Background(), filepath.Join(dir, "slow"), 200*time.Millisecond, nil, nil)
+	if err != nil {
+		t.Fatalf("NewPluginTool failed: %v", err)
+	}
+	result := p.Execute(context.Background(), nil)
+	if !result.IsError || !strings.Contains(result.ForLLM, "timed out") {
+		t.Errorf("Expected a timeout, got %+v", result)
+	}
+}
+
+// TestPluginStructuredReply verifies data and attachments come back, with
+// relative paths resolved in the plugin's directory
+func TestPluginStructuredReply(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugins are shell scripts")
+	}
+	dir := t.TempDir()
+	writePlugin(t, dir, "chart", `#!/bin/sh
+if [ "$1" = describe ]; then echo '{"name": "chart"}'; exit; fi
+echo '{"result": "drew it", "data": {"points": 3}, "attachments": [{"path": "out/chart.png"}, {"path": "/abs/data.csv", "name": "Data"}, {"name": "no path"}]}'
+`, 0755)
+	p, err := NewPluginTool(context.Background(), filepath.Join(dir, "chart"), 5*time.Second, nil, nil)
+	if err != nil {
+		t.Fatalf("NewPluginTool failed: %v", err)
+	}
+
+	result := p.Execute(context.Background(), nil)
+	if result.IsError || result.ForLLM != "drew it" {
+		t.Fatalf("Expected the result, got %+v", result)
+	}
+	if data, _ := json.Marshal(result.Data); string(data) != `{"points":3}` {
+		t.Errorf("Expected the data, got %s", data)
+	}
+	if len(result.Attachments) != 2 {
+		t.Fatalf("Expected two attachments, got %+v", result.Attachments)
+	}
+	if result.Attachments[0].Path != filepath.Join(dir, "out", "chart.png") || result.Attachments[1].Path != "/abs/data.csv" {
+		t.Errorf("Expected resolved paths, got %+v", result.Attachments)
+	}
+}
+
+// TestPluginEnvPolicy verifies plugins inherit only the variables the exec
+// environment policy lets through, plus their own
+func TestPluginEnvPolicy(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugins are shell scripts")
+	}
+	t.Setenv("PLUGIN_TEST_TOKEN", "hunter2")
+	t.Setenv("PLUGIN_TEST_PLAIN", "visible")
+	dir := t.TempDir()
+	writePlugin(t, dir, "env", `#!/bin/sh
+case "$1" in
+describe) echo '{"name": "env_dump", "description": "Prints the environment"}' ;;
+execute) env ;;
+esac
+`, 0755)
+	policy := &EnvPolicy{Deny: []string{"*_TOKEN"}}
+	p, err := NewPluginTool(context.Background(), filepath.Join(dir, "env"), 5*time.Second, policy, []string{"PICOCLAW_WORKSPACE=/ws"})
+	if err != nil {
+		t.Fatalf("NewPluginTool failed: %v", err)
+	}
+
+	result := p.Execute(context.Background(), map[string]interface{}{})
+	if strings.Contains(result.ForLLM, "hunter2") {
+		t.Errorf("Expected the denied variable to be withheld, got %q", result.ForLLM)
+	}
+	for _, want := range []string{"PLUGIN_TEST_PLAIN=visible", "PICOCLAW_WORKSPACE=/ws"} {
+		if !strings.Contains(result.ForLLM, want) {
+			t.Errorf("Expected %s in the plugin's environment, got %q", want, result.ForLLM)
+		}
+	}
+}
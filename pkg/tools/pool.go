@@ -0,0 +1,99 @@
+package tools
+
+import (
+	"context"
+	"sync"
+)
+
+// unpooledTools wait for other tool calls to finish. They must not hold a
+// worker, or a subagent could wait forever for the worker its parent holds.
+var unpooledTools = map[string]bool{
+	"subagent":    true,
+	"spawn":       true,
+	"spawn_agent": true,
+}
+
+// ConcurrentTool is an optional interface for tools that only read, so
+// their calls in one round can run at the same time. Every other call runs
+// alone, in the order the model gave: a write_file before an exec, or two
+// edit_file calls on one file, depend on it.
+type ConcurrentTool interface {
+	Tool
+	ConcurrencySafe() bool
+}
+
+// WorkerPool bounds how many tool calls run at once, overall and per tool.
+// One pool is shared by every registry so subagents count against the same
+// limits as the main agent.
+type WorkerPool struct {
+	workers chan struct{}
+	perTool map[string]chan struct{}
+	mu      sync.Mutex
+	limits  map[string]int
+}
+
+// NewWorkerPool creates a pool running at most workers calls at once, with
+// the given per-tool limits on top.
+func NewWorkerPool(workers int, perTool map[string]int) *WorkerPool {
+	if workers < 1 {
+		workers = 1
+	}
+	return &WorkerPool{
+		workers: make(chan struct{}, workers),
+		perTool: make(map[string]chan struct{}),
+		limits:  perTool,
+	}
+}
+
+// Size returns the number of workers.
+func (p *WorkerPool) Size() int {
+	return cap(p.workers)
+}
+
+// Acquire waits for a free worker and a free slot for the tool. The
+// returned function releases both.
+func (p *WorkerPool) Acquire(ctx context.Context, tool string) (func(), error) {
+	if unpooledTools[tool] {
+		return func() {}, nil
+	}
+	slot := p.toolSlot(tool)
+	if slot != nil {
+		select {
+		case slot <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	// The tool slot is taken first so a capped tool waiting its turn does
+	// not hold a worker other tools could use
+	select {
+	case p.workers <- struct{}{}:
+	case <-ctx.Done():
+		if slot != nil {
+			<-slot
+		}
+		return nil, ctx.Err()
+	}
+	return func() {
+		<-p.workers
+		if slot != nil {
+			<-slot
+		}
+	}, nil
+}
+
+// toolSlot returns the semaphore for a capped tool, or nil.
+func (p *WorkerPool) toolSlot(tool string) chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if slot, ok := p.perTool[tool]; ok {
+		return slot
+	}
+	limit, ok := p.limits[tool]
+	if !ok || limit <= 0 {
+		return nil
+	}
+	slot := make(chan struct{}, limit)
+	p.perTool[tool] = slot
+	return slot
+}
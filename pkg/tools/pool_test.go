@@ -0,0 +1,81 @@
+package tools
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestWorkerPool_PerToolLimit verifies a capped tool never runs more calls
+// at once than its limit, even with free workers.
+func TestWorkerPool_PerToolLimit(t *testing.T) {
+	pool := NewWorkerPool(4, map[string]int{"exec": 1})
+
+	var running, peak atomic.Int32
+	var wg sync.WaitGroup
+	for range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := pool.Acquire(context.Background(), "exec")
+			if err != nil {
+				t.Errorf("Acquire failed: %v", err)
+				return
+			}
+			n := running.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			running.Add(-1)
+			release()
+		}()
+	}
+	wg.Wait()
+
+	if peak.Load() != 1 {
+		t.Errorf("Expected at most 1 concurrent exec, got %d", peak.Load())
+	}
+}
+
+// TestWorkerPool_GlobalLimit verifies the pool size bounds all tools.
+func TestWorkerPool_GlobalLimit(t *testing.T) {
+	pool := NewWorkerPool(1, nil)
+
+	release, err := pool.Acquire(context.Background(), "read_file")
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := pool.Acquire(ctx, "web_fetch"); err == nil {
+		t.Error("Expected second call to wait for the only worker")
+	}
+}
+
+// TestWorkerPool_Unpooled verifies tools that wait on other calls never
+// hold a worker.
+func TestWorkerPool_Unpooled(t *testing.T) {
+	pool := NewWorkerPool(1, nil)
+
+	release, err := pool.Acquire(context.Background(), "subagent")
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	inner, err := pool.Acquire(ctx, "exec")
+	if err != nil {
+		t.Fatalf("Expected the subagent's own calls to get a worker, got %v", err)
+	}
+	inner()
+}
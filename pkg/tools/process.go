@@ -0,0 +1,383 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxBackgroundProcesses caps how many background commands may run at once.
+	maxBackgroundProcesses = 8
+	// maxFinishedProcesses is how many exited processes stay listed.
+	maxFinishedProcesses = 16
+	// processOutputSize is how much of each process's latest output is kept.
+	processOutputSize = 64 * 1024
+)
+
+// Process is a command started with exec's background option.
+type Process struct {
+	ID        string
+	Command   string
+	Dir       string
+	StartedAt time.Time
+
+	cmd     *exec.Cmd
+	cancel  context.CancelFunc
+	cleanup func()
+	output  *tailBuffer
+	done    chan struct{}
+
+	mu       sync.Mutex
+	exitErr  error
+	readFrom int64 // output offset read_output has returned up to
+}
+
+// Running reports whether the process has not exited yet.
+func (p *Process) Running() bool {
+	select {
+	case <-p.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// Status describes the process state, e.g. "running 2m0s" or "exited (exit status 1)".
+func (p *Process) Status() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.Running() {
+		return fmt.Sprintf("running %s", time.Since(p.StartedAt).Round(time.Second))
+	}
+	if p.exitErr != nil {
+		return fmt.Sprintf("exited (%v)", p.exitErr)
+	}
+	return "exited (status 0)"
+}
+
+// Err returns the exit error of a finished process.
+func (p *Process) Err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.exitErr
+}
+
+// ProcessManager tracks background processes and persistent shell sessions
+// so the agent can use them in later tool calls.
+type ProcessManager struct {
+	mu        sync.Mutex
+	processes map[string]*Process
+	shells    map[string]*shellSession
+	nextID    int
+}
+
+func NewProcessManager() *ProcessManager {
+	return &ProcessManager{
+		processes: make(map[string]*Process),
+		shells:    make(map[string]*shellSession),
+	}
+}
+
+// Start runs a command prepared by an ExecBackend in the background. The
+// command must have been created with ctx, which cancel stops.
+func (m *ProcessManager) Start(command, dir string, cmd *exec.Cmd, cancel context.CancelFunc, cleanup func()) (*Process, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	running := 0
+	for _, p := range m.processes {
+		if p.Running() {
+			running++
+		}
+	}
+	if running >= maxBackgroundProcesses {
+		return nil, fmt.Errorf("too many background processes (%d running); stop one with kill_process first", running)
+	}
+
+	m.nextID++
+	p := &Process{
+		ID:        fmt.Sprintf("p%d", m.nextID),
+		Command:   command,
+		Dir:       dir,
+		StartedAt: time.Now(),
+		cmd:       cmd,
+		cancel:    cancel,
+		cleanup:   cleanup,
+		output:    &tailBuffer{max: processOutputSize},
+		done:      make(chan struct{}),
+	}
+	// Both streams go to one buffer so log lines stay in order
+	cmd.Stdout = p.output
+	cmd.Stderr = p.output
+	setProcessGroup(cmd)
+
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return nil, err
+	}
+	go func() {
+		err := cmd.Wait()
+		p.mu.Lock()
+		p.exitErr = err
+		p.mu.Unlock()
+		cancel()
+		close(p.done)
+	}()
+
+	m.processes[p.ID] = p
+	m.pruneLocked()
+	return p, nil
+}
+
+// pruneLocked forgets the oldest exited processes beyond maxFinishedProcesses.
+func (m *ProcessManager) pruneLocked() {
+	var finished []*Process
+	for _, p := range m.processes {
+		if !p.Running() {
+			finished = append(finished, p)
+		}
+	}
+	if len(finished) <= maxFinishedProcesses {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool { return finished[i].StartedAt.Before(finished[j].StartedAt) })
+	for _, p := range finished[:len(finished)-maxFinishedProcesses] {
+		delete(m.processes, p.ID)
+	}
+}
+
+// Get returns a process by ID.
+func (m *ProcessManager) Get(id string) (*Process, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.processes[id]
+	return p, ok
+}
+
+// List returns all tracked processes, oldest first.
+func (m *ProcessManager) List() []*Process {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := make([]*Process, 0, len(m.processes))
+	for _, p := range m.processes {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].StartedAt.Before(list[j].StartedAt) })
+	return list
+}
+
+// Kill stops a process and waits briefly for it to exit.
+func (m *ProcessManager) Kill(id string) error {
+	p, ok := m.Get(id)
+	if !ok {
+		return fmt.Errorf("process %s not found", id)
+	}
+	if !p.Running() {
+		return fmt.Errorf("process %s has already exited", id)
+	}
+	p.cancel()
+	p.cleanup()
+	select {
+	case <-p.done:
+	case <-time.After(5 * time.Second):
+		return fmt.Errorf("process %s did not exit after being killed", id)
+	}
+	return nil
+}
+
+// StopAll kills every running process and shell session, e.g. on shutdown.
+func (m *ProcessManager) StopAll() {
+	for _, p := range m.List() {
+		if p.Running() {
+			p.cancel()
+			p.cleanup()
+		}
+	}
+	for _, name := range m.ShellNames() {
+		m.CloseShell(name)
+	}
+}
+
+// ReadOutput returns the output written since the previous read, or all
+// kept output when all is true, and how many bytes were lost to the buffer
+// limit in between.
+func (p *Process) ReadOutput(all bool) (string, int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	from := p.readFrom
+	if all {
+		from = 0
+	}
+	out, next, dropped := p.output.since(from)
+	p.readFrom = next
+	return out, dropped
+}
+
+// tailBuffer keeps the last max bytes written to it and counts the total,
+// so readers can resume from an offset.
+type tailBuffer struct {
+	mu    sync.Mutex
+	buf   []byte
+	max   int
+	total int64
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.total += int64(len(p))
+	b.buf = append(b.buf, p...)
+	if over := len(b.buf) - b.max; over > 0 {
+		b.buf = append(b.buf[:0], b.buf[over:]...)
+	}
+	return len(p), nil
+}
+
+// since returns the output from offset on, the offset to resume from, and
+// how many bytes after offset are no longer kept.
+func (b *tailBuffer) since(offset int64) (string, int64, int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	start := b.total - int64(len(b.buf))
+	var dropped int64
+	if offset < start {
+		dropped = start - offset
+		offset = start
+	}
+	return string(b.buf[offset-start:]), b.total, dropped
+}
+
+// ListProcessesTool shows the background processes started with exec.
+type ListProcessesTool struct {
+	manager *ProcessManager
+}
+
+func NewListProcessesTool(manager *ProcessManager) *ListProcessesTool {
+	return &ListProcessesTool{manager: manager}
+}
+
+func (t *ListProcessesTool) Name() string {
+	return "list_processes"
+}
+
+func (t *ListProcessesTool) Description() string {
+	return "List background processes started with exec (background: true), with their IDs and status."
+}
+
+func (t *ListProcessesTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{},
+	}
+}
+
+func (t *ListProcessesTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	list := t.manager.List()
+	if len(list) == 0 {
+		return NewToolResult("No background processes")
+	}
+	var sb strings.Builder
+	for _, p := range list {
+		fmt.Fprintf(&sb, "%s  %s  %s\n", p.ID, p.Status(), p.Command)
+	}
+	return NewToolResult(strings.TrimRight(sb.String(), "\n"))
+}
+
+// ReadOutputTool returns the output of a background process.
+type ReadOutputTool struct {
+	manager *ProcessManager
+}
+
+func NewReadOutputTool(manager *ProcessManager) *ReadOutputTool {
+	return &ReadOutputTool{manager: manager}
+}
+
+func (t *ReadOutputTool) Name() string {
+	return "read_output"
+}
+
+func (t *ReadOutputTool) Description() string {
+	return "Read the output (stdout and stderr) of a background process. Returns only what is new since the last read unless all is true."
+}
+
+func (t *ReadOutputTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"id": map[string]interface{}{
+				"type":        "string",
+				"description": "Process ID returned by exec, e.g. p1",
+			},
+			"all": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Return all kept output instead of only new output",
+			},
+		},
+		"required": []string{"id"},
+	}
+}
+
+func (t *ReadOutputTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	id, _ := args["id"].(string)
+	p, ok := t.manager.Get(id)
+	if !ok {
+		return ErrorResult(fmt.Sprintf("process %s not found", id))
+	}
+	all, _ := args["all"].(bool)
+
+	output, dropped := p.ReadOutput(all)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "[%s %s]\n", p.ID, p.Status())
+	if dropped > 0 {
+		fmt.Fprintf(&sb, "... (%d earlier bytes no longer kept)\n", dropped)
+	}
+	if output == "" {
+		sb.WriteString("(no new output)")
+	} else {
+		sb.WriteString(output)
+	}
+	return NewToolResult(sb.String())
+}
+
+// KillProcessTool stops a background process.
+type KillProcessTool struct {
+	manager *ProcessManager
+}
+
+func NewKillProcessTool(manager *ProcessManager) *KillProcessTool {
+	return &KillProcessTool{manager: manager}
+}
+
+func (t *KillProcessTool) Name() string {
+	return "kill_process"
+}
+
+func (t *KillProcessTool) Description() string {
+	return "Stop a background process started with exec."
+}
+
+func (t *KillProcessTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"id": map[string]interface{}{
+				"type":        "string",
+				"description": "Process ID returned by exec, e.g. p1",
+			},
+		},
+		"required": []string{"id"},
+	}
+}
+
+func (t *KillProcessTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	id, _ := args["id"].(string)
+	if err := t.manager.Kill(id); err != nil {
+		return ErrorResult(err.Error())
+	}
+	return NewToolResult(fmt.Sprintf("Stopped process %s", id))
+}
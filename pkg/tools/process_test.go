@@ -0,0 +1,103 @@
+//go:build !windows
+
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// TestExecTool_Background verifies a background command returns a process
+// ID whose output can be read and which can be killed.
+func TestExecTool_Background(t *testing.T) {
+	manager := NewProcessManager()
+	defer manager.StopAll()
+	tool := NewExecTool(t.TempDir(), false)
+	tool.SetProcessManager(manager)
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"command":    "echo started; sleep 30",
+		"background": true,
+	})
+	if result.IsError {
+		t.Fatalf("Expected success, got %s", result.ForLLM)
+	}
+	if !strings.Contains(result.ForLLM, "p1") {
+		t.Fatalf("Expected process ID p1, got %s", result.ForLLM)
+	}
+
+	read := NewReadOutputTool(manager)
+	out := read.Execute(context.Background(), map[string]interface{}{"id": "p1"})
+	if !strings.Contains(out.ForLLM, "started") || !strings.Contains(out.ForLLM, "running") {
+		t.Errorf("Expected running process output, got %s", out.ForLLM)
+	}
+	out = read.Execute(context.Background(), map[string]interface{}{"id": "p1"})
+	if !strings.Contains(out.ForLLM, "(no new output)") {
+		t.Errorf("Expected no new output on second read, got %s", out.ForLLM)
+	}
+
+	list := NewListProcessesTool(manager).Execute(context.Background(), map[string]interface{}{})
+	if !strings.Contains(list.ForLLM, "sleep 30") {
+		t.Errorf("Expected process in list, got %s", list.ForLLM)
+	}
+
+	kill := NewKillProcessTool(manager).Execute(context.Background(), map[string]interface{}{"id": "p1"})
+	if kill.IsError {
+		t.Fatalf("Expected kill to succeed, got %s", kill.ForLLM)
+	}
+	p, _ := manager.Get("p1")
+	if p.Running() {
+		t.Error("Expected process to have exited after kill")
+	}
+}
+
+// TestExecTool_BackgroundExitsImmediately verifies a background command that
+// fails straight away reports its output as an error.
+func TestExecTool_BackgroundExitsImmediately(t *testing.T) {
+	manager := NewProcessManager()
+	tool := NewExecTool(t.TempDir(), false)
+	tool.SetProcessManager(manager)
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"command":    "echo boom >&2; exit 3",
+		"background": true,
+	})
+	if !result.IsError {
+		t.Fatalf("Expected error, got %s", result.ForLLM)
+	}
+	if !strings.Contains(result.ForLLM, "boom") {
+		t.Errorf("Expected output in result, got %s", result.ForLLM)
+	}
+}
+
+// TestTailBuffer_Since verifies reads resume from an offset and report
+// output that no longer fits.
+func TestTailBuffer_Since(t *testing.T) {
+	b := &tailBuffer{max: 8}
+	b.Write([]byte("hello"))
+
+	out, next, dropped := b.since(0)
+	if out != "hello" || next != 5 || dropped != 0 {
+		t.Fatalf("Expected hello/5/0, got %q/%d/%d", out, next, dropped)
+	}
+
+	b.Write([]byte(" world"))
+	out, next, dropped = b.since(next)
+	if out != " world" || next != 11 || dropped != 0 {
+		t.Errorf("Expected \" world\"/11/0, got %q/%d/%d", out, next, dropped)
+	}
+
+	out, _, dropped = b.since(0)
+	if out != "lo world" || dropped != 3 {
+		t.Errorf("Expected \"lo world\" with 3 dropped, got %q/%d", out, dropped)
+	}
+}
+
+// TestProcessManager_KillUnknown verifies killing a missing process fails.
+func TestProcessManager_KillUnknown(t *testing.T) {
+	manager := NewProcessManager()
+	if err := manager.Kill("p9"); err == nil {
+		t.Error("Expected error for unknown process")
+	}
+}
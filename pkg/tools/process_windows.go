@@ -0,0 +1,6 @@
+package tools
+
+import "os/exec"
+
+// setProcessGroup is a no-op on Windows; cancellation kills only the shell.
+func setProcessGroup(cmd *exec.Cmd) {}
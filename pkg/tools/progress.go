@@ -0,0 +1,20 @@
+package tools
+
+import "context"
+
+// ProgressFunc receives partial results from a long-running tool call,
+// e.g. the latest output of a command that is still running.
+type ProgressFunc func(update string)
+
+type progressKey struct{}
+
+// WithProgress returns a context whose tool calls report progress to fn.
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// ProgressFromContext returns the function set by WithProgress, or nil.
+func ProgressFromContext(ctx context.Context) ProgressFunc {
+	fn, _ := ctx.Value(progressKey{}).(ProgressFunc)
+	return fn
+}
@@ -0,0 +1,464 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed python_driver.py
+var pythonDriver string
+
+const (
+	// maxPythonInterpreters caps how many sessions keep an interpreter at
+	// once; the one used least recently is stopped to make room.
+	maxPythonInterpreters = 4
+	maxPythonTimeout      = 10 * time.Minute
+	// PythonScratchDir is the workspace folder the code runs in.
+	PythonScratchDir = "python"
+)
+
+// PythonTool runs Python code in an interpreter kept per session, so
+// variables, imports and loaded data carry over between calls. The code
+// runs in the scratch folder of the workspace, through an ExecBackend (a
+// container, or a host process under memory and CPU limits), and figures
+// left open by matplotlib are saved there and sent to the user.
+type PythonTool struct {
+	workspace  string
+	backend    ExecBackend
+	env        []string
+	python     string
+	memoryMB   int
+	cpuSeconds int
+	timeout    time.Duration
+	idle       time.Duration
+	maxOutput  int
+
+	mu           sync.Mutex
+	interpreters map[string]*pythonInterpreter
+	stopped      map[string]string // why a session's interpreter went away
+}
+
+func NewPythonTool(workspace string) *PythonTool {
+	return &PythonTool{
+		workspace:    workspace,
+		backend:      HostBackend{},
+		python:       "python3",
+		memoryMB:     512,
+		cpuSeconds:   60,
+		timeout:      60 * time.Second,
+		idle:         30 * time.Minute,
+		maxOutput:    10000,
+		interpreters: make(map[string]*pythonInterpreter),
+		stopped:      make(map[string]string),
+	}
+}
+
+// SetBackend sets where interpreters run; containers need python3 in the image.
+func (t *PythonTool) SetBackend(backend ExecBackend) {
+	if backend != nil {
+		t.backend = backend
+	}
+}
+
+// SetEnv sets the interpreters' environment (see ExecBackend.Command).
+func (t *PythonTool) SetEnv(env []string) {
+	t.env = env
+}
+
+// SetPython sets the interpreter binary used on the host.
+func (t *PythonTool) SetPython(python string) {
+	if python != "" {
+		t.python = python
+	}
+}
+
+// SetLimits sets the memory per interpreter, the CPU time and wall time
+// per call, and how long an unused interpreter is kept. Zero values keep
+// the defaults; a negative memory or CPU limit disables it.
+func (t *PythonTool) SetLimits(memoryMB, cpuSeconds int, timeout, idle time.Duration) {
+	if memoryMB != 0 {
+		t.memoryMB = max(memoryMB, 0)
+	}
+	if cpuSeconds != 0 {
+		t.cpuSeconds = max(cpuSeconds, 0)
+	}
+	if timeout > 0 {
+		t.timeout = timeout
+	}
+	if idle > 0 {
+		t.idle = idle
+	}
+}
+
+// SetMaxOutput caps the output returned per call.
+func (t *PythonTool) SetMaxOutput(n int) {
+	if n > 0 {
+		t.maxOutput = n
+	}
+}
+
+func (t *PythonTool) Name() string {
+	return "python"
+}
+
+func (t *PythonTool) Description() string {
+	desc := "Run Python code in a persistent interpreter: variables, imports and loaded data stay available in later calls of this conversation. " +
+		"The value of a final expression is shown, like at the >>> prompt. " +
+		fmt.Sprintf("Code runs in the workspace folder %s/, which other tools can read and write. ", PythonScratchDir) +
+		"Open matplotlib figures are saved as PNG files and sent to the user; don't call plt.show(). " +
+		"Use print for what you need to see, and keep large data out of the output."
+	if note := t.backend.Describe(); note != "" {
+		desc += " " + note
+	}
+	return desc
+}
+
+func (t *PythonTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"code": map[string]interface{}{
+				"type":        "string",
+				"description": "Python code to run",
+			},
+			"reset": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Start a fresh interpreter first, forgetting all variables",
+			},
+			"timeout_seconds": map[string]interface{}{
+				"type":        "integer",
+				"description": fmt.Sprintf("Wall-clock limit for this call (default %d). The interpreter is restarted if it runs out.", int(t.timeout.Seconds())),
+			},
+		},
+	}
+}
+
+// ConfirmationSummary shows the code, for users who approve each run.
+func (t *PythonTool) ConfirmationSummary(args map[string]interface{}) string {
+	code, _ := args["code"].(string)
+	if reset, _ := args["reset"].(bool); reset {
+		return "(fresh interpreter)\n" + code
+	}
+	return code
+}
+
+func (t *PythonTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	code, _ := args["code"].(string)
+	reset, _ := args["reset"].(bool)
+	if strings.TrimSpace(code) == "" && !reset {
+		return ErrorResult("code is required")
+	}
+	key := SessionKeyFromContext(ctx)
+	if key == "" {
+		key = "default"
+	}
+
+	t.stopIdle()
+	if reset {
+		t.stop(key, "")
+		if strings.TrimSpace(code) == "" {
+			return NewToolResult("Started a fresh Python interpreter")
+		}
+	}
+	interp, note, err := t.interpreter(key)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to start Python: %v", err)).WithError(err)
+	}
+
+	timeout := t.timeout
+	if secs, ok := args["timeout_seconds"].(float64); ok && secs > 0 {
+		timeout = min(time.Duration(secs)*time.Second, maxPythonTimeout)
+	}
+	reply, err := interp.run(ctx, code, timeout)
+	if err != nil {
+		t.stop(key, "")
+		msg := fmt.Sprintf("%v; the interpreter was stopped and its variables are lost", err)
+		if reply.Output != "" {
+			msg += ". Output so far:\n" + reply.Output
+		}
+		return ErrorResult(msg).WithError(err)
+	}
+	return t.result(note, reply)
+}
+
+// result turns an interpreter's reply into the tool result.
+func (t *PythonTool) result(note string, reply pythonReply) *ToolResult {
+	var sb strings.Builder
+	if note != "" {
+		sb.WriteString(note + "\n")
+	}
+	sb.WriteString(strings.TrimRight(reply.Output, "\n"))
+	if reply.Dropped > 0 {
+		fmt.Fprintf(&sb, "\n... (truncated, about %d more bytes)", reply.Dropped)
+	}
+	if reply.Error != "" {
+		if sb.Len() > 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(strings.TrimRight(reply.Error, "\n"))
+	}
+
+	var attachments []Attachment
+	for _, plot := range reply.Plots {
+		rel := filepath.Join(PythonScratchDir, filepath.FromSlash(plot))
+		if sb.Len() > 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString("Saved plot: " + rel)
+		attachments = append(attachments, Attachment{Path: filepath.Join(t.workspace, rel)})
+	}
+
+	text := sb.String()
+	if text == "" {
+		text = "(no output)"
+	}
+	var result *ToolResult
+	if reply.Error != "" {
+		result = ErrorResult(text)
+	} else {
+		result = NewToolResult(text)
+	}
+	return result.WithAttachments(attachments...)
+}
+
+// interpreter returns the session's interpreter, starting one if needed,
+// with a note when the session's earlier interpreter was stopped.
+func (t *PythonTool) interpreter(key string) (*pythonInterpreter, string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if interp, ok := t.interpreters[key]; ok && !interp.exited() {
+		interp.lastUsed = time.Now()
+		return interp, "", nil
+	}
+	note := ""
+	if reason, ok := t.stopped[key]; ok && reason != "" {
+		note = fmt.Sprintf("(new interpreter: the previous one %s, so earlier variables are gone)", reason)
+	}
+	delete(t.stopped, key)
+	delete(t.interpreters, key)
+
+	if len(t.interpreters) >= maxPythonInterpreters {
+		var oldest string
+		for k, interp := range t.interpreters {
+			if oldest == "" || interp.lastUsed.Before(t.interpreters[oldest].lastUsed) {
+				oldest = k
+			}
+		}
+		t.interpreters[oldest].close()
+		delete(t.interpreters, oldest)
+		t.stopped[oldest] = "was stopped to make room for another conversation"
+	}
+
+	interp, err := t.start()
+	if err != nil {
+		return nil, "", err
+	}
+	t.interpreters[key] = interp
+	return interp, note, nil
+}
+
+// start launches an interpreter running the driver script.
+func (t *PythonTool) start() (*pythonInterpreter, error) {
+	scratch := filepath.Join(t.workspace, PythonScratchDir)
+	if err := os.MkdirAll(scratch, 0755); err != nil {
+		return nil, err
+	}
+	python, scratchArg := t.python, scratch
+	if container, ok := t.backend.(*ContainerBackend); ok {
+		// The image's python, and the scratch folder as mounted there
+		python = "python3"
+		var err error
+		if scratchArg, err = container.containerPath(scratch); err != nil {
+			return nil, err
+		}
+	}
+	command := strings.Join([]string{
+		"exec", shellQuote(python), "-u", "-c", shellQuote(pythonDriver), shellQuote(scratchArg),
+		strconv.Itoa(t.memoryMB), strconv.Itoa(t.cpuSeconds), strconv.Itoa(t.maxOutput),
+	}, " ")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd, cleanup, err := t.backend.Command(ctx, command, scratch, t.env)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	stderr := &boundedBuffer{max: 4096}
+	cmd.Stderr = stderr
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	interp := &pythonInterpreter{
+		stdin:    stdin,
+		replies:  make(chan []byte, 1),
+		done:     make(chan struct{}),
+		cancel:   cancel,
+		cleanup:  cleanup,
+		lastUsed: time.Now(),
+	}
+	go func() {
+		defer close(interp.done)
+		r := bufio.NewReader(stdout)
+		for {
+			line, err := r.ReadBytes('\n')
+			if err != nil {
+				break
+			}
+			interp.replies <- line
+		}
+		err := cmd.Wait()
+		interp.exitReason = strings.TrimSpace(stderr.String())
+		if interp.exitReason == "" && err != nil {
+			interp.exitReason = err.Error()
+		}
+	}()
+	return interp, nil
+}
+
+// stop closes a session's interpreter, remembering reason for the next call.
+func (t *PythonTool) stop(key, reason string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if interp, ok := t.interpreters[key]; ok {
+		interp.close()
+		delete(t.interpreters, key)
+	}
+	if reason != "" {
+		t.stopped[key] = reason
+	}
+}
+
+// stopIdle closes interpreters unused for longer than the idle timeout.
+func (t *PythonTool) stopIdle() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key, interp := range t.interpreters {
+		if time.Since(interp.lastUsed) > t.idle && interp.mu.TryLock() {
+			interp.close()
+			interp.mu.Unlock()
+			delete(t.interpreters, key)
+			t.stopped[key] = fmt.Sprintf("was unused for %v", t.idle)
+		}
+	}
+}
+
+// Close stops all interpreters.
+func (t *PythonTool) Close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key, interp := range t.interpreters {
+		interp.close()
+		delete(t.interpreters, key)
+	}
+}
+
+// Sessions returns the keys of the sessions with a running interpreter, sorted.
+func (t *PythonTool) Sessions() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	keys := make([]string, 0, len(t.interpreters))
+	for key := range t.interpreters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// pythonInterpreter is one running driver process.
+type pythonInterpreter struct {
+	stdin      io.WriteCloser
+	replies    chan []byte   // one JSON line per request
+	done       chan struct{} // closed when the process has exited
+	exitReason string        // stderr or exit status, set before done closes
+	cancel     context.CancelFunc
+	cleanup    func()
+	lastUsed   time.Time
+	mu         sync.Mutex // one run at a time
+}
+
+type pythonReply struct {
+	Output  string   `json:"output"`
+	Dropped int      `json:"dropped"`
+	Error   string   `json:"error"`
+	Plots   []string `json:"plots"`
+}
+
+func (p *pythonInterpreter) exited() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *pythonInterpreter) close() {
+	p.stdin.Close()
+	p.cancel()
+	p.cleanup()
+}
+
+// run sends code to the interpreter and waits for its reply.
+func (p *pythonInterpreter) run(ctx context.Context, code string, timeout time.Duration) (pythonReply, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	defer func() { p.lastUsed = time.Now() }()
+
+	request, _ := json.Marshal(map[string]string{"code": code})
+	if _, err := p.stdin.Write(append(request, '\n')); err != nil {
+		return pythonReply{}, fmt.Errorf("the interpreter has exited")
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case line := <-p.replies:
+		var reply pythonReply
+		if err := json.Unmarshal(line, &reply); err != nil {
+			return pythonReply{}, fmt.Errorf("unreadable reply from the interpreter: %w", err)
+		}
+		return reply, nil
+	case <-p.done:
+		reason := p.exitReason
+		if reason == "" {
+			reason = "no error output"
+		}
+		return pythonReply{}, fmt.Errorf("the interpreter exited (%s), perhaps over its memory or CPU limit", lastLine(reason))
+	case <-timer.C:
+		return pythonReply{}, fmt.Errorf("timed out after %v", timeout)
+	case <-ctx.Done():
+		return pythonReply{}, ctx.Err()
+	}
+}
+
+// lastLine returns the last line of s, where errors usually end up.
+func lastLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		return s[i+1:]
+	}
+	return s
+}
@@ -0,0 +1,162 @@
+# The interpreter behind picoclaw's python tool. It reads one JSON request
+# per line on stdin, runs the code in a namespace kept between requests, and
+# answers each with one JSON line on the original stdout.
+#
+# Arguments: scratch directory, memory limit (MB), CPU seconds per run and
+# the most output bytes to return (0 for no limit).
+
+import ast
+import json
+import linecache
+import os
+import signal
+import sys
+import tempfile
+import time
+import traceback
+
+try:
+    import resource
+except ImportError:  # not on Windows
+    resource = None
+
+
+class CPULimitExceeded(Exception):
+    pass
+
+
+def on_cpu_limit(signum, frame):
+    raise CPULimitExceeded("CPU time limit exceeded")
+
+
+def main():
+    global SCRATCH
+    scratch = SCRATCH = os.path.abspath(sys.argv[1])
+    memory_mb, cpu_seconds, max_output = (int(a) for a in sys.argv[2:5])
+
+    os.makedirs(scratch, exist_ok=True)
+    os.chdir(scratch)
+    sys.path.insert(0, scratch)
+    sys.argv = [""]
+    # Plots are saved to files, never shown in a window
+    os.environ["MPLBACKEND"] = "Agg"
+
+    if resource is not None:
+        if memory_mb > 0:
+            limit = memory_mb * 1024 * 1024
+            resource.setrlimit(resource.RLIMIT_AS, (limit, limit))
+        if cpu_seconds > 0:
+            signal.signal(signal.SIGXCPU, on_cpu_limit)
+
+    # Requests and replies use copies of stdin and stdout, so the code can
+    # neither read the next request nor garble a reply
+    requests = os.fdopen(os.dup(0), "r", encoding="utf-8")
+    replies = os.fdopen(os.dup(1), "w", encoding="utf-8")
+    devnull = os.open(os.devnull, os.O_RDONLY)
+    os.dup2(devnull, 0)
+    os.close(devnull)
+
+    namespace = {"__name__": "__main__", "__builtins__": __builtins__}
+    cell = 0
+    for line in requests:
+        cell += 1
+        code = json.loads(line)["code"]
+        reply = run(code, cell, namespace, cpu_seconds, max_output)
+        replies.write(json.dumps(reply) + "\n")
+        replies.flush()
+
+
+def run(code, cell, namespace, cpu_seconds, max_output):
+    capture = tempfile.TemporaryFile()
+    sys.stdout.flush()
+    sys.stderr.flush()
+    saved = os.dup(1), os.dup(2)
+    # At the descriptor level, so output of subprocesses is captured too
+    os.dup2(capture.fileno(), 1)
+    os.dup2(capture.fileno(), 2)
+
+    if resource is not None and cpu_seconds > 0:
+        usage = resource.getrusage(resource.RUSAGE_SELF)
+        used = int(usage.ru_utime + usage.ru_stime)
+        _, hard = resource.getrlimit(resource.RLIMIT_CPU)
+        soft = used + cpu_seconds
+        if hard != resource.RLIM_INFINITY:
+            soft = min(soft, hard)
+        resource.setrlimit(resource.RLIMIT_CPU, (soft, hard))
+
+    error = None
+    try:
+        execute(code, "<cell %d>" % cell, namespace)
+    except BaseException as e:
+        tb = e.__traceback__
+        # Leave out this file's frames
+        while tb is not None and tb.tb_frame.f_code.co_filename == DRIVER:
+            tb = tb.tb_next
+        error = "".join(traceback.format_exception(type(e), e, tb))
+
+    if resource is not None and cpu_seconds > 0:
+        # No limit between runs, so the signal can't interrupt this loop
+        _, hard = resource.getrlimit(resource.RLIMIT_CPU)
+        resource.setrlimit(resource.RLIMIT_CPU, (hard, hard))
+
+    plots = []
+    try:
+        plots = save_plots(cell)
+    except Exception as e:
+        error = (error or "") + "Saving plots failed: %s\n" % e
+
+    sys.stdout.flush()
+    sys.stderr.flush()
+    os.dup2(saved[0], 1)
+    os.dup2(saved[1], 2)
+    os.close(saved[0])
+    os.close(saved[1])
+
+    size = capture.seek(0, os.SEEK_END)
+    capture.seek(0)
+    data = capture.read(max_output if max_output > 0 else -1)
+    capture.close()
+    return {
+        "output": data.decode("utf-8", "replace"),
+        "dropped": size - len(data),
+        "error": error,
+        "plots": plots,
+    }
+
+
+def execute(code, filename, namespace):
+    # Keep the source for tracebacks
+    linecache.cache[filename] = (len(code), None, code.splitlines(True), filename)
+    tree = ast.parse(code, filename, "exec")
+    last = None
+    if tree.body and isinstance(tree.body[-1], ast.Expr):
+        # Like the interactive prompt, show the value of a final expression
+        last = ast.Expression(tree.body.pop().value)
+    exec(compile(tree, filename, "exec"), namespace)
+    if last is not None:
+        value = eval(compile(last, filename, "eval"), namespace)
+        if value is not None:
+            print(repr(value))
+
+
+def save_plots(cell):
+    # Names are relative to the scratch directory, wherever the code went
+    plt = sys.modules.get("matplotlib.pyplot")
+    if plt is None:
+        return []
+    plots = []
+    stamp = time.strftime("%Y%m%d-%H%M%S")
+    for i, num in enumerate(plt.get_fignums(), 1):
+        os.makedirs(os.path.join(SCRATCH, "plots"), exist_ok=True)
+        name = os.path.join("plots", "plot-%s-%d-%d.png" % (stamp, cell, i))
+        plt.figure(num).savefig(os.path.join(SCRATCH, name), dpi=100, bbox_inches="tight")
+        plots.append(name)
+    plt.close("all")
+    return plots
+
+
+DRIVER = run.__code__.co_filename
+SCRATCH = "."
+
+if __name__ == "__main__":
+    main()
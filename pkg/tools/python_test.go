@@ -0,0 +1,153 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestPythonTool returns a python tool in a temporary workspace,
+// skipping without python3
+func newTestPythonTool(t *testing.T) (*PythonTool, string) {
+	t.Helper()
+	if _, err := exec.LookPath("python3"); err != nil {
+		t.Skip("python3 is not installed")
+	}
+	dir := t.TempDir()
+	tool := NewPythonTool(dir)
+	t.Cleanup(tool.Close)
+	return tool, dir
+}
+
+// TestPythonToolState verifies variables carry over within a session but
+// not across sessions, and a final expression is shown
+func TestPythonToolState(t *testing.T) {
+	tool, dir := newTestPythonTool(t)
+	ctx := WithSessionKey(context.Background(), "chat-1")
+
+	result := tool.Execute(ctx, map[string]interface{}{"code": "import os\nx = 20\nprint('hi')\nopen('out.txt', 'w').write('saved')"})
+	if result.IsError || result.ForLLM != "hi\n5" {
+		t.Fatalf("Expected the print and the final value, got %q", result.ForLLM)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, PythonScratchDir, "out.txt")); err != nil || string(data) != "saved" {
+		t.Errorf("Expected the file in the scratch folder, got %q, %v", data, err)
+	}
+
+	result = tool.Execute(ctx, map[string]interface{}{"code": "x * 2 + 2"})
+	if result.ForLLM != "42" {
+		t.Errorf("Expected x kept, got %q", result.ForLLM)
+	}
+	result = tool.Execute(ctx, map[string]interface{}{"code": "os.system('echo from a subprocess')"})
+	if !strings.Contains(result.ForLLM, "from a subprocess") {
+		t.Errorf("Expected subprocess output captured, got %q", result.ForLLM)
+	}
+
+	other := WithSessionKey(context.Background(), "chat-2")
+	result = tool.Execute(other, map[string]interface{}{"code": "x"})
+	if !result.IsError || !strings.Contains(result.ForLLM, "NameError") {
+		t.Errorf("Expected another session not to see x, got %q", result.ForLLM)
+	}
+
+	result = tool.Execute(ctx, map[string]interface{}{"code": "x", "reset": true})
+	if !result.IsError || !strings.Contains(result.ForLLM, "NameError") {
+		t.Errorf("Expected reset to forget x, got %q", result.ForLLM)
+	}
+}
+
+// TestPythonToolErrors verifies tracebacks point at the code, output is
+// cut, and a timeout restarts the interpreter
+func TestPythonToolErrors(t *testing.T) {
+	tool, _ := newTestPythonTool(t)
+	tool.SetMaxOutput(100)
+	ctx := context.Background()
+
+	result := tool.Execute(ctx, map[string]interface{}{"code": "print('before')\ndef f():\n    return 1 / 0\nf()"})
+	if !result.IsError {
+		t.Fatalf("Expected an error, got %q", result.ForLLM)
+	}
+	for _, want := range []string{"before", `File "<cell 1>", line 3, in f`, "return 1 / 0", "ZeroDivisionError"} {
+		if !strings.Contains(result.ForLLM, want) {
+			t.Errorf("Expected %q in\n%s", want, result.ForLLM)
+		}
+	}
+	if strings.Contains(result.ForLLM, "execute") {
+		t.Errorf("Expected the driver's frames left out, got\n%s", result.ForLLM)
+	}
+
+	result = tool.Execute(ctx, map[string]interface{}{"code": "print('x' * 1000)"})
+	if !strings.Contains(result.ForLLM, "truncated, about 901 more bytes") {
+		t.Errorf("Expected the output cut, got %q", result.ForLLM)
+	}
+
+	tool.Execute(ctx, map[string]interface{}{"code": "y = 1"})
+	result = tool.Execute(ctx, map[string]interface{}{"code": "import time\nprint('waiting', flush=True)\ntime.sleep(30)", "timeout_seconds": float64(1)})
+	if !result.IsError || !strings.Contains(result.ForLLM, "timed out") {
+		t.Fatalf("Expected a timeout, got %q", result.ForLLM)
+	}
+	result = tool.Execute(ctx, map[string]interface{}{"code": "'y' in globals()"})
+	if result.ForLLM != "False" {
+		t.Errorf("Expected a fresh interpreter after the timeout, got %q", result.ForLLM)
+	}
+}
+
+// TestPythonToolLimits verifies the memory and CPU limits stop runaway
+// code without losing the session
+func TestPythonToolLimits(t *testing.T) {
+	tool, _ := newTestPythonTool(t)
+	tool.SetLimits(256, 1, 30*time.Second, 0)
+	ctx := context.Background()
+
+	tool.Execute(ctx, map[string]interface{}{"code": "kept = 'yes'"})
+	result := tool.Execute(ctx, map[string]interface{}{"code": "data = bytearray(1024 * 1024 * 1024)"})
+	if !result.IsError || !strings.Contains(result.ForLLM, "MemoryError") {
+		t.Errorf("Expected a MemoryError, got %q", result.ForLLM)
+	}
+	result = tool.Execute(ctx, map[string]interface{}{"code": "while True:\n    pass"})
+	if !result.IsError || !strings.Contains(result.ForLLM, "CPU time limit exceeded") {
+		t.Errorf("Expected the CPU limit, got %q", result.ForLLM)
+	}
+	if result := tool.Execute(ctx, map[string]interface{}{"code": "kept"}); result.ForLLM != "'yes'" {
+		t.Errorf("Expected the session kept, got %q", result.ForLLM)
+	}
+}
+
+// TestPythonToolPlots verifies open figures are saved to the scratch folder
+// and attached, using a stand-in for matplotlib.pyplot
+func TestPythonToolPlots(t *testing.T) {
+	tool, dir := newTestPythonTool(t)
+	fake := `import sys, types
+plt = types.ModuleType("matplotlib.pyplot")
+class Figure:
+    def savefig(self, path, **kwargs):
+        open(path, "wb").write(b"png")
+figures = {1: Figure(), 2: Figure()}
+plt.get_fignums = lambda: sorted(figures)
+plt.figure = lambda num: figures[num]
+plt.close = lambda which: figures.clear()
+sys.modules["matplotlib.pyplot"] = plt`
+
+	result := tool.Execute(context.Background(), map[string]interface{}{"code": fake})
+	if result.IsError || len(result.Attachments) != 2 {
+		t.Fatalf("Expected two plots, got %q with %d attachments", result.ForLLM, len(result.Attachments))
+	}
+	for _, a := range result.Attachments {
+		if !strings.HasPrefix(a.Path, filepath.Join(dir, PythonScratchDir, "plots")) {
+			t.Errorf("Expected the plot in the scratch folder, got %s", a.Path)
+		}
+		if data, err := os.ReadFile(a.Path); err != nil || string(data) != "png" {
+			t.Errorf("Expected the plot saved, got %q, %v", data, err)
+		}
+	}
+	if !strings.Contains(result.ForLLM, "Saved plot: python/plots/plot-") {
+		t.Errorf("Expected the plots listed, got %q", result.ForLLM)
+	}
+
+	result = tool.Execute(context.Background(), map[string]interface{}{"code": "1"})
+	if len(result.Attachments) != 0 {
+		t.Errorf("Expected closed figures not saved again, got %d", len(result.Attachments))
+	}
+}
@@ -3,6 +3,10 @@ package tools
 import (
 	"context"
 	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -10,28 +14,277 @@ import (
 	"github.com/sipeed/picoclaw/pkg/providers"
 )
 
+// NamespaceSeparator joins a namespace and a tool name, e.g. "hw__i2c".
+// Providers only accept letters, digits, _ and - in tool names.
+const NamespaceSeparator = "__"
+
+// validToolName is what providers accept as a tool name.
+var validToolName = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// toolEntry is a registered tool together with the name it is exposed under
+// and whether it is currently offered to the model.
+type toolEntry struct {
+	name    string
+	tool    Tool
+	enabled bool
+	stats   ToolStats
+	health  toolHealth
+}
+
+// description returns the tool's description, flagged if it is degraded.
+func (e *toolEntry) description(desc string) string {
+	if e.health.degraded() {
+		return e.health.note() + desc
+	}
+	return desc
+}
+
+// ToolFilter reports whether the named tool should be offered for a request.
+// It is used to apply per-session enable/disable decisions on top of the
+// registry-wide state.
+type ToolFilter func(name string) bool
+
 type ToolRegistry struct {
-	tools map[string]Tool
-	mu    sync.RWMutex
+	tools       map[string]*toolEntry
+	approval    *ApprovalGate
+	idempotency *IdempotencyStore
+	pool        *WorkerPool
+	output      *OutputPolicy
+	dryRun      bool
+	mu          sync.RWMutex
 }
 
 func NewToolRegistry() *ToolRegistry {
 	return &ToolRegistry{
-		tools: make(map[string]Tool),
+		tools: make(map[string]*toolEntry),
+	}
+}
+
+// Register adds a tool under its own name. A tool that is already registered
+// under the same name is replaced and a warning is logged; use RegisterUnique
+// when a collision should be treated as an error. A tool whose name
+// providers would reject, or that could be mistaken for a namespaced one, is
+// not registered and an error is returned.
+func (r *ToolRegistry) Register(tool Tool) error {
+	name := tool.Name()
+	if err := checkToolName("", name); err != nil {
+		logger.ErrorCF("tool", "Invalid tool name, not registering the tool",
+			map[string]interface{}{
+				"tool":  name,
+				"error": err.Error(),
+			})
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.tools[name]; exists {
+		logger.WarnCF("tool", "Tool name collision, replacing existing tool",
+			map[string]interface{}{
+				"tool": name,
+			})
+	}
+	r.tools[name] = &toolEntry{name: name, tool: tool, enabled: true}
+	return nil
+}
+
+// RegisterUnique adds a tool under its own name and fails if the name is taken.
+func (r *ToolRegistry) RegisterUnique(tool Tool) error {
+	return r.RegisterNamespaced("", tool)
+}
+
+// RegisterNamespaced adds a tool as "<namespace>__<name>" so that tools from
+// different sources (plugins, remote agents, hardware) cannot shadow each other.
+// An empty namespace registers the tool under its plain name.
+func (r *ToolRegistry) RegisterNamespaced(namespace string, tool Tool) error {
+	if err := checkToolName(namespace, tool.Name()); err != nil {
+		return err
+	}
+	name := QualifiedToolName(namespace, tool.Name())
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.tools[name]; exists {
+		return fmt.Errorf("tool %q is already registered", name)
+	}
+	r.tools[name] = &toolEntry{name: name, tool: tool, enabled: true}
+	return nil
+}
+
+// Unregister removes a tool. It returns false if the tool was not registered.
+func (r *ToolRegistry) Unregister(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.tools[name]; !ok {
+		return false
+	}
+	delete(r.tools, name)
+	return true
+}
+
+// SetApprovalGate installs the gate consulted before tools that require
+// confirmation are executed. A nil gate disables approvals.
+func (r *ToolRegistry) SetApprovalGate(gate *ApprovalGate) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.approval = gate
+}
+
+// SetIdempotencyStore installs the store used to skip repeated
+// side-effecting calls within a turn. A nil store disables deduplication.
+func (r *ToolRegistry) SetIdempotencyStore(store *IdempotencyStore) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.idempotency = store
+}
+
+// SetWorkerPool bounds concurrent tool calls with pool. Without a pool,
+// calls run as soon as they are made.
+func (r *ToolRegistry) SetWorkerPool(pool *WorkerPool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pool = pool
+}
+
+// SetOutputPolicy caps the output of tool calls with policy. Without a
+// policy, results reach the model whole.
+func (r *ToolRegistry) SetOutputPolicy(policy *OutputPolicy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.output = policy
+}
+
+// SetDryRun switches dry-run mode. While it is on, mutating tools report
+// what they would do instead of doing it.
+func (r *ToolRegistry) SetDryRun(dryRun bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.dryRun = dryRun
+}
+
+// DryRun reports whether dry-run mode is on.
+func (r *ToolRegistry) DryRun() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.dryRun
+}
+
+// QualifiedToolName returns the name a tool is exposed under in a namespace.
+func QualifiedToolName(namespace, name string) string {
+	namespace = strings.TrimSpace(namespace)
+	if namespace == "" {
+		return name
+	}
+	return namespace + NamespaceSeparator + name
+}
+
+// checkToolName returns an error if the tool name in namespace is one
+// providers would reject. Neither part may contain the separator, or
+// namespace a with tool b__c and namespace a__b with tool c would both be
+// a__b__c.
+func checkToolName(namespace, name string) error {
+	namespace = strings.TrimSpace(namespace)
+	if strings.Contains(namespace, NamespaceSeparator) {
+		return fmt.Errorf("invalid tool namespace %q (%s separates namespaces)", namespace, NamespaceSeparator)
+	}
+	if strings.Contains(name, NamespaceSeparator) {
+		return fmt.Errorf("invalid tool name %q (%s separates namespaces)", name, NamespaceSeparator)
+	}
+	if qualified := QualifiedToolName(namespace, name); !validToolName.MatchString(qualified) {
+		return fmt.Errorf("invalid tool name %q (at most 64 letters, digits, _ and -)", qualified)
+	}
+	return nil
+}
+
+// SetEnabled enables or disables a registered tool. Disabled tools stay
+// registered but are neither offered to the model nor executable.
+// Returns false if the tool is unknown.
+func (r *ToolRegistry) SetEnabled(name string, enabled bool) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, ok := r.tools[name]
+	if !ok {
+		return false
 	}
+	entry.enabled = enabled
+	return true
+}
+
+// IsEnabled reports whether a tool is registered and enabled.
+func (r *ToolRegistry) IsEnabled(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	entry, ok := r.tools[name]
+	return ok && entry.enabled
 }
 
-func (r *ToolRegistry) Register(tool Tool) {
+// ApplyDisabled disables every tool in names. A trailing "__*" disables a
+// whole namespace (e.g. "hw__*"). Unknown names are logged and ignored.
+func (r *ToolRegistry) ApplyDisabled(names []string) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	r.tools[tool.Name()] = tool
+
+	for _, name := range names {
+		matched := false
+		for key, entry := range r.tools {
+			if matchToolPattern(name, key) {
+				entry.enabled = false
+				matched = true
+			}
+		}
+		if !matched {
+			logger.WarnCF("tool", "Disabled tool not found in registry",
+				map[string]interface{}{
+					"tool": name,
+				})
+		}
+	}
+}
+
+// SelectTools enables the tools matching enabled, or all if it is empty,
+// except those matching disabled, and disables the rest. Names are as for
+// ApplyDisabled. It works in one step, so a reload never leaves a disabled
+// tool usable in between.
+func (r *ToolRegistry) SelectTools(enabled, disabled []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key, entry := range r.tools {
+		matches := func(name string) bool { return matchToolPattern(name, key) }
+		entry.enabled = (len(enabled) == 0 || slices.ContainsFunc(enabled, matches)) &&
+			!slices.ContainsFunc(disabled, matches)
+	}
+}
+
+// matchToolPattern matches a tool name against an exact name or "ns__*".
+func matchToolPattern(pattern, name string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, NamespaceSeparator+"*"); ok {
+		return strings.HasPrefix(name, prefix+NamespaceSeparator)
+	}
+	return pattern == name
 }
 
 func (r *ToolRegistry) Get(name string) (Tool, bool) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	tool, ok := r.tools[name]
-	return tool, ok
+	entry, ok := r.tools[name]
+	if !ok {
+		return nil, false
+	}
+	return entry.tool, true
+}
+
+// ConcurrencySafe reports whether calls to the named tool may run alongside
+// other calls of the same round.
+func (r *ToolRegistry) ConcurrencySafe(name string) bool {
+	tool, ok := r.Get(name)
+	if !ok {
+		return false
+	}
+	ct, ok := tool.(ConcurrentTool)
+	return ok && ct.ConcurrencySafe()
 }
 
 func (r *ToolRegistry) Execute(ctx context.Context, name string, args map[string]interface{}) *ToolResult {
@@ -48,7 +301,14 @@ func (r *ToolRegistry) ExecuteWithContext(ctx context.Context, name string, args
 			"args": args,
 		})
 
-	tool, ok := r.Get(name)
+	r.mu.RLock()
+	entry, ok := r.tools[name]
+	gate := r.approval
+	store := r.idempotency
+	pool := r.pool
+	output := r.output
+	dryRun := r.dryRun
+	r.mu.RUnlock()
 	if !ok {
 		logger.ErrorCF("tool", "Tool not found",
 			map[string]interface{}{
@@ -56,6 +316,59 @@ func (r *ToolRegistry) ExecuteWithContext(ctx context.Context, name string, args
 			})
 		return ErrorResult(fmt.Sprintf("tool %q not found", name)).WithError(fmt.Errorf("tool not found"))
 	}
+	if !entry.enabled {
+		logger.WarnCF("tool", "Tool is disabled",
+			map[string]interface{}{
+				"tool": name,
+			})
+		return ErrorResult(fmt.Sprintf("tool %q is disabled", name)).WithError(fmt.Errorf("tool disabled"))
+	}
+	tool := entry.tool
+
+	// Tell the model what's wrong instead of running the tool on bad arguments
+	if problems := ValidateArgs(tool.Parameters(), args); len(problems) > 0 {
+		logger.WarnCF("tool", "Invalid tool arguments",
+			map[string]interface{}{
+				"tool":     name,
+				"problems": problems,
+			})
+		return invalidArgsResult(name, tool, problems)
+	}
+
+	// Don't let the model hammer a backend that is down
+	if refused := r.checkHealth(name, time.Now()); refused != nil {
+		return refused
+	}
+
+	if dryRun && isMutating(tool) {
+		logger.InfoCF("tool", "Dry run, tool not executed",
+			map[string]interface{}{
+				"tool": name,
+			})
+		return dryRunResult(ctx, name, tool, args)
+	}
+
+	// Skip side-effecting calls that already succeeded in this turn
+	var idemKey string
+	if se, ok := tool.(SideEffectTool); ok && store != nil && se.HasSideEffects() {
+		if turnID := TurnIDFromContext(ctx); turnID != "" {
+			idemKey = IdempotencyKey(turnID, name, args)
+			if previous, done := store.Lookup(idemKey); done {
+				logger.InfoCF("tool", "Skipping repeated side-effecting call",
+					map[string]interface{}{
+						"tool":    name,
+						"turn_id": turnID,
+					})
+				return SilentResult(fmt.Sprintf("Already done: this exact %s call succeeded earlier in this turn and was not repeated. Previous result: %s", name, previous))
+			}
+		}
+	}
+
+	if gate != nil {
+		if denied := gate.Check(ctx, name, tool, args, channel, chatID); denied != nil {
+			return denied
+		}
+	}
 
 	// If tool implements ContextualTool, set context
 	if contextualTool, ok := tool.(ContextualTool); ok && channel != "" && chatID != "" {
@@ -71,9 +384,32 @@ func (r *ToolRegistry) ExecuteWithContext(ctx context.Context, name string, args
 			})
 	}
 
+	if pool != nil {
+		release, err := pool.Acquire(ctx, name)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("tool %q was not run: %v", name, err)).WithError(err)
+		}
+		defer release()
+	}
+
 	start := time.Now()
 	result := tool.Execute(ctx, args)
 	duration := time.Since(start)
+	r.recordCall(name, duration, result.IsError)
+	r.recordHealth(name, result, time.Now())
+	if output != nil {
+		result = output.Apply(ctx, name, args, result)
+	}
+
+	if idemKey != "" && !result.IsError && !result.Async {
+		if err := store.Record(idemKey, name, result.ForLLM); err != nil {
+			logger.WarnCF("tool", "Failed to record idempotency key",
+				map[string]interface{}{
+					"tool":  name,
+					"error": err.Error(),
+				})
+		}
+	}
 
 	// Log based on result type
 	if result.IsError {
@@ -101,13 +437,32 @@ func (r *ToolRegistry) ExecuteWithContext(ctx context.Context, name string, args
 	return result
 }
 
+// enabledEntries returns the enabled tools accepted by filter, sorted by name
+// so that the tool list sent to providers is stable between requests.
+// Must be called with the lock held.
+func (r *ToolRegistry) enabledEntries(filter ToolFilter) []*toolEntry {
+	entries := make([]*toolEntry, 0, len(r.tools))
+	for _, entry := range r.tools {
+		if !entry.enabled {
+			continue
+		}
+		if filter != nil && !filter(entry.name) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	return entries
+}
+
 func (r *ToolRegistry) GetDefinitions() []map[string]interface{} {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	definitions := make([]map[string]interface{}, 0, len(r.tools))
-	for _, tool := range r.tools {
-		definitions = append(definitions, ToolToSchema(tool))
+	entries := r.enabledEntries(nil)
+	definitions := make([]map[string]interface{}, 0, len(entries))
+	for _, entry := range entries {
+		definitions = append(definitions, toolSchema(entry.name, entry.tool))
 	}
 	return definitions
 }
@@ -115,12 +470,19 @@ func (r *ToolRegistry) GetDefinitions() []map[string]interface{} {
 // ToProviderDefs converts tool definitions to provider-compatible format.
 // This is the format expected by LLM provider APIs.
 func (r *ToolRegistry) ToProviderDefs() []providers.ToolDefinition {
+	return r.ToProviderDefsFiltered(nil)
+}
+
+// ToProviderDefsFiltered is like ToProviderDefs but only includes tools
+// accepted by filter. A nil filter includes every enabled tool.
+func (r *ToolRegistry) ToProviderDefsFiltered(filter ToolFilter) []providers.ToolDefinition {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	definitions := make([]providers.ToolDefinition, 0, len(r.tools))
-	for _, tool := range r.tools {
-		schema := ToolToSchema(tool)
+	entries := r.enabledEntries(filter)
+	definitions := make([]providers.ToolDefinition, 0, len(entries))
+	for _, entry := range entries {
+		schema := toolSchema(entry.name, entry.tool)
 
 		// Safely extract nested values with type checks
 		fn, ok := schema["function"].(map[string]interface{})
@@ -136,7 +498,7 @@ func (r *ToolRegistry) ToProviderDefs() []providers.ToolDefinition {
 			Type: "function",
 			Function: providers.ToolFunctionDefinition{
 				Name:        name,
-				Description: desc,
+				Description: entry.description(desc),
 				Parameters:  params,
 			},
 		})
@@ -144,7 +506,7 @@ func (r *ToolRegistry) ToProviderDefs() []providers.ToolDefinition {
 	return definitions
 }
 
-// List returns a list of all registered tool names.
+// List returns the names of all registered tools, enabled or not, sorted.
 func (r *ToolRegistry) List() []string {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -153,6 +515,7 @@ func (r *ToolRegistry) List() []string {
 	for name := range r.tools {
 		names = append(names, name)
 	}
+	sort.Strings(names)
 	return names
 }
 
@@ -163,15 +526,16 @@ func (r *ToolRegistry) Count() int {
 	return len(r.tools)
 }
 
-// GetSummaries returns human-readable summaries of all registered tools.
+// GetSummaries returns human-readable summaries of all enabled tools.
 // Returns a slice of "name - description" strings.
 func (r *ToolRegistry) GetSummaries() []string {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	summaries := make([]string, 0, len(r.tools))
-	for _, tool := range r.tools {
-		summaries = append(summaries, fmt.Sprintf("- `%s` - %s", tool.Name(), tool.Description()))
+	entries := r.enabledEntries(nil)
+	summaries := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		summaries = append(summaries, fmt.Sprintf("- `%s` - %s", entry.name, entry.description(entry.tool.Description())))
 	}
 	return summaries
 }
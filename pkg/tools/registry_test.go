@@ -0,0 +1,117 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// stubTool is a minimal tool used to exercise the registry.
+type stubTool struct {
+	name string
+}
+
+func (t *stubTool) Name() string        { return t.name }
+func (t *stubTool) Description() string { return "stub " + t.name }
+func (t *stubTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+}
+func (t *stubTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	return NewToolResult("ran " + t.name)
+}
+
+func TestToolRegistry_RegisterUniqueCollision(t *testing.T) {
+	r := NewToolRegistry()
+	if err := r.RegisterUnique(&stubTool{name: "exec"}); err != nil {
+		t.Fatalf("first registration failed: %v", err)
+	}
+	if err := r.RegisterUnique(&stubTool{name: "exec"}); err == nil {
+		t.Error("expected collision error for duplicate name")
+	}
+}
+
+func TestToolRegistry_Namespaced(t *testing.T) {
+	r := NewToolRegistry()
+	r.Register(&stubTool{name: "scan"})
+	if err := r.RegisterNamespaced("hw", &stubTool{name: "scan"}); err != nil {
+		t.Fatalf("namespaced registration should not collide: %v", err)
+	}
+
+	defs := r.ToProviderDefs()
+	if len(defs) != 2 {
+		t.Fatalf("expected 2 definitions, got %d", len(defs))
+	}
+	if defs[0].Function.Name != "hw__scan" || defs[1].Function.Name != "scan" {
+		t.Errorf("expected sorted [hw__scan scan], got [%s %s]", defs[0].Function.Name, defs[1].Function.Name)
+	}
+
+	result := r.Execute(context.Background(), "hw__scan", nil)
+	if result.IsError || result.ForLLM != "ran scan" {
+		t.Errorf("unexpected result executing namespaced tool: %+v", result)
+	}
+}
+
+func TestToolRegistry_InvalidNames(t *testing.T) {
+	r := NewToolRegistry()
+	for _, name := range []string{"hw.i2c", strings.Repeat("x", 65), "hw__scan"} {
+		if err := r.Register(&stubTool{name: name}); err == nil {
+			t.Errorf("expected %q to be refused", name)
+		}
+	}
+	if r.Count() != 0 {
+		t.Errorf("expected invalid names to be refused, got %v", r.List())
+	}
+	if err := r.RegisterNamespaced("my.ns", &stubTool{name: "scan"}); err == nil {
+		t.Error("expected an invalid namespace to be refused")
+	}
+	// Either would be hw__bus__scan, as would namespace hw with tool bus__scan
+	if err := r.RegisterNamespaced("hw__bus", &stubTool{name: "scan"}); err == nil {
+		t.Error("expected a namespace containing __ to be refused")
+	}
+	if err := r.RegisterNamespaced("hw", &stubTool{name: "bus__scan"}); err == nil {
+		t.Error("expected a namespaced tool name containing __ to be refused")
+	}
+	if err := r.RegisterUnique(&stubTool{name: "hw__scan"}); err == nil {
+		t.Error("expected RegisterUnique to refuse a name containing __")
+	}
+	if err := r.RegisterNamespaced("hw", &stubTool{name: "i2c-bus"}); err != nil || !r.IsEnabled("hw__i2c-bus") {
+		t.Errorf("expected a valid namespaced name to be accepted, got %v", err)
+	}
+}
+
+func TestToolRegistry_EnableDisable(t *testing.T) {
+	r := NewToolRegistry()
+	r.Register(&stubTool{name: "exec"})
+	r.RegisterNamespaced("hw", &stubTool{name: "i2c"})
+	r.RegisterNamespaced("hw", &stubTool{name: "spi"})
+
+	r.ApplyDisabled([]string{"hw__*"})
+	if r.IsEnabled("hw__i2c") || r.IsEnabled("hw__spi") {
+		t.Error("expected hw namespace to be disabled")
+	}
+	if len(r.ToProviderDefs()) != 1 {
+		t.Errorf("expected only exec to be offered, got %d tools", len(r.ToProviderDefs()))
+	}
+	if result := r.Execute(context.Background(), "hw__i2c", nil); !result.IsError {
+		t.Error("expected executing a disabled tool to fail")
+	}
+
+	r.SetEnabled("hw__i2c", true)
+	if !r.IsEnabled("hw__i2c") {
+		t.Error("expected hw__i2c to be re-enabled")
+	}
+	if r.Count() != 3 {
+		t.Errorf("disabled tools should stay registered, got count %d", r.Count())
+	}
+}
+
+func TestToolRegistry_ToProviderDefsFiltered(t *testing.T) {
+	r := NewToolRegistry()
+	r.Register(&stubTool{name: "exec"})
+	r.Register(&stubTool{name: "read_file"})
+
+	defs := r.ToProviderDefsFiltered(func(name string) bool { return name != "exec" })
+	if len(defs) != 1 || defs[0].Function.Name != "read_file" {
+		t.Errorf("expected only read_file, got %+v", defs)
+	}
+}
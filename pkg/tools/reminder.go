@@ -0,0 +1,360 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// ReminderTool sets one-shot and recurring reminders on the cron service.
+// Unlike cron jobs, reminders take wall-clock times ("17:00", "tomorrow
+// 9am") in the user's time zone, and are sent to whichever chat the user
+// was last active in when they fire.
+type ReminderTool struct {
+	cronService *cron.CronService
+	msgBus      *bus.MessageBus
+	loc         *time.Location
+	lastActive  func() (channel, chatID string)
+	channel     string
+	chatID      string
+	mu          sync.RWMutex
+}
+
+// NewReminderTool creates a reminder tool. Times are read in loc (the host's
+// zone if nil). lastActive returns the chat the user last wrote from, or
+// empty strings if unknown; reminders then go to the chat they were set in.
+func NewReminderTool(cronService *cron.CronService, msgBus *bus.MessageBus, loc *time.Location, lastActive func() (string, string)) *ReminderTool {
+	if loc == nil {
+		loc = time.Local
+	}
+	return &ReminderTool{
+		cronService: cronService,
+		msgBus:      msgBus,
+		loc:         loc,
+		lastActive:  lastActive,
+	}
+}
+
+func (t *ReminderTool) Name() string {
+	return "reminder"
+}
+
+func (t *ReminderTool) Description() string {
+	return fmt.Sprintf("Set, list or cancel reminders for the user. Use this when the user asks to be reminded of something, e.g. 'remind me at 5pm to take out the trash' → action=set, at='17:00', message='Take out the trash'. Times are in %s.", t.loc)
+}
+
+func (t *ReminderTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"set", "list", "cancel"},
+				"description": "set (default), list or cancel",
+			},
+			"message": map[string]interface{}{
+				"type":        "string",
+				"description": "What to remind the user of, written to them (e.g. 'Take out the trash')",
+			},
+			"at": map[string]interface{}{
+				"type":        "string",
+				"description": "When: '17:00', '5:30pm', 'tomorrow 09:00' or '2026-10-20 09:00'. A bare time means its next occurrence. For repeating reminders, the time of day (and weekday or day of month) of the first one",
+			},
+			"in_minutes": map[string]interface{}{
+				"type":        "integer",
+				"description": "One-shot reminder this many minutes from now, instead of at",
+			},
+			"repeat": map[string]interface{}{
+				"type":        "string",
+				"description": "Repeat the reminder: daily, weekdays, weekly, monthly, or a 5-field cron expression (which replaces at)",
+			},
+			"id": map[string]interface{}{
+				"type":        "string",
+				"description": "For cancel: the reminder ID from list",
+			},
+		},
+		"required": []string{},
+	}
+}
+
+// SetContext records the chat reminders are set from.
+func (t *ReminderTool) SetContext(channel, chatID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.channel = channel
+	t.chatID = chatID
+}
+
+// HasSideEffects marks set as stateful: a retried call within a turn must
+// not add the reminder twice.
+func (t *ReminderTool) HasSideEffects() bool {
+	return true
+}
+
+func (t *ReminderTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	action, _ := args["action"].(string)
+	switch action {
+	case "", "set":
+		return t.set(args)
+	case "list":
+		return t.list()
+	case "cancel":
+		return t.cancel(args)
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action %q: use set, list or cancel", action))
+	}
+}
+
+func (t *ReminderTool) set(args map[string]interface{}) *ToolResult {
+	t.mu.RLock()
+	channel, chatID := t.channel, t.chatID
+	t.mu.RUnlock()
+	if channel == "" || chatID == "" {
+		return ErrorResult("no session context (channel/chat_id not set). Use this tool in an active conversation.")
+	}
+
+	message, _ := args["message"].(string)
+	message = strings.TrimSpace(message)
+	if message == "" {
+		return ErrorResult("message is required")
+	}
+	at, _ := args["at"].(string)
+	repeat, _ := args["repeat"].(string)
+	minutes, _ := args["in_minutes"].(float64)
+
+	schedule, first, err := reminderSchedule(at, minutes, repeat, time.Now(), t.loc)
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+	job, err := t.cronService.AddJobWithPayload(utils.Truncate(message, 30), schedule, cron.CronPayload{
+		Kind:    cron.PayloadReminder,
+		Message: message,
+		Deliver: true,
+		Channel: channel,
+		To:      chatID,
+	})
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to save reminder: %v", err))
+	}
+
+	when := first.Format("Mon Jan 2 15:04")
+	if schedule.Kind == "cron" {
+		when = fmt.Sprintf("%s, first on %s", describeRepeat(repeat), when)
+	}
+	return SilentResult(fmt.Sprintf("Reminder set (id: %s) for %s %s: %s", job.ID, when, t.loc, message))
+}
+
+func (t *ReminderTool) list() *ToolResult {
+	var sb strings.Builder
+	for _, job := range t.cronService.ListJobs(false) {
+		if job.Payload.Kind != cron.PayloadReminder {
+			continue
+		}
+		next := "not scheduled"
+		if job.State.NextRunAtMS != nil {
+			next = time.UnixMilli(*job.State.NextRunAtMS).In(t.loc).Format("Mon Jan 2 15:04")
+		}
+		if job.Schedule.Kind == "cron" {
+			next += " (repeats: " + job.Schedule.Expr + ")"
+		}
+		fmt.Fprintf(&sb, "- %s: %s [id: %s]\n", next, job.Payload.Message, job.ID)
+	}
+	if sb.Len() == 0 {
+		return SilentResult("No reminders set")
+	}
+	return SilentResult(fmt.Sprintf("Reminders (times in %s):\n%s", t.loc, sb.String()))
+}
+
+func (t *ReminderTool) cancel(args map[string]interface{}) *ToolResult {
+	id, _ := args["id"].(string)
+	if id == "" {
+		return ErrorResult("id is required for cancel")
+	}
+	for _, job := range t.cronService.ListJobs(true) {
+		if job.ID == id && job.Payload.Kind == cron.PayloadReminder {
+			t.cronService.RemoveJob(id)
+			return SilentResult(fmt.Sprintf("Reminder cancelled: %s", job.Payload.Message))
+		}
+	}
+	return ErrorResult(fmt.Sprintf("reminder %s not found", id))
+}
+
+// Deliver sends a due reminder to the chat the user was last active in,
+// falling back to the one it was set from. Reminders were asked for, so
+// they are sent with high urgency and come through quiet hours.
+func (t *ReminderTool) Deliver(job *cron.CronJob) {
+	channel, chatID := job.Payload.Channel, job.Payload.To
+	if t.lastActive != nil {
+		if c, id := t.lastActive(); c != "" && id != "" {
+			channel, chatID = c, id
+		}
+	}
+	logger.InfoCF("reminder", "Delivering reminder", map[string]interface{}{
+		"id":      job.ID,
+		"channel": channel,
+	})
+	t.msgBus.PublishOutbound(bus.OutboundMessage{
+		Channel: channel,
+		ChatID:  chatID,
+		Content: "⏰ Reminder: " + job.Payload.Message,
+		Urgency: bus.UrgencyHigh,
+	})
+}
+
+// reminderSchedule turns the tool's at, in_minutes and repeat arguments
+// into a cron schedule, and returns when it first fires.
+func reminderSchedule(at string, minutes float64, repeat string, now time.Time, loc *time.Location) (cron.CronSchedule, time.Time, error) {
+	repeat = strings.ToLower(strings.TrimSpace(repeat))
+	if strings.Count(repeat, " ") >= 4 {
+		next, err := cronNext(repeat, now, loc)
+		if err != nil {
+			return cron.CronSchedule{}, time.Time{}, fmt.Errorf("repeat %q is not a valid cron expression", repeat)
+		}
+		return cron.CronSchedule{Kind: "cron", Expr: repeat, TZ: loc.String()}, next, nil
+	}
+
+	var first time.Time
+	switch {
+	case minutes > 0:
+		if repeat != "" {
+			return cron.CronSchedule{}, time.Time{}, fmt.Errorf("in_minutes is for one-shot reminders; give at with repeat")
+		}
+		first = now.Add(time.Duration(minutes * float64(time.Minute)))
+	case at != "":
+		var err error
+		if first, err = parseReminderTime(at, now, loc); err != nil {
+			return cron.CronSchedule{}, time.Time{}, err
+		}
+	default:
+		return cron.CronSchedule{}, time.Time{}, fmt.Errorf("at or in_minutes is required")
+	}
+
+	if repeat == "" {
+		if !first.After(now) {
+			return cron.CronSchedule{}, time.Time{}, fmt.Errorf("%s is in the past", first.Format("Mon Jan 2 15:04"))
+		}
+		atMS := first.UnixMilli()
+		return cron.CronSchedule{Kind: "at", AtMS: &atMS}, first, nil
+	}
+
+	var expr string
+	switch repeat {
+	case "daily":
+		expr = fmt.Sprintf("%d %d * * *", first.Minute(), first.Hour())
+	case "weekdays":
+		expr = fmt.Sprintf("%d %d * * 1-5", first.Minute(), first.Hour())
+	case "weekly":
+		expr = fmt.Sprintf("%d %d * * %d", first.Minute(), first.Hour(), first.Weekday())
+	case "monthly":
+		expr = fmt.Sprintf("%d %d %d * *", first.Minute(), first.Hour(), first.Day())
+	default:
+		return cron.CronSchedule{}, time.Time{}, fmt.Errorf("unknown repeat %q: use daily, weekdays, weekly, monthly or a cron expression", repeat)
+	}
+	// The first occurrence may be later than at, e.g. weekdays set on a Saturday
+	next, err := cronNext(expr, first.Add(-time.Minute), loc)
+	if err != nil {
+		return cron.CronSchedule{}, time.Time{}, err
+	}
+	return cron.CronSchedule{Kind: "cron", Expr: expr, TZ: loc.String()}, next, nil
+}
+
+// cronNext returns expr's first tick after now, in loc.
+func cronNext(expr string, now time.Time, loc *time.Location) (time.Time, error) {
+	s := cron.CronSchedule{Kind: "cron", Expr: expr, TZ: loc.String()}
+	next := cron.NextRun(s, now)
+	if next == nil {
+		return time.Time{}, fmt.Errorf("invalid cron expression %q", expr)
+	}
+	return time.UnixMilli(*next).In(loc), nil
+}
+
+func describeRepeat(repeat string) string {
+	switch repeat = strings.ToLower(strings.TrimSpace(repeat)); repeat {
+	case "daily", "weekly", "monthly":
+		return repeat
+	case "weekdays":
+		return "every weekday"
+	default:
+		return "repeating (" + repeat + ")"
+	}
+}
+
+// reminderLayouts are the date-and-time forms accepted for at, besides RFC
+// 3339 and bare times of day.
+var reminderLayouts = []string{
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 3:04pm",
+	"2006-01-02 3pm",
+}
+
+// parseReminderTime reads at in loc. A bare time of day ("17:00", "5pm")
+// is its next occurrence; "today" and "tomorrow" may precede one.
+func parseReminderTime(at string, now time.Time, loc *time.Location) (time.Time, error) {
+	s := strings.ToLower(strings.Join(strings.Fields(at), " "))
+	if t, err := time.Parse(time.RFC3339, strings.ToUpper(s)); err == nil {
+		return t.In(loc), nil
+	}
+	s = strings.ReplaceAll(strings.ReplaceAll(s, " am", "am"), " pm", "pm")
+	for _, layout := range reminderLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+
+	local := now.In(loc)
+	day, clock, explicit := local, s, false
+	if rest, ok := strings.CutPrefix(s, "today "); ok {
+		clock, explicit = rest, true
+	} else if rest, ok := strings.CutPrefix(s, "tomorrow "); ok {
+		day, clock, explicit = local.AddDate(0, 0, 1), rest, true
+	}
+	hour, minute, ok := parseClockTime(clock)
+	if !ok {
+		return time.Time{}, fmt.Errorf("cannot read time %q: use e.g. 17:00, 5pm, tomorrow 09:00 or 2026-10-20 09:00", at)
+	}
+	t := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, loc)
+	if !explicit && !t.After(local) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// parseClockTime reads "17:00", "9", "5pm" or "5:30am".
+func parseClockTime(s string) (hour, minute int, ok bool) {
+	pm, am := strings.HasSuffix(s, "pm"), strings.HasSuffix(s, "am")
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "pm"), "am")
+	h, m, hasMinutes := strings.Cut(s, ":")
+	hour, err := strconv.Atoi(h)
+	if err != nil {
+		return 0, 0, false
+	}
+	if hasMinutes {
+		if minute, err = strconv.Atoi(m); err != nil || len(m) != 2 {
+			return 0, 0, false
+		}
+	}
+	if am || pm {
+		if hour < 1 || hour > 12 {
+			return 0, 0, false
+		}
+		hour %= 12
+		if pm {
+			hour += 12
+		}
+	}
+	if hour > 23 || minute > 59 {
+		return 0, 0, false
+	}
+	return hour, minute, true
+}
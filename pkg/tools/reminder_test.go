@@ -0,0 +1,131 @@
+package tools
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/cron"
+)
+
+// TestReminderSchedule verifies wall-clock times and repeats are turned
+// into schedules in the user's zone.
+func TestReminderSchedule(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip("no time zone database")
+	}
+	// Saturday 17 October 2026, 18:30 in Paris
+	now := time.Date(2026, 10, 17, 18, 30, 0, 0, paris)
+
+	tests := []struct {
+		at, repeat string
+		minutes    float64
+		wantKind   string
+		wantFirst  string
+		wantExpr   string
+	}{
+		{at: "17:00", wantKind: "at", wantFirst: "2026-10-18 17:00"},
+		{at: "7pm", wantKind: "at", wantFirst: "2026-10-17 19:00"},
+		{at: "tomorrow 9:15am", wantKind: "at", wantFirst: "2026-10-18 09:15"},
+		{at: "2026-10-20 08:00", wantKind: "at", wantFirst: "2026-10-20 08:00"},
+		{minutes: 45, wantKind: "at", wantFirst: "2026-10-17 19:15"},
+		{at: "08:00", repeat: "daily", wantKind: "cron", wantFirst: "2026-10-18 08:00", wantExpr: "0 8 * * *"},
+		{at: "08:00", repeat: "weekdays", wantKind: "cron", wantFirst: "2026-10-19 08:00", wantExpr: "0 8 * * 1-5"},
+		{at: "2026-10-21 20:00", repeat: "weekly", wantKind: "cron", wantFirst: "2026-10-21 20:00", wantExpr: "0 20 * * 3"},
+		{repeat: "30 7 1 * *", wantKind: "cron", wantFirst: "2026-11-01 07:30", wantExpr: "30 7 1 * *"},
+	}
+	for _, tt := range tests {
+		schedule, first, err := reminderSchedule(tt.at, tt.minutes, tt.repeat, now, paris)
+		if err != nil {
+			t.Errorf("at=%q repeat=%q: unexpected error: %v", tt.at, tt.repeat, err)
+			continue
+		}
+		if schedule.Kind != tt.wantKind || schedule.Expr != tt.wantExpr {
+			t.Errorf("at=%q repeat=%q: Expected %s %q, got %s %q", tt.at, tt.repeat, tt.wantKind, tt.wantExpr, schedule.Kind, schedule.Expr)
+		}
+		if got := first.In(paris).Format("2006-01-02 15:04"); got != tt.wantFirst {
+			t.Errorf("at=%q repeat=%q: Expected first at %s, got %s", tt.at, tt.repeat, tt.wantFirst, got)
+		}
+		if schedule.Kind == "cron" && schedule.TZ != "Europe/Paris" {
+			t.Errorf("Expected the cron schedule in Europe/Paris, got %q", schedule.TZ)
+		}
+	}
+
+	for _, bad := range []struct{ at, repeat string }{
+		{"2026-10-01 08:00", ""},
+		{"25:00", ""},
+		{"noonish", ""},
+		{"08:00", "fortnightly"},
+		{"", ""},
+	} {
+		if _, _, err := reminderSchedule(bad.at, 0, bad.repeat, now, paris); err == nil {
+			t.Errorf("Expected an error for at=%q repeat=%q", bad.at, bad.repeat)
+		}
+	}
+}
+
+// TestReminderTool_SetListCancelDeliver verifies reminders are stored as
+// cron jobs, listed, cancelled, and delivered to the last active chat.
+func TestReminderTool_SetListCancelDeliver(t *testing.T) {
+	cs := cron.NewCronService(filepath.Join(t.TempDir(), "jobs.json"), nil)
+	msgBus := bus.NewMessageBus()
+	defer msgBus.Close()
+	lastChannel, lastChat := "", ""
+	tool := NewReminderTool(cs, msgBus, time.UTC, func() (string, string) { return lastChannel, lastChat })
+	ctx := context.Background()
+
+	result := tool.Execute(ctx, map[string]interface{}{"message": "Take out the trash", "in_minutes": float64(30)})
+	if !result.IsError {
+		t.Fatalf("Expected an error without session context, got %s", result.ForLLM)
+	}
+	tool.SetContext("telegram", "42")
+	result = tool.Execute(ctx, map[string]interface{}{"message": "Take out the trash", "in_minutes": float64(30)})
+	if result.IsError || !strings.Contains(result.ForLLM, "Reminder set") {
+		t.Fatalf("Expected the reminder to be set, got %s", result.ForLLM)
+	}
+	cs.AddJob("not a reminder", cron.CronSchedule{Kind: "cron", Expr: "0 9 * * *"}, "backup", false, "telegram", "42")
+
+	jobs := cs.ListJobs(false)
+	var job *cron.CronJob
+	for i := range jobs {
+		if jobs[i].Payload.Kind == cron.PayloadReminder {
+			job = &jobs[i]
+		}
+	}
+	if job == nil {
+		t.Fatalf("Expected a reminder job, got %+v", jobs)
+	}
+
+	result = tool.Execute(ctx, map[string]interface{}{"action": "list"})
+	if !strings.Contains(result.ForLLM, "Take out the trash [id: "+job.ID+"]") || strings.Contains(result.ForLLM, "backup") {
+		t.Errorf("Expected only the reminder in the list, got:\n%s", result.ForLLM)
+	}
+
+	tool.Deliver(job)
+	lastChannel, lastChat = "slack", "C7"
+	tool.Deliver(job)
+	for _, want := range []string{"telegram/42", "slack/C7"} {
+		msg, ok := msgBus.SubscribeOutbound(ctx)
+		if !ok {
+			t.Fatal("Expected a delivered reminder")
+		}
+		if got := msg.Channel + "/" + msg.ChatID; got != want {
+			t.Errorf("Expected delivery to %s, got %s", want, got)
+		}
+		if msg.Content != "⏰ Reminder: Take out the trash" || msg.Urgency != bus.UrgencyHigh {
+			t.Errorf("Expected a high-urgency reminder, got %q (%s)", msg.Content, msg.Urgency)
+		}
+	}
+
+	result = tool.Execute(ctx, map[string]interface{}{"action": "cancel", "id": job.ID})
+	if result.IsError {
+		t.Fatalf("Expected cancel to succeed, got %s", result.ForLLM)
+	}
+	if result = tool.Execute(ctx, map[string]interface{}{"action": "list"}); result.ForLLM != "No reminders set" {
+		t.Errorf("Expected no reminders after cancel, got %s", result.ForLLM)
+	}
+}
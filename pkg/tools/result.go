@@ -1,6 +1,11 @@
 package tools
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"mime"
+	"path/filepath"
+	"strings"
+)
 
 // ToolResult represents the structured return value from tool execution.
 // It provides clear semantics for different types of results and supports
@@ -27,6 +32,23 @@ type ToolResult struct {
 	// When true, the tool will complete later and notify via callback.
 	Async bool `json:"async"`
 
+	// Preview is a diff or summary of what a file change did (or would do
+	// for a dry run), used to show the user what is about to change.
+	Preview string `json:"preview,omitempty"`
+
+	// Guard is set when a safety guard blocked the call, so the agent can
+	// ask the model for a safer way to do the same thing.
+	Guard *GuardFeedback `json:"guard,omitempty"`
+
+	// Data is the result as machine-readable data, for channels that render
+	// rich results, programs reading picoclaw run --output json, and tools
+	// that consume other tools' output. It must marshal to JSON.
+	Data interface{} `json:"data,omitempty"`
+
+	// Attachments are files the tool produced, such as a chart or an
+	// export. They are sent to the user with ForUser unless Silent.
+	Attachments []Attachment `json:"attachments,omitempty"`
+
 	// Err is the underlying error (not JSON serialized).
 	// Used for internal error handling and logging.
 	Err error `json:"-"`
@@ -99,6 +121,24 @@ func ErrorResult(message string) *ToolResult {
 	}
 }
 
+// DataResult creates a silent ToolResult carrying data, with the data as
+// JSON for the LLM.
+//
+// Example:
+//
+//	result := DataResult(map[string]interface{}{"temp_c": 21.5})
+func DataResult(data interface{}) *ToolResult {
+	result := &ToolResult{Silent: true, Data: data}
+	if encoded, err := json.Marshal(data); err != nil {
+		result.ForLLM = "Result could not be encoded: " + err.Error()
+		result.IsError = true
+		result.Err = err
+	} else {
+		result.ForLLM = string(encoded)
+	}
+	return result
+}
+
 // UserResult creates a ToolResult with content for both LLM and user.
 // Both ForLLM and ForUser are set to the same content.
 //
@@ -141,3 +181,92 @@ func (tr *ToolResult) WithError(err error) *ToolResult {
 	tr.Err = err
 	return tr
 }
+
+// WithPreview sets the Preview field and returns the result for chaining.
+//
+// Example:
+//
+//	result := SilentResult("File edited: notes.md").WithPreview(diff)
+func (tr *ToolResult) WithPreview(preview string) *ToolResult {
+	tr.Preview = preview
+	return tr
+}
+
+// WithGuard sets the Guard field and returns the result for chaining.
+//
+// Example:
+//
+//	result := ErrorResult(block.Error()).WithGuard(block.Feedback(command))
+func (tr *ToolResult) WithGuard(feedback *GuardFeedback) *ToolResult {
+	tr.Guard = feedback
+	return tr
+}
+
+// WithData sets the Data field and returns the result for chaining. Use it
+// when ForLLM is a readable summary of the same data.
+//
+// Example:
+//
+//	result := NewToolResult("21.5°C, light rain").WithData(conditions)
+func (tr *ToolResult) WithData(data interface{}) *ToolResult {
+	tr.Data = data
+	return tr
+}
+
+// WithAttachments adds files to the result and returns it for chaining.
+//
+// Example:
+//
+//	result := UserResult("Chart of last week's sales").WithAttachments(Attachment{Path: png})
+func (tr *ToolResult) WithAttachments(attachments ...Attachment) *ToolResult {
+	tr.Attachments = append(tr.Attachments, attachments...)
+	return tr
+}
+
+// AttachmentPaths returns the files of the result's attachments.
+func (tr *ToolResult) AttachmentPaths() []string {
+	paths := make([]string, 0, len(tr.Attachments))
+	for _, a := range tr.Attachments {
+		paths = append(paths, a.Path)
+	}
+	return paths
+}
+
+// Attachment is a file a tool produced for the user.
+type Attachment struct {
+	// Path is the local file.
+	Path string `json:"path"`
+	// Name is shown to the user; the file's base name if empty.
+	Name string `json:"name,omitempty"`
+	// MediaType is the file's MIME type, e.g. "image/png"; guessed from the
+	// extension if empty.
+	MediaType string `json:"media_type,omitempty"`
+}
+
+// DisplayName is the attachment's name, or its file name.
+func (a Attachment) DisplayName() string {
+	if a.Name != "" {
+		return a.Name
+	}
+	return filepath.Base(a.Path)
+}
+
+// Type is the attachment's MIME type, from MediaType or the extension, or
+// "application/octet-stream" if unknown.
+func (a Attachment) Type() string {
+	if a.MediaType != "" {
+		return a.MediaType
+	}
+	if t := mime.TypeByExtension(strings.ToLower(filepath.Ext(a.Path))); t != "" {
+		if i := strings.Index(t, ";"); i >= 0 {
+			t = t[:i]
+		}
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// IsImage reports whether the attachment is an image.
+func (a Attachment) IsImage() bool {
+	return strings.HasPrefix(a.Type(), "image/")
+}
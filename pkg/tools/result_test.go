@@ -227,3 +227,76 @@ func TestToolResultJSONStructure(t *testing.T) {
 		t.Errorf("Expected silent false, got %v", parsed["silent"])
 	}
 }
+
+func TestDataResult(t *testing.T) {
+	result := DataResult(map[string]interface{}{"temp": 21.5, "city": "Oslo"})
+
+	if !result.Silent || result.IsError {
+		t.Errorf("Expected a silent success, got %+v", result)
+	}
+	if result.ForLLM != `{"city":"Oslo","temp":21.5}` {
+		t.Errorf("Expected the data as JSON for the LLM, got %q", result.ForLLM)
+	}
+
+	result = DataResult(make(chan int))
+	if !result.IsError || result.Err == nil {
+		t.Errorf("Expected an error for data that isn't JSON, got %+v", result)
+	}
+}
+
+func TestToolResultDataAndAttachmentsJSON(t *testing.T) {
+	result := UserResult("Sales chart").
+		WithData(map[string]interface{}{"total": 42}).
+		WithAttachments(Attachment{Path: "/tmp/chart.png"}, Attachment{Path: "/tmp/sales.csv", Name: "Sales"})
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	var decoded ToolResult
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if total, _ := decoded.Data.(map[string]interface{})["total"].(float64); total != 42 {
+		t.Errorf("Expected data to round-trip, got %v", decoded.Data)
+	}
+	if len(decoded.Attachments) != 2 || decoded.Attachments[1].Name != "Sales" {
+		t.Errorf("Expected attachments to round-trip, got %+v", decoded.Attachments)
+	}
+
+	// Plain results keep their JSON shape
+	data, _ = json.Marshal(UserResult("text"))
+	var parsed map[string]interface{}
+	json.Unmarshal(data, &parsed)
+	if _, ok := parsed["data"]; ok {
+		t.Error("Expected no 'data' key for a result without data")
+	}
+	if _, ok := parsed["attachments"]; ok {
+		t.Error("Expected no 'attachments' key for a result without files")
+	}
+}
+
+func TestAttachment(t *testing.T) {
+	tests := []struct {
+		attachment Attachment
+		name       string
+		mediaType  string
+		image      bool
+	}{
+		{Attachment{Path: "/tmp/chart.PNG"}, "chart.PNG", "image/png", true},
+		{Attachment{Path: "/tmp/out.csv", Name: "Report"}, "Report", "text/csv", false},
+		{Attachment{Path: "/tmp/blob", MediaType: "image/webp"}, "blob", "image/webp", true},
+		{Attachment{Path: "/tmp/blob"}, "blob", "application/octet-stream", false},
+	}
+	for _, tt := range tests {
+		if got := tt.attachment.DisplayName(); got != tt.name {
+			t.Errorf("%s: expected name %q, got %q", tt.attachment.Path, tt.name, got)
+		}
+		if got := tt.attachment.Type(); got != tt.mediaType {
+			t.Errorf("%s: expected type %q, got %q", tt.attachment.Path, tt.mediaType, got)
+		}
+		if got := tt.attachment.IsImage(); got != tt.image {
+			t.Errorf("%s: expected IsImage %v, got %v", tt.attachment.Path, tt.image, got)
+		}
+	}
+}
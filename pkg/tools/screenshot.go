@@ -0,0 +1,332 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/png" // registers the PNG decoder for the size check
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	// ScreenshotDir is the workspace folder screenshots are saved in.
+	ScreenshotDir = "screenshots"
+	// screenshotTimeout bounds capturing; describing has its own limit.
+	screenshotTimeout  = 30 * time.Second
+	describeTimeout    = 2 * time.Minute
+	maxScreenshotBytes = 50 << 20
+)
+
+// ErrNoVisionModel is returned by a ScreenDescriber when no model that can
+// view images is configured.
+var ErrNoVisionModel = errors.New("no model that can view images is configured")
+
+// ScreenDescriber describes the image at path, with question, if set, as
+// what to focus on. It returns the description and the model that wrote it.
+type ScreenDescriber func(ctx context.Context, path, question string) (description, model string, err error)
+
+// ScreenshotTool captures the desktop or one window to the workspace with
+// the platform's screenshot command, and has a vision model describe it.
+type ScreenshotTool struct {
+	workspace string
+	describe  ScreenDescriber
+	capturer  *screenCapturer
+}
+
+// NewScreenshotTool creates the tool, saving to screenshots/ in workspace.
+func NewScreenshotTool(workspace string) *ScreenshotTool {
+	return &ScreenshotTool{
+		workspace: workspace,
+		capturer: &screenCapturer{
+			goos:     runtime.GOOS,
+			getenv:   os.Getenv,
+			lookPath: exec.LookPath,
+			run: func(ctx context.Context, name string, args ...string) ([]byte, error) {
+				var stderr bytes.Buffer
+				cmd := exec.CommandContext(ctx, name, args...)
+				cmd.Stderr = &stderr
+				out, err := cmd.Output()
+				if err != nil && stderr.Len() > 0 {
+					err = fmt.Errorf("%s: %v: %s", name, err, strings.TrimSpace(stderr.String()))
+				}
+				return out, err
+			},
+		},
+	}
+}
+
+// SetDescriber sets what describes screenshots; without one they are only
+// saved.
+func (t *ScreenshotTool) SetDescriber(describe ScreenDescriber) {
+	t.describe = describe
+}
+
+func (t *ScreenshotTool) Name() string {
+	return "screenshot"
+}
+
+func (t *ScreenshotTool) Description() string {
+	return "Take a screenshot of the computer's screen, or of one window (the active one, or the first whose title contains window), " +
+		"and save it to the workspace. Unless describe is false, a vision model describes what is on it, so you can answer " +
+		"\"what's on my screen?\"; pass question to have the description focus on something. The image is sent to the user unless send is false."
+}
+
+func (t *ScreenshotTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"target": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"screen", "window"},
+				"description": "The whole screen (default) or one window",
+			},
+			"window": map[string]interface{}{
+				"type":        "string",
+				"description": "Part of the title of the window to capture (for target window; default the active window)",
+			},
+			"describe": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Have a vision model describe the screenshot (default true)",
+			},
+			"question": map[string]interface{}{
+				"type":        "string",
+				"description": "What the description should answer, e.g. \"which error is shown?\"",
+			},
+			"send": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Send the image to the user (default true)",
+			},
+		},
+	}
+}
+
+// ConfirmationSummary describes the capture, for users who approve each one.
+func (t *ScreenshotTool) ConfirmationSummary(args map[string]interface{}) string {
+	if target, _ := args["target"].(string); target != "window" {
+		return "take a screenshot of the screen"
+	}
+	if window, _ := args["window"].(string); window != "" {
+		return fmt.Sprintf("take a screenshot of the window %q", window)
+	}
+	return "take a screenshot of the active window"
+}
+
+func (t *ScreenshotTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	target, _ := args["target"].(string)
+	window, _ := args["window"].(string)
+	switch target {
+	case "", "screen":
+		target = "screen"
+		window = ""
+	case "window":
+	default:
+		return ErrorResult(fmt.Sprintf("unknown target %q: use screen or window", target))
+	}
+
+	rel := filepath.Join(ScreenshotDir, fmt.Sprintf("screenshot-%s.png", time.Now().Format("20060102-150405.000")))
+	path := filepath.Join(t.workspace, rel)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return ErrorResult(err.Error())
+	}
+	captureCtx, cancel := context.WithTimeout(ctx, screenshotTimeout)
+	defer cancel()
+	if err := t.capturer.capture(captureCtx, target == "window", window, path); err != nil {
+		os.Remove(path)
+		return ErrorResult(fmt.Sprintf("screenshot failed: %v", err)).WithError(err)
+	}
+	// The file is whatever was on screen, so keep it private
+	os.Chmod(path, 0600)
+	size, err := screenshotSize(path)
+	if err != nil {
+		os.Remove(path)
+		return ErrorResult(fmt.Sprintf("screenshot failed: %v", err)).WithError(err)
+	}
+
+	what := "the screen"
+	switch {
+	case target == "window" && window != "":
+		what = fmt.Sprintf("the window %q", window)
+	case target == "window":
+		what = "the active window"
+	}
+	text := fmt.Sprintf("Saved a screenshot of %s (%s) to %s", what, size, rel)
+
+	if describe, ok := args["describe"].(bool); (!ok || describe) && t.describe != nil {
+		question, _ := args["question"].(string)
+		describeCtx, cancel := context.WithTimeout(ctx, describeTimeout)
+		description, model, err := t.describe(describeCtx, path, question)
+		cancel()
+		switch {
+		case errors.Is(err, ErrNoVisionModel):
+			text += "\n(Not described: " + err.Error() + "; set agents.defaults.vision_model to describe screenshots.)"
+		case err != nil:
+			text += fmt.Sprintf("\n(The description failed: %v)", err)
+		default:
+			text += fmt.Sprintf("\n\nDescribed by %s:\n%s", model, description)
+		}
+	}
+
+	result := NewToolResult(text)
+	if send, ok := args["send"].(bool); !ok || send {
+		result = result.WithAttachments(Attachment{Path: path, MediaType: "image/png"})
+	}
+	return result
+}
+
+// screenshotSize checks the capture is a PNG and returns its dimensions.
+func screenshotSize(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", errors.New("the screenshot command saved no image")
+	}
+	if info.Size() > maxScreenshotBytes {
+		return "", fmt.Errorf("the screenshot is too large (%d bytes)", info.Size())
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	cfg, format, err := image.DecodeConfig(f)
+	if err != nil || format != "png" {
+		return "", errors.New("the screenshot command did not save a PNG image")
+	}
+	return fmt.Sprintf("%dx%d", cfg.Width, cfg.Height), nil
+}
+
+// screenCapturer runs whichever screenshot command the platform has.
+// Its fields are replaced in tests.
+type screenCapturer struct {
+	goos     string
+	getenv   func(string) string
+	lookPath func(string) (string, error)
+	run      func(ctx context.Context, name string, args ...string) ([]byte, error)
+}
+
+func (c *screenCapturer) has(name string) bool {
+	_, err := c.lookPath(name)
+	return err == nil
+}
+
+// capture saves a PNG of the screen, or of a window (by title, or the
+// active one when title is empty), to out.
+func (c *screenCapturer) capture(ctx context.Context, window bool, title, out string) error {
+	switch c.goos {
+	case "darwin":
+		if window {
+			return errors.New("capturing a single window is not supported on macOS; capture the screen")
+		}
+		_, err := c.run(ctx, "screencapture", "-x", "-t", "png", out)
+		return err
+	case "windows":
+		if window {
+			return errors.New("capturing a single window is not supported on Windows; capture the screen")
+		}
+		_, err := c.run(ctx, "powershell", "-NoProfile", "-NonInteractive", "-Command", windowsCaptureScript(out))
+		return err
+	}
+
+	if c.getenv("WAYLAND_DISPLAY") != "" {
+		if window {
+			return errors.New("capturing a single window is not supported on Wayland; capture the screen")
+		}
+		switch {
+		case c.has("grim"):
+			_, err := c.run(ctx, "grim", "-t", "png", out)
+			return err
+		case c.has("gnome-screenshot"):
+			_, err := c.run(ctx, "gnome-screenshot", "-f", out)
+			return err
+		}
+		return errors.New("no screenshot command found; install grim")
+	}
+	if c.getenv("DISPLAY") == "" {
+		return errors.New("there is no display to capture (neither DISPLAY nor WAYLAND_DISPLAY is set)")
+	}
+
+	if !window {
+		switch {
+		case c.has("import"):
+			_, err := c.run(ctx, "import", "-window", "root", out)
+			return err
+		case c.has("scrot"):
+			_, err := c.run(ctx, "scrot", "--overwrite", out)
+			return err
+		case c.has("maim"):
+			_, err := c.run(ctx, "maim", "--format", "png", out)
+			return err
+		case c.has("gnome-screenshot"):
+			_, err := c.run(ctx, "gnome-screenshot", "-f", out)
+			return err
+		}
+		return errors.New("no screenshot command found; install ImageMagick, scrot or maim")
+	}
+
+	// A window by title needs its ID from xdotool; the active one can do
+	// without when scrot or gnome-screenshot is there
+	if title == "" && !c.has("xdotool") {
+		switch {
+		case c.has("scrot"):
+			_, err := c.run(ctx, "scrot", "--focused", "--overwrite", out)
+			return err
+		case c.has("gnome-screenshot"):
+			_, err := c.run(ctx, "gnome-screenshot", "-w", "-f", out)
+			return err
+		}
+	}
+	if !c.has("xdotool") {
+		return errors.New("capturing a window needs xdotool")
+	}
+	id, err := c.windowID(ctx, title)
+	if err != nil {
+		return err
+	}
+	switch {
+	case c.has("import"):
+		_, err = c.run(ctx, "import", "-window", id, out)
+	case c.has("maim"):
+		_, err = c.run(ctx, "maim", "--format", "png", "--window", id, out)
+	default:
+		err = errors.New("capturing a window needs ImageMagick or maim")
+	}
+	return err
+}
+
+// windowID finds the X11 window with title in its name, or the active one.
+func (c *screenCapturer) windowID(ctx context.Context, title string) (string, error) {
+	args := []string{"getactivewindow"}
+	if title != "" {
+		args = []string{"search", "--onlyvisible", "--name", regexp.QuoteMeta(title)}
+	}
+	out, err := c.run(ctx, "xdotool", args...)
+	id := strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+	if title != "" && id == "" {
+		// xdotool search fails when nothing matches
+		return "", fmt.Errorf("no window titled %q is open", title)
+	}
+	if err != nil {
+		return "", err
+	}
+	if id == "" {
+		return "", errors.New("there is no active window")
+	}
+	return id, nil
+}
+
+// windowsCaptureScript is PowerShell that saves the primary screen as PNG.
+func windowsCaptureScript(out string) string {
+	return "Add-Type -AssemblyName System.Windows.Forms,System.Drawing; " +
+		"$b = [System.Windows.Forms.Screen]::PrimaryScreen.Bounds; " +
+		"$bmp = New-Object System.Drawing.Bitmap $b.Width, $b.Height; " +
+		"$g = [System.Drawing.Graphics]::FromImage($bmp); " +
+		"$g.CopyFromScreen($b.Location, [System.Drawing.Point]::Empty, $b.Size); " +
+		"$bmp.Save('" + strings.ReplaceAll(out, "'", "''") + "', [System.Drawing.Imaging.ImageFormat]::Png)"
+}
@@ -0,0 +1,125 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeCapturer stands in for a desktop: only the commands in installed
+// exist, each call is recorded, and screenshot commands save a PNG to
+// their last argument.
+func fakeCapturer(goos string, env map[string]string, installed ...string) (*screenCapturer, *[]string) {
+	var calls []string
+	c := &screenCapturer{
+		goos:   goos,
+		getenv: func(key string) string { return env[key] },
+		lookPath: func(name string) (string, error) {
+			for _, have := range installed {
+				if have == name {
+					return "/usr/bin/" + name, nil
+				}
+			}
+			return "", exec.ErrNotFound
+		},
+		run: func(ctx context.Context, name string, args ...string) ([]byte, error) {
+			calls = append(calls, strings.Join(append([]string{name}, args...), " "))
+			if name == "xdotool" {
+				if args[0] == "search" && args[len(args)-1] != "Firefox" {
+					return nil, errors.New("exit status 1")
+				}
+				return []byte("4194307\n"), nil
+			}
+			f, err := os.Create(args[len(args)-1])
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			return nil, png.Encode(f, image.NewGray(image.Rect(0, 0, 32, 20)))
+		},
+	}
+	return c, &calls
+}
+
+// TestScreenshotCommands verifies the command picked for each desktop
+func TestScreenshotCommands(t *testing.T) {
+	x11 := map[string]string{"DISPLAY": ":0"}
+	cases := []struct {
+		name      string
+		goos      string
+		env       map[string]string
+		installed []string
+		window    bool
+		title     string
+		want      string // calls, or the error
+	}{
+		{"x11 screen", "linux", x11, []string{"scrot", "import"}, false, "", "import -window root OUT"},
+		{"x11 scrot", "linux", x11, []string{"scrot"}, false, "", "scrot --overwrite OUT"},
+		{"x11 active window", "linux", x11, []string{"xdotool", "import"}, true, "", "xdotool getactivewindow; import -window 4194307 OUT"},
+		{"x11 active window without xdotool", "linux", x11, []string{"scrot"}, true, "", "scrot --focused --overwrite OUT"},
+		{"x11 window by title", "linux", x11, []string{"xdotool", "maim"}, true, "Firefox", "xdotool search --onlyvisible --name Firefox; maim --format png --window 4194307 OUT"},
+		{"x11 missing window", "linux", x11, []string{"xdotool", "import"}, true, "Nope", "error: no window titled \"Nope\" is open"},
+		{"x11 nothing installed", "linux", x11, nil, false, "", "error: no screenshot command found; install ImageMagick, scrot or maim"},
+		{"wayland", "linux", map[string]string{"WAYLAND_DISPLAY": "wayland-0", "DISPLAY": ":0"}, []string{"grim", "import"}, false, "", "grim -t png OUT"},
+		{"headless", "linux", nil, []string{"import"}, false, "", "error: there is no display to capture (neither DISPLAY nor WAYLAND_DISPLAY is set)"},
+		{"macos", "darwin", nil, nil, false, "", "screencapture -x -t png OUT"},
+	}
+	out := filepath.Join(t.TempDir(), "OUT")
+	for _, c := range cases {
+		capturer, calls := fakeCapturer(c.goos, c.env, c.installed...)
+		err := capturer.capture(context.Background(), c.window, c.title, out)
+		got := strings.ReplaceAll(strings.Join(*calls, "; "), out, "OUT")
+		if err != nil {
+			got = "error: " + err.Error()
+		}
+		if got != c.want {
+			t.Errorf("%s: expected %q, got %q", c.name, c.want, got)
+		}
+	}
+}
+
+// TestScreenshotTool verifies a capture is saved, described and sent, and
+// that a missing vision model is explained
+func TestScreenshotTool(t *testing.T) {
+	workspace := t.TempDir()
+	tool := NewScreenshotTool(workspace)
+	tool.capturer, _ = fakeCapturer("linux", map[string]string{"DISPLAY": ":0"}, "import")
+	var asked string
+	tool.SetDescriber(func(ctx context.Context, path, question string) (string, string, error) {
+		asked = question
+		return "A terminal showing a failed build.", "test-vision", nil
+	})
+	ctx := context.Background()
+
+	result := tool.Execute(ctx, map[string]interface{}{"question": "what failed?"})
+	if result.IsError || !strings.HasPrefix(result.ForLLM, "Saved a screenshot of the screen (32x20) to screenshots/screenshot-") ||
+		!strings.HasSuffix(result.ForLLM, "Described by test-vision:\nA terminal showing a failed build.") {
+		t.Fatalf("Unexpected result %q", result.ForLLM)
+	}
+	if asked != "what failed?" {
+		t.Errorf("Expected the question passed on, got %q", asked)
+	}
+	if len(result.Attachments) != 1 || !strings.HasPrefix(result.Attachments[0].Path, workspace) {
+		t.Errorf("Expected the screenshot attached, got %+v", result.Attachments)
+	}
+	if info, err := os.Stat(result.Attachments[0].Path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected a private file, got %v %v", info, err)
+	}
+
+	tool.SetDescriber(func(ctx context.Context, path, question string) (string, string, error) {
+		return "", "", ErrNoVisionModel
+	})
+	result = tool.Execute(ctx, map[string]interface{}{"send": false})
+	if len(result.Attachments) != 0 || !strings.Contains(result.ForLLM, "set agents.defaults.vision_model") {
+		t.Errorf("Expected no attachment and a note about the vision model, got %q", result.ForLLM)
+	}
+	if result := tool.Execute(ctx, map[string]interface{}{"target": "monitor"}); !result.IsError {
+		t.Errorf("Expected an unknown target refused, got %q", result.ForLLM)
+	}
+}
@@ -0,0 +1,404 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	defaultSearchResults = 50
+	maxSearchResults     = 500
+	maxSearchContext     = 10
+	// maxSearchFileSize skips files too large to be useful to grep.
+	maxSearchFileSize = 5 << 20
+	// maxSearchLineLength cuts long lines (minified files) in the output.
+	maxSearchLineLength = 300
+)
+
+// SearchTool searches the workspace by file name (glob) and/or content
+// (regex), honoring .gitignore files, so the model does not need to build
+// find | xargs grep pipelines.
+type SearchTool struct {
+	pathScope
+}
+
+func NewSearchTool(workspace string, restrict bool) *SearchTool {
+	return &SearchTool{pathScope: pathScope{workspace: workspace, restrict: restrict}}
+}
+
+func (t *SearchTool) Name() string {
+	return "search"
+}
+
+// ConcurrencySafe reports true: the search only reads files.
+func (t *SearchTool) ConcurrencySafe() bool {
+	return true
+}
+
+func (t *SearchTool) Description() string {
+	return "Search files recursively. Use `glob` to match file names (e.g. \"**/*.go\", \"*.md\") and/or `pattern` to grep file contents with a regular expression. Skips .git, binary files and anything listed in .gitignore."
+}
+
+func (t *SearchTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"pattern": map[string]interface{}{
+				"type":        "string",
+				"description": "Regular expression to search for in file contents (RE2 syntax)",
+			},
+			"glob": map[string]interface{}{
+				"type":        "string",
+				"description": "Only consider files whose path matches this glob; without a slash it matches the file name",
+			},
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "Directory to search in (default: workspace root)",
+			},
+			"context": map[string]interface{}{
+				"type":        "integer",
+				"description": fmt.Sprintf("Lines of context to show around each match (0-%d)", maxSearchContext),
+			},
+			"ignore_case": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Match the pattern case-insensitively",
+			},
+			"max_results": map[string]interface{}{
+				"type":        "integer",
+				"description": fmt.Sprintf("Maximum matches (or files) to return (default %d)", defaultSearchResults),
+			},
+		},
+	}
+}
+
+func (t *SearchTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	pattern, _ := args["pattern"].(string)
+	glob, _ := args["glob"].(string)
+	if pattern == "" && glob == "" {
+		return ErrorResult("at least one of pattern or glob is required")
+	}
+
+	dir, _ := args["path"].(string)
+	if dir == "" {
+		dir = "."
+	}
+	root, err := t.resolvePath(dir)
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		return ErrorResult(fmt.Sprintf("not a directory: %s", dir))
+	}
+
+	var re *regexp.Regexp
+	if pattern != "" {
+		if ignoreCase, _ := args["ignore_case"].(bool); ignoreCase {
+			pattern = "(?i)" + pattern
+		}
+		re, err = regexp.Compile(pattern)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("invalid pattern: %v", err))
+		}
+	}
+
+	contextLines := 0
+	if v, ok := args["context"].(float64); ok && v > 0 {
+		contextLines = min(int(v), maxSearchContext)
+	}
+	maxResults := defaultSearchResults
+	if v, ok := args["max_results"].(float64); ok && v > 0 {
+		maxResults = min(int(v), maxSearchResults)
+	}
+
+	s := &searcher{
+		root:         root,
+		glob:         filepath.ToSlash(glob),
+		re:           re,
+		contextLines: contextLines,
+		maxResults:   maxResults,
+	}
+	if err := s.walk(ctx); err != nil {
+		return ErrorResult(fmt.Sprintf("search failed: %v", err))
+	}
+
+	return NewToolResult(s.result())
+}
+
+// searcher holds the state of one search.
+type searcher struct {
+	root         string
+	glob         string
+	re           *regexp.Regexp
+	contextLines int
+	maxResults   int
+
+	out       strings.Builder
+	results   int
+	files     int
+	truncated bool
+}
+
+func (s *searcher) walk(ctx context.Context) error {
+	ignores := []*gitignore{loadGitignore(s.root, "")}
+
+	return filepath.WalkDir(s.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Unreadable entries are skipped rather than failing the search
+			if d != nil && d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if s.truncated {
+			return fs.SkipAll
+		}
+
+		rel, _ := filepath.Rel(s.root, p)
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			return nil
+		}
+
+		// Drop ignore files that belong to directories we have left
+		for len(ignores) > 1 && !strings.HasPrefix(rel, ignores[len(ignores)-1].base) {
+			ignores = ignores[:len(ignores)-1]
+		}
+
+		if d.IsDir() {
+			if d.Name() == ".git" || isIgnored(ignores, rel, true) {
+				return fs.SkipDir
+			}
+			if gi := loadGitignore(p, rel+"/"); gi != nil {
+				ignores = append(ignores, gi)
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || isIgnored(ignores, rel, false) {
+			return nil
+		}
+		if s.glob != "" && !matchGlob(s.glob, rel) {
+			return nil
+		}
+
+		if s.re == nil {
+			s.addFile(rel)
+			return nil
+		}
+		return s.grepFile(p, rel)
+	})
+}
+
+func (s *searcher) addFile(rel string) {
+	if s.results >= s.maxResults {
+		s.truncated = true
+		return
+	}
+	s.results++
+	s.out.WriteString(rel)
+	s.out.WriteByte('\n')
+}
+
+// grepFile writes matches from one file in grep format: "path:line: text"
+// for matches and "path-line- text" for context, with "--" between groups.
+func (s *searcher) grepFile(p, rel string) error {
+	info, err := os.Stat(p)
+	if err != nil || info.Size() > maxSearchFileSize {
+		return nil
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	br := bufio.NewReaderSize(f, sniffLen)
+	if head, _ := br.Peek(sniffLen); detectEncoding(head) == encodingBinary {
+		return nil
+	}
+
+	scanner := bufio.NewScanner(br)
+	scanner.Buffer(make([]byte, 64*1024), maxSearchFileSize)
+
+	var before []string // ring of preceding lines for context
+	after := 0          // context lines still to print after a match
+	lastPrinted := 0
+	matched := false
+
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := scanner.Text()
+		if s.re.MatchString(line) {
+			if s.results >= s.maxResults {
+				s.truncated = true
+				break
+			}
+			s.results++
+			if !matched {
+				s.files++
+			}
+			// Separate non-adjacent context groups, as grep -C does
+			start := lineNo - len(before)
+			if s.contextLines > 0 && s.out.Len() > 0 && (!matched || start > lastPrinted+1) {
+				s.out.WriteString("--\n")
+			}
+			matched = true
+			for i, ctxLine := range before {
+				s.writeLine(rel, lineNo-len(before)+i, '-', ctxLine)
+			}
+			before = before[:0]
+			s.writeLine(rel, lineNo, ':', line)
+			lastPrinted = lineNo
+			after = s.contextLines
+			continue
+		}
+
+		if after > 0 {
+			s.writeLine(rel, lineNo, '-', line)
+			lastPrinted = lineNo
+			after--
+			continue
+		}
+		if s.contextLines > 0 {
+			before = append(before, line)
+			if len(before) > s.contextLines {
+				before = before[1:]
+			}
+		}
+	}
+	return nil
+}
+
+func (s *searcher) writeLine(rel string, lineNo int, sep byte, text string) {
+	if len(text) > maxSearchLineLength {
+		text = text[:maxSearchLineLength] + " …"
+	}
+	fmt.Fprintf(&s.out, "%s%c%d%c %s\n", rel, sep, lineNo, sep, text)
+}
+
+func (s *searcher) result() string {
+	if s.results == 0 {
+		return "No matches found."
+	}
+	var summary string
+	if s.re != nil {
+		summary = fmt.Sprintf("%d matches in %d files", s.results, s.files)
+	} else {
+		summary = fmt.Sprintf("%d files", s.results)
+	}
+	if s.truncated {
+		summary += fmt.Sprintf(" (stopped at max_results=%d; narrow the search for more)", s.maxResults)
+	}
+	return strings.TrimRight(s.out.String(), "\n") + "\n\n[" + summary + "]"
+}
+
+// gitignore holds the rules of one .gitignore file.
+type gitignore struct {
+	base  string // directory of the file relative to the search root, with trailing slash ("" for root)
+	rules []ignoreRule
+}
+
+type ignoreRule struct {
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool // contains a slash, so it matches from base rather than any level
+}
+
+// loadGitignore reads dir/.gitignore. It returns nil if there is none.
+func loadGitignore(dir, base string) *gitignore {
+	data, err := os.ReadFile(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		return nil
+	}
+	gi := &gitignore{base: base}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, " \r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignoreRule{}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		rule.pattern = line
+		gi.rules = append(gi.rules, rule)
+	}
+	return gi
+}
+
+// isIgnored applies the stacked .gitignore files to rel; later rules and
+// deeper files take precedence, as in git.
+func isIgnored(stack []*gitignore, rel string, isDir bool) bool {
+	ignored := false
+	for _, gi := range stack {
+		if gi == nil || !strings.HasPrefix(rel, gi.base) {
+			continue
+		}
+		local := strings.TrimPrefix(rel, gi.base)
+		for _, rule := range gi.rules {
+			if rule.dirOnly && !isDir {
+				continue
+			}
+			var match bool
+			if rule.anchored {
+				match = matchGlob(rule.pattern, local)
+			} else {
+				match = matchGlob(rule.pattern, path.Base(local))
+			}
+			if match {
+				ignored = !rule.negate
+			}
+		}
+	}
+	return ignored
+}
+
+// matchGlob matches a slash-separated path against a glob that may contain
+// "**" for any number of directories. A glob without a slash matches the
+// last path element only.
+func matchGlob(glob, rel string) bool {
+	if !strings.Contains(glob, "/") {
+		ok, _ := path.Match(glob, path.Base(rel))
+		return ok
+	}
+	return matchSegments(strings.Split(glob, "/"), strings.Split(rel, "/"))
+}
+
+func matchSegments(glob, parts []string) bool {
+	for len(glob) > 0 {
+		if glob[0] == "**" {
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(glob[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(glob[0], parts[0]); !ok {
+			return false
+		}
+		glob, parts = glob[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
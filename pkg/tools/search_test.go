@@ -0,0 +1,152 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeSearchTree(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		".gitignore":          "build/\n*.log\n!keep.log\n",
+		"main.go":             "package main\n\nfunc main() {\n\thello()\n}\n",
+		"pkg/util/hello.go":   "package util\n\n// Hello says hi\nfunc Hello() {}\n",
+		"pkg/util/README.md":  "hello docs\n",
+		"build/out.go":        "func hello() {}\n",
+		"debug.log":           "hello from log\n",
+		"keep.log":            "hello kept\n",
+		"pkg/.gitignore":      "generated.go\n",
+		"pkg/generated.go":    "hello generated\n",
+		"bin/tool":            "hello\x00\x01\x02",
+		".git/config":         "hello git\n",
+		"docs/guide/intro.md": "intro\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(p), 0755)
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// TestSearchTool_Content verifies regex search honors .gitignore and skips binaries
+func TestSearchTool_Content(t *testing.T) {
+	dir := writeSearchTree(t)
+	tool := NewSearchTool(dir, true)
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"pattern":     "hello",
+		"ignore_case": true,
+	})
+	if result.IsError {
+		t.Fatalf("Expected success, got error: %s", result.ForLLM)
+	}
+
+	for _, want := range []string{"main.go:4:", "pkg/util/hello.go:3:", "pkg/util/README.md:1:", "keep.log:1:"} {
+		if !strings.Contains(result.ForLLM, want) {
+			t.Errorf("Expected %q in output, got:\n%s", want, result.ForLLM)
+		}
+	}
+	for _, unwanted := range []string{"build/out.go", "debug.log", "generated.go", "bin/tool", ".git/config"} {
+		if strings.Contains(result.ForLLM, unwanted) {
+			t.Errorf("Expected %q to be skipped, got:\n%s", unwanted, result.ForLLM)
+		}
+	}
+}
+
+// TestSearchTool_Glob verifies file name matching with and without **
+func TestSearchTool_Glob(t *testing.T) {
+	dir := writeSearchTree(t)
+	tool := NewSearchTool(dir, true)
+
+	result := tool.Execute(context.Background(), map[string]interface{}{"glob": "**/*.md"})
+	if !strings.Contains(result.ForLLM, "pkg/util/README.md") || !strings.Contains(result.ForLLM, "docs/guide/intro.md") {
+		t.Errorf("Expected markdown files, got:\n%s", result.ForLLM)
+	}
+
+	result = tool.Execute(context.Background(), map[string]interface{}{"glob": "*.go", "pattern": "func"})
+	if !strings.Contains(result.ForLLM, "main.go:3:") || strings.Contains(result.ForLLM, "README.md") {
+		t.Errorf("Expected only Go files, got:\n%s", result.ForLLM)
+	}
+}
+
+// TestSearchTool_Context verifies context lines and group separators
+func TestSearchTool_Context(t *testing.T) {
+	dir := t.TempDir()
+	lines := []string{"a", "match1", "b", "c", "d", "e", "match2", "f"}
+	os.WriteFile(filepath.Join(dir, "f.txt"), []byte(strings.Join(lines, "\n")+"\n"), 0644)
+
+	tool := NewSearchTool(dir, true)
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"pattern": "match",
+		"context": float64(1),
+	})
+
+	want := "f.txt-1- a\nf.txt:2: match1\nf.txt-3- b\n--\nf.txt-6- e\nf.txt:7: match2\nf.txt-8- f\n"
+	if !strings.HasPrefix(result.ForLLM, want) {
+		t.Errorf("Expected output to start with:\n%s\ngot:\n%s", want, result.ForLLM)
+	}
+}
+
+// TestSearchTool_MaxResults verifies the result cap
+func TestSearchTool_MaxResults(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "f.txt"), []byte(strings.Repeat("x\n", 20)), 0644)
+
+	tool := NewSearchTool(dir, true)
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"pattern":     "x",
+		"max_results": float64(5),
+	})
+
+	if got := strings.Count(result.ForLLM, "f.txt:"); got != 5 {
+		t.Errorf("Expected 5 matches, got %d:\n%s", got, result.ForLLM)
+	}
+	if !strings.Contains(result.ForLLM, "max_results=5") {
+		t.Errorf("Expected truncation note, got:\n%s", result.ForLLM)
+	}
+}
+
+// TestSearchTool_Errors verifies argument and path validation
+func TestSearchTool_Errors(t *testing.T) {
+	dir := t.TempDir()
+	tool := NewSearchTool(dir, true)
+
+	cases := []map[string]interface{}{
+		{},
+		{"pattern": "("},
+		{"pattern": "x", "path": "../"},
+	}
+	for _, args := range cases {
+		if result := tool.Execute(context.Background(), args); !result.IsError {
+			t.Errorf("Expected error for %v, got: %s", args, result.ForLLM)
+		}
+	}
+}
+
+// TestMatchGlob verifies ** handling
+func TestMatchGlob(t *testing.T) {
+	cases := []struct {
+		glob, path string
+		want       bool
+	}{
+		{"*.go", "a/b/c.go", true},
+		{"**/*.go", "c.go", true},
+		{"**/*.go", "a/b/c.go", true},
+		{"a/**/c.go", "a/c.go", true},
+		{"a/**/c.go", "a/x/y/c.go", true},
+		{"a/*.go", "a/b/c.go", false},
+		{"src/**", "src/x/y", true},
+	}
+	for _, c := range cases {
+		if got := matchGlob(c.glob, c.path); got != c.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", c.glob, c.path, got, c.want)
+		}
+	}
+}
@@ -4,53 +4,94 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
-	"path/filepath"
 	"regexp"
-	"runtime"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/sipeed/picoclaw/pkg/utils"
 )
 
 type ExecTool struct {
 	workingDir          string
 	timeout             time.Duration
-	denyPatterns        []*regexp.Regexp
+	guardMu             sync.RWMutex // guards denyRules, allowPatterns and allowOverride, which a config reload may change
+	denyRules           []guardRule
 	allowPatterns       []*regexp.Regexp
 	restrictToWorkspace bool
+	maxOutput           int
+	maxTimeoutLimit     time.Duration // hard cap on timeout_seconds
+	maxOutputLimit      int           // hard cap on max_output_bytes
+	backend             ExecBackend
+	processes           *ProcessManager
+	streamInterval      time.Duration
+	envPolicy           *EnvPolicy
+	secrets             *SecretVault
+	audit               *AuditLog
+	guardApprover       Approver // asks the user about confirm rules and overrides
+	allowOverride       bool
+	channel             string
+	chatID              string
+	sharedFolders       []string
 }
 
 func NewExecTool(workingDir string, restrict bool) *ExecTool {
-	denyPatterns := []*regexp.Regexp{
-		// rm -rf variants (case insensitive, handles --recursive --force)
-		regexp.MustCompile(`(?i)\brm\s+(-[rf]{1,2}|--recursive|--force)`),
-		// Windows delete commands
-		regexp.MustCompile(`(?i)\bdel\s+/[fq]`),
-		regexp.MustCompile(`(?i)\brmdir\s+/s`),
-		// Disk wiping commands (case insensitive)
-		regexp.MustCompile(`(?i)\b(format|mkfs|diskpart)\b\s`),
-		regexp.MustCompile(`(?i)\bdd\s+if=`),
-		// Block writes to disk devices (sd*, nvme*, vd*)
-		regexp.MustCompile(`(?i)>\s*/dev/(sd[a-z]|nvme\d+n\d+|vd[a-z])\b`),
-		// System control commands
-		regexp.MustCompile(`(?i)\b(shutdown|reboot|poweroff)\b`),
-		// Fork bomb
-		regexp.MustCompile(`:\(\)\s*\{.*\};\s*:`),
-		// Pipe to shell execution (curl/wget | sh, bash, etc.)
-		regexp.MustCompile(`(?i)\b(curl|wget)\b.*\|\s*(sh|bash|zsh|dash|ksh|csh|tcsh|fish)`),
-		// eval with command substitution or variables
-		regexp.MustCompile(`(?i)\beval\s+`),
-		// xargs rm (dangerous recursive delete)
-		regexp.MustCompile(`(?i)\bxargs\s+.*\brm\b`),
-	}
-
 	return &ExecTool{
 		workingDir:          workingDir,
 		timeout:             60 * time.Second,
-		denyPatterns:        denyPatterns,
+		denyRules:           defaultGuardRules,
 		allowPatterns:       nil,
 		restrictToWorkspace: restrict,
+		maxOutput:           10000,
+		backend:             HostBackend{},
+	}
+}
+
+// SetProcessManager enables the background option, which starts commands
+// without waiting for them and tracks them in manager.
+func (t *ExecTool) SetProcessManager(manager *ProcessManager) {
+	t.processes = manager
+}
+
+// SetStreamInterval makes commands that run longer than interval report
+// their new output through the context's ProgressFunc every interval.
+// Zero disables streaming.
+func (t *ExecTool) SetStreamInterval(interval time.Duration) {
+	t.streamInterval = interval
+}
+
+// SetEnvPolicy limits the environment variables commands inherit. Without
+// a policy they inherit picoclaw's whole environment.
+func (t *ExecTool) SetEnvPolicy(policy *EnvPolicy) {
+	t.envPolicy = policy
+}
+
+// SetSecretVault lets calls inject secrets from vault by name with the
+// secrets argument.
+func (t *ExecTool) SetSecretVault(vault *SecretVault) {
+	t.secrets = vault
+}
+
+// SetBackend changes where commands run, e.g. a ContainerBackend.
+func (t *ExecTool) SetBackend(backend ExecBackend) {
+	if backend != nil {
+		t.backend = backend
+	}
+}
+
+// SetLimits sets the hard maxima for the timeout_seconds and
+// max_output_bytes arguments. Zero keeps the defaults as the maxima.
+func (t *ExecTool) SetLimits(maxTimeout time.Duration, maxOutput int) {
+	t.maxTimeoutLimit = maxTimeout
+	t.maxOutputLimit = maxOutput
+}
+
+// SetMaxOutput caps how many bytes of stdout and stderr are kept in memory.
+func (t *ExecTool) SetMaxOutput(n int) {
+	if n > 0 {
+		t.maxOutput = n
 	}
 }
 
@@ -59,11 +100,28 @@ func (t *ExecTool) Name() string {
 }
 
 func (t *ExecTool) Description() string {
-	return "Execute a shell command and return its output. Use with caution."
+	desc := "Execute a shell command and return its output. Use with caution."
+	if note := t.backend.Describe(); note != "" {
+		desc += " " + note
+	}
+	return desc
+}
+
+// ConfirmationSummary shows the exact command line when approval is
+// required, and which secrets it would receive.
+func (t *ExecTool) ConfirmationSummary(args map[string]interface{}) string {
+	summary, _ := args["command"].(string)
+	if dir, ok := args["working_dir"].(string); ok && dir != "" {
+		summary += fmt.Sprintf("\n(in %s)", dir)
+	}
+	if names := secretNames(args); len(names) > 0 {
+		summary += fmt.Sprintf("\n(with secrets: %s)", strings.Join(names, ", "))
+	}
+	return summary
 }
 
 func (t *ExecTool) Parameters() map[string]interface{} {
-	return map[string]interface{}{
+	params := map[string]interface{}{
 		"type": "object",
 		"properties": map[string]interface{}{
 			"command": map[string]interface{}{
@@ -74,9 +132,48 @@ func (t *ExecTool) Parameters() map[string]interface{} {
 				"type":        "string",
 				"description": "Optional working directory for the command",
 			},
+			"timeout_seconds": map[string]interface{}{
+				"type":        "integer",
+				"description": fmt.Sprintf("Optional timeout for slow commands such as builds (default %d, max %d)", int(t.timeout.Seconds()), int(t.timeoutLimit().Seconds())),
+			},
+			"max_output_bytes": map[string]interface{}{
+				"type":        "integer",
+				"description": fmt.Sprintf("Optional output size to keep, for verbose commands such as test suites (default %d, max %d)", t.maxOutput, t.outputLimit()),
+			},
 		},
 		"required": []string{"command"},
 	}
+	if t.secrets != nil {
+		desc := "Names of secrets to set as environment variables for this command only. Their values are never shown to you."
+		if names := t.secrets.Names(); len(names) > 0 {
+			desc += " Available: " + strings.Join(names, ", ")
+		} else {
+			desc += " None are stored yet."
+		}
+		params["properties"].(map[string]interface{})["secrets"] = map[string]interface{}{
+			"type":        "array",
+			"items":       map[string]interface{}{"type": "string"},
+			"description": desc,
+		}
+	}
+	if t.overridesEnabled() {
+		props := params["properties"].(map[string]interface{})
+		props["override_guard"] = map[string]interface{}{
+			"type":        "boolean",
+			"description": "Ask the user to run a command the safety guard blocked. Only use this after a block, when the user really needs that command.",
+		}
+		props["override_reason"] = map[string]interface{}{
+			"type":        "string",
+			"description": "Why the blocked command is needed, shown to the user with override_guard",
+		}
+	}
+	if t.processes != nil {
+		params["properties"].(map[string]interface{})["background"] = map[string]interface{}{
+			"type":        "boolean",
+			"description": "Start the command without waiting for it (e.g. a dev server) and return a process ID for read_output and kill_process",
+		}
+	}
+	return params
 }
 
 func (t *ExecTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
@@ -97,28 +194,68 @@ func (t *ExecTool) Execute(ctx context.Context, args map[string]interface{}) *To
 		}
 	}
 
-	if guardError := t.guardCommand(command, cwd); guardError != "" {
-		return ErrorResult(guardError)
+	if blocked := t.checkGuard(ctx, command, cwd, args); blocked != nil {
+		return blocked
 	}
 
-	cmdCtx, cancel := context.WithTimeout(ctx, t.timeout)
-	defer cancel()
+	var secrets map[string]string
+	if names := secretNames(args); len(names) > 0 {
+		if t.secrets == nil {
+			return ErrorResult("no secret vault is configured")
+		}
+		var err error
+		if secrets, err = t.secrets.Lookup(names); err != nil {
+			return ErrorResult(err.Error())
+		}
+	}
+	env := t.commandEnv(secrets)
 
-	var cmd *exec.Cmd
-	if runtime.GOOS == "windows" {
-		cmd = exec.CommandContext(cmdCtx, "powershell", "-NoProfile", "-NonInteractive", "-Command", command)
-	} else {
-		cmd = exec.CommandContext(cmdCtx, "sh", "-c", command)
+	if background, _ := args["background"].(bool); background && t.processes != nil {
+		if len(secrets) > 0 {
+			// read_output could not redact them
+			return ErrorResult("secrets cannot be passed to background commands")
+		}
+		return t.startBackground(command, cwd, env)
 	}
-	if cwd != "" {
-		cmd.Dir = cwd
+
+	timeout := t.timeout
+	if secs, ok := args["timeout_seconds"].(float64); ok && secs > 0 {
+		timeout = min(time.Duration(secs)*time.Second, t.timeoutLimit())
 	}
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	cmdCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
 
-	err := cmd.Run()
+	cmd, cleanup, err := t.backend.Command(cmdCtx, command, cwd, env)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+
+	maxLen := t.maxOutput
+	if n, ok := args["max_output_bytes"].(float64); ok && n > 0 {
+		maxLen = min(int(n), t.outputLimit())
+	}
+	stdout := &boundedBuffer{max: maxLen}
+	stderr := &boundedBuffer{max: maxLen}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	var stopStream chan struct{}
+	if progress := ProgressFromContext(ctx); progress != nil && t.streamInterval > 0 {
+		live := &tailBuffer{max: streamSnippetSize}
+		cmd.Stdout = io.MultiWriter(stdout, live)
+		cmd.Stderr = io.MultiWriter(stderr, live)
+		stopStream = make(chan struct{})
+		go t.streamOutput(command, live, secrets, progress, stopStream)
+	}
+
+	err = cmd.Run()
+	if stopStream != nil {
+		close(stopStream)
+	}
+	if cmdCtx.Err() != nil {
+		cleanup()
+	}
 	output := stdout.String()
 	if stderr.Len() > 0 {
 		output += "\nSTDERR:\n" + stderr.String()
@@ -126,7 +263,7 @@ func (t *ExecTool) Execute(ctx context.Context, args map[string]interface{}) *To
 
 	if err != nil {
 		if cmdCtx.Err() == context.DeadlineExceeded {
-			msg := fmt.Sprintf("Command timed out after %v", t.timeout)
+			msg := fmt.Sprintf("Command timed out after %v", timeout)
 			return &ToolResult{
 				ForLLM:  msg,
 				ForUser: msg,
@@ -139,10 +276,15 @@ func (t *ExecTool) Execute(ctx context.Context, args map[string]interface{}) *To
 	if output == "" {
 		output = "(no output)"
 	}
+	output = redactSecrets(output, secrets)
 
-	maxLen := 10000
+	dropped := stdout.dropped + stderr.dropped
 	if len(output) > maxLen {
-		output = output[:maxLen] + fmt.Sprintf("\n... (truncated, %d more chars)", len(output)-maxLen)
+		dropped += len(output) - maxLen
+		output = output[:maxLen]
+	}
+	if dropped > 0 {
+		output += fmt.Sprintf("\n... (truncated, %d more chars)", dropped)
 	}
 
 	if err != nil {
@@ -160,70 +302,104 @@ func (t *ExecTool) Execute(ctx context.Context, args map[string]interface{}) *To
 	}
 }
 
-func (t *ExecTool) guardCommand(command, cwd string) string {
-	cmd := strings.TrimSpace(command)
-	lower := strings.ToLower(cmd)
-
-	for _, pattern := range t.denyPatterns {
-		if pattern.MatchString(lower) {
-			return "Command blocked by safety guard (dangerous pattern detected)"
+// streamSnippetSize is how much of the latest output a progress update shows.
+const streamSnippetSize = 1500
+
+// streamOutput reports the output written since the last update every
+// streamInterval, until stop is closed.
+func (t *ExecTool) streamOutput(command string, live *tailBuffer, secrets map[string]string, progress ProgressFunc, stop <-chan struct{}) {
+	ticker := time.NewTicker(t.streamInterval)
+	defer ticker.Stop()
+	start := time.Now()
+	var offset int64
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			out, next, dropped := live.since(offset)
+			offset = next
+			if out == "" {
+				continue
+			}
+			var sb strings.Builder
+			fmt.Fprintf(&sb, "⏳ %s (running %s)\n", utils.Truncate(command, 80), time.Since(start).Round(time.Second))
+			if dropped > 0 {
+				sb.WriteString("...\n")
+			}
+			sb.WriteString(strings.TrimRight(out, "\n"))
+			progress(redactSecrets(sb.String(), secrets))
 		}
 	}
+}
 
-	if len(t.allowPatterns) > 0 {
-		allowed := false
-		for _, pattern := range t.allowPatterns {
-			if pattern.MatchString(lower) {
-				allowed = true
-				break
-			}
-		}
-		if !allowed {
-			return "Command blocked by safety guard (not in allowlist)"
-		}
+// startBackground starts command without a timeout. It outlives the turn,
+// so it is not tied to the tool call's context.
+func (t *ExecTool) startBackground(command, cwd string, env []string) *ToolResult {
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd, cleanup, err := t.backend.Command(ctx, command, cwd, env)
+	if err != nil {
+		cancel()
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	p, err := t.processes.Start(command, cwd, cmd, cancel, cleanup)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to start background process: %v", err)).WithError(err)
 	}
 
-	if t.restrictToWorkspace {
-		// Check for path traversal patterns
-		if strings.Contains(cmd, "..\\") || strings.Contains(cmd, "../") {
-			return "Command blocked by safety guard (path traversal detected)"
-		}
-		// Check for URL-encoded path traversal
-		if strings.Contains(cmd, "%2e%2e%2f") || strings.Contains(cmd, "%2e%2e/") ||
-			strings.Contains(cmd, "..%2f") || strings.Contains(cmd, "%2e%2e%5c") {
-			return "Command blocked by safety guard (URL-encoded path traversal detected)"
-		}
-		// Check for null byte injection
-		if strings.Contains(cmd, "\x00") || strings.Contains(cmd, "%00") {
-			return "Command blocked by safety guard (null byte injection detected)"
+	// Give it a moment so commands that fail straight away say so
+	select {
+	case <-p.done:
+		output, _ := p.ReadOutput(true)
+		msg := fmt.Sprintf("Background process %s %s:\n%s", p.ID, p.Status(), output)
+		if p.Err() != nil {
+			return ErrorResult(msg)
 		}
+		return NewToolResult(msg)
+	case <-time.After(time.Second):
+	}
+	return NewToolResult(fmt.Sprintf("Started background process %s (pid %d). Use read_output to check its output and kill_process to stop it.",
+		p.ID, cmd.Process.Pid))
+}
 
-		cwdPath, err := filepath.Abs(cwd)
-		if err != nil {
-			return ""
+// commandEnv builds a command's environment: the inherited variables the
+// policy allows, plus secrets. Sandboxed backends get only the secrets, as
+// host variables like PATH mean nothing inside the container.
+func (t *ExecTool) commandEnv(secrets map[string]string) []string {
+	var env []string
+	// Containers start from the image's environment, everything else from ours
+	if _, container := t.backend.(*ContainerBackend); !container {
+		if t.envPolicy == nil && len(secrets) == 0 {
+			return nil
 		}
+		env = inheritedEnv(t.envPolicy)
+	}
+	for name, value := range secrets {
+		env = append(env, name+"="+value)
+	}
+	return env
+}
 
-		pathPattern := regexp.MustCompile(`[A-Za-z]:\\[^\\\"']+|/[^\s\"']+`)
-		matches := pathPattern.FindAllString(cmd, -1)
-
-		for _, raw := range matches {
-			p, err := filepath.Abs(raw)
-			if err != nil {
-				continue
-			}
-
-			rel, err := filepath.Rel(cwdPath, p)
-			if err != nil {
-				continue
-			}
-
-			if strings.HasPrefix(rel, "..") {
-				return "Command blocked by safety guard (path outside working dir)"
-			}
+// secretNames returns the secret names requested in args.
+func secretNames(args map[string]interface{}) []string {
+	raw, _ := args["secrets"].([]interface{})
+	names := make([]string, 0, len(raw))
+	for _, v := range raw {
+		if name, ok := v.(string); ok && name != "" {
+			names = append(names, name)
 		}
 	}
+	return names
+}
 
-	return ""
+// timeoutLimit returns the largest timeout a call may ask for.
+func (t *ExecTool) timeoutLimit() time.Duration {
+	return max(t.maxTimeoutLimit, t.timeout)
+}
+
+// outputLimit returns the largest output size a call may ask for.
+func (t *ExecTool) outputLimit() int {
+	return max(t.maxOutputLimit, t.maxOutput)
 }
 
 func (t *ExecTool) SetTimeout(timeout time.Duration) {
@@ -234,14 +410,50 @@ func (t *ExecTool) SetRestrictToWorkspace(restrict bool) {
 	t.restrictToWorkspace = restrict
 }
 
+// SetSharedFolders lets commands use folders outside the workspace when
+// the tool is restricted to the workspace.
+func (t *ExecTool) SetSharedFolders(folders []string) {
+	t.sharedFolders = folders
+}
+
+// SetAllowPatterns restricts commands to those matching one of patterns;
+// none allows all. On error the current patterns are kept.
 func (t *ExecTool) SetAllowPatterns(patterns []string) error {
-	t.allowPatterns = make([]*regexp.Regexp, 0, len(patterns))
+	allow := make([]*regexp.Regexp, 0, len(patterns))
 	for _, p := range patterns {
 		re, err := regexp.Compile(p)
 		if err != nil {
 			return fmt.Errorf("invalid allow pattern %q: %w", p, err)
 		}
-		t.allowPatterns = append(t.allowPatterns, re)
+		allow = append(allow, re)
 	}
+	t.guardMu.Lock()
+	t.allowPatterns = allow
+	t.guardMu.Unlock()
 	return nil
 }
+
+// boundedBuffer keeps at most max bytes and counts the rest, so a chatty
+// command cannot grow memory without bound.
+type boundedBuffer struct {
+	buf     bytes.Buffer
+	max     int
+	dropped int
+}
+
+func (b *boundedBuffer) Write(p []byte) (int, error) {
+	room := b.max - b.buf.Len()
+	if room <= 0 {
+		b.dropped += len(p)
+		return len(p), nil
+	}
+	if len(p) > room {
+		b.buf.Write(p[:room])
+		b.dropped += len(p) - room
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *boundedBuffer) Len() int       { return b.buf.Len() }
+func (b *boundedBuffer) String() string { return b.buf.String() }
@@ -0,0 +1,798 @@
+package tools
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// maxShellNesting bounds how deep substitutions, subshells and nested
+// "sh -c" scripts are followed before the command is rejected.
+const maxShellNesting = 16
+
+// shellWord is one word of a command with quoting and escapes removed, so
+// `\rm` and `"r"m` both read as rm. Variables and substitutions have no
+// known value and contribute nothing to text.
+type shellWord struct {
+	text  string
+	vars  bool           // contains a variable expansion
+	subs  []*shellScript // command and process substitutions in the word
+	fixed bool           // has any literal part
+}
+
+// dynamic reports whether the word is nothing but expansions, so its value
+// cannot be known before the command runs.
+func (w shellWord) dynamic() bool {
+	return !w.fixed && (w.vars || len(w.subs) > 0)
+}
+
+type shellRedirect struct {
+	op     string // e.g. ">", "2>>", "<<", "<<<"
+	target shellWord
+	body   string // here-document contents
+}
+
+// shellCommand is a simple command: its words after any leading VAR=value
+// assignments, and its redirections. A subshell or brace group is a command
+// with a nested script instead of words.
+type shellCommand struct {
+	assigns   []shellWord
+	words     []shellWord
+	redirects []shellRedirect
+	group     *shellScript
+	defines   bool // name() starting a function definition
+}
+
+// name returns the command name without its directory, e.g. rm for /bin/rm.
+func (c *shellCommand) name() string {
+	if len(c.words) == 0 {
+		return ""
+	}
+	return path.Base(c.words[0].text)
+}
+
+// allWords returns the assignments, words and redirection targets.
+func (c *shellCommand) allWords() []shellWord {
+	words := append(append([]shellWord(nil), c.assigns...), c.words...)
+	for _, r := range c.redirects {
+		words = append(words, r.target)
+	}
+	return words
+}
+
+// String renders the command without quoting, e.g. `rm -rf /`.
+func (c *shellCommand) String() string {
+	var parts []string
+	if c.group != nil {
+		parts = append(parts, "(")
+		for _, line := range c.group.pipelineLines() {
+			parts = append(parts, line+";")
+		}
+		parts = append(parts, ")")
+	}
+	for i, w := range c.words {
+		if i == 0 {
+			parts = append(parts, c.name())
+			continue
+		}
+		if w.text != "" {
+			parts = append(parts, w.text)
+		}
+	}
+	for _, r := range c.redirects {
+		parts = append(parts, r.op+" "+r.target.text)
+	}
+	return strings.Join(parts, " ")
+}
+
+type shellPipeline struct {
+	commands []*shellCommand
+}
+
+func (p *shellPipeline) String() string {
+	parts := make([]string, len(p.commands))
+	for i, c := range p.commands {
+		parts[i] = c.String()
+	}
+	return strings.Join(parts, " | ")
+}
+
+// shellScript is a parsed command line: its pipelines in order, whatever
+// operators (;, &&, ||, &, newline) separate them.
+type shellScript struct {
+	pipelines []*shellPipeline
+	// nested holds scripts run by commands of this one: "sh -c" arguments,
+	// eval arguments and here-documents fed to a shell.
+	nested []*shellScript
+}
+
+// pipelineLines returns the top-level pipelines of the script, rendered.
+func (s *shellScript) pipelineLines() []string {
+	lines := make([]string, len(s.pipelines))
+	for i, p := range s.pipelines {
+		lines[i] = p.String()
+	}
+	return lines
+}
+
+// commandLines renders every pipeline the script would run, including
+// those inside substitutions, subshells and nested shells. Output a
+// substitution feeds to a command is shown as a pipe into it, so
+// `bash <(curl x)` reads as `curl x | bash`.
+func (s *shellScript) commandLines() []string {
+	var lines []string
+	s.walk(func(p *shellPipeline) {
+		lines = append(lines, p.String())
+		for _, c := range p.commands {
+			for _, w := range c.words {
+				for _, sub := range w.subs {
+					for _, line := range sub.commandLines() {
+						lines = append(lines, line+" | "+c.String())
+					}
+				}
+			}
+		}
+	})
+	return lines
+}
+
+// simpleCommands returns every simple command the script would run,
+// rendered, including nested ones.
+func (s *shellScript) simpleCommands() []*shellCommand {
+	var cmds []*shellCommand
+	s.walk(func(p *shellPipeline) {
+		for _, c := range p.commands {
+			if len(c.words) > 0 {
+				cmds = append(cmds, c)
+			}
+		}
+	})
+	return cmds
+}
+
+// walk calls fn for every pipeline in the script and the scripts nested in
+// it.
+func (s *shellScript) walk(fn func(p *shellPipeline)) {
+	for _, p := range s.pipelines {
+		fn(p)
+		for _, c := range p.commands {
+			if c.group != nil {
+				c.group.walk(fn)
+			}
+			for _, w := range c.allWords() {
+				for _, sub := range w.subs {
+					sub.walk(fn)
+				}
+			}
+		}
+	}
+	for _, n := range s.nested {
+		n.walk(fn)
+	}
+}
+
+// shellInterpreters run their -c argument or standard input as a script.
+var shellInterpreters = map[string]bool{
+	"sh": true, "bash": true, "zsh": true, "dash": true, "ksh": true,
+	"csh": true, "tcsh": true, "fish": true, "ash": true, "mksh": true,
+}
+
+// shellKeywords are skipped at the start of a command, so `if rm -rf x;
+// then` is read as the command rm.
+var shellKeywords = map[string]bool{
+	"if": true, "then": true, "else": true, "elif": true, "fi": true,
+	"do": true, "done": true, "while": true, "until": true, "!": true,
+	"{": true, "}": true, "time": true, "esac": true,
+}
+
+// parseShell parses a POSIX shell command line. It understands enough of
+// the grammar (quoting, escapes, pipelines, lists, subshells, command and
+// process substitution, redirections and here-documents) for the safety
+// guard to see the commands behind obfuscations like `"r"m -rf /` or
+// `$(rm -rf /)`. It does not expand variables.
+func parseShell(src string) (*shellScript, error) {
+	script, err := parseShellText(src, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := script.parseNested(0); err != nil {
+		return nil, err
+	}
+	return script, nil
+}
+
+func parseShellText(src string, depth int) (*shellScript, error) {
+	if depth > maxShellNesting {
+		return nil, fmt.Errorf("nested too deeply")
+	}
+	p := &shellParser{src: src, depth: depth}
+	script, err := p.parseList(0)
+	if err != nil {
+		return nil, err
+	}
+	return script, nil
+}
+
+// parseNested parses the scripts the commands hand to a shell or eval,
+// throughout the script.
+func (s *shellScript) parseNested(depth int) error {
+	if depth > maxShellNesting {
+		return fmt.Errorf("nested too deeply")
+	}
+	for _, p := range s.pipelines {
+		for _, c := range p.commands {
+			if c.group != nil {
+				if err := c.group.parseNested(depth + 1); err != nil {
+					return err
+				}
+			}
+			for _, w := range c.allWords() {
+				for _, sub := range w.subs {
+					if err := sub.parseNested(depth + 1); err != nil {
+						return err
+					}
+				}
+			}
+			for _, body := range nestedScripts(c) {
+				n, err := parseShellText(body, depth+1)
+				if err != nil {
+					return err
+				}
+				if err := n.parseNested(depth + 1); err != nil {
+					return err
+				}
+				s.nested = append(s.nested, n)
+			}
+		}
+	}
+	return nil
+}
+
+// nestedScripts returns the script text a command runs in another shell:
+// the argument of `sh -c` (also behind wrappers such as sudo or env), the
+// arguments of eval, or a here-document or here-string given to a shell.
+func nestedScripts(c *shellCommand) []string {
+	var scripts []string
+	for i, w := range c.words {
+		name := path.Base(w.text)
+		if name == "eval" {
+			var args []string
+			for _, a := range c.words[i+1:] {
+				args = append(args, a.text)
+			}
+			return append(scripts, strings.Join(args, " "))
+		}
+		if !shellInterpreters[name] {
+			continue
+		}
+		for j := i + 1; j < len(c.words); j++ {
+			arg := c.words[j].text
+			if !strings.HasPrefix(arg, "-") || strings.HasPrefix(arg, "--") {
+				break
+			}
+			if strings.Contains(arg, "c") && j+1 < len(c.words) {
+				scripts = append(scripts, c.words[j+1].text)
+				break
+			}
+		}
+		for _, r := range c.redirects {
+			if r.op == "<<" || r.op == "<<-" {
+				scripts = append(scripts, r.body)
+			} else if r.op == "<<<" {
+				scripts = append(scripts, r.target.text)
+			}
+		}
+		break
+	}
+	return scripts
+}
+
+type shellParser struct {
+	src      string
+	pos      int
+	depth    int
+	heredocs []*shellRedirect // awaiting their bodies after the next newline
+	inCase   int
+}
+
+func (p *shellParser) peek(s string) bool {
+	return strings.HasPrefix(p.src[p.pos:], s)
+}
+
+func (p *shellParser) skipBlanks() {
+	for p.pos < len(p.src) {
+		switch p.src[p.pos] {
+		case ' ', '\t', '\r':
+			p.pos++
+		case '\\':
+			if p.peek("\\\n") {
+				p.pos += 2
+				continue
+			}
+			return
+		case '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// parseList parses pipelines until the end of input or, inside a subshell
+// or substitution, the closing parenthesis (which it consumes).
+func (p *shellParser) parseList(close byte) (*shellScript, error) {
+	script := &shellScript{}
+	pipeline := &shellPipeline{}
+	cmd := &shellCommand{}
+
+	endCommand := func() {
+		if len(cmd.words) > 0 || len(cmd.assigns) > 0 || len(cmd.redirects) > 0 || cmd.group != nil {
+			pipeline.commands = append(pipeline.commands, cmd)
+			switch cmd.name() {
+			case "case":
+				p.inCase++
+			}
+		}
+		cmd = &shellCommand{}
+	}
+	endPipeline := func() {
+		endCommand()
+		if len(pipeline.commands) > 0 {
+			script.pipelines = append(script.pipelines, pipeline)
+		}
+		pipeline = &shellPipeline{}
+	}
+
+	for {
+		p.skipBlanks()
+		if p.pos >= len(p.src) {
+			if close != 0 {
+				return nil, fmt.Errorf("missing %q", close)
+			}
+			endPipeline()
+			return script, nil
+		}
+
+		c := p.src[p.pos]
+		switch {
+		case c == '\n':
+			p.pos++
+			endPipeline()
+			if err := p.readHeredocs(); err != nil {
+				return nil, err
+			}
+		case p.peek("&&") || p.peek("||") || p.peek(";;"):
+			p.pos += 2
+			endPipeline()
+		case c == ';' || (c == '&' && !p.peek("&>")):
+			p.pos++
+			endPipeline()
+		case p.peek("|&") || c == '|':
+			if p.peek("|&") {
+				p.pos++
+			}
+			p.pos++
+			endCommand()
+		case c == ')':
+			p.pos++
+			if close == ')' {
+				endPipeline()
+				return script, nil
+			}
+			if p.inCase > 0 {
+				// End of a case pattern
+				cmd = &shellCommand{}
+				continue
+			}
+			return nil, fmt.Errorf("unexpected ')'")
+		case c == '(' && len(cmd.words) == 0 && !p.peek("(("):
+			p.pos++
+			group, err := p.parseList(')')
+			if err != nil {
+				return nil, err
+			}
+			cmd.group = group
+		case c == '(' && p.peek("()"):
+			// Function definition: name() { ...; }
+			p.pos += 2
+			cmd.defines = true
+			endPipeline()
+		case c == '(':
+			// Arithmetic command or a parenthesis we do not model
+			if _, err := p.readBalanced('(', ')'); err != nil {
+				return nil, err
+			}
+		default:
+			if op := p.redirectOp(); op != "" {
+				if err := p.parseRedirect(cmd, op); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			w, err := p.readWord()
+			if err != nil {
+				return nil, err
+			}
+			p.addWord(cmd, w)
+		}
+	}
+}
+
+// addWord adds w to cmd as an assignment, a skipped keyword or a word.
+func (p *shellParser) addWord(cmd *shellCommand, w shellWord) {
+	if len(cmd.words) == 0 {
+		if name, _, ok := strings.Cut(w.text, "="); ok && isShellName(name) && w.fixed {
+			cmd.assigns = append(cmd.assigns, w)
+			return
+		}
+		if shellKeywords[w.text] {
+			if w.text == "esac" && p.inCase > 0 {
+				p.inCase--
+			}
+			return
+		}
+	}
+	cmd.words = append(cmd.words, w)
+}
+
+func isShellName(s string) bool {
+	if s == "" || (s[0] >= '0' && s[0] <= '9') {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isNameByte(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isNameByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// redirectOp returns the redirection operator at the current position,
+// with any file descriptor number, or "".
+func (p *shellParser) redirectOp() string {
+	i := p.pos
+	for i < len(p.src) && p.src[i] >= '0' && p.src[i] <= '9' {
+		i++
+	}
+	rest := p.src[i:]
+	for _, op := range []string{"&>>", "&>", "<<<", "<<-", "<<", ">>", ">&", "<&", ">|", "<>", ">", "<"} {
+		if strings.HasPrefix(rest, op) {
+			if strings.HasPrefix(op, "&") && i != p.pos {
+				return ""
+			}
+			if (op == "<" || op == ">") && strings.HasPrefix(rest[1:], "(") {
+				// Process substitution, read as a word
+				return ""
+			}
+			return p.src[p.pos:i] + op
+		}
+	}
+	return ""
+}
+
+func (p *shellParser) parseRedirect(cmd *shellCommand, op string) error {
+	p.pos += len(op)
+	p.skipBlanks()
+	if p.pos >= len(p.src) || strings.ContainsRune("\n;|&)", rune(p.src[p.pos])) {
+		return fmt.Errorf("missing target for %s", op)
+	}
+	target, err := p.readWord()
+	if err != nil {
+		return err
+	}
+	cmd.redirects = append(cmd.redirects, shellRedirect{op: strings.TrimLeft(op, "0123456789"), target: target})
+	if r := &cmd.redirects[len(cmd.redirects)-1]; r.op == "<<" || r.op == "<<-" {
+		p.heredocs = append(p.heredocs, r)
+	}
+	return nil
+}
+
+// readHeredocs reads the bodies of the here-documents started on the line
+// just ended.
+func (p *shellParser) readHeredocs() error {
+	for _, r := range p.heredocs {
+		var body strings.Builder
+		for p.pos < len(p.src) {
+			end := strings.IndexByte(p.src[p.pos:], '\n')
+			line := p.src[p.pos:]
+			if end >= 0 {
+				line = line[:end]
+				p.pos += end + 1
+			} else {
+				p.pos = len(p.src)
+			}
+			check := line
+			if r.op == "<<-" {
+				check = strings.TrimLeft(line, "\t")
+			}
+			if check == r.target.text {
+				break
+			}
+			body.WriteString(line + "\n")
+		}
+		r.body = body.String()
+	}
+	p.heredocs = nil
+	return nil
+}
+
+// readWord reads one word up to an unquoted blank or operator.
+func (p *shellParser) readWord() (shellWord, error) {
+	var w shellWord
+	var text strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case strings.ContainsRune(" \t\r\n;&|)", rune(c)):
+			w.text = text.String()
+			return w, nil
+		case (c == '<' || c == '>') && p.peekAt(1) == '(':
+			p.pos += 2
+			sub, err := p.parseSub(')')
+			if err != nil {
+				return w, err
+			}
+			w.subs = append(w.subs, sub)
+		case c == '<' || c == '>' || c == '(':
+			if c == '(' && text.Len() > 0 && !p.peek("()") {
+				// Glob like @(a|b); keep it literal
+				s, err := p.readBalanced('(', ')')
+				if err != nil {
+					return w, err
+				}
+				text.WriteString(s)
+				w.fixed = true
+				continue
+			}
+			w.text = text.String()
+			return w, nil
+		case c == '\\':
+			p.pos++
+			if p.pos < len(p.src) {
+				if p.src[p.pos] != '\n' {
+					text.WriteByte(p.src[p.pos])
+					w.fixed = true
+				}
+				p.pos++
+			}
+		case c == '\'':
+			end := strings.IndexByte(p.src[p.pos+1:], '\'')
+			if end < 0 {
+				return w, fmt.Errorf("unterminated single quote")
+			}
+			text.WriteString(p.src[p.pos+1 : p.pos+1+end])
+			p.pos += end + 2
+			w.fixed = true
+		case c == '"':
+			p.pos++
+			if err := p.readDoubleQuoted(&w, &text); err != nil {
+				return w, err
+			}
+			w.fixed = true
+		case c == '`':
+			sub, err := p.readBackticks()
+			if err != nil {
+				return w, err
+			}
+			w.subs = append(w.subs, sub)
+		case c == '$':
+			if err := p.readDollar(&w, &text); err != nil {
+				return w, err
+			}
+		default:
+			text.WriteByte(c)
+			w.fixed = true
+			p.pos++
+		}
+	}
+	w.text = text.String()
+	return w, nil
+}
+
+func (p *shellParser) peekAt(offset int) byte {
+	if p.pos+offset < len(p.src) {
+		return p.src[p.pos+offset]
+	}
+	return 0
+}
+
+// readDoubleQuoted reads up to the closing double quote.
+func (p *shellParser) readDoubleQuoted(w *shellWord, text *strings.Builder) error {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch c {
+		case '"':
+			p.pos++
+			return nil
+		case '\\':
+			next := p.peekAt(1)
+			switch next {
+			case '$', '`', '"', '\\':
+				text.WriteByte(next)
+				p.pos += 2
+			case '\n':
+				p.pos += 2
+			default:
+				text.WriteByte(c)
+				p.pos++
+			}
+		case '`':
+			sub, err := p.readBackticks()
+			if err != nil {
+				return err
+			}
+			w.subs = append(w.subs, sub)
+		case '$':
+			if err := p.readDollar(w, text); err != nil {
+				return err
+			}
+		default:
+			text.WriteByte(c)
+			p.pos++
+		}
+	}
+	return fmt.Errorf("unterminated double quote")
+}
+
+// readDollar reads a $ expansion: $(...), $((...)), ${...}, $'...' or $name.
+func (p *shellParser) readDollar(w *shellWord, text *strings.Builder) error {
+	switch next := p.peekAt(1); {
+	case p.peek("$(("):
+		p.pos++
+		if _, err := p.readBalanced('(', ')'); err != nil {
+			return err
+		}
+		w.vars = true
+	case next == '(':
+		p.pos += 2
+		sub, err := p.parseSub(')')
+		if err != nil {
+			return err
+		}
+		w.subs = append(w.subs, sub)
+	case next == '{':
+		p.pos++
+		if _, err := p.readBalanced('{', '}'); err != nil {
+			return err
+		}
+		w.vars = true
+	case next == '\'':
+		p.pos += 2
+		s, err := p.readANSIC()
+		if err != nil {
+			return err
+		}
+		text.WriteString(s)
+		w.fixed = true
+	case next == '_' || (next >= 'a' && next <= 'z') || (next >= 'A' && next <= 'Z'):
+		p.pos++
+		for p.pos < len(p.src) && isNameByte(p.src[p.pos]) {
+			p.pos++
+		}
+		w.vars = true
+	case next != 0 && strings.ContainsRune("0123456789@*#?$!-", rune(next)):
+		p.pos += 2
+		w.vars = true
+	default:
+		text.WriteByte('$')
+		w.fixed = true
+		p.pos++
+	}
+	return nil
+}
+
+// readANSIC reads the body of $'...', decoding its escapes.
+func (p *shellParser) readANSIC() (string, error) {
+	var sb strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == '\'' {
+			p.pos++
+			return sb.String(), nil
+		}
+		if c != '\\' || p.pos+1 >= len(p.src) {
+			sb.WriteByte(c)
+			p.pos++
+			continue
+		}
+		p.pos++
+		e := p.src[p.pos]
+		p.pos++
+		switch e {
+		case 'n':
+			sb.WriteByte('\n')
+		case 't':
+			sb.WriteByte('\t')
+		case 'r':
+			sb.WriteByte('\r')
+		case 'x':
+			n := 0
+			for n < 2 && p.pos+n < len(p.src) && strings.ContainsRune("0123456789abcdefABCDEF", rune(p.src[p.pos+n])) {
+				n++
+			}
+			if v, err := strconv.ParseUint(p.src[p.pos:p.pos+n], 16, 8); err == nil {
+				sb.WriteByte(byte(v))
+			}
+			p.pos += n
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			n := 1
+			for n < 3 && p.pos+n-1 < len(p.src) && p.src[p.pos+n-1] >= '0' && p.src[p.pos+n-1] <= '7' {
+				n++
+			}
+			if v, err := strconv.ParseUint(p.src[p.pos-1:p.pos+n-1], 8, 8); err == nil {
+				sb.WriteByte(byte(v))
+			}
+			p.pos += n - 1
+		default:
+			sb.WriteByte(e)
+		}
+	}
+	return "", fmt.Errorf("unterminated $'...' string")
+}
+
+// readBackticks reads a `...` substitution and parses its contents.
+func (p *shellParser) readBackticks() (*shellScript, error) {
+	p.pos++
+	var body strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == '`' {
+			p.pos++
+			return parseShellText(body.String(), p.depth+1)
+		}
+		if c == '\\' && p.pos+1 < len(p.src) && strings.ContainsRune("`\\$", rune(p.src[p.pos+1])) {
+			p.pos++
+			c = p.src[p.pos]
+		}
+		body.WriteByte(c)
+		p.pos++
+	}
+	return nil, fmt.Errorf("unterminated backquote")
+}
+
+// parseSub parses a substitution body in place, up to close.
+func (p *shellParser) parseSub(close byte) (*shellScript, error) {
+	if p.depth+1 > maxShellNesting {
+		return nil, fmt.Errorf("nested too deeply")
+	}
+	p.depth++
+	defer func() { p.depth-- }()
+	return p.parseList(close)
+}
+
+// readBalanced reads from an opening bracket at the current position to
+// its match, respecting quotes, and returns the text including both.
+func (p *shellParser) readBalanced(open, close byte) (string, error) {
+	start := p.pos
+	depth := 0
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch c {
+		case '\\':
+			p.pos++
+		case '\'':
+			end := strings.IndexByte(p.src[p.pos+1:], '\'')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated single quote")
+			}
+			p.pos += end + 1
+		case open:
+			depth++
+		case close:
+			depth--
+			if depth == 0 {
+				p.pos++
+				return p.src[start:p.pos], nil
+			}
+		}
+		p.pos++
+	}
+	return "", fmt.Errorf("missing %q", close)
+}
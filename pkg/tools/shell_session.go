@@ -0,0 +1,352 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/sipeed/picoclaw/pkg/sandbox/pathguard"
+)
+
+// maxShellSessions caps how many persistent shells may be open at once.
+const maxShellSessions = 4
+
+// shellSession is a long-lived sh process that runs commands sent to its
+// stdin, so cwd, environment variables and virtualenv activation carry
+// over between calls.
+type shellSession struct {
+	name    string
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	chunks  chan []byte // stdout (with stderr merged), closed when the shell exits
+	cancel  context.CancelFunc
+	cleanup func()
+	cwd     string
+	mu      sync.Mutex // one command at a time
+}
+
+func (s *shellSession) close() {
+	s.stdin.Close()
+	s.cancel()
+	s.cleanup()
+}
+
+// markerLine matches the line printed after each command, carrying its exit
+// status and the shell's working directory.
+var markerLine = regexp.MustCompile(`(?m)^(__picoclaw_[0-9a-f]+) (\d+) (.*)$`)
+
+// OpenShell starts a named persistent shell with backend in dir, with the
+// environment env (see ExecBackend.Command).
+func (m *ProcessManager) OpenShell(name, dir string, backend ExecBackend, env []string) (*shellSession, error) {
+	if runtime.GOOS == "windows" {
+		return nil, fmt.Errorf("shell sessions need a POSIX sh and are not supported on Windows")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.shells[name]; exists {
+		return nil, fmt.Errorf("shell session %q is already open", name)
+	}
+	if len(m.shells) >= maxShellSessions {
+		return nil, fmt.Errorf("too many shell sessions (%d open); close one first", len(m.shells))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd, cleanup, err := backend.Command(ctx, "exec sh", dir, env)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	s := &shellSession{
+		name:    name,
+		cmd:     cmd,
+		stdin:   stdin,
+		chunks:  make(chan []byte, 16),
+		cancel:  cancel,
+		cleanup: cleanup,
+		cwd:     dir,
+	}
+	go func() {
+		defer close(s.chunks)
+		buf := make([]byte, 4096)
+		for {
+			n, err := stdout.Read(buf)
+			if n > 0 {
+				s.chunks <- append([]byte(nil), buf[:n]...)
+			}
+			if err != nil {
+				cmd.Wait()
+				return
+			}
+		}
+	}()
+
+	// Merge stderr into stdout so output stays in order
+	if _, err := io.WriteString(stdin, "exec 2>&1\n"); err != nil {
+		s.close()
+		return nil, err
+	}
+	m.shells[name] = s
+	return s, nil
+}
+
+// Shell returns an open shell session by name.
+func (m *ProcessManager) Shell(name string) (*shellSession, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.shells[name]
+	return s, ok
+}
+
+// CloseShell stops a shell session.
+func (m *ProcessManager) CloseShell(name string) error {
+	m.mu.Lock()
+	s, ok := m.shells[name]
+	delete(m.shells, name)
+	m.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("shell session %q not found", name)
+	}
+	s.close()
+	return nil
+}
+
+// ShellNames returns the names of the open shell sessions, sorted.
+func (m *ProcessManager) ShellNames() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.shells))
+	for name := range m.shells {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// run sends command to the shell and waits for it to finish. It returns
+// the command's output (at most maxOutput bytes kept) and exit status.
+func (s *shellSession) run(command string, timeout time.Duration, maxOutput int) (string, int, error) {
+	marker := "__picoclaw_" + strings.ReplaceAll(uuid.NewString(), "-", "")[:16]
+	script := fmt.Sprintf("%s\nprintf '\\n%s %%s %%s\\n' \"$?\" \"$(pwd)\"\n", command, marker)
+	if _, err := io.WriteString(s.stdin, script); err != nil {
+		return "", 0, fmt.Errorf("shell session %q has exited", s.name)
+	}
+
+	out := &boundedBuffer{max: maxOutput}
+	var tail []byte // recent output, to find the marker even past maxOutput
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case chunk, ok := <-s.chunks:
+			if !ok {
+				return out.String(), 0, fmt.Errorf("shell session %q exited", s.name)
+			}
+			out.Write(chunk)
+			tail = append(tail, chunk...)
+			if len(tail) > 8192 {
+				tail = tail[len(tail)-8192:]
+			}
+			if m := markerLine.FindSubmatch(tail); m != nil && string(m[1]) == marker {
+				status, _ := strconv.Atoi(string(m[2]))
+				s.cwd = string(m[3])
+				return trimMarker(out, marker), status, nil
+			}
+		case <-timer.C:
+			return out.String(), 0, fmt.Errorf("timed out after %v", timeout)
+		}
+	}
+}
+
+// trimMarker returns the kept output without the marker line.
+func trimMarker(out *boundedBuffer, marker string) string {
+	text := out.String()
+	if i := strings.Index(text, "\n"+marker); i >= 0 {
+		text = text[:i]
+	}
+	if out.dropped > 0 {
+		text += fmt.Sprintf("\n... (truncated, about %d more chars)", out.dropped)
+	}
+	return text
+}
+
+// ShellSessionTool gives the agent named persistent shells. Commands run
+// through the exec tool's backend and safety guard.
+type ShellSessionTool struct {
+	exec      *ExecTool
+	processes *ProcessManager
+}
+
+func NewShellSessionTool(execTool *ExecTool, processes *ProcessManager) *ShellSessionTool {
+	return &ShellSessionTool{exec: execTool, processes: processes}
+}
+
+func (t *ShellSessionTool) Name() string {
+	return "shell_session"
+}
+
+func (t *ShellSessionTool) Description() string {
+	return "Use a named persistent shell that keeps its working directory, environment variables and activated virtualenvs between commands. Actions: open, run, close, list. Prefer exec for one-off commands."
+}
+
+func (t *ShellSessionTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type": "string",
+				"enum": []string{"open", "run", "close", "list"},
+			},
+			"name": map[string]interface{}{
+				"type":        "string",
+				"description": "Session name, e.g. \"build\"",
+			},
+			"command": map[string]interface{}{
+				"type":        "string",
+				"description": "Command to run (for run)",
+			},
+			"working_dir": map[string]interface{}{
+				"type":        "string",
+				"description": "Starting directory (for open)",
+			},
+			"timeout_seconds": map[string]interface{}{
+				"type":        "integer",
+				"description": "Timeout for the command (for run). The session is closed if it runs out.",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+// ConfirmationSummary shows the command, so approvals work as for exec.
+func (t *ShellSessionTool) ConfirmationSummary(args map[string]interface{}) string {
+	action, _ := args["action"].(string)
+	name, _ := args["name"].(string)
+	if command, _ := args["command"].(string); action == "run" {
+		return fmt.Sprintf("%s\n(in shell session %s)", command, name)
+	}
+	return fmt.Sprintf("%s shell session %s", action, name)
+}
+
+func (t *ShellSessionTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	action, _ := args["action"].(string)
+	name, _ := args["name"].(string)
+	if action == "list" {
+		names := t.processes.ShellNames()
+		if len(names) == 0 {
+			return NewToolResult("No shell sessions open")
+		}
+		return NewToolResult("Open shell sessions: " + strings.Join(names, ", "))
+	}
+	if name == "" {
+		return ErrorResult("name is required")
+	}
+
+	switch action {
+	case "open":
+		dir := t.exec.workingDir
+		if wd, _ := args["working_dir"].(string); wd != "" {
+			dir = wd
+		}
+		if blocked := t.exec.checkGuard(ctx, "cd "+dir, t.exec.workingDir, nil); blocked != nil {
+			return blocked
+		}
+		if _, err := t.processes.OpenShell(name, dir, t.exec.backend, t.exec.commandEnv(nil)); err != nil {
+			return ErrorResult(fmt.Sprintf("failed to open shell session: %v", err)).WithError(err)
+		}
+		return NewToolResult(fmt.Sprintf("Opened shell session %s in %s", name, dir))
+
+	case "run":
+		command, _ := args["command"].(string)
+		if strings.TrimSpace(command) == "" {
+			return ErrorResult("command is required")
+		}
+		s, ok := t.processes.Shell(name)
+		if !ok {
+			return ErrorResult(fmt.Sprintf("shell session %q not found; open it first", name))
+		}
+		if blocked := t.exec.checkGuard(ctx, command, s.cwd, nil); blocked != nil {
+			return blocked
+		}
+
+		timeout := t.exec.timeout
+		if secs, ok := args["timeout_seconds"].(float64); ok && secs > 0 {
+			timeout = min(time.Duration(secs)*time.Second, t.exec.timeoutLimit())
+		}
+		s.mu.Lock()
+		output, status, err := s.run(command, timeout, t.exec.maxOutput)
+		if err == nil {
+			if note := t.confine(s); note != "" {
+				output += "\n" + note
+			}
+		}
+		s.mu.Unlock()
+		if err != nil {
+			t.processes.CloseShell(name)
+			return ErrorResult(fmt.Sprintf("%v; shell session %s was closed. Output so far:\n%s", err, name, output)).WithError(err)
+		}
+		if output == "" {
+			output = "(no output)"
+		}
+		if status != 0 {
+			return ErrorResult(fmt.Sprintf("%s\nExit code: %d", output, status))
+		}
+		return NewToolResult(output)
+
+	case "close":
+		if err := t.processes.CloseShell(name); err != nil {
+			return ErrorResult(err.Error())
+		}
+		return NewToolResult(fmt.Sprintf("Closed shell session %s", name))
+
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action %q", action))
+	}
+}
+
+// confine moves the shell back to the workspace if a command left it and
+// the shared folders when the exec tool is restricted to the workspace.
+func (t *ShellSessionTool) confine(s *shellSession) string {
+	if !t.exec.restrictToWorkspace || t.exec.backend.Sandboxed() || t.exec.workingDir == "" {
+		return ""
+	}
+	workspace, _ := filepath.Abs(t.exec.workingDir)
+	guard := pathguard.New(append([]string{workspace}, t.exec.sharedFolders...)...)
+	if guard.Contains(s.cwd) {
+		return ""
+	}
+	s.run("cd "+shellQuote(workspace), 5*time.Second, 0)
+	return fmt.Sprintf("(left the workspace; moved back to %s)", workspace)
+}
+
+// shellQuote quotes s for sh.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
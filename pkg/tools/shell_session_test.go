@@ -0,0 +1,71 @@
+//go:build !windows
+
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// TestShellSession_KeepsState verifies cwd and environment variables carry
+// over between commands in the same session.
+func TestShellSession_KeepsState(t *testing.T) {
+	workspace := t.TempDir()
+	manager := NewProcessManager()
+	defer manager.StopAll()
+	tool := NewShellSessionTool(NewExecTool(workspace, true), manager)
+	ctx := context.Background()
+
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "open", "name": "dev"}); r.IsError {
+		t.Fatalf("open failed: %s", r.ForLLM)
+	}
+	tool.Execute(ctx, map[string]interface{}{"action": "run", "name": "dev", "command": "mkdir sub && cd sub && export GREETING=hi"})
+
+	r := tool.Execute(ctx, map[string]interface{}{"action": "run", "name": "dev", "command": "echo $GREETING; pwd"})
+	if r.IsError {
+		t.Fatalf("run failed: %s", r.ForLLM)
+	}
+	if !strings.Contains(r.ForLLM, "hi") || !strings.Contains(r.ForLLM, "/sub") {
+		t.Errorf("Expected env var and cwd to persist, got %q", r.ForLLM)
+	}
+	if strings.Contains(r.ForLLM, "__picoclaw_") {
+		t.Errorf("Expected marker to be stripped, got %q", r.ForLLM)
+	}
+
+	r = tool.Execute(ctx, map[string]interface{}{"action": "run", "name": "dev", "command": "ls nonexistent_dir_12345"})
+	if !r.IsError || !strings.Contains(r.ForLLM, "Exit code") || !strings.Contains(r.ForLLM, "No such file") {
+		t.Errorf("Expected failing command with stderr and exit code, got %q", r.ForLLM)
+	}
+
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "close", "name": "dev"}); r.IsError {
+		t.Errorf("close failed: %s", r.ForLLM)
+	}
+	if len(manager.ShellNames()) != 0 {
+		t.Error("Expected no open sessions after close")
+	}
+}
+
+// TestShellSession_ConfinedToWorkspace verifies a restricted session that
+// cds out of the workspace is moved back.
+func TestShellSession_ConfinedToWorkspace(t *testing.T) {
+	workspace := t.TempDir()
+	manager := NewProcessManager()
+	defer manager.StopAll()
+	tool := NewShellSessionTool(NewExecTool(workspace, true), manager)
+	ctx := context.Background()
+
+	tool.Execute(ctx, map[string]interface{}{"action": "open", "name": "dev"})
+	r := tool.Execute(ctx, map[string]interface{}{"action": "run", "name": "dev", "command": "cd .."})
+	if !r.IsError && !strings.Contains(r.ForLLM, "moved back") {
+		t.Errorf("Expected the session to be blocked or moved back, got %q", r.ForLLM)
+	}
+	r = tool.Execute(ctx, map[string]interface{}{"action": "run", "name": "dev", "command": "cd ~"})
+	if !strings.Contains(r.ForLLM, "moved back") {
+		t.Errorf("Expected the session to be moved back, got %q", r.ForLLM)
+	}
+	r = tool.Execute(ctx, map[string]interface{}{"action": "run", "name": "dev", "command": "pwd"})
+	if strings.TrimSpace(r.ForLLM) != workspace {
+		t.Errorf("Expected cwd %s, got %q", workspace, r.ForLLM)
+	}
+}
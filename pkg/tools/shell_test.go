@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -186,6 +187,21 @@ func TestShellTool_OutputTruncation(t *testing.T) {
 	}
 }
 
+// TestShellTool_MaxOutput verifies output beyond the configured cap is
+// dropped while the command runs and reported in the truncation note
+func TestShellTool_MaxOutput(t *testing.T) {
+	tool := NewExecTool("", false)
+	tool.SetMaxOutput(100)
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"command": "head -c 5000 /dev/zero | tr '\\0' 'x'",
+	})
+
+	if !strings.Contains(result.ForLLM, "truncated, 4900 more chars") {
+		t.Errorf("Expected truncation note for 4900 chars, got: %s", result.ForLLM)
+	}
+}
+
 // TestShellTool_RestrictToWorkspace verifies workspace restriction
 func TestShellTool_RestrictToWorkspace(t *testing.T) {
 	tmpDir := t.TempDir()
@@ -208,3 +224,96 @@ func TestShellTool_RestrictToWorkspace(t *testing.T) {
 		t.Errorf("Expected 'blocked' message for path traversal, got ForLLM: %s, ForUser: %s", result.ForLLM, result.ForUser)
 	}
 }
+
+// TestShellTool_RestrictFollowsLinks verifies paths are checked after
+// following symlinks, whole path elements are compared, and ordinary
+// relative paths and URLs are not mistaken for escapes.
+func TestShellTool_RestrictFollowsLinks(t *testing.T) {
+	root := t.TempDir()
+	workspace := filepath.Join(root, "ws")
+	os.MkdirAll(workspace, 0755)
+	os.MkdirAll(filepath.Join(root, "ws-other"), 0755)
+	if err := os.Symlink(root, filepath.Join(workspace, "escape")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	tool := NewExecTool(workspace, false)
+	tool.SetRestrictToWorkspace(true)
+
+	for _, command := range []string{
+		"cat escape/secret.txt",
+		"cat " + filepath.Join(root, "ws-other", "x"),
+		"echo hi > escape/new/file.txt",
+		"cat ~/.ssh/id_rsa",
+	} {
+		if block := tool.guardCommand(command, workspace); block == nil || block.Rule != "path-outside-workspace" {
+			t.Errorf("Expected %q to be blocked as outside the workspace, got %+v", command, block)
+		}
+	}
+	for _, command := range []string{
+		"git log origin/main",
+		"cat notes/todo.md",
+		"cat " + filepath.Join(workspace, "notes.md"),
+		"curl -o page.html https://example.com/page",
+	} {
+		if block := tool.guardCommand(command, workspace); block != nil {
+			t.Errorf("Expected %q to be allowed, got %q", command, block.Error())
+		}
+	}
+}
+
+// TestShellTool_StreamsProgress verifies a long-running command reports its
+// new output before it finishes.
+func TestShellTool_StreamsProgress(t *testing.T) {
+	tool := NewExecTool(t.TempDir(), false)
+	tool.SetStreamInterval(50 * time.Millisecond)
+
+	var mu sync.Mutex
+	var updates []string
+	ctx := WithProgress(context.Background(), func(update string) {
+		mu.Lock()
+		updates = append(updates, update)
+		mu.Unlock()
+	})
+
+	result := tool.Execute(ctx, map[string]interface{}{"command": "echo first; sleep 0.3; echo second"})
+	if result.IsError {
+		t.Fatalf("Expected success, got %s", result.ForLLM)
+	}
+	if !strings.Contains(result.ForLLM, "first") || !strings.Contains(result.ForLLM, "second") {
+		t.Errorf("Expected full output in result, got %s", result.ForLLM)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(updates) == 0 {
+		t.Fatal("Expected at least one progress update")
+	}
+	if !strings.HasSuffix(updates[0], "\nfirst") {
+		t.Errorf("Expected first update to hold only the early output, got %q", updates[0])
+	}
+}
+
+// TestShellTool_PerCallLimits verifies timeout_seconds and max_output_bytes
+// apply to a single call and are clamped to the configured maxima.
+func TestShellTool_PerCallLimits(t *testing.T) {
+	tool := NewExecTool(t.TempDir(), false)
+	tool.SetTimeout(100 * time.Millisecond)
+	tool.SetMaxOutput(10)
+	tool.SetLimits(2*time.Second, 50)
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"command":         "sleep 0.3; echo done",
+		"timeout_seconds": float64(1),
+	})
+	if result.IsError || !strings.Contains(result.ForLLM, "done") {
+		t.Errorf("Expected raised timeout to let the command finish, got %s", result.ForLLM)
+	}
+
+	result = tool.Execute(context.Background(), map[string]interface{}{
+		"command":          "printf '%0100d' 0",
+		"max_output_bytes": float64(1000),
+	})
+	if !strings.Contains(result.ForLLM, "truncated, 50 more chars") {
+		t.Errorf("Expected output clamped to 50 bytes, got %s", result.ForLLM)
+	}
+}
@@ -0,0 +1,71 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/skills"
+)
+
+// SkillTool loads a skill's instructions into the conversation when the
+// model decides it needs them, so only the short skill list is in every
+// prompt.
+type SkillTool struct {
+	loader *skills.SkillsLoader
+}
+
+func NewSkillTool(loader *skills.SkillsLoader) *SkillTool {
+	return &SkillTool{loader: loader}
+}
+
+func (t *SkillTool) Name() string {
+	return "skill"
+}
+
+func (t *SkillTool) Description() string {
+	return "Load the full instructions of a skill listed under Skills in the system prompt. Call it before starting a task the skill covers, then follow the instructions."
+}
+
+func (t *SkillTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"name": map[string]interface{}{
+				"type":        "string",
+				"description": "The skill's name, as listed",
+			},
+		},
+		"required": []string{"name"},
+	}
+}
+
+func (t *SkillTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	name, _ := args["name"].(string)
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return ErrorResult("name is required")
+	}
+
+	var info *skills.SkillInfo
+	var names []string
+	for _, s := range t.loader.ListSkills() {
+		names = append(names, s.Name)
+		if s.Name == name {
+			info = &s
+		}
+	}
+	if info == nil {
+		if len(names) == 0 {
+			return ErrorResult(fmt.Sprintf("no skill %q: no skills are installed", name))
+		}
+		return ErrorResult(fmt.Sprintf("no skill %q; available: %s", name, strings.Join(names, ", ")))
+	}
+	content, ok := t.loader.LoadSkill(name)
+	if !ok {
+		return ErrorResult(fmt.Sprintf("skill %q could not be read", name))
+	}
+	return SilentResult(fmt.Sprintf("# Skill: %s\n\nFiles the skill mentions are relative to %s\n\n%s",
+		name, filepath.Dir(info.Path), strings.TrimSpace(content)))
+}
@@ -0,0 +1,49 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/skills"
+)
+
+const reviewSkill = `---
+name: code-review
+description: Review a diff for bugs
+---
+# Code review
+
+Read the diff in checklist.md order.
+`
+
+// TestSkillTool verifies a skill is loaded without its frontmatter and with
+// the folder its files are in
+func TestSkillTool(t *testing.T) {
+	workspace := t.TempDir()
+	dir := filepath.Join(workspace, "skills", "code-review")
+	os.MkdirAll(dir, 0755)
+	os.WriteFile(filepath.Join(dir, "SKILL.md"), []byte(reviewSkill), 0644)
+	tool := NewSkillTool(skills.NewSkillsLoader(workspace, "", ""))
+
+	result := tool.Execute(context.Background(), map[string]interface{}{"name": "code-review"})
+	if result.IsError {
+		t.Fatalf("Expected the skill, got %s", result.ForLLM)
+	}
+	if !strings.Contains(result.ForLLM, "Read the diff in checklist.md order.") || !strings.Contains(result.ForLLM, dir) {
+		t.Errorf("Expected the instructions and folder, got %q", result.ForLLM)
+	}
+	if strings.Contains(result.ForLLM, "description:") {
+		t.Errorf("Expected the frontmatter to be stripped, got %q", result.ForLLM)
+	}
+	if !result.Silent {
+		t.Error("Expected the skill not to be sent to the user")
+	}
+
+	result = tool.Execute(context.Background(), map[string]interface{}{"name": "deploy"})
+	if !result.IsError || !strings.Contains(result.ForLLM, "code-review") {
+		t.Errorf("Expected an error listing the skills, got %q", result.ForLLM)
+	}
+}
@@ -0,0 +1,213 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const (
+	// maxSpawnTasks bounds the child agents one spawn_agent call starts.
+	maxSpawnTasks = 8
+	// maxChildResultChars bounds each child's summary, so a handful of
+	// children can't fill the parent's context.
+	maxChildResultChars = 4000
+)
+
+const childAgentPrompt = `You are a child agent working on one part of a larger task for another agent, which sees only your final answer.
+Use your tools as needed, but stay within the task you were given.
+When done, reply with a concise summary of what you found or did: the facts, figures and file paths that matter, no preamble. Say plainly if you could not finish.`
+
+// SpawnAgentTool delegates bounded subtasks to child agents, each with a
+// fresh context and a restricted set of tools, and waits for their
+// summaries. Several tasks run in parallel, for map/reduce-style work:
+// research each source in a child, then combine the results.
+type SpawnAgentTool struct {
+	manager       *SubagentManager
+	originChannel string
+	originChatID  string
+}
+
+func NewSpawnAgentTool(manager *SubagentManager) *SpawnAgentTool {
+	return &SpawnAgentTool{
+		manager:       manager,
+		originChannel: "cli",
+		originChatID:  "direct",
+	}
+}
+
+func (t *SpawnAgentTool) Name() string {
+	return "spawn_agent"
+}
+
+func (t *SpawnAgentTool) Description() string {
+	return fmt.Sprintf("Delegate self-contained subtasks to child agents and wait for their summaries. Each child starts with an empty context, so describe each task completely; several tasks run in parallel (at most %d). Use it to split research or checks into independent parts, then combine the results yourself.", maxSpawnTasks)
+}
+
+func (t *SpawnAgentTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"tasks": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "The subtasks, one child agent each",
+			},
+			"context": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional background every child needs, such as the overall goal",
+			},
+			"tools": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Optional tools the children may use, e.g. [\"web_search\", \"web_fetch\"]; all subagent tools if omitted",
+			},
+			"max_rounds": map[string]interface{}{
+				"type":        "integer",
+				"description": "Optional limit on each child's tool rounds",
+			},
+		},
+		"required": []string{"tasks"},
+	}
+}
+
+func (t *SpawnAgentTool) SetContext(channel, chatID string) {
+	t.originChannel = channel
+	t.originChatID = chatID
+}
+
+// childResult is what one child agent returned.
+type childResult struct {
+	content string
+	rounds  int
+	err     error
+}
+
+func (t *SpawnAgentTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	if t.manager == nil {
+		return ErrorResult("Subagent manager not configured")
+	}
+	tasks := stringList(args["tasks"])
+	if len(tasks) == 0 {
+		return ErrorResult("tasks is required: a list of subtasks")
+	}
+	if len(tasks) > maxSpawnTasks {
+		return ErrorResult(fmt.Sprintf("at most %d tasks per call; got %d", maxSpawnTasks, len(tasks)))
+	}
+	background, _ := args["context"].(string)
+
+	sm := t.manager
+	sm.mu.RLock()
+	registry := sm.tools
+	model := sm.defaultModel
+	rounds := sm.maxIterations
+	capabilities := sm.capabilities
+	sm.mu.RUnlock()
+
+	if n, ok := args["max_rounds"].(float64); ok && n >= 1 && int(n) < rounds {
+		rounds = int(n)
+	}
+	var filter ToolFilter
+	if names := stringList(args["tools"]); len(names) > 0 {
+		for _, name := range names {
+			if !registry.IsEnabled(name) {
+				return ErrorResult(fmt.Sprintf("tool %q is not available to child agents; they can use %s", name, strings.Join(enabledNames(registry), ", ")))
+			}
+		}
+		filter = func(name string) bool { return slices.Contains(names, name) }
+	}
+
+	results := make([]childResult, len(tasks))
+	var wg sync.WaitGroup
+	for i, task := range tasks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, ok := sm.acquireSlot(ctx)
+			if !ok {
+				results[i].err = ctx.Err()
+				return
+			}
+			defer release()
+
+			prompt := task
+			if background != "" {
+				prompt = "Background: " + background + "\n\nYour task: " + task
+			}
+			messages := []providers.Message{
+				{Role: "system", Content: childAgentPrompt},
+				{Role: "user", Content: prompt},
+			}
+			loopResult, err := RunToolLoop(ctx, ToolLoopConfig{
+				Provider:      sm.provider,
+				Model:         model,
+				Tools:         registry,
+				Capabilities:  capabilities,
+				MaxIterations: rounds,
+				Filter:        filter,
+				LLMOptions: map[string]any{
+					"max_tokens":  4096,
+					"temperature": 0.7,
+				},
+			}, messages, t.originChannel, t.originChatID)
+			if err != nil {
+				results[i].err = err
+				return
+			}
+			results[i] = childResult{content: loopResult.Content, rounds: loopResult.Iterations}
+		}()
+	}
+	wg.Wait()
+
+	var sb strings.Builder
+	failed := 0
+	for i, r := range results {
+		fmt.Fprintf(&sb, "## Task %d: %s\n\n", i+1, utils.Truncate(tasks[i], 200))
+		switch {
+		case r.err != nil:
+			failed++
+			fmt.Fprintf(&sb, "Failed: %v\n\n", r.err)
+		case strings.TrimSpace(r.content) == "":
+			failed++
+			fmt.Fprintf(&sb, "No answer after %d rounds; the child ran out of rounds.\n\n", r.rounds)
+		default:
+			fmt.Fprintf(&sb, "%s\n\n", utils.Truncate(strings.TrimSpace(r.content), maxChildResultChars))
+		}
+	}
+	summary := fmt.Sprintf("%d of %d child agents finished.", len(tasks)-failed, len(tasks))
+	result := &ToolResult{
+		ForLLM:  summary + "\n\n" + strings.TrimSpace(sb.String()),
+		ForUser: summary,
+	}
+	if failed == len(tasks) {
+		result.IsError = true
+	}
+	return result
+}
+
+// stringList reads a JSON array of strings from tool arguments.
+func stringList(value interface{}) []string {
+	items, _ := value.([]interface{})
+	var list []string
+	for _, item := range items {
+		if s, ok := item.(string); ok && strings.TrimSpace(s) != "" {
+			list = append(list, strings.TrimSpace(s))
+		}
+	}
+	return list
+}
+
+func enabledNames(registry *ToolRegistry) []string {
+	var names []string
+	for _, name := range registry.List() {
+		if registry.IsEnabled(name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,108 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// namedTool is a tool that answers with its name.
+type namedTool struct{ name string }
+
+func (t *namedTool) Name() string        { return t.name }
+func (t *namedTool) Description() string { return "test tool " + t.name }
+func (t *namedTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{"type": "object"}
+}
+func (t *namedTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	return SilentResult("ran " + t.name)
+}
+
+// toolCallingProvider calls the tool named in the task once, then answers
+// with the tools it was offered and the tool's result.
+type toolCallingProvider struct{}
+
+func (p *toolCallingProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, options map[string]interface{}) (*providers.LLMResponse, error) {
+	last := messages[len(messages)-1]
+	if last.Role == "tool" {
+		var offered []string
+		for _, def := range tools {
+			offered = append(offered, def.Function.Name)
+		}
+		return &providers.LLMResponse{Content: "offered " + strings.Join(offered, ",") + "; " + last.Content}, nil
+	}
+	task := last.Content[strings.LastIndex(last.Content, " ")+1:]
+	return &providers.LLMResponse{ToolCalls: []providers.ToolCall{{ID: "1", Name: task, Arguments: map[string]interface{}{}}}}, nil
+}
+
+func (p *toolCallingProvider) GetDefaultModel() string { return "test-model" }
+
+// TestSpawnAgentTool_Parallel verifies each task gets its own child with
+// the shared background, and the summaries come back in task order.
+func TestSpawnAgentTool_Parallel(t *testing.T) {
+	manager := NewSubagentManager(&MockLLMProvider{}, "test-model", t.TempDir(), nil)
+	tool := NewSpawnAgentTool(manager)
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"tasks":   []interface{}{"check source A", "check source B"},
+		"context": "compare prices",
+	})
+	if result.IsError {
+		t.Fatalf("Expected success, got %s", result.ForLLM)
+	}
+	a := strings.Index(result.ForLLM, "Task completed: Background: compare prices\n\nYour task: check source A")
+	b := strings.Index(result.ForLLM, "Your task: check source B")
+	if a < 0 || b < a {
+		t.Errorf("Expected both results in order, got %q", result.ForLLM)
+	}
+	if result.ForUser != "2 of 2 child agents finished." {
+		t.Errorf("Expected a short summary for the user, got %q", result.ForUser)
+	}
+}
+
+// TestSpawnAgentTool_RestrictedTools verifies children are offered only the
+// tools named, can't call others, and that unknown tools are refused.
+func TestSpawnAgentTool_RestrictedTools(t *testing.T) {
+	manager := NewSubagentManager(&toolCallingProvider{}, "test-model", t.TempDir(), nil)
+	registry := NewToolRegistry()
+	registry.Register(&namedTool{name: "web_search"})
+	registry.Register(&namedTool{name: "exec"})
+	manager.SetTools(registry)
+	tool := NewSpawnAgentTool(manager)
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"tasks": []interface{}{"use web_search", "use exec"},
+		"tools": []interface{}{"web_search"},
+	})
+	if !strings.Contains(result.ForLLM, "offered web_search; ran web_search") {
+		t.Errorf("Expected the first child to run web_search only, got %q", result.ForLLM)
+	}
+	if !strings.Contains(result.ForLLM, "offered web_search; Tool exec is not available for this task") {
+		t.Errorf("Expected the second child to be refused exec, got %q", result.ForLLM)
+	}
+
+	result = tool.Execute(context.Background(), map[string]interface{}{
+		"tasks": []interface{}{"anything"},
+		"tools": []interface{}{"spawn_agent"},
+	})
+	if !result.IsError || !strings.Contains(result.ForLLM, "exec, web_search") {
+		t.Errorf("Expected an error listing the child tools, got %q", result.ForLLM)
+	}
+}
+
+// TestSpawnAgentTool_Limits verifies the task count is bounded.
+func TestSpawnAgentTool_Limits(t *testing.T) {
+	tool := NewSpawnAgentTool(NewSubagentManager(&MockLLMProvider{}, "test-model", t.TempDir(), nil))
+	tasks := make([]interface{}, maxSpawnTasks+1)
+	for i := range tasks {
+		tasks[i] = "task"
+	}
+	if result := tool.Execute(context.Background(), map[string]interface{}{"tasks": tasks}); !result.IsError {
+		t.Error("Expected too many tasks to be refused")
+	}
+	if result := tool.Execute(context.Background(), map[string]interface{}{}); !result.IsError {
+		t.Error("Expected missing tasks to be refused")
+	}
+}
@@ -0,0 +1,643 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	defaultSQLRows = 100
+	maxSQLRows     = 1000
+	// maxSQLCell cuts long values in a table cell.
+	maxSQLCell = 200
+)
+
+// SQL engines, each run through its command-line client.
+const (
+	sqlSQLite   = "sqlite"   // sqlite3
+	sqlPostgres = "postgres" // psql
+	sqlMySQL    = "mysql"    // mysql or mariadb
+)
+
+// SQLDatabase is a database the sql tool may open by name. DSN is a
+// postgres:// or mysql:// URL, or the path of an SQLite file.
+type SQLDatabase struct {
+	Name     string
+	DSN      string
+	Writable bool
+}
+
+// SQLTool queries SQLite files and configured Postgres and MySQL databases
+// through their command-line clients (sqlite3, psql, mysql), returning rows
+// as a markdown table. Databases are opened read-only unless configured
+// writable; SQLite files opened by path always are. For Postgres and MySQL
+// that is a read-only transaction, which a determined query might still
+// find a way around: a read-only database role is the real guarantee.
+type SQLTool struct {
+	pathScope
+	databases map[string]SQLDatabase
+	maxRows   int
+	timeout   time.Duration
+}
+
+// NewSQLTool returns a sql tool over databases, showing at most maxRows
+// rows (defaultSQLRows if 0) and stopping queries after timeout (30s if 0).
+func NewSQLTool(workspace string, restrict bool, databases []SQLDatabase, maxRows int, timeout time.Duration) *SQLTool {
+	if maxRows <= 0 {
+		maxRows = defaultSQLRows
+	}
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	dbs := make(map[string]SQLDatabase, len(databases))
+	for _, db := range databases {
+		dbs[db.Name] = db
+	}
+	return &SQLTool{
+		pathScope: pathScope{workspace: workspace, restrict: restrict},
+		databases: dbs,
+		maxRows:   min(maxRows, maxSQLRows),
+		timeout:   timeout,
+	}
+}
+
+func (t *SQLTool) Name() string {
+	return "sql"
+}
+
+func (t *SQLTool) Description() string {
+	desc := "Query a database with SQL and get the rows as a markdown table. Use action=schema first to see the tables and columns. " +
+		"SQLite files can be opened by path."
+	if len(t.databases) > 0 {
+		names := make([]string, 0, len(t.databases))
+		for name, db := range t.databases {
+			mode := "read-only"
+			if db.Writable {
+				mode = "writable"
+			}
+			names = append(names, fmt.Sprintf("%s (%s, %s)", name, sqlEngine(db.DSN), mode))
+		}
+		sort.Strings(names)
+		desc += " Configured databases: " + strings.Join(names, ", ") + "."
+	}
+	return desc + " Databases are read-only unless marked writable."
+}
+
+func (t *SQLTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"database": map[string]interface{}{
+				"type":        "string",
+				"description": "A configured database name, or the path of an SQLite file",
+			},
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"query", "schema"},
+				"description": "query runs SQL (default); schema lists tables and their columns",
+			},
+			"query": map[string]interface{}{
+				"type":        "string",
+				"description": "The SQL to run, for action=query",
+			},
+			"table": map[string]interface{}{
+				"type":        "string",
+				"description": "For action=schema, only show this table",
+			},
+			"limit": map[string]interface{}{
+				"type":        "integer",
+				"description": fmt.Sprintf("Most rows to show (default %d, max %d); use LIMIT/OFFSET to page", t.maxRows, maxSQLRows),
+			},
+		},
+		"required": []string{"database"},
+	}
+}
+
+// ConfirmationSummary shows the query and the database it runs on.
+func (t *SQLTool) ConfirmationSummary(args map[string]interface{}) string {
+	database, _ := args["database"].(string)
+	if action, _ := args["action"].(string); action == "schema" {
+		return fmt.Sprintf("schema of %s", database)
+	}
+	query, _ := args["query"].(string)
+	return fmt.Sprintf("on %s:\n%s", database, query)
+}
+
+// sqlTarget is a database resolved for a call.
+type sqlTarget struct {
+	engine   string
+	dsn      string // the URL, or the SQLite file's path
+	writable bool
+}
+
+func (t *SQLTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	database, _ := args["database"].(string)
+	if database == "" {
+		return ErrorResult("database is required")
+	}
+	target, err := t.target(database)
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+	limit := t.maxRows
+	if v, ok := args["limit"].(float64); ok && v >= 1 {
+		limit = min(int(v), maxSQLRows)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	action, _ := args["action"].(string)
+	switch action {
+	case "schema":
+		table, _ := args["table"].(string)
+		return t.schema(ctx, target, table)
+	case "", "query":
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action %q: use query or schema", action))
+	}
+
+	query, _ := args["query"].(string)
+	if strings.TrimSpace(query) == "" {
+		return ErrorResult("query is required")
+	}
+	if err := checkSQLClientCommands(target.engine, query); err != nil {
+		return ErrorResult(err.Error())
+	}
+	if !target.writable && target.engine != sqlSQLite {
+		// sqlite3 opens the file read-only; the servers rely on a read-only
+		// transaction the query must not end
+		if query, err = readOnlyStatement(target.engine, query); err != nil {
+			return ErrorResult(err.Error())
+		}
+	}
+	columns, rows, more, err := runSQL(ctx, target, query, limit)
+	if err != nil {
+		return ErrorResult(sqlErrorMessage(target, database, err)).WithError(err)
+	}
+	return sqlResult(columns, rows, more, limit)
+}
+
+// target resolves a configured name, or an SQLite file in the workspace.
+func (t *SQLTool) target(database string) (sqlTarget, error) {
+	if db, ok := t.databases[database]; ok {
+		target := sqlTarget{engine: sqlEngine(db.DSN), dsn: db.DSN, writable: db.Writable}
+		if target.engine == sqlSQLite {
+			target.dsn = sqlitePath(db.DSN)
+		}
+		return target, nil
+	}
+	if strings.Contains(database, "://") {
+		return sqlTarget{}, fmt.Errorf("unknown database %q: connection URLs must be configured in tools.sql.databases", database)
+	}
+	path, err := t.resolvePath(database)
+	if err != nil {
+		return sqlTarget{}, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		if len(t.databases) > 0 && os.IsNotExist(err) {
+			return sqlTarget{}, fmt.Errorf("%q is neither a configured database nor an SQLite file", database)
+		}
+		return sqlTarget{}, err
+	}
+	if info.IsDir() {
+		return sqlTarget{}, fmt.Errorf("%s is a directory, not an SQLite file", database)
+	}
+	return sqlTarget{engine: sqlSQLite, dsn: path}, nil
+}
+
+// sqlEngine tells the engine from a DSN; anything but a postgres or mysql
+// URL is an SQLite file.
+func sqlEngine(dsn string) string {
+	switch {
+	case strings.HasPrefix(dsn, "postgres://"), strings.HasPrefix(dsn, "postgresql://"):
+		return sqlPostgres
+	case strings.HasPrefix(dsn, "mysql://"), strings.HasPrefix(dsn, "mariadb://"):
+		return sqlMySQL
+	}
+	return sqlSQLite
+}
+
+func sqlitePath(dsn string) string {
+	for _, prefix := range []string{"sqlite://", "sqlite:", "file:"} {
+		if strings.HasPrefix(dsn, prefix) {
+			return strings.TrimPrefix(dsn, prefix)
+		}
+	}
+	return dsn
+}
+
+// checkSQLClientCommands refuses what the command-line clients would run
+// themselves instead of sending it to the database: sqlite3 dot-commands,
+// psql backslash commands and mysql client commands can read files or
+// start a shell.
+func checkSQLClientCommands(engine, query string) error {
+	trimmed := strings.TrimSpace(query)
+	switch engine {
+	case sqlSQLite:
+		if strings.HasPrefix(trimmed, ".") {
+			return errors.New("sqlite3 dot-commands are not allowed; use SQL (e.g. action=schema instead of .tables)")
+		}
+	case sqlPostgres:
+		if strings.HasPrefix(trimmed, `\`) {
+			return errors.New(`psql backslash commands are not allowed; use SQL (e.g. action=schema instead of \d)`)
+		}
+	case sqlMySQL:
+		// mysql reads \x commands anywhere and named ones at line starts
+		if strings.Contains(query, `\`) {
+			return errors.New("backslashes are not allowed in MySQL queries")
+		}
+		for _, line := range strings.Split(query, "\n") {
+			word, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(line)), " ")
+			word = strings.TrimRight(word, ";")
+			if mysqlClientCommands[word] {
+				return fmt.Errorf("the mysql client command %q is not allowed; use SQL", word)
+			}
+		}
+	}
+	return nil
+}
+
+var mysqlClientCommands = map[string]bool{
+	"?": true, "charset": true, "clear": true, "connect": true, "delimiter": true, "edit": true, "ego": true,
+	"exit": true, "go": true, "help": true, "nopager": true, "notee": true, "nowarning": true, "pager": true,
+	"print": true, "prompt": true, "query_attributes": true, "quit": true, "rehash": true, "resetconnection": true,
+	"source": true, "ssl_session_data_print": true, "status": true, "system": true, "tee": true, "use": true,
+	"warnings": true,
+}
+
+// runSQL runs query and reads up to limit rows, reporting whether there
+// were more. The client is stopped once enough rows are read.
+func runSQL(ctx context.Context, target sqlTarget, query string, limit int) ([]string, [][]string, bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	cmd, err := sqlCommand(ctx, target, query)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, false, err
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return nil, nil, false, err
+	}
+
+	var columns []string
+	var rows [][]string
+	more := false
+	readErr := readSQLRows(target.engine, stdout, func(record []string) bool {
+		if columns == nil {
+			columns = record
+			return true
+		}
+		if len(rows) == limit {
+			more = true
+			return false
+		}
+		rows = append(rows, record)
+		return true
+	})
+	if more {
+		cancel()
+	}
+	io.Copy(io.Discard, stdout)
+	waitErr := cmd.Wait()
+
+	switch {
+	case more:
+		// Stopped on purpose
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return nil, nil, false, errors.New("the query timed out")
+	case waitErr != nil:
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = waitErr.Error()
+		}
+		return nil, nil, false, errors.New(msg)
+	case readErr != nil:
+		return nil, nil, false, fmt.Errorf("failed to read the results: %w", readErr)
+	}
+	return columns, rows, more, nil
+}
+
+// sqlCommand builds the client command running query on target.
+func sqlCommand(ctx context.Context, target sqlTarget, query string) (*exec.Cmd, error) {
+	switch target.engine {
+	case sqlPostgres:
+		path, err := exec.LookPath("psql")
+		if err != nil {
+			return nil, errors.New("querying Postgres needs psql (e.g. apt install postgresql-client)")
+		}
+		dsn, password, err := postgresCredentials(target.dsn)
+		if err != nil {
+			return nil, err
+		}
+		args := []string{"-X", "-q", "--csv", "-P", "null=NULL", "-v", "ON_ERROR_STOP=1", "-d", dsn}
+		if target.writable {
+			args = append(args, "-c", query)
+		} else {
+			args = append(args, "-c", "BEGIN READ ONLY", "-c", query, "-c", "ROLLBACK")
+		}
+		cmd := exec.CommandContext(ctx, path, args...)
+		cmd.Env = os.Environ()
+		if password != "" {
+			cmd.Env = append(cmd.Env, "PGPASSWORD="+password)
+		}
+		if !target.writable {
+			cmd.Env = append(cmd.Env, "PGOPTIONS="+strings.TrimSpace(os.Getenv("PGOPTIONS")+" -c default_transaction_read_only=on"))
+		}
+		cmd.Env = append(cmd.Env, "PGCONNECT_TIMEOUT=10")
+		return cmd, nil
+
+	case sqlMySQL:
+		path, err := exec.LookPath("mysql")
+		if err != nil {
+			if path, err = exec.LookPath("mariadb"); err != nil {
+				return nil, errors.New("querying MySQL needs the mysql client (e.g. apt install mariadb-client)")
+			}
+		}
+		u, err := url.Parse(target.dsn)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MySQL URL: %w", err)
+		}
+		args := []string{"--batch", "--no-auto-rehash", "--connect-timeout=10"}
+		if u.Hostname() != "" {
+			args = append(args, "-h", u.Hostname())
+		}
+		if u.Port() != "" {
+			args = append(args, "-P", u.Port())
+		}
+		if u.User != nil {
+			args = append(args, "-u", u.User.Username())
+		}
+		if !target.writable {
+			query = "SET SESSION TRANSACTION READ ONLY;\nSTART TRANSACTION READ ONLY;\n" + query + ";\nROLLBACK;"
+		}
+		args = append(args, "-e", query)
+		if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+			args = append(args, db)
+		}
+		cmd := exec.CommandContext(ctx, path, args...)
+		cmd.Env = os.Environ()
+		if password, ok := u.User.Password(); ok {
+			cmd.Env = append(cmd.Env, "MYSQL_PWD="+password)
+		}
+		return cmd, nil
+	}
+
+	path, err := exec.LookPath("sqlite3")
+	if err != nil {
+		return nil, errors.New("querying SQLite needs sqlite3 (e.g. apt install sqlite3)")
+	}
+	// -safe refuses ATTACH, extensions and shell escapes
+	args := []string{"-safe", "-bail", "-csv", "-header", "-nullvalue", "NULL"}
+	if !target.writable {
+		args = append(args, "-readonly")
+	}
+	args = append(args, target.dsn, query)
+	return exec.CommandContext(ctx, path, args...), nil
+}
+
+// postgresCredentials takes the password out of a Postgres URL, so it is
+// passed in PGPASSWORD rather than on the command line for anyone to see.
+func postgresCredentials(dsn string) (string, string, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid Postgres URL: %w", err)
+	}
+	password, _ := u.User.Password()
+	if password != "" {
+		u.User = url.User(u.User.Username())
+	}
+	if q := u.Query(); q.Has("password") {
+		if password == "" {
+			password = q.Get("password")
+		}
+		q.Del("password")
+		u.RawQuery = q.Encode()
+	}
+	return u.String(), password, nil
+}
+
+// readSQLRows calls row with each record of the client's output, header
+// first, until it returns false. sqlite3 and psql write CSV; mysql writes
+// tab-separated values with backslash escapes.
+func readSQLRows(engine string, r io.Reader, row func([]string) bool) error {
+	if engine == sqlMySQL {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 16<<20)
+		for scanner.Scan() {
+			fields := strings.Split(scanner.Text(), "\t")
+			for i, f := range fields {
+				fields[i] = mysqlUnescape(f)
+			}
+			if !row(fields) {
+				return nil
+			}
+		}
+		return scanner.Err()
+	}
+
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !row(record) {
+			return nil
+		}
+	}
+}
+
+func mysqlUnescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			sb.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			sb.WriteByte('\n')
+		case 't':
+			sb.WriteByte('\t')
+		case '0':
+			sb.WriteByte(0)
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	return sb.String()
+}
+
+// sqlErrorMessage explains a failed query, pointing at the config when a
+// write hit a read-only database.
+func sqlErrorMessage(target sqlTarget, database string, err error) string {
+	msg := err.Error()
+	lower := strings.ToLower(msg)
+	if !target.writable && (strings.Contains(lower, "readonly database") || strings.Contains(lower, "read-only transaction") ||
+		strings.Contains(lower, "read only transaction")) {
+		return fmt.Sprintf("%s is read-only, so the query can't change it (%s). Databases are writable only when configured with \"writable\": true in tools.sql.databases.", database, msg)
+	}
+	return "query failed: " + msg
+}
+
+// sqlResult renders rows as a markdown table with a line on how many
+// there are.
+func sqlResult(columns []string, rows [][]string, more bool, limit int) *ToolResult {
+	data := map[string]interface{}{
+		"columns":   columns,
+		"rows":      rows,
+		"truncated": more,
+	}
+	if columns == nil {
+		return NewToolResult("The statement ran and returned no rows.").WithData(data)
+	}
+	if rows == nil {
+		rows = [][]string{}
+		data["rows"] = rows
+	}
+	out := markdownTable(columns, rows)
+	switch {
+	case more:
+		out += fmt.Sprintf("\n\n(Showing the first %d rows; there are more. Narrow the query or page with LIMIT and OFFSET.)", limit)
+	case len(rows) == 1:
+		out += "\n\n(1 row)"
+	default:
+		out += fmt.Sprintf("\n\n(%d rows)", len(rows))
+	}
+	return NewToolResult(out).WithData(data)
+}
+
+// markdownTable renders a table, keeping each cell on one line.
+func markdownTable(columns []string, rows [][]string) string {
+	var sb strings.Builder
+	writeRow := func(cells []string) {
+		sb.WriteString("|")
+		for i := range columns {
+			cell := ""
+			if i < len(cells) {
+				cell = cells[i]
+			}
+			sb.WriteString(" " + markdownCell(cell) + " |")
+		}
+		sb.WriteString("\n")
+	}
+	writeRow(columns)
+	sb.WriteString("|")
+	for range columns {
+		sb.WriteString(" --- |")
+	}
+	sb.WriteString("\n")
+	for _, row := range rows {
+		writeRow(row)
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+func markdownCell(s string) string {
+	s = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ", "|", `\|`).Replace(s)
+	if utf8.RuneCountInString(s) > maxSQLCell {
+		s = string([]rune(s)[:maxSQLCell]) + "…"
+	}
+	return s
+}
+
+// schema lists the tables and views with their columns, one line each.
+func (t *SQLTool) schema(ctx context.Context, target sqlTarget, table string) *ToolResult {
+	var query string
+	switch target.engine {
+	case sqlPostgres:
+		query = `SELECT CASE WHEN c.table_schema = 'public' THEN c.table_name ELSE c.table_schema || '.' || c.table_name END AS "table",
+  c.column_name AS "column", c.data_type AS "type", c.is_nullable = 'NO' AS "notnull",
+  EXISTS (SELECT 1 FROM information_schema.key_column_usage k JOIN information_schema.table_constraints tc
+    ON tc.constraint_name = k.constraint_name AND tc.table_schema = k.table_schema
+    WHERE tc.constraint_type = 'PRIMARY KEY' AND k.table_schema = c.table_schema AND k.table_name = c.table_name AND k.column_name = c.column_name) AS "pk"
+FROM information_schema.columns c
+WHERE c.table_schema NOT IN ('pg_catalog', 'information_schema')
+ORDER BY c.table_schema, c.table_name, c.ordinal_position`
+	case sqlMySQL:
+		query = `SELECT table_name AS "table", column_name AS "column", column_type AS "type",
+  is_nullable = 'NO' AS "notnull", column_key = 'PRI' AS "pk"
+FROM information_schema.columns WHERE table_schema = DATABASE()
+ORDER BY table_name, ordinal_position`
+	default:
+		query = `SELECT m.name AS "table", p.name AS "column", p.type AS "type", p."notnull" AS "notnull", p.pk > 0 AS "pk"
+FROM sqlite_schema m JOIN pragma_table_info(m.name) p
+WHERE m.type IN ('table', 'view') AND m.name NOT LIKE 'sqlite_%'
+ORDER BY m.name, p.cid`
+	}
+
+	_, rows, _, err := runSQL(ctx, target, query, 100000)
+	if err != nil {
+		return ErrorResult("failed to read the schema: " + err.Error()).WithError(err)
+	}
+
+	var tables []string
+	columns := make(map[string][]string)
+	for _, row := range rows {
+		if len(row) < 5 || (table != "" && !strings.EqualFold(row[0], table)) {
+			continue
+		}
+		col := row[1]
+		if row[2] != "" {
+			col += " " + row[2]
+		}
+		if sqlTrue(row[4]) {
+			col += " primary key"
+		} else if sqlTrue(row[3]) {
+			col += " not null"
+		}
+		if _, ok := columns[row[0]]; !ok {
+			tables = append(tables, row[0])
+		}
+		columns[row[0]] = append(columns[row[0]], col)
+	}
+	if len(tables) == 0 {
+		if table != "" {
+			return ErrorResult(fmt.Sprintf("no table named %q", table))
+		}
+		return NewToolResult("The database has no tables.")
+	}
+
+	var sb strings.Builder
+	for _, name := range tables {
+		fmt.Fprintf(&sb, "%s (%s)\n", name, strings.Join(columns[name], ", "))
+	}
+	return NewToolResult(strings.TrimRight(sb.String(), "\n")).WithData(map[string]interface{}{"tables": columns})
+}
+
+// sqlTrue reads a boolean as each client prints it.
+func sqlTrue(s string) bool {
+	switch strings.ToLower(s) {
+	case "1", "t", "true":
+		return true
+	}
+	return false
+}
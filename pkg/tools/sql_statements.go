@@ -0,0 +1,150 @@
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// readOnlyStatements are the statements refused on read-only Postgres and
+// MySQL databases: they end the read-only transaction a query runs in, or
+// change the session so the next one isn't read-only.
+var readOnlyStatements = map[string]bool{
+	"begin": true, "start": true, "commit": true, "end": true, "rollback": true, "abort": true,
+	"savepoint": true, "release": true, "set": true, "reset": true, "xa": true,
+}
+
+// readOnlyStatement checks a query for a read-only Postgres or MySQL
+// database and returns its single statement, without comments. The query
+// runs inside a read-only transaction, so a second statement (which could
+// run after a COMMIT) and statements controlling the transaction or the
+// session are refused.
+func readOnlyStatement(engine, query string) (string, error) {
+	statements, err := splitSQL(engine, query)
+	if err != nil {
+		return "", err
+	}
+	switch len(statements) {
+	case 0:
+		return "", errors.New("query is required")
+	case 1:
+	default:
+		return "", errors.New("only one statement per query is allowed on a read-only database")
+	}
+	statement := statements[0]
+	words := strings.FieldsFunc(statement, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z')
+	})
+	if len(words) > 0 && readOnlyStatements[strings.ToLower(words[0])] {
+		return "", fmt.Errorf("%s statements are not allowed on a read-only database", strings.ToUpper(words[0]))
+	}
+	return statement, nil
+}
+
+// splitSQL splits a query into its statements, dropping comments and empty
+// statements. It follows the engine's quoting: strings, quoted identifiers,
+// Postgres dollar quotes and E'...' strings, MySQL backticks and #
+// comments. MySQL's /*! comments are code the server runs, so they are
+// refused.
+func splitSQL(engine, query string) ([]string, error) {
+	var statements []string
+	var sb strings.Builder
+	flush := func() {
+		if s := strings.TrimSpace(sb.String()); s != "" {
+			statements = append(statements, s)
+		}
+		sb.Reset()
+	}
+	mysql := engine == sqlMySQL
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == ';':
+			flush()
+
+		case c == '\'' || c == '"' || c == '`' && mysql:
+			// E'' strings take backslash escapes (MySQL queries can't
+			// contain backslashes at all)
+			escapes := !mysql && c == '\'' && i > 0 && (query[i-1] == 'E' || query[i-1] == 'e') &&
+				(i == 1 || !isSQLIdentByte(query[i-2]))
+			end := i + 1
+			for ; end < len(query); end++ {
+				if escapes && query[end] == '\\' {
+					end++
+					continue
+				}
+				if query[end] == c {
+					if end+1 < len(query) && query[end+1] == c {
+						end++
+						continue
+					}
+					break
+				}
+			}
+			if end >= len(query) {
+				return nil, errors.New("the query has an unterminated quote")
+			}
+			sb.WriteString(query[i : end+1])
+			i = end
+
+		case c == '$' && !mysql && (i == 0 || !isSQLIdentByte(query[i-1])):
+			tagEnd := i + 1
+			for tagEnd < len(query) && isSQLIdentByte(query[tagEnd]) && query[tagEnd] != '$' {
+				tagEnd++
+			}
+			if tagEnd == len(query) || query[tagEnd] != '$' || tagEnd > i+1 && query[i+1] >= '0' && query[i+1] <= '9' {
+				sb.WriteByte(c) // a $1 parameter
+				continue
+			}
+			tag := query[i : tagEnd+1]
+			end := strings.Index(query[tagEnd+1:], tag)
+			if end < 0 {
+				return nil, errors.New("the query has an unterminated dollar quote")
+			}
+			end += tagEnd + 1 + len(tag)
+			sb.WriteString(query[i:end])
+			i = end - 1
+
+		case c == '-' && strings.HasPrefix(query[i:], "--") && (!mysql || i+2 == len(query) || query[i+2] <= ' '),
+			c == '#' && mysql:
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+			sb.WriteByte('\n')
+
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			if mysql && (strings.HasPrefix(query[i:], "/*!") || strings.HasPrefix(query[i:], "/*M!")) {
+				return nil, errors.New("MySQL executable comments (/*! ... */) are not allowed")
+			}
+			depth, closed := 0, false
+			for i < len(query) && !closed {
+				switch {
+				case strings.HasPrefix(query[i:], "/*"):
+					depth++
+					i += 2
+				case strings.HasPrefix(query[i:], "*/"):
+					// Postgres comments nest, MySQL ones don't
+					depth--
+					closed = depth == 0 || mysql
+					i += 2
+				default:
+					i++
+				}
+			}
+			if !closed {
+				return nil, errors.New("the query has an unterminated comment")
+			}
+			i--
+			sb.WriteByte(' ')
+
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	flush()
+	return statements, nil
+}
+
+func isSQLIdentByte(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
@@ -0,0 +1,186 @@
+package tools
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestDatabase creates an SQLite file in dir, skipping without sqlite3
+func newTestDatabase(t *testing.T, dir string) string {
+	t.Helper()
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 is not installed")
+	}
+	path := filepath.Join(dir, "shop.db")
+	setup := `CREATE TABLE orders (id INTEGER PRIMARY KEY, customer TEXT NOT NULL, note TEXT, total REAL);
+INSERT INTO orders (customer, note, total) VALUES ('ann', 'gift|wrap', 12.5), ('bob', NULL, 3), ('cy', 'line one
+line two', 7.25);
+CREATE VIEW big_orders AS SELECT * FROM orders WHERE total > 5;`
+	if out, err := exec.Command("sqlite3", path, setup).CombinedOutput(); err != nil {
+		t.Fatalf("Failed to create the database: %v: %s", err, out)
+	}
+	return path
+}
+
+// TestSQLToolQuery verifies rows come back as a markdown table with NULLs
+// shown and cells kept on one line
+func TestSQLToolQuery(t *testing.T) {
+	dir := t.TempDir()
+	newTestDatabase(t, dir)
+	tool := NewSQLTool(dir, true, nil, 0, 0)
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"database": "shop.db",
+		"query":    "SELECT customer, note, total FROM orders ORDER BY id",
+	})
+	if result.IsError {
+		t.Fatalf("Expected rows, got %q", result.ForLLM)
+	}
+	want := "| customer | note | total |\n| --- | --- | --- |\n| ann | gift\\|wrap | 12.5 |\n| bob | NULL | 3.0 |\n| cy | line one line two | 7.25 |\n\n(3 rows)"
+	if result.ForLLM != want {
+		t.Errorf("Expected\n%s\ngot\n%s", want, result.ForLLM)
+	}
+
+	result = tool.Execute(context.Background(), map[string]interface{}{
+		"database": "shop.db",
+		"query":    "SELECT id FROM orders ORDER BY id",
+		"limit":    float64(2),
+	})
+	if !strings.Contains(result.ForLLM, "| 2 |") || strings.Contains(result.ForLLM, "| 3 |") || !strings.Contains(result.ForLLM, "there are more") {
+		t.Errorf("Expected two rows and a note about the rest, got %q", result.ForLLM)
+	}
+
+	result = tool.Execute(context.Background(), map[string]interface{}{"database": "shop.db", "query": "SELECT * FROM missing"})
+	if !result.IsError || !strings.Contains(result.ForLLM, "no such table") {
+		t.Errorf("Expected sqlite's error, got %q", result.ForLLM)
+	}
+}
+
+// TestSQLToolReadOnly verifies files opened by path can't be changed,
+// configured databases only when writable, and client commands are refused
+func TestSQLToolReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	path := newTestDatabase(t, dir)
+	tool := NewSQLTool(dir, true, []SQLDatabase{{Name: "shop", DSN: path, Writable: true}}, 0, 0)
+	ctx := context.Background()
+
+	result := tool.Execute(ctx, map[string]interface{}{"database": "shop.db", "query": "DELETE FROM orders"})
+	if !result.IsError || !strings.Contains(result.ForLLM, "read-only") {
+		t.Errorf("Expected the write refused, got %q", result.ForLLM)
+	}
+
+	result = tool.Execute(ctx, map[string]interface{}{"database": "shop", "query": "DELETE FROM orders WHERE customer = 'bob'"})
+	if result.IsError || !strings.Contains(result.ForLLM, "no rows") {
+		t.Errorf("Expected the writable database changed, got %q", result.ForLLM)
+	}
+	result = tool.Execute(ctx, map[string]interface{}{"database": "shop", "query": "SELECT count(*) AS n FROM orders"})
+	if !strings.Contains(result.ForLLM, "| 2 |") {
+		t.Errorf("Expected two orders left, got %q", result.ForLLM)
+	}
+
+	for _, query := range []string{".shell echo hi", "ATTACH DATABASE 'other.db' AS o"} {
+		if result := tool.Execute(ctx, map[string]interface{}{"database": "shop", "query": query}); !result.IsError {
+			t.Errorf("Expected %q refused, got %q", query, result.ForLLM)
+		}
+	}
+	if result := tool.Execute(ctx, map[string]interface{}{"database": "../outside.db", "query": "SELECT 1"}); !result.IsError {
+		t.Errorf("Expected a file outside the workspace refused, got %q", result.ForLLM)
+	}
+}
+
+// TestSQLToolSchema verifies tables and views are listed with their
+// columns
+func TestSQLToolSchema(t *testing.T) {
+	dir := t.TempDir()
+	newTestDatabase(t, dir)
+	tool := NewSQLTool(dir, true, nil, 0, time.Minute)
+
+	result := tool.Execute(context.Background(), map[string]interface{}{"database": "shop.db", "action": "schema"})
+	want := "big_orders (id INTEGER, customer TEXT, note TEXT, total REAL)\n" +
+		"orders (id INTEGER primary key, customer TEXT not null, note TEXT, total REAL)"
+	if result.ForLLM != want {
+		t.Errorf("Expected\n%s\ngot\n%s", want, result.ForLLM)
+	}
+
+	result = tool.Execute(context.Background(), map[string]interface{}{"database": "shop.db", "action": "schema", "table": "nope"})
+	if !result.IsError {
+		t.Errorf("Expected an unknown table to fail, got %q", result.ForLLM)
+	}
+}
+
+// TestCheckSQLClientCommands verifies client commands are refused for
+// each engine
+func TestCheckSQLClientCommands(t *testing.T) {
+	cases := []struct {
+		engine, query string
+		ok            bool
+	}{
+		{sqlSQLite, "SELECT '.x'", true},
+		{sqlSQLite, "  .tables", false},
+		{sqlPostgres, `\! ls`, false},
+		{sqlPostgres, `SELECT E'a\nb'`, true},
+		{sqlMySQL, "SELECT 1", true},
+		{sqlMySQL, "SELECT 1;\nsystem ls", false},
+		{sqlMySQL, `SELECT 1 \! ls`, false},
+	}
+	for _, c := range cases {
+		if err := checkSQLClientCommands(c.engine, c.query); (err == nil) != c.ok {
+			t.Errorf("%s %q: expected ok=%v, got %v", c.engine, c.query, c.ok, err)
+		}
+	}
+}
+
+// TestReadOnlyStatement verifies read-only server databases get a single
+// statement that can't end or reconfigure its read-only transaction
+func TestReadOnlyStatement(t *testing.T) {
+	cases := []struct {
+		engine, query, want string // want is empty when refused
+	}{
+		{sqlPostgres, "SELECT ';' AS semi;", "SELECT ';' AS semi"},
+		{sqlPostgres, "SELECT $$a; b$$, $tag$ ; $tag$ -- trailing; comment\n;", "SELECT $$a; b$$, $tag$ ; $tag$"},
+		{sqlPostgres, "/* a /* nested ; */ comment */ SELECT 1", "SELECT 1"},
+		{sqlPostgres, `SELECT E'\'; DELETE FROM t; --'`, `SELECT E'\'; DELETE FROM t; --'`},
+		{sqlPostgres, "SELECT $1::int", "SELECT $1::int"},
+		{sqlMySQL, "SELECT `a;b` FROM t # note;", "SELECT `a;b` FROM t"},
+		{sqlPostgres, "BEGIN READ WRITE; DELETE FROM orders; COMMIT;", ""},
+		{sqlPostgres, "SET default_transaction_read_only=off", ""},
+		{sqlPostgres, "/* hi */ commit", ""},
+		{sqlPostgres, "SELECT 1; DELETE FROM orders", ""},
+		{sqlPostgres, "SELECT 'unterminated", ""},
+		{sqlMySQL, "SET SESSION TRANSACTION READ WRITE; DELETE FROM orders", ""},
+		{sqlMySQL, "START TRANSACTION", ""},
+		{sqlMySQL, "SELECT 1 --x\n; DELETE FROM orders", ""},
+		{sqlMySQL, "SELECT 1 /*!50000 ; SET autocommit=1 */", ""},
+	}
+	for _, c := range cases {
+		got, err := readOnlyStatement(c.engine, c.query)
+		if c.want == "" && err == nil {
+			t.Errorf("%s %q: expected it refused, got %q", c.engine, c.query, got)
+		}
+		if c.want != "" && (err != nil || got != c.want) {
+			t.Errorf("%s %q: expected %q, got %q %v", c.engine, c.query, c.want, got, err)
+		}
+	}
+
+	tool := NewSQLTool(t.TempDir(), true, []SQLDatabase{{Name: "shop", DSN: "postgres://app:secret@db/shop"}}, 0, 0)
+	result := tool.Execute(context.Background(), map[string]interface{}{"database": "shop", "query": "BEGIN READ WRITE; DELETE FROM orders; COMMIT;"})
+	if !result.IsError || !strings.Contains(result.ForLLM, "one statement") {
+		t.Errorf("Expected the bypass refused, got %q", result.ForLLM)
+	}
+}
+
+// TestPostgresCredentials verifies the password is taken out of the URL
+func TestPostgresCredentials(t *testing.T) {
+	dsn, password, err := postgresCredentials("postgres://app:s%40cret@db:5432/shop?sslmode=require")
+	if err != nil || dsn != "postgres://app@db:5432/shop?sslmode=require" || password != "s@cret" {
+		t.Errorf("Unexpected %q %q %v", dsn, password, err)
+	}
+	dsn, password, _ = postgresCredentials("postgres://db/shop?password=pw&user=app")
+	if dsn != "postgres://db/shop?user=app" || password != "pw" {
+		t.Errorf("Unexpected %q %q", dsn, password)
+	}
+}
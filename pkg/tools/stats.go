@@ -0,0 +1,57 @@
+package tools
+
+import (
+	"sort"
+	"time"
+)
+
+// ToolStats summarizes the calls made to a tool since startup.
+type ToolStats struct {
+	Name      string
+	Calls     int
+	Errors    int
+	TotalTime time.Duration
+}
+
+// AvgLatency returns the mean duration of a call.
+func (s ToolStats) AvgLatency() time.Duration {
+	if s.Calls == 0 {
+		return 0
+	}
+	return s.TotalTime / time.Duration(s.Calls)
+}
+
+// recordCall updates the statistics of the named tool.
+func (r *ToolRegistry) recordCall(name string, duration time.Duration, failed bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.tools[name]
+	if !ok {
+		return
+	}
+	entry.stats.Calls++
+	entry.stats.TotalTime += duration
+	if failed {
+		entry.stats.Errors++
+	}
+}
+
+// Stats returns the statistics of every tool that has been called, sorted
+// by name.
+func (r *ToolRegistry) Stats() []ToolStats {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	stats := make([]ToolStats, 0, len(r.tools))
+	for name, entry := range r.tools {
+		if entry.stats.Calls == 0 {
+			continue
+		}
+		s := entry.stats
+		s.Name = name
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
@@ -3,6 +3,7 @@ package tools
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -31,6 +32,8 @@ type SubagentManager struct {
 	tools         *ToolRegistry
 	maxIterations int
 	nextID        int
+	slots         chan struct{} // bounds concurrently running subagents; nil means unlimited
+	capabilities  *providers.CapabilityResolver
 }
 
 func NewSubagentManager(provider providers.LLMProvider, defaultModel, workspace string, bus *bus.MessageBus) *SubagentManager {
@@ -54,11 +57,56 @@ func (sm *SubagentManager) SetTools(tools *ToolRegistry) {
 	sm.tools = tools
 }
 
-// RegisterTool registers a tool for subagent execution.
-func (sm *SubagentManager) RegisterTool(tool Tool) {
+// SetDefaultModel sets the model subagents started from now on use.
+func (sm *SubagentManager) SetDefaultModel(model string) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
-	sm.tools.Register(tool)
+	sm.defaultModel = model
+}
+
+// SetCapabilities sets the model capability lookup, so subagents degrade
+// like the main agent on models without tool calling.
+func (sm *SubagentManager) SetCapabilities(capabilities *providers.CapabilityResolver) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.capabilities = capabilities
+}
+
+// SetMaxConcurrent limits how many subagents run at once. Extra tasks wait
+// for a free slot. n <= 0 removes the limit.
+func (sm *SubagentManager) SetMaxConcurrent(n int) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if n <= 0 {
+		sm.slots = nil
+		return
+	}
+	sm.slots = make(chan struct{}, n)
+}
+
+// acquireSlot blocks until a subagent may run. It returns a release func,
+// or false if ctx is done first.
+func (sm *SubagentManager) acquireSlot(ctx context.Context) (func(), bool) {
+	sm.mu.RLock()
+	slots := sm.slots
+	sm.mu.RUnlock()
+	if slots == nil {
+		return func() {}, true
+	}
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, true
+	case <-ctx.Done():
+		return nil, false
+	}
+}
+
+// RegisterTool registers a tool for subagent execution. It fails if the
+// name is invalid.
+func (sm *SubagentManager) RegisterTool(tool Tool) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return sm.tools.Register(tool)
 }
 
 func (sm *SubagentManager) Spawn(ctx context.Context, task, label, originChannel, originChatID string, callback AsyncCallback) (string, error) {
@@ -119,16 +167,29 @@ After completing the task, provide a clear summary of what was done.`
 	default:
 	}
 
+	release, ok := sm.acquireSlot(ctx)
+	if !ok {
+		sm.mu.Lock()
+		task.Status = "cancelled"
+		task.Result = "Task cancelled while waiting for a free slot"
+		sm.mu.Unlock()
+		return
+	}
+	defer release()
+
 	// Run tool loop with access to tools
 	sm.mu.RLock()
 	tools := sm.tools
+	model := sm.defaultModel
 	maxIter := sm.maxIterations
+	capabilities := sm.capabilities
 	sm.mu.RUnlock()
 
 	loopResult, err := RunToolLoop(ctx, ToolLoopConfig{
 		Provider:      sm.provider,
-		Model:         sm.defaultModel,
+		Model:         model,
 		Tools:         tools,
+		Capabilities:  capabilities,
 		MaxIterations: maxIter,
 		LLMOptions: map[string]any{
 			"max_tokens":  4096,
@@ -205,6 +266,22 @@ func (sm *SubagentManager) ListTasks() []*SubagentTask {
 	return tasks
 }
 
+// RunningTasks returns copies of the tasks that haven't finished, oldest
+// first.
+func (sm *SubagentManager) RunningTasks() []SubagentTask {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	var running []SubagentTask
+	for _, task := range sm.tasks {
+		if task.Status == "running" {
+			running = append(running, *task)
+		}
+	}
+	sort.Slice(running, func(i, j int) bool { return running[i].Created < running[j].Created })
+	return running
+}
+
 // SubagentTool executes a subagent task synchronously and returns the result.
 // Unlike SpawnTool which runs tasks asynchronously, SubagentTool waits for completion
 // and returns the result directly in the ToolResult.
@@ -278,15 +355,24 @@ func (t *SubagentTool) Execute(ctx context.Context, args map[string]interface{})
 
 	// Use RunToolLoop to execute with tools (same as async SpawnTool)
 	sm := t.manager
+	release, ok := sm.acquireSlot(ctx)
+	if !ok {
+		return ErrorResult("Subagent cancelled while waiting for a free slot").WithError(ctx.Err())
+	}
+	defer release()
+
 	sm.mu.RLock()
 	tools := sm.tools
+	model := sm.defaultModel
 	maxIter := sm.maxIterations
+	capabilities := sm.capabilities
 	sm.mu.RUnlock()
 
 	loopResult, err := RunToolLoop(ctx, ToolLoopConfig{
 		Provider:      sm.provider,
-		Model:         sm.defaultModel,
+		Model:         model,
 		Tools:         tools,
+		Capabilities:  capabilities,
 		MaxIterations: maxIter,
 		LLMOptions: map[string]any{
 			"max_tokens":  4096,
@@ -0,0 +1,79 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+)
+
+type sessionKeyKey struct{}
+
+// WithSessionKey returns a context carrying the key of the session the tool
+// call belongs to.
+func WithSessionKey(ctx context.Context, sessionKey string) context.Context {
+	return context.WithValue(ctx, sessionKeyKey{}, sessionKey)
+}
+
+// SessionKeyFromContext returns the session key set by WithSessionKey, or "".
+func SessionKeyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(sessionKeyKey{}).(string)
+	return key
+}
+
+// SessionCompactor summarizes the history of a session in place, keeping
+// the pinned facts verbatim. It returns the number of messages folded into
+// the summary.
+type SessionCompactor func(ctx context.Context, sessionKey string, pinned []string) (int, error)
+
+// SummarizeSessionTool lets the model compress its own context mid-task,
+// which keeps small-context models on track during long tool sequences.
+type SummarizeSessionTool struct {
+	compact SessionCompactor
+}
+
+func NewSummarizeSessionTool(compact SessionCompactor) *SummarizeSessionTool {
+	return &SummarizeSessionTool{compact: compact}
+}
+
+func (t *SummarizeSessionTool) Name() string {
+	return "summarize_session"
+}
+
+func (t *SummarizeSessionTool) Description() string {
+	return "Compress the conversation so far into a summary to free up context space. Use it during long tasks when earlier tool output is no longer needed verbatim. Put anything you must not lose (file paths, IDs, decisions, constraints) in `pinned`; pinned facts are kept word for word in every later turn."
+}
+
+func (t *SummarizeSessionTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"pinned": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Facts to keep verbatim, one per item",
+			},
+		},
+	}
+}
+
+func (t *SummarizeSessionTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	sessionKey := SessionKeyFromContext(ctx)
+	if sessionKey == "" {
+		return ErrorResult("no session to summarize")
+	}
+
+	var pinned []string
+	if items, ok := args["pinned"].([]interface{}); ok {
+		for _, item := range items {
+			if s, ok := item.(string); ok && s != "" {
+				pinned = append(pinned, s)
+			}
+		}
+	}
+
+	folded, err := t.compact(ctx, sessionKey, pinned)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to summarize session: %v", err)).WithError(err)
+	}
+
+	return SilentResult(fmt.Sprintf("Context compacted: %d earlier messages replaced by a summary, %d facts pinned. The summary and pinned facts are in the system prompt; continue the task.", folded, len(pinned)))
+}
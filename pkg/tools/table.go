@@ -0,0 +1,774 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultTableRows = 20
+	maxTableRows     = 200
+	tablePreviewRows = 5
+	// tableTypeSample is how many rows column types are guessed from.
+	tableTypeSample = 1000
+	// maxTableGroups bounds the groups of an aggregation.
+	maxTableGroups = 100000
+	// maxTableDistinct bounds the values counted per column for stats.
+	maxTableDistinct = 10000
+)
+
+// TableTool answers questions about CSV, TSV and XLSX files without the
+// model reading them: it filters, sorts, groups and summarizes the rows as
+// it streams through the file and returns only a small table, so even a
+// file of hundreds of megabytes costs a few hundred tokens.
+type TableTool struct {
+	pathScope
+}
+
+func NewTableTool(workspace string, restrict bool) *TableTool {
+	return &TableTool{pathScope: pathScope{workspace: workspace, restrict: restrict}}
+}
+
+func (t *TableTool) Name() string {
+	return "table"
+}
+
+func (t *TableTool) Description() string {
+	return "Analyze a CSV, TSV or XLSX file without reading it into the conversation. " +
+		"action=info shows the columns, their types, the row count and the first rows; " +
+		"query returns the rows matching a filter; aggregate groups rows and computes count, sum, avg, min and max; " +
+		"stats summarizes each column. Filters look like: price > 10 and (city == \"Paris\" or name contains \"bio\"). " +
+		"Use this instead of read_file for data files."
+}
+
+func (t *TableTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "Path to the .csv, .tsv or .xlsx file",
+			},
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"info", "query", "aggregate", "stats"},
+				"description": "info (default), query, aggregate or stats",
+			},
+			"filter": map[string]interface{}{
+				"type":        "string",
+				"description": "Only rows matching this, e.g. `units >= 5 and region != \"north\"`. Operators: == != < <= > >= contains startswith endswith and or not; quote text, `backquote` column names with spaces",
+			},
+			"columns": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "For query, the columns to show; for stats, the columns to summarize (default: all)",
+			},
+			"group_by": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "For aggregate, the columns to group by (none for one total row)",
+			},
+			"aggregates": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": `For aggregate, e.g. ["count", "sum(units)", "avg(price)", "min(date)", "max(price)"] (default: count)`,
+			},
+			"sort": map[string]interface{}{
+				"type":        "string",
+				"description": `Columns to sort by, "-" for descending, e.g. "-total" or "region, -units". For aggregate, output columns such as "-sum(units)" work too`,
+			},
+			"limit": map[string]interface{}{
+				"type":        "integer",
+				"description": fmt.Sprintf("Most rows to return (default %d, max %d)", defaultTableRows, maxTableRows),
+			},
+			"sheet": map[string]interface{}{
+				"type":        "string",
+				"description": "For XLSX, the sheet to read (default: the first)",
+			},
+		},
+		"required": []string{"path"},
+	}
+}
+
+func (t *TableTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	path, _ := args["path"].(string)
+	if path == "" {
+		return ErrorResult("path is required")
+	}
+	resolved, err := t.resolvePath(path)
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+	sheet, _ := args["sheet"].(string)
+	table, err := openTable(resolved, sheet)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to open %s: %v", path, err))
+	}
+	defer table.Close()
+
+	var filter tableFilter
+	if expr, _ := args["filter"].(string); strings.TrimSpace(expr) != "" {
+		if filter, err = parseTableFilter(expr, table.columns); err != nil {
+			return ErrorResult(err.Error())
+		}
+	}
+	limit := defaultTableRows
+	if v, ok := args["limit"].(float64); ok && v >= 1 {
+		limit = min(int(v), maxTableRows)
+	}
+	sortSpec, _ := args["sort"].(string)
+
+	action, _ := args["action"].(string)
+	var result *ToolResult
+	switch action {
+	case "", "info":
+		result, err = tableInfo(ctx, table, filepath.Base(path))
+	case "query":
+		result, err = tableQuery(ctx, table, filter, stringList(args["columns"]), sortSpec, limit)
+	case "aggregate":
+		aggregates := stringList(args["aggregates"])
+		if _, ok := args["limit"]; !ok {
+			limit = maxTableRows
+		}
+		result, err = tableAggregate(ctx, table, filter, stringList(args["group_by"]), aggregates, sortSpec, limit)
+	case "stats":
+		result, err = tableStats(ctx, table, filter, stringList(args["columns"]))
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action %q: use info, query, aggregate or stats", action))
+	}
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+	return result
+}
+
+// tableFile streams the rows of a data file after its header.
+type tableFile struct {
+	columns []string
+	format  string
+	sheets  []string
+	next    func() ([]string, error)
+	close   func() error
+}
+
+func (t *tableFile) Close() error {
+	return t.close()
+}
+
+// openTable opens a CSV, TSV or XLSX file and reads its header row.
+func openTable(path, sheet string) (*tableFile, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	table := &tableFile{}
+	if ext == ".xlsx" || ext == ".xlsm" {
+		x, err := openXLSX(path, sheet)
+		if err != nil {
+			return nil, err
+		}
+		table.format, table.sheets, table.next, table.close = "XLSX", x.Sheets(), x.Next, x.Close
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		br := bufio.NewReaderSize(f, 64*1024)
+		if bom, _ := br.Peek(3); bytes.Equal(bom, []byte{0xEF, 0xBB, 0xBF}) {
+			br.Discard(3)
+		}
+		r := csv.NewReader(br)
+		r.FieldsPerRecord = -1
+		r.LazyQuotes = true
+		r.ReuseRecord = false
+		table.format = "CSV"
+		if ext == ".tsv" || ext == ".tab" {
+			r.Comma, table.format = '\t', "TSV"
+		} else {
+			sample, _ := br.Peek(64 * 1024)
+			r.Comma = sniffDelimiter(sample)
+		}
+		table.next, table.close = r.Read, f.Close
+	}
+
+	header, err := table.next()
+	if err == io.EOF {
+		table.Close()
+		return nil, fmt.Errorf("the file is empty")
+	}
+	if err != nil {
+		table.Close()
+		return nil, err
+	}
+	table.columns = tableHeader(header)
+	return table, nil
+}
+
+// sniffDelimiter picks the separator the first line uses most: comma,
+// semicolon (common where the comma is the decimal mark) or tab.
+func sniffDelimiter(sample []byte) rune {
+	line := sample
+	if i := bytes.IndexByte(sample, '\n'); i >= 0 {
+		line = sample[:i]
+	}
+	best, count := ',', bytes.Count(line, []byte{','})
+	for _, d := range []rune{';', '\t', '|'} {
+		if n := bytes.Count(line, []byte(string(d))); n > count {
+			best, count = d, n
+		}
+	}
+	return best
+}
+
+// tableHeader names blank columns and makes names unique.
+func tableHeader(header []string) []string {
+	columns := make([]string, len(header))
+	seen := make(map[string]int)
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			name = fmt.Sprintf("column_%d", i+1)
+		}
+		if n := seen[strings.ToLower(name)]; n > 0 {
+			seen[strings.ToLower(name)]++
+			name = fmt.Sprintf("%s_%d", name, n+1)
+		}
+		seen[strings.ToLower(name)]++
+		columns[i] = name
+	}
+	return columns
+}
+
+// scan calls row for every data row until it returns false, checking ctx
+// now and then so a huge file can be cancelled.
+func (t *tableFile) scan(ctx context.Context, row func([]string) bool) error {
+	for n := 0; ; n++ {
+		if n%10000 == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		record, err := t.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("row %d: %w", n+2, err)
+		}
+		if !row(record) {
+			return nil
+		}
+	}
+}
+
+// resolveColumns finds names among the table's columns.
+func (t *tableFile) resolveColumns(names []string) ([]int, error) {
+	indexes := make([]int, len(names))
+	for i, name := range names {
+		if indexes[i] = tableColumn(t.columns, name); indexes[i] < 0 {
+			return nil, fmt.Errorf("unknown column %q; columns: %s", name, strings.Join(t.columns, ", "))
+		}
+	}
+	return indexes, nil
+}
+
+func tableInfo(ctx context.Context, table *tableFile, name string) (*ToolResult, error) {
+	var preview [][]string
+	types := make([]tableColumnType, len(table.columns))
+	rows := 0
+	err := table.scan(ctx, func(row []string) bool {
+		if rows < tablePreviewRows {
+			preview = append(preview, row)
+		}
+		if rows < tableTypeSample {
+			for i := range types {
+				types[i].add(cellAt(row, i))
+			}
+		}
+		rows++
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	described := make([]string, len(table.columns))
+	for i, c := range table.columns {
+		described[i] = fmt.Sprintf("%s (%s)", c, types[i].String())
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s (%s): %d rows, %d columns\n", name, table.format, rows, len(table.columns))
+	fmt.Fprintf(&sb, "Columns: %s\n", strings.Join(described, ", "))
+	if len(table.sheets) > 1 {
+		fmt.Fprintf(&sb, "Sheets: %s\n", strings.Join(table.sheets, ", "))
+	}
+	if len(preview) > 0 {
+		fmt.Fprintf(&sb, "\nFirst %d rows:\n%s", len(preview), markdownTable(table.columns, preview))
+	}
+	return NewToolResult(strings.TrimRight(sb.String(), "\n")).WithData(map[string]interface{}{
+		"rows":    rows,
+		"columns": table.columns,
+	}), nil
+}
+
+// tableColumnType guesses a column's type from its values.
+type tableColumnType struct {
+	values, numbers int
+}
+
+func (c *tableColumnType) add(v string) {
+	if strings.TrimSpace(v) == "" {
+		return
+	}
+	c.values++
+	if _, ok := tableNumber(v); ok {
+		c.numbers++
+	}
+}
+
+func (c tableColumnType) String() string {
+	switch {
+	case c.values == 0:
+		return "empty"
+	case c.numbers == c.values:
+		return "number"
+	}
+	return "text"
+}
+
+func cellAt(row []string, i int) string {
+	if i < len(row) {
+		return row[i]
+	}
+	return ""
+}
+
+// tableSortKey is a column to sort by.
+type tableSortKey struct {
+	column int
+	desc   bool
+}
+
+// parseTableSort reads "a, -b" or "b desc" against columns.
+func parseTableSort(spec string, columns []string) ([]tableSortKey, error) {
+	var keys []tableSortKey
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key := tableSortKey{}
+		if strings.HasPrefix(part, "-") {
+			key.desc, part = true, strings.TrimSpace(part[1:])
+		} else if lower := strings.ToLower(part); strings.HasSuffix(lower, " desc") {
+			key.desc, part = true, strings.TrimSpace(part[:len(part)-5])
+		} else if strings.HasSuffix(lower, " asc") {
+			part = strings.TrimSpace(part[:len(part)-4])
+		}
+		if key.column = tableColumn(columns, strings.Trim(part, "`")); key.column < 0 {
+			return nil, fmt.Errorf("unknown sort column %q; columns: %s", part, strings.Join(columns, ", "))
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func sortTableRows(rows [][]string, keys []tableSortKey) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, k := range keys {
+			c := compareTableValues(cellAt(rows[i], k.column), cellAt(rows[j], k.column))
+			if c != 0 {
+				return (c < 0) != k.desc
+			}
+		}
+		return false
+	})
+}
+
+func tableQuery(ctx context.Context, table *tableFile, filter tableFilter, columns []string, sortSpec string, limit int) (*ToolResult, error) {
+	keys, err := parseTableSort(sortSpec, table.columns)
+	if err != nil {
+		return nil, err
+	}
+	selected := make([]int, len(table.columns))
+	for i := range selected {
+		selected[i] = i
+	}
+	if len(columns) > 0 {
+		if selected, err = table.resolveColumns(columns); err != nil {
+			return nil, err
+		}
+	}
+
+	var rows [][]string
+	matched, total := 0, 0
+	err = table.scan(ctx, func(row []string) bool {
+		total++
+		if filter != nil && !filter.match(row) {
+			return true
+		}
+		matched++
+		if len(keys) == 0 {
+			if len(rows) < limit {
+				rows = append(rows, row)
+			}
+			return true
+		}
+		// Keep the best rows only, so sorting a huge file stays small
+		rows = append(rows, row)
+		if len(rows) >= 2*limit+1000 {
+			sortTableRows(rows, keys)
+			rows = rows[:limit]
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortTableRows(rows, keys)
+	if len(rows) > limit {
+		rows = rows[:limit]
+	}
+
+	names := make([]string, len(selected))
+	for i, c := range selected {
+		names[i] = table.columns[c]
+	}
+	out := make([][]string, len(rows))
+	for i, row := range rows {
+		out[i] = make([]string, len(selected))
+		for j, c := range selected {
+			out[i][j] = cellAt(row, c)
+		}
+	}
+
+	data := map[string]interface{}{"columns": names, "rows": out, "matched": matched, "total": total}
+	if matched == 0 {
+		return NewToolResult(fmt.Sprintf("No rows match the filter (%d rows in the file).", total)).WithData(data), nil
+	}
+	summary := fmt.Sprintf("%d of %d rows match", matched, total)
+	if filter == nil {
+		summary = fmt.Sprintf("%d rows", total)
+	}
+	if len(out) < matched {
+		summary += fmt.Sprintf("; showing %d", len(out))
+	}
+	return NewToolResult(summary + ":\n" + markdownTable(names, out)).WithData(data), nil
+}
+
+// tableAggregateSpec is one aggregate such as sum(units).
+type tableAggregateSpec struct {
+	name   string // as shown, e.g. "sum(units)"
+	fn     string // count, sum, avg, min or max
+	column int    // -1 for count
+}
+
+type tableAccumulator struct {
+	sum      float64
+	numbers  int
+	min, max string
+	seen     bool
+}
+
+type tableGroup struct {
+	key   []string
+	count int
+	accs  []tableAccumulator
+}
+
+func parseTableAggregates(specs []string, columns []string) ([]tableAggregateSpec, error) {
+	if len(specs) == 0 {
+		specs = []string{"count"}
+	}
+	var out []tableAggregateSpec
+	for _, spec := range specs {
+		fn, arg, hasArg := strings.Cut(strings.TrimSpace(spec), "(")
+		fn = strings.ToLower(strings.TrimSpace(fn))
+		arg = strings.Trim(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(arg), ")")), "`")
+		if fn == "mean" || fn == "average" {
+			fn = "avg"
+		}
+		switch {
+		case fn == "count" && (!hasArg || arg == "" || arg == "*"):
+			out = append(out, tableAggregateSpec{name: "count", fn: "count", column: -1})
+			continue
+		case fn != "count" && fn != "sum" && fn != "avg" && fn != "min" && fn != "max":
+			return nil, fmt.Errorf("unknown aggregate %q: use count, sum(col), avg(col), min(col) or max(col)", spec)
+		case !hasArg || arg == "":
+			return nil, fmt.Errorf("aggregate %q needs a column, e.g. %s(price)", spec, fn)
+		}
+		column := tableColumn(columns, arg)
+		if column < 0 {
+			return nil, fmt.Errorf("unknown column %q in %q; columns: %s", arg, spec, strings.Join(columns, ", "))
+		}
+		out = append(out, tableAggregateSpec{name: fmt.Sprintf("%s(%s)", fn, columns[column]), fn: fn, column: column})
+	}
+	return out, nil
+}
+
+func tableAggregate(ctx context.Context, table *tableFile, filter tableFilter, groupBy, aggregates []string, sortSpec string, limit int) (*ToolResult, error) {
+	groupCols, err := table.resolveColumns(groupBy)
+	if err != nil {
+		return nil, err
+	}
+	specs, err := parseTableAggregates(aggregates, table.columns)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string]*tableGroup)
+	var order []*tableGroup
+	matched := 0
+	err = table.scan(ctx, func(row []string) bool {
+		if filter != nil && !filter.match(row) {
+			return true
+		}
+		matched++
+		key := make([]string, len(groupCols))
+		for i, c := range groupCols {
+			key[i] = cellAt(row, c)
+		}
+		id := strings.Join(key, "\x00")
+		g, ok := groups[id]
+		if !ok {
+			if len(groups) == maxTableGroups {
+				err = fmt.Errorf("more than %d groups; group by fewer or coarser columns", maxTableGroups)
+				return false
+			}
+			g = &tableGroup{key: key, accs: make([]tableAccumulator, len(specs))}
+			groups[id] = g
+			order = append(order, g)
+		}
+		g.count++
+		for i, spec := range specs {
+			if spec.column < 0 {
+				continue
+			}
+			v := cellAt(row, spec.column)
+			if strings.TrimSpace(v) == "" {
+				continue
+			}
+			acc := &g.accs[i]
+			if f, ok := tableNumber(v); ok {
+				acc.sum += f
+				acc.numbers++
+			}
+			if !acc.seen || compareTableValues(v, acc.min) < 0 {
+				acc.min = v
+			}
+			if !acc.seen || compareTableValues(v, acc.max) > 0 {
+				acc.max = v
+			}
+			acc.seen = true
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(groupCols)+len(specs))
+	for _, c := range groupCols {
+		names = append(names, table.columns[c])
+	}
+	for _, spec := range specs {
+		names = append(names, spec.name)
+	}
+	rows := make([][]string, 0, len(order))
+	for _, g := range order {
+		row := append([]string(nil), g.key...)
+		for i, spec := range specs {
+			acc := g.accs[i]
+			switch spec.fn {
+			case "count":
+				if spec.column < 0 {
+					row = append(row, strconv.Itoa(g.count))
+				} else {
+					row = append(row, strconv.Itoa(acc.numbers))
+				}
+			case "sum":
+				row = append(row, formatTableNumber(acc.sum))
+			case "avg":
+				if acc.numbers == 0 {
+					row = append(row, "")
+				} else {
+					row = append(row, formatTableNumber(acc.sum/float64(acc.numbers)))
+				}
+			case "min":
+				row = append(row, acc.min)
+			case "max":
+				row = append(row, acc.max)
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	if sortSpec == "" && len(groupCols) > 0 {
+		for i := range groupCols {
+			sortSpec += names[i] + ","
+		}
+	}
+	keys, err := parseTableSort(sortSpec, names)
+	if err != nil {
+		return nil, err
+	}
+	sortTableRows(rows, keys)
+
+	groupCount := len(rows)
+	if len(rows) > limit {
+		rows = rows[:limit]
+	}
+	data := map[string]interface{}{"columns": names, "rows": rows, "groups": groupCount, "matched": matched}
+	summary := fmt.Sprintf("%d rows", matched)
+	if filter != nil {
+		summary += " matching the filter"
+	}
+	if len(groupCols) > 0 {
+		summary += fmt.Sprintf(" in %d groups", groupCount)
+		if len(rows) < groupCount {
+			summary += fmt.Sprintf("; showing %d", len(rows))
+		}
+	}
+	return NewToolResult(summary + ":\n" + markdownTable(names, rows)).WithData(data), nil
+}
+
+// formatTableNumber writes f with at most 4 decimals and no exponent.
+func formatTableNumber(f float64) string {
+	return strconv.FormatFloat(math.Round(f*1e4)/1e4, 'f', -1, 64)
+}
+
+// tableColumnStats summarizes a column in one pass (Welford's method for
+// the standard deviation).
+type tableColumnStats struct {
+	count, empty int
+	numbers      int
+	mean, m2     float64
+	min, max     string
+	distinct     map[string]int
+	overflow     bool
+}
+
+func (s *tableColumnStats) add(v string) {
+	if strings.TrimSpace(v) == "" {
+		s.empty++
+		return
+	}
+	if s.count == 0 || compareTableValues(v, s.min) < 0 {
+		s.min = v
+	}
+	if s.count == 0 || compareTableValues(v, s.max) > 0 {
+		s.max = v
+	}
+	s.count++
+	if f, ok := tableNumber(v); ok {
+		s.numbers++
+		delta := f - s.mean
+		s.mean += delta / float64(s.numbers)
+		s.m2 += delta * (f - s.mean)
+	}
+	if _, ok := s.distinct[v]; ok || len(s.distinct) < maxTableDistinct {
+		s.distinct[v]++
+	} else {
+		s.overflow = true
+	}
+}
+
+func tableStats(ctx context.Context, table *tableFile, filter tableFilter, columns []string) (*ToolResult, error) {
+	selected := make([]int, len(table.columns))
+	for i := range selected {
+		selected[i] = i
+	}
+	if len(columns) > 0 {
+		var err error
+		if selected, err = table.resolveColumns(columns); err != nil {
+			return nil, err
+		}
+	}
+	stats := make([]*tableColumnStats, len(selected))
+	for i := range stats {
+		stats[i] = &tableColumnStats{distinct: make(map[string]int)}
+	}
+	rows := 0
+	err := table.scan(ctx, func(row []string) bool {
+		if filter != nil && !filter.match(row) {
+			return true
+		}
+		rows++
+		for i, c := range selected {
+			stats[i].add(cellAt(row, c))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{"column", "type", "values", "empty", "distinct", "min", "max", "mean", "std", "top"}
+	out := make([][]string, len(selected))
+	for i, c := range selected {
+		s := stats[i]
+		numeric := s.count > 0 && s.numbers == s.count
+		kind := "text"
+		switch {
+		case s.count == 0:
+			kind = "empty"
+		case numeric:
+			kind = "number"
+		}
+		distinct := strconv.Itoa(len(s.distinct))
+		if s.overflow {
+			distinct = fmt.Sprintf(">%d", maxTableDistinct)
+		}
+		mean, std, top := "", "", ""
+		if numeric {
+			mean = formatTableNumber(s.mean)
+			if s.numbers > 1 {
+				std = formatTableNumber(math.Sqrt(s.m2 / float64(s.numbers-1)))
+			}
+		} else {
+			top = topTableValues(s.distinct, 3)
+		}
+		out[i] = []string{table.columns[c], kind, strconv.Itoa(s.count), strconv.Itoa(s.empty), distinct, s.min, s.max, mean, std, top}
+	}
+	summary := fmt.Sprintf("%d rows", rows)
+	if filter != nil {
+		summary += " matching the filter"
+	}
+	return NewToolResult(summary + ":\n" + markdownTable(names, out)).WithData(map[string]interface{}{
+		"columns": names,
+		"rows":    out,
+		"matched": rows,
+	}), nil
+}
+
+// topTableValues lists the n most common values with their counts.
+func topTableValues(counts map[string]int, n int) string {
+	type valueCount struct {
+		value string
+		count int
+	}
+	values := make([]valueCount, 0, len(counts))
+	for v, c := range counts {
+		values = append(values, valueCount{v, c})
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].count != values[j].count {
+			return values[i].count > values[j].count
+		}
+		return values[i].value < values[j].value
+	})
+	var parts []string
+	for _, v := range values[:min(n, len(values))] {
+		value := v.value
+		if len([]rune(value)) > 30 {
+			value = string([]rune(value)[:30]) + "…"
+		}
+		parts = append(parts, fmt.Sprintf("%s (%d)", value, v.count))
+	}
+	return strings.Join(parts, ", ")
+}
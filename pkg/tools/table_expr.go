@@ -0,0 +1,322 @@
+package tools
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// tableFilter is a parsed filter expression of the table tool, such as
+//
+//	price > 10 and (city == "Paris" or city contains "lyon")
+//
+// Operands are column names (in `backquotes` if they have spaces), quoted
+// strings and numbers. Two values compare as numbers when both are, else
+// as text; contains, startswith and endswith ignore case.
+type tableFilter interface {
+	match(row []string) bool
+}
+
+type tableAnd struct{ a, b tableFilter }
+type tableOr struct{ a, b tableFilter }
+type tableNot struct{ a tableFilter }
+
+func (e tableAnd) match(row []string) bool { return e.a.match(row) && e.b.match(row) }
+func (e tableOr) match(row []string) bool  { return e.a.match(row) || e.b.match(row) }
+func (e tableNot) match(row []string) bool { return !e.a.match(row) }
+
+// tableOperand is a column or a literal.
+type tableOperand struct {
+	column  int // -1 for a literal
+	literal string
+}
+
+func (o tableOperand) value(row []string) string {
+	if o.column < 0 {
+		return o.literal
+	}
+	if o.column < len(row) {
+		return row[o.column]
+	}
+	return ""
+}
+
+type tableCompare struct {
+	left, right tableOperand
+	op          string
+}
+
+func (e tableCompare) match(row []string) bool {
+	l, r := e.left.value(row), e.right.value(row)
+	switch e.op {
+	case "contains":
+		return strings.Contains(strings.ToLower(l), strings.ToLower(r))
+	case "startswith":
+		return strings.HasPrefix(strings.ToLower(l), strings.ToLower(r))
+	case "endswith":
+		return strings.HasSuffix(strings.ToLower(l), strings.ToLower(r))
+	}
+	cmp := compareTableValues(l, r)
+	switch e.op {
+	case "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+// compareTableValues compares as numbers when both are, else as text.
+func compareTableValues(a, b string) int {
+	if x, ok := tableNumber(a); ok {
+		if y, ok := tableNumber(b); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+// tableNumber parses a cell as a number.
+func tableNumber(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	return f, err == nil
+}
+
+type tableToken struct {
+	kind string // "ident", "string", "number", "op", "(", ")"
+	text string
+}
+
+// parseTableFilter parses expr against the table's columns.
+func parseTableFilter(expr string, columns []string) (tableFilter, error) {
+	tokens, err := lexTableFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &tableFilterParser{tokens: tokens, columns: columns}
+	f, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in filter", p.tokens[p.pos].text)
+	}
+	return f, nil
+}
+
+func lexTableFilter(expr string) ([]tableToken, error) {
+	var tokens []tableToken
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')':
+			tokens = append(tokens, tableToken{kind: string(r), text: string(r)})
+			i++
+		case r == '"' || r == '\'' || r == '`':
+			j := i + 1
+			for j < len(runes) && runes[j] != r {
+				j++
+			}
+			if j == len(runes) {
+				return nil, fmt.Errorf("unclosed %c in filter", r)
+			}
+			kind := "string"
+			if r == '`' {
+				kind = "ident"
+			}
+			tokens = append(tokens, tableToken{kind: kind, text: string(runes[i+1 : j])})
+			i = j + 1
+		case strings.ContainsRune("=!<>", r):
+			j := i + 1
+			if j < len(runes) && (runes[j] == '=' || (r == '<' && runes[j] == '>')) {
+				j++
+			}
+			op := string(runes[i:j])
+			switch op {
+			case "=":
+				op = "=="
+			case "<>":
+				op = "!="
+			case "!":
+				return nil, fmt.Errorf("use != or not in filter")
+			}
+			tokens = append(tokens, tableToken{kind: "op", text: op})
+			i = j
+		case unicode.IsDigit(r) || ((r == '-' || r == '.') && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			j := i + 1
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || strings.ContainsRune(".eE", runes[j]) ||
+				((runes[j] == '-' || runes[j] == '+') && (runes[j-1] == 'e' || runes[j-1] == 'E'))) {
+				j++
+			}
+			tokens = append(tokens, tableToken{kind: "number", text: string(runes[i:j])})
+			i = j
+		case unicode.IsLetter(r) || r == '_':
+			j := i + 1
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_' || runes[j] == '.') {
+				j++
+			}
+			word := string(runes[i:j])
+			switch strings.ToLower(word) {
+			case "and", "or", "not", "contains", "startswith", "endswith":
+				tokens = append(tokens, tableToken{kind: "op", text: strings.ToLower(word)})
+			default:
+				tokens = append(tokens, tableToken{kind: "ident", text: word})
+			}
+			i = j
+		case r == '&' && i+1 < len(runes) && runes[i+1] == '&':
+			tokens = append(tokens, tableToken{kind: "op", text: "and"})
+			i += 2
+		case r == '|' && i+1 < len(runes) && runes[i+1] == '|':
+			tokens = append(tokens, tableToken{kind: "op", text: "or"})
+			i += 2
+		default:
+			return nil, fmt.Errorf("unexpected %q in filter", string(r))
+		}
+	}
+	return tokens, nil
+}
+
+type tableFilterParser struct {
+	tokens  []tableToken
+	pos     int
+	columns []string
+}
+
+func (p *tableFilterParser) peekOp(op string) bool {
+	return p.pos < len(p.tokens) && p.tokens[p.pos].kind == "op" && p.tokens[p.pos].text == op
+}
+
+func (p *tableFilterParser) or() (tableFilter, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekOp("or") {
+		p.pos++
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = tableOr{left, right}
+	}
+	return left, nil
+}
+
+func (p *tableFilterParser) and() (tableFilter, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekOp("and") {
+		p.pos++
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = tableAnd{left, right}
+	}
+	return left, nil
+}
+
+func (p *tableFilterParser) unary() (tableFilter, error) {
+	if p.peekOp("not") {
+		p.pos++
+		inner, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return tableNot{inner}, nil
+	}
+	if p.pos < len(p.tokens) && p.tokens[p.pos].kind == "(" {
+		p.pos++
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != ")" {
+			return nil, fmt.Errorf("missing ) in filter")
+		}
+		p.pos++
+		return inner, nil
+	}
+	return p.comparison()
+}
+
+func (p *tableFilterParser) comparison() (tableFilter, error) {
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != "op" {
+		return nil, fmt.Errorf("expected a comparison after %q in filter", p.tokens[p.pos-1].text)
+	}
+	op := p.tokens[p.pos].text
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=", "contains", "startswith", "endswith":
+	default:
+		return nil, fmt.Errorf("expected a comparison, got %q in filter", op)
+	}
+	p.pos++
+	right, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	return tableCompare{left: left, right: right, op: op}, nil
+}
+
+func (p *tableFilterParser) operand() (tableOperand, error) {
+	if p.pos >= len(p.tokens) {
+		return tableOperand{}, fmt.Errorf("filter ends too early")
+	}
+	tok := p.tokens[p.pos]
+	p.pos++
+	switch tok.kind {
+	case "string", "number":
+		return tableOperand{column: -1, literal: tok.text}, nil
+	case "ident":
+		i := tableColumn(p.columns, tok.text)
+		if i < 0 {
+			return tableOperand{}, fmt.Errorf("unknown column %q in filter (quote text values); columns: %s",
+				tok.text, strings.Join(p.columns, ", "))
+		}
+		return tableOperand{column: i}, nil
+	}
+	return tableOperand{}, fmt.Errorf("unexpected %q in filter", tok.text)
+}
+
+// tableColumn finds a column by name, ignoring case, or returns -1.
+func tableColumn(columns []string, name string) int {
+	for i, c := range columns {
+		if c == name {
+			return i
+		}
+	}
+	for i, c := range columns {
+		if strings.EqualFold(c, name) {
+			return i
+		}
+	}
+	return -1
+}
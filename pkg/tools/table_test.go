@@ -0,0 +1,200 @@
+package tools
+
+import (
+	"archive/zip"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testSalesCSV = "\xEF\xBB\xBFregion;product;units;price\n" +
+	"north;apple;10;1.5\n" +
+	"south;pear;3;2\n" +
+	"north;pear;7;2\n" +
+	"east;apple;;1.25\n" +
+	"south;apple;12;1.5\n"
+
+func newTestTable(t *testing.T) (*TableTool, string) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "sales.csv"), []byte(testSalesCSV), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return NewTableTool(dir, true), dir
+}
+
+// TestTableToolInfo verifies the delimiter is sniffed, the BOM dropped and
+// column types guessed
+func TestTableToolInfo(t *testing.T) {
+	tool, _ := newTestTable(t)
+	result := tool.Execute(context.Background(), map[string]interface{}{"path": "sales.csv"})
+	if result.IsError {
+		t.Fatalf("Expected info, got %q", result.ForLLM)
+	}
+	for _, want := range []string{
+		"sales.csv (CSV): 5 rows, 4 columns",
+		"Columns: region (text), product (text), units (number), price (number)",
+		"| north | apple | 10 | 1.5 |",
+	} {
+		if !strings.Contains(result.ForLLM, want) {
+			t.Errorf("Expected %q in\n%s", want, result.ForLLM)
+		}
+	}
+}
+
+// TestTableToolQuery verifies filtering, column selection, sorting and the
+// limit
+func TestTableToolQuery(t *testing.T) {
+	tool, _ := newTestTable(t)
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"path":    "sales.csv",
+		"action":  "query",
+		"filter":  `product == "apple" and units > 5`,
+		"columns": []interface{}{"region", "units"},
+		"sort":    "-units",
+	})
+	want := "2 of 5 rows match:\n| region | units |\n| --- | --- |\n| south | 12 |\n| north | 10 |"
+	if !strings.HasPrefix(result.ForLLM, want) {
+		t.Errorf("Expected\n%s\ngot\n%s", want, result.ForLLM)
+	}
+
+	result = tool.Execute(context.Background(), map[string]interface{}{
+		"path": "sales.csv", "action": "query", "sort": "price, region", "limit": float64(2),
+	})
+	if !strings.Contains(result.ForLLM, "showing 2") || !strings.Contains(result.ForLLM, "| east |") || strings.Contains(result.ForLLM, "pear") {
+		t.Errorf("Expected the two cheapest rows, got\n%s", result.ForLLM)
+	}
+
+	result = tool.Execute(context.Background(), map[string]interface{}{"path": "sales.csv", "action": "query", "filter": "colour == 1"})
+	if !result.IsError || !strings.Contains(result.ForLLM, "unknown column") {
+		t.Errorf("Expected an unknown column error, got %q", result.ForLLM)
+	}
+}
+
+// TestTableToolAggregate verifies grouped sums, averages and counts, and
+// sorting by an aggregate
+func TestTableToolAggregate(t *testing.T) {
+	tool, _ := newTestTable(t)
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"path":       "sales.csv",
+		"action":     "aggregate",
+		"group_by":   []interface{}{"product"},
+		"aggregates": []interface{}{"count", "sum(units)", "avg(price)", "max(region)"},
+		"sort":       "-sum(units)",
+	})
+	want := "5 rows in 2 groups:\n" +
+		"| product | count | sum(units) | avg(price) | max(region) |\n| --- | --- | --- | --- | --- |\n" +
+		"| apple | 3 | 22 | 1.4167 | south |\n" +
+		"| pear | 2 | 10 | 2 | south |"
+	if !strings.HasPrefix(result.ForLLM, want) {
+		t.Errorf("Expected\n%s\ngot\n%s", want, result.ForLLM)
+	}
+
+	result = tool.Execute(context.Background(), map[string]interface{}{"path": "sales.csv", "action": "aggregate", "aggregates": []interface{}{"median(units)"}})
+	if !result.IsError {
+		t.Errorf("Expected an unknown aggregate to fail, got %q", result.ForLLM)
+	}
+}
+
+// TestTableToolStats verifies per-column summaries
+func TestTableToolStats(t *testing.T) {
+	tool, _ := newTestTable(t)
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"path":    "sales.csv",
+		"action":  "stats",
+		"columns": []interface{}{"units", "region"},
+	})
+	for _, want := range []string{
+		"| units | number | 4 | 1 | 4 | 3 | 12 | 8 | 3.9158 |  |",
+		"| region | text | 5 | 0 | 3 | east | south |  |  | north (2), south (2), east (1) |",
+	} {
+		if !strings.Contains(result.ForLLM, want) {
+			t.Errorf("Expected %q in\n%s", want, result.ForLLM)
+		}
+	}
+}
+
+// TestTableToolXLSX verifies shared strings, inline strings, gaps and sheet
+// selection in a workbook
+func TestTableToolXLSX(t *testing.T) {
+	dir := t.TempDir()
+	f, err := os.Create(filepath.Join(dir, "book.xlsx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	files := map[string]string{
+		"xl/workbook.xml": `<workbook xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="Notes" r:id="rId2"/><sheet name="Data" r:id="rId1"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships><Relationship Id="rId1" Target="worksheets/sheet1.xml"/>` +
+			`<Relationship Id="rId2" Target="worksheets/sheet2.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<sst><si><t>name</t></si><si><t>score</t></si><si><r><t>Ad</t></r><r><t>a</t></r></si></sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet><sheetData>` +
+			`<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c><c r="C1" t="inlineStr"><is><t>ok</t></is></c></row>` +
+			`<row r="2"><c r="A2" t="s"><v>2</v></c><c r="C2" t="b"><v>1</v></c></row>` +
+			`<row r="3"><c r="A3" t="inlineStr"><is><t>Bo</t></is></c><c r="B3"><v>4.5</v></c></row>` +
+			`</sheetData></worksheet>`,
+		"xl/worksheets/sheet2.xml": `<worksheet><sheetData><row r="1"><c r="A1" t="inlineStr"><is><t>text</t></is></c></row></sheetData></worksheet>`,
+	}
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	zw.Close()
+	f.Close()
+
+	tool := NewTableTool(dir, true)
+	result := tool.Execute(context.Background(), map[string]interface{}{"path": "book.xlsx", "action": "query", "sheet": "data"})
+	want := "2 rows:\n| name | score | ok |\n| --- | --- | --- |\n| Ada |  | TRUE |\n| Bo | 4.5 |  |"
+	if !strings.HasPrefix(result.ForLLM, want) {
+		t.Errorf("Expected\n%s\ngot\n%s", want, result.ForLLM)
+	}
+
+	result = tool.Execute(context.Background(), map[string]interface{}{"path": "book.xlsx"})
+	if !strings.Contains(result.ForLLM, "(XLSX): 0 rows, 1 columns") || !strings.Contains(result.ForLLM, "Sheets: Notes, Data") {
+		t.Errorf("Expected the first sheet described, got\n%s", result.ForLLM)
+	}
+
+	result = tool.Execute(context.Background(), map[string]interface{}{"path": "book.xlsx", "sheet": "Missing"})
+	if !result.IsError || !strings.Contains(result.ForLLM, "Notes, Data") {
+		t.Errorf("Expected the sheets listed, got %q", result.ForLLM)
+	}
+}
+
+// TestParseTableFilter verifies operators, precedence, quoting and errors
+func TestParseTableFilter(t *testing.T) {
+	columns := []string{"name", "unit price", "qty"}
+	row := []string{"Blue Widget", "9.5", "10"}
+	cases := []struct {
+		expr  string
+		match bool
+	}{
+		{`qty = 10`, true},
+		{`qty > 9.5 && name startswith 'blue'`, true},
+		{"`unit price` < 10 and not name contains \"red\"", true},
+		{`qty < 2 or qty >= 10 and name endswith "x"`, false},
+		{`(qty < 2 or qty >= 10) and NAME endswith "widget"`, true},
+		{`name <> "Blue Widget"`, false},
+		{`qty > 9`, true},
+	}
+	for _, c := range cases {
+		f, err := parseTableFilter(c.expr, columns)
+		if err != nil {
+			t.Errorf("%q: %v", c.expr, err)
+			continue
+		}
+		if got := f.match(row); got != c.match {
+			t.Errorf("%q: expected %v, got %v", c.expr, c.match, got)
+		}
+	}
+	for _, expr := range []string{`qty >`, `qty > 1 and`, `(qty > 1`, `name == "x`, `price > 1`, `qty ! 1`, `name`} {
+		if _, err := parseTableFilter(expr, columns); err == nil {
+			t.Errorf("%q: expected an error", expr)
+		}
+	}
+}
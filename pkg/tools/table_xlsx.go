@@ -0,0 +1,237 @@
+package tools
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// xlsxRows reads the rows of one worksheet of an XLSX file as text, without
+// loading the sheet into memory. Dates are shown as Excel's day numbers,
+// since their formats live in styles this reader skips.
+type xlsxRows struct {
+	zr      *zip.ReadCloser
+	sheet   io.ReadCloser
+	dec     *xml.Decoder
+	strings []string
+	sheets  []string
+}
+
+// openXLSX opens the sheet named sheet, or the first one if empty.
+func openXLSX(file, sheet string) (*xlsxRows, error) {
+	zr, err := zip.OpenReader(file)
+	if err != nil {
+		return nil, err
+	}
+	x := &xlsxRows{zr: zr}
+	if err := x.open(sheet); err != nil {
+		zr.Close()
+		return nil, err
+	}
+	return x, nil
+}
+
+func (x *xlsxRows) open(sheet string) error {
+	data, err := readZipEntry(&x.zr.Reader, "xl/workbook.xml")
+	if err != nil {
+		return fmt.Errorf("not an XLSX workbook: %w", err)
+	}
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+			RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := xml.Unmarshal(data, &workbook); err != nil || len(workbook.Sheets) == 0 {
+		return errors.New("invalid XLSX workbook: no sheets")
+	}
+	rid := workbook.Sheets[0].RID
+	for _, s := range workbook.Sheets {
+		x.sheets = append(x.sheets, s.Name)
+		if sheet != "" && strings.EqualFold(s.Name, sheet) {
+			rid = s.RID
+		}
+	}
+	if sheet != "" && !containsFold(x.sheets, sheet) {
+		return fmt.Errorf("no sheet named %q; sheets: %s", sheet, strings.Join(x.sheets, ", "))
+	}
+
+	target := "worksheets/sheet1.xml"
+	if data, err := readZipEntry(&x.zr.Reader, "xl/_rels/workbook.xml.rels"); err == nil {
+		var rels struct {
+			Rels []struct {
+				ID     string `xml:"Id,attr"`
+				Target string `xml:"Target,attr"`
+			} `xml:"Relationship"`
+		}
+		if xml.Unmarshal(data, &rels) == nil {
+			for _, r := range rels.Rels {
+				if r.ID == rid {
+					target = r.Target
+				}
+			}
+		}
+	}
+	name := path.Join("xl", target)
+	if strings.HasPrefix(target, "/") {
+		name = strings.TrimPrefix(target, "/")
+	}
+
+	if data, err := readZipEntry(&x.zr.Reader, "xl/sharedStrings.xml"); err == nil {
+		x.strings = xlsxSharedStrings(data)
+	}
+	for _, f := range x.zr.File {
+		if f.Name == name {
+			rc, err := f.Open()
+			if err != nil {
+				return err
+			}
+			x.sheet = rc
+			x.dec = xml.NewDecoder(rc)
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid XLSX workbook: missing %s", name)
+}
+
+// Sheets lists the workbook's sheets.
+func (x *xlsxRows) Sheets() []string {
+	return x.sheets
+}
+
+// Next returns the next row, with empty cells filled in, or io.EOF.
+func (x *xlsxRows) Next() ([]string, error) {
+	var row []string
+	inRow := false
+	for {
+		tok, err := x.dec.Token()
+		if err != nil {
+			if err == io.EOF && inRow {
+				return row, nil
+			}
+			return nil, err
+		}
+		switch el := tok.(type) {
+		case xml.StartElement:
+			switch el.Name.Local {
+			case "row":
+				inRow = true
+			case "c":
+				col := len(row)
+				if ref := attr(el, "r"); ref != "" {
+					if c, ok := xlsxColumn(ref); ok {
+						col = c
+					}
+				}
+				value, err := x.cell(el)
+				if err != nil {
+					return nil, err
+				}
+				for len(row) < col {
+					row = append(row, "")
+				}
+				row = append(row, value)
+			}
+		case xml.EndElement:
+			if el.Name.Local == "row" {
+				return row, nil
+			}
+		}
+	}
+}
+
+// cell reads a <c> element's value.
+func (x *xlsxRows) cell(start xml.StartElement) (string, error) {
+	var c struct {
+		Value  string `xml:"v"`
+		Inline struct {
+			Text string `xml:"t"`
+			Runs []struct {
+				Text string `xml:"t"`
+			} `xml:"r"`
+		} `xml:"is"`
+	}
+	if err := x.dec.DecodeElement(&c, &start); err != nil {
+		return "", err
+	}
+	switch attr(start, "t") {
+	case "s":
+		i, err := strconv.Atoi(c.Value)
+		if err != nil || i < 0 || i >= len(x.strings) {
+			return "", nil
+		}
+		return x.strings[i], nil
+	case "inlineStr":
+		text := c.Inline.Text
+		for _, r := range c.Inline.Runs {
+			text += r.Text
+		}
+		return text, nil
+	case "b":
+		if c.Value == "1" {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	}
+	return c.Value, nil
+}
+
+func (x *xlsxRows) Close() error {
+	if x.sheet != nil {
+		x.sheet.Close()
+	}
+	return x.zr.Close()
+}
+
+// xlsxSharedStrings reads the workbook's string table; rich text runs are
+// joined.
+func xlsxSharedStrings(data []byte) []string {
+	var sst struct {
+		Items []struct {
+			Text string `xml:"t"`
+			Runs []struct {
+				Text string `xml:"t"`
+			} `xml:"r"`
+		} `xml:"si"`
+	}
+	if xml.Unmarshal(data, &sst) != nil {
+		return nil
+	}
+	out := make([]string, len(sst.Items))
+	for i, item := range sst.Items {
+		text := item.Text
+		for _, r := range item.Runs {
+			text += r.Text
+		}
+		out[i] = text
+	}
+	return out
+}
+
+// xlsxColumn returns the zero-based column of a cell reference like "C7".
+func xlsxColumn(ref string) (int, bool) {
+	col := 0
+	n := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		col = col*26 + int(r-'A'+1)
+		n++
+	}
+	return col - 1, n > 0
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,592 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/tasks"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const (
+	// taskSyncInterval is how stale the synced list may get before list
+	// syncs first.
+	taskSyncInterval = 5 * time.Minute
+	// taskReminderHour is when tasks due on a date are reminded of.
+	taskReminderHour = 9
+	maxTaskList      = 50
+)
+
+// TasksTool manages the user's to-do list. Tasks with a due time get a
+// reminder on the cron service, delivered like the reminder tool's, and
+// the list is optionally synced with Todoist or a CalDAV task list.
+type TasksTool struct {
+	store       *tasks.Store
+	remote      tasks.Remote // nil without sync
+	cronService *cron.CronService
+	loc         *time.Location
+	now         func() time.Time
+	channel     string
+	chatID      string
+	lastSync    time.Time
+	mu          sync.Mutex
+}
+
+// NewTasksTool creates a tasks tool over store, syncing with remote if it
+// isn't nil. Dates are read and shown in loc (the host's zone if nil).
+func NewTasksTool(store *tasks.Store, remote tasks.Remote, cronService *cron.CronService, loc *time.Location) *TasksTool {
+	if loc == nil {
+		loc = time.Local
+	}
+	return &TasksTool{store: store, remote: remote, cronService: cronService, loc: loc, now: time.Now}
+}
+
+func (t *TasksTool) Name() string {
+	return "tasks"
+}
+
+func (t *TasksTool) Description() string {
+	desc := "Manage the user's to-do list: add tasks with due dates and priorities, list what's open or due, complete, change or delete them. " +
+		"Tasks due at a time are reminded of when due. Use this for things the user has to do; use reminder for a plain nudge at a time. " +
+		fmt.Sprintf("Dates are in %s.", t.loc)
+	if t.remote != nil {
+		desc += " The list is synced with " + t.remote.Name() + "."
+	}
+	return desc
+}
+
+func (t *TasksTool) Parameters() map[string]interface{} {
+	actions := []string{"add", "list", "complete", "update", "delete"}
+	if t.remote != nil {
+		actions = append(actions, "sync")
+	}
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        actions,
+				"description": "add, list (default), complete, update or delete",
+			},
+			"id": map[string]interface{}{
+				"type":        "integer",
+				"description": "For complete, update and delete: the task number from list",
+			},
+			"title": map[string]interface{}{
+				"type":        "string",
+				"description": "What to do, e.g. 'Renew passport'",
+			},
+			"notes": map[string]interface{}{
+				"type":        "string",
+				"description": "Details",
+			},
+			"due": map[string]interface{}{
+				"type":        "string",
+				"description": "Due date, optionally with a time: 'today', 'tomorrow', 'friday', '2026-10-20', 'tomorrow 17:00' or '2026-10-20 09:30'. For update, 'none' removes it",
+			},
+			"priority": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"low", "normal", "high", "urgent"},
+				"description": "Default normal",
+			},
+			"remind": map[string]interface{}{
+				"type":        "boolean",
+				"description": fmt.Sprintf("Remind the user when the task is due (default: only when due has a time; tasks due on a date are reminded of at %d:00)", taskReminderHour),
+			},
+			"remind_before": map[string]interface{}{
+				"type":        "integer",
+				"description": "Remind this many minutes before it is due",
+			},
+			"filter": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"open", "today", "overdue", "done", "all"},
+				"description": "For list: open tasks (default), those due today or earlier, overdue ones, done ones or all",
+			},
+			"search": map[string]interface{}{
+				"type":        "string",
+				"description": "For list: only tasks whose title or notes contain this",
+			},
+		},
+		"required": []string{},
+	}
+}
+
+// SetContext records the chat task reminders are set from.
+func (t *TasksTool) SetContext(channel, chatID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.channel = channel
+	t.chatID = chatID
+}
+
+// HasSideEffects marks the tool as stateful: a retried add within a turn
+// must not add the task twice.
+func (t *TasksTool) HasSideEffects() bool {
+	return true
+}
+
+// ConfirmationSummary describes a change to the list; listing needs no
+// confirmation.
+func (t *TasksTool) ConfirmationSummary(args map[string]interface{}) string {
+	action, _ := args["action"].(string)
+	title, _ := args["title"].(string)
+	id, _ := args["id"].(float64)
+	switch action {
+	case "add":
+		return fmt.Sprintf("add the task %q", title)
+	case "complete", "update", "delete":
+		return fmt.Sprintf("%s task #%d", action, int64(id))
+	case "sync":
+		if t.remote != nil {
+			return "sync the task list with " + t.remote.Name()
+		}
+	}
+	return ""
+}
+
+// DryRun lists tasks as usual, without syncing, and only describes changes.
+func (t *TasksTool) DryRun(ctx context.Context, args map[string]interface{}) *ToolResult {
+	if action, _ := args["action"].(string); action == "" || action == "list" {
+		return t.list(ctx, args, false)
+	}
+	return UserResult("Dry run, task list not changed. It would " + t.ConfirmationSummary(args) + ".")
+}
+
+func (t *TasksTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	action, _ := args["action"].(string)
+	switch action {
+	case "", "list":
+		return t.list(ctx, args, true)
+	case "add":
+		return t.add(ctx, args)
+	case "complete":
+		return t.complete(ctx, args)
+	case "update":
+		return t.update(ctx, args)
+	case "delete":
+		return t.delete(ctx, args)
+	case "sync":
+		if t.remote == nil {
+			return ErrorResult("task sync is not configured (tools.tasks.todoist or tools.tasks.caldav)")
+		}
+		note, err := t.sync(ctx)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("sync failed: %v", err)).WithError(err)
+		}
+		return SilentResult(note)
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action %q: use add, list, complete, update or delete", action))
+	}
+}
+
+func (t *TasksTool) add(ctx context.Context, args map[string]interface{}) *ToolResult {
+	title, _ := args["title"].(string)
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return ErrorResult("title is required")
+	}
+	notes, _ := args["notes"].(string)
+	priorityName, _ := args["priority"].(string)
+	priority, err := tasks.ParsePriority(priorityName)
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+	task := tasks.Task{Title: title, Notes: strings.TrimSpace(notes), Priority: priority}
+	if due, _ := args["due"].(string); strings.TrimSpace(due) != "" {
+		if task.Due, task.DueTime, err = parseTaskDue(due, t.now(), t.loc); err != nil {
+			return ErrorResult(err.Error())
+		}
+	}
+
+	task, err = t.store.Add(task)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to save the task: %v", err)).WithError(err)
+	}
+	result := "Added task " + t.describe(task)
+	remind, ok := args["remind"].(bool)
+	if !ok {
+		remind = task.DueTime
+	}
+	if note := t.schedule(&task, remind, remindBefore(args)); note != "" {
+		result += "; " + note
+	}
+	if note := t.push(ctx, &task); note != "" {
+		result += ". " + note
+	}
+	if err := t.store.Update(task); err != nil {
+		return ErrorResult(fmt.Sprintf("failed to save the task: %v", err)).WithError(err)
+	}
+	return SilentResult(result)
+}
+
+func (t *TasksTool) list(ctx context.Context, args map[string]interface{}, syncFirst bool) *ToolResult {
+	var syncNote string
+	if syncFirst && t.remote != nil {
+		t.mu.Lock()
+		stale := t.now().Sub(t.lastSync) > taskSyncInterval
+		t.mu.Unlock()
+		if stale {
+			if _, err := t.sync(ctx); err != nil {
+				syncNote = fmt.Sprintf("\n(Showing the local list; sync failed: %v)", err)
+			}
+		}
+	}
+
+	filter, _ := args["filter"].(string)
+	search, _ := args["search"].(string)
+	now := t.now().In(t.loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, t.loc)
+	f := tasks.Filter{Search: strings.TrimSpace(search)}
+	switch filter {
+	case "", "open":
+	case "today":
+		f.DueBefore = today.AddDate(0, 0, 1)
+	case "overdue":
+		f.DueBefore = now
+	case "done":
+		f.Done = true
+	case "all":
+		f.All = true
+	default:
+		return ErrorResult(fmt.Sprintf("unknown filter %q: use open, today, overdue, done or all", filter))
+	}
+	list, err := t.store.List(f)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to read the tasks: %v", err)).WithError(err)
+	}
+
+	var sb strings.Builder
+	shown := 0
+	for _, task := range list {
+		if filter == "overdue" && !t.overdue(task, now) {
+			continue
+		}
+		if shown == maxTaskList {
+			sb.WriteString("- ... more; narrow the list with filter or search\n")
+			break
+		}
+		shown++
+		sb.WriteString("- " + t.line(task, now) + "\n")
+	}
+	if shown == 0 {
+		return SilentResult("No tasks" + map[string]string{
+			"": " open", "open": " open", "today": " due today", "overdue": " overdue", "done": " done",
+		}[filter] + syncNote)
+	}
+	return SilentResult(fmt.Sprintf("Tasks (times in %s):\n%s", t.loc, sb.String()) + strings.TrimPrefix(syncNote, "\n"))
+}
+
+func (t *TasksTool) complete(ctx context.Context, args map[string]interface{}) *ToolResult {
+	task, errResult := t.lookup(args)
+	if errResult != nil {
+		return errResult
+	}
+	if task.Done {
+		return SilentResult(fmt.Sprintf("Task #%d was already done: %s", task.ID, task.Title))
+	}
+	task.Done, task.Completed = true, t.now()
+	t.unschedule(&task)
+	result := "Completed task " + t.describe(task)
+	if t.remote != nil && task.Remote != "" {
+		if err := t.remote.Complete(ctx, task); err != nil {
+			result += fmt.Sprintf(". Not marked done in %s (%v); sync will retry", t.remote.Name(), err)
+		}
+	}
+	if err := t.store.Update(task); err != nil {
+		return ErrorResult(fmt.Sprintf("failed to save the task: %v", err)).WithError(err)
+	}
+	return SilentResult(result)
+}
+
+func (t *TasksTool) update(ctx context.Context, args map[string]interface{}) *ToolResult {
+	task, errResult := t.lookup(args)
+	if errResult != nil {
+		return errResult
+	}
+	dueChanged := false
+	if title, ok := args["title"].(string); ok && strings.TrimSpace(title) != "" {
+		task.Title = strings.TrimSpace(title)
+	}
+	if notes, ok := args["notes"].(string); ok {
+		task.Notes = strings.TrimSpace(notes)
+	}
+	if name, ok := args["priority"].(string); ok && name != "" {
+		p, err := tasks.ParsePriority(name)
+		if err != nil {
+			return ErrorResult(err.Error())
+		}
+		task.Priority = p
+	}
+	if due, ok := args["due"].(string); ok && strings.TrimSpace(due) != "" {
+		if strings.EqualFold(strings.TrimSpace(due), "none") {
+			task.Due, task.DueTime = time.Time{}, false
+		} else {
+			var err error
+			if task.Due, task.DueTime, err = parseTaskDue(due, t.now(), t.loc); err != nil {
+				return ErrorResult(err.Error())
+			}
+		}
+		dueChanged = true
+	}
+
+	result := "Updated task " + t.describe(task)
+	remind, remindGiven := args["remind"].(bool)
+	_, beforeGiven := args["remind_before"]
+	if dueChanged || remindGiven || beforeGiven {
+		if !remindGiven {
+			// A moved task keeps its reminder
+			remind = task.Reminder != "" || task.DueTime
+		}
+		t.unschedule(&task)
+		if note := t.schedule(&task, remind, remindBefore(args)); note != "" {
+			result += "; " + note
+		}
+	}
+	if note := t.push(ctx, &task); note != "" {
+		result += ". " + note
+	}
+	if err := t.store.Update(task); err != nil {
+		return ErrorResult(fmt.Sprintf("failed to save the task: %v", err)).WithError(err)
+	}
+	return SilentResult(result)
+}
+
+func (t *TasksTool) delete(ctx context.Context, args map[string]interface{}) *ToolResult {
+	task, errResult := t.lookup(args)
+	if errResult != nil {
+		return errResult
+	}
+	t.unschedule(&task)
+	if err := t.store.Delete(task.ID); err != nil {
+		return ErrorResult(fmt.Sprintf("failed to delete the task: %v", err)).WithError(err)
+	}
+	result := fmt.Sprintf("Deleted task #%d: %s", task.ID, task.Title)
+	if t.remote != nil && task.Remote != "" {
+		if err := t.remote.Delete(ctx, task); err != nil {
+			result += fmt.Sprintf(". It is still in %s (%v)", t.remote.Name(), err)
+		}
+	}
+	return SilentResult(result)
+}
+
+// sync runs a sync and updates the reminders of tasks it changed.
+func (t *TasksTool) sync(ctx context.Context) (string, error) {
+	res, err := tasks.Sync(ctx, t.store, t.remote)
+	if err != nil {
+		return "", err
+	}
+	t.mu.Lock()
+	t.lastSync = t.now()
+	t.mu.Unlock()
+
+	for _, task := range res.Completed {
+		if task.Reminder != "" {
+			t.unschedule(&task)
+			t.save(task)
+		}
+	}
+	for _, task := range res.Updated {
+		if task.Reminder != "" {
+			t.unschedule(&task)
+			t.schedule(&task, true, 0)
+			t.save(task)
+		}
+	}
+	logger.InfoCF("tasks", "Synced tasks", map[string]interface{}{
+		"remote":    t.remote.Name(),
+		"imported":  len(res.Imported),
+		"updated":   len(res.Updated),
+		"completed": len(res.Completed),
+		"pushed":    res.Pushed,
+	})
+	return fmt.Sprintf("Synced with %s: %d new, %d changed, %d finished there, %d sent there",
+		t.remote.Name(), len(res.Imported), len(res.Updated), len(res.Completed), res.Pushed), nil
+}
+
+// lookup reads the task named by the id argument.
+func (t *TasksTool) lookup(args map[string]interface{}) (tasks.Task, *ToolResult) {
+	id, ok := args["id"].(float64)
+	if !ok || id <= 0 {
+		return tasks.Task{}, ErrorResult("id is required; use list to find it")
+	}
+	task, err := t.store.Get(int64(id))
+	if errors.Is(err, tasks.ErrNotFound) {
+		return tasks.Task{}, ErrorResult(fmt.Sprintf("task #%d not found", int64(id)))
+	}
+	if err != nil {
+		return tasks.Task{}, ErrorResult(fmt.Sprintf("failed to read the task: %v", err)).WithError(err)
+	}
+	return task, nil
+}
+
+// schedule sets the task's reminder, before its due time, and says when
+// it fires. The reminder goes to wherever the user was last active, or
+// the chat the task is set from.
+func (t *TasksTool) schedule(task *tasks.Task, remind bool, before time.Duration) string {
+	if !remind || task.Due.IsZero() || task.Done {
+		return ""
+	}
+	t.mu.Lock()
+	channel, chatID := t.channel, t.chatID
+	t.mu.Unlock()
+
+	at := task.Due.In(t.loc)
+	if !task.DueTime {
+		at = time.Date(at.Year(), at.Month(), at.Day(), taskReminderHour, 0, 0, 0, t.loc)
+	}
+	at = at.Add(-before)
+	if !at.After(t.now()) {
+		return "no reminder, since its time has passed"
+	}
+	atMS := at.UnixMilli()
+	job, err := t.cronService.AddJobWithPayload(utils.Truncate(task.Title, 30), cron.CronSchedule{Kind: "at", AtMS: &atMS}, cron.CronPayload{
+		Kind:    cron.PayloadReminder,
+		Message: fmt.Sprintf("%s (task #%d, due %s)", task.Title, task.ID, t.formatDue(*task)),
+		Deliver: true,
+		Channel: channel,
+		To:      chatID,
+	})
+	if err != nil {
+		return fmt.Sprintf("failed to set the reminder: %v", err)
+	}
+	task.Reminder = job.ID
+	return "reminder at " + at.Format("Mon Jan 2 15:04")
+}
+
+// unschedule cancels the task's reminder.
+func (t *TasksTool) unschedule(task *tasks.Task) {
+	if task.Reminder != "" {
+		t.cronService.RemoveJob(task.Reminder)
+		task.Reminder = ""
+	}
+}
+
+// push saves the task to the remote, returning a note if that failed.
+func (t *TasksTool) push(ctx context.Context, task *tasks.Task) string {
+	if t.remote == nil {
+		return ""
+	}
+	id, err := t.remote.Save(ctx, *task)
+	if err != nil {
+		return fmt.Sprintf("Saved locally but not in %s (%v); sync will retry", t.remote.Name(), err)
+	}
+	task.Remote = id
+	return ""
+}
+
+func (t *TasksTool) save(task tasks.Task) {
+	if err := t.store.Update(task); err != nil {
+		logger.WarnCF("tasks", "Failed to save task", map[string]interface{}{
+			"id":    task.ID,
+			"error": err.Error(),
+		})
+	}
+}
+
+// describe is "#3: Renew passport (due Tue Oct 20, high priority)".
+func (t *TasksTool) describe(task tasks.Task) string {
+	var details []string
+	if !task.Due.IsZero() {
+		details = append(details, "due "+t.formatDue(task))
+	}
+	if task.Priority != tasks.PriorityNormal {
+		details = append(details, task.Priority.String()+" priority")
+	}
+	s := fmt.Sprintf("#%d: %s", task.ID, task.Title)
+	if len(details) > 0 {
+		s += " (" + strings.Join(details, ", ") + ")"
+	}
+	return s
+}
+
+// line is one task in a list.
+func (t *TasksTool) line(task tasks.Task, now time.Time) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "#%d ", task.ID)
+	if task.Done {
+		sb.WriteString("✓ ")
+	}
+	if task.Priority != tasks.PriorityNormal {
+		sb.WriteString("[" + task.Priority.String() + "] ")
+	}
+	sb.WriteString(task.Title)
+	switch {
+	case task.Done && !task.Completed.IsZero():
+		sb.WriteString(" — done " + task.Completed.In(t.loc).Format("Mon Jan 2"))
+	case !task.Due.IsZero():
+		sb.WriteString(" — due " + t.formatDue(task))
+		if t.overdue(task, now) {
+			sb.WriteString(" (overdue)")
+		}
+	}
+	if task.Reminder != "" && !task.Done {
+		sb.WriteString(" ⏰")
+	}
+	if task.Notes != "" {
+		sb.WriteString("\n  " + utils.Truncate(strings.ReplaceAll(task.Notes, "\n", " "), 120))
+	}
+	return sb.String()
+}
+
+func (t *TasksTool) formatDue(task tasks.Task) string {
+	if task.DueTime {
+		return task.Due.In(t.loc).Format("Mon Jan 2 15:04")
+	}
+	return task.Due.In(t.loc).Format("Mon Jan 2")
+}
+
+// overdue reports whether an open task is past due: past its time, or,
+// for one due on a date, past that day.
+func (t *TasksTool) overdue(task tasks.Task, now time.Time) bool {
+	if task.Done || task.Due.IsZero() {
+		return false
+	}
+	if task.DueTime {
+		return task.Due.Before(now)
+	}
+	return !now.Before(task.Due.In(t.loc).AddDate(0, 0, 1))
+}
+
+// remindBefore reads the remind_before argument.
+func remindBefore(args map[string]interface{}) time.Duration {
+	minutes, _ := args["remind_before"].(float64)
+	return time.Duration(minutes * float64(time.Minute))
+}
+
+// parseTaskDue reads a due date, which is the start of the day in loc,
+// or a date and time, as the reminder tool reads them.
+func parseTaskDue(s string, now time.Time, loc *time.Location) (time.Time, bool, error) {
+	s = strings.ToLower(strings.Join(strings.Fields(s), " "))
+	local := now.In(loc)
+	day := func(t time.Time) time.Time { return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc) }
+	switch s {
+	case "today":
+		return day(local), false, nil
+	case "tomorrow":
+		return day(local.AddDate(0, 0, 1)), false, nil
+	}
+	if d, err := time.ParseInLocation("2006-01-02", s, loc); err == nil {
+		return d, false, nil
+	}
+	for wd := time.Sunday; wd <= time.Saturday; wd++ {
+		name := strings.ToLower(wd.String())
+		if s == name || s == name[:3] || s == "next "+name {
+			ahead := (int(wd) - int(local.Weekday()) + 7) % 7
+			if ahead == 0 {
+				ahead = 7
+			}
+			return day(local.AddDate(0, 0, ahead)), false, nil
+		}
+	}
+	due, err := parseReminderTime(s, now, loc)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("cannot read due date %q: use e.g. tomorrow, friday, 2026-10-20 or 2026-10-20 17:00", s)
+	}
+	return due, true, nil
+}
@@ -0,0 +1,114 @@
+package tools
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/tasks"
+)
+
+// TestParseTaskDue verifies due dates and date-times are read in the
+// user's zone.
+func TestParseTaskDue(t *testing.T) {
+	// Saturday 17 October 2026, 18:30
+	now := time.Date(2026, 10, 17, 18, 30, 0, 0, time.UTC)
+	tests := []struct {
+		in       string
+		want     string
+		wantTime bool
+	}{
+		{"today", "2026-10-17 00:00", false},
+		{"Tomorrow", "2026-10-18 00:00", false},
+		{"friday", "2026-10-23 00:00", false},
+		{"sat", "2026-10-24 00:00", false},
+		{"2026-11-02", "2026-11-02 00:00", false},
+		{"tomorrow 17:00", "2026-10-18 17:00", true},
+		{"2026-10-20 9:30am", "2026-10-20 09:30", true},
+	}
+	for _, tt := range tests {
+		due, hasTime, err := parseTaskDue(tt.in, now, time.UTC)
+		if err != nil || due.Format("2006-01-02 15:04") != tt.want || hasTime != tt.wantTime {
+			t.Errorf("%q: expected %s (time %v), got %s (time %v) %v", tt.in, tt.want, tt.wantTime, due.Format("2006-01-02 15:04"), hasTime, err)
+		}
+	}
+	if _, _, err := parseTaskDue("someday", now, time.UTC); err == nil {
+		t.Error("Expected an unreadable date refused")
+	}
+}
+
+// TestTasksTool verifies tasks are added with reminders, listed, moved and
+// completed, and that completing cancels the reminder.
+func TestTasksTool(t *testing.T) {
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 is not installed")
+	}
+	dir := t.TempDir()
+	store, err := tasks.Open(filepath.Join(dir, "tasks.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cronService := cron.NewCronService(filepath.Join(dir, "jobs.json"), nil)
+	tool := NewTasksTool(store, nil, cronService, time.UTC)
+	tool.now = func() time.Time { return time.Date(2026, 10, 17, 18, 30, 0, 0, time.UTC) }
+	tool.SetContext("telegram", "42")
+	ctx := context.Background()
+
+	result := tool.Execute(ctx, map[string]interface{}{
+		"action": "add", "title": "Call the plumber", "due": "2026-10-19 17:00", "priority": "high", "remind_before": float64(30),
+	})
+	if result.IsError || result.ForLLM != "Added task #1: Call the plumber (due Mon Oct 19 17:00, high priority); reminder at Mon Oct 19 16:30" {
+		t.Fatalf("Unexpected result %q", result.ForLLM)
+	}
+	jobs := cronService.ListJobs(false)
+	if len(jobs) != 1 || jobs[0].Payload.Kind != cron.PayloadReminder || jobs[0].Payload.To != "42" ||
+		jobs[0].Payload.Message != "Call the plumber (task #1, due Mon Oct 19 17:00)" {
+		t.Fatalf("Expected a reminder job, got %+v", jobs)
+	}
+	tool.Execute(ctx, map[string]interface{}{"action": "add", "title": "Renew passport", "due": "today"})
+	tool.Execute(ctx, map[string]interface{}{"action": "add", "title": "Read a book", "notes": "The one from Anna"})
+	if len(cronService.ListJobs(false)) != 1 {
+		t.Error("Expected no reminder for tasks without a due time")
+	}
+
+	result = tool.Execute(ctx, map[string]interface{}{})
+	want := "Tasks (times in UTC):\n" +
+		"- #2 Renew passport — due Sat Oct 17\n" +
+		"- #1 [high] Call the plumber — due Mon Oct 19 17:00 ⏰\n" +
+		"- #3 Read a book\n  The one from Anna\n"
+	if result.ForLLM != want {
+		t.Errorf("Unexpected list:\n%s", result.ForLLM)
+	}
+	if result := tool.Execute(ctx, map[string]interface{}{"filter": "today"}); !strings.Contains(result.ForLLM, "#2") || strings.Contains(result.ForLLM, "#1") {
+		t.Errorf("Expected only the task due today, got %q", result.ForLLM)
+	}
+	if result := tool.Execute(ctx, map[string]interface{}{"filter": "overdue"}); result.ForLLM != "No tasks overdue" {
+		t.Errorf("Expected a task due today not to be overdue yet, got %q", result.ForLLM)
+	}
+
+	result = tool.Execute(ctx, map[string]interface{}{"action": "update", "id": float64(1), "due": "2026-10-20 08:00"})
+	if !strings.HasSuffix(result.ForLLM, "reminder at Tue Oct 20 08:00") {
+		t.Errorf("Expected the reminder moved with the task, got %q", result.ForLLM)
+	}
+	if jobs := cronService.ListJobs(false); len(jobs) != 1 || *jobs[0].Schedule.AtMS != time.Date(2026, 10, 20, 8, 0, 0, 0, time.UTC).UnixMilli() {
+		t.Errorf("Expected one reminder at the new time, got %+v", jobs)
+	}
+
+	result = tool.Execute(ctx, map[string]interface{}{"action": "complete", "id": float64(1)})
+	if result.IsError || len(cronService.ListJobs(true)) != 0 {
+		t.Errorf("Expected the task done and its reminder cancelled, got %q", result.ForLLM)
+	}
+	if result := tool.Execute(ctx, map[string]interface{}{"filter": "done"}); !strings.HasPrefix(result.ForLLM, "Tasks (times in UTC):\n- #1 ✓ [high] Call the plumber — done Sat Oct 17") {
+		t.Errorf("Unexpected done list %q", result.ForLLM)
+	}
+	if result := tool.Execute(ctx, map[string]interface{}{"action": "delete", "id": float64(7)}); !result.IsError {
+		t.Errorf("Expected a missing task refused, got %q", result.ForLLM)
+	}
+	if result := tool.Execute(ctx, map[string]interface{}{"action": "sync"}); !result.IsError {
+		t.Errorf("Expected sync refused without a remote, got %q", result.ForLLM)
+	}
+}
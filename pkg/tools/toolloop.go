@@ -21,8 +21,10 @@ type ToolLoopConfig struct {
 	Provider      providers.LLMProvider
 	Model         string
 	Tools         *ToolRegistry
+	Capabilities  *providers.CapabilityResolver // nil guesses from the model name
 	MaxIterations int
 	LLMOptions    map[string]any
+	Filter        ToolFilter // the tools offered and allowed; nil for all of Tools
 }
 
 // ToolLoopResult contains the result of running the tool loop.
@@ -49,7 +51,7 @@ func RunToolLoop(ctx context.Context, config ToolLoopConfig, messages []provider
 		// 1. Build tool definitions
 		var providerToolDefs []providers.ToolDefinition
 		if config.Tools != nil {
-			providerToolDefs = config.Tools.ToProviderDefs()
+			providerToolDefs = config.Tools.ToProviderDefsFiltered(config.Filter)
 		}
 
 		// 2. Set default LLM options
@@ -62,7 +64,8 @@ func RunToolLoop(ctx context.Context, config ToolLoopConfig, messages []provider
 		}
 
 		// 3. Call LLM
-		response, err := config.Provider.Chat(ctx, messages, providerToolDefs, config.Model, llmOpts)
+		caps := config.Capabilities.Resolve(ctx, config.Provider, config.Model)
+		response, err := providers.ChatWithCapabilities(ctx, config.Provider, caps, messages, providerToolDefs, config.Model, llmOpts)
 		if err != nil {
 			logger.ErrorCF("toolloop", "LLM call failed",
 				map[string]any{
@@ -117,15 +120,18 @@ func RunToolLoop(ctx context.Context, config ToolLoopConfig, messages []provider
 		for _, tc := range response.ToolCalls {
 			argsJSON, _ := json.Marshal(tc.Arguments)
 			argsPreview := utils.Truncate(string(argsJSON), 200)
-			logger.InfoCF("toolloop", fmt.Sprintf("Tool call: %s(%s)", tc.Name, argsPreview),
+			logger.InfoCF("toolloop", "Tool call",
 				map[string]any{
 					"tool":      tc.Name,
+					"arguments": argsPreview,
 					"iteration": iteration,
 				})
 
 			// Execute tool (no async callback for subagents - they run independently)
 			var toolResult *ToolResult
-			if config.Tools != nil {
+			if config.Filter != nil && !config.Filter(tc.Name) {
+				toolResult = ErrorResult(fmt.Sprintf("Tool %s is not available for this task", tc.Name))
+			} else if config.Tools != nil {
 				toolResult = config.Tools.ExecuteWithContext(ctx, tc.Name, tc.Arguments, channel, chatID, nil)
 			} else {
 				toolResult = ErrorResult("No tools available")
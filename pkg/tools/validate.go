@@ -0,0 +1,256 @@
+package tools
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// ErrInvalidArguments is the error of a call whose arguments don't match
+// the tool's schema.
+var ErrInvalidArguments = errors.New("invalid tool arguments")
+
+// maxArgProblems bounds how many problems a correction lists.
+const maxArgProblems = 10
+
+// ValidateArgs checks args against a tool's JSON schema: types, required
+// properties, enums, and the same for nested objects and array items. It
+// returns what is wrong, one problem per entry, or nil if args are valid.
+// Schema keywords it doesn't know are ignored.
+func ValidateArgs(schema map[string]interface{}, args map[string]interface{}) []string {
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	var problems []string
+	validateValue(schema, args, "", &problems)
+	if len(problems) > maxArgProblems {
+		problems = append(problems[:maxArgProblems], fmt.Sprintf("and %d more", len(problems)-maxArgProblems))
+	}
+	return problems
+}
+
+// invalidArgsResult tells the model what was wrong with its call and what
+// the tool expects, so it can call again with fixed arguments.
+func invalidArgsResult(name string, tool Tool, problems []string) *ToolResult {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Invalid arguments for %s, the tool was not run:\n", name)
+	for _, p := range problems {
+		fmt.Fprintf(&sb, "- %s\n", p)
+	}
+	if params, err := json.Marshal(tool.Parameters()); err == nil {
+		fmt.Fprintf(&sb, "Expected parameters: %s\n", params)
+	}
+	fmt.Fprintf(&sb, "Fix the arguments and call %s again.", name)
+	return ErrorResult(sb.String()).WithError(fmt.Errorf("%w: %s", ErrInvalidArguments, strings.Join(problems, "; ")))
+}
+
+// validateValue checks value against schema, adding problems for path.
+func validateValue(schema map[string]interface{}, value interface{}, path string, problems *[]string) {
+	if schema == nil {
+		return
+	}
+	if types := schemaTypes(schema["type"]); len(types) > 0 {
+		actual := jsonType(value)
+		ok := false
+		for _, t := range types {
+			if t == actual || (t == "number" && actual == "integer") {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			*problems = append(*problems, fmt.Sprintf("%s must be %s, got %s", describePath(path), strings.Join(types, " or "), describeValue(value)))
+			return
+		}
+	}
+
+	if enum, ok := schema["enum"]; ok {
+		if options := toSlice(enum); len(options) > 0 && !inEnum(value, options) {
+			*problems = append(*problems, fmt.Sprintf("%s must be one of %s, got %s", describePath(path), formatOptions(options), describeValue(value)))
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		validateObject(schema, v, path, problems)
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				validateValue(items, item, fmt.Sprintf("%s[%d]", path, i), problems)
+			}
+		}
+	}
+}
+
+// validateObject checks an object's required and declared properties, and
+// unknown ones if additionalProperties is false.
+func validateObject(schema map[string]interface{}, obj map[string]interface{}, path string, problems *[]string) {
+	props, _ := schema["properties"].(map[string]interface{})
+	for _, name := range toStrings(schema["required"]) {
+		if v, ok := obj[name]; !ok || v == nil {
+			*problems = append(*problems, fmt.Sprintf("%s is required", describePath(joinPath(path, name))))
+		}
+	}
+
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		prop, declared := props[name].(map[string]interface{})
+		if !declared {
+			if additional, ok := schema["additionalProperties"].(bool); ok && !additional {
+				*problems = append(*problems, fmt.Sprintf("%s is not a parameter", describePath(joinPath(path, name))))
+			}
+			continue
+		}
+		if obj[name] == nil {
+			// Models send null for optional arguments they leave out
+			continue
+		}
+		validateValue(prop, obj[name], joinPath(path, name), problems)
+	}
+}
+
+// schemaTypes reads "type", a name or a list of names.
+func schemaTypes(t interface{}) []string {
+	if s, ok := t.(string); ok {
+		return []string{s}
+	}
+	return toStrings(t)
+}
+
+// jsonType names value's JSON type; whole numbers are "integer".
+func jsonType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			return "integer"
+		}
+		return "number"
+	case float32:
+		return jsonType(float64(v))
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	}
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// inEnum reports whether value equals one of options, comparing numbers
+// by value.
+func inEnum(value interface{}, options []interface{}) bool {
+	for _, option := range options {
+		if reflect.DeepEqual(value, option) {
+			return true
+		}
+		if a, ok := toFloat(value); ok {
+			if b, ok := toFloat(option); ok && a == b {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	}
+	return 0, false
+}
+
+// toSlice returns the elements of a []interface{}, []string or other slice.
+func toSlice(v interface{}) []interface{} {
+	if s, ok := v.([]interface{}); ok {
+		return s
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		return nil
+	}
+	out := make([]interface{}, rv.Len())
+	for i := range out {
+		out[i] = rv.Index(i).Interface()
+	}
+	return out
+}
+
+func toStrings(v interface{}) []string {
+	var out []string
+	for _, e := range toSlice(v) {
+		if s, ok := e.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func describePath(path string) string {
+	if path == "" {
+		return "the arguments"
+	}
+	return fmt.Sprintf("%q", path)
+}
+
+// describeValue shows a value briefly, with its type, e.g. `string "5"`.
+func describeValue(value interface{}) string {
+	if value == nil {
+		return "null"
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return jsonType(value)
+	}
+	return jsonType(value) + " " + utils.Truncate(string(data), 40)
+}
+
+func formatOptions(options []interface{}) string {
+	parts := make([]string, len(options))
+	for i, o := range options {
+		data, _ := json.Marshal(o)
+		parts[i] = string(data)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,103 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+var validateSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path":  map[string]interface{}{"type": "string"},
+		"count": map[string]interface{}{"type": "integer"},
+		"ratio": map[string]interface{}{"type": "number"},
+		"mode":  map[string]interface{}{"type": "string", "enum": []string{"read", "write"}},
+		"tags":  map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+		"opts": map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{"force": map[string]interface{}{"type": "boolean"}},
+			"required":   []string{"force"},
+		},
+	},
+	"required": []string{"path"},
+}
+
+// TestValidateArgs verifies types, required fields, enums and nested values
+// are checked
+func TestValidateArgs(t *testing.T) {
+	valid := map[string]interface{}{
+		"path":  "a.txt",
+		"count": 3.0,
+		"ratio": 1.0,
+		"mode":  "read",
+		"tags":  []interface{}{"x"},
+		"opts":  map[string]interface{}{"force": true},
+		"extra": "ignored",
+		"unset": nil,
+	}
+	if problems := ValidateArgs(validateSchema, valid); problems != nil {
+		t.Errorf("Expected valid arguments, got %v", problems)
+	}
+
+	problems := ValidateArgs(validateSchema, map[string]interface{}{
+		"count": "3",
+		"ratio": 1.5,
+		"mode":  "delete",
+		"tags":  []interface{}{"x", 2.0},
+		"opts":  map[string]interface{}{},
+	})
+	want := []string{
+		`"path" is required`,
+		`"count" must be integer, got string "3"`,
+		`"mode" must be one of "read", "write", got string "delete"`,
+		`"opts.force" is required`,
+		`"tags[1]" must be string, got integer 2`,
+	}
+	if strings.Join(problems, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(problems, "\n"))
+	}
+
+	if problems := ValidateArgs(validateSchema, nil); len(problems) != 1 {
+		t.Errorf("Expected nil arguments to miss path, got %v", problems)
+	}
+}
+
+// TestRegistryRejectsInvalidArgs verifies the tool isn't run and the model
+// gets a correction
+func TestRegistryRejectsInvalidArgs(t *testing.T) {
+	r := NewToolRegistry()
+	tool := &schemaTool{}
+	r.Register(tool)
+
+	result := r.Execute(context.Background(), "schema_tool", map[string]interface{}{"count": "many"})
+	if tool.calls != 0 {
+		t.Error("Expected the tool not to run")
+	}
+	if !result.IsError || !errors.Is(result.Err, ErrInvalidArguments) {
+		t.Fatalf("Expected an invalid arguments error, got %+v", result)
+	}
+	for _, want := range []string{`"path" is required`, "Expected parameters:", "call schema_tool again"} {
+		if !strings.Contains(result.ForLLM, want) {
+			t.Errorf("Expected %q in the correction, got %q", want, result.ForLLM)
+		}
+	}
+
+	result = r.Execute(context.Background(), "schema_tool", map[string]interface{}{"path": "a.txt"})
+	if result.IsError || tool.calls != 1 {
+		t.Errorf("Expected valid arguments to run the tool, got %+v", result)
+	}
+}
+
+type schemaTool struct {
+	calls int
+}
+
+func (t *schemaTool) Name() string                       { return "schema_tool" }
+func (t *schemaTool) Description() string                { return "test" }
+func (t *schemaTool) Parameters() map[string]interface{} { return validateSchema }
+func (t *schemaTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	t.calls++
+	return NewToolResult("ok")
+}
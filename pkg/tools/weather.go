@@ -6,18 +6,98 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
+
+	"github.com/sipeed/picoclaw/pkg/geo"
+)
+
+// Weather units.
+const (
+	UnitsImperial = "imperial" // °F, mph
+	UnitsMetric   = "metric"   // °C, m/s
 )
 
+// WeatherProvider is a weather backend. Temperatures and wind speeds are
+// returned in the requested units. Failures of the service itself are
+// wrapped with Unavailable so the tool can be marked degraded.
+type WeatherProvider interface {
+	Name() string
+	Current(ctx context.Context, location, units string) (*CurrentWeather, error)
+	Forecast(ctx context.Context, location, units string) (*WeatherForecast, error)
+}
+
+// CurrentWeather is the conditions right now at a location.
+type CurrentWeather struct {
+	Location string
+	Temp     float64
+	Humidity int
+	Desc     string
+	Wind     float64
+}
+
+// WeatherForecast is a daily forecast starting today at the location.
+type WeatherForecast struct {
+	Location  string
+	UTCOffset time.Duration // of the location, to tell which day is today
+	Days      []DayForecast
+	MaxDays   int // how many days the backend can forecast, today included
+}
+
+// DayForecast summarizes one calendar day at the location.
+type DayForecast struct {
+	Date     time.Time // midnight UTC of the local date
+	Min, Max float64
+	Desc     string
+	Pop      float64 // chance of precipitation, 0..1
+	Wind     float64 // strongest wind of the day
+}
+
 type WeatherTool struct {
-	apiKey      string
-	defaultZip  string
+	provider        WeatherProvider
+	defaultLocation string
+	units           string
 }
 
-func NewWeatherTool(apiKey, defaultZip string) *WeatherTool {
+// NewWeatherTool returns a weather tool backed by provider. defaultLocation
+// is used when the model does not name a place.
+func NewWeatherTool(provider WeatherProvider, defaultLocation string) *WeatherTool {
 	return &WeatherTool{
-		apiKey:     apiKey,
-		defaultZip: defaultZip,
+		provider:        provider,
+		defaultLocation: defaultLocation,
+		units:           UnitsImperial,
+	}
+}
+
+// NewWeatherProvider returns the named backend: "openweathermap",
+// "open-meteo" or "wttr". An empty name picks OpenWeatherMap when an API
+// key is set and the keyless Open-Meteo otherwise. geocoder resolves
+// locations for Open-Meteo.
+func NewWeatherProvider(name, apiKey string, oneCall bool, geocoder *geo.Client) (WeatherProvider, error) {
+	switch strings.ToLower(name) {
+	case "":
+		if apiKey != "" {
+			return NewOpenWeatherMapProvider(apiKey, oneCall), nil
+		}
+		return NewOpenMeteoProvider(geocoder), nil
+	case "openweathermap", "owm":
+		if apiKey == "" {
+			return nil, fmt.Errorf("the openweathermap weather provider needs an api_key")
+		}
+		return NewOpenWeatherMapProvider(apiKey, oneCall), nil
+	case "open-meteo", "openmeteo":
+		return NewOpenMeteoProvider(geocoder), nil
+	case "wttr", "wttr.in":
+		return NewWttrProvider(), nil
+	}
+	return nil, fmt.Errorf("unknown weather provider %q: use openweathermap, open-meteo or wttr", name)
+}
+
+// SetUnits selects "imperial" (°F, mph) or "metric" (°C, m/s). Anything
+// else keeps the current units.
+func (t *WeatherTool) SetUnits(units string) {
+	if units == UnitsImperial || units == UnitsMetric {
+		t.units = units
 	}
 }
 
@@ -26,7 +106,7 @@ func (t *WeatherTool) Name() string {
 }
 
 func (t *WeatherTool) Description() string {
-	return "Get current weather for a location. Use ZIP code or city name. Defaults to home location if not specified."
+	return "Get the current weather or a daily forecast for a location. Use ZIP code or city name. Defaults to home location if not specified."
 }
 
 func (t *WeatherTool) Parameters() map[string]interface{} {
@@ -35,7 +115,21 @@ func (t *WeatherTool) Parameters() map[string]interface{} {
 		"properties": map[string]interface{}{
 			"location": map[string]interface{}{
 				"type":        "string",
-				"description": "ZIP code (e.g., '33547') or city name (e.g., 'Tampa,FL'). Optional - defaults to home.",
+				"description": "ZIP code (e.g., '33547'), city name (e.g., 'Tampa,FL') or coordinates (e.g., '27.95,-82.46', as returned by the location tool). Optional - defaults to home.",
+			},
+			"mode": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"current", "forecast"},
+				"description": "current conditions (default) or a daily forecast",
+			},
+			"when": map[string]interface{}{
+				"type":        "string",
+				"description": "For forecasts: 'today', 'tomorrow', '3-day', '7-day', a weekday ('saturday') or a date (YYYY-MM-DD). Setting it implies mode=forecast.",
+			},
+			"units": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{UnitsImperial, UnitsMetric},
+				"description": fmt.Sprintf("Optional units (default %s)", t.units),
 			},
 		},
 		"required": []string{},
@@ -45,73 +139,193 @@ func (t *WeatherTool) Parameters() map[string]interface{} {
 func (t *WeatherTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
 	location, _ := args["location"].(string)
 	if location == "" {
-		location = t.defaultZip
+		location = t.defaultLocation
+	}
+	if location == "" {
+		return ErrorResult("location is required: no home location is configured")
+	}
+	units := t.units
+	if u, _ := args["units"].(string); u == UnitsImperial || u == UnitsMetric {
+		units = u
+	}
+
+	mode, _ := args["mode"].(string)
+	when, _ := args["when"].(string)
+	when = strings.ToLower(strings.TrimSpace(when))
+	if mode == "forecast" || (when != "" && when != "now") {
+		return t.forecast(ctx, location, when, units)
+	}
+	return t.current(ctx, location, units)
+}
+
+// current reports the conditions right now.
+func (t *WeatherTool) current(ctx context.Context, location, units string) *ToolResult {
+	weather, err := t.provider.Current(ctx, location, units)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+
+	desc := weather.Desc
+	if desc == "" {
+		desc = "unknown"
+	}
+	temp, speed := unitSymbols(units)
+	result := fmt.Sprintf("%s: %.0f%s, %d%% humidity, %s, wind %.0f %s",
+		weather.Location, weather.Temp, temp, weather.Humidity, desc, weather.Wind, speed)
+
+	return UserResult(result).WithData(map[string]interface{}{
+		"location":    weather.Location,
+		"units":       units,
+		"temperature": weather.Temp,
+		"humidity":    weather.Humidity,
+		"description": weather.Desc,
+		"wind":        weather.Wind,
+	})
+}
+
+// forecast reports the days selected by when.
+func (t *WeatherTool) forecast(ctx context.Context, location, when, units string) *ToolResult {
+	fc, err := t.provider.Forecast(ctx, location, units)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	days := fc.Days
+
+	today := time.Now().UTC().Add(fc.UTCOffset).Truncate(24 * time.Hour)
+	start, count, err := parseWhen(when, today)
+	if err != nil {
+		return ErrorResult(err.Error())
 	}
 
-	// Build API URL
-	var apiURL string
-	if len(location) == 5 && isNumeric(location) {
-		// ZIP code
-		apiURL = fmt.Sprintf("https://api.openweathermap.org/data/2.5/weather?zip=%s,us&units=imperial&appid=%s",
-			location, t.apiKey)
-	} else {
-		// City name
-		apiURL = fmt.Sprintf("https://api.openweathermap.org/data/2.5/weather?q=%s&units=imperial&appid=%s",
-			location, t.apiKey)
+	var lines []string
+	var data []map[string]interface{}
+	for _, d := range days {
+		if d.Date.Before(start) || !d.Date.Before(start.AddDate(0, 0, count)) {
+			continue
+		}
+		lines = append(lines, formatDay(d, today, units))
+		data = append(data, map[string]interface{}{
+			"date":                 d.Date.Format("2006-01-02"),
+			"min":                  d.Min,
+			"max":                  d.Max,
+			"description":          d.Desc,
+			"precipitation_chance": d.Pop,
+			"wind":                 d.Wind,
+		})
+	}
+	if len(lines) == 0 {
+		return ErrorResult(fmt.Sprintf("no forecast available for %s; forecasts reach %d days ahead", whenLabel(when), fc.MaxDays-1))
 	}
 
+	result := fmt.Sprintf("%s forecast:\n%s", fc.Location, strings.Join(lines, "\n"))
+	if last := start.AddDate(0, 0, count-1); len(days) > 0 && last.After(days[len(days)-1].Date) {
+		result += fmt.Sprintf("\n(The forecast only reaches %s.)", days[len(days)-1].Date.Format("Mon Jan 2"))
+	}
+	return UserResult(result).WithData(map[string]interface{}{
+		"location": fc.Location,
+		"units":    units,
+		"days":     data,
+	})
+}
+
+// getWeatherJSON fetches url for backend and decodes the JSON body into v.
+// Transport failures, server errors and rejected keys are marked as backend
+// failures; other statuses are reported with the body.
+func getWeatherJSON(ctx context.Context, backend, apiURL string, v interface{}) error {
 	client := &http.Client{Timeout: 10 * time.Second}
 	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
 	if err != nil {
-		return ErrorResult(fmt.Sprintf("failed to create request: %v", err))
+		return fmt.Errorf("failed to create request: %w", err)
 	}
+	req.Header.Set("User-Agent", "picoclaw")
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return ErrorResult(fmt.Sprintf("weather request failed: %v", err))
+		return fmt.Errorf("weather request failed: %w", Unavailable(backend, err))
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return ErrorResult(fmt.Sprintf("failed to read response: %v", err))
+		return fmt.Errorf("failed to read response: %w", err)
 	}
 
 	if resp.StatusCode != 200 {
-		return ErrorResult(fmt.Sprintf("weather API error: %s", string(body)))
+		msg := strings.TrimSpace(string(body))
+		if resp.StatusCode >= 500 || resp.StatusCode == http.StatusUnauthorized {
+			// The service is down or the key is bad; other calls will fail too
+			return Unavailable(backend, fmt.Errorf("status %d: %s", resp.StatusCode, msg))
+		}
+		return fmt.Errorf("%s error: %s", backend, msg)
 	}
-
-	var weather struct {
-		Name string `json:"name"`
-		Main struct {
-			Temp     float64 `json:"temp"`
-			Humidity int     `json:"humidity"`
-		} `json:"main"`
-		Weather []struct {
-			Description string `json:"description"`
-		} `json:"weather"`
-		Wind struct {
-			Speed float64 `json:"speed"`
-		} `json:"wind"`
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("failed to parse %s response: %w", backend, err)
 	}
+	return nil
+}
 
-	if err := json.Unmarshal(body, &weather); err != nil {
-		return ErrorResult(fmt.Sprintf("failed to parse weather: %v", err))
+// parseWhen maps a when argument to the first day and number of days to
+// report, relative to today at the location.
+func parseWhen(when string, today time.Time) (time.Time, int, error) {
+	switch when {
+	case "", "today":
+		return today, 1, nil
+	case "tomorrow":
+		return today.AddDate(0, 0, 1), 1, nil
+	case "3-day", "3day", "3 days", "3":
+		return today, 3, nil
+	case "7-day", "7day", "7 days", "7", "week":
+		return today, 7, nil
+	}
+	for i := 0; i < 7; i++ {
+		day := today.AddDate(0, 0, i)
+		if strings.ToLower(day.Weekday().String()) == when {
+			return day, 1, nil
+		}
+	}
+	if date, err := time.Parse("2006-01-02", when); err == nil {
+		return date, 1, nil
 	}
+	return time.Time{}, 0, fmt.Errorf("unknown when %q: use today, tomorrow, 3-day, 7-day, a weekday or YYYY-MM-DD", when)
+}
 
-	desc := "unknown"
-	if len(weather.Weather) > 0 {
-		desc = weather.Weather[0].Description
+func whenLabel(when string) string {
+	if when == "" {
+		return "today"
 	}
+	return when
+}
 
-	result := fmt.Sprintf("%s: %.0f°F, %d%% humidity, %s, wind %.0f mph",
-		weather.Name, weather.Main.Temp, weather.Main.Humidity, desc, weather.Wind.Speed)
+// formatDay renders one day, e.g. "Tomorrow (Sat Oct 18): 54-68°F, light
+// rain, 40% chance of precipitation, wind up to 12 mph".
+func formatDay(d DayForecast, today time.Time, units string) string {
+	label := d.Date.Format("Mon Jan 2")
+	switch {
+	case d.Date.Equal(today):
+		label = "Today (" + label + ")"
+	case d.Date.Equal(today.AddDate(0, 0, 1)):
+		label = "Tomorrow (" + label + ")"
+	}
+	temp, speed := unitSymbols(units)
+	desc := d.Desc
+	if desc == "" {
+		desc = "unknown"
+	}
+	return fmt.Sprintf("%s: %.0f-%.0f%s, %s, %.0f%% chance of precipitation, wind up to %.0f %s",
+		label, d.Min, d.Max, temp, desc, d.Pop*100, d.Wind, speed)
+}
 
-	return &ToolResult{
-		ForLLM:  result,
-		ForUser: result,
-		IsError: false,
+// unitSymbols returns the temperature and wind speed units for units.
+func unitSymbols(units string) (temp, speed string) {
+	if units == UnitsMetric {
+		return "°C", "m/s"
 	}
+	return "°F", "mph"
+}
+
+// isUSZip reports whether location is a 5-digit US ZIP code.
+func isUSZip(location string) bool {
+	return len(location) == 5 && isNumeric(location)
 }
 
 func isNumeric(s string) bool {
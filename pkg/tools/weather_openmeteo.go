@@ -0,0 +1,177 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/geo"
+)
+
+// openMeteoForecastDays is how many days are requested from Open-Meteo.
+const openMeteoForecastDays = 7
+
+// OpenMeteoProvider reads Open-Meteo, which needs no API key. Locations
+// are resolved with the shared geocoder.
+type OpenMeteoProvider struct {
+	baseURL  string
+	geocoder *geo.Client
+}
+
+// NewOpenMeteoProvider returns an Open-Meteo backend resolving locations
+// with geocoder, or with a client of its own if geocoder is nil.
+func NewOpenMeteoProvider(geocoder *geo.Client) *OpenMeteoProvider {
+	if geocoder == nil {
+		geocoder = geo.NewClient()
+	}
+	return &OpenMeteoProvider{
+		baseURL:  "https://api.open-meteo.com",
+		geocoder: geocoder,
+	}
+}
+
+func (p *OpenMeteoProvider) Name() string {
+	return "open-meteo"
+}
+
+func (p *OpenMeteoProvider) Current(ctx context.Context, location, units string) (*CurrentWeather, error) {
+	place, err := p.geocode(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+	query := p.query(place, units)
+	query.Set("current", "temperature_2m,relative_humidity_2m,weather_code,wind_speed_10m")
+	var resp struct {
+		Current struct {
+			Temp     float64 `json:"temperature_2m"`
+			Humidity float64 `json:"relative_humidity_2m"`
+			Code     int     `json:"weather_code"`
+			Wind     float64 `json:"wind_speed_10m"`
+		} `json:"current"`
+	}
+	if err := getWeatherJSON(ctx, p.Name(), p.baseURL+"/v1/forecast?"+query.Encode(), &resp); err != nil {
+		return nil, err
+	}
+	return &CurrentWeather{
+		Location: place.Label(),
+		Temp:     resp.Current.Temp,
+		Humidity: int(resp.Current.Humidity),
+		Desc:     wmoDescription(resp.Current.Code),
+		Wind:     resp.Current.Wind,
+	}, nil
+}
+
+func (p *OpenMeteoProvider) Forecast(ctx context.Context, location, units string) (*WeatherForecast, error) {
+	place, err := p.geocode(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+	query := p.query(place, units)
+	query.Set("daily", "weather_code,temperature_2m_min,temperature_2m_max,precipitation_probability_max,wind_speed_10m_max")
+	query.Set("forecast_days", fmt.Sprint(openMeteoForecastDays))
+	var resp struct {
+		UTCOffset int `json:"utc_offset_seconds"`
+		Daily     struct {
+			Time []string  `json:"time"`
+			Code []int     `json:"weather_code"`
+			Min  []float64 `json:"temperature_2m_min"`
+			Max  []float64 `json:"temperature_2m_max"`
+			Pop  []float64 `json:"precipitation_probability_max"`
+			Wind []float64 `json:"wind_speed_10m_max"`
+		} `json:"daily"`
+	}
+	if err := getWeatherJSON(ctx, p.Name(), p.baseURL+"/v1/forecast?"+query.Encode(), &resp); err != nil {
+		return nil, err
+	}
+
+	fc := &WeatherForecast{
+		Location:  place.Label(),
+		UTCOffset: time.Duration(resp.UTCOffset) * time.Second,
+		MaxDays:   openMeteoForecastDays,
+	}
+	daily := resp.Daily
+	for i, day := range daily.Time {
+		date, err := time.Parse("2006-01-02", day)
+		if err != nil {
+			continue
+		}
+		d := DayForecast{Date: date}
+		if i < len(daily.Code) {
+			d.Desc = wmoDescription(daily.Code[i])
+		}
+		if i < len(daily.Min) && i < len(daily.Max) {
+			d.Min, d.Max = daily.Min[i], daily.Max[i]
+		}
+		if i < len(daily.Pop) {
+			d.Pop = daily.Pop[i] / 100
+		}
+		if i < len(daily.Wind) {
+			d.Wind = daily.Wind[i]
+		}
+		fc.Days = append(fc.Days, d)
+	}
+	return fc, nil
+}
+
+// query returns the forecast parameters shared by current and daily calls.
+func (p *OpenMeteoProvider) query(place geo.Place, units string) url.Values {
+	query := url.Values{}
+	query.Set("latitude", fmt.Sprintf("%f", place.Lat))
+	query.Set("longitude", fmt.Sprintf("%f", place.Lon))
+	query.Set("timezone", "auto")
+	if units == UnitsMetric {
+		query.Set("wind_speed_unit", "ms")
+	} else {
+		query.Set("temperature_unit", "fahrenheit")
+		query.Set("wind_speed_unit", "mph")
+	}
+	return query
+}
+
+// geocode resolves location, marking geocoding service failures as
+// backend failures.
+func (p *OpenMeteoProvider) geocode(ctx context.Context, location string) (geo.Place, error) {
+	place, err := p.geocoder.Search(ctx, location)
+	if err != nil && !errors.Is(err, geo.ErrNotFound) {
+		return geo.Place{}, Unavailable("geocoding", err)
+	}
+	return place, err
+}
+
+// wmoDescription describes a WMO weather interpretation code as used by
+// Open-Meteo.
+func wmoDescription(code int) string {
+	switch {
+	case code == 0:
+		return "clear sky"
+	case code == 1:
+		return "mainly clear"
+	case code == 2:
+		return "partly cloudy"
+	case code == 3:
+		return "overcast"
+	case code == 45 || code == 48:
+		return "fog"
+	case code >= 51 && code <= 57:
+		return "drizzle"
+	case code == 61 || code == 80:
+		return "light rain"
+	case code == 63 || code == 81:
+		return "rain"
+	case code == 65 || code == 82:
+		return "heavy rain"
+	case code == 66 || code == 67:
+		return "freezing rain"
+	case code == 71 || code == 85:
+		return "light snow"
+	case code == 73 || code == 75 || code == 77 || code == 86:
+		return "snow"
+	case code == 95:
+		return "thunderstorm"
+	case code == 96 || code == 99:
+		return "thunderstorm with hail"
+	}
+	return ""
+}
@@ -0,0 +1,214 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/geo"
+)
+
+// owmForecastDays is how far ahead the free 3-hour forecast endpoint reaches.
+const owmForecastDays = 5
+
+// OpenWeatherMapProvider reads the OpenWeatherMap API, which needs a key.
+type OpenWeatherMapProvider struct {
+	apiKey  string
+	oneCall bool // daily forecasts from One Call 3.0, which needs its own subscription
+	baseURL string
+}
+
+// NewOpenWeatherMapProvider returns an OpenWeatherMap backend. With oneCall,
+// forecasts use the One Call 3.0 API, which covers 8 days instead of the 5
+// of the free forecast endpoint.
+func NewOpenWeatherMapProvider(apiKey string, oneCall bool) *OpenWeatherMapProvider {
+	return &OpenWeatherMapProvider{
+		apiKey:  apiKey,
+		oneCall: oneCall,
+		baseURL: "https://api.openweathermap.org",
+	}
+}
+
+func (p *OpenWeatherMapProvider) Name() string {
+	return "openweathermap"
+}
+
+// owmCurrent is the part of the current weather response we use.
+type owmCurrent struct {
+	Name  string `json:"name"`
+	Coord struct {
+		Lat float64 `json:"lat"`
+		Lon float64 `json:"lon"`
+	} `json:"coord"`
+	Main struct {
+		Temp     float64 `json:"temp"`
+		Humidity int     `json:"humidity"`
+	} `json:"main"`
+	Weather []struct {
+		Description string `json:"description"`
+	} `json:"weather"`
+	Wind struct {
+		Speed float64 `json:"speed"`
+	} `json:"wind"`
+}
+
+func (p *OpenWeatherMapProvider) Current(ctx context.Context, location, units string) (*CurrentWeather, error) {
+	current, err := p.fetchCurrent(ctx, location, units)
+	if err != nil {
+		return nil, err
+	}
+	weather := &CurrentWeather{
+		Location: current.Name,
+		Temp:     current.Main.Temp,
+		Humidity: current.Main.Humidity,
+		Wind:     current.Wind.Speed,
+	}
+	if len(current.Weather) > 0 {
+		weather.Desc = current.Weather[0].Description
+	}
+	return weather, nil
+}
+
+func (p *OpenWeatherMapProvider) fetchCurrent(ctx context.Context, location, units string) (*owmCurrent, error) {
+	var current owmCurrent
+	if err := p.get(ctx, "/data/2.5/weather", p.locationQuery(location, units), &current); err != nil {
+		return nil, err
+	}
+	return &current, nil
+}
+
+func (p *OpenWeatherMapProvider) Forecast(ctx context.Context, location, units string) (*WeatherForecast, error) {
+	if p.oneCall {
+		return p.fetchOneCall(ctx, location, units)
+	}
+	return p.fetch3Hourly(ctx, location, units)
+}
+
+// fetch3Hourly builds daily summaries from the free 5-day/3-hour forecast.
+func (p *OpenWeatherMapProvider) fetch3Hourly(ctx context.Context, location, units string) (*WeatherForecast, error) {
+	var resp struct {
+		List []struct {
+			Dt   int64 `json:"dt"`
+			Main struct {
+				TempMin float64 `json:"temp_min"`
+				TempMax float64 `json:"temp_max"`
+			} `json:"main"`
+			Weather []struct {
+				Description string `json:"description"`
+			} `json:"weather"`
+			Wind struct {
+				Speed float64 `json:"speed"`
+			} `json:"wind"`
+			Pop float64 `json:"pop"`
+		} `json:"list"`
+		City struct {
+			Name     string `json:"name"`
+			Timezone int    `json:"timezone"`
+		} `json:"city"`
+	}
+	if err := p.get(ctx, "/data/2.5/forecast", p.locationQuery(location, units), &resp); err != nil {
+		return nil, err
+	}
+
+	fc := &WeatherForecast{
+		Location:  resp.City.Name,
+		UTCOffset: time.Duration(resp.City.Timezone) * time.Second,
+		MaxDays:   owmForecastDays,
+	}
+	descCounts := map[time.Time]map[string]int{}
+	for _, item := range resp.List {
+		date := time.Unix(item.Dt, 0).UTC().Add(fc.UTCOffset).Truncate(24 * time.Hour)
+		if len(fc.Days) == 0 || !fc.Days[len(fc.Days)-1].Date.Equal(date) {
+			fc.Days = append(fc.Days, DayForecast{Date: date, Min: item.Main.TempMin, Max: item.Main.TempMax})
+			descCounts[date] = map[string]int{}
+		}
+		d := &fc.Days[len(fc.Days)-1]
+		d.Min = min(d.Min, item.Main.TempMin)
+		d.Max = max(d.Max, item.Main.TempMax)
+		d.Pop = max(d.Pop, item.Pop)
+		d.Wind = max(d.Wind, item.Wind.Speed)
+		if len(item.Weather) > 0 {
+			desc := item.Weather[0].Description
+			descCounts[date][desc]++
+			if descCounts[date][desc] > descCounts[date][d.Desc] {
+				d.Desc = desc
+			}
+		}
+	}
+	return fc, nil
+}
+
+// fetchOneCall gets daily forecasts from One Call 3.0, which takes
+// coordinates, so the location is looked up with a current weather call.
+func (p *OpenWeatherMapProvider) fetchOneCall(ctx context.Context, location, units string) (*WeatherForecast, error) {
+	current, err := p.fetchCurrent(ctx, location, units)
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{}
+	query.Set("lat", fmt.Sprintf("%f", current.Coord.Lat))
+	query.Set("lon", fmt.Sprintf("%f", current.Coord.Lon))
+	query.Set("exclude", "current,minutely,hourly,alerts")
+	query.Set("units", units)
+	var resp struct {
+		TimezoneOffset int `json:"timezone_offset"`
+		Daily          []struct {
+			Dt   int64 `json:"dt"`
+			Temp struct {
+				Min float64 `json:"min"`
+				Max float64 `json:"max"`
+			} `json:"temp"`
+			Weather []struct {
+				Description string `json:"description"`
+			} `json:"weather"`
+			WindSpeed float64 `json:"wind_speed"`
+			Pop       float64 `json:"pop"`
+		} `json:"daily"`
+	}
+	if err := p.get(ctx, "/data/3.0/onecall", query, &resp); err != nil {
+		return nil, err
+	}
+
+	fc := &WeatherForecast{
+		Location:  current.Name,
+		UTCOffset: time.Duration(resp.TimezoneOffset) * time.Second,
+		MaxDays:   8,
+	}
+	for _, item := range resp.Daily {
+		d := DayForecast{
+			Date: time.Unix(item.Dt, 0).UTC().Add(fc.UTCOffset).Truncate(24 * time.Hour),
+			Min:  item.Temp.Min,
+			Max:  item.Temp.Max,
+			Pop:  item.Pop,
+			Wind: item.WindSpeed,
+		}
+		if len(item.Weather) > 0 {
+			d.Desc = item.Weather[0].Description
+		}
+		fc.Days = append(fc.Days, d)
+	}
+	return fc, nil
+}
+
+// get calls an OpenWeatherMap endpoint and decodes the response into v.
+func (p *OpenWeatherMapProvider) get(ctx context.Context, path string, query url.Values, v interface{}) error {
+	query.Set("appid", p.apiKey)
+	return getWeatherJSON(ctx, "weather API", p.baseURL+path+"?"+query.Encode(), v)
+}
+
+// locationQuery selects the location by coordinates, US ZIP code or city
+// name.
+func (p *OpenWeatherMapProvider) locationQuery(location, units string) url.Values {
+	query := url.Values{}
+	if lat, lon, ok := geo.ParseCoordinates(location); ok {
+		query.Set("lat", fmt.Sprintf("%f", lat))
+		query.Set("lon", fmt.Sprintf("%f", lon))
+	} else if isUSZip(location) {
+		query.Set("zip", location+",us")
+	} else {
+		query.Set("q", location)
+	}
+	query.Set("units", units)
+	return query
+}
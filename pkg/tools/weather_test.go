@@ -0,0 +1,163 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/geo"
+)
+
+// TestWeatherTool_Forecast verifies 3-hour forecasts are summarized per
+// day and "tomorrow" selects only the next day, in the requested units.
+func TestWeatherTool_Forecast(t *testing.T) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	var gotUnits string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/data/2.5/forecast" {
+			http.NotFound(w, r)
+			return
+		}
+		gotUnits = r.URL.Query().Get("units")
+		var items []string
+		for day := 0; day < 3; day++ {
+			for _, hour := range []int{6, 12, 18} {
+				dt := today.AddDate(0, 0, day).Add(time.Duration(hour) * time.Hour).Unix()
+				desc := "clear sky"
+				if day == 1 && hour != 18 {
+					desc = "light rain"
+				}
+				items = append(items, fmt.Sprintf(`{"dt":%d,"main":{"temp_min":%d,"temp_max":%d},"weather":[{"description":%q}],"wind":{"speed":%d},"pop":0.%d}`,
+					dt, 10+hour/6, 12+hour/2, desc, hour/3, hour/6))
+			}
+		}
+		fmt.Fprintf(w, `{"list":[%s],"city":{"name":"Testville","timezone":0}}`, strings.Join(items, ","))
+	}))
+	defer server.Close()
+
+	provider := NewOpenWeatherMapProvider("key", false)
+	provider.baseURL = server.URL
+	tool := NewWeatherTool(provider, "")
+	tool.SetUnits(UnitsMetric)
+
+	result := tool.Execute(context.Background(), map[string]interface{}{"location": "Testville", "when": "tomorrow"})
+	if result.IsError {
+		t.Fatalf("Expected a forecast, got error: %s", result.ForLLM)
+	}
+	if gotUnits != UnitsMetric {
+		t.Errorf("Expected metric units to be requested, got %q", gotUnits)
+	}
+	want := "Tomorrow (" + today.AddDate(0, 0, 1).Format("Mon Jan 2") + "): 11-21°C, light rain, 30% chance of precipitation, wind up to 6 m/s"
+	if !strings.Contains(result.ForLLM, want) {
+		t.Errorf("Expected %q in the forecast, got %q", want, result.ForLLM)
+	}
+	if strings.Contains(result.ForLLM, "Today") {
+		t.Errorf("Expected only tomorrow, got %q", result.ForLLM)
+	}
+
+	result = tool.Execute(context.Background(), map[string]interface{}{"location": "Testville", "when": "7-day"})
+	if lines := strings.Count(result.ForLLM, "\n"); lines != 4 || !strings.Contains(result.ForLLM, "only reaches") {
+		t.Errorf("Expected 3 days and a note that the forecast is shorter, got %q", result.ForLLM)
+	}
+}
+
+// TestOpenMeteoProvider verifies the keyless backend geocodes "City,ST"
+// to the right state, caches the lookup and reports in the chosen units.
+func TestOpenMeteoProvider(t *testing.T) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	geocodes := 0
+	var forecastQuery url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/search":
+			geocodes++
+			fmt.Fprint(w, `{"results":[
+				{"name":"Springfield","latitude":39.8,"longitude":-89.6,"country_code":"US","country":"United States","admin1":"Illinois"},
+				{"name":"Springfield","latitude":37.2,"longitude":-93.3,"country_code":"US","country":"United States","admin1":"Missouri"}]}`)
+		case "/v1/forecast":
+			forecastQuery = r.URL.Query()
+			if forecastQuery.Get("current") != "" {
+				fmt.Fprint(w, `{"current":{"temperature_2m":71.6,"relative_humidity_2m":40,"weather_code":2,"wind_speed_10m":5.1}}`)
+				return
+			}
+			fmt.Fprintf(w, `{"utc_offset_seconds":0,"daily":{"time":[%q,%q],"weather_code":[0,63],"temperature_2m_min":[50,55],"temperature_2m_max":[68,60],"precipitation_probability_max":[0,80],"wind_speed_10m_max":[7,14]}}`,
+				today.Format("2006-01-02"), today.AddDate(0, 0, 1).Format("2006-01-02"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	geocoder := geo.NewClient()
+	geocoder.GeocodeURL = server.URL
+	provider := NewOpenMeteoProvider(geocoder)
+	provider.baseURL = server.URL
+	tool := NewWeatherTool(provider, "Springfield,MO")
+
+	result := tool.Execute(context.Background(), map[string]interface{}{})
+	if want := "Springfield, Missouri: 72°F, 40% humidity, partly cloudy, wind 5 mph"; result.ForLLM != want {
+		t.Errorf("Expected %q, got %q", want, result.ForLLM)
+	}
+	if forecastQuery.Get("latitude") != "37.200000" || forecastQuery.Get("temperature_unit") != "fahrenheit" {
+		t.Errorf("Expected Missouri coordinates in fahrenheit, got %v", forecastQuery)
+	}
+
+	result = tool.Execute(context.Background(), map[string]interface{}{"when": "tomorrow", "units": UnitsMetric})
+	if !strings.Contains(result.ForLLM, "55-60°C, rain, 80% chance of precipitation, wind up to 14 m/s") {
+		t.Errorf("Expected tomorrow's forecast, got %q", result.ForLLM)
+	}
+	if forecastQuery.Get("wind_speed_unit") != "ms" {
+		t.Errorf("Expected metric wind speeds to be requested, got %v", forecastQuery)
+	}
+	if geocodes != 1 {
+		t.Errorf("Expected the location to be geocoded once, got %d lookups", geocodes)
+	}
+}
+
+// TestWttrUTCOffset verifies the location's offset is derived from the
+// local and UTC observation times, across midnight too.
+func TestWttrUTCOffset(t *testing.T) {
+	for _, tc := range []struct {
+		local, utc string
+		want       time.Duration
+	}{
+		{"2026-10-17 09:12 AM", "01:12 PM", -4 * time.Hour},
+		{"2026-10-17 01:30 AM", "08:00 PM", 5*time.Hour + 30*time.Minute},
+		{"2026-10-17 11:00 PM", "02:00 AM", -3 * time.Hour},
+	} {
+		if got := wttrUTCOffset(tc.local, tc.utc); got != tc.want {
+			t.Errorf("wttrUTCOffset(%q, %q) = %v, expected %v", tc.local, tc.utc, got, tc.want)
+		}
+	}
+}
+
+// TestParseWhen verifies the when argument is mapped to a day range.
+func TestParseWhen(t *testing.T) {
+	today := time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC) // a Saturday
+	for when, want := range map[string][2]int{
+		"":           {0, 1},
+		"tomorrow":   {1, 1},
+		"3-day":      {0, 3},
+		"7-day":      {0, 7},
+		"monday":     {2, 1},
+		"saturday":   {0, 1},
+		"2026-10-20": {3, 1},
+	} {
+		start, count, err := parseWhen(when, today)
+		if err != nil {
+			t.Errorf("parseWhen(%q) failed: %v", when, err)
+			continue
+		}
+		if offset := int(start.Sub(today).Hours() / 24); offset != want[0] || count != want[1] {
+			t.Errorf("parseWhen(%q) = +%d days for %d, expected +%d for %d", when, offset, count, want[0], want[1])
+		}
+	}
+	if _, _, err := parseWhen("someday", today); err == nil {
+		t.Error("Expected an error for an unknown when")
+	}
+}
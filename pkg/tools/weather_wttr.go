@@ -0,0 +1,191 @@
+package tools
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// wttrForecastDays is how many days wttr.in forecasts.
+const wttrForecastDays = 3
+
+// WttrProvider reads wttr.in, which needs no API key.
+type WttrProvider struct {
+	baseURL string
+}
+
+func NewWttrProvider() *WttrProvider {
+	return &WttrProvider{baseURL: "https://wttr.in"}
+}
+
+func (p *WttrProvider) Name() string {
+	return "wttr.in"
+}
+
+// wttrValue is wttr.in's wrapper for text fields.
+type wttrValue []struct {
+	Value string `json:"value"`
+}
+
+func (v wttrValue) String() string {
+	if len(v) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(v[0].Value)
+}
+
+// wttrResponse is the part of the j1 format we use. wttr.in reports every
+// number as a string.
+type wttrResponse struct {
+	CurrentCondition []struct {
+		TempC           string    `json:"temp_C"`
+		TempF           string    `json:"temp_F"`
+		Humidity        string    `json:"humidity"`
+		WeatherDesc     wttrValue `json:"weatherDesc"`
+		WindKmph        string    `json:"windspeedKmph"`
+		WindMiles       string    `json:"windspeedMiles"`
+		LocalObsTime    string    `json:"localObsDateTime"`
+		ObservationTime string    `json:"observation_time"`
+	} `json:"current_condition"`
+	NearestArea []struct {
+		AreaName wttrValue `json:"areaName"`
+		Region   wttrValue `json:"region"`
+	} `json:"nearest_area"`
+	Weather []struct {
+		Date     string `json:"date"`
+		MaxTempC string `json:"maxtempC"`
+		MaxTempF string `json:"maxtempF"`
+		MinTempC string `json:"mintempC"`
+		MinTempF string `json:"mintempF"`
+		Hourly   []struct {
+			ChanceOfRain string    `json:"chanceofrain"`
+			WindKmph     string    `json:"windspeedKmph"`
+			WindMiles    string    `json:"windspeedMiles"`
+			WeatherDesc  wttrValue `json:"weatherDesc"`
+		} `json:"hourly"`
+	} `json:"weather"`
+}
+
+func (p *WttrProvider) fetch(ctx context.Context, location string) (*wttrResponse, error) {
+	var resp wttrResponse
+	apiURL := p.baseURL + "/" + url.PathEscape(location) + "?format=j1"
+	if err := getWeatherJSON(ctx, p.Name(), apiURL, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// location names the area wttr.in matched, falling back to the query.
+func (r *wttrResponse) location(query string) string {
+	if len(r.NearestArea) == 0 {
+		return query
+	}
+	area := r.NearestArea[0]
+	name, region := area.AreaName.String(), area.Region.String()
+	if name == "" {
+		return query
+	}
+	if region != "" && region != name {
+		return name + ", " + region
+	}
+	return name
+}
+
+func (p *WttrProvider) Current(ctx context.Context, location, units string) (*CurrentWeather, error) {
+	resp, err := p.fetch(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+	weather := &CurrentWeather{Location: resp.location(location)}
+	if len(resp.CurrentCondition) > 0 {
+		c := resp.CurrentCondition[0]
+		weather.Temp = pickUnits(units, c.TempC, c.TempF)
+		weather.Wind = wttrWind(units, c.WindKmph, c.WindMiles)
+		weather.Humidity = int(atof(c.Humidity))
+		weather.Desc = strings.ToLower(c.WeatherDesc.String())
+	}
+	return weather, nil
+}
+
+func (p *WttrProvider) Forecast(ctx context.Context, location, units string) (*WeatherForecast, error) {
+	resp, err := p.fetch(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+	fc := &WeatherForecast{
+		Location: resp.location(location),
+		MaxDays:  wttrForecastDays,
+	}
+	if len(resp.CurrentCondition) > 0 {
+		c := resp.CurrentCondition[0]
+		fc.UTCOffset = wttrUTCOffset(c.LocalObsTime, c.ObservationTime)
+	}
+	for _, day := range resp.Weather {
+		date, err := time.Parse("2006-01-02", day.Date)
+		if err != nil {
+			continue
+		}
+		d := DayForecast{
+			Date: date,
+			Min:  pickUnits(units, day.MinTempC, day.MinTempF),
+			Max:  pickUnits(units, day.MaxTempC, day.MaxTempF),
+		}
+		descCounts := map[string]int{}
+		for _, hour := range day.Hourly {
+			d.Pop = max(d.Pop, atof(hour.ChanceOfRain)/100)
+			d.Wind = max(d.Wind, wttrWind(units, hour.WindKmph, hour.WindMiles))
+			desc := strings.ToLower(hour.WeatherDesc.String())
+			descCounts[desc]++
+			if descCounts[desc] > descCounts[d.Desc] {
+				d.Desc = desc
+			}
+		}
+		fc.Days = append(fc.Days, d)
+	}
+	return fc, nil
+}
+
+// wttrUTCOffset works out the location's offset from the local and UTC
+// times of the last observation, e.g. "2026-10-17 09:12 AM" and "01:12 PM".
+func wttrUTCOffset(localObs, utcObs string) time.Duration {
+	local, err := time.Parse("2006-01-02 03:04 PM", localObs)
+	if err != nil {
+		return 0
+	}
+	clock, err := time.Parse("03:04 PM", utcObs)
+	if err != nil {
+		return 0
+	}
+	utc := time.Date(local.Year(), local.Month(), local.Day(), clock.Hour(), clock.Minute(), 0, 0, time.UTC)
+	offset := local.Sub(utc)
+	switch {
+	case offset > 14*time.Hour:
+		offset -= 24 * time.Hour
+	case offset < -12*time.Hour:
+		offset += 24 * time.Hour
+	}
+	return offset.Round(15 * time.Minute)
+}
+
+// pickUnits returns the metric or imperial one of two numeric strings.
+func pickUnits(units, metric, imperial string) float64 {
+	if units == UnitsMetric {
+		return atof(metric)
+	}
+	return atof(imperial)
+}
+
+// wttrWind returns the wind speed in m/s or mph; wttr.in gives km/h.
+func wttrWind(units, kmph, miles string) float64 {
+	if units == UnitsMetric {
+		return atof(kmph) / 3.6
+	}
+	return atof(miles)
+}
+
+func atof(s string) float64 {
+	f, _ := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	return f
+}
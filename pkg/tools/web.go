@@ -11,6 +11,9 @@ import (
 	"regexp"
 	"strings"
 	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
 )
 
 const (
@@ -60,8 +63,8 @@ func (p *BraveSearchProvider) Search(ctx context.Context, query string, count in
 	}
 
 	if err := json.Unmarshal(body, &searchResp); err != nil {
-		// Log error body for debugging
-		fmt.Printf("Brave API Error Body: %s\n", string(body))
+		logger.DebugCF("web", "Unparseable Brave API response",
+			map[string]interface{}{"body": utils.Truncate(string(body), 500)})
 		return "", fmt.Errorf("failed to parse response: %w", err)
 	}
 
@@ -219,6 +222,11 @@ func (t *WebSearchTool) Name() string {
 	return "web_search"
 }
 
+// ConcurrencySafe reports true: searches change nothing.
+func (t *WebSearchTool) ConcurrencySafe() bool {
+	return true
+}
+
 func (t *WebSearchTool) Description() string {
 	return "Search the web for current information. Returns titles, URLs, and snippets from search results."
 }
@@ -257,7 +265,7 @@ func (t *WebSearchTool) Execute(ctx context.Context, args map[string]interface{}
 
 	result, err := t.provider.Search(ctx, query, count)
 	if err != nil {
-		return ErrorResult(fmt.Sprintf("search failed: %v", err))
+		return ErrorResult(fmt.Sprintf("search failed: %v", err)).WithError(Unavailable("search API", err))
 	}
 
 	return &ToolResult{
@@ -267,7 +275,8 @@ func (t *WebSearchTool) Execute(ctx context.Context, args map[string]interface{}
 }
 
 type WebFetchTool struct {
-	maxChars int
+	maxChars     int
+	maxBodyBytes int64
 }
 
 func NewWebFetchTool(maxChars int) *WebFetchTool {
@@ -275,7 +284,15 @@ func NewWebFetchTool(maxChars int) *WebFetchTool {
 		maxChars = 50000
 	}
 	return &WebFetchTool{
-		maxChars: maxChars,
+		maxChars:     maxChars,
+		maxBodyBytes: 10 << 20,
+	}
+}
+
+// SetMaxBodyBytes caps how much of a response body is read into memory.
+func (t *WebFetchTool) SetMaxBodyBytes(n int64) {
+	if n > 0 {
+		t.maxBodyBytes = n
 	}
 }
 
@@ -283,6 +300,12 @@ func (t *WebFetchTool) Name() string {
 	return "web_fetch"
 }
 
+// ConcurrencySafe reports true. The per_tool cap still bounds how many
+// fetches run at once.
+func (t *WebFetchTool) ConcurrencySafe() bool {
+	return true
+}
+
 func (t *WebFetchTool) Description() string {
 	return "Fetch a URL and extract readable content (HTML to text). Use this to get weather info, news, articles, or any web content."
 }
@@ -414,7 +437,11 @@ func (t *WebFetchTool) Execute(ctx context.Context, args map[string]interface{})
 	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	maxBody := t.maxBodyBytes
+	if maxBody <= 0 {
+		maxBody = 10 << 20
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBody))
 	if err != nil {
 		return ErrorResult(fmt.Sprintf("failed to read response: %v", err))
 	}
@@ -0,0 +1,87 @@
+package tui
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/sipeed/picoclaw/pkg/agent"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// Backend is the agent the TUI talks to.
+type Backend interface {
+	// Send runs a turn in session and returns the reply. Slash commands
+	// are handled as in any chat.
+	Send(ctx context.Context, session, text string) (string, error)
+	// Sessions lists the sessions to switch between, latest first.
+	Sessions() []agent.SessionInfo
+	// History returns the messages of session.
+	History(session string) []providers.Message
+	// Models lists models to pick from; Model returns session's.
+	Models() []string
+	Model(session string) string
+}
+
+// AgentBackend drives al, with sessions keyed "cli:...".
+func AgentBackend(al *agent.AgentLoop) Backend {
+	return agentBackend{al}
+}
+
+type agentBackend struct {
+	al *agent.AgentLoop
+}
+
+func (b agentBackend) Send(ctx context.Context, session, text string) (string, error) {
+	return b.al.ProcessDirect(ctx, text, session)
+}
+
+func (b agentBackend) Sessions() []agent.SessionInfo {
+	return b.al.ListSessions("cli:")
+}
+
+func (b agentBackend) History(session string) []providers.Message {
+	return b.al.SessionHistory(session)
+}
+
+func (b agentBackend) Models() []string {
+	return b.al.KnownModels()
+}
+
+func (b agentBackend) Model(session string) string {
+	return b.al.SessionModel(session)
+}
+
+// historyEntries turns stored messages into transcript entries, with tool
+// calls as closed panels.
+func historyEntries(messages []providers.Message) []entry {
+	var entries []entry
+	calls := map[string]int{} // tool call ID -> entry index
+	for _, m := range messages {
+		switch m.Role {
+		case "user":
+			entries = append(entries, entry{kind: entryUser, text: m.Content})
+		case "assistant":
+			if m.Content != "" {
+				entries = append(entries, entry{kind: entryAssistant, text: m.Content})
+			}
+			for _, tc := range m.ToolCalls {
+				name, args := tc.Name, ""
+				if tc.Function != nil {
+					name, args = tc.Function.Name, tc.Function.Arguments
+				}
+				if args == "" && tc.Arguments != nil {
+					data, _ := json.Marshal(tc.Arguments)
+					args = string(data)
+				}
+				calls[tc.ID] = len(entries)
+				entries = append(entries, entry{kind: entryTool, tool: name, args: args})
+			}
+		case "tool":
+			if i, ok := calls[m.ToolCallID]; ok {
+				entries[i].done = true
+				entries[i].result = m.Content
+			}
+		}
+	}
+	return entries
+}
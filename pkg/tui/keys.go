@@ -0,0 +1,133 @@
+package tui
+
+import "unicode/utf8"
+
+// keyType names the keys the TUI handles; printable text is keyRune.
+type keyType int
+
+const (
+	keyRune keyType = iota
+	keyEnter
+	keyBackspace
+	keyDelete
+	keyTab
+	keyShiftTab
+	keyEsc
+	keyUp
+	keyDown
+	keyLeft
+	keyRight
+	keyHome
+	keyEnd
+	keyPgUp
+	keyPgDown
+	keyCtrlA
+	keyCtrlC
+	keyCtrlD
+	keyCtrlE
+	keyCtrlK
+	keyCtrlL
+	keyCtrlN
+	keyCtrlO
+	keyCtrlS
+	keyCtrlU
+	keyCtrlW
+	keyPasteStart // bracketed paste: Enter inserts a line break until keyPasteEnd
+	keyPasteEnd
+)
+
+// key is one key press.
+type key struct {
+	typ  keyType
+	rune rune // for keyRune
+}
+
+// ctrlKeys maps control bytes to keys.
+var ctrlKeys = map[byte]keyType{
+	0x01: keyCtrlA,
+	0x03: keyCtrlC,
+	0x04: keyCtrlD,
+	0x05: keyCtrlE,
+	0x09: keyTab,
+	0x0b: keyCtrlK,
+	0x0c: keyCtrlL,
+	0x0d: keyEnter,
+	0x0a: keyEnter,
+	0x0e: keyCtrlN,
+	0x0f: keyCtrlO,
+	0x13: keyCtrlS,
+	0x15: keyCtrlU,
+	0x17: keyCtrlW,
+	0x7f: keyBackspace,
+	0x08: keyBackspace,
+}
+
+// escapeKeys maps the escape sequences terminals send, without the
+// leading ESC, to keys.
+var escapeKeys = map[string]keyType{
+	"[A": keyUp, "[B": keyDown, "[C": keyRight, "[D": keyLeft,
+	"OA": keyUp, "OB": keyDown, "OC": keyRight, "OD": keyLeft,
+	"[H": keyHome, "[F": keyEnd, "OH": keyHome, "OF": keyEnd,
+	"[1~": keyHome, "[4~": keyEnd, "[7~": keyHome, "[8~": keyEnd,
+	"[3~": keyDelete, "[5~": keyPgUp, "[6~": keyPgDown,
+	"[Z":    keyShiftTab,
+	"[200~": keyPasteStart, "[201~": keyPasteEnd,
+}
+
+// parseKeys decodes the keys in buf. Bytes of an incomplete sequence at
+// the end are returned as rest, to be prefixed to the next read.
+func parseKeys(buf []byte) (keys []key, rest []byte) {
+	for len(buf) > 0 {
+		b := buf[0]
+		switch {
+		case b == 0x1b:
+			if len(buf) == 1 {
+				// A lone ESC is the Esc key; sequences arrive in one read
+				keys = append(keys, key{typ: keyEsc})
+				return keys, nil
+			}
+			n, k, ok := parseEscape(buf[1:])
+			if !ok {
+				keys = append(keys, key{typ: keyEsc})
+				buf = buf[1:]
+				continue
+			}
+			if k >= 0 {
+				keys = append(keys, key{typ: k})
+			}
+			buf = buf[1+n:]
+		case b < 0x20 || b == 0x7f:
+			if k, ok := ctrlKeys[b]; ok {
+				keys = append(keys, key{typ: k})
+			}
+			buf = buf[1:]
+		default:
+			if !utf8.FullRune(buf) {
+				return keys, buf
+			}
+			r, size := utf8.DecodeRune(buf)
+			keys = append(keys, key{typ: keyRune, rune: r})
+			buf = buf[size:]
+		}
+	}
+	return keys, nil
+}
+
+// parseEscape reads the sequence after an ESC. It returns its length and
+// key, -1 for sequences the TUI ignores, and false if seq doesn't start
+// with one.
+func parseEscape(seq []byte) (int, keyType, bool) {
+	if seq[0] != '[' && seq[0] != 'O' {
+		return 0, 0, false
+	}
+	// CSI and SS3 sequences end with a byte in 0x40-0x7e
+	for i := 1; i < len(seq); i++ {
+		if seq[i] >= 0x40 && seq[i] <= 0x7e {
+			if k, ok := escapeKeys[string(seq[:i+1])]; ok {
+				return i + 1, k, true
+			}
+			return i + 1, -1, true
+		}
+	}
+	return len(seq), -1, true
+}
@@ -0,0 +1,588 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// The TUI follows the model-update-view pattern: everything that happens
+// (a key, a reply, a tool starting) is a msg; update applies it to the
+// model and may return a cmd, run in the background, whose result is the
+// next msg; view draws the model. Only the app loop touches the model.
+
+type msg interface{}
+
+// cmd does slow work off the app loop and reports back with a msg.
+type cmd func() msg
+
+type (
+	keyMsg      key
+	tickMsg     time.Time
+	resizeMsg   struct{ width, height int }
+	activityMsg bus.Activity
+	replyMsg    struct {
+		text string
+		err  error
+	}
+	modelSetMsg struct{ err error }
+	quitMsg     struct{}
+	approvalMsg struct {
+		req    tools.ApprovalRequest
+		answer chan<- tools.ApprovalDecision
+	}
+)
+
+type mode int
+
+const (
+	modeChat mode = iota
+	modePicker
+	modeApproval
+)
+
+type entryKind int
+
+const (
+	entryUser entryKind = iota
+	entryAssistant
+	entryTool
+	entryInfo
+	entryError
+)
+
+// entry is one block of the transcript. Tool entries are panels showing
+// the call's arguments and result when expanded.
+type entry struct {
+	kind     entryKind
+	text     string
+	tool     string
+	args     string
+	result   string
+	done     bool
+	failed   bool
+	expanded bool
+}
+
+// picker is a filterable list shown instead of the transcript.
+type picker struct {
+	title    string
+	items    []pickerItem
+	filter   []rune
+	index    int
+	freeText bool // Enter with no match uses the filter as the value
+	choose   func(m *model, value string) cmd
+}
+
+type pickerItem struct {
+	label string
+	value string
+}
+
+// matches returns the items whose label contains the filter.
+func (p *picker) matches() []pickerItem {
+	filter := strings.ToLower(string(p.filter))
+	var out []pickerItem
+	for _, item := range p.items {
+		if strings.Contains(strings.ToLower(item.label), filter) {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+type model struct {
+	backend Backend
+	newKey  func() string // key for a new session
+
+	width, height int
+	session       string
+	modelName     string
+	entries       []entry
+
+	input        []rune
+	cursor       int
+	pasting      bool
+	inputHistory []string
+	historyIndex int // len(inputHistory) when not browsing
+
+	scroll   int // transcript lines scrolled up from the bottom
+	selected int // entry index of the selected tool panel, -1 for none
+
+	busy    bool
+	started time.Time
+	now     time.Time
+	frame   int
+	cancel  context.CancelFunc
+
+	mode     mode
+	picker   *picker
+	approval *approvalMsg
+	quitting bool
+}
+
+func newModel(backend Backend, session string) *model {
+	m := &model{
+		backend:  backend,
+		width:    80,
+		height:   24,
+		selected: -1,
+		now:      time.Now(),
+		newKey: func() string {
+			return "cli:" + time.Now().Format("20060102-150405")
+		},
+	}
+	m.openSession(session)
+	return m
+}
+
+// openSession shows session's history and model.
+func (m *model) openSession(session string) {
+	m.session = session
+	m.entries = historyEntries(m.backend.History(session))
+	m.modelName = m.backend.Model(session)
+	m.scroll = 0
+	m.selected = -1
+}
+
+func (m *model) update(message msg) cmd {
+	switch message := message.(type) {
+	case keyMsg:
+		return m.handleKey(key(message))
+	case tickMsg:
+		m.now = time.Time(message)
+		m.frame++
+	case resizeMsg:
+		m.width, m.height = message.width, message.height
+	case activityMsg:
+		m.handleActivity(bus.Activity(message))
+	case replyMsg:
+		m.busy = false
+		m.cancel = nil
+		switch {
+		case errors.Is(message.err, context.Canceled):
+			m.add(entry{kind: entryInfo, text: "Cancelled."})
+		case message.err != nil:
+			m.add(entry{kind: entryError, text: "Error: " + message.err.Error()})
+		default:
+			m.add(entry{kind: entryAssistant, text: message.text})
+		}
+		m.scroll = 0
+	case modelSetMsg:
+		if message.err != nil {
+			m.add(entry{kind: entryError, text: "Error: " + message.err.Error()})
+		} else {
+			m.modelName = m.backend.Model(m.session)
+			m.add(entry{kind: entryInfo, text: "Model: " + m.modelName})
+		}
+	case quitMsg:
+		m.quitting = true
+	case approvalMsg:
+		m.approval = &message
+		m.mode = modeApproval
+		m.picker = nil
+	}
+	return nil
+}
+
+func (m *model) add(e entry) {
+	m.entries = append(m.entries, e)
+}
+
+func (m *model) handleActivity(a bus.Activity) {
+	switch a.Kind {
+	case bus.ActivityToolStart:
+		m.add(entry{kind: entryTool, tool: a.Tool, args: a.Detail})
+	case bus.ActivityToolDone:
+		for i := len(m.entries) - 1; i >= 0; i-- {
+			e := &m.entries[i]
+			if e.kind == entryTool && e.tool == a.Tool && !e.done {
+				e.done, e.result, e.failed = true, a.Detail, a.IsError
+				return
+			}
+		}
+	}
+}
+
+func (m *model) handleKey(k key) cmd {
+	switch m.mode {
+	case modeApproval:
+		m.answerApproval(k)
+		return nil
+	case modePicker:
+		return m.pickerKey(k)
+	}
+
+	switch k.typ {
+	case keyCtrlC:
+		if m.busy && m.cancel != nil {
+			// A second Ctrl+C quits without waiting
+			m.cancel()
+			m.cancel = nil
+			m.add(entry{kind: entryInfo, text: "Cancelling…"})
+			return nil
+		}
+		m.quitting = true
+	case keyCtrlD:
+		if len(m.input) == 0 {
+			m.quitting = true
+		} else {
+			m.deleteAt(m.cursor)
+		}
+	case keyEnter:
+		if m.pasting {
+			m.insert('\n')
+			return nil
+		}
+		if m.selected >= 0 && len(m.input) == 0 {
+			m.entries[m.selected].expanded = !m.entries[m.selected].expanded
+			return nil
+		}
+		return m.submit()
+	case keyPasteStart:
+		m.pasting = true
+	case keyPasteEnd:
+		m.pasting = false
+	case keyTab:
+		m.selectTool(1)
+	case keyShiftTab:
+		m.selectTool(-1)
+	case keyCtrlO:
+		m.toggleTools()
+	case keyEsc:
+		m.selected = -1
+		m.scroll = 0
+	case keyPgUp:
+		m.scroll += m.bodyHeight() - 1
+	case keyPgDown:
+		m.scroll = max(0, m.scroll-(m.bodyHeight()-1))
+	case keyUp:
+		m.recall(-1)
+	case keyDown:
+		m.recall(1)
+	case keyCtrlS:
+		m.openSessionPicker()
+	case keyCtrlN:
+		m.newSession()
+	case keyCtrlL:
+		m.openModelPicker()
+	default:
+		m.edit(k)
+	}
+	return nil
+}
+
+// edit applies an editing key to the input line.
+func (m *model) edit(k key) {
+	switch k.typ {
+	case keyRune:
+		m.insert(k.rune)
+	case keyBackspace:
+		if m.cursor > 0 {
+			m.cursor--
+			m.deleteAt(m.cursor)
+		}
+	case keyDelete:
+		m.deleteAt(m.cursor)
+	case keyLeft:
+		m.cursor = max(0, m.cursor-1)
+	case keyRight:
+		m.cursor = min(len(m.input), m.cursor+1)
+	case keyHome, keyCtrlA:
+		m.cursor = 0
+	case keyEnd, keyCtrlE:
+		m.cursor = len(m.input)
+	case keyCtrlU:
+		m.input = append([]rune(nil), m.input[m.cursor:]...)
+		m.cursor = 0
+	case keyCtrlK:
+		m.input = m.input[:m.cursor]
+	case keyCtrlW:
+		start := m.cursor
+		for start > 0 && m.input[start-1] == ' ' {
+			start--
+		}
+		for start > 0 && m.input[start-1] != ' ' {
+			start--
+		}
+		m.input = append(m.input[:start], m.input[m.cursor:]...)
+		m.cursor = start
+	}
+}
+
+func (m *model) insert(r rune) {
+	m.input = append(m.input[:m.cursor], append([]rune{r}, m.input[m.cursor:]...)...)
+	m.cursor++
+}
+
+func (m *model) deleteAt(i int) {
+	if i < len(m.input) {
+		m.input = append(m.input[:i], m.input[i+1:]...)
+	}
+}
+
+// recall steps through earlier inputs.
+func (m *model) recall(step int) {
+	i := m.historyIndex + step
+	if i < 0 || i > len(m.inputHistory) {
+		return
+	}
+	m.historyIndex = i
+	if i == len(m.inputHistory) {
+		m.input = nil
+	} else {
+		m.input = []rune(m.inputHistory[i])
+	}
+	m.cursor = len(m.input)
+}
+
+// localCommands are handled by the TUI; other slash commands go to the
+// agent.
+var localCommands = map[string]func(m *model){
+	"/quit":           func(m *model) { m.quitting = true },
+	"/exit":           func(m *model) { m.quitting = true },
+	"/sessions":       (*model).openSessionPicker,
+	"/session":        (*model).openSessionPicker,
+	"/session resume": (*model).openSessionPicker,
+	"/new":            (*model).newSession,
+	"/session new":    (*model).newSession,
+	"/models":         (*model).openModelPicker,
+	"/help":           (*model).showHelp,
+}
+
+func (m *model) submit() cmd {
+	text := strings.TrimSpace(string(m.input))
+	if text == "" {
+		return nil
+	}
+	if text == "exit" || text == "quit" {
+		m.quitting = true
+		return nil
+	}
+	if run, ok := localCommands[text]; ok {
+		m.clearInput(text)
+		run(m)
+		return nil
+	}
+	if m.busy {
+		m.add(entry{kind: entryInfo, text: "Wait for the reply, or press Ctrl+C to cancel it."})
+		return nil
+	}
+
+	m.clearInput(text)
+	m.add(entry{kind: entryUser, text: text})
+	m.busy = true
+	m.started = m.now
+	m.scroll = 0
+	m.selected = -1
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	backend, session := m.backend, m.session
+	return func() msg {
+		reply, err := backend.Send(ctx, session, text)
+		return replyMsg{text: reply, err: err}
+	}
+}
+
+func (m *model) clearInput(text string) {
+	m.inputHistory = append(m.inputHistory, text)
+	m.historyIndex = len(m.inputHistory)
+	m.input = nil
+	m.cursor = 0
+}
+
+func (m *model) showHelp() {
+	m.add(entry{kind: entryInfo, text: strings.Join([]string{
+		"Enter sends; paste keeps line breaks. Up and Down recall earlier messages.",
+		"Tab and Shift+Tab select a tool panel, Enter opens or closes it, Ctrl+O opens or closes all.",
+		"PgUp and PgDn scroll, Esc returns to the bottom.",
+		"Ctrl+S or /sessions switches session, Ctrl+N or /new starts one, Ctrl+L or /models picks a model.",
+		"Ctrl+C cancels a reply in progress, or quits.",
+		"Other slash commands, like /usage, /tools off or /compact, go to the agent.",
+	}, "\n")})
+}
+
+// selectTool moves the selection to the next or previous tool panel,
+// past the last one to none, and scrolls it into view.
+func (m *model) selectTool(step int) {
+	i := m.selected
+	for {
+		switch {
+		case i < 0 && step > 0:
+			i = 0
+		case i < 0:
+			i = len(m.entries) - 1
+		default:
+			i += step
+		}
+		if i < 0 || i >= len(m.entries) {
+			m.selected = -1
+			m.scroll = 0
+			return
+		}
+		if m.entries[i].kind == entryTool {
+			m.selected = i
+			m.scrollTo(i)
+			return
+		}
+	}
+}
+
+// toggleTools opens every tool panel, or closes them all if all are open.
+func (m *model) toggleTools() {
+	open := true
+	for _, e := range m.entries {
+		if e.kind == entryTool && !e.expanded {
+			open = false
+			break
+		}
+	}
+	for i := range m.entries {
+		if m.entries[i].kind == entryTool {
+			m.entries[i].expanded = !open
+		}
+	}
+}
+
+func (m *model) openSessionPicker() {
+	if m.busy {
+		m.add(entry{kind: entryInfo, text: "Wait for the reply before switching sessions."})
+		return
+	}
+	items := []pickerItem{{label: "+ New session", value: ""}}
+	for _, s := range m.backend.Sessions() {
+		label := s.Title
+		if label == "" {
+			label = "(empty)"
+		}
+		label = fmt.Sprintf("%s  · %s, %s", label, s.Key, ago(m.now, s.Updated))
+		if s.Key == m.session {
+			label = "• " + label
+		}
+		items = append(items, pickerItem{label: label, value: s.Key})
+	}
+	m.picker = &picker{
+		title: "Switch session",
+		items: items,
+		index: min(1, len(items)-1),
+		choose: func(m *model, key string) cmd {
+			if key == "" {
+				m.newSession()
+			} else {
+				m.openSession(key)
+			}
+			return nil
+		},
+	}
+	m.mode = modePicker
+}
+
+func (m *model) newSession() {
+	if m.busy {
+		m.add(entry{kind: entryInfo, text: "Wait for the reply before starting a session."})
+		return
+	}
+	m.openSession(m.newKey())
+	m.add(entry{kind: entryInfo, text: "New session " + m.session + "."})
+}
+
+func (m *model) openModelPicker() {
+	if m.busy {
+		m.add(entry{kind: entryInfo, text: "Wait for the reply before changing the model."})
+		return
+	}
+	var items []pickerItem
+	for _, name := range m.backend.Models() {
+		label := name
+		if name == m.modelName {
+			label = "• " + name
+		}
+		items = append(items, pickerItem{label: label, value: name})
+	}
+	m.picker = &picker{
+		title:    "Pick a model for this session (type any name)",
+		items:    items,
+		freeText: true,
+		choose: func(m *model, name string) cmd {
+			backend, session := m.backend, m.session
+			return func() msg {
+				_, err := backend.Send(context.Background(), session, "/model "+name)
+				return modelSetMsg{err: err}
+			}
+		},
+	}
+	m.mode = modePicker
+}
+
+func (m *model) pickerKey(k key) cmd {
+	p := m.picker
+	matches := p.matches()
+	switch k.typ {
+	case keyEsc, keyCtrlC:
+		m.mode, m.picker = modeChat, nil
+	case keyUp:
+		p.index = max(0, p.index-1)
+	case keyDown, keyTab:
+		p.index = min(len(matches)-1, p.index+1)
+	case keyBackspace:
+		if len(p.filter) > 0 {
+			p.filter = p.filter[:len(p.filter)-1]
+			p.index = 0
+		}
+	case keyRune:
+		p.filter = append(p.filter, k.rune)
+		p.index = 0
+	case keyEnter:
+		value := ""
+		switch {
+		case p.index >= 0 && p.index < len(matches):
+			value = matches[p.index].value
+		case p.freeText && strings.TrimSpace(string(p.filter)) != "":
+			value = strings.TrimSpace(string(p.filter))
+		default:
+			return nil
+		}
+		m.mode, m.picker = modeChat, nil
+		return p.choose(m, value)
+	}
+	return nil
+}
+
+// answerApproval answers the pending approval with y, a or n; Esc and
+// Ctrl+C deny.
+func (m *model) answerApproval(k key) {
+	decision, label := tools.ApprovalDeny, "Denied"
+	switch {
+	case k.typ == keyRune && (k.rune == 'y' || k.rune == 'Y'):
+		decision, label = tools.ApprovalApprove, "Approved"
+	case k.typ == keyRune && (k.rune == 'a' || k.rune == 'A'):
+		decision, label = tools.ApprovalAlwaysAllow, "Always approved"
+	case k.typ == keyRune && (k.rune == 'n' || k.rune == 'N'), k.typ == keyEsc, k.typ == keyCtrlC:
+	default:
+		return
+	}
+	m.approval.answer <- decision
+	m.add(entry{kind: entryInfo, text: fmt.Sprintf("%s %s.", label, m.approval.req.Tool)})
+	m.approval = nil
+	m.mode = modeChat
+}
+
+// ago describes how long before now t was.
+func ago(now, t time.Time) string {
+	d := now.Sub(t)
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd ago", int(d.Hours()/24))
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package tui
+
+import (
+	"errors"
+	"os"
+)
+
+type terminal struct{}
+
+func openTerminal() (*terminal, error) {
+	return nil, errors.New("the TUI is not supported on this platform")
+}
+
+func (t *terminal) restore() {}
+
+func (t *terminal) size() (int, int) {
+	return 80, 24
+}
+
+func notifyResize(ch chan<- os.Signal) {}
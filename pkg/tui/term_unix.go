@@ -0,0 +1,57 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package tui
+
+import (
+	"os"
+	"os/signal"
+
+	"golang.org/x/sys/unix"
+)
+
+// terminal is a terminal in raw mode.
+type terminal struct {
+	fd       int
+	original *unix.Termios
+}
+
+// openTerminal switches stdin to raw mode: keys arrive one by one and are
+// not echoed.
+func openTerminal() (*terminal, error) {
+	fd := int(os.Stdin.Fd())
+	original, err := unix.IoctlGetTermios(fd, ioctlReadTermios)
+	if err != nil {
+		return nil, err
+	}
+	raw := *original
+	raw.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	raw.Oflag &^= unix.OPOST
+	raw.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	raw.Cflag &^= unix.CSIZE | unix.PARENB
+	raw.Cflag |= unix.CS8
+	raw.Cc[unix.VMIN] = 1
+	raw.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, ioctlWriteTermios, &raw); err != nil {
+		return nil, err
+	}
+	return &terminal{fd: fd, original: original}, nil
+}
+
+// restore leaves raw mode.
+func (t *terminal) restore() {
+	unix.IoctlSetTermios(t.fd, ioctlWriteTermios, t.original)
+}
+
+// size returns the terminal's width and height in cells.
+func (t *terminal) size() (int, int) {
+	ws, err := unix.IoctlGetWinsize(int(os.Stdout.Fd()), unix.TIOCGWINSZ)
+	if err != nil || ws.Col == 0 || ws.Row == 0 {
+		return 80, 24
+	}
+	return int(ws.Col), int(ws.Row)
+}
+
+// notifyResize sends on ch when the terminal is resized.
+func notifyResize(ch chan<- os.Signal) {
+	signal.Notify(ch, unix.SIGWINCH)
+}
@@ -0,0 +1,145 @@
+// Package tui is the interactive terminal interface of "picoclaw agent":
+// a full-screen chat with live tool panels that open to show arguments and
+// results, a session switcher and a model picker. It needs a Unix
+// terminal; callers fall back to line-based input when Run fails to start.
+package tui
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// App runs the TUI for one backend.
+type App struct {
+	model  *model
+	events chan msg
+	out    io.Writer
+}
+
+// New creates the TUI, opening session.
+func New(backend Backend, session string) *App {
+	return &App{
+		model:  newModel(backend, session),
+		events: make(chan msg, 256),
+		out:    os.Stdout,
+	}
+}
+
+// Activity shows what the agent is doing; pass it to
+// bus.MessageBus.WatchActivity for the "cli" channel. It never blocks.
+func (a *App) Activity(act bus.Activity) {
+	select {
+	case a.events <- activityMsg(act):
+	default:
+	}
+}
+
+// Approve asks the user to approve a tool call; pass it to
+// agent.AgentLoop.SetApprover.
+func (a *App) Approve(ctx context.Context, req tools.ApprovalRequest) (tools.ApprovalDecision, error) {
+	answer := make(chan tools.ApprovalDecision, 1)
+	select {
+	case a.events <- approvalMsg{req: req, answer: answer}:
+	case <-ctx.Done():
+		return tools.ApprovalDeny, ctx.Err()
+	}
+	select {
+	case decision := <-answer:
+		return decision, nil
+	case <-ctx.Done():
+		return tools.ApprovalDeny, ctx.Err()
+	}
+}
+
+// Run takes over the terminal until the user quits. It returns an error
+// without touching the screen if the terminal can't be used.
+func (a *App) Run() error {
+	term, err := openTerminal()
+	if err != nil {
+		return err
+	}
+	defer term.restore()
+
+	// Alternate screen, bracketed paste
+	fmt.Fprint(a.out, "\x1b[?1049h\x1b[?2004h")
+	defer fmt.Fprint(a.out, "\x1b[?2004l\x1b[?1049l")
+
+	m := a.model
+	m.width, m.height = term.size()
+
+	go a.readKeys()
+	resize := make(chan os.Signal, 1)
+	notifyResize(resize)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	a.draw()
+	for !m.quitting {
+		var message msg
+		select {
+		case message = <-a.events:
+		case <-resize:
+			w, h := term.size()
+			message = resizeMsg{width: w, height: h}
+		case now := <-ticker.C:
+			if !m.busy {
+				m.now = now
+				continue
+			}
+			message = tickMsg(now)
+		}
+		if c := m.update(message); c != nil {
+			go func() { a.events <- c() }()
+		}
+		a.draw()
+	}
+
+	if m.cancel != nil {
+		m.cancel()
+	}
+	if m.approval != nil {
+		m.approval.answer <- tools.ApprovalDeny
+	}
+	return nil
+}
+
+// readKeys feeds key presses to the app loop.
+func (a *App) readKeys() {
+	buf := make([]byte, 4096)
+	var rest []byte
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			a.events <- quitMsg{}
+			return
+		}
+		var keys []key
+		keys, rest = parseKeys(append(rest, buf[:n]...))
+		for _, k := range keys {
+			a.events <- keyMsg(k)
+		}
+	}
+}
+
+// draw repaints the whole screen in one write.
+func (a *App) draw() {
+	rows, cursorRow, cursorCol := a.model.view()
+	var b strings.Builder
+	b.WriteString("\x1b[?25l\x1b[H")
+	for i, row := range rows {
+		if i > 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString(row)
+		b.WriteString("\x1b[K")
+	}
+	fmt.Fprintf(&b, "\x1b[%d;%dH\x1b[?25h", cursorRow+1, cursorCol+1)
+	io.WriteString(a.out, b.String())
+}
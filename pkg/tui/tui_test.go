@@ -0,0 +1,199 @@
+package tui
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/agent"
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// fakeBackend answers every message with "re: <text>" and remembers the
+// model set with /model.
+type fakeBackend struct {
+	sent    []string
+	model   string
+	history map[string][]providers.Message
+}
+
+func (b *fakeBackend) Send(ctx context.Context, session, text string) (string, error) {
+	b.sent = append(b.sent, session+" "+text)
+	if name, ok := strings.CutPrefix(text, "/model "); ok {
+		b.model = name
+	}
+	return "re: " + text, nil
+}
+
+func (b *fakeBackend) Sessions() []agent.SessionInfo {
+	return []agent.SessionInfo{
+		{Key: "cli:default", Title: "first chat", Updated: time.Now()},
+		{Key: "cli:old", Title: "trip planning", Updated: time.Now().Add(-48 * time.Hour)},
+	}
+}
+
+func (b *fakeBackend) History(session string) []providers.Message {
+	return b.history[session]
+}
+
+func (b *fakeBackend) Models() []string {
+	return []string{"big-model", "small-model"}
+}
+
+func (b *fakeBackend) Model(session string) string {
+	if b.model == "" {
+		return "big-model"
+	}
+	return b.model
+}
+
+// typeKeys feeds raw terminal input to m, running commands to completion.
+func typeKeys(m *model, input string) {
+	keys, _ := parseKeys([]byte(input))
+	for _, k := range keys {
+		run(m, m.update(keyMsg(k)))
+	}
+}
+
+func run(m *model, c cmd) {
+	for c != nil {
+		c = m.update(c())
+	}
+}
+
+func screen(m *model) string {
+	rows, _, _ := m.view()
+	return strings.Join(rows, "\n")
+}
+
+// TestParseKeys verifies text, control keys, escape sequences and split
+// UTF-8 are decoded.
+func TestParseKeys(t *testing.T) {
+	keys, rest := parseKeys([]byte("hé\r\x1b[A\x1b[3~\x03\x1b[200~\xe2\x82"))
+	want := []key{{typ: keyRune, rune: 'h'}, {typ: keyRune, rune: 'é'}, {typ: keyEnter}, {typ: keyUp},
+		{typ: keyDelete}, {typ: keyCtrlC}, {typ: keyPasteStart}}
+	if len(keys) != len(want) {
+		t.Fatalf("Expected %d keys, got %v", len(want), keys)
+	}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Errorf("Key %d: expected %v, got %v", i, want[i], keys[i])
+		}
+	}
+	if string(rest) != "\xe2\x82" {
+		t.Errorf("Expected the incomplete rune to be kept, got %q", rest)
+	}
+	if keys, _ := parseKeys([]byte{0x1b}); len(keys) != 1 || keys[0].typ != keyEsc {
+		t.Errorf("Expected a lone ESC to be Esc, got %v", keys)
+	}
+}
+
+// TestModel_ChatWithToolPanels verifies a message is sent, tool activity
+// appears as a panel that opens to show its arguments and result, and the
+// reply is shown.
+func TestModel_ChatWithToolPanels(t *testing.T) {
+	backend := &fakeBackend{}
+	m := newModel(backend, "cli:default")
+	m.width, m.height = 60, 20
+
+	keys, _ := parseKeys([]byte("list files\r"))
+	var pending cmd
+	for _, k := range keys {
+		if c := m.update(keyMsg(k)); c != nil {
+			pending = c
+		}
+	}
+	if !m.busy || pending == nil {
+		t.Fatal("Expected a turn to start")
+	}
+	if s := screen(m); !strings.Contains(s, "thinking") {
+		t.Errorf("Expected a thinking status, got:\n%s", s)
+	}
+
+	m.update(activityMsg{Kind: bus.ActivityToolStart, Tool: "list_dir", Detail: `{"path":"."}`})
+	if s := screen(m); !strings.Contains(s, "running list_dir") || !strings.Contains(s, `list_dir  {"path":"."}`) {
+		t.Errorf("Expected the running tool, got:\n%s", s)
+	}
+	m.update(activityMsg{Kind: bus.ActivityToolDone, Tool: "list_dir", Detail: "notes.txt\ntodo.md"})
+	run(m, pending)
+	if m.busy || backend.sent[0] != "cli:default list files" {
+		t.Fatalf("Expected the turn to finish, sent %v", backend.sent)
+	}
+	if s := screen(m); !strings.Contains(s, "re: list files") || strings.Contains(s, "todo.md") {
+		t.Errorf("Expected the reply and a closed panel, got:\n%s", s)
+	}
+
+	typeKeys(m, "\t\r")
+	if s := screen(m); !strings.Contains(s, "Result") || !strings.Contains(s, "todo.md") {
+		t.Errorf("Expected the selected panel to open, got:\n%s", s)
+	}
+	typeKeys(m, "\x0f")
+	if s := screen(m); strings.Contains(s, "todo.md") {
+		t.Errorf("Expected Ctrl+O to close all panels, got:\n%s", s)
+	}
+}
+
+// TestModel_SessionsAndModels verifies switching session loads its
+// history, and picking a model sends /model.
+func TestModel_SessionsAndModels(t *testing.T) {
+	backend := &fakeBackend{history: map[string][]providers.Message{
+		"cli:old": {
+			{Role: "user", Content: "plan a trip"},
+			{Role: "assistant", ToolCalls: []providers.ToolCall{{ID: "1", Name: "web_search", Arguments: map[string]interface{}{"q": "trains"}}}},
+			{Role: "tool", ToolCallID: "1", Content: "ICE 123"},
+			{Role: "assistant", Content: "Take the ICE."},
+		},
+	}}
+	m := newModel(backend, "cli:default")
+	m.width, m.height = 80, 20
+
+	typeKeys(m, "\x13trip\r")
+	if m.session != "cli:old" || len(m.entries) != 3 || m.entries[1].tool != "web_search" || m.entries[1].result != "ICE 123" {
+		t.Fatalf("Expected cli:old with its tool call, got %s %+v", m.session, m.entries)
+	}
+
+	typeKeys(m, "\x0ctiny-model\r")
+	if m.modelName != "tiny-model" || backend.sent[len(backend.sent)-1] != "cli:old /model tiny-model" {
+		t.Errorf("Expected the typed model to be set, got %q after %v", m.modelName, backend.sent)
+	}
+
+	typeKeys(m, "/new\r")
+	if m.session == "cli:old" || len(m.entries) != 1 {
+		t.Errorf("Expected a fresh session, got %s with %d entries", m.session, len(m.entries))
+	}
+}
+
+// TestModel_Approval verifies an approval prompt takes over the keys until
+// answered.
+func TestModel_Approval(t *testing.T) {
+	m := newModel(&fakeBackend{}, "cli:default")
+	answer := make(chan tools.ApprovalDecision, 1)
+	m.update(approvalMsg{req: tools.ApprovalRequest{Tool: "exec", Summary: "rm -rf build"}, answer: answer})
+	if s := screen(m); !strings.Contains(s, "exec wants to run") || !strings.Contains(s, "rm -rf build") {
+		t.Errorf("Expected the approval prompt, got:\n%s", s)
+	}
+
+	typeKeys(m, "xa")
+	if got := <-answer; got != tools.ApprovalAlwaysAllow {
+		t.Errorf("Expected always, got %v", got)
+	}
+	if m.mode != modeChat || len(m.input) != 0 {
+		t.Errorf("Expected the keys to be used by the prompt, got mode %v input %q", m.mode, string(m.input))
+	}
+}
+
+// TestWrap verifies text is wrapped at spaces, long words are broken and
+// wide characters take two cells.
+func TestWrap(t *testing.T) {
+	got := wrap("the quick brown fox\nsupercalifragilistic 你好你好", 10)
+	want := []string{"the quick", "brown fox", "supercalif", "ragilistic", "你好你好"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	if s := truncate("你好世界", 5); s != "你好…" {
+		t.Errorf("Expected %q, got %q", "你好…", s)
+	}
+}
@@ -0,0 +1,383 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ANSI styles.
+const (
+	styleReset   = "\x1b[0m"
+	styleBold    = "\x1b[1m"
+	styleDim     = "\x1b[2m"
+	styleReverse = "\x1b[7m"
+	styleRed     = "\x1b[31m"
+	styleGreen   = "\x1b[32m"
+	styleYellow  = "\x1b[33m"
+	styleCyan    = "\x1b[36m"
+)
+
+var spinner = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// maxPanelLines bounds each part of an open tool panel.
+const maxPanelLines = 30
+
+// line is one row of output before styling.
+type line struct {
+	text  string
+	style string
+}
+
+func (l line) String() string {
+	if l.style == "" {
+		return l.text
+	}
+	return l.style + l.text + styleReset
+}
+
+// bodyHeight is the number of rows between the header and the status
+// line.
+func (m *model) bodyHeight() int {
+	input, _, _ := m.inputLines()
+	return max(1, m.height-2-len(input))
+}
+
+// view draws the screen: exactly m.height rows, and where the cursor goes.
+func (m *model) view() (rows []string, cursorRow, cursorCol int) {
+	header := fmt.Sprintf(" 🦞 picoclaw · %s · %s", m.session, m.modelName)
+	rows = append(rows, line{text: pad(truncate(header, m.width), m.width), style: styleReverse}.String())
+
+	height := m.bodyHeight()
+	var body []line
+	switch m.mode {
+	case modePicker:
+		body = m.pickerLines(height)
+	case modeApproval:
+		panel := m.approvalLines()
+		body = append(m.transcriptWindow(max(0, height-len(panel))), panel...)
+	default:
+		body = m.transcriptWindow(height)
+	}
+	for len(body) < height {
+		body = append(body, line{})
+	}
+	for _, l := range body[len(body)-height:] {
+		rows = append(rows, l.String())
+	}
+
+	rows = append(rows, m.statusLine().String())
+	input, row, col := m.inputLines()
+	rows = append(rows, input...)
+	return rows, len(rows) - len(input) + row, col
+}
+
+// statusLine says what the agent is doing, or which keys do what.
+func (m *model) statusLine() line {
+	if !m.busy {
+		hint := "Enter send · Tab tools · Ctrl+S sessions · Ctrl+L models · /help · Ctrl+C quit"
+		if m.scroll > 0 {
+			hint = fmt.Sprintf("↑ %d lines · Esc back to the bottom · ", m.scroll) + hint
+		}
+		return line{text: truncate(hint, m.width), style: styleDim}
+	}
+	elapsed := m.now.Sub(m.started).Round(time.Second)
+	activity := "thinking"
+	for i := len(m.entries) - 1; i >= 0; i-- {
+		if e := m.entries[i]; e.kind == entryTool && !e.done {
+			activity = "running " + e.tool
+			break
+		}
+	}
+	text := fmt.Sprintf("%s %s %s · Ctrl+C to cancel", spinner[m.frame%len(spinner)], activity, elapsed)
+	return line{text: truncate(text, m.width), style: styleYellow}
+}
+
+// inputLines wraps the prompt and input to the width and finds the
+// cursor. The input shows at most 5 rows, keeping the cursor's in view.
+func (m *model) inputLines() (rows []string, cursorRow, cursorCol int) {
+	prompt := "› "
+	width := max(1, m.width)
+	var current strings.Builder
+	current.WriteString(prompt)
+	col := stringWidth(prompt)
+	for i := 0; i <= len(m.input); i++ {
+		if i == m.cursor {
+			if col >= width {
+				rows = append(rows, current.String())
+				current.Reset()
+				col = 0
+			}
+			cursorRow, cursorCol = len(rows), col
+		}
+		if i == len(m.input) {
+			break
+		}
+		r := m.input[i]
+		if r == '\n' {
+			rows = append(rows, current.String())
+			current.Reset()
+			col = 0
+			continue
+		}
+		w := runeWidth(r)
+		if col+w > width {
+			rows = append(rows, current.String())
+			current.Reset()
+			col = 0
+		}
+		current.WriteRune(r)
+		col += w
+	}
+	rows = append(rows, current.String())
+
+	const maxRows = 5
+	if len(rows) > maxRows {
+		start := min(max(0, cursorRow-maxRows+1), len(rows)-maxRows)
+		rows = rows[start : start+maxRows]
+		cursorRow -= start
+	}
+	return rows, cursorRow, cursorCol
+}
+
+// transcript lays out all entries. starts holds the first line of each
+// entry.
+func (m *model) transcript() (lines []line, starts []int) {
+	width := max(10, m.width)
+	for i, e := range m.entries {
+		if i > 0 && !(e.kind == entryTool && m.entries[i-1].kind == entryTool) {
+			lines = append(lines, line{})
+		}
+		starts = append(starts, len(lines))
+		switch e.kind {
+		case entryUser:
+			lines = append(lines, line{text: "You", style: styleBold + styleCyan})
+			lines = append(lines, indent(e.text, "  ", width, "")...)
+		case entryAssistant:
+			lines = append(lines, line{text: "🦞 picoclaw", style: styleBold})
+			lines = append(lines, indent(e.text, "  ", width, "")...)
+		case entryInfo:
+			lines = append(lines, indent(e.text, "  ", width, styleDim)...)
+		case entryError:
+			lines = append(lines, indent(e.text, "  ", width, styleRed)...)
+		case entryTool:
+			lines = append(lines, m.toolLines(i, e, width)...)
+		}
+	}
+	return lines, starts
+}
+
+// toolLines draws a tool panel: one line when closed, the arguments and
+// result when open.
+func (m *model) toolLines(i int, e entry, width int) []line {
+	mark, style := spinner[m.frame%len(spinner)], styleYellow
+	switch {
+	case e.done && e.failed:
+		mark, style = "✗", styleRed
+	case e.done:
+		mark, style = "✓", styleGreen
+	}
+	arrow := "▸"
+	if e.expanded {
+		arrow = "▾"
+	}
+	title := fmt.Sprintf("  %s %s %s", arrow, mark, e.tool)
+	if !e.expanded && e.args != "" {
+		title += "  " + strings.Join(strings.Fields(e.args), " ")
+	}
+	titleLine := line{text: truncate(title, width), style: style}
+	if i == m.selected {
+		titleLine.style = styleReverse
+	}
+	lines := []line{titleLine}
+	if !e.expanded {
+		return lines
+	}
+	for _, part := range []struct{ label, text string }{{"Arguments", e.args}, {"Result", e.result}} {
+		if part.text == "" {
+			continue
+		}
+		lines = append(lines, line{text: "    " + part.label, style: styleBold})
+		body := indent(part.text, "      ", width, styleDim)
+		if len(body) > maxPanelLines {
+			more := len(body) - maxPanelLines
+			body = append(body[:maxPanelLines], line{text: fmt.Sprintf("      … %d more lines", more), style: styleDim})
+		}
+		lines = append(lines, body...)
+	}
+	return lines
+}
+
+// transcriptWindow returns the height lines of the transcript in view,
+// clamping the scroll position.
+func (m *model) transcriptWindow(height int) []line {
+	lines, _ := m.transcript()
+	if len(lines) == 0 && height > 0 {
+		return []line{{text: "  Type a message to start. /help lists the keys.", style: styleDim}}
+	}
+	m.scroll = min(m.scroll, max(0, len(lines)-height))
+	end := len(lines) - m.scroll
+	return lines[max(0, end-height):end]
+}
+
+// scrollTo scrolls so that entry i starts in view.
+func (m *model) scrollTo(i int) {
+	lines, starts := m.transcript()
+	height := m.bodyHeight()
+	top := len(lines) - height - m.scroll
+	bottom := len(lines) - m.scroll
+	switch start := starts[i]; {
+	case start < top:
+		m.scroll = len(lines) - height - start
+	case start >= bottom:
+		m.scroll = max(0, len(lines)-start-1)
+	}
+}
+
+func (m *model) pickerLines(height int) []line {
+	p := m.picker
+	lines := []line{
+		{text: " " + p.title, style: styleBold},
+		{text: " › " + string(p.filter) + "▏"},
+	}
+	matches := p.matches()
+	if len(matches) == 0 {
+		hint := " Nothing matches."
+		if p.freeText && len(p.filter) > 0 {
+			hint = " Enter uses " + string(p.filter) + "."
+		}
+		return append(lines, line{text: hint, style: styleDim})
+	}
+	room := max(1, height-len(lines)-1)
+	start := min(max(0, p.index-room+1), max(0, len(matches)-room))
+	for i := start; i < len(matches) && i < start+room; i++ {
+		l := line{text: truncate("   "+matches[i].label, m.width)}
+		if i == p.index {
+			l.style = styleReverse
+		}
+		lines = append(lines, l)
+	}
+	return append(lines, line{text: " ↑↓ choose · Enter select · Esc cancel", style: styleDim})
+}
+
+func (m *model) approvalLines() []line {
+	req := m.approval.req
+	lines := []line{{}, {text: fmt.Sprintf("⚠️  %s wants to run:", req.Tool), style: styleBold + styleYellow}}
+	body := indent(req.Summary, "  ", max(10, m.width), "")
+	if len(body) > maxPanelLines {
+		body = append(body[:maxPanelLines], line{text: "  …", style: styleDim})
+	}
+	lines = append(lines, body...)
+	return append(lines, line{text: "[y]es · [a]lways · [n]o", style: styleBold})
+}
+
+// indent wraps text to width with prefix before every line.
+func indent(text, prefix string, width int, style string) []line {
+	var lines []line
+	for _, l := range wrap(text, max(1, width-stringWidth(prefix))) {
+		lines = append(lines, line{text: prefix + l, style: style})
+	}
+	return lines
+}
+
+// wrap breaks text into lines of at most width cells, at spaces where it
+// can.
+func wrap(text string, width int) []string {
+	var out []string
+	for _, paragraph := range strings.Split(strings.ReplaceAll(text, "\t", "    "), "\n") {
+		paragraph = strings.TrimRightFunc(paragraph, unicode.IsSpace)
+		if paragraph == "" {
+			out = append(out, "")
+			continue
+		}
+		var current []rune
+		col := 0
+		lastSpace := -1
+		for _, r := range paragraph {
+			w := runeWidth(r)
+			if col+w > width && len(current) > 0 {
+				if r == ' ' {
+					out = append(out, string(current))
+					current, col, lastSpace = nil, 0, -1
+					continue
+				}
+				if lastSpace > 0 {
+					out = append(out, string(current[:lastSpace]))
+					current = append([]rune(nil), current[lastSpace+1:]...)
+				} else {
+					out = append(out, string(current))
+					current = nil
+				}
+				col, lastSpace = 0, -1
+				for i, c := range current {
+					col += runeWidth(c)
+					if c == ' ' {
+						lastSpace = i
+					}
+				}
+			}
+			if r == ' ' {
+				lastSpace = len(current)
+			}
+			current = append(current, r)
+			col += w
+		}
+		out = append(out, string(current))
+	}
+	return out
+}
+
+// truncate cuts s to width cells, ending with an ellipsis if cut.
+func truncate(s string, width int) string {
+	if stringWidth(s) <= width {
+		return s
+	}
+	var b strings.Builder
+	col := 0
+	for _, r := range s {
+		w := runeWidth(r)
+		if col+w > width-1 {
+			break
+		}
+		b.WriteRune(r)
+		col += w
+	}
+	return b.String() + "…"
+}
+
+// pad fills s with spaces to width cells.
+func pad(s string, width int) string {
+	if n := width - stringWidth(s); n > 0 {
+		return s + strings.Repeat(" ", n)
+	}
+	return s
+}
+
+func stringWidth(s string) int {
+	w := 0
+	for _, r := range s {
+		w += runeWidth(r)
+	}
+	return w
+}
+
+// runeWidth returns the cells r takes: 0 for combining marks and control
+// characters, 2 for wide East Asian characters and emoji, 1 otherwise.
+func runeWidth(r rune) int {
+	switch {
+	case r < 0x20 || r == 0x7f || unicode.Is(unicode.Mn, r) || r == 0x200d || (r >= 0xfe00 && r <= 0xfe0f):
+		return 0
+	case r >= 0x1100 && r <= 0x115f, // Hangul Jamo
+		r >= 0x2e80 && r <= 0xa4cf && r != 0x303f, // CJK
+		r >= 0xac00 && r <= 0xd7a3,                // Hangul syllables
+		r >= 0xf900 && r <= 0xfaff,                // CJK compatibility
+		r >= 0xfe30 && r <= 0xfe4f,
+		r >= 0xff00 && r <= 0xff60, r >= 0xffe0 && r <= 0xffe6, // fullwidth forms
+		r >= 0x1f300 && r <= 0x1f64f, // symbols and emoji
+		r >= 0x1f900 && r <= 0x1f9ff,
+		r >= 0x20000 && r <= 0x3fffd:
+		return 2
+	}
+	return 1
+}
@@ -46,6 +46,11 @@ func SanitizeFilename(filename string) string {
 	return base
 }
 
+// MediaDir returns the directory downloaded attachments are kept in.
+func MediaDir() string {
+	return filepath.Join(os.TempDir(), "picoclaw_media")
+}
+
 // DownloadOptions holds optional parameters for downloading files
 type DownloadOptions struct {
 	Timeout      time.Duration
@@ -64,7 +69,7 @@ func DownloadFile(url, filename string, opts DownloadOptions) string {
 		opts.LoggerPrefix = "utils"
 	}
 
-	mediaDir := filepath.Join(os.TempDir(), "picoclaw_media")
+	mediaDir := MediaDir()
 	if err := os.MkdirAll(mediaDir, 0700); err != nil {
 		logger.ErrorCF(opts.LoggerPrefix, "Failed to create media directory", map[string]interface{}{
 			"error": err.Error(),
@@ -0,0 +1,91 @@
+package voice
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// PiperSynthesizer speaks with Piper (https://github.com/rhasspy/piper), a
+// local TTS engine that runs on a Raspberry Pi, so spoken replies need no
+// API key or network. Piper writes WAV; with ffmpeg installed the audio is
+// converted to OGG/Opus so it arrives as a voice note.
+type PiperSynthesizer struct {
+	binary string
+	model  string
+	ffmpeg string // empty if ffmpeg isn't installed
+}
+
+// NewPiperSynthesizer returns a synthesizer running the piper binary
+// (found on PATH if empty) with the voice model, an .onnx file.
+func NewPiperSynthesizer(binary, model string) (*PiperSynthesizer, error) {
+	if binary == "" {
+		binary = "piper"
+	}
+	path, err := exec.LookPath(binary)
+	if err != nil {
+		return nil, fmt.Errorf("piper not found: %w", err)
+	}
+	if model == "" {
+		return nil, fmt.Errorf("no piper voice model set")
+	}
+	if _, err := os.Stat(model); err != nil {
+		return nil, fmt.Errorf("piper voice model: %w", err)
+	}
+	ffmpeg, _ := exec.LookPath("ffmpeg")
+	return &PiperSynthesizer{binary: path, model: model, ffmpeg: ffmpeg}, nil
+}
+
+func (s *PiperSynthesizer) Synthesize(ctx context.Context, text string) ([]byte, string, error) {
+	dir, err := os.MkdirTemp("", "picoclaw-piper-")
+	if err != nil {
+		return nil, "", err
+	}
+	defer os.RemoveAll(dir)
+
+	wav := filepath.Join(dir, "speech.wav")
+	cmd := exec.CommandContext(ctx, s.binary, "--model", s.model, "--output_file", wav)
+	cmd.Stdin = strings.NewReader(text)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, "", fmt.Errorf("piper failed: %w: %s", err, lastLine(stderr.String()))
+	}
+
+	audio, ext := wav, ".wav"
+	if s.ffmpeg != "" {
+		ogg := filepath.Join(dir, "speech.ogg")
+		cmd := exec.CommandContext(ctx, s.ffmpeg, "-y", "-loglevel", "error", "-i", wav, "-c:a", "libopus", "-b:a", "32k", ogg)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			// A WAV reply still works, as an audio file instead of a voice note
+			logger.WarnCF("voice", "Failed to convert speech to OGG/Opus, sending WAV",
+				map[string]interface{}{"error": err.Error(), "output": lastLine(string(out))})
+		} else {
+			audio, ext = ogg, ".ogg"
+		}
+	}
+
+	data, err := os.ReadFile(audio)
+	if err != nil {
+		return nil, "", fmt.Errorf("piper wrote no audio: %w", err)
+	}
+	logger.DebugCF("voice", "Speech synthesized", map[string]interface{}{
+		"engine": "piper",
+		"chars":  len(text),
+		"bytes":  len(data),
+	})
+	return data, ext, nil
+}
+
+// lastLine returns the last non-empty line of a program's output, which
+// usually says what went wrong.
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
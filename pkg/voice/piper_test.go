@@ -0,0 +1,43 @@
+package voice
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// TestPiperSynthesizer verifies the text goes to piper on stdin with the
+// voice model, and its WAV comes back when ffmpeg isn't there
+func TestPiperSynthesizer(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("piper is faked with a shell script")
+	}
+	dir := t.TempDir()
+	model := filepath.Join(dir, "en_US-test.onnx")
+	os.WriteFile(model, []byte("model"), 0644)
+	// Writes "RIFF", the model and the text to the --output_file
+	fake := filepath.Join(dir, "piper")
+	os.WriteFile(fake, []byte("#!/bin/sh\n{ printf RIFF; printf '%s|' \"$2\"; cat; } > \"$4\"\n"), 0755)
+
+	s, err := NewPiperSynthesizer(fake, model)
+	if err != nil {
+		t.Fatalf("NewPiperSynthesizer failed: %v", err)
+	}
+	s.ffmpeg = ""
+	audio, ext, err := s.Synthesize(context.Background(), "Hello there.")
+	if err != nil {
+		t.Fatalf("Synthesize failed: %v", err)
+	}
+	if ext != ".wav" || string(audio) != "RIFF"+model+"|Hello there." {
+		t.Errorf("Expected the WAV piper wrote, got %s %q", ext, audio)
+	}
+
+	if _, err := NewPiperSynthesizer(fake, filepath.Join(dir, "missing.onnx")); err == nil {
+		t.Error("Expected an error for a missing voice model")
+	}
+	if _, err := NewPiperSynthesizer(filepath.Join(dir, "no-piper"), model); err == nil {
+		t.Error("Expected an error for a missing piper binary")
+	}
+}
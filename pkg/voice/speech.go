@@ -0,0 +1,128 @@
+package voice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// Synthesizer turns text into speech for voice replies. The audio comes
+// with its file extension: ".ogg" is OGG/Opus, which chat apps show as a
+// voice note; other formats are sent as audio files.
+type Synthesizer interface {
+	Synthesize(ctx context.Context, text string) (audio []byte, ext string, err error)
+}
+
+// SpeechSynthesizer turns text into an OGG/Opus voice note through an
+// OpenAI-compatible /audio/speech endpoint.
+type SpeechSynthesizer struct {
+	apiKey     string
+	apiBase    string
+	model      string
+	voice      string
+	httpClient *http.Client
+}
+
+func NewSpeechSynthesizer(apiBase, apiKey, model, voice string) *SpeechSynthesizer {
+	if apiBase == "" {
+		apiBase = "https://api.openai.com/v1"
+	}
+	if model == "" {
+		model = "gpt-4o-mini-tts"
+	}
+	if voice == "" {
+		voice = "alloy"
+	}
+	return &SpeechSynthesizer{
+		apiKey:  apiKey,
+		apiBase: strings.TrimRight(apiBase, "/"),
+		model:   model,
+		voice:   voice,
+		httpClient: &http.Client{
+			Timeout: 60 * time.Second,
+		},
+	}
+}
+
+// Synthesize returns text spoken as OGG/Opus audio, the format chat apps
+// use for voice notes.
+func (s *SpeechSynthesizer) Synthesize(ctx context.Context, text string) ([]byte, string, error) {
+	body, err := json.Marshal(map[string]string{
+		"model":           s.model,
+		"voice":           s.voice,
+		"input":           text,
+		"response_format": "opus",
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", s.apiBase+"/audio/speech", bytes.NewReader(body))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+s.apiKey)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	audio, err := io.ReadAll(io.LimitReader(resp.Body, 25<<20))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(audio))
+	}
+
+	logger.DebugCF("voice", "Speech synthesized", map[string]interface{}{
+		"chars": len(text),
+		"bytes": len(audio),
+	})
+	return audio, ".ogg", nil
+}
+
+func (s *SpeechSynthesizer) IsAvailable() bool {
+	return s.apiKey != ""
+}
+
+var (
+	markdownLink   = regexp.MustCompile(`\[([^\]]+)\]\([^)]+\)`)
+	markdownCode   = regexp.MustCompile("(?s)```.*?```")
+	markdownMarks  = regexp.MustCompile("[*_`#>~|]+")
+	bareURL        = regexp.MustCompile(`https?://\S+`)
+	sentenceEnding = regexp.MustCompile(`[.!?](\s|$)`)
+)
+
+// SpeakableText prepares a chat reply for speech: markdown is dropped, code
+// blocks and URLs are left for the text reply, and the result is cut at a
+// sentence boundary to at most maxChars (0 for no limit).
+func SpeakableText(text string, maxChars int) string {
+	text = markdownCode.ReplaceAllString(text, " ")
+	text = markdownLink.ReplaceAllString(text, "$1")
+	text = bareURL.ReplaceAllString(text, "")
+	text = markdownMarks.ReplaceAllString(text, "")
+	text = strings.Join(strings.Fields(text), " ")
+
+	if maxChars <= 0 || len(text) <= maxChars {
+		return text
+	}
+	cut := text[:maxChars]
+	if ends := sentenceEnding.FindAllStringIndex(cut, -1); len(ends) > 0 {
+		return cut[:ends[len(ends)-1][0]+1]
+	}
+	if i := strings.LastIndexByte(cut, ' '); i > 0 {
+		cut = cut[:i]
+	}
+	return cut + "..."
+}
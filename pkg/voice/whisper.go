@@ -0,0 +1,198 @@
+package voice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// Transcriber turns a voice message into text.
+type Transcriber interface {
+	Transcribe(ctx context.Context, audioFilePath string) (*TranscriptionResponse, error)
+	IsAvailable() bool
+}
+
+// WhisperServerTranscriber sends voice messages to a whisper.cpp server
+// (https://github.com/ggerganov/whisper.cpp, examples/server), so speech is
+// recognized on your own machine or network.
+type WhisperServerTranscriber struct {
+	url        string
+	language   string
+	ffmpeg     string // empty if ffmpeg isn't installed
+	httpClient *http.Client
+}
+
+// NewWhisperServerTranscriber returns a transcriber posting to the server
+// at url, e.g. http://localhost:8080. language is a code such as "en", or
+// empty to detect it.
+func NewWhisperServerTranscriber(url, language string) *WhisperServerTranscriber {
+	ffmpeg, _ := exec.LookPath("ffmpeg")
+	return &WhisperServerTranscriber{
+		url:      strings.TrimRight(url, "/"),
+		language: language,
+		ffmpeg:   ffmpeg,
+		httpClient: &http.Client{
+			Timeout: 120 * time.Second,
+		},
+	}
+}
+
+func (t *WhisperServerTranscriber) Transcribe(ctx context.Context, audioFilePath string) (*TranscriptionResponse, error) {
+	// Without ffmpeg here, the server has to convert (whisper-server --convert)
+	wav := audioFilePath
+	if t.ffmpeg != "" {
+		converted, cleanup, err := toWAV(ctx, t.ffmpeg, audioFilePath)
+		if err != nil {
+			return nil, err
+		}
+		defer cleanup()
+		wav = converted
+	}
+	audio, err := os.ReadFile(wav)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audio file: %w", err)
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", filepath.Base(wav))
+	if err != nil {
+		return nil, err
+	}
+	part.Write(audio)
+	writer.WriteField("response_format", "json")
+	if t.language != "" {
+		writer.WriteField("language", t.language)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", t.url+"/inference", &body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("whisper server error (status %d): %s", resp.StatusCode, string(data))
+	}
+	var result TranscriptionResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	result.Text = strings.TrimSpace(result.Text)
+	logTranscription("whisper-server", &result)
+	return &result, nil
+}
+
+func (t *WhisperServerTranscriber) IsAvailable() bool {
+	return t.url != ""
+}
+
+// WhisperCLITranscriber runs the whisper.cpp command-line program with a
+// local model, for machines that transcribe without any server.
+type WhisperCLITranscriber struct {
+	binary   string
+	model    string
+	language string
+	ffmpeg   string
+}
+
+// NewWhisperCLITranscriber returns a transcriber running binary
+// (whisper-cli on PATH if empty) with model, a ggml .bin file. Voice
+// messages are converted to WAV first, which needs ffmpeg.
+func NewWhisperCLITranscriber(binary, model, language string) (*WhisperCLITranscriber, error) {
+	if binary == "" {
+		binary = "whisper-cli"
+	}
+	path, err := exec.LookPath(binary)
+	if err != nil {
+		return nil, fmt.Errorf("whisper.cpp not found: %w", err)
+	}
+	if _, err := os.Stat(model); err != nil {
+		return nil, fmt.Errorf("whisper model: %w", err)
+	}
+	ffmpeg, _ := exec.LookPath("ffmpeg")
+	return &WhisperCLITranscriber{binary: path, model: model, language: language, ffmpeg: ffmpeg}, nil
+}
+
+func (t *WhisperCLITranscriber) Transcribe(ctx context.Context, audioFilePath string) (*TranscriptionResponse, error) {
+	wav, cleanup, err := toWAV(ctx, t.ffmpeg, audioFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	args := []string{"-m", t.model, "-f", wav, "--no-timestamps", "--no-prints"}
+	if t.language != "" {
+		args = append(args, "-l", t.language)
+	} else {
+		args = append(args, "-l", "auto")
+	}
+	cmd := exec.CommandContext(ctx, t.binary, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("whisper.cpp failed: %w: %s", err, lastLine(stderr.String()))
+	}
+	result := &TranscriptionResponse{Text: strings.Join(strings.Fields(stdout.String()), " ")}
+	logTranscription("whisper", result)
+	return result, nil
+}
+
+func (t *WhisperCLITranscriber) IsAvailable() bool {
+	return true
+}
+
+// toWAV converts audio to the 16 kHz mono WAV whisper.cpp reads, returning
+// the converted file and a function removing it. WAV files are used as is.
+func toWAV(ctx context.Context, ffmpeg, path string) (string, func(), error) {
+	if strings.EqualFold(filepath.Ext(path), ".wav") {
+		return path, func() {}, nil
+	}
+	if ffmpeg == "" {
+		return "", nil, fmt.Errorf("ffmpeg is needed to convert %s for whisper.cpp", filepath.Ext(path))
+	}
+	dir, err := os.MkdirTemp("", "picoclaw-whisper-")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+	wav := filepath.Join(dir, "audio.wav")
+	cmd := exec.CommandContext(ctx, ffmpeg, "-y", "-loglevel", "error", "-i", path, "-ar", "16000", "-ac", "1", "-c:a", "pcm_s16le", wav)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("ffmpeg failed: %w: %s", err, lastLine(string(out)))
+	}
+	return wav, cleanup, nil
+}
+
+func logTranscription(engine string, result *TranscriptionResponse) {
+	logger.InfoCF("voice", "Transcription completed successfully", map[string]interface{}{
+		"engine":                engine,
+		"text_length":           len(result.Text),
+		"transcription_preview": utils.Truncate(result.Text, 50),
+	})
+}
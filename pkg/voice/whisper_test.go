@@ -0,0 +1,75 @@
+package voice
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// TestWhisperServerTranscriber verifies the audio and language are posted
+// to /inference and the text comes back trimmed
+func TestWhisperServerTranscriber(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/inference" {
+			t.Errorf("Expected /inference, got %s", r.URL.Path)
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			t.Fatalf("Expected an uploaded file: %v", err)
+		}
+		audio, _ := io.ReadAll(file)
+		if string(audio) != "RIFF" || r.FormValue("language") != "de" {
+			t.Errorf("Expected the WAV and language, got %q %q", audio, r.FormValue("language"))
+		}
+		w.Write([]byte(`{"text": " Wie wird das Wetter?\n"}`))
+	}))
+	defer server.Close()
+
+	wav := filepath.Join(t.TempDir(), "note.wav")
+	os.WriteFile(wav, []byte("RIFF"), 0644)
+	result, err := NewWhisperServerTranscriber(server.URL+"/", "de").Transcribe(context.Background(), wav)
+	if err != nil {
+		t.Fatalf("Transcribe failed: %v", err)
+	}
+	if result.Text != "Wie wird das Wetter?" {
+		t.Errorf("Expected the trimmed text, got %q", result.Text)
+	}
+}
+
+// TestWhisperCLITranscriber verifies whisper.cpp is run with the model and
+// file and its output joined into one line
+func TestWhisperCLITranscriber(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("whisper.cpp is faked with a shell script")
+	}
+	dir := t.TempDir()
+	model := filepath.Join(dir, "ggml-base.bin")
+	os.WriteFile(model, []byte("model"), 0644)
+	wav := filepath.Join(dir, "note.wav")
+	os.WriteFile(wav, []byte("RIFF"), 0644)
+	fake := filepath.Join(dir, "whisper-cli")
+	os.WriteFile(fake, []byte("#!/bin/sh\n[ \"$2\" = \"$MODEL\" ] && [ \"$4\" = \"$WAV\" ] || exit 1\nprintf ' Turn on\\n the lights.\\n'\n"), 0755)
+	t.Setenv("MODEL", model)
+	t.Setenv("WAV", wav)
+
+	tr, err := NewWhisperCLITranscriber(fake, model, "")
+	if err != nil {
+		t.Fatalf("NewWhisperCLITranscriber failed: %v", err)
+	}
+	result, err := tr.Transcribe(context.Background(), wav)
+	if err != nil {
+		t.Fatalf("Transcribe failed: %v", err)
+	}
+	if result.Text != "Turn on the lights." {
+		t.Errorf("Expected the joined text, got %q", result.Text)
+	}
+
+	if _, err := NewWhisperCLITranscriber(fake, filepath.Join(dir, "missing.bin"), ""); err == nil {
+		t.Error("Expected an error for a missing model")
+	}
+}
@@ -0,0 +1,262 @@
+// Package workflow loads and runs named multi-step recipes. A workflow is a
+// YAML file in the workspace's workflows/ directory; each step is a prompt
+// for the agent, optionally limited to some tools and followed by a check
+// that decides whether the step succeeded.
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Workflow is a named sequence of steps.
+type Workflow struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	Steps       []Step `yaml:"steps"`
+	Path        string `yaml:"-"`
+}
+
+// Step is one agent turn within a workflow.
+type Step struct {
+	Name   string `yaml:"name"`
+	Prompt string `yaml:"prompt"`
+	// Tools limits the tools offered during the step; empty allows all.
+	Tools []string `yaml:"tools"`
+	Check *Check   `yaml:"check"`
+	// Retries is how many more attempts the step gets when its check fails.
+	Retries int `yaml:"retries"`
+}
+
+// Check decides whether a step succeeded. All set conditions must hold.
+type Check struct {
+	Contains    string `yaml:"contains"`
+	NotContains string `yaml:"not_contains"`
+	Matches     string `yaml:"matches"`     // regular expression on the output
+	FileExists  string `yaml:"file_exists"` // path relative to the workspace
+}
+
+// StepRunner runs one step prompt with the given tool allowlist and returns
+// the agent's reply.
+type StepRunner func(ctx context.Context, prompt string, allowedTools []string) (string, error)
+
+// StepResult is the outcome of one step.
+type StepResult struct {
+	Name     string
+	Output   string
+	Attempts int
+	Err      error
+}
+
+// Result is the outcome of a workflow run.
+type Result struct {
+	Workflow string
+	Steps    []StepResult
+}
+
+// Succeeded reports whether every step passed.
+func (r *Result) Succeeded() bool {
+	for _, s := range r.Steps {
+		if s.Err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Load parses a workflow file. The name defaults to the file name.
+func Load(path string) (*Workflow, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var wf Workflow
+	if err := yaml.Unmarshal(data, &wf); err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	if wf.Name == "" {
+		wf.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	wf.Path = path
+	if err := wf.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	return &wf, nil
+}
+
+// LoadDir loads every .yaml/.yml workflow in dir, keyed by name. Files that
+// fail to parse are reported in errs and skipped.
+func LoadDir(dir string) (workflows map[string]*Workflow, errs []error) {
+	workflows = make(map[string]*Workflow)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+		return workflows, errs
+	}
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		wf, err := Load(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		workflows[wf.Name] = wf
+	}
+	return workflows, errs
+}
+
+// Names returns the sorted names of the workflows.
+func Names(workflows map[string]*Workflow) []string {
+	names := make([]string, 0, len(workflows))
+	for name := range workflows {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Validate checks that the workflow can run.
+func (wf *Workflow) Validate() error {
+	if len(wf.Steps) == 0 {
+		return fmt.Errorf("workflow %q has no steps", wf.Name)
+	}
+	for i := range wf.Steps {
+		step := &wf.Steps[i]
+		if step.Name == "" {
+			step.Name = fmt.Sprintf("step %d", i+1)
+		}
+		if strings.TrimSpace(step.Prompt) == "" {
+			return fmt.Errorf("%s: prompt is required", step.Name)
+		}
+		if step.Retries < 0 {
+			return fmt.Errorf("%s: retries must not be negative", step.Name)
+		}
+		if step.Check != nil && step.Check.Matches != "" {
+			if _, err := regexp.Compile(step.Check.Matches); err != nil {
+				return fmt.Errorf("%s: invalid check pattern: %w", step.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Run executes the steps in order and stops at the first step whose check
+// still fails after its retries. Prompts may use {{args}} for the text
+// given after the workflow name, {{previous}} for the prior step's output
+// and {{steps.<name>}} for any earlier step's output.
+func (wf *Workflow) Run(ctx context.Context, args, workspace string, run StepRunner, progress func(StepResult)) *Result {
+	result := &Result{Workflow: wf.Name}
+	outputs := make(map[string]string)
+	previous := ""
+
+	for _, step := range wf.Steps {
+		prompt := expand(step.Prompt, args, previous, outputs)
+		sr := StepResult{Name: step.Name}
+
+		for sr.Attempts <= step.Retries {
+			sr.Attempts++
+			output, err := run(ctx, prompt, step.Tools)
+			sr.Output = output
+			if err == nil {
+				err = step.Check.Evaluate(output, workspace)
+			}
+			sr.Err = err
+			if err == nil || ctx.Err() != nil {
+				break
+			}
+			prompt = fmt.Sprintf("The previous attempt at this step failed: %v\nTry again.\n\n%s", err, expand(step.Prompt, args, previous, outputs))
+		}
+
+		result.Steps = append(result.Steps, sr)
+		if progress != nil {
+			progress(sr)
+		}
+		if sr.Err != nil {
+			break
+		}
+		outputs[step.Name] = sr.Output
+		previous = sr.Output
+	}
+	return result
+}
+
+// expand fills the placeholders of a step prompt.
+func expand(prompt, args, previous string, outputs map[string]string) string {
+	replacements := []string{"{{args}}", args, "{{previous}}", previous}
+	for name, output := range outputs {
+		replacements = append(replacements, "{{steps."+name+"}}", output)
+	}
+	return strings.NewReplacer(replacements...).Replace(prompt)
+}
+
+// Evaluate returns nil if output satisfies the check. A nil check passes.
+func (c *Check) Evaluate(output, workspace string) error {
+	if c == nil {
+		return nil
+	}
+	if c.Contains != "" && !strings.Contains(output, c.Contains) {
+		return fmt.Errorf("output does not contain %q", c.Contains)
+	}
+	if c.NotContains != "" && strings.Contains(output, c.NotContains) {
+		return fmt.Errorf("output contains %q", c.NotContains)
+	}
+	if c.Matches != "" {
+		re, err := regexp.Compile(c.Matches)
+		if err != nil {
+			return err
+		}
+		if !re.MatchString(output) {
+			return fmt.Errorf("output does not match %q", c.Matches)
+		}
+	}
+	if c.FileExists != "" {
+		path := c.FileExists
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(workspace, path)
+		}
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("file %s does not exist", c.FileExists)
+		}
+	}
+	return nil
+}
+
+// Report renders the result for the user.
+func (r *Result) Report() string {
+	var sb strings.Builder
+	if r.Succeeded() {
+		fmt.Fprintf(&sb, "✅ Workflow %s completed (%d steps)\n", r.Workflow, len(r.Steps))
+	} else {
+		fmt.Fprintf(&sb, "❌ Workflow %s failed\n", r.Workflow)
+	}
+	for i, s := range r.Steps {
+		mark := "✓"
+		if s.Err != nil {
+			mark = "✗"
+		}
+		fmt.Fprintf(&sb, "\n%d. %s %s", i+1, mark, s.Name)
+		if s.Attempts > 1 {
+			fmt.Fprintf(&sb, " (%d attempts)", s.Attempts)
+		}
+		if s.Err != nil {
+			fmt.Fprintf(&sb, ": %v", s.Err)
+		}
+	}
+	if n := len(r.Steps); n > 0 && r.Steps[n-1].Output != "" {
+		sb.WriteString("\n\n")
+		sb.WriteString(r.Steps[n-1].Output)
+	}
+	return sb.String()
+}
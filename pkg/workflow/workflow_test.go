@@ -0,0 +1,119 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const backupReport = `
+description: Back up notes and report
+steps:
+  - name: backup
+    prompt: "Back up {{args}}"
+    tools: [exec]
+    check:
+      file_exists: backup.tar
+  - name: report
+    prompt: "Summarize: {{previous}}"
+    check:
+      contains: OK
+    retries: 1
+`
+
+// TestLoadDir verifies workflows are parsed and named after their file
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "backup-report.yaml"), []byte(backupReport), 0644)
+	os.WriteFile(filepath.Join(dir, "broken.yml"), []byte("steps: []\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("ignored"), 0644)
+
+	workflows, errs := LoadDir(dir)
+	if len(errs) != 1 {
+		t.Errorf("Expected 1 error for the broken workflow, got %v", errs)
+	}
+	wf, ok := workflows["backup-report"]
+	if !ok {
+		t.Fatalf("Expected backup-report workflow, got %v", Names(workflows))
+	}
+	if len(wf.Steps) != 2 || wf.Steps[0].Tools[0] != "exec" || wf.Steps[1].Retries != 1 {
+		t.Errorf("Unexpected steps: %+v", wf.Steps)
+	}
+}
+
+// TestRun verifies placeholders, checks and retries
+func TestRun(t *testing.T) {
+	workspace := t.TempDir()
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "backup-report.yaml"), []byte(backupReport), 0644)
+	wf, err := Load(filepath.Join(dir, "backup-report.yaml"))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	var prompts []string
+	run := func(ctx context.Context, prompt string, allowed []string) (string, error) {
+		prompts = append(prompts, prompt)
+		switch len(prompts) {
+		case 1:
+			os.WriteFile(filepath.Join(workspace, "backup.tar"), nil, 0644)
+			return "archived 3 files", nil
+		case 2:
+			return "not sure", nil
+		default:
+			return "OK: 3 files", nil
+		}
+	}
+
+	result := wf.Run(context.Background(), "~/notes", workspace, run, nil)
+	if !result.Succeeded() {
+		t.Fatalf("Expected success, got:\n%s", result.Report())
+	}
+	if prompts[0] != "Back up ~/notes" {
+		t.Errorf("Expected args placeholder expanded, got %q", prompts[0])
+	}
+	if prompts[1] != "Summarize: archived 3 files" {
+		t.Errorf("Expected previous placeholder expanded, got %q", prompts[1])
+	}
+	if result.Steps[1].Attempts != 2 || !strings.Contains(prompts[2], "failed") {
+		t.Errorf("Expected a retry with failure feedback, got %d attempts, prompt %q", result.Steps[1].Attempts, prompts[2])
+	}
+}
+
+// TestRun_StopsOnFailedCheck verifies later steps are skipped after a failure
+func TestRun_StopsOnFailedCheck(t *testing.T) {
+	wf := &Workflow{
+		Name: "two-steps",
+		Steps: []Step{
+			{Name: "first", Prompt: "one", Check: &Check{Matches: `^done$`}},
+			{Name: "second", Prompt: "two"},
+		},
+	}
+	calls := 0
+	run := func(ctx context.Context, prompt string, allowed []string) (string, error) {
+		calls++
+		return "", fmt.Errorf("provider down")
+	}
+
+	result := wf.Run(context.Background(), "", t.TempDir(), run, nil)
+	if result.Succeeded() || calls != 1 || len(result.Steps) != 1 {
+		t.Errorf("Expected failure after first step, got %d calls:\n%s", calls, result.Report())
+	}
+}
+
+// TestValidate verifies invalid definitions are rejected
+func TestValidate(t *testing.T) {
+	cases := []Workflow{
+		{Name: "empty"},
+		{Name: "no-prompt", Steps: []Step{{Name: "a"}}},
+		{Name: "bad-regex", Steps: []Step{{Prompt: "x", Check: &Check{Matches: "("}}}},
+	}
+	for _, wf := range cases {
+		if err := wf.Validate(); err == nil {
+			t.Errorf("Expected validation error for %s", wf.Name)
+		}
+	}
+}